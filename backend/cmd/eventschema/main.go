@@ -0,0 +1,152 @@
+// Command eventschema writes the JSON Schema of every event in
+// internal/events to backend/schemas/events, and checks them in CI.
+//
+// Writing refuses to replace a committed schema with one that breaks its
+// consumers; bump the event's version in internal/events instead, which
+// keeps the old version's file alongside the new one. -check writes
+// nothing: it fails if a committed schema is stale or missing, if an event
+// was removed, or if an event's Go type encodes to JSON its own schema
+// rejects.
+//
+//	cd backend && go generate ./cmd/eventschema
+//	cd backend && go run ./cmd/eventschema -check
+package main
+
+//go:generate go run . -dir ../../schemas/events
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"talkie/backend/internal/events"
+)
+
+var fileName = regexp.MustCompile(`^(.+)\.v(\d+)\.json$`)
+
+func main() {
+	dir := flag.String("dir", "schemas/events", "schema directory")
+	check := flag.Bool("check", false, "check the committed schemas instead of writing them")
+	flag.Parse()
+
+	var problems []string
+	latest := make(map[string]int)
+	for i := range events.Specs {
+		spec := &events.Specs[i]
+		key := string(spec.Kind) + "/" + spec.Name
+		if _, dup := latest[key]; dup {
+			problems = append(problems, fmt.Sprintf("%s: listed twice", key))
+			continue
+		}
+		latest[key] = spec.Version
+		problems = append(problems, sample(spec)...)
+
+		path := filepath.Join(*dir, spec.File())
+		next := spec.Schema()
+		data, err := encode(next)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if prev, err := read(path); err == nil {
+			if issues := events.Breaking(prev, next); len(issues) > 0 {
+				problems = append(problems, fmt.Sprintf("%s: breaking change to v%d, bump its version:\n    %s",
+					key, spec.Version, strings.Join(issues, "\n    ")))
+				continue
+			}
+		} else if !os.IsNotExist(err) {
+			log.Fatal(err)
+		}
+		if *check {
+			committed, err := os.ReadFile(path)
+			if err != nil || !bytes.Equal(committed, data) {
+				problems = append(problems, fmt.Sprintf("%s is stale; run 'make types' and commit the result", path))
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+	problems = append(problems, orphans(*dir, latest)...)
+
+	if len(problems) > 0 {
+		for _, p := range problems {
+			fmt.Fprintln(os.Stderr, p)
+		}
+		os.Exit(1)
+	}
+}
+
+// sample checks that a fully populated value of spec's type encodes to JSON
+// its schema accepts with no properties left over.
+func sample(spec *events.Spec) []string {
+	raw, err := spec.Encode(spec.Sample())
+	if err != nil {
+		return []string{fmt.Sprintf("%s/%s: encode sample: %v", spec.Kind, spec.Name, err)}
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return []string{fmt.Sprintf("%s/%s: decode sample: %v", spec.Kind, spec.Name, err)}
+	}
+	if err := spec.Schema().Validate(v, true); err != nil {
+		return []string{fmt.Sprintf("%s/%s: sample does not match the schema: %v\n    %s", spec.Kind, spec.Name, err, raw)}
+	}
+	return nil
+}
+
+// orphans reports committed schemas of events that no longer exist, or of
+// versions newer than the registry's.
+func orphans(dir string, latest map[string]int) []string {
+	var problems []string
+	files, err := filepath.Glob(filepath.Join(dir, "*", "*.json"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, f := range files {
+		m := fileName.FindStringSubmatch(filepath.Base(f))
+		if m == nil {
+			problems = append(problems, fmt.Sprintf("%s: unexpected file", f))
+			continue
+		}
+		key := filepath.Base(filepath.Dir(f)) + "/" + m[1]
+		version, _ := strconv.Atoi(m[2])
+		current, ok := latest[key]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%s: event %s was removed, which breaks its consumers", f, key))
+		case version > current:
+			problems = append(problems, fmt.Sprintf("%s: newer than %s v%d in internal/events", f, key, current))
+		}
+	}
+	return problems
+}
+
+func read(path string) (events.Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s events.Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+func encode(s events.Schema) ([]byte, error) {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,315 @@
+// Command loadtest measures WebSocket fan-out: it provisions throwaway users
+// and rooms directly in the database, connects every user to its room over
+// /ws/rooms, sends chat messages at a fixed rate and reports end-to-end
+// delivery latency percentiles.
+//
+// It reads DATABASE_URL and JWT_SECRET from the same environment as the
+// server. Run it against a staging instance, never production:
+//
+//	loadtest -url ws://localhost:8080 -clients 500 -rooms 20 -rate 50 -duration 1m
+//
+// -history seeds every room with that many messages first, so history
+// requests and unread counts run against realistic rooms.
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"talkie/backend/internal/auth"
+	"talkie/backend/internal/config"
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// fixtureDomain marks loadtest users so cleanup can find them.
+const fixtureDomain = "loadtest.invalid"
+
+const probePrefix = "lt:"
+
+type client struct {
+	conn   *websocket.Conn
+	roomID uuid.UUID
+	mu     sync.Mutex
+}
+
+func (c *client) send(content string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_ = c.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	return c.conn.WriteJSON(map[string]string{"type": "chat", "content": content})
+}
+
+type recorder struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	sent      atomic.Int64
+	expected  atomic.Int64
+	errors    atomic.Int64
+}
+
+func (r *recorder) observe(d time.Duration) {
+	r.mu.Lock()
+	r.latencies = append(r.latencies, d)
+	r.mu.Unlock()
+}
+
+func main() {
+	baseURL := flag.String("url", "ws://localhost:8080", "server WebSocket base URL")
+	clients := flag.Int("clients", 100, "number of simulated clients")
+	rooms := flag.Int("rooms", 10, "number of rooms clients are spread across")
+	rate := flag.Float64("rate", 20, "messages per second across all clients")
+	duration := flag.Duration("duration", 30*time.Second, "how long to send messages")
+	drain := flag.Duration("drain", 5*time.Second, "how long to wait for in-flight deliveries after sending stops")
+	keep := flag.Bool("keep", false, "keep the provisioned users and rooms")
+	cleanup := flag.Bool("cleanup", false, "only delete fixtures left by earlier runs")
+	history := flag.Int("history", 0, "messages to seed into each room before connecting")
+	flag.Parse()
+
+	if *clients < 1 || *rooms < 1 || *rooms > *clients || *rate <= 0 {
+		fatal(fmt.Errorf("need clients >= rooms >= 1 and rate > 0"))
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fatal(err)
+	}
+	store, err := db.New(cfg.DatabaseURL)
+	if err != nil {
+		fatal(err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	if *cleanup {
+		n, err := store.DeleteUsersByEmailDomain(ctx, fixtureDomain)
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Printf("deleted %d loadtest users\n", n)
+		return
+	}
+
+	tokens, roomIDs, err := provision(ctx, store, cfg.JWTSecret, *clients, *rooms)
+	if err != nil {
+		fatal(err)
+	}
+	if !*keep {
+		defer func() {
+			if _, err := store.DeleteUsersByEmailDomain(context.Background(), fixtureDomain); err != nil {
+				fmt.Fprintln(os.Stderr, "cleanup failed:", err)
+			}
+		}()
+	}
+
+	if *history > 0 {
+		seedStart := time.Now()
+		if err := seed(ctx, store, roomIDs, *history); err != nil {
+			fatal(err)
+		}
+		fmt.Printf("seeded %d messages into %d rooms in %s\n", *history*len(roomIDs), len(roomIDs), time.Since(seedStart).Round(time.Millisecond))
+	}
+
+	rec := &recorder{}
+	conns := make([]*client, 0, *clients)
+	perRoom := make(map[uuid.UUID]int64)
+	var readers sync.WaitGroup
+	connectStart := time.Now()
+	for i, token := range tokens {
+		roomID := roomIDs[i%len(roomIDs)]
+		c, err := dial(*baseURL, roomID, token)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "client %d: %v\n", i, err)
+			rec.errors.Add(1)
+			continue
+		}
+		conns = append(conns, c)
+		perRoom[roomID]++
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			read(c, rec)
+		}()
+	}
+	fmt.Printf("connected %d/%d clients in %s\n", len(conns), *clients, time.Since(connectStart).Round(time.Millisecond))
+	if len(conns) == 0 {
+		fatal(fmt.Errorf("no clients connected"))
+	}
+
+	interval := time.Duration(float64(time.Second) / *rate)
+	ticker := time.NewTicker(interval)
+	deadline := time.After(*duration)
+send:
+	for i := 0; ; i++ {
+		select {
+		case <-deadline:
+			break send
+		case <-ticker.C:
+		}
+		c := conns[i%len(conns)]
+		if err := c.send(probePrefix + strconv.FormatInt(time.Now().UnixNano(), 10)); err != nil {
+			rec.errors.Add(1)
+			continue
+		}
+		rec.sent.Add(1)
+		rec.expected.Add(perRoom[c.roomID])
+	}
+	ticker.Stop()
+	time.Sleep(*drain)
+
+	for _, c := range conns {
+		_ = c.conn.Close()
+	}
+	readers.Wait()
+	report(rec, *duration)
+}
+
+// provision creates verified users and rooms, spreads users across rooms
+// round-robin and mints a JWT for each user.
+func provision(ctx context.Context, store *db.Store, secret string, clients, rooms int) ([]string, []uuid.UUID, error) {
+	run := make([]byte, 3)
+	if _, err := rand.Read(run); err != nil {
+		return nil, nil, err
+	}
+	runID := hex.EncodeToString(run)
+	hash, err := auth.HashPassword(runID + "-password")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	users := make([]db.User, 0, clients)
+	for i := 0; i < clients; i++ {
+		u, err := store.CreateUser(ctx, fmt.Sprintf("%s-%d@%s", runID, i, fixtureDomain), fmt.Sprintf("lt%s%d", runID, i), hash)
+		if err != nil {
+			return nil, nil, fmt.Errorf("create user: %w", err)
+		}
+		if err := store.MarkEmailVerified(ctx, u.ID); err != nil {
+			return nil, nil, err
+		}
+		users = append(users, u)
+	}
+
+	roomIDs := make([]uuid.UUID, 0, rooms)
+	for i := 0; i < rooms; i++ {
+		r, err := store.CreateRoom(ctx, fmt.Sprintf("loadtest %s #%d", runID, i), users[i].ID, true)
+		if err != nil {
+			return nil, nil, fmt.Errorf("create room: %w", err)
+		}
+		roomIDs = append(roomIDs, r.ID)
+	}
+
+	tokens := make([]string, 0, clients)
+	for i, u := range users {
+		if err := store.JoinRoom(ctx, roomIDs[i%rooms], u.ID); err != nil {
+			return nil, nil, fmt.Errorf("join room: %w", err)
+		}
+		token, err := auth.GenerateJWT(secret, u.ID, u.Username, u.SessionVersion, "")
+		if err != nil {
+			return nil, nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, roomIDs, nil
+}
+
+// seed fills each room with n messages written by its members in turn, in
+// batches so a large history costs a few statements per room.
+func seed(ctx context.Context, store *db.Store, roomIDs []uuid.UUID, n int) error {
+	const batchSize = 1000
+	for i, roomID := range roomIDs {
+		members, err := store.ListRoomMembers(ctx, roomID)
+		if err != nil {
+			return err
+		}
+		if len(members) == 0 {
+			continue
+		}
+		for start := 0; start < n; start += batchSize {
+			batch := make([]db.NewMessage, 0, min(batchSize, n-start))
+			for j := start; j < n && j < start+batchSize; j++ {
+				author := members[j%len(members)].ID
+				batch = append(batch, db.NewMessage{UserID: author, Content: fmt.Sprintf("seed %d/%d", i, j)})
+			}
+			if _, err := store.SaveMessagesBatch(ctx, roomID, batch); err != nil {
+				return fmt.Errorf("seed room: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func dial(baseURL string, roomID uuid.UUID, token string) (*client, error) {
+	u := fmt.Sprintf("%s/ws/rooms/%s?token=%s", strings.TrimRight(baseURL, "/"), roomID, url.QueryEscape(token))
+	conn, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &client{conn: conn, roomID: roomID}, nil
+}
+
+func read(c *client, rec *recorder) {
+	for {
+		var msg struct {
+			Type    string `json:"type"`
+			Message *struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		}
+		if err := c.conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		if msg.Type != "chat" || msg.Message == nil || !strings.HasPrefix(msg.Message.Content, probePrefix) {
+			continue
+		}
+		sentAt, err := strconv.ParseInt(strings.TrimPrefix(msg.Message.Content, probePrefix), 10, 64)
+		if err != nil {
+			continue
+		}
+		rec.observe(time.Since(time.Unix(0, sentAt)))
+	}
+}
+
+func report(rec *recorder, duration time.Duration) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	lat := rec.latencies
+	sort.Slice(lat, func(i, j int) bool { return lat[i] < lat[j] })
+
+	expected := rec.expected.Load()
+	fmt.Printf("sent %d messages (%.1f/s), %d send/connect errors\n", rec.sent.Load(), float64(rec.sent.Load())/duration.Seconds(), rec.errors.Load())
+	fmt.Printf("delivered %d/%d (%.2f%%)\n", len(lat), expected, 100*float64(len(lat))/math.Max(1, float64(expected)))
+	if len(lat) == 0 {
+		return
+	}
+	for _, p := range []float64{50, 90, 95, 99, 99.9} {
+		fmt.Printf("p%-5v %s\n", p, percentile(lat, p).Round(time.Microsecond))
+	}
+	fmt.Printf("max    %s\n", lat[len(lat)-1].Round(time.Microsecond))
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	idx := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return sorted[idx]
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "loadtest:", err)
+	os.Exit(1)
+}
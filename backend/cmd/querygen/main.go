@@ -0,0 +1,519 @@
+// Command querygen turns the annotated SQL in internal/db/queries into
+// typed query methods in internal/db/queries.gen.go, in the manner of sqlc,
+// so a select list and the Scan call reading it cannot drift apart.
+//
+// Each query in a .sql file starts with a name comment giving the method,
+// its kind and, for queries returning rows, the row type, followed by an
+// args comment listing the Go parameters bound to $1, $2 and so on. Further
+// comments up to the SQL become the method's doc comment:
+//
+//	-- name: findUserByID :one User
+//	-- args: id uuid.UUID
+//	SELECT id, email, COALESCE(avatar_url, '') AS avatar_url FROM users WHERE id = $1;
+//
+// Kinds are :one, which returns ErrNotFound when there is no row, :many and
+// :exec. A row type that is a struct of package db is filled column by
+// column: every selected column needs a simple name or an alias matching a
+// field, by its db tag or else the field name in snake_case (AvatarURL is
+// avatar_url). A scan tag names a sql.Scanner wrapper constructed with the
+// field's address, or with the row's for "wrapper,row". Any other row type
+// is scanned from a single column.
+//
+// A column without a field fails generation, and a field that was renamed
+// or removed fails to compile, so run it after changing either side:
+//
+//	cd backend && go generate ./cmd/querygen
+//	cd backend && go run ./cmd/querygen -check
+package main
+
+//go:generate go run . -dir ../../internal/db
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const output = "queries.gen.go"
+
+// imports maps the package qualifiers argument and row types may use to
+// their import paths.
+var imports = map[string]string{
+	"sql":  "database/sql",
+	"time": "time",
+	"uuid": "github.com/google/uuid",
+}
+
+type query struct {
+	file   string
+	name   string
+	kind   string
+	row    string
+	args   []arg
+	doc    []string
+	sql    string
+	fields []string
+}
+
+type arg struct{ name, typ string }
+
+type field struct {
+	name string
+	scan string
+	row  bool
+}
+
+func main() {
+	dir := flag.String("dir", "internal/db", "db package directory")
+	check := flag.Bool("check", false, "fail if the generated file is stale instead of writing it")
+	flag.Parse()
+
+	structs, err := loadStructs(*dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(*dir, "queries", "*.sql"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	sort.Strings(files)
+
+	var queries []*query
+	seen := make(map[string]string)
+	var problems []string
+	for _, f := range files {
+		qs, err := parseFile(f)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, q := range qs {
+			if prev, ok := seen[q.name]; ok {
+				problems = append(problems, fmt.Sprintf("%s: %s is already defined in %s", q.file, q.name, prev))
+				continue
+			}
+			seen[q.name] = q.file
+			if err := bind(q, structs); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %s: %v", q.file, q.name, err))
+				continue
+			}
+			queries = append(queries, q)
+		}
+	}
+	if len(problems) > 0 {
+		for _, p := range problems {
+			fmt.Fprintln(os.Stderr, p)
+		}
+		os.Exit(1)
+	}
+
+	src, err := generate(queries)
+	if err != nil {
+		log.Fatal(err)
+	}
+	path := filepath.Join(*dir, output)
+	if *check {
+		cur, err := os.ReadFile(path)
+		if err != nil || !bytes.Equal(cur, src) {
+			fmt.Fprintf(os.Stderr, "%s is stale; run 'go generate ./cmd/querygen' and commit the result.\n", path)
+			os.Exit(1)
+		}
+		return
+	}
+	if err := os.WriteFile(path, src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// loadStructs collects the fields of every struct type declared in the
+// package, skipping the generated file so a stale one cannot hide a field.
+func loadStructs(dir string) (map[string]map[string]field, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go") && fi.Name() != output
+	}, 0)
+	if err != nil {
+		return nil, err
+	}
+	structs := make(map[string]map[string]field)
+	for _, pkg := range pkgs {
+		for _, f := range pkg.Files {
+			ast.Inspect(f, func(n ast.Node) bool {
+				ts, ok := n.(*ast.TypeSpec)
+				if !ok {
+					return true
+				}
+				st, ok := ts.Type.(*ast.StructType)
+				if !ok {
+					return false
+				}
+				cols := make(map[string]field)
+				for _, fl := range st.Fields.List {
+					var tag reflect.StructTag
+					if fl.Tag != nil {
+						s, _ := strconv.Unquote(fl.Tag.Value)
+						tag = reflect.StructTag(s)
+					}
+					for _, id := range fl.Names {
+						col := tag.Get("db")
+						if col == "-" {
+							continue
+						}
+						if col == "" {
+							col = snake(id.Name)
+						}
+						scan, opt, _ := strings.Cut(tag.Get("scan"), ",")
+						cols[col] = field{name: id.Name, scan: scan, row: opt == "row"}
+					}
+				}
+				structs[ts.Name.Name] = cols
+				return false
+			})
+		}
+	}
+	return structs, nil
+}
+
+var (
+	nameLine = regexp.MustCompile(`^--\s*name:\s*(\w+)\s+:(one|many|exec)(?:\s+(\S+))?\s*$`)
+	argsLine = regexp.MustCompile(`^--\s*args:\s*(.*)$`)
+)
+
+func parseFile(path string) ([]*query, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var out []*query
+	var cur *query
+	var body []string
+	flush := func() {
+		if cur != nil {
+			cur.sql = strings.TrimSuffix(strings.TrimSpace(strings.Join(body, "\n")), ";")
+			out = append(out, cur)
+		}
+		body = nil
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if m := nameLine.FindStringSubmatch(trimmed); m != nil {
+			flush()
+			cur = &query{file: path, name: m[1], kind: m[2], row: m[3]}
+			if (cur.kind == "exec") != (cur.row == "") {
+				return nil, fmt.Errorf("%s:%d: :one and :many take a row type, :exec does not", path, i+1)
+			}
+			continue
+		}
+		if m := argsLine.FindStringSubmatch(trimmed); m != nil && cur != nil && len(body) == 0 {
+			for _, a := range strings.Split(m[1], ",") {
+				name, typ, ok := strings.Cut(strings.TrimSpace(a), " ")
+				if !ok {
+					return nil, fmt.Errorf("%s:%d: argument %q needs a type", path, i+1, a)
+				}
+				cur.args = append(cur.args, arg{name, strings.TrimSpace(typ)})
+			}
+			continue
+		}
+		if cur != nil && len(body) == 0 && strings.HasPrefix(trimmed, "--") {
+			cur.doc = append(cur.doc, strings.TrimSpace(strings.TrimPrefix(trimmed, "--")))
+			continue
+		}
+		if cur == nil {
+			if trimmed != "" && !strings.HasPrefix(trimmed, "--") {
+				return nil, fmt.Errorf("%s:%d: SQL before the first name comment", path, i+1)
+			}
+			continue
+		}
+		body = append(body, line)
+	}
+	flush()
+	return out, nil
+}
+
+var placeholder = regexp.MustCompile(`\$(\d+)`)
+
+// bind checks q's placeholders against its arguments and resolves its
+// columns to scan destinations.
+func bind(q *query, structs map[string]map[string]field) error {
+	highest := 0
+	for _, m := range placeholder.FindAllStringSubmatch(q.sql, -1) {
+		n, _ := strconv.Atoi(m[1])
+		highest = max(highest, n)
+	}
+	if highest != len(q.args) {
+		return fmt.Errorf("uses $%d but declares %d arguments", highest, len(q.args))
+	}
+	if q.kind == "exec" {
+		return nil
+	}
+	cols, err := columns(q.sql)
+	if err != nil {
+		return err
+	}
+	fields, ok := structs[q.row]
+	if !ok {
+		if len(cols) != 1 {
+			return fmt.Errorf("row type %s is not a struct of package db but %d columns are selected", q.row, len(cols))
+		}
+		q.fields = []string{"&v"}
+		return nil
+	}
+	for _, c := range cols {
+		f, ok := fields[c]
+		switch {
+		case !ok:
+			return fmt.Errorf("column %q has no field in %s", c, q.row)
+		case f.scan == "":
+			q.fields = append(q.fields, "&v."+f.name)
+		case f.row:
+			q.fields = append(q.fields, f.scan+"{&v}")
+		default:
+			q.fields = append(q.fields, f.scan+"{&v."+f.name+"}")
+		}
+	}
+	return nil
+}
+
+var (
+	alias      = regexp.MustCompile(`(?is)\s+AS\s+(\w+)$`)
+	columnName = regexp.MustCompile(`^(?:\w+\.)?(\w+)$`)
+)
+
+// columns returns the names of the columns a query returns: its RETURNING
+// list, or else the list of its first top-level SELECT.
+func columns(sql string) ([]string, error) {
+	toks := topLevel(sql)
+	list := ""
+	if at, ok := toks["RETURNING"]; ok {
+		list = sql[at+len("RETURNING"):]
+	} else if at, ok := toks["SELECT"]; ok {
+		end, ok := toks["FROM"]
+		if !ok {
+			end = len(sql)
+		}
+		list = sql[at+len("SELECT") : end]
+	} else {
+		return nil, fmt.Errorf("returns no columns")
+	}
+	list = strings.TrimSpace(list)
+	if strings.HasPrefix(strings.ToUpper(list), "DISTINCT ") {
+		list = list[len("DISTINCT "):]
+	}
+	var out []string
+	for _, expr := range splitTopLevel(list) {
+		expr = strings.TrimSpace(expr)
+		if m := alias.FindStringSubmatch(expr); m != nil {
+			out = append(out, strings.ToLower(m[1]))
+			continue
+		}
+		m := columnName.FindStringSubmatch(expr)
+		if m == nil {
+			return nil, fmt.Errorf("column %q needs an alias", expr)
+		}
+		out = append(out, strings.ToLower(m[1]))
+	}
+	return out, nil
+}
+
+// topLevel returns the offset of the first occurrence of each keyword
+// outside parentheses and string literals.
+func topLevel(sql string) map[string]int {
+	found := make(map[string]int)
+	depth, quoted := 0, false
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '\'':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && isWordStart(sql, i):
+			j := i
+			for j < len(sql) && isWord(sql[j]) {
+				j++
+			}
+			word := strings.ToUpper(sql[i:j])
+			if _, ok := found[word]; !ok {
+				found[word] = i
+			}
+			i = j - 1
+		}
+	}
+	return found
+}
+
+func splitTopLevel(list string) []string {
+	var out []string
+	depth, quoted, start := 0, false, 0
+	for i := 0; i < len(list); i++ {
+		switch c := list[i]; {
+		case c == '\'':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			out = append(out, list[start:i])
+			start = i + 1
+		}
+	}
+	return append(out, list[start:])
+}
+
+func isWord(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isWordStart(s string, i int) bool {
+	return isWord(s[i]) && (i == 0 || !isWord(s[i-1]) && s[i-1] != '.' && s[i-1] != ':')
+}
+
+// snake converts a Go field name to a column name, keeping initialisms
+// together: AvatarURL is avatar_url and NSFW is nsfw.
+func snake(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prevLower := unicode.IsLower(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || unicode.IsUpper(runes[i-1]) && nextLower {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+func generate(queries []*query) ([]byte, error) {
+	used := map[string]bool{"context": true, "database/sql": true}
+	for _, q := range queries {
+		if q.kind == "one" {
+			used["errors"] = true
+		}
+		types := []string{q.row}
+		for _, a := range q.args {
+			types = append(types, a.typ)
+		}
+		for _, t := range types {
+			for qual, path := range imports {
+				if strings.Contains(t, qual+".") {
+					used[path] = true
+				}
+			}
+		}
+	}
+	var std, third []string
+	for p := range used {
+		if strings.Contains(strings.Split(p, "/")[0], ".") {
+			third = append(third, p)
+		} else {
+			std = append(std, p)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(third)
+
+	var b bytes.Buffer
+	b.WriteString("// Code generated by querygen from queries/*.sql. DO NOT EDIT.\n\npackage db\n\nimport (\n")
+	for _, p := range std {
+		fmt.Fprintf(&b, "%q\n", p)
+	}
+	if len(third) > 0 {
+		b.WriteString("\n")
+	}
+	for _, p := range third {
+		fmt.Fprintf(&b, "%q\n", p)
+	}
+	b.WriteString(`)
+
+// dbtx is what generated queries run on: the pool or a transaction.
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// queries runs the statements in queries/*.sql on db.
+type queries struct {
+	db dbtx
+}
+`)
+	for _, q := range queries {
+		writeQuery(&b, q)
+	}
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %w\n%s", err, b.Bytes())
+	}
+	return src, nil
+}
+
+func writeQuery(b *bytes.Buffer, q *query) {
+	constName := q.name + "SQL"
+	fmt.Fprintf(b, "\n// %s is from %s.\nconst %s = `\n%s\n`\n\n", constName, filepath.ToSlash(filepath.Join("queries", filepath.Base(q.file))), constName, q.sql)
+
+	params := []string{"ctx context.Context"}
+	callArgs := []string{"ctx", constName}
+	for _, a := range q.args {
+		params = append(params, a.name+" "+a.typ)
+		callArgs = append(callArgs, a.name)
+	}
+	for _, line := range q.doc {
+		fmt.Fprintf(b, "// %s\n", line)
+	}
+	sig := fmt.Sprintf("func (q queries) %s(%s)", q.name, strings.Join(params, ", "))
+	call := strings.Join(callArgs, ", ")
+	dests := strings.Join(q.fields, ", ")
+
+	switch q.kind {
+	case "exec":
+		fmt.Fprintf(b, "%s error {\n_, err := q.db.ExecContext(%s)\nreturn err\n}\n", sig, call)
+	case "one":
+		fmt.Fprintf(b, `%s (%s, error) {
+	var v %s
+	err := q.db.QueryRowContext(%s).Scan(%s)
+	if errors.Is(err, sql.ErrNoRows) {
+		return v, ErrNotFound
+	}
+	return v, err
+}
+`, sig, q.row, q.row, call, dests)
+	case "many":
+		fmt.Fprintf(b, `%s ([]%s, error) {
+	rows, err := q.db.QueryContext(%s)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []%s{}
+	for rows.Next() {
+		var v %s
+		if err := rows.Scan(%s); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+`, sig, q.row, call, q.row, q.row, dests)
+	}
+}
@@ -9,12 +9,29 @@ import (
 	"syscall"
 	"time"
 
+	"talkie/backend/internal/archive"
+	"talkie/backend/internal/broadcast"
 	"talkie/backend/internal/config"
 	"talkie/backend/internal/db"
+	"talkie/backend/internal/errreport"
+	"talkie/backend/internal/events"
+	"talkie/backend/internal/geoip"
 	"talkie/backend/internal/httpapi"
+	"talkie/backend/internal/jobs"
+	"talkie/backend/internal/ldapauth"
+	"talkie/backend/internal/logging"
+	"talkie/backend/internal/notify"
+	"talkie/backend/internal/s3"
+	"talkie/backend/internal/scheduler"
+	"talkie/backend/internal/sms"
+	"talkie/backend/internal/storage"
+	"talkie/backend/internal/telemetry"
+	"talkie/backend/internal/webui"
+	"talkie/backend/internal/worker"
 	"talkie/backend/internal/ws"
+	"talkie/backend/migrations"
 
-	"github.com/go-chi/cors"
+	"github.com/gorilla/websocket"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
@@ -27,36 +44,211 @@ func main() {
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to load config")
 	}
+	logs, err := logging.Setup(logging.Config{
+		Level:    cfg.LogLevel,
+		Format:   cfg.LogFormat,
+		Modules:  cfg.LogModuleLevels,
+		WSSample: cfg.LogWSSample,
+		File:     cfg.LogFile,
+		Syslog:   cfg.LogSyslog,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to configure logging")
+	}
+	defer logs.Close()
 
 	store, err := db.New(cfg.DatabaseURL)
 	if err != nil {
 		log.Fatal().Err(err).Msg("failed to connect db")
 	}
 	defer store.Close()
+	opTimeouts := make(map[string]time.Duration, len(cfg.DBQueryTimeoutsMS))
+	for op, ms := range cfg.DBQueryTimeoutsMS {
+		opTimeouts[op] = time.Duration(ms) * time.Millisecond
+	}
+	store.SetQueryTimeouts(time.Duration(cfg.DBQueryTimeoutMS)*time.Millisecond, opTimeouts)
+	store.SetEmojiShortcodes(cfg.EmojiShortcodes)
 
 	migrateCtx, migrateCancel := context.WithTimeout(context.Background(), 20*time.Second)
 	defer migrateCancel()
-	if err := store.RunMigrations(migrateCtx, cfg.MigrationsPath); err != nil {
+	if err := store.RunMigrations(migrateCtx, migrations.Open(cfg.MigrationsPath)); err != nil {
 		log.Fatal().Err(err).Str("path", cfg.MigrationsPath).Msg("failed to run migrations")
 	}
-	if err := os.MkdirAll(cfg.UploadsDir, 0o755); err != nil {
-		log.Fatal().Err(err).Str("path", cfg.UploadsDir).Msg("failed to create uploads directory")
+	if n, err := store.HashStoredPhones(migrateCtx, func(phone string) string { return sms.Hash(cfg.PhoneHashKey, phone) }); err != nil {
+		log.Fatal().Err(err).Msg("failed to hash stored phone numbers")
+	} else if n > 0 {
+		log.Info().Int("count", n).Msg("hashed stored phone numbers")
+	}
+	if open, err := store.SetupRequired(migrateCtx); err != nil {
+		log.Warn().Err(err).Msg("failed to check first-run setup")
+	} else if open {
+		log.Warn().Bool("token_required", cfg.SetupToken != "").Msg("no accounts yet: the first POST /api/setup creates the admin")
+	}
+	uploads := storage.New(cfg.UploadsDir, cfg.RegionUploadDirs)
+	for _, loc := range uploads.All() {
+		if err := os.MkdirAll(loc.Dir, 0o755); err != nil {
+			log.Fatal().Err(err).Str("path", loc.Dir).Msg("failed to create uploads directory")
+		}
 	}
 
 	hub := ws.NewHub()
-	api := httpapi.New(cfg, store, hub)
+	hub.SetConnLimits(ws.ConnLimits{
+		PerUser:     cfg.WSMaxConnsPerUser,
+		PerIP:       cfg.WSMaxConnsPerIP,
+		CloseOldest: cfg.WSConnLimitPolicy == "close_oldest",
+	})
+	hub.SetFanoutWorkers(cfg.WSFanoutWorkers)
+	notifier := notify.NewDispatcher(store, hub)
+	if cfg.FCMCredentialsFile != "" {
+		fcm, err := notify.NewFCM(cfg.FCMProjectID, cfg.FCMCredentialsFile)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to configure fcm")
+		}
+		notifier.Register("fcm", fcm)
+	}
+	if cfg.APNSKeyFile != "" {
+		apns, err := notify.NewAPNs(cfg.APNSKeyFile, cfg.APNSKeyID, cfg.APNSTeamID, cfg.APNSTopic, cfg.APNSProduction)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to configure apns")
+		}
+		notifier.Register("apns", apns)
+	}
+	twilio := sms.NewTwilio(cfg.TwilioAccountSID, cfg.TwilioAuthToken, cfg.TwilioFrom)
+	if twilio != nil {
+		notifier.SetSMS(twilio, store, cfg.SMSDailyLimit)
+	}
+	api := httpapi.New(cfg, store, hub, notifier)
+	if twilio != nil {
+		api.SMS = twilio
+	}
+	if cfg.GeoIPDBPath != "" {
+		geo, err := geoip.Open(cfg.GeoIPDBPath)
+		if err != nil {
+			log.Fatal().Err(err).Str("path", cfg.GeoIPDBPath).Msg("failed to open geoip database")
+		}
+		api.Geo = geo
+	}
+	if cfg.LDAPURL != "" {
+		dir, err := ldapauth.New(ldapauth.Config{
+			URL:          cfg.LDAPURL,
+			StartTLS:     cfg.LDAPStartTLS,
+			CAFile:       cfg.LDAPCAFile,
+			BindDN:       cfg.LDAPBindDN,
+			BindPassword: cfg.LDAPBindPass,
+			BaseDN:       cfg.LDAPBaseDN,
+			UserFilter:   cfg.LDAPUserFilter,
+			IDAttr:       cfg.LDAPIDAttr,
+			EmailAttr:    cfg.LDAPEmailAttr,
+			UsernameAttr: cfg.LDAPUsernameAttr,
+		})
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to configure ldap")
+		}
+		api.LDAP = dir
+	}
+
+	archiver, err := archive.New(store, s3.New(s3.Config{
+		Bucket:    cfg.ArchiveBucket,
+		Region:    cfg.S3Region,
+		Endpoint:  cfg.S3Endpoint,
+		AccessKey: cfg.S3AccessKey,
+		SecretKey: cfg.S3SecretKey,
+	}), archive.Config{
+		AfterMonths: cfg.ArchiveAfterMonths,
+		Prefix:      cfg.ArchivePrefix,
+		HistoryDays: cfg.QuotaHistoryDays,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to configure message archive")
+	}
+	api.Archive = archiver
+
+	reporter, err := errreport.New(cfg.ErrorReportingDSN, cfg.ErrorReportingEnvironment)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to configure error reporting")
+	}
+	api.Errors = reporter
+	hub.SetPanicHandler(reporter.Panic)
+
+	if cfg.ServeWebUI {
+		if ui := webui.FS(); ui != nil {
+			api.WebUI = ui
+			log.Info().Msg("serving the built-in web client")
+		}
+	}
+
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	go hub.RunReaper(bgCtx, cfg.WSReapMissedPings)
+	go jobs.Lead(bgCtx, store, "rich-presence-expiry", 30*time.Second, api.ExpireRichPresence)
+	go jobs.Lead(bgCtx, store, "uptime-monitors", 30*time.Second, worker.NewUptime(store, api, 5*time.Second).Run)
+	if cfg.CanaryIntervalS > 0 {
+		canary := worker.NewCanary(store, api, worker.CanaryConfig{
+			URL:        cfg.CanaryURL,
+			JWTSecret:  cfg.JWTSecret,
+			Interval:   time.Duration(cfg.CanaryIntervalS) * time.Second,
+			MaxLatency: time.Duration(cfg.CanaryMaxLatencyMS) * time.Millisecond,
+		})
+		go jobs.Lead(bgCtx, store, "canary", 30*time.Second, canary.Run)
+	}
+	if cfg.TelemetryEnabled {
+		api.Usage = telemetry.NewUsage()
+		go api.Usage.Flush(bgCtx, store)
+		reporter := telemetry.NewReporter(store, cfg.TelemetryURL, time.Duration(cfg.TelemetryIntervalH)*time.Hour)
+		go jobs.Lead(bgCtx, store, "telemetry", 30*time.Second, reporter.Run)
+	}
+	if cfg.WorkerEnabled {
+		// The worker is idempotent, but one instance doing the work is enough.
+		w := worker.New(store, time.Duration(cfg.WorkerIntervalMS)*time.Millisecond)
+		go jobs.Lead(bgCtx, store, "derived-data-worker", 30*time.Second, w.Run)
+		// Automations claim each run before acting, so a second runner
+		// would only skip work; one keeps actions in message order.
+		automations := worker.NewAutomations(store, api, time.Duration(cfg.WorkerIntervalMS)*time.Millisecond)
+		go jobs.Lead(bgCtx, store, "automations", 30*time.Second, automations.Run)
+	}
+	if cfg.MaintenanceEnabled {
+		maintenance := worker.MaintenanceConfig{
+			Interval:       time.Duration(cfg.MaintenanceIntervalS) * time.Second,
+			RollupInterval: time.Duration(cfg.RollupRefreshIntervalS) * time.Second,
+			GuestInterval:  time.Duration(cfg.GuestCleanupIntervalS) * time.Second,
+			Retention:      time.Duration(cfg.SoftDeleteRetentionDays) * 24 * time.Hour,
+			HistoryDays:    cfg.QuotaHistoryDays,
 
-	h := cors.Handler(cors.Options{
-		AllowedOrigins:   cfg.AllowedOrigins,
-		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
-		AllowCredentials: true,
-		MaxAge:           300,
-	})(api.Routes())
+			Uploads:          uploads.All(),
+			UploadGCInterval: time.Duration(cfg.UploadGCIntervalS) * time.Second,
+		}
+		if archiver != nil {
+			maintenance.Archive = archiver.Run
+		}
+		tasks := worker.MaintenanceTasks(store, maintenance)
+		go scheduler.New(store, tasks...).Run(bgCtx)
+	}
+	store.InstrumentPool()
+	if cfg.DBPoolWaitWarnMS > 0 {
+		go store.WatchPool(bgCtx, 15*time.Second, time.Duration(cfg.DBPoolWaitWarnMS)*time.Millisecond, func(sat db.PoolSaturation) {
+			log.Warn().
+				Int64("waits", sat.Waits).
+				Dur("avg_wait", sat.AvgWait).
+				Dur("total_wait", sat.TotalWaited).
+				Dur("interval", sat.Interval).
+				Int("in_use", sat.InUse).
+				Int("idle", sat.Idle).
+				Int("max_open", sat.MaxOpen).
+				Msg("database connection pool saturated")
+		})
+	}
+	if cfg.BroadcastBackend == "postgres" {
+		backend := broadcast.NewPostgres(store.DB, cfg.DatabaseURL)
+		hub.SetBroadcastBackend(backend)
+		hub.SetRemoteValidator(events.ValidateSocketEvent)
+		hub.SetHistoryCache(api.History)
+		go backend.Run(bgCtx, hub.DeliverRemote)
+		log.Info().Msg("broadcasting websocket events through postgres")
+	}
 
 	server := &http.Server{
 		Addr:              fmt.Sprintf(":%d", cfg.Port),
-		Handler:           h,
+		Handler:           api.Routes(),
 		ReadHeaderTimeout: 5 * time.Second,
 	}
 
@@ -67,12 +259,29 @@ func main() {
 		}
 	}()
 
+	if cfg.DebugAddr != "" {
+		debug := http.NewServeMux()
+		debug.Handle("/debug/", http.StripPrefix("/debug", api.DebugRoutes()))
+		go func() {
+			log.Info().Str("addr", cfg.DebugAddr).Msg("debug server started")
+			debugServer := &http.Server{Addr: cfg.DebugAddr, Handler: debug, ReadHeaderTimeout: 5 * time.Second}
+			if err := debugServer.ListenAndServe(); err != nil {
+				log.Error().Err(err).Msg("debug server failed")
+			}
+		}()
+	}
+
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
 	<-sigCh
+	stopBackground()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
+	// Shutdown does not track hijacked WebSocket connections, so close them
+	// explicitly with spread-out reconnect hints.
+	closed := hub.CloseAll(websocket.CloseServiceRestart, time.Second, 30*time.Second)
+	log.Info().Int("connections", closed).Msg("websockets closed")
 	if err := server.Shutdown(ctx); err != nil {
 		log.Error().Err(err).Msg("shutdown failed")
 	}
@@ -0,0 +1,442 @@
+// Command talkiectl performs instance administration directly against the
+// database and uploads directory. It reads the same environment as the
+// server, so run it with the server's env file loaded.
+//
+//	talkiectl create-admin -email a@b.c -username admin -password secret
+//	talkiectl reset-password -email a@b.c -password secret
+//	talkiectl verify-email -email a@b.c
+//	talkiectl set-bot -email bot@b.c
+//	talkiectl purge-room -room <room-id> -yes
+//	talkiectl rotate-jwt-secret
+//	talkiectl storage-gc -dry-run
+//	talkiectl migrate-uploads -dry-run
+//	talkiectl backup -out talkie.tar -uploads
+//	talkiectl restore -in talkie.tar -yes
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"talkie/backend/internal/auth"
+	"talkie/backend/internal/backup"
+	"talkie/backend/internal/config"
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/jobs"
+	"talkie/backend/internal/storage"
+	"talkie/backend/internal/worker"
+	"talkie/backend/migrations"
+
+	"github.com/google/uuid"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, env *env, args []string) error
+}
+
+type env struct {
+	cfg   config.Config
+	store *db.Store
+}
+
+var commands = []command{
+	{"create-admin", "create an admin user, or promote an existing one", createAdmin},
+	{"reset-password", "set a user's password", resetPassword},
+	{"verify-email", "mark a user's email as verified", verifyEmail},
+	{"set-bot", "mark a user as a bot account, or clear the flag with -off", setBot},
+	{"purge-room", "delete a room, its messages and its uploads", purgeRoom},
+	{"rotate-jwt-secret", "generate a new JWT secret and print the env to deploy", rotateJWTSecret},
+	{"storage-gc", "delete uploads no longer referenced by messages or avatars", storageGC},
+	{"migrate-uploads", "move room uploads to content-addressed paths and rewrite their URLs", migrateUploads},
+	{"backup", "write a logical backup of users, rooms, messages and uploads as a tar stream", backupInstance},
+	{"restore", "restore a logical backup into an empty instance", restoreInstance},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == os.Args[1] {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fatal(err)
+	}
+	e := &env{cfg: cfg}
+	if cmd.name != "rotate-jwt-secret" {
+		store, err := db.New(cfg.DatabaseURL)
+		if err != nil {
+			fatal(err)
+		}
+		defer store.Close()
+		migrateCtx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		err = store.RunMigrations(migrateCtx, migrations.Open(cfg.MigrationsPath))
+		cancel()
+		if err != nil {
+			fatal(err)
+		}
+		e.store = store
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	if err := cmd.run(ctx, e, os.Args[2:]); err != nil {
+		fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: talkiectl <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-18s %s\n", c.name, c.usage)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "talkiectl:", err)
+	os.Exit(1)
+}
+
+func createAdmin(ctx context.Context, e *env, args []string) error {
+	fl := flag.NewFlagSet("create-admin", flag.ExitOnError)
+	email := fl.String("email", "", "admin email")
+	username := fl.String("username", "", "username for a new user")
+	password := fl.String("password", "", "password for a new user (read from stdin if empty)")
+	_ = fl.Parse(args)
+
+	addr := normalizeEmail(*email)
+	if addr == "" {
+		return errors.New("-email is required")
+	}
+	u, err := e.store.FindUserByEmail(ctx, addr)
+	if err == db.ErrNotFound {
+		name := strings.TrimSpace(*username)
+		if name == "" {
+			return errors.New("-username is required for a new user")
+		}
+		hash, err := readPasswordHash(*password)
+		if err != nil {
+			return err
+		}
+		u, err = e.store.CreateUser(ctx, addr, name, hash)
+		if err != nil {
+			return fmt.Errorf("create user: %w", err)
+		}
+		fmt.Printf("created user %s (%s)\n", u.Username, u.ID)
+	} else if err != nil {
+		return err
+	}
+
+	if err := e.store.SetUserAdmin(ctx, u.ID, true); err != nil {
+		return err
+	}
+	if err := e.store.MarkEmailVerified(ctx, u.ID); err != nil {
+		return err
+	}
+	fmt.Printf("%s is now an admin\n", u.Email)
+	return nil
+}
+
+func resetPassword(ctx context.Context, e *env, args []string) error {
+	fl := flag.NewFlagSet("reset-password", flag.ExitOnError)
+	email := fl.String("email", "", "user email")
+	password := fl.String("password", "", "new password (read from stdin if empty)")
+	_ = fl.Parse(args)
+
+	u, err := findUser(ctx, e, *email)
+	if err != nil {
+		return err
+	}
+	hash, err := readPasswordHash(*password)
+	if err != nil {
+		return err
+	}
+	if err := e.store.SetUserPassword(ctx, u.ID, hash); err != nil {
+		return err
+	}
+	fmt.Printf("password updated for %s\n", u.Email)
+	return nil
+}
+
+func verifyEmail(ctx context.Context, e *env, args []string) error {
+	fl := flag.NewFlagSet("verify-email", flag.ExitOnError)
+	email := fl.String("email", "", "user email")
+	_ = fl.Parse(args)
+
+	u, err := findUser(ctx, e, *email)
+	if err != nil {
+		return err
+	}
+	if err := e.store.MarkEmailVerified(ctx, u.ID); err != nil {
+		return err
+	}
+	fmt.Printf("%s marked as verified\n", u.Email)
+	return nil
+}
+
+func setBot(ctx context.Context, e *env, args []string) error {
+	fl := flag.NewFlagSet("set-bot", flag.ExitOnError)
+	email := fl.String("email", "", "user email")
+	off := fl.Bool("off", false, "turn the account back into a regular user")
+	_ = fl.Parse(args)
+
+	u, err := findUser(ctx, e, *email)
+	if err != nil {
+		return err
+	}
+	if err := e.store.SetUserBot(ctx, u.ID, !*off); err != nil {
+		return err
+	}
+	if *off {
+		fmt.Printf("%s is no longer a bot account\n", u.Email)
+	} else {
+		fmt.Printf("%s is now a bot account\n", u.Email)
+	}
+	return nil
+}
+
+func purgeRoom(ctx context.Context, e *env, args []string) error {
+	fl := flag.NewFlagSet("purge-room", flag.ExitOnError)
+	room := fl.String("room", "", "room id")
+	yes := fl.Bool("yes", false, "confirm deletion")
+	_ = fl.Parse(args)
+
+	roomID, err := uuid.Parse(*room)
+	if err != nil {
+		return errors.New("-room must be a room id")
+	}
+	r, err := e.store.GetRoomByID(ctx, roomID)
+	if err != nil {
+		if err == db.ErrNotFound {
+			return errors.New("room not found")
+		}
+		return err
+	}
+	if !*yes {
+		return fmt.Errorf("this deletes room %q with all its messages and uploads; rerun with -yes", r.Name)
+	}
+	media, err := e.store.ListRoomMediaURLs(ctx, roomID)
+	if err != nil {
+		return err
+	}
+	if err := e.store.DeleteRoom(ctx, roomID); err != nil {
+		if err == db.ErrLegalHold {
+			return errors.New("room is under legal hold; release the hold first")
+		}
+		return err
+	}
+	kept, err := worker.RemoveRoomUploads(ctx, e.store, storage.New(e.cfg.UploadsDir, e.cfg.RegionUploadDirs).All(), roomID.String(), media)
+	if err != nil {
+		return fmt.Errorf("remove uploads: %w", err)
+	}
+	if kept > 0 {
+		fmt.Printf("kept %d uploads that other rooms still use\n", kept)
+	}
+	fmt.Printf("room %q purged\n", r.Name)
+	return nil
+}
+
+func rotateJWTSecret(_ context.Context, e *env, _ []string) error {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(buf)
+	previous := append([]string{e.cfg.JWTSecret}, e.cfg.JWTPrevSecrets...)
+
+	fmt.Println("# Deploy these settings. Tokens signed with the previous secrets stay")
+	fmt.Println("# valid until they expire; drop JWT_PREVIOUS_SECRETS after 24 hours.")
+	fmt.Printf("JWT_SECRET=%s\n", secret)
+	fmt.Printf("JWT_PREVIOUS_SECRETS=%s\n", strings.Join(previous, ","))
+	return nil
+}
+
+func storageGC(ctx context.Context, e *env, args []string) error {
+	fl := flag.NewFlagSet("storage-gc", flag.ExitOnError)
+	dryRun := fl.Bool("dry-run", false, "only list files that would be deleted")
+	grace := fl.Duration("grace", time.Hour, "keep files younger than this, so in-flight uploads survive")
+	_ = fl.Parse(args)
+
+	var removed int
+	var freed int64
+	ran, err := jobs.Once(ctx, e.store, worker.UploadGCJob, func(ctx context.Context) error {
+		var err error
+		removed, freed, err = worker.CollectUploads(ctx, e.store, storage.New(e.cfg.UploadsDir, e.cfg.RegionUploadDirs).All(), *grace, *dryRun, func(path string, _ int64) {
+			if *dryRun {
+				fmt.Println(path)
+			}
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if !ran {
+		return errors.New("another instance is collecting uploads right now; try again later")
+	}
+	verb := "deleted"
+	if *dryRun {
+		verb = "would delete"
+	}
+	fmt.Printf("%s %d files (%d bytes)\n", verb, removed, freed)
+	return nil
+}
+
+func migrateUploads(ctx context.Context, e *env, args []string) error {
+	fl := flag.NewFlagSet("migrate-uploads", flag.ExitOnError)
+	dryRun := fl.Bool("dry-run", false, "only list files that would be moved")
+	_ = fl.Parse(args)
+
+	var files int
+	var messages int64
+	// Holding the GC lock keeps collection from deleting a file between its
+	// move and the rewrite that references it.
+	ran, err := jobs.Once(ctx, e.store, worker.UploadGCJob, func(ctx context.Context) error {
+		var err error
+		files, messages, err = worker.MigrateUploads(ctx, e.store, storage.New(e.cfg.UploadsDir, e.cfg.RegionUploadDirs).All(), *dryRun, func(from, to string) {
+			if *dryRun {
+				fmt.Printf("%s -> %s\n", from, to)
+			}
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if !ran {
+		return errors.New("upload GC is running right now; try again later")
+	}
+	if *dryRun {
+		fmt.Printf("would move %d files\n", files)
+		return nil
+	}
+	fmt.Printf("moved %d files, rewrote %d messages\n", files, messages)
+	return nil
+}
+
+func backupInstance(ctx context.Context, e *env, args []string) error {
+	fl := flag.NewFlagSet("backup", flag.ExitOnError)
+	out := fl.String("out", "", "file to write, or - for stdout")
+	passwords := fl.Bool("passwords", false, "include password hashes; without them restored users must reset their password")
+	uploads := fl.Bool("uploads", false, "include upload files, not only their manifest")
+	_ = fl.Parse(args)
+
+	if *out == "" {
+		return errors.New("-out is required")
+	}
+	w := os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	m, err := backup.Export(ctx, w, e.store, storage.New(e.cfg.UploadsDir, e.cfg.RegionUploadDirs), backup.Options{Passwords: *passwords, Uploads: *uploads})
+	if err != nil {
+		return err
+	}
+	if *out != "-" {
+		if err := w.Close(); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "backup of schema %s written: %s\n", m.Schema, describeTables(m.Tables))
+	return nil
+}
+
+func restoreInstance(ctx context.Context, e *env, args []string) error {
+	fl := flag.NewFlagSet("restore", flag.ExitOnError)
+	in := fl.String("in", "", "backup file, or - for stdin")
+	yes := fl.Bool("yes", false, "confirm the restore")
+	_ = fl.Parse(args)
+
+	if *in == "" {
+		return errors.New("-in is required")
+	}
+	if !*yes {
+		return errors.New("this loads the backup into the configured database, which must be empty; rerun with -yes")
+	}
+	r := os.Stdin
+	if *in != "-" {
+		f, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	m, err := backup.Import(ctx, r, e.store, storage.New(e.cfg.UploadsDir, e.cfg.RegionUploadDirs))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("restored backup from %s: %s\n", m.CreatedAt.Format(time.RFC3339), describeTables(m.Tables))
+	if !m.Passwords {
+		fmt.Println("the backup has no password hashes; users must reset their password to log in")
+	}
+	if !m.Uploads {
+		fmt.Println("the backup has no upload files; copy the uploads directory separately")
+	}
+	return nil
+}
+
+func describeTables(counts map[string]int64) string {
+	parts := make([]string, 0, len(db.BackupTables))
+	for _, t := range db.BackupTables {
+		parts = append(parts, fmt.Sprintf("%s=%d", t.Name, counts[t.Name]))
+	}
+	return strings.Join(parts, " ")
+}
+
+func findUser(ctx context.Context, e *env, email string) (db.User, error) {
+	addr := normalizeEmail(email)
+	if addr == "" {
+		return db.User{}, errors.New("-email is required")
+	}
+	u, err := e.store.FindUserByEmail(ctx, addr)
+	if err == db.ErrNotFound {
+		return db.User{}, fmt.Errorf("no user with email %s", addr)
+	}
+	return u, err
+}
+
+func normalizeEmail(email string) string {
+	return strings.TrimSpace(strings.ToLower(email))
+}
+
+func readPasswordHash(password string) (string, error) {
+	if password == "" {
+		fmt.Fprint(os.Stderr, "password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("read password: %w", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	if len(password) < 6 {
+		return "", errors.New("password must be at least 6 characters")
+	}
+	return auth.HashPassword(password)
+}
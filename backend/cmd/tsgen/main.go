@@ -0,0 +1,187 @@
+// Command tsgen writes TypeScript declarations for the JSON payloads the
+// API and WebSocket send, derived from the Go structs by reflection so the
+// frontend's types cannot silently drift from db.Message, ws.OutgoingMessage
+// and friends.
+//
+// Run it through go generate after changing any of the listed structs:
+//
+//	cd backend && go generate ./cmd/tsgen
+package main
+
+//go:generate go run . -out ../../../frontend/src/lib/api.gen.ts
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/ws"
+
+	"github.com/google/uuid"
+)
+
+// roots are the payload types the frontend consumes. Structs they reference
+// are emitted too.
+var roots = []any{
+	db.User{},
+	db.Room{},
+	db.RoomGroup{},
+	db.GroupChannel{},
+	db.Friend{},
+	db.FriendRequest{},
+	db.RoomMember{},
+	db.Message{},
+	db.Notification{},
+	db.LoginEvent{},
+	db.EmailChange{},
+	db.RoomEvent{},
+	ws.IncomingMessage{},
+	ws.OutgoingMessage{},
+	ws.MessagePayload{},
+	ws.Participant{},
+	ws.RoomState{},
+}
+
+// overrides narrows fields that are plain strings in Go but a closed set on
+// the wire. "-" drops the field.
+var overrides = map[string]string{
+	"User.PasswordHash":           "-", // always blanked before responding
+	"Room.channel_type":           "'text' | 'voice'",
+	"Room.my_role":                "'admin' | 'member'",
+	"GroupChannel.channel_type":   "'text' | 'voice'",
+	"GroupChannel.my_role":        "'admin' | 'member'",
+	"FriendRequest.status":        "'pending' | 'accepted' | 'rejected'",
+	"Message.message_type":        "'text' | 'image' | 'file' | 'audio' | 'contact'",
+	"MessagePayload.message_type": "'text' | 'image' | 'file' | 'audio' | 'contact'",
+	"IncomingMessage.signal":      "'offer' | 'answer' | 'ice' | 'hangup'",
+	"OutgoingMessage.signal":      "'offer' | 'answer' | 'ice' | 'hangup'",
+	"RichPresence.type":           "'playing' | 'listening' | 'watching' | 'meeting' | 'custom'",
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	uuidType = reflect.TypeOf(uuid.UUID{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+type generator struct {
+	out     bytes.Buffer
+	emitted map[reflect.Type]bool
+	queue   []reflect.Type
+}
+
+func main() {
+	out := flag.String("out", "", "file to write (stdout when empty)")
+	flag.Parse()
+
+	g := &generator{emitted: map[reflect.Type]bool{}}
+	g.out.WriteString("// Code generated by backend/cmd/tsgen; DO NOT EDIT.\n")
+	for _, v := range roots {
+		g.enqueue(reflect.TypeOf(v))
+	}
+	for len(g.queue) > 0 {
+		t := g.queue[0]
+		g.queue = g.queue[1:]
+		g.emit(t)
+	}
+
+	if *out == "" {
+		os.Stdout.Write(g.out.Bytes())
+		return
+	}
+	if err := os.WriteFile(*out, g.out.Bytes(), 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func (g *generator) enqueue(t reflect.Type) {
+	if !g.emitted[t] {
+		g.emitted[t] = true
+		g.queue = append(g.queue, t)
+	}
+}
+
+func (g *generator) emit(t reflect.Type) {
+	fmt.Fprintf(&g.out, "\nexport type %s = {\n", t.Name())
+	g.fields(t, t.Name())
+	g.out.WriteString("};\n")
+}
+
+func (g *generator) fields(t reflect.Type, owner string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			g.fields(f.Type, owner)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		ts, ok := overrides[owner+"."+name]
+		if !ok {
+			ts, ok = overrides[owner+"."+f.Name]
+		}
+		if ts == "-" {
+			continue
+		}
+		if !ok {
+			ts = g.tsType(f.Type)
+		}
+		optional := strings.Contains(opts, "omitempty")
+		if f.Type.Kind() == reflect.Pointer && !optional {
+			ts += " | null"
+		}
+		if optional {
+			fmt.Fprintf(&g.out, "  %s?: %s;\n", name, ts)
+		} else {
+			fmt.Fprintf(&g.out, "  %s: %s;\n", name, ts)
+		}
+	}
+}
+
+func (g *generator) tsType(t reflect.Type) string {
+	switch t {
+	case timeType, uuidType:
+		return "string"
+	case rawType:
+		return "unknown"
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.tsType(t.Elem())
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "string"
+		}
+		return g.tsType(t.Elem()) + "[]"
+	case reflect.Map:
+		return fmt.Sprintf("Record<%s, %s>", g.tsType(t.Key()), g.tsType(t.Elem()))
+	case reflect.Struct:
+		g.enqueue(t)
+		return t.Name()
+	}
+	return "unknown"
+}
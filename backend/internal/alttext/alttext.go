@@ -0,0 +1,117 @@
+// Package alttext asks a vision model to describe images, for alt text on
+// image messages posted without any. It speaks the OpenAI chat completions
+// API, which most hosted and self-hosted model servers also accept.
+package alttext
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	describeTimeout = 30 * time.Second
+	// MaxImageBytes is the largest image sent to the model; larger ones
+	// are left without generated alt text.
+	MaxImageBytes = 10 << 20
+	maxTokens     = 120
+
+	prompt = "Write alt text for this image for someone using a screen reader: " +
+		"one or two plain sentences saying what it shows, including any important text in it. " +
+		"Answer with the alt text only."
+)
+
+// ErrTooLarge is returned for images over MaxImageBytes.
+var ErrTooLarge = errors.New("alttext: image too large")
+
+// Describer sends images to a chat completions endpoint. A nil Describer
+// describes nothing.
+type Describer struct {
+	url    string
+	model  string
+	apiKey string
+	client *http.Client
+}
+
+// New returns nil when url is empty, so generated alt text stays optional.
+func New(url, model, apiKey string) *Describer {
+	if url == "" {
+		return nil
+	}
+	return &Describer{url: url, model: model, apiKey: apiKey, client: &http.Client{Timeout: describeTimeout}}
+}
+
+// Describe returns alt text for image, cut to maxChars characters. lang,
+// when set, is the BCP 47 language to write it in.
+func (d *Describer) Describe(ctx context.Context, contentType string, image []byte, lang string, maxChars int) (string, error) {
+	if d == nil {
+		return "", nil
+	}
+	if len(image) > MaxImageBytes {
+		return "", ErrTooLarge
+	}
+	text := prompt
+	if lang != "" {
+		text += " Write it in the language with BCP 47 tag " + lang + "."
+	}
+	body, err := json.Marshal(map[string]any{
+		"model":      d.model,
+		"max_tokens": maxTokens,
+		"messages": []map[string]any{{
+			"role": "user",
+			"content": []map[string]any{
+				{"type": "text", "text": text},
+				{"type": "image_url", "image_url": map[string]string{
+					"url": "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(image),
+				}},
+			},
+		}},
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if d.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+d.apiKey)
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return "", fmt.Errorf("alt text model returned %s", resp.Status)
+	}
+	var out struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 256<<10)).Decode(&out); err != nil {
+		return "", fmt.Errorf("decode alt text model response: %w", err)
+	}
+	if len(out.Choices) == 0 {
+		return "", fmt.Errorf("alt text model response has no choices")
+	}
+	alt := strings.Join(strings.Fields(out.Choices[0].Message.Content), " ")
+	alt = strings.Trim(alt, `"`)
+	if utf8.RuneCountInString(alt) > maxChars {
+		alt = string([]rune(alt)[:maxChars])
+	}
+	return alt, nil
+}
@@ -0,0 +1,330 @@
+// Package archive moves old messages out of Postgres into compressed objects
+// in a bucket and reads them back when a client scrolls that far. Each
+// object holds a batch of one room's messages as zstd-compressed JSON lines,
+// one messages row a line; message_archives is the manifest. Archived
+// messages are read-only.
+package archive
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// batchSize is how many messages go into one object.
+	batchSize = 5000
+	// maxBatchesPerRun bounds one run of the archive task; the next run
+	// carries on where it stopped.
+	maxBatchesPerRun = 100
+	// expireBatch is how many expired archives one run deletes.
+	expireBatch = 500
+	// maxArchivesPerRead bounds how many objects one page may open.
+	maxArchivesPerRead = 20
+	// cachedBatches is how many decoded objects are kept in memory, so
+	// paging through an archived stretch fetches each object once.
+	cachedBatches = 8
+
+	contentType = "application/zstd"
+)
+
+type Store interface {
+	ArchiveMessages(ctx context.Context, cutoff time.Time, limit int, store func(db.ArchiveBatch) (db.MessageArchive, error)) (db.MessageArchive, error)
+	ListMessageArchivesBefore(ctx context.Context, roomID uuid.UUID, beforeID int64, limit int) ([]db.MessageArchive, error)
+	ListMessageArchivesAfter(ctx context.Context, roomID uuid.UUID, afterID int64, limit int) ([]db.MessageArchive, error)
+	ListExpiredMessageArchives(ctx context.Context, defaultDays, limit int) ([]db.MessageArchive, error)
+	DeleteMessageArchive(ctx context.Context, id int64) error
+	RenderArchivedMessages(ctx context.Context, rows []json.RawMessage) ([]db.Message, error)
+}
+
+// Bucket is where the objects live; *s3.Client implements it.
+type Bucket interface {
+	Put(ctx context.Context, key string, body []byte, contentType string) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Config says which messages are archived. HistoryDays is the retention of
+// rooms whose plan does not set one, as for the history_retention task.
+type Config struct {
+	AfterMonths int
+	Prefix      string
+	HistoryDays int
+}
+
+type cached struct {
+	key      string
+	messages []db.Message
+}
+
+// Archiver archives messages and reads them back. A nil Archiver means
+// archiving is off: reads return what they were given.
+type Archiver struct {
+	store  Store
+	bucket Bucket
+	cfg    Config
+	enc    *zstd.Encoder
+	dec    *zstd.Decoder
+
+	mu      sync.Mutex
+	order   *list.List
+	batches map[string]*list.Element
+}
+
+// New returns nil when cfg.AfterMonths is 0.
+func New(store Store, bucket Bucket, cfg Config) (*Archiver, error) {
+	if cfg.AfterMonths <= 0 {
+		return nil, nil
+	}
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+	if err != nil {
+		return nil, err
+	}
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Archiver{
+		store:   store,
+		bucket:  bucket,
+		cfg:     cfg,
+		enc:     enc,
+		dec:     dec,
+		order:   list.New(),
+		batches: make(map[string]*list.Element),
+	}, nil
+}
+
+// cutoff is the age past which messages are archived.
+func (a *Archiver) cutoff() time.Time {
+	return time.Now().AddDate(0, -a.cfg.AfterMonths, 0)
+}
+
+// Run is the archive task: it moves messages older than the cutoff into
+// the bucket and then deletes archives past their room's retention or
+// whose room is gone. It returns how many messages it moved and archives
+// it deleted.
+func (a *Archiver) Run(ctx context.Context) (int64, error) {
+	var n int64
+	cutoff := a.cutoff()
+	for i := 0; i < maxBatchesPerRun; i++ {
+		archived, err := a.store.ArchiveMessages(ctx, cutoff, batchSize, func(b db.ArchiveBatch) (db.MessageArchive, error) {
+			return a.put(ctx, b)
+		})
+		if err == db.ErrNotFound {
+			break
+		}
+		if err != nil {
+			return n, err
+		}
+		n += int64(archived.MessageCount)
+	}
+
+	expired, err := a.store.ListExpiredMessageArchives(ctx, a.cfg.HistoryDays, expireBatch)
+	if err != nil {
+		return n, err
+	}
+	for _, ar := range expired {
+		if err := a.bucket.Delete(ctx, ar.ObjectKey); err != nil {
+			return n, err
+		}
+		if err := a.store.DeleteMessageArchive(ctx, ar.ID); err != nil && err != db.ErrNotFound {
+			return n, err
+		}
+		a.forget(ar.ObjectKey)
+		n++
+	}
+	return n, nil
+}
+
+// put compresses b and uploads it. The key only depends on the batch, so
+// when the transaction around it fails the next run overwrites the object
+// instead of leaving a stray one.
+func (a *Archiver) put(ctx context.Context, b db.ArchiveBatch) (db.MessageArchive, error) {
+	var buf bytes.Buffer
+	for _, row := range b.Rows {
+		buf.Write(row)
+		buf.WriteByte('\n')
+	}
+	body := a.enc.EncodeAll(buf.Bytes(), nil)
+	sum := sha256.Sum256(body)
+	key := fmt.Sprintf("%s%s/%d-%d.jsonl.zst", a.cfg.Prefix, b.RoomID, b.IDs[0], b.IDs[len(b.IDs)-1])
+	if err := a.bucket.Put(ctx, key, body, contentType); err != nil {
+		return db.MessageArchive{}, err
+	}
+	return db.MessageArchive{ObjectKey: key, CompressedBytes: int64(len(body)), SHA256: hex.EncodeToString(sum[:])}, nil
+}
+
+// Before completes a page of messages older than beforeID: hot is what
+// the messages table returned, oldest first, and the result is the newest
+// limit messages of hot and the archive together. hot is returned as is
+// when it is full and recent enough that nothing archived can belong in
+// it.
+func (a *Archiver) Before(ctx context.Context, roomID uuid.UUID, beforeID int64, limit int, hot []db.Message) ([]db.Message, error) {
+	if a == nil || (len(hot) >= limit && hot[0].CreatedAt.After(a.cutoff())) {
+		return hot, nil
+	}
+	// A full page only needs archived messages that sort inside it.
+	var floor int64
+	if len(hot) >= limit {
+		floor = hot[0].ID
+	}
+	archives, err := a.store.ListMessageArchivesBefore(ctx, roomID, beforeID, maxArchivesPerRead)
+	if err != nil {
+		return nil, err
+	}
+	merged := slices.Clone(hot)
+	for _, ar := range archives {
+		if ar.LastID <= floor || (len(merged) >= limit && ar.LastID < merged[len(merged)-limit].ID) {
+			break
+		}
+		messages, err := a.load(ctx, ar)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range messages {
+			if m.ID < beforeID && m.ID > floor {
+				merged = append(merged, m)
+			}
+		}
+		merged = sortByID(merged)
+	}
+	if len(merged) > limit {
+		merged = merged[len(merged)-limit:]
+	}
+	return merged, nil
+}
+
+// After is Before's forward counterpart: the oldest limit messages newer
+// than afterID, from hot and the archive.
+func (a *Archiver) After(ctx context.Context, roomID uuid.UUID, afterID int64, limit int, hot []db.Message) ([]db.Message, error) {
+	if a == nil {
+		return hot, nil
+	}
+	var ceiling int64 = 1<<63 - 1
+	if len(hot) >= limit {
+		ceiling = hot[len(hot)-1].ID
+	}
+	archives, err := a.store.ListMessageArchivesAfter(ctx, roomID, afterID, maxArchivesPerRead)
+	if err != nil {
+		return nil, err
+	}
+	merged := slices.Clone(hot)
+	for _, ar := range archives {
+		if ar.FirstID >= ceiling || (len(merged) >= limit && ar.FirstID > merged[limit-1].ID) {
+			break
+		}
+		messages, err := a.load(ctx, ar)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range messages {
+			if m.ID > afterID && m.ID < ceiling {
+				merged = append(merged, m)
+			}
+		}
+		merged = sortByID(merged)
+	}
+	if len(merged) > limit {
+		merged = merged[:limit]
+	}
+	return merged, nil
+}
+
+// Get returns one archived message of roomID, or db.ErrNotFound.
+func (a *Archiver) Get(ctx context.Context, roomID uuid.UUID, messageID int64) (db.Message, error) {
+	if a == nil {
+		return db.Message{}, db.ErrNotFound
+	}
+	messages, err := a.Before(ctx, roomID, messageID+1, 1, nil)
+	if err != nil {
+		return db.Message{}, err
+	}
+	if len(messages) == 0 || messages[0].ID != messageID {
+		return db.Message{}, db.ErrNotFound
+	}
+	return messages[0], nil
+}
+
+// sortByID orders messages oldest first and drops repeats, which only
+// occur when a hot page and an archive overlap.
+func sortByID(messages []db.Message) []db.Message {
+	slices.SortFunc(messages, func(x, y db.Message) int {
+		switch {
+		case x.ID < y.ID:
+			return -1
+		case x.ID > y.ID:
+			return 1
+		}
+		return 0
+	})
+	return slices.CompactFunc(messages, func(x, y db.Message) bool { return x.ID == y.ID })
+}
+
+// load returns the messages of one archive, oldest first, from memory or
+// the bucket. Authors' names and avatars are as of when it was read.
+func (a *Archiver) load(ctx context.Context, ar db.MessageArchive) ([]db.Message, error) {
+	a.mu.Lock()
+	if el, ok := a.batches[ar.ObjectKey]; ok {
+		a.order.MoveToFront(el)
+		messages := el.Value.(*cached).messages
+		a.mu.Unlock()
+		return messages, nil
+	}
+	a.mu.Unlock()
+
+	body, err := a.bucket.Get(ctx, ar.ObjectKey)
+	if err != nil {
+		return nil, fmt.Errorf("archive: read %s: %w", ar.ObjectKey, err)
+	}
+	if sum := sha256.Sum256(body); hex.EncodeToString(sum[:]) != ar.SHA256 {
+		return nil, fmt.Errorf("archive: %s does not match its checksum", ar.ObjectKey)
+	}
+	raw, err := a.dec.DecodeAll(body, nil)
+	if err != nil {
+		return nil, fmt.Errorf("archive: decompress %s: %w", ar.ObjectKey, err)
+	}
+	var rows []json.RawMessage
+	for _, line := range bytes.Split(raw, []byte{'\n'}) {
+		if len(line) > 0 {
+			rows = append(rows, line)
+		}
+	}
+	messages, err := a.store.RenderArchivedMessages(ctx, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.batches[ar.ObjectKey]; !ok {
+		a.batches[ar.ObjectKey] = a.order.PushFront(&cached{key: ar.ObjectKey, messages: messages})
+		for a.order.Len() > cachedBatches {
+			oldest := a.order.Back()
+			a.order.Remove(oldest)
+			delete(a.batches, oldest.Value.(*cached).key)
+		}
+	}
+	return messages, nil
+}
+
+func (a *Archiver) forget(key string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if el, ok := a.batches[key]; ok {
+		a.order.Remove(el)
+		delete(a.batches, key)
+	}
+}
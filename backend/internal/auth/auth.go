@@ -12,6 +12,13 @@ import (
 type Claims struct {
 	UserID   string `json:"uid"`
 	Username string `json:"username"`
+	// SessionVersion must match users.session_version; bumping the column
+	// revokes every token issued before.
+	SessionVersion int `json:"sv,omitempty"`
+	// Guest marks a temporary guest account with restricted permissions.
+	Guest bool `json:"guest,omitempty"`
+	// Timezone is the user's IANA time zone when it was known at issue.
+	Timezone string `json:"tz,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -27,11 +34,13 @@ func VerifyPassword(hash, password string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 }
 
-func GenerateJWT(secret string, userID uuid.UUID, username string) (string, error) {
+func GenerateJWT(secret string, userID uuid.UUID, username string, sessionVersion int, timezone string) (string, error) {
 	now := time.Now()
 	claims := Claims{
-		UserID:   userID.String(),
-		Username: username,
+		UserID:         userID.String(),
+		Username:       username,
+		SessionVersion: sessionVersion,
+		Timezone:       timezone,
 		RegisteredClaims: jwt.RegisteredClaims{
 			IssuedAt:  jwt.NewNumericDate(now),
 			ExpiresAt: jwt.NewNumericDate(now.Add(24 * time.Hour)),
@@ -41,6 +50,38 @@ func GenerateJWT(secret string, userID uuid.UUID, username string) (string, erro
 	return token.SignedString([]byte(secret))
 }
 
+// GenerateGuestJWT issues a token for a guest account. Guests have no
+// password to log in again with, so the token lives until the account
+// expires.
+func GenerateGuestJWT(secret string, userID uuid.UUID, username string, sessionVersion int, expiresAt time.Time) (string, error) {
+	claims := Claims{
+		UserID:         userID.String(),
+		Username:       username,
+		SessionVersion: sessionVersion,
+		Guest:          true,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(secret))
+}
+
+// ParseJWTAny accepts a token signed with any of secrets. The first secret is
+// the current signing key; the rest are previous keys kept during rotation.
+func ParseJWTAny(secrets []string, tokenString string) (Claims, error) {
+	err := fmt.Errorf("no jwt secrets configured")
+	for _, secret := range secrets {
+		var claims Claims
+		claims, err = ParseJWT(secret, tokenString)
+		if err == nil {
+			return claims, nil
+		}
+	}
+	return Claims{}, err
+}
+
 func ParseJWT(secret, tokenString string) (Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (any, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -0,0 +1,362 @@
+// Package automod evaluates a room's auto-moderation rules against messages
+// before they are stored.
+package automod
+
+import (
+	"context"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/metrics"
+	"talkie/backend/internal/wordmask"
+
+	"github.com/google/uuid"
+)
+
+// cacheTTL bounds how long a room's rules and mutes are served from memory.
+// Edits made through this process invalidate immediately; the TTL covers
+// edits made on other instances.
+const cacheTTL = 30 * time.Second
+
+const defaultMuteMinutes = 10
+
+var (
+	actionsTaken  = metrics.NewCounterVec("talkie_automod_actions_total", "Messages acted on by auto-moderation, by action.", "action")
+	blockedByKind = metrics.NewCounterVec("talkie_automod_blocked_total", "Messages auto-moderation kept from being stored, by the kind of rule that decided.", "kind")
+)
+
+type Store interface {
+	ListAutomodRules(ctx context.Context, roomID uuid.UUID) ([]db.AutomodRule, error)
+	ListRoomMutes(ctx context.Context, roomID uuid.UUID) (map[uuid.UUID]time.Time, error)
+	GetMemberJoinedAt(ctx context.Context, roomID, userID uuid.UUID) (time.Time, error)
+	RecordAutomodEvent(ctx context.Context, ev db.AutomodEvent) error
+	MuteRoomMember(ctx context.Context, roomID, userID uuid.UUID, until time.Time) error
+	GetRoomWordMask(ctx context.Context, roomID uuid.UUID) (db.WordMask, error)
+	GetRoomLanguage(ctx context.Context, roomID uuid.UUID) (string, error)
+	ListModerationDictionaries(ctx context.Context, withWords bool) ([]db.ModerationDictionary, error)
+	ModerationDictionariesVersion(ctx context.Context) (string, error)
+}
+
+// Verdict is the outcome of checking one message. The zero Verdict lets the
+// message through.
+type Verdict struct {
+	// Action is the rule action applied, or "" when no rule matched.
+	Action string
+	RuleID int64
+	// Notice is shown to the sender only.
+	Notice     string
+	MutedUntil time.Time
+}
+
+// Blocked reports whether the message must not be stored. A warning lets
+// the message through.
+func (v Verdict) Blocked() bool {
+	return v.Action != "" && v.Action != "warn"
+}
+
+// severity orders actions so the harshest matching rule decides.
+var severity = map[string]int{"warn": 1, "delete": 2, "block": 3, "mute": 4}
+
+type roomState struct {
+	rules []Rule
+	mutes map[uuid.UUID]time.Time
+	// lang is the room's language, looked up only when dictionaries are
+	// loaded.
+	lang string
+	// words are the room's own masked words, and mask is nil unless the
+	// room masks words.
+	words []string
+	mask  *wordmask.Matcher
+	// spam holds the spam dictionaries' phrases for the room's language.
+	spam     *wordmask.Matcher
+	loadedAt time.Time
+}
+
+// Moderator caches each room's compiled rules. A nil Moderator allows
+// everything.
+type Moderator struct {
+	store Store
+	// maskWords are masked in every room that turns masking on.
+	maskWords []string
+	dictDir   string
+
+	mu           sync.Mutex
+	rooms        map[uuid.UUID]*roomState
+	dicts        *dictionaries
+	dictsChecked time.Time
+}
+
+func New(store Store) *Moderator {
+	return &Moderator{store: store, rooms: map[uuid.UUID]*roomState{}}
+}
+
+// SetMaskWords sets the server-wide words masked in rooms that turn word
+// masking on, in addition to each room's own. Call it before use.
+func (m *Moderator) SetMaskWords(words []string) {
+	m.maskWords = words
+}
+
+// Invalidate drops roomID's cached rules and mutes after an admin edit.
+func (m *Moderator) Invalidate(roomID uuid.UUID) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	delete(m.rooms, roomID)
+	m.mu.Unlock()
+}
+
+func (m *Moderator) load(ctx context.Context, roomID uuid.UUID) (*roomState, error) {
+	m.mu.Lock()
+	st, ok := m.rooms[roomID]
+	m.mu.Unlock()
+	if ok && time.Since(st.loadedAt) < cacheTTL {
+		return st, nil
+	}
+
+	stored, err := m.store.ListAutomodRules(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	mutes, err := m.store.ListRoomMutes(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	wm, err := m.store.GetRoomWordMask(ctx, roomID)
+	if err != nil {
+		return nil, err
+	}
+	dicts := m.dictionaries(ctx)
+	st = &roomState{mutes: mutes, words: wm.Words, loadedAt: time.Now()}
+	if dicts.hasAny() {
+		if st.lang, err = m.store.GetRoomLanguage(ctx, roomID); err != nil {
+			return nil, err
+		}
+		st.spam = m.spamMatcher(dicts, st.lang)
+	}
+	if wm.Enabled {
+		st.mask = wordmask.New(m.profanity(dicts, st.lang, wm.Words))
+	}
+	for _, r := range stored {
+		if !r.Enabled {
+			continue
+		}
+		rule, err := Compile(r)
+		if err != nil {
+			log.Printf("automod: skipping rule %d in room %s: %v", r.ID, roomID, err)
+			continue
+		}
+		st.rules = append(st.rules, rule)
+	}
+	m.mu.Lock()
+	m.rooms[roomID] = st
+	m.mu.Unlock()
+	return st, nil
+}
+
+func (m *Moderator) mutedUntil(st *roomState, userID uuid.UUID) time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return st.mutes[userID]
+}
+
+// Check runs roomID's rules against content sent by userID. Errors loading
+// rules are logged and the message is let through: auto-moderation failing
+// must not take chat down with it.
+func (m *Moderator) Check(ctx context.Context, roomID, userID uuid.UUID, content string) Verdict {
+	if m == nil {
+		return Verdict{}
+	}
+	st, err := m.load(ctx, roomID)
+	if err != nil {
+		log.Printf("automod: load rules for room %s: %v", roomID, err)
+		return Verdict{}
+	}
+	now := time.Now()
+	if until := m.mutedUntil(st, userID); until.After(now) {
+		return Verdict{Action: "mute", Notice: mutedNotice(until), MutedUntil: until}
+	}
+	if len(st.rules) == 0 {
+		return Verdict{}
+	}
+
+	msg := &message{content: content, spam: st.spam, joinedAt: func() time.Time {
+		joined, err := m.store.GetMemberJoinedAt(ctx, roomID, userID)
+		if err != nil {
+			log.Printf("automod: load join time for %s in room %s: %v", userID, roomID, err)
+		}
+		return joined
+	}}
+	matched, hit, reason := evaluate(st.rules, msg, now)
+	for _, r := range matched {
+		ruleID := r.ID
+		if err := m.store.RecordAutomodEvent(ctx, db.AutomodEvent{RoomID: roomID, UserID: userID, RuleID: &ruleID, Action: r.Action, Content: content}); err != nil {
+			log.Printf("automod: record event for rule %d: %v", r.ID, err)
+		}
+	}
+	if hit == nil {
+		return Verdict{}
+	}
+	actionsTaken.With(hit.Action).Add(1)
+	if hit.Action != "warn" {
+		blockedByKind.With(hit.Kind).Add(1)
+	}
+
+	v := Verdict{Action: hit.Action, RuleID: hit.ID}
+	switch hit.Action {
+	case "warn":
+		v.Notice = "Auto-moderation warning: " + reason + "."
+	case "delete":
+		v.Notice = "Your message was removed by this room's auto-moderation."
+	case "block":
+		v.Notice = "Your message was blocked: " + reason + "."
+	case "mute":
+		minutes := hit.MuteMinutes
+		if minutes <= 0 {
+			minutes = defaultMuteMinutes
+		}
+		v.MutedUntil = now.Add(time.Duration(minutes) * time.Minute)
+		if err := m.store.MuteRoomMember(ctx, roomID, userID, v.MutedUntil); err != nil {
+			log.Printf("automod: mute %s in room %s: %v", userID, roomID, err)
+		}
+		m.mu.Lock()
+		if v.MutedUntil.After(st.mutes[userID]) {
+			st.mutes[userID] = v.MutedUntil
+		}
+		m.mu.Unlock()
+		v.Notice = "Your message was blocked: " + reason + ". " + mutedNotice(v.MutedUntil)
+	}
+	return v
+}
+
+// evaluate returns the rules that match msg and, of those, the harshest
+// with the reason shown to the sender.
+func evaluate(rules []Rule, msg *message, now time.Time) ([]*Rule, *Rule, string) {
+	var matched []*Rule
+	var hit *Rule
+	var reason string
+	for i := range rules {
+		r := &rules[i]
+		why, ok := r.match(msg, now)
+		if !ok {
+			continue
+		}
+		matched = append(matched, r)
+		if hit == nil || severity[r.Action] > severity[hit.Action] {
+			hit, reason = r, why
+		}
+	}
+	return matched, hit, reason
+}
+
+func mutedNotice(until time.Time) string {
+	return "You are muted in this room until " + until.UTC().Format("Jan 2 15:04 UTC") + "."
+}
+
+// profanity returns the words masked in a room in lang that lists words
+// of its own: the server-wide words and the profanity dictionaries for lang.
+func (m *Moderator) profanity(d *dictionaries, lang string, words []string) []string {
+	return slices.Concat(m.maskWords, d.words(db.DictionaryProfanity, lang), words)
+}
+
+// MaskText returns content with roomID's masked words starred out, or ""
+// when the room does not mask words or none occur.
+func (m *Moderator) MaskText(ctx context.Context, roomID uuid.UUID, content string) string {
+	masked, ok := m.matcher(ctx, roomID).Mask(content)
+	if !ok {
+		return ""
+	}
+	return masked
+}
+
+// Mask sets ContentMasked on those of roomID's messages that masking
+// changes, in place.
+func (m *Moderator) Mask(ctx context.Context, roomID uuid.UUID, messages []db.Message) {
+	matcher := m.matcher(ctx, roomID)
+	if matcher == nil {
+		return
+	}
+	for i := range messages {
+		if masked, ok := matcher.Mask(messages[i].Content); ok {
+			messages[i].ContentMasked = masked
+		}
+	}
+}
+
+// matcher returns roomID's word mask, or nil when it masks nothing. Like
+// Check it fails open, logging errors and masking nothing.
+func (m *Moderator) matcher(ctx context.Context, roomID uuid.UUID) *wordmask.Matcher {
+	if m == nil {
+		return nil
+	}
+	st, err := m.load(ctx, roomID)
+	if err != nil {
+		log.Printf("automod: load word mask for room %s: %v", roomID, err)
+		return nil
+	}
+	return st.mask
+}
+
+// TestResult is what moderation would make of a message, for admins trying
+// out rules and dictionaries.
+type TestResult struct {
+	// Language is the one dictionaries were chosen for; "" means all.
+	Language string `json:"language"`
+	// Profanity and Spam are the dictionary words and phrases found, and
+	// Masked the text with the profanity starred out.
+	Profanity []string `json:"profanity"`
+	Spam      []string `json:"spam"`
+	Masked    string   `json:"masked"`
+	// The rest is only set when testing against a room: the rules that
+	// matched and the verdict of the harshest.
+	MatchedRules []int64 `json:"matched_rules,omitempty"`
+	Action       string  `json:"action,omitempty"`
+	RuleID       int64   `json:"rule_id,omitempty"`
+	Reason       string  `json:"reason,omitempty"`
+}
+
+// Test runs content through the dictionaries for lang and, unless roomID
+// is uuid.Nil, through that room's words and rules in its language
+// instead. Nothing is recorded and nobody is muted; newcomer rules never
+// match, as there is no sender.
+func (m *Moderator) Test(ctx context.Context, roomID uuid.UUID, lang, content string) (TestResult, error) {
+	dicts := m.dictionaries(ctx)
+	res := TestResult{Language: lang}
+	var words []string
+	var rules []Rule
+	if roomID != uuid.Nil {
+		st, err := m.load(ctx, roomID)
+		if err != nil {
+			return TestResult{}, err
+		}
+		if res.Language, err = m.store.GetRoomLanguage(ctx, roomID); err != nil {
+			return TestResult{}, err
+		}
+		words, rules = st.words, st.rules
+	}
+	profanity := wordmask.New(m.profanity(dicts, res.Language, words))
+	spam := m.spamMatcher(dicts, res.Language)
+	res.Profanity = nonNil(profanity.Find(content))
+	res.Spam = nonNil(spam.Find(content))
+	res.Masked, _ = profanity.Mask(content)
+
+	msg := &message{content: content, spam: spam, joinedAt: func() time.Time { return time.Time{} }}
+	matched, hit, reason := evaluate(rules, msg, time.Now())
+	for _, r := range matched {
+		res.MatchedRules = append(res.MatchedRules, r.ID)
+	}
+	if hit != nil {
+		res.Action, res.RuleID, res.Reason = hit.Action, hit.ID, reason
+	}
+	return res, nil
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
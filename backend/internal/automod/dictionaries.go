@@ -0,0 +1,211 @@
+package automod
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/wordmask"
+)
+
+// dictionary is one word list, for rooms in lang or, when lang is "", every
+// room.
+type dictionary struct {
+	kind  string
+	lang  string
+	words []string
+}
+
+// dictionaries are the uploaded and on-disk word lists as of version.
+// They are never changed once loaded; spam matchers are built on first
+// use, per room language.
+type dictionaries struct {
+	version string
+	lists   []dictionary
+	spam    map[string]*wordmask.Matcher
+}
+
+// SetDictionaryDir makes the Moderator read word lists from dir as well as
+// the uploaded ones: files named <kind>.txt or <kind>.<language>.txt, one
+// word or phrase a line, # starting a comment. Changes are picked up like
+// uploads are. Call it before use.
+func (m *Moderator) SetDictionaryDir(dir string) {
+	m.dictDir = dir
+}
+
+// InvalidateDictionaries makes the next message reload the dictionaries
+// after an admin edit, instead of waiting for the periodic check.
+func (m *Moderator) InvalidateDictionaries() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.dictsChecked = time.Time{}
+	m.mu.Unlock()
+}
+
+// dictionaries returns the current word lists, reloading them when they
+// have changed since the last check. When that fails the lists already
+// loaded stay in use.
+func (m *Moderator) dictionaries(ctx context.Context) *dictionaries {
+	m.mu.Lock()
+	d, checked := m.dicts, m.dictsChecked
+	m.mu.Unlock()
+	if d != nil && time.Since(checked) < cacheTTL {
+		return d
+	}
+
+	version, err := m.dictionaryVersion(ctx)
+	if err == nil && (d == nil || version != d.version) {
+		var loaded *dictionaries
+		if loaded, err = m.loadDictionaries(ctx, version); err == nil {
+			m.mu.Lock()
+			if m.dicts != nil {
+				// Room masks and spam lists were built from the old lists.
+				clear(m.rooms)
+			}
+			m.dicts = loaded
+			m.mu.Unlock()
+			d = loaded
+		}
+	}
+	if err != nil {
+		log.Printf("automod: reload dictionaries: %v", err)
+		if d == nil {
+			d = &dictionaries{spam: map[string]*wordmask.Matcher{}}
+		}
+	}
+	m.mu.Lock()
+	if m.dicts == nil {
+		m.dicts = d
+	}
+	m.dictsChecked = time.Now()
+	m.mu.Unlock()
+	return d
+}
+
+// dictionaryVersion combines the uploaded lists' version with the names,
+// sizes and modification times of the files in the dictionary directory.
+func (m *Moderator) dictionaryVersion(ctx context.Context) (string, error) {
+	version, err := m.store.ModerationDictionariesVersion(ctx)
+	if err != nil || m.dictDir == "" {
+		return version, err
+	}
+	files, err := m.dictionaryFiles()
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	b.WriteString(version)
+	for _, path := range files {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "|%s:%d:%d", filepath.Base(path), info.Size(), info.ModTime().UnixNano())
+	}
+	return b.String(), nil
+}
+
+func (m *Moderator) dictionaryFiles() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(m.dictDir, "*.txt"))
+	slices.Sort(files)
+	return files, err
+}
+
+func (m *Moderator) loadDictionaries(ctx context.Context, version string) (*dictionaries, error) {
+	d := &dictionaries{version: version, spam: map[string]*wordmask.Matcher{}}
+	stored, err := m.store.ListModerationDictionaries(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, sd := range stored {
+		if sd.Enabled {
+			d.lists = append(d.lists, dictionary{kind: sd.Kind, lang: sd.Language, words: sd.Words})
+		}
+	}
+	if m.dictDir == "" {
+		return d, nil
+	}
+	files, err := m.dictionaryFiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range files {
+		kind, lang, _ := strings.Cut(strings.TrimSuffix(filepath.Base(path), ".txt"), ".")
+		if !slices.Contains(db.DictionaryKinds, kind) {
+			log.Printf("automod: skipping dictionary file %s: kind must be one of %s", path, strings.Join(db.DictionaryKinds, ", "))
+			continue
+		}
+		words, err := readDictionaryFile(path)
+		if err != nil {
+			return nil, err
+		}
+		d.lists = append(d.lists, dictionary{kind: kind, lang: lang, words: words})
+	}
+	return d, nil
+}
+
+func readDictionaryFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var words []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			words = append(words, line)
+		}
+	}
+	return words, sc.Err()
+}
+
+// words returns the words of kind that apply to a room in lang: lists for
+// every language and, when lang is set, those for lang or its base
+// language. A room with no language gets them all.
+func (d *dictionaries) words(kind, lang string) []string {
+	var out []string
+	for _, l := range d.lists {
+		if l.kind == kind && appliesTo(l.lang, lang) {
+			out = append(out, l.words...)
+		}
+	}
+	return out
+}
+
+func appliesTo(dictLang, roomLang string) bool {
+	if dictLang == "" || roomLang == "" {
+		return true
+	}
+	dictLang, roomLang = strings.ToLower(dictLang), strings.ToLower(roomLang)
+	return roomLang == dictLang || strings.HasPrefix(roomLang, dictLang+"-")
+}
+
+// spamMatcher returns the matcher for the spam phrases of lang, or nil
+// when there are none.
+func (m *Moderator) spamMatcher(d *dictionaries, lang string) *wordmask.Matcher {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	matcher, ok := d.spam[lang]
+	if !ok {
+		matcher = wordmask.New(d.words(db.DictionarySpam, lang))
+		d.spam[lang] = matcher
+	}
+	return matcher
+}
+
+// hasAny reports whether any list is loaded, so rooms only look up their
+// language when it can matter.
+func (d *dictionaries) hasAny() bool {
+	return len(d.lists) > 0
+}
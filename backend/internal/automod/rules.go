@@ -0,0 +1,224 @@
+package automod
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/wordmask"
+)
+
+const maxPatternLength = 500
+
+// Rule configs by kind:
+//
+//	pattern   {"pattern": "<RE2 regexp>"}      matches message text
+//	links     {"allow": ["example.com"]}       any link outside allow (and its subdomains)
+//	mentions  {"max": 5}                       more than max @mentions
+//	newcomer  {"minutes": 30, "links_only": b} members who joined less than minutes ago,
+//	                                           optionally only when the message has a link
+//	spam      {"max_repeat": 20, "max_links": 5}
+//	                                           a character repeated more than max_repeat
+//	                                           times in a row, more than max_links links,
+//	                                           the same link three times or more,
+//	                                           or a phrase from the spam dictionaries
+type config struct {
+	Pattern   string   `json:"pattern"`
+	Allow     []string `json:"allow"`
+	Max       int      `json:"max"`
+	Minutes   int      `json:"minutes"`
+	LinksOnly bool     `json:"links_only"`
+	MaxRepeat int      `json:"max_repeat"`
+	MaxLinks  int      `json:"max_links"`
+}
+
+// Spam rule defaults for settings left at zero.
+const (
+	defaultMaxRepeat   = 20
+	defaultMaxLinks    = 5
+	maxRepeatsOfOneURL = 2
+)
+
+var (
+	linkPattern    = regexp.MustCompile(`(?i)(?:https?://|\bwww\.)([a-z0-9.-]+)`)
+	urlPattern     = regexp.MustCompile(`(?i)(?:https?://|\bwww\.)[^\s<>"]+`)
+	mentionPattern = regexp.MustCompile(`(?:^|\s)@[\w.-]+`)
+)
+
+// Rule is a stored rule with its config parsed.
+type Rule struct {
+	db.AutomodRule
+	cfg config
+	re  *regexp.Regexp
+}
+
+// Compile parses and validates r's config for its kind. Handlers use it to
+// reject bad rules before they are stored.
+func Compile(r db.AutomodRule) (Rule, error) {
+	if !slices.Contains(db.AutomodKinds, r.Kind) {
+		return Rule{}, fmt.Errorf("kind must be one of %s", strings.Join(db.AutomodKinds, ", "))
+	}
+	if !slices.Contains(db.AutomodActions, r.Action) {
+		return Rule{}, fmt.Errorf("action must be one of %s", strings.Join(db.AutomodActions, ", "))
+	}
+	if r.MuteMinutes < 0 || r.MuteMinutes > 7*24*60 {
+		return Rule{}, errors.New("mute_minutes must be between 0 and 10080")
+	}
+	rule := Rule{AutomodRule: r}
+	if len(r.Config) > 0 {
+		if err := json.Unmarshal(r.Config, &rule.cfg); err != nil {
+			return Rule{}, errors.New("config must be a JSON object")
+		}
+	}
+	switch r.Kind {
+	case "pattern":
+		if rule.cfg.Pattern == "" || len(rule.cfg.Pattern) > maxPatternLength {
+			return Rule{}, fmt.Errorf("pattern must be 1 to %d characters", maxPatternLength)
+		}
+		re, err := regexp.Compile(rule.cfg.Pattern)
+		if err != nil {
+			return Rule{}, fmt.Errorf("invalid pattern: %v", err)
+		}
+		rule.re = re
+	case "links":
+		for i, d := range rule.cfg.Allow {
+			rule.cfg.Allow[i] = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(d)), "www.")
+		}
+	case "mentions":
+		if rule.cfg.Max < 1 {
+			return Rule{}, errors.New("max must be at least 1")
+		}
+	case "newcomer":
+		if rule.cfg.Minutes < 1 {
+			return Rule{}, errors.New("minutes must be at least 1")
+		}
+	case "spam":
+		if rule.cfg.MaxRepeat < 0 || rule.cfg.MaxLinks < 0 {
+			return Rule{}, errors.New("max_repeat and max_links must not be negative")
+		}
+		if rule.cfg.MaxRepeat == 0 {
+			rule.cfg.MaxRepeat = defaultMaxRepeat
+		}
+		if rule.cfg.MaxLinks == 0 {
+			rule.cfg.MaxLinks = defaultMaxLinks
+		}
+	}
+	return rule, nil
+}
+
+// message is what rules look at. joinedAt is only called, once, when a
+// newcomer rule needs it; spam is the room's spam dictionary, if any.
+type message struct {
+	content  string
+	spam     *wordmask.Matcher
+	joinedAt func() time.Time
+
+	joined    time.Time
+	joinedSet bool
+}
+
+func (m *message) joinedTime() time.Time {
+	if !m.joinedSet {
+		m.joined, m.joinedSet = m.joinedAt(), true
+	}
+	return m.joined
+}
+
+// match reports whether r applies to msg, with the reason shown to the
+// sender.
+func (r *Rule) match(msg *message, now time.Time) (string, bool) {
+	switch r.Kind {
+	case "pattern":
+		return "it contains a phrase not allowed here", r.re.MatchString(msg.content)
+	case "links":
+		for _, host := range linkHosts(msg.content) {
+			if !allowedHost(host, r.cfg.Allow) {
+				return "links to " + host + " are not allowed here", true
+			}
+		}
+	case "mentions":
+		if n := len(mentionPattern.FindAllString(msg.content, -1)); n > r.cfg.Max {
+			return fmt.Sprintf("it mentions more than %d people", r.cfg.Max), true
+		}
+	case "newcomer":
+		if r.cfg.LinksOnly && len(linkHosts(msg.content)) == 0 {
+			return "", false
+		}
+		joined := msg.joinedTime()
+		if joined.IsZero() || now.Sub(joined) >= time.Duration(r.cfg.Minutes)*time.Minute {
+			return "", false
+		}
+		if r.cfg.LinksOnly {
+			return fmt.Sprintf("new members cannot post links for their first %d minutes", r.cfg.Minutes), true
+		}
+		return fmt.Sprintf("new members cannot post for their first %d minutes", r.cfg.Minutes), true
+	case "spam":
+		if len(msg.spam.Find(msg.content)) > 0 {
+			return "it contains a phrase listed as spam", true
+		}
+		return spamReason(msg.content, r.cfg.MaxRepeat, r.cfg.MaxLinks)
+	}
+	return "", false
+}
+
+// spamReason applies the spam heuristics to content, which is already
+// normalized, so invisible characters cannot break up a run.
+func spamReason(content string, maxRepeat, maxLinks int) (string, bool) {
+	if longestRun(content) > maxRepeat {
+		return "it repeats the same character too many times", true
+	}
+	urls := urlPattern.FindAllString(content, -1)
+	if len(urls) > maxLinks {
+		return fmt.Sprintf("it has more than %d links", maxLinks), true
+	}
+	seen := make(map[string]int, len(urls))
+	for _, u := range urls {
+		u = strings.ToLower(strings.TrimRight(u, ".,;:!?)"))
+		if seen[u]++; seen[u] > maxRepeatsOfOneURL {
+			return "it repeats the same link", true
+		}
+	}
+	return "", false
+}
+
+// longestRun is the length of the longest run of one non-space character.
+func longestRun(content string) int {
+	longest, run := 0, 0
+	var prev rune
+	for _, r := range content {
+		if r == prev && !unicode.IsSpace(r) {
+			run++
+		} else {
+			run = 1
+		}
+		prev = r
+		longest = max(longest, run)
+	}
+	return longest
+}
+
+func linkHosts(content string) []string {
+	var hosts []string
+	for _, m := range linkPattern.FindAllStringSubmatch(content, -1) {
+		host := strings.TrimPrefix(strings.ToLower(strings.TrimRight(m[1], ".")), "www.")
+		if host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+func allowedHost(host string, allow []string) bool {
+	for _, d := range allow {
+		if d != "" && (host == d || strings.HasSuffix(host, "."+d)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,434 @@
+// Package backup writes and restores logical backups: a tar stream with the
+// instance's rows as JSON lines and a manifest of its uploads, optionally
+// with the upload files themselves. Unlike pg_dump it is independent of the
+// Postgres version and can be restored into a fresh instance of the same or
+// a newer release.
+//
+// Layout:
+//
+//	manifest.json        format, schema, row counts, options
+//	tables/<name>.jsonl  one JSON object per row, in restore order
+//	uploads.jsonl        path, size and sha256 of every upload
+//	uploads/<path>       upload files, when included
+//
+// Upload paths are relative to /uploads, as they are served: a region's
+// files are under regions/<region>/.
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/storage"
+)
+
+// FormatVersion is bumped when the archive layout changes incompatibly.
+const FormatVersion = 1
+
+type Manifest struct {
+	Format    int              `json:"format"`
+	Schema    string           `json:"schema"`
+	CreatedAt time.Time        `json:"created_at"`
+	Passwords bool             `json:"passwords"`
+	Uploads   bool             `json:"uploads"`
+	Tables    map[string]int64 `json:"tables"`
+}
+
+type Upload struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type Options struct {
+	// Passwords keeps password hashes. Without it restored users must reset
+	// their password before logging in.
+	Passwords bool
+	// Uploads includes the upload files, not just their manifest.
+	Uploads bool
+}
+
+// Secrets that only make sense for the instance that issued them.
+var scrubbedUserColumns = []string{"email_verification_token_hash", "password_reset_token_hash"}
+
+// Export writes a backup of store and the uploads in every location to w.
+// Table rows are spooled to temporary files first because tar needs each
+// entry's size up front.
+func Export(ctx context.Context, w io.Writer, store *db.Store, locations *storage.Locations, opts Options) (Manifest, error) {
+	schema, err := store.LatestMigration(ctx)
+	if err != nil {
+		return Manifest{}, err
+	}
+	m := Manifest{
+		Format:    FormatVersion,
+		Schema:    schema,
+		CreatedAt: time.Now().UTC(),
+		Passwords: opts.Passwords,
+		Uploads:   opts.Uploads,
+		Tables:    map[string]int64{},
+	}
+
+	spool, err := os.MkdirTemp("", "talkie-backup-")
+	if err != nil {
+		return Manifest{}, err
+	}
+	defer os.RemoveAll(spool)
+
+	files := map[string]*bufio.Writer{}
+	handles := map[string]*os.File{}
+	defer func() {
+		for _, f := range handles {
+			f.Close()
+		}
+	}()
+	for _, t := range db.BackupTables {
+		f, err := os.Create(filepath.Join(spool, t.Name+".jsonl"))
+		if err != nil {
+			return Manifest{}, err
+		}
+		handles[t.Name] = f
+		files[t.Name] = bufio.NewWriter(f)
+		m.Tables[t.Name] = 0
+	}
+	err = store.ExportBackup(ctx, func(table string, row json.RawMessage) error {
+		if table == "users" {
+			scrubbed, err := scrubUser(row, opts.Passwords)
+			if err != nil {
+				return err
+			}
+			row = scrubbed
+		}
+		m.Tables[table]++
+		bw := files[table]
+		if _, err := bw.Write(row); err != nil {
+			return err
+		}
+		return bw.WriteByte('\n')
+	})
+	if err != nil {
+		return Manifest{}, err
+	}
+	for _, bw := range files {
+		if err := bw.Flush(); err != nil {
+			return Manifest{}, err
+		}
+	}
+
+	var uploads []Upload
+	var sources []string
+	all := locations.All()
+	for i, loc := range all {
+		// A region's directory may be inside UPLOADS_DIR; its files are
+		// backed up with the region.
+		var skip []string
+		for j, other := range all {
+			if j == i {
+				continue
+			}
+			abs, err := filepath.Abs(other.Dir)
+			if err != nil {
+				return Manifest{}, err
+			}
+			skip = append(skip, abs)
+		}
+		if uploads, sources, err = scanUploads(loc, skip, uploads, sources); err != nil {
+			return Manifest{}, err
+		}
+	}
+
+	tw := tar.NewWriter(w)
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return Manifest{}, err
+	}
+	if err := writeBytes(tw, "manifest.json", manifest); err != nil {
+		return Manifest{}, err
+	}
+	for _, t := range db.BackupTables {
+		if err := writeFile(tw, "tables/"+t.Name+".jsonl", filepath.Join(spool, t.Name+".jsonl")); err != nil {
+			return Manifest{}, err
+		}
+	}
+	var list strings.Builder
+	for _, u := range uploads {
+		line, err := json.Marshal(u)
+		if err != nil {
+			return Manifest{}, err
+		}
+		list.Write(line)
+		list.WriteByte('\n')
+	}
+	if err := writeBytes(tw, "uploads.jsonl", []byte(list.String())); err != nil {
+		return Manifest{}, err
+	}
+	if opts.Uploads {
+		for i, u := range uploads {
+			if err := ctx.Err(); err != nil {
+				return Manifest{}, err
+			}
+			if err := writeFile(tw, "uploads/"+u.Path, sources[i]); err != nil {
+				return Manifest{}, err
+			}
+		}
+	}
+	return m, tw.Close()
+}
+
+// Import restores a backup read from r into store, which must be empty, and
+// writes included upload files to their locations. The database part is one
+// transaction; upload files are only written after it commits.
+func Import(ctx context.Context, r io.Reader, store *db.Store, locations *storage.Locations) (Manifest, error) {
+	tr := tar.NewReader(r)
+	hdr, err := tr.Next()
+	if err != nil {
+		return Manifest{}, fmt.Errorf("read backup: %w", err)
+	}
+	if hdr.Name != "manifest.json" {
+		return Manifest{}, errors.New("not a talkie backup: manifest.json must come first")
+	}
+	var m Manifest
+	if err := json.NewDecoder(tr).Decode(&m); err != nil {
+		return Manifest{}, fmt.Errorf("read manifest: %w", err)
+	}
+	if m.Format != FormatVersion {
+		return Manifest{}, fmt.Errorf("unsupported backup format %d", m.Format)
+	}
+	schema, err := store.LatestMigration(ctx)
+	if err != nil {
+		return Manifest{}, err
+	}
+	if m.Schema > schema {
+		return Manifest{}, fmt.Errorf("backup schema %s is newer than this instance (%s); upgrade first", m.Schema, schema)
+	}
+
+	restore, err := store.BeginRestore(ctx)
+	if err != nil {
+		return Manifest{}, err
+	}
+	defer restore.Rollback()
+
+	var (
+		committed bool
+		expected  = map[string]Upload{}
+		written   []string
+	)
+	defer func() {
+		// A failed restore leaves no partial uploads behind.
+		if !committed {
+			for _, p := range written {
+				os.Remove(p)
+			}
+		}
+	}()
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Manifest{}, fmt.Errorf("read backup: %w", err)
+		}
+		switch {
+		case strings.HasPrefix(hdr.Name, "tables/"):
+			table := strings.TrimSuffix(strings.TrimPrefix(hdr.Name, "tables/"), ".jsonl")
+			if err := restoreTable(ctx, restore, table, tr); err != nil {
+				return Manifest{}, err
+			}
+		case hdr.Name == "uploads.jsonl":
+			dec := json.NewDecoder(tr)
+			for dec.More() {
+				var u Upload
+				if err := dec.Decode(&u); err != nil {
+					return Manifest{}, fmt.Errorf("read uploads manifest: %w", err)
+				}
+				expected[u.Path] = u
+			}
+		case strings.HasPrefix(hdr.Name, "uploads/"):
+			rel := strings.TrimPrefix(hdr.Name, "uploads/")
+			u, ok := expected[rel]
+			if !ok {
+				return Manifest{}, fmt.Errorf("upload %s is not in the uploads manifest", rel)
+			}
+			dst, err := restoreUpload(locations, u, tr)
+			if err != nil {
+				return Manifest{}, err
+			}
+			written = append(written, dst)
+		}
+	}
+	if err := restore.Commit(ctx); err != nil {
+		return Manifest{}, err
+	}
+	committed = true
+	return m, nil
+}
+
+func restoreTable(ctx context.Context, restore *db.Restore, table string, r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for sc.Scan() {
+		line := sc.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		if err := restore.Insert(ctx, table, json.RawMessage(line)); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+func restoreUpload(locations *storage.Locations, u Upload, r io.Reader) (string, error) {
+	clean := path.Clean("/" + u.Path)[1:]
+	if clean == "" || clean != u.Path {
+		return "", fmt.Errorf("invalid upload path %q", u.Path)
+	}
+	loc, rel := locations.Default(), clean
+	if rest, ok := strings.CutPrefix(clean, regionsPrefix); ok {
+		region, file, _ := strings.Cut(rest, "/")
+		var found bool
+		if loc, found = locations.Region(region); !found || file == "" {
+			return "", fmt.Errorf("upload %s is in region %q, which has no REGION_UPLOADS_DIRS entry", u.Path, region)
+		}
+		rel = file
+	}
+	dst := loc.Path(filepath.FromSlash(rel))
+	if _, err := os.Stat(dst); err == nil {
+		return "", fmt.Errorf("upload %s already exists", u.Path)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return "", err
+	}
+	f, err := os.Create(dst)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && (n != u.Size || hex.EncodeToString(h.Sum(nil)) != u.SHA256) {
+		err = fmt.Errorf("upload %s does not match its checksum", u.Path)
+	}
+	if err != nil {
+		os.Remove(dst)
+		return "", err
+	}
+	return dst, nil
+}
+
+func scrubUser(row json.RawMessage, keepPassword bool) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(row, &fields); err != nil {
+		return nil, err
+	}
+	for _, c := range scrubbedUserColumns {
+		if _, ok := fields[c]; ok {
+			fields[c] = json.RawMessage("null")
+		}
+	}
+	if !keepPassword {
+		fields["password_hash"] = json.RawMessage(`""`)
+	}
+	return json.Marshal(fields)
+}
+
+// regionsPrefix starts the upload paths of files kept in a region.
+const regionsPrefix = "regions/"
+
+// uploadPrefix is what the paths of loc's files start with: "" for the
+// default location and regions/<region>/ for a region's.
+func uploadPrefix(loc storage.Location) string {
+	p := strings.TrimPrefix(strings.TrimPrefix(loc.URLPrefix, "/uploads"), "/")
+	if p == "" {
+		return ""
+	}
+	return p + "/"
+}
+
+// scanUploads appends the files in loc, except those under the absolute
+// directories in skip, to uploads and their paths on disk to sources.
+func scanUploads(loc storage.Location, skip []string, uploads []Upload, sources []string) ([]Upload, []string, error) {
+	dir, prefix := loc.Dir, uploadPrefix(loc)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && p == dir {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() && p != dir {
+			abs, err := filepath.Abs(p)
+			if err != nil {
+				return err
+			}
+			for _, s := range skip {
+				if s == abs {
+					return fs.SkipDir
+				}
+			}
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		h := sha256.New()
+		n, err := io.Copy(h, f)
+		if err != nil {
+			return err
+		}
+		uploads = append(uploads, Upload{Path: prefix + filepath.ToSlash(rel), Size: n, SHA256: hex.EncodeToString(h.Sum(nil))})
+		sources = append(sources, p)
+		return nil
+	})
+	return uploads, sources, err
+}
+
+func writeBytes(tw *tar.Writer, name string, data []byte) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), ModTime: time.Now()}); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+func writeFile(tw *tar.Writer, name, src string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: info.Size(), ModTime: info.ModTime()}); err != nil {
+		return err
+	}
+	// Copy exactly the size in the header even if the file grew since.
+	_, err = io.CopyN(tw, f, info.Size())
+	return err
+}
@@ -0,0 +1,196 @@
+// Package billing turns Stripe webhook events into subscription state. It
+// talks to nobody: subscriptions are created through Stripe Checkout or the
+// dashboard, and Stripe tells us about them.
+package billing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+// signatureTolerance bounds how old a signed event may be, limiting replays.
+const signatureTolerance = 5 * time.Minute
+
+// Metadata keys a subscription carries to say who it pays for.
+const (
+	UserMetadataKey  = "talkie_user_id"
+	GroupMetadataKey = "talkie_group_id"
+)
+
+var (
+	ErrBadSignature = errors.New("invalid stripe signature")
+	// ErrNoOwner is returned for subscriptions without owner metadata, which
+	// belong to something other than this instance.
+	ErrNoOwner = errors.New("subscription has no talkie owner metadata")
+)
+
+// Stripe verifies and parses webhook events. A nil Stripe means billing is
+// off.
+type Stripe struct {
+	secret string
+	// plans maps Stripe price ids or lookup keys to plan names.
+	plans map[string]string
+}
+
+// New returns nil when webhookSecret is empty, so billing stays optional.
+func New(webhookSecret string, pricePlans map[string]string) *Stripe {
+	if webhookSecret == "" {
+		return nil
+	}
+	return &Stripe{secret: webhookSecret, plans: pricePlans}
+}
+
+// Event is a verified webhook event. Subscription is set for the
+// customer.subscription.* events billing acts on and nil otherwise.
+type Event struct {
+	ID           string
+	Type         string
+	Created      time.Time
+	Subscription *db.Subscription
+}
+
+// Entitled reports whether a subscription in status still earns its plan.
+// past_due keeps it while Stripe retries the payment.
+func Entitled(status string) bool {
+	switch status {
+	case "active", "trialing", "past_due":
+		return true
+	}
+	return false
+}
+
+// ParseEvent checks the Stripe-Signature header against payload and
+// decodes the event.
+func (s *Stripe) ParseEvent(payload []byte, header string, now time.Time) (Event, error) {
+	if err := s.verify(payload, header, now); err != nil {
+		return Event{}, err
+	}
+	var raw struct {
+		ID      string `json:"id"`
+		Type    string `json:"type"`
+		Created int64  `json:"created"`
+		Data    struct {
+			Object json.RawMessage `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return Event{}, fmt.Errorf("decode stripe event: %w", err)
+	}
+	ev := Event{ID: raw.ID, Type: raw.Type, Created: time.Unix(raw.Created, 0).UTC()}
+	if !strings.HasPrefix(raw.Type, "customer.subscription.") {
+		return ev, nil
+	}
+	sub, err := s.subscription(raw.Data.Object)
+	if err != nil {
+		return Event{}, err
+	}
+	ev.Subscription = &sub
+	return ev, nil
+}
+
+// verify implements Stripe's scheme: an HMAC-SHA256 over "t.payload" with
+// the endpoint secret, sent as one or more v1 entries next to t.
+func (s *Stripe) verify(payload []byte, header string, now time.Time) error {
+	var ts string
+	var sigs [][]byte
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			if sig, err := hex.DecodeString(value); err == nil {
+				sigs = append(sigs, sig)
+			}
+		}
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || len(sigs) == 0 {
+		return ErrBadSignature
+	}
+	if age := now.Sub(time.Unix(sec, 0)); age > signatureTolerance || age < -signatureTolerance {
+		return ErrBadSignature
+	}
+	mac := hmac.New(sha256.New, []byte(s.secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	want := mac.Sum(nil)
+	for _, sig := range sigs {
+		if hmac.Equal(sig, want) {
+			return nil
+		}
+	}
+	return ErrBadSignature
+}
+
+type stripeSubscription struct {
+	ID                string            `json:"id"`
+	Customer          string            `json:"customer"`
+	Status            string            `json:"status"`
+	CurrentPeriodEnd  int64             `json:"current_period_end"`
+	CancelAtPeriodEnd bool              `json:"cancel_at_period_end"`
+	Metadata          map[string]string `json:"metadata"`
+	Items             struct {
+		Data []struct {
+			CurrentPeriodEnd int64 `json:"current_period_end"`
+			Price            struct {
+				ID        string `json:"id"`
+				LookupKey string `json:"lookup_key"`
+			} `json:"price"`
+		} `json:"data"`
+	} `json:"items"`
+}
+
+func (s *Stripe) subscription(data json.RawMessage) (db.Subscription, error) {
+	var in stripeSubscription
+	if err := json.Unmarshal(data, &in); err != nil {
+		return db.Subscription{}, fmt.Errorf("decode stripe subscription: %w", err)
+	}
+	sub := db.Subscription{
+		ID:                in.ID,
+		CustomerID:        in.Customer,
+		Status:            in.Status,
+		CancelAtPeriodEnd: in.CancelAtPeriodEnd,
+	}
+	if id, err := uuid.Parse(in.Metadata[GroupMetadataKey]); err == nil {
+		sub.GroupID = &id
+	} else if id, err := uuid.Parse(in.Metadata[UserMetadataKey]); err == nil {
+		sub.UserID = &id
+	} else {
+		return db.Subscription{}, ErrNoOwner
+	}
+
+	periodEnd := in.CurrentPeriodEnd
+	// The first item that maps to a plan decides it. Newer API versions
+	// moved the billing period onto items.
+	for _, item := range in.Items.Data {
+		if periodEnd == 0 {
+			periodEnd = item.CurrentPeriodEnd
+		}
+		if sub.Plan != "" {
+			continue
+		}
+		if plan, ok := s.plans[item.Price.ID]; ok {
+			sub.Plan = plan
+		} else if plan, ok := s.plans[item.Price.LookupKey]; ok && item.Price.LookupKey != "" {
+			sub.Plan = plan
+		}
+	}
+	if periodEnd > 0 {
+		end := time.Unix(periodEnd, 0).UTC()
+		sub.CurrentPeriodEnd = &end
+	}
+	return sub, nil
+}
@@ -0,0 +1,40 @@
+// Package broadcast relays WebSocket events between server instances. The
+// hub delivers every event to its own connections and publishes it through a
+// Backend; other instances receive it and deliver it to theirs.
+//
+// Only event delivery is shared. Presence, call rosters and connection
+// limits stay per instance.
+package broadcast
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
+
+// Message kinds, matching the hub's routing primitives.
+const (
+	KindRoom       = "room"
+	KindRoomUser   = "room_user"
+	KindUser       = "user"
+	KindUserEvents = "user_events"
+	// KindChannel reaches the subscribers of a broadcast room.
+	KindChannel = "channel"
+)
+
+type Message struct {
+	Origin  string          `json:"o"`
+	Kind    string          `json:"k"`
+	RoomID  uuid.UUID       `json:"r,omitempty"`
+	UserID  uuid.UUID       `json:"u,omitempty"`
+	Payload json.RawMessage `json:"p"`
+}
+
+// Backend carries messages to the other instances. Publish must not block
+// the caller; Run delivers messages from other instances (never this one's
+// own) until ctx is cancelled.
+type Backend interface {
+	Publish(msg Message)
+	Run(ctx context.Context, deliver func(Message))
+}
@@ -0,0 +1,157 @@
+package broadcast
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"talkie/backend/internal/metrics"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	notifyChannel = "talkie_broadcast"
+
+	// Postgres caps NOTIFY payloads at 8000 bytes. Larger messages are
+	// written to broadcast_spill and the notification carries "#<id>".
+	maxNotifyPayload = 7900
+	spillPrefix      = "#"
+	spillRetention   = 5 * time.Minute
+)
+
+var (
+	publishedMessages = metrics.NewCounter("talkie_broadcast_published_total", "Messages published to other instances.")
+	receivedMessages  = metrics.NewCounter("talkie_broadcast_received_total", "Messages received from other instances.")
+	droppedMessages   = metrics.NewCounter("talkie_broadcast_dropped_total", "Messages dropped because the publish queue was full or publishing failed.")
+)
+
+// Postgres is a Backend built on LISTEN/NOTIFY, for deployments that run
+// several instances against one database and do not want another broker.
+type Postgres struct {
+	db          *sql.DB
+	databaseURL string
+	origin      string
+	out         chan Message
+}
+
+func NewPostgres(db *sql.DB, databaseURL string) *Postgres {
+	return &Postgres{
+		db:          db,
+		databaseURL: databaseURL,
+		origin:      uuid.NewString(),
+		out:         make(chan Message, 1024),
+	}
+}
+
+func (p *Postgres) Publish(msg Message) {
+	msg.Origin = p.origin
+	select {
+	case p.out <- msg:
+	default:
+		droppedMessages.Inc()
+	}
+}
+
+func (p *Postgres) Run(ctx context.Context, deliver func(Message)) {
+	go p.publishLoop(ctx)
+	for ctx.Err() == nil {
+		if err := p.listen(ctx, deliver); err != nil && ctx.Err() == nil {
+			log.Printf("broadcast listen failed, reconnecting: %v", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+		}
+	}
+}
+
+func (p *Postgres) publishLoop(ctx context.Context) {
+	cleanup := time.NewTicker(time.Minute)
+	defer cleanup.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-cleanup.C:
+			if _, err := p.db.ExecContext(ctx, `DELETE FROM broadcast_spill WHERE created_at < NOW() - make_interval(secs => $1)`, spillRetention.Seconds()); err != nil {
+				log.Printf("broadcast spill cleanup failed: %v", err)
+			}
+		case msg := <-p.out:
+			if err := p.publish(ctx, msg); err != nil {
+				droppedMessages.Inc()
+				log.Printf("broadcast publish failed: %v", err)
+				continue
+			}
+			publishedMessages.Inc()
+		}
+	}
+}
+
+func (p *Postgres) publish(ctx context.Context, msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	body := string(data)
+	if len(body) > maxNotifyPayload {
+		var id int64
+		if err := p.db.QueryRowContext(ctx, `INSERT INTO broadcast_spill (payload) VALUES ($1) RETURNING id`, data).Scan(&id); err != nil {
+			return err
+		}
+		body = spillPrefix + strconv.FormatInt(id, 10)
+	}
+	_, err = p.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, notifyChannel, body)
+	return err
+}
+
+// listen holds a dedicated connection, since LISTEN state belongs to a
+// session and pooled database/sql connections cannot wait on notifications.
+func (p *Postgres) listen(ctx context.Context, deliver func(Message)) error {
+	conn, err := pgx.Connect(ctx, p.databaseURL)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+notifyChannel); err != nil {
+		return err
+	}
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		msg, err := p.decode(ctx, n.Payload)
+		if err != nil {
+			log.Printf("broadcast decode failed: %v", err)
+			continue
+		}
+		if msg.Origin == p.origin {
+			continue
+		}
+		receivedMessages.Inc()
+		deliver(msg)
+	}
+}
+
+func (p *Postgres) decode(ctx context.Context, payload string) (Message, error) {
+	data := []byte(payload)
+	if strings.HasPrefix(payload, spillPrefix) {
+		id, err := strconv.ParseInt(strings.TrimPrefix(payload, spillPrefix), 10, 64)
+		if err != nil {
+			return Message{}, err
+		}
+		if err := p.db.QueryRowContext(ctx, `SELECT payload FROM broadcast_spill WHERE id = $1`, id).Scan(&data); err != nil {
+			return Message{}, err
+		}
+	}
+	var msg Message
+	err := json.Unmarshal(data, &msg)
+	return msg, err
+}
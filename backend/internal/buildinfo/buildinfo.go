@@ -0,0 +1,25 @@
+// Package buildinfo says which build of the server is running.
+package buildinfo
+
+import "runtime/debug"
+
+// Version is set when building a release:
+//
+//	go build -ldflags "-X talkie/backend/internal/buildinfo.Version=v1.2.3"
+var Version string
+
+// String returns Version, or else the commit Go recorded the build from,
+// or "dev".
+func String() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" && len(s.Value) >= 12 {
+				return s.Value[:12]
+			}
+		}
+	}
+	return "dev"
+}
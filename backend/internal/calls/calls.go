@@ -0,0 +1,24 @@
+// Package calls is the seam between the API and the SFU a deployment runs
+// its calls on. LiveKit and Jitsi implement Provider; CALL_PROVIDER picks
+// one, and handlers can be tested against callstest.Mock.
+package calls
+
+import "time"
+
+// Participant is who a token is issued to.
+type Participant struct {
+	ID        string
+	Name      string
+	AvatarURL string
+}
+
+// Provider issues what members need to join a room's call.
+type Provider interface {
+	// Name tells clients which SDK to join with, "livekit" or "jitsi".
+	Name() string
+	// URL is the server calls in rooms of region go through; "" is the
+	// default region.
+	URL(region string) string
+	// Token returns a token letting p join room for ttl.
+	Token(room string, p Participant, ttl time.Duration) (string, error)
+}
@@ -0,0 +1,52 @@
+// Package callstest provides a calls.Provider that records the tokens it
+// was asked for instead of signing them.
+package callstest
+
+import (
+	"sync"
+	"time"
+
+	"talkie/backend/internal/calls"
+)
+
+// Join is one Token call.
+type Join struct {
+	Room        string
+	Participant calls.Participant
+	TTL         time.Duration
+}
+
+// Mock answers Token with TokenValue, or fails with Err when it is set,
+// and reports ProviderName and ServerURL for every region.
+type Mock struct {
+	ProviderName string
+	ServerURL    string
+	TokenValue   string
+	Err          error
+
+	mu    sync.Mutex
+	joins []Join
+}
+
+var _ calls.Provider = (*Mock)(nil)
+
+func (m *Mock) Name() string { return m.ProviderName }
+
+func (m *Mock) URL(string) string { return m.ServerURL }
+
+func (m *Mock) Token(room string, p calls.Participant, ttl time.Duration) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.joins = append(m.joins, Join{Room: room, Participant: p, TTL: ttl})
+	if m.Err != nil {
+		return "", m.Err
+	}
+	return m.TokenValue, nil
+}
+
+// Joins returns the Token calls so far.
+func (m *Mock) Joins() []Join {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Join(nil), m.joins...)
+}
@@ -3,14 +3,24 @@ package config
 import (
 	"fmt"
 	"os"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+
+	"talkie/backend/internal/flags"
+	"talkie/backend/internal/profile"
 )
 
+// MaxMessageLengthCeiling is the longest message text, in characters, the
+// messages table accepts (migration 045).
+const MaxMessageLengthCeiling = 16000
+
 type Config struct {
 	Port             int
 	DatabaseURL      string
 	JWTSecret        string
+	JWTPrevSecrets   []string
 	LiveKitAPIKey    string
 	LiveKitAPISecret string
 	LiveKitURL       string
@@ -20,9 +30,305 @@ type Config struct {
 	SMTPUser         string
 	SMTPPass         string
 	SMTPFrom         string
-	MigrationsPath   string
-	UploadsDir       string
-	AllowedOrigins   []string
+	// MigrationsPath is a directory of SQL migrations to apply instead of
+	// the ones built into the binary.
+	MigrationsPath string
+	UploadsDir     string
+	AllowedOrigins []string
+	// ServeWebUI serves the web client built into the binary, if any, at
+	// every path the API does not use.
+	ServeWebUI bool
+
+	// CORS policies by route group: AllowedOrigins for the app's API,
+	// CORSPublicOrigins for endpoints other sites embed (embeds, status,
+	// invite previews), and CORSUploadOrigins for uploaded media. An origin
+	// may hold one * wildcard, such as https://*.example.com, and "*"
+	// allows any. CORSMaxAgeS is how long browsers cache a preflight.
+	CORSPublicOrigins []string
+	CORSUploadOrigins []string
+	CORSMaxAgeS       int
+
+	// Brute-force limits on email verification codes: wrong guesses per
+	// code, and codes emailed per account per hour. 0 disables either.
+	VerifyMaxAttempts   int
+	VerifyEmailsPerHour int
+
+	FCMProjectID       string
+	FCMCredentialsFile string
+	APNSKeyFile        string
+	APNSKeyID          string
+	APNSTeamID         string
+	APNSTopic          string
+	APNSProduction     bool
+
+	// SMS alerts are off unless all three Twilio settings are set.
+	// TwilioFrom is a sender number or a messaging service SID (MG...).
+	// SMSDailyLimit caps the texts each user is sent a day; 0 is unlimited.
+	TwilioAccountSID string
+	TwilioAuthToken  string
+	TwilioFrom       string
+	SMSDailyLimit    int
+	// PhoneHashKey keys the hashes phone numbers are stored as. It defaults
+	// to JWT_SECRET; changing it forgets every verified number until its
+	// owner verifies it again.
+	PhoneHashKey string
+
+	// APIPublicURL is where browsers reach this API, for the callback URLs
+	// given to workspace identity providers. Empty, it is taken from each
+	// request like WS URLs are.
+	APIPublicURL string
+	// SCIMEnabled serves the SCIM 2.0 API at /api/scim/v2, through which
+	// identity providers holding a token from an instance admin create,
+	// update and deactivate accounts and manage group memberships.
+	SCIMEnabled bool
+	// LDAPURL (ldap:// or ldaps://) makes the directory the only place
+	// passwords are checked: sign-in binds as the user's entry, found with
+	// LDAPUserFilter, and accounts are created or updated from it. Local
+	// passwords can no longer be registered, reset or changed.
+	LDAPURL      string
+	LDAPStartTLS bool
+	LDAPCAFile   string
+	LDAPBindDN   string
+	LDAPBindPass string
+	LDAPBaseDN   string
+	// LDAPUserFilter finds the entry for what users type as their email,
+	// which replaces {login}.
+	LDAPUserFilter   string
+	LDAPIDAttr       string
+	LDAPEmailAttr    string
+	LDAPUsernameAttr string
+
+	// How the instance presents itself at GET /api/instance. Registration
+	// is "open" or "closed"; closed, accounts only come from guest links,
+	// SSO, SCIM or LDAP. The name and registration policy chosen in
+	// first-run setup override these.
+	InstanceName         string
+	InstanceLogoURL      string
+	InstanceContactEmail string
+	InstanceContactURL   string
+	Registration         string
+	// SetupToken, when set, must accompany POST /api/setup, so that only
+	// whoever deployed the instance can claim its first admin account.
+	SetupToken string
+
+	TrustProxyHeaders bool
+	WSMaxConnsPerUser int
+	WSMaxConnsPerIP   int
+	WSConnLimitPolicy string
+	WSFanoutWorkers   int
+	WSReapMissedPings int
+	WSAcceptRate      int
+	WSAcceptBurst     int
+	APIRateLimit      int
+	APIRateBurst      int
+
+	InviteJoinsPerMinute int
+	JoinSpikeThreshold   int
+	// InviteGuessLimit is how many unknown invite tokens an address or user
+	// may try in 10 minutes before invite lookups are blocked for them.
+	InviteGuessLimit int
+	// What the public invite preview may show about a room or workspace.
+	// Unlisted rooms show neither, whatever these say.
+	InvitePreviewNames        bool
+	InvitePreviewMemberCounts bool
+
+	// Quota defaults for users and workspaces without a plan; 0 is
+	// unlimited.
+	QuotaMaxRooms       int
+	QuotaMaxRoomMembers int
+	QuotaMaxUploadMB    int
+	QuotaHistoryDays    int
+
+	// Media types that may be uploaded anywhere: MIME types or type/*.
+	// Empty UploadAllowedTypes allows every supported type not blocked.
+	// Room admins can narrow this further per room.
+	UploadAllowedTypes []string
+	UploadBlockedTypes []string
+
+	// Room size warnings: the admin room size report flags rooms that
+	// reach RoomWarnPercent of RoomWarnMessages, RoomWarnMediaMB or their
+	// member quota. 0 turns a threshold off.
+	RoomWarnMessages int
+	RoomWarnMediaMB  int
+	RoomWarnPercent  int
+
+	// AgeGate is "off", "optional" or "required": whether registration
+	// asks for a date of birth. Sign-ups younger than MinAge are refused;
+	// accounts younger than AdultAge are put in restricted mode.
+	AgeGate  string
+	MinAge   int
+	AdultAge int
+
+	// ProfileFields are the extra profile fields from PROFILE_FIELDS; more
+	// can be added through the admin API.
+	ProfileFields []profile.Field
+
+	// Billing is off unless StripeWebhookSecret is set. StripePricePlans
+	// maps Stripe price ids or lookup keys to plan names.
+	StripeWebhookSecret string
+	StripePricePlans    map[string]string
+
+	HistoryCacheRooms int
+	HistoryCacheSize  int
+
+	MetricsToken string
+	// DebugAddr, when set, is an address such as 127.0.0.1:6060 serving
+	// pprof and the hub dump without auth. Keep it off the internet.
+	DebugAddr string
+
+	// LogLevel is the least level logged, overridden per package by
+	// LogModuleLevels. LogFormat is "console" or "json" for stdout, and
+	// LogWSSample thins out ws package lines under load. LogFile and
+	// LogSyslog add sinks; see logging.Config.
+	LogLevel        string
+	LogFormat       string
+	LogModuleLevels map[string]string
+	LogWSSample     int
+	LogFile         string
+	LogSyslog       string
+
+	// ErrorReportingDSN is a Sentry-compatible DSN panics are sent to,
+	// tagged with ErrorReportingEnvironment. Empty only logs them.
+	ErrorReportingDSN         string
+	ErrorReportingEnvironment string
+
+	WorkerEnabled    bool
+	WorkerIntervalMS int
+
+	// CanaryIntervalS is how often the canary sends a probe message through
+	// a room socket of this server, at CanaryURL (this instance's loopback
+	// address by default). A probe slower than CanaryMaxLatencyMS counts as
+	// failed. 0 turns the canary off.
+	CanaryIntervalS    int
+	CanaryURL          string
+	CanaryMaxLatencyMS int
+
+	// TelemetryEnabled opts in to sending an anonymous usage report to
+	// TelemetryURL every TelemetryIntervalH hours; see package telemetry
+	// for what it holds. Off by default.
+	TelemetryEnabled   bool
+	TelemetryURL       string
+	TelemetryIntervalH int
+
+	BroadcastBackend string
+
+	// CallProvider is the SFU calls go through, "livekit" or "jitsi".
+	CallProvider string
+	// JitsiURL, JitsiAppID and JitsiAppSecret locate a Jitsi Meet
+	// deployment with token authentication and the app its tokens are
+	// signed for.
+	JitsiURL       string
+	JitsiAppID     string
+	JitsiAppSecret string
+
+	// STUNURLs and TURNURLs are handed to clients for WebRTC. TURN
+	// credentials are signed with TURNSecret, coturn's static-auth-secret,
+	// and last TURNCredentialTTLS seconds.
+	STUNURLs           []string
+	TURNURLs           []string
+	TURNSecret         string
+	TURNCredentialTTLS int
+	// P2PCalls lets the two members of a direct room call each other
+	// without the SFU, signaling over their room sockets.
+	P2PCalls bool
+
+	// EmbedRequestsPerMinute caps requests to public room embeds per
+	// client address, and EmbedStreamsPerIP the embed streams each address
+	// may hold open. 0 disables either.
+	EmbedRequestsPerMinute int
+	EmbedStreamsPerIP      int
+
+	Region      string
+	WSPublicURL string
+	WSShardURLs []string
+
+	// RegionUploadDirs and RegionLiveKitURLs route rooms tagged with a data
+	// region to that region's storage and LiveKit cluster. Region storage is
+	// a local directory only; S3Bucket is shared, so direct uploads are
+	// refused in region-tagged rooms.
+	RegionUploadDirs  map[string]string
+	RegionLiveKitURLs map[string]string
+
+	GeoIPDBPath        string
+	LoginAlertsEnabled bool
+
+	// FeatureFlags are client and server feature flags, each on, off or
+	// rolled out to a percentage of users; see package flags.
+	FeatureFlags flags.Set
+
+	CompressionEnabled  bool
+	CompressionLevel    int
+	CompressionMinBytes int
+	UploadsCacheMaxAge  int
+	AvatarsCacheMaxAge  int
+	// UploadsCacheScope is "public", letting CDNs store media, or "private"
+	// to keep it in browser caches only.
+	UploadsCacheScope string
+
+	NSFWClassifierURL       string
+	NSFWClassifierThreshold int
+
+	// AltTextAPIURL is an OpenAI-compatible chat completions endpoint whose
+	// vision model, AltTextModel, writes alt text for images posted without
+	// any. Empty leaves such images without alt text.
+	AltTextAPIURL string
+	AltTextModel  string
+	AltTextAPIKey string
+
+	// SlashCommandsAllowPrivate lets room slash commands call loopback and
+	// private addresses, for development. Otherwise they only reach public
+	// ones.
+	SlashCommandsAllowPrivate bool
+
+	// FFmpegPath enables waveforms for non-WAV voice notes.
+	FFmpegPath string
+
+	// MaxMessageLength caps message text in characters. The messages table
+	// refuses anything over MaxMessageLengthCeiling.
+	MaxMessageLength int
+
+	// EmojiShortcodes expands :shortcode: names in new messages to emoji.
+	EmojiShortcodes bool
+	// ProfanityWords are masked in every room that turns word masking on.
+	ProfanityWords []string
+	// ModerationDictionaryDir holds word lists read alongside the uploaded
+	// ones and reloaded when they change: <kind>.txt or
+	// <kind>.<language>.txt, kind being profanity or spam.
+	ModerationDictionaryDir string
+
+	// Direct uploads are off unless S3Bucket is set. S3Endpoint is only for
+	// S3-compatible stores; S3PublicURL defaults to the bucket URL.
+	S3Bucket      string
+	S3Region      string
+	S3Endpoint    string
+	S3AccessKey   string
+	S3SecretKey   string
+	S3PublicURL   string
+	S3MaxUploadMB int
+	// S3FormTTLS is how long a presigned upload form is valid. When
+	// S3SignedURLTTLS is set the bucket is private and media is fetched
+	// through signed URLs valid that long.
+	S3FormTTLS      int
+	S3SignedURLTTLS int
+	// Messages older than ArchiveAfterMonths move to ArchiveBucket, a
+	// private bucket kept apart from the media one and reached with the S3
+	// region, endpoint and keys above. 0 keeps every message in Postgres.
+	ArchiveAfterMonths int
+	ArchiveBucket      string
+	ArchivePrefix      string
+
+	GuestMaxDays          int
+	GuestCleanupIntervalS int
+
+	MaintenanceEnabled      bool
+	MaintenanceIntervalS    int
+	RollupRefreshIntervalS  int
+	SoftDeleteRetentionDays int
+	UploadGCIntervalS       int
+
+	DBQueryTimeoutMS  int
+	DBQueryTimeoutsMS map[string]int
+	DBPoolWaitWarnMS  int
 }
 
 func Load() (Config, error) {
@@ -30,18 +336,200 @@ func Load() (Config, error) {
 		Port:             envInt("PORT", 8080),
 		DatabaseURL:      os.Getenv("DATABASE_URL"),
 		JWTSecret:        os.Getenv("JWT_SECRET"),
+		JWTPrevSecrets:   splitCSV(envString("JWT_PREVIOUS_SECRETS", "")),
 		LiveKitAPIKey:    os.Getenv("LIVEKIT_API_KEY"),
 		LiveKitAPISecret: os.Getenv("LIVEKIT_API_SECRET"),
 		LiveKitURL:       os.Getenv("LIVEKIT_URL"),
+		CallProvider:     envString("CALL_PROVIDER", "livekit"),
+		JitsiURL:         os.Getenv("JITSI_URL"),
+		JitsiAppID:       os.Getenv("JITSI_APP_ID"),
+		JitsiAppSecret:   os.Getenv("JITSI_APP_SECRET"),
 		FrontendBaseURL:  envString("FRONTEND_BASE_URL", "http://localhost:5173"),
 		SMTPHost:         envString("SMTP_HOST", ""),
 		SMTPPort:         envInt("SMTP_PORT", 0),
 		SMTPUser:         envString("SMTP_USER", ""),
 		SMTPPass:         envString("SMTP_PASS", ""),
 		SMTPFrom:         envString("SMTP_FROM", ""),
-		MigrationsPath:   envString("MIGRATIONS_PATH", "migrations"),
+		MigrationsPath:   envString("MIGRATIONS_PATH", ""),
 		UploadsDir:       envString("UPLOADS_DIR", "uploads"),
 		AllowedOrigins:   splitCSV(envString("ALLOWED_ORIGINS", "http://localhost:5173")),
+		ServeWebUI:       envBool("SERVE_WEB_UI", true),
+
+		CORSPublicOrigins: splitCSV(envString("CORS_PUBLIC_ORIGINS", "*")),
+		CORSUploadOrigins: splitCSV(envString("CORS_UPLOAD_ORIGINS", "")),
+		CORSMaxAgeS:       envInt("CORS_MAX_AGE_S", 300),
+
+		VerifyMaxAttempts:   envInt("VERIFY_MAX_ATTEMPTS", 5),
+		VerifyEmailsPerHour: envInt("VERIFY_EMAILS_PER_HOUR", 5),
+
+		FCMProjectID:       envString("FCM_PROJECT_ID", ""),
+		FCMCredentialsFile: envString("FCM_CREDENTIALS_FILE", ""),
+		APNSKeyFile:        envString("APNS_KEY_FILE", ""),
+		APNSKeyID:          envString("APNS_KEY_ID", ""),
+		APNSTeamID:         envString("APNS_TEAM_ID", ""),
+		APNSTopic:          envString("APNS_TOPIC", ""),
+		APNSProduction:     envBool("APNS_PRODUCTION", false),
+
+		TwilioAccountSID: envString("TWILIO_ACCOUNT_SID", ""),
+		TwilioAuthToken:  envString("TWILIO_AUTH_TOKEN", ""),
+		TwilioFrom:       envString("TWILIO_FROM", ""),
+		SMSDailyLimit:    envInt("SMS_DAILY_LIMIT", 10),
+		PhoneHashKey:     envString("PHONE_HASH_KEY", ""),
+		APIPublicURL:     strings.TrimRight(envString("API_PUBLIC_URL", ""), "/"),
+		SCIMEnabled:      envBool("SCIM_ENABLED", false),
+		LDAPURL:          envString("LDAP_URL", ""),
+		LDAPStartTLS:     envBool("LDAP_STARTTLS", false),
+		LDAPCAFile:       envString("LDAP_CA_FILE", ""),
+		LDAPBindDN:       envString("LDAP_BIND_DN", ""),
+		LDAPBindPass:     os.Getenv("LDAP_BIND_PASSWORD"),
+		LDAPBaseDN:       envString("LDAP_BASE_DN", ""),
+		LDAPUserFilter:   envString("LDAP_USER_FILTER", "(&(objectClass=person)(mail={login}))"),
+		LDAPIDAttr:       envString("LDAP_ID_ATTRIBUTE", "entryUUID"),
+		LDAPEmailAttr:    envString("LDAP_EMAIL_ATTRIBUTE", "mail"),
+		LDAPUsernameAttr: envString("LDAP_USERNAME_ATTRIBUTE", "uid"),
+
+		InstanceName:         envString("INSTANCE_NAME", "Talkie"),
+		InstanceLogoURL:      envString("INSTANCE_LOGO_URL", ""),
+		InstanceContactEmail: envString("INSTANCE_CONTACT_EMAIL", ""),
+		InstanceContactURL:   envString("INSTANCE_CONTACT_URL", ""),
+		Registration:         envString("REGISTRATION", "open"),
+		SetupToken:           envString("SETUP_TOKEN", ""),
+
+		TrustProxyHeaders: envBool("TRUST_PROXY_HEADERS", false),
+		WSMaxConnsPerUser: envInt("WS_MAX_CONNS_PER_USER", 10),
+		WSMaxConnsPerIP:   envInt("WS_MAX_CONNS_PER_IP", 50),
+		WSConnLimitPolicy: envString("WS_CONN_LIMIT_POLICY", "reject"),
+		WSFanoutWorkers:   envInt("WS_FANOUT_WORKERS", 0),
+		WSReapMissedPings: envInt("WS_REAP_MISSED_PINGS", 3),
+		WSAcceptRate:      envInt("WS_ACCEPT_RATE", 200),
+		WSAcceptBurst:     envInt("WS_ACCEPT_BURST", 400),
+		APIRateLimit:      envInt("API_RATE_LIMIT", 20),
+		APIRateBurst:      envInt("API_RATE_BURST", 100),
+
+		InviteJoinsPerMinute: envInt("INVITE_JOINS_PER_MINUTE", 20),
+		JoinSpikeThreshold:   envInt("JOIN_SPIKE_THRESHOLD", 10),
+		InviteGuessLimit:     envInt("INVITE_GUESS_LIMIT", 10),
+
+		InvitePreviewNames:        envBool("INVITE_PREVIEW_NAMES", true),
+		InvitePreviewMemberCounts: envBool("INVITE_PREVIEW_MEMBER_COUNTS", true),
+
+		QuotaMaxRooms:       envInt("QUOTA_MAX_ROOMS_PER_USER", 0),
+		QuotaMaxRoomMembers: envInt("QUOTA_MAX_ROOM_MEMBERS", 0),
+		QuotaMaxUploadMB:    envInt("QUOTA_MAX_UPLOAD_MB", 8),
+		QuotaHistoryDays:    envInt("QUOTA_HISTORY_DAYS", 0),
+
+		UploadAllowedTypes: splitCSV(strings.ToLower(envString("UPLOAD_ALLOWED_TYPES", ""))),
+		UploadBlockedTypes: splitCSV(strings.ToLower(envString("UPLOAD_BLOCKED_TYPES", ""))),
+
+		RoomWarnMessages: envInt("ROOM_WARN_MESSAGES", 0),
+		RoomWarnMediaMB:  envInt("ROOM_WARN_MEDIA_MB", 0),
+		RoomWarnPercent:  envInt("ROOM_WARN_PERCENT", 80),
+
+		AgeGate:  envString("AGE_GATE", "off"),
+		MinAge:   envInt("MIN_AGE", 13),
+		AdultAge: envInt("ADULT_AGE", 18),
+
+		StripeWebhookSecret: envString("STRIPE_WEBHOOK_SECRET", ""),
+		StripePricePlans:    parseMap(envString("STRIPE_PRICE_PLANS", "")),
+
+		HistoryCacheRooms: envInt("HISTORY_CACHE_ROOMS", 512),
+		HistoryCacheSize:  envInt("HISTORY_CACHE_SIZE", 50),
+
+		MetricsToken: envString("METRICS_TOKEN", ""),
+		DebugAddr:    envString("DEBUG_ADDR", ""),
+
+		LogLevel:        strings.ToLower(envString("LOG_LEVEL", "info")),
+		LogFormat:       envString("LOG_FORMAT", "console"),
+		LogModuleLevels: parseMap(strings.ToLower(envString("LOG_MODULE_LEVELS", ""))),
+		LogWSSample:     envInt("LOG_WS_SAMPLE", 1),
+		LogFile:         envString("LOG_FILE", ""),
+		LogSyslog:       envString("LOG_SYSLOG", ""),
+
+		ErrorReportingDSN:         envString("ERROR_REPORTING_DSN", ""),
+		ErrorReportingEnvironment: envString("ERROR_REPORTING_ENVIRONMENT", ""),
+
+		WorkerEnabled:    envBool("WORKER_ENABLED", true),
+		WorkerIntervalMS: envInt("WORKER_INTERVAL_MS", 1000),
+
+		CanaryIntervalS:    envInt("CANARY_INTERVAL_S", 0),
+		CanaryURL:          strings.TrimRight(envString("CANARY_URL", ""), "/"),
+		CanaryMaxLatencyMS: envInt("CANARY_MAX_LATENCY_MS", 2000),
+
+		TelemetryEnabled:   envBool("TELEMETRY_ENABLED", false),
+		TelemetryURL:       envString("TELEMETRY_URL", ""),
+		TelemetryIntervalH: envInt("TELEMETRY_INTERVAL_H", 24),
+
+		BroadcastBackend: envString("BROADCAST_BACKEND", "local"),
+
+		Region:      envString("REGION", ""),
+		WSPublicURL: strings.TrimRight(envString("WS_PUBLIC_URL", ""), "/"),
+		WSShardURLs: splitCSV(envString("WS_SHARD_URLS", "")),
+
+		STUNURLs:           splitCSV(envString("STUN_URLS", "")),
+		TURNURLs:           splitCSV(envString("TURN_URLS", "")),
+		TURNSecret:         os.Getenv("TURN_SECRET"),
+		TURNCredentialTTLS: envInt("TURN_CREDENTIAL_TTL_S", 24*3600),
+		P2PCalls:           envBool("P2P_CALLS", false),
+
+		EmbedRequestsPerMinute: envInt("EMBED_REQUESTS_PER_MINUTE", 60),
+		EmbedStreamsPerIP:      envInt("EMBED_STREAMS_PER_IP", 3),
+
+		RegionUploadDirs:  parseMap(envString("REGION_UPLOADS_DIRS", "")),
+		RegionLiveKitURLs: parseMap(envString("REGION_LIVEKIT_URLS", "")),
+
+		GeoIPDBPath:        envString("GEOIP_DB_PATH", ""),
+		LoginAlertsEnabled: envBool("LOGIN_ALERTS_ENABLED", true),
+
+		CompressionEnabled:  envBool("COMPRESSION_ENABLED", true),
+		CompressionLevel:    envInt("COMPRESSION_LEVEL", 5),
+		CompressionMinBytes: envInt("COMPRESSION_MIN_BYTES", 1024),
+		UploadsCacheMaxAge:  envInt("UPLOADS_CACHE_MAX_AGE", 30*24*60*60),
+		AvatarsCacheMaxAge:  envInt("AVATARS_CACHE_MAX_AGE", 30*24*60*60),
+		UploadsCacheScope:   envString("UPLOADS_CACHE_SCOPE", "public"),
+
+		NSFWClassifierURL:       envString("NSFW_CLASSIFIER_URL", ""),
+		NSFWClassifierThreshold: envInt("NSFW_CLASSIFIER_THRESHOLD", 80),
+
+		AltTextAPIURL: envString("ALT_TEXT_API_URL", ""),
+		AltTextModel:  envString("ALT_TEXT_MODEL", ""),
+		AltTextAPIKey: envString("ALT_TEXT_API_KEY", ""),
+
+		SlashCommandsAllowPrivate: envBool("SLASH_COMMANDS_ALLOW_PRIVATE", false),
+
+		FFmpegPath: envString("FFMPEG_PATH", ""),
+
+		MaxMessageLength: envInt("MAX_MESSAGE_LENGTH", 4000),
+		EmojiShortcodes:  envBool("EMOJI_SHORTCODES", true),
+		ProfanityWords:   splitCSV(envString("PROFANITY_WORDS", "")),
+
+		ModerationDictionaryDir: envString("MODERATION_DICTIONARY_DIR", ""),
+
+		S3Bucket:        envString("S3_BUCKET", ""),
+		S3Region:        envString("S3_REGION", "us-east-1"),
+		S3Endpoint:      envString("S3_ENDPOINT", ""),
+		S3AccessKey:     envString("S3_ACCESS_KEY_ID", ""),
+		S3SecretKey:     envString("S3_SECRET_ACCESS_KEY", ""),
+		S3PublicURL:     envString("S3_PUBLIC_URL", ""),
+		S3MaxUploadMB:   envInt("S3_MAX_UPLOAD_MB", 1024),
+		S3FormTTLS:      envInt("S3_UPLOAD_FORM_TTL_S", 15*60),
+		S3SignedURLTTLS: envInt("S3_SIGNED_URL_TTL_S", 0),
+
+		ArchiveAfterMonths: envInt("ARCHIVE_AFTER_MONTHS", 0),
+		ArchiveBucket:      envString("ARCHIVE_S3_BUCKET", ""),
+		ArchivePrefix:      envString("ARCHIVE_PREFIX", "archive/"),
+
+		GuestMaxDays:          envInt("GUEST_MAX_DAYS", 30),
+		GuestCleanupIntervalS: envInt("GUEST_CLEANUP_INTERVAL_S", 3600),
+
+		MaintenanceEnabled:      envBool("MAINTENANCE_ENABLED", true),
+		MaintenanceIntervalS:    envInt("MAINTENANCE_INTERVAL_S", 3600),
+		RollupRefreshIntervalS:  envInt("ROLLUP_REFRESH_INTERVAL_S", 6*3600),
+		SoftDeleteRetentionDays: envInt("SOFT_DELETE_RETENTION_DAYS", 30),
+		UploadGCIntervalS:       envInt("UPLOAD_GC_INTERVAL_S", 0),
+
+		DBQueryTimeoutMS:  envInt("DB_QUERY_TIMEOUT_MS", 5000),
+		DBQueryTimeoutsMS: parseTimeouts(envString("DB_QUERY_TIMEOUTS", "")),
+		DBPoolWaitWarnMS:  envInt("DB_POOL_WAIT_WARN_MS", 100),
 	}
 
 	if cfg.DatabaseURL == "" {
@@ -50,8 +538,121 @@ func Load() (Config, error) {
 	if cfg.JWTSecret == "" {
 		return Config{}, fmt.Errorf("JWT_SECRET is required")
 	}
-	if cfg.LiveKitAPIKey == "" || cfg.LiveKitAPISecret == "" || cfg.LiveKitURL == "" {
-		return Config{}, fmt.Errorf("LIVEKIT_API_KEY, LIVEKIT_API_SECRET, LIVEKIT_URL are required")
+	if cfg.PhoneHashKey == "" {
+		cfg.PhoneHashKey = cfg.JWTSecret
+	}
+	switch cfg.CallProvider {
+	case "livekit":
+		if cfg.LiveKitAPIKey == "" || cfg.LiveKitAPISecret == "" || cfg.LiveKitURL == "" {
+			return Config{}, fmt.Errorf("LIVEKIT_API_KEY, LIVEKIT_API_SECRET, LIVEKIT_URL are required")
+		}
+	case "jitsi":
+		if cfg.JitsiURL == "" || cfg.JitsiAppID == "" || cfg.JitsiAppSecret == "" {
+			return Config{}, fmt.Errorf("JITSI_URL, JITSI_APP_ID, JITSI_APP_SECRET are required with CALL_PROVIDER=jitsi")
+		}
+	default:
+		return Config{}, fmt.Errorf("CALL_PROVIDER must be livekit or jitsi")
+	}
+	if len(cfg.CORSUploadOrigins) == 0 {
+		cfg.CORSUploadOrigins = cfg.AllowedOrigins
+	}
+	for _, origins := range [][]string{cfg.AllowedOrigins, cfg.CORSPublicOrigins, cfg.CORSUploadOrigins} {
+		for _, o := range origins {
+			if strings.Count(o, "*") > 1 {
+				return Config{}, fmt.Errorf("CORS origin %q may hold only one * wildcard", o)
+			}
+		}
+	}
+	if cfg.CORSMaxAgeS < 0 {
+		return Config{}, fmt.Errorf("CORS_MAX_AGE_S must not be negative")
+	}
+	featureFlags, err := flags.Parse(envString("FEATURE_FLAGS", ""))
+	if err != nil {
+		return Config{}, fmt.Errorf("FEATURE_FLAGS: %w", err)
+	}
+	cfg.FeatureFlags = featureFlags
+	if len(cfg.TURNURLs) > 0 && cfg.TURNSecret == "" {
+		return Config{}, fmt.Errorf("TURN_SECRET is required with TURN_URLS")
+	}
+	if cfg.LDAPURL != "" {
+		if !strings.HasPrefix(cfg.LDAPURL, "ldap://") && !strings.HasPrefix(cfg.LDAPURL, "ldaps://") {
+			return Config{}, fmt.Errorf("LDAP_URL must start with ldap:// or ldaps://")
+		}
+		if cfg.LDAPBaseDN == "" {
+			return Config{}, fmt.Errorf("LDAP_BASE_DN is required with LDAP_URL")
+		}
+		if !strings.Contains(cfg.LDAPUserFilter, "{login}") {
+			return Config{}, fmt.Errorf("LDAP_USER_FILTER must contain {login}")
+		}
+	}
+	if cfg.TURNCredentialTTLS < 60 {
+		return Config{}, fmt.Errorf("TURN_CREDENTIAL_TTL_S must be at least 60")
+	}
+
+	if cfg.WSConnLimitPolicy != "reject" && cfg.WSConnLimitPolicy != "close_oldest" {
+		return Config{}, fmt.Errorf("WS_CONN_LIMIT_POLICY must be reject or close_oldest")
+	}
+	if cfg.BroadcastBackend != "local" && cfg.BroadcastBackend != "postgres" {
+		return Config{}, fmt.Errorf("BROADCAST_BACKEND must be local or postgres")
+	}
+	if cfg.Registration != "open" && cfg.Registration != "closed" {
+		return Config{}, fmt.Errorf("REGISTRATION must be open or closed")
+	}
+	if cfg.AgeGate != "off" && cfg.AgeGate != "optional" && cfg.AgeGate != "required" {
+		return Config{}, fmt.Errorf("AGE_GATE must be off, optional or required")
+	}
+	if cfg.UploadsCacheScope != "public" && cfg.UploadsCacheScope != "private" {
+		return Config{}, fmt.Errorf("UPLOADS_CACHE_SCOPE must be public or private")
+	}
+	if cfg.MaxMessageLength < 1 || cfg.MaxMessageLength > MaxMessageLengthCeiling {
+		return Config{}, fmt.Errorf("MAX_MESSAGE_LENGTH must be between 1 and %d", MaxMessageLengthCeiling)
+	}
+	if cfg.RoomWarnPercent < 1 || cfg.RoomWarnPercent > 100 {
+		return Config{}, fmt.Errorf("ROOM_WARN_PERCENT must be between 1 and 100")
+	}
+	if cfg.ArchiveAfterMonths < 0 {
+		return Config{}, fmt.Errorf("ARCHIVE_AFTER_MONTHS must not be negative")
+	}
+	if cfg.ArchiveAfterMonths > 0 && cfg.ArchiveBucket == "" {
+		return Config{}, fmt.Errorf("ARCHIVE_S3_BUCKET is required with ARCHIVE_AFTER_MONTHS")
+	}
+	if cfg.LogFormat != "console" && cfg.LogFormat != "json" {
+		return Config{}, fmt.Errorf("LOG_FORMAT must be console or json")
+	}
+	if cfg.LogWSSample < 1 {
+		return Config{}, fmt.Errorf("LOG_WS_SAMPLE must be at least 1")
+	}
+	if cfg.CanaryIntervalS < 0 || cfg.CanaryMaxLatencyMS < 1 {
+		return Config{}, fmt.Errorf("CANARY_INTERVAL_S must not be negative and CANARY_MAX_LATENCY_MS must be positive")
+	}
+	if cfg.CanaryURL == "" {
+		cfg.CanaryURL = fmt.Sprintf("ws://127.0.0.1:%d", cfg.Port)
+	}
+	if cfg.TelemetryEnabled {
+		if !strings.HasPrefix(cfg.TelemetryURL, "https://") && !strings.HasPrefix(cfg.TelemetryURL, "http://") {
+			return Config{}, fmt.Errorf("TELEMETRY_URL must be an http(s) URL when TELEMETRY_ENABLED is set")
+		}
+		if cfg.TelemetryIntervalH < 1 {
+			return Config{}, fmt.Errorf("TELEMETRY_INTERVAL_H must be at least 1")
+		}
+	}
+	if cfg.AltTextAPIURL != "" && cfg.AltTextModel == "" {
+		return Config{}, fmt.Errorf("ALT_TEXT_MODEL is required with ALT_TEXT_API_URL")
+	}
+	for _, t := range append(slices.Clone(cfg.UploadAllowedTypes), cfg.UploadBlockedTypes...) {
+		if top, sub, ok := strings.Cut(t, "/"); !ok || top == "" || sub == "" || top == "*" {
+			return Config{}, fmt.Errorf("UPLOAD_ALLOWED_TYPES and UPLOAD_BLOCKED_TYPES take MIME types like image/png or image/*, not %q", t)
+		}
+	}
+	fields, err := profile.ParseConfig(os.Getenv("PROFILE_FIELDS"))
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.ProfileFields = fields
+	for _, name := range cfg.RegionNames() {
+		if !validRegionName(name) {
+			return Config{}, fmt.Errorf("region %q: names must be 1-32 lowercase letters, digits or dashes", name)
+		}
 	}
 
 	return cfg, nil
@@ -76,6 +677,86 @@ func envInt(key string, fallback int) int {
 	return n
 }
 
+func envBool(key string, fallback bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return fallback
+	}
+	return b
+}
+
+// JWTVerificationSecrets lists the secrets tokens are accepted with: the
+// current JWT_SECRET first, then any JWT_PREVIOUS_SECRETS still honoured
+// after a rotation.
+func (c Config) JWTVerificationSecrets() []string {
+	return append([]string{c.JWTSecret}, c.JWTPrevSecrets...)
+}
+
+// RegionNames lists every data region configured in either region map.
+func (c Config) RegionNames() []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, m := range []map[string]string{c.RegionUploadDirs, c.RegionLiveKitURLs} {
+		for name := range m {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseMap reads a comma-separated list of "key=value" entries.
+func parseMap(v string) map[string]string {
+	out := map[string]string{}
+	for _, entry := range splitCSV(v) {
+		name, value, found := strings.Cut(entry, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if name == "" || value == "" || !found {
+			continue
+		}
+		out[name] = value
+	}
+	return out
+}
+
+func validRegionName(name string) bool {
+	if len(name) == 0 || len(name) > 32 {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseTimeouts reads DB_QUERY_TIMEOUTS, a comma-separated list of
+// "Operation=<ms>" entries keyed by Store method name.
+func parseTimeouts(v string) map[string]int {
+	timeouts := map[string]int{}
+	for _, entry := range splitCSV(v) {
+		name, value, found := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if name == "" || !found {
+			continue
+		}
+		ms, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			continue
+		}
+		timeouts[name] = ms
+	}
+	return timeouts
+}
+
 func splitCSV(v string) []string {
 	parts := strings.Split(v, ",")
 	out := make([]string, 0, len(parts))
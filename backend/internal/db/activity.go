@@ -0,0 +1,103 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Activity bucket sizes for RoomActivity.
+const (
+	ActivityHour = "hour"
+	ActivityDay  = "day"
+)
+
+// ActivityBucket is how many messages were posted in a room in the hour or
+// day starting at Start.
+type ActivityBucket struct {
+	Start    time.Time `json:"start"`
+	Messages int       `json:"messages"`
+}
+
+// RefreshRoomActivity rolls message counts up into room_activity_hourly. It
+// recounts from the hour before the newest rolled-up one, which picks up
+// messages that committed late and ones shadowed since; the first run
+// counts the whole history. Shadowed messages are not counted.
+func (s *Store) RefreshRoomActivity(ctx context.Context) (int64, error) {
+	ctx, done := s.op(ctx, "RefreshRoomActivity")
+	defer done()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var since sql.NullTime
+	if err := tx.QueryRowContext(ctx, `SELECT MAX(hour) - INTERVAL '1 hour' FROM room_activity_hourly`).Scan(&since); err != nil {
+		return 0, err
+	}
+	if since.Valid {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM room_activity_hourly WHERE hour >= $1`, since.Time); err != nil {
+			return 0, err
+		}
+	}
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO room_activity_hourly (room_id, hour, messages)
+		SELECT room_id, date_trunc('hour', created_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC', COUNT(*)
+		FROM messages
+		WHERE NOT shadowed
+		  AND ($1::timestamptz IS NULL OR created_at >= $1)
+		GROUP BY 1, 2
+	`, since)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+// RoomActivity returns roomID's message counts from from up to to, oldest
+// first, in hour or day buckets. Hours are UTC hours; days start at
+// midnight in loc. Buckets without messages are left out, and counts lag
+// behind by up to the rollup interval.
+func (s *Store) RoomActivity(ctx context.Context, roomID uuid.UUID, from, to time.Time, bucket string, loc *time.Location) ([]ActivityBucket, error) {
+	ctx, done := s.op(ctx, "RoomActivity")
+	defer done()
+	query := `
+		SELECT hour, messages
+		FROM room_activity_hourly
+		WHERE room_id = $1 AND hour >= $2 AND hour < $3
+		ORDER BY hour
+	`
+	args := []any{roomID, from, to}
+	if bucket == ActivityDay {
+		query = `
+			SELECT date_trunc('day', hour AT TIME ZONE $4) AT TIME ZONE $4 AS day, SUM(messages)
+			FROM room_activity_hourly
+			WHERE room_id = $1 AND hour >= $2 AND hour < $3
+			GROUP BY day
+			ORDER BY day
+		`
+		args = append(args, loc.String())
+	}
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := []ActivityBucket{}
+	for rows.Next() {
+		var b ActivityBucket
+		if err := rows.Scan(&b.Start, &b.Messages); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets, rows.Err()
+}
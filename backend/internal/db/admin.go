@@ -0,0 +1,124 @@
+package db
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// Instance administration helpers, used by talkiectl and the admin API.
+
+func (s *Store) SetUserAdmin(ctx context.Context, userID uuid.UUID, isAdmin bool) error {
+	ctx, done := s.op(ctx, "SetUserAdmin")
+	defer done()
+	return s.execOne(ctx, `UPDATE users SET is_admin = $2 WHERE id = $1`, userID, isAdmin)
+}
+
+// ListInstanceAdminIDs returns the users with is_admin set.
+func (s *Store) ListInstanceAdminIDs(ctx context.Context) ([]uuid.UUID, error) {
+	ctx, done := s.op(ctx, "ListInstanceAdminIDs")
+	defer done()
+	rows, err := s.DB.QueryContext(ctx, `SELECT id FROM users WHERE is_admin`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) SetUserBot(ctx context.Context, userID uuid.UUID, isBot bool) error {
+	ctx, done := s.op(ctx, "SetUserBot")
+	defer done()
+	return s.execOne(ctx, `UPDATE users SET is_bot = $2 WHERE id = $1`, userID, isBot)
+}
+
+func (s *Store) SetUserPassword(ctx context.Context, userID uuid.UUID, passwordHash string) error {
+	ctx, done := s.op(ctx, "SetUserPassword")
+	defer done()
+	return s.execOne(ctx, `
+		UPDATE users
+		SET password_hash = $2,
+		    password_reset_token_hash = NULL,
+		    session_version = session_version + 1
+		WHERE id = $1
+	`, userID, passwordHash)
+}
+
+func (s *Store) MarkEmailVerified(ctx context.Context, userID uuid.UUID) error {
+	ctx, done := s.op(ctx, "MarkEmailVerified")
+	defer done()
+	return s.execOne(ctx, `
+		UPDATE users
+		SET email_verified = TRUE,
+		    email_verification_token_hash = NULL
+		WHERE id = $1
+	`, userID)
+}
+
+// ListReferencedUploads returns every /uploads/... URL still referenced by a
+// message, archived or not, or an avatar, or reused for a new upload in the
+// last day.
+func (s *Store) ListReferencedUploads(ctx context.Context) (map[string]struct{}, error) {
+	ctx, done := s.op(ctx, "ListReferencedUploads")
+	defer done()
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT media_url FROM messages WHERE media_url LIKE '/uploads/%'
+		UNION
+		SELECT avatar_url FROM users WHERE avatar_url LIKE '/uploads/%'
+		UNION
+		SELECT url FROM upload_blobs WHERE ref_count > 0 OR last_used_at > NOW() - INTERVAL '1 day'
+		UNION
+		SELECT u FROM message_archives, unnest(media_urls) u WHERE u LIKE '/uploads/%'
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string]struct{})
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, err
+		}
+		out[url] = struct{}{}
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) execOne(ctx context.Context, query string, args ...any) error {
+	res, err := s.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteUsersByEmailDomain removes every user whose email ends in @domain,
+// along with the rooms and messages they own. It backs fixture cleanup for
+// tools such as cmd/loadtest. Users whose content is under a legal hold
+// are left in place.
+func (s *Store) DeleteUsersByEmailDomain(ctx context.Context, domain string) (int64, error) {
+	ctx, done := s.op(ctx, "DeleteUsersByEmailDomain")
+	defer done()
+	res, err := s.DB.ExecContext(ctx, `DELETE FROM users WHERE email LIKE '%@' || $1 AND NOT legal_hold_blocks_user(id)`, domain)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,49 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
+
+// AdminContact is a room admin who can be reached by email, with their
+// quiet hours.
+type AdminContact struct {
+	UserID     uuid.UUID
+	Email      string
+	Username   string
+	Timezone   string
+	QuietHours QuietHours
+}
+
+// ListAdminEmailContacts returns the admins of roomID who take admin emails
+// and have a verified address.
+func (s *Store) ListAdminEmailContacts(ctx context.Context, roomID uuid.UUID) ([]AdminContact, error) {
+	ctx, done := s.op(ctx, "ListAdminEmailContacts")
+	defer done()
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT u.id, u.email, u.username, u.timezone, u.quiet_hours
+		FROM room_members rm
+		JOIN users u ON u.id = rm.user_id
+		WHERE rm.room_id = $1 AND rm.role = 'admin'
+		  AND u.admin_emails AND u.email_verified AND u.email <> ''
+	`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []AdminContact
+	for rows.Next() {
+		var c AdminContact
+		var raw []byte
+		if err := rows.Scan(&c.UserID, &c.Email, &c.Username, &c.Timezone, &raw); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(raw, &c.QuietHours); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,55 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AgeSettings is what the age gate knows about a user.
+type AgeSettings struct {
+	DateOfBirth *time.Time `json:"date_of_birth,omitempty"`
+	// RestrictedOverride is set when an admin forced restricted mode on or
+	// off regardless of the date of birth.
+	RestrictedOverride *bool `json:"restricted_override,omitempty"`
+}
+
+func (s *Store) GetUserAge(ctx context.Context, userID uuid.UUID) (AgeSettings, error) {
+	ctx, done := s.op(ctx, "GetUserAge")
+	defer done()
+	var dob sql.NullTime
+	var override sql.NullBool
+	err := s.DB.QueryRowContext(ctx, `SELECT date_of_birth, age_restricted FROM users WHERE id = $1`, userID).Scan(&dob, &override)
+	if errors.Is(err, sql.ErrNoRows) {
+		return AgeSettings{}, ErrNotFound
+	}
+	if err != nil {
+		return AgeSettings{}, err
+	}
+	var a AgeSettings
+	if dob.Valid {
+		a.DateOfBirth = &dob.Time
+	}
+	if override.Valid {
+		a.RestrictedOverride = &override.Bool
+	}
+	return a, nil
+}
+
+// SetUserDateOfBirth records or, with nil, clears userID's date of birth.
+func (s *Store) SetUserDateOfBirth(ctx context.Context, userID uuid.UUID, dob *time.Time) error {
+	ctx, done := s.op(ctx, "SetUserDateOfBirth")
+	defer done()
+	return s.execOne(ctx, `UPDATE users SET date_of_birth = $2 WHERE id = $1`, userID, dob)
+}
+
+// SetUserAgeRestricted forces restricted mode on or off; nil goes back to
+// deriving it from the date of birth.
+func (s *Store) SetUserAgeRestricted(ctx context.Context, userID uuid.UUID, restricted *bool) error {
+	ctx, done := s.op(ctx, "SetUserAgeRestricted")
+	defer done()
+	return s.execOne(ctx, `UPDATE users SET age_restricted = $2 WHERE id = $1`, userID, restricted)
+}
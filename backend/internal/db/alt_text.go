@@ -0,0 +1,34 @@
+package db
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// MaxAltTextLength is the longest alt text, in characters, messages take
+// (migration 086).
+const MaxAltTextLength = 1000
+
+// SetMessageAltText sets the author's alt text on an image message, or
+// clears it when altText is empty. It replaces generated alt text.
+func (s *Store) SetMessageAltText(ctx context.Context, roomID uuid.UUID, messageID int64, altText string) error {
+	ctx, done := s.op(ctx, "SetMessageAltText")
+	defer done()
+	return s.execOne(ctx, `
+		UPDATE messages SET alt_text = NULLIF($3, ''), alt_text_generated = FALSE
+		WHERE id = $1 AND room_id = $2 AND message_type = 'image'
+	`, messageID, roomID, altText)
+}
+
+// SetGeneratedAltText sets alt text a vision model wrote. It returns
+// ErrNotFound when the message is gone or already has alt text, so the
+// author's own always wins.
+func (s *Store) SetGeneratedAltText(ctx context.Context, roomID uuid.UUID, messageID int64, altText string) error {
+	ctx, done := s.op(ctx, "SetGeneratedAltText")
+	defer done()
+	return s.execOne(ctx, `
+		UPDATE messages SET alt_text = $3, alt_text_generated = TRUE
+		WHERE id = $1 AND room_id = $2 AND message_type = 'image' AND alt_text IS NULL
+	`, messageID, roomID, altText)
+}
@@ -0,0 +1,263 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MessageArchive is the manifest entry for one archived batch: a room's
+// messages first_id to last_id, not necessarily every id in between, moved
+// into ObjectKey in the archive bucket.
+type MessageArchive struct {
+	ID              int64     `json:"id"`
+	RoomID          uuid.UUID `json:"room_id"`
+	FirstID         int64     `json:"first_id"`
+	LastID          int64     `json:"last_id"`
+	FirstAt         time.Time `json:"first_at"`
+	LastAt          time.Time `json:"last_at"`
+	MessageCount    int       `json:"message_count"`
+	ObjectKey       string    `json:"object_key"`
+	CompressedBytes int64     `json:"compressed_bytes"`
+	SHA256          string    `json:"sha256"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// ArchiveBatch is a room's messages about to be archived, each as the JSON
+// of its messages row.
+type ArchiveBatch struct {
+	RoomID    uuid.UUID
+	IDs       []int64
+	FirstAt   time.Time
+	LastAt    time.Time
+	Rows      []json.RawMessage
+	MediaURLs []string
+}
+
+const messageArchiveColumns = `id, room_id, first_id, last_id, first_at, last_at, message_count, object_key, compressed_bytes, sha256, created_at`
+
+func scanMessageArchive(row interface{ Scan(...any) error }) (MessageArchive, error) {
+	var a MessageArchive
+	err := row.Scan(&a.ID, &a.RoomID, &a.FirstID, &a.LastID, &a.FirstAt, &a.LastAt, &a.MessageCount, &a.ObjectKey, &a.CompressedBytes, &a.SHA256, &a.CreatedAt)
+	return a, err
+}
+
+// ArchiveMessages takes up to limit messages of one room created before
+// cutoff, oldest first, and hands them to store, which puts them in the
+// archive bucket and describes the object. The messages are then deleted
+// and the manifest entry saved. Their rows stay locked while store runs, so
+// an edit or deletion cannot slip in between copying and deleting them.
+// Messages under a legal hold or saved to someone's board are left alone.
+// It returns ErrNotFound when nothing is old enough.
+func (s *Store) ArchiveMessages(ctx context.Context, cutoff time.Time, limit int, store func(ArchiveBatch) (MessageArchive, error)) (MessageArchive, error) {
+	ctx, done := s.op(ctx, "ArchiveMessages")
+	defer done()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return MessageArchive{}, err
+	}
+	defer tx.Rollback()
+
+	var b ArchiveBatch
+	err = tx.QueryRowContext(ctx, `
+		SELECT m.room_id FROM messages m
+		WHERE m.created_at < $1
+		  AND NOT EXISTS (
+			SELECT 1 FROM legal_holds h
+			WHERE h.released_at IS NULL AND (h.room_id = m.room_id OR h.user_id = m.user_id)
+		  )
+		  AND NOT EXISTS (SELECT 1 FROM board_items bi WHERE bi.message_id = m.id)
+		LIMIT 1
+	`, cutoff).Scan(&b.RoomID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return MessageArchive{}, ErrNotFound
+	}
+	if err != nil {
+		return MessageArchive{}, err
+	}
+	rows, err := tx.QueryContext(ctx, `
+		SELECT m.id, m.created_at, COALESCE(m.media_url, ''), to_jsonb(m) - 'search_vector'
+		FROM messages m
+		WHERE m.room_id = $1 AND m.created_at < $2
+		  AND NOT EXISTS (
+			SELECT 1 FROM legal_holds h
+			WHERE h.released_at IS NULL AND (h.room_id = m.room_id OR h.user_id = m.user_id)
+		  )
+		  AND NOT EXISTS (SELECT 1 FROM board_items bi WHERE bi.message_id = m.id)
+		ORDER BY m.id
+		LIMIT $3
+		FOR UPDATE OF m
+	`, b.RoomID, cutoff, limit)
+	if err != nil {
+		return MessageArchive{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var createdAt time.Time
+		var mediaURL string
+		var row json.RawMessage
+		if err := rows.Scan(&id, &createdAt, &mediaURL, &row); err != nil {
+			return MessageArchive{}, err
+		}
+		if len(b.IDs) == 0 || createdAt.Before(b.FirstAt) {
+			b.FirstAt = createdAt
+		}
+		if createdAt.After(b.LastAt) {
+			b.LastAt = createdAt
+		}
+		if mediaURL != "" {
+			b.MediaURLs = append(b.MediaURLs, mediaURL)
+		}
+		b.IDs = append(b.IDs, id)
+		b.Rows = append(b.Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return MessageArchive{}, err
+	}
+	rows.Close()
+	if len(b.IDs) == 0 {
+		return MessageArchive{}, ErrNotFound
+	}
+
+	a, err := store(b)
+	if err != nil {
+		return MessageArchive{}, err
+	}
+	a.RoomID, a.FirstID, a.LastID = b.RoomID, b.IDs[0], b.IDs[len(b.IDs)-1]
+	a.FirstAt, a.LastAt, a.MessageCount = b.FirstAt, b.LastAt, len(b.IDs)
+	if b.MediaURLs == nil {
+		b.MediaURLs = []string{}
+	}
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO message_archives (room_id, first_id, last_id, first_at, last_at, message_count, object_key, compressed_bytes, sha256, media_urls)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (object_key) DO UPDATE
+		SET message_count = EXCLUDED.message_count, compressed_bytes = EXCLUDED.compressed_bytes,
+		    sha256 = EXCLUDED.sha256, media_urls = EXCLUDED.media_urls
+		RETURNING id, created_at
+	`, a.RoomID, a.FirstID, a.LastID, a.FirstAt, a.LastAt, a.MessageCount, a.ObjectKey, a.CompressedBytes, a.SHA256, b.MediaURLs).Scan(&a.ID, &a.CreatedAt)
+	if err != nil {
+		return MessageArchive{}, err
+	}
+	if _, err := tx.ExecContext(ctx, `SET LOCAL talkie.archiving = 'on'`); err != nil {
+		return MessageArchive{}, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM messages WHERE id = ANY($1::bigint[])`, b.IDs); err != nil {
+		return MessageArchive{}, err
+	}
+	return a, tx.Commit()
+}
+
+// ListMessageArchivesBefore returns roomID's archives holding messages
+// older than beforeID, newest first.
+func (s *Store) ListMessageArchivesBefore(ctx context.Context, roomID uuid.UUID, beforeID int64, limit int) ([]MessageArchive, error) {
+	ctx, done := s.op(ctx, "ListMessageArchivesBefore")
+	defer done()
+	return s.listMessageArchives(ctx, `
+		SELECT `+messageArchiveColumns+` FROM message_archives
+		WHERE room_id = $1 AND first_id < $2
+		ORDER BY last_id DESC
+		LIMIT $3
+	`, roomID, beforeID, limit)
+}
+
+// ListMessageArchivesAfter returns roomID's archives holding messages
+// newer than afterID, oldest first.
+func (s *Store) ListMessageArchivesAfter(ctx context.Context, roomID uuid.UUID, afterID int64, limit int) ([]MessageArchive, error) {
+	ctx, done := s.op(ctx, "ListMessageArchivesAfter")
+	defer done()
+	return s.listMessageArchives(ctx, `
+		SELECT `+messageArchiveColumns+` FROM message_archives
+		WHERE room_id = $1 AND last_id > $2
+		ORDER BY first_id
+		LIMIT $3
+	`, roomID, afterID, limit)
+}
+
+// ListExpiredMessageArchives returns archives whose newest message is past
+// its room's history retention (see PurgeExpiredHistory) and archives of
+// rooms that no longer exist. Archives under a legal hold are kept.
+func (s *Store) ListExpiredMessageArchives(ctx context.Context, defaultDays, limit int) ([]MessageArchive, error) {
+	ctx, done := s.op(ctx, "ListExpiredMessageArchives")
+	defer done()
+	return s.listMessageArchives(ctx, `
+		WITH retention AS (
+			SELECT r.id AS room_id,
+			       COALESCE(p.history_days, $1) AS days
+			FROM rooms r
+			JOIN users u ON u.id = r.created_by
+			LEFT JOIN group_channels gc ON gc.room_id = r.id
+			LEFT JOIN room_groups g ON g.id = gc.group_id
+			LEFT JOIN plans p ON p.name = COALESCE(g.plan, u.plan)
+		)
+		SELECT `+messageArchiveColumns+` FROM message_archives a
+		LEFT JOIN retention t ON t.room_id = a.room_id
+		WHERE (t.room_id IS NULL OR (t.days > 0 AND a.last_at < NOW() - make_interval(days => t.days)))
+		  AND NOT EXISTS (
+			SELECT 1 FROM legal_holds h
+			WHERE h.released_at IS NULL AND h.room_id = a.room_id
+		  )
+		ORDER BY a.id
+		LIMIT $2
+	`, defaultDays, limit)
+}
+
+func (s *Store) listMessageArchives(ctx context.Context, query string, args ...any) ([]MessageArchive, error) {
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []MessageArchive{}
+	for rows.Next() {
+		a, err := scanMessageArchive(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) DeleteMessageArchive(ctx context.Context, id int64) error {
+	ctx, done := s.op(ctx, "DeleteMessageArchive")
+	defer done()
+	return s.execOne(ctx, `DELETE FROM message_archives WHERE id = $1`, id)
+}
+
+// RenderArchivedMessages turns archived messages rows back into Messages,
+// with their authors' current names and avatars, oldest first. Messages
+// whose author has since been deleted are dropped, as they would have been
+// from the messages table.
+func (s *Store) RenderArchivedMessages(ctx context.Context, rows []json.RawMessage) ([]Message, error) {
+	ctx, done := s.op(ctx, "RenderArchivedMessages")
+	defer done()
+	batch, err := json.Marshal(rows)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.DB.QueryContext(ctx, `
+		SELECT m.id, m.room_id, m.user_id, u.username, COALESCE(u.avatar_url, ''), m.content, m.message_type, COALESCE(m.media_url, ''), m.created_at, m.client_sent_at, m.shadowed, m.nsfw, m.audio::text, m.components::text, m.contact::text, COALESCE(m.alt_text, ''), COALESCE(m.alt_text_generated, FALSE)
+		FROM jsonb_populate_recordset(NULL::messages, $1::jsonb) m
+		JOIN users u ON u.id = m.user_id
+		ORDER BY m.id
+	`, batch)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	messages := []Message{}
+	for res.Next() {
+		var m Message
+		if err := res.Scan(&m.ID, &m.RoomID, &m.UserID, &m.Username, &m.AvatarURL, contentColumn{&m}, &m.MessageType, &m.MediaURL, &m.CreatedAt, &m.ClientSentAt, &m.Shadowed, &m.NSFW, audioColumn{&m.Audio}, componentsColumn{&m.Components}, contactColumn{&m.Contact}, &m.AltText, &m.AltTextGenerated); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, res.Err()
+}
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// AudioInfo describes the audio of a voice note.
+type AudioInfo struct {
+	// Waveform is a fixed number of peak amplitudes, 0-100, across the
+	// recording.
+	Waveform   []int `json:"waveform"`
+	DurationMS int64 `json:"duration_ms"`
+}
+
+// audioColumn scans the nullable messages.audio JSON into a message.
+type audioColumn struct {
+	dst **AudioInfo
+}
+
+func (c audioColumn) Scan(src any) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		*c.dst = nil
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("audio column: unexpected %T", src)
+	}
+	var info AudioInfo
+	if err := json.Unmarshal(raw, &info); err != nil {
+		return err
+	}
+	*c.dst = &info
+	return nil
+}
+
+// SetMessageAudio attaches the computed audio details to a voice note.
+func (s *Store) SetMessageAudio(ctx context.Context, roomID uuid.UUID, messageID int64, info AudioInfo) error {
+	ctx, done := s.op(ctx, "SetMessageAudio")
+	defer done()
+	raw, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return s.execOne(ctx, `UPDATE messages SET audio = $3 WHERE id = $1 AND room_id = $2`, messageID, roomID, string(raw))
+}
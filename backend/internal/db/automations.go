@@ -0,0 +1,362 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// Automation trigger and action types.
+const (
+	AutomationTriggerMessage = "message"
+
+	AutomationPostMessage = "post_message"
+	AutomationEmail       = "email"
+)
+
+// Automation run states.
+const (
+	AutomationRunRunning = "running"
+	AutomationRunOK      = "ok"
+	AutomationRunFailed  = "failed"
+)
+
+// Automation limits.
+const (
+	MaxAutomationActions  = 5
+	maxAutomationName     = 100
+	maxAutomationContains = 200
+	maxAutomationText     = 2000
+	maxAutomationSubject  = 200
+)
+
+// AutomationTrigger says which messages in the automation's room run it.
+type AutomationTrigger struct {
+	Type string `json:"type"`
+	// Contains, when set, limits the trigger to messages containing it,
+	// ignoring case.
+	Contains string `json:"contains,omitempty"`
+}
+
+// Matches reports whether a message with content fires the trigger.
+func (t AutomationTrigger) Matches(content string) bool {
+	if t.Contains == "" {
+		return true
+	}
+	return strings.Contains(strings.ToLower(content), strings.ToLower(t.Contains))
+}
+
+// AutomationAction is one thing an automation does when it fires. Text and
+// Subject may use the placeholders {{user}}, {{content}} and {{link}}.
+type AutomationAction struct {
+	Type string `json:"type"`
+	// RoomID is where post_message posts, as the automation's owner.
+	RoomID *uuid.UUID `json:"room_id,omitempty"`
+	// UserID is who email writes to, at their verified address. They must
+	// be a member of the automation's room.
+	UserID  *uuid.UUID `json:"user_id,omitempty"`
+	Text    string     `json:"text,omitempty"`
+	Subject string     `json:"subject,omitempty"`
+}
+
+// Automation is a trigger -> actions rule a user set up on a room.
+type Automation struct {
+	ID        int64              `json:"id"`
+	OwnerID   uuid.UUID          `json:"owner_id"`
+	RoomID    uuid.UUID          `json:"room_id"`
+	Name      string             `json:"name"`
+	Trigger   AutomationTrigger  `json:"trigger"`
+	Actions   []AutomationAction `json:"actions"`
+	Enabled   bool               `json:"enabled"`
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+// AutomationRun is one firing of an automation, by MessageID.
+type AutomationRun struct {
+	MessageID  int64      `json:"message_id"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// ValidateAutomation checks the parts of a its owner chose. Whether the
+// owner may use the rooms and users it names is up to the caller.
+func ValidateAutomation(a Automation) error {
+	if a.Name == "" || utf8.RuneCountInString(a.Name) > maxAutomationName {
+		return fmt.Errorf("name must be 1 to %d characters", maxAutomationName)
+	}
+	if a.Trigger.Type != AutomationTriggerMessage {
+		return fmt.Errorf("unknown trigger type %q", a.Trigger.Type)
+	}
+	if utf8.RuneCountInString(a.Trigger.Contains) > maxAutomationContains {
+		return fmt.Errorf("contains must be at most %d characters", maxAutomationContains)
+	}
+	if len(a.Actions) == 0 || len(a.Actions) > MaxAutomationActions {
+		return fmt.Errorf("automations need 1 to %d actions", MaxAutomationActions)
+	}
+	for i, act := range a.Actions {
+		if utf8.RuneCountInString(act.Text) > maxAutomationText || utf8.RuneCountInString(act.Subject) > maxAutomationSubject {
+			return fmt.Errorf("action %d: text or subject too long", i+1)
+		}
+		switch act.Type {
+		case AutomationPostMessage:
+			if act.RoomID == nil || strings.TrimSpace(act.Text) == "" {
+				return fmt.Errorf("action %d: post_message needs room_id and text", i+1)
+			}
+			if act.UserID != nil || act.Subject != "" {
+				return fmt.Errorf("action %d: post_message takes no user_id or subject", i+1)
+			}
+		case AutomationEmail:
+			if act.UserID == nil {
+				return fmt.Errorf("action %d: email needs user_id", i+1)
+			}
+			if act.RoomID != nil {
+				return fmt.Errorf("action %d: email takes no room_id", i+1)
+			}
+		default:
+			return fmt.Errorf("action %d: unknown type %q", i+1, act.Type)
+		}
+	}
+	return nil
+}
+
+// automationColumns scans the trigger and actions JSON of an automation.
+type automationColumns struct {
+	a *Automation
+}
+
+func (c automationColumns) scan(rows interface{ Scan(...any) error }) error {
+	var trigger, actions []byte
+	if err := rows.Scan(&c.a.ID, &c.a.OwnerID, &c.a.RoomID, &c.a.Name, &trigger, &actions, &c.a.Enabled, &c.a.CreatedAt, &c.a.UpdatedAt); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(trigger, &c.a.Trigger); err != nil {
+		return fmt.Errorf("automation %d trigger: %w", c.a.ID, err)
+	}
+	if err := json.Unmarshal(actions, &c.a.Actions); err != nil {
+		return fmt.Errorf("automation %d actions: %w", c.a.ID, err)
+	}
+	return nil
+}
+
+const automationSelect = `SELECT id, owner_id, room_id, name, trigger::text, actions::text, enabled, created_at, updated_at FROM automations`
+
+func (s *Store) listAutomations(ctx context.Context, query string, args ...any) ([]Automation, error) {
+	rows, err := s.DB.QueryContext(ctx, automationSelect+" "+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Automation{}
+	for rows.Next() {
+		var a Automation
+		if err := (automationColumns{&a}).scan(rows); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// ListAutomations returns ownerID's automations, oldest first.
+func (s *Store) ListAutomations(ctx context.Context, ownerID uuid.UUID) ([]Automation, error) {
+	ctx, done := s.op(ctx, "ListAutomations")
+	defer done()
+	return s.listAutomations(ctx, `WHERE owner_id = $1 ORDER BY id`, ownerID)
+}
+
+// ListRoomAutomations returns the enabled automations triggered in
+// roomIDs.
+func (s *Store) ListRoomAutomations(ctx context.Context, roomIDs []uuid.UUID) ([]Automation, error) {
+	ctx, done := s.op(ctx, "ListRoomAutomations")
+	defer done()
+	if len(roomIDs) == 0 {
+		return nil, nil
+	}
+	return s.listAutomations(ctx, `WHERE room_id = ANY($1::uuid[]) AND enabled ORDER BY id`, uuidStrings(roomIDs))
+}
+
+// GetAutomation returns ownerID's automation id.
+func (s *Store) GetAutomation(ctx context.Context, ownerID uuid.UUID, id int64) (Automation, error) {
+	ctx, done := s.op(ctx, "GetAutomation")
+	defer done()
+	var a Automation
+	err := (automationColumns{&a}).scan(s.DB.QueryRowContext(ctx, automationSelect+` WHERE id = $1 AND owner_id = $2`, id, ownerID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Automation{}, ErrNotFound
+	}
+	return a, err
+}
+
+// CountAutomations returns how many automations ownerID has.
+func (s *Store) CountAutomations(ctx context.Context, ownerID uuid.UUID) (int, error) {
+	ctx, done := s.op(ctx, "CountAutomations")
+	defer done()
+	var n int
+	err := s.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM automations WHERE owner_id = $1`, ownerID).Scan(&n)
+	return n, err
+}
+
+// CreateAutomation stores a new automation and returns it with its ID.
+func (s *Store) CreateAutomation(ctx context.Context, a Automation) (Automation, error) {
+	ctx, done := s.op(ctx, "CreateAutomation")
+	defer done()
+	trigger, actions, err := automationJSON(a)
+	if err != nil {
+		return Automation{}, err
+	}
+	err = s.DB.QueryRowContext(ctx, `
+		INSERT INTO automations (owner_id, room_id, name, trigger, actions, enabled)
+		VALUES ($1, $2, $3, $4::jsonb, $5::jsonb, $6)
+		RETURNING id, created_at, updated_at
+	`, a.OwnerID, a.RoomID, a.Name, trigger, actions, a.Enabled).Scan(&a.ID, &a.CreatedAt, &a.UpdatedAt)
+	return a, err
+}
+
+// UpdateAutomation saves a over the automation with its ID and owner.
+func (s *Store) UpdateAutomation(ctx context.Context, a Automation) (Automation, error) {
+	ctx, done := s.op(ctx, "UpdateAutomation")
+	defer done()
+	trigger, actions, err := automationJSON(a)
+	if err != nil {
+		return Automation{}, err
+	}
+	err = s.DB.QueryRowContext(ctx, `
+		UPDATE automations
+		SET room_id = $3, name = $4, trigger = $5::jsonb, actions = $6::jsonb, enabled = $7, updated_at = NOW()
+		WHERE id = $1 AND owner_id = $2
+		RETURNING created_at, updated_at
+	`, a.ID, a.OwnerID, a.RoomID, a.Name, trigger, actions, a.Enabled).Scan(&a.CreatedAt, &a.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Automation{}, ErrNotFound
+	}
+	return a, err
+}
+
+func (s *Store) DeleteAutomation(ctx context.Context, ownerID uuid.UUID, id int64) error {
+	ctx, done := s.op(ctx, "DeleteAutomation")
+	defer done()
+	return s.execOne(ctx, `DELETE FROM automations WHERE id = $1 AND owner_id = $2`, id, ownerID)
+}
+
+func automationJSON(a Automation) (string, string, error) {
+	trigger, err := json.Marshal(a.Trigger)
+	if err != nil {
+		return "", "", err
+	}
+	actions, err := json.Marshal(a.Actions)
+	if err != nil {
+		return "", "", err
+	}
+	return string(trigger), string(actions), nil
+}
+
+// ListAutomationMessages returns the messages in [fromID, toID] that may
+// trigger automations: not shadowed and not posted by an automation.
+func (s *Store) ListAutomationMessages(ctx context.Context, fromID, toID int64) ([]Message, error) {
+	ctx, done := s.op(ctx, "ListAutomationMessages")
+	defer done()
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT m.id, m.room_id, m.user_id, u.username, m.content, m.created_at
+		FROM messages m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.id BETWEEN $1 AND $2 AND NOT m.shadowed AND m.automation_id IS NULL
+		ORDER BY m.id
+	`, fromID, toID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Message
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.RoomID, &m.UserID, &m.Username, contentColumn{&m}, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// StartAutomationRun records that messageID fired automationID, reporting
+// false when it already had.
+func (s *Store) StartAutomationRun(ctx context.Context, automationID, messageID int64) (bool, error) {
+	ctx, done := s.op(ctx, "StartAutomationRun")
+	defer done()
+	res, err := s.DB.ExecContext(ctx, `
+		INSERT INTO automation_runs (automation_id, message_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, automationID, messageID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// FinishAutomationRun records how a run ended; runErr is empty on success.
+func (s *Store) FinishAutomationRun(ctx context.Context, automationID, messageID int64, runErr string) error {
+	ctx, done := s.op(ctx, "FinishAutomationRun")
+	defer done()
+	status := AutomationRunOK
+	if runErr != "" {
+		status = AutomationRunFailed
+	}
+	return s.execOne(ctx, `
+		UPDATE automation_runs SET status = $3, error = $4, finished_at = NOW()
+		WHERE automation_id = $1 AND message_id = $2
+	`, automationID, messageID, status, runErr)
+}
+
+// ListAutomationRuns returns automationID's latest runs, newest first.
+func (s *Store) ListAutomationRuns(ctx context.Context, automationID int64, limit int) ([]AutomationRun, error) {
+	ctx, done := s.op(ctx, "ListAutomationRuns")
+	defer done()
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT message_id, status, error, created_at, finished_at
+		FROM automation_runs
+		WHERE automation_id = $1
+		ORDER BY created_at DESC, message_id DESC
+		LIMIT $2
+	`, automationID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []AutomationRun{}
+	for rows.Next() {
+		var r AutomationRun
+		if err := rows.Scan(&r.MessageID, &r.Status, &r.Error, &r.CreatedAt, &r.FinishedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// SaveAutomationMessage posts content to roomID as userID on behalf of
+// automationID.
+func (s *Store) SaveAutomationMessage(ctx context.Context, roomID, userID uuid.UUID, automationID int64, content string) (Message, error) {
+	ctx, done := s.op(ctx, "SaveAutomationMessage")
+	defer done()
+	content, raw := s.renderContent(content)
+	var id int64
+	err := s.DB.QueryRowContext(ctx, `
+		INSERT INTO messages (room_id, user_id, content, content_raw, message_type, shadowed, nsfw, automation_id)
+		VALUES ($1, $2, $3, $4, 'text', (SELECT shadow_banned FROM users WHERE id = $2), (SELECT nsfw FROM rooms WHERE id = $1), $5)
+		RETURNING id
+	`, roomID, userID, content, raw, automationID).Scan(&id)
+	if err != nil {
+		return Message{}, err
+	}
+	return s.GetMessage(ctx, roomID, id)
+}
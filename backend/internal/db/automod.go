@@ -0,0 +1,206 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Automod rule kinds and actions. See internal/automod for how each kind
+// reads its config.
+var (
+	AutomodKinds   = []string{"pattern", "links", "mentions", "newcomer", "spam"}
+	AutomodActions = []string{"block", "delete", "warn", "mute"}
+)
+
+type AutomodRule struct {
+	ID          int64           `json:"id"`
+	RoomID      uuid.UUID       `json:"room_id"`
+	Kind        string          `json:"kind"`
+	Config      json.RawMessage `json:"config"`
+	Action      string          `json:"action"`
+	MuteMinutes int             `json:"mute_minutes,omitempty"`
+	Enabled     bool            `json:"enabled"`
+	CreatedBy   *uuid.UUID      `json:"created_by,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+type AutomodEvent struct {
+	ID        int64     `json:"id"`
+	RoomID    uuid.UUID `json:"room_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Username  string    `json:"username"`
+	RuleID    *int64    `json:"rule_id,omitempty"`
+	Action    string    `json:"action"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func scanAutomodRule(row interface{ Scan(...any) error }) (AutomodRule, error) {
+	var r AutomodRule
+	var config string
+	var createdBy uuid.NullUUID
+	if err := row.Scan(&r.ID, &r.RoomID, &r.Kind, &config, &r.Action, &r.MuteMinutes, &r.Enabled, &createdBy, &r.CreatedAt); err != nil {
+		return AutomodRule{}, err
+	}
+	r.Config = json.RawMessage(config)
+	if createdBy.Valid {
+		r.CreatedBy = &createdBy.UUID
+	}
+	return r, nil
+}
+
+const automodRuleColumns = `id, room_id, kind, config::text, action, mute_minutes, enabled, created_by, created_at`
+
+func (s *Store) ListAutomodRules(ctx context.Context, roomID uuid.UUID) ([]AutomodRule, error) {
+	ctx, done := s.op(ctx, "ListAutomodRules")
+	defer done()
+	rows, err := s.DB.QueryContext(ctx, `SELECT `+automodRuleColumns+` FROM automod_rules WHERE room_id = $1 ORDER BY id`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []AutomodRule{}
+	for rows.Next() {
+		r, err := scanAutomodRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) CreateAutomodRule(ctx context.Context, rule AutomodRule) (AutomodRule, error) {
+	ctx, done := s.op(ctx, "CreateAutomodRule")
+	defer done()
+	return scanAutomodRule(s.DB.QueryRowContext(ctx, `
+		INSERT INTO automod_rules (room_id, kind, config, action, mute_minutes, enabled, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+automodRuleColumns,
+		rule.RoomID, rule.Kind, string(rule.Config), rule.Action, rule.MuteMinutes, rule.Enabled, rule.CreatedBy))
+}
+
+// UpdateAutomodRule replaces the kind, config, action and enabled flag of
+// the rule with rule.ID in rule.RoomID.
+func (s *Store) UpdateAutomodRule(ctx context.Context, rule AutomodRule) (AutomodRule, error) {
+	ctx, done := s.op(ctx, "UpdateAutomodRule")
+	defer done()
+	updated, err := scanAutomodRule(s.DB.QueryRowContext(ctx, `
+		UPDATE automod_rules
+		SET kind = $3, config = $4, action = $5, mute_minutes = $6, enabled = $7
+		WHERE id = $1 AND room_id = $2
+		RETURNING `+automodRuleColumns,
+		rule.ID, rule.RoomID, rule.Kind, string(rule.Config), rule.Action, rule.MuteMinutes, rule.Enabled))
+	if errors.Is(err, sql.ErrNoRows) {
+		return AutomodRule{}, ErrNotFound
+	}
+	return updated, err
+}
+
+func (s *Store) DeleteAutomodRule(ctx context.Context, roomID uuid.UUID, ruleID int64) error {
+	ctx, done := s.op(ctx, "DeleteAutomodRule")
+	defer done()
+	return s.execOne(ctx, `DELETE FROM automod_rules WHERE id = $1 AND room_id = $2`, ruleID, roomID)
+}
+
+func (s *Store) RecordAutomodEvent(ctx context.Context, ev AutomodEvent) error {
+	ctx, done := s.op(ctx, "RecordAutomodEvent")
+	defer done()
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO automod_events (room_id, user_id, rule_id, action, content)
+		VALUES ($1, $2, $3, $4, $5)
+	`, ev.RoomID, ev.UserID, ev.RuleID, ev.Action, ev.Content)
+	return err
+}
+
+func (s *Store) ListAutomodEvents(ctx context.Context, roomID uuid.UUID, limit int) ([]AutomodEvent, error) {
+	ctx, done := s.op(ctx, "ListAutomodEvents")
+	defer done()
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT e.id, e.room_id, e.user_id, u.username, e.rule_id, e.action, e.content, e.created_at
+		FROM automod_events e
+		JOIN users u ON u.id = e.user_id
+		WHERE e.room_id = $1
+		ORDER BY e.id DESC
+		LIMIT $2
+	`, roomID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []AutomodEvent{}
+	for rows.Next() {
+		var ev AutomodEvent
+		var ruleID sql.NullInt64
+		if err := rows.Scan(&ev.ID, &ev.RoomID, &ev.UserID, &ev.Username, &ruleID, &ev.Action, &ev.Content, &ev.CreatedAt); err != nil {
+			return nil, err
+		}
+		ev.RuleID = nullInt64Ptr(ruleID)
+		out = append(out, ev)
+	}
+	return out, rows.Err()
+}
+
+// MuteRoomMember stops userID posting in roomID until until. An existing
+// mute is extended, never shortened.
+func (s *Store) MuteRoomMember(ctx context.Context, roomID, userID uuid.UUID, until time.Time) error {
+	ctx, done := s.op(ctx, "MuteRoomMember")
+	defer done()
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO room_mutes (room_id, user_id, muted_until)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (room_id, user_id) DO UPDATE SET muted_until = GREATEST(room_mutes.muted_until, EXCLUDED.muted_until)
+	`, roomID, userID, until)
+	return err
+}
+
+func (s *Store) UnmuteRoomMember(ctx context.Context, roomID, userID uuid.UUID) error {
+	ctx, done := s.op(ctx, "UnmuteRoomMember")
+	defer done()
+	return s.execOne(ctx, `DELETE FROM room_mutes WHERE room_id = $1 AND user_id = $2 AND muted_until > NOW()`, roomID, userID)
+}
+
+// ListRoomMutes returns the members of roomID muted right now and until
+// when.
+func (s *Store) ListRoomMutes(ctx context.Context, roomID uuid.UUID) (map[uuid.UUID]time.Time, error) {
+	ctx, done := s.op(ctx, "ListRoomMutes")
+	defer done()
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT user_id, muted_until FROM room_mutes WHERE room_id = $1 AND muted_until > NOW()
+	`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[uuid.UUID]time.Time{}
+	for rows.Next() {
+		var userID uuid.UUID
+		var until time.Time
+		if err := rows.Scan(&userID, &until); err != nil {
+			return nil, err
+		}
+		out[userID] = until
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) GetMemberJoinedAt(ctx context.Context, roomID, userID uuid.UUID) (time.Time, error) {
+	ctx, done := s.op(ctx, "GetMemberJoinedAt")
+	defer done()
+	var joined time.Time
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT joined_at FROM room_members WHERE room_id = $1 AND user_id = $2
+	`, roomID, userID).Scan(&joined)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, ErrNotFound
+	}
+	return joined, err
+}
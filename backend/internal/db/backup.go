@@ -0,0 +1,212 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// BackupTable is a table included in logical backups.
+type BackupTable struct {
+	Name string
+	// Order keeps exports stable and restores in insertion order, which
+	// matters for tables whose ids come from a sequence.
+	Order string
+	// Serial tables have a BIGSERIAL id whose sequence is moved past the
+	// restored rows.
+	Serial bool
+}
+
+// BackupTables lists what a logical backup holds, parents before children
+// so restores satisfy foreign keys. Sessions, devices, delivery state and
+// data the worker can rebuild (worker_cursors) are left out.
+var BackupTables = []BackupTable{
+	{Name: "users", Order: "created_at, id"},
+	{Name: "rooms", Order: "created_at, id"},
+	{Name: "room_groups", Order: "created_at, id"},
+	{Name: "group_channels", Order: "group_id, position, room_id"},
+	{Name: "direct_rooms", Order: "room_id"},
+	{Name: "room_members", Order: "room_id, user_id"},
+	{Name: "messages", Order: "id", Serial: true},
+	{Name: "room_events", Order: "room_id, seq"},
+	{Name: "room_membership_events", Order: "id", Serial: true},
+	{Name: "room_welcomes_sent", Order: "room_id, user_id"},
+	{Name: "friend_requests", Order: "id", Serial: true},
+	{Name: "friendships", Order: "user_id, friend_id"},
+	{Name: "room_invite_links", Order: "created_at, token_hash"},
+	{Name: "friend_invite_links", Order: "created_at, token_hash"},
+	{Name: "guest_invite_links", Order: "created_at, token_hash"},
+	{Name: "notifications", Order: "id", Serial: true},
+}
+
+// LatestMigration returns the newest applied migration, which identifies
+// the schema a backup was taken from.
+func (s *Store) LatestMigration(ctx context.Context) (string, error) {
+	ctx, done := s.op(ctx, "LatestMigration")
+	defer done()
+	var name string
+	err := s.DB.QueryRowContext(ctx, `SELECT COALESCE(MAX(filename), '') FROM schema_migrations`).Scan(&name)
+	return name, err
+}
+
+// ExportBackup streams every row of BackupTables as JSON to each, from one
+// consistent snapshot.
+func (s *Store) ExportBackup(ctx context.Context, each func(table string, row json.RawMessage) error) error {
+	tx, err := s.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, t := range BackupTables {
+		rows, err := tx.QueryContext(ctx, fmt.Sprintf(`SELECT row_to_json(t) FROM %s t ORDER BY %s`, quoteIdent(t.Name), t.Order))
+		if err != nil {
+			return fmt.Errorf("export %s: %w", t.Name, err)
+		}
+		for rows.Next() {
+			var row json.RawMessage
+			if err := rows.Scan(&row); err != nil {
+				rows.Close()
+				return fmt.Errorf("export %s: %w", t.Name, err)
+			}
+			if err := each(t.Name, row); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return fmt.Errorf("export %s: %w", t.Name, err)
+		}
+	}
+	return nil
+}
+
+// Restore loads a logical backup into an empty database inside a single
+// transaction. The room event triggers are disabled for its duration so the
+// restored room_events are kept as exported instead of being regenerated.
+type Restore struct {
+	tx      *sql.Tx
+	columns map[string]map[string]bool
+}
+
+// BeginRestore starts a restore. It refuses databases that already have
+// users, since restored ids would collide with existing data.
+func (s *Store) BeginRestore(ctx context.Context) (*Restore, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	var hasUsers bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users)`).Scan(&hasUsers); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if hasUsers {
+		tx.Rollback()
+		return nil, fmt.Errorf("restore needs an empty database, but it already has users")
+	}
+	for _, table := range []string{"messages", "room_members"} {
+		if _, err := tx.ExecContext(ctx, `ALTER TABLE `+table+` DISABLE TRIGGER USER`); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	r := &Restore{tx: tx, columns: map[string]map[string]bool{}}
+	rows, err := tx.QueryContext(ctx, `
+		SELECT table_name, column_name FROM information_schema.columns
+		WHERE table_schema = current_schema()
+	`)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if r.columns[table] == nil {
+			r.columns[table] = map[string]bool{}
+		}
+		r.columns[table][column] = true
+	}
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Insert restores one exported row. Columns missing from the row, as in
+// backups taken before a migration added them, get their defaults.
+func (r *Restore) Insert(ctx context.Context, table string, row json.RawMessage) error {
+	if !isBackupTable(table) {
+		return fmt.Errorf("unknown backup table %q", table)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(row, &fields); err != nil {
+		return fmt.Errorf("restore %s: %w", table, err)
+	}
+	columns := make([]string, 0, len(fields))
+	for name := range fields {
+		if !r.columns[table][name] {
+			return fmt.Errorf("restore %s: column %q does not exist; upgrade before restoring this backup", table, name)
+		}
+		columns = append(columns, quoteIdent(name))
+	}
+	sort.Strings(columns)
+	list := strings.Join(columns, ", ")
+	query := fmt.Sprintf(`INSERT INTO %s (%s) SELECT %s FROM json_populate_record(NULL::%s, $1::json)`,
+		quoteIdent(table), list, list, quoteIdent(table))
+	if _, err := r.tx.ExecContext(ctx, query, string(row)); err != nil {
+		return fmt.Errorf("restore %s: %w", table, err)
+	}
+	return nil
+}
+
+// Commit moves id sequences past the restored rows, re-enables the triggers
+// and commits.
+func (r *Restore) Commit(ctx context.Context) error {
+	for _, t := range BackupTables {
+		if !t.Serial {
+			continue
+		}
+		name := quoteIdent(t.Name)
+		if _, err := r.tx.ExecContext(ctx, fmt.Sprintf(
+			`SELECT setval(pg_get_serial_sequence('%s', 'id'), COALESCE(MAX(id), 1), MAX(id) IS NOT NULL) FROM %s`,
+			t.Name, name)); err != nil {
+			return fmt.Errorf("reset %s sequence: %w", t.Name, err)
+		}
+	}
+	for _, table := range []string{"messages", "room_members"} {
+		if _, err := r.tx.ExecContext(ctx, `ALTER TABLE `+table+` ENABLE TRIGGER USER`); err != nil {
+			return err
+		}
+	}
+	return r.tx.Commit()
+}
+
+func (r *Restore) Rollback() error {
+	return r.tx.Rollback()
+}
+
+func isBackupTable(name string) bool {
+	for _, t := range BackupTables {
+		if t.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
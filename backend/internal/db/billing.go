@@ -0,0 +1,176 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Subscription is a billing subscription and the account it pays for.
+// Exactly one of UserID and GroupID is set.
+type Subscription struct {
+	ID                string     `json:"id"`
+	CustomerID        string     `json:"customer_id"`
+	UserID            *uuid.UUID `json:"user_id,omitempty"`
+	GroupID           *uuid.UUID `json:"group_id,omitempty"`
+	Status            string     `json:"status"`
+	Plan              string     `json:"plan,omitempty"`
+	CurrentPeriodEnd  *time.Time `json:"current_period_end,omitempty"`
+	CancelAtPeriodEnd bool       `json:"cancel_at_period_end"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+const subscriptionColumns = `id, customer_id, user_id, group_id, status, plan, current_period_end, cancel_at_period_end, updated_at`
+
+func scanSubscription(row interface{ Scan(...any) error }) (Subscription, error) {
+	var sub Subscription
+	var userID, groupID uuid.NullUUID
+	var periodEnd sql.NullTime
+	if err := row.Scan(&sub.ID, &sub.CustomerID, &userID, &groupID, &sub.Status, &sub.Plan, &periodEnd, &sub.CancelAtPeriodEnd, &sub.UpdatedAt); err != nil {
+		return Subscription{}, err
+	}
+	if userID.Valid {
+		sub.UserID = &userID.UUID
+	}
+	if groupID.Valid {
+		sub.GroupID = &groupID.UUID
+	}
+	if periodEnd.Valid {
+		sub.CurrentPeriodEnd = &periodEnd.Time
+	}
+	return sub, nil
+}
+
+// RecordBillingEvent remembers a processed event id and reports whether it
+// was new.
+func (s *Store) RecordBillingEvent(ctx context.Context, eventID string) (bool, error) {
+	ctx, done := s.op(ctx, "RecordBillingEvent")
+	defer done()
+	res, err := s.DB.ExecContext(ctx, `INSERT INTO billing_events (id) VALUES ($1) ON CONFLICT DO NOTHING`, eventID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ForgetBillingEvent drops a recorded event id so a failed event is
+// applied when Stripe retries it.
+func (s *Store) ForgetBillingEvent(ctx context.Context, eventID string) error {
+	ctx, done := s.op(ctx, "ForgetBillingEvent")
+	defer done()
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM billing_events WHERE id = $1`, eventID)
+	return err
+}
+
+// ApplySubscription stores sub as of eventAt and moves its owner onto or
+// off its plan. When entitled the owner gets sub.Plan, provided that plan
+// exists; otherwise the owner loses the plan the subscription gave them,
+// but keeps one an admin assigned by hand. It reports false, changing
+// nothing, when a newer event has already been applied. The owner must
+// exist: ErrNotFound otherwise.
+func (s *Store) ApplySubscription(ctx context.Context, sub Subscription, eventAt time.Time, entitled bool) (bool, error) {
+	ctx, done := s.op(ctx, "ApplySubscription")
+	defer done()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	table, ownerID := "users", sub.UserID
+	if sub.GroupID != nil {
+		table, ownerID = "room_groups", sub.GroupID
+	}
+	var exists bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM `+table+` WHERE id = $1)`, ownerID).Scan(&exists); err != nil {
+		return false, err
+	}
+	if !exists {
+		return false, ErrNotFound
+	}
+
+	var prevPlan string
+	var prevAt time.Time
+	err = tx.QueryRowContext(ctx, `SELECT plan, event_at FROM subscriptions WHERE id = $1 FOR UPDATE`, sub.ID).Scan(&prevPlan, &prevAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return false, err
+	case prevAt.After(eventAt):
+		return false, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO subscriptions (id, customer_id, user_id, group_id, status, plan, current_period_end, cancel_at_period_end, event_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (id) DO UPDATE SET
+			customer_id = EXCLUDED.customer_id,
+			user_id = EXCLUDED.user_id,
+			group_id = EXCLUDED.group_id,
+			status = EXCLUDED.status,
+			plan = EXCLUDED.plan,
+			current_period_end = EXCLUDED.current_period_end,
+			cancel_at_period_end = EXCLUDED.cancel_at_period_end,
+			event_at = EXCLUDED.event_at,
+			updated_at = NOW()
+	`, sub.ID, sub.CustomerID, sub.UserID, sub.GroupID, sub.Status, sub.Plan, sub.CurrentPeriodEnd, sub.CancelAtPeriodEnd, eventAt); err != nil {
+		return false, err
+	}
+
+	// The plan given by an earlier version of this subscription is dropped
+	// first, so a downgrade or lapse does not leave it behind.
+	if prevPlan != "" {
+		if _, err := tx.ExecContext(ctx, `UPDATE `+table+` SET plan = NULL WHERE id = $1 AND plan = $2`, ownerID, prevPlan); err != nil {
+			return false, err
+		}
+	}
+	if entitled && sub.Plan != "" {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE `+table+` SET plan = $2
+			WHERE id = $1 AND EXISTS (SELECT 1 FROM plans WHERE name = $2)
+		`, ownerID, sub.Plan); err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit()
+}
+
+// GetUserSubscription returns the most recently updated subscription paying
+// for userID.
+func (s *Store) GetUserSubscription(ctx context.Context, userID uuid.UUID) (Subscription, error) {
+	ctx, done := s.op(ctx, "GetUserSubscription")
+	defer done()
+	return s.querySubscription(ctx, `
+		SELECT `+subscriptionColumns+`
+		FROM subscriptions
+		WHERE user_id = $1
+		ORDER BY updated_at DESC
+		LIMIT 1
+	`, userID)
+}
+
+// GetGroupSubscription returns the most recently updated subscription
+// paying for a workspace.
+func (s *Store) GetGroupSubscription(ctx context.Context, groupID uuid.UUID) (Subscription, error) {
+	ctx, done := s.op(ctx, "GetGroupSubscription")
+	defer done()
+	return s.querySubscription(ctx, `
+		SELECT `+subscriptionColumns+`
+		FROM subscriptions
+		WHERE group_id = $1
+		ORDER BY updated_at DESC
+		LIMIT 1
+	`, groupID)
+}
+
+func (s *Store) querySubscription(ctx context.Context, query string, id uuid.UUID) (Subscription, error) {
+	sub, err := scanSubscription(s.DB.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Subscription{}, ErrNotFound
+	}
+	return sub, err
+}
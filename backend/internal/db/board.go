@@ -0,0 +1,229 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Board item kinds.
+const (
+	BoardMessage = "message"
+	BoardLink    = "link"
+)
+
+// BoardItem is one entry of a user's saved board: a message from one of
+// their rooms or an outside link, with their note. Message is nil while
+// the message cannot be read, for instance after they left its room.
+type BoardItem struct {
+	ID        int64     `json:"id"`
+	Kind      string    `json:"kind"`
+	MessageID int64     `json:"message_id,omitempty"`
+	Message   *Message  `json:"message,omitempty"`
+	RoomName  string    `json:"room_name,omitempty"`
+	URL       string    `json:"url,omitempty"`
+	Title     string    `json:"title,omitempty"`
+	Note      string    `json:"note"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ListBoardItems returns userID's board in their order.
+func (s *Store) ListBoardItems(ctx context.Context, userID uuid.UUID) ([]BoardItem, error) {
+	ctx, done := s.op(ctx, "ListBoardItems")
+	defer done()
+	return s.boardItems(ctx, userID, 0)
+}
+
+// CountBoardItems returns how many items userID has saved.
+func (s *Store) CountBoardItems(ctx context.Context, userID uuid.UUID) (int, error) {
+	ctx, done := s.op(ctx, "CountBoardItems")
+	defer done()
+	var n int
+	err := s.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM board_items WHERE user_id = $1`, userID).Scan(&n)
+	return n, err
+}
+
+// AddBoardItem puts item at the end of userID's board. Saving a message
+// that is already on the board returns the existing item and false.
+func (s *Store) AddBoardItem(ctx context.Context, userID uuid.UUID, item BoardItem) (BoardItem, bool, error) {
+	ctx, done := s.op(ctx, "AddBoardItem")
+	defer done()
+	var messageID sql.NullInt64
+	var url sql.NullString
+	if item.Kind == BoardMessage {
+		messageID = sql.NullInt64{Int64: item.MessageID, Valid: true}
+	} else {
+		url = sql.NullString{String: item.URL, Valid: true}
+	}
+	var id int64
+	err := s.DB.QueryRowContext(ctx, `
+		INSERT INTO board_items (user_id, message_id, url, title, note, position)
+		VALUES ($1, $2, $3, $4, $5, (SELECT COALESCE(MAX(position), 0) + 1 FROM board_items WHERE user_id = $1))
+		ON CONFLICT (user_id, message_id) WHERE message_id IS NOT NULL DO NOTHING
+		RETURNING id
+	`, userID, messageID, url, item.Title, item.Note).Scan(&id)
+	created := true
+	if errors.Is(err, sql.ErrNoRows) {
+		created = false
+		err = s.DB.QueryRowContext(ctx, `SELECT id FROM board_items WHERE user_id = $1 AND message_id = $2`, userID, item.MessageID).Scan(&id)
+	}
+	if err != nil {
+		return BoardItem{}, false, err
+	}
+	items, err := s.boardItems(ctx, userID, id)
+	if err != nil {
+		return BoardItem{}, false, err
+	}
+	if len(items) == 0 {
+		return BoardItem{}, false, ErrNotFound
+	}
+	return items[0], created, nil
+}
+
+// UpdateBoardItem changes the note and title of one of userID's items;
+// nil leaves a field as it is.
+func (s *Store) UpdateBoardItem(ctx context.Context, userID uuid.UUID, itemID int64, note, title *string) (BoardItem, error) {
+	ctx, done := s.op(ctx, "UpdateBoardItem")
+	defer done()
+	if err := s.execOne(ctx, `
+		UPDATE board_items
+		SET note = COALESCE($3, note), title = COALESCE($4, title), updated_at = NOW()
+		WHERE user_id = $1 AND id = $2
+	`, userID, itemID, note, title); err != nil {
+		return BoardItem{}, err
+	}
+	items, err := s.boardItems(ctx, userID, itemID)
+	if err != nil {
+		return BoardItem{}, err
+	}
+	if len(items) == 0 {
+		return BoardItem{}, ErrNotFound
+	}
+	return items[0], nil
+}
+
+// DeleteBoardItem removes one of userID's items.
+func (s *Store) DeleteBoardItem(ctx context.Context, userID uuid.UUID, itemID int64) error {
+	ctx, done := s.op(ctx, "DeleteBoardItem")
+	defer done()
+	return s.execOne(ctx, `DELETE FROM board_items WHERE user_id = $1 AND id = $2`, userID, itemID)
+}
+
+// ReorderBoardItems puts userID's items in the order of itemIDs, which
+// must list each of them exactly once; otherwise nothing changes and
+// ErrNotFound is returned.
+func (s *Store) ReorderBoardItems(ctx context.Context, userID uuid.UUID, itemIDs []int64) error {
+	ctx, done := s.op(ctx, "ReorderBoardItems")
+	defer done()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `
+		UPDATE board_items b
+		SET position = o.pos
+		FROM unnest($2::bigint[]) WITH ORDINALITY AS o(id, pos)
+		WHERE b.user_id = $1 AND b.id = o.id
+	`, userID, itemIDs)
+	if err != nil {
+		return err
+	}
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	var total int64
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM board_items WHERE user_id = $1`, userID).Scan(&total); err != nil {
+		return err
+	}
+	if updated != int64(len(itemIDs)) || updated != total {
+		return ErrNotFound
+	}
+	return tx.Commit()
+}
+
+// boardItems loads userID's items, or only itemID when it is set, and
+// attaches the messages they can still read.
+func (s *Store) boardItems(ctx context.Context, userID uuid.UUID, itemID int64) ([]BoardItem, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, message_id, COALESCE(url, ''), title, note, position, created_at, updated_at
+		FROM board_items
+		WHERE user_id = $1 AND ($2 = 0 OR id = $2)
+		ORDER BY position, id
+	`, userID, itemID)
+	if err != nil {
+		return nil, err
+	}
+	items := []BoardItem{}
+	var messageIDs []int64
+	for rows.Next() {
+		var it BoardItem
+		var messageID sql.NullInt64
+		if err := rows.Scan(&it.ID, &messageID, &it.URL, &it.Title, &it.Note, &it.Position, &it.CreatedAt, &it.UpdatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		it.Kind = BoardLink
+		if messageID.Valid {
+			it.Kind = BoardMessage
+			it.MessageID = messageID.Int64
+			messageIDs = append(messageIDs, messageID.Int64)
+		}
+		items = append(items, it)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(messageIDs) == 0 {
+		return items, nil
+	}
+
+	// Readable follows the room views: members, and subscribers of
+	// broadcast rooms; shadowed messages only for their author.
+	rows, err = s.DB.QueryContext(ctx, `
+		SELECT m.id, m.room_id, m.user_id, u.username, COALESCE(u.avatar_url, ''), m.content, m.message_type,
+		       COALESCE(m.media_url, ''), m.created_at, m.client_sent_at, m.shadowed, m.nsfw, m.audio::text, m.components::text, m.contact::text, COALESCE(m.alt_text, ''), m.alt_text_generated, r.name
+		FROM messages m
+		JOIN users u ON u.id = m.user_id
+		JOIN rooms r ON r.id = m.room_id
+		WHERE m.id = ANY($2::bigint[])
+		  AND (NOT m.shadowed OR m.user_id = $1)
+		  AND (EXISTS (SELECT 1 FROM room_members rm WHERE rm.room_id = m.room_id AND rm.user_id = $1)
+		       OR (r.broadcast AND EXISTS (SELECT 1 FROM room_subscriptions rs WHERE rs.room_id = m.room_id AND rs.user_id = $1)))
+	`, userID, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	type readable struct {
+		msg  Message
+		room string
+	}
+	byID := make(map[int64]readable, len(messageIDs))
+	for rows.Next() {
+		var rd readable
+		m := &rd.msg
+		if err := rows.Scan(&m.ID, &m.RoomID, &m.UserID, &m.Username, &m.AvatarURL, contentColumn{m}, &m.MessageType, &m.MediaURL, &m.CreatedAt, &m.ClientSentAt, &m.Shadowed, &m.NSFW, audioColumn{&m.Audio}, componentsColumn{&m.Components}, contactColumn{&m.Contact}, &m.AltText, &m.AltTextGenerated, &rd.room); err != nil {
+			return nil, err
+		}
+		byID[m.ID] = rd
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range items {
+		if rd, ok := byID[items[i].MessageID]; ok && items[i].Kind == BoardMessage {
+			msg := rd.msg
+			items[i].Message = &msg
+			items[i].RoomName = rd.room
+		}
+	}
+	return items, nil
+}
@@ -0,0 +1,160 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// SubscribedRoom is a broadcast room a user follows.
+type SubscribedRoom struct {
+	ID              uuid.UUID `json:"id"`
+	Name            string    `json:"name"`
+	SubscriberCount int       `json:"subscriber_count"`
+}
+
+// IsBroadcastRoom reports whether only roomID's members may post in it.
+func (s *Store) IsBroadcastRoom(ctx context.Context, roomID uuid.UUID) (bool, error) {
+	ctx, done := s.op(ctx, "IsBroadcastRoom")
+	defer done()
+	var on bool
+	err := s.DB.QueryRowContext(ctx, `SELECT broadcast FROM rooms WHERE id = $1`, roomID).Scan(&on)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrNotFound
+	}
+	return on, err
+}
+
+// SetRoomBroadcast turns roomID into a broadcast room or back. Turning it
+// off drops its subscriptions; subscribers never were members.
+func (s *Store) SetRoomBroadcast(ctx context.Context, roomID uuid.UUID, on bool) error {
+	ctx, done := s.op(ctx, "SetRoomBroadcast")
+	defer done()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `UPDATE rooms SET broadcast = $2 WHERE id = $1`, roomID, on)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	if !on {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM room_subscriptions WHERE room_id = $1`, roomID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *Store) CountRoomSubscribers(ctx context.Context, roomID uuid.UUID) (int, error) {
+	ctx, done := s.op(ctx, "CountRoomSubscribers")
+	defer done()
+	var n int
+	err := s.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM room_subscriptions WHERE room_id = $1`, roomID).Scan(&n)
+	return n, err
+}
+
+// SubscribeRoom subscribes userID to roomID. It returns ErrNotFound when
+// roomID is not a broadcast room; subscribing twice is not an error.
+func (s *Store) SubscribeRoom(ctx context.Context, roomID, userID uuid.UUID) error {
+	ctx, done := s.op(ctx, "SubscribeRoom")
+	defer done()
+	var ok bool
+	err := s.DB.QueryRowContext(ctx, `
+		WITH room AS (SELECT id FROM rooms WHERE id = $1 AND broadcast),
+		ins AS (
+			INSERT INTO room_subscriptions (room_id, user_id)
+			SELECT id, $2 FROM room
+			ON CONFLICT DO NOTHING
+		)
+		SELECT EXISTS (SELECT 1 FROM room)
+	`, roomID, userID).Scan(&ok)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) UnsubscribeRoom(ctx context.Context, roomID, userID uuid.UUID) error {
+	ctx, done := s.op(ctx, "UnsubscribeRoom")
+	defer done()
+	return s.execOne(ctx, `DELETE FROM room_subscriptions WHERE room_id = $1 AND user_id = $2`, roomID, userID)
+}
+
+// IsRoomSubscriber reports whether userID follows roomID and it is still a
+// broadcast room.
+func (s *Store) IsRoomSubscriber(ctx context.Context, roomID, userID uuid.UUID) (bool, error) {
+	ctx, done := s.op(ctx, "IsRoomSubscriber")
+	defer done()
+	var ok bool
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM room_subscriptions rs
+			JOIN rooms r ON r.id = rs.room_id
+			WHERE rs.room_id = $1 AND rs.user_id = $2 AND r.broadcast
+		)
+	`, roomID, userID).Scan(&ok)
+	return ok, err
+}
+
+// ListSubscribedRooms returns the broadcast rooms userID follows, most
+// recently subscribed first.
+func (s *Store) ListSubscribedRooms(ctx context.Context, userID uuid.UUID) ([]SubscribedRoom, error) {
+	ctx, done := s.op(ctx, "ListSubscribedRooms")
+	defer done()
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT r.id, r.name,
+		       (SELECT COUNT(*) FROM room_subscriptions c WHERE c.room_id = r.id)
+		FROM room_subscriptions rs
+		JOIN rooms r ON r.id = rs.room_id
+		WHERE rs.user_id = $1 AND r.broadcast
+		ORDER BY rs.created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rooms := []SubscribedRoom{}
+	for rows.Next() {
+		var r SubscribedRoom
+		if err := rows.Scan(&r.ID, &r.Name, &r.SubscriberCount); err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, r)
+	}
+	return rooms, rows.Err()
+}
+
+// ListSubscribedRoomIDs returns the broadcast rooms userID follows, for
+// routing live posts to their event sockets.
+func (s *Store) ListSubscribedRoomIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	ctx, done := s.op(ctx, "ListSubscribedRoomIDs")
+	defer done()
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT rs.room_id FROM room_subscriptions rs
+		JOIN rooms r ON r.id = rs.room_id
+		WHERE rs.user_id = $1 AND r.broadcast
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,28 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// GetRoomPersistCallChat reports whether roomID keeps call chat in its
+// history once the call ends.
+func (s *Store) GetRoomPersistCallChat(ctx context.Context, roomID uuid.UUID) (bool, error) {
+	ctx, done := s.op(ctx, "GetRoomPersistCallChat")
+	defer done()
+	var persist bool
+	err := s.DB.QueryRowContext(ctx, `SELECT persist_call_chat FROM rooms WHERE id = $1`, roomID).Scan(&persist)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrNotFound
+	}
+	return persist, err
+}
+
+func (s *Store) SetRoomPersistCallChat(ctx context.Context, roomID uuid.UUID, persist bool) error {
+	ctx, done := s.op(ctx, "SetRoomPersistCallChat")
+	defer done()
+	return s.execOne(ctx, `UPDATE rooms SET persist_call_chat = $2 WHERE id = $1`, roomID, persist)
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CallFeedbackTags are the issues a member can tick when rating a call.
+var CallFeedbackTags = []string{"audio", "video", "echo", "latency", "dropped", "screen_share", "other"}
+
+type CallFeedback struct {
+	CallID        uuid.UUID
+	RoomID        uuid.UUID
+	UserID        uuid.UUID
+	Rating        int
+	Tags          []string
+	LiveKitURL    string
+	ClientVersion string
+}
+
+// CallFeedbackGroup aggregates the ratings given for calls on one LiveKit
+// cluster from one client release.
+type CallFeedbackGroup struct {
+	LiveKitURL    string         `json:"livekit_url"`
+	ClientVersion string         `json:"client_version"`
+	Responses     int            `json:"responses"`
+	AverageRating float64        `json:"average_rating"`
+	LowRatings    int            `json:"low_ratings"`
+	Tags          map[string]int `json:"tags"`
+}
+
+// SaveCallFeedback records f. Rating the same call again replaces the
+// earlier answer.
+func (s *Store) SaveCallFeedback(ctx context.Context, f CallFeedback) error {
+	ctx, done := s.op(ctx, "SaveCallFeedback")
+	defer done()
+	tags := f.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO call_feedback (call_id, room_id, user_id, rating, tags, livekit_url, client_version)
+		VALUES ($1, $2, $3, $4, $5::text[], $6, $7)
+		ON CONFLICT (call_id, user_id) DO UPDATE
+		SET rating = EXCLUDED.rating,
+		    tags = EXCLUDED.tags,
+		    client_version = EXCLUDED.client_version,
+		    created_at = NOW()
+	`, f.CallID, f.RoomID, f.UserID, f.Rating, tags, f.LiveKitURL, f.ClientVersion)
+	return err
+}
+
+// CallFeedbackStats aggregates feedback given since since, grouped by
+// LiveKit URL and client version, most responses first. Ratings of 1 or 2
+// count as low.
+func (s *Store) CallFeedbackStats(ctx context.Context, since time.Time) ([]CallFeedbackGroup, error) {
+	ctx, done := s.op(ctx, "CallFeedbackStats")
+	defer done()
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT livekit_url, client_version, COUNT(*), AVG(rating)::float8, COUNT(*) FILTER (WHERE rating <= 2)
+		FROM call_feedback
+		WHERE created_at >= $1
+		GROUP BY livekit_url, client_version
+		ORDER BY COUNT(*) DESC, livekit_url, client_version
+	`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []CallFeedbackGroup{}
+	index := map[[2]string]int{}
+	for rows.Next() {
+		g := CallFeedbackGroup{Tags: map[string]int{}}
+		if err := rows.Scan(&g.LiveKitURL, &g.ClientVersion, &g.Responses, &g.AverageRating, &g.LowRatings); err != nil {
+			return nil, err
+		}
+		index[[2]string{g.LiveKitURL, g.ClientVersion}] = len(groups)
+		groups = append(groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	tagRows, err := s.DB.QueryContext(ctx, `
+		SELECT livekit_url, client_version, tag, COUNT(*)
+		FROM call_feedback, unnest(tags) AS tag
+		WHERE created_at >= $1
+		GROUP BY livekit_url, client_version, tag
+	`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer tagRows.Close()
+	for tagRows.Next() {
+		var url, version, tag string
+		var n int
+		if err := tagRows.Scan(&url, &version, &tag, &n); err != nil {
+			return nil, err
+		}
+		if i, ok := index[[2]string{url, version}]; ok {
+			groups[i].Tags[tag] = n
+		}
+	}
+	return groups, tagRows.Err()
+}
@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// CanaryEmail is the address of the canary's probe account. The .invalid
+// domain cannot receive mail, and the account has no password, so nobody
+// can sign in as it.
+const CanaryEmail = "canary@talkie.invalid"
+
+// Canary is the probe account and the private room it posts to.
+type Canary struct {
+	UserID         uuid.UUID
+	Username       string
+	SessionVersion int
+	RoomID         uuid.UUID
+}
+
+// EnsureCanary returns the canary's account and room, registering the
+// account and creating the room first when either is missing. The account
+// is a verified bot with no password; its username is made unique so it
+// never takes a name a person wants.
+func (s *Store) EnsureCanary(ctx context.Context) (Canary, error) {
+	ctx, done := s.op(ctx, "EnsureCanary")
+	defer done()
+	var c Canary
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT c.user_id, u.username, u.session_version, c.room_id
+		FROM canary c
+		JOIN users u ON u.id = c.user_id
+	`).Scan(&c.UserID, &c.Username, &c.SessionVersion, &c.RoomID)
+	if err == nil {
+		return c, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return Canary{}, err
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Canary{}, err
+	}
+	defer tx.Rollback()
+	// The account outlives its room when only the room was deleted.
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO users (email, username, password_hash, email_verified, is_bot)
+		VALUES ($1, 'canary-' || substr(md5(random()::text), 1, 8), '', TRUE, TRUE)
+		ON CONFLICT (email) DO UPDATE SET is_bot = TRUE
+		RETURNING id, username, session_version
+	`, CanaryEmail).Scan(&c.UserID, &c.Username, &c.SessionVersion)
+	if err != nil {
+		return Canary{}, err
+	}
+	q := queries{tx}
+	room, err := q.insertRoom(ctx, "Canary", c.UserID, true)
+	if err != nil {
+		return Canary{}, err
+	}
+	if err := q.addRoomMember(ctx, room.ID, c.UserID, "admin"); err != nil {
+		return Canary{}, err
+	}
+	c.RoomID = room.ID
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO canary (user_id, room_id) VALUES ($1, $2)
+		ON CONFLICT (id) DO UPDATE SET user_id = EXCLUDED.user_id, room_id = EXCLUDED.room_id, created_at = NOW()
+	`, c.UserID, c.RoomID); err != nil {
+		return Canary{}, err
+	}
+	return c, tx.Commit()
+}
+
+// DeleteCanaryMessages removes the probe messages in the canary's room, so
+// the room does not grow by one message a run.
+func (s *Store) DeleteCanaryMessages(ctx context.Context) (int64, error) {
+	ctx, done := s.op(ctx, "DeleteCanaryMessages")
+	defer done()
+	res, err := s.DB.ExecContext(ctx, `DELETE FROM messages WHERE room_id = (SELECT room_id FROM canary)`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
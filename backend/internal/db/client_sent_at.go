@@ -0,0 +1,30 @@
+package db
+
+import "time"
+
+const (
+	// MaxClientClockSkew is how far ahead of the server a client's clock may
+	// run before its timestamps are ignored rather than clamped.
+	MaxClientClockSkew = time.Minute
+	// MaxOfflineAge bounds how long a message may sit in an offline queue
+	// and still keep the time it was composed.
+	MaxOfflineAge = 7 * 24 * time.Hour
+)
+
+// CheckClientSentAt validates a client-supplied composition time against
+// the server clock. Times slightly in the future are clamped to now; times
+// too far ahead or older than MaxOfflineAge are dropped, leaving created_at
+// as the only timestamp.
+func CheckClientSentAt(sentAt *time.Time, now time.Time) *time.Time {
+	if sentAt == nil || sentAt.IsZero() {
+		return nil
+	}
+	t := sentAt.UTC()
+	switch {
+	case t.After(now.Add(MaxClientClockSkew)), t.Before(now.Add(-MaxOfflineAge)):
+		return nil
+	case t.After(now):
+		t = now.UTC()
+	}
+	return &t
+}
@@ -0,0 +1,211 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// Component kinds.
+const (
+	ComponentButton = "button"
+	ComponentSelect = "select"
+)
+
+// Component limits, per message.
+const (
+	MaxComponents       = 5
+	MaxComponentOptions = 25
+	maxComponentLabel   = 80
+	maxComponentValue   = 200
+	maxActionID         = 64
+)
+
+// Component is a button or select menu on a slash command's reply. A
+// button sends its Value when pressed; a select sends the Value of the
+// option picked. ActionID tells the command which one was used.
+type Component struct {
+	Type     string `json:"type"`
+	ActionID string `json:"action_id"`
+	// Label is a button's text or a select menu's placeholder.
+	Label string `json:"label,omitempty"`
+	Value string `json:"value,omitempty"`
+	// Style is "primary", "danger" or empty, for buttons.
+	Style   string            `json:"style,omitempty"`
+	Options []ComponentOption `json:"options,omitempty"`
+}
+
+// ComponentOption is one entry of a select menu.
+type ComponentOption struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// ValidateComponents checks components a command sent back.
+func ValidateComponents(cs []Component) error {
+	if len(cs) > MaxComponents {
+		return fmt.Errorf("at most %d components", MaxComponents)
+	}
+	seen := make(map[string]bool, len(cs))
+	for _, c := range cs {
+		if c.ActionID == "" || len(c.ActionID) > maxActionID {
+			return fmt.Errorf("action_id must be 1 to %d bytes", maxActionID)
+		}
+		if seen[c.ActionID] {
+			return fmt.Errorf("duplicate action_id %q", c.ActionID)
+		}
+		seen[c.ActionID] = true
+		if utf8.RuneCountInString(c.Label) > maxComponentLabel || len(c.Value) > maxComponentValue {
+			return fmt.Errorf("component %q: label or value too long", c.ActionID)
+		}
+		switch c.Type {
+		case ComponentButton:
+			if c.Label == "" {
+				return fmt.Errorf("button %q needs a label", c.ActionID)
+			}
+			if c.Style != "" && c.Style != "primary" && c.Style != "danger" {
+				return fmt.Errorf("button %q: unknown style %q", c.ActionID, c.Style)
+			}
+			if len(c.Options) > 0 {
+				return fmt.Errorf("button %q cannot have options", c.ActionID)
+			}
+		case ComponentSelect:
+			if len(c.Options) == 0 || len(c.Options) > MaxComponentOptions {
+				return fmt.Errorf("select %q needs 1 to %d options", c.ActionID, MaxComponentOptions)
+			}
+			for _, o := range c.Options {
+				if o.Label == "" || utf8.RuneCountInString(o.Label) > maxComponentLabel || len(o.Value) > maxComponentValue {
+					return fmt.Errorf("select %q: invalid option", c.ActionID)
+				}
+			}
+		default:
+			return fmt.Errorf("unknown component type %q", c.Type)
+		}
+	}
+	return nil
+}
+
+// Interaction returns the value sent when a member uses actionID: a
+// button's own value, or value itself when it is one of the select's
+// options. ok is false for unknown actions and options.
+func Interaction(cs []Component, actionID, value string) (Component, string, bool) {
+	for _, c := range cs {
+		if c.ActionID != actionID {
+			continue
+		}
+		if c.Type == ComponentButton {
+			return c, c.Value, true
+		}
+		for _, o := range c.Options {
+			if o.Value == value {
+				return c, value, true
+			}
+		}
+		return Component{}, "", false
+	}
+	return Component{}, "", false
+}
+
+// componentsColumn scans the nullable messages.components JSON.
+type componentsColumn struct {
+	dst *[]Component
+}
+
+func (c componentsColumn) Scan(src any) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		*c.dst = nil
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("components column: unexpected %T", src)
+	}
+	return json.Unmarshal(raw, c.dst)
+}
+
+func componentsJSON(cs []Component) (sql.NullString, error) {
+	if len(cs) == 0 {
+		return sql.NullString{}, nil
+	}
+	raw, err := json.Marshal(cs)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(raw), Valid: true}, nil
+}
+
+// SaveCommandMessage stores commandID's in-room reply, posted as userID,
+// with its components.
+func (s *Store) SaveCommandMessage(ctx context.Context, roomID, userID uuid.UUID, commandID int64, content string, components []Component) (Message, error) {
+	ctx, done := s.op(ctx, "SaveCommandMessage")
+	defer done()
+	comps, err := componentsJSON(components)
+	if err != nil {
+		return Message{}, err
+	}
+	content, raw := s.renderContent(content)
+	var id int64
+	err = s.DB.QueryRowContext(ctx, `
+		INSERT INTO messages (room_id, user_id, content, content_raw, message_type, shadowed, nsfw, command_id, components)
+		VALUES ($1, $2, $3, $4, 'text', (SELECT shadow_banned FROM users WHERE id = $2), (SELECT nsfw FROM rooms WHERE id = $1), $5, $6::jsonb)
+		RETURNING id
+	`, roomID, userID, content, raw, commandID, comps).Scan(&id)
+	if err != nil {
+		return Message{}, err
+	}
+	return s.GetMessage(ctx, roomID, id)
+}
+
+// GetCommandMessage returns a message in roomID together with the command
+// that posted it, secret included. ErrNotFound covers messages no command
+// posted and commands deleted since.
+func (s *Store) GetCommandMessage(ctx context.Context, roomID uuid.UUID, messageID int64) (RoomCommand, Message, error) {
+	ctx, done := s.op(ctx, "GetCommandMessage")
+	defer done()
+	var c RoomCommand
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT c.id, c.room_id, c.name, c.url, c.secret, c.description, c.created_by, c.created_at
+		FROM messages m
+		JOIN room_commands c ON c.id = m.command_id
+		WHERE m.room_id = $1 AND m.id = $2
+	`, roomID, messageID).Scan(&c.ID, &c.RoomID, &c.Name, &c.URL, &c.Secret, &c.Description, &c.CreatedBy, &c.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return RoomCommand{}, Message{}, ErrNotFound
+	}
+	if err != nil {
+		return RoomCommand{}, Message{}, err
+	}
+	m, err := s.GetMessage(ctx, roomID, messageID)
+	if err != nil {
+		return RoomCommand{}, Message{}, err
+	}
+	return c, m, nil
+}
+
+// UpdateCommandMessage replaces the text and components of a message a
+// command posted.
+func (s *Store) UpdateCommandMessage(ctx context.Context, roomID uuid.UUID, messageID int64, content string, components []Component) (Message, error) {
+	ctx, done := s.op(ctx, "UpdateCommandMessage")
+	defer done()
+	comps, err := componentsJSON(components)
+	if err != nil {
+		return Message{}, err
+	}
+	content, raw := s.renderContent(content)
+	if err := s.execOne(ctx, `
+		UPDATE messages SET content = $3, content_raw = $4, components = $5::jsonb
+		WHERE room_id = $1 AND id = $2 AND command_id IS NOT NULL
+	`, roomID, messageID, content, raw, comps); err != nil {
+		return Message{}, err
+	}
+	return s.GetMessage(ctx, roomID, messageID)
+}
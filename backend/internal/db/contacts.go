@@ -0,0 +1,93 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// Who may share a user's contact card, users.contact_sharing.
+const (
+	ContactSharingEveryone = "everyone"
+	ContactSharingFriends  = "friends"
+	ContactSharingNobody   = "nobody"
+)
+
+// ContactCard is the profile a "contact" message points at, as it was when
+// the card was sent.
+type ContactCard struct {
+	UserID    uuid.UUID `json:"user_id"`
+	Username  string    `json:"username"`
+	AvatarURL string    `json:"avatar_url,omitempty"`
+}
+
+// contactColumn scans the nullable messages.contact JSON into a message.
+type contactColumn struct {
+	dst **ContactCard
+}
+
+func (c contactColumn) Scan(src any) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		*c.dst = nil
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("contact column: unexpected %T", src)
+	}
+	var card ContactCard
+	if err := json.Unmarshal(raw, &card); err != nil {
+		return err
+	}
+	*c.dst = &card
+	return nil
+}
+
+func (s *Store) GetContactSharing(ctx context.Context, userID uuid.UUID) (string, error) {
+	ctx, done := s.op(ctx, "GetContactSharing")
+	defer done()
+	var sharing string
+	err := s.DB.QueryRowContext(ctx, `SELECT contact_sharing FROM users WHERE id = $1`, userID).Scan(&sharing)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return sharing, err
+}
+
+func (s *Store) SetContactSharing(ctx context.Context, userID uuid.UUID, sharing string) error {
+	ctx, done := s.op(ctx, "SetContactSharing")
+	defer done()
+	return s.execOne(ctx, `UPDATE users SET contact_sharing = $2 WHERE id = $1`, userID, sharing)
+}
+
+// SaveContactMessage posts contactID's card to roomID as userID. The card
+// is copied from the contact's profile now; later renames do not change
+// it.
+func (s *Store) SaveContactMessage(ctx context.Context, roomID, userID, contactID uuid.UUID) (Message, error) {
+	ctx, done := s.op(ctx, "SaveContactMessage")
+	defer done()
+	var id int64
+	err := s.DB.QueryRowContext(ctx, `
+		INSERT INTO messages (room_id, user_id, content, message_type, shadowed, nsfw, contact)
+		SELECT $1, $2, '', 'contact', (SELECT shadow_banned FROM users WHERE id = $2), (SELECT nsfw FROM rooms WHERE id = $1),
+		       jsonb_build_object('user_id', c.id, 'username', c.username, 'avatar_url', COALESCE(c.avatar_url, ''))
+		FROM users c
+		WHERE c.id = $3
+		RETURNING id
+	`, roomID, userID, contactID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Message{}, ErrNotFound
+	}
+	if err != nil {
+		return Message{}, err
+	}
+	return s.GetMessage(ctx, roomID, id)
+}
@@ -5,18 +5,25 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 )
 
 var ErrNotFound = errors.New("not found")
 var ErrForbidden = errors.New("forbidden")
+var ErrTokenUsed = errors.New("token already used")
 
 type Store struct {
 	DB *sql.DB
+
+	defaultTimeout time.Duration
+	timeouts       map[string]time.Duration
+	shortcodes     bool
 }
 
 type User struct {
@@ -25,6 +32,12 @@ type User struct {
 	Username      string    `json:"username"`
 	AvatarURL     string    `json:"avatar_url,omitempty"`
 	EmailVerified bool      `json:"email_verified"`
+	IsAdmin       bool      `json:"is_admin,omitempty"`
+	// IsBot marks service accounts allowed to use bulk endpoints.
+	IsBot bool `json:"is_bot,omitempty"`
+	SessionVersion int      `json:"-"`
+	// GuestExpiresAt is set for temporary guest accounts only.
+	GuestExpiresAt *time.Time `json:"guest_expires_at,omitempty"`
 	PasswordHash string
 	CreatedAt     time.Time `json:"created_at"`
 }
@@ -40,6 +53,9 @@ type Room struct {
 	Position    int       `json:"position,omitempty"`
 	MyRole      string    `json:"my_role,omitempty"`
 	CanManage   bool      `json:"can_manage,omitempty"`
+	UnreadCount int       `json:"unread_count"`
+	FirstUnreadMessageID *int64 `json:"first_unread_message_id,omitempty"`
+	LastMessageAt *time.Time `json:"last_message_at,omitempty"`
 	CreatedAt   time.Time `json:"created_at"`
 }
 
@@ -52,6 +68,8 @@ type GroupChannel struct {
 	IsPrivate   bool      `json:"is_private"`
 	MyRole      string    `json:"my_role,omitempty"`
 	CanManage   bool      `json:"can_manage,omitempty"`
+	UnreadCount int       `json:"unread_count"`
+	FirstUnreadMessageID *int64 `json:"first_unread_message_id,omitempty"`
 	CreatedAt   time.Time `json:"created_at"`
 }
 
@@ -105,17 +123,53 @@ type Message struct {
 	UserID      uuid.UUID `json:"user_id"`
 	Username    string    `json:"username"`
 	AvatarURL   string    `json:"avatar_url,omitempty"`
-	Content     string    `json:"content"`
+	Content     string    `json:"content" scan:"contentColumn,row"`
 	MessageType string    `json:"message_type"`
 	MediaURL    string    `json:"media_url,omitempty"`
+	DeliveryState string  `json:"delivery_state,omitempty"`
+	// NSFW is set on messages posted in an NSFW room and on media the
+	// upload classifier flagged.
+	NSFW bool `json:"nsfw,omitempty"`
+	// Withheld is set on responses to members who opted out of NSFW
+	// content, in place of the flagged media URL.
+	Withheld bool `json:"withheld,omitempty"`
+	// Audio is set on voice notes whose waveform could be computed.
+	Audio *AudioInfo `json:"audio,omitempty" scan:"audioColumn"`
+	// Components are the buttons and select menus a slash command attached
+	// to its reply.
+	Components []Component `json:"components,omitempty" scan:"componentsColumn"`
+	// Contact is the shared profile of a "contact" message.
+	Contact *ContactCard `json:"contact,omitempty" scan:"contactColumn"`
+	// AltText describes an image message for screen readers.
+	// AltTextGenerated says a vision model wrote it, not the author.
+	AltText          string `json:"alt_text,omitempty"`
+	AltTextGenerated bool   `json:"alt_text_generated,omitempty"`
+	// Lang and Dir are the language detected from the content and its text
+	// direction, "ltr" or "rtl". Both are empty when it could not be told.
+	Lang string `json:"lang,omitempty"`
+	Dir  string `json:"dir,omitempty"`
+	// ContentMasked is Content with the room's masked words starred out,
+	// set only when masking changed it. Members other than room admins get
+	// it in Content as well.
+	ContentMasked string `json:"content_masked,omitempty"`
 	CreatedAt   time.Time `json:"created_at"`
+	// ClientSentAt is when the author's device composed the message, which
+	// can be well before CreatedAt for messages queued while offline.
+	ClientSentAt *time.Time `json:"client_sent_at,omitempty"`
+	// EditedAt is when the content last changed, as recorded in the room's
+	// event stream. Only history pages set it.
+	EditedAt *time.Time `json:"edited_at,omitempty"`
+	// Shadowed messages were written by a shadow-banned user and are only
+	// ever shown back to their author.
+	Shadowed bool `json:"-"`
 }
 
 func New(databaseURL string) (*Store, error) {
-	db, err := sql.Open("pgx", databaseURL)
+	cfg, err := pgx.ParseConfig(databaseURL)
 	if err != nil {
 		return nil, fmt.Errorf("open db: %w", err)
 	}
+	db := sql.OpenDB(newRetryConnector(stdlib.GetConnector(*cfg)))
 	db.SetMaxOpenConns(20)
 	db.SetMaxIdleConns(10)
 	db.SetConnMaxLifetime(30 * time.Minute)
@@ -126,7 +180,9 @@ func New(databaseURL string) (*Store, error) {
 		return nil, fmt.Errorf("ping db: %w", err)
 	}
 
-	return &Store{DB: db}, nil
+	s := &Store{DB: db}
+	s.SetQueryTimeouts(DefaultQueryTimeout, nil)
+	return s, nil
 }
 
 func (s *Store) Close() error {
@@ -134,62 +190,39 @@ func (s *Store) Close() error {
 }
 
 func (s *Store) CreateUser(ctx context.Context, email, username, passwordHash string) (User, error) {
-	query := `
-		INSERT INTO users (email, username, password_hash, email_verified)
-		VALUES ($1, $2, $3, FALSE)
-		RETURNING id, email, username, COALESCE(avatar_url, ''), email_verified, password_hash, created_at
-	`
-	var u User
-	err := s.DB.QueryRowContext(ctx, query, email, username, passwordHash).
-		Scan(&u.ID, &u.Email, &u.Username, &u.AvatarURL, &u.EmailVerified, &u.PasswordHash, &u.CreatedAt)
-	if err != nil {
-		return User{}, err
-	}
-	return u, nil
+	ctx, done := s.op(ctx, "CreateUser")
+	defer done()
+	return queries{s.DB}.createUser(ctx, email, username, passwordHash)
 }
 
 func (s *Store) FindUserByEmail(ctx context.Context, email string) (User, error) {
-	query := `SELECT id, email, username, COALESCE(avatar_url, ''), email_verified, password_hash, created_at FROM users WHERE email = $1`
-	var u User
-	err := s.DB.QueryRowContext(ctx, query, email).
-		Scan(&u.ID, &u.Email, &u.Username, &u.AvatarURL, &u.EmailVerified, &u.PasswordHash, &u.CreatedAt)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return User{}, ErrNotFound
-		}
-		return User{}, err
-	}
-	return u, nil
+	ctx, done := s.op(ctx, "FindUserByEmail")
+	defer done()
+	return queries{s.DB}.findUserByEmail(ctx, email)
+}
+
+func (s *Store) FindUserByUsername(ctx context.Context, username string) (User, error) {
+	ctx, done := s.op(ctx, "FindUserByUsername")
+	defer done()
+	return queries{s.DB}.findUserByUsername(ctx, username)
 }
 
 func (s *Store) FindUserByID(ctx context.Context, id uuid.UUID) (User, error) {
-	query := `SELECT id, email, username, COALESCE(avatar_url, ''), email_verified, password_hash, created_at FROM users WHERE id = $1`
-	var u User
-	err := s.DB.QueryRowContext(ctx, query, id).
-		Scan(&u.ID, &u.Email, &u.Username, &u.AvatarURL, &u.EmailVerified, &u.PasswordHash, &u.CreatedAt)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return User{}, ErrNotFound
-		}
-		return User{}, err
-	}
-	return u, nil
+	ctx, done := s.op(ctx, "FindUserByID")
+	defer done()
+	return queries{s.DB}.findUserByID(ctx, id)
 }
 
 func (s *Store) CreateRoom(ctx context.Context, name string, createdBy uuid.UUID, isPrivate bool) (Room, error) {
+	ctx, done := s.op(ctx, "CreateRoom")
+	defer done()
 	isPrivate = true
-	query := `
-		INSERT INTO rooms (name, created_by, is_private)
-		VALUES ($1, $2, $3)
-		RETURNING id, name, created_by, is_private, created_at
-	`
-	var r Room
-	err := s.DB.QueryRowContext(ctx, query, name, createdBy, isPrivate).
-		Scan(&r.ID, &r.Name, &r.CreatedBy, &r.IsPrivate, &r.CreatedAt)
+	q := queries{s.DB}
+	r, err := q.insertRoom(ctx, name, createdBy, isPrivate)
 	if err != nil {
 		return Room{}, err
 	}
-	if _, err := s.DB.ExecContext(ctx, `INSERT INTO room_members (room_id, user_id, role) VALUES ($1, $2, 'admin') ON CONFLICT DO NOTHING`, r.ID, createdBy); err != nil {
+	if err := q.addRoomMember(ctx, r.ID, createdBy, "admin"); err != nil {
 		return Room{}, err
 	}
 	r.MyRole = "admin"
@@ -198,35 +231,14 @@ func (s *Store) CreateRoom(ctx context.Context, name string, createdBy uuid.UUID
 }
 
 func (s *Store) ListRoomsForUser(ctx context.Context, userID uuid.UUID) ([]Room, error) {
-	query := `
-		SELECT DISTINCT r.id, r.name, r.created_by, r.is_private, rm.role, (rm.role = 'admin') AS can_manage, r.created_at
-		FROM rooms r
-		JOIN room_members rm ON rm.room_id = r.id
-		LEFT JOIN direct_rooms d ON d.room_id = r.id
-		LEFT JOIN group_channels gc ON gc.room_id = r.id
-		WHERE d.room_id IS NULL
-		  AND gc.room_id IS NULL
-		  AND rm.user_id = $1
-		ORDER BY r.created_at DESC
-	`
-	rows, err := s.DB.QueryContext(ctx, query, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	rooms := []Room{}
-	for rows.Next() {
-		var r Room
-		if err := rows.Scan(&r.ID, &r.Name, &r.CreatedBy, &r.IsPrivate, &r.MyRole, &r.CanManage, &r.CreatedAt); err != nil {
-			return nil, err
-		}
-		rooms = append(rooms, r)
-	}
-	return rooms, rows.Err()
+	ctx, done := s.op(ctx, "ListRoomsForUser")
+	defer done()
+	return queries{s.DB}.listRoomsForUser(ctx, userID)
 }
 
 func (s *Store) ListRoomGroupsForUser(ctx context.Context, userID uuid.UUID) ([]RoomGroup, error) {
+	ctx, done := s.op(ctx, "ListRoomGroupsForUser")
+	defer done()
 	rows, err := s.DB.QueryContext(ctx, `
 		SELECT g.id,
 		       g.name,
@@ -248,11 +260,13 @@ func (s *Store) ListRoomGroupsForUser(ctx context.Context, userID uuid.UUID) ([]
 		       r.is_private,
 		       rm.role,
 		       (rm.role = 'admin') AS room_can_manage,
-		       r.created_at
+		       r.created_at,
+		       `+listUnreadColumns+`
 		FROM room_groups g
 		JOIN group_channels gc ON gc.group_id = g.id
 		JOIN rooms r ON r.id = gc.room_id
 		JOIN room_members rm ON rm.room_id = r.id AND rm.user_id = $1
+		JOIN room_summaries rs ON rs.user_id = rm.user_id AND rs.room_id = rm.room_id
 		LEFT JOIN direct_rooms d ON d.room_id = r.id
 		WHERE d.room_id IS NULL
 		ORDER BY g.created_at ASC, g.name ASC, gc.channel_type ASC, gc.position ASC, r.created_at ASC
@@ -282,6 +296,8 @@ func (s *Store) ListRoomGroupsForUser(ctx context.Context, userID uuid.UUID) ([]
 			myRole        string
 			roomCanManage bool
 			roomCreatedAt time.Time
+			unreadCount   int
+			firstUnread   sql.NullInt64
 		)
 		if err := rows.Scan(
 			&groupID,
@@ -298,6 +314,8 @@ func (s *Store) ListRoomGroupsForUser(ctx context.Context, userID uuid.UUID) ([]
 			&myRole,
 			&roomCanManage,
 			&roomCreatedAt,
+			&unreadCount,
+			&firstUnread,
 		); err != nil {
 			return nil, err
 		}
@@ -327,6 +345,9 @@ func (s *Store) ListRoomGroupsForUser(ctx context.Context, userID uuid.UUID) ([]
 			MyRole:      myRole,
 			CanManage:   roomCanManage,
 			CreatedAt:   roomCreatedAt,
+
+			UnreadCount:          unreadCount,
+			FirstUnreadMessageID: nullInt64Ptr(firstUnread),
 		}
 		if channelType == "voice" {
 			group.VoiceChannels = append(group.VoiceChannels, channel)
@@ -346,12 +367,9 @@ func (s *Store) ListRoomGroupsForUser(ctx context.Context, userID uuid.UUID) ([]
 }
 
 func (s *Store) CreateRoomGroup(ctx context.Context, name string, createdBy uuid.UUID) (RoomGroup, error) {
-	var g RoomGroup
-	err := s.DB.QueryRowContext(ctx, `
-		INSERT INTO room_groups (name, created_by)
-		VALUES ($1, $2)
-		RETURNING id, name, created_by, created_at
-	`, name, createdBy).Scan(&g.ID, &g.Name, &g.CreatedBy, &g.CreatedAt)
+	ctx, done := s.op(ctx, "CreateRoomGroup")
+	defer done()
+	g, err := queries{s.DB}.insertRoomGroup(ctx, name, createdBy)
 	if err != nil {
 		return RoomGroup{}, err
 	}
@@ -362,6 +380,8 @@ func (s *Store) CreateRoomGroup(ctx context.Context, name string, createdBy uuid
 }
 
 func (s *Store) UpdateRoomGroupName(ctx context.Context, groupID uuid.UUID, userID uuid.UUID, name string) error {
+	ctx, done := s.op(ctx, "UpdateRoomGroupName")
+	defer done()
 	res, err := s.DB.ExecContext(ctx, `
 		UPDATE room_groups
 		SET name = $3
@@ -391,6 +411,8 @@ func (s *Store) UpdateRoomGroupName(ctx context.Context, groupID uuid.UUID, user
 }
 
 func (s *Store) CreateGroupChannel(ctx context.Context, groupID uuid.UUID, name, channelType string, createdBy uuid.UUID) (GroupChannel, error) {
+	ctx, done := s.op(ctx, "CreateGroupChannel")
+	defer done()
 	if channelType != "text" && channelType != "voice" {
 		return GroupChannel{}, fmt.Errorf("invalid channel type")
 	}
@@ -432,21 +454,15 @@ func (s *Store) CreateGroupChannel(ctx context.Context, groupID uuid.UUID, name,
 		return GroupChannel{}, err
 	}
 
-	var out GroupChannel
-	if err := tx.QueryRowContext(ctx, `
-		INSERT INTO rooms (name, created_by, is_private)
-		VALUES ($1, $2, TRUE)
-		RETURNING id, name, created_by, is_private, created_at
-	`, name, createdBy).Scan(&out.ID, &out.Name, &out.CreatedBy, &out.IsPrivate, &out.CreatedAt); err != nil {
+	q := queries{tx}
+	room, err := q.insertRoom(ctx, name, createdBy, true)
+	if err != nil {
 		return GroupChannel{}, err
 	}
-	if _, err := tx.ExecContext(ctx, `
-		INSERT INTO room_members (room_id, user_id, role)
-		VALUES ($1, $2, 'admin')
-		ON CONFLICT DO NOTHING
-	`, out.ID, createdBy); err != nil {
+	if err := q.addRoomMember(ctx, room.ID, createdBy, "admin"); err != nil {
 		return GroupChannel{}, err
 	}
+	out := GroupChannel{ID: room.ID, Name: room.Name, CreatedBy: room.CreatedBy, IsPrivate: room.IsPrivate, CreatedAt: room.CreatedAt}
 	if _, err := tx.ExecContext(ctx, `
 		INSERT INTO group_channels (group_id, room_id, channel_type, position)
 		VALUES ($1, $2, $3, $4)
@@ -465,82 +481,74 @@ func (s *Store) CreateGroupChannel(ctx context.Context, groupID uuid.UUID, name,
 }
 
 func (s *Store) JoinRoom(ctx context.Context, roomID, userID uuid.UUID) error {
-	query := `INSERT INTO room_members (room_id, user_id, role) VALUES ($1, $2, 'member') ON CONFLICT DO NOTHING`
+	ctx, done := s.op(ctx, "JoinRoom")
+	defer done()
+	query := `
+		INSERT INTO room_members (room_id, user_id, role, last_read_message_id)
+		VALUES ($1, $2, 'member', (SELECT MAX(id) FROM messages WHERE room_id = $1))
+		ON CONFLICT DO NOTHING
+	`
 	_, err := s.DB.ExecContext(ctx, query, roomID, userID)
 	return err
 }
 
 func (s *Store) EnsureRoomExists(ctx context.Context, roomID uuid.UUID) error {
-	var id uuid.UUID
-	err := s.DB.QueryRowContext(ctx, `SELECT id FROM rooms WHERE id = $1`, roomID).Scan(&id)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return ErrNotFound
-		}
-		return err
-	}
-	return nil
+	ctx, done := s.op(ctx, "EnsureRoomExists")
+	defer done()
+	_, err := queries{s.DB}.getRoomByID(ctx, roomID)
+	return err
 }
 
 func (s *Store) GetRoomByID(ctx context.Context, roomID uuid.UUID) (Room, error) {
-	var r Room
-	err := s.DB.QueryRowContext(ctx, `SELECT id, name, created_by, '' AS avatar_url, is_private, created_at FROM rooms WHERE id = $1`, roomID).
-		Scan(&r.ID, &r.Name, &r.CreatedBy, &r.AvatarURL, &r.IsPrivate, &r.CreatedAt)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return Room{}, ErrNotFound
-		}
-		return Room{}, err
-	}
-	return r, nil
+	ctx, done := s.op(ctx, "GetRoomByID")
+	defer done()
+	return queries{s.DB}.getRoomByID(ctx, roomID)
 }
 
 func (s *Store) IsRoomMember(ctx context.Context, roomID, userID uuid.UUID) (bool, error) {
-	var exists bool
-	err := s.DB.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM room_members WHERE room_id = $1 AND user_id = $2)`, roomID, userID).Scan(&exists)
-	return exists, err
+	ctx, done := s.op(ctx, "IsRoomMember")
+	defer done()
+	return queries{s.DB}.isRoomMember(ctx, roomID, userID)
 }
 
 func (s *Store) IsRoomAdmin(ctx context.Context, roomID, userID uuid.UUID) (bool, error) {
-	var isAdmin bool
-	err := s.DB.QueryRowContext(ctx, `
-		SELECT EXISTS(
-			SELECT 1
-			FROM room_members
-			WHERE room_id = $1 AND user_id = $2 AND role = 'admin'
-		)
-	`, roomID, userID).Scan(&isAdmin)
-	return isAdmin, err
+	ctx, done := s.op(ctx, "IsRoomAdmin")
+	defer done()
+	return queries{s.DB}.isRoomAdmin(ctx, roomID, userID)
 }
 
 func (s *Store) GetRoomForUser(ctx context.Context, roomID, userID uuid.UUID) (Room, error) {
-	var r Room
-	err := s.DB.QueryRowContext(ctx, `
-		SELECT r.id, r.name, r.created_by, '' AS avatar_url, r.is_private, rm.role, (rm.role = 'admin') AS can_manage, r.created_at
-		FROM rooms r
-		JOIN room_members rm ON rm.room_id = r.id
-		WHERE r.id = $1 AND rm.user_id = $2
-	`, roomID, userID).Scan(&r.ID, &r.Name, &r.CreatedBy, &r.AvatarURL, &r.IsPrivate, &r.MyRole, &r.CanManage, &r.CreatedAt)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return Room{}, ErrNotFound
-		}
-		return Room{}, err
-	}
-	return r, nil
+	ctx, done := s.op(ctx, "GetRoomForUser")
+	defer done()
+	return queries{s.DB}.getRoomForUser(ctx, roomID, userID)
 }
 
 func (s *Store) UpdateRoomName(ctx context.Context, roomID uuid.UUID, name string) error {
+	ctx, done := s.op(ctx, "UpdateRoomName")
+	defer done()
 	_, err := s.DB.ExecContext(ctx, `UPDATE rooms SET name = $2 WHERE id = $1`, roomID, name)
 	return err
 }
 
+// DeleteRoom deletes a room with its messages, or returns ErrLegalHold
+// when that would remove content under a legal hold.
 func (s *Store) DeleteRoom(ctx context.Context, roomID uuid.UUID) error {
+	ctx, done := s.op(ctx, "DeleteRoom")
+	defer done()
+	var held bool
+	if err := s.DB.QueryRowContext(ctx, `SELECT legal_hold_blocks_room($1)`, roomID).Scan(&held); err != nil {
+		return err
+	}
+	if held {
+		return ErrLegalHold
+	}
 	_, err := s.DB.ExecContext(ctx, `DELETE FROM rooms WHERE id = $1`, roomID)
 	return err
 }
 
 func (s *Store) LeaveRoom(ctx context.Context, roomID, userID uuid.UUID) error {
+	ctx, done := s.op(ctx, "LeaveRoom")
+	defer done()
 	tx, err := s.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
@@ -569,7 +577,8 @@ func (s *Store) LeaveRoom(ctx context.Context, roomID, userID uuid.UUID) error {
 		return err
 	}
 	if membersLeft == 0 {
-		if _, err := tx.ExecContext(ctx, `DELETE FROM rooms WHERE id = $1`, roomID); err != nil {
+		// A room under legal hold outlives its last member.
+		if _, err := tx.ExecContext(ctx, `DELETE FROM rooms WHERE id = $1 AND NOT legal_hold_blocks_room($1)`, roomID); err != nil {
 			return err
 		}
 		return tx.Commit()
@@ -602,132 +611,59 @@ func (s *Store) LeaveRoom(ctx context.Context, roomID, userID uuid.UUID) error {
 }
 
 func (s *Store) IsDirectRoom(ctx context.Context, roomID uuid.UUID) (bool, error) {
-	var exists bool
-	err := s.DB.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM direct_rooms WHERE room_id = $1)`, roomID).Scan(&exists)
-	return exists, err
+	ctx, done := s.op(ctx, "IsDirectRoom")
+	defer done()
+	return queries{s.DB}.isDirectRoom(ctx, roomID)
 }
 
 func (s *Store) ListRoomMembers(ctx context.Context, roomID uuid.UUID) ([]RoomMember, error) {
-	rows, err := s.DB.QueryContext(ctx, `
-		SELECT u.id, u.username, COALESCE(u.avatar_url, '')
-		FROM room_members rm
-		JOIN users u ON u.id = rm.user_id
-		WHERE rm.room_id = $1
-		ORDER BY u.username ASC
-	`, roomID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	out := make([]RoomMember, 0)
-	for rows.Next() {
-		var m RoomMember
-		if err := rows.Scan(&m.ID, &m.Username, &m.AvatarURL); err != nil {
-			return nil, err
-		}
-		out = append(out, m)
-	}
-	return out, rows.Err()
+	ctx, done := s.op(ctx, "ListRoomMembers")
+	defer done()
+	return queries{s.DB}.listRoomMembers(ctx, roomID)
 }
 
 func (s *Store) SearchUsers(ctx context.Context, selfID uuid.UUID, q string, limit int) ([]Friend, error) {
+	ctx, done := s.op(ctx, "SearchUsers")
+	defer done()
 	if limit <= 0 || limit > 20 {
 		limit = 10
 	}
-	query := `
-		SELECT id, username, email, COALESCE(avatar_url, '')
-		FROM users
-		WHERE id <> $1 AND (username ILIKE $2 OR email ILIKE $2)
-		ORDER BY username ASC
-		LIMIT $3
-	`
-	rows, err := s.DB.QueryContext(ctx, query, selfID, "%"+q+"%", limit)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	out := make([]Friend, 0)
-	for rows.Next() {
-		var f Friend
-		if err := rows.Scan(&f.ID, &f.Username, &f.Email, &f.AvatarURL); err != nil {
-			return nil, err
-		}
-		out = append(out, f)
-	}
-	return out, rows.Err()
+	return queries{s.DB}.searchUsers(ctx, selfID, "%"+q+"%", limit)
 }
 
 func (s *Store) ListFriends(ctx context.Context, userID uuid.UUID) ([]Friend, error) {
-	query := `
-		SELECT u.id, u.username, u.email, COALESCE(u.avatar_url, '')
-		FROM friendships f
-		JOIN users u ON u.id = f.friend_id
-		WHERE f.user_id = $1
-		ORDER BY u.username ASC
-	`
-	rows, err := s.DB.QueryContext(ctx, query, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	out := make([]Friend, 0)
-	for rows.Next() {
-		var f Friend
-		if err := rows.Scan(&f.ID, &f.Username, &f.Email, &f.AvatarURL); err != nil {
-			return nil, err
-		}
-		out = append(out, f)
-	}
-	return out, rows.Err()
+	ctx, done := s.op(ctx, "ListFriends")
+	defer done()
+	return queries{s.DB}.listFriends(ctx, userID)
 }
 
 func (s *Store) IsFriend(ctx context.Context, userID, targetID uuid.UUID) (bool, error) {
-	var exists bool
-	if err := s.DB.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM friendships WHERE user_id = $1 AND friend_id = $2)`, userID, targetID).Scan(&exists); err != nil {
-		return false, err
-	}
-	return exists, nil
+	ctx, done := s.op(ctx, "IsFriend")
+	defer done()
+	return queries{s.DB}.isFriend(ctx, userID, targetID)
 }
 
 func (s *Store) ListIncomingFriendRequests(ctx context.Context, userID uuid.UUID) ([]FriendRequest, error) {
-	query := `
-		SELECT fr.id, fr.requester_id, fr.addressee_id, ru.username, COALESCE(ru.avatar_url, ''), au.username, COALESCE(au.avatar_url, ''), fr.status, fr.created_at
-		FROM friend_requests fr
-		JOIN users ru ON ru.id = fr.requester_id
-		JOIN users au ON au.id = fr.addressee_id
-		WHERE fr.addressee_id = $1 AND fr.status = 'pending'
-		ORDER BY fr.created_at DESC
-	`
-	rows, err := s.DB.QueryContext(ctx, query, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	out := make([]FriendRequest, 0)
-	for rows.Next() {
-		var fr FriendRequest
-		if err := rows.Scan(&fr.ID, &fr.RequesterID, &fr.AddresseeID, &fr.Requester, &fr.RequesterAvatar, &fr.Addressee, &fr.AddresseeAvatar, &fr.Status, &fr.CreatedAt); err != nil {
-			return nil, err
-		}
-		out = append(out, fr)
-	}
-	return out, rows.Err()
+	ctx, done := s.op(ctx, "ListIncomingFriendRequests")
+	defer done()
+	return queries{s.DB}.listIncomingFriendRequests(ctx, userID)
 }
 
 func (s *Store) CreateFriendRequest(ctx context.Context, requesterID, addresseeID uuid.UUID) error {
+	ctx, done := s.op(ctx, "CreateFriendRequest")
+	defer done()
 	if requesterID == addresseeID {
 		return fmt.Errorf("cannot add self")
 	}
-	var exists bool
-	if err := s.DB.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM friendships WHERE user_id = $1 AND friend_id = $2)`, requesterID, addresseeID).Scan(&exists); err != nil {
+	exists, err := queries{s.DB}.isFriend(ctx, requesterID, addresseeID)
+	if err != nil {
 		return err
 	}
 	if exists {
 		return nil
 	}
 	var reqID int64
-	err := s.DB.QueryRowContext(ctx, `
+	err = s.DB.QueryRowContext(ctx, `
 		INSERT INTO friend_requests (requester_id, addressee_id, status)
 		VALUES ($1, $2, 'pending')
 		ON CONFLICT (requester_id, addressee_id) DO UPDATE
@@ -747,6 +683,8 @@ func (s *Store) CreateFriendRequest(ctx context.Context, requesterID, addresseeI
 }
 
 func (s *Store) AcceptFriendRequest(ctx context.Context, reqID int64, userID uuid.UUID) (uuid.UUID, error) {
+	ctx, done := s.op(ctx, "AcceptFriendRequest")
+	defer done()
 	tx, err := s.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return uuid.Nil, err
@@ -775,10 +713,11 @@ func (s *Store) AcceptFriendRequest(ctx context.Context, reqID int64, userID uui
 	if _, err := tx.ExecContext(ctx, `UPDATE friend_requests SET status = 'accepted' WHERE id = $1`, reqID); err != nil {
 		return uuid.Nil, err
 	}
-	if _, err := tx.ExecContext(ctx, `INSERT INTO friendships (user_id, friend_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, requesterID, addresseeID); err != nil {
+	q := queries{tx}
+	if err := q.addFriendship(ctx, requesterID, addresseeID); err != nil {
 		return uuid.Nil, err
 	}
-	if _, err := tx.ExecContext(ctx, `INSERT INTO friendships (user_id, friend_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, addresseeID, requesterID); err != nil {
+	if err := q.addFriendship(ctx, addresseeID, requesterID); err != nil {
 		return uuid.Nil, err
 	}
 	if err := tx.Commit(); err != nil {
@@ -788,6 +727,8 @@ func (s *Store) AcceptFriendRequest(ctx context.Context, reqID int64, userID uui
 }
 
 func (s *Store) DeclineFriendRequest(ctx context.Context, reqID int64, userID uuid.UUID) error {
+	ctx, done := s.op(ctx, "DeclineFriendRequest")
+	defer done()
 	tx, err := s.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
@@ -820,6 +761,8 @@ func (s *Store) DeclineFriendRequest(ctx context.Context, reqID int64, userID uu
 }
 
 func (s *Store) GetOrCreateDirectRoom(ctx context.Context, a, b uuid.UUID) (Room, error) {
+	ctx, done := s.op(ctx, "GetOrCreateDirectRoom")
+	defer done()
 	if a == b {
 		return Room{}, fmt.Errorf("cannot dm self")
 	}
@@ -843,13 +786,10 @@ func (s *Store) GetOrCreateDirectRoom(ctx context.Context, a, b uuid.UUID) (Room
 	}
 	defer tx.Rollback()
 
+	q := queries{tx}
 	name := "dm-" + userA.String()[:8] + "-" + userB.String()[:8]
-	var r Room
-	if err := tx.QueryRowContext(ctx, `
-		INSERT INTO rooms (name, created_by, is_private)
-		VALUES ($1, $2, true)
-		RETURNING id, name, created_by, is_private, created_at
-	`, name, userA).Scan(&r.ID, &r.Name, &r.CreatedBy, &r.IsPrivate, &r.CreatedAt); err != nil {
+	r, err := q.insertRoom(ctx, name, userA, true)
+	if err != nil {
 		return Room{}, err
 	}
 	if _, err := tx.ExecContext(ctx, `
@@ -859,10 +799,10 @@ func (s *Store) GetOrCreateDirectRoom(ctx context.Context, a, b uuid.UUID) (Room
 	`, r.ID, userA, userB); err != nil {
 		return Room{}, err
 	}
-	if _, err := tx.ExecContext(ctx, `INSERT INTO room_members (room_id, user_id, role) VALUES ($1, $2, 'admin') ON CONFLICT DO NOTHING`, r.ID, userA); err != nil {
+	if err := q.addRoomMember(ctx, r.ID, userA, "admin"); err != nil {
 		return Room{}, err
 	}
-	if _, err := tx.ExecContext(ctx, `INSERT INTO room_members (room_id, user_id, role) VALUES ($1, $2, 'member') ON CONFLICT DO NOTHING`, r.ID, userB); err != nil {
+	if err := q.addRoomMember(ctx, r.ID, userB, "member"); err != nil {
 		return Room{}, err
 	}
 	if err := tx.Commit(); err != nil {
@@ -872,57 +812,37 @@ func (s *Store) GetOrCreateDirectRoom(ctx context.Context, a, b uuid.UUID) (Room
 }
 
 func (s *Store) ListDirectRoomsForUser(ctx context.Context, userID uuid.UUID) ([]Room, error) {
-	query := `
-		SELECT r.id,
-		       CASE WHEN d.user_a = $1 THEN ub.username ELSE ua.username END AS dm_name,
-		       r.created_by,
-		       CASE WHEN d.user_a = $1 THEN COALESCE(ub.avatar_url, '') ELSE COALESCE(ua.avatar_url, '') END AS dm_avatar_url,
-		       r.is_private, rm.role, (rm.role = 'admin') AS can_manage, r.created_at
-		FROM rooms r
-		JOIN direct_rooms d ON d.room_id = r.id
-		JOIN room_members rm ON rm.room_id = r.id AND rm.user_id = $1
-		JOIN users ua ON ua.id = d.user_a
-		JOIN users ub ON ub.id = d.user_b
-		WHERE d.user_a = $1 OR d.user_b = $1
-		ORDER BY r.created_at DESC
-	`
-	rows, err := s.DB.QueryContext(ctx, query, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	out := make([]Room, 0)
-	for rows.Next() {
-		var r Room
-		if err := rows.Scan(&r.ID, &r.Name, &r.CreatedBy, &r.AvatarURL, &r.IsPrivate, &r.MyRole, &r.CanManage, &r.CreatedAt); err != nil {
-			return nil, err
-		}
-		out = append(out, r)
-	}
-	return out, rows.Err()
+	ctx, done := s.op(ctx, "ListDirectRoomsForUser")
+	defer done()
+	return queries{s.DB}.listDirectRoomsForUser(ctx, userID)
 }
 
-func (s *Store) SaveMessage(ctx context.Context, roomID, userID uuid.UUID, content string) (Message, error) {
-	return s.SaveMessageWithType(ctx, roomID, userID, content, "text", "")
+// SaveMessage stores a chat message. clientSentAt is when the client says
+// it was composed; pass it through CheckClientSentAt first.
+func (s *Store) SaveMessage(ctx context.Context, roomID, userID uuid.UUID, content string, clientSentAt *time.Time) (Message, error) {
+	ctx, done := s.op(ctx, "SaveMessage")
+	defer done()
+	return s.saveMessage(ctx, roomID, userID, content, "text", "", clientSentAt)
 }
 
 func (s *Store) SaveMessageWithType(ctx context.Context, roomID, userID uuid.UUID, content, messageType, mediaURL string) (Message, error) {
+	ctx, done := s.op(ctx, "SaveMessageWithType")
+	defer done()
+	return s.saveMessage(ctx, roomID, userID, content, messageType, mediaURL, nil)
+}
+
+func (s *Store) saveMessage(ctx context.Context, roomID, userID uuid.UUID, content, messageType, mediaURL string, clientSentAt *time.Time) (Message, error) {
 	if messageType == "" {
 		messageType = "text"
 	}
-	query := `
-		INSERT INTO messages (room_id, user_id, content, message_type, media_url)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id, room_id, user_id, content, message_type, COALESCE(media_url, ''), created_at
-	`
-	var m Message
-	err := s.DB.QueryRowContext(ctx, query, roomID, userID, content, messageType, nullableString(mediaURL)).
-		Scan(&m.ID, &m.RoomID, &m.UserID, &m.Content, &m.MessageType, &m.MediaURL, &m.CreatedAt)
+	content, raw := s.renderContent(content)
+	q := queries{s.DB}
+	m, err := q.insertMessage(ctx, roomID, userID, content, messageType, sql.NullString{String: mediaURL, Valid: mediaURL != ""}, clientSentAt, raw)
 	if err != nil {
 		return Message{}, err
 	}
 
-	u, err := s.FindUserByID(ctx, userID)
+	u, err := q.findUserByID(ctx, userID)
 	if err != nil {
 		return Message{}, err
 	}
@@ -932,103 +852,100 @@ func (s *Store) SaveMessageWithType(ctx context.Context, roomID, userID uuid.UUI
 }
 
 func (s *Store) ListMessages(ctx context.Context, roomID uuid.UUID, limit int) ([]Message, error) {
+	ctx, done := s.op(ctx, "ListMessages")
+	defer done()
 	if limit <= 0 || limit > 200 {
 		limit = 50
 	}
-	query := `
-		SELECT m.id, m.room_id, m.user_id, u.username, COALESCE(u.avatar_url, ''), m.content, m.message_type, COALESCE(m.media_url, ''), m.created_at
-		FROM messages m
-		JOIN users u ON u.id = m.user_id
-		WHERE m.room_id = $1
-		ORDER BY m.created_at DESC
-		LIMIT $2
-	`
-	rows, err := s.DB.QueryContext(ctx, query, roomID, limit)
+	messages, err := queries{s.DB}.listLatestMessages(ctx, roomID, limit)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	slices.Reverse(messages)
+	return messages, nil
+}
 
-	messages := []Message{}
-	for rows.Next() {
-		var m Message
-		if err := rows.Scan(&m.ID, &m.RoomID, &m.UserID, &m.Username, &m.AvatarURL, &m.Content, &m.MessageType, &m.MediaURL, &m.CreatedAt); err != nil {
-			return nil, err
-		}
-		messages = append(messages, m)
+// ListMessagesBefore pages backwards through a room: it returns up to limit
+// messages with an ID lower than beforeID, oldest first.
+func (s *Store) ListMessagesBefore(ctx context.Context, roomID uuid.UUID, beforeID int64, limit int) ([]Message, error) {
+	ctx, done := s.op(ctx, "ListMessagesBefore")
+	defer done()
+	if limit <= 0 || limit > 200 {
+		limit = 50
 	}
-	if err := rows.Err(); err != nil {
+	messages, err := queries{s.DB}.listMessagesBefore(ctx, roomID, beforeID, limit)
+	if err != nil {
 		return nil, err
 	}
-
-	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
-		messages[i], messages[j] = messages[j], messages[i]
-	}
+	slices.Reverse(messages)
 	return messages, nil
 }
 
 func (s *Store) SetEmailVerificationToken(ctx context.Context, userID uuid.UUID, tokenHash string, sentAt time.Time) error {
+	ctx, done := s.op(ctx, "SetEmailVerificationToken")
+	defer done()
 	_, err := s.DB.ExecContext(ctx, `
 		UPDATE users
-		SET email_verification_token_hash = $2, email_verification_sent_at = $3
+		SET email_verification_token_hash = $2, email_verification_sent_at = $3,
+		    email_verification_attempts = 0
 		WHERE id = $1
 	`, userID, tokenHash, sentAt)
 	return err
 }
 
 func (s *Store) SetPasswordResetToken(ctx context.Context, userID uuid.UUID, tokenHash string, sentAt time.Time) error {
+	ctx, done := s.op(ctx, "SetPasswordResetToken")
+	defer done()
 	_, err := s.DB.ExecContext(ctx, `
 		UPDATE users
-		SET password_reset_token_hash = $2, password_reset_sent_at = $3
+		SET password_reset_token_hash = $2, password_reset_sent_at = $3,
+		    password_reset_used_at = NULL
 		WHERE id = $1
 	`, userID, tokenHash, sentAt)
 	return err
 }
 
-func (s *Store) VerifyUserByEmailAndTokenHash(ctx context.Context, email, tokenHash string) (User, error) {
-	var u User
+// ResetPasswordByTokenHash sets a new password and revokes every existing
+// session of the account, returning its id so callers can notify them. The
+// token is marked used rather than cleared: using it again is
+// ErrTokenUsed, until the expired-token sweep removes it.
+func (s *Store) ResetPasswordByTokenHash(ctx context.Context, tokenHash, passwordHash string) (uuid.UUID, error) {
+	ctx, done := s.op(ctx, "ResetPasswordByTokenHash")
+	defer done()
+	var userID uuid.UUID
 	err := s.DB.QueryRowContext(ctx, `
-		UPDATE users
-		SET email_verified = TRUE,
-		    email_verification_token_hash = NULL
-		WHERE email = $1
-		  AND email_verification_token_hash = $2
-		  AND email_verification_sent_at IS NOT NULL
-		  AND email_verification_sent_at >= NOW() - INTERVAL '24 hours'
-		RETURNING id, email, username, COALESCE(avatar_url, ''), email_verified, password_hash, created_at
-	`, email, tokenHash).Scan(&u.ID, &u.Email, &u.Username, &u.AvatarURL, &u.EmailVerified, &u.PasswordHash, &u.CreatedAt)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return User{}, ErrNotFound
-		}
-		return User{}, err
-	}
-	return u, nil
-}
-
-func (s *Store) ResetPasswordByTokenHash(ctx context.Context, tokenHash, passwordHash string) error {
-	res, err := s.DB.ExecContext(ctx, `
 		UPDATE users
 		SET password_hash = $2,
-		    password_reset_token_hash = NULL
+		    password_reset_used_at = NOW(),
+		    session_version = session_version + 1
 		WHERE password_reset_token_hash = $1
+		  AND password_reset_used_at IS NULL
 		  AND password_reset_sent_at IS NOT NULL
 		  AND password_reset_sent_at >= NOW() - INTERVAL '2 hours'
-	`, tokenHash, passwordHash)
-	if err != nil {
-		return err
+		RETURNING id
+	`, tokenHash, passwordHash).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		var used bool
+		err = s.DB.QueryRowContext(ctx, `
+			SELECT password_reset_used_at IS NOT NULL FROM users WHERE password_reset_token_hash = $1
+		`, tokenHash).Scan(&used)
+		switch {
+		case errors.Is(err, sql.ErrNoRows), err == nil && !used:
+			return uuid.Nil, ErrNotFound
+		case err != nil:
+			return uuid.Nil, err
+		}
+		return uuid.Nil, ErrTokenUsed
 	}
-	affected, err := res.RowsAffected()
 	if err != nil {
-		return err
-	}
-	if affected == 0 {
-		return ErrNotFound
+		return uuid.Nil, err
 	}
-	return nil
+	return userID, nil
 }
 
 func (s *Store) FindRoomInviteLinkByCreator(ctx context.Context, roomID, createdBy uuid.UUID) (string, time.Time, error) {
+	ctx, done := s.op(ctx, "FindRoomInviteLinkByCreator")
+	defer done()
 	var token string
 	var expiresAt time.Time
 	err := s.DB.QueryRowContext(ctx, `
@@ -1050,6 +967,8 @@ func (s *Store) FindRoomInviteLinkByCreator(ctx context.Context, roomID, created
 }
 
 func (s *Store) FindGroupInviteLinkByCreator(ctx context.Context, groupID, createdBy uuid.UUID) (string, time.Time, error) {
+	ctx, done := s.op(ctx, "FindGroupInviteLinkByCreator")
+	defer done()
 	var token string
 	var expiresAt time.Time
 	err := s.DB.QueryRowContext(ctx, `
@@ -1071,6 +990,8 @@ func (s *Store) FindGroupInviteLinkByCreator(ctx context.Context, groupID, creat
 }
 
 func (s *Store) CreateRoomInviteLink(ctx context.Context, rawToken, tokenHash string, roomID, createdBy uuid.UUID, expiresAt time.Time) error {
+	ctx, done := s.op(ctx, "CreateRoomInviteLink")
+	defer done()
 	_, err := s.DB.ExecContext(ctx, `
 		INSERT INTO room_invite_links (token, token_hash, room_id, group_id, created_by, expires_at)
 		VALUES ($1, $2, $3, NULL, $4, $5)
@@ -1079,6 +1000,8 @@ func (s *Store) CreateRoomInviteLink(ctx context.Context, rawToken, tokenHash st
 }
 
 func (s *Store) CreateGroupInviteLink(ctx context.Context, rawToken, tokenHash string, groupID, createdBy uuid.UUID, expiresAt time.Time) error {
+	ctx, done := s.op(ctx, "CreateGroupInviteLink")
+	defer done()
 	_, err := s.DB.ExecContext(ctx, `
 		INSERT INTO room_invite_links (token, token_hash, room_id, group_id, created_by, expires_at)
 		VALUES ($1, $2, NULL, $3, $4, $5)
@@ -1087,30 +1010,23 @@ func (s *Store) CreateGroupInviteLink(ctx context.Context, rawToken, tokenHash s
 }
 
 func (s *Store) GetGroupIDByRoomID(ctx context.Context, roomID uuid.UUID) (uuid.UUID, error) {
-	var groupID uuid.UUID
-	err := s.DB.QueryRowContext(ctx, `
-		SELECT group_id
-		FROM group_channels
-		WHERE room_id = $1
-	`, roomID).Scan(&groupID)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return uuid.Nil, ErrNotFound
-		}
-		return uuid.Nil, err
-	}
-	return groupID, nil
+	ctx, done := s.op(ctx, "GetGroupIDByRoomID")
+	defer done()
+	return queries{s.DB}.getGroupIDByRoomID(ctx, roomID)
 }
 
 func (s *Store) JoinRoomByInviteTokenHash(ctx context.Context, tokenHash string, userID uuid.UUID) (uuid.UUID, error) {
+	ctx, done := s.op(ctx, "JoinRoomByInviteTokenHash")
+	defer done()
 	var roomIDText sql.NullString
 	var groupIDText sql.NullString
+	var createdBy uuid.UUID
 	err := s.DB.QueryRowContext(ctx, `
-		SELECT room_id::text, group_id::text
+		SELECT room_id::text, group_id::text, created_by
 		FROM room_invite_links
 		WHERE token_hash = $1
 		  AND expires_at > NOW()
-	`, tokenHash).Scan(&roomIDText, &groupIDText)
+	`, tokenHash).Scan(&roomIDText, &groupIDText, &createdBy)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return uuid.Nil, ErrNotFound
@@ -1123,7 +1039,7 @@ func (s *Store) JoinRoomByInviteTokenHash(ctx context.Context, tokenHash string,
 		if parseErr != nil {
 			return uuid.Nil, parseErr
 		}
-		if err := s.JoinRoom(ctx, roomID, userID); err != nil {
+		if err := s.joinRoomByLink(ctx, roomID, userID, createdBy, tokenHash); err != nil {
 			return uuid.Nil, err
 		}
 		return roomID, nil
@@ -1162,7 +1078,7 @@ func (s *Store) JoinRoomByInviteTokenHash(ctx context.Context, tokenHash string,
 			firstRoomID = channelRoomID
 			found = true
 		}
-		if err := s.JoinRoom(ctx, channelRoomID, userID); err != nil {
+		if err := s.joinRoomByLink(ctx, channelRoomID, userID, createdBy, tokenHash); err != nil {
 			return uuid.Nil, err
 		}
 	}
@@ -1176,6 +1092,8 @@ func (s *Store) JoinRoomByInviteTokenHash(ctx context.Context, tokenHash string,
 }
 
 func (s *Store) FindFriendInviteLinkByCreator(ctx context.Context, createdBy uuid.UUID) (string, time.Time, error) {
+	ctx, done := s.op(ctx, "FindFriendInviteLinkByCreator")
+	defer done()
 	var token string
 	var expiresAt time.Time
 	err := s.DB.QueryRowContext(ctx, `
@@ -1196,6 +1114,8 @@ func (s *Store) FindFriendInviteLinkByCreator(ctx context.Context, createdBy uui
 }
 
 func (s *Store) CreateFriendInviteLink(ctx context.Context, rawToken, tokenHash string, createdBy uuid.UUID, expiresAt time.Time) error {
+	ctx, done := s.op(ctx, "CreateFriendInviteLink")
+	defer done()
 	_, err := s.DB.ExecContext(ctx, `
 		INSERT INTO friend_invite_links (token, token_hash, created_by, expires_at)
 		VALUES ($1, $2, $3, $4)
@@ -1204,6 +1124,8 @@ func (s *Store) CreateFriendInviteLink(ctx context.Context, rawToken, tokenHash
 }
 
 func (s *Store) AddFriendByInviteTokenHash(ctx context.Context, tokenHash string, userID uuid.UUID) (Friend, error) {
+	ctx, done := s.op(ctx, "AddFriendByInviteTokenHash")
+	defer done()
 	var inviterID uuid.UUID
 	err := s.DB.QueryRowContext(ctx, `
 		SELECT created_by
@@ -1220,20 +1142,19 @@ func (s *Store) AddFriendByInviteTokenHash(ctx context.Context, tokenHash string
 	if inviterID == userID {
 		return Friend{}, fmt.Errorf("cannot add self")
 	}
-	if _, err := s.DB.ExecContext(ctx, `INSERT INTO friendships (user_id, friend_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, inviterID, userID); err != nil {
-		return Friend{}, err
-	}
-	if _, err := s.DB.ExecContext(ctx, `INSERT INTO friendships (user_id, friend_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, userID, inviterID); err != nil {
+	q := queries{s.DB}
+	if err := q.addFriendship(ctx, inviterID, userID); err != nil {
 		return Friend{}, err
 	}
-	var f Friend
-	if err := s.DB.QueryRowContext(ctx, `SELECT id, username, email, COALESCE(avatar_url, '') FROM users WHERE id = $1`, inviterID).Scan(&f.ID, &f.Username, &f.Email, &f.AvatarURL); err != nil {
+	if err := q.addFriendship(ctx, userID, inviterID); err != nil {
 		return Friend{}, err
 	}
-	return f, nil
+	return q.getFriend(ctx, inviterID)
 }
 
 func (s *Store) UpdateUserAvatar(ctx context.Context, userID uuid.UUID, avatarURL string) error {
+	ctx, done := s.op(ctx, "UpdateUserAvatar")
+	defer done()
 	_, err := s.DB.ExecContext(ctx, `
 		UPDATE users
 		SET avatar_url = $2
@@ -1242,6 +1163,85 @@ func (s *Store) UpdateUserAvatar(ctx context.Context, userID uuid.UUID, avatarUR
 	return err
 }
 
+// unreadColumns computes unread_count and first_unread_message_id for the
+// room_members row aliased rm of room r, excluding the member's own messages.
+const unreadColumns = `(SELECT COUNT(*) FROM messages mu WHERE mu.room_id = r.id AND mu.id > COALESCE(rm.last_read_message_id, 0) AND mu.user_id <> rm.user_id AND NOT mu.shadowed) AS unread_count,
+		       (SELECT MIN(mu.id) FROM messages mu WHERE mu.room_id = r.id AND mu.id > COALESCE(rm.last_read_message_id, 0) AND mu.user_id <> rm.user_id AND NOT mu.shadowed) AS first_unread_message_id`
+
+// listUnreadColumns is the cheaper variant for room lists: both come from
+// room_summaries rs, which the background worker refreshes shortly after
+// new messages land and MarkRoomRead updates on read.
+const listUnreadColumns = `rs.unread_count AS unread_count, rs.first_unread_id AS first_unread_message_id`
+
+// MarkRoomRead advances the member's read pointer, and their room summary
+// with it; it never moves backwards, so a stale device cannot un-read
+// messages read elsewhere.
+func (s *Store) MarkRoomRead(ctx context.Context, roomID, userID uuid.UUID, messageID int64) (int64, error) {
+	ctx, done := s.op(ctx, "MarkRoomRead")
+	defer done()
+	var lastRead int64
+	err := s.DB.QueryRowContext(ctx, `
+		WITH rm AS (
+			UPDATE room_members
+			SET last_read_message_id = GREATEST(COALESCE(last_read_message_id, 0), $3),
+			    last_delivered_message_id = GREATEST(COALESCE(last_delivered_message_id, 0), $3),
+			    unread_count = (
+			      SELECT COUNT(*)
+			      FROM messages mu
+			      WHERE mu.room_id = $1
+			        AND mu.id > GREATEST(COALESCE(room_members.last_read_message_id, 0), $3)
+			        AND mu.user_id <> $2
+			        AND NOT mu.shadowed
+			    )
+			WHERE room_id = $1 AND user_id = $2
+			RETURNING room_id, user_id, last_read_message_id, unread_count
+		), summary AS (
+			UPDATE room_summaries rs
+			SET unread_count = rm.unread_count,
+			    first_unread_id = `+summaryFirstUnread+`,
+			    updated_at = NOW()
+			FROM rm
+			WHERE rs.room_id = rm.room_id AND rs.user_id = rm.user_id
+		)
+		SELECT last_read_message_id FROM rm
+	`, roomID, userID, messageID).Scan(&lastRead)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNotFound
+		}
+		return 0, err
+	}
+	return lastRead, nil
+}
+
+func (s *Store) GetUnreadState(ctx context.Context, roomID, userID uuid.UUID) (int, *int64, error) {
+	ctx, done := s.op(ctx, "GetUnreadState")
+	defer done()
+	var count int
+	var firstUnread sql.NullInt64
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT `+unreadColumns+`
+		FROM rooms r
+		JOIN room_members rm ON rm.room_id = r.id
+		WHERE r.id = $1 AND rm.user_id = $2
+	`, roomID, userID).Scan(&count, &firstUnread)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil, ErrNotFound
+		}
+		return 0, nil, err
+	}
+	return count, nullInt64Ptr(firstUnread), nil
+}
+
+func nullInt64Ptr(v sql.NullInt64) *int64 {
+	if !v.Valid {
+		return nil
+	}
+	n := v.Int64
+	return &n
+}
+
 func nullableString(v string) any {
 	if v == "" {
 		return nil
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// DeliveryPointer is how far a member has received and read a room. Per
+// message delivery state in direct messages is derived from the recipient's
+// pointers rather than stored per message.
+type DeliveryPointer struct {
+	UserID        uuid.UUID `json:"user_id"`
+	DeliveredUpTo int64     `json:"delivered_up_to"`
+	ReadUpTo      int64     `json:"read_up_to"`
+}
+
+// MarkRoomDelivered advances the member's delivered pointer and reports
+// whether it moved.
+func (s *Store) MarkRoomDelivered(ctx context.Context, roomID, userID uuid.UUID, messageID int64) (bool, error) {
+	ctx, done := s.op(ctx, "MarkRoomDelivered")
+	defer done()
+	res, err := s.DB.ExecContext(ctx, `
+		UPDATE room_members
+		SET last_delivered_message_id = $3
+		WHERE room_id = $1
+		  AND user_id = $2
+		  AND COALESCE(last_delivered_message_id, 0) < $3
+	`, roomID, userID, messageID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (s *Store) ListDeliveryPointers(ctx context.Context, roomID uuid.UUID) ([]DeliveryPointer, error) {
+	ctx, done := s.op(ctx, "ListDeliveryPointers")
+	defer done()
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT user_id,
+		       GREATEST(COALESCE(last_delivered_message_id, 0), COALESCE(last_read_message_id, 0)),
+		       COALESCE(last_read_message_id, 0)
+		FROM room_members
+		WHERE room_id = $1
+	`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]DeliveryPointer, 0, 2)
+	for rows.Next() {
+		var p DeliveryPointer
+		if err := rows.Scan(&p.UserID, &p.DeliveredUpTo, &p.ReadUpTo); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// ApplyDeliveryStates sets DeliveryState on each message from the pointers
+// of the members other than its author: "read" once any of them read it,
+// "delivered" once any of them received it, and "sent" otherwise.
+func ApplyDeliveryStates(messages []Message, pointers []DeliveryPointer) {
+	for i := range messages {
+		state := "sent"
+		for _, p := range pointers {
+			if p.UserID == messages[i].UserID {
+				continue
+			}
+			if p.ReadUpTo >= messages[i].ID {
+				state = "read"
+				break
+			}
+			if p.DeliveredUpTo >= messages[i].ID {
+				state = "delivered"
+			}
+		}
+		messages[i].DeliveryState = state
+	}
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DeviceLink is a pending sign-in of a new device on behalf of UserID. It is
+// claimed by the first device to present the code, approved by the user on
+// a device that is already signed in, and consumed when the new device
+// collects its token.
+type DeviceLink struct {
+	ID         int64      `json:"id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	DeviceName string     `json:"device_name,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	ClaimedAt  *time.Time `json:"claimed_at,omitempty"`
+	ApprovedAt *time.Time `json:"approved_at,omitempty"`
+	ConsumedAt *time.Time `json:"consumed_at,omitempty"`
+}
+
+const deviceLinkColumns = `id, user_id, device_name, created_at, expires_at, claimed_at, approved_at, consumed_at`
+
+func scanDeviceLink(row interface{ Scan(...any) error }) (DeviceLink, error) {
+	var l DeviceLink
+	err := row.Scan(&l.ID, &l.UserID, &l.DeviceName, &l.CreatedAt, &l.ExpiresAt, &l.ClaimedAt, &l.ApprovedAt, &l.ConsumedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return DeviceLink{}, ErrNotFound
+	}
+	return l, err
+}
+
+func (s *Store) CreateDeviceLink(ctx context.Context, userID uuid.UUID, codeHash string, expiresAt time.Time) (DeviceLink, error) {
+	ctx, done := s.op(ctx, "CreateDeviceLink")
+	defer done()
+	return scanDeviceLink(s.DB.QueryRowContext(ctx, `
+		INSERT INTO device_links (code_hash, user_id, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING `+deviceLinkColumns, codeHash, userID, expiresAt))
+}
+
+// GetDeviceLink returns the user's unexpired, unconsumed link for codeHash.
+func (s *Store) GetDeviceLink(ctx context.Context, userID uuid.UUID, codeHash string) (DeviceLink, error) {
+	ctx, done := s.op(ctx, "GetDeviceLink")
+	defer done()
+	return scanDeviceLink(s.DB.QueryRowContext(ctx, `
+		SELECT `+deviceLinkColumns+` FROM device_links
+		WHERE code_hash = $1 AND user_id = $2 AND expires_at > NOW() AND consumed_at IS NULL
+	`, codeHash, userID))
+}
+
+// ClaimDeviceLink binds an unclaimed link to the device holding claimHash.
+// Only the first claim succeeds; later ones get ErrNotFound.
+func (s *Store) ClaimDeviceLink(ctx context.Context, codeHash, claimHash, deviceName string) (DeviceLink, error) {
+	ctx, done := s.op(ctx, "ClaimDeviceLink")
+	defer done()
+	return scanDeviceLink(s.DB.QueryRowContext(ctx, `
+		UPDATE device_links
+		SET claim_hash = $2, device_name = $3, claimed_at = NOW()
+		WHERE code_hash = $1 AND claim_hash IS NULL AND expires_at > NOW()
+		RETURNING `+deviceLinkColumns, codeHash, claimHash, deviceName))
+}
+
+// ApproveDeviceLink approves a claimed link owned by userID.
+func (s *Store) ApproveDeviceLink(ctx context.Context, userID uuid.UUID, codeHash string) (DeviceLink, error) {
+	ctx, done := s.op(ctx, "ApproveDeviceLink")
+	defer done()
+	return scanDeviceLink(s.DB.QueryRowContext(ctx, `
+		UPDATE device_links
+		SET approved_at = NOW()
+		WHERE code_hash = $1 AND user_id = $2 AND claimed_at IS NOT NULL
+		  AND approved_at IS NULL AND expires_at > NOW()
+		RETURNING `+deviceLinkColumns, codeHash, userID))
+}
+
+func (s *Store) DeleteDeviceLink(ctx context.Context, userID uuid.UUID, codeHash string) error {
+	ctx, done := s.op(ctx, "DeleteDeviceLink")
+	defer done()
+	return s.execOne(ctx, `DELETE FROM device_links WHERE code_hash = $1 AND user_id = $2`, codeHash, userID)
+}
+
+// PollDeviceLink returns the link for the device holding claimHash. Once the
+// link is approved the same call consumes it, so the returned ConsumedAt is
+// set exactly once and a token is issued for it only once.
+func (s *Store) PollDeviceLink(ctx context.Context, codeHash, claimHash string) (DeviceLink, error) {
+	ctx, done := s.op(ctx, "PollDeviceLink")
+	defer done()
+	return scanDeviceLink(s.DB.QueryRowContext(ctx, `
+		UPDATE device_links
+		SET consumed_at = CASE WHEN approved_at IS NOT NULL THEN NOW() END
+		WHERE code_hash = $1 AND claim_hash = $2 AND consumed_at IS NULL AND expires_at > NOW()
+		RETURNING `+deviceLinkColumns, codeHash, claimHash))
+}
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DirectUpload is an object a client may upload straight to the bucket
+// and then post to RoomID.
+type DirectUpload struct {
+	Key         string
+	RoomID      uuid.UUID
+	UserID      uuid.UUID
+	ContentType string
+	MessageType string
+	MaxBytes    int64
+	ExpiresAt   time.Time
+}
+
+func (s *Store) CreateDirectUpload(ctx context.Context, u DirectUpload) error {
+	ctx, done := s.op(ctx, "CreateDirectUpload")
+	defer done()
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO direct_uploads (object_key, room_id, user_id, content_type, message_type, max_bytes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, u.Key, u.RoomID, u.UserID, u.ContentType, u.MessageType, u.MaxBytes, u.ExpiresAt)
+	return err
+}
+
+// GetDirectUpload returns key's pending upload if it has not expired.
+func (s *Store) GetDirectUpload(ctx context.Context, key string) (DirectUpload, error) {
+	ctx, done := s.op(ctx, "GetDirectUpload")
+	defer done()
+	u := DirectUpload{Key: key}
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT room_id, user_id, content_type, message_type, max_bytes, expires_at
+		FROM direct_uploads
+		WHERE object_key = $1 AND expires_at > NOW()
+	`, key).Scan(&u.RoomID, &u.UserID, &u.ContentType, &u.MessageType, &u.MaxBytes, &u.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return DirectUpload{}, ErrNotFound
+	}
+	return u, err
+}
+
+// DeleteDirectUpload claims a pending upload. Of two concurrent
+// completions only one gets nil.
+func (s *Store) DeleteDirectUpload(ctx context.Context, key string) error {
+	ctx, done := s.op(ctx, "DeleteDirectUpload")
+	defer done()
+	return s.execOne(ctx, `DELETE FROM direct_uploads WHERE object_key = $1`, key)
+}
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DiscoveredMessage is one message of an e-discovery export: everything
+// stored about it, shadowed messages included, with its room's name.
+// ContentAsTyped is set when shortcode expansion changed the text.
+type DiscoveredMessage struct {
+	ID             int64      `json:"id"`
+	RoomID         uuid.UUID  `json:"room_id"`
+	RoomName       string     `json:"room_name"`
+	UserID         uuid.UUID  `json:"user_id"`
+	Username       string     `json:"username"`
+	Content        string     `json:"content"`
+	ContentAsTyped string     `json:"content_as_typed,omitempty"`
+	MessageType    string     `json:"message_type"`
+	MediaURL       string     `json:"media_url,omitempty"`
+	Shadowed       bool       `json:"shadowed"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ClientSentAt   *time.Time `json:"client_sent_at,omitempty"`
+}
+
+// exportBatch is how many messages ExportMessages reads per query.
+const exportBatch = 1000
+
+// MessageExport selects the messages ExportMessages streams: those posted
+// in [From, To) by UserID, in RoomID, or both. A zero id does not filter.
+type MessageExport struct {
+	UserID uuid.UUID
+	RoomID uuid.UUID
+	From   time.Time
+	To     time.Time
+}
+
+// ExportMessages streams the messages f selects to each, oldest first. It
+// reads them in batches, each a short query of its own that resumes after
+// the last message sent, so however slowly each consumes them no
+// connection, cursor or transaction is held in between. Messages posted
+// during an export appear in it if they fall after where it has got to.
+func (s *Store) ExportMessages(ctx context.Context, f MessageExport, each func(DiscoveredMessage) error) error {
+	afterAt, afterID := f.From, int64(0)
+	for {
+		batch, err := s.exportMessagesBatch(ctx, f, afterAt, afterID)
+		if err != nil {
+			return err
+		}
+		for _, m := range batch {
+			if err := each(m); err != nil {
+				return err
+			}
+		}
+		if len(batch) < exportBatch {
+			return nil
+		}
+		last := batch[len(batch)-1]
+		afterAt, afterID = last.CreatedAt, last.ID
+	}
+}
+
+// exportMessagesBatch reads the next batch of an export: the messages
+// after (afterAt, afterID) in (created_at, id) order.
+func (s *Store) exportMessagesBatch(ctx context.Context, f MessageExport, afterAt time.Time, afterID int64) ([]DiscoveredMessage, error) {
+	ctx, done := s.op(ctx, "ExportMessages")
+	defer done()
+	var userID, roomID *uuid.UUID
+	if f.UserID != uuid.Nil {
+		userID = &f.UserID
+	}
+	if f.RoomID != uuid.Nil {
+		roomID = &f.RoomID
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT m.id, m.room_id, r.name, m.user_id, u.username, m.content, COALESCE(m.content_raw, ''),
+		       m.message_type, COALESCE(m.media_url, ''), m.shadowed, m.created_at, m.client_sent_at
+		FROM messages m
+		JOIN rooms r ON r.id = m.room_id
+		JOIN users u ON u.id = m.user_id
+		WHERE ($1::uuid IS NULL OR m.user_id = $1)
+		  AND ($2::uuid IS NULL OR m.room_id = $2)
+		  AND (m.created_at, m.id) > ($3, $4)
+		  AND m.created_at < $5
+		ORDER BY m.created_at, m.id
+		LIMIT $6
+	`, userID, roomID, afterAt, afterID, f.To, exportBatch)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	batch := make([]DiscoveredMessage, 0, exportBatch)
+	for rows.Next() {
+		var m DiscoveredMessage
+		if err := rows.Scan(&m.ID, &m.RoomID, &m.RoomName, &m.UserID, &m.Username, &m.Content, &m.ContentAsTyped,
+			&m.MessageType, &m.MediaURL, &m.Shadowed, &m.CreatedAt, &m.ClientSentAt); err != nil {
+			return nil, err
+		}
+		batch = append(batch, m)
+	}
+	return batch, rows.Err()
+}
@@ -0,0 +1,207 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrEmailTaken is returned when the requested address belongs to another
+// account.
+var ErrEmailTaken = errors.New("email already in use")
+
+const (
+	// EmailChangeVerifyWindow is how long the link sent to the new address
+	// stays valid.
+	EmailChangeVerifyWindow = 24 * time.Hour
+	// EmailChangeRollbackWindow is how long the old address can undo the
+	// change, counted from the request.
+	EmailChangeRollbackWindow = 7 * 24 * time.Hour
+)
+
+type EmailChange struct {
+	ID         int64      `json:"id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	OldEmail   string     `json:"old_email"`
+	NewEmail   string     `json:"new_email"`
+	CreatedAt  time.Time  `json:"created_at"`
+	VerifiedAt *time.Time `json:"verified_at,omitempty"`
+}
+
+const emailChangeColumns = `id, user_id, old_email, new_email, created_at, verified_at`
+
+func scanEmailChange(row interface{ Scan(...any) error }) (EmailChange, error) {
+	var c EmailChange
+	var verifiedAt sql.NullTime
+	if err := row.Scan(&c.ID, &c.UserID, &c.OldEmail, &c.NewEmail, &c.CreatedAt, &verifiedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return EmailChange{}, ErrNotFound
+		}
+		return EmailChange{}, err
+	}
+	if verifiedAt.Valid {
+		c.VerifiedAt = &verifiedAt.Time
+	}
+	return c, nil
+}
+
+// CreateEmailChange starts a change to newEmail, replacing any change the
+// user still has pending.
+func (s *Store) CreateEmailChange(ctx context.Context, userID uuid.UUID, oldEmail, newEmail, verifyHash, rollbackHash string) (EmailChange, error) {
+	ctx, done := s.op(ctx, "CreateEmailChange")
+	defer done()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return EmailChange{}, err
+	}
+	defer tx.Rollback()
+
+	var taken bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE email = $1)`, newEmail).Scan(&taken); err != nil {
+		return EmailChange{}, err
+	}
+	if taken {
+		return EmailChange{}, ErrEmailTaken
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE email_changes
+		SET cancelled_at = NOW()
+		WHERE user_id = $1 AND verified_at IS NULL AND cancelled_at IS NULL
+	`, userID); err != nil {
+		return EmailChange{}, err
+	}
+	c, err := scanEmailChange(tx.QueryRowContext(ctx, `
+		INSERT INTO email_changes (user_id, old_email, new_email, verify_token_hash, rollback_token_hash)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+emailChangeColumns, userID, oldEmail, newEmail, verifyHash, rollbackHash))
+	if err != nil {
+		return EmailChange{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return EmailChange{}, err
+	}
+	return c, nil
+}
+
+// GetPendingEmailChange returns the user's unverified, uncancelled change
+// that has not expired yet.
+func (s *Store) GetPendingEmailChange(ctx context.Context, userID uuid.UUID) (EmailChange, error) {
+	ctx, done := s.op(ctx, "GetPendingEmailChange")
+	defer done()
+	return scanEmailChange(s.DB.QueryRowContext(ctx, `
+		SELECT `+emailChangeColumns+`
+		FROM email_changes
+		WHERE user_id = $1
+		  AND verified_at IS NULL
+		  AND cancelled_at IS NULL
+		  AND created_at >= $2
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, userID, time.Now().Add(-EmailChangeVerifyWindow)))
+}
+
+func (s *Store) CancelPendingEmailChange(ctx context.Context, userID uuid.UUID) error {
+	ctx, done := s.op(ctx, "CancelPendingEmailChange")
+	defer done()
+	return s.execOne(ctx, `
+		UPDATE email_changes
+		SET cancelled_at = NOW()
+		WHERE user_id = $1 AND verified_at IS NULL AND cancelled_at IS NULL
+	`, userID)
+}
+
+// ConfirmEmailChange applies the change identified by the token sent to the
+// new address. The old address keeps working until this point.
+func (s *Store) ConfirmEmailChange(ctx context.Context, verifyHash string) (EmailChange, error) {
+	ctx, done := s.op(ctx, "ConfirmEmailChange")
+	defer done()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return EmailChange{}, err
+	}
+	defer tx.Rollback()
+
+	c, err := scanEmailChange(tx.QueryRowContext(ctx, `
+		SELECT `+emailChangeColumns+`
+		FROM email_changes
+		WHERE verify_token_hash = $1
+		  AND verified_at IS NULL
+		  AND cancelled_at IS NULL
+		  AND created_at >= $2
+		FOR UPDATE
+	`, verifyHash, time.Now().Add(-EmailChangeVerifyWindow)))
+	if err != nil {
+		return EmailChange{}, err
+	}
+	var taken bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE email = $1)`, c.NewEmail).Scan(&taken); err != nil {
+		return EmailChange{}, err
+	}
+	if taken {
+		return EmailChange{}, ErrEmailTaken
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET email = $2, email_verified = TRUE WHERE id = $1`, c.UserID, c.NewEmail); err != nil {
+		return EmailChange{}, err
+	}
+	now := time.Now()
+	if _, err := tx.ExecContext(ctx, `UPDATE email_changes SET verified_at = $2 WHERE id = $1`, c.ID, now); err != nil {
+		return EmailChange{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return EmailChange{}, err
+	}
+	c.VerifiedAt = &now
+	return c, nil
+}
+
+// RollbackEmailChange handles the link sent to the old address. A pending
+// change is simply cancelled; an applied one is reverted and every session
+// revoked, since whoever changed the address may not be the owner.
+func (s *Store) RollbackEmailChange(ctx context.Context, rollbackHash string) (EmailChange, error) {
+	ctx, done := s.op(ctx, "RollbackEmailChange")
+	defer done()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return EmailChange{}, err
+	}
+	defer tx.Rollback()
+
+	c, err := scanEmailChange(tx.QueryRowContext(ctx, `
+		SELECT `+emailChangeColumns+`
+		FROM email_changes
+		WHERE rollback_token_hash = $1
+		  AND cancelled_at IS NULL
+		  AND created_at >= $2
+		FOR UPDATE
+	`, rollbackHash, time.Now().Add(-EmailChangeRollbackWindow)))
+	if err != nil {
+		return EmailChange{}, err
+	}
+	if c.VerifiedAt != nil {
+		var taken bool
+		if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE email = $1 AND id <> $2)`, c.OldEmail, c.UserID).Scan(&taken); err != nil {
+			return EmailChange{}, err
+		}
+		if taken {
+			return EmailChange{}, ErrEmailTaken
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE users
+			SET email = $2,
+			    session_version = session_version + 1
+			WHERE id = $1
+		`, c.UserID, c.OldEmail); err != nil {
+			return EmailChange{}, err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE email_changes SET cancelled_at = NOW() WHERE id = $1`, c.ID); err != nil {
+		return EmailChange{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return EmailChange{}, err
+	}
+	return c, nil
+}
@@ -0,0 +1,132 @@
+package db
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrCodeMismatch is a wrong verification code that still leaves
+	// attempts on the current code.
+	ErrCodeMismatch = errors.New("verification code does not match")
+	// ErrTooManyAttempts means the current code is used up; only a new
+	// code can verify the address.
+	ErrTooManyAttempts = errors.New("too many verification attempts")
+)
+
+// verificationWindow is the period AllowVerificationEmail caps sends over,
+// matching the interval in its query.
+const verificationWindow = time.Hour
+
+// VerifyEmailCode verifies email with the code hashing to tokenHash. Codes
+// last 24 hours. Each wrong code uses up one of maxAttempts: the error is
+// ErrCodeMismatch with the attempts left, or ErrTooManyAttempts once none
+// are, after which even the right code fails. ErrNotFound means there is no
+// live code for email.
+func (s *Store) VerifyEmailCode(ctx context.Context, email, tokenHash string, maxAttempts int) (User, int, error) {
+	ctx, done := s.op(ctx, "VerifyEmailCode")
+	defer done()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return User{}, 0, err
+	}
+	defer tx.Rollback()
+
+	var userID uuid.UUID
+	var stored string
+	var attempts int
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, email_verification_token_hash, email_verification_attempts
+		FROM users
+		WHERE email = $1
+		  AND email_verification_token_hash IS NOT NULL
+		  AND email_verification_sent_at >= NOW() - INTERVAL '24 hours'
+		FOR UPDATE
+	`, email).Scan(&userID, &stored, &attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, 0, ErrNotFound
+	}
+	if err != nil {
+		return User{}, 0, err
+	}
+	if maxAttempts > 0 && attempts >= maxAttempts {
+		return User{}, 0, ErrTooManyAttempts
+	}
+
+	if subtle.ConstantTimeCompare([]byte(stored), []byte(tokenHash)) != 1 {
+		if _, err := tx.ExecContext(ctx, `UPDATE users SET email_verification_attempts = email_verification_attempts + 1 WHERE id = $1`, userID); err != nil {
+			return User{}, 0, err
+		}
+		if err := tx.Commit(); err != nil {
+			return User{}, 0, err
+		}
+		if maxAttempts <= 0 {
+			return User{}, 0, ErrCodeMismatch
+		}
+		if left := maxAttempts - attempts - 1; left > 0 {
+			return User{}, left, ErrCodeMismatch
+		}
+		return User{}, 0, ErrTooManyAttempts
+	}
+
+	var u User
+	err = tx.QueryRowContext(ctx, `
+		UPDATE users
+		SET email_verified = TRUE,
+		    email_verification_token_hash = NULL,
+		    email_verification_attempts = 0
+		WHERE id = $1
+		RETURNING id, email, username, COALESCE(avatar_url, ''), email_verified, password_hash, created_at
+	`, userID).Scan(&u.ID, &u.Email, &u.Username, &u.AvatarURL, &u.EmailVerified, &u.PasswordHash, &u.CreatedAt)
+	if err != nil {
+		return User{}, 0, err
+	}
+	return u, 0, tx.Commit()
+}
+
+// AllowVerificationEmail counts one verification email to userID against
+// perHour. When the cap is reached it returns false and how long until the
+// window ends; perHour <= 0 never caps.
+func (s *Store) AllowVerificationEmail(ctx context.Context, userID uuid.UUID, perHour int) (bool, time.Duration, error) {
+	ctx, done := s.op(ctx, "AllowVerificationEmail")
+	defer done()
+	if perHour <= 0 {
+		return true, 0, nil
+	}
+	res, err := s.DB.ExecContext(ctx, `
+		UPDATE users
+		SET email_verification_window_at = CASE WHEN email_verification_window_at IS NULL OR email_verification_window_at <= NOW() - INTERVAL '1 hour'
+		                                        THEN NOW() ELSE email_verification_window_at END,
+		    email_verification_sends = CASE WHEN email_verification_window_at IS NULL OR email_verification_window_at <= NOW() - INTERVAL '1 hour'
+		                                    THEN 1 ELSE email_verification_sends + 1 END
+		WHERE id = $1
+		  AND (email_verification_window_at IS NULL
+		       OR email_verification_window_at <= NOW() - INTERVAL '1 hour'
+		       OR email_verification_sends < $2)
+	`, userID, perHour)
+	if err != nil {
+		return false, 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, 0, err
+	}
+	if n == 1 {
+		return true, 0, nil
+	}
+
+	var windowAt sql.NullTime
+	err = s.DB.QueryRowContext(ctx, `SELECT email_verification_window_at FROM users WHERE id = $1`, userID).Scan(&windowAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, 0, ErrNotFound
+	}
+	if err != nil {
+		return false, 0, err
+	}
+	return false, max(time.Until(windowAt.Time.Add(verificationWindow)), time.Second), nil
+}
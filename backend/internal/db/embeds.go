@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RoomEmbed is a room's public read-only embed. The token itself is only
+// shown when it is created.
+type RoomEmbed struct {
+	RoomID    uuid.UUID  `json:"room_id"`
+	CreatedBy *uuid.UUID `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// EmbedRoom is what an embed shows about its room.
+type EmbedRoom struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	AvatarURL string    `json:"avatar_url,omitempty"`
+}
+
+// GetRoomEmbed returns roomID's embed, or ErrNotFound when embedding is
+// off.
+func (s *Store) GetRoomEmbed(ctx context.Context, roomID uuid.UUID) (RoomEmbed, error) {
+	ctx, done := s.op(ctx, "GetRoomEmbed")
+	defer done()
+	e := RoomEmbed{RoomID: roomID}
+	err := s.DB.QueryRowContext(ctx, `SELECT created_by, created_at FROM room_embeds WHERE room_id = $1`, roomID).Scan(&e.CreatedBy, &e.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return RoomEmbed{}, ErrNotFound
+	}
+	return e, err
+}
+
+// SetRoomEmbed turns embedding on for roomID under tokenHash, replacing
+// any earlier token.
+func (s *Store) SetRoomEmbed(ctx context.Context, roomID, createdBy uuid.UUID, tokenHash string) (RoomEmbed, error) {
+	ctx, done := s.op(ctx, "SetRoomEmbed")
+	defer done()
+	e := RoomEmbed{RoomID: roomID}
+	err := s.DB.QueryRowContext(ctx, `
+		INSERT INTO room_embeds (room_id, token_hash, created_by)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (room_id) DO UPDATE
+		SET token_hash = EXCLUDED.token_hash, created_by = EXCLUDED.created_by, created_at = NOW()
+		RETURNING created_by, created_at
+	`, roomID, tokenHash, createdBy).Scan(&e.CreatedBy, &e.CreatedAt)
+	return e, err
+}
+
+// DeleteRoomEmbed turns embedding off for roomID.
+func (s *Store) DeleteRoomEmbed(ctx context.Context, roomID uuid.UUID) error {
+	ctx, done := s.op(ctx, "DeleteRoomEmbed")
+	defer done()
+	return s.execOne(ctx, `DELETE FROM room_embeds WHERE room_id = $1`, roomID)
+}
+
+// FindEmbedRoom returns the room embedded under tokenHash.
+func (s *Store) FindEmbedRoom(ctx context.Context, tokenHash string) (EmbedRoom, error) {
+	ctx, done := s.op(ctx, "FindEmbedRoom")
+	defer done()
+	var r EmbedRoom
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT r.id, r.name, '' AS avatar_url
+		FROM room_embeds e
+		JOIN rooms r ON r.id = e.room_id
+		WHERE e.token_hash = $1
+	`, tokenHash).Scan(&r.ID, &r.Name, &r.AvatarURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return EmbedRoom{}, ErrNotFound
+	}
+	return r, err
+}
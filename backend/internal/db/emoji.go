@@ -0,0 +1,27 @@
+package db
+
+import (
+	"database/sql"
+
+	"talkie/backend/internal/emoji"
+)
+
+// SetEmojiShortcodes turns :shortcode: expansion of new messages on or off.
+// Messages already stored keep the text they were saved with.
+func (s *Store) SetEmojiShortcodes(on bool) {
+	s.shortcodes = on
+}
+
+// renderContent returns the text to store as a message's content and, when
+// expansion changed it, the text as typed for messages.content_raw, which
+// search indexes alongside the content.
+func (s *Store) renderContent(raw string) (string, sql.NullString) {
+	if !s.shortcodes {
+		return raw, sql.NullString{}
+	}
+	content := emoji.Expand(raw)
+	if content == raw {
+		return raw, sql.NullString{}
+	}
+	return content, sql.NullString{String: raw, Valid: true}
+}
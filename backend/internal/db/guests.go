@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) CreateGuestInviteLink(ctx context.Context, tokenHash string, roomID, createdBy uuid.UUID, guestDays int, expiresAt time.Time) error {
+	ctx, done := s.op(ctx, "CreateGuestInviteLink")
+	defer done()
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO guest_invite_links (token_hash, room_id, created_by, guest_days, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, tokenHash, roomID, createdBy, guestDays, expiresAt)
+	return err
+}
+
+// CreateGuestFromInvite creates a guest account for a valid guest link and
+// adds it to the link's room, returning the user and room.
+func (s *Store) CreateGuestFromInvite(ctx context.Context, tokenHash, email, username, passwordHash string) (User, uuid.UUID, error) {
+	ctx, done := s.op(ctx, "CreateGuestFromInvite")
+	defer done()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return User{}, uuid.Nil, err
+	}
+	defer tx.Rollback()
+
+	var roomID, createdBy uuid.UUID
+	var guestDays int
+	err = tx.QueryRowContext(ctx, `
+		SELECT room_id, created_by, guest_days FROM guest_invite_links
+		WHERE token_hash = $1 AND expires_at > NOW()
+	`, tokenHash).Scan(&roomID, &createdBy, &guestDays)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, uuid.Nil, ErrNotFound
+	}
+	if err != nil {
+		return User{}, uuid.Nil, err
+	}
+
+	var u User
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO users (email, username, password_hash, email_verified, guest_expires_at)
+		VALUES ($1, $2, $3, FALSE, NOW() + make_interval(days => $4))
+		RETURNING id, email, username, COALESCE(avatar_url, ''), email_verified, session_version, guest_expires_at, created_at
+	`, email, username, passwordHash, guestDays).
+		Scan(&u.ID, &u.Email, &u.Username, &u.AvatarURL, &u.EmailVerified, &u.SessionVersion, &u.GuestExpiresAt, &u.CreatedAt)
+	if err != nil {
+		return User{}, uuid.Nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO room_members (room_id, user_id, role, last_read_message_id)
+		VALUES ($1, $2, 'member', (SELECT MAX(id) FROM messages WHERE room_id = $1))
+	`, roomID, u.ID); err != nil {
+		return User{}, uuid.Nil, err
+	}
+	if err := insertMembershipEvent(ctx, tx, MembershipEvent{
+		RoomID: roomID, UserID: u.ID, ActorID: &createdBy, Action: MembershipJoined, Via: ViaGuestLink, InviteLinkID: tokenHash,
+	}); err != nil {
+		return User{}, uuid.Nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return User{}, uuid.Nil, err
+	}
+	return u, roomID, nil
+}
+
+// DeleteExpiredGuests removes guest accounts past their expiry, with their
+// memberships and messages. Guests whose content is under a legal hold are
+// kept until it is released.
+func (s *Store) DeleteExpiredGuests(ctx context.Context) (int64, error) {
+	ctx, done := s.op(ctx, "DeleteExpiredGuests")
+	defer done()
+	res, err := s.DB.ExecContext(ctx, `
+		DELETE FROM users
+		WHERE guest_expires_at IS NOT NULL AND guest_expires_at <= NOW()
+		  AND NOT legal_hold_blocks_user(id)
+	`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
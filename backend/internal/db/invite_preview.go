@@ -0,0 +1,64 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// InvitePreview is what an invite link leads to, for the page shown before
+// someone signs in to accept it. Kind is "room" or "group". Unlisted rooms
+// ask for their name and size to stay hidden; the caller enforces that.
+type InvitePreview struct {
+	Kind        string
+	Name        string
+	AvatarURL   string
+	MemberCount int
+	Unlisted    bool
+}
+
+// GetInvitePreview describes the target of an unexpired room or workspace
+// invite link. A workspace counts everyone in any of its channels.
+func (s *Store) GetInvitePreview(ctx context.Context, tokenHash string) (InvitePreview, error) {
+	ctx, done := s.op(ctx, "GetInvitePreview")
+	defer done()
+	var p InvitePreview
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT CASE WHEN l.group_id IS NOT NULL THEN 'group' ELSE 'room' END,
+		       COALESCE(g.name, r.name), '' AS avatar_url, COALESCE(r.unlisted, FALSE),
+		       CASE WHEN l.group_id IS NOT NULL
+		            THEN (SELECT COUNT(DISTINCT rm.user_id) FROM group_channels gc
+		                  JOIN room_members rm ON rm.room_id = gc.room_id
+		                  WHERE gc.group_id = l.group_id)
+		            ELSE (SELECT COUNT(*) FROM room_members rm WHERE rm.room_id = l.room_id)
+		       END
+		FROM room_invite_links l
+		LEFT JOIN rooms r ON r.id = l.room_id
+		LEFT JOIN room_groups g ON g.id = l.group_id
+		WHERE l.token_hash = $1 AND l.expires_at > NOW()
+		  AND (r.id IS NOT NULL OR g.id IS NOT NULL)
+	`, tokenHash).Scan(&p.Kind, &p.Name, &p.AvatarURL, &p.Unlisted, &p.MemberCount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return InvitePreview{}, ErrNotFound
+	}
+	return p, err
+}
+
+func (s *Store) GetRoomUnlisted(ctx context.Context, roomID uuid.UUID) (bool, error) {
+	ctx, done := s.op(ctx, "GetRoomUnlisted")
+	defer done()
+	var on bool
+	err := s.DB.QueryRowContext(ctx, `SELECT unlisted FROM rooms WHERE id = $1`, roomID).Scan(&on)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrNotFound
+	}
+	return on, err
+}
+
+func (s *Store) SetRoomUnlisted(ctx context.Context, roomID uuid.UUID, on bool) error {
+	ctx, done := s.op(ctx, "SetRoomUnlisted")
+	defer done()
+	return s.execOne(ctx, `UPDATE rooms SET unlisted = $2 WHERE id = $1`, roomID, on)
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// InviteLinkStats is an invite link that leads into a room and what it
+// brought in. Joins counts each member once however many of a group's
+// channels they joined; Pending counts requests still held by raid mode.
+type InviteLinkStats struct {
+	// ID is the link's token hash, as in the membership log.
+	ID              string     `json:"id"`
+	Kind            string     `json:"kind"` // room, group or guest
+	CreatedBy       uuid.UUID  `json:"created_by"`
+	CreatorUsername string     `json:"creator_username"`
+	CreatedAt       time.Time  `json:"created_at"`
+	ExpiresAt       time.Time  `json:"expires_at"`
+	Joins           int        `json:"joins"`
+	Pending         int        `json:"pending"`
+	FirstJoinAt     *time.Time `json:"first_join_at,omitempty"`
+	LastJoinAt      *time.Time `json:"last_join_at,omitempty"`
+}
+
+// ListInviteLinkStats returns every link into roomID, expired ones
+// included, newest first: the room's own links, its group's links and its
+// guest links.
+func (s *Store) ListInviteLinkStats(ctx context.Context, roomID uuid.UUID) ([]InviteLinkStats, error) {
+	ctx, done := s.op(ctx, "ListInviteLinkStats")
+	defer done()
+	rows, err := s.DB.QueryContext(ctx, `
+		WITH links AS (
+			SELECT token_hash, CASE WHEN room_id IS NULL THEN 'group' ELSE 'room' END AS kind, created_by, created_at, expires_at
+			FROM room_invite_links
+			WHERE room_id = $1 OR group_id = (SELECT group_id FROM group_channels WHERE room_id = $1)
+			UNION ALL
+			SELECT token_hash, 'guest', created_by, created_at, expires_at
+			FROM guest_invite_links
+			WHERE room_id = $1
+		)
+		SELECT l.token_hash, l.kind, l.created_by, COALESCE(u.username, ''), l.created_at, l.expires_at,
+		       j.joins, j.first_join, j.last_join, p.pending
+		FROM links l
+		LEFT JOIN users u ON u.id = l.created_by
+		CROSS JOIN LATERAL (
+			SELECT COUNT(DISTINCT e.user_id) AS joins, MIN(e.created_at) AS first_join, MAX(e.created_at) AS last_join
+			FROM room_membership_events e
+			WHERE e.invite_link = l.token_hash AND e.action = 'joined'
+		) j
+		CROSS JOIN LATERAL (
+			SELECT COUNT(*) AS pending FROM room_join_requests jr WHERE jr.invite_link = l.token_hash
+		) p
+		ORDER BY l.created_at DESC, l.token_hash
+	`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []InviteLinkStats{}
+	for rows.Next() {
+		var st InviteLinkStats
+		var first, last sql.NullTime
+		if err := rows.Scan(&st.ID, &st.Kind, &st.CreatedBy, &st.CreatorUsername, &st.CreatedAt, &st.ExpiresAt, &st.Joins, &first, &last, &st.Pending); err != nil {
+			return nil, err
+		}
+		if first.Valid {
+			st.FirstJoinAt, st.LastJoinAt = &first.Time, &last.Time
+		}
+		out = append(out, st)
+	}
+	return out, rows.Err()
+}
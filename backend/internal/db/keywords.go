@@ -0,0 +1,140 @@
+package db
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// KeywordWatch is a keyword a member of RoomID watches for.
+type KeywordWatch struct {
+	RoomID  uuid.UUID
+	UserID  uuid.UUID
+	Keyword string
+}
+
+// KeywordMatch is a message that matched a member's keyword.
+type KeywordMatch struct {
+	MessageID int64
+	RoomID    uuid.UUID
+	UserID    uuid.UUID
+	Keyword   string
+}
+
+// GetUserKeywords returns userID's watched keywords in the order they were
+// added.
+func (s *Store) GetUserKeywords(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	ctx, done := s.op(ctx, "GetUserKeywords")
+	defer done()
+	rows, err := s.DB.QueryContext(ctx, `SELECT keyword FROM user_keywords WHERE user_id = $1 ORDER BY created_at, keyword`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keywords := []string{}
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			return nil, err
+		}
+		keywords = append(keywords, k)
+	}
+	return keywords, rows.Err()
+}
+
+// SetUserKeywords replaces userID's watched keywords. Keywords are expected
+// lowercased and distinct.
+func (s *Store) SetUserKeywords(ctx context.Context, userID uuid.UUID, keywords []string) error {
+	ctx, done := s.op(ctx, "SetUserKeywords")
+	defer done()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_keywords WHERE user_id = $1 AND NOT (keyword = ANY($2::text[]))`, userID, keywords); err != nil {
+		return err
+	}
+	for _, k := range keywords {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO user_keywords (user_id, keyword) VALUES ($1, $2) ON CONFLICT DO NOTHING
+		`, userID, k); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListRoomKeywords returns the keywords watched by members of roomIDs.
+func (s *Store) ListRoomKeywords(ctx context.Context, roomIDs []uuid.UUID) ([]KeywordWatch, error) {
+	ctx, done := s.op(ctx, "ListRoomKeywords")
+	defer done()
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT rm.room_id, k.user_id, k.keyword
+		FROM room_members rm
+		JOIN user_keywords k ON k.user_id = rm.user_id
+		WHERE rm.room_id = ANY($1::uuid[])
+	`, uuidStrings(roomIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []KeywordWatch
+	for rows.Next() {
+		var w KeywordWatch
+		if err := rows.Scan(&w.RoomID, &w.UserID, &w.Keyword); err != nil {
+			return nil, err
+		}
+		out = append(out, w)
+	}
+	return out, rows.Err()
+}
+
+// ListMessageTexts returns the id, room, author and content of the messages
+// in [fromID, toID] that are not shadowed, for matching against keywords.
+func (s *Store) ListMessageTexts(ctx context.Context, fromID, toID int64) ([]Message, error) {
+	ctx, done := s.op(ctx, "ListMessageTexts")
+	defer done()
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, room_id, user_id, content
+		FROM messages
+		WHERE id BETWEEN $1 AND $2 AND NOT shadowed AND content <> ''
+		ORDER BY id
+	`, fromID, toID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Message
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.RoomID, &m.UserID, contentColumn{&m}); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// RecordKeywordMatches adds matches to the mentions inbox. A message that
+// already mentions the user by name keeps that mention.
+func (s *Store) RecordKeywordMatches(ctx context.Context, matches []KeywordMatch) error {
+	ctx, done := s.op(ctx, "RecordKeywordMatches")
+	defer done()
+	if len(matches) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(matches))
+	rooms := make([]uuid.UUID, len(matches))
+	users := make([]uuid.UUID, len(matches))
+	keywords := make([]string, len(matches))
+	for i, m := range matches {
+		ids[i], rooms[i], users[i], keywords[i] = m.MessageID, m.RoomID, m.UserID, m.Keyword
+	}
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO message_mentions (message_id, room_id, user_id, keyword)
+		SELECT * FROM unnest($1::bigint[], $2::uuid[], $3::uuid[], $4::text[])
+		ON CONFLICT DO NOTHING
+	`, ids, uuidStrings(rooms), uuidStrings(users), keywords)
+	return err
+}
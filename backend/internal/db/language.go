@@ -0,0 +1,54 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"talkie/backend/internal/langdetect"
+
+	"github.com/google/uuid"
+)
+
+// contentColumn scans messages.content into a message and fills in the
+// language and direction detected from it. Detection is cheap and
+// deterministic, so it is not stored and old messages get it too.
+type contentColumn struct {
+	m *Message
+}
+
+func (c contentColumn) Scan(src any) error {
+	switch v := src.(type) {
+	case string:
+		c.m.Content = v
+	case []byte:
+		c.m.Content = string(v)
+	default:
+		return fmt.Errorf("content column: unexpected %T", src)
+	}
+	c.m.Lang = langdetect.Detect(c.m.Content)
+	c.m.Dir = langdetect.Direction(c.m.Lang)
+	return nil
+}
+
+// GetRoomLanguage returns the language a room admin set for the room, or ""
+// when it is left to detection.
+func (s *Store) GetRoomLanguage(ctx context.Context, roomID uuid.UUID) (string, error) {
+	ctx, done := s.op(ctx, "GetRoomLanguage")
+	defer done()
+	var lang string
+	err := s.DB.QueryRowContext(ctx, `SELECT language FROM rooms WHERE id = $1`, roomID).Scan(&lang)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return lang, err
+}
+
+// SetRoomLanguage sets the room's language; "" goes back to detecting it
+// from recent messages.
+func (s *Store) SetRoomLanguage(ctx context.Context, roomID uuid.UUID, lang string) error {
+	ctx, done := s.op(ctx, "SetRoomLanguage")
+	defer done()
+	return s.execOne(ctx, `UPDATE rooms SET language = $2 WHERE id = $1`, roomID, lang)
+}
@@ -0,0 +1,40 @@
+package db
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// ListLastMessages returns the newest message of each room, keyed by room,
+// as recorded in viewerID's room summaries. Shadowed messages only count as
+// the latest for their own author. Rooms viewerID is not in are left out.
+func (s *Store) ListLastMessages(ctx context.Context, viewerID uuid.UUID, roomIDs []uuid.UUID) (map[uuid.UUID]Message, error) {
+	ctx, done := s.op(ctx, "ListLastMessages")
+	defer done()
+	out := make(map[uuid.UUID]Message, len(roomIDs))
+	if len(roomIDs) == 0 {
+		return out, nil
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT m.id, m.room_id, m.user_id, u.username, COALESCE(u.avatar_url, ''), m.content, m.message_type, COALESCE(m.media_url, ''), m.created_at, m.client_sent_at, m.shadowed, m.nsfw, m.audio::text, m.components::text, m.contact::text, COALESCE(m.alt_text, ''), m.alt_text_generated
+		FROM room_summaries rs
+		JOIN messages m ON m.id = rs.last_message_id
+		JOIN users u ON u.id = m.user_id
+		WHERE rs.room_id = ANY($1::uuid[])
+		  AND rs.user_id = $2
+	`, uuidStrings(roomIDs), viewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.RoomID, &m.UserID, &m.Username, &m.AvatarURL, contentColumn{&m}, &m.MessageType, &m.MediaURL, &m.CreatedAt, &m.ClientSentAt, &m.Shadowed, &m.NSFW, audioColumn{&m.Audio}, componentsColumn{&m.Components}, contactColumn{&m.Contact}, &m.AltText, &m.AltTextGenerated); err != nil {
+			return nil, err
+		}
+		out[m.RoomID] = m
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// ErrLDAPConflict means a directory entry's email belongs to an account it
+// cannot sign in as: a bot, a guest, or one linked to another entry.
+var ErrLDAPConflict = errors.New("email belongs to another account")
+
+// SyncLDAPUser returns the account for the directory entry ldapID, saving
+// its dn and email. The first sign-in of an entry takes over the account
+// with its email, or creates one named username. Either way the account's
+// password is cleared and its email marked verified: the directory checks
+// the one and vouches for the other. ErrUserExists means username is
+// taken.
+func (s *Store) SyncLDAPUser(ctx context.Context, ldapID, dn, email, username string) (uuid.UUID, error) {
+	ctx, done := s.op(ctx, "SyncLDAPUser")
+	defer done()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+
+	var userID uuid.UUID
+	err = tx.QueryRowContext(ctx, `
+		SELECT user_id FROM ldap_identities WHERE ldap_id = $1 FOR UPDATE
+	`, ldapID).Scan(&userID)
+	switch {
+	case err == nil:
+		var taken bool
+		if err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS (SELECT 1 FROM users WHERE email = $1 AND id <> $2)
+		`, email, userID).Scan(&taken); err != nil {
+			return uuid.Nil, err
+		}
+		if taken {
+			return uuid.Nil, ErrLDAPConflict
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE ldap_identities SET dn = $2, synced_at = NOW() WHERE ldap_id = $1
+		`, ldapID, dn); err != nil {
+			return uuid.Nil, err
+		}
+	case !errors.Is(err, sql.ErrNoRows):
+		return uuid.Nil, err
+	default:
+		var adoptable bool
+		err = tx.QueryRowContext(ctx, `
+			SELECT id, NOT is_bot AND guest_expires_at IS NULL
+			  AND NOT EXISTS (SELECT 1 FROM ldap_identities li WHERE li.user_id = users.id)
+			FROM users WHERE email = $1 FOR UPDATE
+		`, email).Scan(&userID, &adoptable)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			err = tx.QueryRowContext(ctx, `
+				INSERT INTO users (email, username, password_hash, email_verified)
+				VALUES ($1, $2, '', TRUE)
+				ON CONFLICT DO NOTHING
+				RETURNING id
+			`, email, username).Scan(&userID)
+			if errors.Is(err, sql.ErrNoRows) {
+				return uuid.Nil, ErrUserExists
+			}
+			if err != nil {
+				return uuid.Nil, err
+			}
+		case err != nil:
+			return uuid.Nil, err
+		case !adoptable:
+			return uuid.Nil, ErrLDAPConflict
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO ldap_identities (ldap_id, user_id, dn) VALUES ($1, $2, $3)
+		`, ldapID, userID, dn); err != nil {
+			return uuid.Nil, err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE users SET email = $2, email_verified = TRUE, password_hash = '' WHERE id = $1
+	`, userID, email); err != nil {
+		return uuid.Nil, err
+	}
+	return userID, tx.Commit()
+}
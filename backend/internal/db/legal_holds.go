@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrHoldExists is returned when the user or room is already under an
+// active legal hold.
+var ErrHoldExists = errors.New("legal hold already active")
+
+// ErrLegalHold is returned for deletions that would remove content under
+// an active legal hold.
+var ErrLegalHold = errors.New("content is under legal hold")
+
+// LegalHold keeps a user's messages, or a room with its messages, from
+// being deleted by retention purges or anyone else while it is active.
+// Exactly one of UserID and RoomID is set. Released holds are kept as the
+// record of who placed and lifted them.
+type LegalHold struct {
+	ID          int64      `json:"id"`
+	UserID      *uuid.UUID `json:"user_id,omitempty"`
+	RoomID      *uuid.UUID `json:"room_id,omitempty"`
+	Reason      string     `json:"reason"`
+	PlacedBy    uuid.UUID  `json:"placed_by"`
+	PlacedAt    time.Time  `json:"placed_at"`
+	ReleasedBy  *uuid.UUID `json:"released_by,omitempty"`
+	ReleasedAt  *time.Time `json:"released_at,omitempty"`
+	ReleaseNote string     `json:"release_note,omitempty"`
+}
+
+const legalHoldColumns = `id, user_id, room_id, reason, placed_by, placed_at, released_by, released_at, release_note`
+
+func scanLegalHold(row interface{ Scan(...any) error }) (LegalHold, error) {
+	var h LegalHold
+	err := row.Scan(&h.ID, &h.UserID, &h.RoomID, &h.Reason, &h.PlacedBy, &h.PlacedAt, &h.ReleasedBy, &h.ReleasedAt, &h.ReleaseNote)
+	return h, err
+}
+
+// ListLegalHolds returns the active holds, newest first, and released ones
+// too when all is set.
+func (s *Store) ListLegalHolds(ctx context.Context, all bool) ([]LegalHold, error) {
+	ctx, done := s.op(ctx, "ListLegalHolds")
+	defer done()
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT `+legalHoldColumns+`
+		FROM legal_holds
+		WHERE $1 OR released_at IS NULL
+		ORDER BY placed_at DESC, id DESC
+	`, all)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	holds := []LegalHold{}
+	for rows.Next() {
+		h, err := scanLegalHold(rows)
+		if err != nil {
+			return nil, err
+		}
+		holds = append(holds, h)
+	}
+	return holds, rows.Err()
+}
+
+// PlaceLegalHold puts h's user or room under hold, or returns
+// ErrHoldExists when it already is.
+func (s *Store) PlaceLegalHold(ctx context.Context, h LegalHold) (LegalHold, error) {
+	ctx, done := s.op(ctx, "PlaceLegalHold")
+	defer done()
+	held, err := scanLegalHold(s.DB.QueryRowContext(ctx, `
+		INSERT INTO legal_holds (user_id, room_id, reason, placed_by)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING
+		RETURNING `+legalHoldColumns,
+		h.UserID, h.RoomID, h.Reason, h.PlacedBy))
+	if errors.Is(err, sql.ErrNoRows) {
+		return LegalHold{}, ErrHoldExists
+	}
+	return held, err
+}
+
+// ReleaseLegalHold lifts an active hold, recording who did and why.
+func (s *Store) ReleaseLegalHold(ctx context.Context, holdID int64, releasedBy uuid.UUID, note string) (LegalHold, error) {
+	ctx, done := s.op(ctx, "ReleaseLegalHold")
+	defer done()
+	h, err := scanLegalHold(s.DB.QueryRowContext(ctx, `
+		UPDATE legal_holds
+		SET released_by = $2, released_at = NOW(), release_note = $3
+		WHERE id = $1 AND released_at IS NULL
+		RETURNING `+legalHoldColumns,
+		holdID, releasedBy, note))
+	if errors.Is(err, sql.ErrNoRows) {
+		return LegalHold{}, ErrNotFound
+	}
+	return h, err
+}
+
+// RoomUnderLegalHold reports whether deleting roomID would remove held
+// content: the room is held, or it has messages by a held user.
+func (s *Store) RoomUnderLegalHold(ctx context.Context, roomID uuid.UUID) (bool, error) {
+	ctx, done := s.op(ctx, "RoomUnderLegalHold")
+	defer done()
+	var held bool
+	err := s.DB.QueryRowContext(ctx, `SELECT legal_hold_blocks_room($1)`, roomID).Scan(&held)
+	return held, err
+}
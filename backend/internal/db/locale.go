@@ -0,0 +1,32 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// UserLocale is where and how a user reads times and dates.
+type UserLocale struct {
+	Timezone string `json:"timezone,omitempty"`
+	Locale   string `json:"locale,omitempty"`
+}
+
+func (s *Store) GetUserLocale(ctx context.Context, userID uuid.UUID) (UserLocale, error) {
+	ctx, done := s.op(ctx, "GetUserLocale")
+	defer done()
+	var l UserLocale
+	err := s.DB.QueryRowContext(ctx, `SELECT timezone, locale FROM users WHERE id = $1`, userID).Scan(&l.Timezone, &l.Locale)
+	if errors.Is(err, sql.ErrNoRows) {
+		return UserLocale{}, ErrNotFound
+	}
+	return l, err
+}
+
+func (s *Store) SetUserLocale(ctx context.Context, userID uuid.UUID, l UserLocale) error {
+	ctx, done := s.op(ctx, "SetUserLocale")
+	defer done()
+	return s.execOne(ctx, `UPDATE users SET timezone = $2, locale = $3 WHERE id = $1`, userID, l.Timezone, l.Locale)
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type LoginEvent struct {
+	ID        int64     `json:"id"`
+	IP        string    `json:"ip"`
+	Country   string    `json:"country,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LoginNovelty says how a login compares with the user's earlier ones.
+// First is set for the very first recorded login, when nothing is "new".
+type LoginNovelty struct {
+	First      bool
+	NewCountry bool
+	NewDevice  bool
+}
+
+// RecordLogin stores a successful login and reports whether its country or
+// device has been seen for this user before. An empty country (private
+// address or no geo database) never counts as new.
+func (s *Store) RecordLogin(ctx context.Context, userID uuid.UUID, ip, country, deviceHash, userAgent string) (LoginNovelty, error) {
+	ctx, done := s.op(ctx, "RecordLogin")
+	defer done()
+	var n LoginNovelty
+	var total, sameCountry, sameDevice int
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT COUNT(*),
+		       COUNT(*) FILTER (WHERE country = $2),
+		       COUNT(*) FILTER (WHERE device_hash = $3)
+		FROM login_events
+		WHERE user_id = $1
+	`, userID, country, deviceHash).Scan(&total, &sameCountry, &sameDevice)
+	if err != nil {
+		return n, err
+	}
+	_, err = s.DB.ExecContext(ctx, `
+		INSERT INTO login_events (user_id, ip, country, device_hash, user_agent)
+		VALUES ($1, $2, $3, $4, $5)
+	`, userID, ip, country, deviceHash, userAgent)
+	if err != nil {
+		return n, err
+	}
+	n.First = total == 0
+	n.NewCountry = !n.First && country != "" && sameCountry == 0
+	n.NewDevice = !n.First && sameDevice == 0
+	return n, nil
+}
+
+func (s *Store) ListLoginEvents(ctx context.Context, userID uuid.UUID, limit int) ([]LoginEvent, error) {
+	ctx, done := s.op(ctx, "ListLoginEvents")
+	defer done()
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, ip, country, user_agent, created_at
+		FROM login_events
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]LoginEvent, 0)
+	for rows.Next() {
+		var e LoginEvent
+		if err := rows.Scan(&e.ID, &e.IP, &e.Country, &e.UserAgent, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// DeleteExpiredLinks removes invite, guest and device link codes that can no
+// longer be redeemed, and direct uploads that were never completed.
+func (s *Store) DeleteExpiredLinks(ctx context.Context) (int64, error) {
+	ctx, done := s.op(ctx, "DeleteExpiredLinks")
+	defer done()
+	var total int64
+	for _, table := range []string{"room_invite_links", "friend_invite_links", "guest_invite_links", "device_links", "direct_uploads"} {
+		res, err := s.DB.ExecContext(ctx, `DELETE FROM `+table+` WHERE expires_at < NOW()`)
+		if err != nil {
+			return total, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// ClearExpiredTokens drops email verification and password reset tokens
+// past the windows the handlers accept them in.
+func (s *Store) ClearExpiredTokens(ctx context.Context) (int64, error) {
+	ctx, done := s.op(ctx, "ClearExpiredTokens")
+	defer done()
+	var total int64
+	for _, query := range []string{`
+		UPDATE users
+		SET email_verification_token_hash = NULL, email_verification_sent_at = NULL
+		WHERE email_verification_token_hash IS NOT NULL
+		  AND (email_verification_sent_at IS NULL OR email_verification_sent_at < NOW() - INTERVAL '24 hours')
+	`, `
+		UPDATE users
+		SET password_reset_token_hash = NULL, password_reset_sent_at = NULL, password_reset_used_at = NULL
+		WHERE password_reset_token_hash IS NOT NULL
+		  AND (password_reset_sent_at IS NULL OR password_reset_sent_at < NOW() - INTERVAL '2 hours')
+	`} {
+		res, err := s.DB.ExecContext(ctx, query)
+		if err != nil {
+			return total, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// PurgeSoftDeleted removes rows that were only kept around after being
+// dismissed: cancelled or abandoned email changes and read notifications
+// older than retention.
+func (s *Store) PurgeSoftDeleted(ctx context.Context, retention time.Duration) (int64, error) {
+	ctx, done := s.op(ctx, "PurgeSoftDeleted")
+	defer done()
+	res, err := s.DB.ExecContext(ctx, `
+		DELETE FROM email_changes
+		WHERE (cancelled_at IS NOT NULL AND cancelled_at < NOW() - make_interval(secs => $1))
+		   OR (verified_at IS NULL AND cancelled_at IS NULL AND created_at < NOW() - make_interval(secs => $2))
+	`, retention.Seconds(), EmailChangeRollbackWindow.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	changes, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	res, err = s.DB.ExecContext(ctx, `
+		DELETE FROM notifications
+		WHERE read_at IS NOT NULL AND read_at < NOW() - make_interval(secs => $1)
+	`, retention.Seconds())
+	if err != nil {
+		return changes, err
+	}
+	notifications, err := res.RowsAffected()
+	return changes + notifications, err
+}
+
+// RefreshRollups recomputes the counters the worker maintains incrementally
+// (per-member unread counts, each room's latest message and room summaries)
+// for every room, correcting any drift.
+func (s *Store) RefreshRollups(ctx context.Context) (int64, error) {
+	ctx, done := s.op(ctx, "RefreshRollups")
+	defer done()
+	res, err := s.DB.ExecContext(ctx, `
+		UPDATE room_members rm
+		SET unread_count = counts.n
+		FROM (
+			SELECT rm2.room_id, rm2.user_id, COUNT(m.id) AS n
+			FROM room_members rm2
+			LEFT JOIN messages m
+			  ON m.room_id = rm2.room_id
+			 AND m.id > COALESCE(rm2.last_read_message_id, 0)
+			 AND m.user_id <> rm2.user_id
+			 AND NOT m.shadowed
+			GROUP BY rm2.room_id, rm2.user_id
+		) counts
+		WHERE rm.room_id = counts.room_id AND rm.user_id = counts.user_id
+		  AND rm.unread_count <> counts.n
+	`)
+	if err != nil {
+		return 0, err
+	}
+	members, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	res, err = s.DB.ExecContext(ctx, `
+		UPDATE rooms r
+		SET last_message_id = latest.id,
+		    last_message_at = latest.created_at
+		FROM (
+			SELECT DISTINCT ON (room_id) room_id, id, created_at
+			FROM messages
+			WHERE NOT shadowed
+			ORDER BY room_id, id DESC
+		) latest
+		WHERE r.id = latest.room_id
+		  AND r.last_message_id IS DISTINCT FROM latest.id
+	`)
+	if err != nil {
+		return members, err
+	}
+	rooms, err := res.RowsAffected()
+	if err != nil {
+		return members + rooms, err
+	}
+	res, err = s.DB.ExecContext(ctx, refreshRoomSummariesSQL(`TRUE`))
+	if err != nil {
+		return members + rooms, err
+	}
+	summaries, err := res.RowsAffected()
+	return members + rooms + summaries, err
+}
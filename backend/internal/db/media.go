@@ -0,0 +1,44 @@
+package db
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// MediaMessageTypes are the message types that carry an upload.
+var MediaMessageTypes = []string{"image", "file", "audio"}
+
+// ListRoomMedia pages through a room's media messages of the given types,
+// newest first, starting below beforeID (0 for the newest page).
+func (s *Store) ListRoomMedia(ctx context.Context, roomID uuid.UUID, types []string, beforeID int64, limit int) ([]Message, error) {
+	ctx, done := s.op(ctx, "ListRoomMedia")
+	defer done()
+	if limit <= 0 || limit > 200 {
+		limit = 30
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT m.id, m.room_id, m.user_id, u.username, COALESCE(u.avatar_url, ''), m.content, m.message_type, COALESCE(m.media_url, ''), m.created_at, m.client_sent_at, m.shadowed, m.nsfw, m.audio::text, m.components::text, m.contact::text, COALESCE(m.alt_text, ''), m.alt_text_generated
+		FROM messages m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.room_id = $1
+		  AND m.message_type = ANY($2::text[])
+		  AND ($3 = 0 OR m.id < $3)
+		ORDER BY m.id DESC
+		LIMIT $4
+	`, roomID, types, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []Message{}
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.RoomID, &m.UserID, &m.Username, &m.AvatarURL, contentColumn{&m}, &m.MessageType, &m.MediaURL, &m.CreatedAt, &m.ClientSentAt, &m.Shadowed, &m.NSFW, audioColumn{&m.Audio}, componentsColumn{&m.Components}, contactColumn{&m.Contact}, &m.AltText, &m.AltTextGenerated); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
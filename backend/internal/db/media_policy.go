@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// MediaPolicy limits which media types may be uploaded. Entries are MIME
+// types, like image/gif, or whole top-level types, like image/*. An empty
+// Allowed allows every type that is not Blocked.
+type MediaPolicy struct {
+	Allowed []string `json:"allowed"`
+	Blocked []string `json:"blocked"`
+}
+
+// Allows reports whether contentType may be uploaded under p.
+func (p MediaPolicy) Allows(contentType string) bool {
+	if matchesMediaType(p.Blocked, contentType) {
+		return false
+	}
+	return len(p.Allowed) == 0 || matchesMediaType(p.Allowed, contentType)
+}
+
+func matchesMediaType(patterns []string, contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	for _, p := range patterns {
+		if p == contentType {
+			return true
+		}
+		if top, ok := strings.CutSuffix(p, "/*"); ok && strings.HasPrefix(contentType, top+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeMediaType lowercases a MIME type or type/* pattern and reports
+// whether it is one.
+func NormalizeMediaType(pattern string) (string, bool) {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	top, sub, ok := strings.Cut(pattern, "/")
+	if !ok || !mediaTypeToken(top) || (sub != "*" && !mediaTypeToken(sub)) {
+		return "", false
+	}
+	return pattern, true
+}
+
+func mediaTypeToken(s string) bool {
+	if s == "" || len(s) > 127 {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || strings.ContainsRune("!#$&-^_.+", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Store) GetRoomMediaPolicy(ctx context.Context, roomID uuid.UUID) (MediaPolicy, error) {
+	ctx, done := s.op(ctx, "GetRoomMediaPolicy")
+	defer done()
+	var allowed, blocked string
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT array_to_string(media_allowed, ','), array_to_string(media_blocked, ',')
+		FROM rooms WHERE id = $1
+	`, roomID).Scan(&allowed, &blocked)
+	if errors.Is(err, sql.ErrNoRows) {
+		return MediaPolicy{}, ErrNotFound
+	}
+	if err != nil {
+		return MediaPolicy{}, err
+	}
+	p := MediaPolicy{Allowed: []string{}, Blocked: []string{}}
+	if allowed != "" {
+		p.Allowed = strings.Split(allowed, ",")
+	}
+	if blocked != "" {
+		p.Blocked = strings.Split(blocked, ",")
+	}
+	return p, nil
+}
+
+func (s *Store) SetRoomMediaPolicy(ctx context.Context, roomID uuid.UUID, p MediaPolicy) error {
+	ctx, done := s.op(ctx, "SetRoomMediaPolicy")
+	defer done()
+	if p.Allowed == nil {
+		p.Allowed = []string{}
+	}
+	if p.Blocked == nil {
+		p.Blocked = []string{}
+	}
+	return s.execOne(ctx, `UPDATE rooms SET media_allowed = $2::text[], media_blocked = $3::text[] WHERE id = $1`, roomID, p.Allowed, p.Blocked)
+}
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Membership log actions.
+const (
+	MembershipJoined = "joined"
+	MembershipLeft   = "left"
+)
+
+// How a membership change came about.
+const (
+	ViaInvite      = "invite"       // a member added them directly
+	ViaInviteLink  = "invite_link"  // they opened a room or group invite link
+	ViaJoinRequest = "join_request" // an admin approved their request
+	ViaGuestLink   = "guest_link"   // they joined as a guest
+	ViaLeave       = "leave"        // they left on their own
+	ViaClone       = "clone"        // copied over when an admin cloned a room
+	ViaSSO         = "sso"          // signed in through the workspace's identity provider
+	ViaSCIM        = "scim"         // their identity provider groups put them in or took them out
+)
+
+// MembershipEvent is one entry of a room's membership log. ActorID is who
+// let the member in: the inviter, the creator of the link used or the
+// admin who approved the request. It is nil for leaves and once the actor's
+// account is deleted.
+type MembershipEvent struct {
+	ID            int64      `json:"id"`
+	RoomID        uuid.UUID  `json:"room_id"`
+	UserID        uuid.UUID  `json:"user_id"`
+	Username      string     `json:"username"`
+	ActorID       *uuid.UUID `json:"actor_id,omitempty"`
+	ActorUsername string     `json:"actor_username,omitempty"`
+	Action        string     `json:"action"`
+	Via           string     `json:"via"`
+	// InviteLinkID identifies the link used by its token hash, never the
+	// token itself.
+	InviteLinkID string    `json:"invite_link_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// insertMembershipEvent skips rooms that are gone, such as one deleted when
+// its last member left.
+func insertMembershipEvent(ctx context.Context, q execer, ev MembershipEvent) error {
+	_, err := q.ExecContext(ctx, `
+		INSERT INTO room_membership_events (room_id, user_id, actor_id, action, via, invite_link)
+		SELECT $1::uuid, $2::uuid, $3::uuid, $4, $5, $6
+		WHERE EXISTS (SELECT 1 FROM rooms WHERE id = $1)
+	`, ev.RoomID, ev.UserID, ev.ActorID, ev.Action, ev.Via, nullableString(ev.InviteLinkID))
+	return err
+}
+
+// joinRoomByLink adds userID to roomID like JoinRoom and, when that made
+// them a member, logs the join against the link in the same statement.
+func (s *Store) joinRoomByLink(ctx context.Context, roomID, userID, linkCreator uuid.UUID, tokenHash string) error {
+	_, err := s.DB.ExecContext(ctx, `
+		WITH joined AS (
+			INSERT INTO room_members (room_id, user_id, role, last_read_message_id)
+			VALUES ($1, $2, 'member', (SELECT MAX(id) FROM messages WHERE room_id = $1))
+			ON CONFLICT DO NOTHING
+			RETURNING room_id
+		)
+		INSERT INTO room_membership_events (room_id, user_id, actor_id, action, via, invite_link)
+		SELECT room_id, $2, $3::uuid, 'joined', 'invite_link', $4 FROM joined
+	`, roomID, userID, linkCreator, tokenHash)
+	return err
+}
+
+// RecordMembershipEvent appends to a room's membership log. Joins through
+// invite and guest links and approved join requests are recorded by the
+// store as they happen.
+func (s *Store) RecordMembershipEvent(ctx context.Context, ev MembershipEvent) error {
+	ctx, done := s.op(ctx, "RecordMembershipEvent")
+	defer done()
+	return insertMembershipEvent(ctx, s.DB, ev)
+}
+
+// ListMembershipEvents pages backwards through a room's membership log,
+// newest first, starting below beforeID; 0 starts at the newest.
+func (s *Store) ListMembershipEvents(ctx context.Context, roomID uuid.UUID, beforeID int64, limit int) ([]MembershipEvent, error) {
+	ctx, done := s.op(ctx, "ListMembershipEvents")
+	defer done()
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT e.id, e.room_id, e.user_id, u.username, e.actor_id, COALESCE(a.username, ''), e.action, e.via, COALESCE(e.invite_link, ''), e.created_at
+		FROM room_membership_events e
+		JOIN users u ON u.id = e.user_id
+		LEFT JOIN users a ON a.id = e.actor_id
+		WHERE e.room_id = $1 AND ($2::bigint = 0 OR e.id < $2)
+		ORDER BY e.id DESC
+		LIMIT $3
+	`, roomID, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []MembershipEvent{}
+	for rows.Next() {
+		var ev MembershipEvent
+		var actor uuid.NullUUID
+		if err := rows.Scan(&ev.ID, &ev.RoomID, &ev.UserID, &ev.Username, &actor, &ev.ActorUsername, &ev.Action, &ev.Via, &ev.InviteLinkID, &ev.CreatedAt); err != nil {
+			return nil, err
+		}
+		if actor.Valid {
+			ev.ActorID = &actor.UUID
+		}
+		out = append(out, ev)
+	}
+	return out, rows.Err()
+}
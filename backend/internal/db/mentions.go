@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// Mention is a message that @mentioned a user, with the room it was posted
+// in and whether the user has read that far in the room. Keyword is set when
+// the message matched one of the user's watched keywords instead.
+type Mention struct {
+	Message  Message `json:"message"`
+	RoomName string  `json:"room_name"`
+	Read     bool    `json:"read"`
+	Keyword  string  `json:"keyword,omitempty"`
+}
+
+// MentionFilter narrows ListMentions. Before pages backwards by message id
+// (0 starts at the newest); HideNSFW leaves out NSFW rooms.
+type MentionFilter struct {
+	Before     int64
+	Limit      int
+	UnreadOnly bool
+	HideNSFW   bool
+}
+
+// RecordMentions notes which members each message in [fromID, toID]
+// mentions by @username, matched the way push notifications match them.
+// Shadowed messages and mentions of oneself are skipped.
+func (s *Store) RecordMentions(ctx context.Context, fromID, toID int64) error {
+	ctx, done := s.op(ctx, "RecordMentions")
+	defer done()
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO message_mentions (message_id, user_id, room_id)
+		SELECT m.id, rm.user_id, m.room_id
+		FROM messages m
+		JOIN room_members rm ON rm.room_id = m.room_id AND rm.user_id <> m.user_id
+		JOIN users u ON u.id = rm.user_id
+		WHERE m.id BETWEEN $1 AND $2
+		  AND NOT m.shadowed
+		  AND strpos(lower(m.content), '@' || lower(u.username)) > 0
+		ON CONFLICT DO NOTHING
+	`, fromID, toID)
+	return err
+}
+
+// ListMentions returns the messages that mentioned userID, newest first,
+// in rooms they are still a member of.
+func (s *Store) ListMentions(ctx context.Context, userID uuid.UUID, f MentionFilter) ([]Mention, error) {
+	ctx, done := s.op(ctx, "ListMentions")
+	defer done()
+	if f.Limit <= 0 || f.Limit > 100 {
+		f.Limit = 50
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT m.id, m.room_id, m.user_id, u.username, COALESCE(u.avatar_url, ''), m.content, m.message_type,
+		       COALESCE(m.media_url, ''), m.created_at, m.client_sent_at, m.shadowed, m.nsfw, m.audio::text, m.components::text, m.contact::text, COALESCE(m.alt_text, ''), m.alt_text_generated,
+		       r.name, m.id <= COALESCE(rm.last_read_message_id, 0), COALESCE(mm.keyword, '')
+		FROM message_mentions mm
+		JOIN messages m ON m.id = mm.message_id
+		JOIN users u ON u.id = m.user_id
+		JOIN rooms r ON r.id = mm.room_id
+		JOIN room_members rm ON rm.room_id = mm.room_id AND rm.user_id = mm.user_id
+		WHERE mm.user_id = $1
+		  AND ($2 = 0 OR mm.message_id < $2)
+		  AND NOT ($3 AND m.id <= COALESCE(rm.last_read_message_id, 0))
+		  AND NOT ($4 AND r.nsfw)
+		ORDER BY mm.message_id DESC
+		LIMIT $5
+	`, userID, f.Before, f.UnreadOnly, f.HideNSFW, f.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mentions := []Mention{}
+	for rows.Next() {
+		var mn Mention
+		m := &mn.Message
+		if err := rows.Scan(&m.ID, &m.RoomID, &m.UserID, &m.Username, &m.AvatarURL, contentColumn{m}, &m.MessageType, &m.MediaURL, &m.CreatedAt, &m.ClientSentAt, &m.Shadowed, &m.NSFW, audioColumn{&m.Audio}, componentsColumn{&m.Components}, contactColumn{&m.Contact}, &m.AltText, &m.AltTextGenerated, &mn.RoomName, &mn.Read, &mn.Keyword); err != nil {
+			return nil, err
+		}
+		mentions = append(mentions, mn)
+	}
+	return mentions, rows.Err()
+}
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NewMessage is one message for SaveMessagesBatch.
+type NewMessage struct {
+	UserID      uuid.UUID
+	Content     string
+	MessageType string
+	MediaURL    string
+	// ClientSentAt should already have been through CheckClientSentAt.
+	ClientSentAt *time.Time
+}
+
+// SaveMessagesBatch inserts msgs into roomID with a single statement and
+// returns them in order, with author details filled in. It is the bulk
+// counterpart of SaveMessageWithType for importers, seeders and bots, and
+// either stores every message or none.
+func (s *Store) SaveMessagesBatch(ctx context.Context, roomID uuid.UUID, msgs []NewMessage) ([]Message, error) {
+	ctx, done := s.op(ctx, "SaveMessagesBatch")
+	defer done()
+	if len(msgs) == 0 {
+		return []Message{}, nil
+	}
+	userIDs := make([]uuid.UUID, len(msgs))
+	contents := make([]string, len(msgs))
+	raws := make([]string, len(msgs))
+	types := make([]string, len(msgs))
+	media := make([]string, len(msgs))
+	sentAt := make([]*time.Time, len(msgs))
+	for i, m := range msgs {
+		userIDs[i] = m.UserID
+		content, raw := s.renderContent(m.Content)
+		contents[i], raws[i] = content, raw.String
+		types[i] = m.MessageType
+		if types[i] == "" {
+			types[i] = "text"
+		}
+		media[i] = m.MediaURL
+		sentAt[i] = m.ClientSentAt
+	}
+
+	query := `
+		WITH input AS (
+			SELECT *
+			FROM unnest($2::uuid[], $3::text[], $4::text[], $5::text[], $6::timestamptz[], $7::text[])
+			     WITH ORDINALITY AS t(user_id, content, message_type, media_url, client_sent_at, content_raw, n)
+		), inserted AS (
+			INSERT INTO messages (room_id, user_id, content, content_raw, message_type, media_url, client_sent_at, shadowed, nsfw)
+			SELECT $1, i.user_id, i.content, NULLIF(i.content_raw, ''), i.message_type, NULLIF(i.media_url, ''), i.client_sent_at,
+			       (SELECT shadow_banned FROM users WHERE id = i.user_id), (SELECT nsfw FROM rooms WHERE id = $1)
+			FROM input i
+			ORDER BY i.n
+			RETURNING id, room_id, user_id, content, message_type, COALESCE(media_url, '') AS media_url, created_at, client_sent_at, shadowed, nsfw, audio::text AS audio
+		)
+		SELECT ins.id, ins.room_id, ins.user_id, u.username, COALESCE(u.avatar_url, ''), ins.content, ins.message_type, ins.media_url, ins.created_at, ins.client_sent_at, ins.shadowed, ins.nsfw, ins.audio
+		FROM inserted ins
+		JOIN users u ON u.id = ins.user_id
+		ORDER BY ins.id
+	`
+	rows, err := s.DB.QueryContext(ctx, query, roomID, uuidStrings(userIDs), contents, types, media, sentAt, raws)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	saved := make([]Message, 0, len(msgs))
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.RoomID, &m.UserID, &m.Username, &m.AvatarURL, contentColumn{&m}, &m.MessageType, &m.MediaURL, &m.CreatedAt, &m.ClientSentAt, &m.Shadowed, &m.NSFW, audioColumn{&m.Audio}); err != nil {
+			return nil, err
+		}
+		saved = append(saved, m)
+	}
+	return saved, rows.Err()
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// GetMessage loads a single message, scoped to its room so a guessed id
+// cannot leak messages from rooms the caller is not in.
+func (s *Store) GetMessage(ctx context.Context, roomID uuid.UUID, messageID int64) (Message, error) {
+	ctx, done := s.op(ctx, "GetMessage")
+	defer done()
+	var m Message
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT m.id, m.room_id, m.user_id, u.username, COALESCE(u.avatar_url, ''), m.content, m.message_type, COALESCE(m.media_url, ''), m.created_at, m.client_sent_at, m.shadowed, m.nsfw, m.audio::text, m.components::text, m.contact::text, COALESCE(m.alt_text, ''), m.alt_text_generated
+		FROM messages m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.room_id = $1 AND m.id = $2
+	`, roomID, messageID).Scan(&m.ID, &m.RoomID, &m.UserID, &m.Username, &m.AvatarURL, contentColumn{&m}, &m.MessageType, &m.MediaURL, &m.CreatedAt, &m.ClientSentAt, &m.Shadowed, &m.NSFW, audioColumn{&m.Audio}, componentsColumn{&m.Components}, contactColumn{&m.Contact}, &m.AltText, &m.AltTextGenerated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Message{}, ErrNotFound
+	}
+	if err != nil {
+		return Message{}, err
+	}
+	return m, nil
+}
+
+// ListMessagesAfter is the forward counterpart of ListMessagesBefore and
+// returns messages in chronological order.
+func (s *Store) ListMessagesAfter(ctx context.Context, roomID uuid.UUID, afterID int64, limit int) ([]Message, error) {
+	ctx, done := s.op(ctx, "ListMessagesAfter")
+	defer done()
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT m.id, m.room_id, m.user_id, u.username, COALESCE(u.avatar_url, ''), m.content, m.message_type, COALESCE(m.media_url, ''), m.created_at, m.client_sent_at, m.shadowed, m.nsfw, m.audio::text, m.components::text, m.contact::text, COALESCE(m.alt_text, ''), m.alt_text_generated
+		FROM messages m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.room_id = $1 AND m.id > $2
+		ORDER BY m.id ASC
+		LIMIT $3
+	`, roomID, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []Message{}
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.RoomID, &m.UserID, &m.Username, &m.AvatarURL, contentColumn{&m}, &m.MessageType, &m.MediaURL, &m.CreatedAt, &m.ClientSentAt, &m.Shadowed, &m.NSFW, audioColumn{&m.Audio}, componentsColumn{&m.Components}, contactColumn{&m.Contact}, &m.AltText, &m.AltTextGenerated); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// FindMessageAt returns the ID of the first message in roomID posted at or
+// after at, or of the last one before it when there is none, so jumping to
+// a date past the end of a room lands on its newest message. Shadowed
+// messages count only for viewerID, their author.
+func (s *Store) FindMessageAt(ctx context.Context, roomID, viewerID uuid.UUID, at time.Time) (int64, error) {
+	ctx, done := s.op(ctx, "FindMessageAt")
+	defer done()
+	var id int64
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT id FROM (
+			(SELECT id, 0 AS pref FROM messages
+			 WHERE room_id = $1 AND created_at >= $3 AND (NOT shadowed OR user_id = $2)
+			 ORDER BY created_at, id
+			 LIMIT 1)
+			UNION ALL
+			(SELECT id, 1 AS pref FROM messages
+			 WHERE room_id = $1 AND created_at < $3 AND (NOT shadowed OR user_id = $2)
+			 ORDER BY created_at DESC, id DESC
+			 LIMIT 1)
+		) nearest
+		ORDER BY pref
+		LIMIT 1
+	`, roomID, viewerID, at).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	return id, err
+}
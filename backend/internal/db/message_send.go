@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrIdempotencyConflict means an idempotency key was reused for a message
+// with a different room or content.
+var ErrIdempotencyConflict = errors.New("idempotency key reused")
+
+// SaveMessageOnce stores a chat message under the author's idempotency key.
+// If the key was already used for the same room and content it returns the
+// original message and created is false, so clients can retry a send whose
+// response they never saw.
+func (s *Store) SaveMessageOnce(ctx context.Context, roomID, userID uuid.UUID, content string, clientSentAt *time.Time, key string) (Message, bool, error) {
+	ctx, done := s.op(ctx, "SaveMessageOnce")
+	defer done()
+
+	rendered, raw := s.renderContent(content)
+	var id int64
+	err := s.DB.QueryRowContext(ctx, `
+		INSERT INTO messages (room_id, user_id, content, content_raw, message_type, client_sent_at, idempotency_key, shadowed, nsfw)
+		VALUES ($1, $2, $3, $6, 'text', $4, $5, (SELECT shadow_banned FROM users WHERE id = $2), (SELECT nsfw FROM rooms WHERE id = $1))
+		ON CONFLICT (user_id, idempotency_key) WHERE idempotency_key IS NOT NULL DO NOTHING
+		RETURNING id
+	`, roomID, userID, rendered, clientSentAt, key, raw).Scan(&id)
+	created := err == nil
+	if errors.Is(err, sql.ErrNoRows) {
+		var existingRoom uuid.UUID
+		var existingContent string
+		err = s.DB.QueryRowContext(ctx, `
+			SELECT id, room_id, COALESCE(content_raw, content) FROM messages WHERE user_id = $1 AND idempotency_key = $2
+		`, userID, key).Scan(&id, &existingRoom, &existingContent)
+		if errors.Is(err, sql.ErrNoRows) {
+			// The original was deleted after it was sent.
+			return Message{}, false, ErrNotFound
+		}
+		if err == nil && (existingRoom != roomID || existingContent != content) {
+			return Message{}, false, ErrIdempotencyConflict
+		}
+	}
+	if err != nil {
+		return Message{}, false, err
+	}
+
+	m, err := s.GetMessage(ctx, roomID, id)
+	if err != nil {
+		return Message{}, false, err
+	}
+	return m, created, nil
+}
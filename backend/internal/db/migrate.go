@@ -4,16 +4,14 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"os"
-	"path/filepath"
+	"io/fs"
 	"sort"
 	"strings"
 )
 
-func (s *Store) RunMigrations(ctx context.Context, migrationsPath string) error {
-	if migrationsPath == "" {
-		return nil
-	}
+// RunMigrations applies the .sql files at the top of migrations that have
+// not been applied yet, in name order, each in its own transaction.
+func (s *Store) RunMigrations(ctx context.Context, migrations fs.FS) error {
 
 	if _, err := s.DB.ExecContext(ctx, `
 		CREATE TABLE IF NOT EXISTS schema_migrations (
@@ -24,7 +22,7 @@ func (s *Store) RunMigrations(ctx context.Context, migrationsPath string) error
 		return fmt.Errorf("create schema_migrations: %w", err)
 	}
 
-	entries, err := os.ReadDir(migrationsPath)
+	entries, err := fs.ReadDir(migrations, ".")
 	if err != nil {
 		return fmt.Errorf("read migrations dir: %w", err)
 	}
@@ -51,7 +49,7 @@ func (s *Store) RunMigrations(ctx context.Context, migrationsPath string) error
 			return fmt.Errorf("check migration %s: %w", file, err)
 		}
 
-		migrationSQL, err := os.ReadFile(filepath.Join(migrationsPath, file))
+		migrationSQL, err := fs.ReadFile(migrations, file)
 		if err != nil {
 			return fmt.Errorf("read migration %s: %w", file, err)
 		}
@@ -0,0 +1,29 @@
+package db
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// SetUserShadowBanned toggles shadow-ban mode: the user's new messages are
+// still stored and echoed back to them, but nobody else sees them.
+func (s *Store) SetUserShadowBanned(ctx context.Context, userID uuid.UUID, banned bool) error {
+	ctx, done := s.op(ctx, "SetUserShadowBanned")
+	defer done()
+	return s.execOne(ctx, `UPDATE users SET shadow_banned = $2 WHERE id = $1`, userID, banned)
+}
+
+// VisibleTo returns messages without the shadowed ones viewer did not write.
+// It copies rather than filtering in place because callers may pass slices
+// shared with the history cache.
+func VisibleTo(messages []Message, viewer uuid.UUID) []Message {
+	out := make([]Message, 0, len(messages))
+	for _, m := range messages {
+		if m.Shadowed && m.UserID != viewer {
+			continue
+		}
+		out = append(out, m)
+	}
+	return out
+}
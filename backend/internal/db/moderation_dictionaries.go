@@ -0,0 +1,156 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Dictionary kinds: what auto-moderation does with a dictionary's words.
+const (
+	DictionaryProfanity = "profanity"
+	DictionarySpam      = "spam"
+)
+
+var DictionaryKinds = []string{DictionaryProfanity, DictionarySpam}
+
+// ModerationDictionary is a word list uploaded by an instance admin.
+// Language is a BCP 47 tag, or "" for every language.
+type ModerationDictionary struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Kind     string `json:"kind"`
+	Language string `json:"language"`
+	// Words is only filled in where the whole list is wanted; WordCount
+	// always is.
+	Words     []string   `json:"words,omitempty"`
+	WordCount int        `json:"word_count"`
+	Enabled   bool       `json:"enabled"`
+	CreatedBy *uuid.UUID `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+func scanModerationDictionary(row interface{ Scan(...any) error }, withWords bool) (ModerationDictionary, error) {
+	var d ModerationDictionary
+	var raw []byte
+	err := row.Scan(&d.ID, &d.Name, &d.Kind, &d.Language, &raw, &d.WordCount, &d.Enabled, &d.CreatedBy, &d.CreatedAt, &d.UpdatedAt)
+	if err != nil || !withWords {
+		return d, err
+	}
+	if err := json.Unmarshal(raw, &d.Words); err != nil {
+		return ModerationDictionary{}, err
+	}
+	if d.Words == nil {
+		d.Words = []string{}
+	}
+	return d, nil
+}
+
+// ListModerationDictionaries returns every dictionary, oldest first, with
+// their words when withWords is set.
+func (s *Store) ListModerationDictionaries(ctx context.Context, withWords bool) ([]ModerationDictionary, error) {
+	ctx, done := s.op(ctx, "ListModerationDictionaries")
+	defer done()
+	words := `'[]'::jsonb`
+	if withWords {
+		words = `words`
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, name, kind, language, `+words+`, jsonb_array_length(words), enabled, created_by, created_at, updated_at
+		FROM moderation_dictionaries ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []ModerationDictionary{}
+	for rows.Next() {
+		d, err := scanModerationDictionary(rows, withWords)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) GetModerationDictionary(ctx context.Context, id int64) (ModerationDictionary, error) {
+	ctx, done := s.op(ctx, "GetModerationDictionary")
+	defer done()
+	d, err := scanModerationDictionary(s.DB.QueryRowContext(ctx, `
+		SELECT id, name, kind, language, words, jsonb_array_length(words), enabled, created_by, created_at, updated_at
+		FROM moderation_dictionaries WHERE id = $1
+	`, id), true)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ModerationDictionary{}, ErrNotFound
+	}
+	return d, err
+}
+
+func (s *Store) CreateModerationDictionary(ctx context.Context, d ModerationDictionary) (ModerationDictionary, error) {
+	ctx, done := s.op(ctx, "CreateModerationDictionary")
+	defer done()
+	words, err := json.Marshal(d.Words)
+	if err != nil {
+		return ModerationDictionary{}, err
+	}
+	err = s.DB.QueryRowContext(ctx, `
+		INSERT INTO moderation_dictionaries (name, kind, language, words, enabled, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at, updated_at
+	`, d.Name, d.Kind, d.Language, words, d.Enabled, d.CreatedBy).Scan(&d.ID, &d.CreatedAt, &d.UpdatedAt)
+	d.WordCount = len(d.Words)
+	return d, err
+}
+
+// UpdateModerationDictionary saves d's name, language, words and whether
+// it is enabled. A dictionary's kind cannot change.
+func (s *Store) UpdateModerationDictionary(ctx context.Context, d ModerationDictionary) (ModerationDictionary, error) {
+	ctx, done := s.op(ctx, "UpdateModerationDictionary")
+	defer done()
+	words, err := json.Marshal(d.Words)
+	if err != nil {
+		return ModerationDictionary{}, err
+	}
+	err = s.DB.QueryRowContext(ctx, `
+		UPDATE moderation_dictionaries
+		SET name = $2, language = $3, words = $4, enabled = $5, updated_at = NOW()
+		WHERE id = $1
+		RETURNING updated_at
+	`, d.ID, d.Name, d.Language, words, d.Enabled).Scan(&d.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ModerationDictionary{}, ErrNotFound
+	}
+	d.WordCount = len(d.Words)
+	return d, err
+}
+
+func (s *Store) DeleteModerationDictionary(ctx context.Context, id int64) error {
+	ctx, done := s.op(ctx, "DeleteModerationDictionary")
+	defer done()
+	return s.execOne(ctx, `DELETE FROM moderation_dictionaries WHERE id = $1`, id)
+}
+
+// ModerationDictionariesVersion changes whenever a dictionary is added,
+// edited or removed, so other instances can tell when to reload them.
+func (s *Store) ModerationDictionariesVersion(ctx context.Context) (string, error) {
+	ctx, done := s.op(ctx, "ModerationDictionariesVersion")
+	defer done()
+	var n int
+	var latest *time.Time
+	if err := s.DB.QueryRowContext(ctx, `
+		SELECT COUNT(*), MAX(updated_at) FROM moderation_dictionaries
+	`).Scan(&n, &latest); err != nil {
+		return "", err
+	}
+	if latest == nil {
+		return "0", nil
+	}
+	return fmt.Sprintf("%d:%d", n, latest.UnixNano()), nil
+}
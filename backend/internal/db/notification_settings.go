@@ -0,0 +1,165 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NotificationSettings are a user's choices about what reaches them outside
+// the app.
+type NotificationSettings struct {
+	// AdminEmails sends emails about rooms they administer while they are
+	// offline.
+	AdminEmails bool       `json:"admin_emails"`
+	QuietHours  QuietHours `json:"quiet_hours"`
+}
+
+// QuietHours holds back push notifications and non-security emails during
+// its windows. AllowDirectCalls lets calls in direct messages through.
+type QuietHours struct {
+	Windows          []QuietWindow `json:"windows"`
+	AllowDirectCalls bool          `json:"allow_direct_calls"`
+}
+
+// QuietWindow is a daily stretch from Start to End, both "HH:MM" in the
+// user's timezone. A window that ends before it starts runs past midnight,
+// and one that ends when it starts lasts the whole day. Days limits it to
+// the weekdays it starts on, 0 being Sunday; empty means every day.
+type QuietWindow struct {
+	Days  []int  `json:"days,omitempty"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// UserQuietHours is a user's quiet hours with the timezone they are kept in.
+type UserQuietHours struct {
+	UserID     uuid.UUID
+	Timezone   string
+	QuietHours QuietHours
+}
+
+// ParseClock parses "HH:MM" into minutes after midnight.
+func ParseClock(s string) (int, bool) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+// Active reports whether now falls in one of q's windows. timezone is an
+// IANA name; an empty or unknown one means UTC.
+func (q QuietHours) Active(now time.Time, timezone string) bool {
+	if len(q.Windows) == 0 {
+		return false
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	today := int(local.Weekday())
+	yesterday := (today + 6) % 7
+	for _, w := range q.Windows {
+		start, ok1 := ParseClock(w.Start)
+		end, ok2 := ParseClock(w.End)
+		if !ok1 || !ok2 {
+			continue
+		}
+		switch {
+		case start == end:
+			if w.on(today) {
+				return true
+			}
+		case start < end:
+			if w.on(today) && minute >= start && minute < end {
+				return true
+			}
+		default:
+			if w.on(today) && minute >= start || w.on(yesterday) && minute < end {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (w QuietWindow) on(day int) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) GetNotificationSettings(ctx context.Context, userID uuid.UUID) (NotificationSettings, error) {
+	ctx, done := s.op(ctx, "GetNotificationSettings")
+	defer done()
+	var ns NotificationSettings
+	var raw []byte
+	err := s.DB.QueryRowContext(ctx, `SELECT admin_emails, quiet_hours FROM users WHERE id = $1`, userID).Scan(&ns.AdminEmails, &raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return NotificationSettings{}, ErrNotFound
+	}
+	if err != nil {
+		return NotificationSettings{}, err
+	}
+	if err := json.Unmarshal(raw, &ns.QuietHours); err != nil {
+		return NotificationSettings{}, err
+	}
+	if ns.QuietHours.Windows == nil {
+		ns.QuietHours.Windows = []QuietWindow{}
+	}
+	return ns, nil
+}
+
+func (s *Store) SetNotificationSettings(ctx context.Context, userID uuid.UUID, ns NotificationSettings) error {
+	ctx, done := s.op(ctx, "SetNotificationSettings")
+	defer done()
+	if ns.QuietHours.Windows == nil {
+		ns.QuietHours.Windows = []QuietWindow{}
+	}
+	raw, err := json.Marshal(ns.QuietHours)
+	if err != nil {
+		return err
+	}
+	return s.execOne(ctx, `UPDATE users SET admin_emails = $2, quiet_hours = $3 WHERE id = $1`, userID, ns.AdminEmails, string(raw))
+}
+
+// ListQuietHours returns the quiet hours of those of userIDs who set any.
+func (s *Store) ListQuietHours(ctx context.Context, userIDs []uuid.UUID) ([]UserQuietHours, error) {
+	ctx, done := s.op(ctx, "ListQuietHours")
+	defer done()
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, timezone, quiet_hours
+		FROM users
+		WHERE id = ANY($1::uuid[]) AND jsonb_array_length(quiet_hours->'windows') > 0
+	`, uuidStrings(userIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []UserQuietHours
+	for rows.Next() {
+		var q UserQuietHours
+		var raw []byte
+		if err := rows.Scan(&q.UserID, &q.Timezone, &raw); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(raw, &q.QuietHours); err != nil {
+			return nil, err
+		}
+		out = append(out, q)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Notification is an in-app notice for a single user (security alerts and
+// the like); chat messages are not stored here.
+type Notification struct {
+	ID        int64           `json:"id"`
+	UserID    uuid.UUID       `json:"user_id"`
+	Kind      string          `json:"kind"`
+	Title     string          `json:"title"`
+	Body      string          `json:"body,omitempty"`
+	Data      json.RawMessage `json:"data"`
+	ReadAt    *time.Time      `json:"read_at,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+func (s *Store) CreateNotification(ctx context.Context, userID uuid.UUID, kind, title, body string, data any) (Notification, error) {
+	ctx, done := s.op(ctx, "CreateNotification")
+	defer done()
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Notification{}, err
+	}
+	if data == nil {
+		raw = []byte("{}")
+	}
+	n := Notification{UserID: userID, Kind: kind, Title: title, Body: body, Data: raw}
+	err = s.DB.QueryRowContext(ctx, `
+		INSERT INTO notifications (user_id, kind, title, body, data)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`, userID, kind, title, body, string(raw)).Scan(&n.ID, &n.CreatedAt)
+	if err != nil {
+		return Notification{}, err
+	}
+	return n, nil
+}
+
+// CreateNotifications stores the same notification for every user in
+// userIDs with one statement, for fan-outs such as @room mentions.
+func (s *Store) CreateNotifications(ctx context.Context, userIDs []uuid.UUID, kind, title, body string, data any) ([]Notification, error) {
+	ctx, done := s.op(ctx, "CreateNotifications")
+	defer done()
+	if len(userIDs) == 0 {
+		return []Notification{}, nil
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		raw = []byte("{}")
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		INSERT INTO notifications (user_id, kind, title, body, data)
+		SELECT u, $2, $3, $4, $5 FROM unnest($1::uuid[]) AS u
+		RETURNING id, user_id, created_at
+	`, uuidStrings(userIDs), kind, title, body, string(raw))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]Notification, 0, len(userIDs))
+	for rows.Next() {
+		n := Notification{Kind: kind, Title: title, Body: body, Data: raw}
+		if err := rows.Scan(&n.ID, &n.UserID, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) ListNotifications(ctx context.Context, userID uuid.UUID, limit int) ([]Notification, error) {
+	ctx, done := s.op(ctx, "ListNotifications")
+	defer done()
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, user_id, kind, title, body, data, read_at, created_at
+		FROM notifications
+		WHERE user_id = $1
+		ORDER BY id DESC
+		LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]Notification, 0)
+	for rows.Next() {
+		var n Notification
+		var data []byte
+		var readAt sql.NullTime
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Kind, &n.Title, &n.Body, &data, &readAt, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		n.Data = data
+		if readAt.Valid {
+			n.ReadAt = &readAt.Time
+		}
+		out = append(out, n)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) MarkNotificationRead(ctx context.Context, userID uuid.UUID, id int64) error {
+	ctx, done := s.op(ctx, "MarkNotificationRead")
+	defer done()
+	return s.execOne(ctx, `
+		UPDATE notifications
+		SET read_at = COALESCE(read_at, NOW())
+		WHERE id = $1 AND user_id = $2
+	`, id, userID)
+}
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) GetRoomNSFW(ctx context.Context, roomID uuid.UUID) (bool, error) {
+	ctx, done := s.op(ctx, "GetRoomNSFW")
+	defer done()
+	var nsfw bool
+	err := s.DB.QueryRowContext(ctx, `SELECT nsfw FROM rooms WHERE id = $1`, roomID).Scan(&nsfw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrNotFound
+	}
+	return nsfw, err
+}
+
+// SetRoomNSFW flags or unflags a room. Messages already posted keep the
+// marker they were posted with.
+func (s *Store) SetRoomNSFW(ctx context.Context, roomID uuid.UUID, nsfw bool) error {
+	ctx, done := s.op(ctx, "SetRoomNSFW")
+	defer done()
+	return s.execOne(ctx, `UPDATE rooms SET nsfw = $2 WHERE id = $1`, roomID, nsfw)
+}
+
+func (s *Store) SetMessageNSFW(ctx context.Context, roomID uuid.UUID, messageID int64) error {
+	ctx, done := s.op(ctx, "SetMessageNSFW")
+	defer done()
+	return s.execOne(ctx, `UPDATE messages SET nsfw = TRUE WHERE id = $1 AND room_id = $2`, messageID, roomID)
+}
+
+// GetUserHideNSFW reports whether userID opted out of NSFW content.
+func (s *Store) GetUserHideNSFW(ctx context.Context, userID uuid.UUID) (bool, error) {
+	ctx, done := s.op(ctx, "GetUserHideNSFW")
+	defer done()
+	var hide bool
+	err := s.DB.QueryRowContext(ctx, `SELECT hide_nsfw FROM users WHERE id = $1`, userID).Scan(&hide)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrNotFound
+	}
+	return hide, err
+}
+
+func (s *Store) SetUserHideNSFW(ctx context.Context, userID uuid.UUID, hide bool) error {
+	ctx, done := s.op(ctx, "SetUserHideNSFW")
+	defer done()
+	return s.execOne(ctx, `UPDATE users SET hide_nsfw = $2 WHERE id = $1`, userID, hide)
+}
+
+// WithholdNSFWMedia returns messages with the media URL of NSFW messages
+// removed, for viewers who opted out. Like VisibleTo it copies.
+func WithholdNSFWMedia(messages []Message) []Message {
+	out := make([]Message, len(messages))
+	for i, m := range messages {
+		if m.NSFW && m.MediaURL != "" {
+			m.MediaURL = ""
+			m.Withheld = true
+		}
+		out[i] = m
+	}
+	return out
+}
@@ -0,0 +1,181 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MessageBatch is a contiguous id range of messages a worker consumer has not
+// processed yet, with the rooms they belong to.
+type MessageBatch struct {
+	FromID  int64
+	ToID    int64
+	Count   int
+	RoomIDs []uuid.UUID
+}
+
+func (s *Store) GetWorkerCursor(ctx context.Context, name string) (int64, error) {
+	ctx, done := s.op(ctx, "GetWorkerCursor")
+	defer done()
+	var position int64
+	err := s.DB.QueryRowContext(ctx, `SELECT position FROM worker_cursors WHERE name = $1`, name).Scan(&position)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return position, err
+}
+
+func (s *Store) SetWorkerCursor(ctx context.Context, name string, position int64) error {
+	ctx, done := s.op(ctx, "SetWorkerCursor")
+	defer done()
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO worker_cursors (name, position, updated_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (name) DO UPDATE
+		SET position = GREATEST(worker_cursors.position, EXCLUDED.position),
+		    updated_at = NOW()
+	`, name, position)
+	return err
+}
+
+// NextMessageBatch returns up to limit messages after cursor. Messages newer
+// than settle are left for the next round: ids are handed out before commit,
+// so a slow transaction can commit a lower id after a higher one is visible.
+func (s *Store) NextMessageBatch(ctx context.Context, cursor int64, settle time.Duration, limit int) (MessageBatch, error) {
+	ctx, done := s.op(ctx, "NextMessageBatch")
+	defer done()
+	var b MessageBatch
+	var fromID, toID sql.NullInt64
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT MIN(id), MAX(id), COUNT(*)
+		FROM (
+			SELECT id
+			FROM messages
+			WHERE id > $1
+			  AND created_at < NOW() - make_interval(secs => $2)
+			ORDER BY id
+			LIMIT $3
+		) batch
+	`, cursor, settle.Seconds(), limit).Scan(&fromID, &toID, &b.Count)
+	if err != nil || b.Count == 0 {
+		return b, err
+	}
+	b.FromID, b.ToID = fromID.Int64, toID.Int64
+
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT DISTINCT room_id
+		FROM messages
+		WHERE id BETWEEN $1 AND $2
+	`, b.FromID, b.ToID)
+	if err != nil {
+		return MessageBatch{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var roomID uuid.UUID
+		if err := rows.Scan(&roomID); err != nil {
+			return MessageBatch{}, err
+		}
+		b.RoomIDs = append(b.RoomIDs, roomID)
+	}
+	return b, rows.Err()
+}
+
+// IndexMessages fills search_vector for messages in [fromID, toID].
+func (s *Store) IndexMessages(ctx context.Context, fromID, toID int64) error {
+	ctx, done := s.op(ctx, "IndexMessages")
+	defer done()
+	_, err := s.DB.ExecContext(ctx, `
+		UPDATE messages
+		SET search_vector = to_tsvector('simple', content || ' ' || COALESCE(content_raw, ''))
+		WHERE id BETWEEN $1 AND $2
+	`, fromID, toID)
+	return err
+}
+
+// RefreshUnreadCounts recomputes room_members.unread_count for every member
+// of the given rooms.
+func (s *Store) RefreshUnreadCounts(ctx context.Context, roomIDs []uuid.UUID) error {
+	ctx, done := s.op(ctx, "RefreshUnreadCounts")
+	defer done()
+	_, err := s.DB.ExecContext(ctx, `
+		UPDATE room_members rm
+		SET unread_count = (
+			SELECT COUNT(*)
+			FROM messages mu
+			WHERE mu.room_id = rm.room_id
+			  AND mu.id > COALESCE(rm.last_read_message_id, 0)
+			  AND mu.user_id <> rm.user_id
+			  AND NOT mu.shadowed
+		)
+		WHERE rm.room_id = ANY($1::uuid[])
+	`, uuidStrings(roomIDs))
+	return err
+}
+
+// TouchRoomActivity records the latest message of each room.
+func (s *Store) TouchRoomActivity(ctx context.Context, roomIDs []uuid.UUID) error {
+	ctx, done := s.op(ctx, "TouchRoomActivity")
+	defer done()
+	_, err := s.DB.ExecContext(ctx, `
+		UPDATE rooms r
+		SET last_message_id = latest.id,
+		    last_message_at = latest.created_at
+		FROM (
+			SELECT DISTINCT ON (room_id) room_id, id, created_at
+			FROM messages
+			WHERE room_id = ANY($1::uuid[]) AND NOT shadowed
+			ORDER BY room_id, id DESC
+		) latest
+		WHERE r.id = latest.room_id
+	`, uuidStrings(roomIDs))
+	return err
+}
+
+// SearchMessages finds messages in a room by full-text match on the worker
+// maintained search_vector, newest first.
+// SearchMessages returns matches newest first; beforeID > 0 continues below
+// that message.
+func (s *Store) SearchMessages(ctx context.Context, roomID uuid.UUID, q string, beforeID int64, limit int) ([]Message, error) {
+	ctx, done := s.op(ctx, "SearchMessages")
+	defer done()
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT m.id, m.room_id, m.user_id, u.username, COALESCE(u.avatar_url, ''), m.content, m.message_type, COALESCE(m.media_url, ''), m.created_at, m.client_sent_at, m.shadowed, m.nsfw, m.audio::text, m.components::text, m.contact::text, COALESCE(m.alt_text, ''), m.alt_text_generated
+		FROM messages m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.room_id = $1
+		  AND m.search_vector @@ plainto_tsquery('simple', $2)
+		  AND ($3 = 0 OR m.id < $3)
+		ORDER BY m.id DESC
+		LIMIT $4
+	`, roomID, q, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []Message{}
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.RoomID, &m.UserID, &m.Username, &m.AvatarURL, contentColumn{&m}, &m.MessageType, &m.MediaURL, &m.CreatedAt, &m.ClientSentAt, &m.Shadowed, &m.NSFW, audioColumn{&m.Audio}, componentsColumn{&m.Components}, contactColumn{&m.Contact}, &m.AltText, &m.AltTextGenerated); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+func uuidStrings(ids []uuid.UUID) []string {
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		out = append(out, id.String())
+	}
+	return out
+}
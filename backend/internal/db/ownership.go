@@ -0,0 +1,109 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OwnershipTransfer is a pending offer to make ToUserID the owner
+// (created_by) of a room.
+type OwnershipTransfer struct {
+	RoomID     uuid.UUID `json:"room_id"`
+	FromUserID uuid.UUID `json:"from_user_id"`
+	ToUserID   uuid.UUID `json:"to_user_id"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// CreateOwnershipTransfer records fromID's offer of roomID to toID,
+// replacing any earlier offer for the room.
+func (s *Store) CreateOwnershipTransfer(ctx context.Context, roomID, fromID, toID uuid.UUID, expiresAt time.Time) (OwnershipTransfer, error) {
+	ctx, done := s.op(ctx, "CreateOwnershipTransfer")
+	defer done()
+	t := OwnershipTransfer{RoomID: roomID, FromUserID: fromID, ToUserID: toID, ExpiresAt: expiresAt}
+	err := s.DB.QueryRowContext(ctx, `
+		INSERT INTO room_ownership_transfers (room_id, from_user_id, to_user_id, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (room_id) DO UPDATE
+		SET from_user_id = EXCLUDED.from_user_id, to_user_id = EXCLUDED.to_user_id, created_at = NOW(), expires_at = EXCLUDED.expires_at
+		RETURNING created_at
+	`, roomID, fromID, toID, expiresAt).Scan(&t.CreatedAt)
+	return t, err
+}
+
+// GetOwnershipTransfer returns roomID's unexpired offer.
+func (s *Store) GetOwnershipTransfer(ctx context.Context, roomID uuid.UUID) (OwnershipTransfer, error) {
+	ctx, done := s.op(ctx, "GetOwnershipTransfer")
+	defer done()
+	var t OwnershipTransfer
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT room_id, from_user_id, to_user_id, created_at, expires_at
+		FROM room_ownership_transfers
+		WHERE room_id = $1 AND expires_at > NOW()
+	`, roomID).Scan(&t.RoomID, &t.FromUserID, &t.ToUserID, &t.CreatedAt, &t.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return OwnershipTransfer{}, ErrNotFound
+	}
+	return t, err
+}
+
+// AcceptOwnershipTransfer makes toID the owner of roomID if it holds an
+// unexpired offer for the room: created_by moves to them and they become an
+// admin, in one transaction. The offer is void, and ErrNotFound returned,
+// when the offerer no longer owns the room or toID is no longer a member.
+// The previous owner keeps their role.
+func (s *Store) AcceptOwnershipTransfer(ctx context.Context, roomID, toID uuid.UUID) (OwnershipTransfer, error) {
+	ctx, done := s.op(ctx, "AcceptOwnershipTransfer")
+	defer done()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return OwnershipTransfer{}, err
+	}
+	defer tx.Rollback()
+
+	var t OwnershipTransfer
+	err = tx.QueryRowContext(ctx, `
+		DELETE FROM room_ownership_transfers
+		WHERE room_id = $1 AND to_user_id = $2 AND expires_at > NOW()
+		RETURNING room_id, from_user_id, to_user_id, created_at, expires_at
+	`, roomID, toID).Scan(&t.RoomID, &t.FromUserID, &t.ToUserID, &t.CreatedAt, &t.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return OwnershipTransfer{}, ErrNotFound
+	}
+	if err != nil {
+		return OwnershipTransfer{}, err
+	}
+	res, err := tx.ExecContext(ctx, `UPDATE rooms SET created_by = $3 WHERE id = $1 AND created_by = $2`, roomID, t.FromUserID, toID)
+	if err != nil {
+		return OwnershipTransfer{}, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return OwnershipTransfer{}, err
+	} else if n == 0 {
+		return OwnershipTransfer{}, ErrNotFound
+	}
+	res, err = tx.ExecContext(ctx, `UPDATE room_members SET role = 'admin' WHERE room_id = $1 AND user_id = $2`, roomID, toID)
+	if err != nil {
+		return OwnershipTransfer{}, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return OwnershipTransfer{}, err
+	} else if n == 0 {
+		return OwnershipTransfer{}, ErrNotFound
+	}
+	if err := tx.Commit(); err != nil {
+		return OwnershipTransfer{}, err
+	}
+	return t, nil
+}
+
+// DeleteOwnershipTransfer withdraws or declines roomID's offer.
+func (s *Store) DeleteOwnershipTransfer(ctx context.Context, roomID uuid.UUID) error {
+	ctx, done := s.op(ctx, "DeleteOwnershipTransfer")
+	defer done()
+	return s.execOne(ctx, `DELETE FROM room_ownership_transfers WHERE room_id = $1`, roomID)
+}
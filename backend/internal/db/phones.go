@@ -0,0 +1,311 @@
+package db
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrPhoneTaken is returned when a number is already verified on another
+// account.
+var ErrPhoneTaken = errors.New("phone number already in use")
+
+// PhoneCodeWindow is how long a texted verification code stays valid.
+const PhoneCodeWindow = 10 * time.Minute
+
+// UserPhone is what a user sees of their number: its last digits once
+// verified, the number they are verifying, and how it is used.
+type UserPhone struct {
+	Verified     bool   `json:"verified"`
+	Hint         string `json:"phone_hint,omitempty"`
+	Pending      string `json:"pending,omitempty"`
+	SMSAlerts    bool   `json:"sms_alerts"`
+	Discoverable bool   `json:"discoverable"`
+}
+
+// SMSRecipient is a user who gets SMS alerts, at their verified number.
+type SMSRecipient struct {
+	UserID uuid.UUID
+	Phone  string
+}
+
+// PhoneMatch is a discoverable user whose number hashes to PhoneHash.
+type PhoneMatch struct {
+	PhoneHash string    `json:"-"`
+	UserID    uuid.UUID `json:"user_id"`
+	Username  string    `json:"username"`
+	AvatarURL string    `json:"avatar_url,omitempty"`
+}
+
+func (s *Store) GetPhone(ctx context.Context, userID uuid.UUID) (UserPhone, error) {
+	ctx, done := s.op(ctx, "GetPhone")
+	defer done()
+	var p UserPhone
+	var pending sql.NullString
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT u.phone_hash IS NOT NULL, COALESCE(u.phone_hint, ''), u.sms_alerts, u.phone_discoverable, v.phone
+		FROM users u
+		LEFT JOIN phone_verifications v
+		  ON v.user_id = u.id AND v.phone_hash <> '' AND v.sent_at > NOW() - make_interval(secs => $2)
+		WHERE u.id = $1
+	`, userID, PhoneCodeWindow.Seconds()).Scan(&p.Verified, &p.Hint, &p.SMSAlerts, &p.Discoverable, &pending)
+	if errors.Is(err, sql.ErrNoRows) {
+		return UserPhone{}, ErrNotFound
+	}
+	p.Pending = pending.String
+	return p, err
+}
+
+// StartPhoneVerification records the code hashing to codeHash as the one
+// texted to phone for userID, replacing any earlier code. phoneHash is the
+// number's keyed hash, which is what is kept once it is verified.
+func (s *Store) StartPhoneVerification(ctx context.Context, userID uuid.UUID, phone, phoneHash, codeHash string) error {
+	ctx, done := s.op(ctx, "StartPhoneVerification")
+	defer done()
+	var taken bool
+	if err := s.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE phone_hash = $1 AND id <> $2)`, phoneHash, userID).Scan(&taken); err != nil {
+		return err
+	}
+	if taken {
+		return ErrPhoneTaken
+	}
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO phone_verifications (user_id, phone, phone_hash, code_hash)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE
+		SET phone = EXCLUDED.phone, phone_hash = EXCLUDED.phone_hash, code_hash = EXCLUDED.code_hash, attempts = 0, sent_at = NOW()
+	`, userID, phone, phoneHash, codeHash)
+	return err
+}
+
+// VerifyPhoneCode checks userID's pending code and, when it matches, makes
+// the number theirs and returns it. smsAlerts turns SMS alerts on or off
+// with it; nil keeps the current setting. The number itself is only kept
+// while alerts are on. Wrong codes count like email codes: ErrCodeMismatch
+// with the attempts left, then ErrTooManyAttempts. ErrNotFound means no
+// live code.
+func (s *Store) VerifyPhoneCode(ctx context.Context, userID uuid.UUID, codeHash string, maxAttempts int, smsAlerts *bool) (string, int, error) {
+	ctx, done := s.op(ctx, "VerifyPhoneCode")
+	defer done()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	defer tx.Rollback()
+
+	var phone, phoneHash, stored string
+	var attempts int
+	err = tx.QueryRowContext(ctx, `
+		SELECT phone, phone_hash, code_hash, attempts
+		FROM phone_verifications
+		WHERE user_id = $1 AND phone_hash <> '' AND sent_at > NOW() - make_interval(secs => $2)
+		FOR UPDATE
+	`, userID, PhoneCodeWindow.Seconds()).Scan(&phone, &phoneHash, &stored, &attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", 0, ErrNotFound
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	if maxAttempts > 0 && attempts >= maxAttempts {
+		return "", 0, ErrTooManyAttempts
+	}
+	if subtle.ConstantTimeCompare([]byte(stored), []byte(codeHash)) != 1 {
+		if _, err := tx.ExecContext(ctx, `UPDATE phone_verifications SET attempts = attempts + 1 WHERE user_id = $1`, userID); err != nil {
+			return "", 0, err
+		}
+		if err := tx.Commit(); err != nil {
+			return "", 0, err
+		}
+		if maxAttempts <= 0 {
+			return "", 0, ErrCodeMismatch
+		}
+		if left := maxAttempts - attempts - 1; left > 0 {
+			return "", left, ErrCodeMismatch
+		}
+		return "", 0, ErrTooManyAttempts
+	}
+
+	var taken bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE phone_hash = $1 AND id <> $2)`, phoneHash, userID).Scan(&taken); err != nil {
+		return "", 0, err
+	}
+	if taken {
+		return "", 0, ErrPhoneTaken
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE users
+		SET phone_hash = $2, phone_hint = right($3, 4), sms_alerts = COALESCE($4::boolean, sms_alerts),
+		    phone = CASE WHEN COALESCE($4::boolean, sms_alerts) THEN $3 ELSE NULL END
+		WHERE id = $1
+	`, userID, phoneHash, phone, smsAlerts); err != nil {
+		return "", 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM phone_verifications WHERE user_id = $1`, userID); err != nil {
+		return "", 0, err
+	}
+	return phone, 0, tx.Commit()
+}
+
+// ClearPhone forgets userID's number, which also stops their SMS alerts and
+// takes them out of contact discovery.
+func (s *Store) ClearPhone(ctx context.Context, userID uuid.UUID) error {
+	ctx, done := s.op(ctx, "ClearPhone")
+	defer done()
+	if _, err := s.DB.ExecContext(ctx, `DELETE FROM phone_verifications WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	return s.execOne(ctx, `
+		UPDATE users
+		SET phone = NULL, phone_hash = NULL, phone_hint = NULL, sms_alerts = FALSE, phone_discoverable = FALSE
+		WHERE id = $1 AND phone_hash IS NOT NULL
+	`, userID)
+}
+
+// SetSMSAlerts turns userID's SMS alerts on or off. Turning them off also
+// drops the number, leaving only its hash, so turning them on again needs
+// the number verified again. ErrNotFound means there is no number to text.
+func (s *Store) SetSMSAlerts(ctx context.Context, userID uuid.UUID, on bool) error {
+	ctx, done := s.op(ctx, "SetSMSAlerts")
+	defer done()
+	return s.execOne(ctx, `
+		UPDATE users
+		SET sms_alerts = $2, phone = CASE WHEN $2 THEN phone ELSE NULL END
+		WHERE id = $1 AND phone_hash IS NOT NULL AND (phone IS NOT NULL OR NOT $2)
+	`, userID, on)
+}
+
+// SetPhoneDiscoverable decides whether others who have userID's number can
+// find them by it. ErrNotFound means they have no verified number.
+func (s *Store) SetPhoneDiscoverable(ctx context.Context, userID uuid.UUID, on bool) error {
+	ctx, done := s.op(ctx, "SetPhoneDiscoverable")
+	defer done()
+	return s.execOne(ctx, `UPDATE users SET phone_discoverable = $2 WHERE id = $1 AND phone_hash IS NOT NULL`, userID, on)
+}
+
+// MatchPhones returns the discoverable users, other than selfID, whose
+// numbers hash to one of phoneHashes.
+func (s *Store) MatchPhones(ctx context.Context, selfID uuid.UUID, phoneHashes []string) ([]PhoneMatch, error) {
+	ctx, done := s.op(ctx, "MatchPhones")
+	defer done()
+	out := []PhoneMatch{}
+	if len(phoneHashes) == 0 {
+		return out, nil
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT phone_hash, id, username, COALESCE(avatar_url, '')
+		FROM users
+		WHERE phone_hash = ANY($2::text[]) AND phone_discoverable AND id <> $1 AND NOT is_bot
+		ORDER BY username
+	`, selfID, phoneHashes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m PhoneMatch
+		if err := rows.Scan(&m.PhoneHash, &m.UserID, &m.Username, &m.AvatarURL); err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// HashStoredPhones hashes numbers verified before they were kept hashed,
+// and drops those of users without SMS alerts. It returns how many it
+// hashed.
+func (s *Store) HashStoredPhones(ctx context.Context, hash func(phone string) string) (int, error) {
+	ctx, done := s.op(ctx, "HashStoredPhones")
+	defer done()
+	rows, err := s.DB.QueryContext(ctx, `SELECT id, phone FROM users WHERE phone IS NOT NULL AND phone_hash IS NULL`)
+	if err != nil {
+		return 0, err
+	}
+	type stored struct {
+		id    uuid.UUID
+		phone string
+	}
+	var pending []stored
+	for rows.Next() {
+		var p stored
+		if err := rows.Scan(&p.id, &p.phone); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		pending = append(pending, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	for i, p := range pending {
+		if _, err := s.DB.ExecContext(ctx, `
+			UPDATE users
+			SET phone_hash = $2, phone_hint = right(phone, 4), phone = CASE WHEN sms_alerts THEN phone ELSE NULL END
+			WHERE id = $1 AND phone_hash IS NULL
+		`, p.id, hash(p.phone)); err != nil {
+			return i, err
+		}
+	}
+	return len(pending), nil
+}
+
+// ListSMSRecipients returns those of userIDs with SMS alerts on.
+func (s *Store) ListSMSRecipients(ctx context.Context, userIDs []uuid.UUID) ([]SMSRecipient, error) {
+	ctx, done := s.op(ctx, "ListSMSRecipients")
+	defer done()
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, phone FROM users
+		WHERE id = ANY($1::uuid[]) AND sms_alerts AND phone IS NOT NULL
+	`, uuidStrings(userIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []SMSRecipient
+	for rows.Next() {
+		var r SMSRecipient
+		if err := rows.Scan(&r.UserID, &r.Phone); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// TakeSMSBudget counts one kind alert to userID against perDay, over the
+// last 24 hours, and reports false when the budget is spent. perDay <= 0
+// never caps.
+func (s *Store) TakeSMSBudget(ctx context.Context, userID uuid.UUID, kind string, perDay int) (bool, error) {
+	ctx, done := s.op(ctx, "TakeSMSBudget")
+	defer done()
+	res, err := s.DB.ExecContext(ctx, `
+		INSERT INTO sms_sends (user_id, kind)
+		SELECT $1, $2
+		WHERE $3 <= 0 OR (SELECT COUNT(*) FROM sms_sends WHERE user_id = $1 AND sent_at > NOW() - INTERVAL '24 hours') < $3
+	`, userID, kind, perDay)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// DeleteOldSMSSends drops send records older than the budget window.
+func (s *Store) DeleteOldSMSSends(ctx context.Context) (int64, error) {
+	ctx, done := s.op(ctx, "DeleteOldSMSSends")
+	defer done()
+	res, err := s.DB.ExecContext(ctx, `DELETE FROM sms_sends WHERE sent_at < NOW() - INTERVAL '24 hours'`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
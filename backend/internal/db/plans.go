@@ -0,0 +1,248 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// Plan overrides quota defaults for the users and workspaces on it. A nil
+// limit inherits the instance default; 0 means unlimited.
+type Plan struct {
+	Name           string `json:"name"`
+	MaxRooms       *int   `json:"max_rooms"`
+	MaxRoomMembers *int   `json:"max_room_members"`
+	MaxUploadBytes *int64 `json:"max_upload_bytes"`
+	HistoryDays    *int   `json:"history_days"`
+}
+
+const planColumns = `p.name, p.max_rooms, p.max_room_members, p.max_upload_bytes, p.history_days`
+
+func scanPlan(row interface{ Scan(...any) error }) (Plan, error) {
+	var p Plan
+	var maxRooms, maxMembers, historyDays sql.NullInt32
+	var maxUpload sql.NullInt64
+	if err := row.Scan(&p.Name, &maxRooms, &maxMembers, &maxUpload, &historyDays); err != nil {
+		return Plan{}, err
+	}
+	if maxRooms.Valid {
+		v := int(maxRooms.Int32)
+		p.MaxRooms = &v
+	}
+	if maxMembers.Valid {
+		v := int(maxMembers.Int32)
+		p.MaxRoomMembers = &v
+	}
+	if maxUpload.Valid {
+		p.MaxUploadBytes = &maxUpload.Int64
+	}
+	if historyDays.Valid {
+		v := int(historyDays.Int32)
+		p.HistoryDays = &v
+	}
+	return p, nil
+}
+
+func (s *Store) ListPlans(ctx context.Context) ([]Plan, error) {
+	ctx, done := s.op(ctx, "ListPlans")
+	defer done()
+	rows, err := s.DB.QueryContext(ctx, `SELECT `+planColumns+` FROM plans p ORDER BY p.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	plans := []Plan{}
+	for rows.Next() {
+		p, err := scanPlan(rows)
+		if err != nil {
+			return nil, err
+		}
+		plans = append(plans, p)
+	}
+	return plans, rows.Err()
+}
+
+// UpsertPlan creates p or replaces the limits of the plan with its name.
+func (s *Store) UpsertPlan(ctx context.Context, p Plan) error {
+	ctx, done := s.op(ctx, "UpsertPlan")
+	defer done()
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO plans (name, max_rooms, max_room_members, max_upload_bytes, history_days)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (name) DO UPDATE
+		SET max_rooms = EXCLUDED.max_rooms,
+		    max_room_members = EXCLUDED.max_room_members,
+		    max_upload_bytes = EXCLUDED.max_upload_bytes,
+		    history_days = EXCLUDED.history_days
+	`, p.Name, p.MaxRooms, p.MaxRoomMembers, p.MaxUploadBytes, p.HistoryDays)
+	return err
+}
+
+// DeletePlan removes a plan; its users and workspaces fall back to the
+// defaults.
+func (s *Store) DeletePlan(ctx context.Context, name string) error {
+	ctx, done := s.op(ctx, "DeletePlan")
+	defer done()
+	return s.execOne(ctx, `DELETE FROM plans WHERE name = $1`, name)
+}
+
+// SetUserPlan puts userID on plan, or back on the defaults when plan is "".
+// It returns ErrNotFound when the user or the plan does not exist.
+func (s *Store) SetUserPlan(ctx context.Context, userID uuid.UUID, plan string) error {
+	ctx, done := s.op(ctx, "SetUserPlan")
+	defer done()
+	return s.execOne(ctx, `
+		UPDATE users SET plan = NULLIF($2, '')
+		WHERE id = $1 AND ($2 = '' OR EXISTS (SELECT 1 FROM plans WHERE name = $2))
+	`, userID, plan)
+}
+
+// SetGroupPlan is SetUserPlan for a workspace.
+func (s *Store) SetGroupPlan(ctx context.Context, groupID uuid.UUID, plan string) error {
+	ctx, done := s.op(ctx, "SetGroupPlan")
+	defer done()
+	return s.execOne(ctx, `
+		UPDATE room_groups SET plan = NULLIF($2, '')
+		WHERE id = $1 AND ($2 = '' OR EXISTS (SELECT 1 FROM plans WHERE name = $2))
+	`, groupID, plan)
+}
+
+// GetUserPlan returns userID's plan, or a Plan with no name when they are
+// on the defaults.
+func (s *Store) GetUserPlan(ctx context.Context, userID uuid.UUID) (Plan, error) {
+	ctx, done := s.op(ctx, "GetUserPlan")
+	defer done()
+	return s.queryPlan(ctx, `
+		SELECT `+planColumns+`
+		FROM users u JOIN plans p ON p.name = u.plan
+		WHERE u.id = $1
+	`, userID)
+}
+
+// GetRoomPlan returns the plan governing roomID: its workspace's when the
+// workspace has one, otherwise its creator's.
+func (s *Store) GetRoomPlan(ctx context.Context, roomID uuid.UUID) (Plan, error) {
+	ctx, done := s.op(ctx, "GetRoomPlan")
+	defer done()
+	return s.queryPlan(ctx, `
+		SELECT `+planColumns+`
+		FROM rooms r
+		JOIN users u ON u.id = r.created_by
+		LEFT JOIN group_channels gc ON gc.room_id = r.id
+		LEFT JOIN room_groups g ON g.id = gc.group_id
+		JOIN plans p ON p.name = COALESCE(g.plan, u.plan)
+		WHERE r.id = $1
+	`, roomID)
+}
+
+// GetGroupPlan returns the plan governing a workspace: its own, otherwise
+// its creator's.
+func (s *Store) GetGroupPlan(ctx context.Context, groupID uuid.UUID) (Plan, error) {
+	ctx, done := s.op(ctx, "GetGroupPlan")
+	defer done()
+	return s.queryPlan(ctx, `
+		SELECT `+planColumns+`
+		FROM room_groups g
+		JOIN users u ON u.id = g.created_by
+		JOIN plans p ON p.name = COALESCE(g.plan, u.plan)
+		WHERE g.id = $1
+	`, groupID)
+}
+
+func (s *Store) queryPlan(ctx context.Context, query string, id uuid.UUID) (Plan, error) {
+	p, err := scanPlan(s.DB.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Plan{}, nil
+	}
+	return p, err
+}
+
+// CountRoomsCreatedBy counts the rooms and channels userID created, not
+// counting direct messages.
+func (s *Store) CountRoomsCreatedBy(ctx context.Context, userID uuid.UUID) (int, error) {
+	ctx, done := s.op(ctx, "CountRoomsCreatedBy")
+	defer done()
+	var n int
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM rooms r
+		LEFT JOIN direct_rooms d ON d.room_id = r.id
+		WHERE r.created_by = $1 AND d.room_id IS NULL
+	`, userID).Scan(&n)
+	return n, err
+}
+
+func (s *Store) CountRoomMembers(ctx context.Context, roomID uuid.UUID) (int, error) {
+	ctx, done := s.op(ctx, "CountRoomMembers")
+	defer done()
+	var n int
+	err := s.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM room_members WHERE room_id = $1`, roomID).Scan(&n)
+	return n, err
+}
+
+// CountGroupMembers counts the distinct members across a workspace's
+// channels.
+func (s *Store) CountGroupMembers(ctx context.Context, groupID uuid.UUID) (int, error) {
+	ctx, done := s.op(ctx, "CountGroupMembers")
+	defer done()
+	var n int
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT COUNT(DISTINCT rm.user_id)
+		FROM group_channels gc
+		JOIN room_members rm ON rm.room_id = gc.room_id
+		WHERE gc.group_id = $1
+	`, groupID).Scan(&n)
+	return n, err
+}
+
+// IsGroupMember reports whether userID is in any of the workspace's
+// channels.
+func (s *Store) IsGroupMember(ctx context.Context, groupID, userID uuid.UUID) (bool, error) {
+	ctx, done := s.op(ctx, "IsGroupMember")
+	defer done()
+	var member bool
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM group_channels gc
+			JOIN room_members rm ON rm.room_id = gc.room_id
+			WHERE gc.group_id = $1 AND rm.user_id = $2
+		)
+	`, groupID, userID).Scan(&member)
+	return member, err
+}
+
+// PurgeExpiredHistory deletes messages older than their room's history
+// retention: the governing plan's history_days, or defaultDays when the plan
+// leaves it unset. 0 keeps history forever. Messages under a legal hold,
+// through their room or their author, are kept.
+func (s *Store) PurgeExpiredHistory(ctx context.Context, defaultDays int) (int64, error) {
+	ctx, done := s.op(ctx, "PurgeExpiredHistory")
+	defer done()
+	res, err := s.DB.ExecContext(ctx, `
+		WITH retention AS (
+			SELECT r.id AS room_id,
+			       COALESCE(p.history_days, $1) AS days
+			FROM rooms r
+			JOIN users u ON u.id = r.created_by
+			LEFT JOIN group_channels gc ON gc.room_id = r.id
+			LEFT JOIN room_groups g ON g.id = gc.group_id
+			LEFT JOIN plans p ON p.name = COALESCE(g.plan, u.plan)
+		)
+		DELETE FROM messages m
+		USING retention t
+		WHERE m.room_id = t.room_id
+		  AND t.days > 0
+		  AND m.created_at < NOW() - make_interval(days => t.days)
+		  AND NOT EXISTS (
+			SELECT 1 FROM legal_holds h
+			WHERE h.released_at IS NULL AND (h.room_id = m.room_id OR h.user_id = m.user_id)
+		  )
+	`, defaultDays)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
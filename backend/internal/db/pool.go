@@ -0,0 +1,81 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"talkie/backend/internal/metrics"
+)
+
+// PoolSaturation describes an interval in which callers waited on the
+// connection pool for longer than the configured threshold on average.
+type PoolSaturation struct {
+	Interval    time.Duration
+	Waits       int64
+	AvgWait     time.Duration
+	InUse       int
+	Idle        int
+	MaxOpen     int
+	TotalWaited time.Duration
+}
+
+// InstrumentPool exports the pool's sql.DBStats on the metrics endpoint. It
+// must be called at most once per process.
+func (s *Store) InstrumentPool() {
+	stat := func(fn func(sql.DBStats) float64) func() float64 {
+		return func() float64 { return fn(s.DB.Stats()) }
+	}
+	metrics.NewGaugeFunc("talkie_db_pool_open_connections", "Connections open in the pool, in use or idle.",
+		stat(func(st sql.DBStats) float64 { return float64(st.OpenConnections) }))
+	metrics.NewGaugeFunc("talkie_db_pool_in_use", "Connections currently handed out.",
+		stat(func(st sql.DBStats) float64 { return float64(st.InUse) }))
+	metrics.NewGaugeFunc("talkie_db_pool_idle", "Idle connections kept in the pool.",
+		stat(func(st sql.DBStats) float64 { return float64(st.Idle) }))
+	metrics.NewGaugeFunc("talkie_db_pool_max_open", "Upper bound on open connections.",
+		stat(func(st sql.DBStats) float64 { return float64(st.MaxOpenConnections) }))
+	metrics.NewCounterFunc("talkie_db_pool_wait_count_total", "Acquisitions that had to wait for a free connection.",
+		stat(func(st sql.DBStats) float64 { return float64(st.WaitCount) }))
+	metrics.NewCounterFunc("talkie_db_pool_wait_seconds_total", "Time spent waiting for a free connection.",
+		stat(func(st sql.DBStats) float64 { return st.WaitDuration.Seconds() }))
+	metrics.NewCounterFunc("talkie_db_pool_closed_max_idle_total", "Connections closed because the idle pool was full.",
+		stat(func(st sql.DBStats) float64 { return float64(st.MaxIdleClosed) }))
+	metrics.NewCounterFunc("talkie_db_pool_closed_max_lifetime_total", "Connections closed for exceeding their lifetime.",
+		stat(func(st sql.DBStats) float64 { return float64(st.MaxLifetimeClosed) }))
+}
+
+// WatchPool samples the pool every interval until ctx ends and calls warn
+// when the average wait for a connection over that interval exceeded
+// threshold, which is the first sign of pool exhaustion.
+func (s *Store) WatchPool(ctx context.Context, interval, threshold time.Duration, warn func(PoolSaturation)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	prev := s.DB.Stats()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		cur := s.DB.Stats()
+		waits := cur.WaitCount - prev.WaitCount
+		waited := cur.WaitDuration - prev.WaitDuration
+		prev = cur
+		if waits <= 0 {
+			continue
+		}
+		avg := waited / time.Duration(waits)
+		if avg < threshold {
+			continue
+		}
+		warn(PoolSaturation{
+			Interval:    interval,
+			Waits:       waits,
+			AvgWait:     avg,
+			InUse:       cur.InUse,
+			Idle:        cur.Idle,
+			MaxOpen:     cur.MaxOpenConnections,
+			TotalWaited: waited,
+		})
+	}
+}
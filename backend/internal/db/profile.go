@@ -0,0 +1,117 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"talkie/backend/internal/profile"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) ListProfileFields(ctx context.Context) ([]profile.Field, error) {
+	ctx, done := s.op(ctx, "ListProfileFields")
+	defer done()
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT key, label, type, options::text, max_length, position
+		FROM profile_fields
+		ORDER BY position, key
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	fields := []profile.Field{}
+	for rows.Next() {
+		var f profile.Field
+		var options string
+		if err := rows.Scan(&f.Key, &f.Label, &f.Type, &options, &f.MaxLength, &f.Position); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(options), &f.Options); err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+	return fields, rows.Err()
+}
+
+func (s *Store) UpsertProfileField(ctx context.Context, f profile.Field) error {
+	ctx, done := s.op(ctx, "UpsertProfileField")
+	defer done()
+	options, err := json.Marshal(f.Options)
+	if err != nil {
+		return err
+	}
+	if f.Options == nil {
+		options = []byte("[]")
+	}
+	_, err = s.DB.ExecContext(ctx, `
+		INSERT INTO profile_fields (key, label, type, options, max_length, position)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (key) DO UPDATE SET
+			label = EXCLUDED.label,
+			type = EXCLUDED.type,
+			options = EXCLUDED.options,
+			max_length = EXCLUDED.max_length,
+			position = EXCLUDED.position
+	`, f.Key, f.Label, f.Type, string(options), f.MaxLength, f.Position)
+	return err
+}
+
+// DeleteProfileField removes a field definition. Values users set for it
+// stay on their rows but are no longer shown.
+func (s *Store) DeleteProfileField(ctx context.Context, key string) error {
+	ctx, done := s.op(ctx, "DeleteProfileField")
+	defer done()
+	return s.execOne(ctx, `DELETE FROM profile_fields WHERE key = $1`, key)
+}
+
+func (s *Store) GetUserProfile(ctx context.Context, userID uuid.UUID) (map[string]string, error) {
+	ctx, done := s.op(ctx, "GetUserProfile")
+	defer done()
+	var raw string
+	err := s.DB.QueryRowContext(ctx, `SELECT profile::text FROM users WHERE id = $1`, userID).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeProfile(raw)
+}
+
+// UpdateUserProfile sets the given values in one statement; a nil value
+// removes that key. It returns the profile as stored afterwards.
+func (s *Store) UpdateUserProfile(ctx context.Context, userID uuid.UUID, changes map[string]*string) (map[string]string, error) {
+	ctx, done := s.op(ctx, "UpdateUserProfile")
+	defer done()
+	patch, err := json.Marshal(changes)
+	if err != nil {
+		return nil, err
+	}
+	var raw string
+	err = s.DB.QueryRowContext(ctx, `
+		UPDATE users
+		SET profile = jsonb_strip_nulls(profile || $2::jsonb)
+		WHERE id = $1
+		RETURNING profile::text
+	`, userID, string(patch)).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeProfile(raw)
+}
+
+func decodeProfile(raw string) (map[string]string, error) {
+	out := map[string]string{}
+	if err := json.Unmarshal([]byte(raw), &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
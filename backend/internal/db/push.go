@@ -0,0 +1,90 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type PushDevice struct {
+	ID         int64     `json:"id"`
+	UserID     uuid.UUID `json:"user_id"`
+	Platform   string    `json:"platform"`
+	Token      string    `json:"token"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+// RegisterPushDevice stores a provider token for userID. A token that was
+// previously registered by another account is moved to the new owner, since
+// the device itself has changed hands.
+func (s *Store) RegisterPushDevice(ctx context.Context, userID uuid.UUID, platform, token string) (PushDevice, error) {
+	ctx, done := s.op(ctx, "RegisterPushDevice")
+	defer done()
+	var d PushDevice
+	err := s.DB.QueryRowContext(ctx, `
+		INSERT INTO push_devices (user_id, platform, token)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (token) DO UPDATE
+		SET user_id = EXCLUDED.user_id,
+		    platform = EXCLUDED.platform,
+		    last_seen_at = NOW()
+		RETURNING id, user_id, platform, token, created_at, last_seen_at
+	`, userID, platform, token).Scan(&d.ID, &d.UserID, &d.Platform, &d.Token, &d.CreatedAt, &d.LastSeenAt)
+	if err != nil {
+		return PushDevice{}, err
+	}
+	return d, nil
+}
+
+func (s *Store) DeletePushDevice(ctx context.Context, userID uuid.UUID, token string) error {
+	ctx, done := s.op(ctx, "DeletePushDevice")
+	defer done()
+	res, err := s.DB.ExecContext(ctx, `DELETE FROM push_devices WHERE user_id = $1 AND token = $2`, userID, token)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) DeletePushDeviceByToken(ctx context.Context, token string) error {
+	ctx, done := s.op(ctx, "DeletePushDeviceByToken")
+	defer done()
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM push_devices WHERE token = $1`, token)
+	return err
+}
+
+func (s *Store) ListPushDevicesForUsers(ctx context.Context, userIDs []uuid.UUID) ([]PushDevice, error) {
+	ctx, done := s.op(ctx, "ListPushDevicesForUsers")
+	defer done()
+	if len(userIDs) == 0 {
+		return []PushDevice{}, nil
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, user_id, platform, token, created_at, last_seen_at
+		FROM push_devices
+		WHERE user_id = ANY($1::uuid[])
+	`, uuidStrings(userIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]PushDevice, 0)
+	for rows.Next() {
+		var d PushDevice
+		if err := rows.Scan(&d.ID, &d.UserID, &d.Platform, &d.Token, &d.CreatedAt, &d.LastSeenAt); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
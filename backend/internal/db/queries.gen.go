@@ -0,0 +1,520 @@
+// Code generated by querygen from queries/*.sql. DO NOT EDIT.
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// dbtx is what generated queries run on: the pool or a transaction.
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// queries runs the statements in queries/*.sql on db.
+type queries struct {
+	db dbtx
+}
+
+// insertMessageSQL is from queries/messages.sql.
+const insertMessageSQL = `
+INSERT INTO messages (room_id, user_id, content, content_raw, message_type, media_url, client_sent_at, shadowed, nsfw)
+VALUES ($1, $2, $3, $7, $4, $5, $6, (SELECT shadow_banned FROM users WHERE id = $2), (SELECT nsfw FROM rooms WHERE id = $1))
+RETURNING id, room_id, user_id, content, message_type, COALESCE(media_url, '') AS media_url, created_at, client_sent_at, shadowed, nsfw, audio::text AS audio
+`
+
+func (q queries) insertMessage(ctx context.Context, roomID uuid.UUID, userID uuid.UUID, content string, messageType string, mediaURL sql.NullString, clientSentAt *time.Time, contentRaw sql.NullString) (Message, error) {
+	var v Message
+	err := q.db.QueryRowContext(ctx, insertMessageSQL, roomID, userID, content, messageType, mediaURL, clientSentAt, contentRaw).Scan(&v.ID, &v.RoomID, &v.UserID, contentColumn{&v}, &v.MessageType, &v.MediaURL, &v.CreatedAt, &v.ClientSentAt, &v.Shadowed, &v.NSFW, audioColumn{&v.Audio})
+	if errors.Is(err, sql.ErrNoRows) {
+		return v, ErrNotFound
+	}
+	return v, err
+}
+
+// listLatestMessagesSQL is from queries/messages.sql.
+const listLatestMessagesSQL = `
+SELECT m.id, m.room_id, m.user_id, u.username, COALESCE(u.avatar_url, '') AS avatar_url, m.content, m.message_type, COALESCE(m.media_url, '') AS media_url,
+       m.created_at, m.client_sent_at, m.shadowed, m.nsfw, m.audio::text AS audio, m.components::text AS components, m.contact::text AS contact, COALESCE(m.alt_text, '') AS alt_text, m.alt_text_generated,
+       (SELECT MAX(e.created_at) FROM room_events e WHERE e.room_id = m.room_id AND e.message_id = m.id AND e.type = 'message_edited') AS edited_at
+FROM messages m
+JOIN users u ON u.id = m.user_id
+WHERE m.room_id = $1
+ORDER BY m.created_at DESC
+LIMIT $2
+`
+
+// listLatestMessages returns a room's latest messages, newest first.
+func (q queries) listLatestMessages(ctx context.Context, roomID uuid.UUID, limit int) ([]Message, error) {
+	rows, err := q.db.QueryContext(ctx, listLatestMessagesSQL, roomID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Message{}
+	for rows.Next() {
+		var v Message
+		if err := rows.Scan(&v.ID, &v.RoomID, &v.UserID, &v.Username, &v.AvatarURL, contentColumn{&v}, &v.MessageType, &v.MediaURL, &v.CreatedAt, &v.ClientSentAt, &v.Shadowed, &v.NSFW, audioColumn{&v.Audio}, componentsColumn{&v.Components}, contactColumn{&v.Contact}, &v.AltText, &v.AltTextGenerated, &v.EditedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// listMessagesBeforeSQL is from queries/messages.sql.
+const listMessagesBeforeSQL = `
+SELECT m.id, m.room_id, m.user_id, u.username, COALESCE(u.avatar_url, '') AS avatar_url, m.content, m.message_type, COALESCE(m.media_url, '') AS media_url,
+       m.created_at, m.client_sent_at, m.shadowed, m.nsfw, m.audio::text AS audio, m.components::text AS components, m.contact::text AS contact, COALESCE(m.alt_text, '') AS alt_text, m.alt_text_generated,
+       (SELECT MAX(e.created_at) FROM room_events e WHERE e.room_id = m.room_id AND e.message_id = m.id AND e.type = 'message_edited') AS edited_at
+FROM messages m
+JOIN users u ON u.id = m.user_id
+WHERE m.room_id = $1 AND m.id < $2
+ORDER BY m.id DESC
+LIMIT $3
+`
+
+// listMessagesBefore returns the messages below beforeID, newest first.
+func (q queries) listMessagesBefore(ctx context.Context, roomID uuid.UUID, beforeID int64, limit int) ([]Message, error) {
+	rows, err := q.db.QueryContext(ctx, listMessagesBeforeSQL, roomID, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Message{}
+	for rows.Next() {
+		var v Message
+		if err := rows.Scan(&v.ID, &v.RoomID, &v.UserID, &v.Username, &v.AvatarURL, contentColumn{&v}, &v.MessageType, &v.MediaURL, &v.CreatedAt, &v.ClientSentAt, &v.Shadowed, &v.NSFW, audioColumn{&v.Audio}, componentsColumn{&v.Components}, contactColumn{&v.Contact}, &v.AltText, &v.AltTextGenerated, &v.EditedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// insertRoomSQL is from queries/rooms.sql.
+const insertRoomSQL = `
+INSERT INTO rooms (name, created_by, is_private)
+VALUES ($1, $2, $3)
+RETURNING id, name, created_by, is_private, created_at
+`
+
+func (q queries) insertRoom(ctx context.Context, name string, createdBy uuid.UUID, isPrivate bool) (Room, error) {
+	var v Room
+	err := q.db.QueryRowContext(ctx, insertRoomSQL, name, createdBy, isPrivate).Scan(&v.ID, &v.Name, &v.CreatedBy, &v.IsPrivate, &v.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return v, ErrNotFound
+	}
+	return v, err
+}
+
+// addRoomMemberSQL is from queries/rooms.sql.
+const addRoomMemberSQL = `
+INSERT INTO room_members (room_id, user_id, role) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING
+`
+
+func (q queries) addRoomMember(ctx context.Context, roomID uuid.UUID, userID uuid.UUID, role string) error {
+	_, err := q.db.ExecContext(ctx, addRoomMemberSQL, roomID, userID, role)
+	return err
+}
+
+// getRoomByIDSQL is from queries/rooms.sql.
+const getRoomByIDSQL = `
+SELECT id, name, created_by, '' AS avatar_url, is_private, created_at
+FROM rooms
+WHERE id = $1
+`
+
+func (q queries) getRoomByID(ctx context.Context, roomID uuid.UUID) (Room, error) {
+	var v Room
+	err := q.db.QueryRowContext(ctx, getRoomByIDSQL, roomID).Scan(&v.ID, &v.Name, &v.CreatedBy, &v.AvatarURL, &v.IsPrivate, &v.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return v, ErrNotFound
+	}
+	return v, err
+}
+
+// getRoomForUserSQL is from queries/rooms.sql.
+const getRoomForUserSQL = `
+SELECT r.id, r.name, r.created_by, '' AS avatar_url, r.is_private, rm.role AS my_role, (rm.role = 'admin') AS can_manage, r.created_at
+FROM rooms r
+JOIN room_members rm ON rm.room_id = r.id
+WHERE r.id = $1 AND rm.user_id = $2
+`
+
+func (q queries) getRoomForUser(ctx context.Context, roomID uuid.UUID, userID uuid.UUID) (Room, error) {
+	var v Room
+	err := q.db.QueryRowContext(ctx, getRoomForUserSQL, roomID, userID).Scan(&v.ID, &v.Name, &v.CreatedBy, &v.AvatarURL, &v.IsPrivate, &v.MyRole, &v.CanManage, &v.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return v, ErrNotFound
+	}
+	return v, err
+}
+
+// listRoomsForUserSQL is from queries/rooms.sql.
+const listRoomsForUserSQL = `
+SELECT DISTINCT r.id, r.name, r.created_by, r.is_private, rm.role AS my_role, (rm.role = 'admin') AS can_manage, r.created_at, rs.last_message_at,
+       rs.unread_count AS unread_count, rs.first_unread_id AS first_unread_message_id
+FROM room_summaries rs
+JOIN room_members rm ON rm.room_id = rs.room_id AND rm.user_id = rs.user_id
+JOIN rooms r ON r.id = rs.room_id
+LEFT JOIN direct_rooms d ON d.room_id = r.id
+LEFT JOIN group_channels gc ON gc.room_id = r.id
+WHERE d.room_id IS NULL
+  AND gc.room_id IS NULL
+  AND rs.user_id = $1
+ORDER BY r.created_at DESC
+`
+
+// listRoomsForUser reads activity and unread state from room_summaries,
+// like listUnreadColumns.
+func (q queries) listRoomsForUser(ctx context.Context, userID uuid.UUID) ([]Room, error) {
+	rows, err := q.db.QueryContext(ctx, listRoomsForUserSQL, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Room{}
+	for rows.Next() {
+		var v Room
+		if err := rows.Scan(&v.ID, &v.Name, &v.CreatedBy, &v.IsPrivate, &v.MyRole, &v.CanManage, &v.CreatedAt, &v.LastMessageAt, &v.UnreadCount, &v.FirstUnreadMessageID); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// listDirectRoomsForUserSQL is from queries/rooms.sql.
+const listDirectRoomsForUserSQL = `
+SELECT r.id,
+       CASE WHEN d.user_a = $1 THEN ub.username ELSE ua.username END AS name,
+       r.created_by,
+       CASE WHEN d.user_a = $1 THEN COALESCE(ub.avatar_url, '') ELSE COALESCE(ua.avatar_url, '') END AS avatar_url,
+       r.is_private, rm.role AS my_role, (rm.role = 'admin') AS can_manage, r.created_at, rs.last_message_at,
+       rs.unread_count AS unread_count, rs.first_unread_id AS first_unread_message_id
+FROM rooms r
+JOIN direct_rooms d ON d.room_id = r.id
+JOIN room_members rm ON rm.room_id = r.id AND rm.user_id = $1
+JOIN room_summaries rs ON rs.user_id = rm.user_id AND rs.room_id = rm.room_id
+JOIN users ua ON ua.id = d.user_a
+JOIN users ub ON ub.id = d.user_b
+WHERE d.user_a = $1 OR d.user_b = $1
+ORDER BY r.created_at DESC
+`
+
+// listDirectRoomsForUser reads activity and unread state from
+// room_summaries, like listUnreadColumns.
+func (q queries) listDirectRoomsForUser(ctx context.Context, userID uuid.UUID) ([]Room, error) {
+	rows, err := q.db.QueryContext(ctx, listDirectRoomsForUserSQL, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Room{}
+	for rows.Next() {
+		var v Room
+		if err := rows.Scan(&v.ID, &v.Name, &v.CreatedBy, &v.AvatarURL, &v.IsPrivate, &v.MyRole, &v.CanManage, &v.CreatedAt, &v.LastMessageAt, &v.UnreadCount, &v.FirstUnreadMessageID); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// isRoomMemberSQL is from queries/rooms.sql.
+const isRoomMemberSQL = `
+SELECT EXISTS(SELECT 1 FROM room_members WHERE room_id = $1 AND user_id = $2) AS is_member
+`
+
+func (q queries) isRoomMember(ctx context.Context, roomID uuid.UUID, userID uuid.UUID) (bool, error) {
+	var v bool
+	err := q.db.QueryRowContext(ctx, isRoomMemberSQL, roomID, userID).Scan(&v)
+	if errors.Is(err, sql.ErrNoRows) {
+		return v, ErrNotFound
+	}
+	return v, err
+}
+
+// isRoomAdminSQL is from queries/rooms.sql.
+const isRoomAdminSQL = `
+SELECT EXISTS(
+	SELECT 1
+	FROM room_members
+	WHERE room_id = $1 AND user_id = $2 AND role = 'admin'
+) AS is_admin
+`
+
+func (q queries) isRoomAdmin(ctx context.Context, roomID uuid.UUID, userID uuid.UUID) (bool, error) {
+	var v bool
+	err := q.db.QueryRowContext(ctx, isRoomAdminSQL, roomID, userID).Scan(&v)
+	if errors.Is(err, sql.ErrNoRows) {
+		return v, ErrNotFound
+	}
+	return v, err
+}
+
+// isDirectRoomSQL is from queries/rooms.sql.
+const isDirectRoomSQL = `
+SELECT EXISTS(SELECT 1 FROM direct_rooms WHERE room_id = $1) AS is_direct
+`
+
+func (q queries) isDirectRoom(ctx context.Context, roomID uuid.UUID) (bool, error) {
+	var v bool
+	err := q.db.QueryRowContext(ctx, isDirectRoomSQL, roomID).Scan(&v)
+	if errors.Is(err, sql.ErrNoRows) {
+		return v, ErrNotFound
+	}
+	return v, err
+}
+
+// listRoomMembersSQL is from queries/rooms.sql.
+const listRoomMembersSQL = `
+SELECT u.id, u.username, COALESCE(u.avatar_url, '') AS avatar_url
+FROM room_members rm
+JOIN users u ON u.id = rm.user_id
+WHERE rm.room_id = $1
+ORDER BY u.username ASC
+`
+
+func (q queries) listRoomMembers(ctx context.Context, roomID uuid.UUID) ([]RoomMember, error) {
+	rows, err := q.db.QueryContext(ctx, listRoomMembersSQL, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []RoomMember{}
+	for rows.Next() {
+		var v RoomMember
+		if err := rows.Scan(&v.ID, &v.Username, &v.AvatarURL); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// insertRoomGroupSQL is from queries/rooms.sql.
+const insertRoomGroupSQL = `
+INSERT INTO room_groups (name, created_by)
+VALUES ($1, $2)
+RETURNING id, name, created_by, created_at
+`
+
+func (q queries) insertRoomGroup(ctx context.Context, name string, createdBy uuid.UUID) (RoomGroup, error) {
+	var v RoomGroup
+	err := q.db.QueryRowContext(ctx, insertRoomGroupSQL, name, createdBy).Scan(&v.ID, &v.Name, &v.CreatedBy, &v.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return v, ErrNotFound
+	}
+	return v, err
+}
+
+// getGroupIDByRoomIDSQL is from queries/rooms.sql.
+const getGroupIDByRoomIDSQL = `
+SELECT group_id
+FROM group_channels
+WHERE room_id = $1
+`
+
+func (q queries) getGroupIDByRoomID(ctx context.Context, roomID uuid.UUID) (uuid.UUID, error) {
+	var v uuid.UUID
+	err := q.db.QueryRowContext(ctx, getGroupIDByRoomIDSQL, roomID).Scan(&v)
+	if errors.Is(err, sql.ErrNoRows) {
+		return v, ErrNotFound
+	}
+	return v, err
+}
+
+// createUserSQL is from queries/users.sql.
+const createUserSQL = `
+INSERT INTO users (email, username, password_hash, email_verified)
+VALUES ($1, $2, $3, FALSE)
+RETURNING id, email, username, COALESCE(avatar_url, '') AS avatar_url, email_verified, password_hash, created_at
+`
+
+func (q queries) createUser(ctx context.Context, email string, username string, passwordHash string) (User, error) {
+	var v User
+	err := q.db.QueryRowContext(ctx, createUserSQL, email, username, passwordHash).Scan(&v.ID, &v.Email, &v.Username, &v.AvatarURL, &v.EmailVerified, &v.PasswordHash, &v.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return v, ErrNotFound
+	}
+	return v, err
+}
+
+// findUserByEmailSQL is from queries/users.sql.
+const findUserByEmailSQL = `
+SELECT id, email, username, COALESCE(avatar_url, '') AS avatar_url, email_verified, is_admin, is_bot, session_version, guest_expires_at, password_hash, created_at
+FROM users
+WHERE email = $1
+`
+
+func (q queries) findUserByEmail(ctx context.Context, email string) (User, error) {
+	var v User
+	err := q.db.QueryRowContext(ctx, findUserByEmailSQL, email).Scan(&v.ID, &v.Email, &v.Username, &v.AvatarURL, &v.EmailVerified, &v.IsAdmin, &v.IsBot, &v.SessionVersion, &v.GuestExpiresAt, &v.PasswordHash, &v.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return v, ErrNotFound
+	}
+	return v, err
+}
+
+// findUserByUsernameSQL is from queries/users.sql.
+const findUserByUsernameSQL = `
+SELECT id, email, username, COALESCE(avatar_url, '') AS avatar_url, email_verified, is_admin, is_bot, session_version, guest_expires_at, password_hash, created_at
+FROM users
+WHERE username = $1
+`
+
+func (q queries) findUserByUsername(ctx context.Context, username string) (User, error) {
+	var v User
+	err := q.db.QueryRowContext(ctx, findUserByUsernameSQL, username).Scan(&v.ID, &v.Email, &v.Username, &v.AvatarURL, &v.EmailVerified, &v.IsAdmin, &v.IsBot, &v.SessionVersion, &v.GuestExpiresAt, &v.PasswordHash, &v.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return v, ErrNotFound
+	}
+	return v, err
+}
+
+// findUserByIDSQL is from queries/users.sql.
+const findUserByIDSQL = `
+SELECT id, email, username, COALESCE(avatar_url, '') AS avatar_url, email_verified, is_admin, is_bot, session_version, guest_expires_at, password_hash, created_at
+FROM users
+WHERE id = $1
+`
+
+func (q queries) findUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	var v User
+	err := q.db.QueryRowContext(ctx, findUserByIDSQL, id).Scan(&v.ID, &v.Email, &v.Username, &v.AvatarURL, &v.EmailVerified, &v.IsAdmin, &v.IsBot, &v.SessionVersion, &v.GuestExpiresAt, &v.PasswordHash, &v.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return v, ErrNotFound
+	}
+	return v, err
+}
+
+// getFriendSQL is from queries/users.sql.
+const getFriendSQL = `
+SELECT id, username, email, COALESCE(avatar_url, '') AS avatar_url
+FROM users
+WHERE id = $1
+`
+
+func (q queries) getFriend(ctx context.Context, id uuid.UUID) (Friend, error) {
+	var v Friend
+	err := q.db.QueryRowContext(ctx, getFriendSQL, id).Scan(&v.ID, &v.Username, &v.Email, &v.AvatarURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return v, ErrNotFound
+	}
+	return v, err
+}
+
+// searchUsersSQL is from queries/users.sql.
+const searchUsersSQL = `
+SELECT id, username, email, COALESCE(avatar_url, '') AS avatar_url
+FROM users
+WHERE id <> $1 AND (username ILIKE $2 OR email ILIKE $2)
+ORDER BY username ASC
+LIMIT $3
+`
+
+func (q queries) searchUsers(ctx context.Context, selfID uuid.UUID, pattern string, limit int) ([]Friend, error) {
+	rows, err := q.db.QueryContext(ctx, searchUsersSQL, selfID, pattern, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Friend{}
+	for rows.Next() {
+		var v Friend
+		if err := rows.Scan(&v.ID, &v.Username, &v.Email, &v.AvatarURL); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// listFriendsSQL is from queries/users.sql.
+const listFriendsSQL = `
+SELECT u.id, u.username, u.email, COALESCE(u.avatar_url, '') AS avatar_url
+FROM friendships f
+JOIN users u ON u.id = f.friend_id
+WHERE f.user_id = $1
+ORDER BY u.username ASC
+`
+
+func (q queries) listFriends(ctx context.Context, userID uuid.UUID) ([]Friend, error) {
+	rows, err := q.db.QueryContext(ctx, listFriendsSQL, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Friend{}
+	for rows.Next() {
+		var v Friend
+		if err := rows.Scan(&v.ID, &v.Username, &v.Email, &v.AvatarURL); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// isFriendSQL is from queries/users.sql.
+const isFriendSQL = `
+SELECT EXISTS(SELECT 1 FROM friendships WHERE user_id = $1 AND friend_id = $2) AS is_friend
+`
+
+func (q queries) isFriend(ctx context.Context, userID uuid.UUID, friendID uuid.UUID) (bool, error) {
+	var v bool
+	err := q.db.QueryRowContext(ctx, isFriendSQL, userID, friendID).Scan(&v)
+	if errors.Is(err, sql.ErrNoRows) {
+		return v, ErrNotFound
+	}
+	return v, err
+}
+
+// addFriendshipSQL is from queries/users.sql.
+const addFriendshipSQL = `
+INSERT INTO friendships (user_id, friend_id) VALUES ($1, $2) ON CONFLICT DO NOTHING
+`
+
+func (q queries) addFriendship(ctx context.Context, userID uuid.UUID, friendID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, addFriendshipSQL, userID, friendID)
+	return err
+}
+
+// listIncomingFriendRequestsSQL is from queries/users.sql.
+const listIncomingFriendRequestsSQL = `
+SELECT fr.id, fr.requester_id, fr.addressee_id,
+       ru.username AS requester, COALESCE(ru.avatar_url, '') AS requester_avatar,
+       au.username AS addressee, COALESCE(au.avatar_url, '') AS addressee_avatar,
+       fr.status, fr.created_at
+FROM friend_requests fr
+JOIN users ru ON ru.id = fr.requester_id
+JOIN users au ON au.id = fr.addressee_id
+WHERE fr.addressee_id = $1 AND fr.status = 'pending'
+ORDER BY fr.created_at DESC
+`
+
+func (q queries) listIncomingFriendRequests(ctx context.Context, userID uuid.UUID) ([]FriendRequest, error) {
+	rows, err := q.db.QueryContext(ctx, listIncomingFriendRequestsSQL, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []FriendRequest{}
+	for rows.Next() {
+		var v FriendRequest
+		if err := rows.Scan(&v.ID, &v.RequesterID, &v.AddresseeID, &v.Requester, &v.RequesterAvatar, &v.Addressee, &v.AddresseeAvatar, &v.Status, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,31 @@
+-- Chat messages.
+
+-- name: insertMessage :one Message
+-- args: roomID uuid.UUID, userID uuid.UUID, content string, messageType string, mediaURL sql.NullString, clientSentAt *time.Time, contentRaw sql.NullString
+INSERT INTO messages (room_id, user_id, content, content_raw, message_type, media_url, client_sent_at, shadowed, nsfw)
+VALUES ($1, $2, $3, $7, $4, $5, $6, (SELECT shadow_banned FROM users WHERE id = $2), (SELECT nsfw FROM rooms WHERE id = $1))
+RETURNING id, room_id, user_id, content, message_type, COALESCE(media_url, '') AS media_url, created_at, client_sent_at, shadowed, nsfw, audio::text AS audio;
+
+-- name: listLatestMessages :many Message
+-- args: roomID uuid.UUID, limit int
+-- listLatestMessages returns a room's latest messages, newest first.
+SELECT m.id, m.room_id, m.user_id, u.username, COALESCE(u.avatar_url, '') AS avatar_url, m.content, m.message_type, COALESCE(m.media_url, '') AS media_url,
+       m.created_at, m.client_sent_at, m.shadowed, m.nsfw, m.audio::text AS audio, m.components::text AS components, m.contact::text AS contact, COALESCE(m.alt_text, '') AS alt_text, m.alt_text_generated,
+       (SELECT MAX(e.created_at) FROM room_events e WHERE e.room_id = m.room_id AND e.message_id = m.id AND e.type = 'message_edited') AS edited_at
+FROM messages m
+JOIN users u ON u.id = m.user_id
+WHERE m.room_id = $1
+ORDER BY m.created_at DESC
+LIMIT $2;
+
+-- name: listMessagesBefore :many Message
+-- args: roomID uuid.UUID, beforeID int64, limit int
+-- listMessagesBefore returns the messages below beforeID, newest first.
+SELECT m.id, m.room_id, m.user_id, u.username, COALESCE(u.avatar_url, '') AS avatar_url, m.content, m.message_type, COALESCE(m.media_url, '') AS media_url,
+       m.created_at, m.client_sent_at, m.shadowed, m.nsfw, m.audio::text AS audio, m.components::text AS components, m.contact::text AS contact, COALESCE(m.alt_text, '') AS alt_text, m.alt_text_generated,
+       (SELECT MAX(e.created_at) FROM room_events e WHERE e.room_id = m.room_id AND e.message_id = m.id AND e.type = 'message_edited') AS edited_at
+FROM messages m
+JOIN users u ON u.id = m.user_id
+WHERE m.room_id = $1 AND m.id < $2
+ORDER BY m.id DESC
+LIMIT $3;
@@ -0,0 +1,95 @@
+-- Rooms, groups and membership.
+
+-- name: insertRoom :one Room
+-- args: name string, createdBy uuid.UUID, isPrivate bool
+INSERT INTO rooms (name, created_by, is_private)
+VALUES ($1, $2, $3)
+RETURNING id, name, created_by, is_private, created_at;
+
+-- name: addRoomMember :exec
+-- args: roomID uuid.UUID, userID uuid.UUID, role string
+INSERT INTO room_members (room_id, user_id, role) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING;
+
+-- name: getRoomByID :one Room
+-- args: roomID uuid.UUID
+SELECT id, name, created_by, '' AS avatar_url, is_private, created_at
+FROM rooms
+WHERE id = $1;
+
+-- name: getRoomForUser :one Room
+-- args: roomID uuid.UUID, userID uuid.UUID
+SELECT r.id, r.name, r.created_by, '' AS avatar_url, r.is_private, rm.role AS my_role, (rm.role = 'admin') AS can_manage, r.created_at
+FROM rooms r
+JOIN room_members rm ON rm.room_id = r.id
+WHERE r.id = $1 AND rm.user_id = $2;
+
+-- name: listRoomsForUser :many Room
+-- args: userID uuid.UUID
+-- listRoomsForUser reads activity and unread state from room_summaries,
+-- like listUnreadColumns.
+SELECT DISTINCT r.id, r.name, r.created_by, r.is_private, rm.role AS my_role, (rm.role = 'admin') AS can_manage, r.created_at, rs.last_message_at,
+       rs.unread_count AS unread_count, rs.first_unread_id AS first_unread_message_id
+FROM room_summaries rs
+JOIN room_members rm ON rm.room_id = rs.room_id AND rm.user_id = rs.user_id
+JOIN rooms r ON r.id = rs.room_id
+LEFT JOIN direct_rooms d ON d.room_id = r.id
+LEFT JOIN group_channels gc ON gc.room_id = r.id
+WHERE d.room_id IS NULL
+  AND gc.room_id IS NULL
+  AND rs.user_id = $1
+ORDER BY r.created_at DESC;
+
+-- name: listDirectRoomsForUser :many Room
+-- args: userID uuid.UUID
+-- listDirectRoomsForUser reads activity and unread state from
+-- room_summaries, like listUnreadColumns.
+SELECT r.id,
+       CASE WHEN d.user_a = $1 THEN ub.username ELSE ua.username END AS name,
+       r.created_by,
+       CASE WHEN d.user_a = $1 THEN COALESCE(ub.avatar_url, '') ELSE COALESCE(ua.avatar_url, '') END AS avatar_url,
+       r.is_private, rm.role AS my_role, (rm.role = 'admin') AS can_manage, r.created_at, rs.last_message_at,
+       rs.unread_count AS unread_count, rs.first_unread_id AS first_unread_message_id
+FROM rooms r
+JOIN direct_rooms d ON d.room_id = r.id
+JOIN room_members rm ON rm.room_id = r.id AND rm.user_id = $1
+JOIN room_summaries rs ON rs.user_id = rm.user_id AND rs.room_id = rm.room_id
+JOIN users ua ON ua.id = d.user_a
+JOIN users ub ON ub.id = d.user_b
+WHERE d.user_a = $1 OR d.user_b = $1
+ORDER BY r.created_at DESC;
+
+-- name: isRoomMember :one bool
+-- args: roomID uuid.UUID, userID uuid.UUID
+SELECT EXISTS(SELECT 1 FROM room_members WHERE room_id = $1 AND user_id = $2) AS is_member;
+
+-- name: isRoomAdmin :one bool
+-- args: roomID uuid.UUID, userID uuid.UUID
+SELECT EXISTS(
+	SELECT 1
+	FROM room_members
+	WHERE room_id = $1 AND user_id = $2 AND role = 'admin'
+) AS is_admin;
+
+-- name: isDirectRoom :one bool
+-- args: roomID uuid.UUID
+SELECT EXISTS(SELECT 1 FROM direct_rooms WHERE room_id = $1) AS is_direct;
+
+-- name: listRoomMembers :many RoomMember
+-- args: roomID uuid.UUID
+SELECT u.id, u.username, COALESCE(u.avatar_url, '') AS avatar_url
+FROM room_members rm
+JOIN users u ON u.id = rm.user_id
+WHERE rm.room_id = $1
+ORDER BY u.username ASC;
+
+-- name: insertRoomGroup :one RoomGroup
+-- args: name string, createdBy uuid.UUID
+INSERT INTO room_groups (name, created_by)
+VALUES ($1, $2)
+RETURNING id, name, created_by, created_at;
+
+-- name: getGroupIDByRoomID :one uuid.UUID
+-- args: roomID uuid.UUID
+SELECT group_id
+FROM group_channels
+WHERE room_id = $1;
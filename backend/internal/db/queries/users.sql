@@ -0,0 +1,67 @@
+-- Users and friendships.
+
+-- name: createUser :one User
+-- args: email string, username string, passwordHash string
+INSERT INTO users (email, username, password_hash, email_verified)
+VALUES ($1, $2, $3, FALSE)
+RETURNING id, email, username, COALESCE(avatar_url, '') AS avatar_url, email_verified, password_hash, created_at;
+
+-- name: findUserByEmail :one User
+-- args: email string
+SELECT id, email, username, COALESCE(avatar_url, '') AS avatar_url, email_verified, is_admin, is_bot, session_version, guest_expires_at, password_hash, created_at
+FROM users
+WHERE email = $1;
+
+-- name: findUserByUsername :one User
+-- args: username string
+SELECT id, email, username, COALESCE(avatar_url, '') AS avatar_url, email_verified, is_admin, is_bot, session_version, guest_expires_at, password_hash, created_at
+FROM users
+WHERE username = $1;
+
+-- name: findUserByID :one User
+-- args: id uuid.UUID
+SELECT id, email, username, COALESCE(avatar_url, '') AS avatar_url, email_verified, is_admin, is_bot, session_version, guest_expires_at, password_hash, created_at
+FROM users
+WHERE id = $1;
+
+-- name: getFriend :one Friend
+-- args: id uuid.UUID
+SELECT id, username, email, COALESCE(avatar_url, '') AS avatar_url
+FROM users
+WHERE id = $1;
+
+-- name: searchUsers :many Friend
+-- args: selfID uuid.UUID, pattern string, limit int
+SELECT id, username, email, COALESCE(avatar_url, '') AS avatar_url
+FROM users
+WHERE id <> $1 AND (username ILIKE $2 OR email ILIKE $2)
+ORDER BY username ASC
+LIMIT $3;
+
+-- name: listFriends :many Friend
+-- args: userID uuid.UUID
+SELECT u.id, u.username, u.email, COALESCE(u.avatar_url, '') AS avatar_url
+FROM friendships f
+JOIN users u ON u.id = f.friend_id
+WHERE f.user_id = $1
+ORDER BY u.username ASC;
+
+-- name: isFriend :one bool
+-- args: userID uuid.UUID, friendID uuid.UUID
+SELECT EXISTS(SELECT 1 FROM friendships WHERE user_id = $1 AND friend_id = $2) AS is_friend;
+
+-- name: addFriendship :exec
+-- args: userID uuid.UUID, friendID uuid.UUID
+INSERT INTO friendships (user_id, friend_id) VALUES ($1, $2) ON CONFLICT DO NOTHING;
+
+-- name: listIncomingFriendRequests :many FriendRequest
+-- args: userID uuid.UUID
+SELECT fr.id, fr.requester_id, fr.addressee_id,
+       ru.username AS requester, COALESCE(ru.avatar_url, '') AS requester_avatar,
+       au.username AS addressee, COALESCE(au.avatar_url, '') AS addressee_avatar,
+       fr.status, fr.created_at
+FROM friend_requests fr
+JOIN users ru ON ru.id = fr.requester_id
+JOIN users au ON au.id = fr.addressee_id
+WHERE fr.addressee_id = $1 AND fr.status = 'pending'
+ORDER BY fr.created_at DESC;
@@ -0,0 +1,174 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type JoinRequest struct {
+	RoomID    uuid.UUID `json:"room_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Username  string    `json:"username"`
+	AvatarURL string    `json:"avatar_url,omitempty"`
+	// InviteLinkID is the token hash of the invite link they arrived
+	// through.
+	InviteLinkID string    `json:"invite_link_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// GetInviteTarget resolves an unexpired room or group invite link without
+// joining it. Exactly one of the returned IDs is set.
+func (s *Store) GetInviteTarget(ctx context.Context, tokenHash string) (uuid.UUID, uuid.UUID, error) {
+	ctx, done := s.op(ctx, "GetInviteTarget")
+	defer done()
+	var roomID, groupID uuid.NullUUID
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT room_id, group_id FROM room_invite_links WHERE token_hash = $1 AND expires_at > NOW()
+	`, tokenHash).Scan(&roomID, &groupID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, uuid.Nil, ErrNotFound
+	}
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+	if !roomID.Valid && !groupID.Valid {
+		return uuid.Nil, uuid.Nil, ErrNotFound
+	}
+	return roomID.UUID, groupID.UUID, nil
+}
+
+func (s *Store) GetRoomRaidMode(ctx context.Context, roomID uuid.UUID) (bool, error) {
+	ctx, done := s.op(ctx, "GetRoomRaidMode")
+	defer done()
+	var on bool
+	err := s.DB.QueryRowContext(ctx, `SELECT raid_mode FROM rooms WHERE id = $1`, roomID).Scan(&on)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrNotFound
+	}
+	return on, err
+}
+
+func (s *Store) SetRoomRaidMode(ctx context.Context, roomID uuid.UUID, on bool) error {
+	ctx, done := s.op(ctx, "SetRoomRaidMode")
+	defer done()
+	return s.execOne(ctx, `UPDATE rooms SET raid_mode = $2 WHERE id = $1`, roomID, on)
+}
+
+// CreateJoinRequest queues userID for approval, remembering the invite link
+// (by token hash) that brought them. Asking again keeps the original
+// request, its link and its place in the queue.
+func (s *Store) CreateJoinRequest(ctx context.Context, roomID, userID uuid.UUID, inviteLink string) (JoinRequest, error) {
+	ctx, done := s.op(ctx, "CreateJoinRequest")
+	defer done()
+	req := JoinRequest{RoomID: roomID, UserID: userID}
+	err := s.DB.QueryRowContext(ctx, `
+		WITH ins AS (
+			INSERT INTO room_join_requests (room_id, user_id, invite_link)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (room_id, user_id) DO UPDATE SET created_at = room_join_requests.created_at
+			RETURNING created_at, COALESCE(invite_link, '') AS invite_link
+		)
+		SELECT ins.created_at, ins.invite_link, u.username, u.avatar_url FROM ins, users u WHERE u.id = $2
+	`, roomID, userID, nullableString(inviteLink)).Scan(&req.CreatedAt, &req.InviteLinkID, &req.Username, &req.AvatarURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return JoinRequest{}, ErrNotFound
+	}
+	return req, err
+}
+
+// ListJoinRequests returns roomID's pending requests, oldest first.
+func (s *Store) ListJoinRequests(ctx context.Context, roomID uuid.UUID) ([]JoinRequest, error) {
+	ctx, done := s.op(ctx, "ListJoinRequests")
+	defer done()
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT jr.room_id, jr.user_id, u.username, u.avatar_url, COALESCE(jr.invite_link, ''), jr.created_at
+		FROM room_join_requests jr
+		JOIN users u ON u.id = jr.user_id
+		WHERE jr.room_id = $1
+		ORDER BY jr.created_at, jr.user_id
+	`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []JoinRequest{}
+	for rows.Next() {
+		var req JoinRequest
+		if err := rows.Scan(&req.RoomID, &req.UserID, &req.Username, &req.AvatarURL, &req.InviteLinkID, &req.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, req)
+	}
+	return out, rows.Err()
+}
+
+// ApproveJoinRequest removes userID's pending request, adds them to the
+// room as a member and logs the join as approved by approverID, crediting
+// the invite link the request came through.
+func (s *Store) ApproveJoinRequest(ctx context.Context, roomID, userID, approverID uuid.UUID) error {
+	ctx, done := s.op(ctx, "ApproveJoinRequest")
+	defer done()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var inviteLink string
+	err = tx.QueryRowContext(ctx, `
+		DELETE FROM room_join_requests WHERE room_id = $1 AND user_id = $2
+		RETURNING COALESCE(invite_link, '')
+	`, roomID, userID).Scan(&inviteLink)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO room_members (room_id, user_id, role, last_read_message_id)
+		VALUES ($1, $2, 'member', (SELECT MAX(id) FROM messages WHERE room_id = $1))
+		ON CONFLICT DO NOTHING
+	`, roomID, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n > 0 {
+		if err := insertMembershipEvent(ctx, tx, MembershipEvent{
+			RoomID: roomID, UserID: userID, ActorID: &approverID, Action: MembershipJoined, Via: ViaJoinRequest, InviteLinkID: inviteLink,
+		}); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *Store) DeleteJoinRequest(ctx context.Context, roomID, userID uuid.UUID) error {
+	ctx, done := s.op(ctx, "DeleteJoinRequest")
+	defer done()
+	return s.execOne(ctx, `DELETE FROM room_join_requests WHERE room_id = $1 AND user_id = $2`, roomID, userID)
+}
+
+func (s *Store) ListRoomAdminIDs(ctx context.Context, roomID uuid.UUID) ([]uuid.UUID, error) {
+	ctx, done := s.op(ctx, "ListRoomAdminIDs")
+	defer done()
+	rows, err := s.DB.QueryContext(ctx, `SELECT user_id FROM room_members WHERE room_id = $1 AND role = 'admin'`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,29 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// GetRoomRegion returns roomID's data region, "" for the default.
+func (s *Store) GetRoomRegion(ctx context.Context, roomID uuid.UUID) (string, error) {
+	ctx, done := s.op(ctx, "GetRoomRegion")
+	defer done()
+	var region string
+	err := s.DB.QueryRowContext(ctx, `SELECT region FROM rooms WHERE id = $1`, roomID).Scan(&region)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return region, err
+}
+
+// SetRoomRegion retags a room. Media already uploaded stays where it was
+// stored.
+func (s *Store) SetRoomRegion(ctx context.Context, roomID uuid.UUID, region string) error {
+	ctx, done := s.op(ctx, "SetRoomRegion")
+	defer done()
+	return s.execOne(ctx, `UPDATE rooms SET region = $2 WHERE id = $1`, roomID, region)
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrRepoLinked is returned when a room already links that repository.
+var ErrRepoLinked = errors.New("repository already linked")
+
+// RepoLink connects a GitHub or GitLab repository to a room. Secret is only
+// filled in where the webhook is verified and when the link is created.
+type RepoLink struct {
+	ID        int64      `json:"id"`
+	RoomID    uuid.UUID  `json:"room_id"`
+	Provider  string     `json:"provider"`
+	Repo      string     `json:"repo"`
+	Secret    string     `json:"secret,omitempty"`
+	Events    []string   `json:"events"`
+	CreatedBy *uuid.UUID `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+const repoLinkColumns = `id, room_id, provider, repo, secret, array_to_string(events, ','), created_by, created_at`
+
+func scanRepoLink(row interface{ Scan(...any) error }) (RepoLink, error) {
+	var l RepoLink
+	var events string
+	err := row.Scan(&l.ID, &l.RoomID, &l.Provider, &l.Repo, &l.Secret, &events, &l.CreatedBy, &l.CreatedAt)
+	l.Events = []string{}
+	if events != "" {
+		l.Events = strings.Split(events, ",")
+	}
+	return l, err
+}
+
+// ListRepoLinks returns roomID's linked repositories, without secrets.
+func (s *Store) ListRepoLinks(ctx context.Context, roomID uuid.UUID) ([]RepoLink, error) {
+	ctx, done := s.op(ctx, "ListRepoLinks")
+	defer done()
+	rows, err := s.DB.QueryContext(ctx, `SELECT `+repoLinkColumns+` FROM room_repo_links WHERE room_id = $1 ORDER BY id`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []RepoLink{}
+	for rows.Next() {
+		l, err := scanRepoLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		l.Secret = ""
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+// GetRepoLink returns link id, secret included.
+func (s *Store) GetRepoLink(ctx context.Context, id int64) (RepoLink, error) {
+	ctx, done := s.op(ctx, "GetRepoLink")
+	defer done()
+	l, err := scanRepoLink(s.DB.QueryRowContext(ctx, `SELECT `+repoLinkColumns+` FROM room_repo_links WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return RepoLink{}, ErrNotFound
+	}
+	return l, err
+}
+
+// CreateRepoLink adds l to its room, or returns ErrRepoLinked.
+func (s *Store) CreateRepoLink(ctx context.Context, l RepoLink) (RepoLink, error) {
+	ctx, done := s.op(ctx, "CreateRepoLink")
+	defer done()
+	err := s.DB.QueryRowContext(ctx, `
+		INSERT INTO room_repo_links (room_id, provider, repo, secret, events, created_by)
+		VALUES ($1, $2, $3, $4, $5::text[], $6)
+		ON CONFLICT (room_id, provider, repo) DO NOTHING
+		RETURNING id, created_at
+	`, l.RoomID, l.Provider, l.Repo, l.Secret, l.Events, l.CreatedBy).Scan(&l.ID, &l.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return RepoLink{}, ErrRepoLinked
+	}
+	if err != nil {
+		return RepoLink{}, err
+	}
+	return l, nil
+}
+
+// SetRepoLinkEvents changes which event kinds roomID's link id posts.
+func (s *Store) SetRepoLinkEvents(ctx context.Context, roomID uuid.UUID, id int64, events []string) error {
+	ctx, done := s.op(ctx, "SetRepoLinkEvents")
+	defer done()
+	return s.execOne(ctx, `UPDATE room_repo_links SET events = $3::text[] WHERE room_id = $1 AND id = $2`, roomID, id, events)
+}
+
+// DeleteRepoLink unlinks roomID's link id.
+func (s *Store) DeleteRepoLink(ctx context.Context, roomID uuid.UUID, id int64) error {
+	ctx, done := s.op(ctx, "DeleteRepoLink")
+	defer done()
+	return s.execOne(ctx, `DELETE FROM room_repo_links WHERE room_id = $1 AND id = $2`, roomID, id)
+}
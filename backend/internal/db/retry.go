@@ -0,0 +1,286 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"talkie/backend/internal/metrics"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// Transient Postgres errors are retried below database/sql, in a wrapper
+// around the pgx driver, so every Store method gets the same treatment.
+// Statements outside a transaction that Postgres rolled back on its own
+// (serialization failures, deadlocks) are run again on the same
+// connection. Statements the server refused because it is going away or
+// became a read-only standby are handed back to database/sql as
+// driver.ErrBadConn, which retries them on a fresh connection; opening
+// that connection backs off while the database is unreachable. Nothing is
+// retried when the statement may have run, or inside a transaction, which
+// Postgres aborts as a whole. Everything stays bounded by the operation's
+// timeout (see op).
+
+const (
+	// maxStatementRetries is how often a rolled-back statement is rerun.
+	maxStatementRetries = 3
+	retryBaseDelay      = 50 * time.Millisecond
+	retryMaxDelay       = time.Second
+
+	// breakerThreshold failed connection attempts in a row open the
+	// circuit for breakerCooldown, during which nobody dials: callers wait
+	// for the cooldown, or fail at once when their deadline comes first.
+	// One dial is let through after it, closing the circuit if it works.
+	breakerThreshold = 5
+	breakerCooldown  = 5 * time.Second
+)
+
+// ErrUnavailable is returned when the circuit is open and the caller's
+// deadline comes before the next connection attempt.
+var ErrUnavailable = errors.New("db: database unavailable")
+
+var (
+	retries        = metrics.NewCounterVec("talkie_db_retries_total", "Statements and connection attempts retried after a transient database error, by reason.", "reason")
+	circuitOpen    = metrics.NewGauge("talkie_db_circuit_open", "1 while the database circuit breaker is open.")
+	circuitOpens   = metrics.NewCounter("talkie_db_circuit_opens_total", "Times the database circuit breaker opened.")
+	circuitRejects = metrics.NewCounter("talkie_db_circuit_rejected_total", "Connection attempts failed fast because the database circuit breaker was open.")
+)
+
+// retryReason names the transient error err is, or returns "" when err is
+// not one worth retrying. Only errors Postgres reported in answer to the
+// statement count, so the statement is known not to have taken effect.
+func retryReason(err error) string {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return ""
+	}
+	switch {
+	case pgErr.Code == "40001":
+		return "serialization"
+	case pgErr.Code == "40P01":
+		return "deadlock"
+	case pgErr.Code == "25006":
+		// The server we reach was demoted to a standby by a failover.
+		return "read_only"
+	case pgErr.Code == "57P01", pgErr.Code == "57P02", pgErr.Code == "57P03", strings.HasPrefix(pgErr.Code, "08"):
+		return "connection"
+	}
+	return ""
+}
+
+// permanentConnectError reports whether a failed connection attempt will
+// fail again however long we wait: bad credentials or a missing database.
+func permanentConnectError(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return strings.HasPrefix(pgErr.Code, "28") || pgErr.Code == "3D000"
+	}
+	return false
+}
+
+// backoff waits before retry attempt n (from 0), or returns ctx's error.
+func backoff(ctx context.Context, n int) error {
+	d := min(retryBaseDelay<<n, retryMaxDelay)
+	d = d/2 + rand.N(d/2+1)
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// breaker is the circuit breaker in front of new connections.
+type breaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// wait blocks until a connection may be attempted. It fails with
+// ErrUnavailable when ctx's deadline comes before that.
+func (b *breaker) wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		if b.failures < breakerThreshold {
+			b.mu.Unlock()
+			return nil
+		}
+		now := time.Now()
+		if !b.probing && !now.Before(b.openUntil) {
+			b.probing = true
+			b.mu.Unlock()
+			return nil
+		}
+		// Open, or another caller's dial is deciding: look again when the
+		// cooldown ends, or shortly.
+		next := b.openUntil
+		if b.probing {
+			next = now.Add(retryMaxDelay)
+		}
+		b.mu.Unlock()
+
+		if deadline, ok := ctx.Deadline(); ok && deadline.Before(next) {
+			circuitRejects.Inc()
+			return ErrUnavailable
+		}
+		t := time.NewTimer(next.Sub(now))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+func (b *breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if err == nil {
+		b.failures = 0
+		circuitOpen.Set(0)
+		return
+	}
+	b.failures++
+	if b.failures >= breakerThreshold {
+		if b.failures == breakerThreshold {
+			circuitOpens.Inc()
+		}
+		b.openUntil = time.Now().Add(breakerCooldown)
+		circuitOpen.Set(1)
+	}
+}
+
+// retryConnector opens connections through base, backing off and retrying
+// while the database is unreachable.
+type retryConnector struct {
+	base    driver.Connector
+	breaker *breaker
+}
+
+func newRetryConnector(base driver.Connector) *retryConnector {
+	return &retryConnector{base: base, breaker: &breaker{}}
+}
+
+func (c *retryConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	for n := 0; ; n++ {
+		if err := c.breaker.wait(ctx); err != nil {
+			return nil, err
+		}
+		conn, err := c.base.Connect(ctx)
+		c.breaker.record(err)
+		if err == nil {
+			if pc, ok := conn.(*stdlib.Conn); ok {
+				return &retryConn{Conn: pc}, nil
+			}
+			return conn, nil
+		}
+		if ctx.Err() != nil || permanentConnectError(err) {
+			return nil, err
+		}
+		retries.With("connect").Add(1)
+		if err := backoff(ctx, n); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *retryConnector) Driver() driver.Driver { return c.base.Driver() }
+
+// retryConn is a pgx connection that retries statements run outside a
+// transaction. Everything else is the pgx connection's own.
+type retryConn struct {
+	*stdlib.Conn
+	inTx bool
+}
+
+func (c *retryConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	for n := 0; ; n++ {
+		res, err := c.Conn.ExecContext(ctx, query, args)
+		if err = c.retry(ctx, err, n); err != errRetry {
+			return res, err
+		}
+	}
+}
+
+func (c *retryConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	for n := 0; ; n++ {
+		rows, err := c.Conn.QueryContext(ctx, query, args)
+		if err = c.retry(ctx, err, n); err != errRetry {
+			return rows, err
+		}
+	}
+}
+
+var errRetry = errors.New("db: retry statement")
+
+// retry decides what to do after attempt n of a statement failed with err:
+// errRetry to run it again here, driver.ErrBadConn to have database/sql
+// run it on another connection, or the error to return.
+func (c *retryConn) retry(ctx context.Context, err error, n int) error {
+	if err == nil || c.inTx {
+		return err
+	}
+	reason := retryReason(err)
+	switch reason {
+	case "":
+		return err
+	case "serialization", "deadlock":
+		if n >= maxStatementRetries {
+			return err
+		}
+		retries.With(reason).Add(1)
+		if backoff(ctx, n) != nil {
+			return err
+		}
+		return errRetry
+	}
+	// The connection is going away or points at a standby; drop it.
+	retries.With(reason).Add(1)
+	_ = c.Conn.Close()
+	return driver.ErrBadConn
+}
+
+func (c *retryConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *retryConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	tx, err := c.Conn.BeginTx(ctx, opts)
+	if err != nil {
+		if reason := retryReason(err); reason != "" && reason != "serialization" && reason != "deadlock" {
+			retries.With(reason).Add(1)
+			_ = c.Conn.Close()
+			return nil, driver.ErrBadConn
+		}
+		return nil, err
+	}
+	c.inTx = true
+	return &retryTx{Tx: tx, conn: c}, nil
+}
+
+type retryTx struct {
+	driver.Tx
+	conn *retryConn
+}
+
+func (t *retryTx) Commit() error {
+	t.conn.inTx = false
+	return t.Tx.Commit()
+}
+
+func (t *retryTx) Rollback() error {
+	t.conn.inTx = false
+	return t.Tx.Rollback()
+}
@@ -0,0 +1,107 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Rich presence activity types.
+const (
+	ActivityPlaying   = "playing"
+	ActivityListening = "listening"
+	ActivityWatching  = "watching"
+	ActivityMeeting   = "meeting"
+	ActivityCustom    = "custom"
+)
+
+// RichPresence is what a user is doing according to one source, such as
+// a music player integration or a calendar. It is dropped at ExpiresAt
+// unless the source sets it again.
+type RichPresence struct {
+	UserID    uuid.UUID `json:"user_id"`
+	Source    string    `json:"source"`
+	Type      string    `json:"type"`
+	Text      string    `json:"text"`
+	IconURL   string    `json:"icon_url,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SetRichPresence creates or refreshes p's source entry for p.UserID.
+func (s *Store) SetRichPresence(ctx context.Context, p RichPresence) (RichPresence, error) {
+	ctx, done := s.op(ctx, "SetRichPresence")
+	defer done()
+	err := s.DB.QueryRowContext(ctx, `
+		INSERT INTO user_rich_presence (user_id, source, activity_type, text, icon_url, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, source) DO UPDATE
+		SET activity_type = EXCLUDED.activity_type, text = EXCLUDED.text, icon_url = EXCLUDED.icon_url,
+		    expires_at = EXCLUDED.expires_at, updated_at = NOW()
+		RETURNING updated_at
+	`, p.UserID, p.Source, p.Type, p.Text, p.IconURL, p.ExpiresAt).Scan(&p.UpdatedAt)
+	return p, err
+}
+
+// ClearRichPresence removes userID's entry from source.
+func (s *Store) ClearRichPresence(ctx context.Context, userID uuid.UUID, source string) error {
+	ctx, done := s.op(ctx, "ClearRichPresence")
+	defer done()
+	return s.execOne(ctx, `DELETE FROM user_rich_presence WHERE user_id = $1 AND source = $2`, userID, source)
+}
+
+// ListRichPresence returns the unexpired entries of userIDs, most recently
+// updated first.
+func (s *Store) ListRichPresence(ctx context.Context, userIDs []uuid.UUID) ([]RichPresence, error) {
+	ctx, done := s.op(ctx, "ListRichPresence")
+	defer done()
+	out := []RichPresence{}
+	if len(userIDs) == 0 {
+		return out, nil
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT user_id, source, activity_type, text, icon_url, expires_at, updated_at
+		FROM user_rich_presence
+		WHERE user_id = ANY($1::uuid[]) AND expires_at > NOW()
+		ORDER BY updated_at DESC, source
+	`, uuidStrings(userIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p RichPresence
+		if err := rows.Scan(&p.UserID, &p.Source, &p.Type, &p.Text, &p.IconURL, &p.ExpiresAt, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// DeleteExpiredRichPresence drops entries their sources stopped refreshing
+// and returns the users who lost one.
+func (s *Store) DeleteExpiredRichPresence(ctx context.Context) ([]uuid.UUID, error) {
+	ctx, done := s.op(ctx, "DeleteExpiredRichPresence")
+	defer done()
+	rows, err := s.DB.QueryContext(ctx, `
+		WITH expired AS (
+			DELETE FROM user_rich_presence WHERE expires_at <= NOW() RETURNING user_id
+		)
+		SELECT DISTINCT user_id FROM expired
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var users []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		users = append(users, id)
+	}
+	return users, rows.Err()
+}
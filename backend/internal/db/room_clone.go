@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// CloneRoom creates a room called name for userID with roomID's settings
+// and automod rules, all in one transaction. userID is the new room's
+// admin; with withMembers the source's other members come along with their
+// roles, logged as joined via clone. Messages, invite links, subscribers
+// and pending join requests stay behind. A welcome greeting that was set
+// up is posted as userID in the copy.
+func (s *Store) CloneRoom(ctx context.Context, roomID, userID uuid.UUID, name string, withMembers bool) (Room, error) {
+	ctx, done := s.op(ctx, "CloneRoom")
+	defer done()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Room{}, err
+	}
+	defer tx.Rollback()
+
+	var r Room
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO rooms (name, created_by, is_private, language, region, nsfw, room_mentions,
+		                   welcome_mode, welcome_template, welcome_sender, word_mask, masked_words,
+		                   raid_mode, persist_call_chat, unlisted, broadcast, media_allowed, media_blocked)
+		SELECT $2, $3, is_private, language, region, nsfw, room_mentions,
+		       welcome_mode, welcome_template, CASE WHEN welcome_sender IS NULL THEN NULL ELSE $3::uuid END,
+		       word_mask, masked_words, raid_mode, persist_call_chat, unlisted, broadcast, media_allowed, media_blocked
+		FROM rooms
+		WHERE id = $1
+		RETURNING id, name, created_by, is_private, created_at
+	`, roomID, name, userID).Scan(&r.ID, &r.Name, &r.CreatedBy, &r.IsPrivate, &r.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Room{}, ErrNotFound
+	}
+	if err != nil {
+		return Room{}, err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO room_members (room_id, user_id, role) VALUES ($1, $2, 'admin')`, r.ID, userID); err != nil {
+		return Room{}, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO automod_rules (room_id, kind, config, action, mute_minutes, enabled, created_by)
+		SELECT $1, kind, config, action, mute_minutes, enabled, $3
+		FROM automod_rules
+		WHERE room_id = $2
+		ORDER BY id
+	`, r.ID, roomID, userID); err != nil {
+		return Room{}, err
+	}
+	if withMembers {
+		// Guests only ever belong to the room their link was for.
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO room_members (room_id, user_id, role)
+			SELECT $1, rm.user_id, rm.role
+			FROM room_members rm
+			JOIN users u ON u.id = rm.user_id
+			WHERE rm.room_id = $2
+			  AND rm.user_id <> $3
+			  AND u.guest_expires_at IS NULL
+			ON CONFLICT DO NOTHING
+		`, r.ID, roomID, userID); err != nil {
+			return Room{}, err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO room_membership_events (room_id, user_id, actor_id, action, via)
+			SELECT $1, user_id, $2, $3, $4
+			FROM room_members
+			WHERE room_id = $1 AND user_id <> $2
+		`, r.ID, userID, MembershipJoined, ViaClone); err != nil {
+			return Room{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return Room{}, err
+	}
+	r.MyRole = "admin"
+	r.CanManage = true
+	return r, nil
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrCommandExists is returned when a room already has a command by that
+// name.
+var ErrCommandExists = errors.New("command already exists")
+
+// RoomCommand is a custom slash command of a room. Secret signs its
+// invocations; it is only filled in on creation and for invoking.
+type RoomCommand struct {
+	ID          int64      `json:"id"`
+	RoomID      uuid.UUID  `json:"room_id"`
+	Name        string     `json:"name"`
+	URL         string     `json:"url"`
+	Description string     `json:"description,omitempty"`
+	Secret      string     `json:"secret,omitempty"`
+	CreatedBy   *uuid.UUID `json:"created_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// ListRoomCommands returns roomID's commands by name, without secrets.
+func (s *Store) ListRoomCommands(ctx context.Context, roomID uuid.UUID) ([]RoomCommand, error) {
+	ctx, done := s.op(ctx, "ListRoomCommands")
+	defer done()
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, room_id, name, url, description, created_by, created_at
+		FROM room_commands
+		WHERE room_id = $1
+		ORDER BY name
+	`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []RoomCommand{}
+	for rows.Next() {
+		var c RoomCommand
+		if err := rows.Scan(&c.ID, &c.RoomID, &c.Name, &c.URL, &c.Description, &c.CreatedBy, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// GetRoomCommand returns roomID's command called name with its secret.
+func (s *Store) GetRoomCommand(ctx context.Context, roomID uuid.UUID, name string) (RoomCommand, error) {
+	ctx, done := s.op(ctx, "GetRoomCommand")
+	defer done()
+	var c RoomCommand
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT id, room_id, name, url, description, secret, created_by, created_at
+		FROM room_commands
+		WHERE room_id = $1 AND name = $2
+	`, roomID, name).Scan(&c.ID, &c.RoomID, &c.Name, &c.URL, &c.Description, &c.Secret, &c.CreatedBy, &c.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return RoomCommand{}, ErrNotFound
+	}
+	return c, err
+}
+
+// CreateRoomCommand adds c to its room, or returns ErrCommandExists.
+func (s *Store) CreateRoomCommand(ctx context.Context, c RoomCommand) (RoomCommand, error) {
+	ctx, done := s.op(ctx, "CreateRoomCommand")
+	defer done()
+	err := s.DB.QueryRowContext(ctx, `
+		INSERT INTO room_commands (room_id, name, url, secret, description, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (room_id, name) DO NOTHING
+		RETURNING id, created_at
+	`, c.RoomID, c.Name, c.URL, c.Secret, c.Description, c.CreatedBy).Scan(&c.ID, &c.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return RoomCommand{}, ErrCommandExists
+	}
+	if err != nil {
+		return RoomCommand{}, err
+	}
+	return c, nil
+}
+
+// DeleteRoomCommand removes roomID's command called name.
+func (s *Store) DeleteRoomCommand(ctx context.Context, roomID uuid.UUID, name string) error {
+	ctx, done := s.op(ctx, "DeleteRoomCommand")
+	defer done()
+	return s.execOne(ctx, `DELETE FROM room_commands WHERE room_id = $1 AND name = $2`, roomID, name)
+}
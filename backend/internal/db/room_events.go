@@ -0,0 +1,103 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RoomEvent is one entry of a room's persisted event stream. Types are
+// message_created, message_edited, message_deleted, member_joined,
+// member_left and member_role_changed. Data holds the message content or
+// member role as of the event, so replaying the stream in Seq order
+// rebuilds the room's state.
+type RoomEvent struct {
+	Seq       int64           `json:"seq"`
+	Type      string          `json:"type"`
+	UserID    *uuid.UUID      `json:"user_id,omitempty"`
+	Username  string          `json:"username,omitempty"`
+	MessageID *int64          `json:"message_id,omitempty"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// ListRoomEvents returns events with seq > since in order, and the room's
+// latest sequence number.
+func (s *Store) ListRoomEvents(ctx context.Context, roomID uuid.UUID, since int64, limit int) ([]RoomEvent, int64, error) {
+	ctx, done := s.op(ctx, "ListRoomEvents")
+	defer done()
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	var latest int64
+	err := s.DB.QueryRowContext(ctx, `SELECT event_seq FROM rooms WHERE id = $1`, roomID).Scan(&latest)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, 0, ErrNotFound
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT e.seq, e.type, e.user_id, COALESCE(u.username, ''), e.message_id, e.data, e.created_at
+		FROM room_events e
+		LEFT JOIN users u ON u.id = e.user_id
+		WHERE e.room_id = $1 AND e.seq > $2
+		ORDER BY e.seq ASC
+		LIMIT $3
+	`, roomID, since, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	events := []RoomEvent{}
+	for rows.Next() {
+		var e RoomEvent
+		var userID uuid.NullUUID
+		var messageID sql.NullInt64
+		var data []byte
+		if err := rows.Scan(&e.Seq, &e.Type, &userID, &e.Username, &messageID, &data, &e.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		if userID.Valid {
+			e.UserID = &userID.UUID
+		}
+		e.MessageID = nullInt64Ptr(messageID)
+		e.Data = json.RawMessage(data)
+		events = append(events, e)
+	}
+	return events, latest, rows.Err()
+}
+
+// ListDeletedMessageIDs returns the IDs of up to limit messages deleted
+// from roomID with fromID <= ID < beforeID, newest first: the tombstones
+// for a page of history covering that range.
+func (s *Store) ListDeletedMessageIDs(ctx context.Context, roomID uuid.UUID, fromID, beforeID int64, limit int) ([]int64, error) {
+	ctx, done := s.op(ctx, "ListDeletedMessageIDs")
+	defer done()
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT DISTINCT message_id
+		FROM room_events
+		WHERE room_id = $1 AND type = 'message_deleted'
+		  AND message_id >= $2 AND message_id < $3
+		ORDER BY message_id DESC
+		LIMIT $4
+	`, roomID, fromID, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
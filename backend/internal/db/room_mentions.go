@@ -0,0 +1,30 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// RoomMentionPolicies are who may notify the whole room with @room or
+// @here: room admins, every member, or nobody.
+var RoomMentionPolicies = []string{"admins", "members", "off"}
+
+func (s *Store) GetRoomMentionPolicy(ctx context.Context, roomID uuid.UUID) (string, error) {
+	ctx, done := s.op(ctx, "GetRoomMentionPolicy")
+	defer done()
+	var policy string
+	err := s.DB.QueryRowContext(ctx, `SELECT room_mentions FROM rooms WHERE id = $1`, roomID).Scan(&policy)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return policy, err
+}
+
+func (s *Store) SetRoomMentionPolicy(ctx context.Context, roomID uuid.UUID, policy string) error {
+	ctx, done := s.op(ctx, "SetRoomMentionPolicy")
+	defer done()
+	return s.execOne(ctx, `UPDATE rooms SET room_mentions = $2 WHERE id = $1`, roomID, policy)
+}
@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RoomSettings gathers a room's settings, each of which also has its own
+// endpoint. Unlisted, RaidMode and WordMask are for room admins only.
+type RoomSettings struct {
+	NSFW            bool        `json:"nsfw"`
+	Language        string      `json:"language"`
+	Region          string      `json:"region"`
+	MentionPolicy   string      `json:"mention_policy"`
+	PersistCallChat bool        `json:"persist_call_chat"`
+	Broadcast       bool        `json:"broadcast"`
+	MediaPolicy     MediaPolicy `json:"media_policy"`
+	Welcome         RoomWelcome `json:"welcome"`
+	Unlisted        *bool       `json:"unlisted,omitempty"`
+	RaidMode        *bool       `json:"raid_mode,omitempty"`
+	WordMask        *WordMask   `json:"word_mask,omitempty"`
+}
+
+// GetRoomSettings reads every setting of roomID in one query.
+func (s *Store) GetRoomSettings(ctx context.Context, roomID uuid.UUID) (RoomSettings, error) {
+	ctx, done := s.op(ctx, "GetRoomSettings")
+	defer done()
+	var st RoomSettings
+	var allowed, blocked string
+	var sender uuid.NullUUID
+	var unlisted, raid, masked bool
+	var words []byte
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT nsfw, language, region, room_mentions, persist_call_chat, broadcast,
+		       array_to_string(media_allowed, ','), array_to_string(media_blocked, ','),
+		       welcome_mode, welcome_template, welcome_sender,
+		       unlisted, raid_mode, word_mask, masked_words
+		FROM rooms WHERE id = $1
+	`, roomID).Scan(&st.NSFW, &st.Language, &st.Region, &st.MentionPolicy, &st.PersistCallChat, &st.Broadcast,
+		&allowed, &blocked,
+		&st.Welcome.Mode, &st.Welcome.Template, &sender,
+		&unlisted, &raid, &masked, &words)
+	if errors.Is(err, sql.ErrNoRows) {
+		return RoomSettings{}, ErrNotFound
+	}
+	if err != nil {
+		return RoomSettings{}, err
+	}
+	st.MediaPolicy = MediaPolicy{Allowed: []string{}, Blocked: []string{}}
+	if allowed != "" {
+		st.MediaPolicy.Allowed = strings.Split(allowed, ",")
+	}
+	if blocked != "" {
+		st.MediaPolicy.Blocked = strings.Split(blocked, ",")
+	}
+	if sender.Valid {
+		st.Welcome.SenderID = &sender.UUID
+	}
+	wm := WordMask{Enabled: masked}
+	if err := json.Unmarshal(words, &wm.Words); err != nil {
+		return RoomSettings{}, err
+	}
+	if wm.Words == nil {
+		wm.Words = []string{}
+	}
+	st.Unlisted, st.RaidMode, st.WordMask = &unlisted, &raid, &wm
+	return st, nil
+}
+
+// RoomMemberDetail is a member with what moderation needs to know about
+// them in the room.
+type RoomMemberDetail struct {
+	ID         uuid.UUID  `json:"id"`
+	Username   string     `json:"username"`
+	AvatarURL  string     `json:"avatar_url,omitempty"`
+	Role       string     `json:"role"`
+	IsBot      bool       `json:"is_bot,omitempty"`
+	JoinedAt   time.Time  `json:"joined_at"`
+	MutedUntil *time.Time `json:"muted_until,omitempty"`
+}
+
+// ListRoomMemberDetails returns roomID's members by username, with their
+// roles and any mute in force.
+func (s *Store) ListRoomMemberDetails(ctx context.Context, roomID uuid.UUID) ([]RoomMemberDetail, error) {
+	ctx, done := s.op(ctx, "ListRoomMemberDetails")
+	defer done()
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT u.id, u.username, COALESCE(u.avatar_url, ''), rm.role, u.is_bot, rm.joined_at, mu.muted_until
+		FROM room_members rm
+		JOIN users u ON u.id = rm.user_id
+		LEFT JOIN room_mutes mu ON mu.room_id = rm.room_id AND mu.user_id = rm.user_id AND mu.muted_until > NOW()
+		WHERE rm.room_id = $1
+		ORDER BY u.username ASC
+	`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []RoomMemberDetail{}
+	for rows.Next() {
+		var m RoomMemberDetail
+		var muted sql.NullTime
+		if err := rows.Scan(&m.ID, &m.Username, &m.AvatarURL, &m.Role, &m.IsBot, &m.JoinedAt, &muted); err != nil {
+			return nil, err
+		}
+		if muted.Valid {
+			m.MutedUntil = &muted.Time
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RoomSize is how much a room stores and how fast it grows. MediaBytes
+// counts each message's upload in full, even when identical uploads share
+// one file, and leaves out files stored outside this server.
+type RoomSize struct {
+	RoomID          uuid.UUID  `json:"room_id"`
+	Name            string     `json:"name"`
+	Members         int        `json:"members"`
+	Messages        int64      `json:"messages"`
+	MediaMessages   int64      `json:"media_messages"`
+	MediaBytes      int64      `json:"media_bytes"`
+	Messages7d      int64      `json:"messages_7d"`
+	Messages30d     int64      `json:"messages_30d"`
+	MediaBytes30d   int64      `json:"media_bytes_30d"`
+	OldestMessageAt *time.Time `json:"oldest_message_at,omitempty"`
+	// RetentionDays and MaxMembers are the limits of the plan governing
+	// the room, or the defaults; 0 means none.
+	RetentionDays int `json:"retention_days"`
+	MaxMembers    int `json:"max_members"`
+	// ExpiredMessages are older than the retention but still stored: a
+	// legal hold keeps them, or the purge has not reached them yet.
+	ExpiredMessages int64 `json:"expired_messages"`
+	LegalHold       bool  `json:"legal_hold"`
+}
+
+// Orders for ListRoomSizes, largest first.
+const (
+	RoomSizeByMessages   = "messages"
+	RoomSizeByMediaBytes = "media_bytes"
+	RoomSizeByGrowth     = "growth"
+)
+
+var roomSizeOrder = map[string]string{
+	RoomSizeByMessages:   "messages DESC",
+	RoomSizeByMediaBytes: "media_bytes DESC",
+	RoomSizeByGrowth:     "messages_7d DESC, media_bytes_30d DESC",
+}
+
+// RoomSizeFilter narrows ListRoomSizes. DefaultHistoryDays and
+// DefaultMaxMembers apply to rooms whose plan leaves them unset.
+type RoomSizeFilter struct {
+	RoomID             uuid.UUID
+	OrderBy            string
+	Limit              int
+	DefaultHistoryDays int
+	DefaultMaxMembers  int
+}
+
+// ValidRoomSizeOrder reports whether order is one ListRoomSizes takes.
+func ValidRoomSizeOrder(order string) bool {
+	_, ok := roomSizeOrder[order]
+	return ok
+}
+
+// ListRoomSizes reports the largest rooms by f.OrderBy, or only f.RoomID
+// when it is set. It counts every message in the rooms it reports on, so
+// it is meant for operators rather than anything run per request.
+func (s *Store) ListRoomSizes(ctx context.Context, f RoomSizeFilter) ([]RoomSize, error) {
+	ctx, done := s.op(ctx, "ListRoomSizes")
+	defer done()
+	order, ok := roomSizeOrder[f.OrderBy]
+	if !ok {
+		order = roomSizeOrder[RoomSizeByMessages]
+	}
+	if f.Limit <= 0 || f.Limit > 500 {
+		f.Limit = 50
+	}
+	var roomID *uuid.UUID
+	if f.RoomID != uuid.Nil {
+		roomID = &f.RoomID
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		WITH limits AS (
+			SELECT r.id AS room_id, r.name,
+			       COALESCE(p.history_days, $1) AS retention_days,
+			       COALESCE(p.max_room_members, $2) AS max_members
+			FROM rooms r
+			JOIN users u ON u.id = r.created_by
+			LEFT JOIN group_channels gc ON gc.room_id = r.id
+			LEFT JOIN room_groups g ON g.id = gc.group_id
+			LEFT JOIN plans p ON p.name = COALESCE(g.plan, u.plan)
+			WHERE $3::uuid IS NULL OR r.id = $3
+		), counts AS (
+			SELECT m.room_id,
+			       COUNT(*) AS messages,
+			       COUNT(m.media_url) AS media_messages,
+			       COALESCE(SUM(b.size), 0) AS media_bytes,
+			       COUNT(*) FILTER (WHERE m.created_at > NOW() - INTERVAL '7 days') AS messages_7d,
+			       COUNT(*) FILTER (WHERE m.created_at > NOW() - INTERVAL '30 days') AS messages_30d,
+			       COALESCE(SUM(b.size) FILTER (WHERE m.created_at > NOW() - INTERVAL '30 days'), 0) AS media_bytes_30d,
+			       MIN(m.created_at) AS oldest,
+			       COUNT(*) FILTER (WHERE l.retention_days > 0 AND m.created_at < NOW() - make_interval(days => l.retention_days)) AS expired
+			FROM messages m
+			JOIN limits l ON l.room_id = m.room_id
+			LEFT JOIN upload_blobs b ON b.url = m.media_url
+			GROUP BY m.room_id
+		)
+		SELECT l.room_id, l.name,
+		       (SELECT COUNT(*) FROM room_members rm WHERE rm.room_id = l.room_id),
+		       COALESCE(c.messages, 0) AS messages, COALESCE(c.media_messages, 0),
+		       COALESCE(c.media_bytes, 0) AS media_bytes, COALESCE(c.messages_7d, 0) AS messages_7d,
+		       COALESCE(c.messages_30d, 0), COALESCE(c.media_bytes_30d, 0) AS media_bytes_30d,
+		       c.oldest, l.retention_days, l.max_members, COALESCE(c.expired, 0),
+		       EXISTS (SELECT 1 FROM legal_holds h WHERE h.released_at IS NULL AND h.room_id = l.room_id)
+		FROM limits l
+		LEFT JOIN counts c ON c.room_id = l.room_id
+		ORDER BY `+order+`, l.room_id
+		LIMIT $4
+	`, f.DefaultHistoryDays, f.DefaultMaxMembers, roomID, f.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []RoomSize{}
+	for rows.Next() {
+		var rs RoomSize
+		if err := rows.Scan(&rs.RoomID, &rs.Name, &rs.Members, &rs.Messages, &rs.MediaMessages, &rs.MediaBytes, &rs.Messages7d, &rs.Messages30d, &rs.MediaBytes30d, &rs.OldestMessageAt, &rs.RetentionDays, &rs.MaxMembers, &rs.ExpiredMessages, &rs.LegalHold); err != nil {
+			return nil, err
+		}
+		out = append(out, rs)
+	}
+	return out, rows.Err()
+}
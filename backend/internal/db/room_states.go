@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+// RoomUnreadState is one room's read position for a user.
+type RoomUnreadState struct {
+	RoomID               uuid.UUID
+	LastReadMessageID    int64
+	UnreadCount          int
+	FirstUnreadMessageID *int64
+}
+
+// ListRoomUnreadStates validates membership and loads unread state for many
+// rooms in one query. Rooms the user is not a member of are left out.
+func (s *Store) ListRoomUnreadStates(ctx context.Context, userID uuid.UUID, roomIDs []uuid.UUID) ([]RoomUnreadState, error) {
+	ctx, done := s.op(ctx, "ListRoomUnreadStates")
+	defer done()
+	if len(roomIDs) == 0 {
+		return []RoomUnreadState{}, nil
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT r.id, COALESCE(rm.last_read_message_id, 0), `+unreadColumns+`
+		FROM rooms r
+		JOIN room_members rm ON rm.room_id = r.id AND rm.user_id = $1
+		WHERE r.id = ANY($2::uuid[])
+	`, userID, uuidStrings(roomIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]RoomUnreadState, 0, len(roomIDs))
+	for rows.Next() {
+		var st RoomUnreadState
+		var firstUnread sql.NullInt64
+		if err := rows.Scan(&st.RoomID, &st.LastReadMessageID, &st.UnreadCount, &firstUnread); err != nil {
+			return nil, err
+		}
+		st.FirstUnreadMessageID = nullInt64Ptr(firstUnread)
+		out = append(out, st)
+	}
+	return out, rows.Err()
+}
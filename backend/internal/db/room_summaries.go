@@ -0,0 +1,49 @@
+package db
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// summaryFirstUnread is the oldest message the member rm has not read,
+// by the same rules as room_members.unread_count.
+const summaryFirstUnread = `(SELECT MIN(mu.id) FROM messages mu WHERE mu.room_id = rm.room_id AND mu.id > COALESCE(rm.last_read_message_id, 0) AND mu.user_id <> rm.user_id AND NOT mu.shadowed)`
+
+// refreshRoomSummariesSQL recomputes room_summaries from room_members and
+// messages for the members matching where, writing only rows that changed.
+func refreshRoomSummariesSQL(where string) string {
+	return `
+		UPDATE room_summaries rs
+		SET last_message_id = fresh.last_message_id,
+		    last_message_at = fresh.last_message_at,
+		    unread_count = fresh.unread_count,
+		    first_unread_id = fresh.first_unread_id,
+		    updated_at = NOW()
+		FROM (
+			SELECT rm.room_id, rm.user_id, latest.id AS last_message_id, latest.created_at AS last_message_at,
+			       rm.unread_count, ` + summaryFirstUnread + ` AS first_unread_id
+			FROM room_members rm
+			LEFT JOIN LATERAL (
+				SELECT m.id, m.created_at FROM messages m
+				WHERE m.room_id = rm.room_id AND (NOT m.shadowed OR m.user_id = rm.user_id)
+				ORDER BY m.id DESC
+				LIMIT 1
+			) latest ON TRUE
+			WHERE ` + where + `
+		) fresh
+		WHERE rs.room_id = fresh.room_id AND rs.user_id = fresh.user_id
+		  AND (rs.last_message_id, rs.unread_count, rs.first_unread_id)
+		      IS DISTINCT FROM (fresh.last_message_id, fresh.unread_count, fresh.first_unread_id)
+	`
+}
+
+// RefreshRoomSummaries brings every member's summary of the given rooms up
+// to date. It reads room_members.unread_count, so it runs after
+// RefreshUnreadCounts.
+func (s *Store) RefreshRoomSummaries(ctx context.Context, roomIDs []uuid.UUID) error {
+	ctx, done := s.op(ctx, "RefreshRoomSummaries")
+	defer done()
+	_, err := s.DB.ExecContext(ctx, refreshRoomSummariesSQL(`rm.room_id = ANY($1::uuid[])`), uuidStrings(roomIDs))
+	return err
+}
@@ -0,0 +1,745 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrSCIMConflict is returned when a SCIM userName or group
+	// displayName is taken, or the account is already under SCIM.
+	ErrSCIMConflict = errors.New("already provisioned")
+	// ErrSCIMFilter is returned for a filter on an attribute that cannot
+	// be filtered on.
+	ErrSCIMFilter = errors.New("unsupported filter")
+)
+
+// SCIMToken lets an identity provider call the SCIM API. Only its hash is
+// stored.
+type SCIMToken struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	CreatedBy  *uuid.UUID `json:"created_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// SCIMUser is an account managed through SCIM. UserName, ExternalID and
+// DisplayName are the identity provider's; Email, Username and Active are
+// the account's own.
+type SCIMUser struct {
+	UserID      uuid.UUID
+	UserName    string
+	ExternalID  string
+	DisplayName string
+	Email       string
+	Username    string
+	Active      bool
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// SCIMGroup is an identity provider group. Its members are kept in the
+// workspace GroupID or the room RoomID, whichever an admin set, if any.
+type SCIMGroup struct {
+	ID          uuid.UUID    `json:"id"`
+	DisplayName string       `json:"display_name"`
+	ExternalID  string       `json:"external_id,omitempty"`
+	GroupID     *uuid.UUID   `json:"group_id,omitempty"`
+	RoomID      *uuid.UUID   `json:"room_id,omitempty"`
+	Members     []SCIMMember `json:"members"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+type SCIMMember struct {
+	UserID   uuid.UUID `json:"user_id"`
+	UserName string    `json:"user_name"`
+}
+
+// SCIMFilter narrows a SCIM listing to Attr equal to Value. An empty Attr
+// lists everything.
+type SCIMFilter struct {
+	Attr  string
+	Value string
+}
+
+// SCIMRoomChange is a member put in or taken out of a room because of
+// their SCIM groups.
+type SCIMRoomChange struct {
+	UserID uuid.UUID
+	RoomID uuid.UUID
+}
+
+// scimRoomsCTE lists the rooms each SCIM group's members are kept in:
+// every channel of its workspace but direct messages, or its room.
+const scimRoomsCTE = `scim_rooms AS (
+	SELECT sg.id AS scim_group_id, gc.room_id
+	FROM scim_groups sg
+	JOIN group_channels gc ON gc.group_id = sg.group_id
+	LEFT JOIN direct_rooms d ON d.room_id = gc.room_id
+	WHERE d.room_id IS NULL
+	UNION
+	SELECT id, room_id FROM scim_groups WHERE room_id IS NOT NULL
+)`
+
+func (s *Store) CreateSCIMToken(ctx context.Context, name, tokenHash string, createdBy uuid.UUID) (SCIMToken, error) {
+	ctx, done := s.op(ctx, "CreateSCIMToken")
+	defer done()
+	t := SCIMToken{Name: name, CreatedBy: &createdBy}
+	err := s.DB.QueryRowContext(ctx, `
+		INSERT INTO scim_tokens (name, token_hash, created_by)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`, name, tokenHash, createdBy).Scan(&t.ID, &t.CreatedAt)
+	return t, err
+}
+
+func (s *Store) ListSCIMTokens(ctx context.Context) ([]SCIMToken, error) {
+	ctx, done := s.op(ctx, "ListSCIMTokens")
+	defer done()
+	rows, err := s.DB.QueryContext(ctx, `SELECT id, name, created_by, created_at, last_used_at FROM scim_tokens ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []SCIMToken{}
+	for rows.Next() {
+		var t SCIMToken
+		var createdBy uuid.NullUUID
+		if err := rows.Scan(&t.ID, &t.Name, &createdBy, &t.CreatedAt, &t.LastUsedAt); err != nil {
+			return nil, err
+		}
+		if createdBy.Valid {
+			t.CreatedBy = &createdBy.UUID
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+func (s *Store) DeleteSCIMToken(ctx context.Context, id int64) error {
+	ctx, done := s.op(ctx, "DeleteSCIMToken")
+	defer done()
+	return s.execOne(ctx, `DELETE FROM scim_tokens WHERE id = $1`, id)
+}
+
+// UseSCIMToken returns the ID of the token hashing to tokenHash and notes
+// that it was used.
+func (s *Store) UseSCIMToken(ctx context.Context, tokenHash string) (int64, error) {
+	ctx, done := s.op(ctx, "UseSCIMToken")
+	defer done()
+	var id int64
+	err := s.DB.QueryRowContext(ctx, `
+		UPDATE scim_tokens SET last_used_at = NOW()
+		WHERE token_hash = $1
+		RETURNING id
+	`, tokenHash).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	return id, err
+}
+
+const scimUserColumns = `su.user_id, su.user_name, su.external_id, su.display_name, u.email, u.username,
+	u.deactivated_at IS NULL, su.created_at, su.updated_at`
+
+func scanSCIMUser(row interface{ Scan(...any) error }) (SCIMUser, error) {
+	var u SCIMUser
+	err := row.Scan(&u.UserID, &u.UserName, &u.ExternalID, &u.DisplayName, &u.Email, &u.Username,
+		&u.Active, &u.CreatedAt, &u.UpdatedAt)
+	return u, err
+}
+
+func getSCIMUser(ctx context.Context, q dbtx, userID uuid.UUID) (SCIMUser, error) {
+	u, err := scanSCIMUser(q.QueryRowContext(ctx, `
+		SELECT `+scimUserColumns+`
+		FROM scim_users su
+		JOIN users u ON u.id = su.user_id
+		WHERE su.user_id = $1
+	`, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return SCIMUser{}, ErrNotFound
+	}
+	return u, err
+}
+
+func (s *Store) GetSCIMUser(ctx context.Context, userID uuid.UUID) (SCIMUser, error) {
+	ctx, done := s.op(ctx, "GetSCIMUser")
+	defer done()
+	return getSCIMUser(ctx, s.DB, userID)
+}
+
+// scimUserFilters maps the SCIM attributes users can be filtered on to
+// their conditions.
+var scimUserFilters = map[string]string{
+	"":             `$1 = ''`,
+	"id":           `su.user_id::text = $1`,
+	"username":     `LOWER(su.user_name) = LOWER($1)`,
+	"externalid":   `su.external_id = $1`,
+	"emails.value": `u.email = LOWER($1)`,
+}
+
+// ListSCIMUsers returns a page of SCIM users matching f, oldest first,
+// with how many match in all. ErrSCIMFilter means f's attribute cannot be
+// filtered on.
+func (s *Store) ListSCIMUsers(ctx context.Context, f SCIMFilter, offset, limit int) ([]SCIMUser, int, error) {
+	ctx, done := s.op(ctx, "ListSCIMUsers")
+	defer done()
+	where, ok := scimUserFilters[f.Attr]
+	if !ok {
+		return nil, 0, ErrSCIMFilter
+	}
+	var total int
+	if err := s.DB.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM scim_users su JOIN users u ON u.id = su.user_id WHERE `+where, f.Value).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT `+scimUserColumns+`
+		FROM scim_users su
+		JOIN users u ON u.id = su.user_id
+		WHERE `+where+`
+		ORDER BY su.created_at, su.user_id
+		OFFSET $2 LIMIT $3
+	`, f.Value, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	out := []SCIMUser{}
+	for rows.Next() {
+		u, err := scanSCIMUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		out = append(out, u)
+	}
+	return out, total, rows.Err()
+}
+
+// CreateSCIMUser puts u under SCIM. An account with u's email that is not
+// a bot or a guest is taken over; otherwise one is created with username
+// and passwordHash, its email verified, as the identity provider vouches
+// for it. ErrUserExists means the username or email is taken, and
+// ErrSCIMConflict that u's userName or the account is already under SCIM.
+func (s *Store) CreateSCIMUser(ctx context.Context, u SCIMUser, username, passwordHash string) (SCIMUser, error) {
+	ctx, done := s.op(ctx, "CreateSCIMUser")
+	defer done()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return SCIMUser{}, err
+	}
+	defer tx.Rollback()
+	var userID uuid.UUID
+	var adoptable bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, NOT is_bot AND guest_expires_at IS NULL FROM users WHERE email = $1 FOR UPDATE
+	`, u.Email).Scan(&userID, &adoptable)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO users (email, username, password_hash, email_verified)
+			VALUES ($1, $2, $3, TRUE)
+			ON CONFLICT DO NOTHING
+			RETURNING id
+		`, u.Email, username, passwordHash).Scan(&userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return SCIMUser{}, ErrUserExists
+		}
+		if err != nil {
+			return SCIMUser{}, err
+		}
+	case err != nil:
+		return SCIMUser{}, err
+	case !adoptable:
+		return SCIMUser{}, ErrUserExists
+	}
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO scim_users (user_id, user_name, external_id, display_name)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING
+	`, userID, u.UserName, u.ExternalID, u.DisplayName)
+	if err != nil {
+		return SCIMUser{}, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return SCIMUser{}, err
+	} else if n == 0 {
+		return SCIMUser{}, ErrSCIMConflict
+	}
+	if err := setUserActive(ctx, tx, userID, u.Active); err != nil {
+		return SCIMUser{}, err
+	}
+	created, err := getSCIMUser(ctx, tx, userID)
+	if err != nil {
+		return SCIMUser{}, err
+	}
+	return created, tx.Commit()
+}
+
+// UpdateSCIMUser saves u's SCIM attributes, email and whether it is
+// active. Deactivating an account signs it out everywhere. The errors are
+// CreateSCIMUser's, and ErrNotFound when u is not under SCIM.
+func (s *Store) UpdateSCIMUser(ctx context.Context, u SCIMUser) (SCIMUser, error) {
+	ctx, done := s.op(ctx, "UpdateSCIMUser")
+	defer done()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return SCIMUser{}, err
+	}
+	defer tx.Rollback()
+	var taken bool
+	if err := tx.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM scim_users WHERE LOWER(user_name) = LOWER($1) AND user_id <> $2)
+	`, u.UserName, u.UserID).Scan(&taken); err != nil {
+		return SCIMUser{}, err
+	}
+	if taken {
+		return SCIMUser{}, ErrSCIMConflict
+	}
+	res, err := tx.ExecContext(ctx, `
+		UPDATE scim_users
+		SET user_name = $2, external_id = $3, display_name = $4, updated_at = NOW()
+		WHERE user_id = $1
+	`, u.UserID, u.UserName, u.ExternalID, u.DisplayName)
+	if err != nil {
+		return SCIMUser{}, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return SCIMUser{}, err
+	} else if n == 0 {
+		return SCIMUser{}, ErrNotFound
+	}
+	if err := tx.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM users WHERE email = $1 AND id <> $2)
+	`, u.Email, u.UserID).Scan(&taken); err != nil {
+		return SCIMUser{}, err
+	}
+	if taken {
+		return SCIMUser{}, ErrUserExists
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE users SET email = $2, email_verified = TRUE WHERE id = $1 AND email <> $2
+	`, u.UserID, u.Email); err != nil {
+		return SCIMUser{}, err
+	}
+	if err := setUserActive(ctx, tx, u.UserID, u.Active); err != nil {
+		return SCIMUser{}, err
+	}
+	updated, err := getSCIMUser(ctx, tx, u.UserID)
+	if err != nil {
+		return SCIMUser{}, err
+	}
+	return updated, tx.Commit()
+}
+
+// DeleteSCIMUser deactivates userID and takes it out of SCIM, and so out
+// of its SCIM groups. The account and its rooms are kept.
+func (s *Store) DeleteSCIMUser(ctx context.Context, userID uuid.UUID) error {
+	ctx, done := s.op(ctx, "DeleteSCIMUser")
+	defer done()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `DELETE FROM scim_users WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	if err := setUserActive(ctx, tx, userID, false); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// setUserActive deactivates or reactivates userID. Deactivating bumps the
+// session version, so tokens from before stay revoked once it is undone.
+func setUserActive(ctx context.Context, q execer, userID uuid.UUID, active bool) error {
+	_, err := q.ExecContext(ctx, `
+		UPDATE users
+		SET deactivated_at = CASE WHEN $2 THEN NULL ELSE COALESCE(deactivated_at, NOW()) END,
+		    session_version = session_version + CASE WHEN NOT $2 AND deactivated_at IS NULL THEN 1 ELSE 0 END
+		WHERE id = $1
+	`, userID, active)
+	return err
+}
+
+// IsUserDeactivated reports whether userID was deactivated through SCIM.
+func (s *Store) IsUserDeactivated(ctx context.Context, userID uuid.UUID) (bool, error) {
+	ctx, done := s.op(ctx, "IsUserDeactivated")
+	defer done()
+	var deactivated bool
+	err := s.DB.QueryRowContext(ctx, `SELECT deactivated_at IS NOT NULL FROM users WHERE id = $1`, userID).Scan(&deactivated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrNotFound
+	}
+	return deactivated, err
+}
+
+const scimGroupColumns = `id, display_name, external_id, group_id, room_id, created_at, updated_at`
+
+func scanSCIMGroup(row interface{ Scan(...any) error }) (SCIMGroup, error) {
+	var g SCIMGroup
+	var groupID, roomID uuid.NullUUID
+	if err := row.Scan(&g.ID, &g.DisplayName, &g.ExternalID, &groupID, &roomID, &g.CreatedAt, &g.UpdatedAt); err != nil {
+		return g, err
+	}
+	if groupID.Valid {
+		g.GroupID = &groupID.UUID
+	}
+	if roomID.Valid {
+		g.RoomID = &roomID.UUID
+	}
+	g.Members = []SCIMMember{}
+	return g, nil
+}
+
+// loadSCIMMembers fills in the members of groups.
+func loadSCIMMembers(ctx context.Context, q dbtx, groups []SCIMGroup) error {
+	if len(groups) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, len(groups))
+	byID := make(map[uuid.UUID]*SCIMGroup, len(groups))
+	for i := range groups {
+		ids[i] = groups[i].ID
+		byID[groups[i].ID] = &groups[i]
+	}
+	rows, err := q.QueryContext(ctx, `
+		SELECT m.scim_group_id, m.user_id, su.user_name
+		FROM scim_group_members m
+		JOIN scim_users su ON su.user_id = m.user_id
+		WHERE m.scim_group_id = ANY($1::uuid[])
+		ORDER BY su.user_name
+	`, uuidStrings(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var groupID uuid.UUID
+		var m SCIMMember
+		if err := rows.Scan(&groupID, &m.UserID, &m.UserName); err != nil {
+			return err
+		}
+		g := byID[groupID]
+		g.Members = append(g.Members, m)
+	}
+	return rows.Err()
+}
+
+func getSCIMGroup(ctx context.Context, q dbtx, id uuid.UUID) (SCIMGroup, error) {
+	g, err := scanSCIMGroup(q.QueryRowContext(ctx, `SELECT `+scimGroupColumns+` FROM scim_groups WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return SCIMGroup{}, ErrNotFound
+	}
+	if err != nil {
+		return SCIMGroup{}, err
+	}
+	groups := []SCIMGroup{g}
+	if err := loadSCIMMembers(ctx, q, groups); err != nil {
+		return SCIMGroup{}, err
+	}
+	return groups[0], nil
+}
+
+func (s *Store) GetSCIMGroup(ctx context.Context, id uuid.UUID) (SCIMGroup, error) {
+	ctx, done := s.op(ctx, "GetSCIMGroup")
+	defer done()
+	return getSCIMGroup(ctx, s.DB, id)
+}
+
+var scimGroupFilters = map[string]string{
+	"":            `$1 = ''`,
+	"id":          `id::text = $1`,
+	"displayname": `LOWER(display_name) = LOWER($1)`,
+	"externalid":  `external_id = $1`,
+}
+
+// ListSCIMGroups returns a page of SCIM groups matching f, oldest first,
+// with how many match in all.
+func (s *Store) ListSCIMGroups(ctx context.Context, f SCIMFilter, offset, limit int) ([]SCIMGroup, int, error) {
+	ctx, done := s.op(ctx, "ListSCIMGroups")
+	defer done()
+	where, ok := scimGroupFilters[f.Attr]
+	if !ok {
+		return nil, 0, ErrSCIMFilter
+	}
+	var total int
+	if err := s.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM scim_groups WHERE `+where, f.Value).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT `+scimGroupColumns+`
+		FROM scim_groups
+		WHERE `+where+`
+		ORDER BY created_at, id
+		OFFSET $2 LIMIT $3
+	`, f.Value, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	out := []SCIMGroup{}
+	for rows.Next() {
+		g, err := scanSCIMGroup(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		out = append(out, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return out, total, loadSCIMMembers(ctx, s.DB, out)
+}
+
+// CreateSCIMGroup adds an identity provider group, with no members and
+// no workspace or room yet. ErrSCIMConflict means displayName is taken.
+func (s *Store) CreateSCIMGroup(ctx context.Context, displayName, externalID string) (SCIMGroup, error) {
+	ctx, done := s.op(ctx, "CreateSCIMGroup")
+	defer done()
+	g, err := scanSCIMGroup(s.DB.QueryRowContext(ctx, `
+		INSERT INTO scim_groups (display_name, external_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+		RETURNING `+scimGroupColumns,
+		displayName, externalID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return SCIMGroup{}, ErrSCIMConflict
+	}
+	return g, err
+}
+
+// RenameSCIMGroup sets id's displayName and externalId.
+func (s *Store) RenameSCIMGroup(ctx context.Context, id uuid.UUID, displayName, externalID string) error {
+	ctx, done := s.op(ctx, "RenameSCIMGroup")
+	defer done()
+	var taken bool
+	if err := s.DB.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM scim_groups WHERE LOWER(display_name) = LOWER($1) AND id <> $2)
+	`, displayName, id).Scan(&taken); err != nil {
+		return err
+	}
+	if taken {
+		return ErrSCIMConflict
+	}
+	return s.execOne(ctx, `
+		UPDATE scim_groups SET display_name = $2, external_id = $3, updated_at = NOW() WHERE id = $1
+	`, id, displayName, externalID)
+}
+
+// AddSCIMGroupMembers adds the SCIM users among userIDs to group id and
+// puts them in its workspace's channels or its room. It returns who was
+// added and the rooms each joined.
+func (s *Store) AddSCIMGroupMembers(ctx context.Context, id uuid.UUID, userIDs []uuid.UUID) ([]uuid.UUID, []SCIMRoomChange, error) {
+	ctx, done := s.op(ctx, "AddSCIMGroupMembers")
+	defer done()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+	added, err := scanUUIDs(tx.QueryContext(ctx, `
+		INSERT INTO scim_group_members (scim_group_id, user_id)
+		SELECT $1, user_id FROM scim_users WHERE user_id = ANY($2::uuid[])
+		ON CONFLICT DO NOTHING
+		RETURNING user_id
+	`, id, uuidStrings(userIDs)))
+	if err != nil || len(added) == 0 {
+		return nil, nil, err
+	}
+	joined, err := joinSCIMRooms(ctx, tx, id, added)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE scim_groups SET updated_at = NOW() WHERE id = $1`, id); err != nil {
+		return nil, nil, err
+	}
+	return added, joined, tx.Commit()
+}
+
+// joinSCIMRooms puts the members of group id among userIDs in its rooms
+// they are not in yet, as members, and logs the joins.
+func joinSCIMRooms(ctx context.Context, q dbtx, id uuid.UUID, userIDs []uuid.UUID) ([]SCIMRoomChange, error) {
+	rows, err := q.QueryContext(ctx, `
+		WITH `+scimRoomsCTE+`, joined AS (
+			INSERT INTO room_members (room_id, user_id, role, last_read_message_id)
+			SELECT t.room_id, m.user_id, 'member', (SELECT MAX(id) FROM messages WHERE room_id = t.room_id)
+			FROM scim_rooms t
+			JOIN scim_group_members m ON m.scim_group_id = t.scim_group_id
+			WHERE t.scim_group_id = $1 AND m.user_id = ANY($2::uuid[])
+			ON CONFLICT DO NOTHING
+			RETURNING room_id, user_id
+		), logged AS (
+			INSERT INTO room_membership_events (room_id, user_id, action, via)
+			SELECT room_id, user_id, $3, $4 FROM joined
+		)
+		SELECT user_id, room_id FROM joined
+	`, id, uuidStrings(userIDs), MembershipJoined, ViaSCIM)
+	if err != nil {
+		return nil, err
+	}
+	return scanSCIMRoomChanges(rows)
+}
+
+// RemoveSCIMGroupMembers takes userIDs out of group id. It returns who
+// was removed and the rooms each should now leave: those of the group
+// that none of their other SCIM groups keep them in, except rooms they
+// created.
+func (s *Store) RemoveSCIMGroupMembers(ctx context.Context, id uuid.UUID, userIDs []uuid.UUID) ([]uuid.UUID, []SCIMRoomChange, error) {
+	ctx, done := s.op(ctx, "RemoveSCIMGroupMembers")
+	defer done()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+	leaving, err := scimRoomsToLeave(ctx, tx, id, userIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	removed, err := scanUUIDs(tx.QueryContext(ctx, `
+		DELETE FROM scim_group_members WHERE scim_group_id = $1 AND user_id = ANY($2::uuid[])
+		RETURNING user_id
+	`, id, uuidStrings(userIDs)))
+	if err != nil || len(removed) == 0 {
+		return nil, nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE scim_groups SET updated_at = NOW() WHERE id = $1`, id); err != nil {
+		return nil, nil, err
+	}
+	return removed, leaving, tx.Commit()
+}
+
+// DeleteSCIMGroup removes group id and returns the rooms its members
+// should leave, as RemoveSCIMGroupMembers does.
+func (s *Store) DeleteSCIMGroup(ctx context.Context, id uuid.UUID) ([]SCIMRoomChange, error) {
+	ctx, done := s.op(ctx, "DeleteSCIMGroup")
+	defer done()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	userIDs, err := scimGroupMemberIDs(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	leaving, err := scimRoomsToLeave(ctx, tx, id, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM scim_groups WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, ErrNotFound
+	}
+	return leaving, tx.Commit()
+}
+
+func scimRoomsToLeave(ctx context.Context, q dbtx, id uuid.UUID, userIDs []uuid.UUID) ([]SCIMRoomChange, error) {
+	rows, err := q.QueryContext(ctx, `
+		WITH `+scimRoomsCTE+`
+		SELECT rm.user_id, rm.room_id
+		FROM scim_rooms t
+		JOIN scim_group_members m ON m.scim_group_id = t.scim_group_id
+		JOIN room_members rm ON rm.room_id = t.room_id AND rm.user_id = m.user_id
+		JOIN rooms r ON r.id = rm.room_id
+		WHERE t.scim_group_id = $1
+		  AND m.user_id = ANY($2::uuid[])
+		  AND r.created_by IS DISTINCT FROM rm.user_id
+		  AND NOT EXISTS (
+			SELECT 1
+			FROM scim_group_members om
+			JOIN scim_rooms o ON o.scim_group_id = om.scim_group_id
+			WHERE om.user_id = rm.user_id AND om.scim_group_id <> $1 AND o.room_id = rm.room_id
+		  )
+	`, id, uuidStrings(userIDs))
+	if err != nil {
+		return nil, err
+	}
+	return scanSCIMRoomChanges(rows)
+}
+
+func scimGroupMemberIDs(ctx context.Context, q dbtx, id uuid.UUID) ([]uuid.UUID, error) {
+	return scanUUIDs(q.QueryContext(ctx, `SELECT user_id FROM scim_group_members WHERE scim_group_id = $1`, id))
+}
+
+func scanUUIDs(rows *sql.Rows, err error) ([]uuid.UUID, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, rows.Err()
+}
+
+func scanSCIMRoomChanges(rows *sql.Rows) ([]SCIMRoomChange, error) {
+	defer rows.Close()
+	var out []SCIMRoomChange
+	for rows.Next() {
+		var c SCIMRoomChange
+		if err := rows.Scan(&c.UserID, &c.RoomID); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// SetSCIMGroupTarget keeps group id's members in the workspace groupID or
+// the room roomID, or nowhere when both are nil, and puts its members in
+// the new rooms. Nobody is taken out of the old ones. It returns the
+// rooms each member joined.
+func (s *Store) SetSCIMGroupTarget(ctx context.Context, id uuid.UUID, groupID, roomID *uuid.UUID) ([]SCIMRoomChange, error) {
+	ctx, done := s.op(ctx, "SetSCIMGroupTarget")
+	defer done()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `
+		UPDATE scim_groups SET group_id = $2, room_id = $3, updated_at = NOW() WHERE id = $1
+	`, id, groupID, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, ErrNotFound
+	}
+	userIDs, err := scimGroupMemberIDs(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	joined, err := joinSCIMRooms(ctx, tx, id, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	return joined, tx.Commit()
+}
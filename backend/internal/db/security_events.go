@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SecurityEvent is a security action kept for instance admins, such as a
+// completed password reset or an address blocked for guessing invite
+// links, with where the request came from. UserID is nil for events about
+// an address alone.
+type SecurityEvent struct {
+	ID        int64      `json:"id"`
+	UserID    *uuid.UUID `json:"user_id,omitempty"`
+	Kind      string     `json:"kind"`
+	IP        string     `json:"ip"`
+	Country   string     `json:"country,omitempty"`
+	UserAgent string     `json:"user_agent,omitempty"`
+	Detail    string     `json:"detail,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (s *Store) RecordSecurityEvent(ctx context.Context, e SecurityEvent) error {
+	ctx, done := s.op(ctx, "RecordSecurityEvent")
+	defer done()
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO security_events (user_id, kind, ip, country, user_agent, detail)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, e.UserID, e.Kind, e.IP, e.Country, e.UserAgent, e.Detail)
+	return err
+}
+
+// ListSecurityEvents returns userID's security events, newest first.
+func (s *Store) ListSecurityEvents(ctx context.Context, userID uuid.UUID, limit int) ([]SecurityEvent, error) {
+	return s.listSecurityEvents(ctx, "ListSecurityEvents", `WHERE user_id = $1`, userID, limit)
+}
+
+// ListRecentSecurityEvents returns the newest security events of every
+// account and address, only those of kind unless it is empty.
+func (s *Store) ListRecentSecurityEvents(ctx context.Context, kind string, limit int) ([]SecurityEvent, error) {
+	return s.listSecurityEvents(ctx, "ListRecentSecurityEvents", `WHERE $1 = '' OR kind = $1`, kind, limit)
+}
+
+func (s *Store) listSecurityEvents(ctx context.Context, op, where string, arg any, limit int) ([]SecurityEvent, error) {
+	ctx, done := s.op(ctx, op)
+	defer done()
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, user_id, kind, ip, country, user_agent, detail, created_at
+		FROM security_events
+		`+where+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2
+	`, arg, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]SecurityEvent, 0)
+	for rows.Next() {
+		var e SecurityEvent
+		var userID uuid.NullUUID
+		if err := rows.Scan(&e.ID, &userID, &e.Kind, &e.IP, &e.Country, &e.UserAgent, &e.Detail, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if userID.Valid {
+			e.UserID = &userID.UUID
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
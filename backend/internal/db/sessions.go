@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// GetSessionVersion returns the version tokens must carry to be accepted.
+// Expired guests are reported as not found, so their tokens stop working
+// before the cleanup job removes them, and so are deactivated accounts.
+func (s *Store) GetSessionVersion(ctx context.Context, userID uuid.UUID) (int, error) {
+	ctx, done := s.op(ctx, "GetSessionVersion")
+	defer done()
+	var v int
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT session_version FROM users
+		WHERE id = $1 AND (guest_expires_at IS NULL OR guest_expires_at > NOW()) AND deactivated_at IS NULL
+	`, userID).Scan(&v)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	return v, err
+}
+
+// ChangePassword stores a new password hash and revokes all sessions,
+// returning the new session version for the caller's replacement token.
+func (s *Store) ChangePassword(ctx context.Context, userID uuid.UUID, passwordHash string) (int, error) {
+	ctx, done := s.op(ctx, "ChangePassword")
+	defer done()
+	var v int
+	err := s.DB.QueryRowContext(ctx, `
+		UPDATE users
+		SET password_hash = $2,
+		    password_reset_token_hash = NULL,
+		    session_version = session_version + 1
+		WHERE id = $1
+		RETURNING session_version
+	`, userID, passwordHash).Scan(&v)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	return v, err
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// ErrSetupDone is returned by CompleteSetup once the instance has an
+// account or setup already ran.
+var ErrSetupDone = errors.New("setup already completed")
+
+// InstanceSettings are what the first-run setup wizard configures.
+type InstanceSettings struct {
+	Name         string `json:"name"`
+	Registration string `json:"registration"`
+}
+
+// setupOpenSQL is true while setup may run: no account exists, bots such
+// as the canary aside, and setup has not saved its settings.
+const setupOpenSQL = `
+	SELECT NOT EXISTS (SELECT 1 FROM users WHERE NOT is_bot)
+	   AND NOT EXISTS (SELECT 1 FROM instance_settings)
+`
+
+// SetupRequired reports whether the first-run setup is still open.
+func (s *Store) SetupRequired(ctx context.Context) (bool, error) {
+	ctx, done := s.op(ctx, "SetupRequired")
+	defer done()
+	var open bool
+	err := s.DB.QueryRowContext(ctx, setupOpenSQL).Scan(&open)
+	return open, err
+}
+
+// GetInstanceSettings returns the settings setup saved, or ErrNotFound
+// before setup ran.
+func (s *Store) GetInstanceSettings(ctx context.Context) (InstanceSettings, error) {
+	ctx, done := s.op(ctx, "GetInstanceSettings")
+	defer done()
+	var st InstanceSettings
+	err := s.DB.QueryRowContext(ctx, `SELECT name, registration FROM instance_settings`).Scan(&st.Name, &st.Registration)
+	if errors.Is(err, sql.ErrNoRows) {
+		return InstanceSettings{}, ErrNotFound
+	}
+	return st, err
+}
+
+// CompleteSetup creates the first account, a verified instance admin, and
+// saves settings, in one transaction. It returns ErrSetupDone when setup
+// is no longer open, including when another request completed it first.
+func (s *Store) CompleteSetup(ctx context.Context, email, username, passwordHash string, settings InstanceSettings) (User, error) {
+	ctx, done := s.op(ctx, "CompleteSetup")
+	defer done()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return User{}, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, advisoryKey("setup")); err != nil {
+		return User{}, err
+	}
+	var open bool
+	if err := tx.QueryRowContext(ctx, setupOpenSQL).Scan(&open); err != nil {
+		return User{}, err
+	}
+	if !open {
+		return User{}, ErrSetupDone
+	}
+	var u User
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO users (email, username, password_hash, email_verified, is_admin)
+		VALUES ($1, $2, $3, TRUE, TRUE)
+		RETURNING id, email, username, email_verified, is_admin, session_version, created_at
+	`, email, username, passwordHash).Scan(&u.ID, &u.Email, &u.Username, &u.EmailVerified, &u.IsAdmin, &u.SessionVersion, &u.CreatedAt)
+	if err != nil {
+		return User{}, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO instance_settings (name, registration, setup_by) VALUES ($1, $2, $3)
+	`, settings.Name, settings.Registration, u.ID); err != nil {
+		return User{}, err
+	}
+	return u, tx.Commit()
+}
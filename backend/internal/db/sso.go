@@ -0,0 +1,437 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SSOLoginWindow is how long a sign-in may take at the identity provider,
+// and SSOExchangeWindow how long the frontend has to redeem its code.
+const (
+	SSOLoginWindow    = 10 * time.Minute
+	SSOExchangeWindow = 2 * time.Minute
+)
+
+var (
+	// ErrSSOIdentityTaken is returned when the identity is already linked
+	// to another account.
+	ErrSSOIdentityTaken = errors.New("identity already linked to another account")
+	// ErrUserExists is returned when a new account's email or username is
+	// already in use.
+	ErrUserExists = errors.New("email or username already in use")
+)
+
+// SSORoleMapping gives members of an IdP group a role in the workspace.
+type SSORoleMapping struct {
+	Group string `json:"group"`
+	Role  string `json:"role"`
+}
+
+// WorkspaceSSO is a workspace's identity provider. Issuer, ClientID and
+// ClientSecret are for OIDC; the IdP fields for SAML. ClientSecret never
+// leaves the server. Approved is only set by instance admins and is
+// cleared when the provider's address changes.
+type WorkspaceSSO struct {
+	GroupID         uuid.UUID        `json:"group_id"`
+	Protocol        string           `json:"protocol"`
+	Enabled         bool             `json:"enabled"`
+	Enforced        bool             `json:"enforced"`
+	Approved        bool             `json:"approved"`
+	Issuer          string           `json:"issuer,omitempty"`
+	ClientID        string           `json:"client_id,omitempty"`
+	ClientSecret    string           `json:"-"`
+	HasClientSecret bool             `json:"has_client_secret,omitempty"`
+	IdPSSOURL       string           `json:"idp_sso_url,omitempty"`
+	IdPEntityID     string           `json:"idp_entity_id,omitempty"`
+	IdPCertificate  string           `json:"idp_certificate,omitempty"`
+	GroupsClaim     string           `json:"groups_claim"`
+	RoleMappings    []SSORoleMapping `json:"role_mappings"`
+	DefaultRole     string           `json:"default_role"`
+	UpdatedAt       time.Time        `json:"updated_at"`
+}
+
+// Active reports whether members can sign in through it.
+func (c WorkspaceSSO) Active() bool {
+	return c.Enabled && c.Approved
+}
+
+// SSOLogin is a sign-in in flight. Nonce is the OIDC nonce or the SAML
+// request ID; LinkUserID is set when a signed-in user is linking their
+// account rather than signing in.
+type SSOLogin struct {
+	GroupID    uuid.UUID
+	Nonce      string
+	Verifier   string
+	LinkUserID *uuid.UUID
+}
+
+const workspaceSSOColumns = `group_id, protocol, enabled, enforced, approved, issuer, client_id, client_secret,
+	idp_sso_url, idp_entity_id, idp_certificate, groups_claim, role_mappings, default_role, updated_at`
+
+func scanWorkspaceSSO(row interface{ Scan(...any) error }) (WorkspaceSSO, error) {
+	var c WorkspaceSSO
+	var mappings []byte
+	err := row.Scan(&c.GroupID, &c.Protocol, &c.Enabled, &c.Enforced, &c.Approved, &c.Issuer, &c.ClientID, &c.ClientSecret,
+		&c.IdPSSOURL, &c.IdPEntityID, &c.IdPCertificate, &c.GroupsClaim, &mappings, &c.DefaultRole, &c.UpdatedAt)
+	if err != nil {
+		return c, err
+	}
+	c.HasClientSecret = c.ClientSecret != ""
+	c.RoleMappings = []SSORoleMapping{}
+	if err := json.Unmarshal(mappings, &c.RoleMappings); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// GetWorkspaceSSO returns groupID's identity provider, secret included.
+func (s *Store) GetWorkspaceSSO(ctx context.Context, groupID uuid.UUID) (WorkspaceSSO, error) {
+	ctx, done := s.op(ctx, "GetWorkspaceSSO")
+	defer done()
+	c, err := scanWorkspaceSSO(s.DB.QueryRowContext(ctx, `SELECT `+workspaceSSOColumns+` FROM workspace_sso WHERE group_id = $1`, groupID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return WorkspaceSSO{}, ErrNotFound
+	}
+	return c, err
+}
+
+// ListWorkspaceSSO returns every workspace's identity provider, those
+// awaiting approval first, without secrets.
+func (s *Store) ListWorkspaceSSO(ctx context.Context) ([]WorkspaceSSO, error) {
+	ctx, done := s.op(ctx, "ListWorkspaceSSO")
+	defer done()
+	rows, err := s.DB.QueryContext(ctx, `SELECT `+workspaceSSOColumns+` FROM workspace_sso ORDER BY approved, updated_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []WorkspaceSSO{}
+	for rows.Next() {
+		c, err := scanWorkspaceSSO(rows)
+		if err != nil {
+			return nil, err
+		}
+		c.ClientSecret = ""
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// SaveWorkspaceSSO creates or replaces c's workspace's identity provider.
+// An empty ClientSecret keeps the current one. Approval carries over only
+// while the protocol and the provider's address stay the same.
+func (s *Store) SaveWorkspaceSSO(ctx context.Context, c WorkspaceSSO, updatedBy uuid.UUID) (WorkspaceSSO, error) {
+	ctx, done := s.op(ctx, "SaveWorkspaceSSO")
+	defer done()
+	if c.RoleMappings == nil {
+		c.RoleMappings = []SSORoleMapping{}
+	}
+	mappings, err := json.Marshal(c.RoleMappings)
+	if err != nil {
+		return WorkspaceSSO{}, err
+	}
+	saved, err := scanWorkspaceSSO(s.DB.QueryRowContext(ctx, `
+		INSERT INTO workspace_sso (group_id, protocol, enabled, enforced, issuer, client_id, client_secret,
+			idp_sso_url, idp_entity_id, idp_certificate, groups_claim, role_mappings, default_role, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12::jsonb, $13, $14)
+		ON CONFLICT (group_id) DO UPDATE SET
+			protocol = EXCLUDED.protocol,
+			enabled = EXCLUDED.enabled,
+			enforced = EXCLUDED.enforced,
+			approved = workspace_sso.approved
+				AND workspace_sso.protocol = EXCLUDED.protocol
+				AND workspace_sso.issuer = EXCLUDED.issuer
+				AND workspace_sso.idp_sso_url = EXCLUDED.idp_sso_url,
+			issuer = EXCLUDED.issuer,
+			client_id = EXCLUDED.client_id,
+			client_secret = CASE WHEN EXCLUDED.client_secret = '' THEN workspace_sso.client_secret ELSE EXCLUDED.client_secret END,
+			idp_sso_url = EXCLUDED.idp_sso_url,
+			idp_entity_id = EXCLUDED.idp_entity_id,
+			idp_certificate = EXCLUDED.idp_certificate,
+			groups_claim = EXCLUDED.groups_claim,
+			role_mappings = EXCLUDED.role_mappings,
+			default_role = EXCLUDED.default_role,
+			updated_by = EXCLUDED.updated_by,
+			updated_at = NOW()
+		RETURNING `+workspaceSSOColumns,
+		c.GroupID, c.Protocol, c.Enabled, c.Enforced, c.Issuer, c.ClientID, c.ClientSecret,
+		c.IdPSSOURL, c.IdPEntityID, c.IdPCertificate, c.GroupsClaim, string(mappings), c.DefaultRole, updatedBy))
+	if err != nil {
+		return WorkspaceSSO{}, err
+	}
+	return saved, nil
+}
+
+// DeleteWorkspaceSSO removes groupID's identity provider. Linked
+// identities are kept in case it is set up again.
+func (s *Store) DeleteWorkspaceSSO(ctx context.Context, groupID uuid.UUID) error {
+	ctx, done := s.op(ctx, "DeleteWorkspaceSSO")
+	defer done()
+	return s.execOne(ctx, `DELETE FROM workspace_sso WHERE group_id = $1`, groupID)
+}
+
+// SetWorkspaceSSOApproved lets groupID's identity provider be used, or
+// stops it.
+func (s *Store) SetWorkspaceSSOApproved(ctx context.Context, groupID uuid.UUID, approved bool) error {
+	ctx, done := s.op(ctx, "SetWorkspaceSSOApproved")
+	defer done()
+	return s.execOne(ctx, `UPDATE workspace_sso SET approved = $2 WHERE group_id = $1`, groupID, approved)
+}
+
+// CanManageGroup reports whether userID created the workspace or is an
+// admin of one of its channels. ErrNotFound means there is no workspace.
+func (s *Store) CanManageGroup(ctx context.Context, groupID, userID uuid.UUID) (bool, error) {
+	ctx, done := s.op(ctx, "CanManageGroup")
+	defer done()
+	var can bool
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT COALESCE(g.created_by = $2, FALSE) OR EXISTS (
+			SELECT 1
+			FROM group_channels gc
+			JOIN room_members rm ON rm.room_id = gc.room_id
+			WHERE gc.group_id = g.id
+			  AND rm.user_id = $2
+			  AND rm.role = 'admin'
+		)
+		FROM room_groups g
+		WHERE g.id = $1
+	`, groupID, userID).Scan(&can)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrNotFound
+	}
+	return can, err
+}
+
+// EnforcedSSOGroup returns a workspace userID belongs to that requires
+// its members to sign in through its identity provider. The workspace's
+// creator is exempt, so a broken provider cannot lock everyone out.
+// ErrNotFound means password sign-in is allowed.
+func (s *Store) EnforcedSSOGroup(ctx context.Context, userID uuid.UUID) (uuid.UUID, error) {
+	ctx, done := s.op(ctx, "EnforcedSSOGroup")
+	defer done()
+	var groupID uuid.UUID
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT w.group_id
+		FROM workspace_sso w
+		JOIN room_groups g ON g.id = w.group_id
+		WHERE w.enabled AND w.approved AND w.enforced
+		  AND g.created_by IS DISTINCT FROM $1
+		  AND EXISTS (
+			SELECT 1
+			FROM group_channels gc
+			JOIN room_members rm ON rm.room_id = gc.room_id
+			WHERE gc.group_id = w.group_id AND rm.user_id = $1
+		  )
+		ORDER BY w.updated_at
+		LIMIT 1
+	`, userID).Scan(&groupID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, ErrNotFound
+	}
+	return groupID, err
+}
+
+// CreateSSOLogin records a sign-in sent to the identity provider under
+// the hash of its state.
+func (s *Store) CreateSSOLogin(ctx context.Context, stateHash string, l SSOLogin) error {
+	ctx, done := s.op(ctx, "CreateSSOLogin")
+	defer done()
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO sso_logins (state_hash, group_id, nonce, verifier, link_user_id)
+		VALUES ($1, $2, $3, $4, $5)
+	`, stateHash, l.GroupID, l.Nonce, l.Verifier, l.LinkUserID)
+	return err
+}
+
+// TakeSSOLogin returns and forgets the sign-in under stateHash. It is
+// ErrNotFound once used or after SSOLoginWindow.
+func (s *Store) TakeSSOLogin(ctx context.Context, stateHash string) (SSOLogin, error) {
+	ctx, done := s.op(ctx, "TakeSSOLogin")
+	defer done()
+	var l SSOLogin
+	err := s.DB.QueryRowContext(ctx, `
+		DELETE FROM sso_logins
+		WHERE state_hash = $1 AND created_at > NOW() - make_interval(secs => $2)
+		RETURNING group_id, nonce, verifier, link_user_id
+	`, stateHash, SSOLoginWindow.Seconds()).Scan(&l.GroupID, &l.Nonce, &l.Verifier, &l.LinkUserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return SSOLogin{}, ErrNotFound
+	}
+	return l, err
+}
+
+// CreateSSOExchange records that the one-time code hashing to codeHash
+// signs in userID.
+func (s *Store) CreateSSOExchange(ctx context.Context, codeHash string, userID uuid.UUID) error {
+	ctx, done := s.op(ctx, "CreateSSOExchange")
+	defer done()
+	_, err := s.DB.ExecContext(ctx, `INSERT INTO sso_exchanges (code_hash, user_id) VALUES ($1, $2)`, codeHash, userID)
+	return err
+}
+
+// TakeSSOExchange redeems a one-time code, which works once and only
+// within SSOExchangeWindow.
+func (s *Store) TakeSSOExchange(ctx context.Context, codeHash string) (uuid.UUID, error) {
+	ctx, done := s.op(ctx, "TakeSSOExchange")
+	defer done()
+	var userID uuid.UUID
+	err := s.DB.QueryRowContext(ctx, `
+		DELETE FROM sso_exchanges
+		WHERE code_hash = $1 AND created_at > NOW() - make_interval(secs => $2)
+		RETURNING user_id
+	`, codeHash, SSOExchangeWindow.Seconds()).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, ErrNotFound
+	}
+	return userID, err
+}
+
+// DeleteExpiredSSOLogins forgets sign-ins and codes nobody finished.
+func (s *Store) DeleteExpiredSSOLogins(ctx context.Context) (int64, error) {
+	ctx, done := s.op(ctx, "DeleteExpiredSSOLogins")
+	defer done()
+	var n int64
+	err := s.DB.QueryRowContext(ctx, `
+		WITH logins AS (
+			DELETE FROM sso_logins WHERE created_at < NOW() - make_interval(secs => $1) RETURNING 1
+		), codes AS (
+			DELETE FROM sso_exchanges WHERE created_at < NOW() - make_interval(secs => $2) RETURNING 1
+		)
+		SELECT (SELECT COUNT(*) FROM logins) + (SELECT COUNT(*) FROM codes)
+	`, SSOLoginWindow.Seconds(), SSOExchangeWindow.Seconds()).Scan(&n)
+	return n, err
+}
+
+// FindSSOIdentity returns the user subject signs in as at groupID's
+// identity provider, noting the sign-in.
+func (s *Store) FindSSOIdentity(ctx context.Context, groupID uuid.UUID, subject string) (uuid.UUID, error) {
+	ctx, done := s.op(ctx, "FindSSOIdentity")
+	defer done()
+	var userID uuid.UUID
+	err := s.DB.QueryRowContext(ctx, `
+		UPDATE sso_identities SET last_login_at = NOW()
+		WHERE group_id = $1 AND subject = $2
+		RETURNING user_id
+	`, groupID, subject).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, ErrNotFound
+	}
+	return userID, err
+}
+
+// LinkSSOIdentity makes subject sign in as userID, replacing any other
+// identity userID had at that provider.
+func (s *Store) LinkSSOIdentity(ctx context.Context, groupID uuid.UUID, subject string, userID uuid.UUID) error {
+	ctx, done := s.op(ctx, "LinkSSOIdentity")
+	defer done()
+	var owner uuid.UUID
+	err := s.DB.QueryRowContext(ctx, `SELECT user_id FROM sso_identities WHERE group_id = $1 AND subject = $2`, groupID, subject).Scan(&owner)
+	switch {
+	case err == nil && owner != userID:
+		return ErrSSOIdentityTaken
+	case err == nil:
+		return nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+	_, err = s.DB.ExecContext(ctx, `
+		INSERT INTO sso_identities (group_id, subject, user_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (group_id, user_id) DO UPDATE
+		SET subject = EXCLUDED.subject, created_at = NOW(), last_login_at = NOW()
+	`, groupID, subject, userID)
+	return err
+}
+
+// CreateSSOUser provisions an account for a first sign-in through
+// groupID's identity provider. The provider vouches for the email, so it
+// starts verified. ErrUserExists means the email or username is taken.
+func (s *Store) CreateSSOUser(ctx context.Context, groupID uuid.UUID, subject, email, username, passwordHash string) (User, error) {
+	ctx, done := s.op(ctx, "CreateSSOUser")
+	defer done()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return User{}, err
+	}
+	defer tx.Rollback()
+	var u User
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO users (email, username, password_hash, email_verified)
+		VALUES ($1, $2, $3, TRUE)
+		ON CONFLICT DO NOTHING
+		RETURNING id, email, username, COALESCE(avatar_url, ''), email_verified, session_version, created_at
+	`, email, username, passwordHash).Scan(&u.ID, &u.Email, &u.Username, &u.AvatarURL, &u.EmailVerified, &u.SessionVersion, &u.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrUserExists
+	}
+	if err != nil {
+		return User{}, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO sso_identities (group_id, subject, user_id) VALUES ($1, $2, $3)
+	`, groupID, subject, u.ID); err != nil {
+		return User{}, err
+	}
+	return u, tx.Commit()
+}
+
+// SyncSSOMembership puts userID in every channel of groupID with role,
+// as their identity provider's groups say. Channel owners and the
+// workspace's creator keep their role. It returns the channels joined.
+func (s *Store) SyncSSOMembership(ctx context.Context, groupID, userID uuid.UUID, role string) ([]uuid.UUID, error) {
+	ctx, done := s.op(ctx, "SyncSSOMembership")
+	defer done()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE room_members rm
+		SET role = $3
+		FROM group_channels gc, rooms r, room_groups g
+		WHERE gc.group_id = $1 AND gc.room_id = rm.room_id
+		  AND r.id = rm.room_id AND g.id = gc.group_id
+		  AND rm.user_id = $2 AND rm.role <> $3
+		  AND r.created_by IS DISTINCT FROM $2
+		  AND g.created_by IS DISTINCT FROM $2
+	`, groupID, userID, role); err != nil {
+		return nil, err
+	}
+	rows, err := tx.QueryContext(ctx, `
+		WITH joined AS (
+			INSERT INTO room_members (room_id, user_id, role, last_read_message_id)
+			SELECT gc.room_id, $2, $3, (SELECT MAX(id) FROM messages m WHERE m.room_id = gc.room_id)
+			FROM group_channels gc
+			LEFT JOIN direct_rooms d ON d.room_id = gc.room_id
+			WHERE gc.group_id = $1 AND d.room_id IS NULL
+			ON CONFLICT DO NOTHING
+			RETURNING room_id
+		), logged AS (
+			INSERT INTO room_membership_events (room_id, user_id, action, via)
+			SELECT room_id, $2, $4, $5 FROM joined
+		)
+		SELECT room_id FROM joined
+	`, groupID, userID, role, MembershipJoined, ViaSSO)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var joined []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		joined = append(joined, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return joined, tx.Commit()
+}
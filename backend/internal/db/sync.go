@@ -0,0 +1,277 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SyncRoom is what changed in one room since a sync point. Messages are the
+// newest new messages, oldest first, at most the per-room cap; Limited says
+// there were more, which the client fetches through the history endpoint.
+// Edits and membership changes are collapsed to the latest per message and
+// per user.
+type SyncRoom struct {
+	RoomID            uuid.UUID          `json:"room_id"`
+	Messages          []Message          `json:"messages"`
+	Limited           bool               `json:"limited"`
+	Edited            []SyncEdit         `json:"edited"`
+	DeletedMessageIDs []int64            `json:"deleted_message_ids"`
+	Members           []SyncMemberChange `json:"members"`
+	// LatestSeq is the room's event stream position, for clients that
+	// continue with GET /api/rooms/{id}/events.
+	LatestSeq int64 `json:"latest_seq"`
+}
+
+type SyncEdit struct {
+	MessageID int64  `json:"message_id"`
+	Content   string `json:"content"`
+}
+
+// SyncMemberChange is a member's latest membership change: joined, left or
+// role_changed. Role is empty when they left.
+type SyncMemberChange struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Username string    `json:"username,omitempty"`
+	Change   string    `json:"change"`
+	Role     string    `json:"role,omitempty"`
+}
+
+// SyncProfile is the public profile of a user whose name or avatar changed.
+type SyncProfile struct {
+	ID        uuid.UUID `json:"id"`
+	Username  string    `json:"username"`
+	AvatarURL string    `json:"avatar_url,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SyncDelta is everything a user missed since a sync point. JoinedRooms
+// lists every room they are in now, so a client drops rooms it has that are
+// missing: rooms they left, were removed from or that were deleted.
+type SyncDelta struct {
+	JoinedRooms []uuid.UUID   `json:"joined_rooms"`
+	Rooms       []SyncRoom    `json:"rooms"`
+	Profiles    []SyncProfile `json:"profiles"`
+}
+
+// maxSyncProfiles caps the profile changes in one sync; a client that is
+// that far behind reloads its member lists anyway.
+const maxSyncProfiles = 500
+
+// Sync returns what changed for userID after since: per room, up to perRoom
+// new messages plus edits, deletions and membership changes, and the
+// profiles of users who share a room or a friendship with them. Shadowed
+// messages are included only for their author.
+func (s *Store) Sync(ctx context.Context, userID uuid.UUID, since time.Time, perRoom int) (SyncDelta, error) {
+	ctx, done := s.op(ctx, "Sync")
+	defer done()
+	if perRoom <= 0 || perRoom > 100 {
+		perRoom = 20
+	}
+	delta := SyncDelta{JoinedRooms: []uuid.UUID{}, Rooms: []SyncRoom{}, Profiles: []SyncProfile{}}
+
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT r.id, r.event_seq,
+		       EXISTS (SELECT 1 FROM room_events e WHERE e.room_id = r.id AND e.created_at > $2)
+		FROM room_members rm
+		JOIN rooms r ON r.id = rm.room_id
+		WHERE rm.user_id = $1
+		ORDER BY r.id
+	`, userID, since)
+	if err != nil {
+		return delta, err
+	}
+	byRoom := make(map[uuid.UUID]*SyncRoom)
+	var changed []uuid.UUID
+	for rows.Next() {
+		var roomID uuid.UUID
+		var seq int64
+		var hasEvents bool
+		if err := rows.Scan(&roomID, &seq, &hasEvents); err != nil {
+			rows.Close()
+			return delta, err
+		}
+		delta.JoinedRooms = append(delta.JoinedRooms, roomID)
+		if hasEvents {
+			byRoom[roomID] = &SyncRoom{RoomID: roomID, Messages: []Message{}, Edited: []SyncEdit{}, DeletedMessageIDs: []int64{}, Members: []SyncMemberChange{}, LatestSeq: seq}
+			changed = append(changed, roomID)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return delta, err
+	}
+
+	if len(changed) > 0 {
+		if err := s.syncMessages(ctx, userID, changed, since, perRoom, byRoom); err != nil {
+			return delta, err
+		}
+		if err := s.syncEvents(ctx, changed, since, byRoom); err != nil {
+			return delta, err
+		}
+		for _, roomID := range changed {
+			delta.Rooms = append(delta.Rooms, *byRoom[roomID])
+		}
+	}
+
+	profiles, err := s.syncProfiles(ctx, userID, since)
+	if err != nil {
+		return delta, err
+	}
+	delta.Profiles = profiles
+	return delta, nil
+}
+
+func (s *Store) syncMessages(ctx context.Context, userID uuid.UUID, roomIDs []uuid.UUID, since time.Time, perRoom int, byRoom map[uuid.UUID]*SyncRoom) error {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id, room_id, user_id, username, avatar_url, content, message_type, media_url, created_at, client_sent_at, shadowed, nsfw, audio, components, contact, alt_text, alt_text_generated, total
+		FROM (
+			SELECT m.id, m.room_id, m.user_id, u.username, COALESCE(u.avatar_url, '') AS avatar_url, m.content, m.message_type,
+			       COALESCE(m.media_url, '') AS media_url, m.created_at, m.client_sent_at, m.shadowed, m.nsfw, m.audio::text AS audio, m.components::text AS components, m.contact::text AS contact, COALESCE(m.alt_text, '') AS alt_text, m.alt_text_generated,
+			       ROW_NUMBER() OVER (PARTITION BY m.room_id ORDER BY m.id DESC) AS rn,
+			       COUNT(*) OVER (PARTITION BY m.room_id) AS total
+			FROM messages m
+			JOIN users u ON u.id = m.user_id
+			WHERE m.room_id = ANY($1::uuid[])
+			  AND m.created_at > $2
+			  AND (NOT m.shadowed OR m.user_id = $3)
+		) recent
+		WHERE rn <= $4
+		ORDER BY room_id, id
+	`, uuidStrings(roomIDs), since, userID, perRoom)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m Message
+		var total int
+		if err := rows.Scan(&m.ID, &m.RoomID, &m.UserID, &m.Username, &m.AvatarURL, contentColumn{&m}, &m.MessageType, &m.MediaURL, &m.CreatedAt, &m.ClientSentAt, &m.Shadowed, &m.NSFW, audioColumn{&m.Audio}, componentsColumn{&m.Components}, contactColumn{&m.Contact}, &m.AltText, &m.AltTextGenerated, &total); err != nil {
+			return err
+		}
+		room := byRoom[m.RoomID]
+		room.Messages = append(room.Messages, m)
+		room.Limited = total > perRoom
+	}
+	return rows.Err()
+}
+
+// syncEvents fills in edits, deletions and membership changes from the
+// rooms' event streams. Edits to messages that are returned in full, or
+// that were deleted since, are left out.
+func (s *Store) syncEvents(ctx context.Context, roomIDs []uuid.UUID, since time.Time, byRoom map[uuid.UUID]*SyncRoom) error {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT e.room_id, e.type, e.user_id, COALESCE(u.username, ''), e.message_id,
+		       COALESCE(e.data->>'content', ''), COALESCE(e.data->>'role', '')
+		FROM room_events e
+		LEFT JOIN users u ON u.id = e.user_id
+		WHERE e.room_id = ANY($1::uuid[])
+		  AND e.created_at > $2
+		  AND e.type <> 'message_created'
+		ORDER BY e.room_id, e.seq
+	`, uuidStrings(roomIDs), since)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type roomState struct {
+		edits   map[int64]string
+		order   []int64
+		deleted map[int64]bool
+		members map[uuid.UUID]int
+	}
+	states := make(map[uuid.UUID]*roomState)
+	for rows.Next() {
+		var roomID uuid.UUID
+		var typ, username, content, role string
+		var userID uuid.NullUUID
+		var nullMessageID sql.NullInt64
+		if err := rows.Scan(&roomID, &typ, &userID, &username, &nullMessageID, &content, &role); err != nil {
+			return err
+		}
+		messageID := nullInt64Ptr(nullMessageID)
+		room := byRoom[roomID]
+		st := states[roomID]
+		if st == nil {
+			st = &roomState{edits: map[int64]string{}, deleted: map[int64]bool{}, members: map[uuid.UUID]int{}}
+			states[roomID] = st
+		}
+		switch typ {
+		case "message_edited":
+			if messageID == nil {
+				continue
+			}
+			if _, seen := st.edits[*messageID]; !seen {
+				st.order = append(st.order, *messageID)
+			}
+			st.edits[*messageID] = content
+		case "message_deleted":
+			if messageID != nil && !st.deleted[*messageID] {
+				st.deleted[*messageID] = true
+				room.DeletedMessageIDs = append(room.DeletedMessageIDs, *messageID)
+			}
+		case "member_joined", "member_left", "member_role_changed":
+			if !userID.Valid {
+				continue
+			}
+			change := SyncMemberChange{UserID: userID.UUID, Username: username, Change: typ[len("member_"):], Role: role}
+			if i, ok := st.members[userID.UUID]; ok {
+				room.Members[i] = change
+			} else {
+				st.members[userID.UUID] = len(room.Members)
+				room.Members = append(room.Members, change)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for roomID, st := range states {
+		room := byRoom[roomID]
+		full := make(map[int64]bool, len(room.Messages))
+		for _, m := range room.Messages {
+			full[m.ID] = true
+		}
+		for _, id := range st.order {
+			if !full[id] && !st.deleted[id] {
+				room.Edited = append(room.Edited, SyncEdit{MessageID: id, Content: st.edits[id]})
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Store) syncProfiles(ctx context.Context, userID uuid.UUID, since time.Time) ([]SyncProfile, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT u.id, u.username, COALESCE(u.avatar_url, ''), u.profile_updated_at
+		FROM users u
+		WHERE u.profile_updated_at > $2
+		  AND (u.id = $1
+		       OR EXISTS (SELECT 1 FROM friendships f WHERE f.user_id = $1 AND f.friend_id = u.id)
+		       OR EXISTS (
+		         SELECT 1 FROM room_members mine
+		         JOIN room_members theirs ON theirs.room_id = mine.room_id
+		         WHERE mine.user_id = $1 AND theirs.user_id = u.id))
+		ORDER BY u.profile_updated_at
+		LIMIT $3
+	`, userID, since, maxSyncProfiles)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	profiles := []SyncProfile{}
+	for rows.Next() {
+		var p SyncProfile
+		if err := rows.Scan(&p.ID, &p.Username, &p.AvatarURL, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, rows.Err()
+}
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SyncSnapshotTTL is how long a bootstrap's sync token can be resumed from.
+// A client that comes back later reloads instead.
+const SyncSnapshotTTL = time.Hour
+
+// CreateSyncSnapshot records the event sequence of every room userID is in
+// under token. Taken before the rest of a bootstrap is read, it is a point
+// no later than anything the bootstrap returns.
+func (s *Store) CreateSyncSnapshot(ctx context.Context, token string, userID uuid.UUID) error {
+	ctx, done := s.op(ctx, "CreateSyncSnapshot")
+	defer done()
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO sync_snapshots (token, user_id, room_seqs)
+		SELECT $1, $2, COALESCE(jsonb_object_agg(r.id, r.event_seq), '{}'::jsonb)
+		FROM room_members rm
+		JOIN rooms r ON r.id = rm.room_id
+		WHERE rm.user_id = $2
+	`, token, userID)
+	return err
+}
+
+// GetSyncSnapshot returns the room sequences userID's token was taken at,
+// or ErrNotFound when it is unknown, someone else's or expired.
+func (s *Store) GetSyncSnapshot(ctx context.Context, token string, userID uuid.UUID) (map[uuid.UUID]int64, error) {
+	ctx, done := s.op(ctx, "GetSyncSnapshot")
+	defer done()
+	var raw []byte
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT room_seqs FROM sync_snapshots
+		WHERE token = $1 AND user_id = $2 AND created_at > NOW() - make_interval(secs => $3)
+	`, token, userID, SyncSnapshotTTL.Seconds()).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	seqs := map[uuid.UUID]int64{}
+	return seqs, json.Unmarshal(raw, &seqs)
+}
+
+// DeleteExpiredSyncSnapshots removes snapshots past SyncSnapshotTTL.
+func (s *Store) DeleteExpiredSyncSnapshots(ctx context.Context) (int64, error) {
+	ctx, done := s.op(ctx, "DeleteExpiredSyncSnapshots")
+	defer done()
+	res, err := s.DB.ExecContext(ctx, `
+		DELETE FROM sync_snapshots WHERE created_at < NOW() - make_interval(secs => $1)
+	`, SyncSnapshotTTL.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ListMessagesChangedSince returns the messages of roomID created or edited
+// after event sequence seq, as they are now, oldest first. hasMore says
+// there were more than limit.
+func (s *Store) ListMessagesChangedSince(ctx context.Context, roomID uuid.UUID, seq int64, limit int) ([]Message, bool, error) {
+	ctx, done := s.op(ctx, "ListMessagesChangedSince")
+	defer done()
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT m.id, m.room_id, m.user_id, u.username, COALESCE(u.avatar_url, ''), m.content, m.message_type, COALESCE(m.media_url, ''), m.created_at, m.client_sent_at, m.shadowed, m.nsfw, m.audio::text, m.components::text, m.contact::text, COALESCE(m.alt_text, ''), m.alt_text_generated
+		FROM messages m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.room_id = $1
+		  AND m.id IN (
+			SELECT e.message_id FROM room_events e
+			WHERE e.room_id = $1 AND e.seq > $2 AND e.type IN ('message_created', 'message_edited')
+		  )
+		ORDER BY m.id
+		LIMIT $3
+	`, roomID, seq, limit+1)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+	messages := []Message{}
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.RoomID, &m.UserID, &m.Username, &m.AvatarURL, contentColumn{&m}, &m.MessageType, &m.MediaURL, &m.CreatedAt, &m.ClientSentAt, &m.Shadowed, &m.NSFW, audioColumn{&m.Audio}, componentsColumn{&m.Components}, contactColumn{&m.Contact}, &m.AltText, &m.AltTextGenerated); err != nil {
+			return nil, false, err
+		}
+		messages = append(messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	if len(messages) > limit {
+		return messages[:limit], true, nil
+	}
+	return messages, false, nil
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TelemetryStats are the aggregate counts an opt-in usage report carries.
+// Active users are those who posted in the period. Features counts the
+// rows of tables that each stand for one feature being set up.
+type TelemetryStats struct {
+	Users          int64            `json:"users"`
+	ActiveUsers1d  int64            `json:"active_users_1d"`
+	ActiveUsers30d int64            `json:"active_users_30d"`
+	Rooms          int64            `json:"rooms"`
+	Messages1d     int64            `json:"messages_1d"`
+	Features       map[string]int64 `json:"features"`
+}
+
+// telemetryFeatures maps a feature name to the table counted for it.
+var telemetryFeatures = map[string]string{
+	"automations":     "automations",
+	"slash_commands":  "room_commands",
+	"uptime_monitors": "uptime_monitors",
+	"repo_links":      "room_repo_links",
+	"room_embeds":     "room_embeds",
+	"board_items":     "board_items",
+	"push_devices":    "push_devices",
+	"workspace_sso":   "workspace_sso",
+	"scim_tokens":     "scim_tokens",
+	"legal_holds":     "legal_holds",
+	"archives":        "message_archives",
+	"call_feedback":   "call_feedback",
+}
+
+// GetTelemetryState returns the id reports are sent under and when the last
+// one went out, creating the id on first use.
+func (s *Store) GetTelemetryState(ctx context.Context) (uuid.UUID, *time.Time, error) {
+	ctx, done := s.op(ctx, "GetTelemetryState")
+	defer done()
+	var id uuid.UUID
+	var lastSent *time.Time
+	err := s.DB.QueryRowContext(ctx, `
+		WITH created AS (
+			INSERT INTO telemetry_state DEFAULT VALUES
+			ON CONFLICT (id) DO NOTHING
+			RETURNING instance_id, last_sent_at
+		)
+		SELECT instance_id, last_sent_at FROM created
+		UNION ALL
+		SELECT instance_id, last_sent_at FROM telemetry_state
+		LIMIT 1
+	`).Scan(&id, &lastSent)
+	return id, lastSent, err
+}
+
+func (s *Store) MarkTelemetrySent(ctx context.Context, at time.Time) error {
+	ctx, done := s.op(ctx, "MarkTelemetrySent")
+	defer done()
+	return s.execOne(ctx, `UPDATE telemetry_state SET last_sent_at = $1`, at)
+}
+
+// AddTelemetryUsage adds counts, keyed by feature, to the totals waiting for
+// the next report.
+func (s *Store) AddTelemetryUsage(ctx context.Context, counts map[string]int64) error {
+	ctx, done := s.op(ctx, "AddTelemetryUsage")
+	defer done()
+	features := make([]string, 0, len(counts))
+	values := make([]int64, 0, len(counts))
+	for f, n := range counts {
+		features = append(features, f)
+		values = append(values, n)
+	}
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO telemetry_usage (feature, count)
+		SELECT * FROM unnest($1::text[], $2::bigint[])
+		ON CONFLICT (feature) DO UPDATE SET count = telemetry_usage.count + EXCLUDED.count
+	`, features, values)
+	return err
+}
+
+// TakeTelemetryUsage returns the usage totals and clears them.
+func (s *Store) TakeTelemetryUsage(ctx context.Context) (map[string]int64, error) {
+	ctx, done := s.op(ctx, "TakeTelemetryUsage")
+	defer done()
+	rows, err := s.DB.QueryContext(ctx, `DELETE FROM telemetry_usage RETURNING feature, count`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]int64{}
+	for rows.Next() {
+		var f string
+		var n int64
+		if err := rows.Scan(&f, &n); err != nil {
+			return nil, err
+		}
+		out[f] += n
+	}
+	return out, rows.Err()
+}
+
+// GetTelemetryStats counts users, rooms, recent activity and feature use.
+func (s *Store) GetTelemetryStats(ctx context.Context) (TelemetryStats, error) {
+	ctx, done := s.op(ctx, "GetTelemetryStats")
+	defer done()
+	var st TelemetryStats
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT (SELECT COUNT(*) FROM users WHERE guest_expires_at IS NULL AND NOT is_bot),
+		       COUNT(DISTINCT m.user_id) FILTER (WHERE m.created_at > NOW() - INTERVAL '1 day'),
+		       COUNT(DISTINCT m.user_id),
+		       (SELECT COUNT(*) FROM rooms),
+		       COUNT(*) FILTER (WHERE m.created_at > NOW() - INTERVAL '1 day')
+		FROM messages m
+		WHERE m.created_at > NOW() - INTERVAL '30 days'
+	`).Scan(&st.Users, &st.ActiveUsers1d, &st.ActiveUsers30d, &st.Rooms, &st.Messages1d)
+	if err != nil {
+		return TelemetryStats{}, err
+	}
+	st.Features = make(map[string]int64, len(telemetryFeatures))
+	for name, table := range telemetryFeatures {
+		var n int64
+		if err := s.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+table).Scan(&n); err != nil {
+			return TelemetryStats{}, err
+		}
+		st.Features[name] = n
+	}
+	return st, nil
+}
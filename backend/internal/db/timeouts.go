@@ -0,0 +1,91 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"talkie/backend/internal/metrics"
+)
+
+// Every Store method that talks to Postgres opens with s.op, which bounds
+// the call by a per-operation timeout and records how long it took. A slow
+// database then fails requests quickly instead of piling up goroutines that
+// each hold a pooled connection.
+
+// DefaultQueryTimeout applies to operations without an override.
+const DefaultQueryTimeout = 5 * time.Second
+
+// defaultOpTimeouts gives whole-table maintenance work more room than an
+// interactive query. SetQueryTimeouts overrides these per operation.
+var defaultOpTimeouts = map[string]time.Duration{
+	"DeleteUsersByEmailDomain": 2 * time.Minute,
+	"IndexMessages":            time.Minute,
+	"RefreshUnreadCounts":      time.Minute,
+	"PurgeSoftDeleted":         10 * time.Minute,
+	"RefreshRollups":           10 * time.Minute,
+	"RefreshRoomActivity":      10 * time.Minute,
+	"ListReferencedUploads":    2 * time.Minute,
+	"DeleteExpiredGuests":      2 * time.Minute,
+	"ArchiveMessages":          2 * time.Minute,
+	"GetTelemetryStats":        2 * time.Minute,
+}
+
+var (
+	queryDuration = metrics.NewHistogram("talkie_db_query_duration_seconds", "Latency of Store operations, including transactions.", nil)
+	queryTimeouts = metrics.NewCounterVec("talkie_db_query_timeouts_total", "Store operations cancelled by their own timeout.", "op")
+	queryCanceled = metrics.NewCounterVec("talkie_db_query_canceled_total", "Store operations abandoned because the caller's context ended first.", "op")
+)
+
+var errQueryTimeout = errors.New("db: query timeout")
+
+type opKey struct{}
+
+// SetQueryTimeouts replaces the default timeout and the per-operation
+// overrides, keyed by Store method name. Zero or negative disables the
+// timeout for that operation; the caller's context still applies.
+func (s *Store) SetQueryTimeouts(def time.Duration, perOp map[string]time.Duration) {
+	timeouts := make(map[string]time.Duration, len(defaultOpTimeouts)+len(perOp))
+	for name, d := range defaultOpTimeouts {
+		timeouts[name] = d
+	}
+	for name, d := range perOp {
+		timeouts[name] = d
+	}
+	s.defaultTimeout = def
+	s.timeouts = timeouts
+}
+
+func (s *Store) timeoutFor(name string) time.Duration {
+	if d, ok := s.timeouts[name]; ok {
+		return d
+	}
+	return s.defaultTimeout
+}
+
+// op starts the Store operation name. The returned func must be deferred;
+// it releases the timeout and records the outcome. Operations nested in
+// another one (SaveMessage calling SaveMessageWithType, say) run under the
+// outer operation's budget and are not counted twice.
+func (s *Store) op(ctx context.Context, name string) (context.Context, func()) {
+	if ctx.Value(opKey{}) != nil {
+		return ctx, func() {}
+	}
+	ctx = context.WithValue(ctx, opKey{}, name)
+	cancel := context.CancelFunc(func() {})
+	if d := s.timeoutFor(name); d > 0 {
+		ctx, cancel = context.WithTimeoutCause(ctx, d, errQueryTimeout)
+	}
+	start := time.Now()
+	return ctx, func() {
+		queryDuration.ObserveSince(start)
+		if ctx.Err() != nil {
+			if context.Cause(ctx) == errQueryTimeout {
+				queryTimeouts.With(name).Add(1)
+			} else {
+				queryCanceled.With(name).Add(1)
+			}
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,121 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// UploadBlob is a stored upload known by its content hash. Location is the
+// URL prefix of the storage location holding it.
+type UploadBlob struct {
+	Location string
+	SHA256   string
+	URL      string
+	Size     int64
+	NSFW     bool
+	RefCount int
+}
+
+// ReuseUploadBlob looks up a file with the same content in location and
+// marks it used, which keeps upload GC off it until the message that
+// reuses it is saved.
+func (s *Store) ReuseUploadBlob(ctx context.Context, location, sha256 string) (UploadBlob, error) {
+	ctx, done := s.op(ctx, "ReuseUploadBlob")
+	defer done()
+	b := UploadBlob{Location: location, SHA256: sha256}
+	err := s.DB.QueryRowContext(ctx, `
+		UPDATE upload_blobs SET last_used_at = NOW()
+		WHERE location = $1 AND sha256 = $2
+		RETURNING url, size, nsfw, ref_count
+	`, location, sha256).Scan(&b.URL, &b.Size, &b.NSFW, &b.RefCount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return UploadBlob{}, ErrNotFound
+	}
+	return b, err
+}
+
+// SaveUploadBlob records a newly stored file. A row left for the same
+// content whose file has since gone is replaced; if the URL changed its
+// count restarts, since messages naming the old URL no longer count.
+func (s *Store) SaveUploadBlob(ctx context.Context, b UploadBlob) error {
+	ctx, done := s.op(ctx, "SaveUploadBlob")
+	defer done()
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO upload_blobs (location, sha256, url, size, nsfw)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (location, sha256) DO UPDATE
+		SET url = EXCLUDED.url, size = EXCLUDED.size, nsfw = EXCLUDED.nsfw,
+		    ref_count = CASE WHEN upload_blobs.url = EXCLUDED.url THEN upload_blobs.ref_count ELSE 0 END,
+		    created_at = NOW(), last_used_at = NOW()
+	`, b.Location, b.SHA256, b.URL, b.Size, b.NSFW)
+	return err
+}
+
+// ListRoomMediaURLs returns the /uploads/... URLs roomID's messages use.
+func (s *Store) ListRoomMediaURLs(ctx context.Context, roomID uuid.UUID) ([]string, error) {
+	ctx, done := s.op(ctx, "ListRoomMediaURLs")
+	defer done()
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT DISTINCT media_url FROM messages WHERE room_id = $1 AND media_url LIKE '/uploads/%'
+	`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, err
+		}
+		out = append(out, url)
+	}
+	return out, rows.Err()
+}
+
+// MoveUpload points everything naming oldURL at newURL, the
+// content-addressed path of the same file, and records its hash there.
+// It returns how many messages were rewritten. Reference counts are left
+// to RecountUploadBlobs.
+func (s *Store) MoveUpload(ctx context.Context, b UploadBlob, oldURL string) (int64, error) {
+	ctx, done := s.op(ctx, "MoveUpload")
+	defer done()
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `UPDATE messages SET media_url = $2 WHERE media_url = $1`, oldURL, b.URL)
+	if err != nil {
+		return 0, err
+	}
+	moved, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	// Copies of the same content in other rooms all map to one row; a
+	// verdict on any of them carries over.
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO upload_blobs (location, sha256, url, size)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (location, sha256) DO UPDATE SET url = EXCLUDED.url
+	`, b.Location, b.SHA256, b.URL, b.Size); err != nil {
+		return 0, err
+	}
+	return moved, tx.Commit()
+}
+
+// RecountUploadBlobs recomputes every blob's reference count from the
+// messages, after bulk rewrites the trigger could not follow.
+func (s *Store) RecountUploadBlobs(ctx context.Context) error {
+	ctx, done := s.op(ctx, "RecountUploadBlobs")
+	defer done()
+	_, err := s.DB.ExecContext(ctx, `
+		UPDATE upload_blobs b
+		SET ref_count = (SELECT COUNT(*) FROM messages m WHERE m.media_url = b.url)
+	`)
+	return err
+}
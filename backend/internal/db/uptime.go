@@ -0,0 +1,163 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Uptime monitor states. Monitors start unknown until their first check.
+const (
+	UptimeUnknown = "unknown"
+	UptimeUp      = "up"
+	UptimeDown    = "down"
+)
+
+// UptimeMonitor is a URL the server probes every IntervalS seconds.
+type UptimeMonitor struct {
+	ID     int64     `json:"id"`
+	Name   string    `json:"name"`
+	URL    string    `json:"url"`
+	RoomID uuid.UUID `json:"room_id"`
+	// IntervalS is how often the URL is probed, in seconds.
+	IntervalS int `json:"interval_s"`
+	// ExpectStatus is the HTTP status a healthy URL answers; 0 accepts any
+	// 2xx or 3xx.
+	ExpectStatus int  `json:"expect_status"`
+	Public       bool `json:"public"`
+
+	State         string     `json:"state"`
+	Failures      int        `json:"failures"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastLatencyMS *int       `json:"last_latency_ms,omitempty"`
+	LastCheckedAt *time.Time `json:"last_checked_at,omitempty"`
+	LastChangeAt  *time.Time `json:"last_change_at,omitempty"`
+	CreatedBy     *uuid.UUID `json:"created_by,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// UptimeCheck is the outcome of one probe, already folded into the
+// monitor's state by the caller.
+type UptimeCheck struct {
+	State     string
+	Failures  int
+	Error     string
+	LatencyMS int
+	Changed   bool
+}
+
+const uptimeColumns = `id, name, url, room_id, interval_s, expect_status, public, state, failures, last_error,
+	last_latency_ms, last_checked_at, last_change_at, created_by, created_at`
+
+func scanUptimeMonitor(row interface{ Scan(...any) error }) (UptimeMonitor, error) {
+	var m UptimeMonitor
+	err := row.Scan(&m.ID, &m.Name, &m.URL, &m.RoomID, &m.IntervalS, &m.ExpectStatus, &m.Public, &m.State, &m.Failures, &m.LastError,
+		&m.LastLatencyMS, &m.LastCheckedAt, &m.LastChangeAt, &m.CreatedBy, &m.CreatedAt)
+	return m, err
+}
+
+func (s *Store) listUptimeMonitors(ctx context.Context, query string, args ...any) ([]UptimeMonitor, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT `+uptimeColumns+` FROM uptime_monitors `+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []UptimeMonitor{}
+	for rows.Next() {
+		m, err := scanUptimeMonitor(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// ListUptimeMonitors returns every monitor, oldest first.
+func (s *Store) ListUptimeMonitors(ctx context.Context) ([]UptimeMonitor, error) {
+	ctx, done := s.op(ctx, "ListUptimeMonitors")
+	defer done()
+	return s.listUptimeMonitors(ctx, `ORDER BY id`)
+}
+
+// ListPublicUptimeMonitors returns the monitors shown on the status page.
+func (s *Store) ListPublicUptimeMonitors(ctx context.Context) ([]UptimeMonitor, error) {
+	ctx, done := s.op(ctx, "ListPublicUptimeMonitors")
+	defer done()
+	return s.listUptimeMonitors(ctx, `WHERE public ORDER BY name, id`)
+}
+
+// ListDueUptimeMonitors returns up to limit monitors whose next probe is
+// due, the longest overdue first.
+func (s *Store) ListDueUptimeMonitors(ctx context.Context, limit int) ([]UptimeMonitor, error) {
+	ctx, done := s.op(ctx, "ListDueUptimeMonitors")
+	defer done()
+	return s.listUptimeMonitors(ctx, `
+		WHERE last_checked_at IS NULL OR last_checked_at + make_interval(secs => interval_s) <= NOW()
+		ORDER BY last_checked_at NULLS FIRST
+		LIMIT $1`, limit)
+}
+
+func (s *Store) GetUptimeMonitor(ctx context.Context, id int64) (UptimeMonitor, error) {
+	ctx, done := s.op(ctx, "GetUptimeMonitor")
+	defer done()
+	m, err := scanUptimeMonitor(s.DB.QueryRowContext(ctx, `SELECT `+uptimeColumns+` FROM uptime_monitors WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return UptimeMonitor{}, ErrNotFound
+	}
+	return m, err
+}
+
+// CreateUptimeMonitor stores m; its first probe is due right away.
+func (s *Store) CreateUptimeMonitor(ctx context.Context, m UptimeMonitor) (UptimeMonitor, error) {
+	ctx, done := s.op(ctx, "CreateUptimeMonitor")
+	defer done()
+	err := s.DB.QueryRowContext(ctx, `
+		INSERT INTO uptime_monitors (name, url, room_id, interval_s, expect_status, public, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, state, created_at
+	`, m.Name, m.URL, m.RoomID, m.IntervalS, m.ExpectStatus, m.Public, m.CreatedBy).Scan(&m.ID, &m.State, &m.CreatedAt)
+	return m, err
+}
+
+// UpdateUptimeMonitor saves m's settings and who posts its alerts. Changing the URL or expected
+// status starts the monitor over as unknown, due right away.
+func (s *Store) UpdateUptimeMonitor(ctx context.Context, m UptimeMonitor) (UptimeMonitor, error) {
+	ctx, done := s.op(ctx, "UpdateUptimeMonitor")
+	defer done()
+	// Every SET expression sees the row as it was before the update.
+	row := s.DB.QueryRowContext(ctx, `
+		UPDATE uptime_monitors
+		SET name = $2, url = $3, room_id = $4, interval_s = $5, expect_status = $6, public = $7, created_by = $8,
+		    state = CASE WHEN url <> $3 OR expect_status <> $6 THEN 'unknown' ELSE state END,
+		    failures = CASE WHEN url <> $3 OR expect_status <> $6 THEN 0 ELSE failures END,
+		    last_checked_at = CASE WHEN url <> $3 OR expect_status <> $6 THEN NULL ELSE last_checked_at END
+		WHERE id = $1
+		RETURNING `+uptimeColumns, m.ID, m.Name, m.URL, m.RoomID, m.IntervalS, m.ExpectStatus, m.Public, m.CreatedBy)
+	updated, err := scanUptimeMonitor(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return UptimeMonitor{}, ErrNotFound
+	}
+	return updated, err
+}
+
+func (s *Store) DeleteUptimeMonitor(ctx context.Context, id int64) error {
+	ctx, done := s.op(ctx, "DeleteUptimeMonitor")
+	defer done()
+	return s.execOne(ctx, `DELETE FROM uptime_monitors WHERE id = $1`, id)
+}
+
+// RecordUptimeCheck stores the outcome of a probe of monitor id.
+func (s *Store) RecordUptimeCheck(ctx context.Context, id int64, c UptimeCheck) error {
+	ctx, done := s.op(ctx, "RecordUptimeCheck")
+	defer done()
+	return s.execOne(ctx, `
+		UPDATE uptime_monitors
+		SET state = $2, failures = $3, last_error = $4, last_latency_ms = $5, last_checked_at = NOW(),
+		    last_change_at = CASE WHEN $6::boolean THEN NOW() ELSE last_change_at END
+		WHERE id = $1
+	`, id, c.State, c.Failures, c.Error, c.LatencyMS, c.Changed)
+}
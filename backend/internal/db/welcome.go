@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// Welcome modes: "off", "room" (greeting posted in the room) or "dm"
+// (greeting sent as a direct message from the sender).
+var WelcomeModes = []string{"off", "room", "dm"}
+
+type RoomWelcome struct {
+	Mode     string     `json:"mode"`
+	Template string     `json:"template"`
+	SenderID *uuid.UUID `json:"sender_id,omitempty"`
+}
+
+func (s *Store) GetRoomWelcome(ctx context.Context, roomID uuid.UUID) (RoomWelcome, error) {
+	ctx, done := s.op(ctx, "GetRoomWelcome")
+	defer done()
+	var w RoomWelcome
+	var sender uuid.NullUUID
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT welcome_mode, welcome_template, welcome_sender FROM rooms WHERE id = $1
+	`, roomID).Scan(&w.Mode, &w.Template, &sender)
+	if errors.Is(err, sql.ErrNoRows) {
+		return RoomWelcome{}, ErrNotFound
+	}
+	if err != nil {
+		return RoomWelcome{}, err
+	}
+	if sender.Valid {
+		w.SenderID = &sender.UUID
+	}
+	return w, nil
+}
+
+func (s *Store) SetRoomWelcome(ctx context.Context, roomID uuid.UUID, mode, template string, senderID uuid.UUID) error {
+	ctx, done := s.op(ctx, "SetRoomWelcome")
+	defer done()
+	return s.execOne(ctx, `
+		UPDATE rooms SET welcome_mode = $2, welcome_template = $3, welcome_sender = $4 WHERE id = $1
+	`, roomID, mode, template, senderID)
+}
+
+// MarkWelcomeSent records that userID was greeted in roomID. It reports
+// false when they already were, so a greeting goes out at most once.
+func (s *Store) MarkWelcomeSent(ctx context.Context, roomID, userID uuid.UUID) (bool, error) {
+	ctx, done := s.op(ctx, "MarkWelcomeSent")
+	defer done()
+	res, err := s.DB.ExecContext(ctx, `
+		INSERT INTO room_welcomes_sent (room_id, user_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, roomID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
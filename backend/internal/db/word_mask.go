@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// WordMask is a room's masking setting. Words adds to the server-wide list.
+type WordMask struct {
+	Enabled bool     `json:"enabled"`
+	Words   []string `json:"words"`
+}
+
+func (s *Store) GetRoomWordMask(ctx context.Context, roomID uuid.UUID) (WordMask, error) {
+	ctx, done := s.op(ctx, "GetRoomWordMask")
+	defer done()
+	var wm WordMask
+	var raw []byte
+	err := s.DB.QueryRowContext(ctx, `SELECT word_mask, masked_words FROM rooms WHERE id = $1`, roomID).Scan(&wm.Enabled, &raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return WordMask{}, ErrNotFound
+	}
+	if err != nil {
+		return WordMask{}, err
+	}
+	if err := json.Unmarshal(raw, &wm.Words); err != nil {
+		return WordMask{}, err
+	}
+	if wm.Words == nil {
+		wm.Words = []string{}
+	}
+	return wm, nil
+}
+
+func (s *Store) SetRoomWordMask(ctx context.Context, roomID uuid.UUID, wm WordMask) error {
+	ctx, done := s.op(ctx, "SetRoomWordMask")
+	defer done()
+	if wm.Words == nil {
+		wm.Words = []string{}
+	}
+	raw, err := json.Marshal(wm.Words)
+	if err != nil {
+		return err
+	}
+	return s.execOne(ctx, `UPDATE rooms SET word_mask = $2, masked_words = $3 WHERE id = $1`, roomID, wm.Enabled, string(raw))
+}
+
+// Masked returns m as members who may not see the original receive it: with
+// Content replaced by ContentMasked when masking changed it.
+func (m Message) Masked() Message {
+	if m.ContentMasked != "" {
+		m.Content = m.ContentMasked
+	}
+	return m
+}
+
+// WithoutOriginalContent applies Masked to each message. Like VisibleTo it
+// copies.
+func WithoutOriginalContent(messages []Message) []Message {
+	out := make([]Message, len(messages))
+	for i, m := range messages {
+		out[i] = m.Masked()
+	}
+	return out
+}
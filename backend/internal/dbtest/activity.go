@@ -0,0 +1,39 @@
+package dbtest
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+// RoomActivity counts messages directly; the fake has no rollup to lag.
+func (s *Store) RoomActivity(_ context.Context, roomID uuid.UUID, from, to time.Time, bucket string, loc *time.Location) ([]db.ActivityBucket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := make(map[time.Time]int)
+	for _, m := range s.messages {
+		if m.RoomID != roomID || m.Shadowed {
+			continue
+		}
+		hour := m.CreatedAt.UTC().Truncate(time.Hour)
+		if hour.Before(from) || !hour.Before(to) {
+			continue
+		}
+		start := hour
+		if bucket == db.ActivityDay {
+			t := hour.In(loc)
+			start = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		}
+		counts[start]++
+	}
+	buckets := make([]db.ActivityBucket, 0, len(counts))
+	for start, n := range counts {
+		buckets = append(buckets, db.ActivityBucket{Start: start, Messages: n})
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Start.Before(buckets[j].Start) })
+	return buckets, nil
+}
@@ -0,0 +1,49 @@
+package dbtest
+
+import (
+	"context"
+	"slices"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) GetNotificationSettings(_ context.Context, userID uuid.UUID) (db.NotificationSettings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return db.NotificationSettings{}, db.ErrNotFound
+	}
+	q := u.quietHours
+	q.Windows = append([]db.QuietWindow{}, q.Windows...)
+	return db.NotificationSettings{AdminEmails: !u.noAdminMail, QuietHours: q}, nil
+}
+
+func (s *Store) SetNotificationSettings(_ context.Context, userID uuid.UUID, ns db.NotificationSettings) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return db.ErrNotFound
+	}
+	u.noAdminMail = !ns.AdminEmails
+	u.quietHours = ns.QuietHours
+	u.quietHours.Windows = slices.Clone(ns.QuietHours.Windows)
+	return nil
+}
+
+func (s *Store) ListAdminEmailContacts(_ context.Context, roomID uuid.UUID) ([]db.AdminContact, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []db.AdminContact
+	for id, m := range s.members[roomID] {
+		u, ok := s.users[id]
+		if m.role != "admin" || !ok || u.noAdminMail || !u.EmailVerified || u.Email == "" {
+			continue
+		}
+		out = append(out, db.AdminContact{UserID: id, Email: u.Email, Username: u.Username, Timezone: u.locale.Timezone, QuietHours: u.quietHours})
+	}
+	return out, nil
+}
@@ -0,0 +1,42 @@
+package dbtest
+
+import (
+	"context"
+	"time"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) GetUserAge(_ context.Context, userID uuid.UUID) (db.AgeSettings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return db.AgeSettings{}, db.ErrNotFound
+	}
+	return u.age, nil
+}
+
+func (s *Store) SetUserDateOfBirth(_ context.Context, userID uuid.UUID, dob *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return db.ErrNotFound
+	}
+	u.age.DateOfBirth = dob
+	return nil
+}
+
+func (s *Store) SetUserAgeRestricted(_ context.Context, userID uuid.UUID, restricted *bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return db.ErrNotFound
+	}
+	u.age.RestrictedOverride = restricted
+	return nil
+}
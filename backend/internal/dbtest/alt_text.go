@@ -0,0 +1,35 @@
+package dbtest
+
+import (
+	"context"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) SetMessageAltText(_ context.Context, roomID uuid.UUID, messageID int64, altText string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.messages {
+		m := &s.messages[i]
+		if m.ID == messageID && m.RoomID == roomID && m.MessageType == "image" {
+			m.AltText, m.AltTextGenerated = altText, false
+			return nil
+		}
+	}
+	return db.ErrNotFound
+}
+
+func (s *Store) SetGeneratedAltText(_ context.Context, roomID uuid.UUID, messageID int64, altText string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.messages {
+		m := &s.messages[i]
+		if m.ID == messageID && m.RoomID == roomID && m.MessageType == "image" && m.AltText == "" {
+			m.AltText, m.AltTextGenerated = altText, true
+			return nil
+		}
+	}
+	return db.ErrNotFound
+}
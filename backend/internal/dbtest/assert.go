@@ -0,0 +1,13 @@
+package dbtest
+
+import (
+	"talkie/backend/internal/httpapi"
+	"talkie/backend/internal/notify"
+)
+
+// Importing httpapi here means tests that use the fake live in external test
+// packages (package httpapi_test, ws_test) to avoid an import cycle.
+var (
+	_ httpapi.Store      = (*Store)(nil)
+	_ notify.DeviceStore = (*Store)(nil)
+)
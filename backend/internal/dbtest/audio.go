@@ -0,0 +1,21 @@
+package dbtest
+
+import (
+	"context"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) SetMessageAudio(_ context.Context, roomID uuid.UUID, messageID int64, info db.AudioInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.messages {
+		if s.messages[i].ID == messageID && s.messages[i].RoomID == roomID {
+			s.messages[i].Audio = &info
+			return nil
+		}
+	}
+	return db.ErrNotFound
+}
@@ -0,0 +1,161 @@
+package dbtest
+
+import (
+	"context"
+	"slices"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) ListAutomations(_ context.Context, ownerID uuid.UUID) ([]db.Automation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []db.Automation{}
+	for _, a := range s.automations {
+		if a.OwnerID == ownerID {
+			out = append(out, *a)
+		}
+	}
+	return out, nil
+}
+
+func (s *Store) ListRoomAutomations(_ context.Context, roomIDs []uuid.UUID) ([]db.Automation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []db.Automation
+	for _, a := range s.automations {
+		if a.Enabled && slices.Contains(roomIDs, a.RoomID) {
+			out = append(out, *a)
+		}
+	}
+	return out, nil
+}
+
+func (s *Store) GetAutomation(_ context.Context, ownerID uuid.UUID, id int64) (db.Automation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a := s.automationLocked(ownerID, id); a != nil {
+		return *a, nil
+	}
+	return db.Automation{}, db.ErrNotFound
+}
+
+func (s *Store) CountAutomations(_ context.Context, ownerID uuid.UUID) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, a := range s.automations {
+		if a.OwnerID == ownerID {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *Store) CreateAutomation(_ context.Context, a db.Automation) (db.Automation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[a.RoomID]; !ok {
+		return db.Automation{}, db.ErrNotFound
+	}
+	s.nextAutomationID++
+	a.ID = s.nextAutomationID
+	a.CreatedAt = s.now()
+	a.UpdatedAt = a.CreatedAt
+	a.Actions = slices.Clone(a.Actions)
+	s.automations = append(s.automations, &a)
+	return a, nil
+}
+
+func (s *Store) UpdateAutomation(_ context.Context, a db.Automation) (db.Automation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing := s.automationLocked(a.OwnerID, a.ID)
+	if existing == nil {
+		return db.Automation{}, db.ErrNotFound
+	}
+	a.CreatedAt = existing.CreatedAt
+	a.UpdatedAt = s.now()
+	a.Actions = slices.Clone(a.Actions)
+	*existing = a
+	return a, nil
+}
+
+func (s *Store) DeleteAutomation(_ context.Context, ownerID uuid.UUID, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.automations, func(a *db.Automation) bool { return a.ID == id && a.OwnerID == ownerID })
+	if i < 0 {
+		return db.ErrNotFound
+	}
+	s.automations = slices.Delete(s.automations, i, i+1)
+	delete(s.autoRuns, id)
+	return nil
+}
+
+func (s *Store) StartAutomationRun(_ context.Context, automationID, messageID int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.autoRuns[automationID] {
+		if r.MessageID == messageID {
+			return false, nil
+		}
+	}
+	s.autoRuns[automationID] = append(s.autoRuns[automationID], db.AutomationRun{MessageID: messageID, Status: db.AutomationRunRunning, CreatedAt: s.now()})
+	return true, nil
+}
+
+func (s *Store) FinishAutomationRun(_ context.Context, automationID, messageID int64, runErr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	runs := s.autoRuns[automationID]
+	for i := range runs {
+		if runs[i].MessageID != messageID {
+			continue
+		}
+		runs[i].Status = db.AutomationRunOK
+		if runErr != "" {
+			runs[i].Status = db.AutomationRunFailed
+		}
+		runs[i].Error = runErr
+		now := s.now()
+		runs[i].FinishedAt = &now
+		return nil
+	}
+	return db.ErrNotFound
+}
+
+func (s *Store) ListAutomationRuns(_ context.Context, automationID int64, limit int) ([]db.AutomationRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []db.AutomationRun{}
+	runs := s.autoRuns[automationID]
+	for i := len(runs) - 1; i >= 0 && len(out) < limit; i-- {
+		out = append(out, runs[i])
+	}
+	return out, nil
+}
+
+func (s *Store) SaveAutomationMessage(_ context.Context, roomID, userID uuid.UUID, automationID int64, content string) (db.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return db.Message{}, db.ErrNotFound
+	}
+	if _, ok := s.rooms[roomID]; !ok {
+		return db.Message{}, db.ErrNotFound
+	}
+	return s.saveMessageLocked(roomID, u, content, "text", "", nil), nil
+}
+
+func (s *Store) automationLocked(ownerID uuid.UUID, id int64) *db.Automation {
+	for _, a := range s.automations {
+		if a.ID == id && a.OwnerID == ownerID {
+			return a
+		}
+	}
+	return nil
+}
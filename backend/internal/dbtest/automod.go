@@ -0,0 +1,133 @@
+package dbtest
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) ListAutomodRules(_ context.Context, roomID uuid.UUID) ([]db.AutomodRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []db.AutomodRule{}
+	for _, r := range s.automodRules {
+		if r.RoomID == roomID {
+			out = append(out, *r)
+		}
+	}
+	return out, nil
+}
+
+func (s *Store) CreateAutomodRule(_ context.Context, rule db.AutomodRule) (db.AutomodRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[rule.RoomID]; !ok {
+		return db.AutomodRule{}, db.ErrNotFound
+	}
+	s.nextAutomodRuleID++
+	rule.ID = s.nextAutomodRuleID
+	rule.CreatedAt = s.now()
+	s.automodRules = append(s.automodRules, &rule)
+	return rule, nil
+}
+
+func (s *Store) UpdateAutomodRule(_ context.Context, rule db.AutomodRule) (db.AutomodRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.automodRules {
+		if r.ID == rule.ID && r.RoomID == rule.RoomID {
+			r.Kind, r.Config, r.Action, r.MuteMinutes, r.Enabled = rule.Kind, rule.Config, rule.Action, rule.MuteMinutes, rule.Enabled
+			return *r, nil
+		}
+	}
+	return db.AutomodRule{}, db.ErrNotFound
+}
+
+func (s *Store) DeleteAutomodRule(_ context.Context, roomID uuid.UUID, ruleID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.automodRules, func(r *db.AutomodRule) bool { return r.ID == ruleID && r.RoomID == roomID })
+	if i < 0 {
+		return db.ErrNotFound
+	}
+	s.automodRules = slices.Delete(s.automodRules, i, i+1)
+	return nil
+}
+
+func (s *Store) RecordAutomodEvent(_ context.Context, ev db.AutomodEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[ev.UserID]
+	if !ok {
+		return db.ErrNotFound
+	}
+	s.nextAutomodEventID++
+	ev.ID = s.nextAutomodEventID
+	ev.Username = u.Username
+	ev.CreatedAt = s.now()
+	s.automodEvents = append(s.automodEvents, ev)
+	return nil
+}
+
+func (s *Store) ListAutomodEvents(_ context.Context, roomID uuid.UUID, limit int) ([]db.AutomodEvent, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []db.AutomodEvent{}
+	for i := len(s.automodEvents) - 1; i >= 0 && len(out) < limit; i-- {
+		if s.automodEvents[i].RoomID == roomID {
+			out = append(out, s.automodEvents[i])
+		}
+	}
+	return out, nil
+}
+
+func (s *Store) MuteRoomMember(_ context.Context, roomID, userID uuid.UUID, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := [2]uuid.UUID{roomID, userID}
+	if until.After(s.mutes[key]) {
+		s.mutes[key] = until
+	}
+	return nil
+}
+
+func (s *Store) UnmuteRoomMember(_ context.Context, roomID, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := [2]uuid.UUID{roomID, userID}
+	if !s.mutes[key].After(s.now()) {
+		return db.ErrNotFound
+	}
+	delete(s.mutes, key)
+	return nil
+}
+
+func (s *Store) ListRoomMutes(_ context.Context, roomID uuid.UUID) (map[uuid.UUID]time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	out := map[uuid.UUID]time.Time{}
+	for key, until := range s.mutes {
+		if key[0] == roomID && until.After(now) {
+			out[key[1]] = until
+		}
+	}
+	return out, nil
+}
+
+func (s *Store) GetMemberJoinedAt(_ context.Context, roomID, userID uuid.UUID) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.members[roomID][userID]
+	if !ok {
+		return time.Time{}, db.ErrNotFound
+	}
+	return m.joinedAt, nil
+}
@@ -0,0 +1,77 @@
+package dbtest
+
+import (
+	"context"
+	"time"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+type subscription struct {
+	db.Subscription
+	eventAt time.Time
+}
+
+func (s *Store) RecordBillingEvent(_ context.Context, eventID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.seenEvents[eventID]; ok {
+		return false, nil
+	}
+	s.seenEvents[eventID] = struct{}{}
+	return true, nil
+}
+
+func (s *Store) ForgetBillingEvent(_ context.Context, eventID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.seenEvents, eventID)
+	return nil
+}
+
+func (s *Store) ApplySubscription(_ context.Context, sub db.Subscription, eventAt time.Time, entitled bool) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	plans, ownerID := s.userPlans, sub.UserID
+	if sub.GroupID != nil {
+		plans, ownerID = s.groupPlans, sub.GroupID
+		if _, ok := s.groups[*ownerID]; !ok {
+			return false, db.ErrNotFound
+		}
+	} else if ownerID == nil {
+		return false, db.ErrNotFound
+	} else if _, ok := s.users[*ownerID]; !ok {
+		return false, db.ErrNotFound
+	}
+
+	prev, ok := s.subs[sub.ID]
+	if ok && prev.eventAt.After(eventAt) {
+		return false, nil
+	}
+	sub.UpdatedAt = s.now()
+	s.subs[sub.ID] = &subscription{Subscription: sub, eventAt: eventAt}
+	if ok && prev.Plan != "" && plans[*ownerID] == prev.Plan {
+		delete(plans, *ownerID)
+	}
+	if _, exists := s.plans[sub.Plan]; entitled && sub.Plan != "" && exists {
+		plans[*ownerID] = sub.Plan
+	}
+	return true, nil
+}
+
+func (s *Store) GetUserSubscription(_ context.Context, userID uuid.UUID) (db.Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var latest *subscription
+	for _, sub := range s.subs {
+		if sub.UserID != nil && *sub.UserID == userID && (latest == nil || sub.UpdatedAt.After(latest.UpdatedAt)) {
+			latest = sub
+		}
+	}
+	if latest == nil {
+		return db.Subscription{}, db.ErrNotFound
+	}
+	return latest.Subscription, nil
+}
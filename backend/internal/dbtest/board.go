@@ -0,0 +1,149 @@
+package dbtest
+
+import (
+	"context"
+	"slices"
+	"sort"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+type boardItem struct {
+	db.BoardItem
+	userID uuid.UUID
+}
+
+func (s *Store) ListBoardItems(_ context.Context, userID uuid.UUID) ([]db.BoardItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []db.BoardItem{}
+	for _, it := range s.boardItemsLocked(userID) {
+		out = append(out, s.resolveBoardItemLocked(it))
+	}
+	return out, nil
+}
+
+func (s *Store) CountBoardItems(_ context.Context, userID uuid.UUID) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.boardItemsLocked(userID)), nil
+}
+
+func (s *Store) AddBoardItem(_ context.Context, userID uuid.UUID, item db.BoardItem) (db.BoardItem, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pos := 0
+	for _, it := range s.boardItemsLocked(userID) {
+		if item.Kind == db.BoardMessage && it.MessageID == item.MessageID {
+			return s.resolveBoardItemLocked(it), false, nil
+		}
+		pos = max(pos, it.Position)
+	}
+	s.nextBoardItemID++
+	now := s.now()
+	it := &boardItem{userID: userID, BoardItem: db.BoardItem{
+		ID: s.nextBoardItemID, Kind: item.Kind, MessageID: item.MessageID, URL: item.URL, Title: item.Title, Note: item.Note,
+		Position: pos + 1, CreatedAt: now, UpdatedAt: now,
+	}}
+	s.boardItems = append(s.boardItems, it)
+	return s.resolveBoardItemLocked(it), true, nil
+}
+
+func (s *Store) UpdateBoardItem(_ context.Context, userID uuid.UUID, itemID int64, note, title *string) (db.BoardItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, it := range s.boardItems {
+		if it.ID != itemID || it.userID != userID {
+			continue
+		}
+		if note != nil {
+			it.Note = *note
+		}
+		if title != nil {
+			it.Title = *title
+		}
+		it.UpdatedAt = s.now()
+		return s.resolveBoardItemLocked(it), nil
+	}
+	return db.BoardItem{}, db.ErrNotFound
+}
+
+func (s *Store) DeleteBoardItem(_ context.Context, userID uuid.UUID, itemID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.boardItems, func(it *boardItem) bool { return it.ID == itemID && it.userID == userID })
+	if i < 0 {
+		return db.ErrNotFound
+	}
+	s.boardItems = slices.Delete(s.boardItems, i, i+1)
+	return nil
+}
+
+func (s *Store) ReorderBoardItems(_ context.Context, userID uuid.UUID, itemIDs []int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	items := s.boardItemsLocked(userID)
+	if len(items) != len(itemIDs) {
+		return db.ErrNotFound
+	}
+	pos := make(map[int64]int, len(itemIDs))
+	for i, id := range itemIDs {
+		pos[id] = i + 1
+	}
+	for _, it := range items {
+		if _, ok := pos[it.ID]; !ok {
+			return db.ErrNotFound
+		}
+	}
+	if len(pos) != len(itemIDs) {
+		return db.ErrNotFound
+	}
+	for _, it := range items {
+		it.Position = pos[it.ID]
+	}
+	return nil
+}
+
+// boardItemsLocked returns userID's items in board order.
+func (s *Store) boardItemsLocked(userID uuid.UUID) []*boardItem {
+	var out []*boardItem
+	for _, it := range s.boardItems {
+		if it.userID == userID {
+			out = append(out, it)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Position != out[j].Position {
+			return out[i].Position < out[j].Position
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// resolveBoardItemLocked attaches the saved message while its owner can
+// still read it, like the SQL store.
+func (s *Store) resolveBoardItemLocked(it *boardItem) db.BoardItem {
+	out := it.BoardItem
+	if out.Kind != db.BoardMessage {
+		return out
+	}
+	for _, m := range s.messages {
+		if m.ID != out.MessageID {
+			continue
+		}
+		_, member := s.members[m.RoomID][it.userID]
+		_, subscribed := s.roomSubs[m.RoomID][it.userID]
+		room := s.rooms[m.RoomID]
+		if room == nil || !(member || subscribed && s.broadcast[m.RoomID]) || m.Shadowed && m.UserID != it.userID {
+			break
+		}
+		msg := m
+		out.Message = &msg
+		out.RoomName = room.Name
+		break
+	}
+	return out
+}
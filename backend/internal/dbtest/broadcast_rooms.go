@@ -0,0 +1,107 @@
+package dbtest
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) IsBroadcastRoom(_ context.Context, roomID uuid.UUID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[roomID]; !ok {
+		return false, db.ErrNotFound
+	}
+	return s.broadcast[roomID], nil
+}
+
+func (s *Store) SetRoomBroadcast(_ context.Context, roomID uuid.UUID, on bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[roomID]; !ok {
+		return db.ErrNotFound
+	}
+	s.broadcast[roomID] = on
+	if !on {
+		delete(s.roomSubs, roomID)
+	}
+	return nil
+}
+
+func (s *Store) CountRoomSubscribers(_ context.Context, roomID uuid.UUID) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.roomSubs[roomID]), nil
+}
+
+func (s *Store) SubscribeRoom(_ context.Context, roomID, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.broadcast[roomID] {
+		return db.ErrNotFound
+	}
+	if s.roomSubs[roomID] == nil {
+		s.roomSubs[roomID] = make(map[uuid.UUID]time.Time)
+	}
+	if _, ok := s.roomSubs[roomID][userID]; !ok {
+		s.roomSubs[roomID][userID] = s.now()
+	}
+	return nil
+}
+
+func (s *Store) UnsubscribeRoom(_ context.Context, roomID, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.roomSubs[roomID][userID]; !ok {
+		return db.ErrNotFound
+	}
+	delete(s.roomSubs[roomID], userID)
+	return nil
+}
+
+func (s *Store) IsRoomSubscriber(_ context.Context, roomID, userID uuid.UUID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.roomSubs[roomID][userID]
+	return ok && s.broadcast[roomID], nil
+}
+
+func (s *Store) ListSubscribedRooms(_ context.Context, userID uuid.UUID) ([]db.SubscribedRoom, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	type sub struct {
+		room db.SubscribedRoom
+		at   time.Time
+	}
+	var subs []sub
+	for roomID, users := range s.roomSubs {
+		at, ok := users[userID]
+		room, exists := s.rooms[roomID]
+		if !ok || !exists || !s.broadcast[roomID] {
+			continue
+		}
+		subs = append(subs, sub{db.SubscribedRoom{ID: roomID, Name: room.Name, SubscriberCount: len(users)}, at})
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].at.After(subs[j].at) })
+	rooms := []db.SubscribedRoom{}
+	for _, sb := range subs {
+		rooms = append(rooms, sb.room)
+	}
+	return rooms, nil
+}
+
+func (s *Store) ListSubscribedRoomIDs(_ context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ids []uuid.UUID
+	for roomID, users := range s.roomSubs {
+		if _, ok := users[userID]; ok && s.broadcast[roomID] {
+			ids = append(ids, roomID)
+		}
+	}
+	return ids, nil
+}
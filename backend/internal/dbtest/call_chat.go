@@ -0,0 +1,28 @@
+package dbtest
+
+import (
+	"context"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) GetRoomPersistCallChat(_ context.Context, roomID uuid.UUID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[roomID]; !ok {
+		return false, db.ErrNotFound
+	}
+	return s.callChat[roomID], nil
+}
+
+func (s *Store) SetRoomPersistCallChat(_ context.Context, roomID uuid.UUID, persist bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[roomID]; !ok {
+		return db.ErrNotFound
+	}
+	s.callChat[roomID] = persist
+	return nil
+}
@@ -0,0 +1,59 @@
+package dbtest
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"talkie/backend/internal/db"
+)
+
+type callFeedback struct {
+	db.CallFeedback
+	createdAt time.Time
+}
+
+func (s *Store) SaveCallFeedback(_ context.Context, f db.CallFeedback) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f.Tags = append([]string(nil), f.Tags...)
+	for i := range s.feedback {
+		if s.feedback[i].CallID == f.CallID && s.feedback[i].UserID == f.UserID {
+			f.LiveKitURL = s.feedback[i].LiveKitURL
+			s.feedback[i] = callFeedback{CallFeedback: f, createdAt: s.Now()}
+			return nil
+		}
+	}
+	s.feedback = append(s.feedback, callFeedback{CallFeedback: f, createdAt: s.Now()})
+	return nil
+}
+
+func (s *Store) CallFeedbackStats(_ context.Context, since time.Time) ([]db.CallFeedbackGroup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index := map[[2]string]int{}
+	groups := []db.CallFeedbackGroup{}
+	for _, f := range s.feedback {
+		if f.createdAt.Before(since) {
+			continue
+		}
+		key := [2]string{f.LiveKitURL, f.ClientVersion}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, db.CallFeedbackGroup{LiveKitURL: f.LiveKitURL, ClientVersion: f.ClientVersion, Tags: map[string]int{}})
+		}
+		g := &groups[i]
+		g.AverageRating = (g.AverageRating*float64(g.Responses) + float64(f.Rating)) / float64(g.Responses+1)
+		g.Responses++
+		if f.Rating <= 2 {
+			g.LowRatings++
+		}
+		for _, tag := range f.Tags {
+			g.Tags[tag]++
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Responses > groups[j].Responses })
+	return groups, nil
+}
@@ -0,0 +1,63 @@
+package dbtest
+
+import (
+	"context"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) SaveCommandMessage(_ context.Context, roomID, userID uuid.UUID, commandID int64, content string, components []db.Component) (db.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return db.Message{}, db.ErrNotFound
+	}
+	if _, ok := s.rooms[roomID]; !ok {
+		return db.Message{}, db.ErrNotFound
+	}
+	m := s.saveMessageLocked(roomID, u, content, "text", "", nil)
+	m.Components = components
+	s.messages[len(s.messages)-1].Components = components
+	s.commandMsgs[m.ID] = commandID
+	return m, nil
+}
+
+func (s *Store) GetCommandMessage(ctx context.Context, roomID uuid.UUID, messageID int64) (db.RoomCommand, db.Message, error) {
+	m, err := s.GetMessage(ctx, roomID, messageID)
+	if err != nil {
+		return db.RoomCommand{}, db.Message{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	commandID, ok := s.commandMsgs[messageID]
+	if !ok {
+		return db.RoomCommand{}, db.Message{}, db.ErrNotFound
+	}
+	for _, c := range s.roomCommands {
+		if c.ID == commandID {
+			return *c, m, nil
+		}
+	}
+	return db.RoomCommand{}, db.Message{}, db.ErrNotFound
+}
+
+func (s *Store) UpdateCommandMessage(ctx context.Context, roomID uuid.UUID, messageID int64, content string, components []db.Component) (db.Message, error) {
+	s.mu.Lock()
+	found := false
+	if _, ok := s.commandMsgs[messageID]; ok {
+		for i := range s.messages {
+			if m := &s.messages[i]; m.RoomID == roomID && m.ID == messageID {
+				m.Content, m.Components = content, components
+				found = true
+			}
+		}
+	}
+	s.mu.Unlock()
+	if !found {
+		return db.Message{}, db.ErrNotFound
+	}
+	return s.GetMessage(ctx, roomID, messageID)
+}
@@ -0,0 +1,53 @@
+package dbtest
+
+import (
+	"context"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) GetContactSharing(_ context.Context, userID uuid.UUID) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return "", db.ErrNotFound
+	}
+	if u.sharing == "" {
+		return db.ContactSharingFriends, nil
+	}
+	return u.sharing, nil
+}
+
+func (s *Store) SetContactSharing(_ context.Context, userID uuid.UUID, sharing string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return db.ErrNotFound
+	}
+	u.sharing = sharing
+	return nil
+}
+
+func (s *Store) SaveContactMessage(_ context.Context, roomID, userID, contactID uuid.UUID) (db.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return db.Message{}, db.ErrNotFound
+	}
+	c, ok := s.users[contactID]
+	if !ok {
+		return db.Message{}, db.ErrNotFound
+	}
+	if _, ok := s.rooms[roomID]; !ok {
+		return db.Message{}, db.ErrNotFound
+	}
+	m := s.saveMessageLocked(roomID, u, "", "contact", "", nil)
+	m.Contact = &db.ContactCard{UserID: c.ID, Username: c.Username, AvatarURL: c.AvatarURL}
+	s.messages[len(s.messages)-1].Contact = m.Contact
+	return m, nil
+}
@@ -0,0 +1,105 @@
+package dbtest
+
+import (
+	"context"
+	"time"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+type deviceLink struct {
+	db.DeviceLink
+	codeHash  string
+	claimHash string
+}
+
+func (s *Store) CreateDeviceLink(_ context.Context, userID uuid.UUID, codeHash string, expiresAt time.Time) (db.DeviceLink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, l := range s.deviceLinks {
+		if l.codeHash == codeHash {
+			return db.DeviceLink{}, ErrDuplicate
+		}
+	}
+	s.nextDeviceLinkID++
+	l := &deviceLink{
+		DeviceLink: db.DeviceLink{ID: s.nextDeviceLinkID, UserID: userID, CreatedAt: s.now(), ExpiresAt: expiresAt},
+		codeHash:   codeHash,
+	}
+	s.deviceLinks = append(s.deviceLinks, l)
+	return l.DeviceLink, nil
+}
+
+func (s *Store) GetDeviceLink(_ context.Context, userID uuid.UUID, codeHash string) (db.DeviceLink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l := s.deviceLinkLocked(codeHash)
+	if l == nil || l.UserID != userID || l.ConsumedAt != nil {
+		return db.DeviceLink{}, db.ErrNotFound
+	}
+	return l.DeviceLink, nil
+}
+
+func (s *Store) ClaimDeviceLink(_ context.Context, codeHash, claimHash, deviceName string) (db.DeviceLink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l := s.deviceLinkLocked(codeHash)
+	if l == nil || l.claimHash != "" {
+		return db.DeviceLink{}, db.ErrNotFound
+	}
+	now := s.now()
+	l.claimHash = claimHash
+	l.DeviceName = deviceName
+	l.ClaimedAt = &now
+	return l.DeviceLink, nil
+}
+
+func (s *Store) ApproveDeviceLink(_ context.Context, userID uuid.UUID, codeHash string) (db.DeviceLink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l := s.deviceLinkLocked(codeHash)
+	if l == nil || l.UserID != userID || l.ClaimedAt == nil || l.ApprovedAt != nil {
+		return db.DeviceLink{}, db.ErrNotFound
+	}
+	now := s.now()
+	l.ApprovedAt = &now
+	return l.DeviceLink, nil
+}
+
+func (s *Store) DeleteDeviceLink(_ context.Context, userID uuid.UUID, codeHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, l := range s.deviceLinks {
+		if l.codeHash == codeHash && l.UserID == userID {
+			s.deviceLinks = append(s.deviceLinks[:i], s.deviceLinks[i+1:]...)
+			return nil
+		}
+	}
+	return db.ErrNotFound
+}
+
+func (s *Store) PollDeviceLink(_ context.Context, codeHash, claimHash string) (db.DeviceLink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l := s.deviceLinkLocked(codeHash)
+	if l == nil || l.claimHash == "" || l.claimHash != claimHash || l.ConsumedAt != nil {
+		return db.DeviceLink{}, db.ErrNotFound
+	}
+	if l.ApprovedAt != nil {
+		now := s.now()
+		l.ConsumedAt = &now
+	}
+	return l.DeviceLink, nil
+}
+
+// deviceLinkLocked returns the unexpired link for codeHash, or nil.
+func (s *Store) deviceLinkLocked(codeHash string) *deviceLink {
+	for _, l := range s.deviceLinks {
+		if l.codeHash == codeHash && l.ExpiresAt.After(s.now()) {
+			return l
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package dbtest
+
+import (
+	"context"
+
+	"talkie/backend/internal/db"
+)
+
+func (s *Store) CreateDirectUpload(_ context.Context, u db.DirectUpload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.uploads[u.Key] = u
+	return nil
+}
+
+func (s *Store) GetDirectUpload(_ context.Context, key string) (db.DirectUpload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.uploads[key]
+	if !ok || !u.ExpiresAt.After(s.now()) {
+		return db.DirectUpload{}, db.ErrNotFound
+	}
+	return u, nil
+}
+
+func (s *Store) DeleteDirectUpload(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.uploads[key]; !ok {
+		return db.ErrNotFound
+	}
+	delete(s.uploads, key)
+	return nil
+}
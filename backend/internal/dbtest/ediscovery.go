@@ -0,0 +1,40 @@
+package dbtest
+
+import (
+	"context"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) ExportMessages(_ context.Context, f db.MessageExport, each func(db.DiscoveredMessage) error) error {
+	s.mu.Lock()
+	var out []db.DiscoveredMessage
+	for _, m := range s.messages {
+		if f.UserID != uuid.Nil && m.UserID != f.UserID || f.RoomID != uuid.Nil && m.RoomID != f.RoomID {
+			continue
+		}
+		if m.CreatedAt.Before(f.From) || !m.CreatedAt.Before(f.To) {
+			continue
+		}
+		d := db.DiscoveredMessage{
+			ID: m.ID, RoomID: m.RoomID, UserID: m.UserID, Content: m.Content, MessageType: m.MessageType,
+			MediaURL: m.MediaURL, Shadowed: m.Shadowed, CreatedAt: m.CreatedAt, ClientSentAt: m.ClientSentAt,
+		}
+		if r, ok := s.rooms[m.RoomID]; ok {
+			d.RoomName = r.Name
+		}
+		if u, ok := s.users[m.UserID]; ok {
+			d.Username = u.Username
+		}
+		out = append(out, d)
+	}
+	s.mu.Unlock()
+	for _, d := range out {
+		if err := each(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package dbtest
+
+import (
+	"context"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+type emailChange struct {
+	db.EmailChange
+	verifyHash   string
+	rollbackHash string
+	cancelled    bool
+}
+
+func (s *Store) emailTakenLocked(email string, except uuid.UUID) bool {
+	for _, u := range s.users {
+		if u.Email == email && u.ID != except {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) CreateEmailChange(_ context.Context, userID uuid.UUID, oldEmail, newEmail, verifyHash, rollbackHash string) (db.EmailChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.emailTakenLocked(newEmail, uuid.Nil) {
+		return db.EmailChange{}, db.ErrEmailTaken
+	}
+	for _, c := range s.emailChanges {
+		if c.UserID == userID && c.VerifiedAt == nil {
+			c.cancelled = true
+		}
+	}
+	s.nextEmailChangeID++
+	c := &emailChange{
+		EmailChange: db.EmailChange{
+			ID:        s.nextEmailChangeID,
+			UserID:    userID,
+			OldEmail:  oldEmail,
+			NewEmail:  newEmail,
+			CreatedAt: s.now(),
+		},
+		verifyHash:   verifyHash,
+		rollbackHash: rollbackHash,
+	}
+	s.emailChanges = append(s.emailChanges, c)
+	return c.EmailChange, nil
+}
+
+func (s *Store) GetPendingEmailChange(_ context.Context, userID uuid.UUID) (db.EmailChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cutoff := s.now().Add(-db.EmailChangeVerifyWindow)
+	for i := len(s.emailChanges) - 1; i >= 0; i-- {
+		c := s.emailChanges[i]
+		if c.UserID == userID && c.VerifiedAt == nil && !c.cancelled && !c.CreatedAt.Before(cutoff) {
+			return c.EmailChange, nil
+		}
+	}
+	return db.EmailChange{}, db.ErrNotFound
+}
+
+func (s *Store) CancelPendingEmailChange(_ context.Context, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	found := false
+	for _, c := range s.emailChanges {
+		if c.UserID == userID && c.VerifiedAt == nil && !c.cancelled {
+			c.cancelled = true
+			found = true
+		}
+	}
+	if !found {
+		return db.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) ConfirmEmailChange(_ context.Context, verifyHash string) (db.EmailChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cutoff := s.now().Add(-db.EmailChangeVerifyWindow)
+	for _, c := range s.emailChanges {
+		if c.verifyHash != verifyHash || c.VerifiedAt != nil || c.cancelled || c.CreatedAt.Before(cutoff) {
+			continue
+		}
+		if s.emailTakenLocked(c.NewEmail, uuid.Nil) {
+			return db.EmailChange{}, db.ErrEmailTaken
+		}
+		if u, ok := s.users[c.UserID]; ok {
+			u.Email = c.NewEmail
+			u.EmailVerified = true
+		}
+		now := s.now()
+		c.VerifiedAt = &now
+		return c.EmailChange, nil
+	}
+	return db.EmailChange{}, db.ErrNotFound
+}
+
+func (s *Store) RollbackEmailChange(_ context.Context, rollbackHash string) (db.EmailChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cutoff := s.now().Add(-db.EmailChangeRollbackWindow)
+	for _, c := range s.emailChanges {
+		if c.rollbackHash != rollbackHash || c.cancelled || c.CreatedAt.Before(cutoff) {
+			continue
+		}
+		if c.VerifiedAt != nil {
+			if s.emailTakenLocked(c.OldEmail, c.UserID) {
+				return db.EmailChange{}, db.ErrEmailTaken
+			}
+			if u, ok := s.users[c.UserID]; ok {
+				u.Email = c.OldEmail
+				u.SessionVersion++
+			}
+		}
+		c.cancelled = true
+		return c.EmailChange, nil
+	}
+	return db.EmailChange{}, db.ErrNotFound
+}
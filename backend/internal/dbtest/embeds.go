@@ -0,0 +1,59 @@
+package dbtest
+
+import (
+	"context"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+type roomEmbed struct {
+	db.RoomEmbed
+	tokenHash string
+}
+
+func (s *Store) GetRoomEmbed(_ context.Context, roomID uuid.UUID) (db.RoomEmbed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.embeds[roomID]
+	if !ok {
+		return db.RoomEmbed{}, db.ErrNotFound
+	}
+	return e.RoomEmbed, nil
+}
+
+func (s *Store) SetRoomEmbed(_ context.Context, roomID, createdBy uuid.UUID, tokenHash string) (db.RoomEmbed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[roomID]; !ok {
+		return db.RoomEmbed{}, db.ErrNotFound
+	}
+	e := roomEmbed{RoomEmbed: db.RoomEmbed{RoomID: roomID, CreatedBy: &createdBy, CreatedAt: s.now()}, tokenHash: tokenHash}
+	s.embeds[roomID] = e
+	return e.RoomEmbed, nil
+}
+
+func (s *Store) DeleteRoomEmbed(_ context.Context, roomID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.embeds[roomID]; !ok {
+		return db.ErrNotFound
+	}
+	delete(s.embeds, roomID)
+	return nil
+}
+
+func (s *Store) FindEmbedRoom(_ context.Context, tokenHash string) (db.EmbedRoom, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for roomID, e := range s.embeds {
+		if e.tokenHash != tokenHash {
+			continue
+		}
+		if r, ok := s.rooms[roomID]; ok {
+			return db.EmbedRoom{ID: r.ID, Name: r.Name, AvatarURL: r.AvatarURL}, nil
+		}
+	}
+	return db.EmbedRoom{}, db.ErrNotFound
+}
@@ -0,0 +1,89 @@
+package dbtest
+
+import (
+	"context"
+	"time"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+type guestLink struct {
+	roomID    uuid.UUID
+	createdBy uuid.UUID
+	guestDays int
+	createdAt time.Time
+	expiresAt time.Time
+}
+
+func (s *Store) CreateGuestInviteLink(_ context.Context, tokenHash string, roomID, createdBy uuid.UUID, guestDays int, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[roomID]; !ok {
+		return db.ErrNotFound
+	}
+	if _, ok := s.guestLinks[tokenHash]; ok {
+		return ErrDuplicate
+	}
+	s.guestLinks[tokenHash] = &guestLink{roomID: roomID, createdBy: createdBy, guestDays: guestDays, createdAt: s.now(), expiresAt: expiresAt}
+	return nil
+}
+
+func (s *Store) CreateGuestFromInvite(_ context.Context, tokenHash, email, username, passwordHash string) (db.User, uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	link, ok := s.guestLinks[tokenHash]
+	if !ok || !link.expiresAt.After(s.now()) {
+		return db.User{}, uuid.Nil, db.ErrNotFound
+	}
+	for _, u := range s.users {
+		if u.Email == email || u.Username == username {
+			return db.User{}, uuid.Nil, ErrDuplicate
+		}
+	}
+	expires := s.now().AddDate(0, 0, link.guestDays)
+	u := &user{User: db.User{
+		ID:             uuid.New(),
+		Email:          email,
+		Username:       username,
+		PasswordHash:   passwordHash,
+		GuestExpiresAt: &expires,
+		CreatedAt:      s.now(),
+	}}
+	s.users[u.ID] = u
+	s.joinRoomLocked(link.roomID, u.ID)
+	createdBy := link.createdBy
+	s.recordMembershipLocked(db.MembershipEvent{
+		RoomID: link.roomID, UserID: u.ID, ActorID: &createdBy, Action: db.MembershipJoined, Via: db.ViaGuestLink, InviteLinkID: tokenHash,
+	})
+	return u.User, link.roomID, nil
+}
+
+func (s *Store) DeleteExpiredGuests(_ context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for id, u := range s.users {
+		if u.GuestExpiresAt == nil || u.GuestExpiresAt.After(s.now()) {
+			continue
+		}
+		delete(s.users, id)
+		for _, members := range s.members {
+			delete(members, id)
+		}
+		kept := s.messages[:0]
+		for _, m := range s.messages {
+			if m.UserID != id {
+				kept = append(kept, m)
+			}
+		}
+		s.messages = kept
+		n++
+	}
+	return n, nil
+}
+
+func (s *Store) guestExpiredLocked(u *user) bool {
+	return u.GuestExpiresAt != nil && !u.GuestExpiresAt.After(s.now())
+}
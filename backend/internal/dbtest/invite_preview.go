@@ -0,0 +1,66 @@
+package dbtest
+
+import (
+	"context"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) GetInvitePreview(_ context.Context, tokenHash string) (db.InvitePreview, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, l := range s.inviteLinks {
+		if l.tokenHash != tokenHash || !l.expiresAt.After(s.now()) {
+			continue
+		}
+		if l.groupID != uuid.Nil {
+			g, ok := s.groups[l.groupID]
+			if !ok {
+				break
+			}
+			seen := make(map[uuid.UUID]bool)
+			for roomID, ch := range s.channels {
+				if ch.groupID != l.groupID {
+					continue
+				}
+				for userID := range s.members[roomID] {
+					seen[userID] = true
+				}
+			}
+			return db.InvitePreview{Kind: "group", Name: g.name, MemberCount: len(seen)}, nil
+		}
+		room, ok := s.rooms[l.roomID]
+		if !ok {
+			break
+		}
+		return db.InvitePreview{
+			Kind:        "room",
+			Name:        room.Name,
+			AvatarURL:   room.AvatarURL,
+			MemberCount: len(s.members[l.roomID]),
+			Unlisted:    s.unlisted[l.roomID],
+		}, nil
+	}
+	return db.InvitePreview{}, db.ErrNotFound
+}
+
+func (s *Store) GetRoomUnlisted(_ context.Context, roomID uuid.UUID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[roomID]; !ok {
+		return false, db.ErrNotFound
+	}
+	return s.unlisted[roomID], nil
+}
+
+func (s *Store) SetRoomUnlisted(_ context.Context, roomID uuid.UUID, on bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[roomID]; !ok {
+		return db.ErrNotFound
+	}
+	s.unlisted[roomID] = on
+	return nil
+}
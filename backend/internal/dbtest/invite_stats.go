@@ -0,0 +1,66 @@
+package dbtest
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) ListInviteLinkStats(_ context.Context, roomID uuid.UUID) ([]db.InviteLinkStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []db.InviteLinkStats{}
+	add := func(tokenHash, kind string, createdBy uuid.UUID, createdAt, expiresAt time.Time) {
+		st := db.InviteLinkStats{ID: tokenHash, Kind: kind, CreatedBy: createdBy, CreatedAt: createdAt, ExpiresAt: expiresAt}
+		if u, ok := s.users[createdBy]; ok {
+			st.CreatorUsername = u.Username
+		}
+		joined := make(map[uuid.UUID]bool)
+		for _, ev := range s.memberLog {
+			if ev.InviteLinkID != tokenHash || ev.Action != db.MembershipJoined {
+				continue
+			}
+			joined[ev.UserID] = true
+			at := ev.CreatedAt
+			if st.FirstJoinAt == nil || at.Before(*st.FirstJoinAt) {
+				st.FirstJoinAt = &at
+			}
+			if st.LastJoinAt == nil || at.After(*st.LastJoinAt) {
+				st.LastJoinAt = &at
+			}
+		}
+		st.Joins = len(joined)
+		for _, link := range s.joinReqLink {
+			if link == tokenHash {
+				st.Pending++
+			}
+		}
+		out = append(out, st)
+	}
+
+	ch, inGroup := s.channels[roomID]
+	for _, l := range s.inviteLinks {
+		switch {
+		case l.roomID == roomID:
+			add(l.tokenHash, "room", l.createdBy, l.createdAt, l.expiresAt)
+		case l.roomID == uuid.Nil && inGroup && l.groupID == ch.groupID:
+			add(l.tokenHash, "group", l.createdBy, l.createdAt, l.expiresAt)
+		}
+	}
+	for tokenHash, l := range s.guestLinks {
+		if l.roomID == roomID {
+			add(tokenHash, "guest", l.createdBy, l.createdAt, l.expiresAt)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.After(out[j].CreatedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out, nil
+}
@@ -0,0 +1,31 @@
+package dbtest
+
+import (
+	"context"
+	"slices"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) GetUserKeywords(_ context.Context, userID uuid.UUID) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return []string{}, nil
+	}
+	return append([]string{}, u.keywords...), nil
+}
+
+func (s *Store) SetUserKeywords(_ context.Context, userID uuid.UUID, keywords []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return db.ErrNotFound
+	}
+	u.keywords = slices.Clone(keywords)
+	return nil
+}
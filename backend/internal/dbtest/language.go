@@ -0,0 +1,28 @@
+package dbtest
+
+import (
+	"context"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) GetRoomLanguage(_ context.Context, roomID uuid.UUID) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[roomID]; !ok {
+		return "", db.ErrNotFound
+	}
+	return s.roomLangs[roomID], nil
+}
+
+func (s *Store) SetRoomLanguage(_ context.Context, roomID uuid.UUID, lang string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[roomID]; !ok {
+		return db.ErrNotFound
+	}
+	s.roomLangs[roomID] = lang
+	return nil
+}
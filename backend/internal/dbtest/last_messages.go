@@ -0,0 +1,32 @@
+package dbtest
+
+import (
+	"context"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) ListLastMessages(_ context.Context, viewerID uuid.UUID, roomIDs []uuid.UUID) (map[uuid.UUID]db.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	want := make(map[uuid.UUID]bool, len(roomIDs))
+	for _, id := range roomIDs {
+		want[id] = true
+	}
+	out := make(map[uuid.UUID]db.Message, len(roomIDs))
+	for _, m := range s.messages {
+		if !want[m.RoomID] || (m.Shadowed && m.UserID != viewerID) {
+			continue
+		}
+		if prev, ok := out[m.RoomID]; ok && prev.ID > m.ID {
+			continue
+		}
+		if u, ok := s.users[m.UserID]; ok {
+			m.Username, m.AvatarURL = u.Username, u.AvatarURL
+		}
+		out[m.RoomID] = m
+	}
+	return out, nil
+}
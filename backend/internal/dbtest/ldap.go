@@ -0,0 +1,57 @@
+package dbtest
+
+import (
+	"context"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+type ldapIdent struct {
+	userID uuid.UUID
+	dn     string
+}
+
+func (s *Store) SyncLDAPUser(_ context.Context, ldapID, dn, email, username string) (uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var byEmail *user
+	for _, u := range s.users {
+		if u.Email == email {
+			byEmail = u
+		}
+	}
+	ident, ok := s.ldapIdents[ldapID]
+	switch {
+	case ok:
+		if byEmail != nil && byEmail.ID != ident.userID {
+			return uuid.Nil, db.ErrLDAPConflict
+		}
+		ident.dn = dn
+	case byEmail != nil:
+		if byEmail.IsBot || byEmail.GuestExpiresAt != nil {
+			return uuid.Nil, db.ErrLDAPConflict
+		}
+		for _, other := range s.ldapIdents {
+			if other.userID == byEmail.ID {
+				return uuid.Nil, db.ErrLDAPConflict
+			}
+		}
+		ident = &ldapIdent{userID: byEmail.ID, dn: dn}
+		s.ldapIdents[ldapID] = ident
+	default:
+		for _, u := range s.users {
+			if u.Username == username {
+				return uuid.Nil, db.ErrUserExists
+			}
+		}
+		u := &user{User: db.User{ID: uuid.New(), Username: username, CreatedAt: s.now()}}
+		s.users[u.ID] = u
+		ident = &ldapIdent{userID: u.ID, dn: dn}
+		s.ldapIdents[ldapID] = ident
+	}
+	u := s.users[ident.userID]
+	u.Email, u.EmailVerified, u.PasswordHash = email, true, ""
+	return u.ID, nil
+}
@@ -0,0 +1,76 @@
+package dbtest
+
+import (
+	"context"
+	"slices"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) ListLegalHolds(_ context.Context, all bool) ([]db.LegalHold, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []db.LegalHold{}
+	for i := len(s.legalHolds) - 1; i >= 0; i-- {
+		if h := s.legalHolds[i]; all || h.ReleasedAt == nil {
+			out = append(out, *h)
+		}
+	}
+	return out, nil
+}
+
+func (s *Store) PlaceLegalHold(_ context.Context, h db.LegalHold) (db.LegalHold, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.legalHolds {
+		if existing.ReleasedAt != nil {
+			continue
+		}
+		if h.UserID != nil && existing.UserID != nil && *h.UserID == *existing.UserID ||
+			h.RoomID != nil && existing.RoomID != nil && *h.RoomID == *existing.RoomID {
+			return db.LegalHold{}, db.ErrHoldExists
+		}
+	}
+	s.nextLegalHoldID++
+	h.ID = s.nextLegalHoldID
+	h.PlacedAt = s.now()
+	h.ReleasedBy, h.ReleasedAt, h.ReleaseNote = nil, nil, ""
+	s.legalHolds = append(s.legalHolds, &h)
+	return h, nil
+}
+
+func (s *Store) ReleaseLegalHold(_ context.Context, holdID int64, releasedBy uuid.UUID, note string) (db.LegalHold, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.legalHolds, func(h *db.LegalHold) bool { return h.ID == holdID && h.ReleasedAt == nil })
+	if i < 0 {
+		return db.LegalHold{}, db.ErrNotFound
+	}
+	h := s.legalHolds[i]
+	now := s.now()
+	h.ReleasedBy, h.ReleasedAt, h.ReleaseNote = &releasedBy, &now, note
+	return *h, nil
+}
+
+func (s *Store) RoomUnderLegalHold(_ context.Context, roomID uuid.UUID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.roomHeldLocked(roomID), nil
+}
+
+func (s *Store) roomHeldLocked(roomID uuid.UUID) bool {
+	for _, h := range s.legalHolds {
+		if h.ReleasedAt != nil {
+			continue
+		}
+		if h.RoomID != nil && *h.RoomID == roomID {
+			return true
+		}
+		if h.UserID != nil && slices.ContainsFunc(s.messages, func(m db.Message) bool { return m.RoomID == roomID && m.UserID == *h.UserID }) {
+			return true
+		}
+	}
+	return false
+}
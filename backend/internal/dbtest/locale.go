@@ -0,0 +1,30 @@
+package dbtest
+
+import (
+	"context"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) GetUserLocale(_ context.Context, userID uuid.UUID) (db.UserLocale, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return db.UserLocale{}, db.ErrNotFound
+	}
+	return u.locale, nil
+}
+
+func (s *Store) SetUserLocale(_ context.Context, userID uuid.UUID, l db.UserLocale) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return db.ErrNotFound
+	}
+	u.locale = l
+	return nil
+}
@@ -0,0 +1,58 @@
+package dbtest
+
+import (
+	"context"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+type loginEvent struct {
+	db.LoginEvent
+	userID     uuid.UUID
+	deviceHash string
+}
+
+func (s *Store) RecordLogin(_ context.Context, userID uuid.UUID, ip, country, deviceHash, userAgent string) (db.LoginNovelty, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var total, sameCountry, sameDevice int
+	for _, e := range s.logins {
+		if e.userID != userID {
+			continue
+		}
+		total++
+		if e.Country == country {
+			sameCountry++
+		}
+		if e.deviceHash == deviceHash {
+			sameDevice++
+		}
+	}
+	s.nextLoginID++
+	s.logins = append(s.logins, loginEvent{
+		LoginEvent: db.LoginEvent{ID: s.nextLoginID, IP: ip, Country: country, UserAgent: userAgent, CreatedAt: s.now()},
+		userID:     userID,
+		deviceHash: deviceHash,
+	})
+	n := db.LoginNovelty{First: total == 0}
+	n.NewCountry = !n.First && country != "" && sameCountry == 0
+	n.NewDevice = !n.First && sameDevice == 0
+	return n, nil
+}
+
+func (s *Store) ListLoginEvents(_ context.Context, userID uuid.UUID, limit int) ([]db.LoginEvent, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]db.LoginEvent, 0)
+	for i := len(s.logins) - 1; i >= 0 && len(out) < limit; i-- {
+		if s.logins[i].userID == userID {
+			out = append(out, s.logins[i].LoginEvent)
+		}
+	}
+	return out, nil
+}
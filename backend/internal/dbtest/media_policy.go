@@ -0,0 +1,38 @@
+package dbtest
+
+import (
+	"context"
+	"slices"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) GetRoomMediaPolicy(_ context.Context, roomID uuid.UUID) (db.MediaPolicy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[roomID]; !ok {
+		return db.MediaPolicy{}, db.ErrNotFound
+	}
+	p := s.mediaPolicy[roomID]
+	p.Allowed, p.Blocked = slices.Clone(p.Allowed), slices.Clone(p.Blocked)
+	if p.Allowed == nil {
+		p.Allowed = []string{}
+	}
+	if p.Blocked == nil {
+		p.Blocked = []string{}
+	}
+	return p, nil
+}
+
+func (s *Store) SetRoomMediaPolicy(_ context.Context, roomID uuid.UUID, p db.MediaPolicy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[roomID]; !ok {
+		return db.ErrNotFound
+	}
+	p.Allowed, p.Blocked = slices.Clone(p.Allowed), slices.Clone(p.Blocked)
+	s.mediaPolicy[roomID] = p
+	return nil
+}
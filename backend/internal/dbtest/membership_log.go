@@ -0,0 +1,67 @@
+package dbtest
+
+import (
+	"context"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) RecordMembershipEvent(_ context.Context, ev db.MembershipEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recordMembershipLocked(ev)
+	return nil
+}
+
+func (s *Store) recordMembershipLocked(ev db.MembershipEvent) {
+	if _, ok := s.rooms[ev.RoomID]; !ok {
+		return
+	}
+	ev.ID = int64(len(s.memberLog) + 1)
+	ev.CreatedAt = s.now()
+	s.memberLog = append(s.memberLog, ev)
+}
+
+// joinByLinkLocked joins like joinRoomLocked and logs the join when it
+// made userID a member.
+func (s *Store) joinByLinkLocked(roomID, userID uuid.UUID, link *inviteLink) {
+	if _, ok := s.members[roomID][userID]; ok {
+		return
+	}
+	s.joinRoomLocked(roomID, userID)
+	createdBy := link.createdBy
+	s.recordMembershipLocked(db.MembershipEvent{
+		RoomID: roomID, UserID: userID, ActorID: &createdBy, Action: db.MembershipJoined, Via: db.ViaInviteLink, InviteLinkID: link.tokenHash,
+	})
+}
+
+func (s *Store) ListMembershipEvents(_ context.Context, roomID uuid.UUID, beforeID int64, limit int) ([]db.MembershipEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	out := []db.MembershipEvent{}
+	for i := len(s.memberLog) - 1; i >= 0 && len(out) < limit; i-- {
+		ev := s.memberLog[i]
+		if ev.RoomID != roomID || (beforeID > 0 && ev.ID >= beforeID) {
+			continue
+		}
+		if u, ok := s.users[ev.UserID]; ok {
+			ev.Username = u.Username
+		} else {
+			continue
+		}
+		if ev.ActorID != nil {
+			if a, ok := s.users[*ev.ActorID]; ok {
+				ev.ActorUsername = a.Username
+			} else {
+				ev.ActorID = nil
+			}
+		}
+		out = append(out, ev)
+	}
+	return out, nil
+}
@@ -0,0 +1,56 @@
+package dbtest
+
+import (
+	"context"
+	"strings"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/wordmask"
+
+	"github.com/google/uuid"
+)
+
+// ListMentions matches usernames and watched keywords against messages
+// directly; the fake has no worker to record them.
+func (s *Store) ListMentions(_ context.Context, userID uuid.UUID, f db.MentionFilter) ([]db.Mention, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f.Limit <= 0 || f.Limit > 100 {
+		f.Limit = 50
+	}
+	u, ok := s.users[userID]
+	if !ok {
+		return []db.Mention{}, nil
+	}
+	tag := "@" + strings.ToLower(u.Username)
+	keywords := wordmask.New(u.keywords)
+	mentions := []db.Mention{}
+	for i := len(s.messages) - 1; i >= 0 && len(mentions) < f.Limit; i-- {
+		m := s.messages[i]
+		if m.UserID == userID || m.Shadowed || (f.Before > 0 && m.ID >= f.Before) {
+			continue
+		}
+		mem, ok := s.members[m.RoomID][userID]
+		if !ok || (f.HideNSFW && s.nsfwRooms[m.RoomID]) {
+			continue
+		}
+		keyword := ""
+		if !strings.Contains(strings.ToLower(m.Content), tag) {
+			found := keywords.Find(m.Content)
+			if len(found) == 0 {
+				continue
+			}
+			keyword = found[0]
+		}
+		read := m.ID <= mem.lastRead
+		if f.UnreadOnly && read {
+			continue
+		}
+		name := ""
+		if room, ok := s.rooms[m.RoomID]; ok {
+			name = room.Name
+		}
+		mentions = append(mentions, db.Mention{Message: m, RoomName: name, Read: read, Keyword: keyword})
+	}
+	return mentions, nil
+}
@@ -0,0 +1,325 @@
+package dbtest
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/langdetect"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) SaveMessage(_ context.Context, roomID, userID uuid.UUID, content string, clientSentAt *time.Time) (db.Message, error) {
+	return s.saveMessage(roomID, userID, content, "text", "", clientSentAt)
+}
+
+func (s *Store) SaveMessageWithType(_ context.Context, roomID, userID uuid.UUID, content, messageType, mediaURL string) (db.Message, error) {
+	return s.saveMessage(roomID, userID, content, messageType, mediaURL, nil)
+}
+
+func (s *Store) saveMessage(roomID, userID uuid.UUID, content, messageType, mediaURL string, clientSentAt *time.Time) (db.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return db.Message{}, db.ErrNotFound
+	}
+	if _, ok := s.rooms[roomID]; !ok {
+		return db.Message{}, db.ErrNotFound
+	}
+	return s.saveMessageLocked(roomID, u, content, messageType, mediaURL, clientSentAt), nil
+}
+
+type messageKey struct {
+	userID uuid.UUID
+	key    string
+}
+
+func (s *Store) SaveMessageOnce(_ context.Context, roomID, userID uuid.UUID, content string, clientSentAt *time.Time, key string) (db.Message, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return db.Message{}, false, db.ErrNotFound
+	}
+	if _, ok := s.rooms[roomID]; !ok {
+		return db.Message{}, false, db.ErrNotFound
+	}
+	if id, ok := s.messageKeys[messageKey{userID, key}]; ok {
+		for _, m := range s.messages {
+			if m.ID != id {
+				continue
+			}
+			if m.RoomID != roomID || m.Content != content {
+				return db.Message{}, false, db.ErrIdempotencyConflict
+			}
+			m.Username, m.AvatarURL = u.Username, u.AvatarURL
+			return m, false, nil
+		}
+		return db.Message{}, false, db.ErrNotFound
+	}
+	m := s.saveMessageLocked(roomID, u, content, "text", "", clientSentAt)
+	s.messageKeys[messageKey{userID, key}] = m.ID
+	return m, true, nil
+}
+
+func (s *Store) SaveMessagesBatch(_ context.Context, roomID uuid.UUID, msgs []db.NewMessage) ([]db.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[roomID]; !ok {
+		return nil, db.ErrNotFound
+	}
+	for _, m := range msgs {
+		if _, ok := s.users[m.UserID]; !ok {
+			return nil, db.ErrNotFound
+		}
+	}
+	saved := make([]db.Message, 0, len(msgs))
+	for _, m := range msgs {
+		saved = append(saved, s.saveMessageLocked(roomID, s.users[m.UserID], m.Content, m.MessageType, m.MediaURL, m.ClientSentAt))
+	}
+	return saved, nil
+}
+
+func (s *Store) saveMessageLocked(roomID uuid.UUID, u *user, content, messageType, mediaURL string, clientSentAt *time.Time) db.Message {
+	if messageType == "" {
+		messageType = "text"
+	}
+	s.nextMessageID++
+	m := db.Message{
+		ID:          s.nextMessageID,
+		RoomID:      roomID,
+		UserID:      u.ID,
+		Username:    u.Username,
+		AvatarURL:   u.AvatarURL,
+		Content:     content,
+		MessageType: messageType,
+		MediaURL:    mediaURL,
+		CreatedAt:   s.now(),
+		Shadowed:    u.shadowBanned,
+		NSFW:        s.nsfwRooms[roomID],
+
+		ClientSentAt: clientSentAt,
+	}
+	m.Lang = langdetect.Detect(content)
+	m.Dir = langdetect.Direction(m.Lang)
+	s.messages = append(s.messages, m)
+	if !m.Shadowed {
+		id := m.ID
+		s.recordEventLocked(roomID, "message_created", u.ID, &id, map[string]string{
+			"content": content, "message_type": messageType, "media_url": mediaURL,
+		})
+	}
+	return m
+}
+
+func (s *Store) ListMessages(ctx context.Context, roomID uuid.UUID, limit int) ([]db.Message, error) {
+	return s.ListMessagesBefore(ctx, roomID, 0, limit)
+}
+
+// ListMessagesBefore treats beforeID 0 as "no upper bound", which is how
+// ListMessages shares it.
+func (s *Store) ListMessagesBefore(_ context.Context, roomID uuid.UUID, beforeID int64, limit int) ([]db.Message, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []db.Message{}
+	for i := len(s.messages) - 1; i >= 0 && len(out) < limit; i-- {
+		m := s.messages[i]
+		if m.RoomID != roomID || (beforeID > 0 && m.ID >= beforeID) {
+			continue
+		}
+		if u, ok := s.users[m.UserID]; ok {
+			m.Username, m.AvatarURL = u.Username, u.AvatarURL
+		}
+		m.EditedAt = s.editedAtLocked(m)
+		out = append(out, m)
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, nil
+}
+
+func (s *Store) MarkRoomRead(_ context.Context, roomID, userID uuid.UUID, messageID int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.members[roomID][userID]
+	if m == nil {
+		return 0, db.ErrNotFound
+	}
+	m.lastRead = max(m.lastRead, messageID)
+	m.lastDelivered = max(m.lastDelivered, messageID)
+	return m.lastRead, nil
+}
+
+func (s *Store) GetUnreadState(_ context.Context, roomID, userID uuid.UUID) (int, *int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.members[roomID][userID]
+	if m == nil {
+		return 0, nil, db.ErrNotFound
+	}
+	count, first := s.unreadLocked(roomID, userID, m)
+	return count, first, nil
+}
+
+func (s *Store) MarkRoomDelivered(_ context.Context, roomID, userID uuid.UUID, messageID int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.members[roomID][userID]
+	if m == nil || m.lastDelivered >= messageID {
+		return false, nil
+	}
+	m.lastDelivered = messageID
+	return true, nil
+}
+
+func (s *Store) ListDeliveryPointers(_ context.Context, roomID uuid.UUID) ([]db.DeliveryPointer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]db.DeliveryPointer, 0, len(s.members[roomID]))
+	for userID, m := range s.members[roomID] {
+		out = append(out, db.DeliveryPointer{
+			UserID:        userID,
+			DeliveredUpTo: max(m.lastDelivered, m.lastRead),
+			ReadUpTo:      m.lastRead,
+		})
+	}
+	return out, nil
+}
+
+// unreadLocked counts messages after the member's read pointer that were
+// written by someone else and are not shadowed, like the unreadColumns SQL.
+func (s *Store) unreadLocked(roomID, userID uuid.UUID, m *member) (int, *int64) {
+	var count int
+	var first *int64
+	for _, msg := range s.messages {
+		if msg.RoomID != roomID || msg.ID <= m.lastRead || msg.UserID == userID || msg.Shadowed {
+			continue
+		}
+		if first == nil {
+			id := msg.ID
+			first = &id
+		}
+		count++
+	}
+	return count, first
+}
+
+// SearchMessages matches every query word case-insensitively as a substring,
+// which approximates the 'simple' text search configuration.
+func (s *Store) SearchMessages(_ context.Context, roomID uuid.UUID, q string, beforeID int64, limit int) ([]db.Message, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	words := strings.Fields(strings.ToLower(q))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []db.Message{}
+	for i := len(s.messages) - 1; i >= 0 && len(out) < limit; i-- {
+		m := s.messages[i]
+		if m.RoomID != roomID || (beforeID > 0 && m.ID >= beforeID) {
+			continue
+		}
+		content := strings.ToLower(m.Content)
+		matched := len(words) > 0
+		for _, word := range words {
+			if !strings.Contains(content, word) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+func (s *Store) ListRoomMedia(_ context.Context, roomID uuid.UUID, types []string, beforeID int64, limit int) ([]db.Message, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 30
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []db.Message{}
+	for i := len(s.messages) - 1; i >= 0 && len(out) < limit; i-- {
+		m := s.messages[i]
+		if m.RoomID != roomID || (beforeID > 0 && m.ID >= beforeID) || !slices.Contains(types, m.MessageType) {
+			continue
+		}
+		if u, ok := s.users[m.UserID]; ok {
+			m.Username, m.AvatarURL = u.Username, u.AvatarURL
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+func (s *Store) GetMessage(_ context.Context, roomID uuid.UUID, messageID int64) (db.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range s.messages {
+		if m.RoomID == roomID && m.ID == messageID {
+			if u, ok := s.users[m.UserID]; ok {
+				m.Username, m.AvatarURL = u.Username, u.AvatarURL
+			}
+			return m, nil
+		}
+	}
+	return db.Message{}, db.ErrNotFound
+}
+
+func (s *Store) ListMessagesAfter(_ context.Context, roomID uuid.UUID, afterID int64, limit int) ([]db.Message, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []db.Message{}
+	for _, m := range s.messages {
+		if len(out) == limit {
+			break
+		}
+		if m.RoomID != roomID || m.ID <= afterID {
+			continue
+		}
+		if u, ok := s.users[m.UserID]; ok {
+			m.Username, m.AvatarURL = u.Username, u.AvatarURL
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+func (s *Store) FindMessageAt(_ context.Context, roomID, viewerID uuid.UUID, at time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var after, before *db.Message
+	for i := range s.messages {
+		m := &s.messages[i]
+		if m.RoomID != roomID || (m.Shadowed && m.UserID != viewerID) {
+			continue
+		}
+		if !m.CreatedAt.Before(at) {
+			if after == nil || m.CreatedAt.Before(after.CreatedAt) {
+				after = m
+			}
+		} else if before == nil || !m.CreatedAt.Before(before.CreatedAt) {
+			before = m
+		}
+	}
+	switch {
+	case after != nil:
+		return after.ID, nil
+	case before != nil:
+		return before.ID, nil
+	}
+	return 0, db.ErrNotFound
+}
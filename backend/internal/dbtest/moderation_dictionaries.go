@@ -0,0 +1,93 @@
+package dbtest
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"talkie/backend/internal/db"
+)
+
+// copyDictionary returns d with its word count set and, unless withWords,
+// without its words.
+func copyDictionary(d *db.ModerationDictionary, withWords bool) db.ModerationDictionary {
+	out := *d
+	out.WordCount = len(d.Words)
+	if withWords {
+		out.Words = slices.Clone(d.Words)
+	} else {
+		out.Words = nil
+	}
+	return out
+}
+
+func (s *Store) ListModerationDictionaries(_ context.Context, withWords bool) ([]db.ModerationDictionary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []db.ModerationDictionary{}
+	for _, d := range s.dictionaries {
+		out = append(out, copyDictionary(d, withWords))
+	}
+	return out, nil
+}
+
+func (s *Store) GetModerationDictionary(_ context.Context, id int64) (db.ModerationDictionary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, d := range s.dictionaries {
+		if d.ID == id {
+			return copyDictionary(d, true), nil
+		}
+	}
+	return db.ModerationDictionary{}, db.ErrNotFound
+}
+
+func (s *Store) CreateModerationDictionary(_ context.Context, d db.ModerationDictionary) (db.ModerationDictionary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextDictionaryID++
+	d.ID = s.nextDictionaryID
+	d.CreatedAt, d.UpdatedAt = s.now(), s.now()
+	d.Words = slices.Clone(d.Words)
+	s.dictionaries = append(s.dictionaries, &d)
+	return copyDictionary(&d, true), nil
+}
+
+func (s *Store) UpdateModerationDictionary(_ context.Context, d db.ModerationDictionary) (db.ModerationDictionary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, stored := range s.dictionaries {
+		if stored.ID == d.ID {
+			stored.Name, stored.Language, stored.Enabled = d.Name, d.Language, d.Enabled
+			stored.Words = slices.Clone(d.Words)
+			stored.UpdatedAt = s.now()
+			return copyDictionary(stored, true), nil
+		}
+	}
+	return db.ModerationDictionary{}, db.ErrNotFound
+}
+
+func (s *Store) DeleteModerationDictionary(_ context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, d := range s.dictionaries {
+		if d.ID == id {
+			s.dictionaries = slices.Delete(s.dictionaries, i, i+1)
+			return nil
+		}
+	}
+	return db.ErrNotFound
+}
+
+func (s *Store) ModerationDictionariesVersion(_ context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.dictionaries) == 0 {
+		return "0", nil
+	}
+	var latest int64
+	for _, d := range s.dictionaries {
+		latest = max(latest, d.UpdatedAt.UnixNano())
+	}
+	return fmt.Sprintf("%d:%d", len(s.dictionaries), latest), nil
+}
@@ -0,0 +1,76 @@
+package dbtest
+
+import (
+	"context"
+	"encoding/json"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) CreateNotification(_ context.Context, userID uuid.UUID, kind, title, body string, data any) (db.Notification, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return db.Notification{}, err
+	}
+	if data == nil {
+		raw = []byte("{}")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextNotificationID++
+	n := &db.Notification{
+		ID:        s.nextNotificationID,
+		UserID:    userID,
+		Kind:      kind,
+		Title:     title,
+		Body:      body,
+		Data:      raw,
+		CreatedAt: s.now(),
+	}
+	s.notifications = append(s.notifications, n)
+	return *n, nil
+}
+
+func (s *Store) CreateNotifications(ctx context.Context, userIDs []uuid.UUID, kind, title, body string, data any) ([]db.Notification, error) {
+	out := make([]db.Notification, 0, len(userIDs))
+	for _, id := range userIDs {
+		n, err := s.CreateNotification(ctx, id, kind, title, body, data)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+func (s *Store) ListNotifications(_ context.Context, userID uuid.UUID, limit int) ([]db.Notification, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]db.Notification, 0)
+	for i := len(s.notifications) - 1; i >= 0 && len(out) < limit; i-- {
+		if s.notifications[i].UserID == userID {
+			out = append(out, *s.notifications[i])
+		}
+	}
+	return out, nil
+}
+
+func (s *Store) MarkNotificationRead(_ context.Context, userID uuid.UUID, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, n := range s.notifications {
+		if n.ID == id && n.UserID == userID {
+			if n.ReadAt == nil {
+				now := s.now()
+				n.ReadAt = &now
+			}
+			return nil
+		}
+	}
+	return db.ErrNotFound
+}
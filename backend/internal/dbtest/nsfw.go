@@ -0,0 +1,61 @@
+package dbtest
+
+import (
+	"context"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) GetRoomNSFW(_ context.Context, roomID uuid.UUID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[roomID]; !ok {
+		return false, db.ErrNotFound
+	}
+	return s.nsfwRooms[roomID], nil
+}
+
+func (s *Store) SetRoomNSFW(_ context.Context, roomID uuid.UUID, nsfw bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[roomID]; !ok {
+		return db.ErrNotFound
+	}
+	s.nsfwRooms[roomID] = nsfw
+	return nil
+}
+
+func (s *Store) SetMessageNSFW(_ context.Context, roomID uuid.UUID, messageID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.messages {
+		if s.messages[i].ID == messageID && s.messages[i].RoomID == roomID {
+			s.messages[i].NSFW = true
+			return nil
+		}
+	}
+	return db.ErrNotFound
+}
+
+func (s *Store) GetUserHideNSFW(_ context.Context, userID uuid.UUID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return false, db.ErrNotFound
+	}
+	return u.hideNSFW, nil
+}
+
+func (s *Store) SetUserHideNSFW(_ context.Context, userID uuid.UUID, hide bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return db.ErrNotFound
+	}
+	u.hideNSFW = hide
+	return nil
+}
@@ -0,0 +1,62 @@
+package dbtest
+
+import (
+	"context"
+	"time"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) CreateOwnershipTransfer(_ context.Context, roomID, fromID, toID uuid.UUID, expiresAt time.Time) (db.OwnershipTransfer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[roomID]; !ok {
+		return db.OwnershipTransfer{}, db.ErrNotFound
+	}
+	t := db.OwnershipTransfer{RoomID: roomID, FromUserID: fromID, ToUserID: toID, CreatedAt: s.now(), ExpiresAt: expiresAt}
+	s.transfers[roomID] = t
+	return t, nil
+}
+
+func (s *Store) GetOwnershipTransfer(_ context.Context, roomID uuid.UUID) (db.OwnershipTransfer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.transfers[roomID]
+	if !ok || !t.ExpiresAt.After(s.now()) {
+		return db.OwnershipTransfer{}, db.ErrNotFound
+	}
+	return t, nil
+}
+
+func (s *Store) AcceptOwnershipTransfer(_ context.Context, roomID, toID uuid.UUID) (db.OwnershipTransfer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.transfers[roomID]
+	if !ok || t.ToUserID != toID || !t.ExpiresAt.After(s.now()) {
+		return db.OwnershipTransfer{}, db.ErrNotFound
+	}
+	room, ok := s.rooms[roomID]
+	m, isMember := s.members[roomID][toID]
+	if !ok || room.CreatedBy != t.FromUserID || !isMember {
+		return db.OwnershipTransfer{}, db.ErrNotFound
+	}
+	delete(s.transfers, roomID)
+	room.CreatedBy = toID
+	if m.role != "admin" {
+		m.role = "admin"
+		s.recordEventLocked(roomID, "member_role_changed", toID, nil, map[string]string{"role": "admin"})
+	}
+	return t, nil
+}
+
+func (s *Store) DeleteOwnershipTransfer(_ context.Context, roomID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.transfers[roomID]; !ok {
+		return db.ErrNotFound
+	}
+	delete(s.transfers, roomID)
+	return nil
+}
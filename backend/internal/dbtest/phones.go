@@ -0,0 +1,191 @@
+package dbtest
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) phoneTakenLocked(phoneHash string, except uuid.UUID) bool {
+	for _, u := range s.users {
+		if u.phoneDigest == phoneHash && u.ID != except {
+			return true
+		}
+	}
+	return false
+}
+
+// livePhoneCodeLocked reports whether u has a code that has not expired.
+func (s *Store) livePhoneCodeLocked(u *user) bool {
+	return u.phonePending != "" && s.now().Sub(u.phoneSentAt) < db.PhoneCodeWindow
+}
+
+func phoneHint(phone string) string {
+	if len(phone) <= 4 {
+		return phone
+	}
+	return phone[len(phone)-4:]
+}
+
+func (s *Store) GetPhone(_ context.Context, userID uuid.UUID) (db.UserPhone, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return db.UserPhone{}, db.ErrNotFound
+	}
+	p := db.UserPhone{Verified: u.phoneDigest != "", SMSAlerts: u.smsAlerts, Discoverable: u.discoverable}
+	if p.Verified {
+		p.Hint = u.phoneHint
+	}
+	if s.livePhoneCodeLocked(u) {
+		p.Pending = u.phonePending
+	}
+	return p, nil
+}
+
+func (s *Store) StartPhoneVerification(_ context.Context, userID uuid.UUID, phone, phoneHash, codeHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return db.ErrNotFound
+	}
+	if s.phoneTakenLocked(phoneHash, userID) {
+		return db.ErrPhoneTaken
+	}
+	u.phonePending, u.pendingHash, u.phoneCode, u.phoneSentAt, u.phoneTries = phone, phoneHash, codeHash, s.now(), 0
+	return nil
+}
+
+func (s *Store) VerifyPhoneCode(_ context.Context, userID uuid.UUID, codeHash string, maxAttempts int, smsAlerts *bool) (string, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok || !s.livePhoneCodeLocked(u) {
+		return "", 0, db.ErrNotFound
+	}
+	if maxAttempts > 0 && u.phoneTries >= maxAttempts {
+		return "", 0, db.ErrTooManyAttempts
+	}
+	if u.phoneCode != codeHash {
+		u.phoneTries++
+		if maxAttempts <= 0 {
+			return "", 0, db.ErrCodeMismatch
+		}
+		if left := maxAttempts - u.phoneTries; left > 0 {
+			return "", left, db.ErrCodeMismatch
+		}
+		return "", 0, db.ErrTooManyAttempts
+	}
+	if s.phoneTakenLocked(u.pendingHash, userID) {
+		return "", 0, db.ErrPhoneTaken
+	}
+	phone := u.phonePending
+	if smsAlerts != nil {
+		u.smsAlerts = *smsAlerts
+	}
+	u.phoneDigest, u.phoneHint, u.phone = u.pendingHash, phoneHint(phone), ""
+	if u.smsAlerts {
+		u.phone = phone
+	}
+	u.phonePending, u.pendingHash, u.phoneCode, u.phoneTries = "", "", "", 0
+	return phone, 0, nil
+}
+
+func (s *Store) ClearPhone(_ context.Context, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return db.ErrNotFound
+	}
+	u.phonePending, u.pendingHash, u.phoneCode = "", "", ""
+	if u.phoneDigest == "" {
+		return db.ErrNotFound
+	}
+	u.phone, u.phoneDigest, u.phoneHint, u.smsAlerts, u.discoverable = "", "", "", false, false
+	return nil
+}
+
+func (s *Store) SetSMSAlerts(_ context.Context, userID uuid.UUID, on bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok || u.phoneDigest == "" || on && u.phone == "" {
+		return db.ErrNotFound
+	}
+	u.smsAlerts = on
+	if !on {
+		u.phone = ""
+	}
+	return nil
+}
+
+func (s *Store) SetPhoneDiscoverable(_ context.Context, userID uuid.UUID, on bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok || u.phoneDigest == "" {
+		return db.ErrNotFound
+	}
+	u.discoverable = on
+	return nil
+}
+
+func (s *Store) MatchPhones(_ context.Context, selfID uuid.UUID, phoneHashes []string) ([]db.PhoneMatch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	wanted := make(map[string]bool, len(phoneHashes))
+	for _, h := range phoneHashes {
+		wanted[h] = true
+	}
+	out := []db.PhoneMatch{}
+	for _, u := range s.users {
+		if u.ID == selfID || !u.discoverable || u.IsBot || !wanted[u.phoneDigest] {
+			continue
+		}
+		out = append(out, db.PhoneMatch{PhoneHash: u.phoneDigest, UserID: u.ID, Username: u.Username, AvatarURL: u.AvatarURL})
+	}
+	slices.SortFunc(out, func(a, b db.PhoneMatch) int { return strings.Compare(a.Username, b.Username) })
+	return out, nil
+}
+
+func (s *Store) ListSMSRecipients(_ context.Context, userIDs []uuid.UUID) ([]db.SMSRecipient, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []db.SMSRecipient
+	for _, id := range userIDs {
+		if u, ok := s.users[id]; ok && u.smsAlerts && u.phone != "" {
+			out = append(out, db.SMSRecipient{UserID: id, Phone: u.phone})
+		}
+	}
+	return out, nil
+}
+
+func (s *Store) TakeSMSBudget(_ context.Context, userID uuid.UUID, _ string, perDay int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return false, nil
+	}
+	cutoff := s.now().Add(-24 * time.Hour)
+	recent := u.smsSends[:0]
+	for _, t := range u.smsSends {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	u.smsSends = recent
+	if perDay > 0 && len(recent) >= perDay {
+		return false, nil
+	}
+	u.smsSends = append(u.smsSends, s.now())
+	return true, nil
+}
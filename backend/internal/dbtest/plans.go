@@ -0,0 +1,163 @@
+package dbtest
+
+import (
+	"context"
+	"sort"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) ListPlans(_ context.Context) ([]db.Plan, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]db.Plan, 0, len(s.plans))
+	for _, p := range s.plans {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func (s *Store) UpsertPlan(_ context.Context, p db.Plan) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.plans[p.Name] = p
+	return nil
+}
+
+// DeletePlan mirrors ON DELETE SET NULL: users and groups on the plan fall
+// back to the defaults.
+func (s *Store) DeletePlan(_ context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.plans[name]; !ok {
+		return db.ErrNotFound
+	}
+	delete(s.plans, name)
+	for id, plan := range s.userPlans {
+		if plan == name {
+			delete(s.userPlans, id)
+		}
+	}
+	for id, plan := range s.groupPlans {
+		if plan == name {
+			delete(s.groupPlans, id)
+		}
+	}
+	return nil
+}
+
+func (s *Store) SetUserPlan(_ context.Context, userID uuid.UUID, plan string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[userID]; !ok {
+		return db.ErrNotFound
+	}
+	return s.assignPlanLocked(s.userPlans, userID, plan)
+}
+
+func (s *Store) SetGroupPlan(_ context.Context, groupID uuid.UUID, plan string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.groups[groupID]; !ok {
+		return db.ErrNotFound
+	}
+	return s.assignPlanLocked(s.groupPlans, groupID, plan)
+}
+
+func (s *Store) assignPlanLocked(plans map[uuid.UUID]string, id uuid.UUID, plan string) error {
+	if plan == "" {
+		delete(plans, id)
+		return nil
+	}
+	if _, ok := s.plans[plan]; !ok {
+		return db.ErrNotFound
+	}
+	plans[id] = plan
+	return nil
+}
+
+func (s *Store) GetUserPlan(_ context.Context, userID uuid.UUID) (db.Plan, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.plans[s.userPlans[userID]], nil
+}
+
+func (s *Store) GetRoomPlan(_ context.Context, roomID uuid.UUID) (db.Plan, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.roomPlanLocked(roomID), nil
+}
+
+func (s *Store) roomPlanLocked(roomID uuid.UUID) db.Plan {
+	if ch, ok := s.channels[roomID]; ok {
+		return s.groupPlanLocked(ch.groupID)
+	}
+	room, ok := s.rooms[roomID]
+	if !ok {
+		return db.Plan{}
+	}
+	return s.plans[s.userPlans[room.CreatedBy]]
+}
+
+func (s *Store) GetGroupPlan(_ context.Context, groupID uuid.UUID) (db.Plan, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.groupPlanLocked(groupID), nil
+}
+
+func (s *Store) groupPlanLocked(groupID uuid.UUID) db.Plan {
+	if plan, ok := s.groupPlans[groupID]; ok {
+		return s.plans[plan]
+	}
+	if g, ok := s.groups[groupID]; ok {
+		return s.plans[s.userPlans[g.createdBy]]
+	}
+	return db.Plan{}
+}
+
+func (s *Store) CountRoomsCreatedBy(_ context.Context, userID uuid.UUID) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for id, room := range s.rooms {
+		if _, dm := s.direct[id]; room.CreatedBy == userID && !dm {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *Store) CountRoomMembers(_ context.Context, roomID uuid.UUID) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.members[roomID]), nil
+}
+
+func (s *Store) CountGroupMembers(_ context.Context, groupID uuid.UUID) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seen := map[uuid.UUID]struct{}{}
+	for roomID, ch := range s.channels {
+		if ch.groupID != groupID {
+			continue
+		}
+		for userID := range s.members[roomID] {
+			seen[userID] = struct{}{}
+		}
+	}
+	return len(seen), nil
+}
+
+func (s *Store) IsGroupMember(_ context.Context, groupID, userID uuid.UUID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for roomID, ch := range s.channels {
+		if _, ok := s.members[roomID][userID]; ok && ch.groupID == groupID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,82 @@
+package dbtest
+
+import (
+	"context"
+	"maps"
+	"sort"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/profile"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) ListProfileFields(_ context.Context) ([]profile.Field, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]profile.Field, 0, len(s.profileDefs))
+	for _, f := range s.profileDefs {
+		out = append(out, f)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Position != out[j].Position {
+			return out[i].Position < out[j].Position
+		}
+		return out[i].Key < out[j].Key
+	})
+	return out, nil
+}
+
+func (s *Store) UpsertProfileField(_ context.Context, f profile.Field) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.profileDefs[f.Key] = f
+	return nil
+}
+
+func (s *Store) DeleteProfileField(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.profileDefs[key]; !ok {
+		return db.ErrNotFound
+	}
+	delete(s.profileDefs, key)
+	return nil
+}
+
+func (s *Store) GetUserProfile(_ context.Context, userID uuid.UUID) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return nil, db.ErrNotFound
+	}
+	out := maps.Clone(u.profile)
+	if out == nil {
+		out = map[string]string{}
+	}
+	return out, nil
+}
+
+func (s *Store) UpdateUserProfile(_ context.Context, userID uuid.UUID, changes map[string]*string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return nil, db.ErrNotFound
+	}
+	if u.profile == nil {
+		u.profile = map[string]string{}
+	}
+	for key, value := range changes {
+		if value == nil {
+			delete(u.profile, key)
+		} else {
+			u.profile[key] = *value
+		}
+	}
+	if len(changes) > 0 {
+		u.profileAt = s.now()
+	}
+	return maps.Clone(u.profile), nil
+}
@@ -0,0 +1,59 @@
+package dbtest
+
+import (
+	"context"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) RegisterPushDevice(_ context.Context, userID uuid.UUID, platform, token string) (db.PushDevice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	d, ok := s.pushDevices[token]
+	if !ok {
+		s.nextDeviceID++
+		d = &db.PushDevice{ID: s.nextDeviceID, Token: token, CreatedAt: now}
+		s.pushDevices[token] = d
+	}
+	d.UserID = userID
+	d.Platform = platform
+	d.LastSeenAt = now
+	return *d, nil
+}
+
+func (s *Store) DeletePushDevice(_ context.Context, userID uuid.UUID, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.pushDevices[token]
+	if !ok || d.UserID != userID {
+		return db.ErrNotFound
+	}
+	delete(s.pushDevices, token)
+	return nil
+}
+
+func (s *Store) DeletePushDeviceByToken(_ context.Context, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pushDevices, token)
+	return nil
+}
+
+func (s *Store) ListPushDevicesForUsers(_ context.Context, userIDs []uuid.UUID) ([]db.PushDevice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	wanted := make(map[uuid.UUID]struct{}, len(userIDs))
+	for _, id := range userIDs {
+		wanted[id] = struct{}{}
+	}
+	out := make([]db.PushDevice, 0)
+	for _, d := range s.pushDevices {
+		if _, ok := wanted[d.UserID]; ok {
+			out = append(out, *d)
+		}
+	}
+	return out, nil
+}
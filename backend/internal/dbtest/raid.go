@@ -0,0 +1,122 @@
+package dbtest
+
+import (
+	"context"
+	"sort"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) GetInviteTarget(_ context.Context, tokenHash string) (uuid.UUID, uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, l := range s.inviteLinks {
+		if l.tokenHash == tokenHash && l.expiresAt.After(s.now()) {
+			return l.roomID, l.groupID, nil
+		}
+	}
+	return uuid.Nil, uuid.Nil, db.ErrNotFound
+}
+
+func (s *Store) GetRoomRaidMode(_ context.Context, roomID uuid.UUID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[roomID]; !ok {
+		return false, db.ErrNotFound
+	}
+	return s.raidMode[roomID], nil
+}
+
+func (s *Store) SetRoomRaidMode(_ context.Context, roomID uuid.UUID, on bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[roomID]; !ok {
+		return db.ErrNotFound
+	}
+	s.raidMode[roomID] = on
+	return nil
+}
+
+func (s *Store) CreateJoinRequest(_ context.Context, roomID, userID uuid.UUID, inviteLink string) (db.JoinRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if _, roomOK := s.rooms[roomID]; !ok || !roomOK {
+		return db.JoinRequest{}, db.ErrNotFound
+	}
+	key := [2]uuid.UUID{roomID, userID}
+	if _, ok := s.joinReqs[key]; !ok {
+		s.joinReqs[key] = s.now()
+		s.joinReqLink[key] = inviteLink
+	}
+	return db.JoinRequest{RoomID: roomID, UserID: userID, Username: u.Username, AvatarURL: u.AvatarURL, InviteLinkID: s.joinReqLink[key], CreatedAt: s.joinReqs[key]}, nil
+}
+
+func (s *Store) ListJoinRequests(_ context.Context, roomID uuid.UUID) ([]db.JoinRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []db.JoinRequest{}
+	for key, at := range s.joinReqs {
+		if key[0] != roomID {
+			continue
+		}
+		req := db.JoinRequest{RoomID: roomID, UserID: key[1], InviteLinkID: s.joinReqLink[key], CreatedAt: at}
+		if u, ok := s.users[key[1]]; ok {
+			req.Username, req.AvatarURL = u.Username, u.AvatarURL
+		}
+		out = append(out, req)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].UserID.String() < out[j].UserID.String()
+	})
+	return out, nil
+}
+
+func (s *Store) ApproveJoinRequest(_ context.Context, roomID, userID, approverID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := [2]uuid.UUID{roomID, userID}
+	if _, ok := s.joinReqs[key]; !ok {
+		return db.ErrNotFound
+	}
+	link := s.joinReqLink[key]
+	delete(s.joinReqs, key)
+	delete(s.joinReqLink, key)
+	if _, ok := s.members[roomID][userID]; ok {
+		return nil
+	}
+	s.joinRoomLocked(roomID, userID)
+	s.recordMembershipLocked(db.MembershipEvent{
+		RoomID: roomID, UserID: userID, ActorID: &approverID, Action: db.MembershipJoined, Via: db.ViaJoinRequest, InviteLinkID: link,
+	})
+	return nil
+}
+
+func (s *Store) DeleteJoinRequest(_ context.Context, roomID, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := [2]uuid.UUID{roomID, userID}
+	if _, ok := s.joinReqs[key]; !ok {
+		return db.ErrNotFound
+	}
+	delete(s.joinReqs, key)
+	delete(s.joinReqLink, key)
+	return nil
+}
+
+func (s *Store) ListRoomAdminIDs(_ context.Context, roomID uuid.UUID) ([]uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []uuid.UUID
+	for id, m := range s.members[roomID] {
+		if m.role == "admin" {
+			out = append(out, id)
+		}
+	}
+	return out, nil
+}
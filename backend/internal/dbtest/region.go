@@ -0,0 +1,28 @@
+package dbtest
+
+import (
+	"context"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) GetRoomRegion(_ context.Context, roomID uuid.UUID) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[roomID]; !ok {
+		return "", db.ErrNotFound
+	}
+	return s.regions[roomID], nil
+}
+
+func (s *Store) SetRoomRegion(_ context.Context, roomID uuid.UUID, region string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[roomID]; !ok {
+		return db.ErrNotFound
+	}
+	s.regions[roomID] = region
+	return nil
+}
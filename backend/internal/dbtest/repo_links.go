@@ -0,0 +1,81 @@
+package dbtest
+
+import (
+	"context"
+	"slices"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) ListRepoLinks(_ context.Context, roomID uuid.UUID) ([]db.RepoLink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []db.RepoLink{}
+	for _, l := range s.repoLinks {
+		if l.RoomID == roomID {
+			link := *l
+			link.Secret = ""
+			link.Events = slices.Clone(l.Events)
+			out = append(out, link)
+		}
+	}
+	return out, nil
+}
+
+func (s *Store) GetRepoLink(_ context.Context, id int64) (db.RepoLink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, l := range s.repoLinks {
+		if l.ID == id {
+			link := *l
+			link.Events = slices.Clone(l.Events)
+			return link, nil
+		}
+	}
+	return db.RepoLink{}, db.ErrNotFound
+}
+
+func (s *Store) CreateRepoLink(_ context.Context, l db.RepoLink) (db.RepoLink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[l.RoomID]; !ok {
+		return db.RepoLink{}, db.ErrNotFound
+	}
+	for _, existing := range s.repoLinks {
+		if existing.RoomID == l.RoomID && existing.Provider == l.Provider && existing.Repo == l.Repo {
+			return db.RepoLink{}, db.ErrRepoLinked
+		}
+	}
+	s.nextRepoLinkID++
+	l.ID = s.nextRepoLinkID
+	l.CreatedAt = s.now()
+	l.Events = slices.Clone(l.Events)
+	stored := l
+	s.repoLinks = append(s.repoLinks, &stored)
+	return l, nil
+}
+
+func (s *Store) SetRepoLinkEvents(_ context.Context, roomID uuid.UUID, id int64, events []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, l := range s.repoLinks {
+		if l.RoomID == roomID && l.ID == id {
+			l.Events = slices.Clone(events)
+			return nil
+		}
+	}
+	return db.ErrNotFound
+}
+
+func (s *Store) DeleteRepoLink(_ context.Context, roomID uuid.UUID, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.repoLinks, func(l *db.RepoLink) bool { return l.RoomID == roomID && l.ID == id })
+	if i < 0 {
+		return db.ErrNotFound
+	}
+	s.repoLinks = slices.Delete(s.repoLinks, i, i+1)
+	return nil
+}
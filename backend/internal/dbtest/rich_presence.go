@@ -0,0 +1,78 @@
+package dbtest
+
+import (
+	"context"
+	"slices"
+	"sort"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) SetRichPresence(_ context.Context, p db.RichPresence) (db.RichPresence, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[p.UserID]; !ok {
+		return db.RichPresence{}, db.ErrNotFound
+	}
+	p.UpdatedAt = s.now()
+	for i, existing := range s.richPresence {
+		if existing.UserID == p.UserID && existing.Source == p.Source {
+			s.richPresence[i] = p
+			return p, nil
+		}
+	}
+	s.richPresence = append(s.richPresence, p)
+	return p, nil
+}
+
+func (s *Store) ClearRichPresence(_ context.Context, userID uuid.UUID, source string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, p := range s.richPresence {
+		if p.UserID == userID && p.Source == source {
+			s.richPresence = slices.Delete(s.richPresence, i, i+1)
+			return nil
+		}
+	}
+	return db.ErrNotFound
+}
+
+func (s *Store) ListRichPresence(_ context.Context, userIDs []uuid.UUID) ([]db.RichPresence, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	out := []db.RichPresence{}
+	for _, p := range s.richPresence {
+		if slices.Contains(userIDs, p.UserID) && p.ExpiresAt.After(now) {
+			out = append(out, p)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if !out[i].UpdatedAt.Equal(out[j].UpdatedAt) {
+			return out[i].UpdatedAt.After(out[j].UpdatedAt)
+		}
+		return out[i].Source < out[j].Source
+	})
+	return out, nil
+}
+
+func (s *Store) DeleteExpiredRichPresence(_ context.Context) ([]uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	var users []uuid.UUID
+	kept := s.richPresence[:0]
+	for _, p := range s.richPresence {
+		if p.ExpiresAt.After(now) {
+			kept = append(kept, p)
+			continue
+		}
+		if !slices.Contains(users, p.UserID) {
+			users = append(users, p.UserID)
+		}
+	}
+	s.richPresence = kept
+	return users, nil
+}
@@ -0,0 +1,72 @@
+package dbtest
+
+import (
+	"context"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) CloneRoom(_ context.Context, roomID, userID uuid.UUID, name string, withMembers bool) (db.Room, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	src, ok := s.rooms[roomID]
+	if !ok {
+		return db.Room{}, db.ErrNotFound
+	}
+	r := s.insertRoomLocked(name, userID)
+	r.IsPrivate = src.IsPrivate
+	id := r.ID
+	if v, ok := s.mentions[roomID]; ok {
+		s.mentions[id] = v
+	}
+	if w, ok := s.welcomes[roomID]; ok {
+		if w.SenderID != nil {
+			w.SenderID = &userID
+		}
+		s.welcomes[id] = w
+	}
+	if wm, ok := s.wordMasks[roomID]; ok {
+		wm.Words = append([]string(nil), wm.Words...)
+		s.wordMasks[id] = wm
+	}
+	if p, ok := s.mediaPolicy[roomID]; ok {
+		p.Allowed = append([]string(nil), p.Allowed...)
+		p.Blocked = append([]string(nil), p.Blocked...)
+		s.mediaPolicy[id] = p
+	}
+	s.raidMode[id] = s.raidMode[roomID]
+	s.nsfwRooms[id] = s.nsfwRooms[roomID]
+	s.roomLangs[id] = s.roomLangs[roomID]
+	s.unlisted[id] = s.unlisted[roomID]
+	s.broadcast[id] = s.broadcast[roomID]
+	s.callChat[id] = s.callChat[roomID]
+	s.regions[id] = s.regions[roomID]
+	for _, rule := range s.automodRules {
+		if rule.RoomID != roomID {
+			continue
+		}
+		s.nextAutomodRuleID++
+		c := *rule
+		c.ID, c.RoomID, c.CreatedBy, c.CreatedAt = s.nextAutomodRuleID, id, &userID, s.now()
+		s.automodRules = append(s.automodRules, &c)
+	}
+
+	s.addMemberLocked(id, userID, "admin", 0)
+	if withMembers {
+		for memberID, m := range s.members[roomID] {
+			if u := s.users[memberID]; memberID == userID || u == nil || u.GuestExpiresAt != nil {
+				continue
+			}
+			s.addMemberLocked(id, memberID, m.role, 0)
+			s.recordMembershipLocked(db.MembershipEvent{
+				RoomID: id, UserID: memberID, ActorID: &userID, Action: db.MembershipJoined, Via: db.ViaClone,
+			})
+		}
+	}
+	out := *r
+	out.MyRole = "admin"
+	out.CanManage = true
+	return out, nil
+}
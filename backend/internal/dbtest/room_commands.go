@@ -0,0 +1,66 @@
+package dbtest
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) ListRoomCommands(_ context.Context, roomID uuid.UUID) ([]db.RoomCommand, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []db.RoomCommand{}
+	for _, c := range s.roomCommands {
+		if c.RoomID == roomID {
+			cmd := *c
+			cmd.Secret = ""
+			out = append(out, cmd)
+		}
+	}
+	slices.SortFunc(out, func(a, b db.RoomCommand) int { return strings.Compare(a.Name, b.Name) })
+	return out, nil
+}
+
+func (s *Store) GetRoomCommand(_ context.Context, roomID uuid.UUID, name string) (db.RoomCommand, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.roomCommands {
+		if c.RoomID == roomID && c.Name == name {
+			return *c, nil
+		}
+	}
+	return db.RoomCommand{}, db.ErrNotFound
+}
+
+func (s *Store) CreateRoomCommand(_ context.Context, c db.RoomCommand) (db.RoomCommand, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[c.RoomID]; !ok {
+		return db.RoomCommand{}, db.ErrNotFound
+	}
+	for _, existing := range s.roomCommands {
+		if existing.RoomID == c.RoomID && existing.Name == c.Name {
+			return db.RoomCommand{}, db.ErrCommandExists
+		}
+	}
+	s.nextRoomCommandID++
+	c.ID = s.nextRoomCommandID
+	c.CreatedAt = s.now()
+	s.roomCommands = append(s.roomCommands, &c)
+	return c, nil
+}
+
+func (s *Store) DeleteRoomCommand(_ context.Context, roomID uuid.UUID, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.roomCommands, func(c *db.RoomCommand) bool { return c.RoomID == roomID && c.Name == name })
+	if i < 0 {
+		return db.ErrNotFound
+	}
+	s.roomCommands = slices.Delete(s.roomCommands, i, i+1)
+	return nil
+}
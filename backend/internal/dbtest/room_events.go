@@ -0,0 +1,93 @@
+package dbtest
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+// recordEventLocked mirrors the room_events triggers.
+func (s *Store) recordEventLocked(roomID uuid.UUID, typ string, userID uuid.UUID, messageID *int64, data any) {
+	if _, ok := s.rooms[roomID]; !ok {
+		return
+	}
+	raw := json.RawMessage("{}")
+	if data != nil {
+		raw, _ = json.Marshal(data)
+	}
+	events := s.roomEvents[roomID]
+	s.roomEvents[roomID] = append(events, db.RoomEvent{
+		Seq:       int64(len(events)) + 1,
+		Type:      typ,
+		UserID:    &userID,
+		MessageID: messageID,
+		Data:      raw,
+		CreatedAt: s.now(),
+	})
+}
+
+func (s *Store) ListRoomEvents(_ context.Context, roomID uuid.UUID, since int64, limit int) ([]db.RoomEvent, int64, error) {
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[roomID]; !ok {
+		return nil, 0, db.ErrNotFound
+	}
+	all := s.roomEvents[roomID]
+	out := []db.RoomEvent{}
+	for _, e := range all {
+		if e.Seq <= since {
+			continue
+		}
+		if len(out) == limit {
+			break
+		}
+		if u, ok := s.users[*e.UserID]; ok {
+			e.Username = u.Username
+		}
+		out = append(out, e)
+	}
+	return out, int64(len(all)), nil
+}
+
+func (s *Store) ListDeletedMessageIDs(_ context.Context, roomID uuid.UUID, fromID, beforeID int64, limit int) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seen := map[int64]bool{}
+	ids := []int64{}
+	for _, e := range s.roomEvents[roomID] {
+		if e.Type != "message_deleted" || e.MessageID == nil || seen[*e.MessageID] {
+			continue
+		}
+		if id := *e.MessageID; id >= fromID && id < beforeID {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	slices.Reverse(ids)
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	return ids, nil
+}
+
+// editedAtLocked is when m's content last changed, like the edited_at
+// column of history pages.
+func (s *Store) editedAtLocked(m db.Message) *time.Time {
+	var at *time.Time
+	for _, e := range s.roomEvents[m.RoomID] {
+		if e.Type == "message_edited" && e.MessageID != nil && *e.MessageID == m.ID {
+			t := e.CreatedAt
+			at = &t
+		}
+	}
+	return at
+}
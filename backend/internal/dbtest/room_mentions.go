@@ -0,0 +1,31 @@
+package dbtest
+
+import (
+	"context"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) GetRoomMentionPolicy(_ context.Context, roomID uuid.UUID) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[roomID]; !ok {
+		return "", db.ErrNotFound
+	}
+	if policy, ok := s.mentions[roomID]; ok {
+		return policy, nil
+	}
+	return "admins", nil
+}
+
+func (s *Store) SetRoomMentionPolicy(_ context.Context, roomID uuid.UUID, policy string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[roomID]; !ok {
+		return db.ErrNotFound
+	}
+	s.mentions[roomID] = policy
+	return nil
+}
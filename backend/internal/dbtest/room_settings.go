@@ -0,0 +1,49 @@
+package dbtest
+
+import (
+	"context"
+	"sort"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) GetRoomSettings(ctx context.Context, roomID uuid.UUID) (db.RoomSettings, error) {
+	var st db.RoomSettings
+	var err error
+	if st.NSFW, err = s.GetRoomNSFW(ctx, roomID); err != nil {
+		return db.RoomSettings{}, err
+	}
+	st.Language, _ = s.GetRoomLanguage(ctx, roomID)
+	st.Region, _ = s.GetRoomRegion(ctx, roomID)
+	st.MentionPolicy, _ = s.GetRoomMentionPolicy(ctx, roomID)
+	st.PersistCallChat, _ = s.GetRoomPersistCallChat(ctx, roomID)
+	st.MediaPolicy, _ = s.GetRoomMediaPolicy(ctx, roomID)
+	st.Welcome, _ = s.GetRoomWelcome(ctx, roomID)
+	unlisted, _ := s.GetRoomUnlisted(ctx, roomID)
+	raid, _ := s.GetRoomRaidMode(ctx, roomID)
+	wm, _ := s.GetRoomWordMask(ctx, roomID)
+	st.Broadcast, _ = s.IsBroadcastRoom(ctx, roomID)
+	st.Unlisted, st.RaidMode, st.WordMask = &unlisted, &raid, &wm
+	return st, nil
+}
+
+func (s *Store) ListRoomMemberDetails(_ context.Context, roomID uuid.UUID) ([]db.RoomMemberDetail, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]db.RoomMemberDetail, 0, len(s.members[roomID]))
+	for userID, m := range s.members[roomID] {
+		u, ok := s.users[userID]
+		if !ok {
+			continue
+		}
+		d := db.RoomMemberDetail{ID: u.ID, Username: u.Username, AvatarURL: u.AvatarURL, Role: m.role, IsBot: u.IsBot, JoinedAt: m.joinedAt}
+		if until := s.mutes[[2]uuid.UUID{roomID, userID}]; until.After(s.now()) {
+			d.MutedUntil = &until
+		}
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Username < out[j].Username })
+	return out, nil
+}
@@ -0,0 +1,96 @@
+package dbtest
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) ListRoomSizes(_ context.Context, f db.RoomSizeFilter) ([]db.RoomSize, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f.Limit <= 0 || f.Limit > 500 {
+		f.Limit = 50
+	}
+	now := s.now()
+	blobSizes := map[string]int64{}
+	for _, b := range s.blobs {
+		blobSizes[b.URL] = b.Size
+	}
+	out := []db.RoomSize{}
+	for roomID, room := range s.rooms {
+		if f.RoomID != uuid.Nil && roomID != f.RoomID {
+			continue
+		}
+		plan := s.roomPlanLocked(roomID)
+		rs := db.RoomSize{
+			RoomID:        roomID,
+			Name:          room.Name,
+			Members:       len(s.members[roomID]),
+			RetentionDays: f.DefaultHistoryDays,
+			MaxMembers:    f.DefaultMaxMembers,
+		}
+		if plan.HistoryDays != nil {
+			rs.RetentionDays = *plan.HistoryDays
+		}
+		if plan.MaxRoomMembers != nil {
+			rs.MaxMembers = *plan.MaxRoomMembers
+		}
+		for _, hold := range s.legalHolds {
+			if hold.ReleasedAt == nil && hold.RoomID != nil && *hold.RoomID == roomID {
+				rs.LegalHold = true
+			}
+		}
+		for _, m := range s.messages {
+			if m.RoomID != roomID {
+				continue
+			}
+			age := now.Sub(m.CreatedAt)
+			size := blobSizes[m.MediaURL]
+			rs.Messages++
+			rs.MediaBytes += size
+			if m.MediaURL != "" {
+				rs.MediaMessages++
+			}
+			if age < 7*24*time.Hour {
+				rs.Messages7d++
+			}
+			if age < 30*24*time.Hour {
+				rs.Messages30d++
+				rs.MediaBytes30d += size
+			}
+			if rs.OldestMessageAt == nil || m.CreatedAt.Before(*rs.OldestMessageAt) {
+				created := m.CreatedAt
+				rs.OldestMessageAt = &created
+			}
+			if rs.RetentionDays > 0 && age > time.Duration(rs.RetentionDays)*24*time.Hour {
+				rs.ExpiredMessages++
+			}
+		}
+		out = append(out, rs)
+	}
+	key := func(rs db.RoomSize) [2]int64 {
+		switch f.OrderBy {
+		case db.RoomSizeByMediaBytes:
+			return [2]int64{rs.MediaBytes}
+		case db.RoomSizeByGrowth:
+			return [2]int64{rs.Messages7d, rs.MediaBytes30d}
+		}
+		return [2]int64{rs.Messages}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		ki, kj := key(out[i]), key(out[j])
+		if ki != kj {
+			return ki[0] > kj[0] || (ki[0] == kj[0] && ki[1] > kj[1])
+		}
+		return out[i].RoomID.String() < out[j].RoomID.String()
+	})
+	if len(out) > f.Limit {
+		out = out[:f.Limit]
+	}
+	return out, nil
+}
@@ -0,0 +1,29 @@
+package dbtest
+
+import (
+	"context"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) ListRoomUnreadStates(_ context.Context, userID uuid.UUID, roomIDs []uuid.UUID) ([]db.RoomUnreadState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]db.RoomUnreadState, 0, len(roomIDs))
+	for _, roomID := range roomIDs {
+		m := s.members[roomID][userID]
+		if m == nil {
+			continue
+		}
+		count, first := s.unreadLocked(roomID, userID, m)
+		out = append(out, db.RoomUnreadState{
+			RoomID:               roomID,
+			LastReadMessageID:    m.lastRead,
+			UnreadCount:          count,
+			FirstUnreadMessageID: first,
+		})
+	}
+	return out, nil
+}
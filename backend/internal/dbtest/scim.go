@@ -0,0 +1,483 @@
+package dbtest
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+type scimToken struct {
+	db.SCIMToken
+	hash string
+}
+
+type scimUser struct {
+	userName    string
+	externalID  string
+	displayName string
+	createdAt   time.Time
+	updatedAt   time.Time
+}
+
+type scimGroup struct {
+	db.SCIMGroup
+	members map[uuid.UUID]bool
+}
+
+func (s *Store) CreateSCIMToken(_ context.Context, name, tokenHash string, createdBy uuid.UUID) (db.SCIMToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextSCIMTokenID++
+	t := &scimToken{SCIMToken: db.SCIMToken{ID: s.nextSCIMTokenID, Name: name, CreatedBy: &createdBy, CreatedAt: s.now()}, hash: tokenHash}
+	s.scimTokens = append(s.scimTokens, t)
+	return t.SCIMToken, nil
+}
+
+func (s *Store) ListSCIMTokens(_ context.Context) ([]db.SCIMToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []db.SCIMToken{}
+	for _, t := range s.scimTokens {
+		out = append(out, t.SCIMToken)
+	}
+	return out, nil
+}
+
+func (s *Store) DeleteSCIMToken(_ context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, t := range s.scimTokens {
+		if t.ID == id {
+			s.scimTokens = slices.Delete(s.scimTokens, i, i+1)
+			return nil
+		}
+	}
+	return db.ErrNotFound
+}
+
+func (s *Store) UseSCIMToken(_ context.Context, tokenHash string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.scimTokens {
+		if t.hash == tokenHash {
+			now := s.now()
+			t.LastUsedAt = &now
+			return t.ID, nil
+		}
+	}
+	return 0, db.ErrNotFound
+}
+
+func (s *Store) scimUserLocked(userID uuid.UUID) (db.SCIMUser, bool) {
+	su, ok := s.scimUsers[userID]
+	u := s.users[userID]
+	if !ok || u == nil {
+		return db.SCIMUser{}, false
+	}
+	return db.SCIMUser{
+		UserID:      userID,
+		UserName:    su.userName,
+		ExternalID:  su.externalID,
+		DisplayName: su.displayName,
+		Email:       u.Email,
+		Username:    u.Username,
+		Active:      u.deactivated.IsZero(),
+		CreatedAt:   su.createdAt,
+		UpdatedAt:   su.updatedAt,
+	}, true
+}
+
+func (s *Store) GetSCIMUser(_ context.Context, userID uuid.UUID) (db.SCIMUser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.scimUserLocked(userID)
+	if !ok {
+		return db.SCIMUser{}, db.ErrNotFound
+	}
+	return u, nil
+}
+
+func (s *Store) ListSCIMUsers(_ context.Context, f db.SCIMFilter, offset, limit int) ([]db.SCIMUser, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var match func(db.SCIMUser) bool
+	switch f.Attr {
+	case "":
+		match = func(db.SCIMUser) bool { return true }
+	case "id":
+		match = func(u db.SCIMUser) bool { return u.UserID.String() == f.Value }
+	case "username":
+		match = func(u db.SCIMUser) bool { return strings.EqualFold(u.UserName, f.Value) }
+	case "externalid":
+		match = func(u db.SCIMUser) bool { return u.ExternalID == f.Value }
+	case "emails.value":
+		match = func(u db.SCIMUser) bool { return u.Email == strings.ToLower(f.Value) }
+	default:
+		return nil, 0, db.ErrSCIMFilter
+	}
+	all := []db.SCIMUser{}
+	for id := range s.scimUsers {
+		if u, ok := s.scimUserLocked(id); ok && match(u) {
+			all = append(all, u)
+		}
+	}
+	slices.SortFunc(all, func(a, b db.SCIMUser) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.UserID.String(), b.UserID.String())
+	})
+	return page(all, offset, limit), len(all), nil
+}
+
+func page[T any](all []T, offset, limit int) []T {
+	if offset >= len(all) {
+		return all[:0]
+	}
+	return all[offset:min(len(all), offset+limit)]
+}
+
+func (s *Store) scimUserNameTakenLocked(userName string, except uuid.UUID) bool {
+	for id, su := range s.scimUsers {
+		if id != except && strings.EqualFold(su.userName, userName) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) CreateSCIMUser(_ context.Context, in db.SCIMUser, username, passwordHash string) (db.SCIMUser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var target *user
+	for _, u := range s.users {
+		if u.Email == in.Email {
+			target = u
+		}
+	}
+	if target == nil {
+		for _, u := range s.users {
+			if u.Username == username {
+				return db.SCIMUser{}, db.ErrUserExists
+			}
+		}
+	} else if target.IsBot || target.GuestExpiresAt != nil {
+		return db.SCIMUser{}, db.ErrUserExists
+	}
+	if target != nil && s.scimUsers[target.ID] != nil || s.scimUserNameTakenLocked(in.UserName, uuid.Nil) {
+		return db.SCIMUser{}, db.ErrSCIMConflict
+	}
+	if target == nil {
+		target = &user{User: db.User{
+			ID:            uuid.New(),
+			Email:         in.Email,
+			Username:      username,
+			EmailVerified: true,
+			PasswordHash:  passwordHash,
+			CreatedAt:     s.now(),
+		}}
+		s.users[target.ID] = target
+	}
+	now := s.now()
+	s.scimUsers[target.ID] = &scimUser{userName: in.UserName, externalID: in.ExternalID, displayName: in.DisplayName, createdAt: now, updatedAt: now}
+	s.setActiveLocked(target, in.Active)
+	out, _ := s.scimUserLocked(target.ID)
+	return out, nil
+}
+
+func (s *Store) setActiveLocked(u *user, active bool) {
+	switch {
+	case active:
+		u.deactivated = time.Time{}
+	case u.deactivated.IsZero():
+		u.deactivated = s.now()
+		u.SessionVersion++
+	}
+}
+
+func (s *Store) UpdateSCIMUser(_ context.Context, in db.SCIMUser) (db.SCIMUser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.scimUserNameTakenLocked(in.UserName, in.UserID) {
+		return db.SCIMUser{}, db.ErrSCIMConflict
+	}
+	su, ok := s.scimUsers[in.UserID]
+	u := s.users[in.UserID]
+	if !ok || u == nil {
+		return db.SCIMUser{}, db.ErrNotFound
+	}
+	for id, other := range s.users {
+		if id != in.UserID && other.Email == in.Email {
+			return db.SCIMUser{}, db.ErrUserExists
+		}
+	}
+	su.userName, su.externalID, su.displayName, su.updatedAt = in.UserName, in.ExternalID, in.DisplayName, s.now()
+	if u.Email != in.Email {
+		u.Email, u.EmailVerified = in.Email, true
+	}
+	s.setActiveLocked(u, in.Active)
+	out, _ := s.scimUserLocked(in.UserID)
+	return out, nil
+}
+
+func (s *Store) DeleteSCIMUser(_ context.Context, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.scimUsers[userID]; !ok {
+		return db.ErrNotFound
+	}
+	delete(s.scimUsers, userID)
+	for _, g := range s.scimGroups {
+		delete(g.members, userID)
+	}
+	if u := s.users[userID]; u != nil {
+		s.setActiveLocked(u, false)
+	}
+	return nil
+}
+
+func (s *Store) IsUserDeactivated(_ context.Context, userID uuid.UUID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return false, db.ErrNotFound
+	}
+	return !u.deactivated.IsZero(), nil
+}
+
+func (s *Store) scimGroupLocked(id uuid.UUID) *scimGroup {
+	for _, g := range s.scimGroups {
+		if g.ID == id {
+			return g
+		}
+	}
+	return nil
+}
+
+// copySCIMGroupLocked returns g with its members, ordered by userName.
+func (s *Store) copySCIMGroupLocked(g *scimGroup) db.SCIMGroup {
+	out := g.SCIMGroup
+	out.Members = []db.SCIMMember{}
+	for id := range g.members {
+		if su, ok := s.scimUsers[id]; ok {
+			out.Members = append(out.Members, db.SCIMMember{UserID: id, UserName: su.userName})
+		}
+	}
+	slices.SortFunc(out.Members, func(a, b db.SCIMMember) int { return strings.Compare(a.UserName, b.UserName) })
+	return out
+}
+
+func (s *Store) GetSCIMGroup(_ context.Context, id uuid.UUID) (db.SCIMGroup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g := s.scimGroupLocked(id)
+	if g == nil {
+		return db.SCIMGroup{}, db.ErrNotFound
+	}
+	return s.copySCIMGroupLocked(g), nil
+}
+
+func (s *Store) ListSCIMGroups(_ context.Context, f db.SCIMFilter, offset, limit int) ([]db.SCIMGroup, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var match func(*scimGroup) bool
+	switch f.Attr {
+	case "":
+		match = func(*scimGroup) bool { return true }
+	case "id":
+		match = func(g *scimGroup) bool { return g.ID.String() == f.Value }
+	case "displayname":
+		match = func(g *scimGroup) bool { return strings.EqualFold(g.DisplayName, f.Value) }
+	case "externalid":
+		match = func(g *scimGroup) bool { return g.ExternalID == f.Value }
+	default:
+		return nil, 0, db.ErrSCIMFilter
+	}
+	all := []db.SCIMGroup{}
+	for _, g := range s.scimGroups {
+		if match(g) {
+			all = append(all, s.copySCIMGroupLocked(g))
+		}
+	}
+	return page(all, offset, limit), len(all), nil
+}
+
+func (s *Store) scimGroupNameTakenLocked(name string, except uuid.UUID) bool {
+	for _, g := range s.scimGroups {
+		if g.ID != except && strings.EqualFold(g.DisplayName, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) CreateSCIMGroup(_ context.Context, displayName, externalID string) (db.SCIMGroup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.scimGroupNameTakenLocked(displayName, uuid.Nil) {
+		return db.SCIMGroup{}, db.ErrSCIMConflict
+	}
+	now := s.now()
+	g := &scimGroup{
+		SCIMGroup: db.SCIMGroup{ID: uuid.New(), DisplayName: displayName, ExternalID: externalID, CreatedAt: now, UpdatedAt: now},
+		members:   make(map[uuid.UUID]bool),
+	}
+	s.scimGroups = append(s.scimGroups, g)
+	return s.copySCIMGroupLocked(g), nil
+}
+
+func (s *Store) RenameSCIMGroup(_ context.Context, id uuid.UUID, displayName, externalID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.scimGroupNameTakenLocked(displayName, id) {
+		return db.ErrSCIMConflict
+	}
+	g := s.scimGroupLocked(id)
+	if g == nil {
+		return db.ErrNotFound
+	}
+	g.DisplayName, g.ExternalID, g.UpdatedAt = displayName, externalID, s.now()
+	return nil
+}
+
+// scimRoomsLocked returns the rooms g's members are kept in.
+func (s *Store) scimRoomsLocked(g *scimGroup) []uuid.UUID {
+	switch {
+	case g.RoomID != nil:
+		if _, ok := s.rooms[*g.RoomID]; ok {
+			return []uuid.UUID{*g.RoomID}
+		}
+	case g.GroupID != nil:
+		var out []uuid.UUID
+		for roomID, ch := range s.channels {
+			if _, dm := s.direct[roomID]; ch.groupID == *g.GroupID && !dm {
+				out = append(out, roomID)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func (s *Store) joinSCIMRoomsLocked(g *scimGroup, userIDs []uuid.UUID) []db.SCIMRoomChange {
+	var out []db.SCIMRoomChange
+	for _, roomID := range s.scimRoomsLocked(g) {
+		for _, userID := range userIDs {
+			if !g.members[userID] || s.members[roomID][userID] != nil {
+				continue
+			}
+			s.joinRoomLocked(roomID, userID)
+			s.recordMembershipLocked(db.MembershipEvent{RoomID: roomID, UserID: userID, Action: db.MembershipJoined, Via: db.ViaSCIM})
+			out = append(out, db.SCIMRoomChange{UserID: userID, RoomID: roomID})
+		}
+	}
+	return out
+}
+
+func (s *Store) AddSCIMGroupMembers(_ context.Context, id uuid.UUID, userIDs []uuid.UUID) ([]uuid.UUID, []db.SCIMRoomChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g := s.scimGroupLocked(id)
+	if g == nil {
+		return nil, nil, nil
+	}
+	var added []uuid.UUID
+	for _, userID := range userIDs {
+		if _, ok := s.scimUsers[userID]; ok && !g.members[userID] {
+			g.members[userID] = true
+			added = append(added, userID)
+		}
+	}
+	if len(added) == 0 {
+		return nil, nil, nil
+	}
+	g.UpdatedAt = s.now()
+	return added, s.joinSCIMRoomsLocked(g, added), nil
+}
+
+// scimLeavingLocked returns the rooms of g that userIDs should leave once
+// out of it.
+func (s *Store) scimLeavingLocked(g *scimGroup, userIDs []uuid.UUID) []db.SCIMRoomChange {
+	var out []db.SCIMRoomChange
+	for _, roomID := range s.scimRoomsLocked(g) {
+		for _, userID := range userIDs {
+			if !g.members[userID] || s.members[roomID][userID] == nil {
+				continue
+			}
+			if room := s.rooms[roomID]; room != nil && room.CreatedBy == userID {
+				continue
+			}
+			kept := false
+			for _, other := range s.scimGroups {
+				if other != g && other.members[userID] && slices.Contains(s.scimRoomsLocked(other), roomID) {
+					kept = true
+				}
+			}
+			if !kept {
+				out = append(out, db.SCIMRoomChange{UserID: userID, RoomID: roomID})
+			}
+		}
+	}
+	return out
+}
+
+func (s *Store) RemoveSCIMGroupMembers(_ context.Context, id uuid.UUID, userIDs []uuid.UUID) ([]uuid.UUID, []db.SCIMRoomChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g := s.scimGroupLocked(id)
+	if g == nil {
+		return nil, nil, nil
+	}
+	leaving := s.scimLeavingLocked(g, userIDs)
+	var removed []uuid.UUID
+	for _, userID := range userIDs {
+		if g.members[userID] {
+			delete(g.members, userID)
+			removed = append(removed, userID)
+		}
+	}
+	if len(removed) == 0 {
+		return nil, nil, nil
+	}
+	g.UpdatedAt = s.now()
+	return removed, leaving, nil
+}
+
+func (s *Store) DeleteSCIMGroup(_ context.Context, id uuid.UUID) ([]db.SCIMRoomChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, g := range s.scimGroups {
+		if g.ID != id {
+			continue
+		}
+		var members []uuid.UUID
+		for userID := range g.members {
+			members = append(members, userID)
+		}
+		leaving := s.scimLeavingLocked(g, members)
+		s.scimGroups = slices.Delete(s.scimGroups, i, i+1)
+		return leaving, nil
+	}
+	return nil, db.ErrNotFound
+}
+
+func (s *Store) SetSCIMGroupTarget(_ context.Context, id uuid.UUID, groupID, roomID *uuid.UUID) ([]db.SCIMRoomChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g := s.scimGroupLocked(id)
+	if g == nil {
+		return nil, db.ErrNotFound
+	}
+	g.GroupID, g.RoomID, g.UpdatedAt = groupID, roomID, s.now()
+	var members []uuid.UUID
+	for userID := range g.members {
+		members = append(members, userID)
+	}
+	return s.joinSCIMRoomsLocked(g, members), nil
+}
@@ -0,0 +1,42 @@
+package dbtest
+
+import (
+	"context"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) RecordSecurityEvent(_ context.Context, e db.SecurityEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextSecEventID++
+	e.ID = s.nextSecEventID
+	e.CreatedAt = s.now()
+	s.secEvents = append(s.secEvents, e)
+	return nil
+}
+
+func (s *Store) ListSecurityEvents(_ context.Context, userID uuid.UUID, limit int) ([]db.SecurityEvent, error) {
+	return s.listSecurityEvents(limit, func(e db.SecurityEvent) bool { return e.UserID != nil && *e.UserID == userID }), nil
+}
+
+func (s *Store) ListRecentSecurityEvents(_ context.Context, kind string, limit int) ([]db.SecurityEvent, error) {
+	return s.listSecurityEvents(limit, func(e db.SecurityEvent) bool { return kind == "" || e.Kind == kind }), nil
+}
+
+func (s *Store) listSecurityEvents(limit int, keep func(db.SecurityEvent) bool) []db.SecurityEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	out := make([]db.SecurityEvent, 0)
+	for i := len(s.secEvents) - 1; i >= 0 && len(out) < limit; i-- {
+		if keep(s.secEvents[i]) {
+			out = append(out, s.secEvents[i])
+		}
+	}
+	return out
+}
@@ -0,0 +1,61 @@
+package dbtest
+
+import (
+	"context"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) setupOpenLocked() bool {
+	if s.instance != nil {
+		return false
+	}
+	for _, u := range s.users {
+		if !u.IsBot {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Store) SetupRequired(_ context.Context) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.setupOpenLocked(), nil
+}
+
+func (s *Store) GetInstanceSettings(_ context.Context) (db.InstanceSettings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.instance == nil {
+		return db.InstanceSettings{}, db.ErrNotFound
+	}
+	return *s.instance, nil
+}
+
+func (s *Store) CompleteSetup(_ context.Context, email, username, passwordHash string, settings db.InstanceSettings) (db.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.setupOpenLocked() {
+		return db.User{}, db.ErrSetupDone
+	}
+	for _, u := range s.users {
+		if u.Email == email || u.Username == username {
+			return db.User{}, ErrDuplicate
+		}
+	}
+	u := &user{User: db.User{
+		ID:            uuid.New(),
+		Email:         email,
+		Username:      username,
+		PasswordHash:  passwordHash,
+		EmailVerified: true,
+		IsAdmin:       true,
+		CreatedAt:     s.now(),
+	}}
+	s.users[u.ID] = u
+	s.instance = &settings
+	return u.User, nil
+}
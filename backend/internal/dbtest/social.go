@@ -0,0 +1,353 @@
+package dbtest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+type friendRequest struct {
+	id          int64
+	requesterID uuid.UUID
+	addresseeID uuid.UUID
+	status      string
+	createdAt   time.Time
+}
+
+type inviteLink struct {
+	token     string
+	tokenHash string
+	roomID    uuid.UUID
+	groupID   uuid.UUID
+	createdBy uuid.UUID
+	createdAt time.Time
+	expiresAt time.Time
+}
+
+type friendInvite struct {
+	token     string
+	tokenHash string
+	createdBy uuid.UUID
+	createdAt time.Time
+	expiresAt time.Time
+}
+
+// Friends.
+
+func (s *Store) ListFriends(_ context.Context, userID uuid.UUID) ([]db.Friend, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]db.Friend, 0)
+	for pair := range s.friendships {
+		if pair[0] != userID {
+			continue
+		}
+		if u, ok := s.users[pair[1]]; ok {
+			out = append(out, friendOf(u))
+		}
+	}
+	sortFriends(out)
+	return out, nil
+}
+
+func (s *Store) IsFriend(_ context.Context, userID, targetID uuid.UUID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.friendships[[2]uuid.UUID{userID, targetID}]
+	return ok, nil
+}
+
+func (s *Store) ListIncomingFriendRequests(_ context.Context, userID uuid.UUID) ([]db.FriendRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]db.FriendRequest, 0)
+	for _, fr := range s.friendRequests {
+		if fr.addresseeID != userID || fr.status != "pending" {
+			continue
+		}
+		requester, addressee := s.users[fr.requesterID], s.users[fr.addresseeID]
+		if requester == nil || addressee == nil {
+			continue
+		}
+		out = append(out, db.FriendRequest{
+			ID:              fr.id,
+			RequesterID:     fr.requesterID,
+			AddresseeID:     fr.addresseeID,
+			Requester:       requester.Username,
+			RequesterAvatar: requester.AvatarURL,
+			Addressee:       addressee.Username,
+			AddresseeAvatar: addressee.AvatarURL,
+			Status:          fr.status,
+			CreatedAt:       fr.createdAt,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (s *Store) CreateFriendRequest(_ context.Context, requesterID, addresseeID uuid.UUID) error {
+	if requesterID == addresseeID {
+		return fmt.Errorf("cannot add self")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.friendships[[2]uuid.UUID{requesterID, addresseeID}]; ok {
+		return nil
+	}
+	for _, fr := range s.friendRequests {
+		if fr.requesterID != requesterID || fr.addresseeID != addresseeID {
+			continue
+		}
+		if fr.status == "rejected" && fr.createdAt.After(s.now().Add(-24*time.Hour)) {
+			return fmt.Errorf("friend request cooldown is active for 24 hours")
+		}
+		fr.status = "pending"
+		fr.createdAt = s.now()
+		return nil
+	}
+	s.nextRequestID++
+	s.friendRequests = append(s.friendRequests, &friendRequest{
+		id:          s.nextRequestID,
+		requesterID: requesterID,
+		addresseeID: addresseeID,
+		status:      "pending",
+		createdAt:   s.now(),
+	})
+	return nil
+}
+
+func (s *Store) AcceptFriendRequest(_ context.Context, reqID int64, userID uuid.UUID) (uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fr := s.friendRequestLocked(reqID)
+	if fr == nil || fr.addresseeID != userID {
+		return uuid.Nil, db.ErrNotFound
+	}
+	if fr.status == "pending" {
+		fr.status = "accepted"
+		s.befriendLocked(fr.requesterID, fr.addresseeID)
+	}
+	return fr.requesterID, nil
+}
+
+func (s *Store) DeclineFriendRequest(_ context.Context, reqID int64, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fr := s.friendRequestLocked(reqID)
+	if fr == nil || fr.addresseeID != userID {
+		return db.ErrNotFound
+	}
+	if fr.status == "pending" {
+		fr.status = "rejected"
+		fr.createdAt = s.now()
+	}
+	return nil
+}
+
+func (s *Store) FindFriendInviteLinkByCreator(_ context.Context, createdBy uuid.UUID) (string, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var latest *friendInvite
+	for _, l := range s.friendInvites {
+		if l.createdBy == createdBy && l.token != "" && (latest == nil || !l.createdAt.Before(latest.createdAt)) {
+			latest = l
+		}
+	}
+	if latest == nil {
+		return "", time.Time{}, db.ErrNotFound
+	}
+	return latest.token, latest.expiresAt, nil
+}
+
+func (s *Store) CreateFriendInviteLink(_ context.Context, rawToken, tokenHash string, createdBy uuid.UUID, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.friendInvites = append(s.friendInvites, &friendInvite{
+		token:     rawToken,
+		tokenHash: tokenHash,
+		createdBy: createdBy,
+		createdAt: s.now(),
+		expiresAt: expiresAt,
+	})
+	return nil
+}
+
+func (s *Store) AddFriendByInviteTokenHash(_ context.Context, tokenHash string, userID uuid.UUID) (db.Friend, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, l := range s.friendInvites {
+		if l.tokenHash != tokenHash || !l.expiresAt.After(s.now()) {
+			continue
+		}
+		if l.createdBy == userID {
+			return db.Friend{}, fmt.Errorf("cannot add self")
+		}
+		inviter, ok := s.users[l.createdBy]
+		if !ok {
+			return db.Friend{}, db.ErrNotFound
+		}
+		s.befriendLocked(l.createdBy, userID)
+		return friendOf(inviter), nil
+	}
+	return db.Friend{}, db.ErrNotFound
+}
+
+// Direct rooms.
+
+func (s *Store) GetOrCreateDirectRoom(_ context.Context, a, b uuid.UUID) (db.Room, error) {
+	if a == b {
+		return db.Room{}, fmt.Errorf("cannot dm self")
+	}
+	userA, userB := a, b
+	if userA.String() > userB.String() {
+		userA, userB = userB, userA
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for roomID, pair := range s.direct {
+		if pair == [2]uuid.UUID{userA, userB} {
+			return *s.rooms[roomID], nil
+		}
+	}
+	r := s.insertRoomLocked("dm-"+userA.String()[:8]+"-"+userB.String()[:8], userA)
+	s.direct[r.ID] = [2]uuid.UUID{userA, userB}
+	s.addMemberLocked(r.ID, userA, "admin", 0)
+	s.addMemberLocked(r.ID, userB, "member", 0)
+	return *r, nil
+}
+
+func (s *Store) ListDirectRoomsForUser(_ context.Context, userID uuid.UUID) ([]db.Room, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]db.Room, 0)
+	for roomID, pair := range s.direct {
+		m := s.members[roomID][userID]
+		if m == nil {
+			continue
+		}
+		otherID := pair[0]
+		if otherID == userID {
+			otherID = pair[1]
+		}
+		r := s.roomForMemberLocked(s.rooms[roomID], userID, m)
+		if other, ok := s.users[otherID]; ok {
+			r.Name, r.AvatarURL = other.Username, other.AvatarURL
+		}
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+// Room and group invite links.
+
+func (s *Store) FindRoomInviteLinkByCreator(_ context.Context, roomID, createdBy uuid.UUID) (string, time.Time, error) {
+	return s.findInviteLink(func(l *inviteLink) bool { return l.roomID == roomID && l.createdBy == createdBy })
+}
+
+func (s *Store) FindGroupInviteLinkByCreator(_ context.Context, groupID, createdBy uuid.UUID) (string, time.Time, error) {
+	return s.findInviteLink(func(l *inviteLink) bool { return l.groupID == groupID && l.createdBy == createdBy })
+}
+
+func (s *Store) CreateRoomInviteLink(_ context.Context, rawToken, tokenHash string, roomID, createdBy uuid.UUID, expiresAt time.Time) error {
+	s.addInviteLink(&inviteLink{token: rawToken, tokenHash: tokenHash, roomID: roomID, createdBy: createdBy, expiresAt: expiresAt})
+	return nil
+}
+
+func (s *Store) CreateGroupInviteLink(_ context.Context, rawToken, tokenHash string, groupID, createdBy uuid.UUID, expiresAt time.Time) error {
+	s.addInviteLink(&inviteLink{token: rawToken, tokenHash: tokenHash, groupID: groupID, createdBy: createdBy, expiresAt: expiresAt})
+	return nil
+}
+
+// JoinRoomByInviteTokenHash joins the linked room, or every channel of the
+// linked group, and returns the room the client should open.
+func (s *Store) JoinRoomByInviteTokenHash(_ context.Context, tokenHash string, userID uuid.UUID) (uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var link *inviteLink
+	for _, l := range s.inviteLinks {
+		if l.tokenHash == tokenHash && l.expiresAt.After(s.now()) {
+			link = l
+		}
+	}
+	if link == nil {
+		return uuid.Nil, db.ErrNotFound
+	}
+	if link.roomID != uuid.Nil {
+		s.joinByLinkLocked(link.roomID, userID, link)
+		return link.roomID, nil
+	}
+
+	roomIDs := make([]uuid.UUID, 0)
+	for roomID, ch := range s.channels {
+		if ch.groupID == link.groupID {
+			roomIDs = append(roomIDs, roomID)
+		}
+	}
+	if len(roomIDs) == 0 {
+		return uuid.Nil, db.ErrNotFound
+	}
+	sort.Slice(roomIDs, func(i, j int) bool {
+		a, b := s.channels[roomIDs[i]], s.channels[roomIDs[j]]
+		if (a.channelType == "text") != (b.channelType == "text") {
+			return a.channelType == "text"
+		}
+		if a.position != b.position {
+			return a.position < b.position
+		}
+		return s.rooms[roomIDs[i]].CreatedAt.Before(s.rooms[roomIDs[j]].CreatedAt)
+	})
+	for _, roomID := range roomIDs {
+		s.joinByLinkLocked(roomID, userID, link)
+	}
+	return roomIDs[0], nil
+}
+
+func (s *Store) addInviteLink(l *inviteLink) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l.createdAt = s.now()
+	s.inviteLinks = append(s.inviteLinks, l)
+}
+
+func (s *Store) findInviteLink(match func(*inviteLink) bool) (string, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var latest *inviteLink
+	for _, l := range s.inviteLinks {
+		if match(l) && l.token != "" && (latest == nil || !l.createdAt.Before(latest.createdAt)) {
+			latest = l
+		}
+	}
+	if latest == nil {
+		return "", time.Time{}, db.ErrNotFound
+	}
+	return latest.token, latest.expiresAt, nil
+}
+
+func (s *Store) friendRequestLocked(id int64) *friendRequest {
+	for _, fr := range s.friendRequests {
+		if fr.id == id {
+			return fr
+		}
+	}
+	return nil
+}
+
+func (s *Store) befriendLocked(a, b uuid.UUID) {
+	s.friendships[[2]uuid.UUID{a, b}] = struct{}{}
+	s.friendships[[2]uuid.UUID{b, a}] = struct{}{}
+}
+
+func friendOf(u *user) db.Friend {
+	return db.Friend{ID: u.ID, Username: u.Username, Email: u.Email, AvatarURL: u.AvatarURL}
+}
+
+func sortFriends(friends []db.Friend) {
+	sort.Slice(friends, func(i, j int) bool { return friends[i].Username < friends[j].Username })
+}
@@ -0,0 +1,276 @@
+package dbtest
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+type ssoSubject struct {
+	groupID uuid.UUID
+	subject string
+}
+
+type ssoLogin struct {
+	db.SSOLogin
+	createdAt time.Time
+}
+
+type ssoCode struct {
+	userID    uuid.UUID
+	createdAt time.Time
+}
+
+func copySSO(c *db.WorkspaceSSO) db.WorkspaceSSO {
+	out := *c
+	out.RoleMappings = slices.Clone(c.RoleMappings)
+	out.HasClientSecret = c.ClientSecret != ""
+	return out
+}
+
+func (s *Store) GetWorkspaceSSO(_ context.Context, groupID uuid.UUID) (db.WorkspaceSSO, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.ssoConfigs[groupID]
+	if !ok {
+		return db.WorkspaceSSO{}, db.ErrNotFound
+	}
+	return copySSO(c), nil
+}
+
+func (s *Store) ListWorkspaceSSO(_ context.Context) ([]db.WorkspaceSSO, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []db.WorkspaceSSO{}
+	for _, c := range s.ssoConfigs {
+		cp := copySSO(c)
+		cp.ClientSecret = ""
+		out = append(out, cp)
+	}
+	slices.SortFunc(out, func(a, b db.WorkspaceSSO) int {
+		if a.Approved != b.Approved {
+			if a.Approved {
+				return 1
+			}
+			return -1
+		}
+		return b.UpdatedAt.Compare(a.UpdatedAt)
+	})
+	return out, nil
+}
+
+func (s *Store) SaveWorkspaceSSO(_ context.Context, c db.WorkspaceSSO, _ uuid.UUID) (db.WorkspaceSSO, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c.Approved = false
+	if cur, ok := s.ssoConfigs[c.GroupID]; ok {
+		c.Approved = cur.Approved && cur.Protocol == c.Protocol && cur.Issuer == c.Issuer && cur.IdPSSOURL == c.IdPSSOURL
+		if c.ClientSecret == "" {
+			c.ClientSecret = cur.ClientSecret
+		}
+	}
+	if c.RoleMappings == nil {
+		c.RoleMappings = []db.SSORoleMapping{}
+	}
+	c.UpdatedAt = s.now()
+	saved := copySSO(&c)
+	s.ssoConfigs[c.GroupID] = &saved
+	return copySSO(&saved), nil
+}
+
+func (s *Store) DeleteWorkspaceSSO(_ context.Context, groupID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.ssoConfigs[groupID]; !ok {
+		return db.ErrNotFound
+	}
+	delete(s.ssoConfigs, groupID)
+	return nil
+}
+
+func (s *Store) SetWorkspaceSSOApproved(_ context.Context, groupID uuid.UUID, approved bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.ssoConfigs[groupID]
+	if !ok {
+		return db.ErrNotFound
+	}
+	c.Approved = approved
+	return nil
+}
+
+func (s *Store) CanManageGroup(_ context.Context, groupID, userID uuid.UUID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.groups[groupID]
+	if !ok {
+		return false, db.ErrNotFound
+	}
+	if g.createdBy == userID {
+		return true, nil
+	}
+	for roomID, ch := range s.channels {
+		if m, ok := s.members[roomID][userID]; ok && ch.groupID == groupID && m.role == "admin" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *Store) EnforcedSSOGroup(_ context.Context, userID uuid.UUID) (uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for groupID, c := range s.ssoConfigs {
+		if !c.Active() || !c.Enforced {
+			continue
+		}
+		if g, ok := s.groups[groupID]; ok && g.createdBy == userID {
+			continue
+		}
+		for roomID, ch := range s.channels {
+			if _, ok := s.members[roomID][userID]; ok && ch.groupID == groupID {
+				return groupID, nil
+			}
+		}
+	}
+	return uuid.Nil, db.ErrNotFound
+}
+
+func (s *Store) CreateSSOLogin(_ context.Context, stateHash string, l db.SSOLogin) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ssoLogins[stateHash] = ssoLogin{SSOLogin: l, createdAt: s.now()}
+	return nil
+}
+
+func (s *Store) TakeSSOLogin(_ context.Context, stateHash string) (db.SSOLogin, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.ssoLogins[stateHash]
+	delete(s.ssoLogins, stateHash)
+	if !ok || s.now().Sub(l.createdAt) >= db.SSOLoginWindow {
+		return db.SSOLogin{}, db.ErrNotFound
+	}
+	return l.SSOLogin, nil
+}
+
+func (s *Store) CreateSSOExchange(_ context.Context, codeHash string, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ssoCodes[codeHash] = ssoCode{userID: userID, createdAt: s.now()}
+	return nil
+}
+
+func (s *Store) TakeSSOExchange(_ context.Context, codeHash string) (uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.ssoCodes[codeHash]
+	delete(s.ssoCodes, codeHash)
+	if !ok || s.now().Sub(c.createdAt) >= db.SSOExchangeWindow {
+		return uuid.Nil, db.ErrNotFound
+	}
+	return c.userID, nil
+}
+
+func (s *Store) DeleteExpiredSSOLogins(_ context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for h, l := range s.ssoLogins {
+		if s.now().Sub(l.createdAt) >= db.SSOLoginWindow {
+			delete(s.ssoLogins, h)
+			n++
+		}
+	}
+	for h, c := range s.ssoCodes {
+		if s.now().Sub(c.createdAt) >= db.SSOExchangeWindow {
+			delete(s.ssoCodes, h)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *Store) FindSSOIdentity(_ context.Context, groupID uuid.UUID, subject string) (uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	userID, ok := s.ssoIdents[ssoSubject{groupID, subject}]
+	if !ok {
+		return uuid.Nil, db.ErrNotFound
+	}
+	return userID, nil
+}
+
+func (s *Store) LinkSSOIdentity(_ context.Context, groupID uuid.UUID, subject string, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := ssoSubject{groupID, subject}
+	if owner, ok := s.ssoIdents[key]; ok {
+		if owner != userID {
+			return db.ErrSSOIdentityTaken
+		}
+		return nil
+	}
+	for k, owner := range s.ssoIdents {
+		if k.groupID == groupID && owner == userID {
+			delete(s.ssoIdents, k)
+		}
+	}
+	s.ssoIdents[key] = userID
+	return nil
+}
+
+func (s *Store) CreateSSOUser(_ context.Context, groupID uuid.UUID, subject, email, username, passwordHash string) (db.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.Email == email || u.Username == username {
+			return db.User{}, db.ErrUserExists
+		}
+	}
+	u := &user{User: db.User{
+		ID:            uuid.New(),
+		Email:         email,
+		Username:      username,
+		EmailVerified: true,
+		PasswordHash:  passwordHash,
+		CreatedAt:     s.now(),
+	}}
+	s.users[u.ID] = u
+	s.ssoIdents[ssoSubject{groupID, subject}] = u.ID
+	return u.User, nil
+}
+
+func (s *Store) SyncSSOMembership(_ context.Context, groupID, userID uuid.UUID, role string) ([]uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g := s.groups[groupID]
+	var joined []uuid.UUID
+	for roomID, ch := range s.channels {
+		if ch.groupID != groupID {
+			continue
+		}
+		if _, dm := s.direct[roomID]; dm {
+			continue
+		}
+		m, ok := s.members[roomID][userID]
+		if !ok {
+			s.joinRoomLocked(roomID, userID)
+			s.members[roomID][userID].role = role
+			s.recordMembershipLocked(db.MembershipEvent{
+				RoomID: roomID, UserID: userID, Action: db.MembershipJoined, Via: db.ViaSSO,
+			})
+			joined = append(joined, roomID)
+			continue
+		}
+		if room := s.rooms[roomID]; room != nil && room.CreatedBy == userID || g != nil && g.createdBy == userID {
+			continue
+		}
+		m.role = role
+	}
+	return joined, nil
+}
@@ -0,0 +1,816 @@
+// Package dbtest provides an in-memory implementation of the persistence
+// interfaces (httpapi.Store, ws.Store, notify.DeviceStore) so handlers and
+// WebSocket flows can be tested without Postgres.
+//
+// The fake mirrors the SQL semantics of *db.Store closely enough for handler
+// tests: the same sentinel errors, ordering and access rules. It does not
+// model transactions or concurrent writers beyond a single mutex.
+package dbtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/profile"
+
+	"github.com/google/uuid"
+)
+
+// ErrDuplicate is returned where Postgres would report a unique violation.
+var ErrDuplicate = errors.New("duplicate key")
+
+type user struct {
+	db.User
+	verifyHash   string
+	verifySentAt time.Time
+	verifyTries  int
+	verifySends  int
+	verifyWindow time.Time
+	resetHash    string
+	resetSentAt  time.Time
+	resetUsed    bool
+	shadowBanned bool
+	hideNSFW     bool
+	noAdminMail  bool
+	quietHours   db.QuietHours
+	keywords     []string
+	age          db.AgeSettings
+	profile      map[string]string
+	locale       db.UserLocale
+	sharing      string
+	profileAt    time.Time
+	phone        string
+	phoneDigest  string
+	phoneHint    string
+	discoverable bool
+	smsAlerts    bool
+	phonePending string
+	pendingHash  string
+	phoneCode    string
+	phoneSentAt  time.Time
+	phoneTries   int
+	smsSends     []time.Time
+	deactivated  time.Time
+}
+
+type member struct {
+	role          string
+	joinedAt      time.Time
+	lastRead      int64
+	lastDelivered int64
+}
+
+type group struct {
+	id        uuid.UUID
+	name      string
+	createdBy uuid.UUID
+	createdAt time.Time
+}
+
+type channel struct {
+	groupID     uuid.UUID
+	channelType string
+	position    int
+}
+
+type Store struct {
+	// Now is the clock used for created_at columns and expiry checks.
+	Now func() time.Time
+
+	mu             sync.Mutex
+	users          map[uuid.UUID]*user
+	rooms          map[uuid.UUID]*db.Room
+	members        map[uuid.UUID]map[uuid.UUID]*member
+	direct         map[uuid.UUID][2]uuid.UUID
+	groups         map[uuid.UUID]*group
+	channels       map[uuid.UUID]*channel
+	messages       []db.Message
+	friendRequests []*friendRequest
+	friendships    map[[2]uuid.UUID]struct{}
+	inviteLinks    []*inviteLink
+	friendInvites  []*friendInvite
+	pushDevices    map[string]*db.PushDevice
+	logins         []loginEvent
+	secEvents      []db.SecurityEvent
+	notifications  []*db.Notification
+	emailChanges   []*emailChange
+	roomEvents     map[uuid.UUID][]db.RoomEvent
+	welcomes       map[uuid.UUID]db.RoomWelcome
+	welcomed       map[[2]uuid.UUID]struct{}
+	guestLinks     map[string]*guestLink
+	deviceLinks    []*deviceLink
+	messageKeys    map[messageKey]int64
+	mentions       map[uuid.UUID]string // @room policy by room
+	automodRules   []*db.AutomodRule
+	automodEvents  []db.AutomodEvent
+	mutes          map[[2]uuid.UUID]time.Time
+	raidMode       map[uuid.UUID]bool
+	joinReqs       map[[2]uuid.UUID]time.Time
+	joinReqLink    map[[2]uuid.UUID]string
+	nsfwRooms      map[uuid.UUID]bool
+	roomLangs      map[uuid.UUID]string
+	wordMasks      map[uuid.UUID]db.WordMask
+	unlisted       map[uuid.UUID]bool
+	broadcast      map[uuid.UUID]bool
+	roomSubs       map[uuid.UUID]map[uuid.UUID]time.Time
+	memberLog      []db.MembershipEvent
+	transfers      map[uuid.UUID]db.OwnershipTransfer
+	callChat       map[uuid.UUID]bool
+	feedback       []callFeedback
+	regions        map[uuid.UUID]string
+	plans          map[string]db.Plan
+	userPlans      map[uuid.UUID]string
+	groupPlans     map[uuid.UUID]string
+	subs           map[string]*subscription
+	seenEvents     map[string]struct{}
+	profileDefs    map[string]profile.Field
+	uploads        map[string]db.DirectUpload
+	blobs          map[string]db.UploadBlob
+	boardItems     []*boardItem
+	roomCommands   []*db.RoomCommand
+	commandMsgs    map[int64]int64
+	legalHolds     []*db.LegalHold
+	richPresence   []db.RichPresence
+	embeds         map[uuid.UUID]roomEmbed
+	automations    []*db.Automation
+	autoRuns       map[int64][]db.AutomationRun
+	repoLinks      []*db.RepoLink
+	monitors       []*db.UptimeMonitor
+	ssoConfigs     map[uuid.UUID]*db.WorkspaceSSO
+	ssoIdents      map[ssoSubject]uuid.UUID
+	ssoLogins      map[string]ssoLogin
+	ssoCodes       map[string]ssoCode
+	scimTokens     []*scimToken
+	scimUsers      map[uuid.UUID]*scimUser
+	scimGroups     []*scimGroup
+	ldapIdents     map[string]*ldapIdent
+	dictionaries   []*db.ModerationDictionary
+	snapshots      map[string]syncSnapshot
+	mediaPolicy    map[uuid.UUID]db.MediaPolicy
+	instance       *db.InstanceSettings
+
+	nextMessageID      int64
+	nextRequestID      int64
+	nextDeviceID       int64
+	nextLoginID        int64
+	nextSecEventID     int64
+	nextNotificationID int64
+	nextEmailChangeID  int64
+	nextDeviceLinkID   int64
+	nextAutomodRuleID  int64
+	nextAutomodEventID int64
+	nextBoardItemID    int64
+	nextRoomCommandID  int64
+	nextLegalHoldID    int64
+	nextAutomationID   int64
+	nextRepoLinkID     int64
+	nextMonitorID      int64
+	nextSCIMTokenID    int64
+	nextDictionaryID   int64
+}
+
+func New() *Store {
+	return &Store{
+		Now:         time.Now,
+		users:       make(map[uuid.UUID]*user),
+		rooms:       make(map[uuid.UUID]*db.Room),
+		members:     make(map[uuid.UUID]map[uuid.UUID]*member),
+		direct:      make(map[uuid.UUID][2]uuid.UUID),
+		groups:      make(map[uuid.UUID]*group),
+		channels:    make(map[uuid.UUID]*channel),
+		friendships: make(map[[2]uuid.UUID]struct{}),
+		pushDevices: make(map[string]*db.PushDevice),
+		roomEvents:  make(map[uuid.UUID][]db.RoomEvent),
+		welcomes:    make(map[uuid.UUID]db.RoomWelcome),
+		welcomed:    make(map[[2]uuid.UUID]struct{}),
+		guestLinks:  make(map[string]*guestLink),
+		messageKeys: make(map[messageKey]int64),
+		mentions:    make(map[uuid.UUID]string),
+		mutes:       make(map[[2]uuid.UUID]time.Time),
+		raidMode:    make(map[uuid.UUID]bool),
+		joinReqs:    make(map[[2]uuid.UUID]time.Time),
+		joinReqLink: make(map[[2]uuid.UUID]string),
+		nsfwRooms:   make(map[uuid.UUID]bool),
+		roomLangs:   make(map[uuid.UUID]string),
+		wordMasks:   make(map[uuid.UUID]db.WordMask),
+		unlisted:    make(map[uuid.UUID]bool),
+		broadcast:   make(map[uuid.UUID]bool),
+		roomSubs:    make(map[uuid.UUID]map[uuid.UUID]time.Time),
+		transfers:   make(map[uuid.UUID]db.OwnershipTransfer),
+		callChat:    make(map[uuid.UUID]bool),
+		regions:     make(map[uuid.UUID]string),
+		plans:       make(map[string]db.Plan),
+		userPlans:   make(map[uuid.UUID]string),
+		groupPlans:  make(map[uuid.UUID]string),
+		subs:        make(map[string]*subscription),
+		seenEvents:  make(map[string]struct{}),
+		profileDefs: make(map[string]profile.Field),
+		uploads:     make(map[string]db.DirectUpload),
+		blobs:       make(map[string]db.UploadBlob),
+		commandMsgs: make(map[int64]int64),
+		embeds:      make(map[uuid.UUID]roomEmbed),
+		autoRuns:    make(map[int64][]db.AutomationRun),
+		ssoConfigs:  make(map[uuid.UUID]*db.WorkspaceSSO),
+		ssoIdents:   make(map[ssoSubject]uuid.UUID),
+		ssoLogins:   make(map[string]ssoLogin),
+		ssoCodes:    make(map[string]ssoCode),
+		scimUsers:   make(map[uuid.UUID]*scimUser),
+		ldapIdents:  make(map[string]*ldapIdent),
+		snapshots:   make(map[string]syncSnapshot),
+		mediaPolicy: make(map[uuid.UUID]db.MediaPolicy),
+	}
+}
+
+func (s *Store) now() time.Time {
+	return s.Now().UTC()
+}
+
+// Users.
+
+func (s *Store) CreateUser(_ context.Context, email, username, passwordHash string) (db.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.Email == email || u.Username == username {
+			return db.User{}, ErrDuplicate
+		}
+	}
+	u := &user{User: db.User{
+		ID:           uuid.New(),
+		Email:        email,
+		Username:     username,
+		PasswordHash: passwordHash,
+		CreatedAt:    s.now(),
+	}}
+	s.users[u.ID] = u
+	return u.User, nil
+}
+
+func (s *Store) FindUserByUsername(_ context.Context, username string) (db.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.Username == username {
+			return u.User, nil
+		}
+	}
+	return db.User{}, db.ErrNotFound
+}
+
+func (s *Store) FindUserByEmail(_ context.Context, email string) (db.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.Email == email {
+			return u.User, nil
+		}
+	}
+	return db.User{}, db.ErrNotFound
+}
+
+func (s *Store) ListInstanceAdminIDs(_ context.Context) ([]uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []uuid.UUID
+	for id, u := range s.users {
+		if u.IsAdmin {
+			out = append(out, id)
+		}
+	}
+	return out, nil
+}
+
+func (s *Store) FindUserByID(_ context.Context, id uuid.UUID) (db.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[id]
+	if !ok {
+		return db.User{}, db.ErrNotFound
+	}
+	return u.User, nil
+}
+
+func (s *Store) UpdateUserAvatar(_ context.Context, userID uuid.UUID, avatarURL string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.users[userID]; ok {
+		if a := strings.TrimSpace(avatarURL); a != u.AvatarURL {
+			u.AvatarURL = a
+			u.profileAt = s.now()
+		}
+	}
+	return nil
+}
+
+func (s *Store) SearchUsers(_ context.Context, selfID uuid.UUID, q string, limit int) ([]db.Friend, error) {
+	if limit <= 0 || limit > 20 {
+		limit = 10
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q = strings.ToLower(q)
+	out := make([]db.Friend, 0)
+	for _, u := range s.users {
+		if u.ID == selfID {
+			continue
+		}
+		if strings.Contains(strings.ToLower(u.Username), q) || strings.Contains(strings.ToLower(u.Email), q) {
+			out = append(out, friendOf(u))
+		}
+	}
+	sortFriends(out)
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (s *Store) SetEmailVerificationToken(_ context.Context, userID uuid.UUID, tokenHash string, sentAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.users[userID]; ok {
+		u.verifyHash, u.verifySentAt, u.verifyTries = tokenHash, sentAt, 0
+	}
+	return nil
+}
+
+func (s *Store) VerifyEmailCode(_ context.Context, email, tokenHash string, maxAttempts int) (db.User, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.Email != email || u.verifyHash == "" || u.verifySentAt.Before(s.now().Add(-24*time.Hour)) {
+			continue
+		}
+		if maxAttempts > 0 && u.verifyTries >= maxAttempts {
+			return db.User{}, 0, db.ErrTooManyAttempts
+		}
+		if u.verifyHash != tokenHash {
+			u.verifyTries++
+			if maxAttempts <= 0 {
+				return db.User{}, 0, db.ErrCodeMismatch
+			}
+			if left := maxAttempts - u.verifyTries; left > 0 {
+				return db.User{}, left, db.ErrCodeMismatch
+			}
+			return db.User{}, 0, db.ErrTooManyAttempts
+		}
+		u.EmailVerified = true
+		u.verifyHash = ""
+		u.verifyTries = 0
+		return u.User, 0, nil
+	}
+	return db.User{}, 0, db.ErrNotFound
+}
+
+func (s *Store) AllowVerificationEmail(_ context.Context, userID uuid.UUID, perHour int) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return false, 0, db.ErrNotFound
+	}
+	if perHour <= 0 {
+		return true, 0, nil
+	}
+	now := s.now()
+	if u.verifyWindow.IsZero() || !u.verifyWindow.After(now.Add(-time.Hour)) {
+		u.verifyWindow, u.verifySends = now, 1
+		return true, 0, nil
+	}
+	if u.verifySends < perHour {
+		u.verifySends++
+		return true, 0, nil
+	}
+	return false, max(u.verifyWindow.Add(time.Hour).Sub(now), time.Second), nil
+}
+
+func (s *Store) SetPasswordResetToken(_ context.Context, userID uuid.UUID, tokenHash string, sentAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.users[userID]; ok {
+		u.resetHash, u.resetSentAt, u.resetUsed = tokenHash, sentAt, false
+	}
+	return nil
+}
+
+func (s *Store) ResetPasswordByTokenHash(_ context.Context, tokenHash, passwordHash string) (uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.resetHash == "" || u.resetHash != tokenHash {
+			continue
+		}
+		if u.resetUsed {
+			return uuid.Nil, db.ErrTokenUsed
+		}
+		if !u.resetSentAt.Before(s.now().Add(-2 * time.Hour)) {
+			u.PasswordHash = passwordHash
+			u.resetUsed = true
+			u.SessionVersion++
+			return u.ID, nil
+		}
+	}
+	return uuid.Nil, db.ErrNotFound
+}
+
+func (s *Store) GetSessionVersion(_ context.Context, userID uuid.UUID) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok || s.guestExpiredLocked(u) || !u.deactivated.IsZero() {
+		return 0, db.ErrNotFound
+	}
+	return u.SessionVersion, nil
+}
+
+func (s *Store) ChangePassword(_ context.Context, userID uuid.UUID, passwordHash string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return 0, db.ErrNotFound
+	}
+	u.PasswordHash = passwordHash
+	u.resetHash = ""
+	u.SessionVersion++
+	return u.SessionVersion, nil
+}
+
+// Rooms and membership.
+
+func (s *Store) CreateRoom(_ context.Context, name string, createdBy uuid.UUID, _ bool) (db.Room, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.insertRoomLocked(name, createdBy)
+	s.addMemberLocked(r.ID, createdBy, "admin", 0)
+	out := *r
+	out.MyRole = "admin"
+	out.CanManage = true
+	return out, nil
+}
+
+func (s *Store) GetRoomByID(_ context.Context, roomID uuid.UUID) (db.Room, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.rooms[roomID]
+	if !ok {
+		return db.Room{}, db.ErrNotFound
+	}
+	return *r, nil
+}
+
+func (s *Store) GetRoomForUser(_ context.Context, roomID, userID uuid.UUID) (db.Room, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.rooms[roomID]
+	m := s.members[roomID][userID]
+	if !ok || m == nil {
+		return db.Room{}, db.ErrNotFound
+	}
+	out := *r
+	out.MyRole = m.role
+	out.CanManage = m.role == "admin"
+	return out, nil
+}
+
+func (s *Store) ListRoomsForUser(_ context.Context, userID uuid.UUID) ([]db.Room, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []db.Room{}
+	for id, r := range s.rooms {
+		m := s.members[id][userID]
+		_, isDirect := s.direct[id]
+		_, isChannel := s.channels[id]
+		if m == nil || isDirect || isChannel {
+			continue
+		}
+		out = append(out, s.roomForMemberLocked(r, userID, m))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (s *Store) UpdateRoomName(_ context.Context, roomID uuid.UUID, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.rooms[roomID]; ok {
+		r.Name = name
+	}
+	return nil
+}
+
+func (s *Store) DeleteRoom(_ context.Context, roomID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.roomHeldLocked(roomID) {
+		return db.ErrLegalHold
+	}
+	s.deleteRoomLocked(roomID)
+	return nil
+}
+
+func (s *Store) JoinRoom(_ context.Context, roomID, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.joinRoomLocked(roomID, userID)
+	return nil
+}
+
+func (s *Store) LeaveRoom(_ context.Context, roomID, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	members := s.members[roomID]
+	m := members[userID]
+	if m == nil {
+		return db.ErrNotFound
+	}
+	delete(members, userID)
+	s.recordEventLocked(roomID, "member_left", userID, nil, nil)
+	if len(members) == 0 {
+		if !s.roomHeldLocked(roomID) {
+			s.deleteRoomLocked(roomID)
+		}
+		return nil
+	}
+	if m.role != "admin" {
+		return nil
+	}
+	var oldest *member
+	var oldestID uuid.UUID
+	for id, other := range members {
+		if other.role == "admin" {
+			return nil
+		}
+		if oldest == nil || other.joinedAt.Before(oldest.joinedAt) {
+			oldest, oldestID = other, id
+		}
+	}
+	oldest.role = "admin"
+	s.recordEventLocked(roomID, "member_role_changed", oldestID, nil, map[string]string{"role": "admin"})
+	return nil
+}
+
+func (s *Store) IsRoomMember(_ context.Context, roomID, userID uuid.UUID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.members[roomID][userID] != nil, nil
+}
+
+func (s *Store) IsRoomAdmin(_ context.Context, roomID, userID uuid.UUID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.members[roomID][userID]
+	return m != nil && m.role == "admin", nil
+}
+
+func (s *Store) IsDirectRoom(_ context.Context, roomID uuid.UUID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.direct[roomID]
+	return ok, nil
+}
+
+func (s *Store) ListRoomMembers(_ context.Context, roomID uuid.UUID) ([]db.RoomMember, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]db.RoomMember, 0, len(s.members[roomID]))
+	for userID := range s.members[roomID] {
+		if u, ok := s.users[userID]; ok {
+			out = append(out, db.RoomMember{ID: u.ID, Username: u.Username, AvatarURL: u.AvatarURL})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Username < out[j].Username })
+	return out, nil
+}
+
+// Groups and channels.
+
+func (s *Store) ListRoomGroupsForUser(_ context.Context, userID uuid.UUID) ([]db.RoomGroup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	type row struct {
+		ch *channel
+		db.GroupChannel
+	}
+	byGroup := make(map[uuid.UUID][]row)
+	for roomID, ch := range s.channels {
+		m := s.members[roomID][userID]
+		if m == nil {
+			continue
+		}
+		r := s.rooms[roomID]
+		unread, firstUnread := s.unreadLocked(roomID, userID, m)
+		byGroup[ch.groupID] = append(byGroup[ch.groupID], row{ch: ch, GroupChannel: db.GroupChannel{
+			ID:                   r.ID,
+			Name:                 r.Name,
+			ChannelType:          ch.channelType,
+			Position:             ch.position,
+			CreatedBy:            r.CreatedBy,
+			IsPrivate:            r.IsPrivate,
+			MyRole:               m.role,
+			CanManage:            m.role == "admin",
+			UnreadCount:          unread,
+			FirstUnreadMessageID: firstUnread,
+			CreatedAt:            r.CreatedAt,
+		}})
+	}
+
+	out := make([]db.RoomGroup, 0, len(byGroup))
+	for groupID, rows := range byGroup {
+		g := s.groups[groupID]
+		sort.Slice(rows, func(i, j int) bool {
+			if rows[i].ch.position != rows[j].ch.position {
+				return rows[i].ch.position < rows[j].ch.position
+			}
+			return rows[i].CreatedAt.Before(rows[j].CreatedAt)
+		})
+		rg := db.RoomGroup{
+			ID:            g.id,
+			Name:          g.name,
+			CreatedBy:     g.createdBy,
+			CanManage:     s.canManageGroupLocked(g, userID),
+			CreatedAt:     g.createdAt,
+			TextChannels:  make([]db.GroupChannel, 0),
+			VoiceChannels: make([]db.GroupChannel, 0),
+		}
+		for _, r := range rows {
+			if r.ChannelType == "voice" {
+				rg.VoiceChannels = append(rg.VoiceChannels, r.GroupChannel)
+			} else {
+				rg.TextChannels = append(rg.TextChannels, r.GroupChannel)
+			}
+		}
+		out = append(out, rg)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out, nil
+}
+
+func (s *Store) CreateRoomGroup(_ context.Context, name string, createdBy uuid.UUID) (db.RoomGroup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g := &group{id: uuid.New(), name: name, createdBy: createdBy, createdAt: s.now()}
+	s.groups[g.id] = g
+	return db.RoomGroup{
+		ID:            g.id,
+		Name:          g.name,
+		CreatedBy:     g.createdBy,
+		CanManage:     true,
+		CreatedAt:     g.createdAt,
+		TextChannels:  []db.GroupChannel{},
+		VoiceChannels: []db.GroupChannel{},
+	}, nil
+}
+
+func (s *Store) UpdateRoomGroupName(_ context.Context, groupID uuid.UUID, userID uuid.UUID, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.groups[groupID]
+	if !ok || !s.canManageGroupLocked(g, userID) {
+		return db.ErrForbidden
+	}
+	g.name = name
+	return nil
+}
+
+func (s *Store) CreateGroupChannel(_ context.Context, groupID uuid.UUID, name, channelType string, createdBy uuid.UUID) (db.GroupChannel, error) {
+	if channelType != "text" && channelType != "voice" {
+		return db.GroupChannel{}, fmt.Errorf("invalid channel type")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.groups[groupID]
+	if !ok {
+		return db.GroupChannel{}, db.ErrNotFound
+	}
+	if !s.canManageGroupLocked(g, createdBy) {
+		return db.GroupChannel{}, db.ErrForbidden
+	}
+	position := 0
+	for _, ch := range s.channels {
+		if ch.groupID == groupID && ch.channelType == channelType && ch.position >= position {
+			position = ch.position + 1
+		}
+	}
+	r := s.insertRoomLocked(name, createdBy)
+	s.addMemberLocked(r.ID, createdBy, "admin", 0)
+	s.channels[r.ID] = &channel{groupID: groupID, channelType: channelType, position: position}
+	return db.GroupChannel{
+		ID:          r.ID,
+		Name:        r.Name,
+		ChannelType: channelType,
+		Position:    position,
+		CreatedBy:   createdBy,
+		IsPrivate:   true,
+		MyRole:      "admin",
+		CanManage:   true,
+		CreatedAt:   r.CreatedAt,
+	}, nil
+}
+
+func (s *Store) GetGroupIDByRoomID(_ context.Context, roomID uuid.UUID) (uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ch, ok := s.channels[roomID]
+	if !ok {
+		return uuid.Nil, db.ErrNotFound
+	}
+	return ch.groupID, nil
+}
+
+// Locked helpers; callers hold s.mu.
+
+func (s *Store) insertRoomLocked(name string, createdBy uuid.UUID) *db.Room {
+	r := &db.Room{ID: uuid.New(), Name: name, CreatedBy: createdBy, IsPrivate: true, CreatedAt: s.now()}
+	s.rooms[r.ID] = r
+	return r
+}
+
+func (s *Store) addMemberLocked(roomID, userID uuid.UUID, role string, lastRead int64) {
+	if s.members[roomID] == nil {
+		s.members[roomID] = make(map[uuid.UUID]*member)
+	}
+	if _, ok := s.members[roomID][userID]; ok {
+		return
+	}
+	s.members[roomID][userID] = &member{role: role, joinedAt: s.now(), lastRead: lastRead, lastDelivered: lastRead}
+	s.recordEventLocked(roomID, "member_joined", userID, nil, map[string]string{"role": role})
+}
+
+func (s *Store) joinRoomLocked(roomID, userID uuid.UUID) {
+	var latest int64
+	for _, m := range s.messages {
+		if m.RoomID == roomID && m.ID > latest {
+			latest = m.ID
+		}
+	}
+	s.addMemberLocked(roomID, userID, "member", latest)
+}
+
+func (s *Store) deleteRoomLocked(roomID uuid.UUID) {
+	delete(s.rooms, roomID)
+	delete(s.members, roomID)
+	delete(s.direct, roomID)
+	delete(s.channels, roomID)
+	delete(s.roomEvents, roomID)
+	delete(s.transfers, roomID)
+	delete(s.wordMasks, roomID)
+	delete(s.unlisted, roomID)
+	delete(s.embeds, roomID)
+	s.automations = slices.DeleteFunc(s.automations, func(a *db.Automation) bool { return a.RoomID == roomID })
+	s.repoLinks = slices.DeleteFunc(s.repoLinks, func(l *db.RepoLink) bool { return l.RoomID == roomID })
+	s.monitors = slices.DeleteFunc(s.monitors, func(m *db.UptimeMonitor) bool { return m.RoomID == roomID })
+	delete(s.broadcast, roomID)
+	delete(s.roomSubs, roomID)
+	delete(s.welcomes, roomID)
+	kept := s.messages[:0]
+	for _, m := range s.messages {
+		if m.RoomID != roomID {
+			kept = append(kept, m)
+		}
+	}
+	s.messages = kept
+	links := s.inviteLinks[:0]
+	for _, l := range s.inviteLinks {
+		if l.roomID != roomID {
+			links = append(links, l)
+		}
+	}
+	s.inviteLinks = links
+}
+
+func (s *Store) canManageGroupLocked(g *group, userID uuid.UUID) bool {
+	if g.createdBy == userID {
+		return true
+	}
+	for roomID, ch := range s.channels {
+		if ch.groupID != g.id {
+			continue
+		}
+		if m := s.members[roomID][userID]; m != nil && m.role == "admin" {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) roomForMemberLocked(r *db.Room, userID uuid.UUID, m *member) db.Room {
+	out := *r
+	out.MyRole = m.role
+	out.CanManage = m.role == "admin"
+	out.UnreadCount, out.FirstUnreadMessageID = s.unreadLocked(r.ID, userID, m)
+	return out
+}
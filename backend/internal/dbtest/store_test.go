@@ -0,0 +1,122 @@
+package dbtest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/dbtest"
+
+	"github.com/google/uuid"
+)
+
+func TestCreateUserRejectsDuplicates(t *testing.T) {
+	ctx := context.Background()
+	store := dbtest.New()
+	if _, err := store.CreateUser(ctx, "ann@example.com", "ann", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.CreateUser(ctx, "ann@example.com", "other", ""); !errors.Is(err, dbtest.ErrDuplicate) {
+		t.Fatalf("same email = %v, want ErrDuplicate", err)
+	}
+	if _, err := store.CreateUser(ctx, "other@example.com", "ann", ""); !errors.Is(err, dbtest.ErrDuplicate) {
+		t.Fatalf("same username = %v, want ErrDuplicate", err)
+	}
+	if _, err := store.GetRoomByID(ctx, uuid.New()); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("missing room = %v, want db.ErrNotFound", err)
+	}
+}
+
+func TestListMessagesBeforePagesOldestFirst(t *testing.T) {
+	ctx := context.Background()
+	store := dbtest.New()
+	u, err := store.CreateUser(ctx, "ann@example.com", "ann", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	room, err := store.CreateRoom(ctx, "general", u.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := store.CreateRoom(ctx, "random", u.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	for _, content := range []string{"one", "two", "three", "four", "five"} {
+		m, err := store.SaveMessage(ctx, room.ID, u.ID, content, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, m.ID)
+		if _, err := store.SaveMessage(ctx, other.ID, u.ID, "elsewhere", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	latest, err := store.ListMessages(ctx, room.ID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(latest) != 2 || latest[0].ID != ids[3] || latest[1].ID != ids[4] {
+		t.Fatalf("latest page = %v, want the last two messages oldest first", latest)
+	}
+	if latest[0].Username != "ann" {
+		t.Fatalf("username = %q, want the author's", latest[0].Username)
+	}
+
+	older, err := store.ListMessagesBefore(ctx, room.ID, latest[0].ID, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(older) != 3 || older[0].ID != ids[0] || older[2].ID != ids[2] {
+		t.Fatalf("older page = %v, want the first three messages oldest first", older)
+	}
+}
+
+func TestLeaveRoomMembership(t *testing.T) {
+	ctx := context.Background()
+	store := dbtest.New()
+	owner, err := store.CreateUser(ctx, "owner@example.com", "owner", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	member, err := store.CreateUser(ctx, "member@example.com", "member", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	room, err := store.CreateRoom(ctx, "general", owner.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.LeaveRoom(ctx, room.ID, member.ID); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("non-member leave = %v, want db.ErrNotFound", err)
+	}
+
+	if err := store.JoinRoom(ctx, room.ID, member.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.SaveMessage(ctx, room.ID, owner.ID, "hello", nil); err != nil {
+		t.Fatal(err)
+	}
+	if count, first, err := store.GetUnreadState(ctx, room.ID, member.ID); err != nil || count != 1 || first == nil {
+		t.Fatalf("unread = %d %v %v, want one unread message", count, first, err)
+	}
+	if count, _, err := store.GetUnreadState(ctx, room.ID, owner.ID); err != nil || count != 0 {
+		t.Fatalf("author unread = %d %v, want own messages not counted", count, err)
+	}
+
+	if err := store.LeaveRoom(ctx, room.ID, member.ID); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := store.IsRoomMember(ctx, room.ID, member.ID); ok {
+		t.Fatal("member is still in the room after leaving")
+	}
+	if err := store.LeaveRoom(ctx, room.ID, owner.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetRoomByID(ctx, room.ID); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("room after the last member left = %v, want db.ErrNotFound", err)
+	}
+}
@@ -0,0 +1,109 @@
+package dbtest
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+// profileUpdatedAt mirrors users.profile_updated_at, which starts at
+// created_at.
+func (u *user) profileUpdatedAt() time.Time {
+	if u.profileAt.IsZero() {
+		return u.CreatedAt
+	}
+	return u.profileAt
+}
+
+func (s *Store) Sync(_ context.Context, userID uuid.UUID, since time.Time, perRoom int) (db.SyncDelta, error) {
+	if perRoom <= 0 || perRoom > 100 {
+		perRoom = 20
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delta := db.SyncDelta{JoinedRooms: []uuid.UUID{}, Rooms: []db.SyncRoom{}, Profiles: []db.SyncProfile{}}
+
+	shared := map[uuid.UUID]bool{userID: true}
+	for roomID, members := range s.members {
+		if _, ok := members[userID]; !ok {
+			continue
+		}
+		for id := range members {
+			shared[id] = true
+		}
+		delta.JoinedRooms = append(delta.JoinedRooms, roomID)
+	}
+	sort.Slice(delta.JoinedRooms, func(i, j int) bool { return delta.JoinedRooms[i].String() < delta.JoinedRooms[j].String() })
+
+	for _, roomID := range delta.JoinedRooms {
+		events := s.roomEvents[roomID]
+		room := db.SyncRoom{RoomID: roomID, Messages: []db.Message{}, Edited: []db.SyncEdit{}, DeletedMessageIDs: []int64{}, Members: []db.SyncMemberChange{}, LatestSeq: int64(len(events))}
+		changed := false
+		seen := map[uuid.UUID]int{}
+		for _, e := range events {
+			if !e.CreatedAt.After(since) {
+				continue
+			}
+			changed = true
+			switch e.Type {
+			case "message_deleted":
+				room.DeletedMessageIDs = append(room.DeletedMessageIDs, *e.MessageID)
+			case "member_joined", "member_left", "member_role_changed":
+				var data struct {
+					Role string `json:"role"`
+				}
+				_ = json.Unmarshal(e.Data, &data)
+				change := db.SyncMemberChange{UserID: *e.UserID, Change: e.Type[len("member_"):], Role: data.Role}
+				if u, ok := s.users[*e.UserID]; ok {
+					change.Username = u.Username
+				}
+				if i, ok := seen[*e.UserID]; ok {
+					room.Members[i] = change
+				} else {
+					seen[*e.UserID] = len(room.Members)
+					room.Members = append(room.Members, change)
+				}
+			}
+		}
+		if !changed {
+			continue
+		}
+		var msgs []db.Message
+		for _, m := range s.messages {
+			if m.RoomID != roomID || !m.CreatedAt.After(since) || (m.Shadowed && m.UserID != userID) {
+				continue
+			}
+			if u, ok := s.users[m.UserID]; ok {
+				m.Username, m.AvatarURL = u.Username, u.AvatarURL
+			}
+			msgs = append(msgs, m)
+		}
+		sort.Slice(msgs, func(i, j int) bool { return msgs[i].ID < msgs[j].ID })
+		if len(msgs) > perRoom {
+			msgs = msgs[len(msgs)-perRoom:]
+			room.Limited = true
+		}
+		room.Messages = append(room.Messages, msgs...)
+		delta.Rooms = append(delta.Rooms, room)
+	}
+
+	for pair := range s.friendships {
+		if pair[0] == userID {
+			shared[pair[1]] = true
+		}
+	}
+	for id := range shared {
+		u, ok := s.users[id]
+		if !ok || !u.profileUpdatedAt().After(since) {
+			continue
+		}
+		delta.Profiles = append(delta.Profiles, db.SyncProfile{ID: id, Username: u.Username, AvatarURL: u.AvatarURL, UpdatedAt: u.profileUpdatedAt()})
+	}
+	sort.Slice(delta.Profiles, func(i, j int) bool { return delta.Profiles[i].UpdatedAt.Before(delta.Profiles[j].UpdatedAt) })
+	return delta, nil
+}
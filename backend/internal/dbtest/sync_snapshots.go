@@ -0,0 +1,86 @@
+package dbtest
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+type syncSnapshot struct {
+	userID    uuid.UUID
+	seqs      map[uuid.UUID]int64
+	createdAt time.Time
+}
+
+func (s *Store) CreateSyncSnapshot(_ context.Context, token string, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.snapshots[token]; ok {
+		return ErrDuplicate
+	}
+	seqs := map[uuid.UUID]int64{}
+	for roomID, members := range s.members {
+		if _, ok := members[userID]; ok {
+			seqs[roomID] = int64(len(s.roomEvents[roomID]))
+		}
+	}
+	s.snapshots[token] = syncSnapshot{userID: userID, seqs: seqs, createdAt: s.now()}
+	return nil
+}
+
+func (s *Store) GetSyncSnapshot(_ context.Context, token string, userID uuid.UUID) (map[uuid.UUID]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap, ok := s.snapshots[token]
+	if !ok || snap.userID != userID || !snap.createdAt.After(s.now().Add(-db.SyncSnapshotTTL)) {
+		return nil, db.ErrNotFound
+	}
+	seqs := make(map[uuid.UUID]int64, len(snap.seqs))
+	for roomID, seq := range snap.seqs {
+		seqs[roomID] = seq
+	}
+	return seqs, nil
+}
+
+func (s *Store) DeleteExpiredSyncSnapshots(_ context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for token, snap := range s.snapshots {
+		if snap.createdAt.Before(s.now().Add(-db.SyncSnapshotTTL)) {
+			delete(s.snapshots, token)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *Store) ListMessagesChangedSince(_ context.Context, roomID uuid.UUID, seq int64, limit int) ([]db.Message, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := map[int64]bool{}
+	for _, e := range s.roomEvents[roomID] {
+		if e.Seq > seq && e.MessageID != nil && (e.Type == "message_created" || e.Type == "message_edited") {
+			changed[*e.MessageID] = true
+		}
+	}
+	out := []db.Message{}
+	for _, m := range s.messages {
+		if m.RoomID != roomID || !changed[m.ID] {
+			continue
+		}
+		if u, ok := s.users[m.UserID]; ok {
+			m.Username, m.AvatarURL = u.Username, u.AvatarURL
+		}
+		out = append(out, m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	if len(out) > limit {
+		return out[:limit], true, nil
+	}
+	return out, false, nil
+}
@@ -0,0 +1,26 @@
+package dbtest
+
+import (
+	"context"
+
+	"talkie/backend/internal/db"
+)
+
+// The fake does not keep reference counts; RefCount is always 0.
+
+func (s *Store) ReuseUploadBlob(_ context.Context, location, sha256 string) (db.UploadBlob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.blobs[location+" "+sha256]
+	if !ok {
+		return db.UploadBlob{}, db.ErrNotFound
+	}
+	return b, nil
+}
+
+func (s *Store) SaveUploadBlob(_ context.Context, b db.UploadBlob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[b.Location+" "+b.SHA256] = b
+	return nil
+}
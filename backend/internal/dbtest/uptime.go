@@ -0,0 +1,87 @@
+package dbtest
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"talkie/backend/internal/db"
+)
+
+func (s *Store) ListUptimeMonitors(_ context.Context) ([]db.UptimeMonitor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []db.UptimeMonitor{}
+	for _, m := range s.monitors {
+		out = append(out, *m)
+	}
+	return out, nil
+}
+
+func (s *Store) ListPublicUptimeMonitors(_ context.Context) ([]db.UptimeMonitor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []db.UptimeMonitor{}
+	for _, m := range s.monitors {
+		if m.Public {
+			out = append(out, *m)
+		}
+	}
+	slices.SortStableFunc(out, func(a, b db.UptimeMonitor) int { return strings.Compare(a.Name, b.Name) })
+	return out, nil
+}
+
+func (s *Store) GetUptimeMonitor(_ context.Context, id int64) (db.UptimeMonitor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range s.monitors {
+		if m.ID == id {
+			return *m, nil
+		}
+	}
+	return db.UptimeMonitor{}, db.ErrNotFound
+}
+
+func (s *Store) CreateUptimeMonitor(_ context.Context, m db.UptimeMonitor) (db.UptimeMonitor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[m.RoomID]; !ok {
+		return db.UptimeMonitor{}, db.ErrNotFound
+	}
+	s.nextMonitorID++
+	m.ID = s.nextMonitorID
+	m.State = db.UptimeUnknown
+	m.CreatedAt = s.now()
+	stored := m
+	s.monitors = append(s.monitors, &stored)
+	return m, nil
+}
+
+func (s *Store) UpdateUptimeMonitor(_ context.Context, m db.UptimeMonitor) (db.UptimeMonitor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.monitors {
+		if existing.ID != m.ID {
+			continue
+		}
+		if existing.URL != m.URL || existing.ExpectStatus != m.ExpectStatus {
+			existing.State, existing.Failures, existing.LastCheckedAt = db.UptimeUnknown, 0, nil
+		}
+		existing.Name, existing.URL, existing.RoomID = m.Name, m.URL, m.RoomID
+		existing.IntervalS, existing.ExpectStatus, existing.Public = m.IntervalS, m.ExpectStatus, m.Public
+		existing.CreatedBy = m.CreatedBy
+		return *existing, nil
+	}
+	return db.UptimeMonitor{}, db.ErrNotFound
+}
+
+func (s *Store) DeleteUptimeMonitor(_ context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := slices.IndexFunc(s.monitors, func(m *db.UptimeMonitor) bool { return m.ID == id })
+	if i < 0 {
+		return db.ErrNotFound
+	}
+	s.monitors = slices.Delete(s.monitors, i, i+1)
+	return nil
+}
@@ -0,0 +1,43 @@
+package dbtest
+
+import (
+	"context"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) GetRoomWelcome(_ context.Context, roomID uuid.UUID) (db.RoomWelcome, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[roomID]; !ok {
+		return db.RoomWelcome{}, db.ErrNotFound
+	}
+	w, ok := s.welcomes[roomID]
+	if !ok {
+		return db.RoomWelcome{Mode: "off"}, nil
+	}
+	return w, nil
+}
+
+func (s *Store) SetRoomWelcome(_ context.Context, roomID uuid.UUID, mode, template string, senderID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[roomID]; !ok {
+		return db.ErrNotFound
+	}
+	s.welcomes[roomID] = db.RoomWelcome{Mode: mode, Template: template, SenderID: &senderID}
+	return nil
+}
+
+func (s *Store) MarkWelcomeSent(_ context.Context, roomID, userID uuid.UUID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := [2]uuid.UUID{roomID, userID}
+	if _, ok := s.welcomed[key]; ok {
+		return false, nil
+	}
+	s.welcomed[key] = struct{}{}
+	return true, nil
+}
@@ -0,0 +1,35 @@
+package dbtest
+
+import (
+	"context"
+	"slices"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+func (s *Store) GetRoomWordMask(_ context.Context, roomID uuid.UUID) (db.WordMask, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[roomID]; !ok {
+		return db.WordMask{}, db.ErrNotFound
+	}
+	wm := s.wordMasks[roomID]
+	wm.Words = slices.Clone(wm.Words)
+	if wm.Words == nil {
+		wm.Words = []string{}
+	}
+	return wm, nil
+}
+
+func (s *Store) SetRoomWordMask(_ context.Context, roomID uuid.UUID, wm db.WordMask) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.rooms[roomID]; !ok {
+		return db.ErrNotFound
+	}
+	wm.Words = slices.Clone(wm.Words)
+	s.wordMasks[roomID] = wm
+	return nil
+}
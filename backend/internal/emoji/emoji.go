@@ -0,0 +1,137 @@
+// Package emoji expands :shortcode: emoji names, as typed in Slack, GitHub
+// and Discord, to the Unicode characters they stand for, so every client
+// shows the same emoji whatever its own picker knows.
+package emoji
+
+import "strings"
+
+// shortcodes maps the common shortcode names, and their usual aliases, to
+// emoji. Names not listed are left as typed.
+var shortcodes = map[string]string{
+	// Faces
+	"smile": "😄", "smiley": "😃", "grinning": "😀", "grin": "😁", "laughing": "😆", "satisfied": "😆",
+	"sweat_smile": "😅", "joy": "😂", "rofl": "🤣", "slightly_smiling_face": "🙂", "upside_down_face": "🙃",
+	"wink": "😉", "blush": "😊", "innocent": "😇", "heart_eyes": "😍", "star_struck": "🤩",
+	"kissing_heart": "😘", "yum": "😋", "stuck_out_tongue": "😛", "stuck_out_tongue_winking_eye": "😜",
+	"zany_face": "🤪", "money_mouth_face": "🤑", "hugs": "🤗", "hugging_face": "🤗", "thinking": "🤔",
+	"thinking_face": "🤔", "shushing_face": "🤫", "zipper_mouth_face": "🤐", "neutral_face": "😐",
+	"expressionless": "😑", "no_mouth": "😶", "smirk": "😏", "unamused": "😒", "roll_eyes": "🙄",
+	"face_with_rolling_eyes": "🙄", "grimacing": "😬", "relieved": "😌", "pensive": "😔", "sleepy": "😪",
+	"sleeping": "😴", "mask": "😷", "nerd_face": "🤓", "sunglasses": "😎", "confused": "😕",
+	"worried": "😟", "frowning_face": "☹️", "open_mouth": "😮", "astonished": "😲", "flushed": "😳",
+	"pleading_face": "🥺", "cry": "😢", "sob": "😭", "scream": "😱", "confounded": "😖",
+	"disappointed": "😞", "sweat": "😓", "weary": "😩", "tired_face": "😫", "yawning_face": "🥱",
+	"triumph": "😤", "rage": "😡", "pout": "😡", "angry": "😠", "skull": "💀", "poop": "💩",
+	"hankey": "💩", "clown_face": "🤡", "ghost": "👻", "alien": "👽", "robot": "🤖", "see_no_evil": "🙈",
+	"hear_no_evil": "🙉", "speak_no_evil": "🙊", "partying_face": "🥳", "exploding_head": "🤯",
+	"cold_sweat": "😰", "face_palm": "🤦", "facepalm": "🤦", "shrug": "🤷",
+
+	// Hands and people
+	"+1": "👍", "thumbsup": "👍", "-1": "👎", "thumbsdown": "👎", "ok_hand": "👌", "wave": "👋",
+	"clap": "👏", "raised_hands": "🙌", "pray": "🙏", "muscle": "💪", "point_up": "☝️",
+	"point_down": "👇", "point_left": "👈", "point_right": "👉", "v": "✌️", "crossed_fingers": "🤞",
+	"fingers_crossed": "🤞", "metal": "🤘", "call_me_hand": "🤙", "handshake": "🤝", "fist": "✊",
+	"punch": "👊", "facepunch": "👊", "raised_hand": "✋", "hand": "✋", "writing_hand": "✍️",
+	"eyes": "👀", "eye": "👁️", "brain": "🧠", "tongue": "👅", "lips": "👄",
+
+	// Hearts and symbols
+	"heart": "❤️", "orange_heart": "🧡", "yellow_heart": "💛", "green_heart": "💚", "blue_heart": "💙",
+	"purple_heart": "💜", "black_heart": "🖤", "white_heart": "🤍", "broken_heart": "💔",
+	"two_hearts": "💕", "sparkling_heart": "💖", "fire": "🔥", "sparkles": "✨", "star": "⭐",
+	"star2": "🌟", "zap": "⚡", "boom": "💥", "collision": "💥", "100": "💯", "check": "✔️",
+	"heavy_check_mark": "✔️", "white_check_mark": "✅", "x": "❌", "warning": "⚠️", "no_entry": "⛔",
+	"question": "❓", "exclamation": "❗", "bangbang": "‼️", "interrobang": "⁉️", "zzz": "💤",
+	"speech_balloon": "💬", "thought_balloon": "💭", "bulb": "💡", "bell": "🔔", "lock": "🔒",
+	"unlock": "🔓", "key": "🔑", "link": "🔗", "pushpin": "📌", "paperclip": "📎", "memo": "📝",
+	"pencil": "📝", "calendar": "📅", "chart_with_upwards_trend": "📈", "chart_with_downwards_trend": "📉",
+	"hourglass": "⌛", "alarm_clock": "⏰", "stopwatch": "⏱️", "recycle": "♻️", "copyright": "©️",
+	"registered": "®️", "tm": "™️", "arrow_up": "⬆️", "arrow_down": "⬇️", "arrow_left": "⬅️",
+	"arrow_right": "➡️", "heavy_plus_sign": "➕", "heavy_minus_sign": "➖", "infinity": "♾️",
+
+	// Celebration and objects
+	"tada": "🎉", "confetti_ball": "🎊", "balloon": "🎈", "gift": "🎁", "trophy": "🏆", "medal": "🏅",
+	"crown": "👑", "gem": "💎", "moneybag": "💰", "dollar": "💵", "rocket": "🚀", "airplane": "✈️",
+	"car": "🚗", "bike": "🚲", "ship": "🚢", "house": "🏠", "office": "🏢", "computer": "💻",
+	"keyboard": "⌨️", "iphone": "📱", "phone": "☎️", "telephone": "☎️", "email": "📧", "envelope": "✉️",
+	"inbox_tray": "📥", "outbox_tray": "📤", "package": "📦", "books": "📚", "book": "📖",
+	"camera": "📷", "movie_camera": "🎥", "tv": "📺", "headphones": "🎧", "microphone": "🎤",
+	"musical_note": "🎵", "notes": "🎶", "guitar": "🎸", "video_game": "🎮", "game_die": "🎲",
+	"dart": "🎯", "bug": "🐛", "wrench": "🔧", "hammer": "🔨", "gear": "⚙️", "mag": "🔍",
+	"shield": "🛡️", "construction": "🚧", "rotating_light": "🚨", "checkered_flag": "🏁",
+	"triangular_flag_on_post": "🚩", "white_flag": "🏳️", "rainbow_flag": "🏳️‍🌈",
+
+	// Nature, food and weather
+	"sunny": "☀️", "cloud": "☁️", "umbrella": "☔", "snowflake": "❄️", "rainbow": "🌈",
+	"crescent_moon": "🌙", "earth_africa": "🌍", "earth_americas": "🌎", "earth_asia": "🌏",
+	"seedling": "🌱", "evergreen_tree": "🌲", "deciduous_tree": "🌳", "cactus": "🌵", "rose": "🌹",
+	"sunflower": "🌻", "tulip": "🌷", "cherry_blossom": "🌸", "four_leaf_clover": "🍀",
+	"dog": "🐶", "cat": "🐱", "mouse": "🐭", "rabbit": "🐰", "fox_face": "🦊", "bear": "🐻",
+	"panda_face": "🐼", "koala": "🐨", "tiger": "🐯", "lion": "🦁", "cow": "🐮", "pig": "🐷",
+	"frog": "🐸", "monkey": "🐒", "chicken": "🐔", "penguin": "🐧", "bird": "🐦", "owl": "🦉",
+	"unicorn": "🦄", "bee": "🐝", "butterfly": "🦋", "snail": "🐌", "turtle": "🐢", "snake": "🐍",
+	"octopus": "🐙", "fish": "🐟", "whale": "🐳", "dolphin": "🐬", "shark": "🦈", "crab": "🦀",
+	"apple": "🍎", "banana": "🍌", "grapes": "🍇", "watermelon": "🍉", "strawberry": "🍓",
+	"peach": "🍑", "cherries": "🍒", "lemon": "🍋", "avocado": "🥑", "eggplant": "🍆", "carrot": "🥕",
+	"corn": "🌽", "hot_pepper": "🌶️", "bread": "🍞", "cheese": "🧀", "egg": "🥚", "bacon": "🥓",
+	"hamburger": "🍔", "fries": "🍟", "pizza": "🍕", "hotdog": "🌭", "taco": "🌮", "burrito": "🌯",
+	"sushi": "🍣", "ramen": "🍜", "spaghetti": "🍝", "rice": "🍚", "cookie": "🍪", "cake": "🍰",
+	"birthday": "🎂", "doughnut": "🍩", "ice_cream": "🍨", "chocolate_bar": "🍫", "candy": "🍬",
+	"popcorn": "🍿", "coffee": "☕", "tea": "🍵", "beer": "🍺", "beers": "🍻", "wine_glass": "🍷",
+	"cocktail": "🍸", "champagne": "🍾", "clinking_glasses": "🥂", "cup_with_straw": "🥤",
+}
+
+// Lookup returns the emoji for a shortcode name, without colons.
+func Lookup(name string) (string, bool) {
+	e, ok := shortcodes[strings.ToLower(name)]
+	return e, ok
+}
+
+// Expand replaces every known :name: in text with its emoji. Unknown
+// names, and anything inside `code` spans, are left as typed. A colon that
+// closes one shortcode can not open the next, so "::smile::" keeps its
+// outer colons.
+func Expand(text string) string {
+	if strings.Count(text, ":") < 2 {
+		return text
+	}
+	var b strings.Builder
+	b.Grow(len(text))
+	inCode := false
+	for i := 0; i < len(text); {
+		c := text[i]
+		if c == '`' {
+			inCode = !inCode
+		}
+		if c != ':' || inCode {
+			b.WriteByte(c)
+			i++
+			continue
+		}
+		end := strings.IndexByte(text[i+1:], ':')
+		if end > 0 && validName(text[i+1:i+1+end]) {
+			if e, ok := Lookup(text[i+1 : i+1+end]); ok {
+				b.WriteString(e)
+				i += end + 2
+				continue
+			}
+		}
+		b.WriteByte(c)
+		i++
+	}
+	return b.String()
+}
+
+// validName reports whether s can be a shortcode name: letters, digits,
+// '_', '+' and '-', and no longer than any name in the table.
+func validName(s string) bool {
+	if len(s) > 32 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_' || c == '+' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,221 @@
+// Package errreport sends panics to a Sentry-compatible error tracker.
+package errreport
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	sendTimeout = 10 * time.Second
+	// maxInFlight bounds the reports being sent at once; a panic storm
+	// drops reports beyond it rather than piling up goroutines.
+	maxInFlight = 8
+)
+
+// Reporter posts events to the envelope endpoint of the project a DSN
+// names. A nil Reporter reports nothing.
+type Reporter struct {
+	dsn         string
+	endpoint    string
+	auth        string
+	environment string
+	serverName  string
+	client      *http.Client
+	inFlight    chan struct{}
+}
+
+// New returns nil when dsn is empty. The DSN is the usual
+// https://<key>@<host>/<project>.
+func New(dsn, environment string) (*Reporter, error) {
+	if dsn == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil || u.User.Username() == "" || u.Host == "" {
+		return nil, fmt.Errorf("error reporting DSN must look like https://<key>@<host>/<project>")
+	}
+	// Self-hosted trackers may live under a path: the project is its last
+	// element.
+	path := strings.Trim(u.Path, "/")
+	i := strings.LastIndex(path, "/")
+	prefix, project := path[:max(i, 0)], path[i+1:]
+	if project == "" {
+		return nil, fmt.Errorf("error reporting DSN has no project")
+	}
+	endpoint := u.Scheme + "://" + u.Host + "/"
+	if prefix != "" {
+		endpoint += prefix + "/"
+	}
+	host, _ := os.Hostname()
+	return &Reporter{
+		dsn:         dsn,
+		endpoint:    endpoint + "api/" + project + "/envelope/",
+		auth:        "Sentry sentry_version=7, sentry_client=talkie/1.0, sentry_key=" + u.User.Username(),
+		environment: environment,
+		serverName:  host,
+		client:      &http.Client{Timeout: sendTimeout},
+		inFlight:    make(chan struct{}, maxInFlight),
+	}, nil
+}
+
+type frame struct {
+	Function string `json:"function"`
+	Module   string `json:"module,omitempty"`
+	Filename string `json:"filename"`
+	AbsPath  string `json:"abs_path"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+type event struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   time.Time         `json:"timestamp"`
+	Platform    string            `json:"platform"`
+	Level       string            `json:"level"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Exception   struct {
+		Values []exception `json:"values"`
+	} `json:"exception"`
+}
+
+type exception struct {
+	Type      string `json:"type"`
+	Value     string `json:"value"`
+	Mechanism struct {
+		Type    string `json:"type"`
+		Handled bool   `json:"handled"`
+	} `json:"mechanism"`
+	Stacktrace struct {
+		Frames []frame `json:"frames"`
+	} `json:"stacktrace"`
+}
+
+// Panic reports v, the value of a recovered panic, with the stack it was
+// raised on. It must be called from the deferred function that recovered,
+// while that stack is still there. The report is sent in the background.
+func (r *Reporter) Panic(v any, tags map[string]string) {
+	if r == nil {
+		return
+	}
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	ev := event{
+		EventID:     hex.EncodeToString(id),
+		Timestamp:   time.Now().UTC(),
+		Platform:    "go",
+		Level:       "fatal",
+		ServerName:  r.serverName,
+		Environment: r.environment,
+		Tags:        tags,
+	}
+	ex := exception{Type: fmt.Sprintf("%T", v), Value: fmt.Sprint(v)}
+	ex.Mechanism.Type = "panic"
+	ex.Stacktrace.Frames = panicFrames()
+	ev.Exception.Values = []exception{ex}
+
+	select {
+	case r.inFlight <- struct{}{}:
+	default:
+		log.Printf("error reporting: dropped panic report, %d already being sent", maxInFlight)
+		return
+	}
+	go func() {
+		defer func() { <-r.inFlight }()
+		if err := r.send(ev); err != nil {
+			log.Printf("error reporting: send panic report failed: %v", err)
+		}
+	}()
+}
+
+// panicFrames is the stack from the goroutine's entry to the panic,
+// outermost first as trackers expect.
+func panicFrames() []frame {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var out []frame
+	for {
+		f, more := frames.Next()
+		if f.Function == "runtime.gopanic" {
+			// Everything so far is the recovery itself.
+			out = out[:0]
+		} else {
+			module, function := splitFunction(f.Function)
+			out = append(out, frame{
+				Function: function,
+				Module:   module,
+				Filename: f.File,
+				AbsPath:  f.File,
+				Lineno:   f.Line,
+				InApp:    strings.HasPrefix(f.Function, "talkie/"),
+			})
+		}
+		if !more {
+			break
+		}
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out
+}
+
+// splitFunction splits a runtime function name such as
+// talkie/backend/internal/ws.(*Client).ReadPump into its package path and
+// the rest.
+func splitFunction(name string) (string, string) {
+	slash := strings.LastIndex(name, "/")
+	dot := strings.Index(name[slash+1:], ".")
+	if dot < 0 {
+		return "", name
+	}
+	return name[:slash+1+dot], name[slash+2+dot:]
+}
+
+func (r *Reporter) send(ev event) error {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	header, _ := json.Marshal(map[string]any{"event_id": ev.EventID, "sent_at": time.Now().UTC(), "dsn": r.dsn})
+	item, _ := json.Marshal(map[string]any{"type": "event", "length": len(payload)})
+	var body bytes.Buffer
+	for _, line := range [][]byte{header, item, payload} {
+		body.Write(line)
+		body.WriteByte('\n')
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", r.auth)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("error tracker returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package events
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+)
+
+// Breaking lists the ways next would break a consumer written against
+// prev: a property removed or no longer required, a value that may now be
+// null or of another type, a changed format or constant. Adding properties
+// is not breaking, since consumers ignore those they do not know.
+func Breaking(prev, next Schema) []string {
+	c := &comparer{prev: prev, next: next, seen: map[[2]string]bool{}}
+	c.compare(prev, next, "")
+	return c.issues
+}
+
+type comparer struct {
+	prev, next Schema
+	seen       map[[2]string]bool
+	issues     []string
+}
+
+func (c *comparer) report(path, format string, args ...any) {
+	c.issues = append(c.issues, where(path)+": "+fmt.Sprintf(format, args...))
+}
+
+func (c *comparer) compare(prev, next map[string]any, path string) {
+	prev, prevRef, prevNull, err := unwrap(c.prev, prev)
+	if err != nil {
+		c.report(path, "%v", err)
+		return
+	}
+	next, nextRef, nextNull, err := unwrap(c.next, next)
+	if err != nil {
+		c.report(path, "%v", err)
+		return
+	}
+	if prevRef != "" && nextRef != "" {
+		// Recursive types are compared once.
+		key := [2]string{prevRef, nextRef}
+		if c.seen[key] {
+			return
+		}
+		c.seen[key] = true
+	}
+	if nextNull && !prevNull {
+		c.report(path, "may now be null")
+	}
+	if pc, ok := prev["const"]; ok && !reflect.DeepEqual(pc, next["const"]) {
+		c.report(path, "constant changed from %v to %v", pc, next["const"])
+	}
+	if pf, _ := prev["format"].(string); pf != "" && pf != next["format"] {
+		c.report(path, "format changed from %s", pf)
+	}
+	prevTypes, nextTypes := typeList(prev), typeList(next)
+	if len(prevTypes) > 0 {
+		if len(nextTypes) == 0 {
+			c.report(path, "no longer restricted to %v", prevTypes)
+		}
+		for _, t := range nextTypes {
+			if !slices.Contains(prevTypes, t) && !(t == "integer" && slices.Contains(prevTypes, "number")) {
+				c.report(path, "may now be %s", t)
+			}
+		}
+	}
+
+	prevProps, _ := prev["properties"].(map[string]any)
+	nextProps, _ := next["properties"].(map[string]any)
+	nextRequired := asList(next["required"])
+	for _, name := range sortedKeys(prevProps) {
+		p := join(path, name)
+		np, ok := nextProps[name].(map[string]any)
+		if !ok {
+			c.report(p, "removed")
+			continue
+		}
+		if slices.Contains(asList(prev["required"]), name) && !slices.Contains(nextRequired, name) {
+			c.report(p, "no longer required")
+		}
+		c.compare(prevProps[name].(map[string]any), np, p)
+	}
+	if pi, ok := prev["items"].(map[string]any); ok {
+		if ni, ok := next["items"].(map[string]any); ok {
+			c.compare(pi, ni, path+"[]")
+		}
+	}
+	if pa, ok := prev["additionalProperties"].(map[string]any); ok {
+		if na, ok := next["additionalProperties"].(map[string]any); ok {
+			c.compare(pa, na, path+".*")
+		}
+	}
+}
+
+// unwrap resolves a $ref, returning it, and splits the "anyOf: [schema,
+// null]" Generate writes for nullable fields into the schema and whether it
+// may be null.
+func unwrap(root Schema, s map[string]any) (map[string]any, string, bool, error) {
+	nullable := false
+	if anyOf, ok := s["anyOf"].([]any); ok && len(anyOf) == 2 {
+		if null, _ := anyOf[1].(map[string]any); reflect.DeepEqual(null, map[string]any{"type": "null"}) {
+			s, nullable = anyOf[0].(map[string]any), true
+		}
+	}
+	ref, _ := s["$ref"].(string)
+	if ref != "" {
+		def, err := resolve(root, ref)
+		if err != nil {
+			return nil, "", false, err
+		}
+		s = def
+	}
+	return s, ref, nullable, nil
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,179 @@
+// Package events is the registry of every structured event Talkie emits:
+// the events sent over WebSockets and relayed between instances, and the
+// payloads posted to slash command webhooks. Each has a Go type, which is
+// what code builds, and a versioned JSON Schema derived from that type by
+// reflection. The schemas are committed under backend/schemas/events by
+// cmd/eventschema, which also refuses a change that would break consumers
+// of an existing version.
+//
+// Schemas are open: a consumer must ignore properties it does not know, so
+// adding an optional field is not a breaking change. Removing a field,
+// making one optional, or changing its type is, and needs a new version.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"talkie/backend/internal/slashcmd"
+	"talkie/backend/internal/ws"
+)
+
+// Kind is where an event is sent.
+type Kind string
+
+const (
+	// Socket events go to clients over WebSockets and between instances
+	// over the broadcast backend, encoded as ws.OutgoingMessage.
+	Socket Kind = "socket"
+	// Webhook events are POSTed to slash command URLs, or are their
+	// answers.
+	Webhook Kind = "webhook"
+)
+
+// Spec describes one event.
+type Spec struct {
+	Kind Kind
+	// Name identifies the event within its kind, and names its schema
+	// file.
+	Name string
+	// Type is the value of the event's "type" property, or empty for
+	// payloads without one.
+	Type string
+	// Version is bumped whenever the event changes in a way that breaks
+	// consumers of the previous version.
+	Version int
+	// Proto is a value of the event's Go type.
+	Proto any
+}
+
+func socket(e ws.Event, version int) Spec {
+	return Spec{Kind: Socket, Name: e.EventType(), Type: e.EventType(), Version: version, Proto: e}
+}
+
+// Specs lists every event.
+var Specs = []Spec{
+	socket(ws.ChatEvent{}, 1),
+	socket(ws.CallChatEvent{}, 1),
+	socket(ws.EphemeralEvent{}, 1),
+	socket(ws.MessageUpdatedEvent{}, 1),
+	socket(ws.RoomMessageEvent{}, 1),
+	socket(ws.HistoryEvent{}, 1),
+	socket(ws.ResumeEvent{}, 1),
+	socket(ws.ParticipantsEvent{}, 1),
+	socket(ws.CallParticipantsEvent{}, 1),
+	socket(ws.StateSyncEvent{}, 1),
+	socket(ws.PongEvent{}, 1),
+	socket(ws.UnreadEvent{}, 1),
+	socket(ws.DeliveryUpdateEvent{}, 1),
+	socket(ws.SpeakingEvent{}, 1),
+	socket(ws.PresenceEvent{}, 1),
+	socket(ws.PresenceStateEvent{}, 1),
+	socket(ws.RichPresenceEvent{}, 1),
+	socket(ws.NotificationEvent{}, 1),
+	socket(ws.SessionRevokedEvent{}, 1),
+	socket(ws.RoomMembershipEvent{}, 1),
+	socket(ws.MembershipRevokedEvent{}, 1),
+	socket(ws.RoomDeletedEvent{}, 1),
+	socket(ws.ErrorEvent{}, 1),
+	socket(ws.InitialStateEvent{}, 1),
+	socket(ws.BoardEvent{}, 1),
+	socket(ws.CallFeedbackRequestEvent{}, 1),
+	socket(ws.RoomInviteEvent{}, 1),
+	socket(ws.FriendRequestEvent{}, 1),
+	socket(ws.FriendRelationshipEvent{}, 1),
+	socket(ws.DMRoomEvent{}, 1),
+	socket(ws.P2PSignalEvent{}, 1),
+
+	{Kind: Webhook, Name: "command", Type: slashcmd.TypeCommand, Version: 1, Proto: slashcmd.Invocation{}},
+	{Kind: Webhook, Name: "interaction", Type: slashcmd.TypeInteraction, Version: 1, Proto: slashcmd.Interaction{}},
+	{Kind: Webhook, Name: "command_response", Version: 1, Proto: slashcmd.Response{}},
+}
+
+// File is the schema's path below the schemas directory.
+func (s Spec) File() string {
+	return fmt.Sprintf("%s/%s.v%d.json", s.Kind, s.Name, s.Version)
+}
+
+var (
+	compileOnce sync.Once
+	compiled    map[*Spec]Schema
+	socketTypes map[string]*Spec
+)
+
+func compile() {
+	compiled = make(map[*Spec]Schema, len(Specs))
+	socketTypes = make(map[string]*Spec)
+	for i := range Specs {
+		s := &Specs[i]
+		compiled[s] = Generate(*s)
+		if s.Kind == Socket {
+			socketTypes[s.Type] = s
+		}
+	}
+}
+
+// Schema returns the spec's JSON Schema.
+func (s *Spec) Schema() Schema {
+	compileOnce.Do(compile)
+	if sc, ok := compiled[s]; ok {
+		return sc
+	}
+	return Generate(*s)
+}
+
+// LookupSocket returns the socket event with the given type.
+func LookupSocket(eventType string) (*Spec, bool) {
+	compileOnce.Do(compile)
+	s, ok := socketTypes[eventType]
+	return s, ok
+}
+
+// ValidateSocketEvent checks an encoded socket event against the schema for
+// its type. Types this build does not know are let through: they come from
+// a newer instance, and clients that know them may be connected here.
+func ValidateSocketEvent(raw []byte) error {
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return err
+	}
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return fmt.Errorf("event is not an object")
+	}
+	t, _ := obj["type"].(string)
+	spec, ok := LookupSocket(t)
+	if !ok {
+		return nil
+	}
+	if err := spec.Schema().Validate(v, false); err != nil {
+		return fmt.Errorf("%s event: %w", t, err)
+	}
+	return nil
+}
+
+// Sample returns a value of the spec's Go type with every field set, for
+// checking that what the type encodes to matches its schema.
+func (s Spec) Sample() any {
+	v := reflect.New(reflect.TypeOf(s.Proto)).Elem()
+	fill(v, 0)
+	return v.Interface()
+}
+
+// Encode returns the JSON the event is sent as.
+func (s Spec) Encode(v any) ([]byte, error) {
+	if e, ok := v.(ws.Event); ok {
+		return json.Marshal(e.Envelope())
+	}
+	switch p := v.(type) {
+	case slashcmd.Invocation:
+		p.Type = s.Type
+		v = p
+	case slashcmd.Interaction:
+		p.Type = s.Type
+		v = p
+	}
+	return json.Marshal(v)
+}
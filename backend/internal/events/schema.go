@@ -0,0 +1,233 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Schema is a JSON Schema document, in the decoded form encoding/json
+// produces, so generated and committed schemas compare alike.
+type Schema map[string]any
+
+const draft = "https://json-schema.org/draft/2020-12/schema"
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	uuidType      = reflect.TypeOf(uuid.UUID{})
+	rawType       = reflect.TypeOf(json.RawMessage{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// Generate derives spec's schema from its Go type, following encoding/json:
+// fields are named by their json tags, and those without omitempty are
+// required. Named struct types other than the event's own go in $defs.
+func Generate(spec Spec) Schema {
+	g := &generator{defs: map[string]any{}, seen: map[reflect.Type]string{}}
+	root := g.object(reflect.TypeOf(spec.Proto))
+	root["$schema"] = draft
+	root["$id"] = "talkie:" + strings.TrimSuffix(spec.File(), ".json")
+	root["title"] = spec.Name
+	props := root["properties"].(map[string]any)
+	if spec.Type != "" {
+		props["type"] = map[string]any{"const": spec.Type}
+		root["required"] = appendUnique(root["required"].([]any), "type")
+	}
+	if spec.Kind == Socket {
+		// Room-wide events are numbered as they are delivered; see
+		// ws.Hub.Sequence.
+		props["seq"] = map[string]any{"type": "integer", "minimum": 0}
+	}
+	if len(g.defs) > 0 {
+		root["$defs"] = g.defs
+	}
+	return normalize(root)
+}
+
+// normalize round-trips s through JSON so it holds only the types a decoded
+// schema file does.
+func normalize(s map[string]any) Schema {
+	raw, err := json.Marshal(s)
+	if err != nil {
+		panic(err)
+	}
+	var out Schema
+	if err := json.Unmarshal(raw, &out); err != nil {
+		panic(err)
+	}
+	return out
+}
+
+type generator struct {
+	defs map[string]any
+	seen map[reflect.Type]string
+}
+
+func (g *generator) object(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	required := []any{}
+	g.fields(t, props, &required)
+	return map[string]any{"type": "object", "properties": props, "required": required}
+}
+
+func (g *generator) fields(t reflect.Type, props map[string]any, required *[]any) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			g.fields(f.Type, props, required)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s := g.schema(f.Type)
+		omitempty := strings.Contains(opts, "omitempty")
+		switch f.Type.Kind() {
+		case reflect.Pointer, reflect.Slice, reflect.Map:
+			// Without omitempty a nil pointer, slice or map is sent as
+			// null.
+			if !omitempty && f.Type != rawType {
+				s = map[string]any{"anyOf": []any{s, map[string]any{"type": "null"}}}
+			}
+		}
+		props[name] = s
+		if !omitempty {
+			*required = appendUnique(*required, name)
+		}
+	}
+}
+
+func (g *generator) schema(t reflect.Type) map[string]any {
+	switch t {
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case uuidType:
+		return map[string]any{"type": "string", "format": "uuid"}
+	case rawType:
+		return map[string]any{}
+	}
+	if t.Kind() != reflect.Pointer && t.Implements(marshalerType) {
+		panic(fmt.Sprintf("events: %s has its own JSON encoding; describe it in schema.go", t))
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schema(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Interface:
+		return map[string]any{}
+	case reflect.Struct:
+		return map[string]any{"$ref": "#/$defs/" + g.define(t)}
+	}
+	panic(fmt.Sprintf("events: no schema for %s", t))
+}
+
+// define adds struct t to $defs, once, and returns its name there.
+func (g *generator) define(t reflect.Type) string {
+	if name, ok := g.seen[t]; ok {
+		return name
+	}
+	name := t.Name()
+	if _, taken := g.defs[name]; taken || name == "" {
+		panic(fmt.Sprintf("events: cannot name %s in $defs", t))
+	}
+	g.seen[t] = name
+	g.defs[name] = nil
+	g.defs[name] = g.object(t)
+	return name
+}
+
+func appendUnique(list []any, v string) []any {
+	for _, x := range list {
+		if x == v {
+			return list
+		}
+	}
+	return append(list, v)
+}
+
+// fill sets every field of v to a non-zero value. depth stops recursive
+// types.
+func fill(v reflect.Value, depth int) {
+	switch v.Type() {
+	case timeType:
+		v.Set(reflect.ValueOf(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)))
+		return
+	case uuidType:
+		v.Set(reflect.ValueOf(uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8")))
+		return
+	case rawType:
+		v.SetBytes([]byte(`{"sample":true}`))
+		return
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString("sample")
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(1)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(1.5)
+	case reflect.Pointer:
+		if depth > 2 {
+			return
+		}
+		p := reflect.New(v.Type().Elem())
+		fill(p.Elem(), depth+1)
+		v.Set(p)
+	case reflect.Slice:
+		if depth > 2 {
+			return
+		}
+		s := reflect.MakeSlice(v.Type(), 1, 1)
+		fill(s.Index(0), depth+1)
+		v.Set(s)
+	case reflect.Map:
+		if depth > 2 {
+			return
+		}
+		m := reflect.MakeMap(v.Type())
+		k := reflect.New(v.Type().Key()).Elem()
+		e := reflect.New(v.Type().Elem()).Elem()
+		fill(k, depth+1)
+		fill(e, depth+1)
+		m.SetMapIndex(k, e)
+		v.Set(m)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				fill(v.Field(i), depth)
+			}
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package events
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Validate checks a decoded JSON value against the schema. It supports the
+// subset of JSON Schema that Generate writes. strict also rejects
+// properties the schema does not list, which is how cmd/eventschema checks
+// that an event's Go type and its encoding agree; consumers validate
+// without it.
+func (s Schema) Validate(v any, strict bool) error {
+	return validator{root: s, strict: strict}.check(s, v, "")
+}
+
+type validator struct {
+	root   Schema
+	strict bool
+}
+
+func (vd validator) check(s map[string]any, v any, path string) error {
+	if ref, ok := s["$ref"].(string); ok {
+		def, err := resolve(vd.root, ref)
+		if err != nil {
+			return err
+		}
+		return vd.check(def, v, path)
+	}
+	if anyOf, ok := s["anyOf"].([]any); ok {
+		var first error
+		for _, alt := range anyOf {
+			err := vd.check(alt.(map[string]any), v, path)
+			if err == nil {
+				return nil
+			}
+			if first == nil {
+				first = err
+			}
+		}
+		return first
+	}
+	if c, ok := s["const"]; ok && !reflect.DeepEqual(c, v) {
+		return fmt.Errorf("%s: must be %v", where(path), c)
+	}
+	if types := typeList(s); len(types) > 0 && !matchesType(types, v) {
+		return fmt.Errorf("%s: must be %s", where(path), strings.Join(types, " or "))
+	}
+	switch format, _ := s["format"].(string); format {
+	case "date-time":
+		if str, ok := v.(string); ok {
+			if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+				return fmt.Errorf("%s: must be an RFC 3339 time", where(path))
+			}
+		}
+	case "uuid":
+		if str, ok := v.(string); ok {
+			if _, err := uuid.Parse(str); err != nil {
+				return fmt.Errorf("%s: must be a UUID", where(path))
+			}
+		}
+	}
+	if minimum, ok := s["minimum"].(float64); ok {
+		if n, ok := v.(float64); ok && n < minimum {
+			return fmt.Errorf("%s: must be at least %v", where(path), minimum)
+		}
+	}
+	switch val := v.(type) {
+	case map[string]any:
+		props, _ := s["properties"].(map[string]any)
+		for _, r := range asList(s["required"]) {
+			if _, ok := val[r]; !ok {
+				return fmt.Errorf("%s: missing required property", where(join(path, r)))
+			}
+		}
+		extra, _ := s["additionalProperties"].(map[string]any)
+		for k, item := range val {
+			if ps, ok := props[k].(map[string]any); ok {
+				if err := vd.check(ps, item, join(path, k)); err != nil {
+					return err
+				}
+				continue
+			}
+			if extra != nil {
+				if err := vd.check(extra, item, join(path, k)); err != nil {
+					return err
+				}
+				continue
+			}
+			if vd.strict && props != nil {
+				return fmt.Errorf("%s: not in the schema", where(join(path, k)))
+			}
+		}
+	case []any:
+		if items, ok := s["items"].(map[string]any); ok {
+			for i, item := range val {
+				if err := vd.check(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func resolve(root Schema, ref string) (map[string]any, error) {
+	name, ok := strings.CutPrefix(ref, "#/$defs/")
+	if !ok {
+		return nil, fmt.Errorf("unsupported $ref %q", ref)
+	}
+	defs, _ := root["$defs"].(map[string]any)
+	def, ok := defs[name].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("unknown $ref %q", ref)
+	}
+	return def, nil
+}
+
+func typeList(s map[string]any) []string {
+	switch t := s["type"].(type) {
+	case string:
+		return []string{t}
+	case []any:
+		return asList(t)
+	}
+	return nil
+}
+
+func asList(v any) []string {
+	list, _ := v.([]any)
+	out := make([]string, 0, len(list))
+	for _, x := range list {
+		if str, ok := x.(string); ok {
+			out = append(out, str)
+		}
+	}
+	return out
+}
+
+func matchesType(types []string, v any) bool {
+	for _, t := range types {
+		switch val := v.(type) {
+		case nil:
+			if t == "null" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case float64:
+			if t == "number" || (t == "integer" && val == math.Trunc(val)) {
+				return true
+			}
+		case map[string]any:
+			if t == "object" {
+				return true
+			}
+		case []any:
+			if t == "array" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func where(path string) string {
+	if path == "" {
+		return "event"
+	}
+	return path
+}
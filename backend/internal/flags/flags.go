@@ -0,0 +1,120 @@
+// Package flags holds the FEATURE_FLAGS setting. A flag is on, off, or
+// rolled out to a percentage of users: each user falls in a bucket from 0
+// to 99 hashed from their id and the flag's name, and is in the flag's
+// cohort when the bucket is below the percentage. Buckets are the same on
+// every instance and across restarts, so raising the percentage only adds
+// users, and different flags pick different users.
+package flags
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	"talkie/backend/internal/metrics"
+
+	"github.com/google/uuid"
+)
+
+var (
+	exposures = metrics.NewCounterVec("talkie_flag_exposures_total", "Users routed by a partly rolled out feature flag, by flag and cohort (on or off).", "flag", "cohort")
+	outcomes  = metrics.NewCounterVec("talkie_flag_outcomes_total", "Results of code paths behind a partly rolled out feature flag, by flag, cohort and result.", "flag", "cohort", "result")
+)
+
+// Set maps each flag to the percentage of users it is on for: 100 is on
+// for everyone and 0 off.
+type Set map[string]int
+
+// Parse reads a comma-separated list of "name" (on), "name=<bool>" or
+// "name=<percent>%" entries. Entries whose bool does not parse are
+// skipped, as they always were; a bad percentage is an error.
+func Parse(v string) (Set, error) {
+	set := Set{}
+	for _, entry := range strings.Split(v, ",") {
+		name, value, found := strings.Cut(strings.TrimSpace(entry), "=")
+		name = strings.TrimSpace(name)
+		value = strings.TrimSpace(value)
+		if name == "" {
+			continue
+		}
+		if !found {
+			set[name] = 100
+			continue
+		}
+		if pct, ok := strings.CutSuffix(value, "%"); ok {
+			n, err := strconv.Atoi(strings.TrimSpace(pct))
+			if err != nil || n < 0 || n > 100 {
+				return nil, fmt.Errorf("%s: rollout must be a percentage from 0%% to 100%%, not %q", name, value)
+			}
+			set[name] = n
+			continue
+		}
+		on, err := strconv.ParseBool(value)
+		if err != nil {
+			continue
+		}
+		set[name] = 0
+		if on {
+			set[name] = 100
+		}
+	}
+	return set, nil
+}
+
+// bucket places userID from 0 to 99 for flag.
+func bucket(flag string, userID uuid.UUID) int {
+	h := fnv.New32a()
+	h.Write([]byte(flag))
+	h.Write([]byte{':'})
+	h.Write(userID[:])
+	return int(h.Sum32() % 100)
+}
+
+func cohort(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+func (s Set) on(flag string, userID uuid.UUID) (on, partial bool) {
+	pct, ok := s[flag]
+	if !ok || pct <= 0 {
+		return false, false
+	}
+	if pct >= 100 {
+		return true, false
+	}
+	return bucket(flag, userID) < pct, true
+}
+
+// On reports whether flag is on for userID. Server code that branches on
+// a partly rolled out flag calls it where the user is routed, which counts
+// the user in their cohort's exposures.
+func (s Set) On(flag string, userID uuid.UUID) bool {
+	on, partial := s.on(flag, userID)
+	if partial {
+		exposures.With(flag, cohort(on)).Add(1)
+	}
+	return on
+}
+
+// Record counts a result, such as "ok" or "error", of the code path flag
+// sent userID down, so the cohorts can be compared. Flags that are wholly
+// on or off have no cohorts and are not counted.
+func (s Set) Record(flag string, userID uuid.UUID, result string) {
+	if on, partial := s.on(flag, userID); partial {
+		outcomes.With(flag, cohort(on), result).Add(1)
+	}
+}
+
+// For resolves every flag for userID, for clients to route themselves.
+// Partly rolled out flags count as exposures, as the client acts on them.
+func (s Set) For(userID uuid.UUID) map[string]bool {
+	out := make(map[string]bool, len(s))
+	for flag := range s {
+		out[flag] = s.On(flag, userID)
+	}
+	return out
+}
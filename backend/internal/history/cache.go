@@ -0,0 +1,166 @@
+// Package history keeps the most recent messages of active rooms in memory so
+// that every WebSocket connect does not re-run the same ListMessages query.
+package history
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/metrics"
+
+	"github.com/google/uuid"
+)
+
+var (
+	cacheHits   = metrics.NewCounter("talkie_history_cache_hits_total", "History reads served from memory.")
+	cacheMisses = metrics.NewCounter("talkie_history_cache_misses_total", "History reads that fell through to the database.")
+)
+
+type Loader interface {
+	ListMessages(ctx context.Context, roomID uuid.UUID, limit int) ([]db.Message, error)
+}
+
+type entry struct {
+	roomID   uuid.UUID
+	messages []db.Message
+}
+
+// Cache is an LRU of per-room message tails. It holds up to maxRooms rooms and
+// the newest perRoom messages of each, oldest first like ListMessages.
+type Cache struct {
+	mu       sync.Mutex
+	maxRooms int
+	perRoom  int
+	order    *list.List
+	rooms    map[uuid.UUID]*list.Element
+	// latest remembers the newest message ID appended per room so a Put that
+	// raced with a concurrent send cannot install a stale tail.
+	latest map[uuid.UUID]int64
+}
+
+func NewCache(maxRooms, perRoom int) *Cache {
+	return &Cache{
+		maxRooms: maxRooms,
+		perRoom:  perRoom,
+		order:    list.New(),
+		rooms:    make(map[uuid.UUID]*list.Element),
+		latest:   make(map[uuid.UUID]int64),
+	}
+}
+
+func (c *Cache) enabled() bool {
+	return c != nil && c.maxRooms > 0 && c.perRoom > 0
+}
+
+// Get returns up to limit of the newest cached messages for roomID. It misses
+// when the room is not cached or the cache holds fewer than limit messages
+// and may therefore be truncated.
+func (c *Cache) Get(roomID uuid.UUID, limit int) ([]db.Message, bool) {
+	if !c.enabled() || limit > c.perRoom {
+		cacheMisses.Inc()
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.rooms[roomID]
+	if !ok {
+		cacheMisses.Inc()
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	msgs := el.Value.(*entry).messages
+	if len(msgs) > limit {
+		msgs = msgs[len(msgs)-limit:]
+	}
+	cacheHits.Inc()
+	out := make([]db.Message, len(msgs))
+	copy(out, msgs)
+	return out, true
+}
+
+// Put installs the tail loaded from the database. messages must be the
+// newest perRoom (or fewer, if the room is that small) in ascending order.
+func (c *Cache) Put(roomID uuid.UUID, messages []db.Message) {
+	if !c.enabled() {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var lastID int64
+	if len(messages) > 0 {
+		lastID = messages[len(messages)-1].ID
+	}
+	if c.latest[roomID] > lastID {
+		return
+	}
+	if len(messages) > c.perRoom {
+		messages = messages[len(messages)-c.perRoom:]
+	}
+	stored := make([]db.Message, len(messages))
+	copy(stored, messages)
+	if el, ok := c.rooms[roomID]; ok {
+		el.Value.(*entry).messages = stored
+		c.order.MoveToFront(el)
+		return
+	}
+	c.rooms[roomID] = c.order.PushFront(&entry{roomID: roomID, messages: stored})
+	for c.order.Len() > c.maxRooms {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.rooms, oldest.Value.(*entry).roomID)
+	}
+}
+
+// Append adds a newly saved message to its room's cached tail, if any.
+func (c *Cache) Append(msg db.Message) {
+	if !c.enabled() {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if msg.ID > c.latest[msg.RoomID] {
+		c.latest[msg.RoomID] = msg.ID
+	}
+	el, ok := c.rooms[msg.RoomID]
+	if !ok {
+		return
+	}
+	e := el.Value.(*entry)
+	e.messages = append(e.messages, msg)
+	if len(e.messages) > c.perRoom {
+		e.messages = e.messages[len(e.messages)-c.perRoom:]
+	}
+}
+
+func (c *Cache) Invalidate(roomID uuid.UUID) {
+	if !c.enabled() {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.rooms[roomID]; ok {
+		c.order.Remove(el)
+		delete(c.rooms, roomID)
+	}
+	delete(c.latest, roomID)
+}
+
+// Recent serves the newest messages of a room from memory, loading and
+// caching them through store on a miss.
+func (c *Cache) Recent(ctx context.Context, store Loader, roomID uuid.UUID, limit int) ([]db.Message, error) {
+	if cached, ok := c.Get(roomID, limit); ok {
+		return cached, nil
+	}
+	messages, err := store.ListMessages(ctx, roomID, limit)
+	if err != nil {
+		return nil, err
+	}
+	// A short page is the whole room; otherwise only cache pages that cover
+	// the full per-room tail, or Get would later serve a truncated one.
+	if c.enabled() && (len(messages) < limit || limit >= c.perRoom) {
+		c.Put(roomID, messages)
+	}
+	return messages, nil
+}
@@ -0,0 +1,104 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// Longest range one activity request may cover, per bucket size.
+var maxActivityRange = map[string]time.Duration{
+	db.ActivityHour: 31 * 24 * time.Hour,
+	db.ActivityDay:  366 * 24 * time.Hour,
+}
+
+// getRoomActivity returns a room's message counts bucketed by hour or day,
+// for activity heatmaps and for marking the days the jump-to-date picker
+// can land on. from and to take RFC 3339 times or YYYY-MM-DD dates in the
+// viewer's time zone; a date as to includes that whole day. Without a
+// range it covers the last 30 days, or the last 24 hours for hour buckets.
+func (s *Server) getRoomActivity(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return
+	}
+	q := r.URL.Query()
+	bucket := q.Get("bucket")
+	if bucket == "" {
+		bucket = db.ActivityDay
+	}
+	maxRange, ok := maxActivityRange[bucket]
+	if !ok {
+		jsonError(w, http.StatusBadRequest, "bucket must be hour or day")
+		return
+	}
+
+	loc := s.userLocation(r.Context(), user.ID)
+	to := time.Now()
+	if raw := q.Get("to"); raw != "" {
+		t, dateOnly, err := parseDateOrTime(raw, loc)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, "to must be YYYY-MM-DD or an RFC 3339 time")
+			return
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		to = t
+	}
+	var from time.Time
+	if raw := q.Get("from"); raw != "" {
+		from, _, err = parseDateOrTime(raw, loc)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, "from must be YYYY-MM-DD or an RFC 3339 time")
+			return
+		}
+	} else if bucket == db.ActivityHour {
+		from = to.Add(-24 * time.Hour).Truncate(time.Hour)
+	} else {
+		end := to.In(loc)
+		from = time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, -29)
+	}
+	if !from.Before(to) {
+		jsonError(w, http.StatusBadRequest, "from must be before to")
+		return
+	}
+	if to.Sub(from) > maxRange {
+		jsonError(w, http.StatusBadRequest, fmt.Sprintf("%s buckets cover at most %d days", bucket, int(maxRange/(24*time.Hour))))
+		return
+	}
+
+	member, err := s.Store.IsRoomMember(r.Context(), roomID, user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check membership")
+		return
+	}
+	if !member {
+		jsonError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+	buckets, err := s.Store.RoomActivity(r.Context(), roomID, from, to, bucket, loc)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load activity")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{
+		"bucket":   bucket,
+		"timezone": loc.String(),
+		"from":     from,
+		"to":       to,
+		"buckets":  buckets,
+	})
+}
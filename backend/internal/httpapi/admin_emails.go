@@ -0,0 +1,82 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// adminMailInterval is the least time between two emails to the same admin
+// about the same room, so a queue of join requests sends one email rather
+// than one per request.
+const adminMailInterval = 10 * time.Minute
+
+// notifyJoinRequest tells roomID's admins that userID is waiting for
+// approval. Every admin gets an in-app notification; admins with no open
+// connection are also emailed, unless they turned admin emails off or are
+// in their quiet hours.
+func (s *Server) notifyJoinRequest(roomID, userID uuid.UUID, username string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	room, err := s.Store.GetRoomByID(ctx, roomID)
+	if err != nil {
+		log.Printf("join request notification: load room %s: %v", roomID, err)
+		return
+	}
+	admins, err := s.Store.ListRoomAdminIDs(ctx, roomID)
+	if err != nil {
+		log.Printf("join request notification: list admins of %s: %v", roomID, err)
+		return
+	}
+
+	title := fmt.Sprintf("Join request in %s", room.Name)
+	body := fmt.Sprintf("%s is waiting for approval to join %s.", username, room.Name)
+	for _, adminID := range admins {
+		n, err := s.Store.CreateNotification(ctx, adminID, "room.join_request", title, body, map[string]any{
+			"room_id": roomID,
+			"user_id": userID,
+		})
+		if err != nil {
+			log.Printf("join request notification: notify %s: %v", adminID, err)
+			continue
+		}
+		s.Hub.SendNotification(n)
+	}
+
+	contacts, err := s.Store.ListAdminEmailContacts(ctx, roomID)
+	if err != nil {
+		log.Printf("join request notification: list admin emails of %s: %v", roomID, err)
+		return
+	}
+	for _, c := range contacts {
+		if s.Hub.IsUserOnline(c.UserID) || c.QuietHours.Active(time.Now(), c.Timezone) || !s.adminMails.Take(c.UserID.String()+":"+roomID.String()).Allowed {
+			continue
+		}
+		if err := s.sendAdminEmail(c.Email, title, body, s.roomLink(roomID)); err != nil {
+			log.Printf("join request email to %s failed: %v", c.UserID, err)
+		}
+	}
+}
+
+// roomLink is a frontend link that opens roomID.
+func (s *Server) roomLink(roomID uuid.UUID) string {
+	return strings.TrimRight(s.Cfg.FrontendBaseURL, "/") + "/?room=" + url.QueryEscape(roomID.String())
+}
+
+func (s *Server) sendAdminEmail(to, subject, summary, link string) error {
+	body := summary + "\n\nOpen the room to review it:\n" + link + "\n\n" +
+		"You get these emails because you are a room admin and were offline. " +
+		"You can turn them off in your notification settings.\n"
+
+	if !s.Mailer.Enabled() {
+		log.Printf("admin email for %s: %s %s", to, summary, link)
+		return nil
+	}
+	return s.Mailer.Send(to, subject, body)
+}
@@ -0,0 +1,68 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// requireAdmin restricts a route group to instance administrators. The flag
+// is read from the database on every request so revoking it takes effect
+// without waiting for tokens to expire.
+func (s *Server) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := middleware.UserFromContext(r.Context())
+		if !ok {
+			jsonError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		u, err := s.Store.FindUserByID(r.Context(), user.ID)
+		if err != nil && err != db.ErrNotFound {
+			jsonError(w, http.StatusInternalServerError, "failed to load user")
+			return
+		}
+		if err != nil || !u.IsAdmin {
+			jsonError(w, http.StatusForbidden, "admin only")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// setShadowBan toggles shadow-ban mode for a user. Only messages written
+// while the ban is active are hidden; lifting it does not reveal them.
+func (s *Server) setShadowBan(w http.ResponseWriter, r *http.Request) {
+	admin, _ := middleware.UserFromContext(r.Context())
+	userID, err := uuid.Parse(chi.URLParam(r, "userID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	var req struct {
+		ShadowBanned bool `json:"shadow_banned"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if userID == admin.ID {
+		jsonError(w, http.StatusBadRequest, "cannot shadow-ban yourself")
+		return
+	}
+	if err := s.Store.SetUserShadowBanned(r.Context(), userID, req.ShadowBanned); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to update user")
+		return
+	}
+	log.Printf("admin %s set shadow_banned=%t for user %s", admin.ID, req.ShadowBanned, userID)
+	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
+}
@@ -0,0 +1,226 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const dateOfBirthLayout = "2006-01-02"
+
+// ageOn returns how many whole years old someone born on dob is on day now.
+func ageOn(dob, now time.Time) int {
+	years := now.Year() - dob.Year()
+	if now.Month() < dob.Month() || now.Month() == dob.Month() && now.Day() < dob.Day() {
+		years--
+	}
+	return years
+}
+
+func parseDateOfBirth(raw string, now time.Time) (time.Time, error) {
+	dob, err := time.Parse(dateOfBirthLayout, raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("date_of_birth must be YYYY-MM-DD")
+	}
+	if dob.After(now) || ageOn(dob, now) > 150 {
+		return time.Time{}, fmt.Errorf("invalid date_of_birth")
+	}
+	return dob, nil
+}
+
+// registrationDateOfBirth applies the age gate to a sign-up. It returns
+// nil when no date was given or the gate is off, and writes the error
+// response when ok is false.
+func (s *Server) registrationDateOfBirth(w http.ResponseWriter, raw string) (dob *time.Time, ok bool) {
+	if s.Cfg.AgeGate == "" || s.Cfg.AgeGate == "off" {
+		return nil, true
+	}
+	if raw == "" {
+		if s.Cfg.AgeGate == "required" {
+			jsonError(w, http.StatusBadRequest, "date_of_birth is required")
+			return nil, false
+		}
+		return nil, true
+	}
+	now := time.Now().UTC()
+	parsed, err := parseDateOfBirth(raw, now)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	if ageOn(parsed, now) < s.Cfg.MinAge {
+		jsonError(w, http.StatusForbidden, fmt.Sprintf("you must be at least %d to use Talkie", s.Cfg.MinAge))
+		return nil, false
+	}
+	return &parsed, true
+}
+
+// ageRestricted reports whether a's account is in restricted mode: an
+// admin's override when there is one, otherwise being under AdultAge.
+// Accounts without a date of birth are not restricted.
+func (s *Server) ageRestricted(a db.AgeSettings) bool {
+	if a.RestrictedOverride != nil {
+		return *a.RestrictedOverride
+	}
+	return a.DateOfBirth != nil && ageOn(*a.DateOfBirth, time.Now().UTC()) < s.Cfg.AdultAge
+}
+
+func (s *Server) isRestricted(ctx context.Context, userID uuid.UUID) (bool, error) {
+	a, err := s.Store.GetUserAge(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return s.ageRestricted(a), nil
+}
+
+// hidesNSFW is the user's NSFW opt-out, which restricted mode forces on.
+func (s *Server) hidesNSFW(ctx context.Context, userID uuid.UUID) (bool, error) {
+	hide, err := s.Store.GetUserHideNSFW(ctx, userID)
+	if err != nil || hide {
+		return hide, err
+	}
+	return s.isRestricted(ctx, userID)
+}
+
+// allowDirectMessage keeps restricted accounts to DMs with friends, in
+// either direction. It writes the response when it returns false.
+func (s *Server) allowDirectMessage(w http.ResponseWriter, r *http.Request, userID, targetID uuid.UUID) bool {
+	for _, id := range []uuid.UUID{userID, targetID} {
+		restricted, err := s.isRestricted(r.Context(), id)
+		if err != nil && err != db.ErrNotFound {
+			jsonError(w, http.StatusInternalServerError, "failed to load user")
+			return false
+		}
+		if !restricted {
+			continue
+		}
+		friends, err := s.Store.IsFriend(r.Context(), userID, targetID)
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "failed to check friendship")
+			return false
+		}
+		if !friends {
+			jsonError(w, http.StatusForbidden, "restricted accounts can only message friends")
+			return false
+		}
+		return true
+	}
+	return true
+}
+
+type ageResponse struct {
+	DateOfBirth        string `json:"date_of_birth,omitempty"`
+	Restricted         bool   `json:"restricted"`
+	RestrictedOverride *bool  `json:"restricted_override,omitempty"`
+}
+
+func (s *Server) ageResponse(a db.AgeSettings) ageResponse {
+	resp := ageResponse{Restricted: s.ageRestricted(a), RestrictedOverride: a.RestrictedOverride}
+	if a.DateOfBirth != nil {
+		resp.DateOfBirth = a.DateOfBirth.Format(dateOfBirthLayout)
+	}
+	return resp
+}
+
+// getMyAge tells clients whether to hide what restricted mode blocks.
+func (s *Server) getMyAge(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	a, err := s.Store.GetUserAge(r.Context(), user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load user")
+		return
+	}
+	jsonResponse(w, http.StatusOK, s.ageResponse(a))
+}
+
+func (s *Server) getUserAge(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(chi.URLParam(r, "userID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	a, err := s.Store.GetUserAge(r.Context(), userID)
+	if err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to load user")
+		return
+	}
+	jsonResponse(w, http.StatusOK, s.ageResponse(a))
+}
+
+// setUserAge lets admins correct a date of birth and force restricted mode
+// on or off. Fields left out of the body are unchanged; null clears them.
+func (s *Server) setUserAge(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(chi.URLParam(r, "userID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	var req map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if raw, ok := req["date_of_birth"]; ok {
+		var value *string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			jsonError(w, http.StatusBadRequest, "date_of_birth must be a string or null")
+			return
+		}
+		var dob *time.Time
+		if value != nil {
+			parsed, err := parseDateOfBirth(*value, time.Now().UTC())
+			if err != nil {
+				jsonError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			dob = &parsed
+		}
+		if !s.saveUserAge(w, s.Store.SetUserDateOfBirth(r.Context(), userID, dob)) {
+			return
+		}
+	}
+	if raw, ok := req["restricted"]; ok {
+		var restricted *bool
+		if err := json.Unmarshal(raw, &restricted); err != nil {
+			jsonError(w, http.StatusBadRequest, "restricted must be a boolean or null")
+			return
+		}
+		if !s.saveUserAge(w, s.Store.SetUserAgeRestricted(r.Context(), userID, restricted)) {
+			return
+		}
+	}
+	a, err := s.Store.GetUserAge(r.Context(), userID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load user")
+		return
+	}
+	jsonResponse(w, http.StatusOK, s.ageResponse(a))
+}
+
+func (s *Server) saveUserAge(w http.ResponseWriter, err error) bool {
+	if err == nil {
+		return true
+	}
+	if err == db.ErrNotFound {
+		jsonError(w, http.StatusNotFound, "user not found")
+		return false
+	}
+	jsonError(w, http.StatusInternalServerError, "failed to update user")
+	return false
+}
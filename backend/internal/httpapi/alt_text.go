@@ -0,0 +1,144 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// altTextTimeout bounds reading an image and having it described.
+const altTextTimeout = time.Minute
+
+// parseAltText collapses whitespace in alt text from a request and checks
+// its length. It writes the error response when it returns false.
+func parseAltText(w http.ResponseWriter, raw string) (string, bool) {
+	alt := strings.Join(strings.Fields(raw), " ")
+	if utf8.RuneCountInString(alt) > db.MaxAltTextLength {
+		jsonResponse(w, http.StatusBadRequest, map[string]any{
+			"error":      "alt text is too long",
+			"code":       "alt_text_too_long",
+			"max_length": db.MaxAltTextLength,
+		})
+		return "", false
+	}
+	return alt, true
+}
+
+// attachAltText gives a new image message alt, or has the vision model
+// write some in the background when alt is empty. read loads the image.
+func (s *Server) attachAltText(ctx context.Context, msg *db.Message, alt, contentType string, read func(context.Context) ([]byte, error)) {
+	if alt == "" {
+		if s.AltText != nil {
+			go s.generateAltText(*msg, contentType, read)
+		}
+		return
+	}
+	if err := s.Store.SetMessageAltText(ctx, msg.RoomID, msg.ID, alt); err != nil {
+		log.Printf("save alt text for message %d: %v", msg.ID, err)
+		return
+	}
+	msg.AltText = alt
+}
+
+// generateAltText has the vision model describe msg's image and sends the
+// message out again with it. Failures leave the image without alt text.
+func (s *Server) generateAltText(msg db.Message, contentType string, read func(context.Context) ([]byte, error)) {
+	ctx, cancel := context.WithTimeout(context.Background(), altTextTimeout)
+	defer cancel()
+	image, err := read(ctx)
+	if err != nil {
+		log.Printf("alt text: read image of message %d: %v", msg.ID, err)
+		return
+	}
+	lang, err := s.Store.GetRoomLanguage(ctx, msg.RoomID)
+	if err != nil {
+		lang = ""
+	}
+	alt, err := s.AltText.Describe(ctx, contentType, image, lang, db.MaxAltTextLength)
+	if err != nil {
+		log.Printf("alt text for message %d: %v", msg.ID, err)
+		return
+	}
+	if alt == "" {
+		return
+	}
+	if err := s.Store.SetGeneratedAltText(ctx, msg.RoomID, msg.ID, alt); err != nil {
+		// The author wrote their own meanwhile, or the message is gone.
+		if err != db.ErrNotFound {
+			log.Printf("save alt text for message %d: %v", msg.ID, err)
+		}
+		return
+	}
+	msg.AltText, msg.AltTextGenerated = alt, true
+	s.publishMessageUpdate(ctx, msg)
+}
+
+// setMessageAltText lets the author of an image message replace its alt
+// text, generated or not. An empty alt_text removes it.
+func (s *Server) setMessageAltText(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return
+	}
+	messageID, err := strconv.ParseInt(chi.URLParam(r, "messageID"), 10, 64)
+	if err != nil || messageID <= 0 {
+		jsonError(w, http.StatusBadRequest, "invalid message id")
+		return
+	}
+	var req struct {
+		AltText string `json:"alt_text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	alt, ok := parseAltText(w, req.AltText)
+	if !ok {
+		return
+	}
+	msg, err := s.Store.GetMessage(r.Context(), roomID, messageID)
+	if err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "message not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to load message")
+		return
+	}
+	if msg.UserID != user.ID {
+		jsonError(w, http.StatusForbidden, "only the author can change alt text")
+		return
+	}
+	if msg.MessageType != "image" {
+		jsonError(w, http.StatusBadRequest, "only image messages have alt text")
+		return
+	}
+	if err := s.Store.SetMessageAltText(r.Context(), roomID, messageID, alt); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "message not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to save alt text")
+		return
+	}
+	msg.AltText, msg.AltTextGenerated = alt, false
+	s.publishMessageUpdate(r.Context(), msg)
+	jsonResponse(w, http.StatusOK, msg)
+}
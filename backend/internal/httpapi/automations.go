@@ -0,0 +1,336 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+	"talkie/backend/internal/textnorm"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	maxAutomations = 20
+	// automationActionsPerMinute bounds each automation's actions, so a
+	// busy room or a trigger matching everything cannot flood another room
+	// or someone's inbox.
+	automationActionsPerMinute = 20
+	automationRunsShown        = 50
+)
+
+func (s *Server) listAutomations(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	automations, err := s.Store.ListAutomations(r.Context(), user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load automations")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"automations": automations})
+}
+
+func (s *Server) getAutomation(w http.ResponseWriter, r *http.Request) {
+	a, ok := s.automationRequest(w, r)
+	if !ok {
+		return
+	}
+	jsonResponse(w, http.StatusOK, a)
+}
+
+// createAutomation sets up a rule that runs on new messages in a room the
+// caller is in. Actions post as the caller, so they only reach rooms the
+// caller is in and people the room already shares them with.
+func (s *Server) createAutomation(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	a := db.Automation{Enabled: true}
+	if !decodeAutomation(w, r, &a) {
+		return
+	}
+	a.OwnerID = user.ID
+	if !s.checkAutomationTargets(w, r, a) {
+		return
+	}
+	n, err := s.Store.CountAutomations(r.Context(), user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load automations")
+		return
+	}
+	if n >= maxAutomations {
+		jsonError(w, http.StatusConflict, fmt.Sprintf("at most %d automations", maxAutomations))
+		return
+	}
+	created, err := s.Store.CreateAutomation(r.Context(), a)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to save automation")
+		return
+	}
+	jsonResponse(w, http.StatusCreated, created)
+}
+
+// updateAutomation changes the fields present in the body and leaves the
+// rest as they were.
+func (s *Server) updateAutomation(w http.ResponseWriter, r *http.Request) {
+	a, ok := s.automationRequest(w, r)
+	if !ok {
+		return
+	}
+	if !decodeAutomation(w, r, &a) {
+		return
+	}
+	if !s.checkAutomationTargets(w, r, a) {
+		return
+	}
+	updated, err := s.Store.UpdateAutomation(r.Context(), a)
+	if err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "automation not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to save automation")
+		return
+	}
+	jsonResponse(w, http.StatusOK, updated)
+}
+
+func (s *Server) deleteAutomation(w http.ResponseWriter, r *http.Request) {
+	a, ok := s.automationRequest(w, r)
+	if !ok {
+		return
+	}
+	if err := s.Store.DeleteAutomation(r.Context(), a.OwnerID, a.ID); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "automation not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to delete automation")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+// listAutomationRuns shows the automation's latest runs and why any
+// failed, newest first.
+func (s *Server) listAutomationRuns(w http.ResponseWriter, r *http.Request) {
+	a, ok := s.automationRequest(w, r)
+	if !ok {
+		return
+	}
+	runs, err := s.Store.ListAutomationRuns(r.Context(), a.ID, automationRunsShown)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load runs")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"runs": runs})
+}
+
+// automationRequest loads the caller's automation named in the path. It
+// writes the response when it returns false.
+func (s *Server) automationRequest(w http.ResponseWriter, r *http.Request) (db.Automation, bool) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return db.Automation{}, false
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r, "automationID"), 10, 64)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid automation id")
+		return db.Automation{}, false
+	}
+	a, err := s.Store.GetAutomation(r.Context(), user.ID, id)
+	if err == db.ErrNotFound {
+		jsonError(w, http.StatusNotFound, "automation not found")
+		return db.Automation{}, false
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load automation")
+		return db.Automation{}, false
+	}
+	return a, true
+}
+
+// decodeAutomation applies the request body to a and validates the
+// result. It writes the response when it returns false.
+func decodeAutomation(w http.ResponseWriter, r *http.Request, a *db.Automation) bool {
+	var req struct {
+		RoomID  *uuid.UUID             `json:"room_id"`
+		Name    *string                `json:"name"`
+		Trigger *db.AutomationTrigger  `json:"trigger"`
+		Actions *[]db.AutomationAction `json:"actions"`
+		Enabled *bool                  `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return false
+	}
+	if req.RoomID != nil {
+		a.RoomID = *req.RoomID
+	}
+	if req.Name != nil {
+		a.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Trigger != nil {
+		a.Trigger = *req.Trigger
+		a.Trigger.Contains = strings.TrimSpace(textnorm.Message(a.Trigger.Contains))
+	}
+	if req.Actions != nil {
+		a.Actions = *req.Actions
+		for i := range a.Actions {
+			a.Actions[i].Text = textnorm.Message(a.Actions[i].Text)
+			a.Actions[i].Subject = strings.TrimSpace(a.Actions[i].Subject)
+		}
+	}
+	if req.Enabled != nil {
+		a.Enabled = *req.Enabled
+	}
+	if a.RoomID == uuid.Nil {
+		jsonError(w, http.StatusBadRequest, "room_id is required")
+		return false
+	}
+	if err := db.ValidateAutomation(*a); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	return true
+}
+
+// checkAutomationTargets makes sure a's owner may use everything it names.
+// It writes the response when it returns false.
+func (s *Server) checkAutomationTargets(w http.ResponseWriter, r *http.Request, a db.Automation) bool {
+	err := s.automationAllowed(r.Context(), a, nil)
+	var denied automationDenied
+	switch {
+	case errors.As(err, &denied):
+		jsonError(w, http.StatusForbidden, denied.Error())
+		return false
+	case err != nil:
+		jsonError(w, http.StatusInternalServerError, "failed to check membership")
+		return false
+	}
+	return true
+}
+
+// automationDenied is an action the owner may no longer take.
+type automationDenied string
+
+func (e automationDenied) Error() string { return string(e) }
+
+// automationAllowed checks that a's owner is in its room and that act, or
+// every action when act is nil, stays within what they can reach: posting
+// only to their own rooms, mailing only people in the trigger room.
+func (s *Server) automationAllowed(ctx context.Context, a db.Automation, act *db.AutomationAction) error {
+	member, err := s.Store.IsRoomMember(ctx, a.RoomID, a.OwnerID)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return automationDenied("you are not a member of the automation's room")
+	}
+	actions := a.Actions
+	if act != nil {
+		actions = []db.AutomationAction{*act}
+	}
+	for _, act := range actions {
+		switch act.Type {
+		case db.AutomationPostMessage:
+			member, err = s.Store.IsRoomMember(ctx, *act.RoomID, a.OwnerID)
+			if err == nil && !member {
+				err = automationDenied(fmt.Sprintf("you are not a member of room %s", act.RoomID))
+			}
+		case db.AutomationEmail:
+			member, err = s.Store.IsRoomMember(ctx, a.RoomID, *act.UserID)
+			if err == nil && !member {
+				err = automationDenied(fmt.Sprintf("user %s is not a member of the automation's room", act.UserID))
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunAutomationAction carries out one action of a for the message m that
+// fired it. The owner's access is checked again, since it may have changed
+// since the automation was saved.
+func (s *Server) RunAutomationAction(ctx context.Context, a db.Automation, act db.AutomationAction, m db.Message) error {
+	if err := s.automationAllowed(ctx, a, &act); err != nil {
+		return err
+	}
+	if !s.automationRuns.Take(strconv.FormatInt(a.ID, 10)).Allowed {
+		return errors.New("rate limited: too many runs this minute")
+	}
+	link := s.messagePermalink(m.RoomID, m.ID)
+	switch act.Type {
+	case db.AutomationPostMessage:
+		content := renderAutomationText(act.Text, m, link)
+		if verdict := s.Automod.Check(ctx, *act.RoomID, a.OwnerID, content); verdict.Blocked() {
+			return fmt.Errorf("blocked by automod: %s", verdict.Notice)
+		}
+		direct, err := s.Store.IsDirectRoom(ctx, *act.RoomID)
+		if err != nil {
+			return err
+		}
+		msg, err := s.Store.SaveAutomationMessage(ctx, *act.RoomID, a.OwnerID, a.ID, content)
+		if err != nil {
+			return err
+		}
+		if direct {
+			msg.DeliveryState = "sent"
+		}
+		s.publishMessage(ctx, msg)
+		if direct && !msg.Shadowed {
+			s.Hub.DeliverDirect(ctx, s.Store, msg)
+		}
+		return nil
+	case db.AutomationEmail:
+		to, err := s.Store.FindUserByID(ctx, *act.UserID)
+		if err != nil {
+			return err
+		}
+		if !to.EmailVerified {
+			return fmt.Errorf("user %s has no verified email address", to.ID)
+		}
+		subject := act.Subject
+		if subject == "" {
+			subject = "Automation: " + a.Name
+		}
+		subject = renderAutomationText(subject, m, link)
+		body := act.Text
+		if body == "" {
+			body = "{{user}} wrote:\n\n{{content}}\n\n{{link}}"
+		}
+		body = renderAutomationText(body, m, link)
+		body += fmt.Sprintf("\n\n-- \nSent by the automation \"%s\" set up on Talkie.\n", a.Name)
+		if !s.Mailer.Enabled() {
+			log.Printf("automation %d email to %s: %s", a.ID, to.Email, subject)
+			return nil
+		}
+		return s.Mailer.Send(to.Email, subject, body)
+	}
+	return fmt.Errorf("unknown action type %q", act.Type)
+}
+
+// renderAutomationText fills in an action template for the message m.
+func renderAutomationText(tmpl string, m db.Message, link string) string {
+	return strings.NewReplacer(
+		"{{user}}", m.Username,
+		"{{content}}", m.Content,
+		"{{link}}", link,
+	).Replace(tmpl)
+}
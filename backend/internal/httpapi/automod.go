@@ -0,0 +1,196 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"talkie/backend/internal/automod"
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const maxAutomodRules = 50
+
+// roomAdminRequest parses {roomID} and checks the caller is one of the
+// room's admins, returning the room and the caller.
+func (s *Server) roomAdminRequest(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return uuid.Nil, uuid.Nil, false
+	}
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return uuid.Nil, uuid.Nil, false
+	}
+	if !s.authorizeRoomAdmin(w, r, roomID, user.ID) {
+		return uuid.Nil, uuid.Nil, false
+	}
+	return roomID, user.ID, true
+}
+
+// decodeAutomodRule reads a rule from the body and validates its config.
+func decodeAutomodRule(w http.ResponseWriter, r *http.Request, roomID uuid.UUID) (db.AutomodRule, bool) {
+	var req struct {
+		Kind        string          `json:"kind"`
+		Config      json.RawMessage `json:"config"`
+		Action      string          `json:"action"`
+		MuteMinutes int             `json:"mute_minutes"`
+		Enabled     *bool           `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return db.AutomodRule{}, false
+	}
+	if len(req.Config) == 0 || string(req.Config) == "null" {
+		req.Config = json.RawMessage("{}")
+	}
+	rule := db.AutomodRule{
+		RoomID:      roomID,
+		Kind:        req.Kind,
+		Config:      req.Config,
+		Action:      req.Action,
+		MuteMinutes: req.MuteMinutes,
+		Enabled:     req.Enabled == nil || *req.Enabled,
+	}
+	if _, err := automod.Compile(rule); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return db.AutomodRule{}, false
+	}
+	return rule, true
+}
+
+func (s *Server) listAutomodRules(w http.ResponseWriter, r *http.Request) {
+	roomID, _, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	rules, err := s.Store.ListAutomodRules(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load rules")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"rules": rules})
+}
+
+func (s *Server) createAutomodRule(w http.ResponseWriter, r *http.Request) {
+	roomID, userID, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	rule, ok := decodeAutomodRule(w, r, roomID)
+	if !ok {
+		return
+	}
+	existing, err := s.Store.ListAutomodRules(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load rules")
+		return
+	}
+	if len(existing) >= maxAutomodRules {
+		jsonError(w, http.StatusConflict, fmt.Sprintf("a room can have at most %d rules", maxAutomodRules))
+		return
+	}
+	rule.CreatedBy = &userID
+	created, err := s.Store.CreateAutomodRule(r.Context(), rule)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to save rule")
+		return
+	}
+	s.Automod.Invalidate(roomID)
+	jsonResponse(w, http.StatusCreated, created)
+}
+
+func (s *Server) updateAutomodRule(w http.ResponseWriter, r *http.Request) {
+	roomID, _, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	ruleID, err := strconv.ParseInt(chi.URLParam(r, "ruleID"), 10, 64)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid rule id")
+		return
+	}
+	rule, ok := decodeAutomodRule(w, r, roomID)
+	if !ok {
+		return
+	}
+	rule.ID = ruleID
+	updated, err := s.Store.UpdateAutomodRule(r.Context(), rule)
+	if err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "rule not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to save rule")
+		return
+	}
+	s.Automod.Invalidate(roomID)
+	jsonResponse(w, http.StatusOK, updated)
+}
+
+func (s *Server) deleteAutomodRule(w http.ResponseWriter, r *http.Request) {
+	roomID, _, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	ruleID, err := strconv.ParseInt(chi.URLParam(r, "ruleID"), 10, 64)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid rule id")
+		return
+	}
+	if err := s.Store.DeleteAutomodRule(r.Context(), roomID, ruleID); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "rule not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to delete rule")
+		return
+	}
+	s.Automod.Invalidate(roomID)
+	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+// listAutomodEvents shows admins what the rules caught, newest first.
+func (s *Server) listAutomodEvents(w http.ResponseWriter, r *http.Request) {
+	roomID, _, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	events, err := s.Store.ListAutomodEvents(r.Context(), roomID, limit)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load events")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"events": events})
+}
+
+// unmuteRoomMember lifts a mute applied by a rule before it runs out.
+func (s *Server) unmuteRoomMember(w http.ResponseWriter, r *http.Request) {
+	roomID, _, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	userID, err := uuid.Parse(chi.URLParam(r, "userID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	if err := s.Store.UnmuteRoomMember(r.Context(), roomID, userID); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "member is not muted")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to unmute member")
+		return
+	}
+	s.Automod.Invalidate(roomID)
+	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
+}
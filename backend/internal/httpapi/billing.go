@@ -0,0 +1,96 @@
+package httpapi
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"talkie/backend/internal/billing"
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+)
+
+const maxWebhookBody = 1 << 20
+
+// stripeWebhook applies subscription events to their owners' plans. Events
+// billing does not act on, and subscriptions for someone not on this
+// instance, are acknowledged so Stripe stops retrying them; a storage
+// failure answers 500 so it does retry.
+func (s *Server) stripeWebhook(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	ev, err := s.Billing.ParseEvent(payload, r.Header.Get("Stripe-Signature"), time.Now())
+	if err != nil {
+		if errors.Is(err, billing.ErrNoOwner) {
+			jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
+			return
+		}
+		if errors.Is(err, billing.ErrBadSignature) {
+			jsonError(w, http.StatusBadRequest, "invalid signature")
+			return
+		}
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if ev.Subscription == nil {
+		jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
+		return
+	}
+
+	fresh, err := s.Store.RecordBillingEvent(r.Context(), ev.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to record event")
+		return
+	}
+	if !fresh {
+		jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
+		return
+	}
+	sub := *ev.Subscription
+	if sub.Plan == "" && billing.Entitled(sub.Status) {
+		log.Printf("billing: subscription %s has no price mapped in STRIPE_PRICE_PLANS", sub.ID)
+	}
+	if _, err := s.Store.ApplySubscription(r.Context(), sub, ev.Created, billing.Entitled(sub.Status)); err != nil {
+		if err == db.ErrNotFound {
+			log.Printf("billing: subscription %s belongs to a deleted account", sub.ID)
+			jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
+			return
+		}
+		if ferr := s.Store.ForgetBillingEvent(r.Context(), ev.ID); ferr != nil {
+			log.Printf("billing: forget event %s: %v", ev.ID, ferr)
+		}
+		log.Printf("billing: apply subscription %s: %v", sub.ID, err)
+		jsonError(w, http.StatusInternalServerError, "failed to apply subscription")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+// getMyBilling shows the caller's own subscription, if any. Workspace
+// subscriptions show up in the workspace's plan instead.
+func (s *Server) getMyBilling(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	resp := map[string]any{"enabled": s.Billing != nil, "subscription": nil}
+	if s.Billing == nil {
+		jsonResponse(w, http.StatusOK, resp)
+		return
+	}
+	sub, err := s.Store.GetUserSubscription(r.Context(), user.ID)
+	if err != nil && err != db.ErrNotFound {
+		jsonError(w, http.StatusInternalServerError, "failed to load subscription")
+		return
+	}
+	if err == nil {
+		resp["subscription"] = sub
+	}
+	jsonResponse(w, http.StatusOK, resp)
+}
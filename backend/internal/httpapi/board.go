@@ -0,0 +1,289 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+	"talkie/backend/internal/textnorm"
+	"talkie/backend/internal/ws"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	maxBoardItems       = 500
+	maxBoardNoteLength  = 2000
+	maxBoardTitleLength = 200
+	maxBoardURLLength   = 2048
+)
+
+func (s *Server) listBoard(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	items, err := s.Store.ListBoardItems(r.Context(), user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load board")
+		return
+	}
+	items, err = s.prepareBoard(r.Context(), user.ID, items)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load content settings")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"items": items})
+}
+
+// addBoardItem saves a message (room_id and message_id) or an outside link
+// (url, optionally title) to the end of the caller's board. The message
+// must be one they can read now; saving it twice returns the first item
+// with 200 instead of 201.
+func (s *Server) addBoardItem(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	var req struct {
+		RoomID    string `json:"room_id"`
+		MessageID int64  `json:"message_id"`
+		URL       string `json:"url"`
+		Title     string `json:"title"`
+		Note      string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	item := db.BoardItem{Title: textnorm.Message(strings.TrimSpace(req.Title)), Note: textnorm.Message(strings.TrimSpace(req.Note))}
+	if !validBoardText(w, item.Note, item.Title) {
+		return
+	}
+	req.URL = strings.TrimSpace(req.URL)
+	switch {
+	case req.MessageID > 0 && req.URL == "":
+		roomID, err := uuid.Parse(req.RoomID)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, "invalid room id")
+			return
+		}
+		readable, err := s.canReadRoom(r.Context(), roomID, user.ID)
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "failed to check membership")
+			return
+		}
+		if !readable {
+			jsonError(w, http.StatusForbidden, "forbidden")
+			return
+		}
+		msg, err := s.Store.GetMessage(r.Context(), roomID, req.MessageID)
+		if err == db.ErrNotFound || err == nil && msg.Shadowed && msg.UserID != user.ID {
+			jsonError(w, http.StatusNotFound, "message not found")
+			return
+		}
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "failed to load message")
+			return
+		}
+		item.Kind, item.MessageID = db.BoardMessage, msg.ID
+	case req.MessageID == 0 && req.URL != "":
+		u, err := url.Parse(req.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(req.URL) > maxBoardURLLength {
+			jsonError(w, http.StatusBadRequest, "url must be an http or https link")
+			return
+		}
+		item.Kind, item.URL = db.BoardLink, u.String()
+	default:
+		jsonError(w, http.StatusBadRequest, "either message_id with room_id or url is required")
+		return
+	}
+
+	n, err := s.Store.CountBoardItems(r.Context(), user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load board")
+		return
+	}
+	if n >= maxBoardItems {
+		jsonError(w, http.StatusConflict, fmt.Sprintf("the board holds at most %d items", maxBoardItems))
+		return
+	}
+	saved, created, err := s.Store.AddBoardItem(r.Context(), user.ID, item)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to save to board")
+		return
+	}
+	prepared, err := s.prepareBoard(r.Context(), user.ID, []db.BoardItem{saved})
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load content settings")
+		return
+	}
+	saved = prepared[0]
+	if !created {
+		jsonResponse(w, http.StatusOK, saved)
+		return
+	}
+	s.Hub.BroadcastUser(user.ID, ws.BoardMessage(ws.BoardAdded, &saved, 0))
+	jsonResponse(w, http.StatusCreated, saved)
+}
+
+// updateBoardItem edits an item's note or title; fields left out of the
+// body keep their value.
+func (s *Server) updateBoardItem(w http.ResponseWriter, r *http.Request) {
+	user, itemID, ok := boardItemRequest(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Note  *string `json:"note"`
+		Title *string `json:"title"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	var note, title string
+	if req.Note != nil {
+		note = textnorm.Message(strings.TrimSpace(*req.Note))
+		req.Note = &note
+	}
+	if req.Title != nil {
+		title = textnorm.Message(strings.TrimSpace(*req.Title))
+		req.Title = &title
+	}
+	if !validBoardText(w, note, title) {
+		return
+	}
+	item, err := s.Store.UpdateBoardItem(r.Context(), user.ID, itemID, req.Note, req.Title)
+	if err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "board item not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to update board item")
+		return
+	}
+	prepared, err := s.prepareBoard(r.Context(), user.ID, []db.BoardItem{item})
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load content settings")
+		return
+	}
+	item = prepared[0]
+	s.Hub.BroadcastUser(user.ID, ws.BoardMessage(ws.BoardUpdated, &item, 0))
+	jsonResponse(w, http.StatusOK, item)
+}
+
+func (s *Server) deleteBoardItem(w http.ResponseWriter, r *http.Request) {
+	user, itemID, ok := boardItemRequest(w, r)
+	if !ok {
+		return
+	}
+	if err := s.Store.DeleteBoardItem(r.Context(), user.ID, itemID); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "board item not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to remove board item")
+		return
+	}
+	s.Hub.BroadcastUser(user.ID, ws.BoardMessage(ws.BoardRemoved, nil, itemID))
+	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+// reorderBoard sets the order of the caller's board. item_ids must list
+// every item exactly once, so a client working from a stale board is told
+// to reload rather than silently dropping items to the end.
+func (s *Server) reorderBoard(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	var req struct {
+		ItemIDs []int64 `json:"item_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if len(req.ItemIDs) > maxBoardItems {
+		jsonError(w, http.StatusBadRequest, fmt.Sprintf("the board holds at most %d items", maxBoardItems))
+		return
+	}
+	if err := s.Store.ReorderBoardItems(r.Context(), user.ID, req.ItemIDs); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusConflict, "item_ids must list every board item once")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to reorder board")
+		return
+	}
+	s.Hub.BroadcastUser(user.ID, ws.BoardMessage(ws.BoardReordered, nil, 0))
+	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+func boardItemRequest(w http.ResponseWriter, r *http.Request) (middleware.UserContext, int64, bool) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return middleware.UserContext{}, 0, false
+	}
+	itemID, err := strconv.ParseInt(chi.URLParam(r, "itemID"), 10, 64)
+	if err != nil || itemID <= 0 {
+		jsonError(w, http.StatusBadRequest, "invalid board item id")
+		return middleware.UserContext{}, 0, false
+	}
+	return user, itemID, true
+}
+
+func validBoardText(w http.ResponseWriter, note, title string) bool {
+	if utf8.RuneCountInString(note) > maxBoardNoteLength {
+		jsonError(w, http.StatusBadRequest, fmt.Sprintf("note must be at most %d characters", maxBoardNoteLength))
+		return false
+	}
+	if utf8.RuneCountInString(title) > maxBoardTitleLength {
+		jsonError(w, http.StatusBadRequest, fmt.Sprintf("title must be at most %d characters", maxBoardTitleLength))
+		return false
+	}
+	return true
+}
+
+// prepareBoard applies masking and the viewer's NSFW setting to saved
+// messages room by room, as the room views would show them.
+func (s *Server) prepareBoard(ctx context.Context, userID uuid.UUID, items []db.BoardItem) ([]db.BoardItem, error) {
+	hideNSFW, err := s.hidesNSFW(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	byRoom := make(map[uuid.UUID][]int)
+	for i, it := range items {
+		if it.Message != nil {
+			byRoom[it.Message.RoomID] = append(byRoom[it.Message.RoomID], i)
+		}
+	}
+	for roomID, idx := range byRoom {
+		msgs := make([]db.Message, len(idx))
+		for j, i := range idx {
+			msgs[j] = *items[i].Message
+		}
+		if hideNSFW {
+			msgs = db.WithholdNSFWMedia(msgs)
+		}
+		msgs = s.maskFor(ctx, roomID, userID, msgs)
+		for j, i := range idx {
+			m := msgs[j]
+			items[i].Message = &m
+		}
+	}
+	return items, nil
+}
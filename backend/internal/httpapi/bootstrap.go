@@ -0,0 +1,133 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+
+	"github.com/google/uuid"
+)
+
+type bootstrapResponse struct {
+	User         db.User                  `json:"user"`
+	Groups       []db.RoomGroup           `json:"groups"`
+	Rooms        []db.Room                `json:"rooms"`
+	DMs          []db.Room                `json:"dms"`
+	Friends      []db.Friend              `json:"friends"`
+	Incoming     []db.FriendRequest       `json:"incoming"`
+	LastMessages map[uuid.UUID]db.Message `json:"last_messages"`
+	FeatureFlags map[string]bool          `json:"feature_flags"`
+	// Locale is the user's time zone and language, for rendering dates.
+	Locale db.UserLocale `json:"locale"`
+	// MaxMessageLength is the longest message text, in characters, the
+	// server accepts.
+	MaxMessageLength int `json:"max_message_length"`
+	// P2PCalls says direct room calls may run peer to peer.
+	P2PCalls bool `json:"p2p_calls"`
+	// SyncToken is the point this response was read at. A room socket
+	// opened with ?since=<sync_token> replays what was sent after it.
+	SyncToken string `json:"sync_token"`
+}
+
+// bootstrap returns everything the app loads at startup in one response,
+// instead of separate /me, /groups, /rooms, /dm/rooms and /friends calls.
+func (s *Server) bootstrap(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	ctx := r.Context()
+
+	// The snapshot is taken before anything else is read, so everything
+	// below is at least as new as it and a resume may only repeat messages.
+	syncToken, err := randomToken(16)
+	if err == nil {
+		err = s.Store.CreateSyncSnapshot(ctx, syncToken, user.ID)
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to create sync token")
+		return
+	}
+
+	u, err := s.Store.FindUserByID(ctx, user.ID)
+	if err != nil {
+		jsonError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	u.PasswordHash = ""
+	locale, err := s.Store.GetUserLocale(ctx, user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load locale")
+		return
+	}
+
+	groups, err := s.Store.ListRoomGroupsForUser(ctx, user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load groups")
+		return
+	}
+	rooms, err := s.Store.ListRoomsForUser(ctx, user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load rooms")
+		return
+	}
+	dms, err := s.Store.ListDirectRoomsForUser(ctx, user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load dms")
+		return
+	}
+	friends, err := s.Store.ListFriends(ctx, user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load friends")
+		return
+	}
+	incoming, err := s.Store.ListIncomingFriendRequests(ctx, user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load friend requests")
+		return
+	}
+
+	roomIDs := make([]uuid.UUID, 0, len(rooms)+len(dms))
+	for _, room := range rooms {
+		roomIDs = append(roomIDs, room.ID)
+	}
+	for _, room := range dms {
+		roomIDs = append(roomIDs, room.ID)
+	}
+	for _, g := range groups {
+		for _, ch := range g.TextChannels {
+			roomIDs = append(roomIDs, ch.ID)
+		}
+	}
+	lastMessages, err := s.Store.ListLastMessages(ctx, user.ID, roomIDs)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load last messages")
+		return
+	}
+	if hide, err := s.hidesNSFW(ctx, user.ID); err == nil && hide {
+		for roomID, m := range lastMessages {
+			lastMessages[roomID] = db.WithholdNSFWMedia([]db.Message{m})[0]
+		}
+	}
+	for roomID, m := range lastMessages {
+		lastMessages[roomID] = s.maskFor(ctx, roomID, user.ID, []db.Message{m})[0]
+	}
+
+	jsonResponse(w, http.StatusOK, bootstrapResponse{
+		User:         u,
+		Groups:       groups,
+		Rooms:        rooms,
+		DMs:          dms,
+		Friends:      friends,
+		Incoming:     incoming,
+		LastMessages: lastMessages,
+		FeatureFlags: s.Cfg.FeatureFlags.For(user.ID),
+		Locale:       locale,
+
+		MaxMessageLength: s.Cfg.MaxMessageLength,
+		P2PCalls:         s.Cfg.P2PCalls,
+		SyncToken:        syncToken,
+	})
+}
@@ -0,0 +1,183 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// canReadRoom reports whether userID may read roomID's messages: members
+// always, subscribers while it is a broadcast room.
+func (s *Server) canReadRoom(ctx context.Context, roomID, userID uuid.UUID) (bool, error) {
+	member, err := s.Store.IsRoomMember(ctx, roomID, userID)
+	if err != nil || member {
+		return member, err
+	}
+	return s.Store.IsRoomSubscriber(ctx, roomID, userID)
+}
+
+func (s *Server) getRoomBroadcast(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return
+	}
+	room, err := s.Store.GetRoomByID(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusNotFound, "room not found")
+		return
+	}
+	on, err := s.Store.IsBroadcastRoom(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load room")
+		return
+	}
+	member, err := s.Store.IsRoomMember(r.Context(), roomID, user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check membership")
+		return
+	}
+	subscribed, err := s.Store.IsRoomSubscriber(r.Context(), roomID, user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check subscription")
+		return
+	}
+	// Anyone may look up a public broadcast room before subscribing.
+	if !member && !subscribed && (!on || room.IsPrivate) {
+		jsonError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+	count, err := s.Store.CountRoomSubscribers(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to count subscribers")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{
+		"enabled":          on,
+		"subscriber_count": count,
+		"subscribed":       subscribed,
+		"publisher":        member,
+	})
+}
+
+// setRoomBroadcast turns a room into a broadcast room, where only its
+// members post, or back. Sockets already open keep the old setting.
+func (s *Server) setRoomBroadcast(w http.ResponseWriter, r *http.Request) {
+	roomID, _, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	direct, err := s.Store.IsDirectRoom(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check room type")
+		return
+	}
+	if direct {
+		jsonError(w, http.StatusBadRequest, "direct messages cannot be broadcast rooms")
+		return
+	}
+	if err := s.Store.SetRoomBroadcast(r.Context(), roomID, req.Enabled); err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to save room")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]bool{"enabled": req.Enabled})
+}
+
+// subscribeRoom follows a public broadcast room. Private ones are followed
+// through their invite links.
+func (s *Server) subscribeRoom(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return
+	}
+	room, err := s.Store.GetRoomByID(r.Context(), roomID)
+	if err != nil || room.IsPrivate {
+		jsonError(w, http.StatusNotFound, "broadcast room not found")
+		return
+	}
+	if _, ok := s.nsfwAccess(w, r, roomID, user.ID); !ok {
+		return
+	}
+	s.subscribe(w, r, roomID, user.ID)
+}
+
+// subscribe records the subscription and answers with the room's new
+// subscriber count.
+func (s *Server) subscribe(w http.ResponseWriter, r *http.Request, roomID, userID uuid.UUID) {
+	if err := s.Store.SubscribeRoom(r.Context(), roomID, userID); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "broadcast room not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to subscribe")
+		return
+	}
+	s.Hub.SetChannelSubscription(userID, roomID, true)
+	count, err := s.Store.CountRoomSubscribers(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to count subscribers")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"status": "subscribed", "room_id": roomID, "subscriber_count": count})
+}
+
+func (s *Server) unsubscribeRoom(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return
+	}
+	if err := s.Store.UnsubscribeRoom(r.Context(), roomID, user.ID); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "subscription not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to unsubscribe")
+		return
+	}
+	s.Hub.SetChannelSubscription(user.ID, roomID, false)
+	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+func (s *Server) listMySubscriptions(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	rooms, err := s.Store.ListSubscribedRooms(r.Context(), user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load subscriptions")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"rooms": rooms})
+}
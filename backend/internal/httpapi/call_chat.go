@@ -0,0 +1,67 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// getCallChatSettings tells any member whether call chat in the room is
+// kept in its history after the call.
+func (s *Server) getCallChatSettings(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return
+	}
+	member, err := s.Store.IsRoomMember(r.Context(), roomID, user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check membership")
+		return
+	}
+	if !member {
+		jsonError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+	persist, err := s.Store.GetRoomPersistCallChat(r.Context(), roomID)
+	if err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "room not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to load room")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]bool{"persist": persist})
+}
+
+// setCallChatSettings applies to calls that end after the change, including
+// one already running.
+func (s *Server) setCallChatSettings(w http.ResponseWriter, r *http.Request) {
+	roomID, _, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Persist bool `json:"persist"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := s.Store.SetRoomPersistCallChat(r.Context(), roomID, req.Persist); err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to save room")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]bool{"persist": req.Persist})
+}
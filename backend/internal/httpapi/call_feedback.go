@@ -0,0 +1,112 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const maxCallStatsDays = 365
+
+// submitCallFeedback stores a member's rating of a call they took part in,
+// answering the call_feedback_request sent when they left it.
+func (s *Server) submitCallFeedback(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return
+	}
+	var req struct {
+		CallID        string   `json:"call_id"`
+		Rating        int      `json:"rating"`
+		Tags          []string `json:"tags"`
+		ClientVersion string   `json:"client_version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	callID, err := uuid.Parse(req.CallID)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid call id")
+		return
+	}
+	if req.Rating < 1 || req.Rating > 5 {
+		jsonError(w, http.StatusBadRequest, "rating must be between 1 and 5")
+		return
+	}
+	tags := make([]string, 0, len(req.Tags))
+	for _, tag := range req.Tags {
+		if !slices.Contains(db.CallFeedbackTags, tag) {
+			jsonError(w, http.StatusBadRequest, "tags must be among "+strings.Join(db.CallFeedbackTags, ", "))
+			return
+		}
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	version := strings.TrimSpace(req.ClientVersion)
+	if len(version) > 64 {
+		jsonError(w, http.StatusBadRequest, "client_version is too long")
+		return
+	}
+
+	member, err := s.Store.IsRoomMember(r.Context(), roomID, user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check membership")
+		return
+	}
+	if !member {
+		jsonError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+	err = s.Store.SaveCallFeedback(r.Context(), db.CallFeedback{
+		CallID:        callID,
+		RoomID:        roomID,
+		UserID:        user.ID,
+		Rating:        req.Rating,
+		Tags:          tags,
+		LiveKitURL:    s.roomCallURL(r.Context(), roomID),
+		ClientVersion: version,
+	})
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to save feedback")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+// callFeedbackStats aggregates call ratings over the last ?days (default
+// 30) for instance administrators.
+func (s *Server) callFeedbackStats(w http.ResponseWriter, r *http.Request) {
+	days := 30
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxCallStatsDays {
+			jsonError(w, http.StatusBadRequest, "days must be between 1 and 365")
+			return
+		}
+		days = n
+	}
+	since := time.Now().AddDate(0, 0, -days)
+	groups, err := s.Store.CallFeedbackStats(r.Context(), since)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load call feedback")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"since": since.UTC(), "groups": groups})
+}
@@ -0,0 +1,40 @@
+package httpapi
+
+import (
+	"context"
+	"log"
+
+	"talkie/backend/internal/notify"
+)
+
+// CanaryChanged tells instance admins that the canary's probe messages
+// stopped getting through, or started again.
+func (s *Server) CanaryChanged(ctx context.Context, healthy bool, failure string) {
+	ctx, cancel := context.WithTimeout(ctx, uptimeAlertDeadline)
+	defer cancel()
+	kind, title, body := "canary.down", "Message delivery is failing", "The canary's probe message did not get through: "+failure
+	if healthy {
+		kind, title, body = "canary.up", "Message delivery has recovered", "The canary's probe messages are getting through again."
+		log.Printf("canary: probes are passing again")
+	} else {
+		log.Printf("canary: probes are failing: %s", failure)
+	}
+
+	admins, err := s.Store.ListInstanceAdminIDs(ctx)
+	if err != nil {
+		log.Printf("canary alert: list admins: %v", err)
+		return
+	}
+	for _, adminID := range admins {
+		n, err := s.Store.CreateNotification(ctx, adminID, kind, title, body, map[string]any{
+			"healthy": healthy,
+			"failure": failure,
+		})
+		if err != nil {
+			log.Printf("canary alert: notify %s: %v", adminID, err)
+			continue
+		}
+		s.Hub.SendNotification(n)
+	}
+	s.Notifier.Dispatch(admins, notify.Event{Kind: kind, Title: title, Body: body})
+}
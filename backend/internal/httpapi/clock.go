@@ -0,0 +1,32 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type timeResponse struct {
+	// ServerTime is when the request was answered, in Unix milliseconds.
+	ServerTime int64 `json:"server_time"`
+	// ClientTime is the request's ?client_time= echoed back, so the
+	// client can measure the round trip without keeping state.
+	ClientTime int64 `json:"client_time,omitempty"`
+}
+
+// getTime tells clients the server clock, so they can label messages
+// relative to it and correct client_sent_at for a device clock that is off.
+// Half the round trip is the usual estimate of the time spent in transit.
+func (s *Server) getTime(w http.ResponseWriter, r *http.Request) {
+	resp := timeResponse{ServerTime: time.Now().UnixMilli()}
+	if raw := r.URL.Query().Get("client_time"); raw != "" {
+		ms, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || ms < 0 {
+			jsonError(w, http.StatusBadRequest, "invalid client_time")
+			return
+		}
+		resp.ClientTime = ms
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	jsonResponse(w, http.StatusOK, resp)
+}
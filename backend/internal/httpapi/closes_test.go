@@ -0,0 +1,191 @@
+package httpapi_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/dbtest"
+	"talkie/backend/internal/httpapi"
+	"talkie/backend/internal/ws"
+	"talkie/backend/internal/ws/wstest"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// openSocket puts an in-memory room socket for userID in the server's hub,
+// as roomWebSocket would after the upgrade.
+func openSocket(t *testing.T, srv *httpapi.Server, roomID, userID uuid.UUID) *wstest.Conn {
+	t.Helper()
+	conn := wstest.NewConn(wstest.NewClock(time.Now()))
+	c := &ws.Client{
+		Conn:   conn,
+		Hub:    srv.Hub,
+		RoomID: roomID,
+		UserID: userID,
+		Send:   make(chan ws.OutgoingMessage, 16),
+	}
+	srv.Hub.Add(c)
+	go c.WritePump()
+	t.Cleanup(func() {
+		srv.Hub.Remove(c)
+		_ = conn.Close()
+	})
+	return conn
+}
+
+// closeCode waits for conn to be closed and returns the code of the close
+// frame the server sent, or 0 when it sent none.
+func closeCode(t *testing.T, conn *wstest.Conn) int {
+	t.Helper()
+	if err := conn.WaitClosed(2 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range conn.Frames() {
+		if f.Type == websocket.CloseMessage && len(f.Data) >= 2 {
+			return int(binary.BigEndian.Uint16(f.Data))
+		}
+	}
+	return 0
+}
+
+func TestLeaveRoomClosesSockets(t *testing.T) {
+	store := dbtest.New()
+	srv := newTestServer(t, store, testConfig())
+	owner, _ := newUser(t, store, "owner")
+	member, token := newUser(t, store, "member")
+	room, err := store.CreateRoom(context.Background(), "general", owner.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.JoinRoom(context.Background(), room.ID, member.ID); err != nil {
+		t.Fatal(err)
+	}
+	leaving := openSocket(t, srv, room.ID, member.ID)
+	staying := openSocket(t, srv, room.ID, owner.ID)
+
+	code, body := do(t, srv.Routes(), http.MethodPost, "/api/rooms/"+room.ID.String()+"/leave", token, nil)
+	if code != http.StatusOK {
+		t.Fatalf("leave = %d %v", code, body)
+	}
+	if got := closeCode(t, leaving); got != ws.CloseMembershipRevoked {
+		t.Fatalf("close code = %d, want %d", got, ws.CloseMembershipRevoked)
+	}
+	if staying.Closed() {
+		t.Fatal("leaving closed the owner's socket")
+	}
+}
+
+func TestDeleteRoomClosesSockets(t *testing.T) {
+	store := dbtest.New()
+	srv := newTestServer(t, store, testConfig())
+	owner, token := newUser(t, store, "owner")
+	member, _ := newUser(t, store, "member")
+	room, err := store.CreateRoom(context.Background(), "general", owner.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.JoinRoom(context.Background(), room.ID, member.ID); err != nil {
+		t.Fatal(err)
+	}
+	conns := []*wstest.Conn{openSocket(t, srv, room.ID, owner.ID), openSocket(t, srv, room.ID, member.ID)}
+
+	code, body := do(t, srv.Routes(), http.MethodDelete, "/api/rooms/"+room.ID.String(), token, nil)
+	if code != http.StatusOK {
+		t.Fatalf("delete = %d %v", code, body)
+	}
+	for _, conn := range conns {
+		if got := closeCode(t, conn); got != ws.CloseRoomDeleted {
+			t.Fatalf("close code = %d, want %d", got, ws.CloseRoomDeleted)
+		}
+	}
+}
+
+func TestSCIMGroupRemovalClosesSockets(t *testing.T) {
+	ctx := context.Background()
+	store := dbtest.New()
+	cfg := testConfig()
+	cfg.SCIMEnabled = true
+	srv := newTestServer(t, store, cfg)
+	admin, _ := newUser(t, store, "admin")
+	room, err := store.CreateRoom(ctx, "engineering", admin.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("scim-token"))
+	if _, err := store.CreateSCIMToken(ctx, "idp", hex.EncodeToString(sum[:]), admin.ID); err != nil {
+		t.Fatal(err)
+	}
+	member, err := store.CreateSCIMUser(ctx, db.SCIMUser{UserName: "member", Email: "member@example.com", Active: true}, "member", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	group, err := store.CreateSCIMGroup(ctx, "Engineering", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.SetSCIMGroupTarget(ctx, group.ID, nil, &room.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, joined, err := store.AddSCIMGroupMembers(ctx, group.ID, []uuid.UUID{member.UserID}); err != nil || len(joined) != 1 {
+		t.Fatalf("add group member: joined %v, err %v", joined, err)
+	}
+	conn := openSocket(t, srv, room.ID, member.UserID)
+
+	req := httptest.NewRequest(http.MethodPatch, "/api/scim/v2/Groups/"+group.ID.String(), strings.NewReader(`{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "remove", "path": "members[value eq \"`+member.UserID.String()+`\"]"}]
+	}`))
+	req.Header.Set("Authorization", "Bearer scim-token")
+	rec := httptest.NewRecorder()
+	srv.Routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK && rec.Code != http.StatusNoContent {
+		t.Fatalf("patch group = %d %s", rec.Code, rec.Body)
+	}
+	if got := closeCode(t, conn); got != ws.CloseMembershipRevoked {
+		t.Fatalf("close code = %d, want %d", got, ws.CloseMembershipRevoked)
+	}
+}
+
+// userGone is a store whose accounts disappear once the socket handshake
+// checked membership, like one deleted during the upgrade.
+type userGone struct {
+	*dbtest.Store
+}
+
+func (userGone) FindUserByID(context.Context, uuid.UUID) (db.User, error) {
+	return db.User{}, db.ErrNotFound
+}
+
+func TestRoomSocketCloses1011WhenUserFailsToLoad(t *testing.T) {
+	store := dbtest.New()
+	srv := newTestServer(t, userGone{store}, testConfig())
+	u, token := newUser(t, store, "member")
+	room, err := store.CreateRoom(context.Background(), "general", u.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv.Routes())
+	defer ts.Close()
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws/rooms/" + room.ID.String() + "?token=" + token
+	conn, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v (response %v)", err, resp)
+	}
+	defer conn.Close()
+	_, _, err = conn.ReadMessage()
+	var ce *websocket.CloseError
+	if !errors.As(err, &ce) || ce.Code != websocket.CloseInternalServerErr {
+		t.Fatalf("read = %v, want close %d", err, websocket.CloseInternalServerErr)
+	}
+}
@@ -0,0 +1,118 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// sendContact posts a "contact" message: a card with another user's
+// name and avatar that members can tap to open their profile. The
+// contact's contact_sharing setting decides who may share them.
+func (s *Server) sendContact(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return
+	}
+	var req struct {
+		UserID uuid.UUID `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == uuid.Nil {
+		jsonError(w, http.StatusBadRequest, "user_id is required")
+		return
+	}
+
+	member, err := s.Store.IsRoomMember(r.Context(), roomID, user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check membership")
+		return
+	}
+	if !member {
+		jsonError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+	direct, err := s.Store.IsDirectRoom(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load room")
+		return
+	}
+
+	contact, err := s.Store.FindUserByID(r.Context(), req.UserID)
+	if err == db.ErrNotFound {
+		jsonError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load user")
+		return
+	}
+	allowed, err := s.canShareContact(r.Context(), user.ID, contact)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check contact settings")
+		return
+	}
+	if !allowed {
+		jsonResponse(w, http.StatusForbidden, map[string]string{
+			"error": "this user's contact cannot be shared",
+			"code":  "contact_not_shareable",
+		})
+		return
+	}
+
+	msg, err := s.Store.SaveContactMessage(r.Context(), roomID, user.ID, contact.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to save message")
+		return
+	}
+	if direct {
+		msg.DeliveryState = "sent"
+	}
+	s.publishMessage(r.Context(), msg)
+	if direct && !msg.Shadowed {
+		s.Hub.DeliverDirect(r.Context(), s.Store, msg)
+	}
+	jsonResponse(w, http.StatusCreated, msg)
+}
+
+// canShareContact reports whether senderID may share contact's card.
+// Anyone may share their own; guests cannot be shared at all.
+func (s *Server) canShareContact(ctx context.Context, senderID uuid.UUID, contact db.User) (bool, error) {
+	if contact.ID == senderID {
+		return true, nil
+	}
+	if contact.GuestExpiresAt != nil {
+		return false, nil
+	}
+	sharing, err := s.Store.GetContactSharing(ctx, contact.ID)
+	if err != nil {
+		return false, err
+	}
+	switch sharing {
+	case db.ContactSharingEveryone:
+		return true, nil
+	case db.ContactSharingFriends:
+		return s.Store.IsFriend(ctx, contact.ID, senderID)
+	default:
+		return false, nil
+	}
+}
+
+func checkContactSharing(sharing string) bool {
+	switch sharing {
+	case db.ContactSharingEveryone, db.ContactSharingFriends, db.ContactSharingNobody:
+		return true
+	}
+	return false
+}
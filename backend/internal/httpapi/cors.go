@@ -0,0 +1,89 @@
+package httpapi
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/cors"
+)
+
+// publicCORSPaths are the unauthenticated /api endpoints meant to be read
+// from other sites, which get the public CORS policy.
+var publicCORSPaths = []string{
+	"/api/embed/",
+	"/api/invite-links/*/preview",
+	"/api/status",
+	"/api/instance",
+	"/api/time",
+	"/healthz",
+}
+
+// corsPolicies picks the CORS policy by route group. It runs before
+// routing, so preflights for any route get the right answer; the groups
+// are therefore told apart by path.
+func (s *Server) corsPolicies(next http.Handler) http.Handler {
+	maxAge := s.Cfg.CORSMaxAgeS
+	api := cors.New(cors.Options{
+		AllowedOrigins:   s.Cfg.AllowedOrigins,
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "Idempotency-Key", "X-Request-Id"},
+		ExposedHeaders:   []string{"Link", "X-Next-Cursor", "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Idempotent-Replayed", "X-Refreshed-Token", "X-Request-Id"},
+		AllowCredentials: true,
+		MaxAge:           maxAge,
+	}).Handler(next)
+	// Public endpoints and media depend on no cookies or tokens, so they
+	// never allow credentials.
+	public := cors.New(cors.Options{
+		AllowedOrigins: s.Cfg.CORSPublicOrigins,
+		AllowedMethods: []string{"GET", "OPTIONS"},
+		AllowedHeaders: []string{"Accept", "Content-Type", "X-Request-Id"},
+		ExposedHeaders: []string{"Retry-After", "X-Request-Id"},
+		MaxAge:         maxAge,
+	}).Handler(next)
+	uploads := cors.New(cors.Options{
+		AllowedOrigins: s.Cfg.CORSUploadOrigins,
+		AllowedMethods: []string{"GET", "HEAD", "OPTIONS"},
+		AllowedHeaders: []string{"Range"},
+		ExposedHeaders: []string{"Content-Length", "Content-Range", "Accept-Ranges"},
+		MaxAge:         maxAge,
+	}).Handler(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/uploads/"), strings.HasPrefix(r.URL.Path, s3MediaPrefix):
+			uploads.ServeHTTP(w, r)
+		case isPublicCORSPath(r.URL.Path):
+			public.ServeHTTP(w, r)
+		default:
+			api.ServeHTTP(w, r)
+		}
+	})
+}
+
+// isPublicCORSPath matches path against publicCORSPaths, where a trailing
+// slash matches everything under it and * one path segment.
+func isPublicCORSPath(path string) bool {
+	for _, p := range publicCORSPaths {
+		if strings.HasSuffix(p, "/") {
+			if strings.HasPrefix(path, p) {
+				return true
+			}
+			continue
+		}
+		pattern, segments := strings.Split(p, "/"), strings.Split(path, "/")
+		if len(pattern) != len(segments) {
+			continue
+		}
+		match := true
+		for i := range pattern {
+			if pattern[i] != "*" && pattern[i] != segments[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
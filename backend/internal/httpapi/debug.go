@@ -0,0 +1,56 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strconv"
+
+	"talkie/backend/internal/ws"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultDebugRooms = 100
+	maxDebugRooms     = 1000
+)
+
+// DebugRoutes serves net/http/pprof under /pprof/ and a dump of the hub at
+// /hub. Instance admins reach them under /api/admin/debug; DEBUG_ADDR
+// serves them under /debug with no auth, for a port kept off the internet.
+func (s *Server) DebugRoutes() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/hub", s.debugHub)
+	r.Get("/pprof/", pprof.Index)
+	r.Get("/pprof/cmdline", pprof.Cmdline)
+	r.Get("/pprof/profile", pprof.Profile)
+	r.Get("/pprof/symbol", pprof.Symbol)
+	r.Post("/pprof/symbol", pprof.Symbol)
+	r.Get("/pprof/trace", pprof.Trace)
+	// goroutine?debug=2 dumps every goroutine's stack, and heap?gc=1 a
+	// heap profile after a collection.
+	r.Get("/pprof/{profile}", func(w http.ResponseWriter, r *http.Request) {
+		pprof.Handler(chi.URLParam(r, "profile")).ServeHTTP(w, r)
+	})
+	return r
+}
+
+type hubDebugResponse struct {
+	Goroutines int `json:"goroutines"`
+	ws.HubDump
+}
+
+// debugHub dumps the hub's sockets and pump goroutines. ?rooms= caps the
+// rooms listed, largest first; ?events=1 lists events sockets too.
+func (s *Server) debugHub(w http.ResponseWriter, r *http.Request) {
+	rooms, err := strconv.Atoi(r.URL.Query().Get("rooms"))
+	if err != nil || rooms < 0 {
+		rooms = defaultDebugRooms
+	}
+	events := r.URL.Query().Get("events") == "1"
+	jsonResponse(w, http.StatusOK, hubDebugResponse{
+		Goroutines: runtime.NumGoroutine(),
+		HubDump:    s.Hub.Dump(min(rooms, maxDebugRooms), events),
+	})
+}
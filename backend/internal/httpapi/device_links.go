@@ -0,0 +1,201 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Device linking signs in a new device without a password. A signed-in
+// device creates a code and shows it as a QR code; the new device opens it,
+// claims the code and polls POST /api/auth/link/{code} until the user
+// approves the request on the first device.
+
+const (
+	deviceLinkTTL           = 5 * time.Minute
+	maxDeviceNameLength     = 80
+	deviceLinkPollIntervalS = 2
+)
+
+func (s *Server) createDeviceLink(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	code, err := randomToken(16)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to create link code")
+		return
+	}
+	link, err := s.Store.CreateDeviceLink(r.Context(), user.ID, tokenHash(code), time.Now().UTC().Add(deviceLinkTTL))
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to create link code")
+		return
+	}
+	jsonResponse(w, http.StatusCreated, map[string]any{
+		"code":       code,
+		"link_url":   fmt.Sprintf("%s?link=%s", strings.TrimRight(s.Cfg.FrontendBaseURL, "/"), code),
+		"expires_at": link.ExpiresAt.Format(time.RFC3339),
+	})
+}
+
+// getDeviceLink lets the first device watch for a claim so it can ask the
+// user to approve it.
+func (s *Server) getDeviceLink(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	link, err := s.Store.GetDeviceLink(r.Context(), user.ID, tokenHash(chi.URLParam(r, "code")))
+	if err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "link code not found or expired")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to load link code")
+		return
+	}
+	jsonResponse(w, http.StatusOK, deviceLinkStatus(link))
+}
+
+func (s *Server) approveDeviceLink(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	link, err := s.Store.ApproveDeviceLink(r.Context(), user.ID, tokenHash(chi.URLParam(r, "code")))
+	if err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "no device is waiting for approval")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to approve device")
+		return
+	}
+	jsonResponse(w, http.StatusOK, deviceLinkStatus(link))
+}
+
+func (s *Server) deleteDeviceLink(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	if err := s.Store.DeleteDeviceLink(r.Context(), user.ID, tokenHash(chi.URLParam(r, "code"))); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "link code not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to cancel link code")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+// pollDeviceLink is called by the new device. The first call claims the code
+// and returns a claim secret; later calls must present it, so nobody else
+// who sees the code can collect the token. Once approved the response
+// carries the token, exactly once.
+func (s *Server) pollDeviceLink(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Claim      string `json:"claim"`
+		DeviceName string `json:"device_name"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+	codeHash := tokenHash(chi.URLParam(r, "code"))
+
+	if req.Claim == "" {
+		claim, err := randomToken(24)
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "failed to claim link code")
+			return
+		}
+		name := strings.TrimSpace(req.DeviceName)
+		if name == "" {
+			name = describeUserAgent(r.UserAgent())
+		}
+		if utf8.RuneCountInString(name) > maxDeviceNameLength {
+			name = string([]rune(name)[:maxDeviceNameLength])
+		}
+		link, err := s.Store.ClaimDeviceLink(r.Context(), codeHash, tokenHash(claim), name)
+		if err != nil {
+			if err == db.ErrNotFound {
+				jsonError(w, http.StatusNotFound, "link code not found, expired or already used")
+				return
+			}
+			jsonError(w, http.StatusInternalServerError, "failed to claim link code")
+			return
+		}
+		jsonResponse(w, http.StatusAccepted, map[string]any{
+			"status":        "pending",
+			"claim":         claim,
+			"expires_at":    link.ExpiresAt.Format(time.RFC3339),
+			"poll_interval": deviceLinkPollIntervalS,
+		})
+		return
+	}
+
+	link, err := s.Store.PollDeviceLink(r.Context(), codeHash, tokenHash(req.Claim))
+	if err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "link code not found or expired")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to check link code")
+		return
+	}
+	if link.ConsumedAt == nil {
+		jsonResponse(w, http.StatusAccepted, map[string]any{
+			"status":        "pending",
+			"expires_at":    link.ExpiresAt.Format(time.RFC3339),
+			"poll_interval": deviceLinkPollIntervalS,
+		})
+		return
+	}
+
+	u, err := s.Store.FindUserByID(r.Context(), link.UserID)
+	if err != nil {
+		jsonError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	token, err := s.issueToken(r.Context(), u, u.SessionVersion)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to generate token")
+		return
+	}
+	go s.recordLogin(u, s.loginContextFromRequest(r))
+
+	u.PasswordHash = ""
+	jsonResponse(w, http.StatusOK, authResponse{Token: token, User: u})
+}
+
+func deviceLinkStatus(link db.DeviceLink) map[string]any {
+	status := "waiting"
+	switch {
+	case link.ApprovedAt != nil:
+		status = "approved"
+	case link.ClaimedAt != nil:
+		status = "claimed"
+	}
+	return map[string]any{
+		"status":      status,
+		"device_name": link.DeviceName,
+		"expires_at":  link.ExpiresAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,242 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"talkie/backend/internal/alttext"
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+	"talkie/backend/internal/quota"
+	"talkie/backend/internal/s3"
+	"talkie/backend/internal/textnorm"
+	"talkie/backend/internal/ws"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// directUploadTypes are the content types clients may upload straight to
+// the bucket, and the message type each is posted as.
+var directUploadTypes = map[string]string{
+	"image/png":  "image",
+	"image/jpeg": "image",
+	"image/webp": "image",
+	"image/gif":  "image",
+	"audio/webm": "audio",
+	"audio/ogg":  "audio",
+	"audio/mp4":  "audio",
+	"audio/mpeg": "audio",
+	"audio/wav":  "audio",
+	"video/mp4":  "file",
+	"video/webm": "file",
+}
+
+// directUploadLimit is the plan's upload limit without the ceiling that
+// applies to uploads through this server, or S3_MAX_UPLOAD_MB when the plan
+// is unlimited.
+func (s *Server) directUploadLimit(l quota.Limits) int64 {
+	if l.MaxUploadBytes > 0 {
+		return l.MaxUploadBytes
+	}
+	return int64(s.Cfg.S3MaxUploadMB) << 20
+}
+
+// directUploadRoom parses {roomID} and checks the caller may post media
+// there. It writes the error response when ok is false.
+func (s *Server) directUploadRoom(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return uuid.Nil, uuid.Nil, false
+	}
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return uuid.Nil, uuid.Nil, false
+	}
+	member, err := s.Store.IsRoomMember(r.Context(), roomID, user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check membership")
+		return uuid.Nil, uuid.Nil, false
+	}
+	if !member {
+		jsonError(w, http.StatusForbidden, "forbidden")
+		return uuid.Nil, uuid.Nil, false
+	}
+	return roomID, user.ID, true
+}
+
+// presignUpload hands out a form the client posts the file to directly.
+// The bucket enforces the type and size; completeUpload posts the message.
+func (s *Server) presignUpload(w http.ResponseWriter, r *http.Request) {
+	roomID, userID, ok := s.directUploadRoom(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		ContentType string `json:"content_type"`
+		Size        int64  `json:"size"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	req.ContentType = strings.ToLower(strings.TrimSpace(req.ContentType))
+	messageType, allowed := directUploadTypes[req.ContentType]
+	if !allowed {
+		jsonError(w, http.StatusBadRequest, "this content type cannot be uploaded directly")
+		return
+	}
+	if !s.checkMediaType(w, r, roomID, req.ContentType) {
+		return
+	}
+	if messageType == "image" && s.NSFW != nil {
+		// The classifier needs the bytes, which never reach this server.
+		jsonError(w, http.StatusBadRequest, "images must be uploaded through /images on this server")
+		return
+	}
+	if req.Size <= 0 {
+		jsonError(w, http.StatusBadRequest, "size is required")
+		return
+	}
+
+	region, err := s.Store.GetRoomRegion(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load room")
+		return
+	}
+	if _, pinned := s.Uploads.Region(region); pinned {
+		jsonError(w, http.StatusConflict, "this room keeps its media in region "+region+" and cannot use direct uploads")
+		return
+	}
+
+	limits, err := s.roomLimits(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load quota")
+		return
+	}
+	limit := s.directUploadLimit(limits)
+	if req.Size > limit {
+		quotaError(w, &quota.ExceededError{Quota: quota.MaxUploadBytes, Limit: limit, Used: req.Size})
+		return
+	}
+
+	now := time.Now()
+	upload := db.DirectUpload{
+		Key:         fmt.Sprintf("rooms/%s/%s", roomID, uuid.NewString()),
+		RoomID:      roomID,
+		UserID:      userID,
+		ContentType: req.ContentType,
+		MessageType: messageType,
+		MaxBytes:    limit,
+		ExpiresAt:   now.Add(time.Duration(s.Cfg.S3FormTTLS) * time.Second),
+	}
+	form, err := s.S3.PresignPost(upload.Key, upload.ContentType, upload.MaxBytes, now, upload.ExpiresAt)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to sign upload")
+		return
+	}
+	if err := s.Store.CreateDirectUpload(r.Context(), upload); err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to save upload")
+		return
+	}
+	jsonResponse(w, http.StatusCreated, map[string]any{
+		"key":          upload.Key,
+		"url":          form.URL,
+		"fields":       form.Fields,
+		"expires_at":   upload.ExpiresAt,
+		"complete_url": fmt.Sprintf("/api/rooms/%s/uploads/complete", roomID),
+	})
+}
+
+// completeUpload checks the object reached the bucket and posts it as a
+// message, once.
+func (s *Server) completeUpload(w http.ResponseWriter, r *http.Request) {
+	roomID, userID, ok := s.directUploadRoom(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Key     string `json:"key"`
+		Caption string `json:"caption"`
+		AltText string `json:"alt_text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	req.Caption = strings.TrimSpace(textnorm.Message(req.Caption))
+	if !s.checkMessageLength(w, req.Caption) {
+		return
+	}
+	altText, ok := parseAltText(w, req.AltText)
+	if !ok {
+		return
+	}
+	upload, err := s.Store.GetDirectUpload(r.Context(), req.Key)
+	if err != nil || upload.RoomID != roomID || upload.UserID != userID {
+		if err != nil && err != db.ErrNotFound {
+			jsonError(w, http.StatusInternalServerError, "failed to load upload")
+			return
+		}
+		jsonError(w, http.StatusNotFound, "upload not found or expired")
+		return
+	}
+	obj, err := s.S3.Head(r.Context(), upload.Key)
+	if err != nil {
+		if errors.Is(err, s3.ErrNotFound) {
+			jsonError(w, http.StatusConflict, "the file has not been uploaded yet")
+			return
+		}
+		log.Printf("direct upload %s: %v", upload.Key, err)
+		jsonError(w, http.StatusBadGateway, "failed to check the uploaded file")
+		return
+	}
+	if obj.Size > upload.MaxBytes {
+		jsonError(w, http.StatusBadRequest, "the uploaded file is larger than allowed")
+		return
+	}
+	// The room's media policy may have changed since the form was signed.
+	if !s.checkMediaType(w, r, roomID, upload.ContentType) {
+		return
+	}
+	if err := s.Store.DeleteDirectUpload(r.Context(), upload.Key); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusConflict, "upload already completed")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to complete upload")
+		return
+	}
+
+	msg, err := s.Store.SaveMessageWithType(r.Context(), roomID, userID, req.Caption, upload.MessageType, s.s3MediaURL(upload.Key))
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to create message")
+		return
+	}
+	if msg.MessageType == "image" {
+		s.attachAltText(r.Context(), &msg, altText, upload.ContentType, func(ctx context.Context) ([]byte, error) {
+			if obj.Size > alttext.MaxImageBytes {
+				return nil, alttext.ErrTooLarge
+			}
+			return s.S3.Get(ctx, upload.Key)
+		})
+	}
+	s.History.Append(msg)
+	payload := ws.PayloadFromMessage(msg)
+	if msg.Shadowed {
+		s.Hub.SendToRoomUser(roomID, userID, ws.ChatEvent{Message: payload})
+		jsonResponse(w, http.StatusCreated, msg)
+		return
+	}
+	s.Hub.Broadcast(roomID, ws.ChatEvent{Message: payload})
+	s.broadcastRoomMessageEvent(r.Context(), msg)
+	jsonResponse(w, http.StatusCreated, msg)
+}
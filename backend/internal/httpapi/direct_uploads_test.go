@@ -0,0 +1,36 @@
+package httpapi_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"talkie/backend/internal/dbtest"
+)
+
+func TestPresignRefusesRegionRooms(t *testing.T) {
+	store := dbtest.New()
+	cfg := testConfig()
+	cfg.S3Bucket = "media"
+	cfg.S3MaxUploadMB = 1024
+	cfg.S3FormTTLS = 900
+	cfg.RegionUploadDirs = map[string]string{"eu": t.TempDir()}
+	h := newTestServer(t, store, cfg).Routes()
+	u, token := newUser(t, store, "owner")
+	room, err := store.CreateRoom(context.Background(), "general", u.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := map[string]any{"content_type": "video/mp4", "size": 1 << 20}
+	path := "/api/rooms/" + room.ID.String() + "/uploads/presign"
+
+	if code, resp := do(t, h, http.MethodPost, path, token, body); code != http.StatusCreated {
+		t.Fatalf("presign = %d %v, want 201", code, resp)
+	}
+	if err := store.SetRoomRegion(context.Background(), room.ID, "eu"); err != nil {
+		t.Fatal(err)
+	}
+	if code, resp := do(t, h, http.MethodPost, path, token, body); code != http.StatusConflict {
+		t.Fatalf("presign in a region room = %d %v, want 409", code, resp)
+	}
+}
@@ -0,0 +1,208 @@
+package httpapi
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// ediscoveryFlushEvery is how many messages are written between flushes,
+// so a large export reaches the client as it is read.
+const ediscoveryFlushEvery = 500
+
+var ediscoveryColumns = []string{
+	"id", "created_at", "client_sent_at", "room_id", "room_name", "user_id", "username",
+	"message_type", "content", "content_as_typed", "media_url", "shadowed",
+}
+
+// exportWriteTimeout is how long a client may take to read each batch of
+// an export before it is cut off, so one that stops reading does not keep
+// the handler around.
+const exportWriteTimeout = time.Minute
+
+// exportUserMessages streams every message a user posted across all rooms
+// within from and to (YYYY-MM-DD, a whole day in UTC, or RFC 3339) as CSV
+// or JSON, for compliance review. Unlike what members can read, shadowed
+// messages are included. Each export is recorded as a security event on
+// the user before anything is sent.
+func (s *Server) exportUserMessages(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(chi.URLParam(r, "userID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	f, format, ok := parseMessageExport(w, r)
+	if !ok {
+		return
+	}
+	if _, err := s.Store.FindUserByID(r.Context(), userID); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to load user")
+		return
+	}
+	f.UserID = userID
+	s.streamMessageExport(w, r, f, format, "user "+userID.String(), fmt.Sprintf("messages-%s", userID))
+}
+
+// exportRoomMessages is exportUserMessages for everything posted in a
+// room. The security event is recorded without a user.
+func (s *Server) exportRoomMessages(w http.ResponseWriter, r *http.Request) {
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return
+	}
+	f, format, ok := parseMessageExport(w, r)
+	if !ok {
+		return
+	}
+	if _, err := s.Store.GetRoomByID(r.Context(), roomID); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "room not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to load room")
+		return
+	}
+	f.RoomID = roomID
+	s.streamMessageExport(w, r, f, format, "room "+roomID.String(), fmt.Sprintf("room-messages-%s", roomID))
+}
+
+// parseMessageExport reads the format and date range of an export. It
+// writes the response when it returns false.
+func parseMessageExport(w http.ResponseWriter, r *http.Request) (db.MessageExport, string, bool) {
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		jsonError(w, http.StatusBadRequest, "format must be csv or json")
+		return db.MessageExport{}, "", false
+	}
+	to := time.Now().UTC()
+	if raw := q.Get("to"); raw != "" {
+		t, dateOnly, err := parseDateOrTime(raw, time.UTC)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, "to must be YYYY-MM-DD or an RFC 3339 time")
+			return db.MessageExport{}, "", false
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		to = t
+	}
+	var from time.Time
+	if raw := q.Get("from"); raw != "" {
+		var err error
+		from, _, err = parseDateOrTime(raw, time.UTC)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, "from must be YYYY-MM-DD or an RFC 3339 time")
+			return db.MessageExport{}, "", false
+		}
+	}
+	if !from.Before(to) {
+		jsonError(w, http.StatusBadRequest, "from must be before to")
+		return db.MessageExport{}, "", false
+	}
+	return db.MessageExport{From: from, To: to}, format, true
+}
+
+// streamMessageExport records the export of subject's messages and writes
+// them as they are read. Writes block while the client is behind, which
+// holds back the next batch; each flush gives the client
+// exportWriteTimeout to take it.
+func (s *Server) streamMessageExport(w http.ResponseWriter, r *http.Request, f db.MessageExport, format, subject, filePrefix string) {
+	admin, _ := middleware.UserFromContext(r.Context())
+	lc := s.loginContextFromRequest(r)
+	ev := db.SecurityEvent{
+		Kind: "ediscovery_export", IP: lc.IP, Country: lc.Country, UserAgent: lc.UserAgent,
+		Detail: fmt.Sprintf("admin %s exported messages from %s to %s as %s", admin.ID, f.From.Format(time.RFC3339), f.To.Format(time.RFC3339), format),
+	}
+	if f.UserID != uuid.Nil {
+		ev.UserID = &f.UserID
+	}
+	if f.RoomID != uuid.Nil {
+		ev.Detail = fmt.Sprintf("admin %s exported messages of room %s from %s to %s as %s", admin.ID, f.RoomID, f.From.Format(time.RFC3339), f.To.Format(time.RFC3339), format)
+	}
+	if err := s.Store.RecordSecurityEvent(r.Context(), ev); err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to record export")
+		return
+	}
+	log.Printf("admin %s exported messages of %s from %s to %s", admin.ID, subject, f.From.Format(time.RFC3339), f.To.Format(time.RFC3339))
+
+	filename := fmt.Sprintf("%s-%s-%s.%s", filePrefix, f.From.Format("20060102"), f.To.Format("20060102"), format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.Header().Set("Cache-Control", "no-store")
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+	flush := func() {
+		_ = rc.Flush()
+		_ = rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+	}
+	n := 0
+	var err error
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		cw := csv.NewWriter(w)
+		_ = cw.Write(ediscoveryColumns)
+		err = s.Store.ExportMessages(r.Context(), f, func(m db.DiscoveredMessage) error {
+			sentAt := ""
+			if m.ClientSentAt != nil {
+				sentAt = m.ClientSentAt.UTC().Format(time.RFC3339Nano)
+			}
+			if err := cw.Write([]string{
+				strconv.FormatInt(m.ID, 10), m.CreatedAt.UTC().Format(time.RFC3339Nano), sentAt,
+				m.RoomID.String(), m.RoomName, m.UserID.String(), m.Username,
+				m.MessageType, m.Content, m.ContentAsTyped, m.MediaURL, strconv.FormatBool(m.Shadowed),
+			}); err != nil {
+				return err
+			}
+			if n++; n%ediscoveryFlushEvery == 0 {
+				cw.Flush()
+				flush()
+			}
+			return cw.Error()
+		})
+		cw.Flush()
+	} else {
+		// A JSON array written as it goes; an export cut short by an error
+		// ends without its closing bracket rather than looking complete.
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte("["))
+		enc := json.NewEncoder(w)
+		err = s.Store.ExportMessages(r.Context(), f, func(m db.DiscoveredMessage) error {
+			if n > 0 {
+				if _, err := w.Write([]byte(",")); err != nil {
+					return err
+				}
+			}
+			if err := enc.Encode(m); err != nil {
+				return err
+			}
+			if n++; n%ediscoveryFlushEvery == 0 {
+				flush()
+			}
+			return nil
+		})
+		if err == nil {
+			_, _ = w.Write([]byte("]\n"))
+		}
+	}
+	if err != nil {
+		log.Printf("e-discovery export of %s stopped after %d messages: %v", subject, n, err)
+	}
+}
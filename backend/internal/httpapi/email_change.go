@@ -0,0 +1,214 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"talkie/backend/internal/auth"
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+)
+
+// Email changes are two-phase: the new address must be verified before it
+// replaces the old one, and the old address is told about the request with
+// a link that undoes it. A typo therefore never locks anyone out.
+
+func (s *Server) getEmailChange(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	u, err := s.Store.FindUserByID(r.Context(), user.ID)
+	if err != nil {
+		jsonError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	resp := map[string]any{"email": u.Email, "pending": nil}
+	pending, err := s.Store.GetPendingEmailChange(r.Context(), user.ID)
+	if err != nil && err != db.ErrNotFound {
+		jsonError(w, http.StatusInternalServerError, "failed to load email change")
+		return
+	}
+	if err == nil {
+		resp["pending"] = pending
+	}
+	jsonResponse(w, http.StatusOK, resp)
+}
+
+func (s *Server) requestEmailChange(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	if s.ldapManaged(w) {
+		return
+	}
+	var req struct {
+		NewEmail        string `json:"new_email"`
+		CurrentPassword string `json:"current_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	req.NewEmail = strings.TrimSpace(strings.ToLower(req.NewEmail))
+	if addr, err := mail.ParseAddress(req.NewEmail); err != nil || addr.Address != req.NewEmail {
+		jsonError(w, http.StatusBadRequest, "a valid new_email is required")
+		return
+	}
+	u, err := s.Store.FindUserByID(r.Context(), user.ID)
+	if err != nil {
+		jsonError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if err := auth.VerifyPassword(u.PasswordHash, req.CurrentPassword); err != nil {
+		jsonError(w, http.StatusForbidden, "current password is incorrect")
+		return
+	}
+	if req.NewEmail == u.Email {
+		jsonError(w, http.StatusBadRequest, "new_email is the current address")
+		return
+	}
+
+	verifyToken, err := randomToken(24)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to create token")
+		return
+	}
+	rollbackToken, err := randomToken(24)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to create token")
+		return
+	}
+	change, err := s.Store.CreateEmailChange(r.Context(), u.ID, u.Email, req.NewEmail, tokenHash(verifyToken), tokenHash(rollbackToken))
+	if err != nil {
+		if err == db.ErrEmailTaken {
+			jsonError(w, http.StatusConflict, "email already in use")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to start email change")
+		return
+	}
+
+	if err := s.sendEmailChangeConfirmation(change.NewEmail, verifyToken); err != nil {
+		log.Printf("failed to send email change confirmation to %s: %v", change.NewEmail, err)
+	}
+	if err := s.sendEmailChangeNotice(change.OldEmail, change.NewEmail, rollbackToken); err != nil {
+		log.Printf("failed to send email change notice to %s: %v", change.OldEmail, err)
+	}
+	jsonResponse(w, http.StatusAccepted, map[string]any{"pending": change})
+}
+
+func (s *Server) cancelEmailChange(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	if err := s.Store.CancelPendingEmailChange(r.Context(), user.ID); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "no pending email change")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to cancel email change")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+// confirmEmailChange is reached from the link sent to the new address and
+// does not require a session, so it works from another device or browser.
+func (s *Server) confirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	req.Token = strings.TrimSpace(req.Token)
+	if req.Token == "" {
+		jsonError(w, http.StatusBadRequest, "token is required")
+		return
+	}
+	change, err := s.Store.ConfirmEmailChange(r.Context(), tokenHash(req.Token))
+	if err != nil {
+		switch err {
+		case db.ErrNotFound:
+			jsonError(w, http.StatusBadRequest, "invalid or expired link")
+		case db.ErrEmailTaken:
+			jsonError(w, http.StatusConflict, "email already in use")
+		default:
+			jsonError(w, http.StatusInternalServerError, "failed to change email")
+		}
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]string{"email": change.NewEmail})
+}
+
+// revertEmailChange is reached from the link sent to the old address. If the
+// change had already been applied, the address is restored and all sessions
+// are revoked.
+func (s *Server) revertEmailChange(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	req.Token = strings.TrimSpace(req.Token)
+	if req.Token == "" {
+		jsonError(w, http.StatusBadRequest, "token is required")
+		return
+	}
+	change, err := s.Store.RollbackEmailChange(r.Context(), tokenHash(req.Token))
+	if err != nil {
+		switch err {
+		case db.ErrNotFound:
+			jsonError(w, http.StatusBadRequest, "invalid or expired link")
+		case db.ErrEmailTaken:
+			jsonError(w, http.StatusConflict, "the previous email is now used by another account")
+		default:
+			jsonError(w, http.StatusInternalServerError, "failed to revert email change")
+		}
+		return
+	}
+	reverted := change.VerifiedAt != nil
+	if reverted {
+		s.Hub.RevokeSessions(change.UserID, 0)
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"email": change.OldEmail, "reverted": reverted})
+}
+
+func (s *Server) sendEmailChangeConfirmation(to, token string) error {
+	link := fmt.Sprintf("%s/confirm-email?token=%s", strings.TrimRight(s.Cfg.FrontendBaseURL, "/"), token)
+	subject := "Confirm your new Talkie email"
+	body := fmt.Sprintf("Open this link to use this address for your Talkie account:\n\n%s\n\nThe link expires in 24 hours. Until then your old address stays active.\n", link)
+
+	if !s.Mailer.Enabled() {
+		log.Printf("email change confirmation link for %s: %s", to, link)
+		return nil
+	}
+	return s.Mailer.Send(to, subject, body)
+}
+
+func (s *Server) sendEmailChangeNotice(to, newEmail, token string) error {
+	link := fmt.Sprintf("%s/revert-email?token=%s", strings.TrimRight(s.Cfg.FrontendBaseURL, "/"), token)
+	subject := "Your Talkie email is being changed"
+	body := fmt.Sprintf("Someone asked to change the email of your Talkie account to %s.\n\n"+
+		"If this was not you, open this link to cancel the change and sign out every device:\n\n%s\n\n"+
+		"The link works for 7 days, even after the new address has been confirmed.\n", newEmail, link)
+
+	if !s.Mailer.Enabled() {
+		log.Printf("email change revert link for %s: %s", to, link)
+		return nil
+	}
+	return s.Mailer.Send(to, subject, body)
+}
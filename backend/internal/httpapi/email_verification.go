@@ -0,0 +1,20 @@
+package httpapi
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// verificationEmailLimited writes the structured 429 for an account that
+// has had its hourly share of verification codes.
+func verificationEmailLimited(w http.ResponseWriter, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	jsonResponse(w, http.StatusTooManyRequests, map[string]any{
+		"error":               "too many verification emails, try again later",
+		"code":                "too_many_emails",
+		"retry_after_seconds": seconds,
+	})
+}
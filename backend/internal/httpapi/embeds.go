@@ -0,0 +1,304 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"talkie/backend/internal/db"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultEmbedMessages = 20
+	maxEmbedMessages     = 50
+	// embedPoll is how often a stream checks for new messages. Streams
+	// read the database rather than the hub so they see messages sent
+	// through every instance and never count as room participants.
+	embedPoll = 2 * time.Second
+	// embedKeepalive is how often a quiet stream sends a comment, which
+	// also re-checks that the embed is still on.
+	embedKeepalive = 25 * time.Second
+	// embedStreamLifetime bounds one stream; EventSource reconnects on its
+	// own and resumes from Last-Event-ID.
+	embedStreamLifetime = 30 * time.Minute
+)
+
+// embedMessage is a message as an embed shows it: no user IDs or other
+// member details beyond the name and avatar the room already shows.
+type embedMessage struct {
+	ID          int64     `json:"id"`
+	Username    string    `json:"username"`
+	AvatarURL   string    `json:"avatar_url,omitempty"`
+	Content     string    `json:"content"`
+	MessageType string    `json:"message_type"`
+	MediaURL    string    `json:"media_url,omitempty"`
+	Withheld    bool      `json:"withheld,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (s *Server) getRoomEmbed(w http.ResponseWriter, r *http.Request) {
+	roomID, _, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	e, err := s.Store.GetRoomEmbed(r.Context(), roomID)
+	if err == db.ErrNotFound {
+		jsonResponse(w, http.StatusOK, map[string]bool{"enabled": false})
+		return
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load embed")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"enabled": true, "created_at": e.CreatedAt})
+}
+
+// createRoomEmbed turns on the room's public embed, or rotates its token
+// when it is already on, which breaks every page using the old one. The
+// token is only returned here.
+func (s *Server) createRoomEmbed(w http.ResponseWriter, r *http.Request) {
+	roomID, userID, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	direct, err := s.Store.IsDirectRoom(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load room")
+		return
+	}
+	if direct {
+		jsonError(w, http.StatusBadRequest, "direct messages cannot be embedded")
+		return
+	}
+	token, err := randomToken(24)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to create embed")
+		return
+	}
+	e, err := s.Store.SetRoomEmbed(r.Context(), roomID, userID, tokenHash(token))
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to create embed")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{
+		"enabled":      true,
+		"created_at":   e.CreatedAt,
+		"token":        token,
+		"messages_url": "/api/embed/" + token + "/messages",
+		"stream_url":   "/api/embed/" + token + "/stream",
+	})
+}
+
+func (s *Server) deleteRoomEmbed(w http.ResponseWriter, r *http.Request) {
+	roomID, _, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	if err := s.Store.DeleteRoomEmbed(r.Context(), roomID); err != nil && err != db.ErrNotFound {
+		jsonError(w, http.StatusInternalServerError, "failed to turn off embed")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]bool{"enabled": false})
+}
+
+// embedMessages is the public JSON feed of an embedded room: its name and
+// avatar and its latest messages, oldest first.
+func (s *Server) embedMessages(w http.ResponseWriter, r *http.Request) {
+	room, ok := s.embedRequest(w, r)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = defaultEmbedMessages
+	}
+	limit = min(limit, maxEmbedMessages)
+	messages, err := s.Store.ListMessages(r.Context(), room.ID, limit)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load messages")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{
+		"room":     room,
+		"messages": s.embedView(r.Context(), room.ID, messages),
+	})
+}
+
+// embedStream sends an embedded room's new messages as server-sent
+// "message" events, each with the message ID as its event ID. A
+// reconnecting EventSource resumes after Last-Event-ID; a new stream
+// starts from the latest message. When the embed is turned off or its
+// token rotated the stream sends "closed" and ends.
+func (s *Server) embedStream(w http.ResponseWriter, r *http.Request) {
+	room, ok := s.embedRequest(w, r)
+	if !ok {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		jsonError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	ip := s.clientIP(r)
+	if !s.embedStreams.acquire(ip, s.Cfg.EmbedStreamsPerIP) {
+		jsonError(w, http.StatusTooManyRequests, "too many open embed streams")
+		return
+	}
+	defer s.embedStreams.release(ip)
+
+	after, _ := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64)
+	if after <= 0 {
+		latest, err := s.Store.ListMessages(r.Context(), room.ID, 1)
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "failed to load messages")
+			return
+		}
+		if len(latest) > 0 {
+			after = latest[0].ID
+		}
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", embedPoll.Milliseconds()*2)
+	flusher.Flush()
+
+	ctx, cancel := context.WithTimeout(r.Context(), embedStreamLifetime)
+	defer cancel()
+	token := chi.URLParam(r, "token")
+	poll := time.NewTicker(embedPoll)
+	defer poll.Stop()
+	keepalive := time.NewTicker(embedKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-keepalive.C:
+			_, err := s.Store.FindEmbedRoom(ctx, tokenHash(token))
+			if err == db.ErrNotFound {
+				fmt.Fprint(w, "event: closed\ndata: {}\n\n")
+				flusher.Flush()
+				return
+			}
+			if err != nil && ctx.Err() == nil {
+				log.Printf("embed stream for room %s: recheck embed: %v", room.ID, err)
+			}
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		case <-poll.C:
+			messages, err := s.Store.ListMessagesAfter(ctx, room.ID, after, maxEmbedMessages)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("embed stream for room %s: %v", room.ID, err)
+				}
+				continue
+			}
+			if len(messages) == 0 {
+				continue
+			}
+			after = messages[len(messages)-1].ID
+			for _, m := range s.embedView(ctx, room.ID, messages) {
+				data, err := json.Marshal(m)
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(w, "id: %d\nevent: message\ndata: %s\n\n", m.ID, data)
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// embedRequest applies the per-address limit and resolves the token in the
+// path. It writes the response when it returns false.
+func (s *Server) embedRequest(w http.ResponseWriter, r *http.Request) (db.EmbedRoom, bool) {
+	setPrivateHeaders(w)
+	st := s.embedRequests.Take(s.clientIP(r))
+	if !st.Allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(st.RetryAfter.Seconds()))))
+		jsonError(w, http.StatusTooManyRequests, "too many requests, try again shortly")
+		return db.EmbedRoom{}, false
+	}
+	token := strings.TrimSpace(chi.URLParam(r, "token"))
+	if token == "" {
+		jsonError(w, http.StatusNotFound, "embed not found")
+		return db.EmbedRoom{}, false
+	}
+	room, err := s.Store.FindEmbedRoom(r.Context(), tokenHash(token))
+	if err == db.ErrNotFound {
+		jsonError(w, http.StatusNotFound, "embed not found")
+		return db.EmbedRoom{}, false
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load embed")
+		return db.EmbedRoom{}, false
+	}
+	return room, true
+}
+
+// embedView prepares messages for an anonymous reader: no shadowed
+// messages, NSFW media withheld, and masked words starred out.
+func (s *Server) embedView(ctx context.Context, roomID uuid.UUID, messages []db.Message) []embedMessage {
+	messages = viewable(messages, uuid.Nil, true)
+	s.Automod.Mask(ctx, roomID, messages)
+	out := make([]embedMessage, 0, len(messages))
+	for _, m := range db.WithoutOriginalContent(messages) {
+		out = append(out, embedMessage{
+			ID:          m.ID,
+			Username:    m.Username,
+			AvatarURL:   m.AvatarURL,
+			Content:     m.Content,
+			MessageType: m.MessageType,
+			MediaURL:    m.MediaURL,
+			Withheld:    m.Withheld,
+			CreatedAt:   m.CreatedAt,
+		})
+	}
+	return out
+}
+
+// streamCounter counts open streams per client address.
+type streamCounter struct {
+	mu   sync.Mutex
+	open map[string]int
+}
+
+func newStreamCounter() *streamCounter {
+	return &streamCounter{open: make(map[string]int)}
+}
+
+// acquire takes one of key's limit slots; a limit of 0 or less allows any
+// number.
+func (c *streamCounter) acquire(key string, limit int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if limit > 0 && c.open[key] >= limit {
+		return false
+	}
+	c.open[key]++
+	return true
+}
+
+func (c *streamCounter) release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.open[key] <= 1 {
+		delete(c.open, key)
+		return
+	}
+	c.open[key]--
+}
@@ -18,11 +18,23 @@ func (s *Server) listGroups(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusUnauthorized, "unauthorized")
 		return
 	}
+	p, err := parsePage(r, maxUserListPage, maxUserListPage)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	groups, err := s.Store.ListRoomGroupsForUser(r.Context(), user.ID)
 	if err != nil {
 		jsonError(w, http.StatusInternalServerError, "failed to load groups")
 		return
 	}
+	groups = filterByName(groups, r.URL.Query().Get("q"), func(g db.RoomGroup) string { return g.Name })
+	groups, next, err := offsetPage(groups, p)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	setNextPage(w, r, next)
 	jsonResponse(w, http.StatusOK, groups)
 }
 
@@ -44,6 +56,9 @@ func (s *Server) createGroup(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusBadRequest, "name is required")
 		return
 	}
+	if !s.allowNewRoom(w, r, user.ID) {
+		return
+	}
 
 	group, err := s.Store.CreateRoomGroup(r.Context(), req.Name, user.ID)
 	if err != nil {
@@ -118,6 +133,9 @@ func (s *Server) createGroupChannel(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusBadRequest, "name is required")
 		return
 	}
+	if !s.allowNewRoom(w, r, user.ID) {
+		return
+	}
 
 	channel, err := s.Store.CreateGroupChannel(r.Context(), groupID, req.Name, req.Type, user.ID)
 	if err != nil {
@@ -0,0 +1,165 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"talkie/backend/internal/auth"
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+	"talkie/backend/internal/ws"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// Guest links let room admins hand out temporary accounts: whoever opens
+// one picks a username and gets an account that only belongs to that room,
+// cannot use the restricted endpoints (see DenyGuests in Routes) and is
+// deleted after guest_days.
+
+const (
+	defaultGuestDays = 7
+	guestLinkTTL     = 7 * 24 * time.Hour
+)
+
+func (s *Server) createGuestLink(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return
+	}
+	var req struct {
+		Days int `json:"days"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+	if req.Days == 0 {
+		req.Days = min(defaultGuestDays, s.Cfg.GuestMaxDays)
+	}
+	if req.Days < 1 || req.Days > s.Cfg.GuestMaxDays {
+		jsonError(w, http.StatusBadRequest, fmt.Sprintf("days must be between 1 and %d", s.Cfg.GuestMaxDays))
+		return
+	}
+	if !s.authorizeRoomAdmin(w, r, roomID, user.ID) {
+		return
+	}
+	direct, err := s.Store.IsDirectRoom(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check room type")
+		return
+	}
+	if direct {
+		jsonError(w, http.StatusBadRequest, "guest links are not available for direct messages")
+		return
+	}
+
+	token, err := randomToken(24)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to create guest link")
+		return
+	}
+	expiresAt := time.Now().UTC().Add(guestLinkTTL)
+	if err := s.Store.CreateGuestInviteLink(r.Context(), tokenHash(token), roomID, user.ID, req.Days, expiresAt); err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to create guest link")
+		return
+	}
+	jsonResponse(w, http.StatusCreated, map[string]any{
+		"id":         tokenHash(token),
+		"token":      token,
+		"guest_url":  fmt.Sprintf("%s?guest=%s", strings.TrimRight(s.Cfg.FrontendBaseURL, "/"), token),
+		"expires_at": expiresAt.Format(time.RFC3339),
+		"guest_days": req.Days,
+	})
+}
+
+// joinAsGuest redeems a guest link. Guests have no email or password: the
+// returned token is their only credential and lasts until the account
+// expires.
+func (s *Server) joinAsGuest(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token    string `json:"token"`
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	req.Token = strings.TrimSpace(req.Token)
+	req.Username = strings.TrimSpace(req.Username)
+	if req.Token == "" || req.Username == "" {
+		jsonError(w, http.StatusBadRequest, "token and username are required")
+		return
+	}
+	if utf8.RuneCountInString(req.Username) > 15 {
+		jsonError(w, http.StatusBadRequest, "username must be at most 15 characters")
+		return
+	}
+	if !s.allowInviteLookup(w, r) {
+		return
+	}
+
+	// The placeholder email keeps users.email unique and can never receive
+	// mail; the unknown random password means the account cannot log in.
+	email := fmt.Sprintf("guest-%s@guest.invalid", uuid.New())
+	password, err := randomToken(32)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to create guest")
+		return
+	}
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to hash password")
+		return
+	}
+
+	u, roomID, err := s.Store.CreateGuestFromInvite(r.Context(), tokenHash(req.Token), email, req.Username, hash)
+	if err != nil {
+		if err == db.ErrNotFound {
+			s.noteInviteMiss(r)
+			jsonError(w, http.StatusNotFound, "guest link not found or expired")
+			return
+		}
+		jsonError(w, http.StatusConflict, "username already taken")
+		return
+	}
+	token, err := auth.GenerateGuestJWT(s.Cfg.JWTSecret, u.ID, u.Username, u.SessionVersion, *u.GuestExpiresAt)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to generate token")
+		return
+	}
+	go s.announceMembership(roomID, u.ID, ws.MemberJoined)
+	go s.welcomeMember(roomID, u.ID)
+
+	u.PasswordHash = ""
+	jsonResponse(w, http.StatusCreated, map[string]any{
+		"token":   token,
+		"user":    u,
+		"room_id": roomID,
+	})
+}
+
+// sessionVersion reports deleted and expired accounts with a version no
+// token carries, so they are rejected as revoked rather than as a server
+// error.
+func (s *Server) sessionVersion(ctx context.Context, userID uuid.UUID) (int, error) {
+	version, err := s.Store.GetSessionVersion(ctx, userID)
+	if err == db.ErrNotFound {
+		return -1, nil
+	}
+	return version, err
+}
@@ -0,0 +1,55 @@
+package httpapi
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"time"
+
+	"talkie/backend/internal/middleware"
+)
+
+type iceServer struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+}
+
+// listICEServers returns the STUN and TURN servers for an RTCPeerConnection
+// configuration. TURN credentials use coturn's shared-secret scheme, so
+// coturn checks them without asking the API.
+func (s *Server) listICEServers(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	servers := []iceServer{}
+	if len(s.Cfg.STUNURLs) > 0 {
+		servers = append(servers, iceServer{URLs: s.Cfg.STUNURLs})
+	}
+	var expiresAt *time.Time
+	if len(s.Cfg.TURNURLs) > 0 {
+		exp := time.Now().Add(time.Duration(s.Cfg.TURNCredentialTTLS) * time.Second).Truncate(time.Second)
+		username, credential := turnCredential(s.Cfg.TURNSecret, user.ID.String(), exp)
+		servers = append(servers, iceServer{URLs: s.Cfg.TURNURLs, Username: username, Credential: credential})
+		expiresAt = &exp
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	jsonResponse(w, http.StatusOK, map[string]any{
+		"ice_servers": servers,
+		"expires_at":  expiresAt,
+	})
+}
+
+// turnCredential is coturn's use-auth-secret scheme: the username is the
+// expiry as a Unix time and the user it was issued to, the credential the
+// username's HMAC-SHA1 under the shared secret.
+func turnCredential(secret, userID string, expiresAt time.Time) (username, credential string) {
+	username = strconv.FormatInt(expiresAt.Unix(), 10) + ":" + userID
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+	return username, base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
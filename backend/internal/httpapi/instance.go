@@ -0,0 +1,91 @@
+package httpapi
+
+import (
+	"net/http"
+	"slices"
+)
+
+// instanceCacheControl lets clients and proxies cache GET
+// /api/instance; it only changes when the server is reconfigured or
+// first-run setup completes.
+const instanceCacheControl = "public, max-age=300"
+
+type instanceInfo struct {
+	Name    string `json:"name"`
+	LogoURL string `json:"logo_url,omitempty"`
+	// Registration is "open", "closed", or "directory" when accounts
+	// come from LDAP.
+	Registration              string `json:"registration"`
+	RequiresEmailVerification bool   `json:"requires_email_verification"`
+	// AgeGate is "off", "optional" or "required"; MinAge applies unless
+	// it is off.
+	AgeGate          string `json:"age_gate"`
+	MinAge           int    `json:"min_age,omitempty"`
+	MaxUploadBytes   int64  `json:"max_upload_bytes"`
+	MaxDirectUpload  int64  `json:"max_direct_upload_bytes,omitempty"`
+	MaxMessageLength int    `json:"max_message_length"`
+	CallProvider     string `json:"call_provider"`
+	// Features lists the optional parts of the API this server offers.
+	Features []string        `json:"features"`
+	Contact  instanceContact `json:"contact"`
+}
+
+type instanceContact struct {
+	Email string `json:"email,omitempty"`
+	URL   string `json:"url,omitempty"`
+}
+
+// getInstance describes this server to clients that have not signed in,
+// so a generic client can brand itself and hide what is not offered.
+func (s *Server) getInstance(w http.ResponseWriter, r *http.Request) {
+	settings := s.instanceSettings(r.Context())
+	info := instanceInfo{
+		Name:                      settings.Name,
+		LogoURL:                   s.Cfg.InstanceLogoURL,
+		Registration:              settings.Registration,
+		RequiresEmailVerification: true,
+		AgeGate:                   s.Cfg.AgeGate,
+		MaxUploadBytes:            uploadLimit(s.defaultLimits()),
+		MaxMessageLength:          s.Cfg.MaxMessageLength,
+		CallProvider:              s.Cfg.CallProvider,
+		Features:                  s.instanceFeatures(),
+		Contact: instanceContact{
+			Email: s.Cfg.InstanceContactEmail,
+			URL:   s.Cfg.InstanceContactURL,
+		},
+	}
+	if s.LDAP != nil {
+		info.Registration = "directory"
+		info.RequiresEmailVerification = false
+	}
+	if s.Cfg.AgeGate != "off" {
+		info.MinAge = s.Cfg.MinAge
+	}
+	if s.S3 != nil {
+		info.MaxDirectUpload = s.directUploadLimit(s.defaultLimits())
+	}
+	w.Header().Set("Cache-Control", instanceCacheControl)
+	jsonResponse(w, http.StatusOK, info)
+}
+
+// instanceFeatures names the optional features that are turned on.
+func (s *Server) instanceFeatures() []string {
+	features := []string{"workspace_sso", "guest_links"}
+	for name, on := range map[string]bool{
+		"p2p_calls":          s.Cfg.P2PCalls,
+		"direct_uploads":     s.S3 != nil,
+		"phone_verification": s.SMS != nil,
+		"billing":            s.Billing != nil,
+		"nsfw_detection":     s.NSFW != nil,
+		"emoji_shortcodes":   s.Cfg.EmojiShortcodes,
+		"scim":               s.Cfg.SCIMEnabled,
+		"ldap":               s.LDAP != nil,
+		"turn":               len(s.Cfg.TURNURLs) > 0,
+	} {
+		if on {
+			features = append(features, name)
+		}
+	}
+	slices.Sort(features)
+	return features
+}
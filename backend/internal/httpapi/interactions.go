@@ -0,0 +1,135 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+	"talkie/backend/internal/slashcmd"
+	"talkie/backend/internal/ws"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// interactWithMessage reports a button press or menu pick on a command's
+// reply back to that command. The command answers in the background, as
+// it does when invoked, so this only checks the action and returns 202.
+func (s *Server) interactWithMessage(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return
+	}
+	messageID, err := strconv.ParseInt(chi.URLParam(r, "messageID"), 10, 64)
+	if err != nil || messageID <= 0 {
+		jsonError(w, http.StatusBadRequest, "invalid message id")
+		return
+	}
+	var req struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	member, err := s.Store.IsRoomMember(r.Context(), roomID, user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check membership")
+		return
+	}
+	if !member {
+		jsonError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+	cmd, msg, err := s.Store.GetCommandMessage(r.Context(), roomID, messageID)
+	if err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "message has no interactive components")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to load message")
+		return
+	}
+	_, value, ok := db.Interaction(msg.Components, req.ActionID, req.Value)
+	if !ok {
+		jsonError(w, http.StatusBadRequest, "unknown action or option")
+		return
+	}
+	if !s.commandRuns.Take(user.ID.String()).Allowed {
+		jsonError(w, http.StatusTooManyRequests, "too many interactions, try again shortly")
+		return
+	}
+	go s.runInteraction(cmd, msg, user.ID, user.Username, req.ActionID, value)
+	jsonResponse(w, http.StatusAccepted, map[string]bool{"ok": true})
+}
+
+// runInteraction posts the interaction to cmd and shows its answer: to the
+// member alone, as a new reply in the room, or in place of msg.
+func (s *Server) runInteraction(cmd db.RoomCommand, msg db.Message, userID uuid.UUID, username, actionID, value string) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandInvocationTimeout)
+	defer cancel()
+	room, err := s.Store.GetRoomByID(ctx, cmd.RoomID)
+	if err != nil {
+		log.Printf("command /%s interaction: load room %s: %v", cmd.Name, cmd.RoomID, err)
+		return
+	}
+	resp, err := s.Commands.Interact(ctx, cmd.URL, cmd.Secret, slashcmd.Interaction{
+		Command:     "/" + cmd.Name,
+		ActionID:    actionID,
+		Value:       value,
+		MessageID:   msg.ID,
+		RoomID:      cmd.RoomID.String(),
+		RoomName:    room.Name,
+		UserID:      userID.String(),
+		Username:    username,
+		TriggeredAt: time.Now().UTC(),
+	})
+	if err != nil {
+		log.Printf("command /%s interaction in room %s: %v", cmd.Name, cmd.RoomID, err)
+		s.Hub.SendEphemeral(cmd.RoomID, userID, fmt.Sprintf("/%s did not take the action, try again later.", cmd.Name))
+		return
+	}
+	text, ok := s.commandReplyText(cmd, userID, resp)
+	if !ok {
+		return
+	}
+	switch {
+	case resp.ReplaceOriginal:
+		updated, err := s.Store.UpdateCommandMessage(ctx, cmd.RoomID, msg.ID, text, resp.Components)
+		if err != nil {
+			log.Printf("command /%s interaction: replace message %d: %v", cmd.Name, msg.ID, err)
+			return
+		}
+		s.publishMessageUpdate(ctx, updated)
+	case resp.InChannel() && cmd.CreatedBy != nil:
+		s.postCommandReply(ctx, cmd, text, resp.Components)
+	default:
+		s.Hub.SendEphemeral(cmd.RoomID, userID, text)
+	}
+}
+
+// publishMessageUpdate sends a changed message to the room's sockets as
+// "message_updated" and drops the room's cached history.
+func (s *Server) publishMessageUpdate(ctx context.Context, msg db.Message) {
+	s.History.Invalidate(msg.RoomID)
+	msg.ContentMasked = s.Automod.MaskText(ctx, msg.RoomID, msg.Content)
+	out := ws.MessageUpdatedEvent{Message: ws.PayloadFromMessage(msg)}
+	if msg.Shadowed {
+		s.Hub.SendToRoomUser(msg.RoomID, msg.UserID, out)
+		return
+	}
+	s.Hub.Broadcast(msg.RoomID, out)
+}
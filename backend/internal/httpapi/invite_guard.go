@@ -0,0 +1,170 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// inviteGuessWindow is how far back failed invite lookups are counted.
+	inviteGuessWindow = 10 * time.Minute
+	// inviteBlockBase is the first block for guessing; each further block
+	// within inviteStrikeMemory of the last one ending doubles, up to
+	// inviteBlockMax.
+	inviteBlockBase    = 15 * time.Minute
+	inviteBlockMax     = 24 * time.Hour
+	inviteStrikeMemory = 24 * time.Hour
+)
+
+// inviteGuard throttles invite token guessing. It counts lookups of invite
+// tokens that do not exist per IP and per user, and blocks a key from all
+// invite lookups once it reaches the limit within inviteGuessWindow.
+type inviteGuard struct {
+	limit int
+
+	mu        sync.Mutex
+	keys      map[string]*guessState
+	lastSweep time.Time
+}
+
+type guessState struct {
+	misses       []time.Time
+	blockedUntil time.Time
+	strikes      int
+}
+
+func newInviteGuard(limit int) *inviteGuard {
+	return &inviteGuard{limit: limit, keys: map[string]*guessState{}, lastSweep: time.Now()}
+}
+
+// blockedFor returns how much longer the most restricted of keys stays
+// blocked, or 0.
+func (g *inviteGuard) blockedFor(now time.Time, keys ...string) time.Duration {
+	if g == nil || g.limit <= 0 {
+		return 0
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var wait time.Duration
+	for _, k := range keys {
+		if st, ok := g.keys[k]; ok {
+			wait = max(wait, st.blockedUntil.Sub(now))
+		}
+	}
+	return wait
+}
+
+// miss records a failed lookup by key. When that reaches the limit the key
+// is blocked and the block length returned; otherwise 0.
+func (g *inviteGuard) miss(key string, now time.Time) time.Duration {
+	if g == nil || g.limit <= 0 {
+		return 0
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if now.Sub(g.lastSweep) > inviteGuessWindow {
+		g.sweep(now)
+	}
+	st := g.keys[key]
+	if st == nil {
+		st = &guessState{}
+		g.keys[key] = st
+	}
+	recent := st.misses[:0]
+	for _, t := range st.misses {
+		if now.Sub(t) < inviteGuessWindow {
+			recent = append(recent, t)
+		}
+	}
+	st.misses = append(recent, now)
+	if len(st.misses) < g.limit {
+		return 0
+	}
+
+	if now.Sub(st.blockedUntil) > inviteStrikeMemory {
+		st.strikes = 0
+	}
+	block := min(inviteBlockBase<<min(st.strikes, 10), inviteBlockMax)
+	st.strikes++
+	st.blockedUntil = now.Add(block)
+	st.misses = nil
+	return block
+}
+
+// sweep forgets keys with no recent misses, no block in force and no
+// strikes worth remembering.
+func (g *inviteGuard) sweep(now time.Time) {
+	g.lastSweep = now
+	for k, st := range g.keys {
+		idle := len(st.misses) == 0 || now.Sub(st.misses[len(st.misses)-1]) >= inviteGuessWindow
+		if idle && now.Sub(st.blockedUntil) > inviteStrikeMemory {
+			delete(g.keys, k)
+		}
+	}
+}
+
+// inviteGuardKeys are the keys a request is counted under: its address and,
+// when signed in, its user.
+func (s *Server) inviteGuardKeys(r *http.Request) (ip string, userID uuid.UUID, keys []string) {
+	ip = s.clientIP(r)
+	keys = []string{"ip:" + ip}
+	if user, ok := middleware.UserFromContext(r.Context()); ok {
+		userID = user.ID
+		keys = append(keys, "user:"+user.ID.String())
+	}
+	return ip, userID, keys
+}
+
+// allowInviteLookup refuses invite token lookups from an address or user
+// blocked for guessing. It writes the response when it returns false.
+func (s *Server) allowInviteLookup(w http.ResponseWriter, r *http.Request) bool {
+	_, _, keys := s.inviteGuardKeys(r)
+	wait := s.inviteGuesses.blockedFor(time.Now(), keys...)
+	if wait <= 0 {
+		return true
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	jsonError(w, http.StatusTooManyRequests, "too many invalid invite links, try again later")
+	return false
+}
+
+// noteInviteMiss counts a lookup of an invite token that does not exist or
+// has expired, and records a security event when it gets the address or
+// user blocked.
+func (s *Server) noteInviteMiss(r *http.Request) {
+	ip, userID, keys := s.inviteGuardKeys(r)
+	now := time.Now()
+	for _, k := range keys {
+		if block := s.inviteGuesses.miss(k, now); block > 0 {
+			e := db.SecurityEvent{
+				Kind:      "invite_guessing_blocked",
+				IP:        ip,
+				UserAgent: r.UserAgent(),
+				Detail:    fmt.Sprintf("%s blocked for %s after %d invalid invite links in %s", k, block, s.Cfg.InviteGuessLimit, inviteGuessWindow),
+			}
+			if userID != uuid.Nil {
+				e.UserID = &userID
+			}
+			go s.recordSecurityEvent(e)
+		}
+	}
+}
+
+func (s *Server) recordSecurityEvent(e db.SecurityEvent) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.Store.RecordSecurityEvent(ctx, e); err != nil {
+		log.Printf("record security event %s: %v", e.Kind, err)
+	}
+}
@@ -0,0 +1,98 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"talkie/backend/internal/db"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type invitePreviewResponse struct {
+	Type        string `json:"type"`
+	Name        string `json:"name,omitempty"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+	MemberCount *int   `json:"member_count,omitempty"`
+}
+
+// setPrivateHeaders marks a public response as one that search engines,
+// caches and linked sites should not keep: invite URLs get pasted in public
+// places and the page behind them is not meant to be found.
+func setPrivateHeaders(w http.ResponseWriter) {
+	h := w.Header()
+	h.Set("X-Robots-Tag", "noindex, nofollow, noarchive")
+	h.Set("Referrer-Policy", "no-referrer")
+	h.Set("Cache-Control", "no-store")
+}
+
+// previewInviteLink tells someone who has not signed in yet what an invite
+// link leads to. The name, avatar and member count are only included when
+// the server allows it and the room is not unlisted.
+func (s *Server) previewInviteLink(w http.ResponseWriter, r *http.Request) {
+	setPrivateHeaders(w)
+	rawToken := strings.TrimSpace(chi.URLParam(r, "token"))
+	if rawToken == "" {
+		jsonError(w, http.StatusBadRequest, "invite token is required")
+		return
+	}
+	if !s.allowInviteLookup(w, r) {
+		return
+	}
+	p, err := s.Store.GetInvitePreview(r.Context(), tokenHash(rawToken))
+	if err != nil {
+		if err == db.ErrNotFound {
+			s.noteInviteMiss(r)
+			jsonError(w, http.StatusNotFound, "invite link is invalid or expired")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to load invite link")
+		return
+	}
+	resp := invitePreviewResponse{Type: p.Kind}
+	if !p.Unlisted {
+		if s.Cfg.InvitePreviewNames {
+			resp.Name = p.Name
+			resp.AvatarURL = p.AvatarURL
+		}
+		if s.Cfg.InvitePreviewMemberCounts {
+			resp.MemberCount = &p.MemberCount
+		}
+	}
+	jsonResponse(w, http.StatusOK, resp)
+}
+
+func (s *Server) getRoomUnlisted(w http.ResponseWriter, r *http.Request) {
+	roomID, _, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	on, err := s.Store.GetRoomUnlisted(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load room")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]bool{"enabled": on})
+}
+
+// setRoomUnlisted hides or shows the room's name, avatar and member count
+// on invite previews. Invite links keep working either way.
+func (s *Server) setRoomUnlisted(w http.ResponseWriter, r *http.Request) {
+	roomID, _, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := s.Store.SetRoomUnlisted(r.Context(), roomID, req.Enabled); err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to save room")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]bool{"enabled": req.Enabled})
+}
@@ -0,0 +1,73 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"talkie/backend/internal/middleware"
+	"talkie/backend/internal/textnorm"
+)
+
+const (
+	maxKeywords      = 25
+	minKeywordLength = 2
+	maxKeywordLength = 64
+)
+
+func (s *Server) getMyKeywords(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	keywords, err := s.Store.GetUserKeywords(r.Context(), user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load keywords")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"keywords": keywords})
+}
+
+// setMyKeywords replaces the caller's watched keywords. Keywords are
+// matched as whole words ignoring case, so they are stored lowercased and
+// duplicates collapse. Messages already processed are not matched again.
+func (s *Server) setMyKeywords(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	var req struct {
+		Keywords []string `json:"keywords"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	keywords := []string{}
+	seen := make(map[string]bool)
+	for _, k := range req.Keywords {
+		k = strings.ToLower(strings.Join(strings.Fields(textnorm.Message(k)), " "))
+		if k == "" || seen[k] {
+			continue
+		}
+		if n := utf8.RuneCountInString(k); n < minKeywordLength || n > maxKeywordLength {
+			jsonError(w, http.StatusBadRequest, fmt.Sprintf("keywords must be %d to %d characters", minKeywordLength, maxKeywordLength))
+			return
+		}
+		seen[k] = true
+		keywords = append(keywords, k)
+	}
+	if len(keywords) > maxKeywords {
+		jsonError(w, http.StatusBadRequest, fmt.Sprintf("at most %d keywords", maxKeywords))
+		return
+	}
+	if err := s.Store.SetUserKeywords(r.Context(), user.ID, keywords); err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to save keywords")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"keywords": keywords})
+}
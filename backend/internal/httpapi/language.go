@@ -0,0 +1,105 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/langdetect"
+	"talkie/backend/internal/middleware"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// languageSample is how many recent messages a room's language is detected
+// from when no admin set one.
+const languageSample = 100
+
+type roomLanguageResponse struct {
+	// Language is a BCP 47 tag, empty when it is neither set nor clear from
+	// recent messages.
+	Language string `json:"language"`
+	Dir      string `json:"dir,omitempty"`
+	// Detected is set when Language was guessed from recent messages
+	// rather than set by an admin.
+	Detected bool `json:"detected"`
+}
+
+// getRoomLanguage tells any member the room's language and text direction,
+// for laying out the room and for features that write in the room's
+// language.
+func (s *Server) getRoomLanguage(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return
+	}
+	member, err := s.Store.IsRoomMember(r.Context(), roomID, user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check membership")
+		return
+	}
+	if !member {
+		jsonError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+	lang, err := s.Store.GetRoomLanguage(r.Context(), roomID)
+	if err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "room not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to load room")
+		return
+	}
+	if lang != "" {
+		jsonResponse(w, http.StatusOK, roomLanguageResponse{Language: lang, Dir: langdetect.Direction(lang)})
+		return
+	}
+	messages, err := s.Store.ListMessages(r.Context(), roomID, languageSample)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load messages")
+		return
+	}
+	texts := make([]string, 0, len(messages))
+	for _, m := range db.VisibleTo(messages, user.ID) {
+		texts = append(texts, m.Content)
+	}
+	lang = langdetect.Dominant(texts)
+	jsonResponse(w, http.StatusOK, roomLanguageResponse{Language: lang, Dir: langdetect.Direction(lang), Detected: true})
+}
+
+// setRoomLanguage sets the room's language. An empty language goes back to
+// detecting it.
+func (s *Server) setRoomLanguage(w http.ResponseWriter, r *http.Request) {
+	roomID, _, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Language string `json:"language"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	lang := ""
+	if req.Language != "" {
+		var valid bool
+		if lang, valid = langdetect.Canonical(req.Language); !valid {
+			jsonError(w, http.StatusBadRequest, "language must be a BCP 47 tag such as en or ar")
+			return
+		}
+	}
+	if err := s.Store.SetRoomLanguage(r.Context(), roomID, lang); err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to save room")
+		return
+	}
+	jsonResponse(w, http.StatusOK, roomLanguageResponse{Language: lang, Dir: langdetect.Direction(lang)})
+}
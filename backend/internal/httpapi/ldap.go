@@ -0,0 +1,97 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/ldapauth"
+	"talkie/backend/internal/sso"
+
+	"github.com/google/uuid"
+)
+
+// ldapLogin signs in with a password the directory checks, creating or
+// updating the local account from the directory entry.
+func (s *Server) ldapLogin(w http.ResponseWriter, r *http.Request, login, password string) {
+	entry, err := s.LDAP.Authenticate(r.Context(), login, password)
+	if errors.Is(err, ldapauth.ErrInvalidCredentials) {
+		jsonError(w, http.StatusUnauthorized, "invalid credentials")
+		return
+	}
+	if err != nil {
+		log.Printf("ldap sign-in for %q: %v", login, err)
+		jsonError(w, http.StatusServiceUnavailable, "the directory is unavailable")
+		return
+	}
+	if entry.Email == "" {
+		jsonResponse(w, http.StatusForbidden, map[string]string{
+			"error": "your directory entry has no email address",
+			"code":  "ldap_no_email",
+		})
+		return
+	}
+	userID, err := s.syncLDAPUser(r.Context(), entry)
+	if errors.Is(err, db.ErrLDAPConflict) {
+		jsonResponse(w, http.StatusConflict, map[string]string{
+			"error": "your email address belongs to an account that cannot sign in through the directory",
+			"code":  "account_exists",
+		})
+		return
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to save account")
+		return
+	}
+	u, err := s.Store.FindUserByID(r.Context(), userID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load account")
+		return
+	}
+	if s.ssoRequired(w, r, u.ID) || s.accountDeactivated(w, r, u.ID) {
+		return
+	}
+
+	token, err := s.issueToken(r.Context(), u, u.SessionVersion)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to generate token")
+		return
+	}
+	go s.recordLogin(u, s.loginContextFromRequest(r))
+
+	u.PasswordHash = ""
+	jsonResponse(w, http.StatusOK, authResponse{Token: token, User: u})
+}
+
+// syncLDAPUser saves entry's account, taking its username from the entry,
+// with digits added when that is taken.
+func (s *Server) syncLDAPUser(ctx context.Context, e ldapauth.Entry) (uuid.UUID, error) {
+	username := ssoUsername(sso.Identity{Username: e.Username, Email: e.Email})
+	name := username
+	for attempt := 0; ; attempt++ {
+		userID, err := s.Store.SyncLDAPUser(ctx, e.ID, e.DN, e.Email, name)
+		if err != db.ErrUserExists || attempt == 4 {
+			return userID, err
+		}
+		suffix, err := randomDigits(4)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		name = username[:min(len(username), 11)] + suffix
+	}
+}
+
+// ldapManaged turns away requests that would store a password or an email
+// address the directory owns, reporting whether it did.
+func (s *Server) ldapManaged(w http.ResponseWriter) bool {
+	if s.LDAP == nil {
+		return false
+	}
+	jsonResponse(w, http.StatusForbidden, map[string]string{
+		"error": "accounts and passwords are managed by the directory",
+		"code":  "ldap_managed",
+	})
+	return true
+}
@@ -0,0 +1,133 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const maxLegalHoldText = 500
+
+// listLegalHolds returns the active legal holds, and released ones too
+// with ?all=true.
+func (s *Server) listLegalHolds(w http.ResponseWriter, r *http.Request) {
+	all, _ := strconv.ParseBool(r.URL.Query().Get("all"))
+	holds, err := s.Store.ListLegalHolds(r.Context(), all)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load legal holds")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"holds": holds})
+}
+
+// placeLegalHold puts a user (user_id) or a room (room_id) under legal
+// hold. The reason is required and kept with the hold.
+func (s *Server) placeLegalHold(w http.ResponseWriter, r *http.Request) {
+	admin, _ := middleware.UserFromContext(r.Context())
+	var req struct {
+		UserID string `json:"user_id"`
+		RoomID string `json:"room_id"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	hold := db.LegalHold{Reason: strings.TrimSpace(req.Reason), PlacedBy: admin.ID}
+	if hold.Reason == "" || utf8.RuneCountInString(hold.Reason) > maxLegalHoldText {
+		jsonError(w, http.StatusBadRequest, fmt.Sprintf("reason is required, at most %d characters", maxLegalHoldText))
+		return
+	}
+	switch {
+	case req.UserID != "" && req.RoomID == "":
+		userID, err := uuid.Parse(req.UserID)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, "invalid user id")
+			return
+		}
+		if _, err := s.Store.FindUserByID(r.Context(), userID); err != nil {
+			if err == db.ErrNotFound {
+				jsonError(w, http.StatusNotFound, "user not found")
+				return
+			}
+			jsonError(w, http.StatusInternalServerError, "failed to load user")
+			return
+		}
+		hold.UserID = &userID
+	case req.RoomID != "" && req.UserID == "":
+		roomID, err := uuid.Parse(req.RoomID)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, "invalid room id")
+			return
+		}
+		if _, err := s.Store.GetRoomByID(r.Context(), roomID); err != nil {
+			if err == db.ErrNotFound {
+				jsonError(w, http.StatusNotFound, "room not found")
+				return
+			}
+			jsonError(w, http.StatusInternalServerError, "failed to load room")
+			return
+		}
+		hold.RoomID = &roomID
+	default:
+		jsonError(w, http.StatusBadRequest, "either user_id or room_id is required")
+		return
+	}
+	hold, err := s.Store.PlaceLegalHold(r.Context(), hold)
+	if err != nil {
+		if err == db.ErrHoldExists {
+			jsonError(w, http.StatusConflict, "already under legal hold")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to place legal hold")
+		return
+	}
+	log.Printf("admin %s placed legal hold %d (user %v, room %v)", admin.ID, hold.ID, hold.UserID, hold.RoomID)
+	jsonResponse(w, http.StatusCreated, hold)
+}
+
+// releaseLegalHold lifts an active hold. The hold stays listed under
+// ?all=true with who released it and the optional note.
+func (s *Server) releaseLegalHold(w http.ResponseWriter, r *http.Request) {
+	admin, _ := middleware.UserFromContext(r.Context())
+	holdID, err := strconv.ParseInt(chi.URLParam(r, "holdID"), 10, 64)
+	if err != nil || holdID <= 0 {
+		jsonError(w, http.StatusBadRequest, "invalid legal hold id")
+		return
+	}
+	var req struct {
+		Note string `json:"note"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+	note := strings.TrimSpace(req.Note)
+	if utf8.RuneCountInString(note) > maxLegalHoldText {
+		jsonError(w, http.StatusBadRequest, fmt.Sprintf("note must be at most %d characters", maxLegalHoldText))
+		return
+	}
+	hold, err := s.Store.ReleaseLegalHold(r.Context(), holdID, admin.ID, note)
+	if err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "no active legal hold with that id")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to release legal hold")
+		return
+	}
+	log.Printf("admin %s released legal hold %d", admin.ID, hold.ID)
+	jsonResponse(w, http.StatusOK, hold)
+}
@@ -0,0 +1,72 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+
+	"talkie/backend/internal/auth"
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+var localePattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// checkTimezone accepts IANA zone names; "" clears the zone.
+func checkTimezone(tz string) error {
+	if tz == "" {
+		return nil
+	}
+	if tz == "Local" {
+		return fmt.Errorf("timezone must be an IANA time zone such as Europe/Berlin")
+	}
+	if _, err := time.LoadLocation(tz); err != nil {
+		return fmt.Errorf("timezone must be an IANA time zone such as Europe/Berlin")
+	}
+	return nil
+}
+
+// checkLocale accepts BCP 47 tags such as "ru" or "pt-BR"; "" clears it.
+func checkLocale(locale string) error {
+	if locale != "" && (len(locale) > 35 || !localePattern.MatchString(locale)) {
+		return fmt.Errorf("locale must be a language tag such as en or pt-BR")
+	}
+	return nil
+}
+
+// userLocation returns userID's time zone, or UTC when they have not set
+// one or it cannot be loaded.
+func (s *Server) userLocation(ctx context.Context, userID uuid.UUID) *time.Location {
+	l, err := s.Store.GetUserLocale(ctx, userID)
+	if err != nil || l.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(l.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// parseDateOrTime reads an RFC 3339 time or a YYYY-MM-DD date, which is
+// taken as midnight in loc. dateOnly reports which it was.
+func parseDateOrTime(raw string, loc *time.Location) (t time.Time, dateOnly bool, err error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, false, nil
+	}
+	t, err = time.ParseInLocation(time.DateOnly, raw, loc)
+	return t, err == nil, err
+}
+
+// issueToken signs a session token for u carrying their time zone. A
+// failure to load the zone is logged and the token issued without it.
+func (s *Server) issueToken(ctx context.Context, u db.User, sessionVersion int) (string, error) {
+	l, err := s.Store.GetUserLocale(ctx, u.ID)
+	if err != nil {
+		log.Printf("load locale for %s: %v", u.ID, err)
+	}
+	return auth.GenerateJWT(s.Cfg.JWTSecret, u.ID, u.Username, sessionVersion, l.Timezone)
+}
@@ -0,0 +1,153 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+	"talkie/backend/internal/ws"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// loginContext is what we remember about a request that produced a session.
+type loginContext struct {
+	IP        string
+	Country   string
+	UserAgent string
+	Device    string
+}
+
+func (s *Server) loginContextFromRequest(r *http.Request) loginContext {
+	lc := loginContext{
+		IP:        s.clientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+	lc.Country = s.Geo.Country(net.ParseIP(lc.IP))
+	// Native clients send a stable install id; browsers fall back to the
+	// user agent, which is coarse but good enough to spot a new device.
+	lc.Device = r.Header.Get("X-Device-ID")
+	if lc.Device == "" {
+		lc.Device = lc.UserAgent
+	}
+	return lc
+}
+
+// recordLogin stores the login and, when it comes from a country or device
+// the account has not used before, raises an in-app notification and sends
+// a security email. It runs after the response has been written.
+func (s *Server) recordLogin(u db.User, lc loginContext) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	novelty, err := s.Store.RecordLogin(ctx, u.ID, lc.IP, lc.Country, tokenHash(lc.Device), lc.UserAgent)
+	if err != nil {
+		log.Printf("record login failed: %v", err)
+		return
+	}
+	if !s.Cfg.LoginAlertsEnabled || (!novelty.NewCountry && !novelty.NewDevice) {
+		return
+	}
+
+	where := lc.IP
+	if lc.Country != "" {
+		where = fmt.Sprintf("%s (%s)", lc.IP, lc.Country)
+	}
+	title := "New sign-in to your account"
+	body := fmt.Sprintf("Your account was signed in from %s using %s.", where, describeUserAgent(lc.UserAgent))
+	n, err := s.Store.CreateNotification(ctx, u.ID, "security.new_login", title, body, map[string]any{
+		"ip":          lc.IP,
+		"country":     lc.Country,
+		"user_agent":  lc.UserAgent,
+		"new_country": novelty.NewCountry,
+		"new_device":  novelty.NewDevice,
+	})
+	if err != nil {
+		log.Printf("create login notification failed: %v", err)
+	} else {
+		s.Hub.SendToUser(u.ID, ws.NotificationEvent{Notification: n})
+	}
+
+	if err := s.sendLoginAlertEmail(u.Email, body); err != nil {
+		log.Printf("send login alert email failed: %v", err)
+	}
+}
+
+func describeUserAgent(ua string) string {
+	if ua == "" {
+		return "an unknown client"
+	}
+	if len(ua) > 120 {
+		ua = ua[:120] + "…"
+	}
+	return ua
+}
+
+func (s *Server) sendLoginAlertEmail(to, summary string) error {
+	subject := "New sign-in to your Talkie account"
+	body := summary + "\n\nIf this was you, you can ignore this email. " +
+		"If not, reset your password right away.\n"
+
+	if !s.Mailer.Enabled() {
+		log.Printf("login alert for %s: %s", to, summary)
+		return nil
+	}
+	return s.Mailer.Send(to, subject, body)
+}
+
+func (s *Server) listLoginEvents(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	events, err := s.Store.ListLoginEvents(r.Context(), user.ID, 20)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load logins")
+		return
+	}
+	jsonResponse(w, http.StatusOK, events)
+}
+
+func (s *Server) listNotifications(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	notifications, err := s.Store.ListNotifications(r.Context(), user.ID, limit)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load notifications")
+		return
+	}
+	jsonResponse(w, http.StatusOK, notifications)
+}
+
+func (s *Server) markNotificationRead(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r, "notificationID"), 10, 64)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid notification id")
+		return
+	}
+	if err := s.Store.MarkNotificationRead(r.Context(), user.ID, id); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "notification not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to update notification")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
+}
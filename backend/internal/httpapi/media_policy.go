@@ -0,0 +1,147 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const maxMediaPolicyEntries = 50
+
+// serverMediaPolicy is UPLOAD_ALLOWED_TYPES and UPLOAD_BLOCKED_TYPES.
+func (s *Server) serverMediaPolicy() db.MediaPolicy {
+	return db.MediaPolicy{Allowed: s.Cfg.UploadAllowedTypes, Blocked: s.Cfg.UploadBlockedTypes}
+}
+
+// checkMediaType refuses contentType when the server or, with roomID set,
+// the room does not allow it. It writes the error response when it returns
+// false.
+func (s *Server) checkMediaType(w http.ResponseWriter, r *http.Request, roomID uuid.UUID, contentType string) bool {
+	if !s.serverMediaPolicy().Allows(contentType) {
+		mediaTypeError(w, contentType, "server", contentType+" uploads are not allowed on this server")
+		return false
+	}
+	if roomID == uuid.Nil {
+		return true
+	}
+	p, err := s.Store.GetRoomMediaPolicy(r.Context(), roomID)
+	if err != nil {
+		log.Printf("load media policy of room %s: %v", roomID, err)
+		jsonError(w, http.StatusInternalServerError, "failed to load room")
+		return false
+	}
+	if !p.Allows(contentType) {
+		mediaTypeError(w, contentType, "room", contentType+" uploads are not allowed in this room")
+		return false
+	}
+	return true
+}
+
+// mediaTypeError answers 415 with code media_type_not_allowed, saying
+// whether the server or the room refused the type.
+func mediaTypeError(w http.ResponseWriter, contentType, scope, message string) {
+	jsonResponse(w, http.StatusUnsupportedMediaType, map[string]any{
+		"error":        message,
+		"code":         "media_type_not_allowed",
+		"content_type": contentType,
+		"scope":        scope,
+	})
+}
+
+// getRoomMediaPolicy tells any member which media types the room takes, so
+// clients can hide upload options that would be refused. server is the
+// server-wide policy, which applies as well.
+func (s *Server) getRoomMediaPolicy(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return
+	}
+	member, err := s.Store.IsRoomMember(r.Context(), roomID, user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check membership")
+		return
+	}
+	if !member {
+		jsonError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+	p, err := s.Store.GetRoomMediaPolicy(r.Context(), roomID)
+	if err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "room not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to load media policy")
+		return
+	}
+	server := s.serverMediaPolicy()
+	if server.Allowed == nil {
+		server.Allowed = []string{}
+	}
+	if server.Blocked == nil {
+		server.Blocked = []string{}
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{
+		"allowed": p.Allowed,
+		"blocked": p.Blocked,
+		"server":  server,
+	})
+}
+
+// setRoomMediaPolicy replaces the room's allowed and blocked media types.
+// Both empty lifts the room's own limits.
+func (s *Server) setRoomMediaPolicy(w http.ResponseWriter, r *http.Request) {
+	roomID, _, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	var req db.MediaPolicy
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	var p db.MediaPolicy
+	for _, list := range []struct {
+		in  []string
+		out *[]string
+	}{{req.Allowed, &p.Allowed}, {req.Blocked, &p.Blocked}} {
+		if len(list.in) > maxMediaPolicyEntries {
+			jsonError(w, http.StatusBadRequest, "too many media types")
+			return
+		}
+		*list.out = []string{}
+		seen := map[string]bool{}
+		for _, t := range list.in {
+			t, valid := db.NormalizeMediaType(t)
+			if !valid {
+				jsonError(w, http.StatusBadRequest, "media types must be MIME types like image/png or image/*")
+				return
+			}
+			if !seen[t] {
+				seen[t] = true
+				*list.out = append(*list.out, t)
+			}
+		}
+	}
+	if err := s.Store.SetRoomMediaPolicy(r.Context(), roomID, p); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "room not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to save media policy")
+		return
+	}
+	jsonResponse(w, http.StatusOK, p)
+}
@@ -0,0 +1,94 @@
+package httpapi
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/ws"
+
+	"github.com/google/uuid"
+)
+
+// announceMembership tells roomID's sockets its new member list and every
+// member's events socket, plus userID's when they left, that membership
+// changed. It runs after the change is stored and goes through the hub, so
+// connections on other instances hear about it too.
+func (s *Server) announceMembership(roomID, userID uuid.UUID, change string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	members, err := s.Store.ListRoomMembers(ctx, roomID)
+	if err != nil {
+		log.Printf("announce membership change in room %s: %v", roomID, err)
+		return
+	}
+	s.Hub.Broadcast(roomID, ws.ParticipantsEvent{Participants: ws.ParticipantsFromMembers(members)})
+	event := ws.MembershipMessage(roomID, userID, change, len(members))
+	for _, m := range members {
+		s.Hub.BroadcastUser(m.ID, event)
+	}
+	if change == ws.MemberLeft {
+		s.Hub.BroadcastUser(userID, event)
+	}
+}
+
+// announceRoomDeleted tells the former members of a deleted room, listed
+// before the delete, to drop it from their room lists.
+func (s *Server) announceRoomDeleted(roomID uuid.UUID, members []db.RoomMember) {
+	event := ws.MembershipMessage(roomID, uuid.Nil, ws.RoomDeleted, 0)
+	for _, m := range members {
+		s.Hub.BroadcastUser(m.ID, event)
+	}
+}
+
+// logMembership appends to the room's membership log. The change itself is
+// already stored, so a failure is logged rather than failing the request.
+func (s *Server) logMembership(ctx context.Context, ev db.MembershipEvent) {
+	if err := s.Store.RecordMembershipEvent(ctx, ev); err != nil {
+		log.Printf("membership log: %s %s in room %s via %s: %v", ev.UserID, ev.Action, ev.RoomID, ev.Via, err)
+	}
+}
+
+// listMembershipLog shows room admins who joined and left, who let them in
+// and how. ?before=<id> pages back.
+func (s *Server) listMembershipLog(w http.ResponseWriter, r *http.Request) {
+	roomID, _, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	var before int64
+	if raw := r.URL.Query().Get("before"); raw != "" {
+		var err error
+		before, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil || before <= 0 {
+			jsonError(w, http.StatusBadRequest, "invalid before")
+			return
+		}
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	events, err := s.Store.ListMembershipEvents(r.Context(), roomID, before, limit)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load membership log")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"events": events})
+}
+
+// listInviteLinks shows room admins every link into the room with how many
+// members each brought in and when, so they can tell which shared links
+// work.
+func (s *Server) listInviteLinks(w http.ResponseWriter, r *http.Request) {
+	roomID, _, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	links, err := s.Store.ListInviteLinkStats(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load invite links")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"links": links})
+}
@@ -0,0 +1,82 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+
+	"github.com/google/uuid"
+)
+
+// listMyMentions is the mentions inbox: messages across the user's rooms
+// that @mentioned them, newest first, each with its room's name and whether
+// they have read that far. ?unread=true keeps only the unread ones.
+func (s *Server) listMyMentions(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	p, err := parsePage(r, 50, 100)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var before int64
+	if p.Cursor != "" {
+		before, err = strconv.ParseInt(strings.TrimPrefix(p.Cursor, "b:"), 10, 64)
+		if err != nil || before <= 0 || !strings.HasPrefix(p.Cursor, "b:") {
+			jsonError(w, http.StatusBadRequest, errInvalidCursor.Error())
+			return
+		}
+	}
+	hideNSFW, err := s.hidesNSFW(r.Context(), user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load content settings")
+		return
+	}
+	mentions, err := s.Store.ListMentions(r.Context(), user.ID, db.MentionFilter{
+		Before:     before,
+		Limit:      p.Limit,
+		UnreadOnly: r.URL.Query().Get("unread") == "true",
+		HideNSFW:   hideNSFW,
+	})
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load mentions")
+		return
+	}
+	next := ""
+	if len(mentions) == p.Limit {
+		next = encodeCursor(fmt.Sprintf("b:%d", mentions[len(mentions)-1].Message.ID))
+	}
+
+	// Masking and NSFW media are applied room by room, as the room views
+	// would show them.
+	byRoom := make(map[uuid.UUID][]int)
+	for i, m := range mentions {
+		byRoom[m.Message.RoomID] = append(byRoom[m.Message.RoomID], i)
+	}
+	for roomID, idx := range byRoom {
+		msgs := make([]db.Message, len(idx))
+		for j, i := range idx {
+			msgs[j] = mentions[i].Message
+		}
+		if hideNSFW {
+			msgs = db.WithholdNSFWMedia(msgs)
+		}
+		msgs = s.maskFor(r.Context(), roomID, user.ID, msgs)
+		for j, i := range idx {
+			mentions[i].Message = msgs[j]
+		}
+	}
+
+	setNextPage(w, r, next)
+	jsonResponse(w, http.StatusOK, map[string]any{
+		"mentions":    mentions,
+		"next_cursor": next,
+	})
+}
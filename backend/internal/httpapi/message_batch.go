@@ -0,0 +1,125 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+	"talkie/backend/internal/ws"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	maxBatchMessages  = 500
+	maxBatchBodyBytes = 4 << 20
+)
+
+// postMessageBatch lets a bot account post many messages to a room in one
+// request and one INSERT. Members see them arrive as ordinary chat messages.
+func (s *Server) postMessageBatch(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBatchBodyBytes)
+	var req struct {
+		Messages []struct {
+			Content      string     `json:"content"`
+			ClientSentAt *time.Time `json:"client_sent_at"`
+		} `json:"messages"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if len(req.Messages) == 0 || len(req.Messages) > maxBatchMessages {
+		jsonError(w, http.StatusBadRequest, fmt.Sprintf("messages must contain 1 to %d entries", maxBatchMessages))
+		return
+	}
+
+	u, err := s.Store.FindUserByID(r.Context(), user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load user")
+		return
+	}
+	if !u.IsBot {
+		jsonError(w, http.StatusForbidden, "only bot accounts can post message batches")
+		return
+	}
+	if _, err := s.Store.GetRoomByID(r.Context(), roomID); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "room not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to load room")
+		return
+	}
+	member, err := s.Store.IsRoomMember(r.Context(), roomID, user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check membership")
+		return
+	}
+	if !member {
+		jsonError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+
+	now := time.Now()
+	batch := make([]db.NewMessage, 0, len(req.Messages))
+	for i, m := range req.Messages {
+		if strings.TrimSpace(m.Content) == "" {
+			jsonError(w, http.StatusBadRequest, fmt.Sprintf("message %d is empty", i))
+			return
+		}
+		batch = append(batch, db.NewMessage{
+			UserID:       user.ID,
+			Content:      m.Content,
+			MessageType:  "text",
+			ClientSentAt: db.CheckClientSentAt(m.ClientSentAt, now),
+		})
+	}
+	saved, err := s.Store.SaveMessagesBatch(r.Context(), roomID, batch)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to save messages")
+		return
+	}
+	s.publishMessages(r.Context(), saved)
+
+	jsonResponse(w, http.StatusCreated, map[string]any{"messages": saved})
+}
+
+// publishMessages delivers a batch saved outside a chat socket. Every
+// message goes to the room as chat; members' event sockets and push get
+// only the last one, which is enough to move their unread badges.
+func (s *Server) publishMessages(ctx context.Context, msgs []db.Message) {
+	var last *db.Message
+	for i := range msgs {
+		msg := msgs[i]
+		s.History.Append(msg)
+		msg.ContentMasked = s.Automod.MaskText(ctx, msg.RoomID, msg.Content)
+		payload := ws.PayloadFromMessage(msg)
+		if msg.Shadowed {
+			s.Hub.SendToRoomUser(msg.RoomID, msg.UserID, ws.ChatEvent{Message: payload})
+			continue
+		}
+		s.Hub.Broadcast(msg.RoomID, ws.ChatEvent{Message: payload})
+		last = &msg
+	}
+	if last != nil {
+		s.broadcastRoomMessageEvent(ctx, *last)
+	}
+}
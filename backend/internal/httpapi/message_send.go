@@ -0,0 +1,134 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+	"talkie/backend/internal/textnorm"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const maxIdempotencyKeyLength = 128
+
+// checkMessageLength refuses message text over MAX_MESSAGE_LENGTH with a
+// structured 400 the client can show without parsing the message.
+func (s *Server) checkMessageLength(w http.ResponseWriter, content string) bool {
+	if utf8.RuneCountInString(content) <= s.Cfg.MaxMessageLength {
+		return true
+	}
+	jsonResponse(w, http.StatusBadRequest, map[string]any{
+		"error":      "message is too long",
+		"code":       "message_too_long",
+		"max_length": s.Cfg.MaxMessageLength,
+	})
+	return false
+}
+
+// sendMessage is the REST equivalent of a "chat" frame on the room socket,
+// for clients flushing messages they queued while offline. An
+// Idempotency-Key header (or "idempotency_key" in the body) makes retries
+// safe: resending with the same key returns the original message with 200
+// instead of posting it again.
+func (s *Server) sendMessage(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return
+	}
+
+	var req struct {
+		Content        string     `json:"content"`
+		ClientSentAt   *time.Time `json:"client_sent_at"`
+		IdempotencyKey string     `json:"idempotency_key"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	req.Content = textnorm.Message(req.Content)
+	if strings.TrimSpace(req.Content) == "" {
+		jsonError(w, http.StatusBadRequest, "content is required")
+		return
+	}
+	if !s.checkMessageLength(w, req.Content) {
+		return
+	}
+	key := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+	if key == "" {
+		key = strings.TrimSpace(req.IdempotencyKey)
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		jsonError(w, http.StatusBadRequest, "idempotency key is too long")
+		return
+	}
+
+	member, err := s.Store.IsRoomMember(r.Context(), roomID, user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check membership")
+		return
+	}
+	if !member {
+		jsonError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+	direct, err := s.Store.IsDirectRoom(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load room")
+		return
+	}
+
+	if verdict := s.Automod.Check(r.Context(), roomID, user.ID, req.Content); verdict.Blocked() {
+		jsonError(w, http.StatusForbidden, verdict.Notice)
+		return
+	}
+	if s.runSlashCommand(roomID, user.ID, user.Username, req.Content) {
+		jsonResponse(w, http.StatusAccepted, map[string]bool{"command": true})
+		return
+	}
+
+	sentAt := db.CheckClientSentAt(req.ClientSentAt, time.Now())
+	var msg db.Message
+	created := true
+	if key == "" {
+		msg, err = s.Store.SaveMessage(r.Context(), roomID, user.ID, req.Content, sentAt)
+	} else {
+		msg, created, err = s.Store.SaveMessageOnce(r.Context(), roomID, user.ID, req.Content, sentAt, key)
+	}
+	if err != nil {
+		switch err {
+		case db.ErrIdempotencyConflict:
+			jsonError(w, http.StatusConflict, "idempotency key was already used for a different message")
+		case db.ErrNotFound:
+			jsonError(w, http.StatusGone, "the message sent with this idempotency key was deleted")
+		default:
+			jsonError(w, http.StatusInternalServerError, "failed to save message")
+		}
+		return
+	}
+	if direct {
+		msg.DeliveryState = "sent"
+	}
+	if !created {
+		w.Header().Set("Idempotent-Replayed", "true")
+		jsonResponse(w, http.StatusOK, msg)
+		return
+	}
+
+	s.publishMessage(r.Context(), msg)
+	if direct && !msg.Shadowed {
+		s.Hub.DeliverDirect(r.Context(), s.Store, msg)
+	}
+	jsonResponse(w, http.StatusCreated, msg)
+}
@@ -0,0 +1,276 @@
+package httpapi
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/langdetect"
+	"talkie/backend/internal/middleware"
+	"talkie/backend/internal/textnorm"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	maxDictionaryName      = 100
+	maxDictionaryWords     = 50000
+	maxDictionaryWordChars = 200
+	maxDictionaryBytes     = 4 << 20
+	maxModerationTestChars = 4000
+)
+
+// dictionaryInput is a dictionary as admins send it. Fields left out keep
+// their value on update.
+type dictionaryInput struct {
+	Name     *string   `json:"name"`
+	Kind     *string   `json:"kind"`
+	Language *string   `json:"language"`
+	Words    *[]string `json:"words"`
+	Enabled  *bool     `json:"enabled"`
+}
+
+func (s *Server) listModerationDictionaries(w http.ResponseWriter, r *http.Request) {
+	dicts, err := s.Store.ListModerationDictionaries(r.Context(), false)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load dictionaries")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"dictionaries": dicts})
+}
+
+func (s *Server) getModerationDictionary(w http.ResponseWriter, r *http.Request) {
+	d, ok := s.loadModerationDictionary(w, r)
+	if !ok {
+		return
+	}
+	jsonResponse(w, http.StatusOK, d)
+}
+
+// createModerationDictionary stores a word list. The body is either JSON
+// or, to upload a file, text/plain with one word or phrase a line and the
+// other fields in the query string.
+func (s *Server) createModerationDictionary(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	d := db.ModerationDictionary{Enabled: true, CreatedBy: &user.ID}
+	if !s.decodeModerationDictionary(w, r, &d) {
+		return
+	}
+	created, err := s.Store.CreateModerationDictionary(r.Context(), d)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to save dictionary")
+		return
+	}
+	s.Automod.InvalidateDictionaries()
+	created.Words = nil
+	jsonResponse(w, http.StatusCreated, created)
+}
+
+// updateModerationDictionary changes the fields present in the body; a
+// text/plain body replaces the words.
+func (s *Server) updateModerationDictionary(w http.ResponseWriter, r *http.Request) {
+	d, ok := s.loadModerationDictionary(w, r)
+	if !ok {
+		return
+	}
+	if !s.decodeModerationDictionary(w, r, &d) {
+		return
+	}
+	updated, err := s.Store.UpdateModerationDictionary(r.Context(), d)
+	if err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "dictionary not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to save dictionary")
+		return
+	}
+	s.Automod.InvalidateDictionaries()
+	updated.Words = nil
+	jsonResponse(w, http.StatusOK, updated)
+}
+
+func (s *Server) deleteModerationDictionary(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "dictionaryID"), 10, 64)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid dictionary id")
+		return
+	}
+	if err := s.Store.DeleteModerationDictionary(r.Context(), id); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "dictionary not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to delete dictionary")
+		return
+	}
+	s.Automod.InvalidateDictionaries()
+	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+func (s *Server) loadModerationDictionary(w http.ResponseWriter, r *http.Request) (db.ModerationDictionary, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "dictionaryID"), 10, 64)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid dictionary id")
+		return db.ModerationDictionary{}, false
+	}
+	d, err := s.Store.GetModerationDictionary(r.Context(), id)
+	if err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "dictionary not found")
+			return db.ModerationDictionary{}, false
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to load dictionary")
+		return db.ModerationDictionary{}, false
+	}
+	return d, true
+}
+
+// decodeModerationDictionary applies the request to d and checks the
+// result. It writes the response when it returns false.
+func (s *Server) decodeModerationDictionary(w http.ResponseWriter, r *http.Request, d *db.ModerationDictionary) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxDictionaryBytes)
+	var in dictionaryInput
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "text/plain" {
+		words, err := readDictionaryLines(r.Body)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, "failed to read word list")
+			return false
+		}
+		in.Words = &words
+		q := r.URL.Query()
+		in.Name, in.Kind, in.Language = queryParam(q, "name"), queryParam(q, "kind"), queryParam(q, "language")
+	} else if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return false
+	}
+
+	if in.Name != nil {
+		d.Name = strings.TrimSpace(*in.Name)
+	}
+	if in.Kind != nil {
+		if d.ID != 0 && *in.Kind != d.Kind {
+			jsonError(w, http.StatusBadRequest, "a dictionary's kind cannot change")
+			return false
+		}
+		d.Kind = *in.Kind
+	}
+	if in.Language != nil {
+		d.Language = ""
+		if tag := strings.TrimSpace(*in.Language); tag != "" {
+			lang, valid := langdetect.Canonical(tag)
+			if !valid {
+				jsonError(w, http.StatusBadRequest, "language must be a language tag such as en or pt-BR, or empty for all languages")
+				return false
+			}
+			d.Language = lang
+		}
+	}
+	if in.Words != nil {
+		d.Words = make([]string, 0, len(*in.Words))
+		seen := make(map[string]bool, len(*in.Words))
+		for _, word := range *in.Words {
+			word = textnorm.Message(strings.TrimSpace(word))
+			if word == "" || seen[strings.ToLower(word)] {
+				continue
+			}
+			if utf8.RuneCountInString(word) > maxDictionaryWordChars {
+				jsonError(w, http.StatusBadRequest, fmt.Sprintf("words and phrases are limited to %d characters", maxDictionaryWordChars))
+				return false
+			}
+			seen[strings.ToLower(word)] = true
+			d.Words = append(d.Words, word)
+		}
+	}
+	if in.Enabled != nil {
+		d.Enabled = *in.Enabled
+	}
+
+	if d.Name == "" || utf8.RuneCountInString(d.Name) > maxDictionaryName {
+		jsonError(w, http.StatusBadRequest, fmt.Sprintf("name must be 1 to %d characters", maxDictionaryName))
+		return false
+	}
+	if !slices.Contains(db.DictionaryKinds, d.Kind) {
+		jsonError(w, http.StatusBadRequest, "kind must be one of "+strings.Join(db.DictionaryKinds, ", "))
+		return false
+	}
+	if len(d.Words) > maxDictionaryWords {
+		jsonError(w, http.StatusBadRequest, fmt.Sprintf("at most %d words a dictionary", maxDictionaryWords))
+		return false
+	}
+	return true
+}
+
+// queryParam returns q's key, or nil when it is absent.
+func queryParam(q url.Values, key string) *string {
+	if !q.Has(key) {
+		return nil
+	}
+	v := q.Get(key)
+	return &v
+}
+
+// readDictionaryLines reads an uploaded word list: one word or phrase a
+// line, blank lines and lines starting with # skipped.
+func readDictionaryLines(body io.Reader) ([]string, error) {
+	words := []string{}
+	sc := bufio.NewScanner(body)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			words = append(words, line)
+		}
+	}
+	return words, sc.Err()
+}
+
+// testModeration shows what auto-moderation makes of a sample message with
+// the dictionaries as they are now and, given a room, the room's rules.
+func (s *Server) testModeration(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Content  string    `json:"content"`
+		Language string    `json:"language"`
+		RoomID   uuid.UUID `json:"room_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	content := textnorm.Message(req.Content)
+	if strings.TrimSpace(content) == "" || utf8.RuneCountInString(content) > maxModerationTestChars {
+		jsonError(w, http.StatusBadRequest, fmt.Sprintf("content must be 1 to %d characters", maxModerationTestChars))
+		return
+	}
+	lang := ""
+	if tag := strings.TrimSpace(req.Language); tag != "" {
+		var valid bool
+		if lang, valid = langdetect.Canonical(tag); !valid {
+			jsonError(w, http.StatusBadRequest, "language must be a language tag such as en or pt-BR")
+			return
+		}
+	}
+	res, err := s.Automod.Test(r.Context(), req.RoomID, lang, content)
+	if err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "room not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to test message")
+		return
+	}
+	jsonResponse(w, http.StatusOK, res)
+}
@@ -0,0 +1,90 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+)
+
+const maxQuietWindows = 7
+
+func (s *Server) getNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	ns, err := s.Store.GetNotificationSettings(r.Context(), user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load notification settings")
+		return
+	}
+	jsonResponse(w, http.StatusOK, ns)
+}
+
+// setNotificationSettings updates the fields present in the body and leaves
+// the rest as they were. Quiet hours are kept in the timezone of the user's
+// locale settings.
+func (s *Server) setNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	var req struct {
+		AdminEmails *bool          `json:"admin_emails"`
+		QuietHours  *db.QuietHours `json:"quiet_hours"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.QuietHours != nil {
+		if msg := validQuietHours(*req.QuietHours); msg != "" {
+			jsonError(w, http.StatusBadRequest, msg)
+			return
+		}
+	}
+	ns, err := s.Store.GetNotificationSettings(r.Context(), user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load notification settings")
+		return
+	}
+	if req.AdminEmails != nil {
+		ns.AdminEmails = *req.AdminEmails
+	}
+	if req.QuietHours != nil {
+		ns.QuietHours = *req.QuietHours
+		if ns.QuietHours.Windows == nil {
+			ns.QuietHours.Windows = []db.QuietWindow{}
+		}
+	}
+	if err := s.Store.SetNotificationSettings(r.Context(), user.ID, ns); err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to save notification settings")
+		return
+	}
+	jsonResponse(w, http.StatusOK, ns)
+}
+
+// validQuietHours returns why q cannot be saved, or "".
+func validQuietHours(q db.QuietHours) string {
+	if len(q.Windows) > maxQuietWindows {
+		return "at most 7 quiet hours windows"
+	}
+	for _, win := range q.Windows {
+		if _, ok := db.ParseClock(win.Start); !ok {
+			return "quiet hours start must be HH:MM"
+		}
+		if _, ok := db.ParseClock(win.End); !ok {
+			return "quiet hours end must be HH:MM"
+		}
+		for _, d := range win.Days {
+			if d < 0 || d > 6 {
+				return "quiet hours days must be 0 (Sunday) to 6"
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,161 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// nsfwAccess applies userID's NSFW opt-out to roomID. Members who opted
+// out are refused NSFW rooms outright; elsewhere hide tells the caller to
+// withhold flagged media. It writes the error response when ok is false.
+func (s *Server) nsfwAccess(w http.ResponseWriter, r *http.Request, roomID, userID uuid.UUID) (hide bool, ok bool) {
+	hide, err := s.hidesNSFW(r.Context(), userID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load content settings")
+		return false, false
+	}
+	if !hide {
+		return false, true
+	}
+	nsfw, err := s.Store.GetRoomNSFW(r.Context(), roomID)
+	if err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "room not found")
+			return false, false
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to load room")
+		return false, false
+	}
+	if nsfw {
+		jsonError(w, http.StatusForbidden, "this room is marked NSFW and your settings hide NSFW content")
+		return false, false
+	}
+	return true, true
+}
+
+// viewable is db.VisibleTo plus withholding NSFW media from members who
+// opted out.
+func viewable(messages []db.Message, viewer uuid.UUID, hideNSFW bool) []db.Message {
+	messages = db.VisibleTo(messages, viewer)
+	if hideNSFW {
+		messages = db.WithholdNSFWMedia(messages)
+	}
+	return messages
+}
+
+// classifyUpload runs the optional classifier over a stored upload. A
+// classifier failure is logged and the image treated as safe, so an outage
+// does not block uploads.
+func (s *Server) classifyUpload(ctx context.Context, path, contentType string) bool {
+	if s.NSFW == nil {
+		return false
+	}
+	image, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("nsfw classify: read %s: %v", path, err)
+		return false
+	}
+	flagged, err := s.NSFW.Classify(ctx, contentType, image)
+	if err != nil {
+		log.Printf("nsfw classify %s: %v", path, err)
+		return false
+	}
+	return flagged
+}
+
+// getRoomNSFW tells any member whether the room is marked NSFW.
+func (s *Server) getRoomNSFW(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return
+	}
+	member, err := s.Store.IsRoomMember(r.Context(), roomID, user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check membership")
+		return
+	}
+	if !member {
+		jsonError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+	nsfw, err := s.Store.GetRoomNSFW(r.Context(), roomID)
+	if err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "room not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to load room")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]bool{"nsfw": nsfw})
+}
+
+func (s *Server) setRoomNSFW(w http.ResponseWriter, r *http.Request) {
+	roomID, _, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		NSFW bool `json:"nsfw"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := s.Store.SetRoomNSFW(r.Context(), roomID, req.NSFW); err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to save room")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]bool{"nsfw": req.NSFW})
+}
+
+func (s *Server) getContentSettings(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	hide, err := s.Store.GetUserHideNSFW(r.Context(), user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load content settings")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]bool{"hide_nsfw": hide})
+}
+
+// setContentSettings takes effect for new requests and connections; sockets
+// already open keep the setting they were opened with.
+func (s *Server) setContentSettings(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	var req struct {
+		HideNSFW bool `json:"hide_nsfw"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := s.Store.SetUserHideNSFW(r.Context(), user.ID, req.HideNSFW); err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to save content settings")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]bool{"hide_nsfw": req.HideNSFW})
+}
@@ -0,0 +1,212 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// ownershipOfferTTL is how long the new owner has to accept a transfer.
+const ownershipOfferTTL = 7 * 24 * time.Hour
+
+// ownershipRequest resolves the room and the caller for the transfer
+// endpoints. It writes the error response when ok is false.
+func (s *Server) ownershipRequest(w http.ResponseWriter, r *http.Request) (room db.Room, user middleware.UserContext, ok bool) {
+	user, ok = middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return db.Room{}, user, false
+	}
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return db.Room{}, user, false
+	}
+	room, err = s.Store.GetRoomByID(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusNotFound, "room not found")
+		return db.Room{}, user, false
+	}
+	return room, user, true
+}
+
+// getOwnershipTransfer shows the room's pending transfer to its owner and
+// to the member it is offered to.
+func (s *Server) getOwnershipTransfer(w http.ResponseWriter, r *http.Request) {
+	room, user, ok := s.ownershipRequest(w, r)
+	if !ok {
+		return
+	}
+	t, err := s.Store.GetOwnershipTransfer(r.Context(), room.ID)
+	if err != nil && err != db.ErrNotFound {
+		jsonError(w, http.StatusInternalServerError, "failed to load ownership transfer")
+		return
+	}
+	if err == db.ErrNotFound || (user.ID != room.CreatedBy && user.ID != t.ToUserID) {
+		jsonError(w, http.StatusNotFound, "no pending ownership transfer")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"transfer": t})
+}
+
+// transferOwnership offers the room to another member. Nothing changes
+// until they accept; offering again replaces the earlier offer.
+func (s *Server) transferOwnership(w http.ResponseWriter, r *http.Request) {
+	room, user, ok := s.ownershipRequest(w, r)
+	if !ok {
+		return
+	}
+	if user.ID != room.CreatedBy {
+		jsonError(w, http.StatusForbidden, "only the room owner can transfer it")
+		return
+	}
+	direct, err := s.Store.IsDirectRoom(r.Context(), room.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check room type")
+		return
+	}
+	if direct {
+		jsonError(w, http.StatusBadRequest, "direct messages have no owner to transfer")
+		return
+	}
+	var req struct {
+		UserID string `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	targetID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	if targetID == user.ID {
+		jsonError(w, http.StatusBadRequest, "you already own this room")
+		return
+	}
+	member, err := s.Store.IsRoomMember(r.Context(), room.ID, targetID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check membership")
+		return
+	}
+	if !member {
+		jsonError(w, http.StatusBadRequest, "the new owner must be a member of the room")
+		return
+	}
+	target, err := s.Store.FindUserByID(r.Context(), targetID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to find user")
+		return
+	}
+	if target.GuestExpiresAt != nil {
+		jsonError(w, http.StatusBadRequest, "guests cannot own rooms")
+		return
+	}
+
+	t, err := s.Store.CreateOwnershipTransfer(r.Context(), room.ID, user.ID, targetID, time.Now().UTC().Add(ownershipOfferTTL))
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to create ownership transfer")
+		return
+	}
+	go s.notifyOwnership(targetID, "room.ownership_offer", "Room ownership offered",
+		fmt.Sprintf("%s wants to make you the owner of %s.", user.Username, room.Name), t)
+	jsonResponse(w, http.StatusAccepted, map[string]any{"status": "pending", "transfer": t})
+}
+
+// acceptOwnershipTransfer makes the caller the owner of the room if it was
+// offered to them, and posts a system message saying so.
+func (s *Server) acceptOwnershipTransfer(w http.ResponseWriter, r *http.Request) {
+	room, user, ok := s.ownershipRequest(w, r)
+	if !ok {
+		return
+	}
+	t, err := s.Store.AcceptOwnershipTransfer(r.Context(), room.ID, user.ID)
+	if err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "no pending ownership transfer for you")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to transfer ownership")
+		return
+	}
+	go s.announceOwnership(room, t)
+	jsonResponse(w, http.StatusOK, map[string]any{"ok": true, "transfer": t})
+}
+
+// cancelOwnershipTransfer lets the owner withdraw a pending offer and the
+// member it was offered to decline it.
+func (s *Server) cancelOwnershipTransfer(w http.ResponseWriter, r *http.Request) {
+	room, user, ok := s.ownershipRequest(w, r)
+	if !ok {
+		return
+	}
+	t, err := s.Store.GetOwnershipTransfer(r.Context(), room.ID)
+	if err != nil && err != db.ErrNotFound {
+		jsonError(w, http.StatusInternalServerError, "failed to load ownership transfer")
+		return
+	}
+	if err == db.ErrNotFound || (user.ID != room.CreatedBy && user.ID != t.ToUserID) {
+		jsonError(w, http.StatusNotFound, "no pending ownership transfer")
+		return
+	}
+	if err := s.Store.DeleteOwnershipTransfer(r.Context(), room.ID); err != nil && err != db.ErrNotFound {
+		jsonError(w, http.StatusInternalServerError, "failed to cancel ownership transfer")
+		return
+	}
+	if user.ID == t.ToUserID {
+		go s.notifyOwnership(t.FromUserID, "room.ownership_declined", "Room ownership declined",
+			fmt.Sprintf("%s declined to become the owner of %s.", user.Username, room.Name), t)
+	}
+	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+// announceOwnership posts the transfer to the room as a system message from
+// the previous owner and tells them it went through.
+func (s *Server) announceOwnership(room db.Room, t db.OwnershipTransfer) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	from, err := s.Store.FindUserByID(ctx, t.FromUserID)
+	if err != nil {
+		log.Printf("announce ownership transfer of room %s: %v", room.ID, err)
+		return
+	}
+	to, err := s.Store.FindUserByID(ctx, t.ToUserID)
+	if err != nil {
+		log.Printf("announce ownership transfer of room %s: %v", room.ID, err)
+		return
+	}
+	msg, err := s.Store.SaveMessageWithType(ctx, room.ID, from.ID,
+		fmt.Sprintf("%s transferred ownership of this room to %s.", from.Username, to.Username), "system", "")
+	if err != nil {
+		log.Printf("announce ownership transfer of room %s: %v", room.ID, err)
+	} else {
+		s.publishMessage(ctx, msg)
+	}
+	s.notifyOwnership(from.ID, "room.ownership_accepted", "Room ownership transferred",
+		fmt.Sprintf("%s is now the owner of %s.", to.Username, room.Name), t)
+}
+
+func (s *Server) notifyOwnership(userID uuid.UUID, kind, title, body string, t db.OwnershipTransfer) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	n, err := s.Store.CreateNotification(ctx, userID, kind, title, body, map[string]any{
+		"room_id":      t.RoomID,
+		"from_user_id": t.FromUserID,
+		"to_user_id":   t.ToUserID,
+	})
+	if err != nil {
+		log.Printf("ownership notification %s: %v", kind, err)
+		return
+	}
+	s.Hub.SendNotification(n)
+}
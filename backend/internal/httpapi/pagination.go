@@ -0,0 +1,116 @@
+package httpapi
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// List endpoints share one convention: ?limit=<n>&cursor=<opaque>. When more
+// results exist the response carries a Link rel="next" header and an
+// X-Next-Cursor header; handlers whose body is an object also include
+// "next_cursor". Cursors are opaque to clients and only valid for the
+// endpoint and filters that produced them.
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+type page struct {
+	Limit  int
+	Cursor string
+}
+
+func parsePage(r *http.Request, defaultLimit, maxLimit int) (page, error) {
+	p := page{Limit: defaultLimit}
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return page{}, errors.New("invalid limit")
+		}
+		p.Limit = min(n, maxLimit)
+	}
+	if raw := r.URL.Query().Get("cursor"); raw != "" {
+		b, err := base64.RawURLEncoding.DecodeString(raw)
+		if err != nil {
+			return page{}, errInvalidCursor
+		}
+		p.Cursor = string(b)
+	}
+	return p, nil
+}
+
+func encodeCursor(v string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(v))
+}
+
+// setNextPage advertises the next page. An empty cursor means this was the
+// last one.
+func setNextPage(w http.ResponseWriter, r *http.Request, cursor string) {
+	if cursor == "" {
+		return
+	}
+	q := r.URL.Query()
+	q.Set("cursor", cursor)
+	next := *r.URL
+	next.RawQuery = q.Encode()
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()))
+	w.Header().Set("X-Next-Cursor", cursor)
+}
+
+// offsetPage pages a list that is already fully loaded and ordered, using
+// the position as the cursor. It returns the page and the next cursor.
+func offsetPage[T any](items []T, p page) ([]T, string, error) {
+	offset := 0
+	if p.Cursor != "" {
+		n, err := strconv.Atoi(strings.TrimPrefix(p.Cursor, "o:"))
+		if err != nil || n < 0 || !strings.HasPrefix(p.Cursor, "o:") {
+			return nil, "", errInvalidCursor
+		}
+		offset = min(n, len(items))
+	}
+	end := min(offset+p.Limit, len(items))
+	next := ""
+	if end < len(items) {
+		next = encodeCursor("o:" + strconv.Itoa(end))
+	}
+	return items[offset:end], next, nil
+}
+
+// filterByName keeps items whose name contains q, case-insensitively.
+func filterByName[T any](items []T, q string, name func(T) string) []T {
+	q = strings.ToLower(strings.TrimSpace(q))
+	if q == "" {
+		return items
+	}
+	out := make([]T, 0, len(items))
+	for _, item := range items {
+		if strings.Contains(strings.ToLower(name(item)), q) {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// sortBy orders items by the ?sort= key, using the comparators the endpoint
+// supports. A leading "-" reverses the order. An empty key keeps the
+// store's order.
+func sortBy[T any](items []T, key string, comparators map[string]func(a, b T) int) error {
+	if key == "" {
+		return nil
+	}
+	desc := strings.HasPrefix(key, "-")
+	cmp, ok := comparators[strings.TrimPrefix(key, "-")]
+	if !ok {
+		return fmt.Errorf("invalid sort %q", key)
+	}
+	slices.SortStableFunc(items, func(a, b T) int {
+		if desc {
+			return cmp(b, a)
+		}
+		return cmp(a, b)
+	})
+	return nil
+}
@@ -0,0 +1,292 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+	"talkie/backend/internal/sms"
+)
+
+const (
+	// phoneCodesPerHour caps verification texts per user, since each one
+	// costs money and lands on someone's phone.
+	phoneCodesPerHour = 5
+	// Contact lookups are capped per request and per user so the endpoint
+	// cannot be used to walk the number space.
+	maxPhoneLookup      = 1000
+	phoneLookupsPerHour = 10
+)
+
+// A phone number is verified by a code texted to it before it is stored.
+// Only its keyed hash is kept, which is enough to keep numbers unique and
+// to match contacts, plus the number itself while SMS alerts are on.
+
+func (s *Server) getPhone(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	p, err := s.Store.GetPhone(r.Context(), user.ID)
+	if err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to load phone")
+		return
+	}
+	jsonResponse(w, http.StatusOK, struct {
+		db.UserPhone
+		SMSAvailable bool `json:"sms_available"`
+	}{p, s.SMS != nil})
+}
+
+// startPhoneVerification texts a code to the number in the body. The
+// number only replaces the current one once the code is entered.
+func (s *Server) startPhoneVerification(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	var req struct {
+		Phone string `json:"phone"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	phone := sms.Normalize(req.Phone)
+	if phone == "" {
+		jsonError(w, http.StatusBadRequest, "phone must be an international number starting with +")
+		return
+	}
+	st := s.phoneCodes.Take(user.ID.String())
+	if !st.Allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(st.RetryAfter.Seconds()))))
+		jsonError(w, http.StatusTooManyRequests, "too many codes requested, try again later")
+		return
+	}
+	code, err := randomDigits(6)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to create code")
+		return
+	}
+	if err := s.Store.StartPhoneVerification(r.Context(), user.ID, phone, s.phoneHash(phone), tokenHash(code)); err != nil {
+		if err == db.ErrPhoneTaken {
+			jsonError(w, http.StatusConflict, "phone number already in use")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to start verification")
+		return
+	}
+	text := "Your Talkie verification code is " + code
+	if s.SMS == nil {
+		log.Printf("SMS is not configured; verification code for %s is %s", phone, code)
+	} else if err := s.SMS.Send(r.Context(), phone, text); err != nil {
+		log.Printf("failed to text verification code to %s: %v", user.ID, err)
+		jsonError(w, http.StatusBadGateway, "failed to send code")
+		return
+	}
+	jsonResponse(w, http.StatusAccepted, map[string]string{"pending": phone})
+}
+
+func (s *Server) verifyPhone(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	var req struct {
+		Code string `json:"code"`
+		// SMSAlerts turns SMS alerts on or off along with the new number;
+		// left out, the current setting stays.
+		SMSAlerts *bool `json:"sms_alerts"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	req.Code = strings.TrimSpace(req.Code)
+	if req.Code == "" {
+		jsonError(w, http.StatusBadRequest, "code is required")
+		return
+	}
+	phone, left, err := s.Store.VerifyPhoneCode(r.Context(), user.ID, tokenHash(req.Code), s.Cfg.VerifyMaxAttempts, req.SMSAlerts)
+	switch {
+	case err == db.ErrNotFound:
+		jsonError(w, http.StatusBadRequest, "invalid or expired verification code")
+		return
+	case err == db.ErrCodeMismatch:
+		resp := map[string]any{"error": "invalid or expired verification code", "code": "invalid_code"}
+		if s.Cfg.VerifyMaxAttempts > 0 {
+			resp["attempts_remaining"] = left
+		}
+		jsonResponse(w, http.StatusBadRequest, resp)
+		return
+	case err == db.ErrTooManyAttempts:
+		jsonResponse(w, http.StatusTooManyRequests, map[string]any{
+			"error":              "too many wrong codes, request a new one",
+			"code":               "too_many_attempts",
+			"attempts_remaining": 0,
+		})
+		return
+	case err == db.ErrPhoneTaken:
+		jsonError(w, http.StatusConflict, "phone number already in use")
+		return
+	case err != nil:
+		jsonError(w, http.StatusInternalServerError, "failed to verify phone")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]string{"phone_hint": sms.Hint(phone)})
+}
+
+func (s *Server) deletePhone(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	if err := s.Store.ClearPhone(r.Context(), user.ID); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "no phone number")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to remove phone")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+func (s *Server) setSMSAlerts(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	var req struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+		jsonError(w, http.StatusBadRequest, "enabled is required")
+		return
+	}
+	if err := s.Store.SetSMSAlerts(r.Context(), user.ID, *req.Enabled); err != nil {
+		if err == db.ErrNotFound {
+			// Only the number's hash is kept while alerts are off, so
+			// there is nothing to text until it is verified again.
+			jsonResponse(w, http.StatusConflict, map[string]string{
+				"error": "verify your phone number with sms_alerts to turn alerts on",
+				"code":  "phone_required",
+			})
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to save setting")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]bool{"sms_alerts": *req.Enabled})
+}
+
+func (s *Server) setPhoneDiscoverable(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	var req struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+		jsonError(w, http.StatusBadRequest, "enabled is required")
+		return
+	}
+	if err := s.Store.SetPhoneDiscoverable(r.Context(), user.ID, *req.Enabled); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusConflict, "verify a phone number first")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to save setting")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]bool{"discoverable": *req.Enabled})
+}
+
+// lookupContacts finds the users among the caller's contacts who let
+// others discover them by number. The numbers are hashed on arrival and
+// never stored.
+func (s *Server) lookupContacts(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	restricted, err := s.isRestricted(r.Context(), user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load user")
+		return
+	}
+	if restricted {
+		jsonError(w, http.StatusForbidden, "contact lookup is not available to restricted accounts")
+		return
+	}
+	var req struct {
+		Phones []string `json:"phones"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if len(req.Phones) > maxPhoneLookup {
+		jsonError(w, http.StatusBadRequest, fmt.Sprintf("at most %d phones per lookup", maxPhoneLookup))
+		return
+	}
+	st := s.phoneLookups.Take(user.ID.String())
+	if !st.Allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(st.RetryAfter.Seconds()))))
+		jsonError(w, http.StatusTooManyRequests, "too many lookups, try again later")
+		return
+	}
+	// Several spellings of one number come back under each of them.
+	sent := make(map[string][]string, len(req.Phones))
+	hashes := make([]string, 0, len(req.Phones))
+	for _, raw := range req.Phones {
+		phone := sms.Normalize(raw)
+		if phone == "" {
+			continue
+		}
+		h := s.phoneHash(phone)
+		if _, ok := sent[h]; !ok {
+			hashes = append(hashes, h)
+		}
+		sent[h] = append(sent[h], raw)
+	}
+	found, err := s.Store.MatchPhones(r.Context(), user.ID, hashes)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to look up contacts")
+		return
+	}
+	type match struct {
+		Phone string `json:"phone"`
+		db.PhoneMatch
+	}
+	matches := []match{}
+	for _, m := range found {
+		for _, raw := range sent[m.PhoneHash] {
+			matches = append(matches, match{Phone: raw, PhoneMatch: m})
+		}
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"matches": matches})
+}
+
+// phoneHash is the keyed hash phone is stored and matched as.
+func (s *Server) phoneHash(phone string) string {
+	return sms.Hash(s.Cfg.PhoneHashKey, phone)
+}
@@ -0,0 +1,56 @@
+package httpapi
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"talkie/backend/internal/ws"
+
+	"github.com/google/uuid"
+)
+
+// presenceChanged is the hub's presence handler. The friend lookup runs off
+// the socket's goroutine.
+func (s *Server) presenceChanged(userID uuid.UUID) {
+	go s.announcePresence(userID)
+}
+
+// announcePresence tells userID's friends whether userID is online now.
+func (s *Server) announcePresence(userID uuid.UUID) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	friends, err := s.Store.ListFriends(ctx, userID)
+	if err != nil {
+		log.Printf("announce presence of %s: %v", userID, err)
+		return
+	}
+	event := ws.PresenceMessage(userID, s.Hub.IsUserOnline(userID))
+	for _, f := range friends {
+		s.Hub.BroadcastUser(f.ID, event)
+	}
+}
+
+// onlineFriends lists userID's friends with a socket open on this instance.
+func (s *Server) onlineFriends(ctx context.Context, userID uuid.UUID) ([]ws.Participant, error) {
+	friends, err := s.Store.ListFriends(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	online := make([]ws.Participant, 0, len(friends))
+	for _, f := range friends {
+		if s.Hub.IsUserOnline(f.ID) {
+			online = append(online, ws.Participant{ID: f.ID.String(), Username: f.Username, AvatarURL: f.AvatarURL})
+		}
+	}
+	return online, nil
+}
+
+// userWebSocket is the app shell's stream: everything /ws/events carries
+// (room messages and membership, DMs, friend requests, notifications,
+// presence changes) plus a presence_state snapshot of online friends when
+// it opens.
+func (s *Server) userWebSocket(w http.ResponseWriter, r *http.Request) {
+	s.serveUserEvents(w, r, true)
+}
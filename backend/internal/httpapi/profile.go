@@ -0,0 +1,208 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+	"talkie/backend/internal/profile"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const maxProfileFields = 50
+
+// profileSchema is every extra profile field: PROFILE_FIELDS first, then
+// those added through the admin API.
+func (s *Server) profileSchema(ctx context.Context) ([]profile.Field, error) {
+	stored, err := s.Store.ListProfileFields(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return profile.Merge(s.Cfg.ProfileFields, stored), nil
+}
+
+func (s *Server) listProfileFields(w http.ResponseWriter, r *http.Request) {
+	schema, err := s.profileSchema(r.Context())
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load profile fields")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"fields": schema})
+}
+
+// updateMe edits the caller's extra profile fields, time zone, locale and
+// contact sharing.
+// Only what the body names changes; null or "" clears it. Changing the time
+// zone also returns a fresh token carrying it in X-Refreshed-Token.
+func (s *Server) updateMe(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	var req struct {
+		Profile  map[string]*string `json:"profile"`
+		Timezone *string            `json:"timezone"`
+		Locale   *string            `json:"locale"`
+		// ContactSharing is who may share the caller's contact card:
+		// "everyone", "friends" or "nobody".
+		ContactSharing *string `json:"contact_sharing"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.ContactSharing != nil && !checkContactSharing(*req.ContactSharing) {
+		jsonError(w, http.StatusBadRequest, "contact_sharing must be everyone, friends or nobody")
+		return
+	}
+	schema, err := s.profileSchema(r.Context())
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load profile fields")
+		return
+	}
+	for key, value := range req.Profile {
+		i := slices.IndexFunc(schema, func(f profile.Field) bool { return f.Key == key })
+		if i < 0 {
+			jsonError(w, http.StatusBadRequest, "unknown profile field "+key)
+			return
+		}
+		if value == nil {
+			continue
+		}
+		normalized, err := schema[i].Normalize(*value)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if normalized == "" {
+			req.Profile[key] = nil
+		} else {
+			req.Profile[key] = &normalized
+		}
+	}
+	if req.Timezone != nil || req.Locale != nil {
+		current, err := s.Store.GetUserLocale(r.Context(), user.ID)
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "failed to load locale")
+			return
+		}
+		next := current
+		if req.Timezone != nil {
+			next.Timezone = strings.TrimSpace(*req.Timezone)
+		}
+		if req.Locale != nil {
+			next.Locale = strings.TrimSpace(*req.Locale)
+		}
+		if err := checkTimezone(next.Timezone); err != nil {
+			jsonError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := checkLocale(next.Locale); err != nil {
+			jsonError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := s.Store.SetUserLocale(r.Context(), user.ID, next); err != nil {
+			jsonError(w, http.StatusInternalServerError, "failed to update locale")
+			return
+		}
+		if next.Timezone != current.Timezone {
+			u, err := s.Store.FindUserByID(r.Context(), user.ID)
+			if err != nil {
+				jsonError(w, http.StatusInternalServerError, "failed to load user")
+				return
+			}
+			token, err := s.issueToken(r.Context(), u, u.SessionVersion)
+			if err != nil {
+				jsonError(w, http.StatusInternalServerError, "failed to generate token")
+				return
+			}
+			w.Header().Set("X-Refreshed-Token", token)
+		}
+	}
+	if req.ContactSharing != nil {
+		if err := s.Store.SetContactSharing(r.Context(), user.ID, *req.ContactSharing); err != nil {
+			jsonError(w, http.StatusInternalServerError, "failed to update contact sharing")
+			return
+		}
+	}
+	if len(req.Profile) > 0 {
+		if _, err := s.Store.UpdateUserProfile(r.Context(), user.ID, req.Profile); err != nil {
+			jsonError(w, http.StatusInternalServerError, "failed to update profile")
+			return
+		}
+	}
+	s.me(w, r)
+}
+
+// visibleProfile loads userID's extra fields, leaving out values of fields
+// that no longer exist.
+func (s *Server) visibleProfile(ctx context.Context, userID uuid.UUID) (map[string]string, error) {
+	values, err := s.Store.GetUserProfile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := s.profileSchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return profile.Visible(schema, values), nil
+}
+
+// putProfileField creates or replaces a field. Fields from PROFILE_FIELDS
+// are fixed.
+func (s *Server) putProfileField(w http.ResponseWriter, r *http.Request) {
+	var f profile.Field
+	if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	f.Key = chi.URLParam(r, "key")
+	f.Builtin = false
+	if err := f.Check(); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	schema, err := s.profileSchema(r.Context())
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load profile fields")
+		return
+	}
+	i := slices.IndexFunc(schema, func(existing profile.Field) bool { return existing.Key == f.Key })
+	if i >= 0 && schema[i].Builtin {
+		jsonError(w, http.StatusConflict, "field is defined in PROFILE_FIELDS")
+		return
+	}
+	if i < 0 && len(schema) >= maxProfileFields {
+		jsonError(w, http.StatusConflict, "too many profile fields")
+		return
+	}
+	if err := s.Store.UpsertProfileField(r.Context(), f); err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to save profile field")
+		return
+	}
+	jsonResponse(w, http.StatusOK, f)
+}
+
+func (s *Server) deleteProfileField(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "key")
+	if slices.ContainsFunc(s.Cfg.ProfileFields, func(f profile.Field) bool { return f.Key == key }) {
+		jsonError(w, http.StatusConflict, "field is defined in PROFILE_FIELDS")
+		return
+	}
+	if err := s.Store.DeleteProfileField(r.Context(), key); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "profile field not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to delete profile field")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
+}
@@ -0,0 +1,67 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (s *Server) registerPushDevice(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	var req struct {
+		Platform string `json:"platform"`
+		Token    string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	req.Platform = strings.ToLower(strings.TrimSpace(req.Platform))
+	req.Token = strings.TrimSpace(req.Token)
+	if req.Platform != "fcm" && req.Platform != "apns" {
+		jsonError(w, http.StatusBadRequest, "platform must be fcm or apns")
+		return
+	}
+	if req.Token == "" || len(req.Token) > 4096 {
+		jsonError(w, http.StatusBadRequest, "token is required")
+		return
+	}
+
+	device, err := s.Store.RegisterPushDevice(r.Context(), user.ID, req.Platform, req.Token)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to register device")
+		return
+	}
+	jsonResponse(w, http.StatusCreated, device)
+}
+
+func (s *Server) unregisterPushDevice(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	token := strings.TrimSpace(chi.URLParam(r, "token"))
+	if token == "" {
+		jsonError(w, http.StatusBadRequest, "token is required")
+		return
+	}
+	if err := s.Store.DeletePushDevice(r.Context(), user.ID, token); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "device not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to unregister device")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
+}
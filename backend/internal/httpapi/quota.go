@@ -0,0 +1,284 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+	"talkie/backend/internal/quota"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// maxUploadCeiling caps uploads even when a plan sets no upload limit.
+const maxUploadCeiling = 64 << 20
+
+var planNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+func (s *Server) defaultLimits() quota.Limits {
+	return quota.Limits{
+		MaxRooms:       s.Cfg.QuotaMaxRooms,
+		MaxRoomMembers: s.Cfg.QuotaMaxRoomMembers,
+		MaxUploadBytes: int64(s.Cfg.QuotaMaxUploadMB) << 20,
+		HistoryDays:    s.Cfg.QuotaHistoryDays,
+	}
+}
+
+func (s *Server) userLimits(ctx context.Context, userID uuid.UUID) (quota.Limits, db.Plan, error) {
+	plan, err := s.Store.GetUserPlan(ctx, userID)
+	return s.defaultLimits().WithPlan(plan), plan, err
+}
+
+func (s *Server) roomLimits(ctx context.Context, roomID uuid.UUID) (quota.Limits, error) {
+	plan, err := s.Store.GetRoomPlan(ctx, roomID)
+	return s.defaultLimits().WithPlan(plan), err
+}
+
+// uploadLimit is the effective upload size limit, bounded by
+// maxUploadCeiling.
+func uploadLimit(l quota.Limits) int64 {
+	if l.MaxUploadBytes <= 0 || l.MaxUploadBytes > maxUploadCeiling {
+		return maxUploadCeiling
+	}
+	return l.MaxUploadBytes
+}
+
+// quotaError writes a structured 403 telling the client which quota was
+// hit, so it can offer an upgrade rather than a generic failure.
+func quotaError(w http.ResponseWriter, err *quota.ExceededError) {
+	jsonResponse(w, http.StatusForbidden, map[string]any{
+		"error": err.Error(),
+		"code":  "quota_exceeded",
+		"quota": err.Quota,
+		"limit": err.Limit,
+		"used":  err.Used,
+	})
+}
+
+// allowNewRoom checks userID may create one more room or channel. It writes
+// the response when it returns false.
+func (s *Server) allowNewRoom(w http.ResponseWriter, r *http.Request, userID uuid.UUID) bool {
+	limits, _, err := s.userLimits(r.Context(), userID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load quota")
+		return false
+	}
+	if limits.MaxRooms <= 0 {
+		return true
+	}
+	used, err := s.Store.CountRoomsCreatedBy(r.Context(), userID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load quota")
+		return false
+	}
+	return s.checkQuota(w, quota.Allow(quota.MaxRooms, int64(limits.MaxRooms), int64(used)))
+}
+
+// allowNewMember checks roomID can take one more member.
+func (s *Server) allowNewMember(w http.ResponseWriter, r *http.Request, roomID uuid.UUID) bool {
+	limits, err := s.roomLimits(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load quota")
+		return false
+	}
+	if limits.MaxRoomMembers <= 0 {
+		return true
+	}
+	used, err := s.Store.CountRoomMembers(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load quota")
+		return false
+	}
+	return s.checkQuota(w, quota.Allow(quota.MaxRoomMembers, int64(limits.MaxRoomMembers), int64(used)))
+}
+
+// allowNewGroupMember checks a workspace can take userID, counting everyone
+// in any of its channels. Existing members always get back in.
+func (s *Server) allowNewGroupMember(w http.ResponseWriter, r *http.Request, groupID, userID uuid.UUID) bool {
+	member, err := s.Store.IsGroupMember(r.Context(), groupID, userID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check membership")
+		return false
+	}
+	if member {
+		return true
+	}
+	plan, err := s.Store.GetGroupPlan(r.Context(), groupID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load quota")
+		return false
+	}
+	limits := s.defaultLimits().WithPlan(plan)
+	if limits.MaxRoomMembers <= 0 {
+		return true
+	}
+	used, err := s.Store.CountGroupMembers(r.Context(), groupID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load quota")
+		return false
+	}
+	return s.checkQuota(w, quota.Allow(quota.MaxRoomMembers, int64(limits.MaxRoomMembers), int64(used)))
+}
+
+// parseUpload reads a multipart upload of at most limit bytes, answering
+// with a quota error when the body is larger.
+func parseUpload(w http.ResponseWriter, r *http.Request, limit int64) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	if err := r.ParseMultipartForm(limit); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			quotaError(w, &quota.ExceededError{Quota: quota.MaxUploadBytes, Limit: limit})
+			return false
+		}
+		jsonError(w, http.StatusBadRequest, "invalid upload payload or file too large")
+		return false
+	}
+	return true
+}
+
+func (s *Server) checkQuota(w http.ResponseWriter, err error) bool {
+	var exceeded *quota.ExceededError
+	if errors.As(err, &exceeded) {
+		quotaError(w, exceeded)
+		return false
+	}
+	return true
+}
+
+// getMyQuota shows the caller their plan, effective limits and room usage.
+func (s *Server) getMyQuota(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	limits, plan, err := s.userLimits(r.Context(), user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load quota")
+		return
+	}
+	rooms, err := s.Store.CountRoomsCreatedBy(r.Context(), user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load quota")
+		return
+	}
+	limits.MaxUploadBytes = uploadLimit(limits)
+	jsonResponse(w, http.StatusOK, map[string]any{
+		"plan":   plan.Name,
+		"limits": limits,
+		"usage":  map[string]int{"rooms": rooms},
+	})
+}
+
+func (s *Server) listPlans(w http.ResponseWriter, r *http.Request) {
+	plans, err := s.Store.ListPlans(r.Context())
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load plans")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"defaults": s.defaultLimits(), "plans": plans})
+}
+
+// putPlan creates or replaces a plan. Omitted or null limits inherit the
+// instance defaults.
+func (s *Server) putPlan(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "plan")
+	if !planNamePattern.MatchString(name) {
+		jsonError(w, http.StatusBadRequest, "plan names are 1-32 lowercase letters, digits, dashes or underscores")
+		return
+	}
+	var plan db.Plan
+	if err := json.NewDecoder(r.Body).Decode(&plan); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	plan.Name = name
+	for _, v := range []*int{plan.MaxRooms, plan.MaxRoomMembers, plan.HistoryDays} {
+		if v != nil && *v < 0 {
+			jsonError(w, http.StatusBadRequest, "limits must not be negative")
+			return
+		}
+	}
+	if plan.MaxUploadBytes != nil && *plan.MaxUploadBytes < 0 {
+		jsonError(w, http.StatusBadRequest, "limits must not be negative")
+		return
+	}
+	if err := s.Store.UpsertPlan(r.Context(), plan); err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to save plan")
+		return
+	}
+	jsonResponse(w, http.StatusOK, plan)
+}
+
+func (s *Server) deletePlan(w http.ResponseWriter, r *http.Request) {
+	if err := s.Store.DeletePlan(r.Context(), chi.URLParam(r, "plan")); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "plan not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to delete plan")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+func decodePlanAssignment(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req struct {
+		Plan string `json:"plan"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return "", false
+	}
+	return req.Plan, true
+}
+
+// setUserPlan moves a user onto a plan; "" puts them back on the defaults.
+func (s *Server) setUserPlan(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(chi.URLParam(r, "userID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	plan, ok := decodePlanAssignment(w, r)
+	if !ok {
+		return
+	}
+	if err := s.Store.SetUserPlan(r.Context(), userID, plan); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "user or plan not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to update user")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]string{"plan": plan})
+}
+
+// setGroupPlan moves a workspace onto a plan; its channels follow it
+// instead of their creators' plans.
+func (s *Server) setGroupPlan(w http.ResponseWriter, r *http.Request) {
+	groupID, err := uuid.Parse(chi.URLParam(r, "groupID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid group id")
+		return
+	}
+	plan, ok := decodePlanAssignment(w, r)
+	if !ok {
+		return
+	}
+	if err := s.Store.SetGroupPlan(r.Context(), groupID, plan); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "group or plan not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to update group")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]string{"plan": plan})
+}
@@ -0,0 +1,257 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/ws"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	// joinWindow is how far back join velocity is measured.
+	joinWindow = time.Minute
+	// joinAlertCooldown keeps a sustained raid from paging admins on every
+	// join.
+	joinAlertCooldown = 15 * time.Minute
+)
+
+// joinVelocity counts invite-link joins per room over the last joinWindow
+// and says when a room crosses the spike threshold.
+type joinVelocity struct {
+	threshold int
+
+	mu        sync.Mutex
+	joins     map[uuid.UUID][]time.Time
+	alerted   map[uuid.UUID]time.Time
+	lastSweep time.Time
+}
+
+func newJoinVelocity(threshold int) *joinVelocity {
+	return &joinVelocity{threshold: threshold, joins: map[uuid.UUID][]time.Time{}, alerted: map[uuid.UUID]time.Time{}, lastSweep: time.Now()}
+}
+
+// record notes a join to roomID. When that takes the room over the
+// threshold and it has not been alerted on recently, it returns the number
+// of joins in the window; otherwise 0.
+func (v *joinVelocity) record(roomID uuid.UUID, now time.Time) int {
+	if v == nil || v.threshold <= 0 {
+		return 0
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if now.Sub(v.lastSweep) > joinAlertCooldown {
+		v.sweep(now)
+	}
+	recent := v.joins[roomID][:0]
+	for _, t := range v.joins[roomID] {
+		if now.Sub(t) < joinWindow {
+			recent = append(recent, t)
+		}
+	}
+	recent = append(recent, now)
+	v.joins[roomID] = recent
+	if len(recent) < v.threshold || now.Sub(v.alerted[roomID]) < joinAlertCooldown {
+		return 0
+	}
+	v.alerted[roomID] = now
+	return len(recent)
+}
+
+func (v *joinVelocity) sweep(now time.Time) {
+	v.lastSweep = now
+	for roomID, joins := range v.joins {
+		if len(joins) == 0 || now.Sub(joins[len(joins)-1]) >= joinWindow {
+			delete(v.joins, roomID)
+		}
+	}
+	for roomID, at := range v.alerted {
+		if now.Sub(at) >= joinAlertCooldown {
+			delete(v.alerted, roomID)
+		}
+	}
+}
+
+// allowInviteJoin applies the per-room cap on joins through invite links.
+func (s *Server) allowInviteJoin(w http.ResponseWriter, targetID uuid.UUID) bool {
+	st := s.inviteJoins.Take(targetID.String())
+	if st.Allowed {
+		return true
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(st.RetryAfter.Seconds()))))
+	jsonError(w, http.StatusTooManyRequests, "too many people are joining this room right now, try again shortly")
+	return false
+}
+
+// noteInviteJoin feeds the join velocity tracker and alerts roomID's admins
+// when joins spike.
+func (s *Server) noteInviteJoin(roomID uuid.UUID) {
+	if n := s.joinSpikes.record(roomID, time.Now()); n > 0 {
+		go s.alertJoinSpike(roomID, n)
+	}
+}
+
+func (s *Server) alertJoinSpike(roomID uuid.UUID, joins int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	room, err := s.Store.GetRoomByID(ctx, roomID)
+	if err != nil {
+		log.Printf("join spike alert: load room %s: %v", roomID, err)
+		return
+	}
+	raid, err := s.Store.GetRoomRaidMode(ctx, roomID)
+	if err != nil {
+		log.Printf("join spike alert: load raid mode for %s: %v", roomID, err)
+		return
+	}
+	admins, err := s.Store.ListRoomAdminIDs(ctx, roomID)
+	if err != nil {
+		log.Printf("join spike alert: list admins of %s: %v", roomID, err)
+		return
+	}
+
+	title := fmt.Sprintf("Unusual join activity in %s", room.Name)
+	body := fmt.Sprintf("%d people joined through invite links in the last minute.", joins)
+	if raid {
+		body += " Raid mode is on, so they are waiting for approval."
+	} else {
+		body += " Turn on raid mode to hold new joins for approval."
+	}
+	for _, adminID := range admins {
+		n, err := s.Store.CreateNotification(ctx, adminID, "room.join_spike", title, body, map[string]any{
+			"room_id":   roomID,
+			"joins":     joins,
+			"raid_mode": raid,
+		})
+		if err != nil {
+			log.Printf("join spike alert: notify %s: %v", adminID, err)
+			continue
+		}
+		s.Hub.SendNotification(n)
+	}
+}
+
+func (s *Server) getRoomRaidMode(w http.ResponseWriter, r *http.Request) {
+	roomID, _, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	on, err := s.Store.GetRoomRaidMode(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load raid mode")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]bool{"enabled": on})
+}
+
+// setRoomRaidMode turns raid mode on or off. Turning it off does not admit
+// anyone still waiting; their requests stay for an admin to decide.
+func (s *Server) setRoomRaidMode(w http.ResponseWriter, r *http.Request) {
+	roomID, _, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := s.Store.SetRoomRaidMode(r.Context(), roomID, req.Enabled); err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to save raid mode")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]bool{"enabled": req.Enabled})
+}
+
+func (s *Server) listJoinRequests(w http.ResponseWriter, r *http.Request) {
+	roomID, _, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	reqs, err := s.Store.ListJoinRequests(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load join requests")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"requests": reqs})
+}
+
+func (s *Server) approveJoinRequest(w http.ResponseWriter, r *http.Request) {
+	roomID, adminID, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	userID, err := uuid.Parse(chi.URLParam(r, "userID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	if !s.allowNewMember(w, r, roomID) {
+		return
+	}
+	if err := s.Store.ApproveJoinRequest(r.Context(), roomID, userID, adminID); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "join request not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to approve join request")
+		return
+	}
+	go s.announceMembership(roomID, userID, ws.MemberJoined)
+	go s.welcomeMember(roomID, userID)
+	go s.notifyJoinApproved(roomID, userID)
+	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+func (s *Server) rejectJoinRequest(w http.ResponseWriter, r *http.Request) {
+	roomID, _, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	userID, err := uuid.Parse(chi.URLParam(r, "userID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	if err := s.Store.DeleteJoinRequest(r.Context(), roomID, userID); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "join request not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to reject join request")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+// notifyJoinApproved tells a member whose request was approved that the
+// room is now open to them.
+func (s *Server) notifyJoinApproved(roomID, userID uuid.UUID) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	room, err := s.Store.GetRoomByID(ctx, roomID)
+	if err != nil {
+		log.Printf("join approved notification: load room %s: %v", roomID, err)
+		return
+	}
+	n, err := s.Store.CreateNotification(ctx, userID, "room.join_approved", "Join request approved",
+		fmt.Sprintf("You can now chat in %s.", room.Name), map[string]any{"room_id": roomID})
+	if err != nil {
+		log.Printf("join approved notification: %v", err)
+		return
+	}
+	s.Hub.SendNotification(n)
+}
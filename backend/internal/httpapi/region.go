@@ -0,0 +1,89 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// roomCallURL is the SFU server calls in roomID go through. If the region
+// cannot be loaded the default server is used.
+func (s *Server) roomCallURL(ctx context.Context, roomID uuid.UUID) string {
+	region, err := s.Store.GetRoomRegion(ctx, roomID)
+	if err != nil {
+		log.Printf("load region of room %s: %v", roomID, err)
+		return s.Calls.URL("")
+	}
+	return s.Calls.URL(region)
+}
+
+// getRoomRegion tells any member the room's data region and which regions
+// the instance offers.
+func (s *Server) getRoomRegion(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return
+	}
+	member, err := s.Store.IsRoomMember(r.Context(), roomID, user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check membership")
+		return
+	}
+	if !member {
+		jsonError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+	region, err := s.Store.GetRoomRegion(r.Context(), roomID)
+	if err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "room not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to load room")
+		return
+	}
+	available := s.Cfg.RegionNames()
+	if available == nil {
+		available = []string{}
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"region": region, "available": available})
+}
+
+// setRoomRegion retags a room. Only regions configured on the instance are
+// accepted; "" moves the room back to the default.
+func (s *Server) setRoomRegion(w http.ResponseWriter, r *http.Request) {
+	roomID, _, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Region string `json:"region"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Region != "" && !slices.Contains(s.Cfg.RegionNames(), req.Region) {
+		jsonError(w, http.StatusBadRequest, "unknown region")
+		return
+	}
+	if err := s.Store.SetRoomRegion(r.Context(), roomID, req.Region); err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to save room")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]string{"region": req.Region})
+}
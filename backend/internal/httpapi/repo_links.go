@@ -0,0 +1,261 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/repohooks"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	maxRoomRepoLinks = 20
+	// repoHooksPerMinute bounds what one link posts, so a mass relabel or
+	// a flapping pipeline cannot bury the room.
+	repoHooksPerMinute = 30
+)
+
+var (
+	githubRepo = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,100}/[A-Za-z0-9_.-]{1,100}$`)
+	// GitLab paths nest groups; the length and depth are checked apart,
+	// as RE2 caps nested repeat counts at 1000.
+	gitlabRepo = regexp.MustCompile(`^[A-Za-z0-9_.-]+(/[A-Za-z0-9_.-]+)+$`)
+)
+
+const (
+	maxGitlabPath  = 1024
+	maxGitlabDepth = 21
+)
+
+func (s *Server) listRepoLinks(w http.ResponseWriter, r *http.Request) {
+	roomID, _, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	links, err := s.Store.ListRepoLinks(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load repositories")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"repos": links})
+}
+
+// createRepoLink links a repository to the room. The response carries the
+// webhook path and the secret to configure on the repository; the secret
+// is not shown again.
+func (s *Server) createRepoLink(w http.ResponseWriter, r *http.Request) {
+	roomID, adminID, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Provider string   `json:"provider"`
+		Repo     string   `json:"repo"`
+		Events   []string `json:"events"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if !repohooks.ValidProvider(req.Provider) {
+		jsonError(w, http.StatusBadRequest, "provider must be github or gitlab")
+		return
+	}
+	repo := strings.Trim(strings.TrimSpace(req.Repo), "/")
+	if !validRepo(req.Provider, repo) {
+		jsonError(w, http.StatusBadRequest, "repo must be the repository's path, e.g. owner/name")
+		return
+	}
+	events := req.Events
+	if events == nil {
+		events = repohooks.Kinds
+	}
+	if !validRepoEvents(events) {
+		jsonError(w, http.StatusBadRequest, "events must be any of pull_request, ci and issue")
+		return
+	}
+	direct, err := s.Store.IsDirectRoom(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load room")
+		return
+	}
+	if direct {
+		jsonError(w, http.StatusBadRequest, "repositories cannot be linked to direct messages")
+		return
+	}
+	existing, err := s.Store.ListRepoLinks(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load repositories")
+		return
+	}
+	if len(existing) >= maxRoomRepoLinks {
+		jsonError(w, http.StatusConflict, fmt.Sprintf("a room can link at most %d repositories", maxRoomRepoLinks))
+		return
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to link repository")
+		return
+	}
+	link, err := s.Store.CreateRepoLink(r.Context(), db.RepoLink{
+		RoomID: roomID, Provider: req.Provider, Repo: repo, Secret: secret, Events: events, CreatedBy: &adminID,
+	})
+	if err != nil {
+		if err == db.ErrRepoLinked {
+			jsonError(w, http.StatusConflict, "the room already links that repository")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to link repository")
+		return
+	}
+	jsonResponse(w, http.StatusCreated, map[string]any{
+		"repo":        link,
+		"webhook_url": fmt.Sprintf("/api/hooks/%s/%d", link.Provider, link.ID),
+	})
+}
+
+func (s *Server) updateRepoLink(w http.ResponseWriter, r *http.Request) {
+	roomID, _, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r, "linkID"), 10, 64)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid link id")
+		return
+	}
+	var req struct {
+		Events []string `json:"events"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Events == nil || !validRepoEvents(req.Events) {
+		jsonError(w, http.StatusBadRequest, "events must be any of pull_request, ci and issue")
+		return
+	}
+	if err := s.Store.SetRepoLinkEvents(r.Context(), roomID, id, req.Events); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "repository link not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to save repository link")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"events": req.Events})
+}
+
+func (s *Server) deleteRepoLink(w http.ResponseWriter, r *http.Request) {
+	roomID, _, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r, "linkID"), 10, 64)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid link id")
+		return
+	}
+	if err := s.Store.DeleteRepoLink(r.Context(), roomID, id); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "repository link not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to unlink repository")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+// repoWebhook receives a GitHub or GitLab delivery for one room link and
+// posts it to the room as the admin who linked the repository. Deliveries
+// the room does not want are acknowledged so the provider does not retry
+// them; bad signatures and unknown links are not.
+func (s *Server) repoWebhook(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+	id, err := strconv.ParseInt(chi.URLParam(r, "linkID"), 10, 64)
+	if err != nil || !repohooks.ValidProvider(provider) {
+		jsonError(w, http.StatusNotFound, "webhook not found")
+		return
+	}
+	payload, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	link, err := s.Store.GetRepoLink(r.Context(), id)
+	if err == db.ErrNotFound || (err == nil && link.Provider != provider) {
+		jsonError(w, http.StatusNotFound, "webhook not found")
+		return
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load webhook")
+		return
+	}
+	if err := repohooks.Verify(provider, link.Secret, r.Header, payload); err != nil {
+		jsonError(w, http.StatusUnauthorized, "invalid signature")
+		return
+	}
+	ev, err := repohooks.Parse(provider, r.Header, payload)
+	if errors.Is(err, repohooks.ErrIgnored) {
+		jsonResponse(w, http.StatusOK, map[string]bool{"ok": true, "ignored": true})
+		return
+	}
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// The secret is per link, so a delivery for another repository means
+	// the hook was pointed at the wrong room.
+	if !strings.EqualFold(ev.Repo, link.Repo) || !slices.Contains(link.Events, ev.Kind) || link.CreatedBy == nil {
+		jsonResponse(w, http.StatusOK, map[string]bool{"ok": true, "ignored": true})
+		return
+	}
+	if !s.repoHooks.Take(strconv.FormatInt(link.ID, 10)).Allowed {
+		jsonError(w, http.StatusTooManyRequests, "too many deliveries, try again shortly")
+		return
+	}
+	member, err := s.Store.IsRoomMember(r.Context(), link.RoomID, *link.CreatedBy)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check membership")
+		return
+	}
+	if !member {
+		log.Printf("repo link %d: %s is no longer in room %s", link.ID, *link.CreatedBy, link.RoomID)
+		jsonResponse(w, http.StatusOK, map[string]bool{"ok": true, "ignored": true})
+		return
+	}
+	msg, err := s.Store.SaveMessage(r.Context(), link.RoomID, *link.CreatedBy, ev.Text, nil)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to save message")
+		return
+	}
+	s.publishMessage(r.Context(), msg)
+	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+func validRepo(provider, repo string) bool {
+	if provider == repohooks.GitHub {
+		return githubRepo.MatchString(repo)
+	}
+	return len(repo) <= maxGitlabPath && strings.Count(repo, "/") < maxGitlabDepth && gitlabRepo.MatchString(repo)
+}
+
+func validRepoEvents(events []string) bool {
+	for i, e := range events {
+		if !slices.Contains(repohooks.Kinds, e) || slices.Contains(events[:i], e) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,238 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+	"talkie/backend/internal/textnorm"
+	"talkie/backend/internal/ws"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	maxRichPresenceSources = 5
+	maxRichPresenceText    = 128
+	maxRichPresenceIconURL = 512
+	defaultRichPresenceTTL = 5 * time.Minute
+	minRichPresenceTTL     = 30 * time.Second
+	maxRichPresenceTTL     = time.Hour
+	// richPresenceSweep is how often lapsed entries are cleared, so an
+	// entry can outlive its TTL by up to this long.
+	richPresenceSweep = 15 * time.Second
+)
+
+var richPresenceSource = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,31}$`)
+
+var richPresenceTypes = map[string]bool{
+	db.ActivityPlaying:   true,
+	db.ActivityListening: true,
+	db.ActivityWatching:  true,
+	db.ActivityMeeting:   true,
+	db.ActivityCustom:    true,
+}
+
+func (s *Server) listMyRichPresence(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	rich, err := s.Store.ListRichPresence(r.Context(), []uuid.UUID{user.ID})
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load rich presence")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"rich_presence": rich})
+}
+
+// setRichPresence sets what the caller is doing according to one source,
+// a client or an integration, named in the path. The entry lapses after
+// ttl_seconds unless the source sets it again, so a player that crashes
+// does not leave "listening to ..." up for good.
+func (s *Server) setRichPresence(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	source := chi.URLParam(r, "source")
+	if !richPresenceSource.MatchString(source) {
+		jsonError(w, http.StatusBadRequest, "source must be 1 to 32 lowercase letters, digits, '.', '_' or '-'")
+		return
+	}
+	var req struct {
+		Type       string `json:"type"`
+		Text       string `json:"text"`
+		IconURL    string `json:"icon_url"`
+		TTLSeconds int    `json:"ttl_seconds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if !richPresenceTypes[req.Type] {
+		jsonError(w, http.StatusBadRequest, "type must be playing, listening, watching, meeting or custom")
+		return
+	}
+	req.Text = strings.TrimSpace(textnorm.Message(req.Text))
+	if req.Text == "" || utf8.RuneCountInString(req.Text) > maxRichPresenceText {
+		jsonError(w, http.StatusBadRequest, fmt.Sprintf("text must be 1 to %d characters", maxRichPresenceText))
+		return
+	}
+	req.IconURL = strings.TrimSpace(req.IconURL)
+	if req.IconURL != "" && !validIconURL(req.IconURL) {
+		jsonError(w, http.StatusBadRequest, "icon_url must be an https URL")
+		return
+	}
+	ttl := defaultRichPresenceTTL
+	if req.TTLSeconds != 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+	if ttl < minRichPresenceTTL || ttl > maxRichPresenceTTL {
+		jsonError(w, http.StatusBadRequest, fmt.Sprintf("ttl_seconds must be %d to %d", int(minRichPresenceTTL.Seconds()), int(maxRichPresenceTTL.Seconds())))
+		return
+	}
+
+	current, err := s.Store.ListRichPresence(r.Context(), []uuid.UUID{user.ID})
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load rich presence")
+		return
+	}
+	if len(current) >= maxRichPresenceSources && !hasRichPresenceSource(current, source) {
+		jsonError(w, http.StatusConflict, fmt.Sprintf("at most %d rich presence sources", maxRichPresenceSources))
+		return
+	}
+	p, err := s.Store.SetRichPresence(r.Context(), db.RichPresence{
+		UserID:    user.ID,
+		Source:    source,
+		Type:      req.Type,
+		Text:      req.Text,
+		IconURL:   req.IconURL,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to save rich presence")
+		return
+	}
+	// A refresh that changes nothing is not worth an event to every friend.
+	if !sameRichPresence(current, p) {
+		go s.announceRichPresence(user.ID)
+	}
+	jsonResponse(w, http.StatusOK, p)
+}
+
+func (s *Server) clearRichPresence(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	if err := s.Store.ClearRichPresence(r.Context(), user.ID, chi.URLParam(r, "source")); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "rich presence not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to clear rich presence")
+		return
+	}
+	go s.announceRichPresence(user.ID)
+	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+// announceRichPresence sends userID's current rich presence to their
+// friends and to their own other devices.
+func (s *Server) announceRichPresence(userID uuid.UUID) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	rich, err := s.Store.ListRichPresence(ctx, []uuid.UUID{userID})
+	if err != nil {
+		log.Printf("announce rich presence of %s: %v", userID, err)
+		return
+	}
+	friends, err := s.Store.ListFriends(ctx, userID)
+	if err != nil {
+		log.Printf("announce rich presence of %s: %v", userID, err)
+		return
+	}
+	event := ws.RichPresenceMessage(userID, rich)
+	s.Hub.BroadcastUser(userID, event)
+	for _, f := range friends {
+		s.Hub.BroadcastUser(f.ID, event)
+	}
+}
+
+// friendsRichPresence is the rich presence of userID's friends, for the
+// presence_state snapshot.
+func (s *Server) friendsRichPresence(ctx context.Context, userID uuid.UUID) ([]db.RichPresence, error) {
+	friends, err := s.Store.ListFriends(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uuid.UUID, len(friends))
+	for i, f := range friends {
+		ids[i] = f.ID
+	}
+	return s.Store.ListRichPresence(ctx, ids)
+}
+
+// ExpireRichPresence clears entries whose sources stopped refreshing them
+// and tells the users' friends, until ctx ends. One instance runs it.
+func (s *Server) ExpireRichPresence(ctx context.Context) {
+	ticker := time.NewTicker(richPresenceSweep)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		users, err := s.Store.DeleteExpiredRichPresence(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("expire rich presence: %v", err)
+			}
+			continue
+		}
+		for _, id := range users {
+			s.announceRichPresence(id)
+		}
+	}
+}
+
+func hasRichPresenceSource(rich []db.RichPresence, source string) bool {
+	for _, p := range rich {
+		if p.Source == source {
+			return true
+		}
+	}
+	return false
+}
+
+func sameRichPresence(rich []db.RichPresence, p db.RichPresence) bool {
+	for _, old := range rich {
+		if old.Source == p.Source {
+			return old.Type == p.Type && old.Text == p.Text && old.IconURL == p.IconURL
+		}
+	}
+	return false
+}
+
+func validIconURL(raw string) bool {
+	if len(raw) > maxRichPresenceIconURL {
+		return false
+	}
+	u, err := url.Parse(raw)
+	return err == nil && u.Scheme == "https" && u.Host != ""
+}
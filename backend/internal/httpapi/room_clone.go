@@ -0,0 +1,114 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/quota"
+	"talkie/backend/internal/ws"
+
+	"github.com/google/uuid"
+)
+
+// cloneRoom creates a new room from an existing one's setup: settings,
+// automod rules and, when asked, members with their roles. History is never
+// copied. Only room admins can clone, and direct messages and workspace
+// channels cannot be cloned. The new room counts against the cloner's room
+// quota and, with members, against their plan's member cap.
+func (s *Server) cloneRoom(w http.ResponseWriter, r *http.Request) {
+	roomID, userID, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Name    string `json:"name"`
+		Members bool   `json:"members"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		jsonError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	direct, err := s.Store.IsDirectRoom(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check room type")
+		return
+	}
+	if direct {
+		jsonError(w, http.StatusBadRequest, "cannot clone direct messages")
+		return
+	}
+	if _, err := s.Store.GetGroupIDByRoomID(r.Context(), roomID); err == nil {
+		jsonError(w, http.StatusBadRequest, "cannot clone a workspace channel")
+		return
+	} else if err != db.ErrNotFound {
+		jsonError(w, http.StatusInternalServerError, "failed to check room type")
+		return
+	}
+	if !s.allowNewRoom(w, r, userID) {
+		return
+	}
+	if req.Members && !s.allowClonedMembers(w, r, roomID, userID) {
+		return
+	}
+
+	room, err := s.Store.CloneRoom(r.Context(), roomID, userID, req.Name, req.Members)
+	if err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "room not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to clone room")
+		return
+	}
+	if req.Members {
+		go s.announceClone(room.ID, userID)
+	}
+	jsonResponse(w, http.StatusCreated, room)
+}
+
+// allowClonedMembers checks the source's members fit in a room created by
+// userID, whose plan governs the copy.
+func (s *Server) allowClonedMembers(w http.ResponseWriter, r *http.Request, roomID, userID uuid.UUID) bool {
+	limits, _, err := s.userLimits(r.Context(), userID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load quota")
+		return false
+	}
+	if limits.MaxRoomMembers <= 0 {
+		return true
+	}
+	n, err := s.Store.CountRoomMembers(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load quota")
+		return false
+	}
+	// Allow checks room for one more; the cloner is that one.
+	return s.checkQuota(w, quota.Allow(quota.MaxRoomMembers, int64(limits.MaxRoomMembers), int64(n-1)))
+}
+
+// announceClone tells the members copied into a cloned room to refresh
+// their room lists, as an invite would.
+func (s *Server) announceClone(roomID, clonerID uuid.UUID) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	members, err := s.Store.ListRoomMembers(ctx, roomID)
+	if err != nil {
+		log.Printf("announce cloned room %s: %v", roomID, err)
+		return
+	}
+	for _, m := range members {
+		if m.ID != clonerID {
+			s.Hub.SendToUser(m.ID, ws.RoomInviteEvent{})
+		}
+	}
+}
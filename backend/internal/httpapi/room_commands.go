@@ -0,0 +1,246 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/slashcmd"
+	"talkie/backend/internal/textnorm"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	maxRoomCommands          = 50
+	maxCommandDescription    = 200
+	maxCommandURLLength      = 2048
+	commandRunsPerMinute     = 10
+	commandLookupTimeout     = 2 * time.Second
+	commandInvocationTimeout = slashcmd.Timeout + time.Second
+)
+
+var commandName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+func (s *Server) listRoomCommands(w http.ResponseWriter, r *http.Request) {
+	roomID, _, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	commands, err := s.Store.ListRoomCommands(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load commands")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"commands": commands})
+}
+
+// createRoomCommand registers /name for the room. The response carries the
+// signing secret, which is not shown again; the command's service uses it
+// to check that invocations come from here.
+func (s *Server) createRoomCommand(w http.ResponseWriter, r *http.Request) {
+	roomID, adminID, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Name        string `json:"name"`
+		URL         string `json:"url"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	name := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(req.Name), "/"))
+	if !commandName.MatchString(name) {
+		jsonError(w, http.StatusBadRequest, "name must be 1 to 32 lowercase letters, digits, dashes or underscores")
+		return
+	}
+	req.URL = strings.TrimSpace(req.URL)
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(req.URL) > maxCommandURLLength {
+		jsonError(w, http.StatusBadRequest, "url must be an http or https link")
+		return
+	}
+	description := textnorm.Message(strings.TrimSpace(req.Description))
+	if utf8.RuneCountInString(description) > maxCommandDescription {
+		jsonError(w, http.StatusBadRequest, fmt.Sprintf("description must be at most %d characters", maxCommandDescription))
+		return
+	}
+	existing, err := s.Store.ListRoomCommands(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load commands")
+		return
+	}
+	if len(existing) >= maxRoomCommands {
+		jsonError(w, http.StatusConflict, fmt.Sprintf("a room can have at most %d commands", maxRoomCommands))
+		return
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to create command")
+		return
+	}
+	cmd, err := s.Store.CreateRoomCommand(r.Context(), db.RoomCommand{
+		RoomID: roomID, Name: name, URL: u.String(), Description: description, Secret: secret, CreatedBy: &adminID,
+	})
+	if err != nil {
+		if err == db.ErrCommandExists {
+			jsonError(w, http.StatusConflict, "the room already has a command with that name")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to create command")
+		return
+	}
+	jsonResponse(w, http.StatusCreated, cmd)
+}
+
+func (s *Server) deleteRoomCommand(w http.ResponseWriter, r *http.Request) {
+	roomID, _, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	if err := s.Store.DeleteRoomCommand(r.Context(), roomID, strings.ToLower(chi.URLParam(r, "name"))); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "command not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to delete command")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+// runSlashCommand reports whether text invokes one of roomID's commands,
+// and if so runs it in the background. Text that only looks like a command
+// is left to be posted as usual.
+func (s *Server) runSlashCommand(roomID, userID uuid.UUID, username, text string) bool {
+	if !strings.HasPrefix(text, "/") {
+		return false
+	}
+	name, args, _ := strings.Cut(strings.TrimPrefix(text, "/"), " ")
+	name = strings.ToLower(name)
+	if !commandName.MatchString(name) {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), commandLookupTimeout)
+	defer cancel()
+	cmd, err := s.Store.GetRoomCommand(ctx, roomID, name)
+	if err != nil {
+		if err != db.ErrNotFound {
+			log.Printf("look up command /%s in room %s: %v", name, roomID, err)
+		}
+		return false
+	}
+	if !s.commandRuns.Take(userID.String()).Allowed {
+		s.Hub.SendEphemeral(roomID, userID, "You are running commands too quickly, try again shortly.")
+		return true
+	}
+	go s.invokeCommand(cmd, userID, username, strings.TrimSpace(args))
+	return true
+}
+
+// invokeCommand calls cmd's webhook and shows the reply. In-room replies
+// are posted as the admin who registered the command, after the invocation
+// itself as the invoker's message, as Slack shows them. Failures and
+// ephemeral replies go to the invoker alone.
+func (s *Server) invokeCommand(cmd db.RoomCommand, userID uuid.UUID, username, args string) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandInvocationTimeout)
+	defer cancel()
+	room, err := s.Store.GetRoomByID(ctx, cmd.RoomID)
+	if err != nil {
+		log.Printf("run command /%s: load room %s: %v", cmd.Name, cmd.RoomID, err)
+		return
+	}
+	resp, err := s.Commands.Invoke(ctx, cmd.URL, cmd.Secret, slashcmd.Invocation{
+		Command:     "/" + cmd.Name,
+		Text:        args,
+		RoomID:      cmd.RoomID.String(),
+		RoomName:    room.Name,
+		UserID:      userID.String(),
+		Username:    username,
+		TriggeredAt: time.Now().UTC(),
+	})
+	if err != nil {
+		log.Printf("run command /%s in room %s: %v", cmd.Name, cmd.RoomID, err)
+		notice := fmt.Sprintf("/%s failed, try again later.", cmd.Name)
+		if errors.Is(err, context.DeadlineExceeded) || isTimeout(err) {
+			notice = fmt.Sprintf("/%s did not respond in time.", cmd.Name)
+		}
+		s.Hub.SendEphemeral(cmd.RoomID, userID, notice)
+		return
+	}
+	text, ok := s.commandReplyText(cmd, userID, resp)
+	if !ok {
+		return
+	}
+	if !resp.InChannel() || cmd.CreatedBy == nil {
+		s.Hub.SendEphemeral(cmd.RoomID, userID, text)
+		return
+	}
+
+	invocation := "/" + cmd.Name
+	if args != "" {
+		invocation += " " + args
+	}
+	echo, err := s.Store.SaveMessage(ctx, cmd.RoomID, userID, invocation, nil)
+	if err != nil {
+		log.Printf("run command /%s: save invocation: %v", cmd.Name, err)
+		s.Hub.SendEphemeral(cmd.RoomID, userID, text)
+		return
+	}
+	s.publishMessage(ctx, echo)
+	// A shadow-banned invoker's command stays as invisible as the rest of
+	// what they post.
+	if echo.Shadowed {
+		s.Hub.SendEphemeral(cmd.RoomID, userID, text)
+		return
+	}
+	s.postCommandReply(ctx, cmd, text, resp.Components)
+}
+
+// commandReplyText normalizes the text of cmd's answer. ok is false when
+// there is nothing to show: the command only acknowledged, or its reply
+// was unusable, which userID is told about.
+func (s *Server) commandReplyText(cmd db.RoomCommand, userID uuid.UUID, resp slashcmd.Response) (string, bool) {
+	text := textnorm.Message(strings.TrimSpace(resp.Text))
+	if text == "" {
+		return "", false
+	}
+	if utf8.RuneCountInString(text) > s.Cfg.MaxMessageLength {
+		s.Hub.SendEphemeral(cmd.RoomID, userID, fmt.Sprintf("/%s replied with more than %d characters.", cmd.Name, s.Cfg.MaxMessageLength))
+		return "", false
+	}
+	if err := db.ValidateComponents(resp.Components); err != nil {
+		log.Printf("run command /%s in room %s: %v", cmd.Name, cmd.RoomID, err)
+		s.Hub.SendEphemeral(cmd.RoomID, userID, fmt.Sprintf("/%s replied with invalid components.", cmd.Name))
+		return "", false
+	}
+	return text, true
+}
+
+// postCommandReply posts an in-room reply as the admin who registered cmd.
+func (s *Server) postCommandReply(ctx context.Context, cmd db.RoomCommand, text string, components []db.Component) {
+	reply, err := s.Store.SaveCommandMessage(ctx, cmd.RoomID, *cmd.CreatedBy, cmd.ID, text, components)
+	if err != nil {
+		log.Printf("run command /%s: save reply: %v", cmd.Name, err)
+		return
+	}
+	s.publishMessage(ctx, reply)
+}
+
+func isTimeout(err error) bool {
+	var t interface{ Timeout() bool }
+	return errors.As(err, &t) && t.Timeout()
+}
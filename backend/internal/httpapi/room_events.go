@@ -0,0 +1,73 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// listRoomEvents replays a room's persisted event stream from ?since=<seq>
+// so a bot or auditor that was offline can rebuild the room's state. These
+// sequence numbers are durable and independent of the live socket's seq.
+func (s *Server) listRoomEvents(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return
+	}
+	var since int64
+	if raw := r.URL.Query().Get("since"); raw != "" {
+		since, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil || since < 0 {
+			jsonError(w, http.StatusBadRequest, "invalid since")
+			return
+		}
+	}
+	limit := 100
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			jsonError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = min(limit, 1000)
+	}
+	member, err := s.Store.IsRoomMember(r.Context(), roomID, user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check membership")
+		return
+	}
+	if !member {
+		jsonError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+
+	events, latest, err := s.Store.ListRoomEvents(r.Context(), roomID, since, limit)
+	if err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "room not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to load events")
+		return
+	}
+	last := since
+	if len(events) > 0 {
+		last = events[len(events)-1].Seq
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{
+		"events":     events,
+		"latest_seq": latest,
+		"has_more":   last < latest,
+	})
+}
@@ -1,19 +1,25 @@
 package httpapi
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"log"
+	"math"
 	"net/http"
+	"net/mail"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"talkie/backend/internal/calls"
 	"talkie/backend/internal/db"
 	"talkie/backend/internal/middleware"
+	"talkie/backend/internal/ws"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
-	lkauth "github.com/livekit/protocol/auth"
 )
 
 func (s *Server) createRoom(w http.ResponseWriter, r *http.Request) {
@@ -34,6 +40,9 @@ func (s *Server) createRoom(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusBadRequest, "name is required")
 		return
 	}
+	if !s.allowNewRoom(w, r, user.ID) {
+		return
+	}
 
 	room, err := s.Store.CreateRoom(r.Context(), req.Name, user.ID, true)
 	if err != nil {
@@ -49,14 +58,96 @@ func (s *Server) listRooms(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusUnauthorized, "unauthorized")
 		return
 	}
+	p, err := parsePage(r, maxUserListPage, maxUserListPage)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	rooms, err := s.Store.ListRoomsForUser(r.Context(), user.ID)
 	if err != nil {
 		jsonError(w, http.StatusInternalServerError, "failed to load rooms")
 		return
 	}
+	rooms = filterByName(rooms, r.URL.Query().Get("q"), func(room db.Room) string { return room.Name })
+	if err := sortBy(rooms, r.URL.Query().Get("sort"), roomSorts); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	rooms, next, err := offsetPage(rooms, p)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	setNextPage(w, r, next)
 	jsonResponse(w, http.StatusOK, rooms)
 }
 
+// maxUserListPage bounds lists scoped to one user (rooms, DMs, groups,
+// friends). It is also their default so existing clients still get the
+// whole list in one page.
+const maxUserListPage = 500
+
+var roomSorts = map[string]func(a, b db.Room) int{
+	"name": func(a, b db.Room) int {
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	},
+	"created": func(a, b db.Room) int { return a.CreatedAt.Compare(b.CreatedAt) },
+	"activity": func(a, b db.Room) int {
+		return roomActivity(a).Compare(roomActivity(b))
+	},
+}
+
+func roomActivity(room db.Room) time.Time {
+	if room.LastMessageAt != nil {
+		return *room.LastMessageAt
+	}
+	return room.CreatedAt
+}
+
+// listRoomMembers pages through a room's members by username.
+func (s *Server) listRoomMembers(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return
+	}
+	p, err := parsePage(r, 100, 500)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	member, err := s.Store.IsRoomMember(r.Context(), roomID, user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check membership")
+		return
+	}
+	if !member {
+		jsonError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+	members, err := s.Store.ListRoomMembers(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load members")
+		return
+	}
+	members = filterByName(members, r.URL.Query().Get("q"), func(m db.RoomMember) string { return m.Username })
+	members, next, err := offsetPage(members, p)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	setNextPage(w, r, next)
+	jsonResponse(w, http.StatusOK, map[string]any{
+		"members":     members,
+		"next_cursor": next,
+	})
+}
+
 func (s *Server) inviteToRoom(w http.ResponseWriter, r *http.Request) {
 	user, ok := middleware.UserFromContext(r.Context())
 	if !ok {
@@ -91,27 +182,106 @@ func (s *Server) inviteToRoom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Exactly one of user_id, username or email identifies the invitee. An
+	// email that does not belong to an account gets the room's invite link
+	// by mail instead.
 	var req struct {
-		UserID string `json:"user_id"`
+		UserID   string `json:"user_id"`
+		Username string `json:"username"`
+		Email    string `json:"email"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		jsonError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
-	targetID, err := uuid.Parse(req.UserID)
+	req.Username = strings.TrimSpace(req.Username)
+	req.Email = strings.TrimSpace(strings.ToLower(req.Email))
+
+	var target db.User
+	switch {
+	case req.UserID != "":
+		targetID, perr := uuid.Parse(req.UserID)
+		if perr != nil {
+			jsonError(w, http.StatusBadRequest, "invalid user id")
+			return
+		}
+		target, err = s.Store.FindUserByID(r.Context(), targetID)
+	case req.Username != "":
+		target, err = s.Store.FindUserByUsername(r.Context(), req.Username)
+	case req.Email != "":
+		if addr, perr := mail.ParseAddress(req.Email); perr != nil || addr.Address != req.Email {
+			jsonError(w, http.StatusBadRequest, "invalid email")
+			return
+		}
+		target, err = s.Store.FindUserByEmail(r.Context(), req.Email)
+		if err == db.ErrNotFound {
+			s.inviteByEmail(w, r, roomID, user, req.Email)
+			return
+		}
+	default:
+		jsonError(w, http.StatusBadRequest, "user_id, username or email is required")
+		return
+	}
+	if err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to find user")
+		return
+	}
+	already, err := s.Store.IsRoomMember(r.Context(), roomID, target.ID)
 	if err != nil {
-		jsonError(w, http.StatusBadRequest, "invalid user id")
+		jsonError(w, http.StatusInternalServerError, "failed to check membership")
 		return
 	}
-	if _, err := s.Store.FindUserByID(r.Context(), targetID); err != nil {
-		jsonError(w, http.StatusNotFound, "user not found")
+	if !already && !s.allowNewMember(w, r, roomID) {
 		return
 	}
-	if err := s.Store.JoinRoom(r.Context(), roomID, targetID); err != nil {
+	if err := s.Store.JoinRoom(r.Context(), roomID, target.ID); err != nil {
 		jsonError(w, http.StatusInternalServerError, "failed to invite user")
 		return
 	}
-	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
+	s.Hub.SendToUser(target.ID, ws.RoomInviteEvent{})
+	if !already {
+		s.logMembership(r.Context(), db.MembershipEvent{RoomID: roomID, UserID: target.ID, ActorID: &user.ID, Action: db.MembershipJoined, Via: db.ViaInvite})
+		go s.announceMembership(roomID, target.ID, ws.MemberJoined)
+	}
+	go s.welcomeMember(roomID, target.ID)
+	jsonResponse(w, http.StatusOK, map[string]any{"ok": true, "user_id": target.ID})
+}
+
+// inviteByEmail mails the inviter's invite link for the room to an address
+// that has no account yet; joining happens once they sign up and open it.
+func (s *Server) inviteByEmail(w http.ResponseWriter, r *http.Request, roomID uuid.UUID, inviter middleware.UserContext, email string) {
+	room, err := s.Store.GetRoomByID(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusNotFound, "room not found")
+		return
+	}
+	token, _, _, err := s.roomInviteLink(r.Context(), roomID, inviter.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to create invite link")
+		return
+	}
+	inviteURL := fmt.Sprintf("%s?invite=%s", strings.TrimRight(s.Cfg.FrontendBaseURL, "/"), token)
+	if err := s.sendRoomInviteEmail(email, inviter.Username, room.Name, inviteURL); err != nil {
+		log.Printf("failed to send room invite email to %s: %v", email, err)
+		jsonError(w, http.StatusBadGateway, "failed to send invite email")
+		return
+	}
+	jsonResponse(w, http.StatusAccepted, map[string]any{"ok": true, "emailed": true})
+}
+
+func (s *Server) sendRoomInviteEmail(to, inviter, roomName, inviteURL string) error {
+	subject := fmt.Sprintf("%s invited you to %s on Talkie", inviter, roomName)
+	body := fmt.Sprintf("%s invited you to join \"%s\" on Talkie.\n\nCreate an account and open this link to join:\n\n%s\n", inviter, roomName, inviteURL)
+
+	if !s.Mailer.Enabled() {
+		log.Printf("room invite link for %s: %s", to, inviteURL)
+		return nil
+	}
+	return s.Mailer.Send(to, subject, body)
 }
 
 func (s *Server) createRoomInviteLink(w http.ResponseWriter, r *http.Request) {
@@ -148,70 +318,63 @@ func (s *Server) createRoomInviteLink(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	groupID, groupErr := s.Store.GetGroupIDByRoomID(r.Context(), roomID)
-	if groupErr == nil {
-		if token, expiresAt, err := s.Store.FindGroupInviteLinkByCreator(r.Context(), groupID, user.ID); err == nil {
-			jsonResponse(w, http.StatusOK, map[string]string{
-				"token":      token,
-				"invite_url": fmt.Sprintf("%s?invite=%s", strings.TrimRight(s.Cfg.FrontendBaseURL, "/"), token),
-				"expires_at": expiresAt.Format(time.RFC3339),
-			})
-			return
-		} else if err != db.ErrNotFound {
-			jsonError(w, http.StatusInternalServerError, "failed to load invite link")
-			return
-		}
-
-		rawToken, err := randomToken(24)
-		if err != nil {
-			jsonError(w, http.StatusInternalServerError, "failed to create invite link")
-			return
-		}
-		expiresAt := time.Now().UTC().Add(10 * 365 * 24 * time.Hour)
-		if err := s.Store.CreateGroupInviteLink(r.Context(), rawToken, tokenHash(rawToken), groupID, user.ID, expiresAt); err != nil {
-			jsonError(w, http.StatusInternalServerError, "failed to store invite link")
-			return
-		}
-
-		jsonResponse(w, http.StatusCreated, map[string]string{
-			"token":      rawToken,
-			"invite_url": fmt.Sprintf("%s?invite=%s", strings.TrimRight(s.Cfg.FrontendBaseURL, "/"), rawToken),
-			"expires_at": expiresAt.Format(time.RFC3339),
-		})
-		return
-	} else if groupErr != db.ErrNotFound {
-		jsonError(w, http.StatusInternalServerError, "failed to detect invite target")
+	token, expiresAt, created, err := s.roomInviteLink(r.Context(), roomID, user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to create invite link")
 		return
 	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	jsonResponse(w, status, map[string]string{
+		"id":         tokenHash(token),
+		"token":      token,
+		"invite_url": fmt.Sprintf("%s?invite=%s", strings.TrimRight(s.Cfg.FrontendBaseURL, "/"), token),
+		"expires_at": expiresAt.Format(time.RFC3339),
+	})
+}
 
-	if token, expiresAt, err := s.Store.FindRoomInviteLinkByCreator(r.Context(), roomID, user.ID); err == nil {
-		jsonResponse(w, http.StatusOK, map[string]string{
-			"token":      token,
-			"invite_url": fmt.Sprintf("%s?invite=%s", strings.TrimRight(s.Cfg.FrontendBaseURL, "/"), token),
-			"expires_at": expiresAt.Format(time.RFC3339),
-		})
-		return
-	} else if err != db.ErrNotFound {
-		jsonError(w, http.StatusInternalServerError, "failed to load invite link")
-		return
+// roomInviteLink returns the inviter's existing invite link for the room,
+// creating one if needed. Channels of a group share the group's link.
+func (s *Server) roomInviteLink(ctx context.Context, roomID, inviterID uuid.UUID) (string, time.Time, bool, error) {
+	groupID, groupErr := s.Store.GetGroupIDByRoomID(ctx, roomID)
+	if groupErr != nil && groupErr != db.ErrNotFound {
+		return "", time.Time{}, false, groupErr
+	}
+	isGroup := groupErr == nil
+
+	var (
+		token     string
+		expiresAt time.Time
+		err       error
+	)
+	if isGroup {
+		token, expiresAt, err = s.Store.FindGroupInviteLinkByCreator(ctx, groupID, inviterID)
+	} else {
+		token, expiresAt, err = s.Store.FindRoomInviteLinkByCreator(ctx, roomID, inviterID)
+	}
+	if err == nil {
+		return token, expiresAt, false, nil
+	}
+	if err != db.ErrNotFound {
+		return "", time.Time{}, false, err
 	}
 
 	rawToken, err := randomToken(24)
 	if err != nil {
-		jsonError(w, http.StatusInternalServerError, "failed to create invite link")
-		return
+		return "", time.Time{}, false, err
 	}
-	expiresAt := time.Now().UTC().Add(10 * 365 * 24 * time.Hour)
-	if err := s.Store.CreateRoomInviteLink(r.Context(), rawToken, tokenHash(rawToken), roomID, user.ID, expiresAt); err != nil {
-		jsonError(w, http.StatusInternalServerError, "failed to store invite link")
-		return
+	expiresAt = time.Now().UTC().Add(10 * 365 * 24 * time.Hour)
+	if isGroup {
+		err = s.Store.CreateGroupInviteLink(ctx, rawToken, tokenHash(rawToken), groupID, inviterID, expiresAt)
+	} else {
+		err = s.Store.CreateRoomInviteLink(ctx, rawToken, tokenHash(rawToken), roomID, inviterID, expiresAt)
 	}
-
-	jsonResponse(w, http.StatusCreated, map[string]string{
-		"token":      rawToken,
-		"invite_url": fmt.Sprintf("%s?invite=%s", strings.TrimRight(s.Cfg.FrontendBaseURL, "/"), rawToken),
-		"expires_at": expiresAt.Format(time.RFC3339),
-	})
+	if err != nil {
+		return "", time.Time{}, false, err
+	}
+	return rawToken, expiresAt, true, nil
 }
 
 func (s *Server) joinByInviteLink(w http.ResponseWriter, r *http.Request) {
@@ -225,8 +388,77 @@ func (s *Server) joinByInviteLink(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusBadRequest, "invite token is required")
 		return
 	}
+	if !s.allowInviteLookup(w, r) {
+		return
+	}
+
+	hash := tokenHash(rawToken)
+	inviteRoomID, groupID, err := s.Store.GetInviteTarget(r.Context(), hash)
+	if err != nil {
+		if err == db.ErrNotFound {
+			s.noteInviteMiss(r)
+			jsonError(w, http.StatusNotFound, "invite link is invalid or expired")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to join by invite link")
+		return
+	}
+	if inviteRoomID != uuid.Nil {
+		member, err := s.Store.IsRoomMember(r.Context(), inviteRoomID, user.ID)
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "failed to check membership")
+			return
+		}
+		if member {
+			room, err := s.Store.GetRoomByID(r.Context(), inviteRoomID)
+			if err != nil {
+				jsonError(w, http.StatusNotFound, "room not found")
+				return
+			}
+			jsonResponse(w, http.StatusOK, room)
+			return
+		}
+		if _, ok := s.nsfwAccess(w, r, inviteRoomID, user.ID); !ok {
+			return
+		}
+		// Invite links into a broadcast room subscribe rather than add a
+		// publisher, so member caps and raid mode do not apply.
+		broadcast, err := s.Store.IsBroadcastRoom(r.Context(), inviteRoomID)
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "failed to load room")
+			return
+		}
+		if broadcast {
+			s.subscribe(w, r, inviteRoomID, user.ID)
+			return
+		}
+		if !s.allowNewMember(w, r, inviteRoomID) {
+			return
+		}
+		if !s.allowInviteJoin(w, inviteRoomID) {
+			return
+		}
+		raid, err := s.Store.GetRoomRaidMode(r.Context(), inviteRoomID)
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "failed to load room")
+			return
+		}
+		if raid {
+			req, err := s.Store.CreateJoinRequest(r.Context(), inviteRoomID, user.ID, hash)
+			if err != nil {
+				jsonError(w, http.StatusInternalServerError, "failed to request to join")
+				return
+			}
+			s.noteInviteJoin(inviteRoomID)
+			go s.notifyJoinRequest(inviteRoomID, user.ID, user.Username)
+			jsonResponse(w, http.StatusAccepted, map[string]any{"status": "pending", "request": req})
+			return
+		}
+	} else if !s.allowNewGroupMember(w, r, groupID, user.ID) || !s.allowInviteJoin(w, groupID) {
+		return
+	}
 
-	roomID, err := s.Store.JoinRoomByInviteTokenHash(r.Context(), tokenHash(rawToken), user.ID)
+	roomID, err := s.Store.JoinRoomByInviteTokenHash(r.Context(), hash, user.ID)
 	if err != nil {
 		if err == db.ErrNotFound {
 			jsonError(w, http.StatusNotFound, "invite link is invalid or expired")
@@ -241,6 +473,9 @@ func (s *Server) joinByInviteLink(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusNotFound, "room not found")
 		return
 	}
+	s.noteInviteJoin(roomID)
+	go s.announceMembership(roomID, user.ID, ws.MemberJoined)
+	go s.welcomeMember(roomID, user.ID)
 	jsonResponse(w, http.StatusOK, room)
 }
 
@@ -380,10 +615,23 @@ func (s *Server) deleteRoom(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusForbidden, "admin role required")
 		return
 	}
+	// Listed before the delete so the former members can be told; a failure
+	// only costs them the live update.
+	members, err := s.Store.ListRoomMembers(r.Context(), roomID)
+	if err != nil {
+		log.Printf("list members of room %s before delete: %v", roomID, err)
+	}
 	if err := s.Store.DeleteRoom(r.Context(), roomID); err != nil {
+		if err == db.ErrLegalHold {
+			jsonError(w, http.StatusConflict, "room is under legal hold")
+			return
+		}
 		jsonError(w, http.StatusInternalServerError, "failed to delete room")
 		return
 	}
+	s.History.Invalidate(roomID)
+	s.Hub.CloseRoom(roomID)
+	s.announceRoomDeleted(roomID, members)
 	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
 }
 
@@ -428,6 +676,9 @@ func (s *Server) leaveRoom(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusInternalServerError, "failed to leave room")
 		return
 	}
+	s.Hub.RevokeMembership(roomID, user.ID)
+	s.logMembership(r.Context(), db.MembershipEvent{RoomID: roomID, UserID: user.ID, Action: db.MembershipLeft, Via: db.ViaLeave})
+	go s.announceMembership(roomID, user.ID, ws.MemberLeft)
 	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
 }
 
@@ -446,7 +697,7 @@ func (s *Server) listMessages(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusNotFound, "room not found")
 		return
 	}
-	member, err := s.Store.IsRoomMember(r.Context(), roomID, user.ID)
+	member, err := s.canReadRoom(r.Context(), roomID, user.ID)
 	if err != nil {
 		jsonError(w, http.StatusInternalServerError, "failed to check membership")
 		return
@@ -456,15 +707,93 @@ func (s *Server) listMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	hideNSFW, ok := s.nsfwAccess(w, r, roomID, user.ID)
+	if !ok {
+		return
+	}
+
 	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
 	messages, err := s.Store.ListMessages(r.Context(), roomID, limit)
+	if err == nil {
+		messages, err = s.Archive.Before(r.Context(), roomID, math.MaxInt64, limit, messages)
+	}
 	if err != nil {
 		jsonError(w, http.StatusInternalServerError, "failed to load messages")
 		return
 	}
+	// Clients that ask for tombstones get an object, the rest the plain
+	// array they have always had.
+	var deleted []int64
+	withDeleted := r.URL.Query().Get("deleted") == "1"
+	if withDeleted {
+		deleted = ws.DeletedInPage(r.Context(), s.Store, roomID, messages, math.MaxInt64, len(messages) == limit)
+	}
+	messages = s.maskFor(r.Context(), roomID, user.ID, viewable(messages, user.ID, hideNSFW))
+	direct, err := s.Store.IsDirectRoom(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check room type")
+		return
+	}
+	if direct && len(messages) > 0 {
+		s.Hub.MarkDelivered(r.Context(), s.Store, roomID, user.ID, messages[len(messages)-1].ID)
+		if pointers, err := s.Store.ListDeliveryPointers(r.Context(), roomID); err == nil {
+			db.ApplyDeliveryStates(messages, pointers)
+		}
+	}
+	if withDeleted {
+		jsonResponse(w, http.StatusOK, messagePage{Messages: messages, DeletedMessageIDs: deleted})
+		return
+	}
 	jsonResponse(w, http.StatusOK, messages)
 }
 
+// messagePage is GET /api/rooms/{roomID}/messages?deleted=1.
+type messagePage struct {
+	Messages          []db.Message `json:"messages"`
+	DeletedMessageIDs []int64      `json:"deleted_message_ids"`
+}
+
+func (s *Server) markRoomRead(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return
+	}
+	var req struct {
+		MessageID int64 `json:"message_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.MessageID <= 0 {
+		jsonError(w, http.StatusBadRequest, "message_id is required")
+		return
+	}
+	lastRead, err := s.Store.MarkRoomRead(r.Context(), roomID, user.ID, req.MessageID)
+	if err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusForbidden, "forbidden")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to mark room read")
+		return
+	}
+	s.Hub.PublishReadState(r.Context(), s.Store, roomID, user.ID, lastRead)
+	if direct, err := s.Store.IsDirectRoom(r.Context(), roomID); err == nil && direct {
+		s.Hub.PublishDelivery(r.Context(), s.Store, roomID)
+	}
+	jsonResponse(w, http.StatusOK, map[string]int64{"last_read_message_id": lastRead})
+}
+
 func (s *Server) listCallParticipants(w http.ResponseWriter, r *http.Request) {
 	user, ok := middleware.UserFromContext(r.Context())
 	if !ok {
@@ -494,7 +823,81 @@ func (s *Server) listCallParticipants(w http.ResponseWriter, r *http.Request) {
 	jsonResponse(w, http.StatusOK, participants)
 }
 
+// callJoin checks the caller may join roomID's call and signs them a token
+// for it. It reports false after writing the error response.
+func (s *Server) callJoin(w http.ResponseWriter, r *http.Request) (roomID uuid.UUID, token string, ok bool) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return uuid.Nil, "", false
+	}
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return uuid.Nil, "", false
+	}
+	if _, err := s.Store.GetRoomByID(r.Context(), roomID); err != nil {
+		jsonError(w, http.StatusNotFound, "room not found")
+		return uuid.Nil, "", false
+	}
+	member, err := s.Store.IsRoomMember(r.Context(), roomID, user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check membership")
+		return uuid.Nil, "", false
+	}
+	if !member {
+		jsonError(w, http.StatusForbidden, "forbidden")
+		return uuid.Nil, "", false
+	}
+
+	p := calls.Participant{ID: user.ID.String(), Name: user.Username}
+	if u, err := s.Store.FindUserByID(r.Context(), user.ID); err == nil {
+		p.AvatarURL = u.AvatarURL
+	}
+	token, err = s.Calls.Token(roomID.String(), p, 2*time.Hour)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to generate call token")
+		return uuid.Nil, "", false
+	}
+	return roomID, token, true
+}
+
+// liveKitToken is the LiveKit-only form of callToken that older clients
+// use.
 func (s *Server) liveKitToken(w http.ResponseWriter, r *http.Request) {
+	if s.Calls.Name() != "livekit" {
+		jsonError(w, http.StatusNotFound, "calls do not use livekit on this server")
+		return
+	}
+	roomID, token, ok := s.callJoin(w, r)
+	if !ok {
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]string{
+		"token":       token,
+		"livekit_url": s.roomCallURL(r.Context(), roomID),
+		"room_name":   roomID.String(),
+	})
+}
+
+// callToken tells a member which SFU the room's call runs on and signs
+// them a token to join it.
+func (s *Server) callToken(w http.ResponseWriter, r *http.Request) {
+	roomID, token, ok := s.callJoin(w, r)
+	if !ok {
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]string{
+		"provider":  s.Calls.Name(),
+		"url":       s.roomCallURL(r.Context(), roomID),
+		"token":     token,
+		"room_name": roomID.String(),
+	})
+}
+
+// searchMessages runs a full-text search over a room. The index is filled by
+// the background worker, so messages from the last few seconds may be missing.
+func (s *Server) searchMessages(w http.ResponseWriter, r *http.Request) {
 	user, ok := middleware.UserFromContext(r.Context())
 	if !ok {
 		jsonError(w, http.StatusUnauthorized, "unauthorized")
@@ -505,8 +908,9 @@ func (s *Server) liveKitToken(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusBadRequest, "invalid room id")
 		return
 	}
-	if _, err := s.Store.GetRoomByID(r.Context(), roomID); err != nil {
-		jsonError(w, http.StatusNotFound, "room not found")
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		jsonError(w, http.StatusBadRequest, "q is required")
 		return
 	}
 	member, err := s.Store.IsRoomMember(r.Context(), roomID, user.ID)
@@ -519,25 +923,261 @@ func (s *Server) liveKitToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	grant := &lkauth.VideoGrant{
-		RoomJoin: true,
-		Room:     roomID.String(),
+	hideNSFW, ok := s.nsfwAccess(w, r, roomID, user.ID)
+	if !ok {
+		return
 	}
-	at := lkauth.NewAccessToken(s.Cfg.LiveKitAPIKey, s.Cfg.LiveKitAPISecret)
-	at.SetIdentity(user.ID.String())
-	at.SetName(user.Username)
-	at.SetValidFor(2 * time.Hour)
-	at.AddGrant(grant)
 
-	token, err := at.ToJWT()
+	p, err := parsePage(r, 20, 100)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var before int64
+	if p.Cursor != "" {
+		before, err = strconv.ParseInt(strings.TrimPrefix(p.Cursor, "b:"), 10, 64)
+		if err != nil || before <= 0 || !strings.HasPrefix(p.Cursor, "b:") {
+			jsonError(w, http.StatusBadRequest, errInvalidCursor.Error())
+			return
+		}
+	}
+	messages, err := s.Store.SearchMessages(r.Context(), roomID, q, before, p.Limit)
 	if err != nil {
-		jsonError(w, http.StatusInternalServerError, "failed to generate livekit token")
+		jsonError(w, http.StatusInternalServerError, "failed to search messages")
 		return
 	}
+	// A full page may have more behind it; the next page starts below the
+	// oldest hit. Shadowed messages are dropped after this so paging stays
+	// in step with the store.
+	if len(messages) == p.Limit {
+		setNextPage(w, r, encodeCursor(fmt.Sprintf("b:%d", messages[len(messages)-1].ID)))
+	}
+	jsonResponse(w, http.StatusOK, s.maskFor(r.Context(), roomID, user.ID, viewable(messages, user.ID, hideNSFW)))
+}
 
-	jsonResponse(w, http.StatusOK, map[string]string{
-		"token":       token,
-		"livekit_url": s.Cfg.LiveKitURL,
-		"room_name":   roomID.String(),
+// listRoomMedia serves the "shared media" tab: media messages only, newest
+// first, paged with ?before=<message id>.
+func (s *Server) listRoomMedia(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return
+	}
+	types := db.MediaMessageTypes
+	if t := r.URL.Query().Get("type"); t != "" {
+		if !slices.Contains(db.MediaMessageTypes, t) {
+			jsonError(w, http.StatusBadRequest, "type must be image, file or audio")
+			return
+		}
+		types = []string{t}
+	}
+	var before int64
+	if raw := r.URL.Query().Get("before"); raw != "" {
+		before, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil || before <= 0 {
+			jsonError(w, http.StatusBadRequest, "invalid before")
+			return
+		}
+	}
+	member, err := s.Store.IsRoomMember(r.Context(), roomID, user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check membership")
+		return
+	}
+	if !member {
+		jsonError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+
+	hideNSFW, ok := s.nsfwAccess(w, r, roomID, user.ID)
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 30
+	}
+	// One extra row tells us whether another page exists.
+	messages, err := s.Store.ListRoomMedia(r.Context(), roomID, types, before, limit+1)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load media")
+		return
+	}
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{
+		"messages": s.maskFor(r.Context(), roomID, user.ID, viewable(messages, user.ID, hideNSFW)),
+		"has_more": hasMore,
+	})
+}
+
+// getMessageWithContext returns one message plus up to ?context=N messages on
+// either side, for jumping to search hits, pins and notification links.
+func (s *Server) getMessageWithContext(w http.ResponseWriter, r *http.Request) {
+	messageID, ok := parseMessageID(w, r)
+	if !ok {
+		return
+	}
+	s.serveMessageContext(w, r, false, fixedMessage(messageID))
+}
+
+// getMessagesAroundDate is getMessageWithContext for a date instead of a
+// message: ?date= is a day (YYYY-MM-DD, in the viewer's time zone) or an
+// RFC 3339 time, and the response centres on the first message posted then
+// or later, or the newest message when the room has none that late.
+func (s *Server) getMessagesAroundDate(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	at, _, err := parseDateOrTime(r.URL.Query().Get("date"), s.userLocation(r.Context(), user.ID))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "date must be YYYY-MM-DD or an RFC 3339 time")
+		return
+	}
+	s.serveMessageContext(w, r, false, func(ctx context.Context, roomID, viewerID uuid.UUID) (int64, error) {
+		return s.Store.FindMessageAt(ctx, roomID, viewerID, at)
 	})
 }
+
+// resolvePermalink backs the /r/{roomID}/m/{messageID} share URLs. It is the
+// same lookup as getMessageWithContext but also returns the room, since the
+// client following a link may not have it loaded yet.
+func (s *Server) resolvePermalink(w http.ResponseWriter, r *http.Request) {
+	messageID, ok := parseMessageID(w, r)
+	if !ok {
+		return
+	}
+	s.serveMessageContext(w, r, true, fixedMessage(messageID))
+}
+
+func parseMessageID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	messageID, err := strconv.ParseInt(chi.URLParam(r, "messageID"), 10, 64)
+	if err != nil || messageID <= 0 {
+		jsonError(w, http.StatusBadRequest, "invalid message id")
+		return 0, false
+	}
+	return messageID, true
+}
+
+// messageLocator picks the message serveMessageContext centres on, once
+// the viewer is known to be a member of the room.
+type messageLocator func(ctx context.Context, roomID, viewerID uuid.UUID) (int64, error)
+
+func fixedMessage(messageID int64) messageLocator {
+	return func(context.Context, uuid.UUID, uuid.UUID) (int64, error) { return messageID, nil }
+}
+
+func (s *Server) serveMessageContext(w http.ResponseWriter, r *http.Request, withRoom bool, locate messageLocator) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return
+	}
+	around := 10
+	if raw := r.URL.Query().Get("context"); raw != "" {
+		around, err = strconv.Atoi(raw)
+		if err != nil || around < 0 || around > 50 {
+			jsonError(w, http.StatusBadRequest, "context must be between 0 and 50")
+			return
+		}
+	}
+	room, err := s.Store.GetRoomByID(r.Context(), roomID)
+	if err == db.ErrNotFound {
+		jsonError(w, http.StatusNotFound, "room not found")
+		return
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load room")
+		return
+	}
+	member, err := s.Store.IsRoomMember(r.Context(), roomID, user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check membership")
+		return
+	}
+	if !member {
+		jsonError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+
+	hideNSFW, ok := s.nsfwAccess(w, r, roomID, user.ID)
+	if !ok {
+		return
+	}
+
+	messageID, err := locate(r.Context(), roomID, user.ID)
+	if err != nil && err != db.ErrNotFound {
+		jsonError(w, http.StatusInternalServerError, "failed to find message")
+		return
+	}
+	var msg db.Message
+	if err == nil {
+		msg, err = s.Store.GetMessage(r.Context(), roomID, messageID)
+		if err == db.ErrNotFound {
+			msg, err = s.Archive.Get(r.Context(), roomID, messageID)
+		}
+	}
+	if err == nil && msg.Shadowed && msg.UserID != user.ID {
+		err = db.ErrNotFound
+	}
+	if err == db.ErrNotFound {
+		jsonError(w, http.StatusNotFound, "message not found")
+		return
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load message")
+		return
+	}
+	before, after := []db.Message{}, []db.Message{}
+	if around > 0 {
+		if before, err = s.Store.ListMessagesBefore(r.Context(), roomID, messageID, around); err == nil {
+			before, err = s.Archive.Before(r.Context(), roomID, messageID, around, before)
+		}
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "failed to load context")
+			return
+		}
+		if after, err = s.Store.ListMessagesAfter(r.Context(), roomID, messageID, around); err == nil {
+			after, err = s.Archive.After(r.Context(), roomID, messageID, around, after)
+		}
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "failed to load context")
+			return
+		}
+	}
+	if hideNSFW {
+		msg = db.WithholdNSFWMedia([]db.Message{msg})[0]
+	}
+	msg = s.maskFor(r.Context(), roomID, user.ID, []db.Message{msg})[0]
+	resp := map[string]any{
+		"message":   msg,
+		"before":    s.maskFor(r.Context(), roomID, user.ID, viewable(before, user.ID, hideNSFW)),
+		"after":     s.maskFor(r.Context(), roomID, user.ID, viewable(after, user.ID, hideNSFW)),
+		"permalink": s.messagePermalink(roomID, messageID),
+	}
+	if withRoom {
+		resp["room"] = room
+	}
+	jsonResponse(w, http.StatusOK, resp)
+}
+
+// messagePermalink is the stable share URL for a message. The frontend
+// resolves it through /api/permalinks.
+func (s *Server) messagePermalink(roomID uuid.UUID, messageID int64) string {
+	return fmt.Sprintf("%s/r/%s/m/%d", strings.TrimRight(s.Cfg.FrontendBaseURL, "/"), roomID, messageID)
+}
@@ -0,0 +1,79 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// getRoomMentionPolicy tells any member who may use @room and @here, so
+// clients can warn before a mention that will not notify anyone.
+func (s *Server) getRoomMentionPolicy(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return
+	}
+	member, err := s.Store.IsRoomMember(r.Context(), roomID, user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check membership")
+		return
+	}
+	if !member {
+		jsonError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+	policy, err := s.Store.GetRoomMentionPolicy(r.Context(), roomID)
+	if err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "room not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to load mention policy")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]string{"policy": policy})
+}
+
+func (s *Server) setRoomMentionPolicy(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return
+	}
+	var req struct {
+		Policy string `json:"policy"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if !slices.Contains(db.RoomMentionPolicies, req.Policy) {
+		jsonError(w, http.StatusBadRequest, "policy must be admins, members or off")
+		return
+	}
+	if !s.authorizeRoomAdmin(w, r, roomID, user.ID) {
+		return
+	}
+	if err := s.Store.SetRoomMentionPolicy(r.Context(), roomID, req.Policy); err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to save mention policy")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]string{"policy": req.Policy})
+}
@@ -0,0 +1,125 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/quota"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// Names of the limits a room size warning is about, besides the member
+// quota.
+const (
+	roomLimitMessages   = "messages"
+	roomLimitMediaBytes = "media_bytes"
+)
+
+// roomSizeReport is a room's size with the limits it is getting close to.
+type roomSizeReport struct {
+	db.RoomSize
+	Warnings []roomSizeWarning `json:"warnings"`
+}
+
+// roomSizeWarning says a room has reached ROOM_WARN_PERCENT of a limit.
+// DaysLeft is how long the last 30 days' growth would take to reach it,
+// absent when the room is not growing or is already there.
+type roomSizeWarning struct {
+	Limit    string `json:"limit"`
+	Max      int64  `json:"max"`
+	Used     int64  `json:"used"`
+	DaysLeft *int   `json:"days_left,omitempty"`
+}
+
+// listRoomSizes reports the largest rooms by ?order= (messages,
+// media_bytes or growth) with their retention and any warnings.
+func (s *Server) listRoomSizes(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := s.roomSizeFilter()
+	if order := q.Get("order"); order != "" {
+		if !db.ValidRoomSizeOrder(order) {
+			jsonError(w, http.StatusBadRequest, "order must be messages, media_bytes or growth")
+			return
+		}
+		f.OrderBy = order
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 500 {
+			jsonError(w, http.StatusBadRequest, "limit must be between 1 and 500")
+			return
+		}
+		f.Limit = n
+	}
+	sizes, err := s.Store.ListRoomSizes(r.Context(), f)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load room sizes")
+		return
+	}
+	reports := make([]roomSizeReport, 0, len(sizes))
+	for _, rs := range sizes {
+		reports = append(reports, s.roomSizeReport(rs))
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{
+		"rooms": reports,
+		"thresholds": map[string]int64{
+			roomLimitMessages:   int64(s.Cfg.RoomWarnMessages),
+			roomLimitMediaBytes: int64(s.Cfg.RoomWarnMediaMB) << 20,
+			"percent":           int64(s.Cfg.RoomWarnPercent),
+		},
+	})
+}
+
+func (s *Server) getRoomSize(w http.ResponseWriter, r *http.Request) {
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return
+	}
+	f := s.roomSizeFilter()
+	f.RoomID = roomID
+	sizes, err := s.Store.ListRoomSizes(r.Context(), f)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load room size")
+		return
+	}
+	if len(sizes) == 0 {
+		jsonError(w, http.StatusNotFound, "room not found")
+		return
+	}
+	jsonResponse(w, http.StatusOK, s.roomSizeReport(sizes[0]))
+}
+
+func (s *Server) roomSizeFilter() db.RoomSizeFilter {
+	limits := s.defaultLimits()
+	return db.RoomSizeFilter{
+		OrderBy:            db.RoomSizeByMessages,
+		Limit:              50,
+		DefaultHistoryDays: limits.HistoryDays,
+		DefaultMaxMembers:  limits.MaxRoomMembers,
+	}
+}
+
+// roomSizeReport checks rs against the configured thresholds and its
+// member quota.
+func (s *Server) roomSizeReport(rs db.RoomSize) roomSizeReport {
+	report := roomSizeReport{RoomSize: rs, Warnings: []roomSizeWarning{}}
+	check := func(limit string, max, used, perMonth int64) {
+		if max <= 0 || used*100 < max*int64(s.Cfg.RoomWarnPercent) {
+			return
+		}
+		warning := roomSizeWarning{Limit: limit, Max: max, Used: used}
+		if used < max && perMonth > 0 {
+			days := int((max - used) * 30 / perMonth)
+			warning.DaysLeft = &days
+		}
+		report.Warnings = append(report.Warnings, warning)
+	}
+	check(roomLimitMessages, int64(s.Cfg.RoomWarnMessages), rs.Messages, rs.Messages30d)
+	check(roomLimitMediaBytes, int64(s.Cfg.RoomWarnMediaMB)<<20, rs.MediaBytes, rs.MediaBytes30d)
+	check(quota.MaxRoomMembers, int64(rs.MaxMembers), int64(rs.Members), 0)
+	return report
+}
@@ -0,0 +1,95 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type roomStateMember struct {
+	db.RoomMemberDetail
+	// Online says the member has a socket open on this instance.
+	Online     bool              `json:"online"`
+	Activities []db.RichPresence `json:"activities,omitempty"`
+}
+
+type roomStateResponse struct {
+	Room     db.Room           `json:"room"`
+	Settings db.RoomSettings   `json:"settings"`
+	Members  []roomStateMember `json:"members"`
+}
+
+// getRoomState returns a room, its settings and its members with their
+// roles, mutes and presence in one document, so a moderation bot need not
+// call the endpoint of each. Settings only room admins may read are left
+// out for other members.
+func (s *Server) getRoomState(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return
+	}
+	ctx := r.Context()
+	member, err := s.Store.IsRoomMember(ctx, roomID, user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check membership")
+		return
+	}
+	if !member {
+		jsonError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+	room, err := s.Store.GetRoomByID(ctx, roomID)
+	if err != nil {
+		jsonError(w, http.StatusNotFound, "room not found")
+		return
+	}
+	settings, err := s.Store.GetRoomSettings(ctx, roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load room settings")
+		return
+	}
+	details, err := s.Store.ListRoomMemberDetails(ctx, roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load members")
+		return
+	}
+	ids := make([]uuid.UUID, len(details))
+	for i, m := range details {
+		ids[i] = m.ID
+	}
+	presence, err := s.Store.ListRichPresence(ctx, ids)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load presence")
+		return
+	}
+	activities := make(map[uuid.UUID][]db.RichPresence)
+	for _, p := range presence {
+		activities[p.UserID] = append(activities[p.UserID], p)
+	}
+
+	members := make([]roomStateMember, len(details))
+	for i, m := range details {
+		if m.ID == user.ID {
+			room.MyRole = m.Role
+		}
+		members[i] = roomStateMember{
+			RoomMemberDetail: m,
+			Online:           s.Hub.IsUserOnline(m.ID),
+			Activities:       activities[m.ID],
+		}
+	}
+	if room.MyRole != "admin" {
+		settings.Unlisted, settings.RaidMode, settings.WordMask = nil, nil, nil
+	}
+	jsonResponse(w, http.StatusOK, roomStateResponse{Room: room, Settings: settings, Members: members})
+}
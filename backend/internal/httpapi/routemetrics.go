@@ -0,0 +1,71 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+
+	"talkie/backend/internal/metrics"
+
+	"github.com/go-chi/chi/v5"
+)
+
+var httpRequests = metrics.NewCounterVec("talkie_http_requests_total", "HTTP requests by method, route pattern and status class.", "method", "route", "code")
+
+// countRoutes counts requests per route pattern, so that feature use shows
+// in metrics without a label per room or user id, and adds them to the
+// telemetry usage counts when telemetry is on.
+func (s *Server) countRoutes(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Upgraded connections are hijacked, which a wrapped writer would
+		// hide; they have no status worth counting anyway.
+		if r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			s.countRoute(r, "upgrade")
+			return
+		}
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		s.countRoute(r, strconv.Itoa(sw.status/100)+"xx")
+	})
+}
+
+func (s *Server) countRoute(r *http.Request, code string) {
+	route := "unmatched"
+	if rc := chi.RouteContext(r.Context()); rc != nil && rc.RoutePattern() != "" {
+		route = rc.RoutePattern()
+	}
+	httpRequests.With(r.Method, route, code).Add(1)
+	if route != "unmatched" {
+		s.Usage.Add(r.Method + " " + route)
+	}
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
@@ -0,0 +1,1114 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"talkie/backend/internal/auth"
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+	"talkie/backend/internal/sso"
+	"talkie/backend/internal/ws"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// SCIM 2.0 (RFC 7643, 7644) lets an enterprise identity provider create,
+// update and deactivate accounts and keep its groups' members in the
+// workspaces or rooms an instance admin points them at. The provider
+// authenticates with a token from /api/admin/scim/tokens; every change it
+// makes is recorded as a security event.
+
+const (
+	scimUserSchema    = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimGroupSchema   = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimListSchema    = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimErrorSchema   = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimDefaultCount  = 100
+	scimMaxCount      = 200
+	scimMaxBodyBytes  = 1 << 20
+	scimMaxGroupPatch = 1000
+)
+
+var (
+	scimFilter       = regexp.MustCompile(`^\s*([A-Za-z.]+)\s+(?i:eq)\s+("(?:[^"\\]|\\.)*")\s*$`)
+	scimMemberFilter = regexp.MustCompile(`(?i)^members\[value eq "([^"]+)"\]$`)
+)
+
+type scimTokenKey struct{}
+
+// scimAuth lets requests with a SCIM token through.
+func (s *Server) scimAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			scimError(w, http.StatusUnauthorized, "", "missing bearer token")
+			return
+		}
+		id, err := s.Store.UseSCIMToken(r.Context(), tokenHash(strings.TrimSpace(token)))
+		if err != nil {
+			if err == db.ErrNotFound {
+				scimError(w, http.StatusUnauthorized, "", "invalid token")
+				return
+			}
+			scimError(w, http.StatusInternalServerError, "", "failed to check token")
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, scimMaxBodyBytes)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), scimTokenKey{}, id)))
+	})
+}
+
+func scimResponse(w http.ResponseWriter, status int, payload any) {
+	w.Header().Set("Content-Type", "application/scim+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+// scimError answers with a SCIM error; scimType may be empty.
+func scimError(w http.ResponseWriter, status int, scimType, detail string) {
+	body := map[string]any{
+		"schemas": []string{scimErrorSchema},
+		"status":  strconv.Itoa(status),
+		"detail":  detail,
+	}
+	if scimType != "" {
+		body["scimType"] = scimType
+	}
+	scimResponse(w, status, body)
+}
+
+// auditSCIM records a change made through SCIM as a security event.
+func (s *Server) auditSCIM(r *http.Request, kind string, userID *uuid.UUID, detail string) {
+	tokenID, _ := r.Context().Value(scimTokenKey{}).(int64)
+	lc := s.loginContextFromRequest(r)
+	err := s.Store.RecordSecurityEvent(r.Context(), db.SecurityEvent{
+		UserID: userID, Kind: kind, IP: lc.IP, Country: lc.Country, UserAgent: lc.UserAgent,
+		Detail: fmt.Sprintf("token %d: %s", tokenID, detail),
+	})
+	if err != nil {
+		log.Printf("record %s: %v", kind, err)
+	}
+}
+
+func (s *Server) scimBaseURL(r *http.Request) string {
+	return s.apiBaseURL(r) + "/api/scim/v2"
+}
+
+func (s *Server) scimServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	unsupported := map[string]bool{"supported": false}
+	scimResponse(w, http.StatusOK, map[string]any{
+		"schemas":        []string{"urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"},
+		"patch":          map[string]bool{"supported": true},
+		"bulk":           map[string]any{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]any{"supported": true, "maxResults": scimMaxCount},
+		"changePassword": unsupported,
+		"sort":           unsupported,
+		"etag":           unsupported,
+		"authenticationSchemes": []map[string]any{{
+			"type": "oauthbearertoken", "name": "Bearer token", "primary": true,
+			"description": "A token created by an instance admin.",
+		}},
+	})
+}
+
+func (s *Server) scimResourceTypes(w http.ResponseWriter, r *http.Request) {
+	types := []map[string]any{
+		{"schemas": []string{"urn:ietf:params:scim:schemas:core:2.0:ResourceType"}, "id": "User", "name": "User", "endpoint": "/Users", "schema": scimUserSchema},
+		{"schemas": []string{"urn:ietf:params:scim:schemas:core:2.0:ResourceType"}, "id": "Group", "name": "Group", "endpoint": "/Groups", "schema": scimGroupSchema},
+	}
+	scimResponse(w, http.StatusOK, scimList(types, len(types), 1))
+}
+
+func scimList[T any](resources []T, total, startIndex int) map[string]any {
+	return map[string]any{
+		"schemas":      []string{scimListSchema},
+		"totalResults": total,
+		"startIndex":   startIndex,
+		"itemsPerPage": len(resources),
+		"Resources":    resources,
+	}
+}
+
+// scimPage reads the filter and paging of a listing. It answers the
+// request itself when they are invalid.
+func scimPage(w http.ResponseWriter, r *http.Request) (f db.SCIMFilter, startIndex, count int, ok bool) {
+	q := r.URL.Query()
+	if raw := q.Get("filter"); raw != "" {
+		m := scimFilter.FindStringSubmatch(raw)
+		if m == nil {
+			scimError(w, http.StatusBadRequest, "invalidFilter", `only filters of the form attribute eq "value" are supported`)
+			return f, 0, 0, false
+		}
+		value, err := strconv.Unquote(m[2])
+		if err != nil {
+			scimError(w, http.StatusBadRequest, "invalidFilter", "invalid filter value")
+			return f, 0, 0, false
+		}
+		f = db.SCIMFilter{Attr: strings.ToLower(m[1]), Value: value}
+	}
+	startIndex, count = 1, scimDefaultCount
+	if v, err := strconv.Atoi(q.Get("startIndex")); err == nil && v > 1 {
+		startIndex = v
+	}
+	if v, err := strconv.Atoi(q.Get("count")); err == nil && v >= 0 {
+		count = min(v, scimMaxCount)
+	}
+	return f, startIndex, count, true
+}
+
+// scimUser is the SCIM representation of an account.
+type scimUser struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id"`
+	ExternalID  string      `json:"externalId,omitempty"`
+	UserName    string      `json:"userName"`
+	DisplayName string      `json:"displayName,omitempty"`
+	Emails      []scimEmail `json:"emails"`
+	Active      bool        `json:"active"`
+	Meta        scimMeta    `json:"meta"`
+}
+
+type scimEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type scimMeta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location"`
+}
+
+func (s *Server) scimUserResource(r *http.Request, u db.SCIMUser) scimUser {
+	return scimUser{
+		Schemas:     []string{scimUserSchema},
+		ID:          u.UserID.String(),
+		ExternalID:  u.ExternalID,
+		UserName:    u.UserName,
+		DisplayName: u.DisplayName,
+		Emails:      []scimEmail{{Value: u.Email, Type: "work", Primary: true}},
+		Active:      u.Active,
+		Meta: scimMeta{
+			ResourceType: "User",
+			Created:      u.CreatedAt,
+			LastModified: u.UpdatedAt,
+			Location:     s.scimBaseURL(r) + "/Users/" + u.UserID.String(),
+		},
+	}
+}
+
+// scimUserInput is a user as a provider sends it. Only the attributes
+// Talkie keeps are read; the rest are accepted and dropped.
+type scimUserInput struct {
+	UserName    string      `json:"userName"`
+	ExternalID  string      `json:"externalId"`
+	DisplayName string      `json:"displayName"`
+	Name        scimName    `json:"name"`
+	Emails      []scimEmail `json:"emails"`
+	Active      *bool       `json:"active"`
+}
+
+type scimName struct {
+	Formatted  string `json:"formatted"`
+	GivenName  string `json:"givenName"`
+	FamilyName string `json:"familyName"`
+}
+
+// apply turns in into u's new attributes, returning what is wrong with
+// it, if anything.
+func (in scimUserInput) apply(u *db.SCIMUser) string {
+	u.UserName = strings.TrimSpace(in.UserName)
+	u.ExternalID = strings.TrimSpace(in.ExternalID)
+	u.DisplayName = strings.TrimSpace(in.DisplayName)
+	if u.DisplayName == "" {
+		u.DisplayName = strings.TrimSpace(in.Name.Formatted)
+	}
+	if u.DisplayName == "" {
+		u.DisplayName = strings.TrimSpace(in.Name.GivenName + " " + in.Name.FamilyName)
+	}
+	if in.Active != nil {
+		u.Active = *in.Active
+	}
+	if u.UserName == "" {
+		return "userName is required"
+	}
+	email := ""
+	for _, e := range in.Emails {
+		if email == "" || e.Primary {
+			email = e.Value
+		}
+	}
+	if email == "" && strings.Contains(u.UserName, "@") {
+		email = u.UserName
+	}
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return "an email is required"
+	}
+	if !strings.Contains(email, "@") || len(email) > 254 {
+		return "invalid email"
+	}
+	u.Email = email
+	return ""
+}
+
+func (s *Server) scimListUsers(w http.ResponseWriter, r *http.Request) {
+	f, startIndex, count, ok := scimPage(w, r)
+	if !ok {
+		return
+	}
+	users, total, err := s.Store.ListSCIMUsers(r.Context(), f, startIndex-1, count)
+	if err != nil {
+		if err == db.ErrSCIMFilter {
+			scimError(w, http.StatusBadRequest, "invalidFilter", "users can be filtered on id, userName, externalId or emails.value")
+			return
+		}
+		scimError(w, http.StatusInternalServerError, "", "failed to list users")
+		return
+	}
+	out := make([]scimUser, 0, len(users))
+	for _, u := range users {
+		out = append(out, s.scimUserResource(r, u))
+	}
+	scimResponse(w, http.StatusOK, scimList(out, total, startIndex))
+}
+
+// scimLoadUser loads the user in the URL, answering the request itself
+// when it cannot.
+func (s *Server) scimLoadUser(w http.ResponseWriter, r *http.Request) (db.SCIMUser, bool) {
+	userID, err := uuid.Parse(chi.URLParam(r, "scimUserID"))
+	if err != nil {
+		scimError(w, http.StatusNotFound, "", "user not found")
+		return db.SCIMUser{}, false
+	}
+	u, err := s.Store.GetSCIMUser(r.Context(), userID)
+	if err != nil {
+		if err == db.ErrNotFound {
+			scimError(w, http.StatusNotFound, "", "user not found")
+			return db.SCIMUser{}, false
+		}
+		scimError(w, http.StatusInternalServerError, "", "failed to load user")
+		return db.SCIMUser{}, false
+	}
+	return u, true
+}
+
+func (s *Server) scimGetUser(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.scimLoadUser(w, r)
+	if !ok {
+		return
+	}
+	scimResponse(w, http.StatusOK, s.scimUserResource(r, u))
+}
+
+func (s *Server) scimCreateUser(w http.ResponseWriter, r *http.Request) {
+	var in scimUserInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		scimError(w, http.StatusBadRequest, "invalidSyntax", "invalid request body")
+		return
+	}
+	u := db.SCIMUser{Active: true}
+	if msg := in.apply(&u); msg != "" {
+		scimError(w, http.StatusBadRequest, "invalidValue", msg)
+		return
+	}
+	created, err := s.provisionSCIMUser(r.Context(), u)
+	switch err {
+	case nil:
+	case db.ErrSCIMConflict:
+		scimError(w, http.StatusConflict, "uniqueness", "userName or account is already provisioned")
+		return
+	case db.ErrUserExists:
+		scimError(w, http.StatusConflict, "uniqueness", "email or username is in use by an account that cannot be provisioned")
+		return
+	default:
+		log.Printf("scim create user %q: %v", u.UserName, err)
+		scimError(w, http.StatusInternalServerError, "", "failed to create user")
+		return
+	}
+	s.auditSCIM(r, "scim_user_provisioned", &created.UserID, "userName "+created.UserName)
+	if !created.Active {
+		s.Hub.RevokeSessions(created.UserID, 0)
+	}
+	w.Header().Set("Location", s.scimBaseURL(r)+"/Users/"+created.UserID.String())
+	scimResponse(w, http.StatusCreated, s.scimUserResource(r, created))
+}
+
+// provisionSCIMUser creates or takes over the account for u, trying a few
+// numbered usernames when the plain one is taken. A new account's
+// password is random and never shown, as with SSO accounts.
+func (s *Server) provisionSCIMUser(ctx context.Context, u db.SCIMUser) (db.SCIMUser, error) {
+	password, err := randomToken(32)
+	if err != nil {
+		return db.SCIMUser{}, err
+	}
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return db.SCIMUser{}, err
+	}
+	local, _, _ := strings.Cut(u.UserName, "@")
+	username := ssoUsername(sso.Identity{Username: local, Email: u.Email})
+	name := username
+	for attempt := 0; ; attempt++ {
+		created, err := s.Store.CreateSCIMUser(ctx, u, name, hash)
+		if err != db.ErrUserExists || attempt == 4 {
+			return created, err
+		}
+		suffix, err := randomDigits(4)
+		if err != nil {
+			return db.SCIMUser{}, err
+		}
+		name = username[:min(len(username), 11)] + suffix
+	}
+}
+
+func (s *Server) scimReplaceUser(w http.ResponseWriter, r *http.Request) {
+	current, ok := s.scimLoadUser(w, r)
+	if !ok {
+		return
+	}
+	var in scimUserInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		scimError(w, http.StatusBadRequest, "invalidSyntax", "invalid request body")
+		return
+	}
+	u := current
+	u.Active = true
+	if msg := in.apply(&u); msg != "" {
+		scimError(w, http.StatusBadRequest, "invalidValue", msg)
+		return
+	}
+	s.scimSaveUser(w, r, current, u)
+}
+
+// scimPatch is a PATCH request body.
+type scimPatch struct {
+	Operations []scimPatchOp `json:"Operations"`
+}
+
+type scimPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+func decodeSCIMPatch(w http.ResponseWriter, r *http.Request) (scimPatch, bool) {
+	var p scimPatch
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		scimError(w, http.StatusBadRequest, "invalidSyntax", "invalid request body")
+		return p, false
+	}
+	for i := range p.Operations {
+		p.Operations[i].Op = strings.ToLower(p.Operations[i].Op)
+		switch p.Operations[i].Op {
+		case "add", "replace", "remove":
+		default:
+			scimError(w, http.StatusBadRequest, "invalidSyntax", fmt.Sprintf("unknown op %q", p.Operations[i].Op))
+			return p, false
+		}
+	}
+	return p, true
+}
+
+func (s *Server) scimPatchUser(w http.ResponseWriter, r *http.Request) {
+	current, ok := s.scimLoadUser(w, r)
+	if !ok {
+		return
+	}
+	p, ok := decodeSCIMPatch(w, r)
+	if !ok {
+		return
+	}
+	in := scimUserInput{
+		UserName:    current.UserName,
+		ExternalID:  current.ExternalID,
+		DisplayName: current.DisplayName,
+		Emails:      []scimEmail{{Value: current.Email, Primary: true}},
+		Active:      &current.Active,
+	}
+	for _, op := range p.Operations {
+		if err := in.patch(op); err != nil {
+			scimError(w, http.StatusBadRequest, "invalidValue", err.Error())
+			return
+		}
+	}
+	u := current
+	if msg := in.apply(&u); msg != "" {
+		scimError(w, http.StatusBadRequest, "invalidValue", msg)
+		return
+	}
+	s.scimSaveUser(w, r, current, u)
+}
+
+// patch applies one PATCH operation. Without a path, the value holds the
+// attributes to set, by name or by path.
+func (in *scimUserInput) patch(op scimPatchOp) error {
+	if op.Path == "" {
+		if op.Op == "remove" {
+			return errors.New("remove needs a path")
+		}
+		var attrs map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &attrs); err != nil {
+			return errors.New("value must be an object when there is no path")
+		}
+		for path, value := range attrs {
+			if err := in.set(path, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if op.Op == "remove" {
+		return in.set(op.Path, json.RawMessage("null"))
+	}
+	return in.set(op.Path, op.Value)
+}
+
+func (in *scimUserInput) set(path string, value json.RawMessage) error {
+	null := bytes.Equal(bytes.TrimSpace(value), []byte("null"))
+	switch p := strings.ToLower(path); {
+	case p == "active":
+		// Some providers send booleans as strings.
+		var v any
+		if err := json.Unmarshal(value, &v); err != nil {
+			return errors.New("invalid active")
+		}
+		var active bool
+		switch v := v.(type) {
+		case bool:
+			active = v
+		case string:
+			active = strings.EqualFold(v, "true")
+		default:
+			return errors.New("active must be a boolean")
+		}
+		in.Active = &active
+	case p == "username":
+		return scimString(value, null, &in.UserName)
+	case p == "externalid":
+		return scimString(value, null, &in.ExternalID)
+	case p == "displayname":
+		return scimString(value, null, &in.DisplayName)
+	case p == "name":
+		in.Name = scimName{}
+		if null {
+			return nil
+		}
+		return json.Unmarshal(value, &in.Name)
+	case p == "name.formatted":
+		return scimString(value, null, &in.Name.Formatted)
+	case p == "name.givenname":
+		return scimString(value, null, &in.Name.GivenName)
+	case p == "name.familyname":
+		return scimString(value, null, &in.Name.FamilyName)
+	case p == "emails":
+		if null {
+			in.Emails = nil
+			return nil
+		}
+		return json.Unmarshal(value, &in.Emails)
+	case strings.HasPrefix(p, "emails[") && strings.HasSuffix(p, "].value"):
+		// The one address Talkie keeps stands for whichever is meant.
+		var email string
+		if err := scimString(value, null, &email); err != nil {
+			return err
+		}
+		in.Emails = []scimEmail{{Value: email, Primary: true}}
+	}
+	return nil
+}
+
+func scimString(value json.RawMessage, null bool, dst *string) error {
+	if null {
+		*dst = ""
+		return nil
+	}
+	if err := json.Unmarshal(value, dst); err != nil {
+		return errors.New("expected a string")
+	}
+	return nil
+}
+
+// scimSaveUser stores u over current and answers with it.
+func (s *Server) scimSaveUser(w http.ResponseWriter, r *http.Request, current, u db.SCIMUser) {
+	saved, err := s.Store.UpdateSCIMUser(r.Context(), u)
+	switch err {
+	case nil:
+	case db.ErrNotFound:
+		scimError(w, http.StatusNotFound, "", "user not found")
+		return
+	case db.ErrSCIMConflict:
+		scimError(w, http.StatusConflict, "uniqueness", "userName is taken")
+		return
+	case db.ErrUserExists:
+		scimError(w, http.StatusConflict, "uniqueness", "email is in use by another account")
+		return
+	default:
+		log.Printf("scim update user %s: %v", u.UserID, err)
+		scimError(w, http.StatusInternalServerError, "", "failed to update user")
+		return
+	}
+	switch {
+	case current.Active && !saved.Active:
+		s.Hub.RevokeSessions(saved.UserID, 0)
+		s.auditSCIM(r, "scim_user_deactivated", &saved.UserID, "userName "+saved.UserName)
+	case !current.Active && saved.Active:
+		s.auditSCIM(r, "scim_user_reactivated", &saved.UserID, "userName "+saved.UserName)
+	}
+	if current.UserName != saved.UserName || current.Email != saved.Email || current.ExternalID != saved.ExternalID || current.DisplayName != saved.DisplayName {
+		s.auditSCIM(r, "scim_user_updated", &saved.UserID, "userName "+saved.UserName)
+	}
+	scimResponse(w, http.StatusOK, s.scimUserResource(r, saved))
+}
+
+// scimDeleteUser deactivates the account and stops managing it; the
+// account itself is kept, as are its rooms and messages.
+func (s *Server) scimDeleteUser(w http.ResponseWriter, r *http.Request) {
+	u, ok := s.scimLoadUser(w, r)
+	if !ok {
+		return
+	}
+	if err := s.Store.DeleteSCIMUser(r.Context(), u.UserID); err != nil {
+		if err == db.ErrNotFound {
+			scimError(w, http.StatusNotFound, "", "user not found")
+			return
+		}
+		scimError(w, http.StatusInternalServerError, "", "failed to delete user")
+		return
+	}
+	s.Hub.RevokeSessions(u.UserID, 0)
+	s.auditSCIM(r, "scim_user_deprovisioned", &u.UserID, "userName "+u.UserName)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// scimGroup is the SCIM representation of a group.
+type scimGroup struct {
+	Schemas     []string          `json:"schemas"`
+	ID          string            `json:"id"`
+	ExternalID  string            `json:"externalId,omitempty"`
+	DisplayName string            `json:"displayName"`
+	Members     []scimGroupMember `json:"members"`
+	Meta        scimMeta          `json:"meta"`
+}
+
+type scimGroupMember struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+func (s *Server) scimGroupResource(r *http.Request, g db.SCIMGroup) scimGroup {
+	base := s.scimBaseURL(r)
+	members := make([]scimGroupMember, 0, len(g.Members))
+	for _, m := range g.Members {
+		members = append(members, scimGroupMember{Value: m.UserID.String(), Display: m.UserName, Ref: base + "/Users/" + m.UserID.String()})
+	}
+	return scimGroup{
+		Schemas:     []string{scimGroupSchema},
+		ID:          g.ID.String(),
+		ExternalID:  g.ExternalID,
+		DisplayName: g.DisplayName,
+		Members:     members,
+		Meta: scimMeta{
+			ResourceType: "Group",
+			Created:      g.CreatedAt,
+			LastModified: g.UpdatedAt,
+			Location:     base + "/Groups/" + g.ID.String(),
+		},
+	}
+}
+
+type scimGroupInput struct {
+	DisplayName string            `json:"displayName"`
+	ExternalID  string            `json:"externalId"`
+	Members     []scimGroupMember `json:"members"`
+}
+
+// memberIDs parses the members' IDs, ignoring any that cannot be ours.
+func memberIDs(members []scimGroupMember) []uuid.UUID {
+	out := make([]uuid.UUID, 0, len(members))
+	for _, m := range members {
+		if id, err := uuid.Parse(m.Value); err == nil {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+func (s *Server) scimListGroups(w http.ResponseWriter, r *http.Request) {
+	f, startIndex, count, ok := scimPage(w, r)
+	if !ok {
+		return
+	}
+	groups, total, err := s.Store.ListSCIMGroups(r.Context(), f, startIndex-1, count)
+	if err != nil {
+		if err == db.ErrSCIMFilter {
+			scimError(w, http.StatusBadRequest, "invalidFilter", "groups can be filtered on id, displayName or externalId")
+			return
+		}
+		scimError(w, http.StatusInternalServerError, "", "failed to list groups")
+		return
+	}
+	excludeMembers := strings.Contains(strings.ToLower(r.URL.Query().Get("excludedAttributes")), "members")
+	out := make([]scimGroup, 0, len(groups))
+	for _, g := range groups {
+		res := s.scimGroupResource(r, g)
+		if excludeMembers {
+			res.Members = nil
+		}
+		out = append(out, res)
+	}
+	scimResponse(w, http.StatusOK, scimList(out, total, startIndex))
+}
+
+// scimLoadGroup loads the group in the URL, answering the request itself
+// when it cannot.
+func (s *Server) scimLoadGroup(w http.ResponseWriter, r *http.Request) (db.SCIMGroup, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "scimGroupID"))
+	if err != nil {
+		scimError(w, http.StatusNotFound, "", "group not found")
+		return db.SCIMGroup{}, false
+	}
+	g, err := s.Store.GetSCIMGroup(r.Context(), id)
+	if err != nil {
+		if err == db.ErrNotFound {
+			scimError(w, http.StatusNotFound, "", "group not found")
+			return db.SCIMGroup{}, false
+		}
+		scimError(w, http.StatusInternalServerError, "", "failed to load group")
+		return db.SCIMGroup{}, false
+	}
+	return g, true
+}
+
+func (s *Server) scimGetGroup(w http.ResponseWriter, r *http.Request) {
+	g, ok := s.scimLoadGroup(w, r)
+	if !ok {
+		return
+	}
+	scimResponse(w, http.StatusOK, s.scimGroupResource(r, g))
+}
+
+func (s *Server) scimCreateGroup(w http.ResponseWriter, r *http.Request) {
+	var in scimGroupInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		scimError(w, http.StatusBadRequest, "invalidSyntax", "invalid request body")
+		return
+	}
+	in.DisplayName = strings.TrimSpace(in.DisplayName)
+	if in.DisplayName == "" {
+		scimError(w, http.StatusBadRequest, "invalidValue", "displayName is required")
+		return
+	}
+	g, err := s.Store.CreateSCIMGroup(r.Context(), in.DisplayName, strings.TrimSpace(in.ExternalID))
+	if err != nil {
+		if err == db.ErrSCIMConflict {
+			scimError(w, http.StatusConflict, "uniqueness", "displayName is taken")
+			return
+		}
+		scimError(w, http.StatusInternalServerError, "", "failed to create group")
+		return
+	}
+	s.auditSCIM(r, "scim_group_created", nil, fmt.Sprintf("group %s %q", g.ID, g.DisplayName))
+	if !s.scimSetMembers(w, r, g, memberIDs(in.Members)) {
+		return
+	}
+	w.Header().Set("Location", s.scimBaseURL(r)+"/Groups/"+g.ID.String())
+	s.scimRespondGroup(w, r, g.ID, http.StatusCreated)
+}
+
+func (s *Server) scimReplaceGroup(w http.ResponseWriter, r *http.Request) {
+	g, ok := s.scimLoadGroup(w, r)
+	if !ok {
+		return
+	}
+	var in scimGroupInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		scimError(w, http.StatusBadRequest, "invalidSyntax", "invalid request body")
+		return
+	}
+	if !s.scimRenameGroup(w, r, g, in.DisplayName, in.ExternalID) {
+		return
+	}
+	if !s.scimSetMembers(w, r, g, memberIDs(in.Members)) {
+		return
+	}
+	s.scimRespondGroup(w, r, g.ID, http.StatusOK)
+}
+
+func (s *Server) scimPatchGroup(w http.ResponseWriter, r *http.Request) {
+	g, ok := s.scimLoadGroup(w, r)
+	if !ok {
+		return
+	}
+	p, ok := decodeSCIMPatch(w, r)
+	if !ok {
+		return
+	}
+	name, externalID := g.DisplayName, g.ExternalID
+	var add, remove []uuid.UUID
+	var replace []uuid.UUID
+	replaced := false
+	for _, op := range p.Operations {
+		path := strings.ToLower(op.Path)
+		switch {
+		case path == "" && op.Op != "remove":
+			var in struct {
+				DisplayName *string           `json:"displayName"`
+				ExternalID  *string           `json:"externalId"`
+				Members     []scimGroupMember `json:"members"`
+			}
+			if err := json.Unmarshal(op.Value, &in); err != nil {
+				scimError(w, http.StatusBadRequest, "invalidValue", "value must be an object when there is no path")
+				return
+			}
+			if in.DisplayName != nil {
+				name = *in.DisplayName
+			}
+			if in.ExternalID != nil {
+				externalID = *in.ExternalID
+			}
+			if in.Members != nil {
+				if op.Op == "add" {
+					add = append(add, memberIDs(in.Members)...)
+				} else {
+					replace, replaced, add, remove = memberIDs(in.Members), true, nil, nil
+				}
+			}
+		case path == "displayname" && op.Op != "remove":
+			if err := scimString(op.Value, false, &name); err != nil {
+				scimError(w, http.StatusBadRequest, "invalidValue", "displayName must be a string")
+				return
+			}
+		case path == "externalid":
+			if err := scimString(op.Value, op.Op == "remove", &externalID); err != nil {
+				scimError(w, http.StatusBadRequest, "invalidValue", "externalId must be a string")
+				return
+			}
+		case path == "members":
+			var members []scimGroupMember
+			if len(op.Value) > 0 {
+				if err := json.Unmarshal(op.Value, &members); err != nil {
+					scimError(w, http.StatusBadRequest, "invalidValue", "members must be a list")
+					return
+				}
+			}
+			switch {
+			case op.Op == "add":
+				add = append(add, memberIDs(members)...)
+			case op.Op == "replace" || op.Op == "remove" && len(members) == 0:
+				replace, replaced, add, remove = memberIDs(members), true, nil, nil
+			default:
+				remove = append(remove, memberIDs(members)...)
+			}
+		case strings.HasPrefix(path, "members[") && op.Op == "remove":
+			// members[value eq "<id>"]
+			m := scimMemberFilter.FindStringSubmatch(op.Path)
+			if m == nil {
+				scimError(w, http.StatusBadRequest, "invalidPath", "unsupported members filter")
+				return
+			}
+			if id, err := uuid.Parse(m[1]); err == nil {
+				remove = append(remove, id)
+			}
+		default:
+			scimError(w, http.StatusBadRequest, "invalidPath", fmt.Sprintf("cannot %s %q", op.Op, op.Path))
+			return
+		}
+	}
+	if len(add)+len(remove)+len(replace) > scimMaxGroupPatch {
+		scimError(w, http.StatusRequestEntityTooLarge, "tooMany", fmt.Sprintf("at most %d members a request", scimMaxGroupPatch))
+		return
+	}
+	if (name != g.DisplayName || externalID != g.ExternalID) && !s.scimRenameGroup(w, r, g, name, externalID) {
+		return
+	}
+	if replaced && !s.scimSetMembers(w, r, g, replace) {
+		return
+	}
+	if len(remove) > 0 && !s.scimRemoveMembers(w, r, g, remove) {
+		return
+	}
+	if len(add) > 0 && !s.scimAddMembers(w, r, g, add) {
+		return
+	}
+	s.scimRespondGroup(w, r, g.ID, http.StatusOK)
+}
+
+func (s *Server) scimRenameGroup(w http.ResponseWriter, r *http.Request, g db.SCIMGroup, name, externalID string) bool {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		scimError(w, http.StatusBadRequest, "invalidValue", "displayName is required")
+		return false
+	}
+	if err := s.Store.RenameSCIMGroup(r.Context(), g.ID, name, strings.TrimSpace(externalID)); err != nil {
+		switch err {
+		case db.ErrSCIMConflict:
+			scimError(w, http.StatusConflict, "uniqueness", "displayName is taken")
+		case db.ErrNotFound:
+			scimError(w, http.StatusNotFound, "", "group not found")
+		default:
+			scimError(w, http.StatusInternalServerError, "", "failed to update group")
+		}
+		return false
+	}
+	if name != g.DisplayName {
+		s.auditSCIM(r, "scim_group_renamed", nil, fmt.Sprintf("group %s %q to %q", g.ID, g.DisplayName, name))
+	}
+	return true
+}
+
+// scimSetMembers makes userIDs g's members.
+func (s *Server) scimSetMembers(w http.ResponseWriter, r *http.Request, g db.SCIMGroup, userIDs []uuid.UUID) bool {
+	keep := make(map[uuid.UUID]bool, len(userIDs))
+	for _, id := range userIDs {
+		keep[id] = true
+	}
+	var remove []uuid.UUID
+	for _, m := range g.Members {
+		if !keep[m.UserID] {
+			remove = append(remove, m.UserID)
+		}
+	}
+	if len(remove) > 0 && !s.scimRemoveMembers(w, r, g, remove) {
+		return false
+	}
+	return len(userIDs) == 0 || s.scimAddMembers(w, r, g, userIDs)
+}
+
+func (s *Server) scimAddMembers(w http.ResponseWriter, r *http.Request, g db.SCIMGroup, userIDs []uuid.UUID) bool {
+	added, joined, err := s.Store.AddSCIMGroupMembers(r.Context(), g.ID, userIDs)
+	if err != nil {
+		log.Printf("scim add members to %s: %v", g.ID, err)
+		scimError(w, http.StatusInternalServerError, "", "failed to add members")
+		return false
+	}
+	for _, j := range joined {
+		go s.announceMembership(j.RoomID, j.UserID, ws.MemberJoined)
+	}
+	s.auditSCIMMembers(r, "scim_group_member_added", g, added)
+	return true
+}
+
+func (s *Server) scimRemoveMembers(w http.ResponseWriter, r *http.Request, g db.SCIMGroup, userIDs []uuid.UUID) bool {
+	removed, leaving, err := s.Store.RemoveSCIMGroupMembers(r.Context(), g.ID, userIDs)
+	if err != nil {
+		log.Printf("scim remove members from %s: %v", g.ID, err)
+		scimError(w, http.StatusInternalServerError, "", "failed to remove members")
+		return false
+	}
+	s.leaveSCIMRooms(r.Context(), leaving)
+	s.auditSCIMMembers(r, "scim_group_member_removed", g, removed)
+	return true
+}
+
+func (s *Server) auditSCIMMembers(r *http.Request, kind string, g db.SCIMGroup, userIDs []uuid.UUID) {
+	for _, id := range userIDs {
+		s.auditSCIM(r, kind, &id, fmt.Sprintf("group %s %q", g.ID, g.DisplayName))
+	}
+}
+
+// leaveSCIMRooms takes members out of the rooms their SCIM groups no
+// longer keep them in.
+func (s *Server) leaveSCIMRooms(ctx context.Context, leaving []db.SCIMRoomChange) {
+	for _, l := range leaving {
+		if err := s.Store.LeaveRoom(ctx, l.RoomID, l.UserID); err != nil {
+			if err != db.ErrNotFound {
+				log.Printf("scim: remove %s from room %s: %v", l.UserID, l.RoomID, err)
+			}
+			continue
+		}
+		s.Hub.RevokeMembership(l.RoomID, l.UserID)
+		s.logMembership(ctx, db.MembershipEvent{RoomID: l.RoomID, UserID: l.UserID, Action: db.MembershipLeft, Via: db.ViaSCIM})
+		go s.announceMembership(l.RoomID, l.UserID, ws.MemberLeft)
+	}
+}
+
+func (s *Server) scimRespondGroup(w http.ResponseWriter, r *http.Request, id uuid.UUID, status int) {
+	g, err := s.Store.GetSCIMGroup(r.Context(), id)
+	if err != nil {
+		scimError(w, http.StatusInternalServerError, "", "failed to load group")
+		return
+	}
+	scimResponse(w, status, s.scimGroupResource(r, g))
+}
+
+func (s *Server) scimDeleteGroup(w http.ResponseWriter, r *http.Request) {
+	g, ok := s.scimLoadGroup(w, r)
+	if !ok {
+		return
+	}
+	leaving, err := s.Store.DeleteSCIMGroup(r.Context(), g.ID)
+	if err != nil {
+		if err == db.ErrNotFound {
+			scimError(w, http.StatusNotFound, "", "group not found")
+			return
+		}
+		scimError(w, http.StatusInternalServerError, "", "failed to delete group")
+		return
+	}
+	s.leaveSCIMRooms(r.Context(), leaving)
+	s.auditSCIM(r, "scim_group_deleted", nil, fmt.Sprintf("group %s %q", g.ID, g.DisplayName))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// accountDeactivated answers 403 when userID was deactivated through
+// SCIM, reporting whether it did.
+func (s *Server) accountDeactivated(w http.ResponseWriter, r *http.Request, userID uuid.UUID) bool {
+	deactivated, err := s.Store.IsUserDeactivated(r.Context(), userID)
+	if err != nil {
+		log.Printf("check deactivation of %s: %v", userID, err)
+		return false
+	}
+	if deactivated {
+		jsonResponse(w, http.StatusForbidden, map[string]string{
+			"error": "this account has been deactivated",
+			"code":  "account_deactivated",
+		})
+	}
+	return deactivated
+}
+
+func (s *Server) listSCIMTokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := s.Store.ListSCIMTokens(r.Context())
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to list scim tokens")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"tokens": tokens})
+}
+
+// createSCIMToken returns the new token once; only its hash is kept.
+func (s *Server) createSCIMToken(w http.ResponseWriter, r *http.Request) {
+	admin, _ := middleware.UserFromContext(r.Context())
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		jsonError(w, http.StatusBadRequest, "name must be 1 to 100 characters")
+		return
+	}
+	token, err := randomToken(32)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to generate token")
+		return
+	}
+	t, err := s.Store.CreateSCIMToken(r.Context(), req.Name, tokenHash(token), admin.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to save scim token")
+		return
+	}
+	jsonResponse(w, http.StatusCreated, map[string]any{"token": token, "scim_token": t, "base_url": s.scimBaseURL(r)})
+}
+
+func (s *Server) deleteSCIMToken(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "tokenID"), 10, 64)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid token id")
+		return
+	}
+	if err := s.Store.DeleteSCIMToken(r.Context(), id); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "scim token not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to delete scim token")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+// listSCIMGroups shows instance admins the provider's groups and where
+// their members are kept, a page of ?offset= at a time.
+func (s *Server) listSCIMGroups(w http.ResponseWriter, r *http.Request) {
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	groups, total, err := s.Store.ListSCIMGroups(r.Context(), db.SCIMFilter{}, max(offset, 0), scimMaxCount)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to list scim groups")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"groups": groups, "total": total})
+}
+
+// setSCIMGroupTarget points a provider group at a workspace or a room and
+// puts its members there.
+func (s *Server) setSCIMGroupTarget(w http.ResponseWriter, r *http.Request) {
+	admin, _ := middleware.UserFromContext(r.Context())
+	id, err := uuid.Parse(chi.URLParam(r, "scimGroupID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid group id")
+		return
+	}
+	var req struct {
+		GroupID *uuid.UUID `json:"group_id"`
+		RoomID  *uuid.UUID `json:"room_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	switch {
+	case req.GroupID != nil && req.RoomID != nil:
+		jsonError(w, http.StatusBadRequest, "set group_id or room_id, not both")
+		return
+	case req.GroupID != nil:
+		if _, err := s.Store.CanManageGroup(r.Context(), *req.GroupID, admin.ID); err != nil {
+			if err == db.ErrNotFound {
+				jsonError(w, http.StatusNotFound, "workspace not found")
+				return
+			}
+			jsonError(w, http.StatusInternalServerError, "failed to load workspace")
+			return
+		}
+	case req.RoomID != nil:
+		if _, err := s.Store.GetRoomByID(r.Context(), *req.RoomID); err != nil {
+			jsonError(w, http.StatusNotFound, "room not found")
+			return
+		}
+		direct, err := s.Store.IsDirectRoom(r.Context(), *req.RoomID)
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "failed to check room type")
+			return
+		}
+		if direct {
+			jsonError(w, http.StatusBadRequest, "direct messages cannot be provisioned")
+			return
+		}
+	}
+	joined, err := s.Store.SetSCIMGroupTarget(r.Context(), id, req.GroupID, req.RoomID)
+	if err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "scim group not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to save scim group")
+		return
+	}
+	for _, j := range joined {
+		go s.announceMembership(j.RoomID, j.UserID, ws.MemberJoined)
+	}
+	g, err := s.Store.GetSCIMGroup(r.Context(), id)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load scim group")
+		return
+	}
+	jsonResponse(w, http.StatusOK, g)
+}
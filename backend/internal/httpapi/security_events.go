@@ -0,0 +1,90 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"talkie/backend/internal/db"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// recordPasswordReset keeps an audit record of a completed password reset
+// and emails the account about it, since whoever holds the mailbox may not
+// be who reset it. It runs after the response has been written.
+func (s *Server) recordPasswordReset(userID uuid.UUID, lc loginContext) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := s.Store.RecordSecurityEvent(ctx, db.SecurityEvent{UserID: &userID, Kind: "password_reset", IP: lc.IP, Country: lc.Country, UserAgent: lc.UserAgent})
+	if err != nil {
+		log.Printf("record password reset for %s: %v", userID, err)
+	}
+	u, err := s.Store.FindUserByID(ctx, userID)
+	if err != nil {
+		log.Printf("password reset notice: load user %s: %v", userID, err)
+		return
+	}
+	where := lc.IP
+	if lc.Country != "" {
+		where = fmt.Sprintf("%s (%s)", lc.IP, lc.Country)
+	}
+	summary := fmt.Sprintf("The password for your Talkie account was reset from %s using %s. All your sessions were signed out.", where, describeUserAgent(lc.UserAgent))
+	if err := s.sendPasswordResetNotice(u.Email, summary); err != nil {
+		log.Printf("send password reset notice failed: %v", err)
+	}
+}
+
+func (s *Server) sendPasswordResetNotice(to, summary string) error {
+	subject := "Your Talkie password was reset"
+	body := summary + "\n\nIf this was you, you can ignore this email. " +
+		"If not, reset your password again right away and check the email address on your account.\n"
+
+	if !s.Mailer.Enabled() {
+		log.Printf("password reset notice for %s: %s", to, summary)
+		return nil
+	}
+	return s.Mailer.Send(to, subject, body)
+}
+
+// listUserSecurityEvents shows an admin a user's recorded security actions,
+// newest first.
+func (s *Server) listUserSecurityEvents(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(chi.URLParam(r, "userID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	if _, err := s.Store.FindUserByID(r.Context(), userID); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to load user")
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	events, err := s.Store.ListSecurityEvents(r.Context(), userID, limit)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load security events")
+		return
+	}
+	jsonResponse(w, http.StatusOK, events)
+}
+
+// listSecurityEvents shows an admin the newest security events across the
+// instance, optionally only one ?kind=.
+func (s *Server) listSecurityEvents(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	events, err := s.Store.ListRecentSecurityEvents(r.Context(), r.URL.Query().Get("kind"), limit)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load security events")
+		return
+	}
+	jsonResponse(w, http.StatusOK, events)
+}
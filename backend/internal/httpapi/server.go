@@ -6,86 +6,455 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io/fs"
 	"log"
 	"math/big"
+	"net"
 	"net/http"
-	"net/smtp"
 	"strings"
 	"time"
 	"unicode/utf8"
 
+	"talkie/backend/internal/alttext"
+	"talkie/backend/internal/archive"
 	"talkie/backend/internal/auth"
+	"talkie/backend/internal/automod"
+	"talkie/backend/internal/billing"
+	"talkie/backend/internal/calls"
 	"talkie/backend/internal/config"
 	"talkie/backend/internal/db"
+	"talkie/backend/internal/errreport"
+	"talkie/backend/internal/geoip"
+	"talkie/backend/internal/history"
+	"talkie/backend/internal/jitsi"
+	"talkie/backend/internal/ldapauth"
+	"talkie/backend/internal/livekit"
+	"talkie/backend/internal/mailer"
+	"talkie/backend/internal/metrics"
 	"talkie/backend/internal/middleware"
+	"talkie/backend/internal/notify"
+	"talkie/backend/internal/nsfw"
+	"talkie/backend/internal/ratelimit"
+	"talkie/backend/internal/s3"
+	"talkie/backend/internal/slashcmd"
+	"talkie/backend/internal/sms"
+	"talkie/backend/internal/sso"
+	"talkie/backend/internal/storage"
+	"talkie/backend/internal/telemetry"
+	"talkie/backend/internal/waveform"
 	"talkie/backend/internal/ws"
 
 	"github.com/go-chi/chi/v5"
 )
 
 type Server struct {
-	Cfg   config.Config
-	Store *db.Store
-	Hub   *ws.Hub
+	Cfg      config.Config
+	Store    Store
+	Hub      *ws.Hub
+	Notifier *notify.Dispatcher
+	History  *history.Cache
+	Automod  *automod.Moderator
+	Mailer   *mailer.Mailer
+	// Geo is optional; without it logins are recorded with no country.
+	Geo *geoip.DB
+	// NSFW is optional; without it uploads are not classified.
+	NSFW *nsfw.Classifier
+	// AltText is optional; without it images posted without alt text
+	// keep none.
+	AltText *alttext.Describer
+	// Billing is optional; without it the Stripe webhook is not mounted.
+	Billing *billing.Stripe
+	// Uploads maps room regions to where their media is stored.
+	Uploads *storage.Locations
+	// S3 is optional; without it direct uploads are not mounted.
+	S3 *s3.Client
+	// Archive is optional; without it every message stays in Postgres.
+	Archive *archive.Archiver
+	// Waveform computes voice note waveforms; only WAV without ffmpeg.
+	Waveform *waveform.Analyzer
+	// Commands calls the webhooks behind rooms' slash commands.
+	Commands *slashcmd.Client
+	// Calls issues the tokens members join calls with.
+	Calls calls.Provider
+	// Errors is optional; without it panics are only logged.
+	Errors *errreport.Reporter
+	// SMS is optional; without it phone verification codes are logged.
+	SMS sms.Sender
+	// LDAP is optional; with it passwords are checked by the directory
+	// and none are stored.
+	LDAP *ldapauth.Directory
+	// Usage is nil unless telemetry is enabled; it counts endpoint calls
+	// for the usage report.
+	Usage *telemetry.Usage
+	// WebUI is the web client to serve at every path the API does not
+	// use; nil when it is hosted separately.
+	WebUI fs.FS
+
+	wsAccept *ratelimit.Bucket
+	apiRate  *ratelimit.Keyed
+
+	inviteJoins    *ratelimit.Keyed
+	joinSpikes     *joinVelocity
+	inviteGuesses  *inviteGuard
+	adminMails     *ratelimit.Keyed
+	commandRuns    *ratelimit.Keyed
+	embedRequests  *ratelimit.Keyed
+	embedStreams   *streamCounter
+	automationRuns *ratelimit.Keyed
+	repoHooks      *ratelimit.Keyed
+	phoneCodes     *ratelimit.Keyed
+	phoneLookups   *ratelimit.Keyed
+	ssoStarts      *ratelimit.Keyed
+	oidc           *sso.OIDC
 }
 
-func New(cfg config.Config, store *db.Store, hub *ws.Hub) *Server {
-	return &Server{Cfg: cfg, Store: store, Hub: hub}
+func New(cfg config.Config, store Store, hub *ws.Hub, notifier *notify.Dispatcher) *Server {
+	s := &Server{
+		Cfg:      cfg,
+		Store:    store,
+		Hub:      hub,
+		Notifier: notifier,
+		History:  history.NewCache(cfg.HistoryCacheRooms, cfg.HistoryCacheSize),
+		Automod:  automod.New(store),
+		NSFW:     nsfw.New(cfg.NSFWClassifierURL, float64(cfg.NSFWClassifierThreshold)/100),
+		AltText:  alttext.New(cfg.AltTextAPIURL, cfg.AltTextModel, cfg.AltTextAPIKey),
+		Billing:  billing.New(cfg.StripeWebhookSecret, cfg.StripePricePlans),
+		Uploads:  storage.New(cfg.UploadsDir, cfg.RegionUploadDirs),
+		Waveform: waveform.New(cfg.FFmpegPath),
+		Commands: slashcmd.New(cfg.SlashCommandsAllowPrivate),
+		Calls:    callProvider(cfg),
+		S3: s3.New(s3.Config{
+			Bucket:    cfg.S3Bucket,
+			Region:    cfg.S3Region,
+			Endpoint:  cfg.S3Endpoint,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			PublicURL: cfg.S3PublicURL,
+		}),
+		Mailer:   mailer.New(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUser, cfg.SMTPPass, cfg.SMTPFrom),
+		wsAccept: ratelimit.NewBucket(float64(cfg.WSAcceptRate), cfg.WSAcceptBurst),
+		apiRate:  ratelimit.NewKeyed(float64(cfg.APIRateLimit), cfg.APIRateBurst),
+
+		inviteJoins:    ratelimit.NewKeyed(float64(cfg.InviteJoinsPerMinute)/60, cfg.InviteJoinsPerMinute),
+		joinSpikes:     newJoinVelocity(cfg.JoinSpikeThreshold),
+		inviteGuesses:  newInviteGuard(cfg.InviteGuessLimit),
+		adminMails:     ratelimit.NewKeyed(1/adminMailInterval.Seconds(), 1),
+		commandRuns:    ratelimit.NewKeyed(float64(commandRunsPerMinute)/60, commandRunsPerMinute),
+		embedRequests:  ratelimit.NewKeyed(float64(cfg.EmbedRequestsPerMinute)/60, cfg.EmbedRequestsPerMinute),
+		embedStreams:   newStreamCounter(),
+		automationRuns: ratelimit.NewKeyed(float64(automationActionsPerMinute)/60, automationActionsPerMinute),
+		repoHooks:      ratelimit.NewKeyed(float64(repoHooksPerMinute)/60, repoHooksPerMinute),
+		phoneCodes:     ratelimit.NewKeyed(float64(phoneCodesPerHour)/3600, phoneCodesPerHour),
+		phoneLookups:   ratelimit.NewKeyed(float64(phoneLookupsPerHour)/3600, phoneLookupsPerHour),
+		ssoStarts:      ratelimit.NewKeyed(float64(ssoStartsPerMinute)/60, ssoStartsPerMinute),
+		oidc:           sso.NewOIDC(),
+	}
+	s.Automod.SetMaskWords(cfg.ProfanityWords)
+	s.Automod.SetDictionaryDir(cfg.ModerationDictionaryDir)
+	hub.SetPresenceHandler(s.presenceChanged)
+	return s
+}
+
+// callProvider returns the SFU cfg.CallProvider names.
+func callProvider(cfg config.Config) calls.Provider {
+	if cfg.CallProvider == "jitsi" {
+		return jitsi.New(cfg.JitsiURL, cfg.JitsiAppID, cfg.JitsiAppSecret)
+	}
+	return livekit.New(cfg.LiveKitAPIKey, cfg.LiveKitAPISecret, cfg.LiveKitURL, cfg.RegionLiveKitURLs)
 }
 
 func (s *Server) Routes() http.Handler {
 	r := chi.NewRouter()
+	r.Use(s.corsPolicies, middleware.RequestID, middleware.Recover(s.Errors.Panic), s.countRoutes)
 
 	r.Get("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
 	})
-	r.Handle("/uploads/*", http.StripPrefix("/uploads/", http.FileServer(http.Dir(s.Cfg.UploadsDir))))
+	r.Handle("/metrics", s.metricsHandler())
+	r.Handle("/uploads/regions/{region}/*", http.HandlerFunc(s.serveRegionUpload))
+	r.Handle("/uploads/*", http.StripPrefix("/uploads/", s.uploadsHandler(s.Uploads.Default())))
+	if s.S3 != nil && s.Cfg.S3SignedURLTTLS > 0 {
+		r.Get(s3MediaPrefix+"*", s.redirectS3Media)
+	}
 
 	r.Route("/api", func(r chi.Router) {
+		if s.Cfg.CompressionEnabled {
+			r.Use(middleware.Compress(s.Cfg.CompressionLevel, s.Cfg.CompressionMinBytes))
+		}
 		r.Post("/auth/register", s.register)
 		r.Post("/auth/login", s.login)
 		r.Post("/auth/verify-email", s.verifyEmail)
 		r.Post("/auth/resend-verification", s.resendVerification)
 		r.Post("/auth/forgot-password", s.forgotPassword)
 		r.Post("/auth/reset-password", s.resetPassword)
+		r.Post("/auth/confirm-email-change", s.confirmEmailChange)
+		r.Post("/auth/revert-email-change", s.revertEmailChange)
+
+		r.Post("/auth/guest", s.joinAsGuest)
+		r.Post("/auth/link/{code}", s.pollDeviceLink)
+		r.Post("/auth/sso", s.exchangeSSOCode)
+		r.Get("/sso/{groupID}", s.getSSOLogin)
+		r.Get("/sso/{groupID}/login", s.startSSOLogin)
+		r.Get("/sso/{groupID}/saml/metadata", s.samlMetadata)
+		r.Get("/sso/oidc/callback", s.oidcCallback)
+		r.Post("/sso/saml/acs", s.samlACS)
+		r.Get("/invite-links/{token}/preview", s.previewInviteLink)
+		r.Get("/embed/{token}/messages", s.embedMessages)
+		r.Get("/embed/{token}/stream", s.embedStream)
+		r.Post("/hooks/{provider}/{linkID}", s.repoWebhook)
+		r.Get("/status", s.statusPage)
+		r.Get("/instance", s.getInstance)
+		r.Get("/time", s.getTime)
+		r.Get("/setup", s.getSetup)
+		r.Post("/setup", s.completeSetup)
+		if s.Billing != nil {
+			r.Post("/billing/stripe/webhook", s.stripeWebhook)
+		}
+		if s.Cfg.SCIMEnabled {
+			r.Route("/scim/v2", func(r chi.Router) {
+				r.Use(s.scimAuth)
+				r.Get("/ServiceProviderConfig", s.scimServiceProviderConfig)
+				r.Get("/ResourceTypes", s.scimResourceTypes)
+				r.Get("/Users", s.scimListUsers)
+				r.Post("/Users", s.scimCreateUser)
+				r.Get("/Users/{scimUserID}", s.scimGetUser)
+				r.Put("/Users/{scimUserID}", s.scimReplaceUser)
+				r.Patch("/Users/{scimUserID}", s.scimPatchUser)
+				r.Delete("/Users/{scimUserID}", s.scimDeleteUser)
+				r.Get("/Groups", s.scimListGroups)
+				r.Post("/Groups", s.scimCreateGroup)
+				r.Get("/Groups/{scimGroupID}", s.scimGetGroup)
+				r.Put("/Groups/{scimGroupID}", s.scimReplaceGroup)
+				r.Patch("/Groups/{scimGroupID}", s.scimPatchGroup)
+				r.Delete("/Groups/{scimGroupID}", s.scimDeleteGroup)
+			})
+		}
 
 		r.Group(func(r chi.Router) {
-			r.Use(middleware.Auth(s.Cfg.JWTSecret))
+			r.Use(middleware.Auth(s.sessionVersion, s.Cfg.JWTVerificationSecrets()...))
+			r.Use(middleware.RateLimit(s.apiRate))
 			r.Get("/me", s.me)
+			r.Get("/profile-fields", s.listProfileFields)
+			r.Get("/bootstrap", s.bootstrap)
+			r.Get("/sync", s.sync)
+			r.Get("/me/logins", s.listLoginEvents)
+			r.Get("/notifications", s.listNotifications)
+			r.Post("/notifications/{notificationID}/read", s.markNotificationRead)
+			r.Get("/ws/endpoint", s.wsEndpoint)
+			r.Get("/rtc/ice-servers", s.listICEServers)
 			r.Post("/me/avatar", s.uploadMyAvatar)
+			r.Get("/me/mentions", s.listMyMentions)
+			r.Get("/me/subscriptions", s.listMySubscriptions)
+			r.Get("/me/keywords", s.getMyKeywords)
+			r.Put("/me/keywords", s.setMyKeywords)
+			r.Get("/me/rich-presence", s.listMyRichPresence)
+			r.Put("/me/rich-presence/{source}", s.setRichPresence)
+			r.Delete("/me/rich-presence/{source}", s.clearRichPresence)
+			r.Get("/me/board", s.listBoard)
+			r.Post("/me/board", s.addBoardItem)
+			r.Put("/me/board/order", s.reorderBoard)
+			r.Patch("/me/board/{itemID}", s.updateBoardItem)
+			r.Delete("/me/board/{itemID}", s.deleteBoardItem)
+			r.Get("/me/quota", s.getMyQuota)
+			r.Get("/me/age", s.getMyAge)
+			r.Get("/me/billing", s.getMyBilling)
+			r.Get("/me/content-settings", s.getContentSettings)
+			r.Put("/me/content-settings", s.setContentSettings)
+			r.Get("/me/notification-settings", s.getNotificationSettings)
+			r.Put("/me/notification-settings", s.setNotificationSettings)
 			r.Get("/rooms", s.listRooms)
-			r.Post("/rooms", s.createRoom)
-			r.Post("/rooms/{roomID}/join", s.joinRoom)
 			r.Patch("/rooms/{roomID}", s.renameRoom)
 			r.Delete("/rooms/{roomID}", s.deleteRoom)
 			r.Post("/rooms/{roomID}/leave", s.leaveRoom)
-			r.Post("/rooms/{roomID}/invite", s.inviteToRoom)
-			r.Post("/rooms/{roomID}/invite-link", s.createRoomInviteLink)
 			r.Get("/rooms/{roomID}/messages", s.listMessages)
+			r.Post("/rooms/{roomID}/messages", s.sendMessage)
+			r.Post("/rooms/{roomID}/contact", s.sendContact)
+			r.Post("/rooms/{roomID}/messages/batch", s.postMessageBatch)
+			r.Get("/rooms/{roomID}/messages/search", s.searchMessages)
+			r.Get("/rooms/{roomID}/messages/around", s.getMessagesAroundDate)
+			r.Get("/rooms/{roomID}/activity", s.getRoomActivity)
+			r.Get("/rooms/{roomID}/messages/{messageID}", s.getMessageWithContext)
+			r.Post("/rooms/{roomID}/messages/{messageID}/interactions", s.interactWithMessage)
+			r.Put("/rooms/{roomID}/messages/{messageID}/alt-text", s.setMessageAltText)
+			r.Get("/rooms/{roomID}/media", s.listRoomMedia)
+			r.Get("/rooms/{roomID}/members", s.listRoomMembers)
+			r.Get("/rooms/{roomID}/state", s.getRoomState)
+			r.Get("/rooms/{roomID}/events", s.listRoomEvents)
+			r.Get("/rooms/{roomID}/membership-log", s.listMembershipLog)
+			r.Get("/rooms/{roomID}/invite-links", s.listInviteLinks)
+			r.Get("/rooms/{roomID}/welcome", s.getRoomWelcome)
+			r.Put("/rooms/{roomID}/welcome", s.setRoomWelcome)
+			r.Get("/rooms/{roomID}/mention-policy", s.getRoomMentionPolicy)
+			r.Put("/rooms/{roomID}/mention-policy", s.setRoomMentionPolicy)
+			r.Get("/rooms/{roomID}/automod/rules", s.listAutomodRules)
+			r.Post("/rooms/{roomID}/automod/rules", s.createAutomodRule)
+			r.Put("/rooms/{roomID}/automod/rules/{ruleID}", s.updateAutomodRule)
+			r.Delete("/rooms/{roomID}/automod/rules/{ruleID}", s.deleteAutomodRule)
+			r.Get("/rooms/{roomID}/automod/events", s.listAutomodEvents)
+			r.Delete("/rooms/{roomID}/automod/mutes/{userID}", s.unmuteRoomMember)
+			r.Get("/rooms/{roomID}/nsfw", s.getRoomNSFW)
+			r.Put("/rooms/{roomID}/nsfw", s.setRoomNSFW)
+			r.Get("/rooms/{roomID}/language", s.getRoomLanguage)
+			r.Put("/rooms/{roomID}/language", s.setRoomLanguage)
+			r.Get("/rooms/{roomID}/call-chat", s.getCallChatSettings)
+			r.Put("/rooms/{roomID}/call-chat", s.setCallChatSettings)
+			r.Post("/rooms/{roomID}/call-feedback", s.submitCallFeedback)
+			r.Get("/rooms/{roomID}/region", s.getRoomRegion)
+			r.Put("/rooms/{roomID}/region", s.setRoomRegion)
+			r.Get("/rooms/{roomID}/raid-mode", s.getRoomRaidMode)
+			r.Put("/rooms/{roomID}/raid-mode", s.setRoomRaidMode)
+			r.Get("/rooms/{roomID}/unlisted", s.getRoomUnlisted)
+			r.Put("/rooms/{roomID}/unlisted", s.setRoomUnlisted)
+			r.Get("/rooms/{roomID}/embed", s.getRoomEmbed)
+			r.Post("/rooms/{roomID}/embed", s.createRoomEmbed)
+			r.Delete("/rooms/{roomID}/embed", s.deleteRoomEmbed)
+			r.Get("/rooms/{roomID}/broadcast", s.getRoomBroadcast)
+			r.Put("/rooms/{roomID}/broadcast", s.setRoomBroadcast)
+			r.Delete("/rooms/{roomID}/subscription", s.unsubscribeRoom)
+			r.Get("/rooms/{roomID}/word-mask", s.getRoomWordMask)
+			r.Put("/rooms/{roomID}/word-mask", s.setRoomWordMask)
+			r.Get("/rooms/{roomID}/media-policy", s.getRoomMediaPolicy)
+			r.Put("/rooms/{roomID}/media-policy", s.setRoomMediaPolicy)
+			r.Get("/rooms/{roomID}/commands", s.listRoomCommands)
+			r.Post("/rooms/{roomID}/commands", s.createRoomCommand)
+			r.Delete("/rooms/{roomID}/commands/{name}", s.deleteRoomCommand)
+			r.Get("/rooms/{roomID}/repos", s.listRepoLinks)
+			r.Post("/rooms/{roomID}/repos", s.createRepoLink)
+			r.Patch("/rooms/{roomID}/repos/{linkID}", s.updateRepoLink)
+			r.Delete("/rooms/{roomID}/repos/{linkID}", s.deleteRepoLink)
+			r.Get("/rooms/{roomID}/join-requests", s.listJoinRequests)
+			r.Post("/rooms/{roomID}/join-requests/{userID}/approve", s.approveJoinRequest)
+			r.Delete("/rooms/{roomID}/join-requests/{userID}", s.rejectJoinRequest)
+			r.Post("/rooms/{roomID}/read", s.markRoomRead)
 			r.Get("/rooms/{roomID}/call-participants", s.listCallParticipants)
 			r.Post("/rooms/{roomID}/images", s.uploadRoomImage)
+			r.Post("/rooms/{roomID}/voice", s.uploadVoiceNote)
+			if s.S3 != nil {
+				r.Post("/rooms/{roomID}/uploads/presign", s.presignUpload)
+				r.Post("/rooms/{roomID}/uploads/complete", s.completeUpload)
+			}
 			r.Post("/rooms/{roomID}/livekit-token", s.liveKitToken)
+			r.Post("/rooms/{roomID}/call-token", s.callToken)
 			r.Get("/groups", s.listGroups)
-			r.Post("/groups", s.createGroup)
-			r.Patch("/groups/{groupID}", s.renameGroup)
-			r.Post("/groups/{groupID}/channels", s.createGroupChannel)
-			r.Get("/users/search", s.searchUsers)
 			r.Get("/users/{userID}/profile", s.userProfile)
 			r.Get("/friends", s.listFriends)
-			r.Post("/friends/requests", s.sendFriendRequest)
-			r.Post("/friends/requests/{requestID}/accept", s.acceptFriendRequest)
-			r.Post("/friends/requests/{requestID}/decline", s.declineFriendRequest)
-			r.Post("/friends/invite-link", s.createFriendInviteLink)
-			r.Post("/friends/invite-links/{token}/accept", s.acceptFriendInviteLink)
 			r.Get("/dm/rooms", s.listDMRooms)
-			r.Post("/dm/rooms", s.createOrGetDMRoom)
-			r.Post("/invite-links/{token}/join", s.joinByInviteLink)
+			r.Get("/permalinks/{roomID}/{messageID}", s.resolvePermalink)
+			r.Post("/push/devices", s.registerPushDevice)
+			r.Delete("/push/devices/{token}", s.unregisterPushDevice)
+
+			// Guests stay in the room they were invited to: no account
+			// settings, joining or creating rooms, inviting, or contacting
+			// other users.
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.DenyGuests)
+				r.Patch("/me", s.updateMe)
+				r.Post("/me/password", s.changePassword)
+				r.Get("/me/email", s.getEmailChange)
+				r.Post("/me/email", s.requestEmailChange)
+				r.Delete("/me/email/pending", s.cancelEmailChange)
+				r.Get("/me/phone", s.getPhone)
+				r.Post("/me/phone", s.startPhoneVerification)
+				r.Post("/me/phone/verify", s.verifyPhone)
+				r.Delete("/me/phone", s.deletePhone)
+				r.Put("/me/phone/alerts", s.setSMSAlerts)
+				r.Put("/me/phone/discoverable", s.setPhoneDiscoverable)
+				r.Post("/contacts/lookup", s.lookupContacts)
+				r.Post("/me/device-links", s.createDeviceLink)
+				r.Get("/me/device-links/{code}", s.getDeviceLink)
+				r.Post("/me/device-links/{code}/approve", s.approveDeviceLink)
+				r.Delete("/me/device-links/{code}", s.deleteDeviceLink)
+				r.Post("/rooms", s.createRoom)
+				r.Post("/rooms/{roomID}/clone", s.cloneRoom)
+				r.Post("/rooms/{roomID}/join", s.joinRoom)
+				r.Post("/rooms/{roomID}/subscription", s.subscribeRoom)
+				r.Post("/rooms/{roomID}/invite", s.inviteToRoom)
+				r.Post("/rooms/{roomID}/invite-link", s.createRoomInviteLink)
+				r.Post("/rooms/{roomID}/guest-links", s.createGuestLink)
+				r.Get("/rooms/{roomID}/transfer-ownership", s.getOwnershipTransfer)
+				r.Post("/rooms/{roomID}/transfer-ownership", s.transferOwnership)
+				r.Post("/rooms/{roomID}/transfer-ownership/accept", s.acceptOwnershipTransfer)
+				r.Delete("/rooms/{roomID}/transfer-ownership", s.cancelOwnershipTransfer)
+				r.Post("/groups", s.createGroup)
+				r.Patch("/groups/{groupID}", s.renameGroup)
+				r.Post("/groups/{groupID}/channels", s.createGroupChannel)
+				r.Get("/groups/{groupID}/sso", s.getWorkspaceSSO)
+				r.Put("/groups/{groupID}/sso", s.putWorkspaceSSO)
+				r.Delete("/groups/{groupID}/sso", s.deleteWorkspaceSSO)
+				r.Post("/groups/{groupID}/sso/link", s.linkWorkspaceSSO)
+				r.Get("/users/search", s.searchUsers)
+				r.Post("/friends/requests", s.sendFriendRequest)
+				r.Post("/friends/requests/{requestID}/accept", s.acceptFriendRequest)
+				r.Post("/friends/requests/{requestID}/decline", s.declineFriendRequest)
+				r.Post("/friends/invite-link", s.createFriendInviteLink)
+				r.Post("/friends/invite-links/{token}/accept", s.acceptFriendInviteLink)
+				r.Post("/dm/rooms", s.createOrGetDMRoom)
+				r.Get("/automations", s.listAutomations)
+				r.Post("/automations", s.createAutomation)
+				r.Get("/automations/{automationID}", s.getAutomation)
+				r.Patch("/automations/{automationID}", s.updateAutomation)
+				r.Delete("/automations/{automationID}", s.deleteAutomation)
+				r.Get("/automations/{automationID}/runs", s.listAutomationRuns)
+				r.Post("/invite-links/{token}/join", s.joinByInviteLink)
+
+				r.Route("/admin", func(r chi.Router) {
+					r.Use(s.requireAdmin)
+					r.Put("/users/{userID}/shadow-ban", s.setShadowBan)
+					r.Get("/users/{userID}/age", s.getUserAge)
+					r.Get("/users/{userID}/security-events", s.listUserSecurityEvents)
+					r.Get("/security-events", s.listSecurityEvents)
+					r.Get("/users/{userID}/messages/export", s.exportUserMessages)
+					r.Get("/rooms/{roomID}/messages/export", s.exportRoomMessages)
+					r.Put("/users/{userID}/age", s.setUserAge)
+					r.Put("/profile-fields/{key}", s.putProfileField)
+					r.Delete("/profile-fields/{key}", s.deleteProfileField)
+					r.Get("/stats/calls", s.callFeedbackStats)
+					r.Get("/rooms/sizes", s.listRoomSizes)
+					r.Get("/rooms/{roomID}/size", s.getRoomSize)
+					r.Get("/plans", s.listPlans)
+					r.Put("/plans/{plan}", s.putPlan)
+					r.Delete("/plans/{plan}", s.deletePlan)
+					r.Put("/users/{userID}/plan", s.setUserPlan)
+					r.Put("/groups/{groupID}/plan", s.setGroupPlan)
+					r.Get("/sso", s.listWorkspaceSSO)
+					r.Put("/groups/{groupID}/sso", s.setWorkspaceSSOApproval)
+					if s.Cfg.SCIMEnabled {
+						r.Get("/scim/tokens", s.listSCIMTokens)
+						r.Post("/scim/tokens", s.createSCIMToken)
+						r.Delete("/scim/tokens/{tokenID}", s.deleteSCIMToken)
+						r.Get("/scim/groups", s.listSCIMGroups)
+						r.Put("/scim/groups/{scimGroupID}", s.setSCIMGroupTarget)
+					}
+					r.Get("/legal-holds", s.listLegalHolds)
+					r.Post("/legal-holds", s.placeLegalHold)
+					r.Post("/legal-holds/{holdID}/release", s.releaseLegalHold)
+					r.Get("/monitors", s.listUptimeMonitors)
+					r.Post("/monitors", s.createUptimeMonitor)
+					r.Patch("/monitors/{monitorID}", s.updateUptimeMonitor)
+					r.Delete("/monitors/{monitorID}", s.deleteUptimeMonitor)
+					r.Get("/moderation/dictionaries", s.listModerationDictionaries)
+					r.Post("/moderation/dictionaries", s.createModerationDictionary)
+					r.Get("/moderation/dictionaries/{dictionaryID}", s.getModerationDictionary)
+					r.Put("/moderation/dictionaries/{dictionaryID}", s.updateModerationDictionary)
+					r.Delete("/moderation/dictionaries/{dictionaryID}", s.deleteModerationDictionary)
+					r.Post("/moderation/test", s.testModeration)
+					r.Mount("/debug", s.DebugRoutes())
+				})
+			})
 		})
 	})
 
 	r.Get("/ws/rooms/{roomID}", s.roomWebSocket)
 	r.Get("/ws/events", s.eventsWebSocket)
+	r.Get("/ws/user", s.userWebSocket)
 
+	if s.WebUI != nil {
+		webUI := http.Handler(http.HandlerFunc(s.serveWebUI))
+		if s.Cfg.CompressionEnabled {
+			webUI = middleware.Compress(s.Cfg.CompressionLevel, s.Cfg.CompressionMinBytes)(webUI)
+		}
+		r.NotFound(webUI.ServeHTTP)
+	}
 	return r
 }
 
@@ -93,6 +462,13 @@ type authRequest struct {
 	Email    string `json:"email"`
 	Username string `json:"username,omitempty"`
 	Password string `json:"password"`
+	// DateOfBirth (YYYY-MM-DD) is only read at registration, when the age
+	// gate is on.
+	DateOfBirth string `json:"date_of_birth,omitempty"`
+	// Timezone and Locale are optional hints the client sends at
+	// registration.
+	Timezone string `json:"timezone,omitempty"`
+	Locale   string `json:"locale,omitempty"`
 }
 
 type authResponse struct {
@@ -102,6 +478,16 @@ type authResponse struct {
 }
 
 func (s *Server) register(w http.ResponseWriter, r *http.Request) {
+	if s.ldapManaged(w) || s.setupPending(w, r) {
+		return
+	}
+	if s.instanceSettings(r.Context()).Registration == "closed" {
+		jsonResponse(w, http.StatusForbidden, map[string]string{
+			"error": "registration is closed on this server",
+			"code":  "registration_closed",
+		})
+		return
+	}
 	var req authRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		jsonError(w, http.StatusBadRequest, "invalid request body")
@@ -121,6 +507,18 @@ func (s *Server) register(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusBadRequest, "username must be at most 15 characters")
 		return
 	}
+	dob, ok := s.registrationDateOfBirth(w, strings.TrimSpace(req.DateOfBirth))
+	if !ok {
+		return
+	}
+	// A bad hint is dropped rather than failing the sign-up.
+	locale := db.UserLocale{Timezone: strings.TrimSpace(req.Timezone), Locale: strings.TrimSpace(req.Locale)}
+	if checkTimezone(locale.Timezone) != nil {
+		locale.Timezone = ""
+	}
+	if checkLocale(locale.Locale) != nil {
+		locale.Locale = ""
+	}
 
 	hash, err := auth.HashPassword(req.Password)
 	if err != nil {
@@ -133,6 +531,22 @@ func (s *Server) register(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusConflict, "user already exists")
 		return
 	}
+	if dob != nil {
+		if err := s.Store.SetUserDateOfBirth(r.Context(), u.ID, dob); err != nil {
+			jsonError(w, http.StatusInternalServerError, "failed to save date of birth")
+			return
+		}
+	}
+	if locale != (db.UserLocale{}) {
+		if err := s.Store.SetUserLocale(r.Context(), u.ID, locale); err != nil {
+			log.Printf("save locale for %s: %v", u.ID, err)
+		}
+	}
+	// Registration's code counts against the hourly cap, so resends right
+	// after sign-up are capped too. It is never refused: the window is new.
+	if _, _, err := s.Store.AllowVerificationEmail(r.Context(), u.ID, s.Cfg.VerifyEmailsPerHour); err != nil {
+		log.Printf("count verification email for %s: %v", u.ID, err)
+	}
 	verifyCode, err := randomDigits(6)
 	if err != nil {
 		jsonError(w, http.StatusInternalServerError, "failed to create verification code")
@@ -161,6 +575,10 @@ func (s *Server) login(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusBadRequest, "email and password are required")
 		return
 	}
+	if s.LDAP != nil {
+		s.ldapLogin(w, r, req.Email, req.Password)
+		return
+	}
 
 	u, err := s.Store.FindUserByEmail(r.Context(), req.Email)
 	if err != nil {
@@ -171,6 +589,9 @@ func (s *Server) login(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusUnauthorized, "invalid credentials")
 		return
 	}
+	if s.ssoRequired(w, r, u.ID) || s.accountDeactivated(w, r, u.ID) {
+		return
+	}
 	if !u.EmailVerified {
 		jsonResponse(w, http.StatusForbidden, map[string]any{
 			"error":                       "email is not verified",
@@ -179,12 +600,14 @@ func (s *Server) login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := auth.GenerateJWT(s.Cfg.JWTSecret, u.ID, u.Username)
+	token, err := s.issueToken(r.Context(), u, u.SessionVersion)
 	if err != nil {
 		jsonError(w, http.StatusInternalServerError, "failed to generate token")
 		return
 	}
 
+	go s.recordLogin(u, s.loginContextFromRequest(r))
+
 	u.PasswordHash = ""
 	jsonResponse(w, http.StatusOK, authResponse{Token: token, User: u})
 }
@@ -204,20 +627,35 @@ func (s *Server) verifyEmail(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusBadRequest, "email and code are required")
 		return
 	}
-	u, err := s.Store.VerifyUserByEmailAndTokenHash(r.Context(), req.Email, tokenHash(req.Code))
-	if err != nil {
-		if err == db.ErrNotFound {
-			jsonError(w, http.StatusBadRequest, "invalid or expired verification code")
-			return
+	u, left, err := s.Store.VerifyEmailCode(r.Context(), req.Email, tokenHash(req.Code), s.Cfg.VerifyMaxAttempts)
+	switch {
+	case err == db.ErrNotFound:
+		jsonError(w, http.StatusBadRequest, "invalid or expired verification code")
+		return
+	case err == db.ErrCodeMismatch:
+		resp := map[string]any{"error": "invalid or expired verification code", "code": "invalid_code"}
+		if s.Cfg.VerifyMaxAttempts > 0 {
+			resp["attempts_remaining"] = left
 		}
+		jsonResponse(w, http.StatusBadRequest, resp)
+		return
+	case err == db.ErrTooManyAttempts:
+		jsonResponse(w, http.StatusTooManyRequests, map[string]any{
+			"error":              "too many wrong codes, request a new one",
+			"code":               "too_many_attempts",
+			"attempts_remaining": 0,
+		})
+		return
+	case err != nil:
 		jsonError(w, http.StatusInternalServerError, "failed to verify email")
 		return
 	}
-	token, err := auth.GenerateJWT(s.Cfg.JWTSecret, u.ID, u.Username)
+	token, err := s.issueToken(r.Context(), u, u.SessionVersion)
 	if err != nil {
 		jsonError(w, http.StatusInternalServerError, "failed to generate token")
 		return
 	}
+	go s.recordLogin(u, s.loginContextFromRequest(r))
 	u.PasswordHash = ""
 	jsonResponse(w, http.StatusOK, authResponse{Token: token, User: u})
 }
@@ -238,6 +676,15 @@ func (s *Server) resendVerification(w http.ResponseWriter, r *http.Request) {
 
 	u, err := s.Store.FindUserByEmail(r.Context(), req.Email)
 	if err == nil && !u.EmailVerified {
+		allowed, wait, limitErr := s.Store.AllowVerificationEmail(r.Context(), u.ID, s.Cfg.VerifyEmailsPerHour)
+		if limitErr != nil {
+			jsonError(w, http.StatusInternalServerError, "failed to send verification code")
+			return
+		}
+		if !allowed {
+			verificationEmailLimited(w, wait)
+			return
+		}
 		verifyCode, codeErr := randomDigits(6)
 		if codeErr != nil {
 			jsonError(w, http.StatusInternalServerError, "failed to create verification code")
@@ -256,6 +703,9 @@ func (s *Server) resendVerification(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	if s.ldapManaged(w) {
+		return
+	}
 	var req struct {
 		Email string `json:"email"`
 	}
@@ -288,6 +738,9 @@ func (s *Server) forgotPassword(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) resetPassword(w http.ResponseWriter, r *http.Request) {
+	if s.ldapManaged(w) {
+		return
+	}
 	var req struct {
 		Token       string `json:"token"`
 		NewPassword string `json:"new_password"`
@@ -306,17 +759,79 @@ func (s *Server) resetPassword(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusInternalServerError, "failed to hash password")
 		return
 	}
-	if err := s.Store.ResetPasswordByTokenHash(r.Context(), tokenHash(req.Token), hash); err != nil {
-		if err == db.ErrNotFound {
+	userID, err := s.Store.ResetPasswordByTokenHash(r.Context(), tokenHash(req.Token), hash)
+	if err != nil {
+		switch err {
+		case db.ErrNotFound:
 			jsonError(w, http.StatusBadRequest, "invalid or expired reset token")
-			return
+		case db.ErrTokenUsed:
+			jsonResponse(w, http.StatusBadRequest, map[string]string{
+				"error": "this reset link has already been used",
+				"code":  "token_used",
+			})
+		default:
+			jsonError(w, http.StatusInternalServerError, "failed to reset password")
 		}
-		jsonError(w, http.StatusInternalServerError, "failed to reset password")
 		return
 	}
+	s.Hub.RevokeSessions(userID, 0)
+	go s.recordPasswordReset(userID, s.loginContextFromRequest(r))
 	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
 }
 
+// changePassword replaces the password of the signed-in user. Every other
+// session is revoked; the caller gets a fresh token so it stays signed in.
+func (s *Server) changePassword(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	if s.ldapManaged(w) {
+		return
+	}
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if len(req.NewPassword) < 6 {
+		jsonError(w, http.StatusBadRequest, "password must be at least 6 characters")
+		return
+	}
+	u, err := s.Store.FindUserByID(r.Context(), user.ID)
+	if err != nil {
+		jsonError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if err := auth.VerifyPassword(u.PasswordHash, req.CurrentPassword); err != nil {
+		jsonError(w, http.StatusForbidden, "current password is incorrect")
+		return
+	}
+	hash, err := auth.HashPassword(req.NewPassword)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to hash password")
+		return
+	}
+	version, err := s.Store.ChangePassword(r.Context(), u.ID, hash)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to change password")
+		return
+	}
+	token, err := s.issueToken(r.Context(), u, version)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to generate token")
+		return
+	}
+	s.Hub.RevokeSessions(u.ID, version)
+
+	u.PasswordHash = ""
+	jsonResponse(w, http.StatusOK, authResponse{Token: token, User: u})
+}
+
 func (s *Server) me(w http.ResponseWriter, r *http.Request) {
 	user, ok := middleware.UserFromContext(r.Context())
 	if !ok {
@@ -329,7 +844,27 @@ func (s *Server) me(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	u.PasswordHash = ""
-	jsonResponse(w, http.StatusOK, u)
+	fields, err := s.visibleProfile(r.Context(), u.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load profile")
+		return
+	}
+	locale, err := s.Store.GetUserLocale(r.Context(), u.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load locale")
+		return
+	}
+	sharing, err := s.Store.GetContactSharing(r.Context(), u.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load contact sharing")
+		return
+	}
+	jsonResponse(w, http.StatusOK, struct {
+		db.User
+		db.UserLocale
+		Profile        map[string]string `json:"profile"`
+		ContactSharing string            `json:"contact_sharing"`
+	}{u, locale, fields, sharing})
 }
 
 func (s *Server) searchUsers(w http.ResponseWriter, r *http.Request) {
@@ -338,6 +873,15 @@ func (s *Server) searchUsers(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusUnauthorized, "unauthorized")
 		return
 	}
+	restricted, err := s.isRestricted(r.Context(), user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load user")
+		return
+	}
+	if restricted {
+		jsonError(w, http.StatusForbidden, "user search is not available to restricted accounts")
+		return
+	}
 	q := strings.TrimSpace(r.URL.Query().Get("q"))
 	if q == "" {
 		jsonResponse(w, http.StatusOK, []db.Friend{})
@@ -351,6 +895,19 @@ func (s *Server) searchUsers(w http.ResponseWriter, r *http.Request) {
 	jsonResponse(w, http.StatusOK, users)
 }
 
+// metricsHandler exposes the metrics registry, optionally behind a static
+// bearer token so scrapers can reach it while the public cannot.
+func (s *Server) metricsHandler() http.Handler {
+	h := metrics.Handler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.Cfg.MetricsToken != "" && r.Header.Get("Authorization") != "Bearer "+s.Cfg.MetricsToken {
+			jsonError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
 func jsonResponse(w http.ResponseWriter, status int, payload any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -361,6 +918,27 @@ func jsonError(w http.ResponseWriter, status int, msg string) {
 	jsonResponse(w, status, map[string]string{"error": msg})
 }
 
+// clientIP returns the caller's address, honouring X-Forwarded-For only when
+// the server is configured to sit behind a trusted reverse proxy.
+func (s *Server) clientIP(r *http.Request) string {
+	if s.Cfg.TrustProxyHeaders {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			first, _, _ := strings.Cut(fwd, ",")
+			if ip := strings.TrimSpace(first); ip != "" {
+				return ip
+			}
+		}
+		if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 func randomToken(n int) (string, error) {
 	buf := make([]byte, n)
 	if _, err := rand.Read(buf); err != nil {
@@ -394,22 +972,12 @@ func tokenHash(token string) string {
 func (s *Server) sendVerificationEmail(to, code string) error {
 	subject := "Talkie email verification code"
 	body := fmt.Sprintf("Your Talkie verification code is: %s\n\nThe code expires in 24 hours.\n", code)
-	message := []byte("From: " + s.Cfg.SMTPFrom + "\r\n" +
-		"To: " + to + "\r\n" +
-		"Subject: " + subject + "\r\n\r\n" +
-		body)
 
-	if s.Cfg.SMTPHost == "" || s.Cfg.SMTPPort == 0 || s.Cfg.SMTPFrom == "" {
+	if !s.Mailer.Enabled() {
 		log.Printf("verification code for %s: %s", to, code)
 		return nil
 	}
-
-	addr := fmt.Sprintf("%s:%d", s.Cfg.SMTPHost, s.Cfg.SMTPPort)
-	var auth smtp.Auth
-	if s.Cfg.SMTPUser != "" {
-		auth = smtp.PlainAuth("", s.Cfg.SMTPUser, s.Cfg.SMTPPass, s.Cfg.SMTPHost)
-	}
-	return smtp.SendMail(addr, auth, s.Cfg.SMTPFrom, []string{to}, message)
+	return s.Mailer.Send(to, subject, body)
 }
 
 func (s *Server) sendPasswordResetEmail(to, token string) error {
@@ -420,19 +988,10 @@ func (s *Server) sendPasswordResetEmail(to, token string) error {
 	resetURL := fmt.Sprintf("%s/reset-password?token=%s", frontendBase, token)
 	subject := "Talkie password reset"
 	body := fmt.Sprintf("Open this link to reset your Talkie password:\n\n%s\n\nThe link expires in 2 hours.\n", resetURL)
-	message := []byte("From: " + s.Cfg.SMTPFrom + "\r\n" +
-		"To: " + to + "\r\n" +
-		"Subject: " + subject + "\r\n\r\n" +
-		body)
 
-	if s.Cfg.SMTPHost == "" || s.Cfg.SMTPPort == 0 || s.Cfg.SMTPFrom == "" {
+	if !s.Mailer.Enabled() {
 		log.Printf("password reset link for %s: %s", to, resetURL)
 		return nil
 	}
-	addr := fmt.Sprintf("%s:%d", s.Cfg.SMTPHost, s.Cfg.SMTPPort)
-	var auth smtp.Auth
-	if s.Cfg.SMTPUser != "" {
-		auth = smtp.PlainAuth("", s.Cfg.SMTPUser, s.Cfg.SMTPPass, s.Cfg.SMTPHost)
-	}
-	return smtp.SendMail(addr, auth, s.Cfg.SMTPFrom, []string{to}, message)
+	return s.Mailer.Send(to, subject, body)
 }
@@ -0,0 +1,79 @@
+package httpapi_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"talkie/backend/internal/auth"
+	"talkie/backend/internal/config"
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/dbtest"
+	"talkie/backend/internal/httpapi"
+	"talkie/backend/internal/notify"
+	"talkie/backend/internal/ws"
+)
+
+const testJWTSecret = "test-secret"
+
+func testConfig() config.Config {
+	return config.Config{JWTSecret: testJWTSecret, Registration: "open", InstanceName: "Talkie"}
+}
+
+// testStore is what a test server runs on: dbtest.Store, or a wrapper of
+// it that fails some calls.
+type testStore interface {
+	httpapi.Store
+	notify.DeviceStore
+}
+
+func newTestServer(t *testing.T, store testStore, cfg config.Config) *httpapi.Server {
+	t.Helper()
+	hub := ws.NewHub()
+	return httpapi.New(cfg, store, hub, notify.NewDispatcher(store, hub))
+}
+
+// newUser creates an account and returns it with a token for it.
+func newUser(t *testing.T, store *dbtest.Store, name string) (db.User, string) {
+	t.Helper()
+	u, err := store.CreateUser(context.Background(), name+"@example.com", name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := auth.GenerateJWT(testJWTSecret, u.ID, u.Username, u.SessionVersion, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u, token
+}
+
+// do sends a JSON request, signed in with token unless it is empty, and
+// decodes the JSON object it answers with.
+func do(t *testing.T, h http.Handler, method, path, token string, body any) (int, map[string]any) {
+	t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &payload)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var out map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("%s %s: decode %q: %v", method, path, rec.Body.String(), err)
+	}
+	return rec.Code, out
+}
+
+func postJSON(t *testing.T, h http.Handler, path string, body any) (int, map[string]any) {
+	t.Helper()
+	return do(t, h, http.MethodPost, path, "", body)
+}
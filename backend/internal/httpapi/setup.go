@@ -0,0 +1,158 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"talkie/backend/internal/auth"
+	"talkie/backend/internal/db"
+)
+
+const maxInstanceNameLength = 64
+
+type setupStep struct {
+	ID       string `json:"id"`
+	Required bool   `json:"required"`
+	Done     bool   `json:"done"`
+}
+
+type setupRequest struct {
+	Email        string `json:"email"`
+	Username     string `json:"username"`
+	Password     string `json:"password"`
+	InstanceName string `json:"instance_name"`
+	Registration string `json:"registration"`
+	// Token must match SETUP_TOKEN when it is set.
+	Token string `json:"setup_token,omitempty"`
+}
+
+// instanceSettings returns the name and registration policy setup saved,
+// or INSTANCE_NAME and REGISTRATION before it ran.
+func (s *Server) instanceSettings(ctx context.Context) db.InstanceSettings {
+	st, err := s.Store.GetInstanceSettings(ctx)
+	if err == nil {
+		return st
+	}
+	if err != db.ErrNotFound {
+		log.Printf("load instance settings: %v", err)
+	}
+	return db.InstanceSettings{Name: s.Cfg.InstanceName, Registration: s.Cfg.Registration}
+}
+
+// setupPending turns away a request that would create an account while
+// first-run setup is open, reporting whether it did. Otherwise whoever
+// registered first would close setup and leave the operator without a
+// way to make the first admin.
+func (s *Server) setupPending(w http.ResponseWriter, r *http.Request) bool {
+	open, err := s.Store.SetupRequired(r.Context())
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check setup")
+		return true
+	}
+	if !open {
+		return false
+	}
+	jsonResponse(w, http.StatusForbidden, map[string]string{
+		"error": "this server has not been set up yet",
+		"code":  "setup_required",
+	})
+	return true
+}
+
+// getSetup tells a setup wizard whether this instance still needs its
+// first run and what it involves. Once setup is done it only says so.
+func (s *Server) getSetup(w http.ResponseWriter, r *http.Request) {
+	open, err := s.Store.SetupRequired(r.Context())
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check setup")
+		return
+	}
+	if !open {
+		jsonResponse(w, http.StatusOK, map[string]any{"required": false})
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{
+		"required": true,
+		"steps": []setupStep{
+			{ID: "admin", Required: s.LDAP == nil},
+			{ID: "instance", Required: true},
+			// Without SMTP, verification and reset emails are only logged.
+			{ID: "email", Done: s.Cfg.SMTPHost != ""},
+		},
+		"token_required": s.Cfg.SetupToken != "",
+		"defaults":       db.InstanceSettings{Name: s.Cfg.InstanceName, Registration: s.Cfg.Registration},
+	})
+}
+
+// completeSetup creates the first admin account and the instance settings,
+// then signs the admin in. It works once, while the instance has no
+// accounts; after that it answers 409.
+func (s *Server) completeSetup(w http.ResponseWriter, r *http.Request) {
+	if s.ldapManaged(w) {
+		return
+	}
+	var req setupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if s.Cfg.SetupToken != "" && subtle.ConstantTimeCompare([]byte(req.Token), []byte(s.Cfg.SetupToken)) != 1 {
+		jsonError(w, http.StatusForbidden, "invalid setup token")
+		return
+	}
+	req.Email = strings.TrimSpace(strings.ToLower(req.Email))
+	req.Username = strings.TrimSpace(req.Username)
+	req.InstanceName = strings.TrimSpace(req.InstanceName)
+	if req.Email == "" || req.Password == "" || req.Username == "" {
+		jsonError(w, http.StatusBadRequest, "email, username, and password are required")
+		return
+	}
+	if len(req.Password) < 6 {
+		jsonError(w, http.StatusBadRequest, "password must be at least 6 characters")
+		return
+	}
+	if utf8.RuneCountInString(req.Username) > 15 {
+		jsonError(w, http.StatusBadRequest, "username must be at most 15 characters")
+		return
+	}
+	if req.InstanceName == "" || utf8.RuneCountInString(req.InstanceName) > maxInstanceNameLength {
+		jsonError(w, http.StatusBadRequest, "instance_name must be 1 to 64 characters")
+		return
+	}
+	if req.Registration != "open" && req.Registration != "closed" {
+		jsonError(w, http.StatusBadRequest, "registration must be open or closed")
+		return
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to hash password")
+		return
+	}
+	u, err := s.Store.CompleteSetup(r.Context(), req.Email, req.Username, hash, db.InstanceSettings{
+		Name:         req.InstanceName,
+		Registration: req.Registration,
+	})
+	if errors.Is(err, db.ErrSetupDone) {
+		jsonError(w, http.StatusConflict, "setup is already complete")
+		return
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to complete setup")
+		return
+	}
+	log.Printf("setup completed: %s is the first admin", u.ID)
+	token, err := s.issueToken(r.Context(), u, u.SessionVersion)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to generate token")
+		return
+	}
+	u.PasswordHash = ""
+	jsonResponse(w, http.StatusCreated, authResponse{Token: token, User: u})
+}
@@ -0,0 +1,39 @@
+package httpapi_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"talkie/backend/internal/dbtest"
+)
+
+func TestRegisterBeforeSetup(t *testing.T) {
+	store := dbtest.New()
+	h := newTestServer(t, store, testConfig()).Routes()
+
+	code, body := postJSON(t, h, "/api/auth/register", map[string]string{
+		"email": "early@example.com", "username": "early", "password": "secret123",
+	})
+	if code != http.StatusForbidden || body["code"] != "setup_required" {
+		t.Fatalf("register before setup = %d %v, want 403 setup_required", code, body)
+	}
+	if _, err := store.FindUserByEmail(context.Background(), "early@example.com"); err == nil {
+		t.Fatal("register before setup created an account")
+	}
+
+	code, body = postJSON(t, h, "/api/setup", map[string]string{
+		"email": "admin@example.com", "username": "admin", "password": "secret123",
+		"instance_name": "Ours", "registration": "open",
+	})
+	if code != http.StatusCreated {
+		t.Fatalf("setup = %d %v, want 201", code, body)
+	}
+
+	code, body = postJSON(t, h, "/api/auth/register", map[string]string{
+		"email": "later@example.com", "username": "later", "password": "secret123",
+	})
+	if code != http.StatusCreated {
+		t.Fatalf("register after setup = %d %v, want 201", code, body)
+	}
+}
@@ -22,19 +22,32 @@ func (s *Server) listFriends(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusUnauthorized, "unauthorized")
 		return
 	}
+	p, err := parsePage(r, maxUserListPage, maxUserListPage)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	friends, err := s.Store.ListFriends(r.Context(), user.ID)
 	if err != nil {
 		jsonError(w, http.StatusInternalServerError, "failed to load friends")
 		return
 	}
+	friends = filterByName(friends, r.URL.Query().Get("q"), func(f db.Friend) string { return f.Username })
+	friends, next, err := offsetPage(friends, p)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	incoming, err := s.Store.ListIncomingFriendRequests(r.Context(), user.ID)
 	if err != nil {
 		jsonError(w, http.StatusInternalServerError, "failed to load friend requests")
 		return
 	}
+	setNextPage(w, r, next)
 	jsonResponse(w, http.StatusOK, map[string]any{
-		"friends":  friends,
-		"incoming": incoming,
+		"friends":     friends,
+		"incoming":    incoming,
+		"next_cursor": next,
 	})
 }
 
@@ -63,12 +76,18 @@ func (s *Server) userProfile(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusInternalServerError, "failed to load relationship")
 		return
 	}
+	fields, err := s.visibleProfile(r.Context(), targetID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load user profile")
+		return
+	}
 	jsonResponse(w, http.StatusOK, map[string]any{
 		"id":         u.ID,
 		"username":   u.Username,
 		"avatar_url": u.AvatarURL,
 		"created_at": u.CreatedAt,
 		"is_friend":  isFriend,
+		"profile":    fields,
 	})
 }
 
@@ -94,7 +113,7 @@ func (s *Server) sendFriendRequest(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	s.Hub.BroadcastUser(targetID, ws.OutgoingMessage{Type: "friend_request_event"})
+	s.Hub.BroadcastUser(targetID, ws.FriendRequestEvent{})
 	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
 }
 
@@ -118,9 +137,9 @@ func (s *Server) acceptFriendRequest(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusBadRequest, "failed to accept request")
 		return
 	}
-	s.Hub.BroadcastUser(user.ID, ws.OutgoingMessage{Type: "friend_relationship_event"})
-	s.Hub.BroadcastUser(requesterID, ws.OutgoingMessage{Type: "friend_relationship_event"})
-	s.Hub.BroadcastUser(user.ID, ws.OutgoingMessage{Type: "friend_request_event"})
+	s.Hub.BroadcastUser(user.ID, ws.FriendRelationshipEvent{})
+	s.Hub.BroadcastUser(requesterID, ws.FriendRelationshipEvent{})
+	s.Hub.BroadcastUser(user.ID, ws.FriendRequestEvent{})
 	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
 }
 
@@ -143,7 +162,7 @@ func (s *Server) declineFriendRequest(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusBadRequest, "failed to decline request")
 		return
 	}
-	s.Hub.BroadcastUser(user.ID, ws.OutgoingMessage{Type: "friend_request_event"})
+	s.Hub.BroadcastUser(user.ID, ws.FriendRequestEvent{})
 	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
 }
 
@@ -193,17 +212,21 @@ func (s *Server) acceptFriendInviteLink(w http.ResponseWriter, r *http.Request)
 		jsonError(w, http.StatusBadRequest, "friend invite token is required")
 		return
 	}
+	if !s.allowInviteLookup(w, r) {
+		return
+	}
 	friend, err := s.Store.AddFriendByInviteTokenHash(r.Context(), tokenHash(rawToken), user.ID)
 	if err != nil {
 		if err == db.ErrNotFound {
+			s.noteInviteMiss(r)
 			jsonError(w, http.StatusNotFound, "friend invite link is invalid or expired")
 			return
 		}
 		jsonError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	s.Hub.BroadcastUser(user.ID, ws.OutgoingMessage{Type: "friend_relationship_event"})
-	s.Hub.BroadcastUser(friend.ID, ws.OutgoingMessage{Type: "friend_relationship_event"})
+	s.Hub.BroadcastUser(user.ID, ws.FriendRelationshipEvent{})
+	s.Hub.BroadcastUser(friend.ID, ws.FriendRelationshipEvent{})
 	jsonResponse(w, http.StatusOK, friend)
 }
 
@@ -213,11 +236,27 @@ func (s *Server) listDMRooms(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusUnauthorized, "unauthorized")
 		return
 	}
+	p, err := parsePage(r, maxUserListPage, maxUserListPage)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	rooms, err := s.Store.ListDirectRoomsForUser(r.Context(), user.ID)
 	if err != nil {
 		jsonError(w, http.StatusInternalServerError, "failed to load dms")
 		return
 	}
+	rooms = filterByName(rooms, r.URL.Query().Get("q"), func(room db.Room) string { return room.Name })
+	if err := sortBy(rooms, r.URL.Query().Get("sort"), roomSorts); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	rooms, next, err := offsetPage(rooms, p)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	setNextPage(w, r, next)
 	jsonResponse(w, http.StatusOK, rooms)
 }
 
@@ -239,12 +278,15 @@ func (s *Server) createOrGetDMRoom(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusBadRequest, "invalid user id")
 		return
 	}
+	if !s.allowDirectMessage(w, r, user.ID, targetID) {
+		return
+	}
 	room, err := s.Store.GetOrCreateDirectRoom(r.Context(), user.ID, targetID)
 	if err != nil {
 		jsonError(w, http.StatusBadRequest, "failed to open dm")
 		return
 	}
-	s.Hub.BroadcastUser(targetID, ws.OutgoingMessage{Type: "dm_room_event"})
+	s.Hub.BroadcastUser(targetID, ws.DMRoomEvent{})
 	targetUser, err := s.Store.FindUserByID(r.Context(), targetID)
 	if err == nil {
 		room.Name = targetUser.Username
@@ -0,0 +1,772 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"talkie/backend/internal/auth"
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+	"talkie/backend/internal/sso"
+	"talkie/backend/internal/ws"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	// ssoStartsPerMinute caps sign-ins started per client address; each
+	// one stores a pending login and may fetch the IdP's configuration.
+	ssoStartsPerMinute = 20
+	maxSSORoleMappings = 50
+	maxSSOFormBytes    = 512 << 10
+)
+
+var ssoUsernameStrip = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// A workspace admin points the workspace at an OIDC or SAML identity
+// provider. Once an instance admin approves it, members can sign in
+// through it at /api/sso/{groupID}/login: the provider's answer comes
+// back to a callback here, which sends the browser on to the frontend
+// with a one-time code it trades for a session at /api/auth/sso.
+// Unknown users are provisioned on their first sign-in, and every sign-in
+// puts the user in all of the workspace's channels with the role their
+// provider groups map to.
+
+func (s *Server) getWorkspaceSSO(w http.ResponseWriter, r *http.Request) {
+	groupID, ok := s.managedGroup(w, r)
+	if !ok {
+		return
+	}
+	// What to register at the identity provider.
+	sp := s.samlService(r, groupID)
+	resp := map[string]any{
+		"sso":          nil,
+		"redirect_uri": s.oidcRedirectURI(r),
+		"entity_id":    sp.EntityID,
+		"acs_url":      sp.ACSURL,
+		"metadata_url": sp.EntityID,
+	}
+	c, err := s.Store.GetWorkspaceSSO(r.Context(), groupID)
+	switch {
+	case err == nil:
+		resp["sso"] = c
+	case err != db.ErrNotFound:
+		jsonError(w, http.StatusInternalServerError, "failed to load sso settings")
+		return
+	}
+	jsonResponse(w, http.StatusOK, resp)
+}
+
+func (s *Server) putWorkspaceSSO(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	groupID, ok := s.managedGroup(w, r)
+	if !ok {
+		return
+	}
+	// client_secret is write-only, so it is not a field of the settings.
+	var req struct {
+		db.WorkspaceSSO
+		ClientSecret string `json:"client_secret"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	c := req.WorkspaceSSO
+	c.GroupID = groupID
+	c.ClientSecret = strings.TrimSpace(req.ClientSecret)
+	current, err := s.Store.GetWorkspaceSSO(r.Context(), groupID)
+	if err != nil && err != db.ErrNotFound {
+		jsonError(w, http.StatusInternalServerError, "failed to load sso settings")
+		return
+	}
+	if msg := validateWorkspaceSSO(&c, current); msg != "" {
+		jsonError(w, http.StatusBadRequest, msg)
+		return
+	}
+	saved, err := s.Store.SaveWorkspaceSSO(r.Context(), c, user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to save sso settings")
+		return
+	}
+	jsonResponse(w, http.StatusOK, saved)
+}
+
+// validateWorkspaceSSO tidies c and returns what is wrong with it, if
+// anything. current is the saved settings, zero if there are none.
+func validateWorkspaceSSO(c *db.WorkspaceSSO, current db.WorkspaceSSO) string {
+	c.Issuer = strings.TrimRight(strings.TrimSpace(c.Issuer), "/")
+	c.ClientID = strings.TrimSpace(c.ClientID)
+	c.IdPSSOURL = strings.TrimSpace(c.IdPSSOURL)
+	c.IdPEntityID = strings.TrimSpace(c.IdPEntityID)
+	c.IdPCertificate = strings.TrimSpace(c.IdPCertificate)
+	c.GroupsClaim = strings.TrimSpace(c.GroupsClaim)
+	if c.GroupsClaim == "" {
+		c.GroupsClaim = "groups"
+	}
+	switch c.Protocol {
+	case sso.ProtocolOIDC:
+		if !providerURL(c.Issuer) {
+			return "issuer must be an https URL"
+		}
+		if c.ClientID == "" {
+			return "client_id is required"
+		}
+		if c.ClientSecret == "" && (current.Protocol != sso.ProtocolOIDC || !current.HasClientSecret) {
+			return "client_secret is required"
+		}
+		c.IdPSSOURL, c.IdPEntityID, c.IdPCertificate = "", "", ""
+	case sso.ProtocolSAML:
+		if !providerURL(c.IdPSSOURL) {
+			return "idp_sso_url must be an https URL"
+		}
+		if c.IdPEntityID == "" {
+			return "idp_entity_id is required"
+		}
+		cert, err := sso.ParseCertificate(c.IdPCertificate)
+		if err != nil {
+			return "idp_certificate must be a PEM certificate"
+		}
+		if time.Now().After(cert.NotAfter) {
+			return "idp_certificate has expired"
+		}
+		c.Issuer, c.ClientID, c.ClientSecret = "", "", ""
+	default:
+		return "protocol must be oidc or saml"
+	}
+	if c.DefaultRole != "" && c.DefaultRole != "member" {
+		return `default_role must be "member" or "" to turn away users in no mapped group`
+	}
+	if len(c.RoleMappings) > maxSSORoleMappings {
+		return fmt.Sprintf("at most %d role mappings", maxSSORoleMappings)
+	}
+	for i, m := range c.RoleMappings {
+		c.RoleMappings[i].Group = strings.TrimSpace(m.Group)
+		if c.RoleMappings[i].Group == "" || (m.Role != "admin" && m.Role != "member") {
+			return `role mappings need a group and a role of "admin" or "member"`
+		}
+	}
+	return ""
+}
+
+// providerURL reports whether u can be an identity provider's address:
+// https, or http on the local machine for development.
+func providerURL(u string) bool {
+	p, err := url.Parse(u)
+	if err != nil || p.Host == "" {
+		return false
+	}
+	switch p.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := p.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	}
+	return false
+}
+
+func (s *Server) deleteWorkspaceSSO(w http.ResponseWriter, r *http.Request) {
+	groupID, ok := s.managedGroup(w, r)
+	if !ok {
+		return
+	}
+	if err := s.Store.DeleteWorkspaceSSO(r.Context(), groupID); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "sso is not configured")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to remove sso settings")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+// managedGroup parses the groupID URL parameter and checks the caller
+// can manage that workspace.
+func (s *Server) managedGroup(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return uuid.Nil, false
+	}
+	groupID, err := uuid.Parse(chi.URLParam(r, "groupID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid group id")
+		return uuid.Nil, false
+	}
+	can, err := s.Store.CanManageGroup(r.Context(), groupID, user.ID)
+	if err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "group not found")
+			return uuid.Nil, false
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to check permissions")
+		return uuid.Nil, false
+	}
+	if !can {
+		jsonError(w, http.StatusForbidden, "admin role required")
+		return uuid.Nil, false
+	}
+	return groupID, true
+}
+
+// linkWorkspaceSSO starts a sign-in that links the caller's account to
+// their identity at the workspace's provider instead of signing in.
+func (s *Server) linkWorkspaceSSO(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	c, ok := s.activeSSO(w, r)
+	if !ok {
+		return
+	}
+	authURL, err := s.beginSSO(r, c, &user.ID)
+	if err != nil {
+		log.Printf("start sso link for group %s: %v", c.GroupID, err)
+		jsonError(w, http.StatusBadGateway, "failed to reach the identity provider")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]string{"url": authURL})
+}
+
+func (s *Server) listWorkspaceSSO(w http.ResponseWriter, r *http.Request) {
+	list, err := s.Store.ListWorkspaceSSO(r.Context())
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to list sso settings")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"sso": list})
+}
+
+// setWorkspaceSSOApproval lets an instance admin allow a workspace's
+// identity provider, since it can create accounts and is fetched from
+// this server.
+func (s *Server) setWorkspaceSSOApproval(w http.ResponseWriter, r *http.Request) {
+	groupID, err := uuid.Parse(chi.URLParam(r, "groupID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid group id")
+		return
+	}
+	var req struct {
+		Approved *bool `json:"approved"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Approved == nil {
+		jsonError(w, http.StatusBadRequest, "approved is required")
+		return
+	}
+	if err := s.Store.SetWorkspaceSSOApproved(r.Context(), groupID, *req.Approved); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "sso is not configured")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to save approval")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]bool{"approved": *req.Approved})
+}
+
+// getSSOLogin tells the sign-in page whether a workspace has SSO.
+func (s *Server) getSSOLogin(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.activeSSO(w, r)
+	if !ok {
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{
+		"group_id":  c.GroupID,
+		"protocol":  c.Protocol,
+		"enforced":  c.Enforced,
+		"login_url": ssoLoginPath(c.GroupID),
+	})
+}
+
+// startSSOLogin sends the browser to the workspace's identity provider.
+func (s *Server) startSSOLogin(w http.ResponseWriter, r *http.Request) {
+	st := s.ssoStarts.Take(s.clientIP(r))
+	if !st.Allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(st.RetryAfter.Seconds()))))
+		jsonError(w, http.StatusTooManyRequests, "too many sign-ins, try again later")
+		return
+	}
+	c, ok := s.activeSSO(w, r)
+	if !ok {
+		return
+	}
+	authURL, err := s.beginSSO(r, c, nil)
+	if err != nil {
+		log.Printf("start sso for group %s: %v", c.GroupID, err)
+		s.ssoDone(w, r, "sso_error", "idp_unavailable")
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// samlMetadata serves the service provider metadata to configure the
+// IdP with, before approval too.
+func (s *Server) samlMetadata(w http.ResponseWriter, r *http.Request) {
+	groupID, err := uuid.Parse(chi.URLParam(r, "groupID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid group id")
+		return
+	}
+	c, err := s.Store.GetWorkspaceSSO(r.Context(), groupID)
+	if err != nil || c.Protocol != sso.ProtocolSAML {
+		jsonError(w, http.StatusNotFound, "saml is not configured")
+		return
+	}
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	_, _ = w.Write(s.samlService(r, groupID).Metadata())
+}
+
+func (s *Server) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	login, c, ok := s.resumeSSO(w, r, q.Get("state"), sso.ProtocolOIDC)
+	if !ok {
+		return
+	}
+	if e := q.Get("error"); e != "" {
+		log.Printf("sso for group %s: identity provider returned %s", c.GroupID, e)
+		s.ssoDone(w, r, "sso_error", "idp_denied")
+		return
+	}
+	id, err := s.oidc.Exchange(r.Context(), s.oidcLogin(r, c), q.Get("code"), login.Nonce, login.Verifier)
+	if err != nil {
+		log.Printf("sso for group %s: %v", c.GroupID, err)
+		s.ssoDone(w, r, "sso_error", "invalid_response")
+		return
+	}
+	s.completeSSO(w, r, login, c, id)
+}
+
+func (s *Server) samlACS(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxSSOFormBytes)
+	if err := r.ParseForm(); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid form")
+		return
+	}
+	login, c, ok := s.resumeSSO(w, r, r.PostForm.Get("RelayState"), sso.ProtocolSAML)
+	if !ok {
+		return
+	}
+	id, err := s.samlService(r, c.GroupID).ParseResponse(samlIdP(c), r.PostForm.Get("SAMLResponse"), login.Nonce, c.GroupsClaim, time.Now())
+	if err != nil {
+		log.Printf("sso for group %s: %v", c.GroupID, err)
+		s.ssoDone(w, r, "sso_error", "invalid_response")
+		return
+	}
+	s.completeSSO(w, r, login, c, id)
+}
+
+// exchangeSSOCode trades the one-time code from a finished sign-in for a
+// session token.
+func (s *Server) exchangeSSOCode(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Code) == "" {
+		jsonError(w, http.StatusBadRequest, "code is required")
+		return
+	}
+	userID, err := s.Store.TakeSSOExchange(r.Context(), tokenHash(strings.TrimSpace(req.Code)))
+	if err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusUnauthorized, "invalid or expired code")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to sign in")
+		return
+	}
+	u, err := s.Store.FindUserByID(r.Context(), userID)
+	if err != nil {
+		jsonError(w, http.StatusUnauthorized, "invalid or expired code")
+		return
+	}
+	if s.accountDeactivated(w, r, u.ID) {
+		return
+	}
+	token, err := s.issueToken(r.Context(), u, u.SessionVersion)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to generate token")
+		return
+	}
+	go s.recordLogin(u, s.loginContextFromRequest(r))
+	u.PasswordHash = ""
+	jsonResponse(w, http.StatusOK, authResponse{Token: token, User: u})
+}
+
+// activeSSO loads the groupID URL parameter's SSO settings, answering 404
+// unless members can sign in with them.
+func (s *Server) activeSSO(w http.ResponseWriter, r *http.Request) (db.WorkspaceSSO, bool) {
+	groupID, err := uuid.Parse(chi.URLParam(r, "groupID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid group id")
+		return db.WorkspaceSSO{}, false
+	}
+	c, err := s.Store.GetWorkspaceSSO(r.Context(), groupID)
+	if err != nil && err != db.ErrNotFound {
+		jsonError(w, http.StatusInternalServerError, "failed to load sso settings")
+		return db.WorkspaceSSO{}, false
+	}
+	if err == db.ErrNotFound || !c.Active() {
+		jsonError(w, http.StatusNotFound, "sso is not available for this workspace")
+		return db.WorkspaceSSO{}, false
+	}
+	return c, true
+}
+
+// beginSSO records a sign-in and returns the identity provider URL to
+// send the browser to. linkUserID is set to link that account.
+func (s *Server) beginSSO(r *http.Request, c db.WorkspaceSSO, linkUserID *uuid.UUID) (string, error) {
+	state, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := sso.RandomID()
+	if err != nil {
+		return "", err
+	}
+	login := db.SSOLogin{GroupID: c.GroupID, Nonce: nonce, LinkUserID: linkUserID}
+	var authURL string
+	switch c.Protocol {
+	case sso.ProtocolOIDC:
+		if login.Verifier, err = randomToken(32); err != nil {
+			return "", err
+		}
+		authURL, err = s.oidc.AuthURL(r.Context(), s.oidcLogin(r, c), state, nonce, login.Verifier)
+	case sso.ProtocolSAML:
+		authURL, err = s.samlService(r, c.GroupID).AuthURL(samlIdP(c), nonce, state, time.Now())
+	default:
+		err = fmt.Errorf("unknown protocol %q", c.Protocol)
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := s.Store.CreateSSOLogin(r.Context(), tokenHash(state), login); err != nil {
+		return "", err
+	}
+	return authURL, nil
+}
+
+// resumeSSO takes the sign-in state names, redirecting to the frontend
+// with an error when it is unknown, used or no longer allowed.
+func (s *Server) resumeSSO(w http.ResponseWriter, r *http.Request, state, protocol string) (db.SSOLogin, db.WorkspaceSSO, bool) {
+	if state == "" {
+		s.ssoDone(w, r, "sso_error", "expired")
+		return db.SSOLogin{}, db.WorkspaceSSO{}, false
+	}
+	login, err := s.Store.TakeSSOLogin(r.Context(), tokenHash(state))
+	if err != nil {
+		if err != db.ErrNotFound {
+			log.Printf("take sso login: %v", err)
+		}
+		s.ssoDone(w, r, "sso_error", "expired")
+		return db.SSOLogin{}, db.WorkspaceSSO{}, false
+	}
+	c, err := s.Store.GetWorkspaceSSO(r.Context(), login.GroupID)
+	if err != nil || !c.Active() || c.Protocol != protocol {
+		s.ssoDone(w, r, "sso_error", "not_configured")
+		return db.SSOLogin{}, db.WorkspaceSSO{}, false
+	}
+	return login, c, true
+}
+
+// completeSSO signs in the user id is, provisioning or linking them as
+// needed, and sends the browser back to the frontend with a one-time
+// code for their session.
+func (s *Server) completeSSO(w http.ResponseWriter, r *http.Request, login db.SSOLogin, c db.WorkspaceSSO, id sso.Identity) {
+	role := ssoRole(c, id.Groups)
+	if role == "" {
+		s.ssoDone(w, r, "sso_error", "not_authorized")
+		return
+	}
+	userID, failure := s.ssoUser(r.Context(), login, c, id)
+	if failure != "" {
+		s.ssoDone(w, r, "sso_error", failure)
+		return
+	}
+	deactivated, err := s.Store.IsUserDeactivated(r.Context(), userID)
+	if err != nil {
+		log.Printf("check deactivation of %s: %v", userID, err)
+		s.ssoDone(w, r, "sso_error", "server_error")
+		return
+	}
+	if deactivated {
+		s.ssoDone(w, r, "sso_error", "account_deactivated")
+		return
+	}
+	full, err := s.ssoWorkspaceFull(r.Context(), c.GroupID, userID)
+	if err != nil {
+		log.Printf("sso quota for group %s: %v", c.GroupID, err)
+		s.ssoDone(w, r, "sso_error", "server_error")
+		return
+	}
+	if full {
+		s.ssoDone(w, r, "sso_error", "workspace_full")
+		return
+	}
+	joined, err := s.Store.SyncSSOMembership(r.Context(), c.GroupID, userID, role)
+	if err != nil {
+		log.Printf("sso membership for %s in group %s: %v", userID, c.GroupID, err)
+		s.ssoDone(w, r, "sso_error", "server_error")
+		return
+	}
+	for _, roomID := range joined {
+		go s.announceMembership(roomID, userID, ws.MemberJoined)
+	}
+	if login.LinkUserID != nil {
+		s.ssoDone(w, r, "sso_linked", c.GroupID.String())
+		return
+	}
+	code, err := randomToken(32)
+	if err == nil {
+		err = s.Store.CreateSSOExchange(r.Context(), tokenHash(code), userID)
+	}
+	if err != nil {
+		log.Printf("sso exchange for %s: %v", userID, err)
+		s.ssoDone(w, r, "sso_error", "server_error")
+		return
+	}
+	s.ssoDone(w, r, "sso_code", code)
+}
+
+// ssoUser finds or makes the account id signs in as. The second result
+// is the sso_error to give up with, if any.
+func (s *Server) ssoUser(ctx context.Context, login db.SSOLogin, c db.WorkspaceSSO, id sso.Identity) (uuid.UUID, string) {
+	if login.LinkUserID != nil {
+		err := s.Store.LinkSSOIdentity(ctx, c.GroupID, id.Subject, *login.LinkUserID)
+		if err == db.ErrSSOIdentityTaken {
+			return uuid.Nil, "identity_taken"
+		}
+		if err != nil {
+			log.Printf("link sso identity for %s: %v", *login.LinkUserID, err)
+			return uuid.Nil, "server_error"
+		}
+		return *login.LinkUserID, ""
+	}
+	userID, err := s.Store.FindSSOIdentity(ctx, c.GroupID, id.Subject)
+	if err == nil {
+		return userID, ""
+	}
+	if err != db.ErrNotFound {
+		log.Printf("find sso identity in group %s: %v", c.GroupID, err)
+		return uuid.Nil, "server_error"
+	}
+	email := strings.ToLower(strings.TrimSpace(id.Email))
+	if email == "" {
+		return uuid.Nil, "missing_email"
+	}
+	existing, err := s.Store.FindUserByEmail(ctx, email)
+	switch {
+	case err == nil:
+		// An account with the address is only taken over when it is
+		// already in the workspace and both sides verified the address;
+		// anyone else signs in with their password and links instead.
+		member, err := s.Store.IsGroupMember(ctx, c.GroupID, existing.ID)
+		if err != nil {
+			log.Printf("check group membership for %s: %v", existing.ID, err)
+			return uuid.Nil, "server_error"
+		}
+		if !member || !existing.EmailVerified || !id.EmailVerified {
+			return uuid.Nil, "account_exists"
+		}
+		if err := s.Store.LinkSSOIdentity(ctx, c.GroupID, id.Subject, existing.ID); err != nil {
+			log.Printf("link sso identity for %s: %v", existing.ID, err)
+			return uuid.Nil, "server_error"
+		}
+		return existing.ID, ""
+	case err != db.ErrNotFound:
+		log.Printf("find user for sso: %v", err)
+		return uuid.Nil, "server_error"
+	}
+	if !id.EmailVerified {
+		return uuid.Nil, "email_not_verified"
+	}
+	// Like registration, provisioning waits for first-run setup.
+	open, err := s.Store.SetupRequired(ctx)
+	if err != nil {
+		log.Printf("check setup for sso: %v", err)
+		return uuid.Nil, "server_error"
+	}
+	if open {
+		return uuid.Nil, "setup_required"
+	}
+	u, err := s.provisionSSOUser(ctx, c.GroupID, id.Subject, email, ssoUsername(id))
+	if err == db.ErrUserExists {
+		return uuid.Nil, "account_exists"
+	}
+	if err != nil {
+		log.Printf("provision sso user in group %s: %v", c.GroupID, err)
+		return uuid.Nil, "server_error"
+	}
+	return u.ID, ""
+}
+
+// provisionSSOUser creates the account for a first sign-in, trying a few
+// numbered usernames when the plain one is taken. Its password is random
+// and never shown: it signs in through SSO, or resets the password.
+func (s *Server) provisionSSOUser(ctx context.Context, groupID uuid.UUID, subject, email, username string) (db.User, error) {
+	password, err := randomToken(32)
+	if err != nil {
+		return db.User{}, err
+	}
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return db.User{}, err
+	}
+	name := username
+	for attempt := 0; ; attempt++ {
+		u, err := s.Store.CreateSSOUser(ctx, groupID, subject, email, name, hash)
+		if err != db.ErrUserExists || attempt == 4 {
+			return u, err
+		}
+		suffix, err := randomDigits(4)
+		if err != nil {
+			return db.User{}, err
+		}
+		name = username[:min(len(username), 11)] + suffix
+	}
+}
+
+// ssoUsername picks a username from the identity's username or the local
+// part of its email, in the characters and length usernames allow.
+func ssoUsername(id sso.Identity) string {
+	name := id.Username
+	if name == "" {
+		name, _, _ = strings.Cut(id.Email, "@")
+	}
+	name = ssoUsernameStrip.ReplaceAllString(name, "")
+	if name == "" {
+		name = "user"
+	}
+	return name[:min(len(name), 15)]
+}
+
+// ssoRole is the role id's groups map to: admin if any mapped group says
+// so, member if any other does, else the default, which may be none.
+func ssoRole(c db.WorkspaceSSO, groups []string) string {
+	role := c.DefaultRole
+	for _, m := range c.RoleMappings {
+		if !slices.Contains(groups, m.Group) {
+			continue
+		}
+		if m.Role == "admin" {
+			return "admin"
+		}
+		role = "member"
+	}
+	return role
+}
+
+// ssoWorkspaceFull reports whether userID would join a workspace that is
+// already at its plan's member limit.
+func (s *Server) ssoWorkspaceFull(ctx context.Context, groupID, userID uuid.UUID) (bool, error) {
+	member, err := s.Store.IsGroupMember(ctx, groupID, userID)
+	if err != nil || member {
+		return false, err
+	}
+	plan, err := s.Store.GetGroupPlan(ctx, groupID)
+	if err != nil {
+		return false, err
+	}
+	limits := s.defaultLimits().WithPlan(plan)
+	if limits.MaxRoomMembers <= 0 {
+		return false, nil
+	}
+	used, err := s.Store.CountGroupMembers(ctx, groupID)
+	if err != nil {
+		return false, err
+	}
+	return used >= limits.MaxRoomMembers, nil
+}
+
+// ssoDone sends the browser back to the frontend with key=value.
+func (s *Server) ssoDone(w http.ResponseWriter, r *http.Request, key, value string) {
+	target := fmt.Sprintf("%s?%s=%s", strings.TrimRight(s.Cfg.FrontendBaseURL, "/"), key, url.QueryEscape(value))
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// apiBaseURL is where browsers reach this API.
+func (s *Server) apiBaseURL(r *http.Request) string {
+	if s.Cfg.APIPublicURL != "" {
+		return s.Cfg.APIPublicURL
+	}
+	scheme := "http"
+	if r.TLS != nil || s.Cfg.TrustProxyHeaders && strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+		scheme = "https"
+	}
+	host := r.Host
+	if fwd := r.Header.Get("X-Forwarded-Host"); s.Cfg.TrustProxyHeaders && fwd != "" {
+		host = fwd
+	}
+	return scheme + "://" + host
+}
+
+func (s *Server) oidcRedirectURI(r *http.Request) string {
+	return s.apiBaseURL(r) + "/api/sso/oidc/callback"
+}
+
+func (s *Server) oidcLogin(r *http.Request, c db.WorkspaceSSO) sso.OIDCLogin {
+	return sso.OIDCLogin{
+		Issuer:       c.Issuer,
+		ClientID:     c.ClientID,
+		ClientSecret: c.ClientSecret,
+		RedirectURI:  s.oidcRedirectURI(r),
+		GroupsClaim:  c.GroupsClaim,
+	}
+}
+
+// samlService is this server as groupID's service provider. Its entity
+// ID is the metadata URL, which keeps it unique per workspace.
+func (s *Server) samlService(r *http.Request, groupID uuid.UUID) sso.SAMLService {
+	base := s.apiBaseURL(r)
+	return sso.SAMLService{
+		EntityID: fmt.Sprintf("%s/api/sso/%s/saml/metadata", base, groupID),
+		ACSURL:   base + "/api/sso/saml/acs",
+	}
+}
+
+func samlIdP(c db.WorkspaceSSO) sso.SAMLIdP {
+	return sso.SAMLIdP{SSOURL: c.IdPSSOURL, EntityID: c.IdPEntityID, Certificate: c.IdPCertificate}
+}
+
+func ssoLoginPath(groupID uuid.UUID) string {
+	return fmt.Sprintf("/api/sso/%s/login", groupID)
+}
+
+// ssoRequired turns away a password sign-in by a member of a workspace
+// that enforces SSO, reporting whether it did.
+func (s *Server) ssoRequired(w http.ResponseWriter, r *http.Request, userID uuid.UUID) bool {
+	groupID, err := s.Store.EnforcedSSOGroup(r.Context(), userID)
+	if errors.Is(err, db.ErrNotFound) {
+		return false
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check sign-in method")
+		return true
+	}
+	jsonResponse(w, http.StatusForbidden, map[string]any{
+		"error":    "your workspace requires signing in through its identity provider",
+		"code":     "sso_required",
+		"group_id": groupID,
+		"sso_url":  ssoLoginPath(groupID),
+	})
+	return true
+}
@@ -0,0 +1,80 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"talkie/backend/internal/storage"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// uploadsHandler serves stored uploads. Upload file names are random and
+// never reused, so responses can be cached for a long time; the ETag lets
+// clients revalidate cheaply once that expires. Misses are not cached, so a
+// CDN asked for a file moments before it is written does not keep the 404.
+func (s *Server) uploadsHandler(loc storage.Location) http.Handler {
+	root := http.Dir(loc.Dir)
+	files := http.FileServer(root)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, err := root.Open(r.URL.Path)
+		if err != nil {
+			w.Header().Set("Cache-Control", "no-store")
+			files.ServeHTTP(w, r)
+			return
+		}
+		if info, err := f.Stat(); err == nil && !info.IsDir() {
+			w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+			maxAge := s.Cfg.UploadsCacheMaxAge
+			if strings.HasPrefix(strings.TrimPrefix(r.URL.Path, "/"), "avatars/") {
+				maxAge = s.Cfg.AvatarsCacheMaxAge
+			}
+			if maxAge > 0 {
+				w.Header().Set("Cache-Control", fmt.Sprintf("%s, max-age=%d, immutable", s.Cfg.UploadsCacheScope, maxAge))
+			}
+		}
+		f.Close()
+		files.ServeHTTP(w, r)
+	})
+}
+
+// serveRegionUpload serves files from the storage of the region named in
+// the URL.
+func (s *Server) serveRegionUpload(w http.ResponseWriter, r *http.Request) {
+	region := chi.URLParam(r, "region")
+	loc, ok := s.Uploads.Region(region)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	http.StripPrefix(loc.URLPrefix+"/", s.uploadsHandler(loc)).ServeHTTP(w, r)
+}
+
+// s3MediaPrefix is where media in a private bucket is served from, by
+// redirecting to a freshly signed URL.
+const s3MediaPrefix = "/media/s3/"
+
+// s3MediaURL is the media_url stored for an object in the bucket.
+func (s *Server) s3MediaURL(key string) string {
+	if s.Cfg.S3SignedURLTTLS > 0 {
+		return s3MediaPrefix + key
+	}
+	return s.S3.PublicURL(key)
+}
+
+// redirectS3Media sends the client to a signed URL for an object in a
+// private bucket. The redirect is cached for half the signature's lifetime,
+// and only by the browser, so nobody follows a cached redirect to an
+// expired URL.
+func (s *Server) redirectS3Media(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "*")
+	if !strings.HasPrefix(key, "rooms/") || strings.Contains(key, "..") {
+		http.NotFound(w, r)
+		return
+	}
+	ttl := time.Duration(s.Cfg.S3SignedURLTTLS) * time.Second
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", s.Cfg.S3SignedURLTTLS/2))
+	http.Redirect(w, r, s.S3.PresignGet(key, time.Now(), ttl), http.StatusFound)
+}
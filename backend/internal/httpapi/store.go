@@ -0,0 +1,310 @@
+package httpapi
+
+import (
+	"context"
+	"time"
+
+	"talkie/backend/internal/automod"
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/profile"
+	"talkie/backend/internal/ws"
+
+	"github.com/google/uuid"
+)
+
+// Store is everything the HTTP handlers read from or write to. *db.Store
+// implements it against Postgres; dbtest.Store implements it in memory so
+// handlers can be exercised without a database.
+type Store interface {
+	ws.Store
+	automod.Store
+
+	CreateUser(ctx context.Context, email, username, passwordHash string) (db.User, error)
+	FindUserByEmail(ctx context.Context, email string) (db.User, error)
+	FindUserByUsername(ctx context.Context, username string) (db.User, error)
+	FindUserByID(ctx context.Context, id uuid.UUID) (db.User, error)
+	RecordSecurityEvent(ctx context.Context, e db.SecurityEvent) error
+	ListSecurityEvents(ctx context.Context, userID uuid.UUID, limit int) ([]db.SecurityEvent, error)
+	ListRecentSecurityEvents(ctx context.Context, kind string, limit int) ([]db.SecurityEvent, error)
+	UpdateUserAvatar(ctx context.Context, userID uuid.UUID, avatarURL string) error
+	SearchUsers(ctx context.Context, selfID uuid.UUID, q string, limit int) ([]db.Friend, error)
+	SetEmailVerificationToken(ctx context.Context, userID uuid.UUID, tokenHash string, sentAt time.Time) error
+	VerifyEmailCode(ctx context.Context, email, tokenHash string, maxAttempts int) (db.User, int, error)
+	AllowVerificationEmail(ctx context.Context, userID uuid.UUID, perHour int) (bool, time.Duration, error)
+	SetPasswordResetToken(ctx context.Context, userID uuid.UUID, tokenHash string, sentAt time.Time) error
+	ResetPasswordByTokenHash(ctx context.Context, tokenHash, passwordHash string) (uuid.UUID, error)
+
+	CreateRoom(ctx context.Context, name string, createdBy uuid.UUID, isPrivate bool) (db.Room, error)
+	CloneRoom(ctx context.Context, roomID, userID uuid.UUID, name string, withMembers bool) (db.Room, error)
+	GetRoomByID(ctx context.Context, roomID uuid.UUID) (db.Room, error)
+	GetRoomForUser(ctx context.Context, roomID, userID uuid.UUID) (db.Room, error)
+	ListRoomsForUser(ctx context.Context, userID uuid.UUID) ([]db.Room, error)
+	UpdateRoomName(ctx context.Context, roomID uuid.UUID, name string) error
+	DeleteRoom(ctx context.Context, roomID uuid.UUID) error
+	JoinRoom(ctx context.Context, roomID, userID uuid.UUID) error
+	LeaveRoom(ctx context.Context, roomID, userID uuid.UUID) error
+	IsRoomMember(ctx context.Context, roomID, userID uuid.UUID) (bool, error)
+	IsRoomAdmin(ctx context.Context, roomID, userID uuid.UUID) (bool, error)
+	IsDirectRoom(ctx context.Context, roomID uuid.UUID) (bool, error)
+	IsBroadcastRoom(ctx context.Context, roomID uuid.UUID) (bool, error)
+	SetRoomBroadcast(ctx context.Context, roomID uuid.UUID, on bool) error
+	CountRoomSubscribers(ctx context.Context, roomID uuid.UUID) (int, error)
+	SubscribeRoom(ctx context.Context, roomID, userID uuid.UUID) error
+	UnsubscribeRoom(ctx context.Context, roomID, userID uuid.UUID) error
+	IsRoomSubscriber(ctx context.Context, roomID, userID uuid.UUID) (bool, error)
+	ListSubscribedRooms(ctx context.Context, userID uuid.UUID) ([]db.SubscribedRoom, error)
+	ListSubscribedRoomIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error)
+
+	ListRoomGroupsForUser(ctx context.Context, userID uuid.UUID) ([]db.RoomGroup, error)
+	CreateRoomGroup(ctx context.Context, name string, createdBy uuid.UUID) (db.RoomGroup, error)
+	UpdateRoomGroupName(ctx context.Context, groupID uuid.UUID, userID uuid.UUID, name string) error
+	CreateGroupChannel(ctx context.Context, groupID uuid.UUID, name, channelType string, createdBy uuid.UUID) (db.GroupChannel, error)
+	GetGroupIDByRoomID(ctx context.Context, roomID uuid.UUID) (uuid.UUID, error)
+
+	SaveMessageWithType(ctx context.Context, roomID, userID uuid.UUID, content, messageType, mediaURL string) (db.Message, error)
+	SaveMessageOnce(ctx context.Context, roomID, userID uuid.UUID, content string, clientSentAt *time.Time, key string) (db.Message, bool, error)
+	SearchMessages(ctx context.Context, roomID uuid.UUID, q string, beforeID int64, limit int) ([]db.Message, error)
+	GetMessage(ctx context.Context, roomID uuid.UUID, messageID int64) (db.Message, error)
+	ListMessagesAfter(ctx context.Context, roomID uuid.UUID, afterID int64, limit int) ([]db.Message, error)
+	FindMessageAt(ctx context.Context, roomID, viewerID uuid.UUID, at time.Time) (int64, error)
+	ListMentions(ctx context.Context, userID uuid.UUID, f db.MentionFilter) ([]db.Mention, error)
+	RoomActivity(ctx context.Context, roomID uuid.UUID, from, to time.Time, bucket string, loc *time.Location) ([]db.ActivityBucket, error)
+	ListRoomMedia(ctx context.Context, roomID uuid.UUID, types []string, beforeID int64, limit int) ([]db.Message, error)
+
+	FindRoomInviteLinkByCreator(ctx context.Context, roomID, createdBy uuid.UUID) (string, time.Time, error)
+	FindGroupInviteLinkByCreator(ctx context.Context, groupID, createdBy uuid.UUID) (string, time.Time, error)
+	CreateRoomInviteLink(ctx context.Context, rawToken, tokenHash string, roomID, createdBy uuid.UUID, expiresAt time.Time) error
+	CreateGroupInviteLink(ctx context.Context, rawToken, tokenHash string, groupID, createdBy uuid.UUID, expiresAt time.Time) error
+	JoinRoomByInviteTokenHash(ctx context.Context, tokenHash string, userID uuid.UUID) (uuid.UUID, error)
+
+	ListFriends(ctx context.Context, userID uuid.UUID) ([]db.Friend, error)
+	IsFriend(ctx context.Context, userID, targetID uuid.UUID) (bool, error)
+	ListIncomingFriendRequests(ctx context.Context, userID uuid.UUID) ([]db.FriendRequest, error)
+	CreateFriendRequest(ctx context.Context, requesterID, addresseeID uuid.UUID) error
+	AcceptFriendRequest(ctx context.Context, reqID int64, userID uuid.UUID) (uuid.UUID, error)
+	DeclineFriendRequest(ctx context.Context, reqID int64, userID uuid.UUID) error
+	FindFriendInviteLinkByCreator(ctx context.Context, createdBy uuid.UUID) (string, time.Time, error)
+	CreateFriendInviteLink(ctx context.Context, rawToken, tokenHash string, createdBy uuid.UUID, expiresAt time.Time) error
+	AddFriendByInviteTokenHash(ctx context.Context, tokenHash string, userID uuid.UUID) (db.Friend, error)
+	GetOrCreateDirectRoom(ctx context.Context, a, b uuid.UUID) (db.Room, error)
+	ListDirectRoomsForUser(ctx context.Context, userID uuid.UUID) ([]db.Room, error)
+
+	RegisterPushDevice(ctx context.Context, userID uuid.UUID, platform, token string) (db.PushDevice, error)
+	DeletePushDevice(ctx context.Context, userID uuid.UUID, token string) error
+
+	GetSessionVersion(ctx context.Context, userID uuid.UUID) (int, error)
+	ChangePassword(ctx context.Context, userID uuid.UUID, passwordHash string) (int, error)
+
+	CreateEmailChange(ctx context.Context, userID uuid.UUID, oldEmail, newEmail, verifyHash, rollbackHash string) (db.EmailChange, error)
+	GetPendingEmailChange(ctx context.Context, userID uuid.UUID) (db.EmailChange, error)
+	CancelPendingEmailChange(ctx context.Context, userID uuid.UUID) error
+	ConfirmEmailChange(ctx context.Context, verifyHash string) (db.EmailChange, error)
+	RollbackEmailChange(ctx context.Context, rollbackHash string) (db.EmailChange, error)
+
+	GetPhone(ctx context.Context, userID uuid.UUID) (db.UserPhone, error)
+	StartPhoneVerification(ctx context.Context, userID uuid.UUID, phone, phoneHash, codeHash string) error
+	VerifyPhoneCode(ctx context.Context, userID uuid.UUID, codeHash string, maxAttempts int, smsAlerts *bool) (string, int, error)
+	ClearPhone(ctx context.Context, userID uuid.UUID) error
+	SetSMSAlerts(ctx context.Context, userID uuid.UUID, on bool) error
+	SetPhoneDiscoverable(ctx context.Context, userID uuid.UUID, on bool) error
+	MatchPhones(ctx context.Context, selfID uuid.UUID, phoneHashes []string) ([]db.PhoneMatch, error)
+
+	GetWorkspaceSSO(ctx context.Context, groupID uuid.UUID) (db.WorkspaceSSO, error)
+	ListWorkspaceSSO(ctx context.Context) ([]db.WorkspaceSSO, error)
+	SaveWorkspaceSSO(ctx context.Context, c db.WorkspaceSSO, updatedBy uuid.UUID) (db.WorkspaceSSO, error)
+	DeleteWorkspaceSSO(ctx context.Context, groupID uuid.UUID) error
+	SetWorkspaceSSOApproved(ctx context.Context, groupID uuid.UUID, approved bool) error
+	CanManageGroup(ctx context.Context, groupID, userID uuid.UUID) (bool, error)
+	EnforcedSSOGroup(ctx context.Context, userID uuid.UUID) (uuid.UUID, error)
+	CreateSSOLogin(ctx context.Context, stateHash string, l db.SSOLogin) error
+	TakeSSOLogin(ctx context.Context, stateHash string) (db.SSOLogin, error)
+	CreateSSOExchange(ctx context.Context, codeHash string, userID uuid.UUID) error
+	TakeSSOExchange(ctx context.Context, codeHash string) (uuid.UUID, error)
+	FindSSOIdentity(ctx context.Context, groupID uuid.UUID, subject string) (uuid.UUID, error)
+	LinkSSOIdentity(ctx context.Context, groupID uuid.UUID, subject string, userID uuid.UUID) error
+	CreateSSOUser(ctx context.Context, groupID uuid.UUID, subject, email, username, passwordHash string) (db.User, error)
+	SyncSSOMembership(ctx context.Context, groupID, userID uuid.UUID, role string) ([]uuid.UUID, error)
+	CreateSCIMToken(ctx context.Context, name, tokenHash string, createdBy uuid.UUID) (db.SCIMToken, error)
+	ListSCIMTokens(ctx context.Context) ([]db.SCIMToken, error)
+	DeleteSCIMToken(ctx context.Context, id int64) error
+	UseSCIMToken(ctx context.Context, tokenHash string) (int64, error)
+	GetSCIMUser(ctx context.Context, userID uuid.UUID) (db.SCIMUser, error)
+	ListSCIMUsers(ctx context.Context, f db.SCIMFilter, offset, limit int) ([]db.SCIMUser, int, error)
+	CreateSCIMUser(ctx context.Context, u db.SCIMUser, username, passwordHash string) (db.SCIMUser, error)
+	UpdateSCIMUser(ctx context.Context, u db.SCIMUser) (db.SCIMUser, error)
+	DeleteSCIMUser(ctx context.Context, userID uuid.UUID) error
+	IsUserDeactivated(ctx context.Context, userID uuid.UUID) (bool, error)
+	GetSCIMGroup(ctx context.Context, id uuid.UUID) (db.SCIMGroup, error)
+	ListSCIMGroups(ctx context.Context, f db.SCIMFilter, offset, limit int) ([]db.SCIMGroup, int, error)
+	CreateSCIMGroup(ctx context.Context, displayName, externalID string) (db.SCIMGroup, error)
+	RenameSCIMGroup(ctx context.Context, id uuid.UUID, displayName, externalID string) error
+	AddSCIMGroupMembers(ctx context.Context, id uuid.UUID, userIDs []uuid.UUID) ([]uuid.UUID, []db.SCIMRoomChange, error)
+	RemoveSCIMGroupMembers(ctx context.Context, id uuid.UUID, userIDs []uuid.UUID) ([]uuid.UUID, []db.SCIMRoomChange, error)
+	DeleteSCIMGroup(ctx context.Context, id uuid.UUID) ([]db.SCIMRoomChange, error)
+	SetSCIMGroupTarget(ctx context.Context, id uuid.UUID, groupID, roomID *uuid.UUID) ([]db.SCIMRoomChange, error)
+	SyncLDAPUser(ctx context.Context, ldapID, dn, email, username string) (uuid.UUID, error)
+
+	ListLastMessages(ctx context.Context, viewerID uuid.UUID, roomIDs []uuid.UUID) (map[uuid.UUID]db.Message, error)
+	ListRoomEvents(ctx context.Context, roomID uuid.UUID, since int64, limit int) ([]db.RoomEvent, int64, error)
+	GetRoomWordMask(ctx context.Context, roomID uuid.UUID) (db.WordMask, error)
+	SetRoomWordMask(ctx context.Context, roomID uuid.UUID, wm db.WordMask) error
+	GetRoomMediaPolicy(ctx context.Context, roomID uuid.UUID) (db.MediaPolicy, error)
+	SetRoomMediaPolicy(ctx context.Context, roomID uuid.UUID, p db.MediaPolicy) error
+	Sync(ctx context.Context, userID uuid.UUID, since time.Time, perRoom int) (db.SyncDelta, error)
+	CreateSyncSnapshot(ctx context.Context, token string, userID uuid.UUID) error
+	GetSyncSnapshot(ctx context.Context, token string, userID uuid.UUID) (map[uuid.UUID]int64, error)
+	ListMessagesChangedSince(ctx context.Context, roomID uuid.UUID, seq int64, limit int) ([]db.Message, bool, error)
+	GetRoomWelcome(ctx context.Context, roomID uuid.UUID) (db.RoomWelcome, error)
+	SetRoomWelcome(ctx context.Context, roomID uuid.UUID, mode, template string, senderID uuid.UUID) error
+	SetRoomMentionPolicy(ctx context.Context, roomID uuid.UUID, policy string) error
+	CreateAutomodRule(ctx context.Context, rule db.AutomodRule) (db.AutomodRule, error)
+	UpdateAutomodRule(ctx context.Context, rule db.AutomodRule) (db.AutomodRule, error)
+	DeleteAutomodRule(ctx context.Context, roomID uuid.UUID, ruleID int64) error
+	ListAutomodEvents(ctx context.Context, roomID uuid.UUID, limit int) ([]db.AutomodEvent, error)
+	UnmuteRoomMember(ctx context.Context, roomID, userID uuid.UUID) error
+	GetInviteTarget(ctx context.Context, tokenHash string) (uuid.UUID, uuid.UUID, error)
+	GetRoomRaidMode(ctx context.Context, roomID uuid.UUID) (bool, error)
+	SetRoomRaidMode(ctx context.Context, roomID uuid.UUID, on bool) error
+	GetInvitePreview(ctx context.Context, tokenHash string) (db.InvitePreview, error)
+	GetRoomUnlisted(ctx context.Context, roomID uuid.UUID) (bool, error)
+	SetRoomUnlisted(ctx context.Context, roomID uuid.UUID, on bool) error
+	CreateJoinRequest(ctx context.Context, roomID, userID uuid.UUID, inviteLink string) (db.JoinRequest, error)
+	ListJoinRequests(ctx context.Context, roomID uuid.UUID) ([]db.JoinRequest, error)
+	ApproveJoinRequest(ctx context.Context, roomID, userID, approverID uuid.UUID) error
+	DeleteJoinRequest(ctx context.Context, roomID, userID uuid.UUID) error
+	ListRoomAdminIDs(ctx context.Context, roomID uuid.UUID) ([]uuid.UUID, error)
+	ListInstanceAdminIDs(ctx context.Context) ([]uuid.UUID, error)
+	GetRoomNSFW(ctx context.Context, roomID uuid.UUID) (bool, error)
+	SetRoomNSFW(ctx context.Context, roomID uuid.UUID, nsfw bool) error
+	RecordMembershipEvent(ctx context.Context, ev db.MembershipEvent) error
+	ListMembershipEvents(ctx context.Context, roomID uuid.UUID, beforeID int64, limit int) ([]db.MembershipEvent, error)
+	ListInviteLinkStats(ctx context.Context, roomID uuid.UUID) ([]db.InviteLinkStats, error)
+	CreateOwnershipTransfer(ctx context.Context, roomID, fromID, toID uuid.UUID, expiresAt time.Time) (db.OwnershipTransfer, error)
+	GetOwnershipTransfer(ctx context.Context, roomID uuid.UUID) (db.OwnershipTransfer, error)
+	AcceptOwnershipTransfer(ctx context.Context, roomID, toID uuid.UUID) (db.OwnershipTransfer, error)
+	DeleteOwnershipTransfer(ctx context.Context, roomID uuid.UUID) error
+	GetRoomLanguage(ctx context.Context, roomID uuid.UUID) (string, error)
+	SetRoomLanguage(ctx context.Context, roomID uuid.UUID, lang string) error
+	SetMessageNSFW(ctx context.Context, roomID uuid.UUID, messageID int64) error
+	SetMessageAudio(ctx context.Context, roomID uuid.UUID, messageID int64, info db.AudioInfo) error
+	SetMessageAltText(ctx context.Context, roomID uuid.UUID, messageID int64, altText string) error
+	SetGeneratedAltText(ctx context.Context, roomID uuid.UUID, messageID int64, altText string) error
+	CreateDirectUpload(ctx context.Context, u db.DirectUpload) error
+	GetDirectUpload(ctx context.Context, key string) (db.DirectUpload, error)
+	DeleteDirectUpload(ctx context.Context, key string) error
+	ReuseUploadBlob(ctx context.Context, location, sha256 string) (db.UploadBlob, error)
+	SaveUploadBlob(ctx context.Context, b db.UploadBlob) error
+	GetUserHideNSFW(ctx context.Context, userID uuid.UUID) (bool, error)
+	SetUserHideNSFW(ctx context.Context, userID uuid.UUID, hide bool) error
+	GetNotificationSettings(ctx context.Context, userID uuid.UUID) (db.NotificationSettings, error)
+	SetNotificationSettings(ctx context.Context, userID uuid.UUID, ns db.NotificationSettings) error
+	ListAdminEmailContacts(ctx context.Context, roomID uuid.UUID) ([]db.AdminContact, error)
+	GetUserKeywords(ctx context.Context, userID uuid.UUID) ([]string, error)
+	SetUserKeywords(ctx context.Context, userID uuid.UUID, keywords []string) error
+	ListBoardItems(ctx context.Context, userID uuid.UUID) ([]db.BoardItem, error)
+	CountBoardItems(ctx context.Context, userID uuid.UUID) (int, error)
+	AddBoardItem(ctx context.Context, userID uuid.UUID, item db.BoardItem) (db.BoardItem, bool, error)
+	UpdateBoardItem(ctx context.Context, userID uuid.UUID, itemID int64, note, title *string) (db.BoardItem, error)
+	DeleteBoardItem(ctx context.Context, userID uuid.UUID, itemID int64) error
+	ReorderBoardItems(ctx context.Context, userID uuid.UUID, itemIDs []int64) error
+	ListRoomCommands(ctx context.Context, roomID uuid.UUID) ([]db.RoomCommand, error)
+	GetRoomCommand(ctx context.Context, roomID uuid.UUID, name string) (db.RoomCommand, error)
+	CreateRoomCommand(ctx context.Context, c db.RoomCommand) (db.RoomCommand, error)
+	DeleteRoomCommand(ctx context.Context, roomID uuid.UUID, name string) error
+	SaveCommandMessage(ctx context.Context, roomID, userID uuid.UUID, commandID int64, content string, components []db.Component) (db.Message, error)
+	GetCommandMessage(ctx context.Context, roomID uuid.UUID, messageID int64) (db.RoomCommand, db.Message, error)
+	UpdateCommandMessage(ctx context.Context, roomID uuid.UUID, messageID int64, content string, components []db.Component) (db.Message, error)
+	ListLegalHolds(ctx context.Context, all bool) ([]db.LegalHold, error)
+	PlaceLegalHold(ctx context.Context, h db.LegalHold) (db.LegalHold, error)
+	ReleaseLegalHold(ctx context.Context, holdID int64, releasedBy uuid.UUID, note string) (db.LegalHold, error)
+	ExportMessages(ctx context.Context, f db.MessageExport, each func(db.DiscoveredMessage) error) error
+	SetRoomPersistCallChat(ctx context.Context, roomID uuid.UUID, persist bool) error
+	SaveCallFeedback(ctx context.Context, f db.CallFeedback) error
+	CallFeedbackStats(ctx context.Context, since time.Time) ([]db.CallFeedbackGroup, error)
+	GetRoomRegion(ctx context.Context, roomID uuid.UUID) (string, error)
+	SetRoomRegion(ctx context.Context, roomID uuid.UUID, region string) error
+	ListPlans(ctx context.Context) ([]db.Plan, error)
+	UpsertPlan(ctx context.Context, p db.Plan) error
+	DeletePlan(ctx context.Context, name string) error
+	SetUserPlan(ctx context.Context, userID uuid.UUID, plan string) error
+	SetGroupPlan(ctx context.Context, groupID uuid.UUID, plan string) error
+	GetUserPlan(ctx context.Context, userID uuid.UUID) (db.Plan, error)
+	GetRoomPlan(ctx context.Context, roomID uuid.UUID) (db.Plan, error)
+	GetGroupPlan(ctx context.Context, groupID uuid.UUID) (db.Plan, error)
+	CountRoomsCreatedBy(ctx context.Context, userID uuid.UUID) (int, error)
+	CountRoomMembers(ctx context.Context, roomID uuid.UUID) (int, error)
+	CountGroupMembers(ctx context.Context, groupID uuid.UUID) (int, error)
+	IsGroupMember(ctx context.Context, groupID, userID uuid.UUID) (bool, error)
+	RecordBillingEvent(ctx context.Context, eventID string) (bool, error)
+	ForgetBillingEvent(ctx context.Context, eventID string) error
+	ApplySubscription(ctx context.Context, sub db.Subscription, eventAt time.Time, entitled bool) (bool, error)
+	GetUserSubscription(ctx context.Context, userID uuid.UUID) (db.Subscription, error)
+	GetUserAge(ctx context.Context, userID uuid.UUID) (db.AgeSettings, error)
+	SetUserDateOfBirth(ctx context.Context, userID uuid.UUID, dob *time.Time) error
+	SetUserAgeRestricted(ctx context.Context, userID uuid.UUID, restricted *bool) error
+	ListProfileFields(ctx context.Context) ([]profile.Field, error)
+	UpsertProfileField(ctx context.Context, f profile.Field) error
+	DeleteProfileField(ctx context.Context, key string) error
+	GetUserProfile(ctx context.Context, userID uuid.UUID) (map[string]string, error)
+	UpdateUserProfile(ctx context.Context, userID uuid.UUID, changes map[string]*string) (map[string]string, error)
+	GetUserLocale(ctx context.Context, userID uuid.UUID) (db.UserLocale, error)
+	SetUserLocale(ctx context.Context, userID uuid.UUID, l db.UserLocale) error
+	GetContactSharing(ctx context.Context, userID uuid.UUID) (string, error)
+	SetContactSharing(ctx context.Context, userID uuid.UUID, sharing string) error
+	SaveContactMessage(ctx context.Context, roomID, userID, contactID uuid.UUID) (db.Message, error)
+	SetRichPresence(ctx context.Context, p db.RichPresence) (db.RichPresence, error)
+	ClearRichPresence(ctx context.Context, userID uuid.UUID, source string) error
+	ListRichPresence(ctx context.Context, userIDs []uuid.UUID) ([]db.RichPresence, error)
+	GetRoomSettings(ctx context.Context, roomID uuid.UUID) (db.RoomSettings, error)
+	ListRoomMemberDetails(ctx context.Context, roomID uuid.UUID) ([]db.RoomMemberDetail, error)
+	SetupRequired(ctx context.Context) (bool, error)
+	GetInstanceSettings(ctx context.Context) (db.InstanceSettings, error)
+	CompleteSetup(ctx context.Context, email, username, passwordHash string, settings db.InstanceSettings) (db.User, error)
+	DeleteExpiredRichPresence(ctx context.Context) ([]uuid.UUID, error)
+	GetRoomEmbed(ctx context.Context, roomID uuid.UUID) (db.RoomEmbed, error)
+	SetRoomEmbed(ctx context.Context, roomID, createdBy uuid.UUID, tokenHash string) (db.RoomEmbed, error)
+	DeleteRoomEmbed(ctx context.Context, roomID uuid.UUID) error
+	FindEmbedRoom(ctx context.Context, tokenHash string) (db.EmbedRoom, error)
+	ListAutomations(ctx context.Context, ownerID uuid.UUID) ([]db.Automation, error)
+	GetAutomation(ctx context.Context, ownerID uuid.UUID, id int64) (db.Automation, error)
+	CountAutomations(ctx context.Context, ownerID uuid.UUID) (int, error)
+	CreateAutomation(ctx context.Context, a db.Automation) (db.Automation, error)
+	UpdateAutomation(ctx context.Context, a db.Automation) (db.Automation, error)
+	DeleteAutomation(ctx context.Context, ownerID uuid.UUID, id int64) error
+	ListAutomationRuns(ctx context.Context, automationID int64, limit int) ([]db.AutomationRun, error)
+	SaveAutomationMessage(ctx context.Context, roomID, userID uuid.UUID, automationID int64, content string) (db.Message, error)
+	ListRepoLinks(ctx context.Context, roomID uuid.UUID) ([]db.RepoLink, error)
+	GetRepoLink(ctx context.Context, id int64) (db.RepoLink, error)
+	CreateRepoLink(ctx context.Context, l db.RepoLink) (db.RepoLink, error)
+	SetRepoLinkEvents(ctx context.Context, roomID uuid.UUID, id int64, events []string) error
+	DeleteRepoLink(ctx context.Context, roomID uuid.UUID, id int64) error
+	ListUptimeMonitors(ctx context.Context) ([]db.UptimeMonitor, error)
+	ListPublicUptimeMonitors(ctx context.Context) ([]db.UptimeMonitor, error)
+	GetUptimeMonitor(ctx context.Context, id int64) (db.UptimeMonitor, error)
+	CreateUptimeMonitor(ctx context.Context, m db.UptimeMonitor) (db.UptimeMonitor, error)
+	UpdateUptimeMonitor(ctx context.Context, m db.UptimeMonitor) (db.UptimeMonitor, error)
+	DeleteUptimeMonitor(ctx context.Context, id int64) error
+	GetModerationDictionary(ctx context.Context, id int64) (db.ModerationDictionary, error)
+	CreateModerationDictionary(ctx context.Context, d db.ModerationDictionary) (db.ModerationDictionary, error)
+	UpdateModerationDictionary(ctx context.Context, d db.ModerationDictionary) (db.ModerationDictionary, error)
+	DeleteModerationDictionary(ctx context.Context, id int64) error
+	ListRoomSizes(ctx context.Context, f db.RoomSizeFilter) ([]db.RoomSize, error)
+	MarkWelcomeSent(ctx context.Context, roomID, userID uuid.UUID) (bool, error)
+	ListRoomUnreadStates(ctx context.Context, userID uuid.UUID, roomIDs []uuid.UUID) ([]db.RoomUnreadState, error)
+	CreateGuestInviteLink(ctx context.Context, tokenHash string, roomID, createdBy uuid.UUID, guestDays int, expiresAt time.Time) error
+	CreateGuestFromInvite(ctx context.Context, tokenHash, email, username, passwordHash string) (db.User, uuid.UUID, error)
+	CreateDeviceLink(ctx context.Context, userID uuid.UUID, codeHash string, expiresAt time.Time) (db.DeviceLink, error)
+	GetDeviceLink(ctx context.Context, userID uuid.UUID, codeHash string) (db.DeviceLink, error)
+	ClaimDeviceLink(ctx context.Context, codeHash, claimHash, deviceName string) (db.DeviceLink, error)
+	ApproveDeviceLink(ctx context.Context, userID uuid.UUID, codeHash string) (db.DeviceLink, error)
+	DeleteDeviceLink(ctx context.Context, userID uuid.UUID, codeHash string) error
+	PollDeviceLink(ctx context.Context, codeHash, claimHash string) (db.DeviceLink, error)
+
+	SetUserShadowBanned(ctx context.Context, userID uuid.UUID, banned bool) error
+
+	RecordLogin(ctx context.Context, userID uuid.UUID, ip, country, deviceHash, userAgent string) (db.LoginNovelty, error)
+	ListLoginEvents(ctx context.Context, userID uuid.UUID, limit int) ([]db.LoginEvent, error)
+	CreateNotification(ctx context.Context, userID uuid.UUID, kind, title, body string, data any) (db.Notification, error)
+	ListNotifications(ctx context.Context, userID uuid.UUID, limit int) ([]db.Notification, error)
+	MarkNotificationRead(ctx context.Context, userID uuid.UUID, id int64) error
+}
@@ -0,0 +1,105 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+)
+
+const (
+	// syncOverlap is how far before ?since= a sync looks, so rows committed
+	// late by a slow transaction are not skipped. Clients dedupe by id.
+	syncOverlap = 5 * time.Second
+	// maxSyncAge is the oldest sync point served; past it a client reloads
+	// through /api/bootstrap instead.
+	maxSyncAge = 30 * 24 * time.Hour
+)
+
+type syncResponse struct {
+	db.SyncDelta
+	// NextBatch is the since value for the next sync, in unix milliseconds.
+	NextBatch int64 `json:"next_batch"`
+}
+
+// sync returns what changed for the user since ?since=, either the
+// next_batch of their previous sync or an RFC 3339 timestamp, so a client
+// that was offline catches up in one request. ?limit= caps new messages per
+// room; rooms that had more are marked limited.
+func (s *Server) sync(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	now := time.Now()
+	since, ok := parseSyncSince(r.URL.Query().Get("since"))
+	if !ok {
+		jsonError(w, http.StatusBadRequest, "invalid since")
+		return
+	}
+	if now.Sub(since) > maxSyncAge {
+		jsonError(w, http.StatusGone, "since is too old, reload instead")
+		return
+	}
+	limit := 20
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			jsonError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = min(n, 100)
+	}
+
+	delta, err := s.Store.Sync(r.Context(), user.ID, since.Add(-syncOverlap), limit)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to sync")
+		return
+	}
+	hideNSFW, err := s.hidesNSFW(r.Context(), user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load content settings")
+		return
+	}
+	// Members who opted out of NSFW content are refused NSFW rooms, so
+	// those rooms' content is left out like it is from the history.
+	rooms := delta.Rooms[:0]
+	for _, room := range delta.Rooms {
+		if hideNSFW {
+			nsfw, err := s.Store.GetRoomNSFW(r.Context(), room.RoomID)
+			if err != nil && err != db.ErrNotFound {
+				jsonError(w, http.StatusInternalServerError, "failed to load room")
+				return
+			}
+			if nsfw || err == db.ErrNotFound {
+				continue
+			}
+		}
+		room.Messages = s.maskFor(r.Context(), room.RoomID, user.ID, viewable(room.Messages, user.ID, hideNSFW))
+		rooms = append(rooms, room)
+	}
+	delta.Rooms = rooms
+	jsonResponse(w, http.StatusOK, syncResponse{SyncDelta: delta, NextBatch: now.UnixMilli()})
+}
+
+// parseSyncSince accepts unix milliseconds, as handed out in next_batch, or
+// an RFC 3339 timestamp.
+func parseSyncSince(raw string) (time.Time, bool) {
+	if raw == "" {
+		return time.Time{}, false
+	}
+	if ms, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		if ms < 0 {
+			return time.Time{}, false
+		}
+		return time.UnixMilli(ms), true
+	}
+	t, err := time.Parse(time.RFC3339Nano, raw)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
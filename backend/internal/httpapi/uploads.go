@@ -2,22 +2,27 @@ package httpapi
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"talkie/backend/internal/db"
 	"talkie/backend/internal/middleware"
+	"talkie/backend/internal/storage"
+	"talkie/backend/internal/textnorm"
 	"talkie/backend/internal/ws"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 )
 
-const maxImageUploadSize = 8 << 20 // 8MB
-
 func (s *Server) uploadRoomImage(w http.ResponseWriter, r *http.Request) {
 	user, ok := middleware.UserFromContext(r.Context())
 	if !ok {
@@ -44,9 +49,12 @@ func (s *Server) uploadRoomImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	r.Body = http.MaxBytesReader(w, r.Body, maxImageUploadSize)
-	if err := r.ParseMultipartForm(maxImageUploadSize); err != nil {
-		jsonError(w, http.StatusBadRequest, "invalid upload payload or file too large")
+	limits, err := s.roomLimits(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load quota")
+		return
+	}
+	if !parseUpload(w, r, uploadLimit(limits)) {
 		return
 	}
 
@@ -56,6 +64,14 @@ func (s *Server) uploadRoomImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer file.Close()
+	caption := strings.TrimSpace(textnorm.Message(r.FormValue("caption")))
+	if !s.checkMessageLength(w, caption) {
+		return
+	}
+	altText, ok := parseAltText(w, r.FormValue("alt_text"))
+	if !ok {
+		return
+	}
 
 	head := make([]byte, 512)
 	n, err := io.ReadFull(file, head)
@@ -70,44 +86,119 @@ func (s *Server) uploadRoomImage(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusBadRequest, "only png, jpeg, webp or gif images are allowed")
 		return
 	}
-
-	roomDir := filepath.Join(s.Cfg.UploadsDir, roomID.String())
-	if err := os.MkdirAll(roomDir, 0o755); err != nil {
-		jsonError(w, http.StatusInternalServerError, "failed to prepare uploads directory")
+	if !s.checkMediaType(w, r, roomID, contentType) {
 		return
 	}
 
-	filename := fmt.Sprintf("%s%s", uuid.NewString(), ext)
-	targetPath := filepath.Join(roomDir, filename)
-	target, err := os.Create(targetPath)
+	region, err := s.Store.GetRoomRegion(r.Context(), roomID)
 	if err != nil {
-		jsonError(w, http.StatusInternalServerError, "failed to store image")
+		jsonError(w, http.StatusInternalServerError, "failed to load room")
 		return
 	}
-	defer target.Close()
-
-	if _, err := io.Copy(target, io.MultiReader(bytes.NewReader(head), file)); err != nil {
+	stored, err := s.storeUpload(r.Context(), s.Uploads.For(region), io.MultiReader(bytes.NewReader(head), file), ext, contentType, true)
+	if err != nil {
+		log.Printf("store image for room %s: %v", roomID, err)
 		jsonError(w, http.StatusInternalServerError, "failed to store image")
 		return
 	}
 
-	caption := strings.TrimSpace(r.FormValue("caption"))
 	if caption == "" {
 		caption = header.Filename
 	}
-	relativeURL := fmt.Sprintf("/uploads/%s/%s", roomID.String(), filename)
-	msg, err := s.Store.SaveMessageWithType(r.Context(), roomID, user.ID, caption, "image", relativeURL)
+	msg, err := s.Store.SaveMessageWithType(r.Context(), roomID, user.ID, caption, "image", stored.URL)
 	if err != nil {
 		jsonError(w, http.StatusInternalServerError, "failed to create image message")
 		return
 	}
+	if stored.NSFW && !msg.NSFW {
+		if err := s.Store.SetMessageNSFW(r.Context(), roomID, msg.ID); err != nil {
+			log.Printf("flag nsfw upload %d: %v", msg.ID, err)
+		} else {
+			msg.NSFW = true
+		}
+	}
+	s.attachAltText(r.Context(), &msg, altText, contentType, func(context.Context) ([]byte, error) {
+		return os.ReadFile(stored.Path)
+	})
 
+	s.History.Append(msg)
 	payload := ws.PayloadFromMessage(msg)
-	s.Hub.Broadcast(roomID, ws.OutgoingMessage{Type: "chat", Message: &payload})
-	s.broadcastRoomMessageEvent(r.Context(), roomID, user.ID, payload)
+	if msg.Shadowed {
+		s.Hub.SendToRoomUser(roomID, user.ID, ws.ChatEvent{Message: payload})
+		jsonResponse(w, http.StatusCreated, msg)
+		return
+	}
+	s.Hub.Broadcast(roomID, ws.ChatEvent{Message: payload})
+	s.broadcastRoomMessageEvent(r.Context(), msg)
 	jsonResponse(w, http.StatusCreated, msg)
 }
 
+// storedUpload is where storeUpload put a file.
+type storedUpload struct {
+	URL  string
+	Path string
+	// NSFW is the classifier's verdict, when classification was asked for.
+	NSFW bool
+}
+
+// storeUpload writes content to its content-addressed path in loc. A file
+// with the same content already stored there is reused, along with its
+// earlier NSFW verdict, so identical uploads take the space of one. With
+// classify set, new images go through the NSFW classifier. Recording the
+// hash is best effort; the file is stored either way.
+func (s *Server) storeUpload(ctx context.Context, loc storage.Location, content io.Reader, ext, contentType string, classify bool) (storedUpload, error) {
+	blobDir := loc.Path(storage.BlobDir)
+	if err := os.MkdirAll(blobDir, 0o755); err != nil {
+		return storedUpload{}, err
+	}
+	tmp, err := os.CreateTemp(blobDir, ".upload-*")
+	if err != nil {
+		return storedUpload{}, err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(tmp, io.TeeReader(content, hash))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return storedUpload{}, err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	rel := storage.ContentPath(sum, ext)
+	out := storedUpload{URL: loc.URL(rel), Path: loc.Path(filepath.FromSlash(rel))}
+
+	blob, err := s.Store.ReuseUploadBlob(ctx, loc.URLPrefix, sum)
+	switch {
+	case err == nil:
+		// Blobs recorded before content addressing live at their old path.
+		old := loc.Path(filepath.FromSlash(strings.TrimPrefix(blob.URL, loc.URLPrefix+"/")))
+		if _, statErr := os.Stat(old); statErr == nil {
+			_ = os.Remove(tmp.Name())
+			return storedUpload{URL: blob.URL, Path: old, NSFW: blob.NSFW}, nil
+		}
+	case err != db.ErrNotFound:
+		log.Printf("upload dedup lookup: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(out.Path), 0o755); err != nil {
+		_ = os.Remove(tmp.Name())
+		return storedUpload{}, err
+	}
+	// Renaming over an identical file that lost its row is harmless.
+	if err := os.Rename(tmp.Name(), out.Path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return storedUpload{}, err
+	}
+	if classify {
+		out.NSFW = s.classifyUpload(ctx, out.Path, contentType)
+	}
+	if err := s.Store.SaveUploadBlob(ctx, db.UploadBlob{Location: loc.URLPrefix, SHA256: sum, URL: out.URL, Size: size, NSFW: out.NSFW}); err != nil {
+		log.Printf("record upload blob %s: %v", out.URL, err)
+	}
+	return out, nil
+}
+
 func (s *Server) uploadMyAvatar(w http.ResponseWriter, r *http.Request) {
 	user, ok := middleware.UserFromContext(r.Context())
 	if !ok {
@@ -115,9 +206,12 @@ func (s *Server) uploadMyAvatar(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	r.Body = http.MaxBytesReader(w, r.Body, maxImageUploadSize)
-	if err := r.ParseMultipartForm(maxImageUploadSize); err != nil {
-		jsonError(w, http.StatusBadRequest, "invalid upload payload or file too large")
+	limits, _, err := s.userLimits(r.Context(), user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load quota")
+		return
+	}
+	if !parseUpload(w, r, uploadLimit(limits)) {
 		return
 	}
 
@@ -141,8 +235,11 @@ func (s *Server) uploadMyAvatar(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusBadRequest, "only png, jpeg, webp or gif images are allowed")
 		return
 	}
+	if !s.checkMediaType(w, r, uuid.Nil, contentType) {
+		return
+	}
 
-	avatarDir := filepath.Join(s.Cfg.UploadsDir, "avatars", user.ID.String())
+	avatarDir := s.Uploads.Default().Path("avatars", user.ID.String())
 	if err := os.MkdirAll(avatarDir, 0o755); err != nil {
 		jsonError(w, http.StatusInternalServerError, "failed to prepare uploads directory")
 		return
@@ -162,6 +259,12 @@ func (s *Server) uploadMyAvatar(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if s.classifyUpload(r.Context(), targetPath, contentType) {
+		_ = os.Remove(targetPath)
+		jsonError(w, http.StatusBadRequest, "this image was flagged as NSFW and cannot be used as an avatar")
+		return
+	}
+
 	relativeURL := fmt.Sprintf("/uploads/avatars/%s/%s", user.ID.String(), filename)
 	if err := s.Store.UpdateUserAvatar(r.Context(), user.ID, relativeURL); err != nil {
 		jsonError(w, http.StatusInternalServerError, "failed to save avatar")
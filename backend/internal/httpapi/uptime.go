@@ -0,0 +1,275 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+	"talkie/backend/internal/notify"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	maxUptimeMonitors   = 100
+	maxUptimeName       = 100
+	maxUptimeURL        = 2048
+	defaultUptimeCheck  = 60
+	minUptimeCheck      = 30
+	maxUptimeCheck      = 3600
+	uptimeAlertDeadline = 15 * time.Second
+)
+
+// statusMonitor is a monitor as the public status page shows it, without
+// its URL or room.
+type statusMonitor struct {
+	Name          string     `json:"name"`
+	State         string     `json:"state"`
+	LastCheckedAt *time.Time `json:"last_checked_at,omitempty"`
+	LastChangeAt  *time.Time `json:"last_change_at,omitempty"`
+}
+
+func (s *Server) listUptimeMonitors(w http.ResponseWriter, r *http.Request) {
+	monitors, err := s.Store.ListUptimeMonitors(r.Context())
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load monitors")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"monitors": monitors})
+}
+
+// createUptimeMonitor registers a URL to probe. Alerts go to room_id, which
+// the admin must be in, since they are posted as them.
+func (s *Server) createUptimeMonitor(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	m := db.UptimeMonitor{IntervalS: defaultUptimeCheck, CreatedBy: &user.ID}
+	if !s.decodeUptimeMonitor(w, r, &m) {
+		return
+	}
+	existing, err := s.Store.ListUptimeMonitors(r.Context())
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load monitors")
+		return
+	}
+	if len(existing) >= maxUptimeMonitors {
+		jsonError(w, http.StatusConflict, fmt.Sprintf("at most %d monitors", maxUptimeMonitors))
+		return
+	}
+	created, err := s.Store.CreateUptimeMonitor(r.Context(), m)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to save monitor")
+		return
+	}
+	jsonResponse(w, http.StatusCreated, created)
+}
+
+// updateUptimeMonitor changes the fields present in the body.
+func (s *Server) updateUptimeMonitor(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "monitorID"), 10, 64)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid monitor id")
+		return
+	}
+	m, err := s.Store.GetUptimeMonitor(r.Context(), id)
+	if err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "monitor not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to load monitor")
+		return
+	}
+	if !s.decodeUptimeMonitor(w, r, &m) {
+		return
+	}
+	updated, err := s.Store.UpdateUptimeMonitor(r.Context(), m)
+	if err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "monitor not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to save monitor")
+		return
+	}
+	jsonResponse(w, http.StatusOK, updated)
+}
+
+func (s *Server) deleteUptimeMonitor(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "monitorID"), 10, 64)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid monitor id")
+		return
+	}
+	if err := s.Store.DeleteUptimeMonitor(r.Context(), id); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "monitor not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to delete monitor")
+		return
+	}
+	jsonResponse(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+// statusPage lists the public monitors and whether each is up, for anyone.
+func (s *Server) statusPage(w http.ResponseWriter, r *http.Request) {
+	monitors, err := s.Store.ListPublicUptimeMonitors(r.Context())
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load status")
+		return
+	}
+	out := make([]statusMonitor, len(monitors))
+	status := db.UptimeUp
+	for i, m := range monitors {
+		out[i] = statusMonitor{Name: m.Name, State: m.State, LastCheckedAt: m.LastCheckedAt, LastChangeAt: m.LastChangeAt}
+		if m.State == db.UptimeDown {
+			status = db.UptimeDown
+		}
+	}
+	jsonResponse(w, http.StatusOK, map[string]any{"status": status, "monitors": out})
+}
+
+// decodeUptimeMonitor applies the request body to m and checks the result.
+// It writes the response when it returns false.
+func (s *Server) decodeUptimeMonitor(w http.ResponseWriter, r *http.Request, m *db.UptimeMonitor) bool {
+	var req struct {
+		Name         *string    `json:"name"`
+		URL          *string    `json:"url"`
+		RoomID       *uuid.UUID `json:"room_id"`
+		IntervalS    *int       `json:"interval_s"`
+		ExpectStatus *int       `json:"expect_status"`
+		Public       *bool      `json:"public"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return false
+	}
+	if req.Name != nil {
+		m.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.URL != nil {
+		m.URL = strings.TrimSpace(*req.URL)
+	}
+	if req.RoomID != nil {
+		m.RoomID = *req.RoomID
+	}
+	if req.IntervalS != nil {
+		m.IntervalS = *req.IntervalS
+	}
+	if req.ExpectStatus != nil {
+		m.ExpectStatus = *req.ExpectStatus
+	}
+	if req.Public != nil {
+		m.Public = *req.Public
+	}
+
+	if m.Name == "" || utf8.RuneCountInString(m.Name) > maxUptimeName {
+		jsonError(w, http.StatusBadRequest, fmt.Sprintf("name must be 1 to %d characters", maxUptimeName))
+		return false
+	}
+	u, err := url.Parse(m.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(m.URL) > maxUptimeURL {
+		jsonError(w, http.StatusBadRequest, "url must be an http or https link")
+		return false
+	}
+	if m.IntervalS < minUptimeCheck || m.IntervalS > maxUptimeCheck {
+		jsonError(w, http.StatusBadRequest, fmt.Sprintf("interval_s must be %d to %d", minUptimeCheck, maxUptimeCheck))
+		return false
+	}
+	if m.ExpectStatus != 0 && (m.ExpectStatus < 100 || m.ExpectStatus > 599) {
+		jsonError(w, http.StatusBadRequest, "expect_status must be an HTTP status code")
+		return false
+	}
+	if req.RoomID != nil || m.ID == 0 {
+		user, _ := middleware.UserFromContext(r.Context())
+		member, err := s.Store.IsRoomMember(r.Context(), m.RoomID, user.ID)
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "failed to check membership")
+			return false
+		}
+		if !member {
+			jsonError(w, http.StatusBadRequest, "room_id must be a room you are in")
+			return false
+		}
+		// Alerts in a moved monitor are posted by whoever moved it.
+		m.CreatedBy = &user.ID
+	}
+	return true
+}
+
+// UptimeChanged posts that m went down or came back to its room, as the
+// admin who set it up, and notifies the room's admins.
+func (s *Server) UptimeChanged(ctx context.Context, m db.UptimeMonitor, previous string) {
+	ctx, cancel := context.WithTimeout(ctx, uptimeAlertDeadline)
+	defer cancel()
+	var title, text string
+	if m.State == db.UptimeDown {
+		title = fmt.Sprintf("%s is down", m.Name)
+		text = fmt.Sprintf("%s is down: %s\n%s", m.Name, m.LastError, m.URL)
+	} else {
+		title = fmt.Sprintf("%s is back up", m.Name)
+		text = fmt.Sprintf("%s is back up.\n%s", m.Name, m.URL)
+	}
+
+	if m.CreatedBy != nil {
+		member, err := s.Store.IsRoomMember(ctx, m.RoomID, *m.CreatedBy)
+		switch {
+		case err != nil:
+			log.Printf("uptime alert for monitor %d: %v", m.ID, err)
+		case !member:
+			log.Printf("uptime alert for monitor %d: %s is no longer in room %s", m.ID, *m.CreatedBy, m.RoomID)
+		default:
+			msg, err := s.Store.SaveMessage(ctx, m.RoomID, *m.CreatedBy, text, nil)
+			if err != nil {
+				log.Printf("uptime alert for monitor %d: save message: %v", m.ID, err)
+			} else {
+				s.publishMessage(ctx, msg)
+			}
+		}
+	}
+
+	admins, err := s.Store.ListRoomAdminIDs(ctx, m.RoomID)
+	if err != nil {
+		log.Printf("uptime alert for monitor %d: list admins: %v", m.ID, err)
+		return
+	}
+	kind := "uptime." + m.State
+	body := m.URL
+	if m.LastError != "" && m.State == db.UptimeDown {
+		body = m.LastError
+	}
+	for _, adminID := range admins {
+		n, err := s.Store.CreateNotification(ctx, adminID, kind, title, body, map[string]any{
+			"monitor_id": m.ID,
+			"room_id":    m.RoomID,
+			"state":      m.State,
+			"previous":   previous,
+		})
+		if err != nil {
+			log.Printf("uptime alert for monitor %d: notify %s: %v", m.ID, adminID, err)
+			continue
+		}
+		s.Hub.SendNotification(n)
+	}
+	s.Notifier.Dispatch(admins, notify.Event{
+		Kind:   kind,
+		Title:  title,
+		Body:   body,
+		RoomID: m.RoomID.String(),
+		Data:   map[string]string{"monitor_id": strconv.FormatInt(m.ID, 10)},
+	})
+}
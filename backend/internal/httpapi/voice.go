@@ -0,0 +1,156 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+	"talkie/backend/internal/waveform"
+	"talkie/backend/internal/ws"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// uploadVoiceNote stores a recorded audio clip as an "audio" message. The
+// waveform is computed before the message is broadcast so it arrives with
+// it; if the format cannot be decoded the note is still sent, without one.
+func (s *Server) uploadVoiceNote(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return
+	}
+	if _, err := s.Store.GetRoomByID(r.Context(), roomID); err != nil {
+		jsonError(w, http.StatusNotFound, "room not found")
+		return
+	}
+	member, err := s.Store.IsRoomMember(r.Context(), roomID, user.ID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check membership")
+		return
+	}
+	if !member {
+		jsonError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+
+	limits, err := s.roomLimits(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load quota")
+		return
+	}
+	if !parseUpload(w, r, uploadLimit(limits)) {
+		return
+	}
+
+	file, _, err := r.FormFile("audio")
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "missing audio file")
+		return
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		jsonError(w, http.StatusBadRequest, "failed to read audio")
+		return
+	}
+	head = head[:n]
+	contentType := http.DetectContentType(head)
+	ext, valid := audioExt(contentType)
+	if !valid {
+		jsonError(w, http.StatusBadRequest, "only webm, ogg, mp4, mp3 or wav audio is allowed")
+		return
+	}
+	if !s.checkMediaType(w, r, roomID, contentType) {
+		return
+	}
+
+	region, err := s.Store.GetRoomRegion(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load room")
+		return
+	}
+	stored, err := s.storeUpload(r.Context(), s.Uploads.For(region), io.MultiReader(bytes.NewReader(head), file), ext, contentType, false)
+	if err != nil {
+		log.Printf("store voice note for room %s: %v", roomID, err)
+		jsonError(w, http.StatusInternalServerError, "failed to store audio")
+		return
+	}
+
+	audio := s.analyzeVoiceNote(r.Context(), stored.Path, contentType)
+	msg, err := s.Store.SaveMessageWithType(r.Context(), roomID, user.ID, "", "audio", stored.URL)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to create audio message")
+		return
+	}
+	if audio != nil {
+		if err := s.Store.SetMessageAudio(r.Context(), roomID, msg.ID, *audio); err != nil {
+			log.Printf("save waveform for message %d: %v", msg.ID, err)
+		} else {
+			msg.Audio = audio
+		}
+	}
+
+	s.History.Append(msg)
+	payload := ws.PayloadFromMessage(msg)
+	if msg.Shadowed {
+		s.Hub.SendToRoomUser(roomID, user.ID, ws.ChatEvent{Message: payload})
+		jsonResponse(w, http.StatusCreated, msg)
+		return
+	}
+	s.Hub.Broadcast(roomID, ws.ChatEvent{Message: payload})
+	s.broadcastRoomMessageEvent(r.Context(), msg)
+	jsonResponse(w, http.StatusCreated, msg)
+}
+
+// analyzeVoiceNote computes the waveform of a stored clip, or returns nil
+// when it cannot. Formats other than WAV need FFMPEG_PATH.
+func (s *Server) analyzeVoiceNote(ctx context.Context, path, contentType string) *db.AudioInfo {
+	start := time.Now()
+	info, err := s.Waveform.Analyze(ctx, path, contentType)
+	if err != nil {
+		if !errors.Is(err, waveform.ErrUnsupported) {
+			log.Printf("waveform %s: %v", path, err)
+		}
+		return nil
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		log.Printf("waveform %s took %s", path, elapsed)
+	}
+	return &db.AudioInfo{Waveform: info.Waveform, DurationMS: info.DurationMS}
+}
+
+// audioExt maps sniffed types to extensions. Browsers record webm (Chrome,
+// Firefox) or mp4 (Safari), which sniff as video; the extension is what
+// the uploads handler serves them by.
+func audioExt(contentType string) (string, bool) {
+	switch contentType {
+	case "video/webm":
+		return ".webm", true
+	case "application/ogg":
+		return ".ogg", true
+	case "video/mp4":
+		return ".m4a", true
+	case "audio/mpeg":
+		return ".mp3", true
+	case "audio/wave":
+		return ".wav", true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,46 @@
+package httpapi
+
+import (
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// webUIAssetCache is for Vite's build output under assets/, whose file
+// names carry a content hash.
+const webUIAssetCache = "public, max-age=31536000, immutable"
+
+// serveWebUI serves the web client from s.WebUI for any GET that no other
+// route matched. Paths that neither are a file nor look like one get
+// index.html, so the client's own routes survive a reload; under /api/,
+// /ws/ and /uploads/ a miss stays a 404.
+func (s *Server) serveWebUI(w http.ResponseWriter, r *http.Request) {
+	p := r.URL.Path
+	if strings.HasPrefix(p, "/api/") || strings.HasPrefix(p, "/ws/") || strings.HasPrefix(p, "/uploads/") ||
+		(r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		jsonError(w, http.StatusNotFound, "not found")
+		return
+	}
+	// The client's files are small enough to always send whole, and a
+	// partial response must not be gzipped.
+	r.Header.Del("Range")
+	name := strings.TrimPrefix(path.Clean(p), "/")
+	if info, err := fs.Stat(s.WebUI, name); name == "" || err != nil || info.IsDir() {
+		// A missing file, such as an asset from before a deploy, must not
+		// be answered with HTML.
+		if err != nil && path.Ext(name) != "" {
+			http.NotFound(w, r)
+			return
+		}
+		name = "index.html"
+	}
+	if name == "index.html" {
+		// index.html names the current asset bundle, so it is always
+		// revalidated.
+		w.Header().Set("Cache-Control", "no-cache")
+	} else if strings.HasPrefix(name, "assets/") {
+		w.Header().Set("Cache-Control", webUIAssetCache)
+	}
+	http.ServeFileFS(w, r, s.WebUI, name)
+}
@@ -0,0 +1,176 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/middleware"
+	"talkie/backend/internal/ws"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const maxWelcomeTemplateLength = 2000
+
+// authorizeRoomAdmin checks that the room exists and userID administers it,
+// writing the error response when not.
+func (s *Server) authorizeRoomAdmin(w http.ResponseWriter, r *http.Request, roomID, userID uuid.UUID) bool {
+	if _, err := s.Store.GetRoomByID(r.Context(), roomID); err != nil {
+		jsonError(w, http.StatusNotFound, "room not found")
+		return false
+	}
+	member, err := s.Store.IsRoomMember(r.Context(), roomID, userID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check membership")
+		return false
+	}
+	if !member {
+		jsonError(w, http.StatusForbidden, "forbidden")
+		return false
+	}
+	admin, err := s.Store.IsRoomAdmin(r.Context(), roomID, userID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check room role")
+		return false
+	}
+	if !admin {
+		jsonError(w, http.StatusForbidden, "admin role required")
+		return false
+	}
+	return true
+}
+
+func (s *Server) getRoomWelcome(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return
+	}
+	if !s.authorizeRoomAdmin(w, r, roomID, user.ID) {
+		return
+	}
+	welcome, err := s.Store.GetRoomWelcome(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to load welcome message")
+		return
+	}
+	jsonResponse(w, http.StatusOK, welcome)
+}
+
+// setRoomWelcome configures the greeting new members get. The template may
+// use {username} and {room}; the greeting is sent as the admin saving it.
+func (s *Server) setRoomWelcome(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid room id")
+		return
+	}
+	var req struct {
+		Mode     string `json:"mode"`
+		Template string `json:"template"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	req.Template = strings.TrimSpace(req.Template)
+	if !slices.Contains(db.WelcomeModes, req.Mode) {
+		jsonError(w, http.StatusBadRequest, "mode must be off, room or dm")
+		return
+	}
+	if req.Mode != "off" && req.Template == "" {
+		jsonError(w, http.StatusBadRequest, "template is required")
+		return
+	}
+	if utf8.RuneCountInString(req.Template) > maxWelcomeTemplateLength {
+		jsonError(w, http.StatusBadRequest, "template is too long")
+		return
+	}
+	if !s.authorizeRoomAdmin(w, r, roomID, user.ID) {
+		return
+	}
+	direct, err := s.Store.IsDirectRoom(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check room type")
+		return
+	}
+	if direct {
+		jsonError(w, http.StatusBadRequest, "direct messages have no welcome message")
+		return
+	}
+	if err := s.Store.SetRoomWelcome(r.Context(), roomID, req.Mode, req.Template, user.ID); err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to save welcome message")
+		return
+	}
+	jsonResponse(w, http.StatusOK, db.RoomWelcome{Mode: req.Mode, Template: req.Template, SenderID: &user.ID})
+}
+
+func renderWelcome(template, username, roomName string) string {
+	return strings.NewReplacer("{username}", username, "{room}", roomName).Replace(template)
+}
+
+// welcomeMember sends roomID's greeting to a member who just joined, once.
+// It runs after the join has been answered, so failures are only logged.
+func (s *Server) welcomeMember(roomID, userID uuid.UUID) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	welcome, err := s.Store.GetRoomWelcome(ctx, roomID)
+	if err != nil || welcome.Mode == "off" || welcome.SenderID == nil || *welcome.SenderID == userID {
+		return
+	}
+	sent, err := s.Store.MarkWelcomeSent(ctx, roomID, userID)
+	if err != nil || !sent {
+		return
+	}
+	room, err := s.Store.GetRoomByID(ctx, roomID)
+	if err != nil {
+		return
+	}
+	u, err := s.Store.FindUserByID(ctx, userID)
+	if err != nil {
+		return
+	}
+	text := renderWelcome(welcome.Template, u.Username, room.Name)
+	senderID := *welcome.SenderID
+
+	target := roomID
+	if welcome.Mode == "dm" {
+		dm, err := s.Store.GetOrCreateDirectRoom(ctx, senderID, userID)
+		if err != nil {
+			log.Printf("open welcome dm for room %s failed: %v", roomID, err)
+			return
+		}
+		target = dm.ID
+		s.Hub.BroadcastUser(userID, ws.DMRoomEvent{})
+	}
+	msg, err := s.Store.SaveMessageWithType(ctx, target, senderID, text, "text", "")
+	if err != nil {
+		log.Printf("save welcome message for room %s failed: %v", roomID, err)
+		return
+	}
+	s.publishMessage(ctx, msg)
+}
+
+// publishMessage delivers a message saved outside a chat socket to the room
+// and its members' event sockets, the same way a chat message is delivered.
+func (s *Server) publishMessage(ctx context.Context, msg db.Message) {
+	s.publishMessages(ctx, []db.Message{msg})
+}
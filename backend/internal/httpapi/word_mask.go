@@ -0,0 +1,105 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxMaskedWords     = 500
+	maxMaskedWordChars = 64
+)
+
+// maskFor applies roomID's word mask to messages for userID. Room admins
+// get content_masked alongside the original; everyone else gets the masked
+// text as the content too. If the admin check fails the viewer is treated
+// as a member, so originals are never leaked by an error.
+func (s *Server) maskFor(ctx context.Context, roomID, userID uuid.UUID, messages []db.Message) []db.Message {
+	s.Automod.Mask(ctx, roomID, messages)
+	masked := false
+	for _, m := range messages {
+		if m.ContentMasked != "" {
+			masked = true
+			break
+		}
+	}
+	if !masked {
+		return messages
+	}
+	admin, err := s.Store.IsRoomAdmin(ctx, roomID, userID)
+	if err != nil {
+		log.Printf("word mask: check admin %s in room %s: %v", userID, roomID, err)
+	}
+	if admin {
+		return messages
+	}
+	return db.WithoutOriginalContent(messages)
+}
+
+func (s *Server) getRoomWordMask(w http.ResponseWriter, r *http.Request) {
+	roomID, _, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	wm, err := s.Store.GetRoomWordMask(r.Context(), roomID)
+	if err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "room not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to load word mask")
+		return
+	}
+	jsonResponse(w, http.StatusOK, wm)
+}
+
+// setRoomWordMask turns word masking on or off and replaces the room's own
+// word list. The server-wide list always applies while masking is on.
+func (s *Server) setRoomWordMask(w http.ResponseWriter, r *http.Request) {
+	roomID, _, ok := s.roomAdminRequest(w, r)
+	if !ok {
+		return
+	}
+	var req db.WordMask
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	words := make([]string, 0, len(req.Words))
+	seen := make(map[string]bool, len(req.Words))
+	for _, word := range req.Words {
+		word = strings.TrimSpace(word)
+		if word == "" || seen[strings.ToLower(word)] {
+			continue
+		}
+		if utf8.RuneCountInString(word) > maxMaskedWordChars {
+			jsonError(w, http.StatusBadRequest, "masked words are limited to 64 characters")
+			return
+		}
+		seen[strings.ToLower(word)] = true
+		words = append(words, word)
+	}
+	if len(words) > maxMaskedWords {
+		jsonError(w, http.StatusBadRequest, "too many masked words")
+		return
+	}
+	req.Words = words
+	if err := s.Store.SetRoomWordMask(r.Context(), roomID, req); err != nil {
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusNotFound, "room not found")
+			return
+		}
+		jsonError(w, http.StatusInternalServerError, "failed to save word mask")
+		return
+	}
+	s.Automod.Invalidate(roomID)
+	jsonResponse(w, http.StatusOK, req)
+}
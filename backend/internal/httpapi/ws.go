@@ -2,11 +2,16 @@ package httpapi
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"talkie/backend/internal/auth"
+	"talkie/backend/internal/db"
 	"talkie/backend/internal/ws"
 
 	"github.com/go-chi/chi/v5"
@@ -14,6 +19,12 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+const maxInitialStateRooms = 200
+
+// maxResumeMessages is the most messages a room socket opened with a sync
+// token replays; past it the client reloads the room's history.
+const maxResumeMessages = 200
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
@@ -22,20 +33,59 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-func (s *Server) roomWebSocket(w http.ResponseWriter, r *http.Request) {
+// acceptWebSocket applies the global accept-rate limit shared by all socket
+// endpoints. Rejected clients get a jittered Retry-After so they do not all
+// come back in the same second.
+func (s *Server) acceptWebSocket(w http.ResponseWriter) bool {
+	ok, wait := s.wsAccept.Allow()
+	if ok {
+		return true
+	}
+	delay := ws.ReconnectDelay(wait+time.Second, wait+10*time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(int(delay.Seconds())+1))
+	jsonResponse(w, http.StatusServiceUnavailable, map[string]any{
+		"error":          "server is busy, retry later",
+		"retry_after_ms": delay.Milliseconds(),
+	})
+	return false
+}
+
+// authenticateSocket checks the ?token= of a WebSocket handshake the same way
+// middleware.Auth checks REST requests, including session revocation.
+func (s *Server) authenticateSocket(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
 	tokenString := r.URL.Query().Get("token")
 	if tokenString == "" {
 		jsonError(w, http.StatusUnauthorized, "missing token")
-		return
+		return uuid.Nil, false
 	}
-	claims, err := auth.ParseJWT(s.Cfg.JWTSecret, tokenString)
+	claims, err := auth.ParseJWTAny(s.Cfg.JWTVerificationSecrets(), tokenString)
 	if err != nil {
 		jsonError(w, http.StatusUnauthorized, "invalid token")
-		return
+		return uuid.Nil, false
 	}
 	userID, err := uuid.Parse(claims.UserID)
 	if err != nil {
 		jsonError(w, http.StatusUnauthorized, "invalid token payload")
+		return uuid.Nil, false
+	}
+	version, err := s.sessionVersion(r.Context(), userID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check session")
+		return uuid.Nil, false
+	}
+	if version != claims.SessionVersion {
+		jsonError(w, http.StatusUnauthorized, "session revoked")
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+func (s *Server) roomWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !s.acceptWebSocket(w) {
+		return
+	}
+	userID, ok := s.authenticateSocket(w, r)
+	if !ok {
 		return
 	}
 	roomID, err := uuid.Parse(chi.URLParam(r, "roomID"))
@@ -57,6 +107,51 @@ func (s *Server) roomWebSocket(w http.ResponseWriter, r *http.Request) {
 		jsonError(w, http.StatusForbidden, "forbidden")
 		return
 	}
+	hideNSFW, ok := s.nsfwAccess(w, r, roomID, userID)
+	if !ok {
+		return
+	}
+
+	// ?since=<sync_token> resumes from a bootstrap: the room's messages
+	// since it was taken are replayed after state_sync. Rooms joined after
+	// the bootstrap have no sequence in it and get no replay.
+	var resumeSeq int64 = -1
+	if token := r.URL.Query().Get("since"); token != "" {
+		seqs, err := s.Store.GetSyncSnapshot(r.Context(), token, userID)
+		if err == db.ErrNotFound {
+			jsonError(w, http.StatusGone, "sync token expired, reload instead")
+			return
+		}
+		if err != nil {
+			jsonError(w, http.StatusInternalServerError, "failed to load sync token")
+			return
+		}
+		if seq, ok := seqs[roomID]; ok {
+			resumeSeq = seq
+		}
+	}
+
+	direct, err := s.Store.IsDirectRoom(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check room type")
+		return
+	}
+	broadcast, err := s.Store.IsBroadcastRoom(r.Context(), roomID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check room type")
+		return
+	}
+	admin, err := s.Store.IsRoomAdmin(r.Context(), roomID, userID)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, "failed to check membership")
+		return
+	}
+
+	remoteIP := s.clientIP(r)
+	if err := s.Hub.CheckConnLimits(userID, remoteIP); err != nil {
+		jsonError(w, http.StatusTooManyRequests, "too many concurrent connections")
+		return
+	}
 
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -64,7 +159,7 @@ func (s *Server) roomWebSocket(w http.ResponseWriter, r *http.Request) {
 	}
 	u, err := s.Store.FindUserByID(r.Context(), userID)
 	if err != nil {
-		_ = conn.Close()
+		ws.CloseConn(conn, websocket.CloseInternalServerErr, "failed to load user")
 		return
 	}
 
@@ -72,33 +167,73 @@ func (s *Server) roomWebSocket(w http.ResponseWriter, r *http.Request) {
 		Conn:      conn,
 		Hub:       s.Hub,
 		Store:     s.Store,
+		Notifier:  s.Notifier,
+		History:   s.History,
+		Archive:   s.Archive,
+		Automod:   s.Automod,
 		RoomID:    roomID,
 		UserID:    userID,
 		Username:  u.Username,
 		AvatarURL: u.AvatarURL,
 		Send:      make(chan ws.OutgoingMessage, 64),
+		RemoteIP:  remoteIP,
+		IsDirect:  direct,
+		HideNSFW:  hideNSFW,
+		Batch:     r.URL.Query().Get("batch") == "1",
+
+		SeesOriginals: admin,
+		IsBroadcast:   broadcast,
+
+		MaxMessageLength: s.Cfg.MaxMessageLength,
+		RunCommand:       s.runSlashCommand,
+		P2PCalls:         s.Cfg.P2PCalls,
+	}
+	if err := s.Hub.Admit(c); err != nil {
+		c.CloseWithReason(websocket.ClosePolicyViolation, "too many concurrent connections")
+		return
 	}
-	s.Hub.Add(c)
 
-	members, err := s.Store.ListRoomMembers(r.Context(), roomID)
-	if err == nil {
-		participants := make([]ws.Participant, 0, len(members))
-		for _, m := range members {
-			participants = append(participants, ws.Participant{ID: m.ID.String(), Username: m.Username, AvatarURL: m.AvatarURL})
+	var participants []ws.Participant
+	if members, err := s.Store.ListRoomMembers(r.Context(), roomID); err == nil {
+		participants = ws.ParticipantsFromMembers(members)
+	}
+
+	// The snapshot goes out before this client's own arrival is announced so
+	// the participants broadcast is the first sequenced event it sees.
+	s.Hub.SendStateSync(c, participants)
+	if participants != nil {
+		s.Hub.Broadcast(roomID, ws.ParticipantsEvent{Participants: participants})
+	}
+
+	// The client is admitted before the replay is read, so anything sent
+	// in between arrives live as well; clients upsert messages by id.
+	if resumeSeq >= 0 {
+		changed, more, err := s.Store.ListMessagesChangedSince(r.Context(), roomID, resumeSeq, maxResumeMessages)
+		if err == nil {
+			changed = s.maskFor(r.Context(), roomID, userID, viewable(changed, userID, hideNSFW))
+			c.Send <- ws.ResumeMessage(roomID, changed, more).Envelope()
+		} else {
+			log.Printf("load messages to resume failed: %v", err)
+			c.Send <- ws.ResumeEvent{RoomID: roomID.String(), HasMore: true}.Envelope()
 		}
-		s.Hub.Broadcast(roomID, ws.OutgoingMessage{Type: "participants", Participants: participants})
 	}
 
-	history, err := s.Store.ListMessages(r.Context(), roomID, 50)
-	if err == nil {
-		payload := make([]ws.MessagePayload, 0, len(history))
-		for _, m := range history {
-			payload = append(payload, ws.PayloadFromMessage(m))
+	// History is sent on request ("history_request") so clients that only
+	// want the live stream do not pay for it; history=eager keeps the old
+	// push-on-connect behaviour for clients that predate the request.
+	if r.URL.Query().Get("history") == "eager" {
+		history, err := s.History.Recent(r.Context(), s.Store, roomID, ws.DefaultHistoryPage)
+		if err == nil {
+			s.Automod.Mask(r.Context(), roomID, history)
+			hasMore := len(history) == ws.DefaultHistoryPage
+			deleted := ws.DeletedInPage(r.Context(), s.Store, roomID, history, math.MaxInt64, hasMore)
+			c.Send <- ws.HistoryMessage(db.VisibleTo(history, userID), deleted, hasMore).Envelope()
 		}
-		c.Send <- ws.OutgoingMessage{Type: "history", Messages: payload}
 	}
 
-	c.Send <- ws.OutgoingMessage{Type: "call_participants", CallUsers: s.Hub.CallParticipants(roomID)}
+	if unread, firstUnread, err := s.Store.GetUnreadState(r.Context(), roomID, userID); err == nil {
+		c.Send <- ws.UnreadMessage(roomID, 0, unread, firstUnread).Envelope()
+	}
 
 	go c.WritePump()
 	go c.ReadPump()
@@ -107,20 +242,37 @@ func (s *Server) roomWebSocket(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) eventsWebSocket(w http.ResponseWriter, r *http.Request) {
-	tokenString := r.URL.Query().Get("token")
-	if tokenString == "" {
-		jsonError(w, http.StatusUnauthorized, "missing token")
+	s.serveUserEvents(w, r, false)
+}
+
+// serveUserEvents opens a user-level socket. With presence set it starts
+// with the user's online friends.
+func (s *Server) serveUserEvents(w http.ResponseWriter, r *http.Request, presence bool) {
+	if !s.acceptWebSocket(w) {
 		return
 	}
-	claims, err := auth.ParseJWT(s.Cfg.JWTSecret, tokenString)
-	if err != nil {
-		jsonError(w, http.StatusUnauthorized, "invalid token")
+	userID, ok := s.authenticateSocket(w, r)
+	if !ok {
 		return
 	}
-	userID, err := uuid.Parse(claims.UserID)
-	if err != nil {
-		jsonError(w, http.StatusUnauthorized, "invalid token payload")
-		return
+
+	// ?rooms=<id>,<id>,... asks for one combined initial_state covering those
+	// rooms instead of a round-trip per room. Non-member rooms are dropped.
+	var roomIDs []uuid.UUID
+	if raw := r.URL.Query().Get("rooms"); raw != "" {
+		parts := strings.Split(raw, ",")
+		if len(parts) > maxInitialStateRooms {
+			jsonError(w, http.StatusBadRequest, fmt.Sprintf("at most %d rooms", maxInitialStateRooms))
+			return
+		}
+		for _, part := range parts {
+			id, err := uuid.Parse(strings.TrimSpace(part))
+			if err != nil {
+				jsonError(w, http.StatusBadRequest, "invalid room id")
+				return
+			}
+			roomIDs = append(roomIDs, id)
+		}
 	}
 
 	conn, err := upgrader.Upgrade(w, r, nil)
@@ -133,6 +285,33 @@ func (s *Server) eventsWebSocket(w http.ResponseWriter, r *http.Request) {
 		Hub:    s.Hub,
 		UserID: userID,
 		Send:   make(chan ws.OutgoingMessage, 64),
+		Batch:  r.URL.Query().Get("batch") == "1",
+	}
+	if hide, err := s.hidesNSFW(r.Context(), userID); err == nil {
+		c.HideNSFW = hide
+	}
+	if channels, err := s.Store.ListSubscribedRoomIDs(r.Context(), userID); err == nil {
+		c.Channels = channels
+	} else {
+		log.Printf("load subscriptions failed: %v", err)
+	}
+	if len(roomIDs) > 0 {
+		if states, err := s.Store.ListRoomUnreadStates(r.Context(), userID, roomIDs); err == nil {
+			c.Send <- s.Hub.InitialState(states).Envelope()
+		} else {
+			log.Printf("load initial room state failed: %v", err)
+		}
+	}
+	if presence {
+		if online, err := s.onlineFriends(r.Context(), userID); err == nil {
+			rich, err := s.friendsRichPresence(r.Context(), userID)
+			if err != nil {
+				log.Printf("load friends' rich presence failed: %v", err)
+			}
+			c.Send <- ws.PresenceStateMessage(online, rich).Envelope()
+		} else {
+			log.Printf("load online friends failed: %v", err)
+		}
 	}
 	s.Hub.AddUserEvents(c)
 
@@ -142,19 +321,21 @@ func (s *Server) eventsWebSocket(w http.ResponseWriter, r *http.Request) {
 	_ = conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
 }
 
-func (s *Server) broadcastRoomMessageEvent(ctx context.Context, roomID, senderID uuid.UUID, payload ws.MessagePayload) {
-	members, err := s.Store.ListRoomMembers(ctx, roomID)
+func (s *Server) broadcastRoomMessageEvent(ctx context.Context, msg db.Message) {
+	members, err := s.Store.ListRoomMembers(ctx, msg.RoomID)
 	if err != nil {
 		log.Printf("list members for room event failed: %v", err)
 		return
 	}
+	event := ws.RoomMessageEvent{Message: ws.PayloadFromMessage(msg)}
 	for _, m := range members {
-		if m.ID == senderID {
+		if m.ID == msg.UserID {
 			continue
 		}
-		s.Hub.BroadcastUser(m.ID, ws.OutgoingMessage{
-			Type:    "room_message_event",
-			Message: &payload,
-		})
+		s.Hub.BroadcastUser(m.ID, event)
+	}
+	if broadcast, err := s.Store.IsBroadcastRoom(ctx, msg.RoomID); err == nil && broadcast {
+		s.Hub.BroadcastChannel(msg.RoomID, event)
 	}
+	s.Notifier.NotifyMessage(msg.Masked(), members, ws.RoomMentionScope(ctx, s.Store, msg))
 }
@@ -0,0 +1,91 @@
+package httpapi
+
+import (
+	"hash/fnv"
+	"net/http"
+	"strings"
+
+	"talkie/backend/internal/middleware"
+
+	"github.com/google/uuid"
+)
+
+type wsEndpointResponse struct {
+	URL        string `json:"url"`
+	EventsURL  string `json:"events_url"`
+	UserURL    string `json:"user_url"`
+	RoomURL    string `json:"room_url,omitempty"`
+	Region     string `json:"region,omitempty"`
+	Shard      *int   `json:"shard,omitempty"`
+	ShardCount int    `json:"shard_count,omitempty"`
+}
+
+// wsEndpoint tells a client where to open its sockets. With WS_SHARD_URLS
+// set, the events socket goes to the user's shard and, when room_id is
+// given, the room socket goes to the room's shard, so a router in front of
+// the instances does not need sticky sessions.
+func (s *Server) wsEndpoint(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		jsonError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	var roomID uuid.UUID
+	if raw := r.URL.Query().Get("room_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, "invalid room id")
+			return
+		}
+		roomID = id
+	}
+
+	base := s.wsBaseURL(r)
+	resp := wsEndpointResponse{Region: s.Cfg.Region}
+	if n := len(s.Cfg.WSShardURLs); n > 0 {
+		shard := shardIndex(user.ID, n)
+		base = s.Cfg.WSShardURLs[shard]
+		resp.Shard = &shard
+		resp.ShardCount = n
+	}
+	resp.URL = base
+	resp.EventsURL = base + "/ws/events"
+	resp.UserURL = base + "/ws/user"
+	if roomID != uuid.Nil {
+		roomBase := base
+		if n := len(s.Cfg.WSShardURLs); n > 0 {
+			roomBase = s.Cfg.WSShardURLs[shardIndex(roomID, n)]
+		}
+		resp.RoomURL = roomBase + "/ws/rooms/" + roomID.String()
+	}
+	jsonResponse(w, http.StatusOK, resp)
+}
+
+// wsBaseURL is WS_PUBLIC_URL, or the ws(s):// origin the request came in on.
+func (s *Server) wsBaseURL(r *http.Request) string {
+	if s.Cfg.WSPublicURL != "" {
+		return s.Cfg.WSPublicURL
+	}
+	scheme := "ws"
+	if r.TLS != nil {
+		scheme = "wss"
+	}
+	if s.Cfg.TrustProxyHeaders && strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+		scheme = "wss"
+	}
+	host := r.Host
+	if s.Cfg.TrustProxyHeaders {
+		if fwd := r.Header.Get("X-Forwarded-Host"); fwd != "" {
+			host = fwd
+		}
+	}
+	return scheme + "://" + host
+}
+
+// shardIndex maps an id onto one of n shards. It must stay stable across
+// releases: changing it moves every room to a different instance.
+func shardIndex(id uuid.UUID, n int) int {
+	h := fnv.New32a()
+	_, _ = h.Write(id[:])
+	return int(h.Sum32() % uint32(n))
+}
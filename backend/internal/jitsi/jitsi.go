@@ -0,0 +1,75 @@
+// Package jitsi is the calls.Provider for Jitsi Meet deployments with
+// token authentication: it signs the JWTs Prosody's token module accepts
+// with the app ID and secret configured there.
+package jitsi
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"talkie/backend/internal/calls"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Client signs room tokens for one Jitsi deployment.
+type Client struct {
+	baseURL   string
+	appID     string
+	appSecret string
+}
+
+var _ calls.Provider = (*Client)(nil)
+
+// New returns a client for the deployment at baseURL, such as
+// https://meet.example.com.
+func New(baseURL, appID, appSecret string) *Client {
+	return &Client{baseURL: strings.TrimRight(baseURL, "/"), appID: appID, appSecret: appSecret}
+}
+
+func (c *Client) Name() string { return "jitsi" }
+
+// URL is the same for every region: a Jitsi deployment shards rooms across
+// its own videobridges.
+func (c *Client) URL(string) string { return c.baseURL }
+
+type userContext struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Avatar string `json:"avatar,omitempty"`
+}
+
+type claims struct {
+	Room    string `json:"room"`
+	Context struct {
+		User userContext `json:"user"`
+	} `json:"context"`
+	jwt.RegisteredClaims
+}
+
+// Token signs a token for room only. Its subject is the deployment's
+// domain, as Prosody checks it against the virtual host.
+func (c *Client) Token(room string, p calls.Participant, ttl time.Duration) (string, error) {
+	now := time.Now()
+	cl := claims{
+		Room: room,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    c.appID,
+			Audience:  jwt.ClaimStrings{"jitsi"},
+			Subject:   c.domain(),
+			NotBefore: jwt.NewNumericDate(now.Add(-time.Minute)),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	cl.Context.User = userContext{ID: p.ID, Name: p.Name, Avatar: p.AvatarURL}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, cl).SignedString([]byte(c.appSecret))
+}
+
+func (c *Client) domain() string {
+	u, err := url.Parse(c.baseURL)
+	if err != nil || u.Host == "" {
+		return "*"
+	}
+	return u.Hostname()
+}
@@ -0,0 +1,96 @@
+// Package jobs coordinates background work across replicas with Postgres
+// advisory locks, so a job runs on exactly one instance at a time.
+//
+// Lead is for long-running loops: instances compete for the job's lock and
+// the holder runs the loop until its context ends or the lock's connection
+// is lost, when another instance takes over. Once is for one-off runs such
+// as admin commands that must not overlap with a scheduled run.
+package jobs
+
+import (
+	"context"
+	"log"
+	"math/rand/v2"
+	"time"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/metrics"
+)
+
+var (
+	leadershipAcquired = metrics.NewCounterVec("talkie_jobs_leadership_acquired_total", "Times this instance became leader of a job.", "job")
+	leadershipLost     = metrics.NewCounterVec("talkie_jobs_leadership_lost_total", "Times this instance lost a job's lock while leading.", "job")
+)
+
+type Locker interface {
+	TryAdvisoryLock(ctx context.Context, name string) (*db.AdvisoryLock, error)
+}
+
+// Lead runs fn while this instance holds the lock named job, retrying every
+// retry (with jitter) while another instance holds it. fn's context is
+// cancelled when the lock is lost; fn should return promptly then. Lead
+// returns when ctx is cancelled.
+func Lead(ctx context.Context, locker Locker, job string, retry time.Duration, fn func(ctx context.Context)) {
+	for {
+		lock, err := locker.TryAdvisoryLock(ctx, job)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("jobs: %s: leader election failed: %v", job, err)
+		}
+		if lock != nil {
+			leadershipAcquired.With(job).Add(1)
+			lead(ctx, lock, job, retry, fn)
+			if err := lock.Release(); err != nil && ctx.Err() == nil {
+				log.Printf("jobs: %s: release lock: %v", job, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(Jitter(retry, 0.2)):
+		}
+	}
+}
+
+func lead(ctx context.Context, lock *db.AdvisoryLock, job string, check time.Duration, fn func(ctx context.Context)) {
+	leaderCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		ticker := time.NewTicker(check)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-leaderCtx.Done():
+				return
+			case <-ticker.C:
+				if err := lock.Check(leaderCtx); err != nil && leaderCtx.Err() == nil {
+					leadershipLost.With(job).Add(1)
+					log.Printf("jobs: %s: lost lock: %v", job, err)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	fn(leaderCtx)
+}
+
+// Once runs fn if no other instance holds the lock named job, reporting
+// whether it ran.
+func Once(ctx context.Context, locker Locker, job string, fn func(ctx context.Context) error) (bool, error) {
+	lock, err := locker.TryAdvisoryLock(ctx, job)
+	if err != nil || lock == nil {
+		return false, err
+	}
+	defer lock.Release()
+	return true, fn(ctx)
+}
+
+// Jitter returns d moved randomly by up to fraction of itself in either
+// direction.
+func Jitter(d time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 || d <= 0 {
+		return d
+	}
+	spread := float64(d) * fraction
+	return d + time.Duration((rand.Float64()*2-1)*spread)
+}
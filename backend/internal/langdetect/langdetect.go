@@ -0,0 +1,203 @@
+// Package langdetect guesses the language of short chat messages well
+// enough for clients to pick a text direction and for per-room features to
+// pick a language. It works from the script the letters are written in and,
+// for Latin script, from common function words; anything it cannot place
+// confidently is reported as unknown rather than guessed.
+package langdetect
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/language"
+)
+
+const (
+	LTR = "ltr"
+	RTL = "rtl"
+)
+
+// minLetters is how many letters a text needs before its script counts.
+const minLetters = 2
+
+// scripts maps a Unicode script to the language it most likely means in
+// chat. Scripts shared by several languages are refined in Detect.
+var scripts = []struct {
+	table *unicode.RangeTable
+	lang  string
+}{
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Greek, "el"},
+	{unicode.Hangul, "ko"},
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Han, "zh"},
+	{unicode.Thai, "th"},
+	{unicode.Devanagari, "hi"},
+	{unicode.Armenian, "hy"},
+	{unicode.Georgian, "ka"},
+	{unicode.Syriac, "syr"},
+	{unicode.Thaana, "dv"},
+	{unicode.Latin, ""},
+}
+
+// rtl lists the base languages written right to left.
+var rtl = map[string]bool{
+	"ar": true, "arc": true, "ckb": true, "dv": true, "fa": true, "he": true,
+	"ps": true, "sd": true, "syr": true, "ug": true, "ur": true, "yi": true,
+}
+
+// stopwords are frequent function words that rarely appear in the other
+// listed languages. Words shared between languages are left out.
+var stopwords = map[string]string{
+	"the": "en", "and": "en", "is": "en", "you": "en", "this": "en", "that": "en", "with": "en", "what": "en", "have": "en", "are": "en", "it's": "en", "i'm": "en",
+	"el": "es", "los": "es", "las": "es", "y": "es", "por": "es", "pero": "es", "muy": "es", "está": "es", "hola": "es", "gracias": "es",
+	"les": "fr", "et": "fr", "est": "fr", "je": "fr", "vous": "fr", "pas": "fr", "une": "fr", "avec": "fr", "c'est": "fr", "bonjour": "fr", "merci": "fr",
+	"der": "de", "die": "de", "und": "de", "ist": "de", "ich": "de", "nicht": "de", "das": "de", "ein": "de", "mit": "de", "auch": "de", "danke": "de", "hallo": "de",
+	"não": "pt", "você": "pt", "uma": "pt", "obrigado": "pt", "muito": "pt", "também": "pt", "olá": "pt", "isso": "pt", "é": "pt",
+	"che": "it", "di": "it", "sono": "it", "ciao": "it", "grazie": "it", "anche": "it", "perché": "it", "questo": "it",
+}
+
+// Detect returns the BCP 47 base language of text, or "" when it cannot
+// tell: too few letters, a mix of scripts with none dominant, or Latin
+// text without enough telltale words.
+func Detect(text string) string {
+	counts := make(map[string]int)
+	letters := 0
+	persian := 0 // letters only Persian and Urdu add to the Arabic script
+	urdu := 0
+	yiddish := false
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		for _, s := range scripts {
+			if !unicode.Is(s.table, r) {
+				continue
+			}
+			key := s.lang
+			if s.table == unicode.Latin {
+				key = "latn"
+			}
+			counts[key]++
+			letters++
+			break
+		}
+		switch r {
+		case 'پ', 'چ', 'ژ', 'گ', 'ک', 'ی':
+			persian++
+		case 'ٹ', 'ڈ', 'ڑ', 'ں', 'ھ', 'ے':
+			urdu++
+		case 'ײ', 'װ', 'ױ':
+			yiddish = true
+		}
+	}
+	if letters < minLetters {
+		return ""
+	}
+
+	best, n := "", 0
+	for k, c := range counts {
+		if c > n || (c == n && k < best) {
+			best, n = k, c
+		}
+	}
+	// Japanese mixes kanji with kana; any kana at all means Japanese.
+	if best == "zh" && counts["ja"] > 0 {
+		best, n = "ja", n+counts["ja"]
+	}
+	if n*2 <= letters {
+		return ""
+	}
+	switch best {
+	case "ar":
+		if urdu > 0 {
+			return "ur"
+		}
+		if persian > 0 {
+			return "fa"
+		}
+	case "he":
+		if yiddish {
+			return "yi"
+		}
+	case "latn":
+		return latin(text)
+	}
+	return best
+}
+
+// latin picks among the Latin-script languages by counting stopwords. It
+// wants at least two hits and a clear winner.
+func latin(text string) string {
+	hits := make(map[string]int)
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	}) {
+		if lang, ok := stopwords[w]; ok {
+			hits[lang]++
+		}
+	}
+	best, n := "", 0
+	for lang, c := range hits {
+		if c > n {
+			best, n = lang, c
+		}
+	}
+	if n < 2 {
+		return ""
+	}
+	for lang, c := range hits {
+		if c == n && lang != best {
+			return ""
+		}
+	}
+	return best
+}
+
+// Direction returns the text direction of lang, a BCP 47 tag, or "" when
+// lang is empty.
+func Direction(lang string) string {
+	if lang == "" {
+		return ""
+	}
+	base := lang
+	if i := strings.IndexAny(base, "-_"); i >= 0 {
+		base = base[:i]
+	}
+	if rtl[strings.ToLower(base)] {
+		return RTL
+	}
+	return LTR
+}
+
+// Canonical parses a language tag as an admin typed it and returns it in
+// canonical form, or false when it is not a valid tag.
+func Canonical(tag string) (string, bool) {
+	t, err := language.Parse(strings.TrimSpace(tag))
+	if err != nil || t == language.Und {
+		return "", false
+	}
+	return t.String(), true
+}
+
+// Dominant returns the language most of texts are in, or "" when no
+// language covers more than half of the texts whose language is known.
+func Dominant(texts []string) string {
+	counts := make(map[string]int)
+	known := 0
+	for _, t := range texts {
+		if lang := Detect(t); lang != "" {
+			counts[lang]++
+			known++
+		}
+	}
+	for lang, c := range counts {
+		if c*2 > known {
+			return lang
+		}
+	}
+	return ""
+}
@@ -0,0 +1,181 @@
+// Package ldapauth checks passwords against an LDAP directory or Active
+// Directory. It finds the entry a login names with a service account, then
+// binds as that entry with the password given, so passwords are never kept
+// here.
+package ldapauth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LoginPlaceholder is replaced in UserFilter by the escaped login.
+const LoginPlaceholder = "{login}"
+
+// timeout bounds dialing and each request to the directory.
+const timeout = 10 * time.Second
+
+// ErrInvalidCredentials is returned when no single entry matches the login
+// or the directory refuses its password. The two are not told apart.
+var ErrInvalidCredentials = errors.New("ldapauth: invalid credentials")
+
+// Config locates the directory and says how to read its entries.
+type Config struct {
+	// URL is ldap://host:389 or ldaps://host:636. StartTLS upgrades an
+	// ldap:// connection before anything is sent.
+	URL      string
+	StartTLS bool
+	// CAFile is a PEM bundle trusted for the directory's certificate in
+	// place of the system roots.
+	CAFile string
+	// BindDN and BindPassword are the service account entries are looked
+	// up with. Empty, the search is anonymous.
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// UserFilter selects the entry for a login, which stands in for
+	// LoginPlaceholder, e.g. (&(objectClass=person)(mail={login})).
+	UserFilter string
+	// IDAttr holds a value that stays the same for an entry when it is
+	// renamed or moved: entryUUID, or objectGUID on Active Directory.
+	IDAttr       string
+	EmailAttr    string
+	UsernameAttr string
+}
+
+// Entry is the directory's record of whoever signed in.
+type Entry struct {
+	DN string
+	// ID is IDAttr's value, hex-encoded when it is binary.
+	ID       string
+	Email    string
+	Username string
+}
+
+// Directory authenticates against one LDAP server.
+type Directory struct {
+	cfg Config
+	tls *tls.Config
+}
+
+// New returns a Directory for cfg, reading CAFile if set.
+func New(cfg Config) (*Directory, error) {
+	if !strings.Contains(cfg.UserFilter, LoginPlaceholder) {
+		return nil, fmt.Errorf("ldapauth: user filter must contain %s", LoginPlaceholder)
+	}
+	d := &Directory{cfg: cfg, tls: &tls.Config{MinVersion: tls.VersionTLS12}}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("ldapauth: read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ldapauth: no certificates in %s", cfg.CAFile)
+		}
+		d.tls.RootCAs = pool
+	}
+	return d, nil
+}
+
+// Authenticate returns the entry login names if password is its password.
+func (d *Directory) Authenticate(ctx context.Context, login, password string) (Entry, error) {
+	// An empty password would make the bind unauthenticated, which many
+	// servers accept for any DN.
+	if login == "" || password == "" {
+		return Entry{}, ErrInvalidCredentials
+	}
+	conn, err := d.dial(ctx)
+	if err != nil {
+		return Entry{}, err
+	}
+	defer conn.Close()
+
+	if d.cfg.BindDN != "" {
+		if err := conn.Bind(d.cfg.BindDN, d.cfg.BindPassword); err != nil {
+			return Entry{}, fmt.Errorf("ldapauth: service bind: %w", err)
+		}
+	}
+	filter := strings.ReplaceAll(d.cfg.UserFilter, LoginPlaceholder, ldap.EscapeFilter(login))
+	res, err := conn.Search(ldap.NewSearchRequest(
+		d.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(timeout.Seconds()), false, filter,
+		[]string{d.cfg.IDAttr, d.cfg.EmailAttr, d.cfg.UsernameAttr}, nil,
+	))
+	switch {
+	case ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded):
+		return Entry{}, ErrInvalidCredentials
+	case err != nil:
+		return Entry{}, fmt.Errorf("ldapauth: search: %w", err)
+	case len(res.Entries) != 1:
+		return Entry{}, ErrInvalidCredentials
+	}
+	found := res.Entries[0]
+
+	if err := conn.Bind(found.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return Entry{}, ErrInvalidCredentials
+		}
+		return Entry{}, fmt.Errorf("ldapauth: user bind: %w", err)
+	}
+
+	e := Entry{
+		DN:       found.DN,
+		ID:       attrString(found.GetRawAttributeValue(d.cfg.IDAttr)),
+		Email:    strings.ToLower(strings.TrimSpace(found.GetAttributeValue(d.cfg.EmailAttr))),
+		Username: strings.TrimSpace(found.GetAttributeValue(d.cfg.UsernameAttr)),
+	}
+	if e.ID == "" {
+		return Entry{}, fmt.Errorf("ldapauth: %s has no %s", found.DN, d.cfg.IDAttr)
+	}
+	return e, nil
+}
+
+func (d *Directory) dial(ctx context.Context) (*ldap.Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	if deadline, ok := ctx.Deadline(); ok {
+		dialer.Deadline = deadline
+	}
+	conn, err := ldap.DialURL(d.cfg.URL, ldap.DialWithDialer(dialer), ldap.DialWithTLSConfig(d.serverTLS()))
+	if err != nil {
+		return nil, fmt.Errorf("ldapauth: dial: %w", err)
+	}
+	conn.SetTimeout(timeout)
+	if d.cfg.StartTLS {
+		if err := conn.StartTLS(d.serverTLS()); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldapauth: starttls: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// serverTLS is the TLS config with ServerName taken from URL, which
+// StartTLS does not fill in by itself.
+func (d *Directory) serverTLS() *tls.Config {
+	c := d.tls.Clone()
+	if u, err := url.Parse(d.cfg.URL); err == nil {
+		c.ServerName = u.Hostname()
+	}
+	return c
+}
+
+// attrString returns v as text, or hex when it is binary, as objectGUID is.
+func attrString(v []byte) string {
+	if utf8.Valid(v) && !strings.ContainsFunc(string(v), func(r rune) bool { return r < ' ' }) {
+		return string(v)
+	}
+	return hex.EncodeToString(v)
+}
@@ -0,0 +1,47 @@
+// Package livekit is the calls.Provider for LiveKit: it signs the access
+// tokens members join calls with. Calls to LiveKit's server API belong
+// here too when they are needed.
+package livekit
+
+import (
+	"time"
+
+	"talkie/backend/internal/calls"
+
+	lkauth "github.com/livekit/protocol/auth"
+)
+
+// Client signs tokens with a LiveKit API key, which every regional
+// cluster must accept.
+type Client struct {
+	apiKey     string
+	apiSecret  string
+	url        string
+	regionURLs map[string]string
+}
+
+var _ calls.Provider = (*Client)(nil)
+
+// New returns a client for the cluster at url, and the clusters in
+// regionURLs for rooms tagged with those regions.
+func New(apiKey, apiSecret, url string, regionURLs map[string]string) *Client {
+	return &Client{apiKey: apiKey, apiSecret: apiSecret, url: url, regionURLs: regionURLs}
+}
+
+func (c *Client) Name() string { return "livekit" }
+
+func (c *Client) URL(region string) string {
+	if url := c.regionURLs[region]; url != "" {
+		return url
+	}
+	return c.url
+}
+
+func (c *Client) Token(room string, p calls.Participant, ttl time.Duration) (string, error) {
+	at := lkauth.NewAccessToken(c.apiKey, c.apiSecret)
+	at.SetIdentity(p.ID)
+	at.SetName(p.Name)
+	at.SetValidFor(ttl)
+	at.AddGrant(&lkauth.VideoGrant{RoomJoin: true, Room: room})
+	return at.ToJWT()
+}
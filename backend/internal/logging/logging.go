@@ -0,0 +1,180 @@
+// Package logging sets up the server's zerolog logger from configuration
+// and routes the standard library logger, which the internal packages log
+// through, into it. Lines from the standard logger are tagged with the
+// package that wrote them, which per-module level overrides and the
+// WebSocket sampler key on.
+package logging
+
+import (
+	"fmt"
+	"io"
+	stdlog "log"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Config is the LOG_* settings. Modules maps a package name, such as ws or
+// httpapi, to the least level logged from it; Level applies to the rest.
+// WSSample keeps one in WSSample lines from the ws package once more than
+// wsBurst were logged in a second, 1 keeping them all. File and Syslog add
+// sinks that always get JSON lines.
+type Config struct {
+	Level    string
+	Format   string
+	Modules  map[string]string
+	WSSample int
+	File     string
+	Syslog   string
+}
+
+// wsBurst is how many ws lines a second pass before WSSample applies.
+const wsBurst = 10
+
+// Setup replaces log.Logger and the standard library logger's output. The
+// returned closer closes the file and syslog sinks, if any.
+func Setup(cfg Config) (io.Closer, error) {
+	level, err := zerolog.ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, fmt.Errorf("LOG_LEVEL: %w", err)
+	}
+	modules := make(map[string]zerolog.Level, len(cfg.Modules))
+	least := level
+	for name, v := range cfg.Modules {
+		l, err := zerolog.ParseLevel(v)
+		if err != nil {
+			return nil, fmt.Errorf("LOG_MODULE_LEVELS: %s: %w", name, err)
+		}
+		modules[name] = l
+		least = min(least, l)
+	}
+
+	var stdout io.Writer = os.Stdout
+	if cfg.Format != "json" {
+		stdout = zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339}
+	}
+	writers := []io.Writer{stdout}
+	var closers closeAll
+	if cfg.File != "" {
+		f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("LOG_FILE: %w", err)
+		}
+		writers = append(writers, f)
+		closers = append(closers, f)
+	}
+	if cfg.Syslog != "" {
+		w, c, err := dialSyslog(cfg.Syslog)
+		if err != nil {
+			closers.Close()
+			return nil, fmt.Errorf("LOG_SYSLOG: %w", err)
+		}
+		writers = append(writers, w)
+		closers = append(closers, c)
+	}
+
+	zerolog.TimeFieldFormat = time.RFC3339
+	// The global level is the lowest any module asks for; each logger
+	// below raises its own.
+	zerolog.SetGlobalLevel(least)
+	root := zerolog.New(zerolog.MultiLevelWriter(writers...)).With().Timestamp().Logger()
+	log.Logger = root.Level(levelFor(modules, level, "main"))
+
+	b := &bridge{
+		root:    root,
+		level:   level,
+		modules: modules,
+		loggers: make(map[string]zerolog.Logger),
+	}
+	if cfg.WSSample > 1 {
+		b.wsSampler = &zerolog.BurstSampler{
+			Burst:       wsBurst,
+			Period:      time.Second,
+			NextSampler: &zerolog.BasicSampler{N: uint32(cfg.WSSample)},
+		}
+	}
+	stdlog.SetFlags(0)
+	stdlog.SetOutput(b)
+	return closers, nil
+}
+
+func levelFor(modules map[string]zerolog.Level, fallback zerolog.Level, module string) zerolog.Level {
+	if l, ok := modules[module]; ok {
+		return l
+	}
+	return fallback
+}
+
+type closeAll []io.Closer
+
+func (c closeAll) Close() error {
+	var first error
+	for _, cl := range c {
+		if err := cl.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// bridge is the standard library logger's output. The standard logger has
+// no levels, so a line that reports a failure, error or panic is logged
+// as an error and anything else as info.
+type bridge struct {
+	root      zerolog.Logger
+	level     zerolog.Level
+	modules   map[string]zerolog.Level
+	wsSampler zerolog.Sampler
+
+	// loggers is only touched under the standard logger's lock, which
+	// it holds while writing.
+	loggers map[string]zerolog.Logger
+}
+
+func (b *bridge) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	module := callerModule()
+	l, ok := b.loggers[module]
+	if !ok {
+		l = b.root.With().Str("module", module).Logger().Level(levelFor(b.modules, b.level, module))
+		if module == "ws" && b.wsSampler != nil {
+			l = l.Sample(b.wsSampler)
+		}
+		b.loggers[module] = l
+	}
+	lower := strings.ToLower(msg)
+	if strings.Contains(lower, "fail") || strings.Contains(lower, "error") || strings.Contains(lower, "panic") {
+		l.Error().Msg(msg)
+	} else {
+		l.Info().Msg(msg)
+	}
+	return len(p), nil
+}
+
+// callerModule names the package that called the standard logger: the
+// last element of its import path, or main.
+func callerModule() string {
+	pcs := make([]uintptr, 16)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		f, more := frames.Next()
+		pkg := f.Function
+		if i := strings.LastIndex(pkg, "/"); i >= 0 {
+			pkg = pkg[i+1:]
+		}
+		if i := strings.Index(pkg, "."); i >= 0 {
+			pkg = pkg[:i]
+		}
+		if pkg != "log" && pkg != "logging" && pkg != "" {
+			return pkg
+		}
+		if !more {
+			return "main"
+		}
+	}
+}
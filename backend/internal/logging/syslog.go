@@ -0,0 +1,33 @@
+//go:build !windows && !plan9
+
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+	"net/url"
+
+	"github.com/rs/zerolog"
+)
+
+// dialSyslog connects to the local syslog daemon for "local", or to the
+// daemon at a udp:// or tcp:// address.
+func dialSyslog(target string) (io.Writer, io.Closer, error) {
+	const priority = syslog.LOG_INFO | syslog.LOG_DAEMON
+	var w *syslog.Writer
+	var err error
+	if target == "local" {
+		w, err = syslog.New(priority, "talkie")
+	} else {
+		u, perr := url.Parse(target)
+		if perr != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Host == "" {
+			return nil, nil, fmt.Errorf("want local, udp://host:port or tcp://host:port, not %q", target)
+		}
+		w, err = syslog.Dial(u.Scheme, u.Host, priority, "talkie")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return zerolog.SyslogLevelWriter(w), w, nil
+}
@@ -0,0 +1,13 @@
+//go:build windows || plan9
+
+package logging
+
+import (
+	"errors"
+	"io"
+)
+
+// dialSyslog fails: Go has no syslog client on this platform.
+func dialSyslog(string) (io.Writer, io.Closer, error) {
+	return nil, nil, errors.New("syslog is not supported on this platform")
+}
@@ -0,0 +1,39 @@
+// Package mailer sends plain-text transactional email over SMTP.
+package mailer
+
+import (
+	"fmt"
+	"net/smtp"
+)
+
+type Mailer struct {
+	Host string
+	Port int
+	User string
+	Pass string
+	From string
+}
+
+func New(host string, port int, user, pass, from string) *Mailer {
+	return &Mailer{Host: host, Port: port, User: user, Pass: pass, From: from}
+}
+
+// Enabled reports whether SMTP is configured. Callers log the message
+// instead when it is not, which keeps local development usable.
+func (m *Mailer) Enabled() bool {
+	return m != nil && m.Host != "" && m.Port != 0 && m.From != ""
+}
+
+func (m *Mailer) Send(to, subject, body string) error {
+	message := []byte("From: " + m.From + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n\r\n" +
+		body)
+
+	addr := fmt.Sprintf("%s:%d", m.Host, m.Port)
+	var auth smtp.Auth
+	if m.User != "" {
+		auth = smtp.PlainAuth("", m.User, m.Pass, m.Host)
+	}
+	return smtp.SendMail(addr, auth, m.From, []string{to}, message)
+}
@@ -14,13 +14,23 @@ import (
 type UserContext struct {
 	ID       uuid.UUID
 	Username string
+	// Guest is set for temporary guest accounts; see DenyGuests.
+	Guest bool
+	// Timezone is the IANA zone carried by the token, "" when unknown.
+	// Tokens keep the zone they were issued with.
+	Timezone string
 }
 
 type contextKey string
 
 const userKey contextKey = "user"
 
-func Auth(secret string) func(http.Handler) http.Handler {
+// SessionVersionFunc returns the session version a user's tokens must carry.
+type SessionVersionFunc func(ctx context.Context, userID uuid.UUID) (int, error)
+
+// Auth validates the bearer token. When sessionVersion is non-nil, tokens
+// issued before the user's sessions were revoked are rejected.
+func Auth(sessionVersion SessionVersionFunc, secrets ...string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			header := r.Header.Get("Authorization")
@@ -33,7 +43,7 @@ func Auth(secret string) func(http.Handler) http.Handler {
 				writeErr(w, http.StatusUnauthorized, "invalid authorization header")
 				return
 			}
-			claims, err := auth.ParseJWT(secret, parts[1])
+			claims, err := auth.ParseJWTAny(secrets, parts[1])
 			if err != nil {
 				writeErr(w, http.StatusUnauthorized, "invalid token")
 				return
@@ -43,12 +53,34 @@ func Auth(secret string) func(http.Handler) http.Handler {
 				writeErr(w, http.StatusUnauthorized, "invalid token payload")
 				return
 			}
-			ctx := context.WithValue(r.Context(), userKey, UserContext{ID: userID, Username: claims.Username})
+			if sessionVersion != nil {
+				current, err := sessionVersion(r.Context(), userID)
+				if err != nil {
+					writeErr(w, http.StatusInternalServerError, "failed to check session")
+					return
+				}
+				if current != claims.SessionVersion {
+					writeErr(w, http.StatusUnauthorized, "session revoked")
+					return
+				}
+			}
+			ctx := context.WithValue(r.Context(), userKey, UserContext{ID: userID, Username: claims.Username, Guest: claims.Guest, Timezone: claims.Timezone})
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// DenyGuests rejects requests from guest accounts. It must run after Auth.
+func DenyGuests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, ok := UserFromContext(r.Context()); ok && u.Guest {
+			writeErr(w, http.StatusForbidden, "not available to guest accounts")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func UserFromContext(ctx context.Context) (UserContext, bool) {
 	u, ok := ctx.Value(userKey).(UserContext)
 	return u, ok
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"talkie/backend/internal/ratelimit"
+)
+
+// RateLimit applies a per-user request budget after Auth. Every response
+// carries X-RateLimit-Limit, -Remaining and -Reset (seconds until the budget
+// is full again) so clients can slow down before they are refused.
+func RateLimit(limiter *ratelimit.Keyed) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := UserFromContext(r.Context())
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			st := limiter.Take(user.ID.String())
+			if st.Limit > 0 {
+				h := w.Header()
+				h.Set("X-RateLimit-Limit", strconv.Itoa(st.Limit))
+				h.Set("X-RateLimit-Remaining", strconv.Itoa(st.Remaining))
+				h.Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(st.Reset)))
+			}
+			if !st.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(st.RetryAfter)))
+				writeErr(w, http.StatusTooManyRequests, "rate limit exceeded")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+const requestIDKey contextKey = "request_id"
+
+// maxRequestIDLength bounds the X-Request-Id a client or proxy may pick.
+const maxRequestIDLength = 64
+
+// RequestID gives each request an id, taken from the X-Request-Id header
+// a proxy set or made up, and echoes it in the response's X-Request-Id.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-Id")
+		if !validRequestID(id) {
+			buf := make([]byte, 12)
+			_, _ = rand.Read(buf)
+			id = hex.EncodeToString(buf)
+		}
+		w.Header().Set("X-Request-Id", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestIDFromContext returns the id RequestID gave the request, or "".
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// PanicFunc is told about a recovered panic. It is called in the deferred
+// function that recovered, so it can still see the panicking stack.
+type PanicFunc func(v any, tags map[string]string)
+
+// Recover turns a panic in a handler into a 500 with the request id, logs
+// it with its stack and passes it to report, which may be nil. Place it
+// after RequestID. http.ErrAbortHandler is let through, as net/http uses
+// it to abort a response on purpose.
+func Recover(report PanicFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+				id := RequestIDFromContext(r.Context())
+				log.Printf("panic serving %s %s (request %s): %v\n%s", r.Method, r.URL.Path, id, v, debug.Stack())
+				if report != nil {
+					report(v, map[string]string{"request_id": id, "method": r.Method, "path": r.URL.Path})
+				}
+				// A hijacked connection, such as a WebSocket, has no
+				// response left to write.
+				if r.Header.Get("Upgrade") != "" {
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusInternalServerError)
+				_ = json.NewEncoder(w).Encode(map[string]string{
+					"error":      "internal server error",
+					"code":       "internal_error",
+					"request_id": id,
+				})
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// APNs sends notifications through Apple's HTTP/2 provider API using a
+// token-based (.p8) signing key.
+type APNs struct {
+	keyID      string
+	teamID     string
+	topic      string
+	host       string
+	privateKey any
+	client     *http.Client
+
+	mu       sync.Mutex
+	jwt      string
+	issuedAt time.Time
+}
+
+func NewAPNs(keyFile, keyID, teamID, topic string, production bool) (*APNs, error) {
+	raw, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("read apns key: %w", err)
+	}
+	key, err := jwt.ParseECPrivateKeyFromPEM(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parse apns key: %w", err)
+	}
+	host := "https://api.sandbox.push.apple.com"
+	if production {
+		host = "https://api.push.apple.com"
+	}
+	return &APNs{
+		keyID:      keyID,
+		teamID:     teamID,
+		topic:      topic,
+		host:       host,
+		privateKey: key,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (a *APNs) Send(ctx context.Context, token string, ev Event) error {
+	bearer, err := a.providerToken()
+	if err != nil {
+		return err
+	}
+	payload := map[string]any{
+		"aps": map[string]any{
+			"alert": map[string]string{
+				"title": ev.Title,
+				"body":  ev.Body,
+			},
+			"sound": "default",
+		},
+		"kind": ev.Kind,
+	}
+	if ev.RoomID != "" {
+		payload["room_id"] = ev.RoomID
+	}
+	for k, v := range ev.Data {
+		payload[k] = v
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.host+"/3/device/"+token, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "bearer "+bearer)
+	req.Header.Set("apns-topic", a.topic)
+	req.Header.Set("apns-push-type", "alert")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	reason := string(respBody)
+	if resp.StatusCode == http.StatusGone || strings.Contains(reason, "BadDeviceToken") || strings.Contains(reason, "Unregistered") {
+		return ErrInvalidToken
+	}
+	return fmt.Errorf("apns status %d: %s", resp.StatusCode, strings.TrimSpace(reason))
+}
+
+// providerToken returns a cached signing JWT. Apple rejects tokens older than
+// an hour and throttles ones refreshed more often than every 20 minutes.
+func (a *APNs) providerToken() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.jwt != "" && time.Since(a.issuedAt) < 50*time.Minute {
+		return a.jwt, nil
+	}
+	now := time.Now()
+	t := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss": a.teamID,
+		"iat": now.Unix(),
+	})
+	t.Header["kid"] = a.keyID
+	signed, err := t.SignedString(a.privateKey)
+	if err != nil {
+		return "", fmt.Errorf("sign apns token: %w", err)
+	}
+	a.jwt = signed
+	a.issuedAt = now
+	return signed, nil
+}
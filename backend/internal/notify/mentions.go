@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"context"
+	"log"
+	"strings"
+	"unicode"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+// MentionScope is how much of a room a message addresses through @room or
+// @here.
+type MentionScope int
+
+const (
+	MentionNone MentionScope = iota
+	// MentionHere addresses the members online when the message is sent.
+	MentionHere
+	// MentionRoom addresses every member.
+	MentionRoom
+)
+
+// ParseRoomMention finds @room or @here as whole words in content. @room
+// wins when both appear.
+func ParseRoomMention(content string) MentionScope {
+	scope := MentionNone
+	rest := strings.ToLower(content)
+	for {
+		i := strings.IndexByte(rest, '@')
+		if i < 0 {
+			return scope
+		}
+		word := rest[i+1:]
+		end := strings.IndexFunc(word, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' })
+		if end >= 0 {
+			word = word[:end]
+		}
+		boundary := i == 0 || !isWordByte(rest[i-1])
+		switch {
+		case boundary && word == "room":
+			return MentionRoom
+		case boundary && word == "here":
+			scope = MentionHere
+		}
+		rest = rest[i+1:]
+	}
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 0x80
+}
+
+// Inbox records in-app notifications in bulk.
+type Inbox interface {
+	CreateNotifications(ctx context.Context, userIDs []uuid.UUID, kind, title, body string, data any) ([]db.Notification, error)
+}
+
+// Live delivers an in-app notification to a user's open connections. The
+// WebSocket hub implements it alongside Presence.
+type Live interface {
+	SendNotification(n db.Notification)
+}
+
+// notifyInbox stores a notification for each user and pushes it to their
+// open connections. It runs on its own goroutine so a mention of a large
+// room costs the sender one bulk insert, not a write per member.
+func (d *Dispatcher) notifyInbox(userIDs []uuid.UUID, kind, title, body string, data map[string]string) {
+	if d.inbox == nil || len(userIDs) == 0 {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), dispatchTimeout)
+		defer cancel()
+		created, err := d.inbox.CreateNotifications(ctx, userIDs, kind, title, body, data)
+		if err != nil {
+			log.Printf("record %s notifications failed: %v", kind, err)
+			return
+		}
+		live, ok := d.presence.(Live)
+		if !ok {
+			return
+		}
+		for _, n := range created {
+			live.SendNotification(n)
+		}
+	}()
+}
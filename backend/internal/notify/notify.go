@@ -0,0 +1,237 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/sms"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidToken is returned by providers when the push service reports that
+// a device token is no longer valid; the dispatcher deletes such tokens.
+var ErrInvalidToken = errors.New("invalid device token")
+
+const dispatchTimeout = 15 * time.Second
+
+type Event struct {
+	Kind   string            `json:"kind"`
+	Title  string            `json:"title"`
+	Body   string            `json:"body"`
+	RoomID string            `json:"room_id,omitempty"`
+	Data   map[string]string `json:"data,omitempty"`
+	// DirectCall marks a call in a direct message, which users may let
+	// through their quiet hours.
+	DirectCall bool `json:"-"`
+}
+
+type Provider interface {
+	Send(ctx context.Context, token string, ev Event) error
+}
+
+type Presence interface {
+	IsUserOnline(userID uuid.UUID) bool
+}
+
+type DeviceStore interface {
+	ListPushDevicesForUsers(ctx context.Context, userIDs []uuid.UUID) ([]db.PushDevice, error)
+	DeletePushDeviceByToken(ctx context.Context, token string) error
+}
+
+// QuietStore lists users' quiet hours.
+type QuietStore interface {
+	ListQuietHours(ctx context.Context, userIDs []uuid.UUID) ([]db.UserQuietHours, error)
+}
+
+type Dispatcher struct {
+	store     DeviceStore
+	inbox     Inbox
+	quiet     QuietStore
+	presence  Presence
+	providers map[string]Provider
+
+	sms       sms.Sender
+	smsStore  SMSStore
+	smsPerDay int
+}
+
+// NewDispatcher builds a dispatcher that pushes to the devices in store.
+// If store is also an Inbox, room-wide mentions are recorded as in-app
+// notifications too; if it is a QuietStore, users in their quiet hours are
+// not pushed to.
+func NewDispatcher(store DeviceStore, presence Presence) *Dispatcher {
+	inbox, _ := store.(Inbox)
+	quiet, _ := store.(QuietStore)
+	return &Dispatcher{
+		store:     store,
+		inbox:     inbox,
+		quiet:     quiet,
+		presence:  presence,
+		providers: make(map[string]Provider),
+	}
+}
+
+// Register installs the provider used for devices on the given platform
+// ("fcm" or "apns"). Platforms without a provider are skipped silently.
+func (d *Dispatcher) Register(platform string, p Provider) {
+	d.providers[platform] = p
+}
+
+func (d *Dispatcher) Enabled() bool {
+	return d != nil && len(d.providers) > 0
+}
+
+// Dispatch delivers ev to the devices of every offline user in userIDs. It
+// returns immediately; delivery happens on a background goroutine so the
+// message path never waits on a push provider.
+func (d *Dispatcher) Dispatch(userIDs []uuid.UUID, ev Event) {
+	if !d.Enabled() || len(userIDs) == 0 {
+		return
+	}
+	offline := make([]uuid.UUID, 0, len(userIDs))
+	for _, id := range userIDs {
+		if d.presence != nil && d.presence.IsUserOnline(id) {
+			continue
+		}
+		offline = append(offline, id)
+	}
+	if len(offline) == 0 {
+		return
+	}
+	go d.deliver(offline, ev)
+}
+
+func (d *Dispatcher) deliver(userIDs []uuid.UUID, ev Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), dispatchTimeout)
+	defer cancel()
+
+	userIDs = d.outsideQuietHours(ctx, userIDs, ev, time.Now())
+	if len(userIDs) == 0 {
+		return
+	}
+	devices, err := d.store.ListPushDevicesForUsers(ctx, userIDs)
+	if err != nil {
+		log.Printf("list push devices failed: %v", err)
+		return
+	}
+	for _, dev := range devices {
+		p, ok := d.providers[dev.Platform]
+		if !ok {
+			continue
+		}
+		err := p.Send(ctx, dev.Token, ev)
+		if err == nil {
+			continue
+		}
+		if errors.Is(err, ErrInvalidToken) {
+			if delErr := d.store.DeletePushDeviceByToken(ctx, dev.Token); delErr != nil {
+				log.Printf("delete invalid push token failed: %v", delErr)
+			}
+			continue
+		}
+		log.Printf("push to %s device of %s failed: %v", dev.Platform, dev.UserID, err)
+	}
+}
+
+// outsideQuietHours drops the users in their quiet hours at now, keeping
+// those who let direct calls through when ev is one. If quiet hours cannot
+// be loaded everyone is kept: a missed quiet hour beats a missed message.
+func (d *Dispatcher) outsideQuietHours(ctx context.Context, userIDs []uuid.UUID, ev Event, now time.Time) []uuid.UUID {
+	if d.quiet == nil {
+		return userIDs
+	}
+	quiet, err := d.quiet.ListQuietHours(ctx, userIDs)
+	if err != nil {
+		log.Printf("list quiet hours failed: %v", err)
+		return userIDs
+	}
+	if len(quiet) == 0 {
+		return userIDs
+	}
+	held := make(map[uuid.UUID]bool, len(quiet))
+	for _, q := range quiet {
+		if q.QuietHours.Active(now, q.Timezone) && !(ev.DirectCall && q.QuietHours.AllowDirectCalls) {
+			held[q.UserID] = true
+		}
+	}
+	out := userIDs[:0:0]
+	for _, id := range userIDs {
+		if !held[id] {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// NotifyMessage pushes msg to the offline members of its room, upgrading the
+// event to a mention for members whose @username appears in the content.
+// scope is the room-wide mention the sender was allowed to make: @room
+// mentions every member and @here the members online right now; those
+// members also get an in-app notification.
+func (d *Dispatcher) NotifyMessage(msg db.Message, members []db.RoomMember, scope MentionScope) {
+	if d == nil {
+		return
+	}
+	body := msg.Content
+	if msg.MessageType == "image" {
+		body = "sent an image"
+	}
+	lower := strings.ToLower(msg.Content)
+	plain := make([]uuid.UUID, 0, len(members))
+	mentioned := make([]uuid.UUID, 0)
+	roomWide := make([]uuid.UUID, 0)
+	for _, m := range members {
+		if m.ID == msg.UserID {
+			continue
+		}
+		switch {
+		case scope == MentionRoom,
+			scope == MentionHere && d.presence != nil && d.presence.IsUserOnline(m.ID):
+			roomWide = append(roomWide, m.ID)
+		case strings.Contains(lower, "@"+strings.ToLower(m.Username)):
+			mentioned = append(mentioned, m.ID)
+		default:
+			plain = append(plain, m.ID)
+		}
+	}
+	data := map[string]string{"message_id": strconv.FormatInt(msg.ID, 10)}
+	roomID := msg.RoomID.String()
+	d.Dispatch(plain, Event{Kind: "message", Title: msg.Username, Body: body, RoomID: roomID, Data: data})
+	mention := Event{Kind: "mention", Title: msg.Username + " mentioned you", Body: body, RoomID: roomID, Data: data}
+	d.Dispatch(mentioned, mention)
+	d.text(mentioned, mention)
+	if len(roomWide) > 0 {
+		tag := "@room"
+		if scope == MentionHere {
+			tag = "@here"
+		}
+		title := msg.Username + " mentioned " + tag
+		d.Dispatch(roomWide, Event{Kind: "mention", Title: title, Body: body, RoomID: roomID, Data: data})
+		d.notifyInbox(roomWide, "mention.room", title, body, map[string]string{"room_id": roomID, "message_id": data["message_id"]})
+	}
+}
+
+// NotifyCall tells offline room members that caller started a call. direct
+// says the room is a direct message; those calls are also texted to
+// members with SMS alerts on.
+func (d *Dispatcher) NotifyCall(roomID uuid.UUID, callerID uuid.UUID, caller string, members []db.RoomMember, direct bool) {
+	if d == nil {
+		return
+	}
+	recipients := make([]uuid.UUID, 0, len(members))
+	for _, m := range members {
+		if m.ID != callerID {
+			recipients = append(recipients, m.ID)
+		}
+	}
+	d.Dispatch(recipients, Event{Kind: "call", Title: caller, Body: "started a call", RoomID: roomID.String(), DirectCall: direct})
+	if direct {
+		d.text(recipients, Event{Kind: "call", Title: caller + " called you", RoomID: roomID.String(), DirectCall: true})
+	}
+}
@@ -0,0 +1,93 @@
+package notify
+
+import (
+	"context"
+	"log"
+	"time"
+	"unicode/utf8"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/sms"
+
+	"github.com/google/uuid"
+)
+
+// smsMaxBody keeps alerts to a single SMS segment.
+const smsMaxBody = 160
+
+// SMSStore finds who gets SMS alerts and meters how many they are sent.
+type SMSStore interface {
+	ListSMSRecipients(ctx context.Context, userIDs []uuid.UUID) ([]db.SMSRecipient, error)
+	TakeSMSBudget(ctx context.Context, userID uuid.UUID, kind string, perDay int) (bool, error)
+}
+
+// SetSMS texts missed direct calls and personal mentions to offline users
+// who turned SMS alerts on, at most perDay texts each a day.
+func (d *Dispatcher) SetSMS(sender sms.Sender, store SMSStore, perDay int) {
+	d.sms, d.smsStore, d.smsPerDay = sender, store, perDay
+}
+
+// SMSEnabled reports whether alerts can go out by SMS.
+func (d *Dispatcher) SMSEnabled() bool {
+	return d != nil && d.sms != nil
+}
+
+// text sends ev as an SMS to the offline users in userIDs with SMS alerts on.
+// Like pushes it returns at once and sends in the background.
+func (d *Dispatcher) text(userIDs []uuid.UUID, ev Event) {
+	if !d.SMSEnabled() || len(userIDs) == 0 {
+		return
+	}
+	offline := make([]uuid.UUID, 0, len(userIDs))
+	for _, id := range userIDs {
+		if d.presence == nil || !d.presence.IsUserOnline(id) {
+			offline = append(offline, id)
+		}
+	}
+	if len(offline) == 0 {
+		return
+	}
+	go d.deliverText(offline, ev)
+}
+
+func (d *Dispatcher) deliverText(userIDs []uuid.UUID, ev Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), dispatchTimeout)
+	defer cancel()
+
+	userIDs = d.outsideQuietHours(ctx, userIDs, ev, time.Now())
+	if len(userIDs) == 0 {
+		return
+	}
+	recipients, err := d.smsStore.ListSMSRecipients(ctx, userIDs)
+	if err != nil {
+		log.Printf("list sms recipients failed: %v", err)
+		return
+	}
+	body := smsBody(ev)
+	for _, r := range recipients {
+		ok, err := d.smsStore.TakeSMSBudget(ctx, r.UserID, ev.Kind, d.smsPerDay)
+		if err != nil {
+			log.Printf("sms budget of %s: %v", r.UserID, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if err := d.sms.Send(ctx, r.Phone, body); err != nil {
+			log.Printf("sms to %s failed: %v", r.UserID, err)
+		}
+	}
+}
+
+// smsBody is ev as one line of text, cut to fit one segment.
+func smsBody(ev Event) string {
+	text := "Talkie: " + ev.Title
+	if ev.Body != "" {
+		text += ": " + ev.Body
+	}
+	if utf8.RuneCountInString(text) <= smsMaxBody {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:smsMaxBody-1]) + "…"
+}
@@ -0,0 +1,67 @@
+// Package nsfw asks an external image classifier whether uploads are NSFW.
+package nsfw
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const classifyTimeout = 5 * time.Second
+
+// Classifier posts images to a classification service. The service gets the
+// raw image bytes with their Content-Type and answers with JSON carrying
+// either {"nsfw": true|false} or a {"score": 0..1} compared against the
+// threshold. A nil Classifier flags nothing.
+type Classifier struct {
+	url       string
+	threshold float64
+	client    *http.Client
+}
+
+// New returns nil when url is empty, so classification stays optional.
+func New(url string, threshold float64) *Classifier {
+	if url == "" {
+		return nil
+	}
+	return &Classifier{url: url, threshold: threshold, client: &http.Client{Timeout: classifyTimeout}}
+}
+
+// Classify reports whether the image is NSFW.
+func (c *Classifier) Classify(ctx context.Context, contentType string, image []byte) (bool, error) {
+	if c == nil {
+		return false, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(image))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return false, fmt.Errorf("nsfw classifier returned %s", resp.Status)
+	}
+	var out struct {
+		NSFW  *bool    `json:"nsfw"`
+		Score *float64 `json:"score"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&out); err != nil {
+		return false, fmt.Errorf("decode nsfw classifier response: %w", err)
+	}
+	switch {
+	case out.NSFW != nil:
+		return *out.NSFW, nil
+	case out.Score != nil:
+		return *out.Score >= c.threshold, nil
+	}
+	return false, fmt.Errorf("nsfw classifier response has neither nsfw nor score")
+}
@@ -0,0 +1,156 @@
+// Package profile validates the extra profile fields a deployment defines
+// on top of username and avatar.
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Field types.
+const (
+	Text     = "text"
+	Select   = "select"
+	URL      = "url"
+	Timezone = "timezone"
+)
+
+var Types = []string{Text, Select, URL, Timezone}
+
+const (
+	defaultMaxLength = 100
+	maxMaxLength     = 1000
+	maxOptions       = 100
+)
+
+var keyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+// Field is one extra profile field. Fields from PROFILE_FIELDS are marked
+// Builtin and cannot be changed through the admin API.
+type Field struct {
+	Key     string   `json:"key"`
+	Label   string   `json:"label"`
+	Type    string   `json:"type"`
+	Options []string `json:"options,omitempty"`
+	// MaxLength caps text values, in characters. 0 means the default.
+	MaxLength int  `json:"max_length,omitempty"`
+	Position  int  `json:"position"`
+	Builtin   bool `json:"builtin,omitempty"`
+}
+
+// Check validates f's definition.
+func (f Field) Check() error {
+	if !keyPattern.MatchString(f.Key) {
+		return errors.New("key must be 1-32 lowercase letters, digits or underscores, starting with a letter")
+	}
+	if strings.TrimSpace(f.Label) == "" || utf8.RuneCountInString(f.Label) > 64 {
+		return errors.New("label must be 1-64 characters")
+	}
+	if !slices.Contains(Types, f.Type) {
+		return fmt.Errorf("type must be one of %s", strings.Join(Types, ", "))
+	}
+	if f.MaxLength < 0 || f.MaxLength > maxMaxLength {
+		return fmt.Errorf("max_length must be between 0 and %d", maxMaxLength)
+	}
+	if f.Type == Select && (len(f.Options) == 0 || len(f.Options) > maxOptions) {
+		return fmt.Errorf("select fields need 1 to %d options", maxOptions)
+	}
+	if f.Type != Select && len(f.Options) > 0 {
+		return errors.New("only select fields take options")
+	}
+	return nil
+}
+
+// Normalize checks value against f and returns it as it is stored.
+func (f Field) Normalize(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	limit := f.MaxLength
+	if limit == 0 {
+		limit = defaultMaxLength
+	}
+	if utf8.RuneCountInString(value) > limit {
+		return "", fmt.Errorf("%s must be at most %d characters", f.Key, limit)
+	}
+	switch f.Type {
+	case Select:
+		if !slices.Contains(f.Options, value) {
+			return "", fmt.Errorf("%s must be one of %s", f.Key, strings.Join(f.Options, ", "))
+		}
+	case URL:
+		u, err := url.Parse(value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "", fmt.Errorf("%s must be an http or https URL", f.Key)
+		}
+	case Timezone:
+		if _, err := time.LoadLocation(value); err != nil || value == "" || value == "Local" {
+			return "", fmt.Errorf("%s must be an IANA time zone such as Europe/Berlin", f.Key)
+		}
+	}
+	return value, nil
+}
+
+// ParseConfig reads PROFILE_FIELDS, a JSON array of fields.
+func ParseConfig(raw string) ([]Field, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var fields []Field
+	if err := json.Unmarshal([]byte(raw), &fields); err != nil {
+		return nil, fmt.Errorf("PROFILE_FIELDS must be a JSON array of fields: %w", err)
+	}
+	seen := map[string]bool{}
+	for i := range fields {
+		if err := fields[i].Check(); err != nil {
+			return nil, fmt.Errorf("PROFILE_FIELDS[%d]: %w", i, err)
+		}
+		if seen[fields[i].Key] {
+			return nil, fmt.Errorf("PROFILE_FIELDS: duplicate key %q", fields[i].Key)
+		}
+		seen[fields[i].Key] = true
+		fields[i].Builtin = true
+		if fields[i].Position == 0 {
+			fields[i].Position = i
+		}
+	}
+	return fields, nil
+}
+
+// Merge lists builtin fields first, then stored ones whose key a builtin
+// field does not already take, each group by position.
+func Merge(builtin, stored []Field) []Field {
+	out := slices.Clone(builtin)
+	for _, f := range stored {
+		if !slices.ContainsFunc(builtin, func(b Field) bool { return b.Key == f.Key }) {
+			out = append(out, f)
+		}
+	}
+	slices.SortStableFunc(out, func(a, b Field) int {
+		if a.Builtin != b.Builtin {
+			if a.Builtin {
+				return -1
+			}
+			return 1
+		}
+		return a.Position - b.Position
+	})
+	return out
+}
+
+// Visible keeps only the values of fields still in schema, so values left
+// behind by a deleted field are not shown.
+func Visible(schema []Field, values map[string]string) map[string]string {
+	out := make(map[string]string, len(values))
+	for _, f := range schema {
+		if v, ok := values[f.Key]; ok {
+			out[f.Key] = v
+		}
+	}
+	return out
+}
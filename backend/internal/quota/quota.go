@@ -0,0 +1,61 @@
+// Package quota holds the soft limits plans put on users and workspaces.
+package quota
+
+import (
+	"fmt"
+
+	"talkie/backend/internal/db"
+)
+
+// Quota names, as reported in ExceededError.
+const (
+	MaxRooms       = "max_rooms"
+	MaxRoomMembers = "max_room_members"
+	MaxUploadBytes = "max_upload_bytes"
+)
+
+// Limits are the effective quotas for a user or room. 0 means unlimited.
+type Limits struct {
+	MaxRooms       int   `json:"max_rooms"`
+	MaxRoomMembers int   `json:"max_room_members"`
+	MaxUploadBytes int64 `json:"max_upload_bytes"`
+	HistoryDays    int   `json:"history_days"`
+}
+
+// WithPlan returns l with the limits p sets replacing the defaults.
+func (l Limits) WithPlan(p db.Plan) Limits {
+	if p.MaxRooms != nil {
+		l.MaxRooms = *p.MaxRooms
+	}
+	if p.MaxRoomMembers != nil {
+		l.MaxRoomMembers = *p.MaxRoomMembers
+	}
+	if p.MaxUploadBytes != nil {
+		l.MaxUploadBytes = *p.MaxUploadBytes
+	}
+	if p.HistoryDays != nil {
+		l.HistoryDays = *p.HistoryDays
+	}
+	return l
+}
+
+// ExceededError reports which quota an action would break.
+type ExceededError struct {
+	Quota string `json:"quota"`
+	Limit int64  `json:"limit"`
+	// Used is the current usage, when it is known.
+	Used int64 `json:"used,omitempty"`
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("quota exceeded: %s is limited to %d", e.Quota, e.Limit)
+}
+
+// Allow reports an ExceededError when adding one more to used would go past
+// limit. A limit of 0 allows everything.
+func Allow(name string, limit, used int64) error {
+	if limit > 0 && used >= limit {
+		return &ExceededError{Quota: name, Limit: limit, Used: used}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket refilled continuously at rate tokens per second up
+// to burst. A nil or zero-rate Bucket allows everything.
+type Bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func NewBucket(rate float64, burst int) *Bucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Bucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Status describes a bucket after a Take, in the terms of the
+// X-RateLimit-* headers.
+type Status struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until the next token, when not Allowed.
+	RetryAfter time.Duration
+}
+
+// Allow consumes a token if one is available. When it is not, the returned
+// duration is how long until the next token refills.
+func (b *Bucket) Allow() (bool, time.Duration) {
+	st := b.Take()
+	return st.Allowed, st.RetryAfter
+}
+
+// Take is Allow with the bucket's state reported alongside.
+func (b *Bucket) Take() Status {
+	if b == nil || b.rate <= 0 {
+		return Status{Allowed: true}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	st := Status{Limit: int(b.burst)}
+	if b.tokens >= 1 {
+		b.tokens--
+		st.Allowed = true
+	} else {
+		st.RetryAfter = time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	}
+	st.Remaining = int(math.Floor(b.tokens))
+	st.Reset = time.Duration((b.burst - b.tokens) / b.rate * float64(time.Second))
+	return st
+}
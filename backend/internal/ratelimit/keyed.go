@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// idleAfter is how long a key's bucket may go unused before it is dropped.
+// By then it has refilled, so dropping it loses nothing.
+const idleAfter = 10 * time.Minute
+
+// Keyed keeps one Bucket per key, such as per user. A nil or zero-rate
+// Keyed allows everything.
+type Keyed struct {
+	rate  float64
+	burst int
+
+	mu        sync.Mutex
+	buckets   map[string]*Bucket
+	lastSweep time.Time
+}
+
+func NewKeyed(rate float64, burst int) *Keyed {
+	return &Keyed{rate: rate, burst: burst, buckets: map[string]*Bucket{}, lastSweep: time.Now()}
+}
+
+// Take consumes a token from key's bucket.
+func (k *Keyed) Take(key string) Status {
+	if k == nil || k.rate <= 0 {
+		return Status{Allowed: true}
+	}
+	k.mu.Lock()
+	now := time.Now()
+	if now.Sub(k.lastSweep) > idleAfter {
+		k.sweep(now)
+	}
+	b, ok := k.buckets[key]
+	if !ok {
+		b = NewBucket(k.rate, k.burst)
+		k.buckets[key] = b
+	}
+	k.mu.Unlock()
+	return b.Take()
+}
+
+func (k *Keyed) sweep(now time.Time) {
+	k.lastSweep = now
+	for key, b := range k.buckets {
+		b.mu.Lock()
+		idle := now.Sub(b.last) > idleAfter
+		b.mu.Unlock()
+		if idle {
+			delete(k.buckets, key)
+		}
+	}
+}
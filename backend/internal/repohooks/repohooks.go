@@ -0,0 +1,227 @@
+// Package repohooks verifies GitHub and GitLab webhook deliveries and turns
+// the ones rooms care about — pull or merge requests opened and merged, CI
+// failures, issues assigned — into chat text. Like billing, it only parses:
+// what to do with an event is up to the caller.
+package repohooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Providers.
+const (
+	GitHub = "github"
+	GitLab = "gitlab"
+)
+
+// Event kinds a room link can subscribe to.
+const (
+	KindPullRequest = "pull_request"
+	KindCI          = "ci"
+	KindIssue       = "issue"
+)
+
+// Kinds lists every event kind, in the order links show them.
+var Kinds = []string{KindPullRequest, KindCI, KindIssue}
+
+var (
+	ErrBadSignature = errors.New("invalid webhook signature")
+	// ErrIgnored is returned for deliveries that are valid but not worth a
+	// message, such as pings, pushes or a pull request being relabelled.
+	ErrIgnored = errors.New("event ignored")
+)
+
+// Event is a delivery worth posting.
+type Event struct {
+	Kind string
+	// Repo is the repository's full path, e.g. "acme/api" or
+	// "group/subgroup/project".
+	Repo string
+	Text string
+}
+
+// ValidProvider reports whether provider is one repohooks understands.
+func ValidProvider(provider string) bool {
+	return provider == GitHub || provider == GitLab
+}
+
+// Verify checks a delivery against the link's secret: GitHub signs the body
+// with HMAC-SHA256 in X-Hub-Signature-256, GitLab sends the secret itself in
+// X-Gitlab-Token.
+func Verify(provider, secret string, h http.Header, body []byte) error {
+	switch provider {
+	case GitHub:
+		sig, ok := strings.CutPrefix(h.Get("X-Hub-Signature-256"), "sha256=")
+		if !ok {
+			return ErrBadSignature
+		}
+		got, err := hex.DecodeString(sig)
+		if err != nil {
+			return ErrBadSignature
+		}
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		if !hmac.Equal(got, mac.Sum(nil)) {
+			return ErrBadSignature
+		}
+		return nil
+	case GitLab:
+		if subtle.ConstantTimeCompare([]byte(h.Get("X-Gitlab-Token")), []byte(secret)) != 1 {
+			return ErrBadSignature
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown provider %q", provider)
+}
+
+// Parse turns a verified delivery into an Event, or returns ErrIgnored.
+func Parse(provider string, h http.Header, body []byte) (Event, error) {
+	switch provider {
+	case GitHub:
+		return parseGitHub(h.Get("X-GitHub-Event"), body)
+	case GitLab:
+		return parseGitLab(h.Get("X-Gitlab-Event"), body)
+	}
+	return Event{}, fmt.Errorf("unknown provider %q", provider)
+}
+
+type githubPayload struct {
+	Action     string `json:"action"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	Sender struct {
+		Login string `json:"login"`
+	} `json:"sender"`
+	PullRequest struct {
+		Number  int    `json:"number"`
+		Title   string `json:"title"`
+		HTMLURL string `json:"html_url"`
+		Merged  bool   `json:"merged"`
+		User    struct {
+			Login string `json:"login"`
+		} `json:"user"`
+	} `json:"pull_request"`
+	Issue struct {
+		Number  int    `json:"number"`
+		Title   string `json:"title"`
+		HTMLURL string `json:"html_url"`
+	} `json:"issue"`
+	Assignee struct {
+		Login string `json:"login"`
+	} `json:"assignee"`
+	WorkflowRun struct {
+		Name       string `json:"name"`
+		HeadBranch string `json:"head_branch"`
+		Conclusion string `json:"conclusion"`
+		HTMLURL    string `json:"html_url"`
+	} `json:"workflow_run"`
+}
+
+func parseGitHub(event string, body []byte) (Event, error) {
+	var p githubPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return Event{}, fmt.Errorf("invalid github payload: %w", err)
+	}
+	repo := p.Repository.FullName
+	switch event {
+	case "pull_request":
+		pr := p.PullRequest
+		switch {
+		case p.Action == "opened" || p.Action == "reopened":
+			return Event{KindPullRequest, repo, fmt.Sprintf("[%s] Pull request #%d %s by %s: %s\n%s", repo, pr.Number, p.Action, pr.User.Login, pr.Title, pr.HTMLURL)}, nil
+		case p.Action == "closed" && pr.Merged:
+			return Event{KindPullRequest, repo, fmt.Sprintf("[%s] Pull request #%d merged by %s: %s\n%s", repo, pr.Number, p.Sender.Login, pr.Title, pr.HTMLURL)}, nil
+		}
+	case "workflow_run":
+		run := p.WorkflowRun
+		if p.Action == "completed" && (run.Conclusion == "failure" || run.Conclusion == "timed_out") {
+			return Event{KindCI, repo, fmt.Sprintf("[%s] CI failed: %s on %s\n%s", repo, run.Name, run.HeadBranch, run.HTMLURL)}, nil
+		}
+	case "issues":
+		if p.Action == "assigned" {
+			is := p.Issue
+			return Event{KindIssue, repo, fmt.Sprintf("[%s] Issue #%d assigned to %s: %s\n%s", repo, is.Number, p.Assignee.Login, is.Title, is.HTMLURL)}, nil
+		}
+	}
+	return Event{}, ErrIgnored
+}
+
+type gitlabUser struct {
+	Username string `json:"username"`
+}
+
+type gitlabPayload struct {
+	User    gitlabUser `json:"user"`
+	Project struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+		WebURL            string `json:"web_url"`
+	} `json:"project"`
+	ObjectAttributes struct {
+		IID    int    `json:"iid"`
+		ID     int    `json:"id"`
+		Title  string `json:"title"`
+		URL    string `json:"url"`
+		Action string `json:"action"`
+		Status string `json:"status"`
+		Ref    string `json:"ref"`
+	} `json:"object_attributes"`
+	Changes struct {
+		Assignees *struct {
+			Previous []gitlabUser `json:"previous"`
+			Current  []gitlabUser `json:"current"`
+		} `json:"assignees"`
+	} `json:"changes"`
+}
+
+func parseGitLab(event string, body []byte) (Event, error) {
+	var p gitlabPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return Event{}, fmt.Errorf("invalid gitlab payload: %w", err)
+	}
+	repo := p.Project.PathWithNamespace
+	obj := p.ObjectAttributes
+	switch event {
+	case "Merge Request Hook":
+		switch obj.Action {
+		case "open", "reopen":
+			return Event{KindPullRequest, repo, fmt.Sprintf("[%s] Merge request !%d opened by %s: %s\n%s", repo, obj.IID, p.User.Username, obj.Title, obj.URL)}, nil
+		case "merge":
+			return Event{KindPullRequest, repo, fmt.Sprintf("[%s] Merge request !%d merged by %s: %s\n%s", repo, obj.IID, p.User.Username, obj.Title, obj.URL)}, nil
+		}
+	case "Pipeline Hook":
+		if obj.Status == "failed" {
+			return Event{KindCI, repo, fmt.Sprintf("[%s] CI failed: pipeline #%d on %s\n%s/-/pipelines/%d", repo, obj.ID, obj.Ref, p.Project.WebURL, obj.ID)}, nil
+		}
+	case "Issue Hook":
+		if a := p.Changes.Assignees; a != nil {
+			if added := newAssignees(a.Previous, a.Current); len(added) > 0 {
+				return Event{KindIssue, repo, fmt.Sprintf("[%s] Issue #%d assigned to %s: %s\n%s", repo, obj.IID, strings.Join(added, ", "), obj.Title, obj.URL)}, nil
+			}
+		}
+	}
+	return Event{}, ErrIgnored
+}
+
+// newAssignees returns the usernames in current that were not in previous.
+func newAssignees(previous, current []gitlabUser) []string {
+	had := make(map[string]bool, len(previous))
+	for _, u := range previous {
+		had[u.Username] = true
+	}
+	var added []string
+	for _, u := range current {
+		if !had[u.Username] {
+			added = append(added, u.Username)
+		}
+	}
+	return added
+}
@@ -0,0 +1,288 @@
+// Package s3 signs the two requests direct uploads need: a browser POST
+// policy that lets a client put one object in the bucket, and a HEAD the
+// server uses to confirm the object arrived. It also reads and writes
+// whole objects for the message archive. It speaks SigV4 to AWS or any
+// S3-compatible store and pulls in no SDK.
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	algorithm = "AWS4-HMAC-SHA256"
+	// emptySHA256 is the payload hash of a request without a body.
+	emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// ErrNotFound means the object does not exist, usually because the client
+// never finished uploading it.
+var ErrNotFound = errors.New("s3: object not found")
+
+// Config describes the bucket. Endpoint is only set for S3-compatible
+// stores, which are addressed path-style; AWS uses virtual-hosted URLs.
+// PublicURL is the base media URLs are built from, such as a CDN in front of
+// the bucket; it defaults to the bucket URL.
+type Config struct {
+	Bucket    string
+	Region    string
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+	PublicURL string
+}
+
+// Client signs requests for one bucket. A nil Client means direct uploads
+// are off.
+type Client struct {
+	cfg    Config
+	base   string
+	public string
+	http   *http.Client
+}
+
+// New returns nil when no bucket is configured.
+func New(cfg Config) *Client {
+	if cfg.Bucket == "" {
+		return nil
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	base := fmt.Sprintf("https://%s.s3.%s.amazonaws.com", cfg.Bucket, cfg.Region)
+	if cfg.Endpoint != "" {
+		base = strings.TrimRight(cfg.Endpoint, "/") + "/" + cfg.Bucket
+	}
+	public := strings.TrimRight(cfg.PublicURL, "/")
+	if public == "" {
+		public = base
+	}
+	return &Client{cfg: cfg, base: base, public: public, http: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// PublicURL is where clients fetch the object stored under key.
+func (c *Client) PublicURL(key string) string {
+	return c.public + "/" + escapeKey(key)
+}
+
+// PresignedPost is a form the client submits as multipart/form-data to URL,
+// with Fields first and the file last, in a field named "file".
+type PresignedPost struct {
+	URL    string            `json:"url"`
+	Fields map[string]string `json:"fields"`
+}
+
+// PresignPost lets the holder upload exactly key, of contentType and at
+// most maxBytes, until expires.
+func (c *Client) PresignPost(key, contentType string, maxBytes int64, now, expires time.Time) (PresignedPost, error) {
+	now = now.UTC()
+	date := now.Format("20060102T150405Z")
+	credential := fmt.Sprintf("%s/%s", c.cfg.AccessKey, c.scope(now))
+	policy, err := json.Marshal(map[string]any{
+		"expiration": expires.UTC().Format("2006-01-02T15:04:05.000Z"),
+		"conditions": []any{
+			map[string]string{"bucket": c.cfg.Bucket},
+			[]any{"eq", "$key", key},
+			[]any{"eq", "$Content-Type", contentType},
+			[]any{"content-length-range", 1, maxBytes},
+			map[string]string{"x-amz-algorithm": algorithm},
+			map[string]string{"x-amz-credential": credential},
+			map[string]string{"x-amz-date": date},
+		},
+	})
+	if err != nil {
+		return PresignedPost{}, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(policy)
+	return PresignedPost{
+		URL: c.base,
+		Fields: map[string]string{
+			"key":              key,
+			"Content-Type":     contentType,
+			"policy":           encoded,
+			"x-amz-algorithm":  algorithm,
+			"x-amz-credential": credential,
+			"x-amz-date":       date,
+			"x-amz-signature":  hex.EncodeToString(hmacSHA256(c.signingKey(now), encoded)),
+		},
+	}, nil
+}
+
+// PresignGet returns a URL that fetches key from a private bucket until
+// now+ttl.
+func (c *Client) PresignGet(key string, now time.Time, ttl time.Duration) string {
+	now = now.UTC()
+	date := now.Format("20060102T150405Z")
+	u, _ := url.Parse(c.base + "/" + escapeKey(key))
+	q := url.Values{}
+	q.Set("X-Amz-Algorithm", algorithm)
+	q.Set("X-Amz-Credential", c.cfg.AccessKey+"/"+c.scope(now))
+	q.Set("X-Amz-Date", date)
+	q.Set("X-Amz-Expires", strconv.Itoa(int(ttl.Seconds())))
+	q.Set("X-Amz-SignedHeaders", "host")
+	// Encode sorts by key, as the canonical query string must be.
+	query := strings.ReplaceAll(q.Encode(), "+", "%20")
+	canonical := strings.Join([]string{
+		http.MethodGet,
+		u.EscapedPath(),
+		query,
+		"host:" + u.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	hash := sha256.Sum256([]byte(canonical))
+	toSign := strings.Join([]string{algorithm, date, c.scope(now), hex.EncodeToString(hash[:])}, "\n")
+	signature := hex.EncodeToString(hmacSHA256(c.signingKey(now), toSign))
+	return u.String() + "?" + query + "&X-Amz-Signature=" + signature
+}
+
+// Object is what HEAD reports about a stored object.
+type Object struct {
+	Size        int64
+	ContentType string
+}
+
+// Head looks up key in the bucket.
+func (c *Client) Head(ctx context.Context, key string) (Object, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.base+"/"+escapeKey(key), nil)
+	if err != nil {
+		return Object{}, err
+	}
+	c.sign(req, time.Now(), emptySHA256)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return Object{}, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return Object{}, ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		return Object{}, fmt.Errorf("s3: HEAD %s: %s", key, resp.Status)
+	}
+	return Object{Size: resp.ContentLength, ContentType: resp.Header.Get("Content-Type")}, nil
+}
+
+// Put stores body under key, replacing any object already there.
+func (c *Client) Put(ctx context.Context, key string, body []byte, contentType string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.base+"/"+escapeKey(key), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	hash := sha256.Sum256(body)
+	c.sign(req, time.Now(), hex.EncodeToString(hash[:]))
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("s3: PUT %s: %s", key, resp.Status)
+	}
+	return nil
+}
+
+// Get reads the whole object stored under key.
+func (c *Client) Get(ctx context.Context, key string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base+"/"+escapeKey(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	c.sign(req, time.Now(), emptySHA256)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("s3: GET %s: %s", key, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// Delete removes key. Deleting an object that does not exist succeeds.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, c.base+"/"+escapeKey(key), nil)
+	if err != nil {
+		return err
+	}
+	c.sign(req, time.Now(), emptySHA256)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("s3: DELETE %s: %s", key, resp.Status)
+	}
+	return nil
+}
+
+// sign adds SigV4 headers to a request whose body hashes to payloadHash.
+func (c *Client) sign(req *http.Request, now time.Time, payloadHash string) {
+	now = now.UTC()
+	date := now.Format("20060102T150405Z")
+	req.Header.Set("x-amz-date", date)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host + "\n" +
+			"x-amz-content-sha256:" + payloadHash + "\n" +
+			"x-amz-date:" + date + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	hash := sha256.Sum256([]byte(canonical))
+	toSign := strings.Join([]string{algorithm, date, c.scope(now), hex.EncodeToString(hash[:])}, "\n")
+	signature := hex.EncodeToString(hmacSHA256(c.signingKey(now), toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm, c.cfg.AccessKey, c.scope(now), signedHeaders, signature))
+}
+
+func (c *Client) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + c.cfg.Region + "/s3/aws4_request"
+}
+
+func (c *Client) signingKey(now time.Time) []byte {
+	k := hmacSHA256([]byte("AWS4"+c.cfg.SecretKey), now.Format("20060102"))
+	k = hmacSHA256(k, c.cfg.Region)
+	k = hmacSHA256(k, "s3")
+	return hmacSHA256(k, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// escapeKey escapes each path segment of key the way SigV4 expects.
+func escapeKey(key string) string {
+	parts := strings.Split(key, "/")
+	for i, p := range parts {
+		parts[i] = strings.ReplaceAll(url.PathEscape(p), "+", "%2B")
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,109 @@
+// Package scheduler runs periodic maintenance tasks on exactly one instance:
+// the leader of the scheduler job (see package jobs) runs every task on its
+// interval. Task runs are spread with jitter so replicas restarting together
+// do not hit the database in lockstep.
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"talkie/backend/internal/jobs"
+	"talkie/backend/internal/metrics"
+)
+
+const job = "scheduler"
+
+var (
+	taskRuns     = metrics.NewCounterVec("talkie_scheduler_runs_total", "Scheduled task runs by result.", "task", "result")
+	taskRows     = metrics.NewCounterVec("talkie_scheduler_rows_total", "Rows changed by scheduled tasks.", "task")
+	taskDuration = metrics.NewHistogram("talkie_scheduler_task_seconds", "Scheduled task run time.", []float64{0.01, 0.1, 1, 10, 60, 300})
+	leaderGauge  = metrics.NewGauge("talkie_scheduler_leader", "1 while this instance runs the scheduled tasks.")
+)
+
+// Task is a periodic job. Run returns how many rows it changed.
+type Task struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) (int64, error)
+}
+
+type Scheduler struct {
+	locker jobs.Locker
+	tasks  []Task
+	// Jitter is the fraction of an interval each wait is randomly moved by.
+	Jitter float64
+	// RetryInterval is how often a follower tries to become leader, and how
+	// often the leader checks it still holds the lock.
+	RetryInterval time.Duration
+}
+
+func New(locker jobs.Locker, tasks ...Task) *Scheduler {
+	return &Scheduler{locker: locker, tasks: tasks, Jitter: 0.1, RetryInterval: 30 * time.Second}
+}
+
+// Run competes for leadership and runs the tasks while leader, until ctx is
+// cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	jobs.Lead(ctx, s.locker, job, s.RetryInterval, s.lead)
+}
+
+// lead runs the tasks until ctx is cancelled, which also happens when the
+// lock is lost and another instance may already have taken over.
+func (s *Scheduler) lead(ctx context.Context) {
+	log.Printf("scheduler: this instance is now the leader")
+	leaderGauge.Set(1)
+	defer leaderGauge.Set(0)
+	if len(s.tasks) == 0 {
+		<-ctx.Done()
+		return
+	}
+	// First runs are staggered too, so a new leader does not run everything
+	// at once.
+	next := make([]time.Time, len(s.tasks))
+	now := time.Now()
+	for i := range s.tasks {
+		next[i] = now.Add(jobs.Jitter(time.Minute, s.Jitter))
+	}
+	for {
+		due := next[0]
+		for _, n := range next[1:] {
+			if n.Before(due) {
+				due = n
+			}
+		}
+		timer := time.NewTimer(time.Until(due))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		for i, t := range s.tasks {
+			if ctx.Err() != nil || time.Now().Before(next[i]) {
+				continue
+			}
+			s.runTask(ctx, t)
+			next[i] = time.Now().Add(jobs.Jitter(t.Interval, s.Jitter))
+		}
+	}
+}
+
+func (s *Scheduler) runTask(ctx context.Context, t Task) {
+	start := time.Now()
+	n, err := t.Run(ctx)
+	taskDuration.ObserveSince(start)
+	if err != nil {
+		if ctx.Err() == nil {
+			taskRuns.With(t.Name, "error").Add(1)
+			log.Printf("scheduler: task %s failed: %v", t.Name, err)
+		}
+		return
+	}
+	taskRuns.With(t.Name, "ok").Add(1)
+	taskRows.With(t.Name).Add(n)
+	if n > 0 {
+		log.Printf("scheduler: task %s changed %d rows in %s", t.Name, n, time.Since(start).Round(time.Millisecond))
+	}
+}
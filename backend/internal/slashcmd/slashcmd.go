@@ -0,0 +1,219 @@
+// Package slashcmd runs custom slash commands served by external webhooks,
+// after Slack's outgoing command model: the invocation is POSTed as signed
+// JSON to the command's URL, and whatever text comes back within the
+// timeout is shown in the room or to the invoker alone. Buttons and menus
+// on a command's replies are reported to the same URL as interactions.
+package slashcmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"talkie/backend/internal/db"
+)
+
+const (
+	// Timeout is how long a command has to answer, as in Slack.
+	Timeout = 3 * time.Second
+	// MaxSkew is how far a signed timestamp may be from the receiver's
+	// clock before Verify rejects the request as a replay.
+	MaxSkew = 5 * time.Minute
+
+	maxResponseBytes = 64 << 10
+
+	SignatureHeader = "X-Talkie-Signature"
+	TimestampHeader = "X-Talkie-Request-Timestamp"
+	signatureScheme = "v0"
+)
+
+// ErrPrivateAddress is returned for command URLs that resolve to loopback,
+// private or link-local addresses when those are not allowed.
+var ErrPrivateAddress = errors.New("command url resolves to a private address")
+
+// ErrBadSignature is returned by Verify for requests that were not signed
+// with the command's secret or are too old.
+var ErrBadSignature = errors.New("invalid command signature")
+
+// Payload types, sent as "type" so one URL can serve both.
+const (
+	TypeCommand     = "command"
+	TypeInteraction = "interaction"
+)
+
+// Invocation is the JSON body POSTed to a command's URL.
+type Invocation struct {
+	Type        string    `json:"type"`
+	Command     string    `json:"command"`
+	Text        string    `json:"text"`
+	RoomID      string    `json:"room_id"`
+	RoomName    string    `json:"room_name"`
+	UserID      string    `json:"user_id"`
+	Username    string    `json:"username"`
+	TriggeredAt time.Time `json:"triggered_at"`
+}
+
+// Interaction is the JSON body POSTed to a command's URL when a member
+// presses a button or picks an option on one of its replies.
+type Interaction struct {
+	Type        string    `json:"type"`
+	Command     string    `json:"command"`
+	ActionID    string    `json:"action_id"`
+	Value       string    `json:"value"`
+	MessageID   int64     `json:"message_id"`
+	RoomID      string    `json:"room_id"`
+	RoomName    string    `json:"room_name"`
+	UserID      string    `json:"user_id"`
+	Username    string    `json:"username"`
+	TriggeredAt time.Time `json:"triggered_at"`
+}
+
+// Response is a command's answer. ResponseType "in_channel" posts Text to
+// the room, with Components under it; anything else, "ephemeral" included,
+// shows Text to the invoker only. A plain-text body is read as an
+// ephemeral Text. In answer to an interaction, ReplaceOriginal swaps the
+// text and components of the message that was used instead.
+type Response struct {
+	ResponseType    string         `json:"response_type"`
+	Text            string         `json:"text"`
+	Components      []db.Component `json:"components,omitempty"`
+	ReplaceOriginal bool           `json:"replace_original,omitempty"`
+}
+
+// InChannel reports whether the response is meant for the whole room.
+func (r Response) InChannel() bool {
+	return r.ResponseType == "in_channel"
+}
+
+// Client invokes command webhooks.
+type Client struct {
+	http *http.Client
+}
+
+// New returns a Client. Unless allowPrivate is set it refuses to connect to
+// loopback, private and link-local addresses, checked on every dial so a
+// hostname cannot be re-pointed inside the deployment after it was saved.
+// Redirects are not followed.
+func New(allowPrivate bool) *Client {
+	dialer := &net.Dialer{Timeout: Timeout}
+	if !allowPrivate {
+		dialer.Control = denyPrivate
+	}
+	return &Client{http: &http.Client{
+		Timeout: Timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: Timeout,
+			MaxIdleConns:        20,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}}
+}
+
+func denyPrivate(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast() {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+// Invoke posts inv to url signed with secret and returns the command's
+// answer. An empty 2xx body is an empty Response: the command acknowledged
+// without replying.
+func (c *Client) Invoke(ctx context.Context, url, secret string, inv Invocation) (Response, error) {
+	inv.Type = TypeCommand
+	return c.post(ctx, url, secret, inv)
+}
+
+// Interact posts in to url signed with secret, as Invoke does.
+func (c *Client) Interact(ctx context.Context, url, secret string, in Interaction) (Response, error) {
+	in.Type = TypeInteraction
+	return c.post(ctx, url, secret, in)
+}
+
+func (c *Client) post(ctx context.Context, url, secret string, payload any) (Response, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return Response{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return Response{}, err
+	}
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, strconv.FormatInt(ts, 10))
+	req.Header.Set(SignatureHeader, Sign(secret, ts, body))
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return Response{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBytes))
+		return Response{}, fmt.Errorf("command returned %s", resp.Status)
+	}
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes+1))
+	if err != nil {
+		return Response{}, err
+	}
+	if len(raw) > maxResponseBytes {
+		return Response{}, fmt.Errorf("command response is over %d bytes", maxResponseBytes)
+	}
+	text := strings.TrimSpace(string(raw))
+	if !strings.HasPrefix(text, "{") {
+		return Response{Text: text}, nil
+	}
+	var out Response
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return Response{}, fmt.Errorf("decode command response: %w", err)
+	}
+	return out, nil
+}
+
+// Sign returns the signature header value for body sent at ts: "v0=" and
+// the hex HMAC-SHA256 of "v0:<ts>:<body>" keyed with secret.
+func Sign(secret string, ts int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s:%d:", signatureScheme, ts)
+	mac.Write(body)
+	return signatureScheme + "=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks an invocation's timestamp and signature headers the way a
+// command's receiver should: the timestamp within MaxSkew of now and the
+// signature matching body.
+func Verify(secret, timestamp, signature string, body []byte, now time.Time) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrBadSignature
+	}
+	if skew := now.Sub(time.Unix(ts, 0)); skew > MaxSkew || skew < -MaxSkew {
+		return ErrBadSignature
+	}
+	if !hmac.Equal([]byte(Sign(secret, ts, body)), []byte(signature)) {
+		return ErrBadSignature
+	}
+	return nil
+}
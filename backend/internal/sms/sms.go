@@ -0,0 +1,118 @@
+// Package sms sends text messages through a provider. Twilio is the only
+// one built in; anything with a Send method can stand in for it.
+package sms
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Sender delivers one text message to an E.164 number.
+type Sender interface {
+	Send(ctx context.Context, to, body string) error
+}
+
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// Normalize returns phone in E.164 form, dropping the spaces, dashes, dots
+// and parentheses people type, or "" when it is not a full international
+// number.
+func Normalize(phone string) string {
+	phone = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(phone))
+	if strings.HasPrefix(phone, "00") {
+		phone = "+" + phone[2:]
+	}
+	if !e164.MatchString(phone) {
+		return ""
+	}
+	return phone
+}
+
+// Hash returns the keyed hash a normalized number is stored and looked up
+// as. Without the key, the few billion possible numbers cannot be hashed to
+// recover one.
+func Hash(key, phone string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(phone))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Hint is the last digits of phone, enough for its owner to recognise it.
+func Hint(phone string) string {
+	if len(phone) <= 4 {
+		return phone
+	}
+	return phone[len(phone)-4:]
+}
+
+// Twilio sends through Twilio's Messages API.
+type Twilio struct {
+	AccountSID string
+	AuthToken  string
+	// From is the sending number, or a messaging service SID (MG...).
+	From    string
+	BaseURL string
+	client  *http.Client
+}
+
+// NewTwilio returns nil unless all three settings are present, so SMS stays
+// optional.
+func NewTwilio(accountSID, authToken, from string) *Twilio {
+	if accountSID == "" || authToken == "" || from == "" {
+		return nil
+	}
+	return &Twilio{
+		AccountSID: accountSID,
+		AuthToken:  authToken,
+		From:       from,
+		BaseURL:    "https://api.twilio.com",
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (t *Twilio) Send(ctx context.Context, to, body string) error {
+	form := url.Values{"To": {to}, "Body": {body}}
+	if strings.HasPrefix(t.From, "MG") {
+		form.Set("MessagingServiceSid", t.From)
+	} else {
+		form.Set("From", t.From)
+	}
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", t.BaseURL, url.PathEscape(t.AccountSID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(t.AccountSID, t.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	var apiErr struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&apiErr)
+	return fmt.Errorf("twilio: status %d: %d %s", resp.StatusCode, apiErr.Code, apiErr.Message)
+}
@@ -0,0 +1,318 @@
+package sso
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// discoveryTTL is how long an issuer's configuration and keys are
+	// cached. Keys are fetched again sooner when a token names one we do
+	// not have, at most once per keyRefetchGap.
+	discoveryTTL  = time.Hour
+	keyRefetchGap = time.Minute
+	maxOIDCBody   = 1 << 20
+)
+
+// OIDC signs users in with OpenID Connect's authorization code flow,
+// caching each issuer's discovery document and signing keys.
+type OIDC struct {
+	client *http.Client
+
+	mu     sync.Mutex
+	issuer map[string]*oidcIssuer
+}
+
+type oidcIssuer struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+
+	fetchedAt     time.Time
+	keys          map[string]crypto.PublicKey
+	keysFetchedAt time.Time
+}
+
+func NewOIDC() *OIDC {
+	return &OIDC{
+		client: &http.Client{Timeout: 10 * time.Second},
+		issuer: make(map[string]*oidcIssuer),
+	}
+}
+
+// OIDCLogin is what a sign-in needs from the workspace's settings.
+type OIDCLogin struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURI  string
+	// GroupsClaim names the ID token claim listing the user's groups.
+	GroupsClaim string
+}
+
+// AuthURL is where to send the browser to sign in. state comes back on
+// the callback, nonce inside the ID token, and verifier is the PKCE
+// secret Exchange must be given.
+func (o *OIDC) AuthURL(ctx context.Context, l OIDCLogin, state, nonce, verifier string) (string, error) {
+	iss, err := o.discover(ctx, l.Issuer)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {l.ClientID},
+		"redirect_uri":          {l.RedirectURI},
+		"scope":                 {"openid email profile"},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(iss.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return iss.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange redeems the code from the callback and returns who the ID
+// token says signed in, after checking its signature, issuer, audience,
+// lifetime and nonce.
+func (o *OIDC) Exchange(ctx context.Context, l OIDCLogin, code, nonce, verifier string) (Identity, error) {
+	iss, err := o.discover(ctx, l.Issuer)
+	if err != nil {
+		return Identity{}, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {l.RedirectURI},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, iss.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Identity{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(l.ClientID), url.QueryEscape(l.ClientSecret))
+	var tok struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := o.do(req, &tok); err != nil {
+		return Identity{}, fmt.Errorf("token endpoint: %w", err)
+	}
+	if tok.IDToken == "" {
+		return Identity{}, errors.New("token response has no id_token")
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(tok.IDToken, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return o.key(ctx, iss, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(iss.Issuer),
+		jwt.WithAudience(l.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(clockSkew),
+	)
+	if err != nil {
+		return Identity{}, fmt.Errorf("id token: %w", err)
+	}
+	if got, _ := claims["nonce"].(string); got == "" || got != nonce {
+		return Identity{}, errors.New("id token: nonce mismatch")
+	}
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return Identity{}, errors.New("id token: no subject")
+	}
+	id := Identity{Subject: sub}
+	id.Email, _ = claims["email"].(string)
+	// Some providers send email_verified as a string.
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		id.EmailVerified = v
+	case string:
+		id.EmailVerified = v == "true"
+	}
+	id.Username, _ = claims["preferred_username"].(string)
+	if l.GroupsClaim != "" {
+		id.Groups = stringList(claims[l.GroupsClaim])
+	}
+	return id, nil
+}
+
+// discover returns issuer's configuration, which must name issuer itself.
+func (o *OIDC) discover(ctx context.Context, issuer string) (*oidcIssuer, error) {
+	issuer = strings.TrimRight(issuer, "/")
+	o.mu.Lock()
+	cached := o.issuer[issuer]
+	o.mu.Unlock()
+	if cached != nil && time.Since(cached.fetchedAt) < discoveryTTL {
+		return cached, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var iss oidcIssuer
+	if err := o.do(req, &iss); err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+	if strings.TrimRight(iss.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("discovery: issuer is %q, want %q", iss.Issuer, issuer)
+	}
+	if iss.AuthorizationEndpoint == "" || iss.TokenEndpoint == "" || iss.JWKSURI == "" {
+		return nil, errors.New("discovery: missing endpoints")
+	}
+	iss.fetchedAt = time.Now()
+	o.mu.Lock()
+	o.issuer[issuer] = &iss
+	o.mu.Unlock()
+	return &iss, nil
+}
+
+// key returns the issuer's signing key kid, fetching the key set again
+// when kid is new. Tokens without a kid need the set to hold one key.
+func (o *OIDC) key(ctx context.Context, iss *oidcIssuer, kid string) (crypto.PublicKey, error) {
+	o.mu.Lock()
+	keys, fetched := iss.keys, iss.keysFetchedAt
+	o.mu.Unlock()
+	if k := pickKey(keys, kid); k != nil {
+		return k, nil
+	}
+	if time.Since(fetched) < keyRefetchGap {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, iss.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := o.do(req, &set); err != nil {
+		return nil, fmt.Errorf("jwks: %w", err)
+	}
+	keys = make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if pub, err := k.publicKey(); err == nil {
+			keys[k.Kid] = pub
+		}
+	}
+	o.mu.Lock()
+	iss.keys, iss.keysFetchedAt = keys, time.Now()
+	o.mu.Unlock()
+	if k := pickKey(keys, kid); k != nil {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func pickKey(keys map[string]crypto.PublicKey, kid string) crypto.PublicKey {
+	if kid != "" {
+		return keys[kid]
+	}
+	if len(keys) == 1 {
+		for _, k := range keys {
+			return k
+		}
+	}
+	return nil
+}
+
+func (o *OIDC) do(req *http.Request, out any) error {
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxOIDCBody))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", req.URL.Host, resp.StatusCode)
+	}
+	return json.Unmarshal(body, out)
+}
+
+// jwk is one key of a JSON Web Key Set. Only RSA and EC keys are used.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exp := new(big.Int).SetBytes(e)
+		if !exp.IsInt64() || exp.Int64() > 1<<31-1 {
+			return nil, errors.New("rsa exponent too large")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("ec point not on curve")
+		}
+		return pub, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
@@ -0,0 +1,318 @@
+package sso
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+const (
+	samlProtocolNS = "urn:oasis:names:tc:SAML:2.0:protocol"
+	samlAssertNS   = "urn:oasis:names:tc:SAML:2.0:assertion"
+	samlSuccess    = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	samlBearer     = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	// maxSAMLResponse bounds the posted response before it is parsed.
+	maxSAMLResponse = 256 << 10
+)
+
+// SAMLService is this server as a SAML service provider for one
+// workspace: its entity ID and where the IdP posts responses.
+type SAMLService struct {
+	EntityID string
+	ACSURL   string
+}
+
+// SAMLIdP is the workspace's identity provider.
+type SAMLIdP struct {
+	SSOURL   string
+	EntityID string
+	// Certificate is the PEM certificate the IdP signs with.
+	Certificate string
+}
+
+// ParseCertificate reads a PEM (or bare base64) X.509 certificate.
+func ParseCertificate(text string) (*x509.Certificate, error) {
+	text = strings.TrimSpace(text)
+	if block, _ := pem.Decode([]byte(text)); block != nil {
+		return x509.ParseCertificate(block.Bytes)
+	}
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+	if err != nil {
+		return nil, errors.New("certificate is not PEM or base64")
+	}
+	return x509.ParseCertificate(der)
+}
+
+// AuthURL is the IdP's sign-in URL carrying an AuthnRequest with id over
+// the HTTP-Redirect binding. relayState comes back with the response.
+func (sp SAMLService) AuthURL(idp SAMLIdP, id, relayState string, now time.Time) (string, error) {
+	req := fmt.Sprintf(`<samlp:AuthnRequest xmlns:samlp="%s" xmlns:saml="%s" ID="%s" Version="2.0" IssueInstant="%s" Destination="%s" AssertionConsumerServiceURL="%s" ProtocolBinding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"><saml:Issuer>%s</saml:Issuer><samlp:NameIDPolicy AllowCreate="true"/></samlp:AuthnRequest>`,
+		samlProtocolNS, samlAssertNS, id, now.UTC().Format(time.RFC3339),
+		xmlEscape(idp.SSOURL), xmlEscape(sp.ACSURL), xmlEscape(sp.EntityID))
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write([]byte(req)); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	q := url.Values{
+		"SAMLRequest": {base64.StdEncoding.EncodeToString(buf.Bytes())},
+		"RelayState":  {relayState},
+	}
+	sep := "?"
+	if strings.Contains(idp.SSOURL, "?") {
+		sep = "&"
+	}
+	return idp.SSOURL + sep + q.Encode(), nil
+}
+
+// Metadata is the service provider metadata IdPs are configured from.
+func (sp SAMLService) Metadata() []byte {
+	return []byte(fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="%s">
+  <md:SPSSODescriptor AuthnRequestsSigned="false" WantAssertionsSigned="true" protocolSupportEnumeration="%s">
+    <md:NameIDFormat>urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress</md:NameIDFormat>
+    <md:AssertionConsumerService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST" Location="%s" index="0" isDefault="true"/>
+  </md:SPSSODescriptor>
+</md:EntityDescriptor>
+`, xmlEscape(sp.EntityID), samlProtocolNS, xmlEscape(sp.ACSURL)))
+}
+
+// ParseResponse checks a posted SAMLResponse answering request requestID
+// and returns who it signs in. The Response or its Assertion must be
+// signed by idp's certificate; only what the signature covers is read.
+// groupsAttr names the attribute listing the user's groups.
+func (sp SAMLService) ParseResponse(idp SAMLIdP, encoded, requestID, groupsAttr string, now time.Time) (Identity, error) {
+	if len(encoded) > maxSAMLResponse {
+		return Identity{}, errors.New("saml response too large")
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+	if err != nil {
+		return Identity{}, errors.New("saml response is not base64")
+	}
+	cert, err := ParseCertificate(idp.Certificate)
+	if err != nil {
+		return Identity{}, err
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(raw); err != nil {
+		return Identity{}, fmt.Errorf("saml response: %w", err)
+	}
+	resp := doc.Root()
+	if resp == nil || resp.Tag != "Response" || resp.NamespaceURI() != samlProtocolNS {
+		return Identity{}, errors.New("not a saml response")
+	}
+	validator := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: []*x509.Certificate{cert}})
+
+	if hasChild(resp, "Signature") {
+		if resp, err = validator.Validate(resp); err != nil {
+			return Identity{}, fmt.Errorf("response signature: %w", err)
+		}
+	}
+	if dest := resp.SelectAttrValue("Destination", ""); dest != "" && dest != sp.ACSURL {
+		return Identity{}, errors.New("response is for another destination")
+	}
+	if irt := resp.SelectAttrValue("InResponseTo", ""); irt != "" && irt != requestID {
+		return Identity{}, errors.New("response answers another sign-in")
+	}
+	if status := resp.FindElement("./Status/StatusCode"); status == nil || status.SelectAttrValue("Value", "") != samlSuccess {
+		return Identity{}, errors.New("identity provider did not sign the user in")
+	}
+	if len(resp.SelectElements("EncryptedAssertion")) > 0 {
+		return Identity{}, errors.New("encrypted assertions are not supported")
+	}
+	assertions := resp.SelectElements("Assertion")
+	if len(assertions) != 1 {
+		return Identity{}, errors.New("response must carry exactly one assertion")
+	}
+	assertion := assertions[0]
+	switch {
+	case hasChild(assertion, "Signature"):
+		if assertion, err = validator.Validate(detach(assertion)); err != nil {
+			return Identity{}, fmt.Errorf("assertion signature: %w", err)
+		}
+	case resp == doc.Root():
+		// Neither the response nor the assertion was signed.
+		return Identity{}, errors.New("saml response is not signed")
+	}
+
+	out := etree.NewDocument()
+	out.SetRoot(assertion)
+	b, err := out.WriteToBytes()
+	if err != nil {
+		return Identity{}, err
+	}
+	var a samlAssertion
+	if err := xml.Unmarshal(b, &a); err != nil {
+		return Identity{}, fmt.Errorf("assertion: %w", err)
+	}
+	return a.identity(sp, idp, requestID, groupsAttr, now)
+}
+
+type samlAssertion struct {
+	Issuer  string `xml:"Issuer"`
+	Subject struct {
+		NameID        string `xml:"NameID"`
+		Confirmations []struct {
+			Method string `xml:"Method,attr"`
+			Data   struct {
+				Recipient    string `xml:"Recipient,attr"`
+				NotOnOrAfter string `xml:"NotOnOrAfter,attr"`
+				InResponseTo string `xml:"InResponseTo,attr"`
+			} `xml:"SubjectConfirmationData"`
+		} `xml:"SubjectConfirmation"`
+	} `xml:"Subject"`
+	Conditions struct {
+		NotBefore    string `xml:"NotBefore,attr"`
+		NotOnOrAfter string `xml:"NotOnOrAfter,attr"`
+		Restrictions []struct {
+			Audiences []string `xml:"Audience"`
+		} `xml:"AudienceRestriction"`
+	} `xml:"Conditions"`
+	Attributes []struct {
+		Name         string   `xml:"Name,attr"`
+		FriendlyName string   `xml:"FriendlyName,attr"`
+		Values       []string `xml:"AttributeValue"`
+	} `xml:"AttributeStatement>Attribute"`
+}
+
+func (a samlAssertion) identity(sp SAMLService, idp SAMLIdP, requestID, groupsAttr string, now time.Time) (Identity, error) {
+	if strings.TrimSpace(a.Issuer) != idp.EntityID {
+		return Identity{}, errors.New("assertion is from another issuer")
+	}
+	if !within(now, a.Conditions.NotBefore, a.Conditions.NotOnOrAfter) {
+		return Identity{}, errors.New("assertion has expired or is not yet valid")
+	}
+	// Every audience restriction must name us, and there must be one.
+	if len(a.Conditions.Restrictions) == 0 {
+		return Identity{}, errors.New("assertion has no audience")
+	}
+	for _, r := range a.Conditions.Restrictions {
+		ok := false
+		for _, aud := range r.Audiences {
+			ok = ok || strings.TrimSpace(aud) == sp.EntityID
+		}
+		if !ok {
+			return Identity{}, errors.New("assertion is for another audience")
+		}
+	}
+	confirmed := false
+	for _, c := range a.Subject.Confirmations {
+		if c.Method == samlBearer && c.Data.Recipient == sp.ACSURL && c.Data.InResponseTo == requestID &&
+			c.Data.NotOnOrAfter != "" && within(now, "", c.Data.NotOnOrAfter) {
+			confirmed = true
+		}
+	}
+	if !confirmed {
+		return Identity{}, errors.New("assertion does not answer this sign-in")
+	}
+	id := Identity{Subject: strings.TrimSpace(a.Subject.NameID)}
+	if id.Subject == "" {
+		return Identity{}, errors.New("assertion has no subject")
+	}
+	for _, attr := range a.Attributes {
+		name := attrName(attr.Name)
+		friendly := strings.ToLower(attr.FriendlyName)
+		values := nonEmpty(attr.Values)
+		switch {
+		case groupsAttr != "" && (attr.Name == groupsAttr || strings.EqualFold(attr.FriendlyName, groupsAttr)):
+			id.Groups = append(id.Groups, values...)
+		case len(values) == 0:
+		case name == "email" || name == "mail" || name == "emailaddress" || friendly == "mail" || friendly == "email":
+			id.Email = values[0]
+		case name == "username" || name == "uid" || friendly == "uid":
+			id.Username = values[0]
+		}
+	}
+	if id.Email == "" && strings.Contains(id.Subject, "@") {
+		id.Email = id.Subject
+	}
+	// The IdP vouches for the addresses it asserts.
+	id.EmailVerified = id.Email != ""
+	return id, nil
+}
+
+// attrName is an attribute's name without a URI or OID prefix, lowercased:
+// ".../claims/emailaddress" and "email" are both recognised.
+func attrName(name string) string {
+	if i := strings.LastIndexAny(name, "/:"); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.ToLower(name)
+}
+
+func nonEmpty(values []string) []string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// within reports whether now falls in [notBefore, notOnOrAfter), either of
+// which may be empty, give or take clockSkew.
+func within(now time.Time, notBefore, notOnOrAfter string) bool {
+	if notBefore != "" {
+		t, err := time.Parse(time.RFC3339, notBefore)
+		if err != nil || now.Add(clockSkew).Before(t) {
+			return false
+		}
+	}
+	if notOnOrAfter != "" {
+		t, err := time.Parse(time.RFC3339, notOnOrAfter)
+		if err != nil || !now.Add(-clockSkew).Before(t) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasChild(el *etree.Element, tag string) bool {
+	for _, c := range el.ChildElements() {
+		if c.Tag == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// detach copies el out of its document with the namespace declarations it
+// inherits, so its signature can be checked on its own.
+func detach(el *etree.Element) *etree.Element {
+	out := el.Copy()
+	for p := el.Parent(); p != nil; p = p.Parent() {
+		for _, a := range p.Attr {
+			if a.Space != "xmlns" && !(a.Space == "" && a.Key == "xmlns") {
+				continue
+			}
+			if out.SelectAttr(a.FullKey()) == nil {
+				out.CreateAttr(a.FullKey(), a.Value)
+			}
+		}
+	}
+	return out
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
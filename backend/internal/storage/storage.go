@@ -0,0 +1,91 @@
+// Package storage decides where uploads live. Rooms tagged with a region
+// keep their media in that region's location; everything else uses the
+// default UPLOADS_DIR.
+package storage
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// Location is one place uploads are kept: a directory on disk and the URL
+// prefix the server serves it under.
+type Location struct {
+	Dir       string
+	URLPrefix string
+}
+
+// Path returns where a file stored under the relative name rel lives on disk.
+func (l Location) Path(rel ...string) string {
+	return filepath.Join(append([]string{l.Dir}, rel...)...)
+}
+
+// URL returns the public URL of a file stored under rel, which uses forward
+// slashes.
+func (l Location) URL(rel string) string {
+	return l.URLPrefix + "/" + rel
+}
+
+// BlobDir is the directory, relative to a location, that content-addressed
+// uploads live under.
+const BlobDir = "blobs"
+
+// ContentPath is where the upload with hex SHA-256 sum and extension ext is
+// stored, relative to a location. Files are sharded by the first two bytes
+// of the hash, so no directory grows much past a few thousand entries.
+func ContentPath(sum, ext string) string {
+	return BlobDir + "/" + sum[:2] + "/" + sum[2:4] + "/" + sum + ext
+}
+
+// Locations maps region names to upload locations.
+type Locations struct {
+	def     Location
+	regions map[string]Location
+}
+
+// RegionURLPrefix is where a region's uploads are served.
+func RegionURLPrefix(region string) string {
+	return "/uploads/regions/" + region
+}
+
+func New(defaultDir string, regionDirs map[string]string) *Locations {
+	l := &Locations{def: Location{Dir: defaultDir, URLPrefix: "/uploads"}, regions: map[string]Location{}}
+	for name, dir := range regionDirs {
+		l.regions[name] = Location{Dir: dir, URLPrefix: RegionURLPrefix(name)}
+	}
+	return l
+}
+
+// Default is the location for avatars and rooms without a region.
+func (l *Locations) Default() Location {
+	return l.def
+}
+
+// For returns region's location, or the default when region is empty or has
+// no location of its own.
+func (l *Locations) For(region string) Location {
+	if loc, ok := l.regions[region]; ok {
+		return loc
+	}
+	return l.def
+}
+
+// Region returns the location configured for region itself.
+func (l *Locations) Region(region string) (Location, bool) {
+	loc, ok := l.regions[region]
+	return loc, ok
+}
+
+// All returns every location, the default first and regions by name.
+func (l *Locations) All() []Location {
+	names := make([]string, 0, len(l.regions))
+	for name := range l.regions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := []Location{l.def}
+	for _, name := range names {
+		out = append(out, l.regions[name])
+	}
+	return out
+}
@@ -0,0 +1,202 @@
+// Package telemetry sends opt-in anonymous usage reports: aggregate counts
+// of users, rooms and messages, how many of each feature is set up, how
+// often each API endpoint was called, and the server version. Reports
+// carry a random instance id and nothing that names a user, room or
+// deployment. Nothing is collected or sent unless it is turned on.
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+
+	"talkie/backend/internal/buildinfo"
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+const (
+	sendTimeout = 30 * time.Second
+	// checkEvery is how often the reporter looks whether a report is due,
+	// so a restart does not reset the schedule.
+	checkEvery = time.Hour
+	// FlushInterval is how often each instance adds its endpoint counts
+	// to the shared totals.
+	FlushInterval = 5 * time.Minute
+)
+
+type Store interface {
+	GetTelemetryState(ctx context.Context) (uuid.UUID, *time.Time, error)
+	MarkTelemetrySent(ctx context.Context, at time.Time) error
+	AddTelemetryUsage(ctx context.Context, counts map[string]int64) error
+	TakeTelemetryUsage(ctx context.Context) (map[string]int64, error)
+	GetTelemetryStats(ctx context.Context) (db.TelemetryStats, error)
+}
+
+// Usage counts endpoint calls on this instance between flushes. A nil
+// Usage counts nothing.
+type Usage struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func NewUsage() *Usage {
+	return &Usage{counts: map[string]int64{}}
+}
+
+// Add counts one call of feature, an endpoint such as
+// "GET /api/rooms/{roomID}/messages".
+func (u *Usage) Add(feature string) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	u.counts[feature]++
+	u.mu.Unlock()
+}
+
+func (u *Usage) take() map[string]int64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	counts := u.counts
+	u.counts = map[string]int64{}
+	return counts
+}
+
+// Flush adds this instance's counts to the shared totals every
+// FlushInterval until ctx is cancelled, and once more then.
+func (u *Usage) Flush(ctx context.Context, store Store) {
+	ticker := time.NewTicker(FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			final, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			u.flush(final, store)
+			cancel()
+			return
+		case <-ticker.C:
+			u.flush(ctx, store)
+		}
+	}
+}
+
+func (u *Usage) flush(ctx context.Context, store Store) {
+	counts := u.take()
+	if len(counts) == 0 {
+		return
+	}
+	if err := store.AddTelemetryUsage(ctx, counts); err != nil {
+		log.Printf("telemetry: save endpoint counts failed: %v", err)
+	}
+}
+
+// Report is what is sent.
+type Report struct {
+	InstanceID uuid.UUID `json:"instance_id"`
+	Version    string    `json:"version"`
+	GoVersion  string    `json:"go_version"`
+	OS         string    `json:"os"`
+	Arch       string    `json:"arch"`
+	db.TelemetryStats
+	// Endpoints counts calls per method and route pattern since the
+	// previous report.
+	Endpoints map[string]int64 `json:"endpoints"`
+	// Since is when the previous report was sent.
+	Since *time.Time `json:"since,omitempty"`
+}
+
+// Reporter sends a Report to url every interval.
+type Reporter struct {
+	store    Store
+	url      string
+	interval time.Duration
+	client   *http.Client
+}
+
+func NewReporter(store Store, url string, interval time.Duration) *Reporter {
+	return &Reporter{store: store, url: url, interval: interval, client: &http.Client{Timeout: sendTimeout}}
+}
+
+// Run sends reports as they fall due until ctx is cancelled.
+func (r *Reporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(checkEvery)
+	defer ticker.Stop()
+	for {
+		if err := r.Step(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("telemetry report failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Step sends a report if the last one is at least an interval old.
+func (r *Reporter) Step(ctx context.Context) error {
+	id, lastSent, err := r.store.GetTelemetryState(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if lastSent != nil && now.Sub(*lastSent) < r.interval {
+		return nil
+	}
+	stats, err := r.store.GetTelemetryStats(ctx)
+	if err != nil {
+		return err
+	}
+	// Counts taken here are lost if sending fails, which only makes the
+	// next report cover a shorter stretch.
+	endpoints, err := r.store.TakeTelemetryUsage(ctx)
+	if err != nil {
+		return err
+	}
+	report := Report{
+		InstanceID:     id,
+		Version:        buildinfo.String(),
+		GoVersion:      runtime.Version(),
+		OS:             runtime.GOOS,
+		Arch:           runtime.GOARCH,
+		TelemetryStats: stats,
+		Endpoints:      endpoints,
+		Since:          lastSent,
+	}
+	if err := r.send(ctx, report); err != nil {
+		return err
+	}
+	return r.store.MarkTelemetrySent(ctx, now)
+}
+
+func (r *Reporter) send(ctx context.Context, report Report) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "talkie/"+report.Version)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("telemetry endpoint returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// Package textnorm normalizes message text before it is checked and stored,
+// so the same visible text is always the same string: rules, search and
+// mention matching see through lookalike encodings and invisible padding.
+package textnorm
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	zwnj = '\u200c'
+	zwj  = '\u200d'
+)
+
+// dropped are invisible characters with no place in chat text. They are
+// used to pad messages, split words past filters or make blank-looking
+// messages.
+var dropped = map[rune]bool{
+	'\u200b': true, // zero width space
+	'\u2060': true, // word joiner
+	'\u2061': true, // invisible operators
+	'\u2062': true,
+	'\u2063': true,
+	'\u2064': true,
+	'\ufeff': true, // byte order mark
+	'\u180e': true, // Mongolian vowel separator
+	'\u034f': true, // combining grapheme joiner
+	'\u115f': true, // Hangul fillers, rendered blank
+	'\u1160': true,
+	'\u3164': true,
+	'\uffa0': true,
+}
+
+// Message returns s in NFC with invisible characters removed. Joiners and
+// variation selectors, which emoji sequences and some scripts need, survive
+// one at a time between visible characters; runs of them collapse to one.
+func Message(s string) string {
+	s = norm.NFC.String(s)
+	if !strings.ContainsFunc(s, invisible) {
+		return s
+	}
+	runes := []rune(s)
+	var b strings.Builder
+	b.Grow(len(s))
+	var prev rune // last rune written
+	for i, r := range runes {
+		switch {
+		case dropped[r]:
+			continue
+		case r == zwj || r == zwnj:
+			if prev == 0 || prev == zwj || prev == zwnj || unicode.IsSpace(prev) || !visibleAfter(runes[i+1:]) {
+				continue
+			}
+		case isVariationSelector(r):
+			if prev == 0 || isVariationSelector(prev) {
+				continue
+			}
+		}
+		b.WriteRune(r)
+		prev = r
+	}
+	return b.String()
+}
+
+func invisible(r rune) bool {
+	return dropped[r] || r == zwj || r == zwnj || isVariationSelector(r)
+}
+
+func isVariationSelector(r rune) bool {
+	return (r >= '\ufe00' && r <= '\ufe0f') || (r >= 0xe0100 && r <= 0xe01ef)
+}
+
+// visibleAfter reports whether a joiner followed by rest joins onto a
+// visible character.
+func visibleAfter(rest []rune) bool {
+	for _, r := range rest {
+		if invisible(r) {
+			continue
+		}
+		return !unicode.IsSpace(r)
+	}
+	return false
+}
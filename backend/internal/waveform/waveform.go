@@ -0,0 +1,225 @@
+// Package waveform reduces an audio file to a short amplitude envelope that
+// clients draw as a voice note's scrub bar.
+package waveform
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Buckets is how many amplitude values a waveform has.
+const Buckets = 64
+
+const (
+	ffmpegTimeout = 15 * time.Second
+	// ffmpegRate is the sample rate ffmpeg decodes to; an envelope needs
+	// far less than speech quality.
+	ffmpegRate = 8000
+	// maxDecodedSeconds bounds how much decoded audio is held in memory.
+	maxDecodedSeconds = 30 * 60
+)
+
+// ErrUnsupported means the format cannot be decoded here: not WAV, and no
+// ffmpeg configured.
+var ErrUnsupported = errors.New("waveform: unsupported audio format")
+
+// Info is what is computed for a voice note.
+type Info struct {
+	// Waveform holds Buckets peak amplitudes scaled to 0-100.
+	Waveform   []int `json:"waveform"`
+	DurationMS int64 `json:"duration_ms"`
+}
+
+// Analyzer computes waveforms. WAV is decoded natively; other formats need
+// an ffmpeg binary. A nil Analyzer only handles WAV.
+type Analyzer struct {
+	ffmpeg string
+}
+
+// New returns an Analyzer that decodes non-WAV audio with the ffmpeg binary
+// at ffmpegPath, or only WAV when ffmpegPath is empty.
+func New(ffmpegPath string) *Analyzer {
+	return &Analyzer{ffmpeg: ffmpegPath}
+}
+
+// Analyze computes the waveform of the audio file at path, whose sniffed
+// content type is contentType.
+func (a *Analyzer) Analyze(ctx context.Context, path, contentType string) (Info, error) {
+	if contentType == "audio/wave" {
+		f, err := os.Open(path)
+		if err != nil {
+			return Info{}, err
+		}
+		defer f.Close()
+		return decodeWAV(bufio.NewReader(f))
+	}
+	if a == nil || a.ffmpeg == "" {
+		return Info{}, ErrUnsupported
+	}
+	return a.decodeFFmpeg(ctx, path)
+}
+
+// decodeFFmpeg has ffmpeg turn the file into mono 16-bit PCM at ffmpegRate.
+func (a *Analyzer) decodeFFmpeg(ctx context.Context, path string) (Info, error) {
+	ctx, cancel := context.WithTimeout(ctx, ffmpegTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, a.ffmpeg, "-nostdin", "-v", "error", "-i", path,
+		"-ac", "1", "-ar", fmt.Sprint(ffmpegRate), "-f", "s16le", "-")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return Info{}, err
+	}
+	if err := cmd.Start(); err != nil {
+		return Info{}, fmt.Errorf("waveform: start ffmpeg: %w", err)
+	}
+	raw, readErr := io.ReadAll(io.LimitReader(out, maxDecodedSeconds*ffmpegRate*2))
+	// Drain whatever is past the limit so ffmpeg can exit.
+	_, _ = io.Copy(io.Discard, out)
+	if err := cmd.Wait(); err != nil {
+		return Info{}, fmt.Errorf("waveform: ffmpeg: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	if readErr != nil {
+		return Info{}, readErr
+	}
+	frames := len(raw) / 2
+	env := newEnvelope(int64(frames))
+	for i := 0; i < frames; i++ {
+		env.add(int64(i), math.Abs(float64(int16(binary.LittleEndian.Uint16(raw[2*i:]))))/32768)
+	}
+	return env.info(int64(frames), ffmpegRate), nil
+}
+
+// decodeWAV streams PCM or float WAV data into an envelope without holding
+// the samples.
+func decodeWAV(r io.Reader) (Info, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil || string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return Info{}, errors.New("waveform: not a WAV file")
+	}
+	var format, channels, bits uint16
+	var rate uint32
+	for {
+		var hdr [8]byte
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return Info{}, errors.New("waveform: WAV has no data chunk")
+		}
+		size := int64(binary.LittleEndian.Uint32(hdr[4:]))
+		switch string(hdr[0:4]) {
+		case "fmt ":
+			if size < 16 {
+				return Info{}, errors.New("waveform: short WAV fmt chunk")
+			}
+			fmtChunk := make([]byte, size+size%2)
+			if _, err := io.ReadFull(r, fmtChunk); err != nil {
+				return Info{}, err
+			}
+			format = binary.LittleEndian.Uint16(fmtChunk[0:])
+			channels = binary.LittleEndian.Uint16(fmtChunk[2:])
+			rate = binary.LittleEndian.Uint32(fmtChunk[4:])
+			bits = binary.LittleEndian.Uint16(fmtChunk[14:])
+			// WAVE_FORMAT_EXTENSIBLE keeps the real format in its sub-format GUID.
+			if format == 0xFFFE && size >= 26 {
+				format = binary.LittleEndian.Uint16(fmtChunk[24:])
+			}
+		case "data":
+			if channels == 0 || rate == 0 {
+				return Info{}, errors.New("waveform: WAV data before fmt chunk")
+			}
+			return wavSamples(r, size, format, channels, bits, rate)
+		default:
+			if _, err := io.CopyN(io.Discard, r, size+size%2); err != nil {
+				return Info{}, err
+			}
+		}
+	}
+}
+
+func wavSamples(r io.Reader, size int64, format, channels, bits uint16, rate uint32) (Info, error) {
+	width := int(bits) / 8
+	var sample func(b []byte) float64
+	switch {
+	case format == 1 && bits == 8:
+		sample = func(b []byte) float64 { return math.Abs(float64(int(b[0])-128)) / 128 }
+	case format == 1 && bits == 16:
+		sample = func(b []byte) float64 { return math.Abs(float64(int16(binary.LittleEndian.Uint16(b)))) / (1 << 15) }
+	case format == 1 && bits == 24:
+		sample = func(b []byte) float64 {
+			v := int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+			return math.Abs(float64(v)) / (1 << 23)
+		}
+	case format == 1 && bits == 32:
+		sample = func(b []byte) float64 { return math.Abs(float64(int32(binary.LittleEndian.Uint32(b)))) / (1 << 31) }
+	case format == 3 && bits == 32:
+		sample = func(b []byte) float64 { return math.Abs(float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))) }
+	default:
+		return Info{}, ErrUnsupported
+	}
+	frameSize := width * int(channels)
+	frames := size / int64(frameSize)
+	env := newEnvelope(frames)
+	br := bufio.NewReaderSize(r, 64<<10)
+	frame := make([]byte, frameSize)
+	var i int64
+	for ; i < frames; i++ {
+		if _, err := io.ReadFull(br, frame); err != nil {
+			// Recorders that crash leave the header claiming more data
+			// than was written; use what is there.
+			break
+		}
+		peak := 0.0
+		for c := 0; c < int(channels); c++ {
+			peak = max(peak, sample(frame[c*width:]))
+		}
+		env.add(i, peak)
+	}
+	return env.info(i, int64(rate)), nil
+}
+
+// envelope keeps the peak of each of Buckets equal slices of the audio.
+type envelope struct {
+	total int64
+	peaks [Buckets]float64
+}
+
+func newEnvelope(total int64) *envelope {
+	return &envelope{total: max(total, 1)}
+}
+
+func (e *envelope) add(i int64, v float64) {
+	b := i * Buckets / e.total
+	if b >= Buckets {
+		b = Buckets - 1
+	}
+	e.peaks[b] = max(e.peaks[b], v)
+}
+
+// info scales the peaks so the loudest bucket reads 100, which keeps quiet
+// recordings from drawing as a flat line.
+func (e *envelope) info(frames, rate int64) Info {
+	loudest := 0.0
+	for _, p := range e.peaks {
+		loudest = max(loudest, p)
+	}
+	out := Info{Waveform: make([]int, Buckets)}
+	if rate > 0 {
+		out.DurationMS = frames * 1000 / rate
+	}
+	if loudest == 0 {
+		return out
+	}
+	for i, p := range e.peaks {
+		out.Waveform[i] = int(math.Round(min(p/loudest, 1) * 100))
+	}
+	return out
+}
@@ -0,0 +1,26 @@
+// Package webui holds the built web client, compiled into the server so
+// that an instance can run as a single binary. `make dist` copies
+// frontend/dist here before building; a plain go build embeds nothing and
+// the client has to be hosted separately.
+package webui
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed all:dist
+var dist embed.FS
+
+// FS returns the embedded client, rooted at its index.html, or nil when
+// this binary was built without one.
+func FS() fs.FS {
+	sub, err := fs.Sub(dist, "dist")
+	if err != nil {
+		return nil
+	}
+	if _, err := fs.Stat(sub, "index.html"); err != nil {
+		return nil
+	}
+	return sub
+}
@@ -0,0 +1,207 @@
+// Package wordmask masks listed words in message text. All words are
+// compiled into one Aho-Corasick automaton, so masking costs a single pass
+// over the text however many words a room lists.
+package wordmask
+
+import (
+	"strings"
+	"unicode"
+)
+
+// maskRune replaces each letter of a masked word.
+const maskRune = '*'
+
+type node struct {
+	next map[rune]int32
+	fail int32
+	// depth is the length in runes of the longest word ending here, or 0
+	// when no word ends here or at any suffix of it.
+	depth int32
+	// end is the length of the word ending exactly here, or 0.
+	end int32
+	// out is the nearest node on the failure chain where a word ends.
+	out int32
+}
+
+// Matcher finds whole-word, case-insensitive occurrences of its words. The
+// zero Matcher and a nil *Matcher match nothing.
+type Matcher struct {
+	nodes []node
+}
+
+// New compiles words into a Matcher. Blank words are ignored; nil is
+// returned when none are left.
+func New(words []string) *Matcher {
+	m := &Matcher{nodes: []node{{}}}
+	added := false
+	for _, w := range words {
+		w = strings.TrimSpace(w)
+		if w == "" {
+			continue
+		}
+		m.add(fold(w))
+		added = true
+	}
+	if !added {
+		return nil
+	}
+	m.link()
+	return m
+}
+
+func fold(s string) []rune {
+	runes := []rune(s)
+	for i, r := range runes {
+		runes[i] = unicode.ToLower(r)
+	}
+	return runes
+}
+
+func (m *Matcher) add(word []rune) {
+	cur := int32(0)
+	for _, r := range word {
+		next, ok := m.nodes[cur].next[r]
+		if !ok {
+			next = int32(len(m.nodes))
+			m.nodes = append(m.nodes, node{})
+			if m.nodes[cur].next == nil {
+				m.nodes[cur].next = make(map[rune]int32)
+			}
+			m.nodes[cur].next[r] = next
+		}
+		cur = next
+	}
+	m.nodes[cur].depth = int32(len(word))
+	m.nodes[cur].end = int32(len(word))
+}
+
+// link sets failure links breadth first and carries each node's longest
+// match down from its failure target, so a lookup never walks the chain.
+func (m *Matcher) link() {
+	queue := make([]int32, 0, len(m.nodes))
+	for _, child := range m.nodes[0].next {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for r, child := range m.nodes[cur].next {
+			queue = append(queue, child)
+			f := m.nodes[cur].fail
+			for {
+				if next, ok := m.nodes[f].next[r]; ok && next != child {
+					m.nodes[child].fail = next
+					break
+				}
+				if f == 0 {
+					break
+				}
+				f = m.nodes[f].fail
+			}
+			fail := m.nodes[child].fail
+			if d := m.nodes[fail].depth; d > m.nodes[child].depth {
+				m.nodes[child].depth = d
+			}
+			if m.nodes[fail].end > 0 {
+				m.nodes[child].out = fail
+			} else {
+				m.nodes[child].out = m.nodes[fail].out
+			}
+		}
+	}
+}
+
+func (m *Matcher) step(cur int32, r rune) int32 {
+	for {
+		if next, ok := m.nodes[cur].next[r]; ok {
+			return next
+		}
+		if cur == 0 {
+			return 0
+		}
+		cur = m.nodes[cur].fail
+	}
+}
+
+// Mask returns text with the letters of every listed word that stands as a
+// whole word replaced by '*', and whether anything was masked. Matching
+// ignores case; a word inside a longer word is left alone.
+func (m *Matcher) Mask(text string) (string, bool) {
+	if m == nil || len(m.nodes) < 2 {
+		return text, false
+	}
+	runes := []rune(text)
+	var masked []bool
+	cur := int32(0)
+	for i, r := range runes {
+		cur = m.step(cur, unicode.ToLower(r))
+		// Only the longest word ending here is tried. Any shorter one is
+		// its suffix, so unless the longer word has punctuation in it, the
+		// shorter one follows a letter and cannot stand alone either.
+		d := int(m.nodes[cur].depth)
+		if d == 0 {
+			continue
+		}
+		start := i - d + 1
+		if start > 0 && isWordRune(runes[start-1]) || i+1 < len(runes) && isWordRune(runes[i+1]) {
+			continue
+		}
+		if masked == nil {
+			masked = make([]bool, len(runes))
+		}
+		for j := start; j <= i; j++ {
+			masked[j] = true
+		}
+	}
+	if masked == nil {
+		return text, false
+	}
+	for i, r := range runes {
+		if masked[i] && !unicode.IsSpace(r) {
+			runes[i] = maskRune
+		}
+	}
+	return string(runes), true
+}
+
+// Find returns the listed words that stand as whole words in text, each
+// once, lowercased, in the order they first end. Unlike Mask it reports a
+// word even when a longer listed word ends at the same place.
+func (m *Matcher) Find(text string) []string {
+	if m == nil || len(m.nodes) < 2 {
+		return nil
+	}
+	runes := []rune(text)
+	folded := make([]rune, len(runes))
+	var found []string
+	var seen map[string]bool
+	cur := int32(0)
+	for i, r := range runes {
+		folded[i] = unicode.ToLower(r)
+		cur = m.step(cur, folded[i])
+		n := cur
+		if m.nodes[n].end == 0 {
+			n = m.nodes[n].out
+		}
+		for ; n != 0; n = m.nodes[n].out {
+			start := i - int(m.nodes[n].end) + 1
+			if start > 0 && isWordRune(runes[start-1]) || i+1 < len(runes) && isWordRune(runes[i+1]) {
+				continue
+			}
+			w := string(folded[start : i+1])
+			if seen[w] {
+				continue
+			}
+			if seen == nil {
+				seen = make(map[string]bool)
+			}
+			seen[w] = true
+			found = append(found, w)
+		}
+	}
+	return found
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
@@ -0,0 +1,143 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/metrics"
+
+	"github.com/google/uuid"
+)
+
+const automationsCursor = "automations"
+
+var (
+	automationRuns   = metrics.NewCounter("talkie_automation_runs_total", "Automations run by the automations worker.")
+	automationErrors = metrics.NewCounter("talkie_automation_errors_total", "Automation runs with a failed action.")
+)
+
+type AutomationStore interface {
+	GetWorkerCursor(ctx context.Context, name string) (int64, error)
+	SetWorkerCursor(ctx context.Context, name string, position int64) error
+	NextMessageBatch(ctx context.Context, cursor int64, settle time.Duration, limit int) (db.MessageBatch, error)
+	ListRoomAutomations(ctx context.Context, roomIDs []uuid.UUID) ([]db.Automation, error)
+	ListAutomationMessages(ctx context.Context, fromID, toID int64) ([]db.Message, error)
+	StartAutomationRun(ctx context.Context, automationID, messageID int64) (bool, error)
+	FinishAutomationRun(ctx context.Context, automationID, messageID int64, runErr string) error
+}
+
+// AutomationActions carries out automation actions; the HTTP server does,
+// since posting and mailing need its hub and mailer.
+type AutomationActions interface {
+	RunAutomationAction(ctx context.Context, a db.Automation, act db.AutomationAction, m db.Message) error
+}
+
+// Automations runs users' automations against new messages. Unlike the
+// derived-data steps, actions are not idempotent, so each automation and
+// message pair is claimed in automation_runs before its actions run: a crash
+// mid-run loses that run rather than repeating it.
+type Automations struct {
+	store     AutomationStore
+	actions   AutomationActions
+	interval  time.Duration
+	settle    time.Duration
+	batchSize int
+}
+
+func NewAutomations(store AutomationStore, actions AutomationActions, interval time.Duration) *Automations {
+	return &Automations{
+		store:     store,
+		actions:   actions,
+		interval:  interval,
+		settle:    2 * time.Second,
+		batchSize: 200,
+	}
+}
+
+// Run processes batches until ctx is cancelled, like Worker.Run.
+func (w *Automations) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		n, err := w.Step(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("automations batch failed: %v", err)
+		}
+		if err == nil && n == w.batchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Step runs the automations fired by one batch and returns how many
+// messages it covered.
+func (w *Automations) Step(ctx context.Context) (int, error) {
+	cursor, err := w.store.GetWorkerCursor(ctx, automationsCursor)
+	if err != nil {
+		return 0, err
+	}
+	batch, err := w.store.NextMessageBatch(ctx, cursor, w.settle, w.batchSize)
+	if err != nil || batch.Count == 0 {
+		return 0, err
+	}
+	automations, err := w.store.ListRoomAutomations(ctx, batch.RoomIDs)
+	if err != nil {
+		return 0, err
+	}
+	if len(automations) > 0 {
+		if err := w.runBatch(ctx, batch, automations); err != nil {
+			return 0, err
+		}
+	}
+	if err := w.store.SetWorkerCursor(ctx, automationsCursor, batch.ToID); err != nil {
+		return 0, err
+	}
+	return batch.Count, nil
+}
+
+func (w *Automations) runBatch(ctx context.Context, batch db.MessageBatch, automations []db.Automation) error {
+	byRoom := make(map[uuid.UUID][]db.Automation)
+	for _, a := range automations {
+		byRoom[a.RoomID] = append(byRoom[a.RoomID], a)
+	}
+	messages, err := w.store.ListAutomationMessages(ctx, batch.FromID, batch.ToID)
+	if err != nil {
+		return err
+	}
+	for _, m := range messages {
+		for _, a := range byRoom[m.RoomID] {
+			// A new automation only sees messages sent after it, even
+			// when the cursor is behind.
+			if m.CreatedAt.Before(a.CreatedAt) || !a.Trigger.Matches(m.Content) {
+				continue
+			}
+			claimed, err := w.store.StartAutomationRun(ctx, a.ID, m.ID)
+			if err != nil {
+				return err
+			}
+			if !claimed {
+				continue
+			}
+			automationRuns.Inc()
+			var runErr string
+			for _, act := range a.Actions {
+				if err := w.actions.RunAutomationAction(ctx, a, act, m); err != nil {
+					automationErrors.Inc()
+					runErr = err.Error()
+					break
+				}
+			}
+			if err := w.store.FinishAutomationRun(ctx, a.ID, m.ID, runErr); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
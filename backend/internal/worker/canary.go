@@ -0,0 +1,238 @@
+package worker
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"talkie/backend/internal/auth"
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/metrics"
+	"talkie/backend/internal/ws"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// canaryDownAfter is how many probes in a row must fail before the
+	// canary alerts, as for uptime monitors.
+	canaryDownAfter = 2
+	canaryTimeout   = 30 * time.Second
+)
+
+// Stages a canary probe can fail at, the result label of
+// talkie_canary_runs_total besides "ok".
+const (
+	canarySetup     = "setup"
+	canaryDial      = "dial"
+	canarySend      = "send"
+	canaryBroadcast = "broadcast"
+	canaryPersist   = "persist"
+	canarySlow      = "slow"
+)
+
+var (
+	canaryRuns        = metrics.NewCounterVec("talkie_canary_runs_total", "Canary probes by result: ok or the stage that failed.", "result")
+	canaryLatency     = metrics.NewHistogram("talkie_canary_broadcast_seconds", "Time from the canary sending a message on one room socket to receiving it on another.", []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10})
+	canaryUp          = metrics.NewGauge("talkie_canary_up", "1 when the last canary probe passed.")
+	canaryLastSuccess = metrics.NewGauge("talkie_canary_last_success_timestamp_seconds", "Unix time of the last canary probe that passed.")
+)
+
+type CanaryStore interface {
+	EnsureCanary(ctx context.Context) (db.Canary, error)
+	GetMessage(ctx context.Context, roomID uuid.UUID, messageID int64) (db.Message, error)
+	DeleteCanaryMessages(ctx context.Context) (int64, error)
+}
+
+// CanaryAlerts is told when the canary starts failing and when it passes
+// again; the HTTP server implements it by notifying instance admins.
+type CanaryAlerts interface {
+	CanaryChanged(ctx context.Context, healthy bool, failure string)
+}
+
+// CanaryConfig says where the canary connects. URL is the ws:// or wss://
+// base of a server, normally this one over loopback, and JWTSecret signs
+// the probe account's token.
+type CanaryConfig struct {
+	URL        string
+	JWTSecret  string
+	Interval   time.Duration
+	MaxLatency time.Duration
+}
+
+// Canary sends a message through the whole chat pipeline on a schedule:
+// it opens two room sockets as its probe account, sends on one, waits for
+// the broadcast on the other and reads the message back from the
+// database. Results go to metrics, and sustained failure to CanaryAlerts.
+type Canary struct {
+	store  CanaryStore
+	alerts CanaryAlerts
+	cfg    CanaryConfig
+	dialer *websocket.Dialer
+
+	failures int
+	down     bool
+}
+
+func NewCanary(store CanaryStore, alerts CanaryAlerts, cfg CanaryConfig) *Canary {
+	return &Canary{
+		store:  store,
+		alerts: alerts,
+		cfg:    cfg,
+		dialer: &websocket.Dialer{HandshakeTimeout: 10 * time.Second},
+	}
+}
+
+// canaryError is a failed probe with the stage it failed at.
+type canaryError struct {
+	stage string
+	err   error
+}
+
+func (e *canaryError) Error() string { return e.stage + ": " + e.err.Error() }
+
+// Run probes every interval until ctx is cancelled. The first probe waits
+// an interval, giving the server time to start listening.
+func (c *Canary) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := c.Step(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("canary probe failed: %v", err)
+		}
+	}
+}
+
+// Step runs one probe, records its result and alerts when the canary goes
+// down or comes back.
+func (c *Canary) Step(ctx context.Context) error {
+	latency, err := c.probe(ctx)
+	if ctx.Err() != nil {
+		return nil
+	}
+	if _, err := c.store.DeleteCanaryMessages(ctx); err != nil {
+		log.Printf("canary: delete probe messages: %v", err)
+	}
+	if err == nil && latency > c.cfg.MaxLatency {
+		err = &canaryError{canarySlow, fmt.Errorf("broadcast took %s, over %s", latency.Round(time.Millisecond), c.cfg.MaxLatency)}
+	}
+
+	if err == nil {
+		canaryRuns.With("ok").Add(1)
+		canaryUp.Set(1)
+		canaryLastSuccess.Set(float64(time.Now().Unix()))
+		c.failures = 0
+		if c.down {
+			c.down = false
+			c.alerts.CanaryChanged(ctx, true, "")
+		}
+		return nil
+	}
+
+	stage := canarySetup
+	var ce *canaryError
+	if errors.As(err, &ce) {
+		stage = ce.stage
+	}
+	canaryRuns.With(stage).Add(1)
+	canaryUp.Set(0)
+	c.failures++
+	if c.failures >= canaryDownAfter && !c.down {
+		c.down = true
+		c.alerts.CanaryChanged(ctx, false, err.Error())
+	}
+	return err
+}
+
+// probe sends one message and returns how long its broadcast took.
+func (c *Canary) probe(ctx context.Context) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, canaryTimeout)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+
+	probe, err := c.store.EnsureCanary(ctx)
+	if err != nil {
+		return 0, &canaryError{canarySetup, err}
+	}
+	token, err := auth.GenerateJWT(c.cfg.JWTSecret, probe.UserID, probe.Username, probe.SessionVersion, "")
+	if err != nil {
+		return 0, &canaryError{canarySetup, err}
+	}
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return 0, &canaryError{canarySetup, err}
+	}
+	content := "canary " + hex.EncodeToString(nonce)
+
+	sender, err := c.dial(ctx, probe, token)
+	if err != nil {
+		return 0, &canaryError{canaryDial, err}
+	}
+	defer sender.Close()
+	receiver, err := c.dial(ctx, probe, token)
+	if err != nil {
+		return 0, &canaryError{canaryDial, err}
+	}
+	defer receiver.Close()
+	// state_sync is sent once a socket has joined the room, so after it
+	// both sockets are in the broadcast.
+	for _, conn := range []*websocket.Conn{sender, receiver} {
+		if _, err := await(conn, deadline, func(m ws.OutgoingMessage) bool { return m.Type == "state_sync" }); err != nil {
+			return 0, &canaryError{canaryDial, err}
+		}
+	}
+
+	start := time.Now()
+	_ = sender.SetWriteDeadline(deadline)
+	if err := sender.WriteJSON(ws.IncomingMessage{Type: "chat", Content: content}); err != nil {
+		return 0, &canaryError{canarySend, err}
+	}
+	got, err := await(receiver, deadline, func(m ws.OutgoingMessage) bool {
+		return m.Type == "chat" && m.Message != nil && m.Message.Content == content
+	})
+	if err != nil {
+		return 0, &canaryError{canaryBroadcast, err}
+	}
+	latency := time.Since(start)
+	canaryLatency.Observe(latency.Seconds())
+
+	stored, err := c.store.GetMessage(ctx, probe.RoomID, got.Message.ID)
+	if err != nil {
+		return 0, &canaryError{canaryPersist, fmt.Errorf("read message %d back: %w", got.Message.ID, err)}
+	}
+	if stored.Content != content {
+		return 0, &canaryError{canaryPersist, fmt.Errorf("message %d was stored as %q", got.Message.ID, stored.Content)}
+	}
+	return latency, nil
+}
+
+func (c *Canary) dial(ctx context.Context, probe db.Canary, token string) (*websocket.Conn, error) {
+	u := fmt.Sprintf("%s/ws/rooms/%s?token=%s", c.cfg.URL, probe.RoomID, url.QueryEscape(token))
+	conn, _, err := c.dialer.DialContext(ctx, u, nil)
+	return conn, err
+}
+
+// await reads events from conn until one matches or deadline passes.
+func await(conn *websocket.Conn, deadline time.Time, match func(ws.OutgoingMessage) bool) (ws.OutgoingMessage, error) {
+	_ = conn.SetReadDeadline(deadline)
+	for {
+		var m ws.OutgoingMessage
+		if err := conn.ReadJSON(&m); err != nil {
+			return ws.OutgoingMessage{}, err
+		}
+		if match(m) {
+			return m, nil
+		}
+	}
+}
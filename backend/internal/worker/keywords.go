@@ -0,0 +1,68 @@
+package worker
+
+import (
+	"context"
+	"strings"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/wordmask"
+
+	"github.com/google/uuid"
+)
+
+// roomKeywords is one room's watched keywords compiled into a single
+// matcher, with who watches each.
+type roomKeywords struct {
+	matcher  *wordmask.Matcher
+	watchers map[string][]uuid.UUID
+}
+
+// matchKeywords records which messages in [fromID, toID] match keywords
+// their rooms' members watch. Each room's keywords are compiled once per
+// batch, so a message costs one pass however many members watch words.
+func (w *Worker) matchKeywords(ctx context.Context, fromID, toID int64, roomIDs []uuid.UUID) error {
+	watches, err := w.store.ListRoomKeywords(ctx, roomIDs)
+	if err != nil || len(watches) == 0 {
+		return err
+	}
+	rooms := make(map[uuid.UUID]*roomKeywords)
+	words := make(map[uuid.UUID][]string)
+	for _, kw := range watches {
+		rk := rooms[kw.RoomID]
+		if rk == nil {
+			rk = &roomKeywords{watchers: map[string][]uuid.UUID{}}
+			rooms[kw.RoomID] = rk
+		}
+		key := strings.ToLower(kw.Keyword)
+		if len(rk.watchers[key]) == 0 {
+			words[kw.RoomID] = append(words[kw.RoomID], key)
+		}
+		rk.watchers[key] = append(rk.watchers[key], kw.UserID)
+	}
+	for roomID, rk := range rooms {
+		rk.matcher = wordmask.New(words[roomID])
+	}
+
+	messages, err := w.store.ListMessageTexts(ctx, fromID, toID)
+	if err != nil {
+		return err
+	}
+	var matches []db.KeywordMatch
+	for _, m := range messages {
+		rk := rooms[m.RoomID]
+		if rk == nil {
+			continue
+		}
+		notified := map[uuid.UUID]bool{m.UserID: true}
+		for _, word := range rk.matcher.Find(m.Content) {
+			for _, userID := range rk.watchers[word] {
+				if notified[userID] {
+					continue
+				}
+				notified[userID] = true
+				matches = append(matches, db.KeywordMatch{MessageID: m.ID, RoomID: m.RoomID, UserID: userID, Keyword: word})
+			}
+		}
+	}
+	return w.store.RecordKeywordMatches(ctx, matches)
+}
@@ -0,0 +1,90 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"talkie/backend/internal/jobs"
+	"talkie/backend/internal/scheduler"
+	"talkie/backend/internal/storage"
+)
+
+// UploadGCJob is the lock upload collection runs under, shared by the
+// scheduled task and talkiectl storage-gc so they never overlap.
+const UploadGCJob = "upload-gc"
+
+type MaintenanceStore interface {
+	DeleteExpiredLinks(ctx context.Context) (int64, error)
+	ClearExpiredTokens(ctx context.Context) (int64, error)
+	PurgeSoftDeleted(ctx context.Context, retention time.Duration) (int64, error)
+	RefreshRollups(ctx context.Context) (int64, error)
+	RefreshRoomActivity(ctx context.Context) (int64, error)
+	DeleteExpiredGuests(ctx context.Context) (int64, error)
+	PurgeExpiredHistory(ctx context.Context, defaultDays int) (int64, error)
+	DeleteOldSMSSends(ctx context.Context) (int64, error)
+	DeleteExpiredSSOLogins(ctx context.Context) (int64, error)
+	DeleteExpiredSyncSnapshots(ctx context.Context) (int64, error)
+	UploadStore
+	jobs.Locker
+}
+
+type MaintenanceConfig struct {
+	Interval       time.Duration
+	RollupInterval time.Duration
+	GuestInterval  time.Duration
+	// Retention is how long cancelled email changes and read notifications
+	// are kept.
+	Retention time.Duration
+	// HistoryDays is how long messages are kept in rooms whose plan does
+	// not say; 0 keeps them forever.
+	HistoryDays int
+
+	Uploads          []storage.Location
+	UploadGCInterval time.Duration
+
+	// Archive, when set, moves old messages to object storage every
+	// Interval.
+	Archive func(ctx context.Context) (int64, error)
+}
+
+// MaintenanceTasks are the periodic database clean-ups. Tasks with a zero
+// interval are left out.
+func MaintenanceTasks(store MaintenanceStore, cfg MaintenanceConfig) []scheduler.Task {
+	tasks := []scheduler.Task{
+		{Name: "expired_links", Interval: cfg.Interval, Run: store.DeleteExpiredLinks},
+		{Name: "expired_tokens", Interval: cfg.Interval, Run: store.ClearExpiredTokens},
+		{Name: "soft_deleted", Interval: cfg.Interval, Run: func(ctx context.Context) (int64, error) {
+			return store.PurgeSoftDeleted(ctx, cfg.Retention)
+		}},
+		{Name: "history_retention", Interval: cfg.Interval, Run: func(ctx context.Context) (int64, error) {
+			return store.PurgeExpiredHistory(ctx, cfg.HistoryDays)
+		}},
+		{Name: "sms_sends", Interval: cfg.Interval, Run: store.DeleteOldSMSSends},
+		{Name: "sso_logins", Interval: cfg.Interval, Run: store.DeleteExpiredSSOLogins},
+		{Name: "sync_snapshots", Interval: cfg.Interval, Run: store.DeleteExpiredSyncSnapshots},
+		{Name: "rollups", Interval: cfg.RollupInterval, Run: store.RefreshRollups},
+		{Name: "room_activity", Interval: cfg.RollupInterval, Run: store.RefreshRoomActivity},
+		// Expired guests are already locked out by the session check, so
+		// this interval only bounds how long their rows linger.
+		{Name: "expired_guests", Interval: cfg.GuestInterval, Run: store.DeleteExpiredGuests},
+		{Name: "upload_gc", Interval: cfg.UploadGCInterval, Run: func(ctx context.Context) (int64, error) {
+			var removed int
+			_, err := jobs.Once(ctx, store, UploadGCJob, func(ctx context.Context) error {
+				var err error
+				removed, _, err = CollectUploads(ctx, store, cfg.Uploads, time.Hour, false, nil)
+				return err
+			})
+			return int64(removed), err
+		}},
+	}
+	if cfg.Archive != nil {
+		tasks = append(tasks, scheduler.Task{Name: "message_archive", Interval: cfg.Interval, Run: cfg.Archive})
+	}
+	enabled := tasks[:0]
+	for _, t := range tasks {
+		if t.Interval > 0 {
+			enabled = append(enabled, t)
+		}
+	}
+	return enabled
+}
@@ -0,0 +1,314 @@
+package worker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+type UploadStore interface {
+	ListReferencedUploads(ctx context.Context) (map[string]struct{}, error)
+}
+
+// CollectUploads deletes files in locs that no message or avatar
+// references. Files younger than grace are kept so in-flight uploads
+// survive. With dryRun nothing is deleted. visit, when set, is called for
+// every file collected.
+func CollectUploads(ctx context.Context, store UploadStore, locs []storage.Location, grace time.Duration, dryRun bool, visit func(path string, size int64)) (int, int64, error) {
+	referenced, err := store.ListReferencedUploads(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	roots := make(map[string]bool, len(locs))
+	for _, loc := range locs {
+		roots[filepath.Clean(loc.Dir)] = true
+	}
+	cutoff := time.Now().Add(-grace)
+	var removed int
+	var freed int64
+	for _, loc := range locs {
+		n, size, err := collectLocation(ctx, loc, roots, referenced, cutoff, dryRun, visit)
+		removed += n
+		freed += size
+		if err != nil {
+			return removed, freed, err
+		}
+	}
+	return removed, freed, nil
+}
+
+func collectLocation(ctx context.Context, loc storage.Location, roots map[string]bool, referenced map[string]struct{}, cutoff time.Time, dryRun bool, visit func(path string, size int64)) (int, int64, error) {
+	dir := filepath.Clean(loc.Dir)
+	var removed int
+	var freed int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if d.IsDir() {
+			// Another location nested inside this one is collected on its
+			// own, against its own URLs.
+			if path != dir && roots[path] {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if _, ok := referenced[loc.URL(filepath.ToSlash(rel))]; ok {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(cutoff) {
+			return nil
+		}
+		if !dryRun {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+		if visit != nil {
+			visit(path, info.Size())
+		}
+		removed++
+		freed += info.Size()
+		return nil
+	})
+	return removed, freed, err
+}
+
+// RemoveRoomUploads deletes a purged room's files: those under its legacy
+// per-room directory in each of locs and the content-addressed files in
+// urls, its messages' media gathered before the room was deleted. Files
+// still referenced elsewhere, because another room uploaded the same
+// content, are kept and counted in the result.
+func RemoveRoomUploads(ctx context.Context, store UploadStore, locs []storage.Location, roomDir string, urls []string) (int, error) {
+	referenced, err := store.ListReferencedUploads(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var kept int
+	for _, url := range urls {
+		if _, ok := referenced[url]; ok {
+			kept++
+			continue
+		}
+		loc, rel, ok := locate(locs, url)
+		if !ok || !strings.HasPrefix(rel, storage.BlobDir+"/") {
+			continue
+		}
+		if err := os.Remove(loc.Path(filepath.FromSlash(rel))); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return kept, err
+		}
+	}
+	for _, loc := range locs {
+		dir := loc.Path(roomDir)
+		entries, err := os.ReadDir(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return kept, err
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				continue
+			}
+			if _, ok := referenced[loc.URL(roomDir+"/"+e.Name())]; ok {
+				kept++
+				continue
+			}
+			if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+				return kept, err
+			}
+		}
+		// Fails, harmlessly, while kept files remain.
+		_ = os.Remove(dir)
+	}
+	return kept, nil
+}
+
+// locate finds the location a URL is served from, preferring the longest
+// prefix since region locations sit under /uploads/regions/.
+func locate(locs []storage.Location, url string) (storage.Location, string, bool) {
+	var best storage.Location
+	found := false
+	for _, loc := range locs {
+		if strings.HasPrefix(url, loc.URLPrefix+"/") && (!found || len(loc.URLPrefix) > len(best.URLPrefix)) {
+			best, found = loc, true
+		}
+	}
+	if !found {
+		return storage.Location{}, "", false
+	}
+	return best, strings.TrimPrefix(url, best.URLPrefix+"/"), true
+}
+
+type MigrateStore interface {
+	MoveUpload(ctx context.Context, b db.UploadBlob, oldURL string) (int64, error)
+	RecountUploadBlobs(ctx context.Context) error
+}
+
+// MigrateUploads moves files from the per-room directories uploads used to
+// be stored in to their content-addressed paths, rewriting the messages
+// that use them. Each file is placed at its new path before the database
+// changes and removed from the old one after, so media keeps resolving if
+// the run is interrupted; rerunning picks up where it stopped. Run it while
+// upload GC is held off, or GC may see the new path before it is
+// referenced. With dryRun nothing changes. It returns files moved and
+// messages rewritten.
+func MigrateUploads(ctx context.Context, store MigrateStore, locs []storage.Location, dryRun bool, visit func(from, to string)) (int, int64, error) {
+	roots := make(map[string]bool, len(locs))
+	for _, loc := range locs {
+		roots[filepath.Clean(loc.Dir)] = true
+	}
+	var files int
+	var messages int64
+	for _, loc := range locs {
+		rooms, err := os.ReadDir(loc.Dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return files, messages, err
+		}
+		for _, room := range rooms {
+			// Room directories are named by room id; avatars, blobs and
+			// nested region locations are not.
+			if !room.IsDir() || roots[filepath.Join(filepath.Clean(loc.Dir), room.Name())] {
+				continue
+			}
+			if _, err := uuid.Parse(room.Name()); err != nil {
+				continue
+			}
+			n, moved, err := migrateRoomDir(ctx, store, loc, room.Name(), dryRun, visit)
+			files += n
+			messages += moved
+			if err != nil {
+				return files, messages, err
+			}
+		}
+	}
+	if dryRun || files == 0 {
+		return files, messages, nil
+	}
+	return files, messages, store.RecountUploadBlobs(ctx)
+}
+
+func migrateRoomDir(ctx context.Context, store MigrateStore, loc storage.Location, roomDir string, dryRun bool, visit func(from, to string)) (int, int64, error) {
+	dir := loc.Path(roomDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	var files int
+	var messages int64
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return files, messages, err
+		}
+		oldPath := filepath.Join(dir, e.Name())
+		sum, size, err := hashFile(oldPath)
+		if err != nil {
+			return files, messages, err
+		}
+		rel := storage.ContentPath(sum, strings.ToLower(filepath.Ext(e.Name())))
+		newPath := loc.Path(filepath.FromSlash(rel))
+		if visit != nil {
+			visit(oldPath, newPath)
+		}
+		files++
+		if dryRun {
+			continue
+		}
+		if err := placeFile(oldPath, newPath); err != nil {
+			return files, messages, err
+		}
+		n, err := store.MoveUpload(ctx, db.UploadBlob{Location: loc.URLPrefix, SHA256: sum, URL: loc.URL(rel), Size: size}, loc.URL(roomDir+"/"+e.Name()))
+		if err != nil {
+			return files, messages, err
+		}
+		messages += n
+		if err := os.Remove(oldPath); err != nil {
+			return files, messages, err
+		}
+	}
+	if !dryRun {
+		// Fails, harmlessly, if anything but moved files was left.
+		_ = os.Remove(dir)
+	}
+	return files, messages, nil
+}
+
+func hashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// placeFile makes newPath hold the contents of oldPath, leaving oldPath in
+// place. A file already at newPath has the same content by construction.
+func placeFile(oldPath, newPath string) error {
+	if _, err := os.Stat(newPath); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(newPath), 0o755); err != nil {
+		return err
+	}
+	if err := os.Link(oldPath, newPath); err == nil {
+		return nil
+	}
+	src, err := os.Open(oldPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(newPath), ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), newPath)
+}
@@ -0,0 +1,152 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/metrics"
+)
+
+const (
+	// uptimeDownAfter is how many probes in a row must fail before a
+	// monitor is reported down, so one dropped connection is not an alert.
+	uptimeDownAfter = 2
+	uptimeTimeout   = 10 * time.Second
+	uptimeBatch     = 50
+	uptimeParallel  = 8
+)
+
+var uptimeChecks = metrics.NewCounter("talkie_uptime_checks_total", "Uptime monitor probes.")
+
+type UptimeStore interface {
+	ListDueUptimeMonitors(ctx context.Context, limit int) ([]db.UptimeMonitor, error)
+	RecordUptimeCheck(ctx context.Context, id int64, c db.UptimeCheck) error
+}
+
+// UptimeAlerts is told when a monitor goes down or comes back; the HTTP
+// server implements it by posting to the monitor's room and notifying its
+// admins.
+type UptimeAlerts interface {
+	UptimeChanged(ctx context.Context, m db.UptimeMonitor, previous string)
+}
+
+// Uptime probes due monitors and records their state.
+type Uptime struct {
+	store    UptimeStore
+	alerts   UptimeAlerts
+	client   *http.Client
+	interval time.Duration
+}
+
+func NewUptime(store UptimeStore, alerts UptimeAlerts, interval time.Duration) *Uptime {
+	return &Uptime{
+		store:  store,
+		alerts: alerts,
+		client: &http.Client{
+			Timeout: uptimeTimeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				// A redirect is an answer; following it would probe
+				// somewhere else.
+				return http.ErrUseLastResponse
+			},
+		},
+		interval: interval,
+	}
+}
+
+// Run probes monitors as they fall due until ctx is cancelled.
+func (u *Uptime) Run(ctx context.Context) {
+	ticker := time.NewTicker(u.interval)
+	defer ticker.Stop()
+	for {
+		if err := u.Step(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("uptime checks failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Step probes the monitors that are due, a few at a time.
+func (u *Uptime) Step(ctx context.Context) error {
+	due, err := u.store.ListDueUptimeMonitors(ctx, uptimeBatch)
+	if err != nil || len(due) == 0 {
+		return err
+	}
+	sem := make(chan struct{}, uptimeParallel)
+	var wg sync.WaitGroup
+	for _, m := range due {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			u.check(ctx, m)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+func (u *Uptime) check(ctx context.Context, m db.UptimeMonitor) {
+	start := time.Now()
+	probeErr := u.probe(ctx, m)
+	uptimeChecks.Inc()
+	c := db.UptimeCheck{State: m.State, Failures: 0, LatencyMS: int(time.Since(start).Milliseconds())}
+	if probeErr == nil {
+		c.State = db.UptimeUp
+	} else {
+		c.Failures = m.Failures + 1
+		c.Error = probeErr.Error()
+		if c.Failures >= uptimeDownAfter {
+			c.State = db.UptimeDown
+		}
+	}
+	c.Changed = c.State != m.State
+	if err := u.store.RecordUptimeCheck(ctx, m.ID, c); err != nil {
+		if ctx.Err() == nil {
+			log.Printf("record uptime check of monitor %d: %v", m.ID, err)
+		}
+		return
+	}
+	// The first check of a new monitor only says where it starts.
+	if !c.Changed || (m.State == db.UptimeUnknown && c.State == db.UptimeUp) {
+		return
+	}
+	previous := m.State
+	m.State, m.Failures, m.LastError = c.State, c.Failures, c.Error
+	u.alerts.UptimeChanged(ctx, m, previous)
+}
+
+func (u *Uptime) probe(ctx context.Context, m db.UptimeMonitor) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.URL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "Talkie-Uptime/1")
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if m.ExpectStatus != 0 {
+		if resp.StatusCode != m.ExpectStatus {
+			return fmt.Errorf("status %d, want %d", resp.StatusCode, m.ExpectStatus)
+		}
+		return nil
+	}
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
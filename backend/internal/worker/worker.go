@@ -0,0 +1,117 @@
+// Package worker maintains data derived from messages — the full-text search
+// vector, @mentions and keyword matches, per-member unread counters, room
+// activity timestamps and room summaries — off the request path. It tails
+// the messages table by id, which doubles as an outbox: every consumer keeps
+// its own cursor in worker_cursors.
+//
+// Each step is idempotent, so a crash between steps, or two instances
+// processing the same batch, only repeats work.
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/metrics"
+
+	"github.com/google/uuid"
+)
+
+const cursorName = "messages"
+
+var (
+	processedMessages = metrics.NewCounter("talkie_worker_messages_processed_total", "Messages processed by the derived-data worker.")
+	workerErrors      = metrics.NewCounter("talkie_worker_errors_total", "Failed derived-data worker batches.")
+	workerCursor      = metrics.NewGauge("talkie_worker_cursor", "Last message id processed by the derived-data worker.")
+)
+
+type Store interface {
+	GetWorkerCursor(ctx context.Context, name string) (int64, error)
+	SetWorkerCursor(ctx context.Context, name string, position int64) error
+	NextMessageBatch(ctx context.Context, cursor int64, settle time.Duration, limit int) (db.MessageBatch, error)
+	IndexMessages(ctx context.Context, fromID, toID int64) error
+	RecordMentions(ctx context.Context, fromID, toID int64) error
+	ListRoomKeywords(ctx context.Context, roomIDs []uuid.UUID) ([]db.KeywordWatch, error)
+	ListMessageTexts(ctx context.Context, fromID, toID int64) ([]db.Message, error)
+	RecordKeywordMatches(ctx context.Context, matches []db.KeywordMatch) error
+	RefreshUnreadCounts(ctx context.Context, roomIDs []uuid.UUID) error
+	TouchRoomActivity(ctx context.Context, roomIDs []uuid.UUID) error
+	RefreshRoomSummaries(ctx context.Context, roomIDs []uuid.UUID) error
+}
+
+type Worker struct {
+	store     Store
+	interval  time.Duration
+	settle    time.Duration
+	batchSize int
+}
+
+func New(store Store, interval time.Duration) *Worker {
+	return &Worker{
+		store:     store,
+		interval:  interval,
+		settle:    2 * time.Second,
+		batchSize: 500,
+	}
+}
+
+// Run processes batches until ctx is cancelled. After a full batch it
+// continues immediately so a backlog drains quickly; otherwise it waits for
+// the next tick.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		n, err := w.Step(ctx)
+		if err != nil && ctx.Err() == nil {
+			workerErrors.Inc()
+			log.Printf("worker batch failed: %v", err)
+		}
+		if err == nil && n == w.batchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Step processes one batch and returns how many messages it covered.
+func (w *Worker) Step(ctx context.Context) (int, error) {
+	cursor, err := w.store.GetWorkerCursor(ctx, cursorName)
+	if err != nil {
+		return 0, err
+	}
+	batch, err := w.store.NextMessageBatch(ctx, cursor, w.settle, w.batchSize)
+	if err != nil || batch.Count == 0 {
+		return 0, err
+	}
+	if err := w.store.IndexMessages(ctx, batch.FromID, batch.ToID); err != nil {
+		return 0, err
+	}
+	if err := w.store.RecordMentions(ctx, batch.FromID, batch.ToID); err != nil {
+		return 0, err
+	}
+	if err := w.matchKeywords(ctx, batch.FromID, batch.ToID, batch.RoomIDs); err != nil {
+		return 0, err
+	}
+	if err := w.store.RefreshUnreadCounts(ctx, batch.RoomIDs); err != nil {
+		return 0, err
+	}
+	if err := w.store.TouchRoomActivity(ctx, batch.RoomIDs); err != nil {
+		return 0, err
+	}
+	if err := w.store.RefreshRoomSummaries(ctx, batch.RoomIDs); err != nil {
+		return 0, err
+	}
+	if err := w.store.SetWorkerCursor(ctx, cursorName, batch.ToID); err != nil {
+		return 0, err
+	}
+	processedMessages.Add(int64(batch.Count))
+	workerCursor.Set(float64(batch.ToID))
+	return batch.Count, nil
+}
@@ -0,0 +1,71 @@
+package ws
+
+import (
+	"talkie/backend/internal/metrics"
+
+	"github.com/gorilla/websocket"
+)
+
+// Sockets opened with ?batch=1 receive every frame as a JSON array of
+// events. When the send queue has a backlog the write pump drains up to
+// maxBatch queued events into one frame instead of writing them one by one,
+// which saves a frame and a syscall per event during bursts. Sockets that did
+// not opt in keep getting one event object per frame.
+
+const maxBatch = 32
+
+var batchedEvents = metrics.NewCounter("talkie_ws_batched_events_total", "Events written to a socket in the same frame as an earlier event.")
+
+// writeQueued writes first, and with batch set whatever else is already
+// queued on send, to conn, withholding NSFW media and unmasked content as
+// hideNSFW and originals say. It reports false when the pump should stop:
+// the write failed, send was closed or a closing event was written.
+func writeQueued(conn Conn, send <-chan OutgoingMessage, first OutgoingMessage, batch, hideNSFW, originals bool) bool {
+	events := []OutgoingMessage{first}
+	closed := false
+	if batch {
+	drain:
+		for len(events) < maxBatch && !closesSocket(events[len(events)-1].Type) {
+			select {
+			case msg, ok := <-send:
+				if !ok {
+					closed = true
+					break drain
+				}
+				events = append(events, msg)
+			default:
+				break drain
+			}
+		}
+	}
+	if hideNSFW {
+		for i := range events {
+			events[i] = events[i].WithoutNSFWMedia()
+		}
+	}
+	if !originals {
+		for i := range events {
+			events[i] = events[i].WithoutOriginalContent()
+		}
+	}
+
+	var err error
+	if batch {
+		err = conn.WriteJSON(events)
+		batchedEvents.Add(int64(len(events) - 1))
+	} else {
+		err = conn.WriteJSON(events[0])
+	}
+	if err != nil {
+		return false
+	}
+	if last := events[len(events)-1].Type; closesSocket(last) {
+		closeAfter(conn, last)
+		return false
+	}
+	if closed {
+		_ = conn.WriteMessage(websocket.CloseMessage, []byte{})
+		return false
+	}
+	return true
+}
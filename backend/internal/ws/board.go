@@ -0,0 +1,19 @@
+package ws
+
+import "talkie/backend/internal/db"
+
+// Saved board changes announced to the owner's events sockets.
+const (
+	BoardAdded     = "added"
+	BoardUpdated   = "updated"
+	BoardRemoved   = "removed"
+	BoardReordered = "reordered"
+)
+
+// BoardMessage tells a user's events sockets that their saved board
+// changed, so their other devices follow without refetching it. item is
+// set for additions and updates, itemID for removals; a reorder carries
+// neither and clients reload the board.
+func BoardMessage(change string, item *db.BoardItem, itemID int64) BoardEvent {
+	return BoardEvent{Change: change, BoardItem: item, BoardItemID: itemID}
+}
@@ -0,0 +1,115 @@
+package ws
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+// maxCallChatLines bounds the transcript kept per call. Lines past it are
+// still relayed but will not be persisted.
+const maxCallChatLines = 1000
+
+type callChatLine struct {
+	userID uuid.UUID
+	text   string
+	sentAt time.Time
+}
+
+// recordCallChat keeps a call chat line for persisting when the call ends.
+// It is a no-op once nobody on this instance is in the room's call.
+func (h *Hub) recordCallChat(roomID, userID uuid.UUID, text string, sentAt time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.callUsers[roomID]) == 0 || len(h.callChats[roomID]) >= maxCallChatLines {
+		return
+	}
+	h.callChats[roomID] = append(h.callChats[roomID], callChatLine{userID: userID, text: text, sentAt: sentAt})
+}
+
+// takeCallChat returns and forgets roomID's transcript once its call has
+// ended on this instance. While anyone is still in the call it returns nil.
+func (h *Hub) takeCallChat(roomID uuid.UUID) []callChatLine {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.callUsers[roomID]) > 0 {
+		return nil
+	}
+	lines := h.callChats[roomID]
+	delete(h.callChats, roomID)
+	return lines
+}
+
+// CallChatMessage builds a "call_chat" event. It is only delivered to
+// sockets that have joined the room's call.
+func CallChatMessage(roomID uuid.UUID, c *Client, content string, sentAt time.Time) CallChatEvent {
+	return CallChatEvent{
+		Message: MessagePayload{
+			RoomID:      roomID.String(),
+			UserID:      c.UserID.String(),
+			Username:    c.Username,
+			AvatarURL:   c.AvatarURL,
+			Content:     content,
+			MessageType: "text",
+			Ephemeral:   true,
+			CreatedAt:   sentAt,
+		},
+	}
+}
+
+func (c *Client) sendCallChat(content string) {
+	if !c.InCall || content == "" {
+		return
+	}
+	if !c.acceptLength(content) {
+		return
+	}
+	verdict := c.Automod.Check(c.ctx, c.RoomID, c.UserID, content)
+	if verdict.Notice != "" {
+		c.Hub.SendEphemeral(c.RoomID, c.UserID, verdict.Notice)
+	}
+	if verdict.Blocked() {
+		return
+	}
+	now := c.Hub.now().UTC()
+	c.Hub.recordCallChat(c.RoomID, c.UserID, content, now)
+	c.Hub.Broadcast(c.RoomID, CallChatMessage(c.RoomID, c, content, now))
+}
+
+// endCallChat writes the transcript of a call that just ended into the
+// room's history when the room opted in, and drops it otherwise.
+func (c *Client) endCallChat(ctx context.Context) {
+	lines := c.Hub.takeCallChat(c.RoomID)
+	if len(lines) == 0 {
+		return
+	}
+	persist, err := c.Store.GetRoomPersistCallChat(ctx, c.RoomID)
+	if err != nil {
+		log.Printf("load call chat setting for room %s: %v", c.RoomID, err)
+		return
+	}
+	if !persist {
+		return
+	}
+	batch := make([]db.NewMessage, 0, len(lines))
+	for _, l := range lines {
+		sentAt := l.sentAt
+		batch = append(batch, db.NewMessage{UserID: l.userID, Content: l.text, MessageType: "text", ClientSentAt: &sentAt})
+	}
+	saved, err := c.Store.SaveMessagesBatch(ctx, c.RoomID, batch)
+	if err != nil {
+		log.Printf("persist call chat for room %s: %v", c.RoomID, err)
+		return
+	}
+	for _, msg := range saved {
+		c.History.Append(msg)
+		if msg.Shadowed {
+			continue
+		}
+		c.Hub.Broadcast(c.RoomID, ChatEvent{Message: PayloadFromMessage(msg)})
+	}
+}
@@ -0,0 +1,41 @@
+package ws
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// minFeedbackCall is how long a member must have been in a call before
+// leaving it prompts them to rate it; accidental joins are not worth asking
+// about.
+const minFeedbackCall = 30 * time.Second
+
+// CallID identifies the current run of roomID's call on this instance, or
+// uuid.Nil when nobody is in it.
+func (h *Hub) CallID(roomID uuid.UUID) uuid.UUID {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.callIDs[roomID]
+}
+
+// CallFeedbackRequest asks a member who just left a call to rate it.
+func CallFeedbackRequest(roomID, callID uuid.UUID) CallFeedbackRequestEvent {
+	return CallFeedbackRequestEvent{RoomID: roomID.String(), CallID: callID.String()}
+}
+
+// promptCallFeedback asks c's user to rate the call they just left: on this
+// socket when they left the call but stayed in the room, on their events
+// socket when the room socket went away.
+func (c *Client) promptCallFeedback(socketOpen bool) {
+	if c.callID == uuid.Nil || c.Hub.now().Sub(c.callJoinedAt) < minFeedbackCall {
+		return
+	}
+	msg := CallFeedbackRequest(c.RoomID, c.callID)
+	c.callID = uuid.Nil
+	if socketOpen {
+		c.Hub.SendToRoomUser(c.RoomID, c.UserID, msg)
+		return
+	}
+	c.Hub.BroadcastUser(c.UserID, msg)
+}
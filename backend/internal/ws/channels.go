@@ -0,0 +1,97 @@
+package ws
+
+import (
+	"talkie/backend/internal/broadcast"
+
+	"github.com/google/uuid"
+)
+
+// Subscribers of broadcast rooms are not members, so room events do not
+// reach them and a per-subscriber loop over thousands of users would be
+// slow. Instead each instance keeps, for the users with an events socket
+// open on it, which broadcast rooms they follow; a post is published once
+// and every instance hands it to its own online subscribers.
+
+// watchChannelsLocked registers userID's events sockets for roomIDs.
+func (h *Hub) watchChannelsLocked(userID uuid.UUID, roomIDs []uuid.UUID) {
+	for _, roomID := range roomIDs {
+		h.addChannelLocked(userID, roomID)
+	}
+}
+
+func (h *Hub) addChannelLocked(userID, roomID uuid.UUID) {
+	if h.channels[roomID] == nil {
+		h.channels[roomID] = make(map[uuid.UUID]struct{})
+	}
+	h.channels[roomID][userID] = struct{}{}
+	if h.userChannels[userID] == nil {
+		h.userChannels[userID] = make(map[uuid.UUID]struct{})
+	}
+	h.userChannels[userID][roomID] = struct{}{}
+}
+
+func (h *Hub) removeChannelLocked(userID, roomID uuid.UUID) {
+	if subs := h.channels[roomID]; subs != nil {
+		delete(subs, userID)
+		if len(subs) == 0 {
+			delete(h.channels, roomID)
+		}
+	}
+	if rooms := h.userChannels[userID]; rooms != nil {
+		delete(rooms, roomID)
+		if len(rooms) == 0 {
+			delete(h.userChannels, userID)
+		}
+	}
+}
+
+// unwatchChannelsLocked forgets userID's subscriptions once their last
+// events socket on this instance closes.
+func (h *Hub) unwatchChannelsLocked(userID uuid.UUID) {
+	for roomID := range h.userChannels[userID] {
+		h.removeChannelLocked(userID, roomID)
+	}
+}
+
+// SetChannelSubscription updates userID's open events sockets after they
+// subscribe to or unsubscribe from roomID. Sockets on other instances pick
+// the change up when they reconnect.
+func (h *Hub) SetChannelSubscription(userID, roomID uuid.UUID, subscribed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.userEvents[userID]) == 0 {
+		return
+	}
+	if subscribed {
+		h.addChannelLocked(userID, roomID)
+	} else {
+		h.removeChannelLocked(userID, roomID)
+	}
+}
+
+// BroadcastChannel delivers event to the events sockets of everyone
+// subscribed to broadcast room roomID.
+func (h *Hub) BroadcastChannel(roomID uuid.UUID, event Event) {
+	payload := event.Envelope()
+	h.broadcastChannelLocal(roomID, payload)
+	h.publish(broadcast.KindChannel, roomID, uuid.Nil, payload)
+}
+
+func (h *Hub) broadcastChannelLocal(roomID uuid.UUID, payload OutgoingMessage) {
+	h.mu.RLock()
+	var targets []*NotificationClient
+	for userID := range h.channels[roomID] {
+		for c := range h.userEvents[userID] {
+			targets = append(targets, c)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, c := range targets {
+		select {
+		case c.Send <- payload:
+		default:
+			c.Close()
+		}
+	}
+}
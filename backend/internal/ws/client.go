@@ -3,30 +3,89 @@ package ws
 import (
 	"context"
 	"log"
+	"math"
+	"sync/atomic"
 	"time"
 
+	"talkie/backend/internal/archive"
+	"talkie/backend/internal/automod"
 	"talkie/backend/internal/db"
+	"talkie/backend/internal/history"
+	"talkie/backend/internal/notify"
+	"talkie/backend/internal/textnorm"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
 const (
+	DefaultHistoryPage = 50
+	maxHistoryPage     = 200
+	// maxTombstones bounds the deleted message IDs one history page
+	// carries; a retention purge can delete far more than a page.
+	maxTombstones = 500
+
 	writeWait  = 10 * time.Second
 	pongWait   = 60 * time.Second
 	pingPeriod = (pongWait * 9) / 10
 )
 
 type Client struct {
-	Conn     *websocket.Conn
+	Conn     Conn
 	Hub      *Hub
-	Store    *db.Store
+	Store    Store
+	Notifier *notify.Dispatcher
+	History  *history.Cache
+	// Archive serves history older than the messages table holds; nil
+	// when archiving is off.
+	Archive  *archive.Archiver
+	Automod  *automod.Moderator
 	RoomID   uuid.UUID
 	UserID   uuid.UUID
 	Username string
 	AvatarURL string
 	InCall   bool
+	IsDirect bool
+	// IsBroadcast sends posts to the room's subscribers as well.
+	IsBroadcast bool
+	// HideNSFW withholds flagged media from this connection.
+	HideNSFW bool
+	// SeesOriginals keeps unmasked content for room admins; everyone else
+	// gets masked words starred out.
+	SeesOriginals bool
+	// Batch writes frames as JSON arrays of events (?batch=1).
+	Batch bool
+	// P2PCalls relays WebRTC signaling between the two members of a
+	// direct room for calls that bypass the SFU.
+	P2PCalls bool
+	// MaxMessageLength caps chat text in characters; zero means no cap.
+	MaxMessageLength int
+	// RunCommand, when set, sees chat text before it is saved and reports
+	// whether it invoked a room slash command. The command answers on its
+	// own and the text is not posted.
+	RunCommand func(roomID, userID uuid.UUID, username, text string) bool
 	Send     chan OutgoingMessage
+
+	RemoteIP    string
+	ConnectedAt time.Time
+
+	// inCall mirrors InCall for the hub and is guarded by Hub.mu.
+	inCall bool
+	// callID and callJoinedAt describe the call this socket last joined.
+	callID       uuid.UUID
+	callJoinedAt time.Time
+	// p2pPeer is the other member of the direct room, once a signal
+	// looked it up.
+	p2pPeer uuid.UUID
+	// lastWrite is when the write pump last completed a write, in Unix
+	// nanoseconds, for the reaper.
+	lastWrite atomic.Int64
+
+	// ctx scopes the database work done on behalf of this connection and is
+	// cancelled once ReadPump returns, so queries still in flight for a
+	// client that went away are abandoned rather than waited on.
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 func (c *Client) Close() {
@@ -34,24 +93,27 @@ func (c *Client) Close() {
 }
 
 func (c *Client) ReadPump() {
+	defer c.Hub.recoverPump(c.Hub.startPump("room read pump"), c.UserID, c.RoomID)
+	c.ctx, c.cancel = context.WithCancel(context.Background())
 	defer func() {
 		c.Hub.Remove(c)
-		members, err := c.Store.ListRoomMembers(context.Background(), c.RoomID)
+		members, err := c.Store.ListRoomMembers(c.ctx, c.RoomID)
 		if err == nil {
-			participants := make([]Participant, 0, len(members))
-			for _, m := range members {
-				participants = append(participants, Participant{ID: m.ID.String(), Username: m.Username, AvatarURL: m.AvatarURL})
-			}
-			c.Hub.Broadcast(c.RoomID, OutgoingMessage{Type: "participants", Participants: participants})
+			c.Hub.Broadcast(c.RoomID, ParticipantsEvent{Participants: ParticipantsFromMembers(members)})
+		}
+		c.Hub.Broadcast(c.RoomID, CallParticipantsEvent{CallUsers: c.Hub.CallParticipants(c.RoomID)})
+		if c.InCall {
+			c.endCallChat(c.ctx)
+			c.promptCallFeedback(false)
 		}
-		c.Hub.Broadcast(c.RoomID, OutgoingMessage{Type: "call_participants", CallUsers: c.Hub.CallParticipants(c.RoomID)})
+		c.cancel()
 		_ = c.Conn.Close()
 	}()
 
-	c.Conn.SetReadLimit(4096)
-	_ = c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.Conn.SetReadLimit(readLimit(c.MaxMessageLength))
+	_ = c.Conn.SetReadDeadline(c.Hub.now().Add(pongWait))
 	c.Conn.SetPongHandler(func(string) error {
-		return c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+		return c.Conn.SetReadDeadline(c.Hub.now().Add(pongWait))
 	})
 
 	for {
@@ -59,62 +121,215 @@ func (c *Client) ReadPump() {
 		if err := c.Conn.ReadJSON(&incoming); err != nil {
 			break
 		}
+		incoming.Content = textnorm.Message(incoming.Content)
 		if incoming.Type != "chat" || incoming.Content == "" {
 			switch incoming.Type {
+			case "history_request":
+				c.sendHistory(incoming.Before, incoming.Limit)
+			case "read":
+				c.markRead(incoming.MessageID)
+			case "state_sync":
+				c.sendStateSync()
+			case "ping":
+				c.pong(incoming.ClientTime)
 			case "call_join":
 				if !c.InCall {
+					callStarted := len(c.Hub.CallParticipants(c.RoomID)) == 0
 					c.InCall = true
 					c.Hub.SetInCall(c, true)
-					c.Hub.Broadcast(c.RoomID, OutgoingMessage{Type: "call_participants", CallUsers: c.Hub.CallParticipants(c.RoomID)})
+					c.callID, c.callJoinedAt = c.Hub.CallID(c.RoomID), c.Hub.now()
+					c.Hub.Broadcast(c.RoomID, CallParticipantsEvent{CallUsers: c.Hub.CallParticipants(c.RoomID)})
+					if callStarted {
+						c.notifyCallStarted()
+					}
 				}
+			case "call_chat":
+				c.sendCallChat(incoming.Content)
+			case "speaking":
+				c.reportSpeaking(incoming.Speaking)
+			case "p2p_signal":
+				c.relaySignal(incoming)
 			case "call_leave":
 				if c.InCall {
 					c.InCall = false
 					c.Hub.SetInCall(c, false)
-					c.Hub.Broadcast(c.RoomID, OutgoingMessage{Type: "call_participants", CallUsers: c.Hub.CallParticipants(c.RoomID)})
+					c.Hub.Broadcast(c.RoomID, CallParticipantsEvent{CallUsers: c.Hub.CallParticipants(c.RoomID)})
+					c.endCallChat(c.ctx)
+					c.promptCallFeedback(true)
 				}
 			}
 			continue
 		}
 
-		msg, err := c.Store.SaveMessage(context.Background(), c.RoomID, c.UserID, incoming.Content)
+		if !c.acceptLength(incoming.Content) {
+			continue
+		}
+		verdict := c.Automod.Check(c.ctx, c.RoomID, c.UserID, incoming.Content)
+		if verdict.Notice != "" {
+			c.Hub.SendEphemeral(c.RoomID, c.UserID, verdict.Notice)
+		}
+		if verdict.Blocked() {
+			continue
+		}
+		if c.RunCommand != nil && c.RunCommand(c.RoomID, c.UserID, c.Username, incoming.Content) {
+			continue
+		}
+
+		msg, err := c.Store.SaveMessage(c.ctx, c.RoomID, c.UserID, incoming.Content, db.CheckClientSentAt(incoming.ClientSentAt, c.Hub.now()))
 		if err != nil {
 			log.Printf("save message failed: %v", err)
+			c.Hub.SendEphemeral(c.RoomID, c.UserID, "Message could not be sent, please try again.")
+			continue
+		}
+		c.History.Append(msg)
+		msg.ContentMasked = c.Automod.MaskText(c.ctx, c.RoomID, msg.Content)
+		if c.IsDirect {
+			msg.DeliveryState = "sent"
+		}
+		if msg.Shadowed {
+			// Shadow-banned authors see their message go through as usual;
+			// nobody else is told about it.
+			c.Hub.SendToRoomUser(c.RoomID, c.UserID, ChatEvent{Message: PayloadFromMessage(msg)})
 			continue
 		}
 
-		c.Hub.Broadcast(c.RoomID, OutgoingMessage{
-			Type:    "chat",
-			Message: ptrPayload(PayloadFromMessage(msg)),
-		})
+		c.Hub.Broadcast(c.RoomID, ChatEvent{Message: PayloadFromMessage(msg)})
 		c.notifyRoomMessage(msg)
+		if c.IsDirect {
+			c.Hub.DeliverDirect(c.ctx, c.Store, msg)
+		}
 	}
 }
 
-func ptrPayload(p MessagePayload) *MessagePayload {
-	return &p
+// sendStateSync answers a client that detected a gap in sequence numbers
+// with a fresh snapshot of the room.
+func (c *Client) sendStateSync() {
+	members, err := c.Store.ListRoomMembers(c.ctx, c.RoomID)
+	if err != nil {
+		log.Printf("load room members failed: %v", err)
+		return
+	}
+	c.Hub.SendStateSync(c, ParticipantsFromMembers(members))
+}
+
+// sendHistory answers a history_request with the page of messages older than
+// before (or the newest page when before is zero). has_more tells the client
+// whether another request with before set to the first ID would return more.
+func (c *Client) sendHistory(before int64, limit int) {
+	if limit <= 0 {
+		limit = DefaultHistoryPage
+	}
+	if limit > maxHistoryPage {
+		limit = maxHistoryPage
+	}
+	var (
+		messages []db.Message
+		err      error
+	)
+	if before <= 0 {
+		messages, err = c.History.Recent(c.ctx, c.Store, c.RoomID, limit)
+		before = math.MaxInt64
+	} else {
+		messages, err = c.Store.ListMessagesBefore(c.ctx, c.RoomID, before, limit)
+	}
+	if err == nil {
+		messages, err = c.Archive.Before(c.ctx, c.RoomID, before, limit, messages)
+	}
+	if err != nil {
+		log.Printf("load history failed: %v", err)
+		c.Hub.SendEphemeral(c.RoomID, c.UserID, "History could not be loaded, please try again.")
+		return
+	}
+	if c.IsDirect && len(messages) > 0 {
+		c.Hub.MarkDelivered(c.ctx, c.Store, c.RoomID, c.UserID, messages[len(messages)-1].ID)
+		if pointers, err := c.Store.ListDeliveryPointers(c.ctx, c.RoomID); err == nil {
+			db.ApplyDeliveryStates(messages, pointers)
+		}
+	}
+	c.Automod.Mask(c.ctx, c.RoomID, messages)
+	hasMore := len(messages) == limit
+	deleted := DeletedInPage(c.ctx, c.Store, c.RoomID, messages, before, hasMore)
+	select {
+	case c.Send <- HistoryMessage(db.VisibleTo(messages, c.UserID), deleted, hasMore).Envelope():
+	default:
+		c.Close()
+	}
+}
+
+// DeletedInPage returns the tombstones for a page of history that ends
+// below before: the IDs of messages deleted between its first message, or
+// the start of the room on the last page, and before.
+func DeletedInPage(ctx context.Context, store Store, roomID uuid.UUID, messages []db.Message, before int64, hasMore bool) []int64 {
+	var from int64
+	if hasMore && len(messages) > 0 {
+		from = messages[0].ID
+	}
+	ids, err := store.ListDeletedMessageIDs(ctx, roomID, from, before, maxTombstones)
+	if err != nil {
+		log.Printf("load deleted messages failed: %v", err)
+		return nil
+	}
+	return ids
+}
+
+// pong answers a "ping" frame. Behind a full send buffer the answer is
+// dropped, since a late one would misreport the round trip anyway.
+func (c *Client) pong(clientTime int64) {
+	select {
+	case c.Send <- PongEvent{ClientTime: clientTime, ServerTime: c.Hub.now().UnixMilli()}.Envelope():
+	default:
+	}
+}
+
+func (c *Client) markRead(messageID int64) {
+	if messageID <= 0 {
+		return
+	}
+	lastRead, err := c.Store.MarkRoomRead(c.ctx, c.RoomID, c.UserID, messageID)
+	if err != nil {
+		log.Printf("mark room read failed: %v", err)
+		return
+	}
+	c.Hub.PublishReadState(c.ctx, c.Store, c.RoomID, c.UserID, lastRead)
+	if c.IsDirect {
+		c.Hub.PublishDelivery(c.ctx, c.Store, c.RoomID)
+	}
 }
 
 func (c *Client) notifyRoomMessage(msg db.Message) {
-	members, err := c.Store.ListRoomMembers(context.Background(), c.RoomID)
+	members, err := c.Store.ListRoomMembers(c.ctx, c.RoomID)
 	if err != nil {
 		log.Printf("list members for room event failed: %v", err)
 		return
 	}
-	payload := ptrPayload(PayloadFromMessage(msg))
+	event := RoomMessageEvent{Message: PayloadFromMessage(msg)}
 	for _, m := range members {
 		if m.ID == c.UserID {
 			continue
 		}
-		c.Hub.BroadcastUser(m.ID, OutgoingMessage{
-			Type:    "room_message_event",
-			Message: payload,
-		})
+		c.Hub.BroadcastUser(m.ID, event)
+	}
+	if c.IsBroadcast {
+		c.Hub.BroadcastChannel(c.RoomID, event)
+	}
+	c.Notifier.NotifyMessage(msg.Masked(), members, RoomMentionScope(c.ctx, c.Store, msg))
+}
+
+func (c *Client) notifyCallStarted() {
+	if !c.Notifier.Enabled() && !(c.IsDirect && c.Notifier.SMSEnabled()) {
+		return
+	}
+	members, err := c.Store.ListRoomMembers(c.ctx, c.RoomID)
+	if err != nil {
+		log.Printf("list members for call push failed: %v", err)
+		return
 	}
+	c.Notifier.NotifyCall(c.RoomID, c.UserID, c.Username, members, c.IsDirect)
 }
 
 func (c *Client) WritePump() {
-	ticker := time.NewTicker(pingPeriod)
+	defer c.Hub.recoverPump(c.Hub.startPump("room write pump"), c.UserID, c.RoomID)
+	ticker := c.Hub.newTicker(pingPeriod)
 	defer func() {
 		ticker.Stop()
 		_ = c.Conn.Close()
@@ -123,19 +338,21 @@ func (c *Client) WritePump() {
 	for {
 		select {
 		case msg, ok := <-c.Send:
-			_ = c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			_ = c.Conn.SetWriteDeadline(c.Hub.now().Add(writeWait))
 			if !ok {
 				_ = c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
-			if err := c.Conn.WriteJSON(msg); err != nil {
+			if !writeQueued(c.Conn, c.Send, msg, c.Batch, c.HideNSFW, c.SeesOriginals) {
 				return
 			}
-		case <-ticker.C:
-			_ = c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.wrote()
+		case <-ticker.Chan():
+			_ = c.Conn.SetWriteDeadline(c.Hub.now().Add(writeWait))
 			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
+			c.wrote()
 		}
 	}
 }
@@ -0,0 +1,39 @@
+package ws
+
+import "time"
+
+// Clock is the time source for ping and read deadlines, the reaper, call
+// durations and timestamps the hub puts on events. Tests swap in
+// wstest.Clock to move time forward by hand. Fan-out latency metrics keep
+// using the wall clock.
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker is a time.Ticker behind an interface.
+type Ticker interface {
+	Chan() <-chan time.Time
+	Stop()
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) NewTicker(d time.Duration) Ticker { return systemTicker{time.NewTicker(d)} }
+
+type systemTicker struct{ t *time.Ticker }
+
+func (t systemTicker) Chan() <-chan time.Time { return t.t.C }
+func (t systemTicker) Stop()                  { t.t.Stop() }
+
+// SetClock replaces the hub's clock. It is not guarded: call it before the
+// hub is used.
+func (h *Hub) SetClock(c Clock) {
+	h.clock = c
+}
+
+func (h *Hub) now() time.Time { return h.clock.Now() }
+
+func (h *Hub) newTicker(d time.Duration) Ticker { return h.clock.NewTicker(d) }
@@ -0,0 +1,62 @@
+package ws
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// Failures before the upgrade are answered with a JSON HTTP error. Once a
+// socket is open the server ends it with a close frame instead, so the
+// client can tell why it was disconnected and whether to reconnect.
+const (
+	// CloseMembershipRevoked ends a room socket whose user left the room.
+	CloseMembershipRevoked = 4003
+	// CloseRoomDeleted ends every socket of a deleted room.
+	CloseRoomDeleted = 4004
+)
+
+type closeFrame struct {
+	code   int
+	reason string
+}
+
+// closingEvents are delivered like any other event and then make the write
+// pump close the socket. Going through the send queue keeps them behind
+// events already queued and lets them reach sockets on other instances.
+var closingEvents = map[string]closeFrame{
+	"session_revoked":    {websocket.ClosePolicyViolation, "session revoked"},
+	"membership_revoked": {CloseMembershipRevoked, "no longer a member of this room"},
+	"room_deleted":       {CloseRoomDeleted, "room deleted"},
+}
+
+// RevokeMembership closes userID's sockets in roomID after they leave it.
+func (h *Hub) RevokeMembership(roomID, userID uuid.UUID) {
+	h.SendToRoomUser(roomID, userID, MembershipRevokedEvent{RoomID: roomID.String()})
+}
+
+// CloseRoom closes every socket in a room that has been deleted.
+func (h *Hub) CloseRoom(roomID uuid.UUID) {
+	h.Broadcast(roomID, RoomDeletedEvent{RoomID: roomID.String()})
+}
+
+// closesSocket reports whether an event of type eventType ends the socket.
+func closesSocket(eventType string) bool {
+	_, ok := closingEvents[eventType]
+	return ok
+}
+
+// closeAfter sends the close frame for a closing event.
+func closeAfter(conn Conn, eventType string) {
+	f := closingEvents[eventType]
+	CloseConn(conn, f.code, f.reason)
+}
+
+// CloseConn sends a close frame with code and reason and drops conn. It is
+// for sockets that fail after the upgrade, before they are handed to a
+// client.
+func CloseConn(conn Conn, code int, reason string) {
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(writeWait))
+	_ = conn.Close()
+}
@@ -0,0 +1,174 @@
+package ws_test
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"talkie/backend/internal/ws"
+	"talkie/backend/internal/ws/wstest"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// newHub returns a hub running on a fake clock.
+func newHub(t *testing.T) (*ws.Hub, *wstest.Clock) {
+	t.Helper()
+	clock := wstest.NewClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	hub := ws.NewHub()
+	hub.SetClock(clock)
+	return hub, clock
+}
+
+// newClient returns a room client on an in-memory connection that has not
+// been added to the hub.
+func newClient(clock *wstest.Clock, hub *ws.Hub, roomID, userID uuid.UUID) (*ws.Client, *wstest.Conn) {
+	conn := wstest.NewConn(clock)
+	return &ws.Client{
+		Conn:   conn,
+		Hub:    hub,
+		RoomID: roomID,
+		UserID: userID,
+		Send:   make(chan ws.OutgoingMessage, 16),
+	}, conn
+}
+
+// openSocket adds a client to hub and starts its write pump.
+func openSocket(t *testing.T, hub *ws.Hub, clock *wstest.Clock, roomID, userID uuid.UUID) *wstest.Conn {
+	t.Helper()
+	c, conn := newClient(clock, hub, roomID, userID)
+	hub.Add(c)
+	go c.WritePump()
+	t.Cleanup(func() {
+		hub.Remove(c)
+		_ = conn.Close()
+	})
+	return conn
+}
+
+// closeCode waits for conn to be closed and returns the code of the close
+// frame the server sent, or 0 when it sent none.
+func closeCode(t *testing.T, conn *wstest.Conn) int {
+	t.Helper()
+	if err := conn.WaitClosed(2 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range conn.Frames() {
+		if f.Type == websocket.CloseMessage && len(f.Data) >= 2 {
+			return int(binary.BigEndian.Uint16(f.Data))
+		}
+	}
+	return 0
+}
+
+func TestClosingEventsCloseWithCode(t *testing.T) {
+	tests := []struct {
+		name  string
+		close func(hub *ws.Hub, roomID, userID uuid.UUID)
+		want  int
+	}{
+		{"session revoked", func(hub *ws.Hub, _, userID uuid.UUID) { hub.RevokeSessions(userID, 0) }, websocket.ClosePolicyViolation},
+		{"membership revoked", func(hub *ws.Hub, roomID, userID uuid.UUID) { hub.RevokeMembership(roomID, userID) }, ws.CloseMembershipRevoked},
+		{"room deleted", func(hub *ws.Hub, roomID, _ uuid.UUID) { hub.CloseRoom(roomID) }, ws.CloseRoomDeleted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub, clock := newHub(t)
+			roomID, userID := uuid.New(), uuid.New()
+			conn := openSocket(t, hub, clock, roomID, userID)
+			tt.close(hub, roomID, userID)
+			if got := closeCode(t, conn); got != tt.want {
+				t.Fatalf("close code = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRevokeMembershipLeavesOtherSocketsOpen(t *testing.T) {
+	hub, clock := newHub(t)
+	roomID, leaving, staying := uuid.New(), uuid.New(), uuid.New()
+	gone := openSocket(t, hub, clock, roomID, leaving)
+	kept := openSocket(t, hub, clock, roomID, staying)
+	elsewhere := openSocket(t, hub, clock, uuid.New(), leaving)
+
+	hub.RevokeMembership(roomID, leaving)
+	if got := closeCode(t, gone); got != ws.CloseMembershipRevoked {
+		t.Fatalf("close code = %d, want %d", got, ws.CloseMembershipRevoked)
+	}
+	if kept.Closed() || elsewhere.Closed() {
+		t.Fatal("revoking one membership closed another socket")
+	}
+}
+
+func TestAdmitCloseOldestSendsReplaced(t *testing.T) {
+	hub, clock := newHub(t)
+	hub.SetConnLimits(ws.ConnLimits{PerUser: 1, CloseOldest: true})
+	roomID, userID := uuid.New(), uuid.New()
+
+	old, oldConn := newClient(clock, hub, roomID, userID)
+	if err := hub.Admit(old); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Second)
+	newer, newerConn := newClient(clock, hub, roomID, userID)
+	if err := hub.Admit(newer); err != nil {
+		t.Fatal(err)
+	}
+	if got := closeCode(t, oldConn); got != ws.CloseReplaced {
+		t.Fatalf("close code = %d, want %d", got, ws.CloseReplaced)
+	}
+	if newerConn.Closed() {
+		t.Fatal("the newer connection was closed")
+	}
+}
+
+func TestAdmitCloseOldestEvictsByIP(t *testing.T) {
+	hub, clock := newHub(t)
+	hub.SetConnLimits(ws.ConnLimits{PerIP: 2, CloseOldest: true})
+
+	admit := func(roomID uuid.UUID, ip string) (*ws.Client, *wstest.Conn) {
+		t.Helper()
+		clock.Advance(time.Second)
+		c, conn := newClient(clock, hub, roomID, uuid.New())
+		c.RemoteIP = ip
+		if err := hub.Admit(c); err != nil {
+			t.Fatal(err)
+		}
+		return c, conn
+	}
+	oldest, oldestConn := admit(uuid.New(), "203.0.113.7")
+	_, otherIPConn := admit(uuid.New(), "198.51.100.1")
+	_, middleConn := admit(uuid.New(), "203.0.113.7")
+	_, newestConn := admit(uuid.New(), "203.0.113.7")
+
+	if got := closeCode(t, oldestConn); got != ws.CloseReplaced {
+		t.Fatalf("close code = %d, want %d", got, ws.CloseReplaced)
+	}
+	if middleConn.Closed() || newestConn.Closed() || otherIPConn.Closed() {
+		t.Fatal("evicted more than the oldest connection from the address")
+	}
+
+	// Once the evicted socket's pumps remove it the address is back at the
+	// cap, and the other address still has room.
+	hub.Remove(oldest)
+	hub.SetConnLimits(ws.ConnLimits{PerIP: 2})
+	if err := hub.CheckConnLimits(uuid.New(), "203.0.113.7"); err != ws.ErrConnLimit {
+		t.Fatalf("check = %v, want ErrConnLimit at the cap", err)
+	}
+	if err := hub.CheckConnLimits(uuid.New(), "198.51.100.1"); err != nil {
+		t.Fatalf("check other address = %v", err)
+	}
+}
+
+func TestCloseConnSendsCodeAndReason(t *testing.T) {
+	_, clock := newHub(t)
+	conn := wstest.NewConn(clock)
+	ws.CloseConn(conn, websocket.CloseInternalServerErr, "failed to load user")
+	if got := closeCode(t, conn); got != websocket.CloseInternalServerErr {
+		t.Fatalf("close code = %d, want %d", got, websocket.CloseInternalServerErr)
+	}
+	if f := conn.Frames()[0]; string(f.Data[2:]) != "failed to load user" {
+		t.Fatalf("close reason = %q", f.Data[2:])
+	}
+}
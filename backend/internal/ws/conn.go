@@ -0,0 +1,24 @@
+package ws
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Conn is the part of *websocket.Conn that sockets use. Tests drive sockets
+// through wstest.Conn instead of a network connection.
+type Conn interface {
+	ReadJSON(v any) error
+	ReadMessage() (messageType int, p []byte, err error)
+	WriteJSON(v any) error
+	WriteMessage(messageType int, data []byte) error
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	SetReadLimit(limit int64)
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+	SetPongHandler(h func(appData string) error)
+	Close() error
+}
+
+var _ Conn = (*websocket.Conn)(nil)
@@ -0,0 +1,141 @@
+package ws
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// pumpCounts tracks the pump goroutines running, by pump. Pumps that
+// outnumber the sockets the hub lists are stuck after their socket left.
+type pumpCounts struct {
+	mu      sync.Mutex
+	running map[string]int
+}
+
+func (p *pumpCounts) add(pump string, n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.running == nil {
+		p.running = make(map[string]int)
+	}
+	p.running[pump] += n
+}
+
+func (p *pumpCounts) snapshot() map[string]int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make(map[string]int, len(p.running))
+	for k, v := range p.running {
+		out[k] = v
+	}
+	return out
+}
+
+// startPump counts a pump goroutine as running until its deferred
+// recoverPump; it returns pump for that call.
+func (h *Hub) startPump(pump string) string {
+	h.pumps.add(pump, 1)
+	return pump
+}
+
+// HubDump is a snapshot of the hub for diagnosing stuck sockets.
+type HubDump struct {
+	Pumps        map[string]int `json:"pumps"`
+	RoomSockets  int            `json:"room_sockets"`
+	EventSockets int            `json:"event_sockets"`
+	Users        int            `json:"users"`
+	FanoutQueues []int          `json:"fanout_queues"`
+	// Rooms lists the rooms with the most sockets first.
+	Rooms  []RoomDump        `json:"rooms"`
+	Events []EventSocketDump `json:"events,omitempty"`
+}
+
+type RoomDump struct {
+	RoomID  uuid.UUID    `json:"room_id"`
+	Seq     uint64       `json:"seq"`
+	InCall  int          `json:"in_call"`
+	Sockets []SocketDump `json:"sockets"`
+}
+
+type SocketDump struct {
+	UserID      uuid.UUID `json:"user_id"`
+	RemoteIP    string    `json:"remote_ip,omitempty"`
+	ConnectedAt time.Time `json:"connected_at"`
+	LastWrite   time.Time `json:"last_write"`
+	InCall      bool      `json:"in_call,omitempty"`
+	// SendQueue is the events waiting for the write pump, out of SendCap.
+	SendQueue int `json:"send_queue"`
+	SendCap   int `json:"send_cap"`
+}
+
+type EventSocketDump struct {
+	UserID    uuid.UUID `json:"user_id"`
+	LastWrite time.Time `json:"last_write"`
+	Channels  int       `json:"channels"`
+	SendQueue int       `json:"send_queue"`
+	SendCap   int       `json:"send_cap"`
+}
+
+// Dump snapshots the hub, listing up to maxRooms rooms. Event sockets are
+// listed only with events set, as every online user has one.
+func (h *Hub) Dump(maxRooms int, events bool) HubDump {
+	d := HubDump{Pumps: h.pumps.snapshot(), Rooms: []RoomDump{}}
+
+	h.seqMu.Lock()
+	for _, q := range h.fanout.queues {
+		d.FanoutQueues = append(d.FanoutQueues, len(q))
+	}
+	seqs := make(map[uuid.UUID]uint64, len(h.seqs))
+	for id, seq := range h.seqs {
+		seqs[id] = seq
+	}
+	h.seqMu.Unlock()
+
+	h.mu.RLock()
+	d.Users = len(h.users)
+	for roomID, clients := range h.rooms {
+		d.RoomSockets += len(clients)
+		room := RoomDump{RoomID: roomID, Seq: seqs[roomID]}
+		for c := range clients {
+			if c.inCall {
+				room.InCall++
+			}
+			room.Sockets = append(room.Sockets, SocketDump{
+				UserID:      c.UserID,
+				RemoteIP:    c.RemoteIP,
+				ConnectedAt: c.ConnectedAt,
+				LastWrite:   time.Unix(0, c.lastWrite.Load()),
+				InCall:      c.inCall,
+				SendQueue:   len(c.Send),
+				SendCap:     cap(c.Send),
+			})
+		}
+		d.Rooms = append(d.Rooms, room)
+	}
+	for _, clients := range h.userEvents {
+		d.EventSockets += len(clients)
+		if !events {
+			continue
+		}
+		for c := range clients {
+			d.Events = append(d.Events, EventSocketDump{
+				UserID:    c.UserID,
+				LastWrite: time.Unix(0, c.lastWrite.Load()),
+				Channels:  len(c.Channels),
+				SendQueue: len(c.Send),
+				SendCap:   cap(c.Send),
+			})
+		}
+	}
+	h.mu.RUnlock()
+
+	slices.SortFunc(d.Rooms, func(a, b RoomDump) int { return cmp.Compare(len(b.Sockets), len(a.Sockets)) })
+	if len(d.Rooms) > maxRooms {
+		d.Rooms = d.Rooms[:maxRooms]
+	}
+	return d
+}
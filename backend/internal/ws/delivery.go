@@ -0,0 +1,63 @@
+package ws
+
+import (
+	"context"
+	"log"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+// MarkDelivered advances userID's delivered pointer in a direct room and, if
+// it moved, tells both participants via "delivery_update".
+func (h *Hub) MarkDelivered(ctx context.Context, store Store, roomID, userID uuid.UUID, upTo int64) {
+	if upTo <= 0 {
+		return
+	}
+	advanced, err := store.MarkRoomDelivered(ctx, roomID, userID, upTo)
+	if err != nil {
+		log.Printf("mark delivered failed: %v", err)
+		return
+	}
+	if advanced {
+		h.PublishDelivery(ctx, store, roomID)
+	}
+}
+
+// PublishDelivery sends each member's delivered/read pointers to every
+// member of the room, on all of their connections.
+func (h *Hub) PublishDelivery(ctx context.Context, store Store, roomID uuid.UUID) {
+	pointers, err := store.ListDeliveryPointers(ctx, roomID)
+	if err != nil {
+		log.Printf("list delivery pointers failed: %v", err)
+		return
+	}
+	for _, p := range pointers {
+		update := DeliveryUpdateEvent{
+			RoomID:        roomID.String(),
+			UserID:        p.UserID.String(),
+			DeliveredUpTo: p.DeliveredUpTo,
+			ReadUpTo:      p.ReadUpTo,
+		}
+		for _, member := range pointers {
+			h.SendToUser(member.UserID, update)
+		}
+	}
+}
+
+// DeliverDirect marks a fresh DM as delivered to every recipient that is
+// connected right now.
+func (h *Hub) DeliverDirect(ctx context.Context, store Store, msg db.Message) {
+	pointers, err := store.ListDeliveryPointers(ctx, msg.RoomID)
+	if err != nil {
+		log.Printf("list delivery pointers failed: %v", err)
+		return
+	}
+	for _, p := range pointers {
+		if p.UserID == msg.UserID || !h.IsUserOnline(p.UserID) {
+			continue
+		}
+		h.MarkDelivered(ctx, store, msg.RoomID, p.UserID, msg.ID)
+	}
+}
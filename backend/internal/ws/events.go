@@ -0,0 +1,413 @@
+package ws
+
+import (
+	"encoding/json"
+
+	"talkie/backend/internal/db"
+)
+
+// Every event the server sends over a socket has its own type below, with
+// exactly the fields that event carries. The hub and sockets still move them
+// as OutgoingMessage, the one envelope all of them are encoded in, so the
+// wire format is unchanged; the typed events are what code builds and what
+// internal/events derives each event's JSON schema from. A field's json tag
+// here must match the envelope field it is copied to, omitempty included,
+// or the schema would not describe what is actually sent.
+
+// Event is a server-to-client socket event.
+type Event interface {
+	// EventType is the event's "type" on the wire.
+	EventType() string
+	// Envelope encodes the event as it is queued to a socket.
+	Envelope() OutgoingMessage
+}
+
+// ChatEvent is a new message in the room.
+type ChatEvent struct {
+	Message MessagePayload `json:"message"`
+}
+
+func (ChatEvent) EventType() string { return "chat" }
+
+func (e ChatEvent) Envelope() OutgoingMessage {
+	return OutgoingMessage{Type: e.EventType(), Message: &e.Message}
+}
+
+// CallChatEvent is a line of in-call chat, seen only by call members.
+type CallChatEvent struct {
+	Message MessagePayload `json:"message"`
+}
+
+func (CallChatEvent) EventType() string { return "call_chat" }
+
+func (e CallChatEvent) Envelope() OutgoingMessage {
+	return OutgoingMessage{Type: e.EventType(), Message: &e.Message}
+}
+
+// EphemeralEvent is a system notice shown to one member and never stored.
+type EphemeralEvent struct {
+	Message MessagePayload `json:"message"`
+}
+
+func (EphemeralEvent) EventType() string { return "ephemeral" }
+
+func (e EphemeralEvent) Envelope() OutgoingMessage {
+	return OutgoingMessage{Type: e.EventType(), Message: &e.Message}
+}
+
+// MessageUpdatedEvent replaces a message already shown, such as a command
+// reply an interaction rewrote.
+type MessageUpdatedEvent struct {
+	Message MessagePayload `json:"message"`
+}
+
+func (MessageUpdatedEvent) EventType() string { return "message_updated" }
+
+func (e MessageUpdatedEvent) Envelope() OutgoingMessage {
+	return OutgoingMessage{Type: e.EventType(), Message: &e.Message}
+}
+
+// RoomMessageEvent tells a member's events socket about a message in one of
+// their rooms, or a subscriber about a post in a broadcast room.
+type RoomMessageEvent struct {
+	Message MessagePayload `json:"message"`
+}
+
+func (RoomMessageEvent) EventType() string { return "room_message_event" }
+
+func (e RoomMessageEvent) Envelope() OutgoingMessage {
+	return OutgoingMessage{Type: e.EventType(), Message: &e.Message}
+}
+
+// HistoryEvent is a page of messages, oldest first. DeletedMessageIDs are
+// the messages deleted from the range the page covers, newest first, so
+// clients can drop copies they still hold.
+type HistoryEvent struct {
+	Messages          []MessagePayload `json:"messages,omitempty"`
+	DeletedMessageIDs []int64          `json:"deleted_message_ids,omitempty"`
+	HasMore           bool             `json:"has_more,omitempty"`
+}
+
+func (HistoryEvent) EventType() string { return "history" }
+
+func (e HistoryEvent) Envelope() OutgoingMessage {
+	return OutgoingMessage{Type: e.EventType(), Messages: e.Messages, DeletedMessageIDs: e.DeletedMessageIDs, HasMore: e.HasMore}
+}
+
+// ParticipantsEvent lists the room's members.
+type ParticipantsEvent struct {
+	Participants []Participant `json:"participants,omitempty"`
+}
+
+func (ParticipantsEvent) EventType() string { return "participants" }
+
+func (e ParticipantsEvent) Envelope() OutgoingMessage {
+	return OutgoingMessage{Type: e.EventType(), Participants: e.Participants}
+}
+
+// CallParticipantsEvent lists who is in the room's call.
+type CallParticipantsEvent struct {
+	CallUsers []Participant `json:"call_users,omitempty"`
+}
+
+func (CallParticipantsEvent) EventType() string { return "call_participants" }
+
+func (e CallParticipantsEvent) Envelope() OutgoingMessage {
+	return OutgoingMessage{Type: e.EventType(), CallUsers: e.CallUsers}
+}
+
+// StateSyncEvent is the snapshot a room socket starts from; see
+// SendStateSync.
+type StateSyncEvent struct {
+	Seq          uint64        `json:"seq,omitempty"`
+	RoomID       string        `json:"room_id"`
+	Participants []Participant `json:"participants,omitempty"`
+	CallUsers    []Participant `json:"call_users,omitempty"`
+}
+
+func (StateSyncEvent) EventType() string { return "state_sync" }
+
+func (e StateSyncEvent) Envelope() OutgoingMessage {
+	return OutgoingMessage{Type: e.EventType(), Seq: e.Seq, RoomID: e.RoomID, Participants: e.Participants, CallUsers: e.CallUsers}
+}
+
+// ResumeEvent follows state_sync on a socket opened with a bootstrap's sync
+// token: the room's messages created or edited since the bootstrap, as they
+// are now, oldest first. HasMore means there were too many to send and the
+// client should reload the room's history.
+type ResumeEvent struct {
+	RoomID   string           `json:"room_id"`
+	Messages []MessagePayload `json:"messages,omitempty"`
+	HasMore  bool             `json:"has_more,omitempty"`
+}
+
+func (ResumeEvent) EventType() string { return "resume" }
+
+func (e ResumeEvent) Envelope() OutgoingMessage {
+	return OutgoingMessage{Type: e.EventType(), RoomID: e.RoomID, Messages: e.Messages, HasMore: e.HasMore}
+}
+
+// PongEvent answers a "ping" frame on either socket: the frame's
+// client_time echoed back and the server clock when it was answered, both
+// in Unix milliseconds. The client gets the round trip from its own clock
+// and its skew from ServerTime against the midpoint of the round trip.
+type PongEvent struct {
+	ClientTime int64 `json:"client_time,omitempty"`
+	ServerTime int64 `json:"server_time"`
+}
+
+func (PongEvent) EventType() string { return "pong" }
+
+func (e PongEvent) Envelope() OutgoingMessage {
+	return OutgoingMessage{Type: e.EventType(), ClientTime: e.ClientTime, ServerTime: e.ServerTime}
+}
+
+// UnreadEvent is a member's read state for a room. MessageID is their last
+// read message.
+type UnreadEvent struct {
+	RoomID               string `json:"room_id"`
+	MessageID            int64  `json:"message_id,omitempty"`
+	UnreadCount          int    `json:"unread_count"`
+	FirstUnreadMessageID *int64 `json:"first_unread_message_id,omitempty"`
+}
+
+func (UnreadEvent) EventType() string { return "unread" }
+
+func (e UnreadEvent) Envelope() OutgoingMessage {
+	return OutgoingMessage{
+		Type:                 e.EventType(),
+		RoomID:               e.RoomID,
+		MessageID:            e.MessageID,
+		UnreadCount:          &e.UnreadCount,
+		FirstUnreadMessageID: e.FirstUnreadMessageID,
+	}
+}
+
+// DeliveryUpdateEvent is one member's delivered and read pointers in a
+// direct room.
+type DeliveryUpdateEvent struct {
+	RoomID        string `json:"room_id"`
+	UserID        string `json:"user_id"`
+	DeliveredUpTo int64  `json:"delivered_up_to,omitempty"`
+	ReadUpTo      int64  `json:"read_up_to,omitempty"`
+}
+
+func (DeliveryUpdateEvent) EventType() string { return "delivery_update" }
+
+func (e DeliveryUpdateEvent) Envelope() OutgoingMessage {
+	return OutgoingMessage{Type: e.EventType(), RoomID: e.RoomID, UserID: e.UserID, DeliveredUpTo: e.DeliveredUpTo, ReadUpTo: e.ReadUpTo}
+}
+
+// SpeakingEvent tells members outside the call who is talking in it.
+type SpeakingEvent struct {
+	RoomID   string `json:"room_id"`
+	UserID   string `json:"user_id"`
+	Speaking bool   `json:"speaking"`
+}
+
+func (SpeakingEvent) EventType() string { return "speaking" }
+
+func (e SpeakingEvent) Envelope() OutgoingMessage {
+	return OutgoingMessage{Type: e.EventType(), RoomID: e.RoomID, UserID: e.UserID, Speaking: &e.Speaking}
+}
+
+// PresenceEvent tells a friend that a user came online or went offline.
+type PresenceEvent struct {
+	UserID string `json:"user_id"`
+	Online bool   `json:"online"`
+}
+
+func (PresenceEvent) EventType() string { return "presence" }
+
+func (e PresenceEvent) Envelope() OutgoingMessage {
+	return OutgoingMessage{Type: e.EventType(), UserID: e.UserID, Online: &e.Online}
+}
+
+// PresenceStateEvent lists the friends online when an events socket opens,
+// and the rich presence friends have set, online or not.
+type PresenceStateEvent struct {
+	Participants []Participant     `json:"participants,omitempty"`
+	RichPresence []db.RichPresence `json:"rich_presence,omitempty"`
+}
+
+func (PresenceStateEvent) EventType() string { return "presence_state" }
+
+func (e PresenceStateEvent) Envelope() OutgoingMessage {
+	return OutgoingMessage{Type: e.EventType(), Participants: e.Participants, RichPresence: e.RichPresence}
+}
+
+// RichPresenceEvent carries all of a user's current rich presence, to
+// their friends and their own sockets, whenever an entry is set, cleared
+// or expires. An empty list means they have none left.
+type RichPresenceEvent struct {
+	UserID       string            `json:"user_id"`
+	RichPresence []db.RichPresence `json:"rich_presence,omitempty"`
+}
+
+func (RichPresenceEvent) EventType() string { return "rich_presence" }
+
+func (e RichPresenceEvent) Envelope() OutgoingMessage {
+	return OutgoingMessage{Type: e.EventType(), UserID: e.UserID, RichPresence: e.RichPresence}
+}
+
+// NotificationEvent delivers a stored notification as it is created.
+type NotificationEvent struct {
+	Notification db.Notification `json:"notification"`
+}
+
+func (NotificationEvent) EventType() string { return "notification" }
+
+func (e NotificationEvent) Envelope() OutgoingMessage {
+	return OutgoingMessage{Type: e.EventType(), Notification: &e.Notification}
+}
+
+// SessionRevokedEvent tells a user's sockets that sessions older than
+// SessionVersion were signed out.
+type SessionRevokedEvent struct {
+	SessionVersion int `json:"session_version,omitempty"`
+}
+
+func (SessionRevokedEvent) EventType() string { return "session_revoked" }
+
+func (e SessionRevokedEvent) Envelope() OutgoingMessage {
+	return OutgoingMessage{Type: e.EventType(), SessionVersion: e.SessionVersion}
+}
+
+// RoomMembershipEvent tells a member that someone joined or left a room, or
+// that it was deleted. Change is one of MemberJoined, MemberLeft and
+// RoomDeleted.
+type RoomMembershipEvent struct {
+	RoomID      string `json:"room_id"`
+	UserID      string `json:"user_id,omitempty"`
+	Change      string `json:"change"`
+	MemberCount int    `json:"member_count"`
+}
+
+func (RoomMembershipEvent) EventType() string { return "room_membership_event" }
+
+func (e RoomMembershipEvent) Envelope() OutgoingMessage {
+	return OutgoingMessage{Type: e.EventType(), RoomID: e.RoomID, UserID: e.UserID, Change: e.Change, MemberCount: &e.MemberCount}
+}
+
+// MembershipRevokedEvent tells a socket its user was removed from the room.
+type MembershipRevokedEvent struct {
+	RoomID string `json:"room_id"`
+}
+
+func (MembershipRevokedEvent) EventType() string { return "membership_revoked" }
+
+func (e MembershipRevokedEvent) Envelope() OutgoingMessage {
+	return OutgoingMessage{Type: e.EventType(), RoomID: e.RoomID}
+}
+
+// RoomDeletedEvent tells a room's sockets the room is gone.
+type RoomDeletedEvent struct {
+	RoomID string `json:"room_id"`
+}
+
+func (RoomDeletedEvent) EventType() string { return "room_deleted" }
+
+func (e RoomDeletedEvent) Envelope() OutgoingMessage {
+	return OutgoingMessage{Type: e.EventType(), RoomID: e.RoomID}
+}
+
+// ErrorEvent tells one socket about a problem with a frame it sent.
+type ErrorEvent struct {
+	Code      string `json:"code"`
+	Error     string `json:"error"`
+	MaxLength int    `json:"max_length,omitempty"`
+}
+
+func (ErrorEvent) EventType() string { return "error" }
+
+func (e ErrorEvent) Envelope() OutgoingMessage {
+	return OutgoingMessage{Type: e.EventType(), Code: e.Code, Error: e.Error, MaxLength: e.MaxLength}
+}
+
+// InitialStateEvent is the combined per-room state an events socket opens
+// with; see Hub.InitialState.
+type InitialStateEvent struct {
+	Rooms []RoomState `json:"rooms,omitempty"`
+}
+
+func (InitialStateEvent) EventType() string { return "initial_state" }
+
+func (e InitialStateEvent) Envelope() OutgoingMessage {
+	return OutgoingMessage{Type: e.EventType(), Rooms: e.Rooms}
+}
+
+// BoardEvent tells a user's other devices their saved board changed: the
+// item added or updated, or the id of the one removed. A reorder carries
+// neither.
+type BoardEvent struct {
+	Change      string        `json:"change"`
+	BoardItem   *db.BoardItem `json:"board_item,omitempty"`
+	BoardItemID int64         `json:"board_item_id,omitempty"`
+}
+
+func (BoardEvent) EventType() string { return "board_event" }
+
+func (e BoardEvent) Envelope() OutgoingMessage {
+	return OutgoingMessage{Type: e.EventType(), Change: e.Change, BoardItem: e.BoardItem, BoardItemID: e.BoardItemID}
+}
+
+// CallFeedbackRequestEvent asks a member who just left a call to rate it.
+type CallFeedbackRequestEvent struct {
+	RoomID string `json:"room_id"`
+	CallID string `json:"call_id"`
+}
+
+func (CallFeedbackRequestEvent) EventType() string { return "call_feedback_request" }
+
+func (e CallFeedbackRequestEvent) Envelope() OutgoingMessage {
+	return OutgoingMessage{Type: e.EventType(), RoomID: e.RoomID, CallID: e.CallID}
+}
+
+// The events below carry nothing but their type: they tell an events
+// socket to refetch a list.
+
+// RoomInviteEvent means the user's room invitations changed.
+type RoomInviteEvent struct{}
+
+func (RoomInviteEvent) EventType() string { return "room_invite_event" }
+
+func (e RoomInviteEvent) Envelope() OutgoingMessage { return OutgoingMessage{Type: e.EventType()} }
+
+// FriendRequestEvent means the user's friend requests changed.
+type FriendRequestEvent struct{}
+
+func (FriendRequestEvent) EventType() string { return "friend_request_event" }
+
+func (e FriendRequestEvent) Envelope() OutgoingMessage { return OutgoingMessage{Type: e.EventType()} }
+
+// FriendRelationshipEvent means the user's friend list changed.
+type FriendRelationshipEvent struct{}
+
+func (FriendRelationshipEvent) EventType() string { return "friend_relationship_event" }
+
+func (e FriendRelationshipEvent) Envelope() OutgoingMessage {
+	return OutgoingMessage{Type: e.EventType()}
+}
+
+// DMRoomEvent means the user's direct rooms changed.
+type DMRoomEvent struct{}
+
+func (DMRoomEvent) EventType() string { return "dm_room_event" }
+
+func (e DMRoomEvent) Envelope() OutgoingMessage { return OutgoingMessage{Type: e.EventType()} }
+
+// P2PSignalEvent relays one WebRTC signaling message from the other member
+// of a direct room for a peer-to-peer call.
+type P2PSignalEvent struct {
+	RoomID    string          `json:"room_id"`
+	UserID    string          `json:"user_id"`
+	Signal    string          `json:"signal"`
+	SDP       string          `json:"sdp,omitempty"`
+	Candidate json.RawMessage `json:"candidate,omitempty"`
+}
+
+func (P2PSignalEvent) EventType() string { return "p2p_signal" }
+
+func (e P2PSignalEvent) Envelope() OutgoingMessage {
+	return OutgoingMessage{Type: e.EventType(), RoomID: e.RoomID, UserID: e.UserID, Signal: e.Signal, SDP: e.SDP, Candidate: e.Candidate}
+}
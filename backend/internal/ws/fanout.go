@@ -0,0 +1,126 @@
+package ws
+
+import (
+	"encoding/binary"
+	"runtime"
+	"time"
+
+	"talkie/backend/internal/metrics"
+
+	"github.com/google/uuid"
+)
+
+// Room events are handed to a fixed pool of fan-out workers rather than
+// delivered on the caller's goroutine, so a handler that broadcasts into a
+// room with thousands of sockets returns as soon as the event is numbered.
+// Each room is pinned to one worker and its events are queued in the order
+// they were numbered, so per-room ordering, including state_sync snapshots
+// and targeted sends, is what it was with inline delivery.
+
+const fanoutQueueSize = 1024
+
+var (
+	fanoutLatency = metrics.NewHistogram("talkie_ws_fanout_seconds", "Time from queuing a room event to handing it to every target socket.",
+		[]float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1})
+	fanoutQueueFull = metrics.NewCounter("talkie_ws_fanout_queue_full_total", "Room events whose sender waited because its fan-out worker's queue was full.")
+)
+
+type fanoutJob struct {
+	targets []*Client
+	payload OutgoingMessage
+	queued  time.Time
+	// done, when set, marks a barrier queued by Drain: it is closed once
+	// everything queued before it was delivered.
+	done chan struct{}
+}
+
+type fanoutPool struct {
+	queues []chan fanoutJob
+}
+
+// newFanoutPool starts workers workers, or one per CPU when workers is not
+// positive.
+func newFanoutPool(workers int) *fanoutPool {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	p := &fanoutPool{queues: make([]chan fanoutJob, workers)}
+	for i := range p.queues {
+		q := make(chan fanoutJob, fanoutQueueSize)
+		p.queues[i] = q
+		go runFanout(q)
+	}
+	return p
+}
+
+// submit queues payload for targets on roomID's worker. A full queue makes
+// the caller wait rather than drop or reorder the event.
+func (p *fanoutPool) submit(roomID uuid.UUID, targets []*Client, payload OutgoingMessage) {
+	if len(targets) == 0 {
+		return
+	}
+	q := p.queues[binary.BigEndian.Uint32(roomID[12:])%uint32(len(p.queues))]
+	job := fanoutJob{targets: targets, payload: payload, queued: time.Now()}
+	select {
+	case q <- job:
+	default:
+		fanoutQueueFull.Inc()
+		q <- job
+	}
+}
+
+// stop ends the workers once their queues drain.
+func (p *fanoutPool) stop() {
+	for _, q := range p.queues {
+		close(q)
+	}
+}
+
+func runFanout(q chan fanoutJob) {
+	for job := range q {
+		if job.done != nil {
+			close(job.done)
+			continue
+		}
+		deliver(job.targets, job.payload)
+		fanoutLatency.ObserveSince(job.queued)
+	}
+}
+
+// deliver queues payload on each client's Send channel. A client too slow
+// to have room is closed rather than allowed to hold up the others.
+func deliver(targets []*Client, payload OutgoingMessage) {
+	for _, c := range targets {
+		select {
+		case c.Send <- payload:
+		default:
+			c.Close()
+		}
+	}
+}
+
+// Drain waits until every event queued before the call has been handed to
+// its target sockets' Send channels. Tests use it to check delivery, and
+// which slow sockets were closed, without sleeping.
+func (h *Hub) Drain() {
+	h.seqMu.Lock()
+	dones := make([]chan struct{}, len(h.fanout.queues))
+	for i, q := range h.fanout.queues {
+		dones[i] = make(chan struct{})
+		q <- fanoutJob{done: dones[i]}
+	}
+	h.seqMu.Unlock()
+	for _, done := range dones {
+		<-done
+	}
+}
+
+// SetFanoutWorkers replaces the fan-out pool with one of n workers, one per
+// CPU when n is not positive. Call it before the hub carries traffic.
+func (h *Hub) SetFanoutWorkers(n int) {
+	h.seqMu.Lock()
+	defer h.seqMu.Unlock()
+	old := h.fanout
+	h.fanout = newFanoutPool(n)
+	old.stop()
+}
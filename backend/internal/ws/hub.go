@@ -1,88 +1,231 @@
 package ws
 
 import (
+	"context"
+	"log"
 	"sync"
 
+	"talkie/backend/internal/broadcast"
+	"talkie/backend/internal/history"
+
 	"github.com/google/uuid"
 )
 
 type Hub struct {
 	mu         sync.RWMutex
+	seqMu      sync.Mutex
+	seqs       map[uuid.UUID]uint64
 	rooms      map[uuid.UUID]map[*Client]struct{}
+	users      map[uuid.UUID]map[*Client]struct{}
+	ips        map[string]map[*Client]struct{}
 	userEvents map[uuid.UUID]map[*NotificationClient]struct{}
 	callCounts map[uuid.UUID]map[uuid.UUID]int
 	callUsers  map[uuid.UUID]map[uuid.UUID]Participant
+	speakers   map[uuid.UUID]map[uuid.UUID]struct{}
+	callChats  map[uuid.UUID][]callChatLine
+	callIDs    map[uuid.UUID]uuid.UUID
+	limits     ConnLimits
+	backend    broadcast.Backend
+	validate   func([]byte) error
+	history    *history.Cache
+	clock      Clock
+	// fanout is replaced only under seqMu.
+	fanout     *fanoutPool
+	onPresence func(uuid.UUID)
+	onPanic    func(any, map[string]string)
+	pumps      pumpCounts
+
+	// channels maps a broadcast room to the users with an events socket
+	// here who subscribe to it; userChannels is the reverse.
+	channels     map[uuid.UUID]map[uuid.UUID]struct{}
+	userChannels map[uuid.UUID]map[uuid.UUID]struct{}
 }
 
 func NewHub() *Hub {
 	return &Hub{
+		seqs:       make(map[uuid.UUID]uint64),
 		rooms:      make(map[uuid.UUID]map[*Client]struct{}),
+		users:      make(map[uuid.UUID]map[*Client]struct{}),
+		ips:        make(map[string]map[*Client]struct{}),
 		userEvents: make(map[uuid.UUID]map[*NotificationClient]struct{}),
+
+		channels:     make(map[uuid.UUID]map[uuid.UUID]struct{}),
+		userChannels: make(map[uuid.UUID]map[uuid.UUID]struct{}),
+
 		callCounts: make(map[uuid.UUID]map[uuid.UUID]int),
 		callUsers:  make(map[uuid.UUID]map[uuid.UUID]Participant),
+		speakers:   make(map[uuid.UUID]map[uuid.UUID]struct{}),
+		callChats:  make(map[uuid.UUID][]callChatLine),
+		callIDs:    make(map[uuid.UUID]uuid.UUID),
+		fanout:     newFanoutPool(0),
+		clock:      systemClock{},
 	}
 }
 
 func (h *Hub) Add(c *Client) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
+	was := h.onlineLocked(c.UserID)
+	h.addLocked(c)
+	changed := h.presenceChangedLocked(c.UserID, was)
+	h.mu.Unlock()
+	if changed != nil {
+		changed(c.UserID)
+	}
+}
+
+func (h *Hub) addLocked(c *Client) {
+	c.wrote()
 	if _, ok := h.rooms[c.RoomID]; !ok {
 		h.rooms[c.RoomID] = make(map[*Client]struct{})
 	}
 	h.rooms[c.RoomID][c] = struct{}{}
+	if _, ok := h.users[c.UserID]; !ok {
+		h.users[c.UserID] = make(map[*Client]struct{})
+	}
+	h.users[c.UserID][c] = struct{}{}
+	if c.RemoteIP != "" {
+		if _, ok := h.ips[c.RemoteIP]; !ok {
+			h.ips[c.RemoteIP] = make(map[*Client]struct{})
+		}
+		h.ips[c.RemoteIP][c] = struct{}{}
+	}
 }
 
 func (h *Hub) Remove(c *Client) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
+	changed := h.removeLocked(c)
+	h.mu.Unlock()
+	if changed != nil {
+		changed(c.UserID)
+	}
+}
+
+// removeLocked drops c and returns the presence handler to call, if any.
+func (h *Hub) removeLocked(c *Client) func(uuid.UUID) {
 	clients, ok := h.rooms[c.RoomID]
 	if !ok {
-		return
+		return nil
+	}
+	if _, ok := clients[c]; !ok {
+		return nil
 	}
 	delete(clients, c)
-	h.removeCallLocked(c.RoomID, c.UserID)
+	if c.inCall {
+		c.inCall = false
+		h.removeCallLocked(c.RoomID, c.UserID)
+	}
 	if len(clients) == 0 {
 		delete(h.rooms, c.RoomID)
+		delete(h.seqs, c.RoomID)
 	}
+	if byIP := h.ips[c.RemoteIP]; byIP != nil {
+		delete(byIP, c)
+		if len(byIP) == 0 {
+			delete(h.ips, c.RemoteIP)
+		}
+	}
+	if byUser := h.users[c.UserID]; byUser != nil {
+		delete(byUser, c)
+		if len(byUser) == 0 {
+			delete(h.users, c.UserID)
+		}
+	}
+	return h.presenceChangedLocked(c.UserID, true)
 }
 
-func (h *Hub) Broadcast(roomID uuid.UUID, payload OutgoingMessage) {
-	h.mu.RLock()
-	clients := h.rooms[roomID]
-	h.mu.RUnlock()
+func (h *Hub) broadcastLocal(roomID uuid.UUID, payload OutgoingMessage) {
+	h.seqMu.Lock()
+	defer h.seqMu.Unlock()
 
+	h.mu.Lock()
+	clients := h.rooms[roomID]
+	// Events for only part of the room carry no sequence number, or the
+	// sockets that skip them would see a gap.
+	partial := payload.Type == "speaking" || payload.Type == "call_chat"
+	if len(clients) > 0 && !partial {
+		h.seqs[roomID]++
+		payload.Seq = h.seqs[roomID]
+	}
+	targets := make([]*Client, 0, len(clients))
 	for c := range clients {
-		select {
-		case c.Send <- payload:
-		default:
-			c.Close()
+		switch {
+		case payload.Type == "speaking" && c.inCall:
+			// Members in the call hear this from LiveKit directly.
+			continue
+		case payload.Type == "call_chat" && !c.inCall:
+			continue
+		}
+		targets = append(targets, c)
+	}
+	h.mu.Unlock()
+
+	h.fanout.submit(roomID, targets, payload)
+}
+
+// sendToRoomUserLocal goes through roomID's fan-out worker like a room
+// broadcast, so it stays ordered with the room's other events.
+func (h *Hub) sendToRoomUserLocal(roomID, userID uuid.UUID, payload OutgoingMessage) {
+	h.seqMu.Lock()
+	defer h.seqMu.Unlock()
+
+	h.mu.RLock()
+	targets := make([]*Client, 0, 1)
+	for c := range h.users[userID] {
+		if c.RoomID == roomID {
+			targets = append(targets, c)
 		}
 	}
+	h.mu.RUnlock()
+
+	h.fanout.submit(roomID, targets, payload)
+}
+
+// SendEphemeral shows content to a single user in a room as a system-authored
+// message that exists only on that user's screen.
+func (h *Hub) SendEphemeral(roomID, userID uuid.UUID, content string) {
+	h.SendToRoomUser(roomID, userID, EphemeralMessage(roomID, content))
 }
 
 func (h *Hub) AddUserEvents(c *NotificationClient) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
+	was := h.onlineLocked(c.UserID)
 	if _, ok := h.userEvents[c.UserID]; !ok {
 		h.userEvents[c.UserID] = make(map[*NotificationClient]struct{})
 	}
 	h.userEvents[c.UserID][c] = struct{}{}
+	h.watchChannelsLocked(c.UserID, c.Channels)
+	c.wrote()
+	changed := h.presenceChangedLocked(c.UserID, was)
+	h.mu.Unlock()
+	if changed != nil {
+		changed(c.UserID)
+	}
 }
 
 func (h *Hub) RemoveUserEvents(c *NotificationClient) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
 	clients, ok := h.userEvents[c.UserID]
 	if !ok {
+		h.mu.Unlock()
+		return
+	}
+	if _, ok := clients[c]; !ok {
+		h.mu.Unlock()
 		return
 	}
 	delete(clients, c)
 	if len(clients) == 0 {
 		delete(h.userEvents, c.UserID)
+		h.unwatchChannelsLocked(c.UserID)
+	}
+	changed := h.presenceChangedLocked(c.UserID, true)
+	h.mu.Unlock()
+	if changed != nil {
+		changed(c.UserID)
 	}
 }
 
-func (h *Hub) BroadcastUser(userID uuid.UUID, payload OutgoingMessage) {
+func (h *Hub) broadcastUserLocal(userID uuid.UUID, payload OutgoingMessage) {
 	h.mu.RLock()
 	clients := h.userEvents[userID]
 	h.mu.RUnlock()
@@ -96,6 +239,45 @@ func (h *Hub) BroadcastUser(userID uuid.UUID, payload OutgoingMessage) {
 	}
 }
 
+func (h *Hub) sendToUserLocal(userID uuid.UUID, payload OutgoingMessage) {
+	h.mu.RLock()
+	roomClients := make([]*Client, 0, len(h.users[userID]))
+	for c := range h.users[userID] {
+		roomClients = append(roomClients, c)
+	}
+	eventClients := make([]*NotificationClient, 0, len(h.userEvents[userID]))
+	for c := range h.userEvents[userID] {
+		eventClients = append(eventClients, c)
+	}
+	h.mu.RUnlock()
+
+	deliver(roomClients, payload)
+	for _, c := range eventClients {
+		select {
+		case c.Send <- payload:
+		default:
+			c.Close()
+		}
+	}
+}
+
+// PublishReadState pushes the member's new unread state to all of their
+// connections so every device moves its "new messages" divider together.
+func (h *Hub) PublishReadState(ctx context.Context, store Store, roomID, userID uuid.UUID, lastRead int64) {
+	unread, firstUnread, err := store.GetUnreadState(ctx, roomID, userID)
+	if err != nil {
+		log.Printf("load unread state failed: %v", err)
+		return
+	}
+	h.SendToUser(userID, UnreadMessage(roomID, lastRead, unread, firstUnread))
+}
+
+func (h *Hub) IsUserOnline(userID uuid.UUID) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.onlineLocked(userID)
+}
+
 func (h *Hub) Participants(roomID uuid.UUID) []Participant {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
@@ -110,6 +292,10 @@ func (h *Hub) Participants(roomID uuid.UUID) []Participant {
 func (h *Hub) SetInCall(c *Client, inCall bool) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
+	if c.inCall == inCall {
+		return
+	}
+	c.inCall = inCall
 	if inCall {
 		h.addCallLocked(c.RoomID, c.UserID, c.Username, c.AvatarURL)
 		return
@@ -131,6 +317,7 @@ func (h *Hub) CallParticipants(roomID uuid.UUID) []Participant {
 func (h *Hub) addCallLocked(roomID, userID uuid.UUID, username, avatarURL string) {
 	if _, ok := h.callCounts[roomID]; !ok {
 		h.callCounts[roomID] = make(map[uuid.UUID]int)
+		h.callIDs[roomID] = uuid.New()
 	}
 	if _, ok := h.callUsers[roomID]; !ok {
 		h.callUsers[roomID] = make(map[uuid.UUID]Participant)
@@ -150,11 +337,19 @@ func (h *Hub) removeCallLocked(roomID, userID uuid.UUID) {
 		if users := h.callUsers[roomID]; users != nil {
 			delete(users, userID)
 		}
+		if talking := h.speakers[roomID]; talking != nil {
+			delete(talking, userID)
+			if len(talking) == 0 {
+				delete(h.speakers, roomID)
+			}
+		}
 	} else {
 		counts[userID] = n
 	}
 	if len(counts) == 0 {
 		delete(h.callCounts, roomID)
 		delete(h.callUsers, roomID)
+		delete(h.speakers, roomID)
+		delete(h.callIDs, roomID)
 	}
 }
@@ -0,0 +1,31 @@
+package ws
+
+import "talkie/backend/internal/db"
+
+// RoomState is one room's entry in a combined "initial_state" event.
+type RoomState struct {
+	RoomID               string        `json:"room_id"`
+	Seq                  uint64        `json:"seq"`
+	LastReadMessageID    int64         `json:"last_read_message_id"`
+	UnreadCount          int           `json:"unread_count"`
+	FirstUnreadMessageID *int64        `json:"first_unread_message_id,omitempty"`
+	CallUsers            []Participant `json:"call_users,omitempty"`
+}
+
+// InitialState bundles the state a client needs for several rooms at once,
+// so an app with many rooms does not open a socket per room at startup.
+// Seq lets the client line up later room sockets with this snapshot.
+func (h *Hub) InitialState(states []db.RoomUnreadState) InitialStateEvent {
+	rooms := make([]RoomState, 0, len(states))
+	for _, st := range states {
+		rooms = append(rooms, RoomState{
+			RoomID:               st.RoomID.String(),
+			Seq:                  h.Sequence(st.RoomID),
+			LastReadMessageID:    st.LastReadMessageID,
+			UnreadCount:          st.UnreadCount,
+			FirstUnreadMessageID: st.FirstUnreadMessageID,
+			CallUsers:            h.CallParticipants(st.RoomID),
+		})
+	}
+	return InitialStateEvent{Rooms: rooms}
+}
@@ -0,0 +1,33 @@
+package ws
+
+import "unicode/utf8"
+
+// minReadLimit is the frame size a room socket always accepts, enough for
+// every client frame other than long chat text.
+const minReadLimit = 4096
+
+// readLimit sizes a room socket's frame limit to fit a chat frame of
+// maxLength characters. JSON escapes a character in at most six bytes.
+func readLimit(maxLength int) int64 {
+	return max(minReadLimit, int64(6*maxLength+1024))
+}
+
+// MessageTooLongMessage tells the sender their message was not sent
+// because it is over maxLength characters.
+func MessageTooLongMessage(maxLength int) ErrorEvent {
+	return ErrorEvent{Code: "message_too_long", Error: "message is too long", MaxLength: maxLength}
+}
+
+// acceptLength reports whether content is within the socket's message
+// length limit, telling the sender when it is not.
+func (c *Client) acceptLength(content string) bool {
+	if c.MaxMessageLength <= 0 || utf8.RuneCountInString(content) <= c.MaxMessageLength {
+		return true
+	}
+	select {
+	case c.Send <- MessageTooLongMessage(c.MaxMessageLength).Envelope():
+	default:
+		c.Close()
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+package ws
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+// CloseReplaced is sent to a connection evicted by the close_oldest policy.
+const CloseReplaced = 4001
+
+var ErrConnLimit = errors.New("connection limit reached")
+
+// ConnLimits caps concurrent room sockets. Zero disables a cap. With
+// CloseOldest set, a new connection over the cap evicts the oldest one instead
+// of being rejected, which suits clients that reconnect without closing.
+type ConnLimits struct {
+	PerUser     int
+	PerIP       int
+	CloseOldest bool
+}
+
+func (h *Hub) SetConnLimits(l ConnLimits) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.limits = l
+}
+
+// CheckConnLimits reports whether a new connection would be refused. It is
+// meant to run before the HTTP upgrade so rejects get a plain 429 response.
+func (h *Hub) CheckConnLimits(userID uuid.UUID, ip string) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.limits.CloseOldest {
+		return nil
+	}
+	return h.overLimitLocked(userID, ip)
+}
+
+// Admit registers c subject to the connection limits. Under the reject
+// policy it returns ErrConnLimit without adding c; under close_oldest it adds
+// c and closes the oldest connections that now exceed the caps.
+func (h *Hub) Admit(c *Client) error {
+	if c.ConnectedAt.IsZero() {
+		c.ConnectedAt = h.now()
+	}
+	h.mu.Lock()
+	if !h.limits.CloseOldest {
+		if err := h.overLimitLocked(c.UserID, c.RemoteIP); err != nil {
+			h.mu.Unlock()
+			return err
+		}
+	}
+	was := h.onlineLocked(c.UserID)
+	h.addLocked(c)
+	evicted := h.evictionsLocked(c)
+	changed := h.presenceChangedLocked(c.UserID, was)
+	h.mu.Unlock()
+
+	if changed != nil {
+		changed(c.UserID)
+	}
+
+	for _, old := range evicted {
+		old.CloseWithReason(CloseReplaced, "replaced by a newer connection")
+	}
+	return nil
+}
+
+func (h *Hub) overLimitLocked(userID uuid.UUID, ip string) error {
+	if h.limits.PerUser > 0 && len(h.users[userID]) >= h.limits.PerUser {
+		return ErrConnLimit
+	}
+	if h.limits.PerIP > 0 && ip != "" && len(h.ips[ip]) >= h.limits.PerIP {
+		return ErrConnLimit
+	}
+	return nil
+}
+
+func (h *Hub) evictionsLocked(c *Client) []*Client {
+	if !h.limits.CloseOldest {
+		return nil
+	}
+	evicted := make(map[*Client]struct{})
+	if h.limits.PerUser > 0 {
+		for _, old := range oldestFirst(h.users[c.UserID], nil, c) {
+			if len(h.users[c.UserID])-len(evicted) <= h.limits.PerUser {
+				break
+			}
+			evicted[old] = struct{}{}
+		}
+	}
+	if h.limits.PerIP > 0 && c.RemoteIP != "" {
+		byIP := h.ips[c.RemoteIP]
+		remaining := len(byIP)
+		for old := range evicted {
+			if old.RemoteIP == c.RemoteIP {
+				remaining--
+			}
+		}
+		for _, old := range oldestFirst(byIP, evicted, c) {
+			if remaining <= h.limits.PerIP {
+				break
+			}
+			evicted[old] = struct{}{}
+			remaining--
+		}
+	}
+	out := make([]*Client, 0, len(evicted))
+	for old := range evicted {
+		out = append(out, old)
+	}
+	return out
+}
+
+func oldestFirst(set map[*Client]struct{}, skip map[*Client]struct{}, keep *Client) []*Client {
+	out := make([]*Client, 0, len(set))
+	for c := range set {
+		if c == keep {
+			continue
+		}
+		if _, ok := skip[c]; ok {
+			continue
+		}
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ConnectedAt.Before(out[j].ConnectedAt)
+	})
+	return out
+}
+
+// CloseWithReason sends a close frame before dropping the connection so the
+// client can tell a deliberate disconnect from a network failure.
+func (c *Client) CloseWithReason(code int, reason string) {
+	CloseConn(c.Conn, code, reason)
+}
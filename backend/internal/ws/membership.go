@@ -0,0 +1,21 @@
+package ws
+
+import "github.com/google/uuid"
+
+// Membership changes announced to members' events sockets.
+const (
+	MemberJoined = "joined"
+	MemberLeft   = "left"
+	RoomDeleted  = "deleted"
+)
+
+// MembershipMessage tells a member's events socket that userID joined or
+// left roomID, or that the room was deleted, so room lists and member counts
+// can update without a refetch of every room.
+func MembershipMessage(roomID, userID uuid.UUID, change string, members int) RoomMembershipEvent {
+	msg := RoomMembershipEvent{RoomID: roomID.String(), Change: change, MemberCount: members}
+	if userID != uuid.Nil {
+		msg.UserID = userID.String()
+	}
+	return msg
+}
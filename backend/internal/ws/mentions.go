@@ -0,0 +1,44 @@
+package ws
+
+import (
+	"context"
+	"log"
+
+	"talkie/backend/internal/db"
+	"talkie/backend/internal/notify"
+)
+
+// RoomMentionScope returns the @room/@here scope msg may use under its
+// room's mention policy. The policy is only looked up when the content
+// actually contains such a mention, so ordinary messages cost nothing.
+func RoomMentionScope(ctx context.Context, store Store, msg db.Message) notify.MentionScope {
+	scope := notify.ParseRoomMention(msg.Content)
+	if scope == notify.MentionNone || msg.Shadowed {
+		return notify.MentionNone
+	}
+	policy, err := store.GetRoomMentionPolicy(ctx, msg.RoomID)
+	if err != nil {
+		log.Printf("load mention policy failed: %v", err)
+		return notify.MentionNone
+	}
+	switch policy {
+	case "members":
+		return scope
+	case "admins":
+		admin, err := store.IsRoomAdmin(ctx, msg.RoomID, msg.UserID)
+		if err != nil {
+			log.Printf("check room admin failed: %v", err)
+			return notify.MentionNone
+		}
+		if admin {
+			return scope
+		}
+	}
+	return notify.MentionNone
+}
+
+// SendNotification delivers an in-app notification to every connection of
+// its user. It makes the hub a notify.Live.
+func (h *Hub) SendNotification(n db.Notification) {
+	h.SendToUser(n.UserID, NotificationEvent{Notification: n})
+}
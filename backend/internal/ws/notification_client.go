@@ -1,17 +1,29 @@
 package ws
 
 import (
-	"time"
+	"encoding/json"
+	"sync/atomic"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
 type NotificationClient struct {
-	Conn   *websocket.Conn
+	Conn   Conn
 	Hub    *Hub
 	UserID uuid.UUID
 	Send   chan OutgoingMessage
+	// HideNSFW withholds flagged media from this connection.
+	HideNSFW bool
+	// Batch writes frames as JSON arrays of events (?batch=1).
+	Batch bool
+	// Channels are the broadcast rooms the user subscribes to, whose posts
+	// this socket receives.
+	Channels []uuid.UUID
+
+	// lastWrite is when the write pump last completed a write, in Unix
+	// nanoseconds, for the reaper.
+	lastWrite atomic.Int64
 }
 
 func (c *NotificationClient) Close() {
@@ -19,26 +31,39 @@ func (c *NotificationClient) Close() {
 }
 
 func (c *NotificationClient) ReadPump() {
+	defer c.Hub.recoverPump(c.Hub.startPump("events read pump"), c.UserID, uuid.Nil)
 	defer func() {
 		c.Hub.RemoveUserEvents(c)
 		_ = c.Conn.Close()
 	}()
 
 	c.Conn.SetReadLimit(1024)
-	_ = c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	_ = c.Conn.SetReadDeadline(c.Hub.now().Add(pongWait))
 	c.Conn.SetPongHandler(func(string) error {
-		return c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+		return c.Conn.SetReadDeadline(c.Hub.now().Add(pongWait))
 	})
 
+	// "ping" is the only frame this socket answers; anything else is read
+	// and ignored.
 	for {
-		if _, _, err := c.Conn.ReadMessage(); err != nil {
+		_, data, err := c.Conn.ReadMessage()
+		if err != nil {
 			break
 		}
+		var incoming IncomingMessage
+		if json.Unmarshal(data, &incoming) != nil || incoming.Type != "ping" {
+			continue
+		}
+		select {
+		case c.Send <- PongEvent{ClientTime: incoming.ClientTime, ServerTime: c.Hub.now().UnixMilli()}.Envelope():
+		default:
+		}
 	}
 }
 
 func (c *NotificationClient) WritePump() {
-	ticker := time.NewTicker(pingPeriod)
+	defer c.Hub.recoverPump(c.Hub.startPump("events write pump"), c.UserID, uuid.Nil)
+	ticker := c.Hub.newTicker(pingPeriod)
 	defer func() {
 		ticker.Stop()
 		_ = c.Conn.Close()
@@ -47,19 +72,25 @@ func (c *NotificationClient) WritePump() {
 	for {
 		select {
 		case msg, ok := <-c.Send:
-			_ = c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			_ = c.Conn.SetWriteDeadline(c.Hub.now().Add(writeWait))
 			if !ok {
 				_ = c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
-			if err := c.Conn.WriteJSON(msg); err != nil {
+			if !writeQueued(c.Conn, c.Send, msg, c.Batch, c.HideNSFW, false) {
 				return
 			}
-		case <-ticker.C:
-			_ = c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.wrote()
+		case <-ticker.Chan():
+			_ = c.Conn.SetWriteDeadline(c.Hub.now().Add(writeWait))
 			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
+			c.wrote()
 		}
 	}
 }
+
+func (c *NotificationClient) CloseWithReason(code int, reason string) {
+	CloseConn(c.Conn, code, reason)
+}
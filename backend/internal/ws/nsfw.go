@@ -0,0 +1,29 @@
+package ws
+
+// WithoutNSFWMedia returns m with the media of NSFW messages withheld. The
+// payloads are copied, since the same message is shared by every recipient
+// of a broadcast.
+func (m OutgoingMessage) WithoutNSFWMedia() OutgoingMessage {
+	if m.Message != nil && m.Message.NSFW && m.Message.MediaURL != "" {
+		p := withholdMedia(*m.Message)
+		m.Message = &p
+	}
+	copied := false
+	for i, p := range m.Messages {
+		if !p.NSFW || p.MediaURL == "" {
+			continue
+		}
+		if !copied {
+			m.Messages = append([]MessagePayload(nil), m.Messages...)
+			copied = true
+		}
+		m.Messages[i] = withholdMedia(p)
+	}
+	return m
+}
+
+func withholdMedia(p MessagePayload) MessagePayload {
+	p.MediaURL = ""
+	p.Withheld = true
+	return p
+}
@@ -0,0 +1,64 @@
+package ws
+
+import (
+	"bytes"
+	"log"
+
+	"github.com/google/uuid"
+)
+
+// A direct room's two members can call each other without the SFU: their
+// clients run WebRTC between themselves and exchange offers, answers and
+// ICE candidates over their room sockets. The hub only relays them and
+// looks at nothing but the signal's kind, so the media never touches the
+// server, which also means TURN from /api/rtc/ice-servers is what gets
+// peers behind strict NATs connected.
+
+var p2pSignals = map[string]bool{"offer": true, "answer": true, "ice": true, "hangup": true}
+
+// P2PSignalMessage builds the relayed form of a signal from c.
+func P2PSignalMessage(c *Client, in IncomingMessage) P2PSignalEvent {
+	return P2PSignalEvent{
+		RoomID:    c.RoomID.String(),
+		UserID:    c.UserID.String(),
+		Signal:    in.Signal,
+		SDP:       in.SDP,
+		Candidate: in.Candidate,
+	}
+}
+
+// relaySignal hands a p2p_signal frame to the other member's sockets in
+// the room. Frames on group rooms, of unknown kinds or with a candidate
+// that is not a JSON object are answered with an error event.
+func (c *Client) relaySignal(in IncomingMessage) {
+	if !c.P2PCalls || !c.IsDirect {
+		c.Hub.SendToRoomUser(c.RoomID, c.UserID, ErrorEvent{Code: "p2p_unavailable", Error: "peer-to-peer calls are not available in this room"})
+		return
+	}
+	if !p2pSignals[in.Signal] || len(in.Candidate) > 0 && !bytes.HasPrefix(bytes.TrimSpace(in.Candidate), []byte("{")) {
+		c.Hub.SendToRoomUser(c.RoomID, c.UserID, ErrorEvent{Code: "invalid_signal", Error: "invalid p2p signal"})
+		return
+	}
+	if !c.lookupPeer() {
+		return
+	}
+	c.Hub.SendToRoomUser(c.RoomID, c.p2pPeer, P2PSignalMessage(c, in))
+}
+
+func (c *Client) lookupPeer() bool {
+	if c.p2pPeer != uuid.Nil {
+		return true
+	}
+	members, err := c.Store.ListRoomMembers(c.ctx, c.RoomID)
+	if err != nil {
+		log.Printf("load peer of direct room %s: %v", c.RoomID, err)
+		return false
+	}
+	for _, m := range members {
+		if m.ID != c.UserID {
+			c.p2pPeer = m.ID
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package ws
+
+import (
+	"log"
+	"runtime/debug"
+
+	"github.com/google/uuid"
+)
+
+// SetPanicHandler sets where panics in socket pumps are reported once
+// logged. It is called in the deferred function that recovered, so it can
+// still see the panicking stack. Set it before sockets are served.
+func (h *Hub) SetPanicHandler(fn func(v any, tags map[string]string)) {
+	h.onPanic = fn
+}
+
+// recoverPump is deferred first in each pump goroutine, with the pump's
+// name from startPump. A panic in one socket's pump then closes that
+// socket, through the pump's own deferred cleanup, instead of taking the
+// server down.
+func (h *Hub) recoverPump(pump string, userID, roomID uuid.UUID) {
+	h.pumps.add(pump, -1)
+	v := recover()
+	if v == nil {
+		return
+	}
+	log.Printf("panic in %s of user %s: %v\n%s", pump, userID, v, debug.Stack())
+	if h.onPanic == nil {
+		return
+	}
+	tags := map[string]string{"pump": pump, "user_id": userID.String()}
+	if roomID != uuid.Nil {
+		tags["room_id"] = roomID.String()
+	}
+	h.onPanic(v, tags)
+}
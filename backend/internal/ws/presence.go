@@ -0,0 +1,53 @@
+package ws
+
+import (
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+// A user is online while they have any socket open on this instance. The
+// hub reports the moment that changes to a handler set by the server, which
+// tells the user's friends. Presence is per instance: behind several
+// instances a user is reported offline when their sockets on one instance
+// close, even if they still have sockets elsewhere.
+
+// SetPresenceHandler registers fn to be called, without hub locks held,
+// when userID's first socket opens or last socket closes. fn should read
+// the current state with IsUserOnline rather than assume which way it went,
+// since calls for one user may race.
+func (h *Hub) SetPresenceHandler(fn func(userID uuid.UUID)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.onPresence = fn
+}
+
+func (h *Hub) onlineLocked(userID uuid.UUID) bool {
+	return len(h.userEvents[userID]) > 0 || len(h.users[userID]) > 0
+}
+
+// presenceChangedLocked returns the handler to call if userID's online
+// state is no longer was, or nil.
+func (h *Hub) presenceChangedLocked(userID uuid.UUID, was bool) func(uuid.UUID) {
+	if h.onPresence == nil || h.onlineLocked(userID) == was {
+		return nil
+	}
+	return h.onPresence
+}
+
+// PresenceMessage tells a friend's events socket that userID came online or
+// went offline.
+func PresenceMessage(userID uuid.UUID, online bool) PresenceEvent {
+	return PresenceEvent{UserID: userID.String(), Online: online}
+}
+
+// PresenceStateMessage lists the friends online, and friends' rich
+// presence, when a /ws/user socket opens.
+func PresenceStateMessage(online []Participant, rich []db.RichPresence) PresenceStateEvent {
+	return PresenceStateEvent{Participants: online, RichPresence: rich}
+}
+
+// RichPresenceMessage tells userID's friends what userID is doing now.
+func RichPresenceMessage(userID uuid.UUID, rich []db.RichPresence) RichPresenceEvent {
+	return RichPresenceEvent{UserID: userID.String(), RichPresence: rich}
+}
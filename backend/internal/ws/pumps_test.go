@@ -0,0 +1,91 @@
+package ws_test
+
+import (
+	"testing"
+	"time"
+
+	"talkie/backend/internal/dbtest"
+	"talkie/backend/internal/ws"
+	"talkie/backend/internal/ws/wstest"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// startPumps adds a client to hub, runs both of its pumps and waits for
+// them to park on the clock: the ping ticker and the read deadline.
+func startPumps(t *testing.T, hub *ws.Hub, clock *wstest.Clock) (*ws.Client, *wstest.Conn) {
+	t.Helper()
+	c, conn := newClient(clock, hub, uuid.New(), uuid.New())
+	c.Store = dbtest.New()
+	hub.Add(c)
+	go c.WritePump()
+	go c.ReadPump()
+	t.Cleanup(func() { _ = conn.Close() })
+	if !clock.WaitPending(2, 2*time.Second) {
+		t.Fatal("pumps did not start")
+	}
+	return c, conn
+}
+
+func TestPingTimeoutClosesSilentPeer(t *testing.T) {
+	hub, clock := newHub(t)
+	c, conn := startPumps(t, hub, clock)
+
+	clock.Advance(54 * time.Second)
+	frames, ok := conn.WaitFrames(1, 2*time.Second)
+	if !ok || frames[0].Type != websocket.PingMessage {
+		t.Fatalf("frames = %v, want a ping after 54s", frames)
+	}
+	if conn.Closed() {
+		t.Fatal("closed before the pong wait ran out")
+	}
+
+	clock.Advance(6 * time.Second)
+	if err := conn.WaitClosed(2 * time.Second); err != nil {
+		t.Fatal("a peer that never answered the ping stayed connected")
+	}
+	if hub.IsUserOnline(c.UserID) {
+		t.Fatal("the timed-out client is still in the hub")
+	}
+}
+
+func TestPongKeepsPeerConnected(t *testing.T) {
+	hub, clock := newHub(t)
+	_, conn := startPumps(t, hub, clock)
+
+	clock.Advance(54 * time.Second)
+	if _, ok := conn.WaitFrames(1, 2*time.Second); !ok {
+		t.Fatal("no ping after 54s")
+	}
+	if err := conn.Pong(); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(6 * time.Second)
+	if err := conn.WaitClosed(50 * time.Millisecond); err == nil {
+		t.Fatal("a peer that answered the ping was disconnected")
+	}
+}
+
+func TestBlockedPeerIsDroppedAfterWriteWait(t *testing.T) {
+	hub, clock := newHub(t)
+	roomID := uuid.New()
+	conn := openSocket(t, hub, clock, roomID, uuid.New())
+	if !clock.WaitPending(1, 2*time.Second) {
+		t.Fatal("write pump did not start")
+	}
+	conn.Block()
+
+	hub.Broadcast(roomID, ws.CallParticipantsEvent{})
+	if !clock.WaitPending(2, 2*time.Second) {
+		t.Fatal("write never waited on its deadline")
+	}
+	clock.Advance(9 * time.Second)
+	if conn.Closed() {
+		t.Fatal("closed before the write deadline")
+	}
+	clock.Advance(time.Second)
+	if err := conn.WaitClosed(2 * time.Second); err != nil {
+		t.Fatal("a peer that stopped reading stayed connected")
+	}
+}
@@ -0,0 +1,143 @@
+package ws
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"talkie/backend/internal/metrics"
+
+	"github.com/google/uuid"
+)
+
+// A socket whose peer stopped reading without closing keeps its write pump
+// blocked until TCP gives up, which can take many minutes, and until then the
+// hub still lists it, including as a call participant. The reaper closes
+// sockets that have not completed a write, data or ping, for a number of ping
+// periods, and reconciles call state with the sockets actually in calls.
+
+var reapedSockets = metrics.NewCounter("talkie_ws_reaped_total", "Sockets closed by the reaper for not completing a write in time.")
+
+// wrote records a completed write for the reaper.
+func (c *Client) wrote() { c.lastWrite.Store(c.Hub.now().UnixNano()) }
+
+// wrote records a completed write for the reaper.
+func (c *NotificationClient) wrote() { c.lastWrite.Store(c.Hub.now().UnixNano()) }
+
+// RunReaper checks every ping period for sockets that have missed
+// missedPings ping periods' worth of writes until ctx is done. A
+// missedPings of zero or less disables it.
+func (h *Hub) RunReaper(ctx context.Context, missedPings int) {
+	if missedPings <= 0 {
+		return
+	}
+	maxIdle := time.Duration(missedPings) * pingPeriod
+	ticker := h.newTicker(pingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.Chan():
+			h.reap(now, maxIdle)
+		}
+	}
+}
+
+// ReapNow runs one reaper pass at the hub clock's current time, as
+// RunReaper does every ping period. Tests call it after advancing the clock.
+func (h *Hub) ReapNow(missedPings int) {
+	if missedPings > 0 {
+		h.reap(h.now(), time.Duration(missedPings)*pingPeriod)
+	}
+}
+
+func (h *Hub) reap(now time.Time, maxIdle time.Duration) {
+	cutoff := now.Add(-maxIdle).UnixNano()
+	h.mu.RLock()
+	var staleRooms []*Client
+	for _, clients := range h.rooms {
+		for c := range clients {
+			if c.lastWrite.Load() < cutoff {
+				staleRooms = append(staleRooms, c)
+			}
+		}
+	}
+	var staleEvents []*NotificationClient
+	for _, clients := range h.userEvents {
+		for c := range clients {
+			if c.lastWrite.Load() < cutoff {
+				staleEvents = append(staleEvents, c)
+			}
+		}
+	}
+	h.mu.RUnlock()
+
+	changed := h.reconcileCalls()
+	// Removing the socket here rather than waiting for its read pump to
+	// notice the close takes it out of the call at once.
+	for _, c := range staleRooms {
+		h.Remove(c)
+		c.Close()
+		changed[c.RoomID] = struct{}{}
+	}
+	for _, c := range staleEvents {
+		h.RemoveUserEvents(c)
+		c.Close()
+	}
+	for roomID := range changed {
+		h.Broadcast(roomID, CallParticipantsEvent{CallUsers: h.CallParticipants(roomID)})
+	}
+
+	if n := len(staleRooms) + len(staleEvents); n > 0 {
+		reapedSockets.Add(int64(n))
+		log.Printf("ws reaper: closed %d room and %d event sockets with no completed write in %s", len(staleRooms), len(staleEvents), maxIdle)
+	}
+}
+
+// reconcileCalls rebuilds call membership from the sockets marked as in a
+// call and returns the rooms whose participants changed. It should find
+// nothing; a drift means a socket left without going through Remove or
+// SetInCall.
+func (h *Hub) reconcileCalls() map[uuid.UUID]struct{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	actual := make(map[uuid.UUID]map[uuid.UUID]int)
+	for roomID, clients := range h.rooms {
+		for c := range clients {
+			if !c.inCall {
+				continue
+			}
+			if actual[roomID] == nil {
+				actual[roomID] = make(map[uuid.UUID]int)
+			}
+			actual[roomID][c.UserID]++
+		}
+	}
+
+	changed := make(map[uuid.UUID]struct{})
+	for roomID, counts := range h.callCounts {
+		for userID, n := range counts {
+			if actual[roomID][userID] == n {
+				continue
+			}
+			changed[roomID] = struct{}{}
+			for ; n > actual[roomID][userID]; n-- {
+				h.removeCallLocked(roomID, userID)
+			}
+		}
+	}
+	for roomID, users := range actual {
+		for c := range h.rooms[roomID] {
+			if c.inCall && h.callCounts[roomID][c.UserID] < users[c.UserID] {
+				changed[roomID] = struct{}{}
+				h.addCallLocked(roomID, c.UserID, c.Username, c.AvatarURL)
+			}
+		}
+	}
+	if len(changed) > 0 {
+		log.Printf("ws reaper: reconciled call state in %d rooms", len(changed))
+	}
+	return changed
+}
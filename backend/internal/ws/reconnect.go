@@ -0,0 +1,50 @@
+package ws
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// ReconnectDelay picks a uniformly jittered delay in [min, max) so a fleet of
+// clients disconnected at the same moment spreads its reconnects out.
+func ReconnectDelay(min, max time.Duration) time.Duration {
+	if max <= min {
+		return min
+	}
+	return min + time.Duration(rand.Int63n(int64(max-min)))
+}
+
+// ReconnectReason encodes the delay as a close-frame reason. Clients parse it
+// as JSON and wait retry_after_ms before reconnecting.
+func ReconnectReason(delay time.Duration) string {
+	return fmt.Sprintf(`{"retry_after_ms":%d}`, delay.Milliseconds())
+}
+
+// CloseAll disconnects every socket, giving each one its own jittered
+// reconnect delay. It is used on shutdown so a deploy does not trigger a
+// synchronized reconnect storm against the next instance.
+func (h *Hub) CloseAll(code int, minDelay, maxDelay time.Duration) int {
+	h.mu.RLock()
+	roomClients := make([]*Client, 0)
+	for _, clients := range h.rooms {
+		for c := range clients {
+			roomClients = append(roomClients, c)
+		}
+	}
+	eventClients := make([]*NotificationClient, 0)
+	for _, clients := range h.userEvents {
+		for c := range clients {
+			eventClients = append(eventClients, c)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, c := range roomClients {
+		c.CloseWithReason(code, ReconnectReason(ReconnectDelay(minDelay, maxDelay)))
+	}
+	for _, c := range eventClients {
+		c.CloseWithReason(code, ReconnectReason(ReconnectDelay(minDelay, maxDelay)))
+	}
+	return len(roomClients) + len(eventClients)
+}
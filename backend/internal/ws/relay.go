@@ -0,0 +1,137 @@
+package ws
+
+import (
+	"encoding/json"
+	"log"
+
+	"talkie/backend/internal/broadcast"
+	"talkie/backend/internal/history"
+	"talkie/backend/internal/metrics"
+
+	"github.com/google/uuid"
+)
+
+var rejectedRemoteEvents = metrics.NewCounter("talkie_ws_remote_events_rejected_total", "Events relayed from another instance that failed schema validation and were dropped.")
+
+// SetBroadcastBackend makes the hub publish every routed event to other
+// instances. Without a backend the hub only serves its own connections.
+func (h *Hub) SetBroadcastBackend(b broadcast.Backend) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.backend = b
+}
+
+// SetRemoteValidator makes the hub check events relayed from other
+// instances with validate before delivering them, dropping those it
+// rejects. Instances of different versions share the backend during a
+// rolling deploy, so this is where an event that does not match its schema
+// would first show up.
+func (h *Hub) SetRemoteValidator(validate func(payload []byte) error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.validate = validate
+}
+
+// SetHistoryCache gives the hub the history cache to invalidate when
+// another instance relays a room's new or changed message, which this
+// instance never saw saved.
+func (h *Hub) SetHistoryCache(c *history.Cache) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.history = c
+}
+
+// changesHistory reports whether an event of type t carries a saved
+// message, so a cached tail of its room may be stale.
+func changesHistory(t string) bool {
+	switch t {
+	case "chat", "call_chat", "message_updated", "room_message_event":
+		return true
+	}
+	return false
+}
+
+func (h *Hub) Broadcast(roomID uuid.UUID, event Event) {
+	payload := event.Envelope()
+	h.broadcastLocal(roomID, payload)
+	h.publish(broadcast.KindRoom, roomID, uuid.Nil, payload)
+}
+
+// SendToRoomUser delivers event only to userID's connections in roomID.
+// It is the routing primitive for ephemeral messages, which are never persisted
+// and must not leak to other room members.
+func (h *Hub) SendToRoomUser(roomID, userID uuid.UUID, event Event) {
+	payload := event.Envelope()
+	h.sendToRoomUserLocal(roomID, userID, payload)
+	h.publish(broadcast.KindRoomUser, roomID, userID, payload)
+}
+
+func (h *Hub) BroadcastUser(userID uuid.UUID, event Event) {
+	payload := event.Envelope()
+	h.broadcastUserLocal(userID, payload)
+	h.publish(broadcast.KindUserEvents, uuid.Nil, userID, payload)
+}
+
+// SendToUser delivers event to every live connection of userID: room
+// sockets in any room plus the user-level events socket.
+func (h *Hub) SendToUser(userID uuid.UUID, event Event) {
+	payload := event.Envelope()
+	h.sendToUserLocal(userID, payload)
+	h.publish(broadcast.KindUser, uuid.Nil, userID, payload)
+}
+
+// DeliverRemote hands an event published by another instance to this
+// instance's connections. It never republishes.
+func (h *Hub) DeliverRemote(msg broadcast.Message) {
+	h.mu.RLock()
+	validate := h.validate
+	cache := h.history
+	h.mu.RUnlock()
+	if validate != nil {
+		if err := validate(msg.Payload); err != nil {
+			rejectedRemoteEvents.Inc()
+			log.Printf("drop remote event from %s: %v", msg.Origin, err)
+			return
+		}
+	}
+	var payload OutgoingMessage
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		log.Printf("decode remote event failed: %v", err)
+		return
+	}
+	// Sequence numbers are assigned per instance on local delivery.
+	payload.Seq = 0
+	if msg.RoomID != uuid.Nil && changesHistory(payload.Type) {
+		// Reload the room's tail on next read rather than append: the
+		// message may be shadowed or an edit of one already cached.
+		cache.Invalidate(msg.RoomID)
+	}
+	switch msg.Kind {
+	case broadcast.KindRoom:
+		h.broadcastLocal(msg.RoomID, payload)
+	case broadcast.KindRoomUser:
+		h.sendToRoomUserLocal(msg.RoomID, msg.UserID, payload)
+	case broadcast.KindUserEvents:
+		h.broadcastUserLocal(msg.UserID, payload)
+	case broadcast.KindUser:
+		h.sendToUserLocal(msg.UserID, payload)
+	case broadcast.KindChannel:
+		h.broadcastChannelLocal(msg.RoomID, payload)
+	}
+}
+
+func (h *Hub) publish(kind string, roomID, userID uuid.UUID, payload OutgoingMessage) {
+	h.mu.RLock()
+	backend := h.backend
+	h.mu.RUnlock()
+	if backend == nil {
+		return
+	}
+	payload.Seq = 0
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("encode event for broadcast failed: %v", err)
+		return
+	}
+	backend.Publish(broadcast.Message{Kind: kind, RoomID: roomID, UserID: userID, Payload: data})
+}
@@ -0,0 +1,39 @@
+package ws
+
+import "github.com/google/uuid"
+
+// Room-wide events carry a per-room sequence number so clients can tell when
+// they missed or reordered one. Targeted events (SendToRoomUser, SendToUser)
+// are not sequenced: they are not seen by the whole room.
+//
+// seqMu is held while an event is numbered and queued on its room's fan-out
+// worker, so the order events land in each client's Send channel matches
+// their sequence numbers.
+
+// Sequence returns the sequence number of the last event broadcast to roomID.
+func (h *Hub) Sequence(roomID uuid.UUID) uint64 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.seqs[roomID]
+}
+
+// SendStateSync queues a "state_sync" snapshot for c: the room's current
+// sequence number, members and call participants. Every later broadcast has
+// a higher sequence number and is queued after the snapshot, so a client can
+// apply it and continue from Seq without missing anything.
+func (h *Hub) SendStateSync(c *Client, participants []Participant) {
+	h.seqMu.Lock()
+	defer h.seqMu.Unlock()
+
+	h.mu.RLock()
+	seq := h.seqs[c.RoomID]
+	h.mu.RUnlock()
+
+	msg := StateSyncEvent{
+		Seq:          seq,
+		RoomID:       c.RoomID.String(),
+		Participants: participants,
+		CallUsers:    h.CallParticipants(c.RoomID),
+	}
+	h.fanout.submit(c.RoomID, []*Client{c}, msg.Envelope())
+}
@@ -0,0 +1,11 @@
+package ws
+
+import "github.com/google/uuid"
+
+// RevokeSessions tells every live connection of userID that its session has
+// ended. Clients still holding a token at or above version may reconnect;
+// version 0 signs out everywhere. The write pumps close each socket right
+// after the event so a stolen token cannot keep an open socket alive.
+func (h *Hub) RevokeSessions(userID uuid.UUID, version int) {
+	h.SendToUser(userID, SessionRevokedEvent{SessionVersion: version})
+}
@@ -0,0 +1,50 @@
+package ws
+
+import "github.com/google/uuid"
+
+// LiveKit only reports who is talking to participants of the media session,
+// and its webhooks carry no speaker events. Members in the call report their
+// own speaking state over the room socket instead, and the hub relays changes
+// to the room's sockets that are not in the call.
+
+// SetSpeaking records whether c's user is speaking and reports whether that
+// changed. Only members in the call can speak; LiveKit's speaker detection
+// flaps, so unchanged reports are dropped rather than relayed.
+func (h *Hub) SetSpeaking(c *Client, speaking bool) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.callUsers[c.RoomID][c.UserID]; !ok {
+		return false
+	}
+	talking := h.speakers[c.RoomID]
+	if _, was := talking[c.UserID]; was == speaking {
+		return false
+	}
+	if !speaking {
+		delete(talking, c.UserID)
+		if len(talking) == 0 {
+			delete(h.speakers, c.RoomID)
+		}
+		return true
+	}
+	if talking == nil {
+		talking = make(map[uuid.UUID]struct{})
+		h.speakers[c.RoomID] = talking
+	}
+	talking[c.UserID] = struct{}{}
+	return true
+}
+
+// SpeakingMessage tells members outside the call that userID started or
+// stopped speaking. Clients drop speakers who leave the call when the next
+// call_participants event arrives.
+func SpeakingMessage(roomID, userID uuid.UUID, speaking bool) SpeakingEvent {
+	return SpeakingEvent{RoomID: roomID.String(), UserID: userID.String(), Speaking: speaking}
+}
+
+func (c *Client) reportSpeaking(speaking bool) {
+	if !c.InCall || !c.Hub.SetSpeaking(c, speaking) {
+		return
+	}
+	c.Hub.Broadcast(c.RoomID, SpeakingMessage(c.RoomID, c.UserID, speaking))
+}
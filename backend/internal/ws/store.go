@@ -0,0 +1,31 @@
+package ws
+
+import (
+	"context"
+	"time"
+
+	"talkie/backend/internal/db"
+
+	"github.com/google/uuid"
+)
+
+// Store is the persistence the WebSocket layer needs. *db.Store implements
+// it; dbtest.Store is an in-memory stand-in for tests.
+type Store interface {
+	ListRoomMembers(ctx context.Context, roomID uuid.UUID) ([]db.RoomMember, error)
+	SaveMessage(ctx context.Context, roomID, userID uuid.UUID, content string, clientSentAt *time.Time) (db.Message, error)
+	ListMessages(ctx context.Context, roomID uuid.UUID, limit int) ([]db.Message, error)
+	ListMessagesBefore(ctx context.Context, roomID uuid.UUID, beforeID int64, limit int) ([]db.Message, error)
+	ListDeletedMessageIDs(ctx context.Context, roomID uuid.UUID, fromID, beforeID int64, limit int) ([]int64, error)
+
+	MarkRoomRead(ctx context.Context, roomID, userID uuid.UUID, messageID int64) (int64, error)
+	GetUnreadState(ctx context.Context, roomID, userID uuid.UUID) (int, *int64, error)
+	MarkRoomDelivered(ctx context.Context, roomID, userID uuid.UUID, messageID int64) (bool, error)
+	ListDeliveryPointers(ctx context.Context, roomID uuid.UUID) ([]db.DeliveryPointer, error)
+
+	IsRoomAdmin(ctx context.Context, roomID, userID uuid.UUID) (bool, error)
+	GetRoomMentionPolicy(ctx context.Context, roomID uuid.UUID) (string, error)
+
+	GetRoomPersistCallChat(ctx context.Context, roomID uuid.UUID) (bool, error)
+	SaveMessagesBatch(ctx context.Context, roomID uuid.UUID, msgs []db.NewMessage) ([]db.Message, error)
+}
@@ -1,33 +1,135 @@
 package ws
 
 import (
+	"encoding/json"
 	"talkie/backend/internal/db"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 type IncomingMessage struct {
-	Type    string `json:"type"`
-	Content string `json:"content"`
+	Type      string `json:"type"`
+	Content   string `json:"content"`
+	Before    int64  `json:"before,omitempty"`
+	Limit     int    `json:"limit,omitempty"`
+	MessageID int64  `json:"message_id,omitempty"`
+	// Speaking is a call member's own voice activity, sent with "speaking".
+	Speaking bool `json:"speaking,omitempty"`
+	// Signal, SDP and Candidate are a "p2p_signal" frame; see
+	// P2PSignalEvent.
+	Signal    string          `json:"signal,omitempty"`
+	SDP       string          `json:"sdp,omitempty"`
+	Candidate json.RawMessage `json:"candidate,omitempty"`
+
+	// ClientSentAt is when a chat message was composed on the device,
+	// which may be long before it is sent for messages queued offline.
+	ClientSentAt *time.Time `json:"client_sent_at,omitempty"`
+	// ClientTime is the device clock in Unix milliseconds, sent with
+	// "ping" and echoed back in the "pong".
+	ClientTime int64 `json:"client_time,omitempty"`
 }
 
+// OutgoingMessage is the wire envelope of every server event: one struct
+// whose fields are the union of all events' fields, decoded as-is by
+// clients and relayed between instances. Build events as the typed values
+// in events.go and let Envelope fill this in.
 type OutgoingMessage struct {
 	Type         string           `json:"type"`
+	Seq          uint64           `json:"seq,omitempty"`
 	Message      *MessagePayload  `json:"message,omitempty"`
 	Participants []Participant    `json:"participants,omitempty"`
 	CallUsers    []Participant    `json:"call_users,omitempty"`
 	Messages     []MessagePayload `json:"messages,omitempty"`
+	HasMore      bool             `json:"has_more,omitempty"`
+	// DeletedMessageIDs are the tombstones of a "history" page.
+	DeletedMessageIDs []int64 `json:"deleted_message_ids,omitempty"`
+
+	RoomID               string `json:"room_id,omitempty"`
+	MessageID            int64  `json:"message_id,omitempty"`
+	UnreadCount          *int   `json:"unread_count,omitempty"`
+	FirstUnreadMessageID *int64 `json:"first_unread_message_id,omitempty"`
+
+	UserID        string `json:"user_id,omitempty"`
+	DeliveredUpTo int64  `json:"delivered_up_to,omitempty"`
+	ReadUpTo      int64  `json:"read_up_to,omitempty"`
+	Speaking      *bool  `json:"speaking,omitempty"`
+	CallID        string `json:"call_id,omitempty"`
+
+	Notification *db.Notification `json:"notification,omitempty"`
+
+	SessionVersion int `json:"session_version,omitempty"`
+
+	// Change and MemberCount describe a room_membership_event.
+	Change      string `json:"change,omitempty"`
+	MemberCount *int   `json:"member_count,omitempty"`
+
+	Online *bool `json:"online,omitempty"`
+	// RichPresence is what users are doing, on presence_state and
+	// rich_presence.
+	RichPresence []db.RichPresence `json:"rich_presence,omitempty"`
+
+	// Code, Error and MaxLength describe an "error" event sent to one
+	// socket about a frame it sent.
+	Code      string `json:"code,omitempty"`
+	Error     string `json:"error,omitempty"`
+	MaxLength int    `json:"max_length,omitempty"`
+
+	Rooms []RoomState `json:"rooms,omitempty"`
+
+	// BoardItem and BoardItemID describe a board_event: the item added or
+	// updated, or the id of the one removed. A reorder carries neither.
+	BoardItem   *db.BoardItem `json:"board_item,omitempty"`
+	BoardItemID int64         `json:"board_item_id,omitempty"`
+
+	// Signal, SDP and Candidate describe a p2p_signal.
+	Signal    string          `json:"signal,omitempty"`
+	SDP       string          `json:"sdp,omitempty"`
+	Candidate json.RawMessage `json:"candidate,omitempty"`
+
+	// ClientTime and ServerTime are a pong's clocks, in Unix milliseconds.
+	ClientTime int64 `json:"client_time,omitempty"`
+	ServerTime int64 `json:"server_time,omitempty"`
 }
 
 type MessagePayload struct {
-	ID          int64     `json:"id"`
-	RoomID      string    `json:"room_id"`
-	UserID      string    `json:"user_id"`
-	Username    string    `json:"username"`
-	AvatarURL   string    `json:"avatar_url,omitempty"`
-	Content     string    `json:"content"`
-	MessageType string    `json:"message_type"`
-	MediaURL    string    `json:"media_url,omitempty"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID          int64  `json:"id"`
+	RoomID      string `json:"room_id"`
+	UserID      string `json:"user_id"`
+	Username    string `json:"username"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+	Content     string `json:"content"`
+	MessageType string `json:"message_type"`
+	MediaURL    string `json:"media_url,omitempty"`
+	Ephemeral   bool   `json:"ephemeral,omitempty"`
+	NSFW        bool   `json:"nsfw,omitempty"`
+	// Withheld is set when the media of an NSFW message was removed for a
+	// recipient who opted out of NSFW content.
+	Withheld bool `json:"withheld,omitempty"`
+	// Audio carries a voice note's waveform and duration.
+	Audio *db.AudioInfo `json:"audio,omitempty"`
+	// Components are a command reply's buttons and select menus.
+	Components []db.Component `json:"components,omitempty"`
+	// Contact is the profile a "contact" message shares.
+	Contact *db.ContactCard `json:"contact,omitempty"`
+	// AltText describes an image for screen readers; AltTextGenerated
+	// says a vision model wrote it.
+	AltText          string `json:"alt_text,omitempty"`
+	AltTextGenerated bool   `json:"alt_text_generated,omitempty"`
+	// Lang and Dir are the detected language of the content and its text
+	// direction, so clients can lay out right-to-left messages.
+	Lang string `json:"lang,omitempty"`
+	Dir  string `json:"dir,omitempty"`
+	// ContentMasked is the content with the room's masked words starred
+	// out. Only room admins' sockets keep the original in Content.
+	ContentMasked string `json:"content_masked,omitempty"`
+
+	DeliveryState string `json:"delivery_state,omitempty"`
+
+	CreatedAt    time.Time  `json:"created_at"`
+	ClientSentAt *time.Time `json:"client_sent_at,omitempty"`
+	// EditedAt is set in history when the content was changed.
+	EditedAt *time.Time `json:"edited_at,omitempty"`
 }
 
 type Participant struct {
@@ -36,6 +138,14 @@ type Participant struct {
 	AvatarURL string `json:"avatar_url,omitempty"`
 }
 
+func ParticipantsFromMembers(members []db.RoomMember) []Participant {
+	participants := make([]Participant, 0, len(members))
+	for _, m := range members {
+		participants = append(participants, Participant{ID: m.ID.String(), Username: m.Username, AvatarURL: m.AvatarURL})
+	}
+	return participants
+}
+
 func PayloadFromMessage(m db.Message) MessagePayload {
 	return MessagePayload{
 		ID:          m.ID,
@@ -46,6 +156,65 @@ func PayloadFromMessage(m db.Message) MessagePayload {
 		Content:     m.Content,
 		MessageType: m.MessageType,
 		MediaURL:    m.MediaURL,
+		NSFW:        m.NSFW,
+		Audio:       m.Audio,
+		Components:  m.Components,
+		Contact:     m.Contact,
+		AltText:     m.AltText,
+		Lang:        m.Lang,
+		Dir:         m.Dir,
 		CreatedAt:   m.CreatedAt,
+
+		ContentMasked:    m.ContentMasked,
+		AltTextGenerated: m.AltTextGenerated,
+
+		ClientSentAt:  m.ClientSentAt,
+		EditedAt:      m.EditedAt,
+		DeliveryState: m.DeliveryState,
+	}
+}
+
+// HistoryMessage wraps a page of messages, oldest first, and the IDs of
+// messages deleted within it as a "history" event.
+func HistoryMessage(messages []db.Message, deleted []int64, hasMore bool) HistoryEvent {
+	payload := make([]MessagePayload, 0, len(messages))
+	for _, m := range messages {
+		payload = append(payload, PayloadFromMessage(m))
+	}
+	return HistoryEvent{Messages: payload, DeletedMessageIDs: deleted, HasMore: hasMore}
+}
+
+// ResumeMessage wraps a room's messages changed since a sync token as a
+// "resume" event.
+func ResumeMessage(roomID uuid.UUID, messages []db.Message, hasMore bool) ResumeEvent {
+	payload := make([]MessagePayload, 0, len(messages))
+	for _, m := range messages {
+		payload = append(payload, PayloadFromMessage(m))
+	}
+	return ResumeEvent{RoomID: roomID.String(), Messages: payload, HasMore: hasMore}
+}
+
+// EphemeralMessage builds an unpersisted "ephemeral" event. It carries no
+// message ID or author so clients render it as a system notice.
+func EphemeralMessage(roomID uuid.UUID, content string) EphemeralEvent {
+	return EphemeralEvent{
+		Message: MessagePayload{
+			RoomID:      roomID.String(),
+			Content:     content,
+			MessageType: "system",
+			Ephemeral:   true,
+			CreatedAt:   time.Now().UTC(),
+		},
+	}
+}
+
+// UnreadMessage reports a member's read state for a room. It is sent on
+// connect and to the member's other devices whenever the pointer moves.
+func UnreadMessage(roomID uuid.UUID, lastRead int64, unread int, firstUnread *int64) UnreadEvent {
+	return UnreadEvent{
+		RoomID:               roomID.String(),
+		MessageID:            lastRead,
+		UnreadCount:          unread,
+		FirstUnreadMessageID: firstUnread,
 	}
 }
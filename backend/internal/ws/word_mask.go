@@ -0,0 +1,24 @@
+package ws
+
+// WithoutOriginalContent returns m with the content of masked messages
+// replaced by its masked form, for sockets of members who are not room
+// admins. Like WithoutNSFWMedia it copies before changing anything.
+func (m OutgoingMessage) WithoutOriginalContent() OutgoingMessage {
+	if m.Message != nil && m.Message.ContentMasked != "" {
+		p := *m.Message
+		p.Content = p.ContentMasked
+		m.Message = &p
+	}
+	copied := false
+	for i, p := range m.Messages {
+		if p.ContentMasked == "" {
+			continue
+		}
+		if !copied {
+			m.Messages = append([]MessagePayload(nil), m.Messages...)
+			copied = true
+		}
+		m.Messages[i].Content = p.ContentMasked
+	}
+	return m
+}
@@ -0,0 +1,157 @@
+// Package wstest provides a fake clock and an in-memory connection for
+// driving ws.Hub sockets in tests: ping and read deadlines, the reaper and
+// call timings follow the Clock, which only moves when Advance is called,
+// and a Conn records what the server wrote and can stop accepting writes
+// like a peer that stopped reading.
+package wstest
+
+import (
+	"sync"
+	"time"
+
+	"talkie/backend/internal/ws"
+)
+
+// Clock is a ws.Clock that only moves when told to.
+type Clock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*ticker
+	waiters []waiter
+}
+
+type waiter struct {
+	at   time.Time
+	done chan struct{}
+}
+
+var _ ws.Clock = (*Clock)(nil)
+
+// NewClock returns a Clock reading start.
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTicker returns a ticker that fires every d of Advance. Like
+// time.Ticker it holds one tick and drops the ones a slow reader misses.
+func (c *Clock) NewTicker(d time.Duration) ws.Ticker {
+	if d <= 0 {
+		panic("wstest: non-positive ticker period")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &ticker{clock: c, period: d, next: c.now.Add(d), ch: make(chan time.Time, 1)}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+// Advance moves the clock forward by d, firing tickers and deadlines in
+// order as it passes them.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	target := c.now.Add(d)
+	for {
+		at, ok := c.nextLocked(target)
+		if !ok {
+			break
+		}
+		c.now = at
+		for _, t := range c.tickers {
+			if !t.next.After(at) {
+				select {
+				case t.ch <- at:
+				default:
+				}
+				t.next = t.next.Add(t.period)
+			}
+		}
+		kept := c.waiters[:0]
+		for _, w := range c.waiters {
+			if w.at.After(at) {
+				kept = append(kept, w)
+				continue
+			}
+			close(w.done)
+		}
+		c.waiters = kept
+	}
+	c.now = target
+}
+
+// WaitPending waits up to timeout of real time until at least n tickers
+// and deadlines are waiting on the clock, so a test knows the pumps it
+// started are parked before it calls Advance.
+func (c *Clock) WaitPending(n int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		c.mu.Lock()
+		pending := len(c.tickers) + len(c.waiters)
+		c.mu.Unlock()
+		if pending >= n {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// nextLocked returns the earliest tick or deadline not after target.
+func (c *Clock) nextLocked(target time.Time) (time.Time, bool) {
+	var next time.Time
+	found := false
+	consider := func(t time.Time) {
+		if !t.After(target) && (!found || t.Before(next)) {
+			next, found = t, true
+		}
+	}
+	for _, t := range c.tickers {
+		consider(t.next)
+	}
+	for _, w := range c.waiters {
+		consider(w.at)
+	}
+	return next, found
+}
+
+// until returns a channel closed once the clock reaches at.
+func (c *Clock) until(at time.Time) <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	done := make(chan struct{})
+	if !c.now.Before(at) {
+		close(done)
+		return done
+	}
+	c.waiters = append(c.waiters, waiter{at: at, done: done})
+	return done
+}
+
+type ticker struct {
+	clock  *Clock
+	period time.Duration
+	next   time.Time
+	ch     chan time.Time
+}
+
+func (t *ticker) Chan() <-chan time.Time { return t.ch }
+
+func (t *ticker) Stop() {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, x := range c.tickers {
+		if x == t {
+			c.tickers = append(c.tickers[:i], c.tickers[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package wstest_test
+
+import (
+	"testing"
+	"time"
+
+	"talkie/backend/internal/ws/wstest"
+)
+
+func TestTickerFiresPerPeriodAndDropsMissedTicks(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := wstest.NewClock(start)
+	ticker := clock.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	clock.Advance(9 * time.Second)
+	select {
+	case at := <-ticker.Chan():
+		t.Fatalf("ticked at %v before its period", at)
+	default:
+	}
+
+	clock.Advance(31 * time.Second)
+	select {
+	case at := <-ticker.Chan():
+		if want := start.Add(10 * time.Second); !at.Equal(want) {
+			t.Fatalf("tick at %v, want %v", at, want)
+		}
+	default:
+		t.Fatal("no tick after the period passed")
+	}
+	select {
+	case at := <-ticker.Chan():
+		t.Fatalf("missed tick at %v was kept", at)
+	default:
+	}
+	if got, want := clock.Now(), start.Add(40*time.Second); !got.Equal(want) {
+		t.Fatalf("now = %v, want %v", got, want)
+	}
+}
+
+func TestBlockedWriteTimesOutOnDeadline(t *testing.T) {
+	clock := wstest.NewClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	conn := wstest.NewConn(clock)
+	conn.Block()
+	_ = conn.SetWriteDeadline(clock.Now().Add(10 * time.Second))
+
+	done := make(chan error, 1)
+	go func() { done <- conn.WriteJSON(map[string]string{"type": "chat"}) }()
+	if !clock.WaitPending(1, 2*time.Second) {
+		t.Fatal("write never waited on its deadline")
+	}
+	clock.Advance(10 * time.Second)
+	select {
+	case err := <-done:
+		if err != wstest.ErrTimeout {
+			t.Fatalf("write = %v, want ErrTimeout", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("blocked write did not time out")
+	}
+	if len(conn.Frames()) != 0 {
+		t.Fatal("a timed-out write was recorded")
+	}
+
+	conn.Unblock()
+	if err := conn.WriteJSON(map[string]string{"type": "chat"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(conn.Frames()) != 1 {
+		t.Fatalf("frames = %d after unblocking, want 1", len(conn.Frames()))
+	}
+}
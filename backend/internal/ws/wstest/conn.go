@@ -0,0 +1,311 @@
+package wstest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"talkie/backend/internal/ws"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrTimeout is returned by reads and writes whose deadline the clock
+// passed.
+var ErrTimeout error = timeoutError{}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "wstest: i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var _ net.Error = timeoutError{}
+
+// Frame is one frame the server wrote.
+type Frame struct {
+	Type int
+	Data []byte
+}
+
+// Conn is an in-memory ws.Conn. The test plays the peer: Send and Pong
+// feed the server's read pump, and Frames shows what its write pump wrote.
+type Conn struct {
+	clock *Clock
+	in    chan []byte
+
+	mu            sync.Mutex
+	closed        chan struct{}
+	isClosed      bool
+	peerClosed    *websocket.CloseError
+	readDeadline  time.Time
+	writeDeadline time.Time
+	readLimit     int64
+	pong          func(string) error
+	frames        []Frame
+	wroteFrame    chan struct{}
+	blocked       chan struct{}
+}
+
+var _ ws.Conn = (*Conn)(nil)
+
+// NewConn returns an open Conn whose deadlines follow clock.
+func NewConn(clock *Clock) *Conn {
+	return &Conn{
+		clock:      clock,
+		in:         make(chan []byte, 64),
+		closed:     make(chan struct{}),
+		wroteFrame: make(chan struct{}),
+	}
+}
+
+// Send queues v as a JSON text frame from the peer.
+func (c *Conn) Send(v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	c.in <- data
+}
+
+// Pong answers a ping as a live peer would, running the pong handler.
+func (c *Conn) Pong() error {
+	c.mu.Lock()
+	h := c.pong
+	c.mu.Unlock()
+	if h == nil {
+		return nil
+	}
+	return h("")
+}
+
+// Hangup closes the connection from the peer's side with a normal close.
+func (c *Conn) Hangup() {
+	c.mu.Lock()
+	c.peerClosed = &websocket.CloseError{Code: websocket.CloseNormalClosure}
+	c.mu.Unlock()
+	_ = c.Close()
+}
+
+// Block makes writes wait, like a peer that stopped reading, until Unblock,
+// Close or the write deadline.
+func (c *Conn) Block() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.blocked == nil {
+		c.blocked = make(chan struct{})
+	}
+}
+
+// Unblock releases writes held by Block.
+func (c *Conn) Unblock() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.blocked != nil {
+		close(c.blocked)
+		c.blocked = nil
+	}
+}
+
+// Closed reports whether either side closed the connection.
+func (c *Conn) Closed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.isClosed
+}
+
+// Frames returns the frames written so far.
+func (c *Conn) Frames() []Frame {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Frame(nil), c.frames...)
+}
+
+// Events decodes the text frames written so far, unpacking batched
+// frames.
+func (c *Conn) Events() ([]ws.OutgoingMessage, error) {
+	var events []ws.OutgoingMessage
+	for _, f := range c.Frames() {
+		if f.Type != websocket.TextMessage {
+			continue
+		}
+		if bytes.HasPrefix(f.Data, []byte("[")) {
+			var batch []ws.OutgoingMessage
+			if err := json.Unmarshal(f.Data, &batch); err != nil {
+				return nil, err
+			}
+			events = append(events, batch...)
+			continue
+		}
+		var e ws.OutgoingMessage
+		if err := json.Unmarshal(f.Data, &e); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// WaitFrames waits up to timeout of real time for at least n frames to
+// have been written, and returns them.
+func (c *Conn) WaitFrames(n int, timeout time.Duration) ([]Frame, bool) {
+	deadline := time.After(timeout)
+	for {
+		c.mu.Lock()
+		if len(c.frames) >= n {
+			frames := append([]Frame(nil), c.frames...)
+			c.mu.Unlock()
+			return frames, true
+		}
+		wrote := c.wroteFrame
+		c.mu.Unlock()
+		select {
+		case <-wrote:
+		case <-deadline:
+			return c.Frames(), false
+		}
+	}
+}
+
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	for {
+		c.mu.Lock()
+		deadline, limit := c.readDeadline, c.readLimit
+		c.mu.Unlock()
+		var expired <-chan struct{}
+		if !deadline.IsZero() {
+			expired = c.clock.until(deadline)
+		}
+		select {
+		case data := <-c.in:
+			if limit > 0 && int64(len(data)) > limit {
+				_ = c.Close()
+				return 0, nil, websocket.ErrReadLimit
+			}
+			return websocket.TextMessage, data, nil
+		case <-c.closed:
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if c.peerClosed != nil {
+				return 0, nil, c.peerClosed
+			}
+			return 0, nil, net.ErrClosed
+		case <-expired:
+			// The pong handler may have pushed the deadline out while
+			// this read waited.
+			c.mu.Lock()
+			passed := !c.readDeadline.After(c.clock.Now())
+			c.mu.Unlock()
+			if passed {
+				return 0, nil, ErrTimeout
+			}
+		}
+	}
+}
+
+func (c *Conn) ReadJSON(v any) error {
+	_, data, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (c *Conn) WriteJSON(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(websocket.TextMessage, data)
+}
+
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	c.mu.Lock()
+	deadline, blocked := c.writeDeadline, c.blocked
+	c.mu.Unlock()
+	return c.write(messageType, data, deadline, blocked)
+}
+
+func (c *Conn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	c.mu.Lock()
+	blocked := c.blocked
+	c.mu.Unlock()
+	return c.write(messageType, data, deadline, blocked)
+}
+
+func (c *Conn) write(messageType int, data []byte, deadline time.Time, blocked chan struct{}) error {
+	if blocked != nil {
+		var expired <-chan struct{}
+		if !deadline.IsZero() {
+			expired = c.clock.until(deadline)
+		}
+		select {
+		case <-blocked:
+		case <-c.closed:
+		case <-expired:
+			return ErrTimeout
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.isClosed {
+		return websocket.ErrCloseSent
+	}
+	c.frames = append(c.frames, Frame{Type: messageType, Data: append([]byte(nil), data...)})
+	close(c.wroteFrame)
+	c.wroteFrame = make(chan struct{})
+	return nil
+}
+
+func (c *Conn) SetReadLimit(limit int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readLimit = limit
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	return nil
+}
+
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeDeadline = t
+	return nil
+}
+
+func (c *Conn) SetPongHandler(h func(appData string) error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pong = h
+}
+
+// Close closes the connection. Blocked reads and writes return.
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.isClosed {
+		c.isClosed = true
+		close(c.closed)
+	}
+	return nil
+}
+
+// ErrNotClosed is returned by WaitClosed when the connection stayed open.
+var ErrNotClosed = errors.New("wstest: connection still open")
+
+// WaitClosed waits up to timeout of real time for the connection to close.
+func (c *Conn) WaitClosed(timeout time.Duration) error {
+	select {
+	case <-c.closed:
+		return nil
+	case <-time.After(timeout):
+		return ErrNotClosed
+	}
+}
@@ -0,0 +1,10 @@
+ALTER TABLE room_members
+  ADD COLUMN IF NOT EXISTS last_read_message_id BIGINT;
+
+-- Existing members start with everything read instead of a flood of
+-- historical unread messages.
+UPDATE room_members rm
+SET last_read_message_id = (
+  SELECT MAX(m.id) FROM messages m WHERE m.room_id = rm.room_id
+)
+WHERE rm.last_read_message_id IS NULL;
@@ -0,0 +1,6 @@
+ALTER TABLE room_members
+  ADD COLUMN IF NOT EXISTS last_delivered_message_id BIGINT;
+
+UPDATE room_members
+SET last_delivered_message_id = last_read_message_id
+WHERE last_delivered_message_id IS NULL;
@@ -0,0 +1,19 @@
+-- Derived data maintained by the background worker (internal/worker), which
+-- tails messages by id using the cursor in worker_cursors.
+ALTER TABLE messages
+  ADD COLUMN IF NOT EXISTS search_vector TSVECTOR;
+
+CREATE INDEX IF NOT EXISTS idx_messages_search_vector ON messages USING GIN (search_vector);
+
+ALTER TABLE room_members
+  ADD COLUMN IF NOT EXISTS unread_count INT NOT NULL DEFAULT 0;
+
+ALTER TABLE rooms
+  ADD COLUMN IF NOT EXISTS last_message_id BIGINT,
+  ADD COLUMN IF NOT EXISTS last_message_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS worker_cursors (
+  name TEXT PRIMARY KEY,
+  position BIGINT NOT NULL DEFAULT 0,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,9 @@
+-- Holds broadcast messages too large for a NOTIFY payload; rows are read by
+-- the other instances right away and cleaned up after a few minutes.
+CREATE TABLE IF NOT EXISTS broadcast_spill (
+  id BIGSERIAL PRIMARY KEY,
+  payload BYTEA NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_broadcast_spill_created_at ON broadcast_spill(created_at);
@@ -0,0 +1,3 @@
+-- Bumped whenever every existing session must stop working (password reset
+-- or change). Tokens carry the version they were issued under.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS session_version INT NOT NULL DEFAULT 0;
@@ -0,0 +1,16 @@
+-- Pending email changes. users.email is only rewritten once the new address
+-- is verified; the old address gets a rollback link that stays valid for a
+-- week, including after the change was applied.
+CREATE TABLE IF NOT EXISTS email_changes (
+  id BIGSERIAL PRIMARY KEY,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  old_email TEXT NOT NULL,
+  new_email TEXT NOT NULL,
+  verify_token_hash TEXT NOT NULL UNIQUE,
+  rollback_token_hash TEXT NOT NULL UNIQUE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  verified_at TIMESTAMPTZ,
+  cancelled_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_changes_user ON email_changes(user_id, created_at DESC);
@@ -0,0 +1,103 @@
+-- Persisted per-room event stream for replay (GET /api/rooms/{id}/events).
+-- Events are written by triggers so every code path that adds messages or
+-- changes membership is covered. rooms.event_seq is the last sequence
+-- number handed out; bumping it row-locks the room, which keeps each room's
+-- sequence gapless and in commit order.
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS event_seq BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS room_events (
+  room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+  seq BIGINT NOT NULL,
+  type TEXT NOT NULL,
+  user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+  message_id BIGINT,
+  data JSONB NOT NULL DEFAULT '{}'::jsonb,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (room_id, seq)
+);
+
+CREATE OR REPLACE FUNCTION record_room_event(p_room UUID, p_type TEXT, p_user UUID, p_message BIGINT, p_data JSONB)
+RETURNS VOID AS $$
+DECLARE
+  next_seq BIGINT;
+BEGIN
+  UPDATE rooms SET event_seq = event_seq + 1 WHERE id = p_room RETURNING event_seq INTO next_seq;
+  -- The room is gone (cascading delete): nothing to record.
+  IF next_seq IS NULL THEN
+    RETURN;
+  END IF;
+  INSERT INTO room_events (room_id, seq, type, user_id, message_id, data)
+  VALUES (p_room, next_seq, p_type, p_user, p_message, COALESCE(p_data, '{}'::jsonb));
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION room_events_on_message() RETURNS TRIGGER AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    -- Shadowed messages are invisible to everyone but their author, so they
+    -- are left out of the shared stream.
+    IF NOT NEW.shadowed THEN
+      PERFORM record_room_event(NEW.room_id, 'message_created', NEW.user_id, NEW.id,
+        jsonb_build_object('content', NEW.content, 'message_type', NEW.message_type, 'media_url', COALESCE(NEW.media_url, '')));
+    END IF;
+    RETURN NULL;
+  ELSIF TG_OP = 'UPDATE' THEN
+    IF NOT NEW.shadowed AND NEW.content IS DISTINCT FROM OLD.content THEN
+      PERFORM record_room_event(NEW.room_id, 'message_edited', NEW.user_id, NEW.id,
+        jsonb_build_object('content', NEW.content));
+    END IF;
+    RETURN NULL;
+  END IF;
+  IF NOT OLD.shadowed THEN
+    PERFORM record_room_event(OLD.room_id, 'message_deleted', OLD.user_id, OLD.id, NULL);
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION room_events_on_member() RETURNS TRIGGER AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    PERFORM record_room_event(NEW.room_id, 'member_joined', NEW.user_id, NULL, jsonb_build_object('role', NEW.role));
+  ELSIF TG_OP = 'UPDATE' THEN
+    IF NEW.role IS DISTINCT FROM OLD.role THEN
+      PERFORM record_room_event(NEW.room_id, 'member_role_changed', NEW.user_id, NULL, jsonb_build_object('role', NEW.role));
+    END IF;
+  ELSE
+    PERFORM record_room_event(OLD.room_id, 'member_left', OLD.user_id, NULL, NULL);
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_room_events_message ON messages;
+CREATE TRIGGER trg_room_events_message
+  AFTER INSERT OR UPDATE OF content OR DELETE ON messages
+  FOR EACH ROW EXECUTE FUNCTION room_events_on_message();
+
+DROP TRIGGER IF EXISTS trg_room_events_member ON room_members;
+CREATE TRIGGER trg_room_events_member
+  AFTER INSERT OR UPDATE OF role OR DELETE ON room_members
+  FOR EACH ROW EXECUTE FUNCTION room_events_on_member();
+
+-- Backfill what can be reconstructed: current members and existing messages,
+-- in time order.
+INSERT INTO room_events (room_id, seq, type, user_id, message_id, data, created_at)
+SELECT room_id,
+       ROW_NUMBER() OVER (PARTITION BY room_id ORDER BY created_at, ord, ref),
+       type, user_id, message_id, data, created_at
+FROM (
+  SELECT room_id, 'member_joined' AS type, user_id, NULL::BIGINT AS message_id,
+         jsonb_build_object('role', role) AS data, joined_at AS created_at, 0 AS ord, 0::BIGINT AS ref
+  FROM room_members
+  UNION ALL
+  SELECT room_id, 'message_created', user_id, id,
+         jsonb_build_object('content', content, 'message_type', message_type, 'media_url', COALESCE(media_url, '')),
+         created_at, 1, id
+  FROM messages
+  WHERE NOT shadowed
+) backfill
+ON CONFLICT DO NOTHING;
+
+UPDATE rooms r
+SET event_seq = COALESCE((SELECT MAX(seq) FROM room_events e WHERE e.room_id = r.id), 0);
@@ -0,0 +1,21 @@
+-- Automatic greeting for new members. welcome_sender is the admin who set
+-- it up; the greeting is posted as them.
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS welcome_mode TEXT NOT NULL DEFAULT 'off';
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS welcome_template TEXT NOT NULL DEFAULT '';
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS welcome_sender UUID REFERENCES users(id) ON DELETE SET NULL;
+
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'rooms_welcome_mode_check') THEN
+    ALTER TABLE rooms ADD CONSTRAINT rooms_welcome_mode_check CHECK (welcome_mode IN ('off', 'room', 'dm'));
+  END IF;
+END;
+$$;
+
+-- One greeting per member per room, even if they leave and come back.
+CREATE TABLE IF NOT EXISTS room_welcomes_sent (
+  room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  sent_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (room_id, user_id)
+);
@@ -0,0 +1,19 @@
+-- Temporary guest accounts. Guests have no usable email or password, only
+-- reach the room their link was for, and are deleted once guest_expires_at
+-- passes.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS guest_expires_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_users_guest_expires
+  ON users(guest_expires_at)
+  WHERE guest_expires_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS guest_invite_links (
+  token_hash TEXT PRIMARY KEY,
+  room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+  created_by UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  guest_days INT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_guest_invite_links_room ON guest_invite_links(room_id);
@@ -0,0 +1,16 @@
+-- Device linking: a signed-in device creates a short-lived code (shown as a
+-- QR code), a new device claims it and polls until the first device approves.
+CREATE TABLE IF NOT EXISTS device_links (
+  id BIGSERIAL PRIMARY KEY,
+  code_hash TEXT UNIQUE NOT NULL,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  claim_hash TEXT,
+  device_name TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  expires_at TIMESTAMPTZ NOT NULL,
+  claimed_at TIMESTAMPTZ,
+  approved_at TIMESTAMPTZ,
+  consumed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_links_user ON device_links(user_id);
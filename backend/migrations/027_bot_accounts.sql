@@ -0,0 +1,3 @@
+-- Bot accounts are ordinary users flagged by an operator. They may post
+-- through the bulk message endpoint.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,3 @@
+-- When the author's device composed a message, as reported by the client
+-- and checked against the server clock. NULL when the client did not say.
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS client_sent_at TIMESTAMPTZ;
@@ -0,0 +1,7 @@
+-- Idempotency keys for messages sent over the REST send path, so a client
+-- retrying a queued message after a lost response does not post it twice.
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS idempotency_key TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_idempotency
+  ON messages(user_id, idempotency_key)
+  WHERE idempotency_key IS NOT NULL;
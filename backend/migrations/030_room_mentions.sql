@@ -0,0 +1,11 @@
+-- Who may use @room and @here in a room: "admins" (default), "members" or
+-- "off", which leaves them as plain text.
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS room_mentions TEXT NOT NULL DEFAULT 'admins';
+
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'rooms_room_mentions_check') THEN
+    ALTER TABLE rooms ADD CONSTRAINT rooms_room_mentions_check CHECK (room_mentions IN ('admins', 'members', 'off'));
+  END IF;
+END;
+$$;
@@ -0,0 +1,38 @@
+-- Per-room auto-moderation. Rules are evaluated against every message
+-- before it is stored; kind decides how config is read and action what
+-- happens on a match.
+CREATE TABLE IF NOT EXISTS automod_rules (
+  id BIGSERIAL PRIMARY KEY,
+  room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+  kind TEXT NOT NULL CHECK (kind IN ('pattern', 'links', 'mentions', 'newcomer')),
+  config JSONB NOT NULL DEFAULT '{}',
+  action TEXT NOT NULL CHECK (action IN ('block', 'delete', 'warn', 'mute')),
+  mute_minutes INT NOT NULL DEFAULT 0,
+  enabled BOOLEAN NOT NULL DEFAULT TRUE,
+  created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_automod_rules_room ON automod_rules(room_id, id);
+
+-- What the rules caught, for room admins to review. Content is kept so a
+-- deleted message can still be judged.
+CREATE TABLE IF NOT EXISTS automod_events (
+  id BIGSERIAL PRIMARY KEY,
+  room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  rule_id BIGINT REFERENCES automod_rules(id) ON DELETE SET NULL,
+  action TEXT NOT NULL,
+  content TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_automod_events_room ON automod_events(room_id, id DESC);
+
+-- Members muted by a rule (or an admin) cannot post until muted_until.
+CREATE TABLE IF NOT EXISTS room_mutes (
+  room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  muted_until TIMESTAMPTZ NOT NULL,
+  PRIMARY KEY (room_id, user_id)
+);
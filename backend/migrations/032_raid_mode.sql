@@ -0,0 +1,12 @@
+-- Raid mode: while on, people arriving through an invite link are queued
+-- as join requests for a room admin to approve instead of joining.
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS raid_mode BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS room_join_requests (
+  room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (room_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_room_join_requests_room ON room_join_requests(room_id, created_at);
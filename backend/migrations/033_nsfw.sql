@@ -0,0 +1,6 @@
+-- NSFW gating. A room flagged NSFW marks every message posted in it; the
+-- upload classifier can mark single images anywhere. Members with
+-- hide_nsfw set are kept out of NSFW rooms and get flagged media withheld.
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS nsfw BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS nsfw BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS hide_nsfw BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,3 @@
+-- Call chat lives only in server memory while a call runs. Rooms that opt in
+-- have the transcript written to their history when the call ends.
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS persist_call_chat BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,17 @@
+-- Ratings members give a call after leaving it. call_id identifies one run
+-- of a room's call; livekit_url and client_version let operators line up
+-- complaints with media clusters and app releases.
+CREATE TABLE IF NOT EXISTS call_feedback (
+    id BIGSERIAL PRIMARY KEY,
+    call_id UUID NOT NULL,
+    room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    rating SMALLINT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    livekit_url TEXT NOT NULL DEFAULT '',
+    client_version TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (call_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_call_feedback_created ON call_feedback (created_at);
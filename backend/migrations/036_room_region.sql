@@ -0,0 +1,3 @@
+-- Data residency. A room tagged with a region keeps new media in that
+-- region's storage and calls through its LiveKit cluster; '' is the default.
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS region TEXT NOT NULL DEFAULT '';
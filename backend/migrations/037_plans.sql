@@ -0,0 +1,14 @@
+-- Plans override the instance-wide quota defaults. A NULL limit inherits
+-- the default; 0 means unlimited. A room follows its workspace's (group's)
+-- plan when the group has one, otherwise its creator's.
+CREATE TABLE IF NOT EXISTS plans (
+    name TEXT PRIMARY KEY,
+    max_rooms INT CHECK (max_rooms >= 0),
+    max_room_members INT CHECK (max_room_members >= 0),
+    max_upload_bytes BIGINT CHECK (max_upload_bytes >= 0),
+    history_days INT CHECK (history_days >= 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS plan TEXT REFERENCES plans(name) ON DELETE SET NULL;
+ALTER TABLE room_groups ADD COLUMN IF NOT EXISTS plan TEXT REFERENCES plans(name) ON DELETE SET NULL;
@@ -0,0 +1,28 @@
+-- Stripe subscriptions for hosted deployments. A subscription belongs to
+-- either a user or a workspace (group), taken from its metadata, and
+-- entitles the owner to the plan its price maps to while it is in good
+-- standing. event_at is the Stripe event time the row reflects, so events
+-- delivered out of order do not roll it back.
+CREATE TABLE IF NOT EXISTS subscriptions (
+    id TEXT PRIMARY KEY,
+    customer_id TEXT NOT NULL,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    group_id UUID REFERENCES room_groups(id) ON DELETE CASCADE,
+    status TEXT NOT NULL,
+    plan TEXT NOT NULL DEFAULT '',
+    current_period_end TIMESTAMPTZ,
+    cancel_at_period_end BOOLEAN NOT NULL DEFAULT FALSE,
+    event_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK ((user_id IS NULL) <> (group_id IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS subscriptions_user_idx ON subscriptions (user_id) WHERE user_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS subscriptions_group_idx ON subscriptions (group_id) WHERE group_id IS NOT NULL;
+
+-- Stripe delivers events at least once; processed ids are remembered so a
+-- redelivery is acknowledged without being applied twice.
+CREATE TABLE IF NOT EXISTS billing_events (
+    id TEXT PRIMARY KEY,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
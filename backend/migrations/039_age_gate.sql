@@ -0,0 +1,5 @@
+-- Date of birth is optional and only collected when the age gate is on.
+-- age_restricted is an admin override of the restriction otherwise derived
+-- from date_of_birth: NULL follows the date, TRUE/FALSE force it.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS date_of_birth DATE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS age_restricted BOOLEAN;
@@ -0,0 +1,13 @@
+-- Extra profile fields defined through the admin API. Fields can also come
+-- from PROFILE_FIELDS, which are not stored here. Values live on users as
+-- a JSON object of strings keyed by field.
+CREATE TABLE IF NOT EXISTS profile_fields (
+    key TEXT PRIMARY KEY,
+    label TEXT NOT NULL,
+    type TEXT NOT NULL,
+    options JSONB NOT NULL DEFAULT '[]',
+    max_length INT NOT NULL DEFAULT 0,
+    position INT NOT NULL DEFAULT 0
+);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS profile JSONB NOT NULL DEFAULT '{}';
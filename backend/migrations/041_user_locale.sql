@@ -0,0 +1,4 @@
+-- IANA time zone and BCP 47 locale the user's client reported; empty means
+-- unknown, which the server treats as UTC.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locale TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+-- Amplitude envelope and duration of audio messages, computed at upload so
+-- clients can draw the scrub bar before fetching the audio.
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS audio JSONB;
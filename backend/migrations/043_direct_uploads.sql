@@ -0,0 +1,13 @@
+-- Uploads a client was given a presigned S3 form for and has not completed.
+-- Completing one deletes the row, so each upload posts one message.
+CREATE TABLE IF NOT EXISTS direct_uploads (
+    object_key TEXT PRIMARY KEY,
+    room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    content_type TEXT NOT NULL,
+    message_type TEXT NOT NULL,
+    max_bytes BIGINT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS direct_uploads_expires_idx ON direct_uploads (expires_at);
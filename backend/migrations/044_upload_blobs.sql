@@ -0,0 +1,33 @@
+-- Content hashes of uploaded room images, so an identical image uploaded
+-- again reuses the stored file. Dedup stays within one location, so files
+-- never cross a data region. ref_count is kept by the trigger below as the
+-- number of messages whose media_url is the file; last_used_at protects a
+-- file that was just reused from upload GC before its message is saved.
+CREATE TABLE IF NOT EXISTS upload_blobs (
+    location TEXT NOT NULL,
+    sha256 TEXT NOT NULL,
+    url TEXT NOT NULL UNIQUE,
+    size BIGINT NOT NULL,
+    nsfw BOOLEAN NOT NULL DEFAULT FALSE,
+    ref_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (location, sha256)
+);
+
+CREATE OR REPLACE FUNCTION upload_blobs_on_message() RETURNS TRIGGER AS $$
+BEGIN
+  IF TG_OP IN ('UPDATE', 'DELETE') AND OLD.media_url IS NOT NULL THEN
+    UPDATE upload_blobs SET ref_count = ref_count - 1 WHERE url = OLD.media_url;
+  END IF;
+  IF TG_OP IN ('INSERT', 'UPDATE') AND NEW.media_url IS NOT NULL THEN
+    UPDATE upload_blobs SET ref_count = ref_count + 1 WHERE url = NEW.media_url;
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_upload_blobs_message ON messages;
+CREATE TRIGGER trg_upload_blobs_message
+  AFTER INSERT OR UPDATE OF media_url OR DELETE ON messages
+  FOR EACH ROW EXECUTE FUNCTION upload_blobs_on_message();
@@ -0,0 +1,10 @@
+-- Message text is capped by MAX_MESSAGE_LENGTH in the server; this is the
+-- hard ceiling (config.MaxMessageLengthCeiling) so no write path can store
+-- more. NOT VALID skips checking rows written before the cap.
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'messages_content_length_check') THEN
+    ALTER TABLE messages ADD CONSTRAINT messages_content_length_check CHECK (char_length(content) <= 16000) NOT VALID;
+  END IF;
+END;
+$$;
@@ -0,0 +1,5 @@
+-- Adds the spam rule kind: repeated characters, link floods and the same
+-- link posted over and over.
+ALTER TABLE automod_rules DROP CONSTRAINT IF EXISTS automod_rules_kind_check;
+ALTER TABLE automod_rules ADD CONSTRAINT automod_rules_kind_check
+  CHECK (kind IN ('pattern', 'links', 'mentions', 'newcomer', 'spam'));
@@ -0,0 +1,3 @@
+-- BCP 47 language a room admin set for the room; empty means it is
+-- detected from recent messages.
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS language TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,17 @@
+-- Audit trail of how members came and went. Unlike room_events, which
+-- triggers write for every path, these rows are written by the server so
+-- they can say who let the member in and through which mechanism.
+-- invite_link is the token hash of the room, group or guest link used.
+CREATE TABLE IF NOT EXISTS room_membership_events (
+  id BIGSERIAL PRIMARY KEY,
+  room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  actor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+  action TEXT NOT NULL CHECK (action IN ('joined', 'left')),
+  via TEXT NOT NULL,
+  invite_link TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_room_membership_events_room
+  ON room_membership_events(room_id, id DESC);
@@ -0,0 +1,8 @@
+-- Joins through invite links are credited to the link. room_membership_events
+-- already names the link for direct joins; join requests held by raid mode
+-- keep it here until they are approved.
+ALTER TABLE room_join_requests ADD COLUMN IF NOT EXISTS invite_link TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_room_membership_events_invite_link
+  ON room_membership_events(invite_link)
+  WHERE invite_link IS NOT NULL;
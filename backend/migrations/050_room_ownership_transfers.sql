@@ -0,0 +1,11 @@
+-- A room owner's offer to hand the room to another member. It takes effect
+-- only once that member accepts; one offer per room, a new one replaces it.
+CREATE TABLE IF NOT EXISTS room_ownership_transfers (
+  room_id UUID PRIMARY KEY REFERENCES rooms(id) ON DELETE CASCADE,
+  from_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  to_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_room_ownership_transfers_to ON room_ownership_transfers(to_user_id);
@@ -0,0 +1,26 @@
+-- Delta sync (GET /api/sync) reports which users changed their public
+-- profile since the client last synced. A trigger keeps the timestamp
+-- current so every code path that edits a profile is covered.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS profile_updated_at TIMESTAMPTZ;
+UPDATE users SET profile_updated_at = created_at WHERE profile_updated_at IS NULL;
+ALTER TABLE users ALTER COLUMN profile_updated_at SET DEFAULT NOW();
+ALTER TABLE users ALTER COLUMN profile_updated_at SET NOT NULL;
+
+CREATE OR REPLACE FUNCTION touch_profile_updated_at() RETURNS TRIGGER AS $$
+BEGIN
+  NEW.profile_updated_at := NOW();
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_users_profile_updated_at ON users;
+CREATE TRIGGER trg_users_profile_updated_at
+  BEFORE UPDATE OF username, avatar_url, profile ON users
+  FOR EACH ROW
+  WHEN (NEW.username IS DISTINCT FROM OLD.username
+     OR NEW.avatar_url IS DISTINCT FROM OLD.avatar_url
+     OR NEW.profile IS DISTINCT FROM OLD.profile)
+  EXECUTE FUNCTION touch_profile_updated_at();
+
+CREATE INDEX IF NOT EXISTS idx_room_events_room_created ON room_events(room_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_users_profile_updated_at ON users(profile_updated_at);
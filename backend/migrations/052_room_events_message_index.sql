@@ -0,0 +1,3 @@
+-- History pages read each message's last edit and the deletions in their
+-- ID range from room_events.
+CREATE INDEX IF NOT EXISTS idx_room_events_message ON room_events(room_id, message_id, type) WHERE message_id IS NOT NULL;
@@ -0,0 +1,5 @@
+-- With EMOJI_SHORTCODES on, messages.content holds the text with
+-- :shortcode: names expanded to emoji and content_raw the text as typed,
+-- so search finds a message by either form. content_raw is NULL when the
+-- two are the same.
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS content_raw TEXT;
@@ -0,0 +1,5 @@
+-- Per-room word masking. When it is on, listed words (plus the server's
+-- PROFANITY_WORDS) are masked in what members receive; the stored message
+-- keeps the original text for room admins.
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS word_mask BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS masked_words JSONB NOT NULL DEFAULT '[]';
@@ -0,0 +1,3 @@
+-- Jumping to a date (GET /api/rooms/{id}/messages/around) looks messages up
+-- by time within a room.
+CREATE INDEX IF NOT EXISTS idx_messages_room_created_at ON messages(room_id, created_at);
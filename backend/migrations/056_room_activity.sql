@@ -0,0 +1,10 @@
+-- Hourly message counts per room, for GET /api/rooms/{id}/activity. The
+-- room_activity maintenance task recounts recent hours from messages; older
+-- hours keep their counts after history retention removes the messages.
+CREATE TABLE IF NOT EXISTS room_activity_hourly (
+    room_id  UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+    hour     TIMESTAMPTZ NOT NULL,
+    messages INT NOT NULL,
+    PRIMARY KEY (room_id, hour)
+);
+CREATE INDEX IF NOT EXISTS idx_room_activity_hourly_hour ON room_activity_hourly(hour);
@@ -0,0 +1,19 @@
+-- Who each message @mentions, for the mentions inbox (GET /api/me/mentions).
+-- The derived-data worker fills it in as messages arrive; existing messages
+-- are backfilled here against current usernames and memberships.
+CREATE TABLE IF NOT EXISTS message_mentions (
+    message_id BIGINT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id    UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    room_id    UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+    PRIMARY KEY (message_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_message_mentions_user ON message_mentions(user_id, message_id DESC);
+
+INSERT INTO message_mentions (message_id, user_id, room_id)
+SELECT m.id, rm.user_id, m.room_id
+FROM messages m
+JOIN room_members rm ON rm.room_id = m.room_id AND rm.user_id <> m.user_id
+JOIN users u ON u.id = rm.user_id
+WHERE NOT m.shadowed
+  AND strpos(lower(m.content), '@' || lower(u.username)) > 0
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,3 @@
+-- Unlisted rooms keep their name, avatar and member count out of the public
+-- invite preview (GET /api/invite-links/{token}/preview).
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS unlisted BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,6 @@
+-- Brute-force limits on email verification codes: wrong guesses per code,
+-- and codes sent per hour (counted in a window that starts with the first
+-- send and lasts an hour).
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verification_attempts INT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verification_sends INT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verification_window_at TIMESTAMPTZ;
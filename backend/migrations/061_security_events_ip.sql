@@ -0,0 +1,5 @@
+-- Security events may be about an address rather than an account, such as
+-- an IP blocked for guessing invite tokens, and can carry a short detail.
+ALTER TABLE security_events ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE security_events ADD COLUMN IF NOT EXISTS detail TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_security_events_created ON security_events(created_at DESC);
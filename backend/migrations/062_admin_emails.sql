@@ -0,0 +1,3 @@
+-- Room admins who are offline when something needs their attention, such
+-- as a join request, are emailed unless they turn it off.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS admin_emails BOOLEAN NOT NULL DEFAULT TRUE;
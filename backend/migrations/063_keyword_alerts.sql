@@ -0,0 +1,10 @@
+-- Words a user watches for in every room they are in. Messages that match
+-- land in their mentions inbox like @mentions, with the keyword that matched.
+CREATE TABLE IF NOT EXISTS user_keywords (
+    user_id    UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    keyword    TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, keyword)
+);
+
+ALTER TABLE message_mentions ADD COLUMN IF NOT EXISTS keyword TEXT;
@@ -0,0 +1,3 @@
+-- Daily windows, in the user's timezone, during which push notifications
+-- and non-security emails are held back.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS quiet_hours JSONB NOT NULL DEFAULT '{"windows": []}';
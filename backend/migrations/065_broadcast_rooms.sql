@@ -0,0 +1,12 @@
+-- Broadcast rooms are read-only channels: their members are the publishers,
+-- and everyone else follows them through a subscription, which carries no
+-- role, read state or unread counter.
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS broadcast BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS room_subscriptions (
+    room_id    UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+    user_id    UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (room_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_room_subscriptions_user ON room_subscriptions(user_id);
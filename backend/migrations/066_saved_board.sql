@@ -0,0 +1,19 @@
+-- Personal saved board: messages from any room and outside links a user
+-- collects, each with their own note, in the order they arrange them.
+-- Exactly one of message_id and url is set.
+CREATE TABLE IF NOT EXISTS board_items (
+  id BIGSERIAL PRIMARY KEY,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  message_id BIGINT REFERENCES messages(id) ON DELETE CASCADE,
+  url TEXT,
+  title TEXT NOT NULL DEFAULT '',
+  note TEXT NOT NULL DEFAULT '',
+  position INT NOT NULL DEFAULT 0,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  CHECK ((message_id IS NULL) <> (url IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS idx_board_items_user ON board_items(user_id, position, id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_board_items_user_message
+  ON board_items(user_id, message_id) WHERE message_id IS NOT NULL;
@@ -0,0 +1,13 @@
+-- Custom slash commands. Typing /name in the room POSTs the invocation,
+-- signed with secret, to url; in-room replies are posted as created_by.
+CREATE TABLE IF NOT EXISTS room_commands (
+  id BIGSERIAL PRIMARY KEY,
+  room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  url TEXT NOT NULL,
+  secret TEXT NOT NULL,
+  description TEXT NOT NULL DEFAULT '',
+  created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE (room_id, name)
+);
@@ -0,0 +1,6 @@
+-- Buttons and select menus on slash command replies. command_id routes a
+-- member's interaction back to the command that posted the message.
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS components JSONB;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS command_id BIGINT REFERENCES room_commands(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_messages_command ON messages (command_id) WHERE command_id IS NOT NULL;
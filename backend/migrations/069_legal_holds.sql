@@ -0,0 +1,71 @@
+-- Legal holds keep a user's or a room's content from being deleted while
+-- they are active. Rows are never deleted: a released hold keeps who placed
+-- and released it and why, as the audit trail. Subjects and actors are not
+-- foreign keys so the trail outlives them.
+CREATE TABLE IF NOT EXISTS legal_holds (
+  id BIGSERIAL PRIMARY KEY,
+  user_id UUID,
+  room_id UUID,
+  reason TEXT NOT NULL,
+  placed_by UUID NOT NULL,
+  placed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  released_by UUID,
+  released_at TIMESTAMPTZ,
+  release_note TEXT NOT NULL DEFAULT '',
+  CHECK ((user_id IS NULL) <> (room_id IS NULL))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_legal_holds_active_user ON legal_holds(user_id) WHERE released_at IS NULL AND user_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_legal_holds_active_room ON legal_holds(room_id) WHERE released_at IS NULL AND room_id IS NOT NULL;
+
+-- A room is held when it is under a hold itself or holds messages of a
+-- held user.
+CREATE OR REPLACE FUNCTION legal_hold_blocks_room(p_room UUID) RETURNS BOOLEAN AS $$
+  SELECT EXISTS (SELECT 1 FROM legal_holds WHERE released_at IS NULL AND room_id = p_room)
+      OR EXISTS (
+        SELECT 1 FROM legal_holds h
+        JOIN messages m ON m.user_id = h.user_id AND m.room_id = p_room
+        WHERE h.released_at IS NULL
+      )
+$$ LANGUAGE sql STABLE;
+
+-- A user is held when they are under a hold, wrote in a held room, or own
+-- a room that is held, since deleting them would delete that content.
+CREATE OR REPLACE FUNCTION legal_hold_blocks_user(p_user UUID) RETURNS BOOLEAN AS $$
+  SELECT EXISTS (SELECT 1 FROM legal_holds WHERE released_at IS NULL AND user_id = p_user)
+      OR EXISTS (
+        SELECT 1 FROM legal_holds h
+        JOIN messages m ON m.room_id = h.room_id AND m.user_id = p_user
+        WHERE h.released_at IS NULL
+      )
+      OR EXISTS (SELECT 1 FROM rooms WHERE created_by = p_user AND legal_hold_blocks_room(id))
+$$ LANGUAGE sql STABLE;
+
+-- Backstop for deletions that skip the checks in the server: deleting held
+-- content fails instead.
+CREATE OR REPLACE FUNCTION enforce_legal_hold() RETURNS trigger AS $$
+BEGIN
+  IF TG_TABLE_NAME = 'messages' THEN
+    IF EXISTS (SELECT 1 FROM legal_holds WHERE released_at IS NULL AND (room_id = OLD.room_id OR user_id = OLD.user_id)) THEN
+      RAISE EXCEPTION 'message % is under legal hold', OLD.id;
+    END IF;
+  ELSIF TG_TABLE_NAME = 'rooms' THEN
+    IF EXISTS (SELECT 1 FROM legal_holds WHERE released_at IS NULL AND room_id = OLD.id) THEN
+      RAISE EXCEPTION 'room % is under legal hold', OLD.id;
+    END IF;
+  ELSIF EXISTS (SELECT 1 FROM legal_holds WHERE released_at IS NULL AND user_id = OLD.id) THEN
+    RAISE EXCEPTION 'user % is under legal hold', OLD.id;
+  END IF;
+  RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS messages_legal_hold ON messages;
+CREATE TRIGGER messages_legal_hold BEFORE DELETE ON messages
+  FOR EACH ROW EXECUTE FUNCTION enforce_legal_hold();
+DROP TRIGGER IF EXISTS rooms_legal_hold ON rooms;
+CREATE TRIGGER rooms_legal_hold BEFORE DELETE ON rooms
+  FOR EACH ROW EXECUTE FUNCTION enforce_legal_hold();
+DROP TRIGGER IF EXISTS users_legal_hold ON users;
+CREATE TRIGGER users_legal_hold BEFORE DELETE ON users
+  FOR EACH ROW EXECUTE FUNCTION enforce_legal_hold();
@@ -0,0 +1,5 @@
+-- Contact card messages: a snapshot of the shared user's profile, and who
+-- each user lets share theirs.
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS contact JSONB;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS contact_sharing TEXT NOT NULL DEFAULT 'friends'
+    CHECK (contact_sharing IN ('everyone', 'friends', 'nobody'));
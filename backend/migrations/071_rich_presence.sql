@@ -0,0 +1,15 @@
+-- Rich presence: what a user is doing ("listening to ...", "in a meeting"),
+-- set by their clients and integrations, one entry per source. An entry
+-- lapses at expires_at unless its source refreshes it.
+CREATE TABLE IF NOT EXISTS user_rich_presence (
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  source TEXT NOT NULL,
+  activity_type TEXT NOT NULL,
+  text TEXT NOT NULL,
+  icon_url TEXT NOT NULL DEFAULT '',
+  expires_at TIMESTAMPTZ NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (user_id, source)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_rich_presence_expires ON user_rich_presence(expires_at);
@@ -0,0 +1,9 @@
+-- Public read-only embeds of a room's feed. A room is embeddable while it
+-- has a row here; the token in the embed URL is stored hashed, and
+-- rotating it replaces the row.
+CREATE TABLE IF NOT EXISTS room_embeds (
+  room_id UUID PRIMARY KEY REFERENCES rooms(id) ON DELETE CASCADE,
+  token_hash TEXT NOT NULL UNIQUE,
+  created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,33 @@
+-- Automations: trigger -> action rules a user sets up on a room they are
+-- in, run by the automations worker against new messages. Messages an
+-- automation posts carry its id and never trigger automations themselves.
+CREATE TABLE IF NOT EXISTS automations (
+  id BIGSERIAL PRIMARY KEY,
+  owner_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  trigger JSONB NOT NULL,
+  actions JSONB NOT NULL,
+  enabled BOOLEAN NOT NULL DEFAULT TRUE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_automations_owner ON automations(owner_id, id);
+CREATE INDEX IF NOT EXISTS idx_automations_room ON automations(room_id) WHERE enabled;
+
+-- One row per automation and triggering message, written before the
+-- actions run, so a message never runs an automation twice.
+CREATE TABLE IF NOT EXISTS automation_runs (
+  automation_id BIGINT NOT NULL REFERENCES automations(id) ON DELETE CASCADE,
+  message_id BIGINT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+  status TEXT NOT NULL DEFAULT 'running',
+  error TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  finished_at TIMESTAMPTZ,
+  PRIMARY KEY (automation_id, message_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_automation_runs_recent ON automation_runs(automation_id, created_at DESC);
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS automation_id BIGINT REFERENCES automations(id) ON DELETE SET NULL;
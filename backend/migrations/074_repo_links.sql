@@ -0,0 +1,14 @@
+-- GitHub/GitLab repositories linked to rooms. Deliveries to
+-- /api/hooks/{provider}/{id} are checked against secret and, for the event
+-- kinds listed, posted to the room as created_by.
+CREATE TABLE IF NOT EXISTS room_repo_links (
+  id BIGSERIAL PRIMARY KEY,
+  room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+  provider TEXT NOT NULL CHECK (provider IN ('github', 'gitlab')),
+  repo TEXT NOT NULL,
+  secret TEXT NOT NULL,
+  events TEXT[] NOT NULL,
+  created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE (room_id, provider, repo)
+);
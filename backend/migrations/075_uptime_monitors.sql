@@ -0,0 +1,22 @@
+-- Uptime monitors: URLs operators have the server probe. State changes are
+-- posted to room_id and sent to its admins as notifications; public
+-- monitors are listed on the status page.
+CREATE TABLE IF NOT EXISTS uptime_monitors (
+  id BIGSERIAL PRIMARY KEY,
+  name TEXT NOT NULL,
+  url TEXT NOT NULL,
+  room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+  interval_s INT NOT NULL,
+  expect_status INT NOT NULL DEFAULT 0,
+  public BOOLEAN NOT NULL DEFAULT FALSE,
+  state TEXT NOT NULL DEFAULT 'unknown' CHECK (state IN ('unknown', 'up', 'down')),
+  failures INT NOT NULL DEFAULT 0,
+  last_error TEXT NOT NULL DEFAULT '',
+  last_latency_ms INT,
+  last_checked_at TIMESTAMPTZ,
+  last_change_at TIMESTAMPTZ,
+  created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_uptime_monitors_due ON uptime_monitors(last_checked_at NULLS FIRST);
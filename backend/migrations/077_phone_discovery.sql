@@ -0,0 +1,10 @@
+-- Verified numbers are kept as a keyed hash, which is all uniqueness and
+-- contact discovery need. users.phone now only holds the number of users
+-- with SMS alerts on; the server hashes numbers verified before this on
+-- startup and then drops the rest.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone_hash TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone_hint TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone_discoverable BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_phone_hash ON users(phone_hash) WHERE phone_hash IS NOT NULL;
+
+ALTER TABLE phone_verifications ADD COLUMN IF NOT EXISTS phone_hash TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,53 @@
+-- Single sign-on for a workspace through its own OIDC or SAML identity
+-- provider. A workspace admin configures it; it does nothing until an
+-- instance admin approves it. Enforced, members must sign in through it.
+CREATE TABLE IF NOT EXISTS workspace_sso (
+  group_id UUID PRIMARY KEY REFERENCES room_groups(id) ON DELETE CASCADE,
+  protocol TEXT NOT NULL CHECK (protocol IN ('oidc', 'saml')),
+  enabled BOOLEAN NOT NULL DEFAULT FALSE,
+  enforced BOOLEAN NOT NULL DEFAULT FALSE,
+  approved BOOLEAN NOT NULL DEFAULT FALSE,
+  issuer TEXT NOT NULL DEFAULT '',
+  client_id TEXT NOT NULL DEFAULT '',
+  client_secret TEXT NOT NULL DEFAULT '',
+  idp_sso_url TEXT NOT NULL DEFAULT '',
+  idp_entity_id TEXT NOT NULL DEFAULT '',
+  idp_certificate TEXT NOT NULL DEFAULT '',
+  groups_claim TEXT NOT NULL DEFAULT 'groups',
+  -- [{"group": "...", "role": "admin"|"member"}]
+  role_mappings JSONB NOT NULL DEFAULT '[]',
+  -- Role for users in none of the mapped groups; '' turns them away.
+  default_role TEXT NOT NULL DEFAULT 'member' CHECK (default_role IN ('', 'member')),
+  updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Who each subject at a workspace's identity provider is here.
+CREATE TABLE IF NOT EXISTS sso_identities (
+  group_id UUID NOT NULL REFERENCES room_groups(id) ON DELETE CASCADE,
+  subject TEXT NOT NULL,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  last_login_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (group_id, subject),
+  UNIQUE (group_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_sso_identities_user ON sso_identities(user_id);
+
+-- Sign-ins in flight, keyed by the hash of the state sent to the IdP, and
+-- sign-ins done, keyed by the hash of the one-time code handed to the
+-- frontend. Both are taken once and only live a few minutes.
+CREATE TABLE IF NOT EXISTS sso_logins (
+  state_hash TEXT PRIMARY KEY,
+  group_id UUID NOT NULL REFERENCES room_groups(id) ON DELETE CASCADE,
+  nonce TEXT NOT NULL,
+  verifier TEXT NOT NULL DEFAULT '',
+  link_user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS sso_exchanges (
+  code_hash TEXT PRIMARY KEY,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,46 @@
+-- SCIM provisioning. Identity providers authenticate with tokens instance
+-- admins create, stored hashed.
+CREATE TABLE IF NOT EXISTS scim_tokens (
+  id BIGSERIAL PRIMARY KEY,
+  name TEXT NOT NULL,
+  token_hash TEXT NOT NULL UNIQUE,
+  created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  last_used_at TIMESTAMPTZ
+);
+
+-- Accounts the identity provider manages, under the userName it knows
+-- them by. Deactivated accounts cannot sign in and their sessions stop
+-- working.
+CREATE TABLE IF NOT EXISTS scim_users (
+  user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  user_name TEXT NOT NULL,
+  external_id TEXT NOT NULL DEFAULT '',
+  display_name TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_scim_users_user_name ON scim_users(LOWER(user_name));
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deactivated_at TIMESTAMPTZ;
+
+-- The identity provider's groups. An instance admin points each at a
+-- workspace or a room; its members are then kept in it.
+CREATE TABLE IF NOT EXISTS scim_groups (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  display_name TEXT NOT NULL,
+  external_id TEXT NOT NULL DEFAULT '',
+  group_id UUID REFERENCES room_groups(id) ON DELETE SET NULL,
+  room_id UUID REFERENCES rooms(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  CHECK (group_id IS NULL OR room_id IS NULL)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_scim_groups_display_name ON scim_groups(LOWER(display_name));
+
+CREATE TABLE IF NOT EXISTS scim_group_members (
+  scim_group_id UUID NOT NULL REFERENCES scim_groups(id) ON DELETE CASCADE,
+  user_id UUID NOT NULL REFERENCES scim_users(user_id) ON DELETE CASCADE,
+  PRIMARY KEY (scim_group_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_scim_group_members_user ON scim_group_members(user_id);
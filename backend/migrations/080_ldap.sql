@@ -0,0 +1,10 @@
+-- Accounts signed in through the LDAP directory, by the entry's stable id
+-- (entryUUID or objectGUID). Their password_hash is left empty: passwords
+-- are checked by the directory only.
+CREATE TABLE IF NOT EXISTS ldap_identities (
+  ldap_id TEXT PRIMARY KEY,
+  user_id UUID NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+  dn TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  synced_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
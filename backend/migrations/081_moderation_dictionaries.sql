@@ -0,0 +1,14 @@
+-- Word lists instance admins upload for auto-moderation, per language ('' for
+-- every language). Profanity lists are masked in rooms that mask words;
+-- spam lists make rooms' spam rules match the phrases they hold.
+CREATE TABLE IF NOT EXISTS moderation_dictionaries (
+  id BIGSERIAL PRIMARY KEY,
+  name TEXT NOT NULL,
+  kind TEXT NOT NULL CHECK (kind IN ('profanity', 'spam')),
+  language TEXT NOT NULL DEFAULT '',
+  words JSONB NOT NULL DEFAULT '[]',
+  enabled BOOLEAN NOT NULL DEFAULT TRUE,
+  created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,2 @@
+-- E-discovery exports page through a user's messages by (created_at, id).
+CREATE INDEX IF NOT EXISTS idx_messages_user_created_at ON messages(user_id, created_at, id);
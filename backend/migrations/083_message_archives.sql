@@ -0,0 +1,48 @@
+-- Cold storage for old messages. The archive task moves batches of a room's
+-- messages into zstd-compressed objects in the archive bucket; each row is
+-- the manifest entry for one object. room_id has no foreign key: when a room
+-- is deleted its archives are found and removed by the archive task, which
+-- also deletes the object.
+CREATE TABLE IF NOT EXISTS message_archives (
+    id BIGSERIAL PRIMARY KEY,
+    room_id UUID NOT NULL,
+    first_id BIGINT NOT NULL,
+    last_id BIGINT NOT NULL,
+    first_at TIMESTAMPTZ NOT NULL,
+    last_at TIMESTAMPTZ NOT NULL,
+    message_count INT NOT NULL,
+    object_key TEXT NOT NULL UNIQUE,
+    compressed_bytes BIGINT NOT NULL,
+    sha256 TEXT NOT NULL,
+    -- Uploads the archived messages point to, so upload GC keeps them.
+    media_urls TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_archives_room ON message_archives(room_id, last_id);
+
+-- Archiving deletes the messages it moved, which must not tell clients the
+-- messages were deleted. The archive transaction sets talkie.archiving.
+CREATE OR REPLACE FUNCTION room_events_on_message() RETURNS TRIGGER AS $$
+BEGIN
+  IF TG_OP = 'INSERT' THEN
+    -- Shadowed messages are invisible to everyone but their author, so they
+    -- are left out of the shared stream.
+    IF NOT NEW.shadowed THEN
+      PERFORM record_room_event(NEW.room_id, 'message_created', NEW.user_id, NEW.id,
+        jsonb_build_object('content', NEW.content, 'message_type', NEW.message_type, 'media_url', COALESCE(NEW.media_url, '')));
+    END IF;
+    RETURN NULL;
+  ELSIF TG_OP = 'UPDATE' THEN
+    IF NOT NEW.shadowed AND NEW.content IS DISTINCT FROM OLD.content THEN
+      PERFORM record_room_event(NEW.room_id, 'message_edited', NEW.user_id, NEW.id,
+        jsonb_build_object('content', NEW.content));
+    END IF;
+    RETURN NULL;
+  END IF;
+  IF NOT OLD.shadowed AND current_setting('talkie.archiving', true) IS DISTINCT FROM 'on' THEN
+    PERFORM record_room_event(OLD.room_id, 'message_deleted', OLD.user_id, OLD.id, NULL);
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
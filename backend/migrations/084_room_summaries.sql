@@ -0,0 +1,46 @@
+-- Per-member summary of each room the member is in, so room lists and
+-- bootstrap read one row per room instead of counting messages. The
+-- derived-data worker refreshes the rows of rooms with new messages,
+-- MarkRoomRead the reader's, and the rollups task corrects any drift.
+-- last_message_id is the newest message the member can see: shadowed
+-- messages count only for their author.
+CREATE TABLE IF NOT EXISTS room_summaries (
+  user_id UUID NOT NULL,
+  room_id UUID NOT NULL,
+  last_message_id BIGINT,
+  last_message_at TIMESTAMPTZ,
+  unread_count INT NOT NULL DEFAULT 0,
+  first_unread_id BIGINT,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (user_id, room_id),
+  FOREIGN KEY (room_id, user_id) REFERENCES room_members(room_id, user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_room_summaries_room ON room_summaries(room_id);
+
+-- A new member starts with the room's latest message and nothing unread,
+-- as room_members.unread_count does.
+CREATE OR REPLACE FUNCTION room_summaries_on_member() RETURNS TRIGGER AS $$
+BEGIN
+  INSERT INTO room_summaries (user_id, room_id, last_message_id, last_message_at)
+  SELECT NEW.user_id, NEW.room_id, r.last_message_id, r.last_message_at
+  FROM rooms r
+  WHERE r.id = NEW.room_id
+  ON CONFLICT DO NOTHING;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_room_summaries_member ON room_members;
+CREATE TRIGGER trg_room_summaries_member
+  AFTER INSERT ON room_members
+  FOR EACH ROW EXECUTE FUNCTION room_summaries_on_member();
+
+INSERT INTO room_summaries (user_id, room_id, last_message_id, last_message_at, unread_count, first_unread_id)
+SELECT rm.user_id, rm.room_id, r.last_message_id, r.last_message_at, rm.unread_count,
+       (SELECT MIN(mu.id) FROM messages mu
+        WHERE mu.room_id = rm.room_id AND mu.id > COALESCE(rm.last_read_message_id, 0)
+          AND mu.user_id <> rm.user_id AND NOT mu.shadowed)
+FROM room_members rm
+JOIN rooms r ON r.id = rm.room_id
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,13 @@
+-- The point GET /api/bootstrap read its data at: the event sequence of each
+-- room the user was in. A room socket opened with the snapshot's token
+-- replays what changed in the room since then, so nothing sent between the
+-- two requests is lost. Snapshots are short-lived and swept by the
+-- sync_snapshots maintenance task.
+CREATE TABLE IF NOT EXISTS sync_snapshots (
+  token TEXT PRIMARY KEY,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  room_seqs JSONB NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_sync_snapshots_created ON sync_snapshots(created_at);
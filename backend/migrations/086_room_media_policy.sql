@@ -0,0 +1,5 @@
+-- Per-room limits on uploaded media types, on top of UPLOAD_ALLOWED_TYPES
+-- and UPLOAD_BLOCKED_TYPES. Entries are MIME types or "type/*"; an empty
+-- media_allowed allows every type not blocked.
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS media_allowed TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS media_blocked TEXT[] NOT NULL DEFAULT '{}';
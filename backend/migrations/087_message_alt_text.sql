@@ -0,0 +1,4 @@
+-- Alt text on image messages, from the author or, when they gave none,
+-- from the vision model behind ALT_TEXT_API_URL.
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS alt_text TEXT CHECK (char_length(alt_text) <= 1000);
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS alt_text_generated BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,10 @@
+-- The account and room the canary probes the message pipeline with. The
+-- room is private with the probe account as its only member, so nobody else
+-- sees it. There is at most one row; when the account or room is deleted
+-- the row goes with it and the canary sets up a new pair on its next run.
+CREATE TABLE IF NOT EXISTS canary (
+  id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,14 @@
+-- Opt-in usage telemetry. telemetry_state holds the random id reports are
+-- sent under, which says nothing about the instance, and when the last
+-- report went out. telemetry_usage sums requests per endpoint pattern
+-- across instances until the next report takes them.
+CREATE TABLE IF NOT EXISTS telemetry_state (
+  id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+  instance_id UUID NOT NULL DEFAULT gen_random_uuid(),
+  last_sent_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS telemetry_usage (
+  feature TEXT PRIMARY KEY,
+  count BIGINT NOT NULL
+);
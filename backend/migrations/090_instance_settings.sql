@@ -0,0 +1,9 @@
+-- Settings chosen in the first-run setup wizard. Once the row exists its
+-- values override INSTANCE_NAME and REGISTRATION, and setup is locked.
+CREATE TABLE IF NOT EXISTS instance_settings (
+  id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+  name TEXT NOT NULL,
+  registration TEXT NOT NULL CHECK (registration IN ('open', 'closed')),
+  setup_by UUID REFERENCES users(id) ON DELETE SET NULL,
+  setup_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
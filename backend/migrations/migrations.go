@@ -0,0 +1,20 @@
+// Package migrations embeds the SQL migrations, so that the server applies
+// them without a migrations directory next to the binary.
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+)
+
+//go:embed *.sql
+var embedded embed.FS
+
+// Open returns the migrations in dir, or the embedded ones when dir is "".
+func Open(dir string) fs.FS {
+	if dir != "" {
+		return os.DirFS(dir)
+	}
+	return embedded
+}
@@ -1,15 +1,37 @@
 import { useEffect, useMemo, useRef, useState, type ChangeEvent } from 'react';
-import { Room, RoomEvent, Track } from 'livekit-client';
-import { APIError, api } from './lib/api';
+import { ParticipantEvent, Room, RoomEvent, Track } from 'livekit-client';
+import { APIError, api, type DeviceLinkPoll } from './lib/api';
 import type { Friend, FriendsResponse, Message, Participant, Room as AppRoom, RoomGroup, User } from './lib/types';
+import { DeviceLinkPanel } from './components/DeviceLinkPanel';
 import { FriendsPanel } from './components/FriendsPanel';
 import { UserAvatar } from './components/UserAvatar';
 
-type AuthView = 'login' | 'register' | 'verify' | 'forgot' | 'reset';
+type AuthView = 'login' | 'register' | 'verify' | 'forgot' | 'reset' | 'guest' | 'link';
 type CreateMode = 'server' | 'room';
 type MiniProfile = { id: string; username: string; avatarURL?: string; createdAt?: string; isFriend?: boolean; loading: boolean };
 type SidebarView = { kind: 'root' } | { kind: 'group'; groupID: string };
 const NIL_UUID = '00000000-0000-0000-0000-000000000000';
+const CALL_FEEDBACK_TAGS: [string, string][] = [
+  ['audio', 'звук'],
+  ['video', 'видео'],
+  ['echo', 'эхо'],
+  ['latency', 'задержка'],
+  ['dropped', 'обрыв'],
+  ['screen_share', 'демонстрация'],
+  ['other', 'другое'],
+];
+
+// tokenSessionVersion reads the "sv" claim so a session_revoked event can
+// tell whether this device already holds a post-revocation token.
+function tokenSessionVersion(token: string | null): number {
+  if (!token) return 0;
+  try {
+    const payload = JSON.parse(atob(token.split('.')[1].replace(/-/g, '+').replace(/_/g, '/')));
+    return typeof payload.sv === 'number' ? payload.sv : 0;
+  } catch {
+    return 0;
+  }
+}
 
 function hasGroupID(groupID?: string): groupID is string {
   return Boolean(groupID && groupID !== NIL_UUID);
@@ -85,11 +107,20 @@ function isVideoTrack(track: Track | undefined): track is Track {
 }
 
 function wsBaseUrl(apiBase: string): string {
+  // Served by the API itself, as the single binary does: same origin.
+  if (!apiBase) return `${window.location.protocol === 'https:' ? 'wss:' : 'ws:'}//${window.location.host}`;
   if (apiBase.startsWith('https://')) return apiBase.replace('https://', 'wss://');
   if (apiBase.startsWith('http://')) return apiBase.replace('http://', 'ws://');
   return apiBase;
 }
 
+// socketEvents unpacks a frame from a socket opened with batch=1, which
+// carries an array of events.
+function socketEvents(data: string): unknown[] {
+  const parsed = JSON.parse(data) as unknown;
+  return Array.isArray(parsed) ? parsed : [parsed];
+}
+
 function mediaUrl(apiBase: string, mediaPath?: string): string {
   if (!mediaPath) return '';
   if (mediaPath.startsWith('http://') || mediaPath.startsWith('https://')) return mediaPath;
@@ -121,6 +152,7 @@ function volumeKey(kind: 'voice' | 'screen', participantID: string): string {
 
 function previewText(message: Message): string {
   if (message.message_type === 'image') return '[Фото]';
+  if (message.message_type === 'audio') return '[Голосовое сообщение]';
   const text = message.content.trim();
   return text.length > 80 ? `${text.slice(0, 77)}...` : text;
 }
@@ -190,9 +222,14 @@ function VideoTile({
 }
 
 export function App() {
-  const [authView, setAuthView] = useState<AuthView>('login');
+  const [authView, setAuthView] = useState<AuthView>(() => {
+    const params = new URLSearchParams(window.location.search);
+    if (params.has('link')) return 'link';
+    return params.has('guest') ? 'guest' : 'login';
+  });
   const [email, setEmail] = useState('');
   const [username, setUsername] = useState('');
+  const [dateOfBirth, setDateOfBirth] = useState('');
   const [password, setPassword] = useState('');
   const [acceptLegal, setAcceptLegal] = useState(false);
   const [user, setUser] = useState<User | null>(null);
@@ -219,6 +256,8 @@ export function App() {
   );
   const [hasNewFriendRequest, setHasNewFriendRequest] = useState(false);
   const [showFriendsModal, setShowFriendsModal] = useState(false);
+  const [showDeviceLinkModal, setShowDeviceLinkModal] = useState(false);
+  const deviceLinkClaimRef = useRef<Promise<DeviceLinkPoll> | null>(null);
   const [miniProfile, setMiniProfile] = useState<MiniProfile | null>(null);
   const [newEntityName, setNewEntityName] = useState('');
   const [createMode, setCreateMode] = useState<CreateMode>('server');
@@ -261,6 +300,11 @@ export function App() {
   const [videoTracks, setVideoTracks] = useState<VideoTrackItem[]>([]);
   const [focusedTileKey, setFocusedTileKey] = useState<string | null>(null);
   const [activeSpeakerIDs, setActiveSpeakerIDs] = useState<string[]>([]);
+  const [callChat, setCallChat] = useState<Message[]>([]);
+  const [callChatDraft, setCallChatDraft] = useState('');
+  const [maxMessageLength, setMaxMessageLength] = useState(4000);
+  const [callFeedback, setCallFeedback] = useState<{ roomID: string; callID: string } | null>(null);
+  const [callFeedbackTags, setCallFeedbackTags] = useState<string[]>([]);
   const [pendingImage, setPendingImage] = useState<File | null>(null);
   const [lightboxImageURL, setLightboxImageURL] = useState<string | null>(null);
   const [refreshTick, setRefreshTick] = useState(0);
@@ -289,6 +333,7 @@ export function App() {
   const mutedRoomsRef = useRef<Record<string, boolean>>({});
   const lastRoomMessageIDsRef = useRef<Record<string, number>>({});
   const inviteJoinHandledRef = useRef(false);
+  const permalinkHandledRef = useRef(false);
 
   const sortedRootRooms = useMemo(
     () =>
@@ -422,23 +467,22 @@ export function App() {
     if (!token) return;
     (async () => {
       try {
-        const [me, groupList, roomList, dms, friends] = await Promise.all([
-          api.me(token),
-          api.listGroups(token),
-          api.listRooms(token),
-          api.listDMRooms(token),
-          api.listFriends(token),
-        ]);
+        const boot = await api.bootstrap(token);
+        const { user: me, groups: groupList, rooms: roomList, dms } = boot;
+        const friends = { friends: boot.friends, incoming: boot.incoming };
         const mergedRooms = mergeGroupedAndStandalone(groupList, roomList);
         setUser(me);
         setGroups(groupList);
         setRooms(mergedRooms);
         setDMRooms(dms);
         setFriendsData(friends);
+        if (boot.max_message_length) setMaxMessageLength(boot.max_message_length);
         setRoomActivityByID((prev) => {
           const next = { ...prev };
           for (const room of [...mergedRooms, ...dms]) {
-            if (!next[room.id]) next[room.id] = new Date(room.created_at).getTime();
+            if (next[room.id]) continue;
+            const last = boot.last_messages[room.id];
+            next[room.id] = new Date(last?.created_at ?? room.created_at).getTime();
           }
           return next;
         });
@@ -470,6 +514,31 @@ export function App() {
     }
   }, [token]);
 
+  useEffect(() => {
+    const path = window.location.pathname;
+    if (path !== '/confirm-email' && path !== '/revert-email') return;
+    const emailToken = new URLSearchParams(window.location.search).get('token');
+    window.history.replaceState({}, '', '/');
+    if (!emailToken) return;
+
+    if (path === '/confirm-email') {
+      void api.confirmEmailChange(emailToken)
+        .then(({ email }) => setAuthMessage(`Адрес почты изменён на ${email}.`))
+        .catch((err) => setError(err instanceof Error ? err.message : 'failed to confirm email change'));
+      return;
+    }
+    void api.revertEmailChange(emailToken)
+      .then(({ email, reverted }) => {
+        if (reverted) {
+          logout();
+          setAuthMessage(`Адрес почты восстановлен: ${email}. Все сеансы завершены, войдите снова.`);
+        } else {
+          setAuthMessage('Смена адреса почты отменена.');
+        }
+      })
+      .catch((err) => setError(err instanceof Error ? err.message : 'failed to revert email change'));
+  }, []);
+
   useEffect(() => {
     if (!token || !user || inviteJoinHandledRef.current) return;
     const params = new URLSearchParams(window.location.search);
@@ -480,8 +549,17 @@ export function App() {
     let mounted = true;
     setError(null);
     void api.joinByInviteLink(token, inviteToken)
-      .then(async (room) => {
+      .then(async (joined) => {
         if (!mounted) return;
+        if ('status' in joined && joined.status === 'subscribed') {
+          setAuthMessage('Вы подписались на канал.');
+          return;
+        }
+        if ('status' in joined) {
+          setError('Заявка на вступление отправлена. Дождитесь одобрения администратора комнаты.');
+          return;
+        }
+        const room = joined;
         const [groupList, roomList, dms] = await Promise.all([api.listGroups(token), api.listRooms(token), api.listDMRooms(token)]);
         const mergedRooms = mergeGroupedAndStandalone(groupList, roomList);
         if (!mounted) return;
@@ -507,6 +585,28 @@ export function App() {
     };
   }, [token, user]);
 
+  useEffect(() => {
+    if (!token || !user || permalinkHandledRef.current) return;
+    const match = window.location.pathname.match(/^\/r\/([0-9a-f-]{36})\/m\/(\d+)$/i);
+    if (!match) return;
+
+    permalinkHandledRef.current = true;
+    const [, roomID, messageID] = match;
+    setError(null);
+    void api.resolvePermalink(token, roomID, messageID)
+      .then(async ({ room }) => {
+        const known = [...roomsRef.current, ...dmRoomsRef.current].find((candidate) => candidate.id === room.id);
+        await openRoom(known || room);
+        document.getElementById(`message-${messageID}`)?.scrollIntoView({ block: 'center' });
+      })
+      .catch((err) => {
+        setError(err instanceof Error ? err.message : 'failed to open message link');
+      })
+      .finally(() => {
+        window.history.replaceState({}, '', '/' + window.location.search);
+      });
+  }, [token, user]);
+
   useEffect(() => {
     if (!token || !user) return;
     const params = new URLSearchParams(window.location.search);
@@ -530,6 +630,20 @@ export function App() {
       });
   }, [token, user]);
 
+  useEffect(() => {
+    if (!token || !user) return;
+    const params = new URLSearchParams(window.location.search);
+    const roomID = params.get('room');
+    if (!roomID) return;
+    const room = rooms.find((candidate) => candidate.id === roomID);
+    if (!room) return;
+
+    params.delete('room');
+    const next = window.location.pathname + (params.toString() ? `?${params.toString()}` : '');
+    window.history.replaceState({}, '', next);
+    void openRoom(room);
+  }, [token, user, rooms]);
+
   useEffect(() => {
     if (!token || !user) return;
     let stopped = false;
@@ -537,15 +651,25 @@ export function App() {
 
     const connect = () => {
       if (stopped) return;
-      const wsUrl = `${wsBaseUrl(api.apiBase)}/ws/events?token=${encodeURIComponent(token)}`;
+      const wsUrl = `${wsBaseUrl(api.apiBase)}/ws/events?token=${encodeURIComponent(token)}&batch=1`;
       const socket = new WebSocket(wsUrl);
       eventsWsRef.current = socket;
 
-      socket.onmessage = (event) => {
-        const payload = JSON.parse(event.data) as {
+      const handleEvent = (event: unknown) => {
+        const payload = event as {
           type: string;
           message?: Message;
+          session_version?: number;
+          room_id?: string;
+          call_id?: string;
         };
+        if (payload.type === 'session_revoked') {
+          const current = tokenSessionVersion(localStorage.getItem('talkie_token'));
+          if (payload.session_version && current >= payload.session_version) return;
+          logout();
+          setAuthMessage('Пароль был изменён. Войдите снова.');
+          return;
+        }
         if (payload.type === 'room_message_event' && payload.message) {
           const incomingMessage = payload.message;
           if (incomingMessage.user_id === user.id) return;
@@ -578,6 +702,11 @@ export function App() {
           }
           return;
         }
+        if (payload.type === 'call_feedback_request' && payload.room_id && payload.call_id) {
+          setCallFeedback({ roomID: payload.room_id, callID: payload.call_id });
+          setCallFeedbackTags([]);
+          return;
+        }
         if (payload.type === 'friend_request_event') {
           setHasNewFriendRequest(true);
           playNotifyTone('request');
@@ -596,6 +725,18 @@ export function App() {
           void refreshSocial();
           return;
         }
+        if (payload.type === 'room_membership_event') {
+          void Promise.all([api.listGroups(token), api.listRooms(token), api.listDMRooms(token)])
+            .then(([groupList, roomList, dms]) => {
+              setGroups(groupList);
+              setRooms(mergeGroupedAndStandalone(groupList, roomList));
+              setDMRooms(dms);
+            })
+            .catch(() => {
+              // best effort
+            });
+          return;
+        }
         if (payload.type === 'dm_room_event') {
           void api.listDMRooms(token)
             .then((dms) => setDMRooms(dms))
@@ -605,6 +746,7 @@ export function App() {
           return;
         }
       };
+      socket.onmessage = (event) => socketEvents(event.data).forEach(handleEvent);
 
       socket.onclose = () => {
         if (stopped) return;
@@ -803,6 +945,52 @@ export function App() {
     }
   }, [showFriendsModal]);
 
+  useEffect(() => {
+    if (token || authView !== 'link') return;
+    const params = new URLSearchParams(window.location.search);
+    const code = params.get('link');
+    if (!code) return;
+    let cancelled = false;
+    let timer = 0;
+    const clearLinkParam = () => {
+      params.delete('link');
+      const next = window.location.pathname + (params.toString() ? `?${params.toString()}` : '');
+      window.history.replaceState({}, '', next);
+    };
+    // The claim is shared across effect re-runs: a code can only be claimed once.
+    if (!deviceLinkClaimRef.current) {
+      deviceLinkClaimRef.current = api.pollDeviceLink(code);
+    }
+    const claimRequest = deviceLinkClaimRef.current;
+    const poll = async () => {
+      try {
+        const { claim } = await claimRequest;
+        const result = await api.pollDeviceLink(code, claim);
+        if (cancelled) return;
+        if (result.token && result.user) {
+          clearLinkParam();
+          localStorage.setItem('talkie_token', result.token);
+          setToken(result.token);
+          setUser(result.user);
+          setAuthView('login');
+          return;
+        }
+        timer = window.setTimeout(poll, (result.poll_interval ?? 2) * 1000);
+      } catch (err) {
+        if (cancelled) return;
+        clearLinkParam();
+        deviceLinkClaimRef.current = null;
+        setAuthView('login');
+        setError(err instanceof Error ? err.message : 'failed to link device');
+      }
+    };
+    void poll();
+    return () => {
+      cancelled = true;
+      window.clearTimeout(timer);
+    };
+  }, [token, authView]);
+
   useEffect(() => {
     localStorage.setItem('talkie_muted_rooms', JSON.stringify(mutedRooms));
   }, [mutedRooms]);
@@ -874,7 +1062,7 @@ export function App() {
           setError('Подтвердите согласие с Пользовательским соглашением и Политикой конфиденциальности.');
           return;
         }
-        await api.register(email, username, password);
+        await api.register(email, username, password, dateOfBirth);
         setPendingVerificationEmail(email.trim().toLowerCase());
         setVerificationTokenInput('');
         setPassword('');
@@ -913,6 +1101,26 @@ export function App() {
     }
   }
 
+  async function handleGuestSubmit(e: React.FormEvent) {
+    e.preventDefault();
+    const params = new URLSearchParams(window.location.search);
+    const guestToken = params.get('guest');
+    if (!guestToken || !username.trim()) return;
+    setError(null);
+    try {
+      const result = await api.joinAsGuest(guestToken, username.trim());
+      params.delete('guest');
+      const next = window.location.pathname + (params.toString() ? `?${params.toString()}` : '');
+      window.history.replaceState({}, '', next);
+      localStorage.setItem('talkie_token', result.token);
+      setToken(result.token);
+      setUser(result.user);
+      setAuthView('login');
+    } catch (err) {
+      setError(err instanceof Error ? err.message : 'failed to join as guest');
+    }
+  }
+
   async function handleVerifyEmail(e: React.FormEvent) {
     e.preventDefault();
     const codeInput = verificationTokenInput.trim();
@@ -1087,18 +1295,37 @@ export function App() {
       }
 
       const connectRoomSocket = () => {
-        const wsUrl = `${wsBaseUrl(api.apiBase)}/ws/rooms/${room.id}?token=${encodeURIComponent(token)}`;
+        const wsUrl = `${wsBaseUrl(api.apiBase)}/ws/rooms/${room.id}?token=${encodeURIComponent(token)}&batch=1`;
         const socket = new WebSocket(wsUrl);
+        let lastSeq = 0;
 
-        socket.onmessage = (event) => {
-          const payload = JSON.parse(event.data) as {
+        socket.onopen = () => {
+          socket.send(JSON.stringify({ type: 'history_request', limit: 50 }));
+        };
+
+        const handleEvent = (event: unknown) => {
+          const payload = event as {
             type: string;
+            seq?: number;
             message?: Message;
             messages?: Message[];
             participants?: Participant[];
             call_users?: Participant[];
+            user_id?: string;
+            speaking?: boolean;
+            call_id?: string;
           };
 
+          if (payload.type === 'state_sync') {
+            lastSeq = payload.seq || 0;
+          } else if (payload.seq) {
+            if (payload.seq <= lastSeq) return;
+            if (payload.seq !== lastSeq + 1) {
+              socket.send(JSON.stringify({ type: 'state_sync' }));
+            }
+            lastSeq = payload.seq;
+          }
+
           if (payload.type === 'history' && payload.messages) {
             setMessages(payload.messages);
           }
@@ -1117,10 +1344,10 @@ export function App() {
             }
             lastRoomMessageIDsRef.current[room.id] = incomingMessage.id;
           }
-          if (payload.type === 'participants' && payload.participants) {
+          if ((payload.type === 'participants' || payload.type === 'state_sync') && payload.participants) {
             setChatParticipants(payload.participants);
           }
-          if (payload.type === 'call_participants') {
+          if (payload.type === 'call_participants' || payload.type === 'state_sync') {
             const callUsers = payload.call_users || [];
             setActiveCallsByRoom((prev) => ({ ...prev, [room.id]: callUsers.length }));
             const nextIDs = new Set(callUsers.map((u) => u.id));
@@ -1136,12 +1363,31 @@ export function App() {
             callPresenceIDsRef.current = nextIDs;
             if (!inCall || callRoomIDRef.current !== room.id) {
               applyCallPresence(callUsers);
+              setActiveSpeakerIDs((prev) => prev.filter((id) => nextIDs.has(id)));
             }
           }
+          if (payload.type === 'call_feedback_request' && payload.call_id) {
+            setCallFeedback({ roomID: room.id, callID: payload.call_id });
+            setCallFeedbackTags([]);
+          }
+          if (payload.type === 'call_chat' && payload.message) {
+            const line = payload.message;
+            setCallChat((prev) => [...prev, line]);
+          }
+          if (payload.type === 'speaking' && payload.user_id && (!inCall || callRoomIDRef.current !== room.id)) {
+            const speakerID = payload.user_id;
+            setActiveSpeakerIDs((prev) => {
+              const rest = prev.filter((id) => id !== speakerID);
+              return payload.speaking ? [...rest, speakerID] : rest;
+            });
+          }
         };
+        socket.onmessage = (event) => socketEvents(event.data).forEach(handleEvent);
 
-        socket.onclose = () => {
+        socket.onclose = (event) => {
           if (selectedRoomIDRef.current !== room.id) return;
+          // 4003: left the room, 4004: room deleted. Reconnecting would fail.
+          if (event.code === 4003 || event.code === 4004) return;
           roomWsReconnectRef.current = window.setTimeout(() => {
             if (selectedRoomIDRef.current === room.id) {
               connectRoomSocket();
@@ -1202,7 +1448,7 @@ export function App() {
     }
     const text = (chatInputRef.current?.value || '').trim();
     if (!text || !wsRef.current || wsRef.current.readyState !== WebSocket.OPEN) return;
-    wsRef.current.send(JSON.stringify({ type: 'chat', content: text }));
+    wsRef.current.send(JSON.stringify({ type: 'chat', content: text, client_sent_at: new Date().toISOString() }));
     if (chatInputRef.current) chatInputRef.current.value = '';
   }
 
@@ -1359,6 +1605,37 @@ export function App() {
     ws.send(JSON.stringify({ type: eventType }));
   }
 
+  async function submitCallFeedback(rating: number) {
+    if (!token || !callFeedback) return;
+    const prompt = callFeedback;
+    setCallFeedback(null);
+    try {
+      await api.submitCallFeedback(token, prompt.roomID, {
+        call_id: prompt.callID,
+        rating,
+        tags: callFeedbackTags,
+        client_version: __APP_VERSION__,
+      });
+    } catch {
+      // best effort
+    }
+  }
+
+  function sendCallChat(e: React.FormEvent) {
+    e.preventDefault();
+    const ws = wsRef.current;
+    const content = callChatDraft.trim();
+    if (!content || !ws || ws.readyState !== WebSocket.OPEN) return;
+    ws.send(JSON.stringify({ type: 'call_chat', content }));
+    setCallChatDraft('');
+  }
+
+  function notifySpeaking(speaking: boolean) {
+    const ws = wsRef.current;
+    if (!ws || ws.readyState !== WebSocket.OPEN) return;
+    ws.send(JSON.stringify({ type: 'speaking', speaking }));
+  }
+
   function toggleRemoteVideo(participantID: string, source: Track.Source.Camera | Track.Source.ScreenShare) {
     const room = roomRef.current;
     if (!room) return;
@@ -1480,10 +1757,14 @@ export function App() {
         setFocusedTileKey(null);
         setActiveSpeakerIDs([]);
         setCallParticipants([]);
+        setCallChat([]);
       });
       room.on(RoomEvent.ActiveSpeakersChanged, (speakers) => {
         setActiveSpeakerIDs(speakers.map((speaker) => speaker.identity));
       });
+      room.localParticipant.on(ParticipantEvent.IsSpeakingChanged, (speaking: boolean) => {
+        notifySpeaking(speaking);
+      });
       room.on(RoomEvent.ParticipantConnected, () => {
         syncCallParticipants(room);
       });
@@ -1549,6 +1830,7 @@ export function App() {
     setWatchedVideoKeys({});
     setActiveSpeakerIDs([]);
     setCallParticipants([]);
+    setCallChat([]);
   }
 
   async function toggleCamera() {
@@ -2057,7 +2339,38 @@ export function App() {
     const hasFriendInviteInURL = new URLSearchParams(window.location.search).has('friend_invite');
     return (
       <div className="auth-shell">
-        {authView === 'verify' ? (
+        {authView === 'link' ? (
+          <div className="auth-card">
+            <h1>Вход по QR-коду</h1>
+            <p>Подтвердите вход на устройстве, где вы уже авторизованы.</p>
+            <small>Ожидаем подтверждения...</small>
+            <button
+              type="button"
+              className="ghost"
+              onClick={() => {
+                window.history.replaceState({}, '', window.location.pathname);
+                setAuthView('login');
+              }}
+            >
+              Войти с паролем
+            </button>
+            {error && <p className="error">{error}</p>}
+          </div>
+        ) : authView === 'guest' ? (
+          <form className="auth-card" onSubmit={handleGuestSubmit}>
+            <h1>Гостевой Доступ</h1>
+            <p>Выберите имя. Гостевой аккаунт работает только в этой комнате и удаляется автоматически.</p>
+            <label>
+              Username
+              <input value={username} onChange={(e) => setUsername(e.target.value.slice(0, 15))} maxLength={15} required />
+            </label>
+            <button type="submit">Войти как гость</button>
+            <button type="button" className="ghost" onClick={() => setAuthView('login')}>
+              У меня есть аккаунт
+            </button>
+            {error && <p className="error">{error}</p>}
+          </form>
+        ) : authView === 'verify' ? (
           <form className="auth-card" onSubmit={handleVerifyEmail}>
             <h1>Подтверждение Email</h1>
             <p>Введите код из письма, чтобы завершить вход.</p>
@@ -2141,6 +2454,12 @@ export function App() {
                 <input value={username} onChange={(e) => setUsername(e.target.value.slice(0, 15))} maxLength={15} required />
               </label>
             )}
+            {authView === 'register' && (
+              <label>
+                Дата рождения
+                <input type="date" value={dateOfBirth} onChange={(e) => setDateOfBirth(e.target.value)} />
+              </label>
+            )}
             <label>
               Password
               <input type="password" value={password} onChange={(e) => setPassword(e.target.value)} required />
@@ -2387,6 +2706,9 @@ export function App() {
                 <button type="button" className="ghost sidebar-user-btn" onClick={() => setShowFriendsModal(true)}>
                   <span>Друзья</span> {hasNewFriendRequest && <span className="red-dot" />}
                 </button>
+                <button type="button" className="ghost sidebar-user-btn" onClick={() => setShowDeviceLinkModal(true)}>
+                  Привязать устройство
+                </button>
                 <button className="logout sidebar-user-btn" onClick={logout}>Выйти</button>
               </div>
               <div className="sidebar-user-actions single">
@@ -2548,6 +2870,23 @@ export function App() {
                       </div>
                     ))}
                   </div>
+                  <div className="call-chat">
+                    <div className="call-chat-lines">
+                      {callChat.map((line, i) => (
+                        <div key={i} className="call-chat-line">
+                          <strong>{line.username}</strong> {line.content}
+                        </div>
+                      ))}
+                    </div>
+                    <form onSubmit={sendCallChat}>
+                      <input
+                        value={callChatDraft}
+                        onChange={(e) => setCallChatDraft(e.target.value)}
+                        placeholder="Чат звонка (видят только участники)"
+                        maxLength={maxMessageLength}
+                      />
+                    </form>
+                  </div>
                 </>
               ) : null}
               {canUseCallUI && (
@@ -2614,7 +2953,7 @@ export function App() {
                   <div className="panel-heading">Чат канала</div>
                   <div className="messages" ref={messagesRef}>
                     {messages.map((m) => (
-                      <p key={m.id} className={m.message_type === 'image' ? 'image-message' : ''}>
+                      <p key={m.id} id={`message-${m.id}`} className={m.message_type === 'image' ? 'image-message' : m.message_type === 'system' ? 'system-message' : ''}>
                         <span className="msg-header">
                           <UserAvatar username={m.username} avatarUrl={resolveAvatarUrl(m.avatar_url)} size="sm" />
                           <button
@@ -2626,12 +2965,12 @@ export function App() {
                             {m.username}
                           </button>
                         </span>
-                        {!(m.message_type === 'image' && looksLikeImageFilename(m.content)) && (
-                          <span className="msg-content">{m.content}</span>
+                        {!(m.message_type === 'image' && looksLikeImageFilename(m.content)) && m.message_type !== 'audio' && (
+                          <span className="msg-content" lang={m.lang} dir={m.dir ?? 'auto'}>{m.content}</span>
                         )}
                         {m.message_type === 'image' && m.media_url && (
                           <img
-                            className="chat-image"
+                            className={m.nsfw ? 'chat-image chat-image-nsfw' : 'chat-image'}
                             src={mediaUrl(api.apiBase, m.media_url)}
                             alt={m.content || 'изображение'}
                             onClick={() => setLightboxImageURL(mediaUrl(api.apiBase, m.media_url))}
@@ -2641,6 +2980,19 @@ export function App() {
                             }}
                           />
                         )}
+                        {m.message_type === 'audio' && m.media_url && (
+                          <span className="voice-note">
+                            {m.audio && (
+                              <span className="voice-waveform">
+                                {m.audio.waveform.map((v, i) => (
+                                  <span key={i} style={{ height: `${Math.max(v, 4)}%` }} />
+                                ))}
+                              </span>
+                            )}
+                            <audio controls preload="none" src={mediaUrl(api.apiBase, m.media_url)} />
+                          </span>
+                        )}
+                        {m.withheld && <span className="msg-content">Изображение скрыто: NSFW-контент отключён в настройках.</span>}
                       </p>
                     ))}
                   </div>
@@ -2657,6 +3009,7 @@ export function App() {
                     <input
                       ref={chatInputRef}
                       onPaste={handleChatPaste}
+                      maxLength={maxMessageLength}
                       placeholder={pendingImage ? 'Подпись к изображению (необязательно)' : 'Напишите сообщение'}
                     />
                     <button type="submit">{pendingImage ? 'Отправить фото' : 'Отправить'}</button>
@@ -2724,6 +3077,31 @@ export function App() {
           </>
         )}
         {error && <p className="error global">{error}</p>}
+        {callFeedback && (
+          <div className="call-feedback">
+            <span>Как прошёл звонок?</span>
+            {[1, 2, 3, 4, 5].map((rating) => (
+              <button key={rating} type="button" onClick={() => void submitCallFeedback(rating)}>
+                {rating}
+              </button>
+            ))}
+            {CALL_FEEDBACK_TAGS.map(([tag, label]) => (
+              <label key={tag}>
+                <input
+                  type="checkbox"
+                  checked={callFeedbackTags.includes(tag)}
+                  onChange={(e) =>
+                    setCallFeedbackTags((prev) => (e.target.checked ? [...prev, tag] : prev.filter((t) => t !== tag)))
+                  }
+                />
+                {label}
+              </label>
+            ))}
+            <button type="button" onClick={() => setCallFeedback(null)}>
+              Пропустить
+            </button>
+          </div>
+        )}
         {showFriendsModal && (
           <div className="mini-profile-overlay" onClick={() => setShowFriendsModal(false)} role="button" tabIndex={0}>
             <div className="mini-profile-card friends-modal" onClick={(e) => e.stopPropagation()}>
@@ -2749,6 +3127,14 @@ export function App() {
             </div>
           </div>
         )}
+        {showDeviceLinkModal && (
+          <div className="mini-profile-overlay" onClick={() => setShowDeviceLinkModal(false)} role="button" tabIndex={0}>
+            <div className="mini-profile-card" onClick={(e) => e.stopPropagation()}>
+              <h4>Привязать устройство</h4>
+              <DeviceLinkPanel token={token} onClose={() => setShowDeviceLinkModal(false)} />
+            </div>
+          </div>
+        )}
         {miniProfile && (
           <div className="mini-profile-overlay" onClick={() => setMiniProfile(null)} role="button" tabIndex={0}>
             <div className="mini-profile-card" onClick={(e) => e.stopPropagation()}>
@@ -0,0 +1,87 @@
+import { useEffect, useRef, useState } from 'react';
+import QRCode from 'qrcode';
+import { api, type DeviceLink, type DeviceLinkStatus } from '../lib/api';
+
+type DeviceLinkPanelProps = {
+  token: string;
+  onClose: () => void;
+};
+
+// DeviceLinkPanel shows a QR code another device can open to sign in, and
+// asks for approval once that device has claimed it.
+export function DeviceLinkPanel({ token, onClose }: DeviceLinkPanelProps) {
+  const [link, setLink] = useState<DeviceLink | null>(null);
+  const [qr, setQR] = useState('');
+  const [status, setStatus] = useState<DeviceLinkStatus | null>(null);
+  const [error, setError] = useState<string | null>(null);
+  const approvedRef = useRef(false);
+
+  useEffect(() => {
+    let cancelled = false;
+    let created: DeviceLink | null = null;
+    api
+      .createDeviceLink(token)
+      .then(async (next) => {
+        created = next;
+        const dataURL = await QRCode.toDataURL(next.link_url, { margin: 1, width: 240 });
+        if (cancelled) return;
+        setLink(next);
+        setQR(dataURL);
+      })
+      .catch((err) => {
+        if (!cancelled) setError(err instanceof Error ? err.message : 'failed to create link code');
+      });
+    return () => {
+      cancelled = true;
+      // An approved link must survive until the new device collects its token.
+      if (created && !approvedRef.current) void api.cancelDeviceLink(token, created.code).catch(() => undefined);
+    };
+  }, [token]);
+
+  useEffect(() => {
+    if (!link || status?.status === 'approved') return;
+    const timer = window.setInterval(() => {
+      api
+        .getDeviceLink(token, link.code)
+        .then(setStatus)
+        .catch((err) => {
+          setError(err instanceof Error ? err.message : 'link code expired');
+          window.clearInterval(timer);
+        });
+    }, 2000);
+    return () => window.clearInterval(timer);
+  }, [token, link, status?.status]);
+
+  async function approve() {
+    if (!link) return;
+    try {
+      const next = await api.approveDeviceLink(token, link.code);
+      approvedRef.current = true;
+      setStatus(next);
+    } catch (err) {
+      setError(err instanceof Error ? err.message : 'failed to approve device');
+    }
+  }
+
+  return (
+    <div className="device-link-panel">
+      {!link && !error && <small>Создаем код...</small>}
+      {link && status?.status !== 'claimed' && status?.status !== 'approved' && (
+        <>
+          <p>Отсканируйте код на новом устройстве, чтобы войти без пароля.</p>
+          {qr && <img src={qr} alt="QR-код для входа" width={240} height={240} />}
+          <small>Код действует до {new Date(link.expires_at).toLocaleTimeString()}.</small>
+        </>
+      )}
+      {status?.status === 'claimed' && (
+        <>
+          <p>Войти на устройстве «{status.device_name}»?</p>
+          <button type="button" onClick={approve}>Разрешить вход</button>
+        </>
+      )}
+      {status?.status === 'approved' && <p>Устройство подключено.</p>}
+      {error && <p className="error">{error}</p>}
+      <button type="button" className="ghost" onClick={onClose}>Закрыть</button>
+    </div>
+  );
+}
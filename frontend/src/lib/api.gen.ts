@@ -0,0 +1,283 @@
+// Code generated by backend/cmd/tsgen; DO NOT EDIT.
+
+export type User = {
+  id: string;
+  email: string;
+  username: string;
+  avatar_url?: string;
+  email_verified: boolean;
+  is_admin?: boolean;
+  is_bot?: boolean;
+  guest_expires_at?: string;
+  created_at: string;
+};
+
+export type Room = {
+  id: string;
+  name: string;
+  created_by: string;
+  avatar_url?: string;
+  is_private: boolean;
+  channel_type?: 'text' | 'voice';
+  group_id?: string;
+  position?: number;
+  my_role?: 'admin' | 'member';
+  can_manage?: boolean;
+  unread_count: number;
+  first_unread_message_id?: number;
+  last_message_at?: string;
+  created_at: string;
+};
+
+export type RoomGroup = {
+  id: string;
+  name: string;
+  created_by: string;
+  can_manage: boolean;
+  created_at: string;
+  text_channels: GroupChannel[];
+  voice_channels: GroupChannel[];
+};
+
+export type GroupChannel = {
+  id: string;
+  name: string;
+  channel_type: 'text' | 'voice';
+  position: number;
+  created_by: string;
+  is_private: boolean;
+  my_role?: 'admin' | 'member';
+  can_manage?: boolean;
+  unread_count: number;
+  first_unread_message_id?: number;
+  created_at: string;
+};
+
+export type Friend = {
+  id: string;
+  username: string;
+  email: string;
+  avatar_url?: string;
+};
+
+export type FriendRequest = {
+  id: number;
+  requester_id: string;
+  addressee_id: string;
+  requester_username: string;
+  requester_avatar_url?: string;
+  addressee_username: string;
+  addressee_avatar_url?: string;
+  status: 'pending' | 'accepted' | 'rejected';
+  created_at: string;
+};
+
+export type RoomMember = {
+  id: string;
+  username: string;
+  avatar_url?: string;
+};
+
+export type Message = {
+  id: number;
+  room_id: string;
+  user_id: string;
+  username: string;
+  avatar_url?: string;
+  content: string;
+  message_type: 'text' | 'image' | 'file' | 'audio' | 'contact';
+  media_url?: string;
+  delivery_state?: string;
+  nsfw?: boolean;
+  withheld?: boolean;
+  audio?: AudioInfo;
+  components?: Component[];
+  contact?: ContactCard;
+  alt_text?: string;
+  alt_text_generated?: boolean;
+  lang?: string;
+  dir?: string;
+  content_masked?: string;
+  created_at: string;
+  client_sent_at?: string;
+  edited_at?: string;
+};
+
+export type Notification = {
+  id: number;
+  user_id: string;
+  kind: string;
+  title: string;
+  body?: string;
+  data: unknown;
+  read_at?: string;
+  created_at: string;
+};
+
+export type LoginEvent = {
+  id: number;
+  ip: string;
+  country?: string;
+  user_agent?: string;
+  created_at: string;
+};
+
+export type EmailChange = {
+  id: number;
+  user_id: string;
+  old_email: string;
+  new_email: string;
+  created_at: string;
+  verified_at?: string;
+};
+
+export type RoomEvent = {
+  seq: number;
+  type: string;
+  user_id?: string;
+  username?: string;
+  message_id?: number;
+  data: unknown;
+  created_at: string;
+};
+
+export type IncomingMessage = {
+  type: string;
+  content: string;
+  before?: number;
+  limit?: number;
+  message_id?: number;
+  speaking?: boolean;
+  signal?: 'offer' | 'answer' | 'ice' | 'hangup';
+  sdp?: string;
+  candidate?: unknown;
+  client_sent_at?: string;
+  client_time?: number;
+};
+
+export type OutgoingMessage = {
+  type: string;
+  seq?: number;
+  message?: MessagePayload;
+  participants?: Participant[];
+  call_users?: Participant[];
+  messages?: MessagePayload[];
+  has_more?: boolean;
+  deleted_message_ids?: number[];
+  room_id?: string;
+  message_id?: number;
+  unread_count?: number;
+  first_unread_message_id?: number;
+  user_id?: string;
+  delivered_up_to?: number;
+  read_up_to?: number;
+  speaking?: boolean;
+  call_id?: string;
+  notification?: Notification;
+  session_version?: number;
+  change?: string;
+  member_count?: number;
+  online?: boolean;
+  rich_presence?: RichPresence[];
+  code?: string;
+  error?: string;
+  max_length?: number;
+  rooms?: RoomState[];
+  board_item?: BoardItem;
+  board_item_id?: number;
+  signal?: 'offer' | 'answer' | 'ice' | 'hangup';
+  sdp?: string;
+  candidate?: unknown;
+  client_time?: number;
+  server_time?: number;
+};
+
+export type MessagePayload = {
+  id: number;
+  room_id: string;
+  user_id: string;
+  username: string;
+  avatar_url?: string;
+  content: string;
+  message_type: 'text' | 'image' | 'file' | 'audio' | 'contact';
+  media_url?: string;
+  ephemeral?: boolean;
+  nsfw?: boolean;
+  withheld?: boolean;
+  audio?: AudioInfo;
+  components?: Component[];
+  contact?: ContactCard;
+  alt_text?: string;
+  alt_text_generated?: boolean;
+  lang?: string;
+  dir?: string;
+  content_masked?: string;
+  delivery_state?: string;
+  created_at: string;
+  client_sent_at?: string;
+  edited_at?: string;
+};
+
+export type Participant = {
+  id: string;
+  username: string;
+  avatar_url?: string;
+};
+
+export type RoomState = {
+  room_id: string;
+  seq: number;
+  last_read_message_id: number;
+  unread_count: number;
+  first_unread_message_id?: number;
+  call_users?: Participant[];
+};
+
+export type AudioInfo = {
+  waveform: number[];
+  duration_ms: number;
+};
+
+export type Component = {
+  type: string;
+  action_id: string;
+  label?: string;
+  value?: string;
+  style?: string;
+  options?: ComponentOption[];
+};
+
+export type ContactCard = {
+  user_id: string;
+  username: string;
+  avatar_url?: string;
+};
+
+export type RichPresence = {
+  user_id: string;
+  source: string;
+  type: 'playing' | 'listening' | 'watching' | 'meeting' | 'custom';
+  text: string;
+  icon_url?: string;
+  expires_at: string;
+  updated_at: string;
+};
+
+export type BoardItem = {
+  id: number;
+  kind: string;
+  message_id?: number;
+  message?: Message;
+  room_name?: string;
+  url?: string;
+  title?: string;
+  note: string;
+  position: number;
+  created_at: string;
+  updated_at: string;
+};
+
+export type ComponentOption = {
+  label: string;
+  value: string;
+};
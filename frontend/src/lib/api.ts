@@ -1,4 +1,4 @@
-import type { Friend, FriendsResponse, Message, Participant, Room, RoomGroup, User, UserProfile } from './types';
+import type { Friend, FriendsResponse, Message, Participant, ProfileField, Room, RoomGroup, User, UserProfile } from './types';
 
 const API_BASE = import.meta.env.VITE_API_BASE_URL || '';
 
@@ -41,19 +41,108 @@ async function request<T>(path: string, options: RequestInit = {}, token?: strin
 export type AuthResult = { token: string; user: User };
 export type RegisterResult = { user: User; requires_email_verification?: boolean };
 export type InviteLinkResult = { token: string; invite_url: string; expires_at: string };
+export type DeviceLink = { code: string; link_url: string; expires_at: string };
+export type DeviceLinkStatus = { status: 'waiting' | 'claimed' | 'approved'; device_name: string; expires_at: string };
+export type DeviceLinkPoll = Partial<AuthResult> & { status?: 'pending'; claim?: string; poll_interval?: number };
+export type AutomodRule = {
+  id: number;
+  room_id: string;
+  kind: 'pattern' | 'links' | 'mentions' | 'newcomer' | 'spam';
+  config: Record<string, unknown>;
+  action: 'block' | 'delete' | 'warn' | 'mute';
+  mute_minutes?: number;
+  enabled: boolean;
+  created_by?: string;
+  created_at: string;
+};
+export type AutomodRuleInput = Pick<AutomodRule, 'kind' | 'config' | 'action' | 'mute_minutes' | 'enabled'>;
+export type AutomodEvent = {
+  id: number;
+  room_id: string;
+  user_id: string;
+  username: string;
+  rule_id?: number;
+  action: AutomodRule['action'];
+  content: string;
+  created_at: string;
+};
+export type JoinRequest = { room_id: string; user_id: string; username: string; avatar_url?: string; created_at: string };
+export type JoinPending = { status: 'pending'; request: JoinRequest };
+export type Subscribed = { status: 'subscribed'; room_id: string; subscriber_count: number };
+export type SubscribedRoom = { id: string; name: string; subscriber_count: number };
+export type BoardItem = {
+  id: number;
+  kind: 'message' | 'link';
+  message_id?: number;
+  message?: Message;
+  room_name?: string;
+  url?: string;
+  title?: string;
+  note: string;
+  position: number;
+  created_at: string;
+  updated_at: string;
+};
+export type BoardItemInput =
+  | { room_id: string; message_id: number; note?: string; title?: string }
+  | { url: string; note?: string; title?: string };
+export type RoomCommand = {
+  id: number;
+  room_id: string;
+  name: string;
+  url: string;
+  description?: string;
+  secret?: string;
+  created_by?: string;
+  created_at: string;
+};
+export type QuietWindow = { start: string; end: string; days?: number[] };
+export type NotificationSettings = {
+  admin_emails: boolean;
+  quiet_hours: { windows: QuietWindow[]; allow_direct_calls: boolean };
+};
+export type InvitePreview = { type: 'room' | 'group'; name?: string; avatar_url?: string; member_count?: number };
+export type MessageContext = { message: Message; before: Message[]; after: Message[]; permalink: string };
+export type Bootstrap = FriendsResponse & {
+  user: User;
+  groups: RoomGroup[];
+  rooms: Room[];
+  dms: Room[];
+  last_messages: Record<string, Message>;
+  feature_flags: Record<string, boolean>;
+  locale: { timezone?: string; locale?: string };
+  max_message_length: number;
+};
 
 export const api = {
   apiBase: API_BASE,
-  register: (email: string, username: string, password: string) =>
+  register: (email: string, username: string, password: string, dateOfBirth?: string) =>
     request<RegisterResult>('/api/auth/register', {
       method: 'POST',
-      body: JSON.stringify({ email, username, password }),
+      body: JSON.stringify({
+        email,
+        username,
+        password,
+        date_of_birth: dateOfBirth || undefined,
+        timezone: Intl.DateTimeFormat().resolvedOptions().timeZone,
+        locale: navigator.language,
+      }),
     }),
   login: (email: string, password: string) =>
     request<AuthResult>('/api/auth/login', {
       method: 'POST',
       body: JSON.stringify({ email, password }),
     }),
+  joinAsGuest: (token: string, username: string) =>
+    request<AuthResult & { room_id: string }>('/api/auth/guest', {
+      method: 'POST',
+      body: JSON.stringify({ token, username }),
+    }),
+  pollDeviceLink: (code: string, claim?: string) =>
+    request<DeviceLinkPoll>(`/api/auth/link/${encodeURIComponent(code)}`, {
+      method: 'POST',
+      body: JSON.stringify({ claim }),
+    }),
   verifyEmail: (email: string, code: string) =>
     request<AuthResult>('/api/auth/verify-email', {
       method: 'POST',
@@ -74,7 +163,26 @@ export const api = {
       method: 'POST',
       body: JSON.stringify({ token, new_password: newPassword }),
     }),
+  confirmEmailChange: (token: string) =>
+    request<{ email: string }>('/api/auth/confirm-email-change', {
+      method: 'POST',
+      body: JSON.stringify({ token }),
+    }),
+  revertEmailChange: (token: string) =>
+    request<{ email: string; reverted: boolean }>('/api/auth/revert-email-change', {
+      method: 'POST',
+      body: JSON.stringify({ token }),
+    }),
   me: (token: string) => request<User>('/api/me', {}, token),
+  updateProfile: (token: string, profile: Record<string, string | null>) =>
+    request<User>('/api/me', { method: 'PATCH', body: JSON.stringify({ profile }) }, token),
+  listProfileFields: (token: string) => request<{ fields: ProfileField[] }>('/api/profile-fields', {}, token),
+  bootstrap: (token: string) => request<Bootstrap>('/api/bootstrap', {}, token),
+  changePassword: (token: string, currentPassword: string, newPassword: string) =>
+    request<AuthResult>('/api/me/password', {
+      method: 'POST',
+      body: JSON.stringify({ current_password: currentPassword, new_password: newPassword }),
+    }, token),
   uploadMyAvatar: async (token: string, image: File) => {
     const formData = new FormData();
     formData.set('image', image);
@@ -86,6 +194,23 @@ export const api = {
       method: 'POST',
       body: JSON.stringify({ name }),
     }, token),
+  cloneRoom: (token: string, roomID: string, name: string, members: boolean) =>
+    request<Room>(`/api/rooms/${roomID}/clone`, {
+      method: 'POST',
+      body: JSON.stringify({ name, members }),
+    }, token),
+  listRoomCommands: (token: string, roomID: string) =>
+    request<{ commands: RoomCommand[] }>(`/api/rooms/${roomID}/commands`, {}, token),
+  createRoomCommand: (token: string, roomID: string, command: { name: string; url: string; description?: string }) =>
+    request<RoomCommand>(`/api/rooms/${roomID}/commands`, { method: 'POST', body: JSON.stringify(command) }, token),
+  deleteRoomCommand: (token: string, roomID: string, name: string) =>
+    request<{ ok: boolean }>(`/api/rooms/${roomID}/commands/${encodeURIComponent(name)}`, { method: 'DELETE' }, token),
+  interactWithMessage: (token: string, roomID: string, messageID: number, actionID: string, value?: string) =>
+    request<{ ok: boolean }>(
+      `/api/rooms/${roomID}/messages/${messageID}/interactions`,
+      { method: 'POST', body: JSON.stringify({ action_id: actionID, value }) },
+      token,
+    ),
   inviteToRoom: (token: string, roomID: string, userID: string) =>
     request<{ ok: boolean }>(
       `/api/rooms/${roomID}/invite`,
@@ -94,8 +219,104 @@ export const api = {
     ),
   createInviteLink: (token: string, roomID: string) =>
     request<InviteLinkResult>(`/api/rooms/${roomID}/invite-link`, { method: 'POST' }, token),
+  createDeviceLink: (token: string) => request<DeviceLink>('/api/me/device-links', { method: 'POST' }, token),
+  getDeviceLink: (token: string, code: string) =>
+    request<DeviceLinkStatus>(`/api/me/device-links/${encodeURIComponent(code)}`, {}, token),
+  approveDeviceLink: (token: string, code: string) =>
+    request<DeviceLinkStatus>(`/api/me/device-links/${encodeURIComponent(code)}/approve`, { method: 'POST' }, token),
+  cancelDeviceLink: (token: string, code: string) =>
+    request<{ ok: boolean }>(`/api/me/device-links/${encodeURIComponent(code)}`, { method: 'DELETE' }, token),
+  getMentionPolicy: (token: string, roomID: string) =>
+    request<{ policy: 'admins' | 'members' | 'off' }>(`/api/rooms/${roomID}/mention-policy`, {}, token),
+  setMentionPolicy: (token: string, roomID: string, policy: 'admins' | 'members' | 'off') =>
+    request<{ policy: string }>(`/api/rooms/${roomID}/mention-policy`, { method: 'PUT', body: JSON.stringify({ policy }) }, token),
+  listAutomodRules: (token: string, roomID: string) =>
+    request<{ rules: AutomodRule[] }>(`/api/rooms/${roomID}/automod/rules`, {}, token),
+  createAutomodRule: (token: string, roomID: string, rule: AutomodRuleInput) =>
+    request<AutomodRule>(`/api/rooms/${roomID}/automod/rules`, { method: 'POST', body: JSON.stringify(rule) }, token),
+  updateAutomodRule: (token: string, roomID: string, ruleID: number, rule: AutomodRuleInput) =>
+    request<AutomodRule>(`/api/rooms/${roomID}/automod/rules/${ruleID}`, { method: 'PUT', body: JSON.stringify(rule) }, token),
+  deleteAutomodRule: (token: string, roomID: string, ruleID: number) =>
+    request<{ ok: boolean }>(`/api/rooms/${roomID}/automod/rules/${ruleID}`, { method: 'DELETE' }, token),
+  listAutomodEvents: (token: string, roomID: string, limit = 50) =>
+    request<{ events: AutomodEvent[] }>(`/api/rooms/${roomID}/automod/events?limit=${limit}`, {}, token),
+  unmuteRoomMember: (token: string, roomID: string, userID: string) =>
+    request<{ ok: boolean }>(`/api/rooms/${roomID}/automod/mutes/${userID}`, { method: 'DELETE' }, token),
+  getRoomNSFW: (token: string, roomID: string) => request<{ nsfw: boolean }>(`/api/rooms/${roomID}/nsfw`, {}, token),
+  setRoomNSFW: (token: string, roomID: string, nsfw: boolean) =>
+    request<{ nsfw: boolean }>(`/api/rooms/${roomID}/nsfw`, { method: 'PUT', body: JSON.stringify({ nsfw }) }, token),
+  getContentSettings: (token: string) => request<{ hide_nsfw: boolean }>('/api/me/content-settings', {}, token),
+  setContentSettings: (token: string, settings: { hide_nsfw: boolean }) =>
+    request<{ hide_nsfw: boolean }>('/api/me/content-settings', { method: 'PUT', body: JSON.stringify(settings) }, token),
+  getNotificationSettings: (token: string) => request<NotificationSettings>('/api/me/notification-settings', {}, token),
+  setNotificationSettings: (token: string, settings: Partial<NotificationSettings>) =>
+    request<NotificationSettings>('/api/me/notification-settings', { method: 'PUT', body: JSON.stringify(settings) }, token),
+  getCallChatSettings: (token: string, roomID: string) =>
+    request<{ persist: boolean }>(`/api/rooms/${roomID}/call-chat`, {}, token),
+  setCallChatSettings: (token: string, roomID: string, persist: boolean) =>
+    request<{ persist: boolean }>(`/api/rooms/${roomID}/call-chat`, { method: 'PUT', body: JSON.stringify({ persist }) }, token),
+  submitCallFeedback: (
+    token: string,
+    roomID: string,
+    feedback: { call_id: string; rating: number; tags: string[]; client_version: string },
+  ) =>
+    request<{ ok: boolean }>(`/api/rooms/${roomID}/call-feedback`, { method: 'POST', body: JSON.stringify(feedback) }, token),
+  getRoomRegion: (token: string, roomID: string) =>
+    request<{ region: string; available: string[] }>(`/api/rooms/${roomID}/region`, {}, token),
+  setRoomRegion: (token: string, roomID: string, region: string) =>
+    request<{ region: string }>(`/api/rooms/${roomID}/region`, { method: 'PUT', body: JSON.stringify({ region }) }, token),
+  getMyQuota: (token: string) =>
+    request<{
+      plan: string;
+      limits: { max_rooms: number; max_room_members: number; max_upload_bytes: number; history_days: number };
+      usage: { rooms: number };
+    }>('/api/me/quota', {}, token),
+  getMyBilling: (token: string) =>
+    request<{
+      enabled: boolean;
+      subscription: { id: string; status: string; plan?: string; current_period_end?: string; cancel_at_period_end: boolean } | null;
+    }>('/api/me/billing', {}, token),
+  getMyAge: (token: string) =>
+    request<{ date_of_birth?: string; restricted: boolean }>('/api/me/age', {}, token),
+  getRaidMode: (token: string, roomID: string) => request<{ enabled: boolean }>(`/api/rooms/${roomID}/raid-mode`, {}, token),
+  setRaidMode: (token: string, roomID: string, enabled: boolean) =>
+    request<{ enabled: boolean }>(`/api/rooms/${roomID}/raid-mode`, { method: 'PUT', body: JSON.stringify({ enabled }) }, token),
+  listJoinRequests: (token: string, roomID: string) =>
+    request<{ requests: JoinRequest[] }>(`/api/rooms/${roomID}/join-requests`, {}, token),
+  approveJoinRequest: (token: string, roomID: string, userID: string) =>
+    request<{ ok: boolean }>(`/api/rooms/${roomID}/join-requests/${userID}/approve`, { method: 'POST' }, token),
+  rejectJoinRequest: (token: string, roomID: string, userID: string) =>
+    request<{ ok: boolean }>(`/api/rooms/${roomID}/join-requests/${userID}`, { method: 'DELETE' }, token),
+  createGuestLink: (token: string, roomID: string, days: number) =>
+    request<{ token: string; guest_url: string; expires_at: string; guest_days: number }>(
+      `/api/rooms/${roomID}/guest-links`,
+      { method: 'POST', body: JSON.stringify({ days }) },
+      token,
+    ),
+  previewInviteLink: (inviteToken: string) =>
+    request<InvitePreview>(`/api/invite-links/${encodeURIComponent(inviteToken)}/preview`),
+  getRoomUnlisted: (token: string, roomID: string) => request<{ enabled: boolean }>(`/api/rooms/${roomID}/unlisted`, {}, token),
+  setRoomUnlisted: (token: string, roomID: string, enabled: boolean) =>
+    request<{ enabled: boolean }>(`/api/rooms/${roomID}/unlisted`, { method: 'PUT', body: JSON.stringify({ enabled }) }, token),
+  getRoomBroadcast: (token: string, roomID: string) =>
+    request<{ enabled: boolean; subscriber_count: number; subscribed: boolean; publisher: boolean }>(`/api/rooms/${roomID}/broadcast`, {}, token),
+  setRoomBroadcast: (token: string, roomID: string, enabled: boolean) =>
+    request<{ enabled: boolean }>(`/api/rooms/${roomID}/broadcast`, { method: 'PUT', body: JSON.stringify({ enabled }) }, token),
+  subscribeRoom: (token: string, roomID: string) => request<Subscribed>(`/api/rooms/${roomID}/subscription`, { method: 'POST' }, token),
+  unsubscribeRoom: (token: string, roomID: string) =>
+    request<{ ok: boolean }>(`/api/rooms/${roomID}/subscription`, { method: 'DELETE' }, token),
+  listSubscriptions: (token: string) => request<{ rooms: SubscribedRoom[] }>('/api/me/subscriptions', {}, token),
+  listBoard: (token: string) => request<{ items: BoardItem[] }>('/api/me/board', {}, token),
+  addBoardItem: (token: string, item: BoardItemInput) =>
+    request<BoardItem>('/api/me/board', { method: 'POST', body: JSON.stringify(item) }, token),
+  updateBoardItem: (token: string, itemID: number, changes: { note?: string; title?: string }) =>
+    request<BoardItem>(`/api/me/board/${itemID}`, { method: 'PATCH', body: JSON.stringify(changes) }, token),
+  deleteBoardItem: (token: string, itemID: number) =>
+    request<{ ok: boolean }>(`/api/me/board/${itemID}`, { method: 'DELETE' }, token),
+  reorderBoard: (token: string, itemIDs: number[]) =>
+    request<{ ok: boolean }>('/api/me/board/order', { method: 'PUT', body: JSON.stringify({ item_ids: itemIDs }) }, token),
   joinByInviteLink: (token: string, inviteToken: string) =>
-    request<Room>(`/api/invite-links/${encodeURIComponent(inviteToken)}/join`, { method: 'POST' }, token),
+    request<Room | JoinPending | Subscribed>(`/api/invite-links/${encodeURIComponent(inviteToken)}/join`, { method: 'POST' }, token),
   joinRoom: (token: string, roomID: string) =>
     request<{ joined: boolean }>(`/api/rooms/${roomID}/join`, { method: 'POST' }, token),
   renameRoom: (token: string, roomID: string, name: string) =>
@@ -106,6 +327,18 @@ export const api = {
     request<{ ok: boolean }>(`/api/rooms/${roomID}/leave`, { method: 'POST' }, token),
   listMessages: (token: string, roomID: string, limit = 50) =>
     request<Message[]>(`/api/rooms/${roomID}/messages?limit=${limit}`, {}, token),
+  sendMessage: (token: string, roomID: string, content: string, idempotencyKey: string, clientSentAt?: string) =>
+    request<Message | { command: true }>(
+      `/api/rooms/${roomID}/messages`,
+      {
+        method: 'POST',
+        headers: { 'Idempotency-Key': idempotencyKey },
+        body: JSON.stringify({ content, client_sent_at: clientSentAt }),
+      },
+      token,
+    ),
+  resolvePermalink: (token: string, roomID: string, messageID: string) =>
+    request<MessageContext & { room: Room }>(`/api/permalinks/${roomID}/${messageID}`, {}, token),
   listCallParticipants: (token: string, roomID: string) =>
     request<Participant[]>(`/api/rooms/${roomID}/call-participants`, {}, token),
   uploadRoomImage: async (token: string, roomID: string, image: File, caption: string) => {
@@ -114,6 +347,23 @@ export const api = {
     if (caption.trim()) formData.set('caption', caption.trim());
     return request<Message>(`/api/rooms/${roomID}/images`, { method: 'POST', body: formData }, token);
   },
+  uploadVoiceNote: async (token: string, roomID: string, audio: Blob) => {
+    const formData = new FormData();
+    formData.set('audio', audio);
+    return request<Message>(`/api/rooms/${roomID}/voice`, { method: 'POST', body: formData }, token);
+  },
+  presignUpload: (token: string, roomID: string, contentType: string, size: number) =>
+    request<{ key: string; url: string; fields: Record<string, string>; expires_at: string; complete_url: string }>(
+      `/api/rooms/${roomID}/uploads/presign`,
+      { method: 'POST', body: JSON.stringify({ content_type: contentType, size }) },
+      token,
+    ),
+  completeUpload: (token: string, roomID: string, key: string, caption: string) =>
+    request<Message>(
+      `/api/rooms/${roomID}/uploads/complete`,
+      { method: 'POST', body: JSON.stringify({ key, caption }) },
+      token,
+    ),
   liveKitToken: (token: string, roomID: string) =>
     request<{ token: string; livekit_url: string; room_name: string }>(
       `/api/rooms/${roomID}/livekit-token`,
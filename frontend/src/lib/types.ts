@@ -1,3 +1,5 @@
+import type * as gen from './api.gen';
+
 export type User = {
   id: string;
   email: string;
@@ -5,6 +7,20 @@ export type User = {
   avatar_url?: string;
   email_verified?: boolean;
   created_at: string;
+  // Extra profile fields defined by the deployment, keyed by field.
+  profile?: Record<string, string>;
+  timezone?: string;
+  locale?: string;
+};
+
+export type ProfileField = {
+  key: string;
+  label: string;
+  type: 'text' | 'select' | 'url' | 'timezone';
+  options?: string[];
+  max_length?: number;
+  position: number;
+  builtin?: boolean;
 };
 
 export type Room = {
@@ -28,8 +44,13 @@ export type Message = {
   username: string;
   avatar_url?: string;
   content: string;
-  message_type: 'text' | 'image';
+  message_type: 'text' | 'image' | 'file' | 'audio' | 'system';
   media_url?: string;
+  nsfw?: boolean;
+  withheld?: boolean;
+  audio?: { waveform: number[]; duration_ms: number };
+  lang?: string;
+  dir?: 'ltr' | 'rtl';
   created_at: string;
 };
 
@@ -69,6 +90,7 @@ export type UserProfile = {
   avatar_url?: string;
   created_at: string;
   is_friend: boolean;
+  profile?: Record<string, string>;
 };
 
 export type GroupChannel = {
@@ -92,3 +114,19 @@ export type RoomGroup = {
   text_channels: GroupChannel[];
   voice_channels: GroupChannel[];
 };
+
+// Drift check: each payload generated from the Go structs (api.gen.ts, see
+// backend/cmd/tsgen) must still satisfy the type the UI reads it as, so a
+// backend change that breaks the frontend fails type-checking.
+type Assert<T extends true> = T;
+type Satisfies<Wire, Local> = Wire extends Local ? true : false;
+export type PayloadDriftCheck = [
+  Assert<Satisfies<gen.User, User>>,
+  Assert<Satisfies<gen.Room, Room>>,
+  Assert<Satisfies<gen.Message, Message>>,
+  Assert<Satisfies<gen.Participant, Participant>>,
+  Assert<Satisfies<gen.Friend, Friend>>,
+  Assert<Satisfies<gen.FriendRequest, FriendRequest>>,
+  Assert<Satisfies<gen.GroupChannel, GroupChannel>>,
+  Assert<Satisfies<gen.RoomGroup, RoomGroup>>,
+];